@@ -2,14 +2,26 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"html"
 	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
 
+	"github.com/ha1tch/tgpiler/dacpac"
+	"github.com/ha1tch/tgpiler/lint"
 	"github.com/ha1tch/tgpiler/protogen"
 	"github.com/ha1tch/tgpiler/storage"
 	"github.com/ha1tch/tgpiler/transpiler"
@@ -67,8 +79,8 @@ func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
 	fs.SetOutput(stderr)
 
 	var (
-		inputDir       = fs.String("d", "", "Read all .sql files from directory")
-		inputDirL      = fs.String("dir", "", "Read all .sql files from directory")
+		inputDir       = fs.String("d", "", "Read all .sql files from directory, or the routines of a .dacpac")
+		inputDirL      = fs.String("dir", "", "Read all .sql files from directory, or the routines of a .dacpac")
 		readStdin      = fs.Bool("s", false, "Read from stdin")
 		readStdinL     = fs.Bool("stdin", false, "Read from stdin")
 		output         = fs.String("o", "", "Write to single output file")
@@ -84,13 +96,22 @@ func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
 		storeVar       = fs.String("store", "r.db", "Store variable name for DML operations")
 		receiver       = fs.String("receiver", "r", "Receiver variable name for generated methods (empty for standalone functions)")
 		receiverType   = fs.String("receiver-type", "*Repository", "Receiver type for generated methods")
+		style          = fs.String("style", "methods", "Generation style: methods, functions (default: methods)")
+		goVersion      = fs.String("go-version", "", "Target Go version for generated code, e.g. 1.22 (default: conservative baseline)")
 		preserveGo     = fs.Bool("preserve-go", false, "Don't strip GO batch separators (default: strip them)")
+		script         = fs.Bool("script", false, "Transpile statements outside procedures into one function named after the file")
+		jobs           = fs.Bool("jobs", false, "Input is SQL Server Agent jobs (msdb script or JSON); generate their steps and job runners")
 		sequenceMode   = fs.String("sequence-mode", "db", "Sequence handling: db, uuid, stub (default: db)")
 		newidMode      = fs.String("newid", "app", "NEWID() handling: app, db, grpc, mock, stub (default: app)")
 		idServiceVar   = fs.String("id-service", "", "gRPC client variable for --newid=grpc")
 		skipDDL        = fs.Bool("skip-ddl", true, "Skip DDL statements with warning (default: true)")
 		strictDDL      = fs.Bool("strict-ddl", false, "Fail on any DDL statement")
 		extractDDL     = fs.String("extract-ddl", "", "Extract skipped DDL to separate file")
+		schemaPath     = fs.String("schema", "", "CREATE TABLE/TYPE script, directory or .dacpac; computed/identity columns are dropped from INSERT/UPDATE, table types declare TVPs")
+		typesFile      = fs.String("types-file", "", "CREATE TYPE ... AS TABLE script; writes the table types to table_types.go for procedures to share")
+		constantsFile  = fs.String("constants", "", "Constants file naming status strings and codes; writes them to constants.go and refers to them")
+		namingConfig   = fs.String("naming-config", "", "Naming config: extra words for splitting identifiers, acronyms, and Go names for identifiers")
+		verbsFile      = fs.String("verbs-file", "", "Verbs file adding and removing verbs of inferred gRPC method names and procedure mappings")
 		useSPLogger    = fs.Bool("splogger", false, "Use SPLogger for CATCH block error logging")
 		spLoggerVar    = fs.String("logger", "spLogger", "SPLogger variable name")
 		spLoggerType   = fs.String("logger-type", "slog", "SPLogger type: slog, db, file, multi, nop")
@@ -98,16 +119,66 @@ func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
 		spLoggerFile   = fs.String("logger-file", "", "File path for file logger")
 		spLoggerFormat = fs.String("logger-format", "json", "Format for file logger: json, text")
 		genLoggerInit  = fs.Bool("logger-init", false, "Generate SPLogger initialization code")
+		execStats      = fs.Bool("exec-stats", false, "Record per-procedure execution statistics in tsqlruntime.ProcStats")
+		metrics        = fs.Bool("metrics", false, "Record per-procedure call counts and latencies through a tsqlruntime.Metrics")
+		metricsVar     = fs.String("metrics-recorder", "r.metrics", "tsqlruntime.Metrics variable name for --metrics")
+		timeout        = fs.Duration("timeout", 0, "Deadline for generated procedures (e.g. 30s); loops also check for cancellation")
+		timeoutScope   = fs.String("timeout-scope", "procedure", "What --timeout bounds: procedure, statement")
+		retry          = fs.Int("retry", 0, "Retry transactions failing with transient errors, up to this many attempts")
+		retryBackoff   = fs.Duration("retry-backoff", 100*time.Millisecond, "Delay before the first --retry, doubled for each after")
+		retryOn        = fs.String("retry-on", "", "Extra retryable error codes, comma-separated (e.g. 1222,40613 or 55P03)")
+		otel           = fs.Bool("otel", false, "Trace each procedure and its SQL and gRPC calls through a tsqlruntime.Tracer")
+		tracerVar      = fs.String("tracer", "r.tracer", "tsqlruntime.Tracer variable name for --otel")
+		udfMode        = fs.String("udf-mode", "keep", "Scalar UDF calls inside queries: keep, compute (default: keep)")
+		udfOverrides   = fs.String("udf-override", "", "Per-function UDF modes (format: fn_Name:compute,fn_Other:keep)")
+		allowAnyScan   = fs.Bool("allow-any-scan", false, "Scan columns of unknown type into interface{} instead of string")
+		nullMode       = fs.String("null-mode", "", "Go types for nullable parameters and columns: zero, sqlnull, pointer (default: zero)")
+		decimalMode    = fs.String("decimal-mode", "shopspring", "Go type for DECIMAL/NUMERIC/MONEY: shopspring, string, float, apd")
+		timeMode       = fs.String("time-mode", "local", "Clock GETDATE()/SYSDATETIME() read: local, utc")
+		nolockStrategy = fs.String("nolock-strategy", "comment", "NOLOCK/READUNCOMMITTED hints: comment, ignore, read-uncommitted-tx")
+		tryCatchMode   = fs.String("trycatch-mode", "iife", "TRY/CATCH translation: iife, errors")
+		printMode      = fs.String("print-mode", "fmt", "PRINT translation: fmt, slog, discard")
+		spatialMode    = fs.String("spatial-mode", "wkt", "GEOMETRY/GEOGRAPHY values: wkt, postgis")
+		securityReport = fs.Bool("security-report", false, "Report variables concatenated into dynamic SQL")
+		sideEffectsReport = fs.Bool("side-effects-report", false, "Report mail and events that need real implementations")
+		performanceReport = fs.Bool("performance-report", false, "Report RECOMPILE, OPTIMIZE FOR and other plan hints")
+		reportFile       = fs.String("report", "", "Write a migration report of the run to this file, HTML if it ends in .html, else Markdown")
+		configFile       = fs.String("config", defaultConfigFile, "File of flag defaults, one \"flag: value\" per line")
+		applySuggest     = fs.Bool("apply-suggestions", false, "Write suggested fixes into the --config file")
+		transliterate  = fs.Bool("transliterate", false, "Transliterate accented letters in Go identifiers to ASCII")
+		stream         = fs.Bool("stream", false, "Transpile each input a GO batch at a time, bounding memory on huge files (requires --dml)")
+		watch          = fs.Bool("watch", false, "With -d and -O, transpile each SQL file again when it's saved and print a diff of its Go code")
+		manifestFile   = fs.String("manifest", "", "After the run, write a JSON manifest of the sources read and files written to this file")
+		diagnosticsFormat = fs.String("diagnostics", "text", "Format of warnings and suggestions: text, json, sarif")
+		diagnosticsFile = fs.String("diagnostics-file", "", "Write --diagnostics=json or sarif to this file instead of stderr")
+		werror          = fs.Bool("werror", false, "Exit with status 2 if there are any warnings")
+		maxWarnings     = fs.Int("max-warnings", -1, "Exit with status 2 if there are more warnings than this")
+		failOn          = fs.String("fail-on", "", "Exit with status 2 on any warning of these rules (format: rule,rule)")
 		// Backend options
-		backend         = fs.String("backend", "sql", "Backend type: sql, grpc, mock, inline")
+		backend         = fs.String("backend", "sql", "Backend type: sql, grpc, mock, inline, mongo, redis, procedure-call")
 		fallbackBackend = fs.String("fallback-backend", "", "Fallback backend for temp tables: sql, mock (default: sql)")
+		tableBackend    = fs.String("table-backend", "", "Per-table backends (format: Table:backend,#tmp:backend)")
+		rowsMode        = fs.String("rows", "slice", "Result sets of procedure-call wrappers: slice, callback, iter")
 		grpcClient      = fs.String("grpc-client", "client", "gRPC client variable name")
 		grpcPackage   = fs.String("grpc-package", "", "Import path for generated gRPC package")
+		enumOverrides = fs.String("enum-overrides", "", "Literal-to-enum overrides for proto enum fields (needs --proto or --proto-dir)")
 		mockStore     = fs.String("mock-store", "store", "Mock store variable name")
+		tableCollection = fs.String("table-collection", "", "Table-to-collection mappings for --backend=mongo (format: Table:coll,Table:coll)")
+		mongoDB       = fs.String("mongo-db", "", "*mongo.Database variable for tables routed to mongo (default: --store)")
+		redisClient   = fs.String("redis-client", "r.redis", "go-redis client variable name for --backend=redis")
+		redisKeys     = fs.String("redis-key", "", "Key columns for --backend=redis (format: Table:Column,Table:Column)")
+		tableEvent    = fs.String("table-event", "", "Publish INSERTs into these tables as events (format: Table:topic,Table:topic)")
+		eventKey      = fs.String("event-key", "", "Message key columns for --table-event (format: Table:Column,Table:Column)")
+		eventPublisher = fs.String("event-publisher", "r.events", "tsqlruntime.EventPublisher variable name for --table-event")
+		notifier       = fs.String("notifier", "r.notifier", "tsqlruntime.Notifier variable name for sp_send_dbmail/xp_sendmail")
 		// gRPC mapping options
 		tableService  = fs.String("table-service", "", "Table-to-service mappings (format: Table:Service,Table:Service)")
 		tableClient   = fs.String("table-client", "", "Table-to-client mappings (format: Table:client,Table:client)")
 		grpcMappings  = fs.String("grpc-mappings", "", "Procedure-to-method mappings (format: proc:Service.Method,proc:Service.Method)")
+		modulePath    = fs.String("module-path", "", "Import path of the output root; other generated packages are imported from under it")
+		packagePath   = fs.String("package-path", "", "Import paths of packages the code refers to (format: pkg:import/path,pkg:import/path)")
+		schemaPackage = fs.String("schema-package", "", "Package each SQL schema's procedures are generated into (format: Schema:pkg,Schema:pkg)")
+		passthrough   = fs.String("passthrough", "", "Procedures not migrated yet, called in the database through generated stubs (format: proc,proc)")
 		// Proto/gRPC generation options
 		protoFile     = fs.String("proto", "", "Proto file for gRPC operations")
 		protoDir      = fs.String("proto-dir", "", "Directory of proto files")
@@ -115,10 +186,35 @@ func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
 		serviceName   = fs.String("service", "", "Target service name (defaults to all)")
 		genServer     = fs.Bool("gen-server", false, "Generate gRPC server stubs from proto")
 		genImpl       = fs.Bool("gen-impl", false, "Generate repository implementations with procedure mappings")
+		implPkgDirs   = fs.Bool("impl-package-dirs", false, "With --gen-impl -O, put each service in its own package subdirectory")
 		genMock       = fs.Bool("gen-mock", false, "Generate mock server code")
 		showMappings  = fs.Bool("show-mappings", false, "Display procedure-to-method mappings")
-		outputFormat  = fs.String("output-format", "text", "Output format for --show-mappings (text, json, markdown, html)")
+		mappingDiff   = fs.String("diff", "", "With --show-mappings, compare with the mappings of an earlier --output-format json run")
+		outputFormat  = fs.String("output-format", "text", "Output format for --show-mappings (text, json, markdown, html), --cluster-report (text, json, html) --feature-matrix (text, csv, json), --analyze and --dry-run (text, json)")
+		// Contract extraction
+		genContracts    = fs.Bool("gen-contracts", false, "Emit procedure contracts instead of Go code")
+		contractsFormat = fs.String("contracts-format", "json", "Contract format: json, yaml")
+		// REST generation
+		genREST       = fs.Bool("gen-rest", false, "Generate net/http JSON handlers for every procedure")
+		openAPIFile   = fs.String("openapi", "", "Write an OpenAPI 3 spec for the --gen-rest handlers to this file")
+		restBasePath  = fs.String("rest-base-path", "", "Path prefix for --gen-rest endpoints (e.g. /api)")
+		restRouter    = fs.String("router", protogen.RouterMux, "Router the --gen-rest handlers register with: mux, chi")
+		genHTTP       = fs.Bool("gen-http-handlers", false, "Same as --gen-rest")
+		// Service decomposition
+		clusterReport    = fs.Bool("cluster-report", false, "Suggest services by clustering procedures on shared tables and calls")
+		clusterThreshold = fs.Float64("cluster-threshold", transpiler.DefaultClusterOptions().Threshold, "Lowest similarity (0-1) at which --cluster-report merges procedures")
+		// Migration planning
+		featureMatrix = fs.Bool("feature-matrix", false, "List the features each procedure uses (cursors, temp tables, transactions, ...)")
+		analyze       = fs.Bool("analyze", false, "Score each procedure's complexity and suggest a migration order, without generating Go code")
+		dryRun        = fs.Bool("dry-run", false, "Transpile without writing code, reporting the share of each file's statements handled")
+		// Repository scaffolding
+		genRepo       = fs.Bool("gen-repo", false, "Also generate the Repository struct, constructor and interface")
+		genInterface  = fs.Bool("gen-interface", false, "Also generate an interface of the generated methods")
+		mockKind      = fs.String("mock", "", "Mock for --gen-interface: gomock, moq or func")
+		// Lint
+		lintDir       = fs.String("lint", "", "Check a directory of generated Go code for cross-file drift")
 		warnThreshold = fs.Int("warn-threshold", 50, "Confidence threshold (%) for low-confidence warnings (0-100)")
+		mappingWeights = fs.String("mapping-weights", "", "Weights of the --show-mappings strategies (naming=2,types=0.5); 0 leaves one out")
 		showHelp       = fs.Bool("h", false, "Show help")
 		helpL          = fs.Bool("help", false, "Show help")
 		showVer        = fs.Bool("v", false, "Show version")
@@ -136,6 +232,10 @@ func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
 	if err := fs.Parse(args); err != nil {
 		return 2
 	}
+	if err := loadConfigFile(fs, *configFile); err != nil {
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		return 2
+	}
 
 	// Coalesce short and long flags
 	if *inputDirL != "" {
@@ -186,13 +286,13 @@ func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
 
 	// Show help if no input specified (and not in proto generation mode)
 	protoGenMode := *genServer || *genImpl || *genMock || *showMappings
-	if inputFile == "" && *inputDir == "" && !*readStdin && !protoGenMode {
+	if inputFile == "" && *inputDir == "" && !*readStdin && !protoGenMode && *lintDir == "" && *typesFile == "" {
 		printUsage(stdout)
 		return 0
 	}
 
 	// Validate flag combinations
-	if err := validateFlags(inputFile, *inputDir, *readStdin, *output, *outDir); err != nil {
+	if err := validateFlags(inputFile, *inputDir, *readStdin, *output, *outDir, *genImpl); err != nil {
 		fmt.Fprintf(stderr, "error: %v\n", err)
 		return 2
 	}
@@ -211,43 +311,122 @@ func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
 		storeVar:       *storeVar,
 		receiver:       *receiver,
 		receiverType:   *receiverType,
+		style:          *style,
+		goVersion:      *goVersion,
 		preserveGo:     *preserveGo,
 		sequenceMode:   *sequenceMode,
 		newidMode:      *newidMode,
 		idServiceVar:   *idServiceVar,
+		script:         *script,
+		jobs:           *jobs,
 		skipDDL:        *skipDDL,
 		strictDDL:      *strictDDL,
 		extractDDL:      *extractDDL,
+		schemaPath:      *schemaPath,
+		typesFile:       *typesFile,
+		constantsFile:   *constantsFile,
+		namingConfig:    *namingConfig,
+		verbsFile:       *verbsFile,
 		useSPLogger:     *useSPLogger,
+		execStats:       *execStats,
+		metrics:         *metrics,
+		metricsVar:      *metricsVar,
+		timeout:         *timeout,
+		timeoutScope:    *timeoutScope,
+		retry:           *retry,
+		retryBackoff:    *retryBackoff,
+		retryOn:         *retryOn,
+		otel:            *otel,
+		tracerVar:       *tracerVar,
 		spLoggerVar:     *spLoggerVar,
 		spLoggerType:    *spLoggerType,
 		spLoggerTable:   *spLoggerTable,
 		spLoggerFile:    *spLoggerFile,
 		spLoggerFormat:  *spLoggerFormat,
 		genLoggerInit:   *genLoggerInit,
+		udfMode:         *udfMode,
+		udfOverrides:    *udfOverrides,
+		allowAnyScan:    *allowAnyScan,
+		nullMode:        *nullMode,
+		decimalMode:     *decimalMode,
+		timeMode:        *timeMode,
+		nolockStrategy:  *nolockStrategy,
+		tryCatchMode:    *tryCatchMode,
+		printMode:       *printMode,
+		spatialMode:     *spatialMode,
 		backend:         *backend,
 		fallbackBackend: *fallbackBackend,
+		tableBackend:    *tableBackend,
+		rowsMode:        *rowsMode,
 		grpcClient:      *grpcClient,
 		grpcPackage:    *grpcPackage,
+		enumOverrides:  *enumOverrides,
 		mockStore:      *mockStore,
+		tableCollection: *tableCollection,
+		mongoDB:        *mongoDB,
+		redisClient:    *redisClient,
+		redisKeys:      *redisKeys,
+		tableEvent:     *tableEvent,
+		eventKey:       *eventKey,
+		eventPublisher: *eventPublisher,
+		notifier:       *notifier,
 		tableService:   *tableService,
 		tableClient:    *tableClient,
 		grpcMappings:   *grpcMappings,
+		modulePath:     *modulePath,
+		packagePath:    *packagePath,
+		schemaPackage:  *schemaPackage,
+		passthrough:    *passthrough,
 		protoFile:      *protoFile,
 		protoDir:       *protoDir,
 		sqlDir:         *sqlDir,
 		serviceName:    *serviceName,
 		genServer:      *genServer,
 		genImpl:        *genImpl,
+		implPkgDirs:    *implPkgDirs,
 		genMock:        *genMock,
 		showMappings:   *showMappings,
+		mappingDiff:    *mappingDiff,
 		outputFormat:   *outputFormat,
+		genContracts:   *genContracts,
+		contractsFormat: *contractsFormat,
+		genREST:        *genREST || *genHTTP,
+		openAPIFile:    *openAPIFile,
+		restBasePath:   *restBasePath,
+		restRouter:     *restRouter,
+		clusterReport:    *clusterReport,
+		clusterThreshold: *clusterThreshold,
+		featureMatrix:    *featureMatrix,
+		analyze:          *analyze,
+		dryRun:           *dryRun,
+		genRepo:        *genRepo,
+		genInterface:   *genInterface,
+		mockKind:       *mockKind,
+		lintDir:        *lintDir,
+		securityReport: *securityReport,
+		sideEffectsReport: *sideEffectsReport,
+		performanceReport: *performanceReport,
+		reportFile:        *reportFile,
+		configFile:        *configFile,
+		applySuggestions:  *applySuggest,
+		diagnosticsFormat: *diagnosticsFormat,
+		diagnosticsFile:   *diagnosticsFile,
+		werror:            *werror,
+		maxWarnings:       *maxWarnings,
+		failOn:            *failOn,
+		transliterate:  *transliterate,
+		stream:         *stream,
+		watch:          *watch,
 		warnThreshold:  *warnThreshold,
+		mappingWeights: *mappingWeights,
 		annotateLevel:  annotate.Level(),
 		stdin:          stdin,
 		stdout:         stdout,
 		stderr:         stderr,
 	}
+	if *manifestFile != "" {
+		cfg.manifest = &manifest{Tgpiler: version, ConfigHash: configHash(fs)}
+	}
 
 	if err := execute(cfg); err != nil {
 		fmt.Fprintf(stderr, "error: %v\n", err)
@@ -265,9 +444,57 @@ func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
 			fmt.Fprintf(stderr, "error writing DDL file: %v\n", err)
 			return 1
 		}
+		cfg.manifest.addFile(cfg.extractDDL)
 		fmt.Fprintf(stderr, "Extracted %d DDL statements to %s\n", len(cfg.collectedDDL), cfg.extractDDL)
 	}
 
+	if cfg.securityReport {
+		printSecurityReport(stderr, cfg.securityFindings)
+	}
+	if cfg.sideEffectsReport {
+		printSideEffectsReport(stderr, cfg.sideEffects)
+	}
+	if cfg.performanceReport {
+		printPerformanceReport(stderr, cfg.performanceNotes)
+	}
+	if cfg.migration != nil {
+		if err := writeMigrationReport(cfg); err != nil {
+			fmt.Fprintf(stderr, "error writing report: %v\n", err)
+			return 1
+		}
+	}
+
+	diagnostics := uniqueDiagnostics(cfg.diagnostics)
+	if cfg.diagnosticsFormat == "text" {
+		for _, d := range diagnostics {
+			fmt.Fprintf(stderr, "suggestion: %s\n", d)
+		}
+	} else if err := writeIssues(cfg); err != nil {
+		fmt.Fprintf(stderr, "error writing diagnostics: %v\n", err)
+		return 1
+	}
+	if cfg.applySuggestions && len(diagnostics) > 0 {
+		n, err := applySuggestions(cfg.configFile, diagnostics)
+		if err != nil {
+			fmt.Fprintf(stderr, "error applying suggestions: %v\n", err)
+			return 1
+		}
+		fmt.Fprintf(stderr, "Applied %d suggestion(s) to %s\n", n, cfg.configFile)
+	}
+
+	if cfg.manifest != nil {
+		cfg.manifest.Diagnostics = len(diagnostics)
+		if err := cfg.manifest.write(cfg, *manifestFile); err != nil {
+			fmt.Fprintf(stderr, "error writing manifest: %v\n", err)
+			return 1
+		}
+	}
+
+	// Written, but not good enough for --werror and the like
+	if err := checkWarnings(cfg); err != nil {
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		return 2
+	}
 	return 0
 }
 
@@ -284,30 +511,82 @@ type config struct {
 	storeVar       string
 	receiver       string
 	receiverType   string
+	style          string
+	goVersion      string
 	preserveGo     bool
 	sequenceMode   string
 	newidMode      string
 	idServiceVar   string
+	script         bool
+	scriptName     string // Function name for --script, from the input file
+	jobs           bool
 	skipDDL        bool
 	strictDDL      bool
 	extractDDL     string
 	collectedDDL   []string // Accumulated DDL statements for extraction
+	schemaPath     string
+	generatedColumns map[string]map[string]string // Loaded from schemaPath on first use
+	tableTypes     []transpiler.TableType       // Loaded from schemaPath on first use, and from typesFile
+	typesFile      string
+	constantsFile  string
+	constants      []transpiler.ConstantBlock // Parsed from constantsFile
+	namingConfig   string
+	verbsFile      string
+	verbs          transpiler.VerbsConfig // Parsed from verbsFile
+	declaredTableTypes []string                 // Table type structs already generated for the package
+	declaredPassthroughs []string               // Passthrough stubs already generated for the package
 	useSPLogger    bool
+	execStats      bool
+	metrics        bool
+	metricsVar     string
+	timeout        time.Duration
+	timeoutScope   string
+	retry          int
+	retryBackoff   time.Duration
+	retryOn        string
+	otel           bool
+	tracerVar      string
 	spLoggerVar    string
 	spLoggerType   string
 	spLoggerTable  string
 	spLoggerFile   string
 	spLoggerFormat string
 	genLoggerInit  bool
+	udfMode        string
+	udfOverrides   string
+	allowAnyScan   bool
+	nullMode       string
+	decimalMode    string
+	timeMode       string
+	nolockStrategy string
+	tryCatchMode   string
+	printMode      string
+	spatialMode    string
 	// Backend options
 	backend         string
 	fallbackBackend string
+	tableBackend    string
+	rowsMode        string
 	grpcClient      string
 	grpcPackage  string
+	enumOverrides string
+	protoEnumFields map[string]*transpiler.ProtoEnum // From the protos, for gRPC requests
 	mockStore    string
+	tableCollection string
+	mongoDB      string
+	redisClient  string
+	redisKeys    string
+	tableEvent     string
+	eventKey       string
+	eventPublisher string
+	notifier       string
 	tableService string
 	tableClient  string
 	grpcMappings string
+	modulePath    string
+	packagePath   string
+	schemaPackage string
+	passthrough   string
 	// Proto/gRPC generation
 	protoFile    string
 	protoDir     string
@@ -315,10 +594,68 @@ type config struct {
 	serviceName   string
 	genServer     bool
 	genImpl       bool
+	implPkgDirs   bool
 	genMock       bool
 	showMappings  bool
+	mappingDiff   string
 	outputFormat  string
+	// Contract extraction
+	genContracts    bool
+	contractsFormat string
+	// REST generation
+	genREST            bool
+	openAPIFile        string
+	restBasePath       string
+	restRouter         string
+	collectedContracts []transpiler.ProcedureContract // Accumulated for --gen-rest
+	// Service decomposition
+	clusterReport    bool
+	clusterThreshold float64
+	featureMatrix    bool
+	analyze          bool
+	dryRun           bool
+	// Repository scaffolding
+	genRepo       bool
+	genInterface  bool
+	mockKind      string
+	collectedCode []string             // Generated code of every input, for --gen-repo and --gen-interface
+	repoConfig    transpiler.DMLConfig // DML config the code was generated with, for scaffolding and table_types.go
+	// Security audit
+	securityReport   bool
+	securityFindings []transpiler.SecurityFinding // Accumulated across input files
+	// External side effects report
+	sideEffectsReport bool
+	configFile        string
+	applySuggestions  bool
+	diagnostics       []transpiler.Diagnostic // Suggested fixes, from every file
+	sideEffects       []transpiler.SideEffect // Accumulated across input files
+	// Structured diagnostics
+	diagnosticsFormat string
+	diagnosticsFile   string
+	issues            []transpiler.Issue // Warnings and diagnostics of every file
+	// Warning policy
+	werror      bool
+	maxWarnings int // -1 for no limit
+	failOn      string
+	sourceFile        string             // File being transpiled, "" for stdin
+	// Plan hints report
+	performanceReport bool
+	performanceNotes  []transpiler.PerformanceNote // Accumulated across input files
+	// Migration report
+	reportFile string
+	migration  *transpiler.MigrationReport // Accumulated across input files; nil without --report
+	// Identifiers
+	transliterate bool
+	// Large inputs
+	stream bool
+	// Watch mode
+	watch bool
+	// Manifest
+	manifest *manifest // nil without --manifest
+	// Lint
+	lintDir string
 	warnThreshold int
+	mappingWeights string
 	annotateLevel string
 	// IO
 	stdin  io.Reader
@@ -326,7 +663,7 @@ type config struct {
 	stderr io.Writer
 }
 
-func validateFlags(inputFile, inputDir string, readStdin bool, output, outDir string) error {
+func validateFlags(inputFile, inputDir string, readStdin bool, output, outDir string, genImpl bool) error {
 	// Check for conflicting input modes
 	inputModes := 0
 	if inputFile != "" {
@@ -342,8 +679,8 @@ func validateFlags(inputFile, inputDir string, readStdin bool, output, outDir st
 		return fmt.Errorf("cannot combine multiple input modes (file, --dir, --stdin)")
 	}
 
-	// outDir requires inputDir
-	if outDir != "" && inputDir == "" {
+	// outDir requires inputDir, except for --gen-impl's file per service
+	if outDir != "" && inputDir == "" && !genImpl {
 		return fmt.Errorf("--outdir requires --dir (directory-to-directory mode)")
 	}
 
@@ -355,6 +692,40 @@ func validateFlags(inputFile, inputDir string, readStdin bool, output, outDir st
 	return nil
 }
 
+// parseBackend maps a --backend name to its BackendType.
+func parseBackend(name string) (transpiler.BackendType, bool) {
+	switch name {
+	case "sql":
+		return transpiler.BackendSQL, true
+	case "grpc":
+		return transpiler.BackendGRPC, true
+	case "mock":
+		return transpiler.BackendMock, true
+	case "inline":
+		return transpiler.BackendInline, true
+	case "mongo":
+		return transpiler.BackendMongo, true
+	case "redis":
+		return transpiler.BackendRedis, true
+	case "procedure-call":
+		return transpiler.BackendProcedureCall, true
+	}
+	return "", false
+}
+
+// validTopicName reports whether name is a legal Kafka topic name.
+func validTopicName(name string) bool {
+	if name == "" || len(name) > 249 || name == "." || name == ".." {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '_' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
 // parseMapping parses a comma-separated mapping string into a map.
 // Format: "key:value,key:value" or "key=value,key=value"
 // Returns nil if input is empty.
@@ -389,23 +760,238 @@ func parseMapping(s string) map[string]string {
 	return result
 }
 
+// mapValues returns the values of a mapping parsed by parseMapping.
+func mapValues(m map[string]string) []string {
+	var values []string
+	for _, v := range m {
+		values = append(values, v)
+	}
+	return values
+}
+
 func execute(cfg *config) error {
+	switch cfg.diagnosticsFormat {
+	case "text", "json", "sarif":
+	default:
+		return fmt.Errorf("unknown --diagnostics: %s (valid: text, json, sarif)", cfg.diagnosticsFormat)
+	}
+	if cfg.diagnosticsFile != "" && cfg.diagnosticsFormat == "text" {
+		return fmt.Errorf("--diagnostics-file requires --diagnostics=json or --diagnostics=sarif")
+	}
+	if _, err := failOnRules(cfg); err != nil {
+		return err
+	}
+	if cfg.reportFile != "" {
+		if !cfg.dmlMode {
+			return fmt.Errorf("--report requires --dml")
+		}
+		cfg.migration = &transpiler.MigrationReport{}
+	}
+	if cfg.dryRun && !cfg.dmlMode {
+		return fmt.Errorf("--dry-run requires --dml")
+	}
+	if cfg.lintDir != "" {
+		return executeLint(cfg)
+	}
+
+	// Before anything is named: constants, contracts and mappings included
+	if cfg.namingConfig != "" {
+		source, err := os.ReadFile(cfg.namingConfig)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", cfg.namingConfig, err)
+		}
+		naming, err := transpiler.ParseNamingConfig(string(source))
+		if err != nil {
+			return fmt.Errorf("%s: %w", cfg.namingConfig, err)
+		}
+		transpiler.SetNamer(transpiler.NewNamer(naming))
+	}
+
+	if cfg.verbsFile != "" {
+		source, err := os.ReadFile(cfg.verbsFile)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", cfg.verbsFile, err)
+		}
+		if cfg.verbs, err = transpiler.ParseVerbs(string(source)); err != nil {
+			return fmt.Errorf("%s: %w", cfg.verbsFile, err)
+		}
+	}
+
+	if cfg.mappingDiff != "" && !cfg.showMappings {
+		return fmt.Errorf("--diff requires --show-mappings")
+	}
+
 	// Proto generation modes (mutually exclusive with transpilation)
 	if cfg.genServer || cfg.genImpl || cfg.genMock || cfg.showMappings {
 		return executeProtoGen(cfg)
 	}
 
+	// REST generation and clustering aggregate contracts from every input
+	if cfg.genREST {
+		return executeRESTGen(cfg)
+	}
+	if cfg.clusterReport {
+		return executeClusterReport(cfg)
+	}
+	if cfg.featureMatrix {
+		return executeFeatureMatrix(cfg)
+	}
+	if cfg.analyze {
+		return executeAnalyze(cfg)
+	}
+
+	// The types file's structs are shared by every file transpiled
+	var fileTypes []transpiler.TableType
+	if cfg.typesFile != "" {
+		if !cfg.dmlMode && (cfg.inputDir != "" || cfg.inputFile != "" || cfg.readStdin) {
+			return fmt.Errorf("--types-file requires --dml")
+		}
+		source, err := os.ReadFile(cfg.typesFile)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", cfg.typesFile, err)
+		}
+		fileTypes, err = transpiler.TableTypes(string(source))
+		if err != nil {
+			return fmt.Errorf("%s: %w", cfg.typesFile, err)
+		}
+		if len(fileTypes) == 0 {
+			return fmt.Errorf("%s: no CREATE TYPE ... AS TABLE statements", cfg.typesFile)
+		}
+		cfg.tableTypes = append(cfg.tableTypes, fileTypes...)
+		for _, tt := range fileTypes {
+			cfg.declaredTableTypes = append(cfg.declaredTableTypes, tt.Name)
+		}
+		cfg.repoConfig = transpiler.DefaultDMLConfig()
+	}
+
+	// The constants are declared once, and referred to by every file
+	if cfg.constantsFile != "" {
+		if !cfg.dmlMode {
+			return fmt.Errorf("--constants requires --dml")
+		}
+		source, err := os.ReadFile(cfg.constantsFile)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", cfg.constantsFile, err)
+		}
+		if cfg.constants, err = transpiler.ParseConstants(string(source)); err != nil {
+			return fmt.Errorf("%s: %w", cfg.constantsFile, err)
+		}
+	}
+
+	// Enum fields of the protos take their constants in gRPC requests
+	if cfg.dmlMode && (cfg.protoFile != "" || cfg.protoDir != "") {
+		protos, err := parseProtoFiles(cfg)
+		if err != nil {
+			return err
+		}
+		var overrides []byte
+		if cfg.enumOverrides != "" {
+			if overrides, err = os.ReadFile(cfg.enumOverrides); err != nil {
+				return fmt.Errorf("reading %s: %w", cfg.enumOverrides, err)
+			}
+		}
+		if cfg.protoEnumFields, err = protogen.EnumFields(protos, string(overrides)); err != nil {
+			return fmt.Errorf("%s: %w", cfg.enumOverrides, err)
+		}
+	} else if cfg.enumOverrides != "" {
+		return fmt.Errorf("--enum-overrides requires --dml and --proto or --proto-dir")
+	}
+
+	if cfg.dryRun {
+		return executeDryRun(cfg)
+	}
+
 	// Standard transpilation modes
+	var err error
 	switch {
+	case cfg.watch:
+		err = executeWatch(cfg)
+	case cfg.stream:
+		err = executeStream(cfg)
 	case cfg.inputDir != "":
-		return executeDirectory(cfg)
+		err = executeDirectory(cfg)
 	case cfg.inputFile != "":
-		return executeSingleFile(cfg)
+		err = executeSingleFile(cfg)
 	case cfg.readStdin:
-		return executeStdin(cfg)
-	default:
+		err = executeStdin(cfg)
+	case cfg.typesFile == "":
 		return fmt.Errorf("no input specified")
 	}
+	if err != nil {
+		return err
+	}
+	if cfg.typesFile != "" {
+		code, err := transpiler.GenerateTableTypes(fileTypes, cfg.packageName, cfg.repoConfig)
+		if err != nil {
+			return fmt.Errorf("%s: %w", cfg.typesFile, err)
+		}
+		noInput := cfg.inputDir == "" && cfg.inputFile == "" && !cfg.readStdin
+		if noInput && cfg.output != "" {
+			// Only the types: -o names their file
+			err = writeGeneratedFile(cfg, cfg.output, []byte(code))
+		} else {
+			err = writeScaffold(cfg, "table_types.go", code)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if cfg.constantsFile != "" {
+		code, err := transpiler.GenerateConstants(cfg.constants, cfg.packageName)
+		if err != nil {
+			return fmt.Errorf("%s: %w", cfg.constantsFile, err)
+		}
+		if err := writeScaffold(cfg, "constants.go", code); err != nil {
+			return err
+		}
+	}
+	if !cfg.genRepo && !cfg.genInterface {
+		return nil
+	}
+	return executeRepoGen(cfg)
+}
+
+// executeRepoGen writes the Repository scaffolding and interface for the
+// code generated from every input: to repository.go and interface.go
+// beside -o or in -O, else to stdout.
+func executeRepoGen(cfg *config) error {
+	if cfg.genRepo {
+		generate := transpiler.GenerateRepository
+		if cfg.genInterface {
+			// interface.go has the interface
+			generate = transpiler.GenerateRepositoryStruct
+		}
+		code, err := generate(cfg.collectedCode, cfg.packageName, cfg.repoConfig)
+		if err != nil {
+			return err
+		}
+		if err := writeScaffold(cfg, "repository.go", code); err != nil {
+			return err
+		}
+	}
+	if cfg.genInterface {
+		code, err := transpiler.GenerateInterface(cfg.collectedCode, cfg.packageName, cfg.repoConfig, cfg.mockKind)
+		if err != nil {
+			return err
+		}
+		return writeScaffold(cfg, "interface.go", code)
+	}
+	return nil
+}
+
+// writeScaffold writes a generated scaffold file into -O or beside -o, or
+// after the code on stdout.
+func writeScaffold(cfg *config, name, code string) error {
+	switch {
+	case cfg.outDir != "":
+		return writeGeneratedFile(cfg, filepath.Join(cfg.outDir, name), []byte(code))
+	case cfg.output != "":
+		return writeGeneratedFile(cfg, filepath.Join(filepath.Dir(cfg.output), name), []byte(code))
+	default:
+		fmt.Fprintln(cfg.stdout)
+		fmt.Fprint(cfg.stdout, code)
+		return nil
+	}
 }
 
 func executeStdin(cfg *config) error {
@@ -414,6 +1000,9 @@ func executeStdin(cfg *config) error {
 		return fmt.Errorf("reading stdin: %w", err)
 	}
 
+	cfg.scriptName = scriptName("")
+	cfg.sourceFile = ""
+	cfg.manifest.addSource("-", source)
 	result, err := doTranspile(cfg, string(source))
 	if err != nil {
 		return err
@@ -428,6 +1017,9 @@ func executeSingleFile(cfg *config) error {
 		return fmt.Errorf("reading %s: %w", cfg.inputFile, err)
 	}
 
+	cfg.scriptName = scriptName(cfg.inputFile)
+	cfg.sourceFile = cfg.inputFile
+	cfg.manifest.addSource(cfg.inputFile, source)
 	result, err := doTranspile(cfg, string(source))
 	if err != nil {
 		return fmt.Errorf("%s: %w", cfg.inputFile, err)
@@ -436,162 +1028,1961 @@ func executeSingleFile(cfg *config) error {
 	return writeOutput(cfg, cfg.inputFile, result)
 }
 
+// scriptName returns the function name for the statements of a script,
+// from its file name: nightly_cleanup.sql becomes NightlyCleanup.
+// Standard input is Script.
+func scriptName(path string) string {
+	if path == "" {
+		return "Script"
+	}
+	base := filepath.Base(path)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
 // doTranspile calls the appropriate transpiler based on config
 func doTranspile(cfg *config, source string) (string, error) {
-	if cfg.dmlMode {
-		// Map backend string to BackendType
-		var backendType transpiler.BackendType
-		switch cfg.backend {
-		case "sql":
-			backendType = transpiler.BackendSQL
-		case "grpc":
-			backendType = transpiler.BackendGRPC
-		case "mock":
-			backendType = transpiler.BackendMock
-		case "inline":
-			backendType = transpiler.BackendInline
-		default:
-			return "", fmt.Errorf("unknown backend: %s (valid: sql, grpc, mock, inline)", cfg.backend)
+	if cfg.securityReport {
+		findings, err := transpiler.AuditDynamicSQL(source)
+		if err != nil {
+			return "", err
+		}
+		cfg.securityFindings = append(cfg.securityFindings, findings...)
+	}
+	if cfg.performanceReport {
+		notes, err := transpiler.AnalyzePerformanceHints(source)
+		if err != nil {
+			return "", err
 		}
+		cfg.performanceNotes = append(cfg.performanceNotes, notes...)
+	}
 
-		// Map fallback backend string to BackendType
-		var fallbackBackendType transpiler.BackendType
-		fallbackExplicit := cfg.fallbackBackend != ""
-		switch cfg.fallbackBackend {
-		case "sql", "":
-			fallbackBackendType = transpiler.BackendSQL
-		case "mock":
-			fallbackBackendType = transpiler.BackendMock
-		default:
-			return "", fmt.Errorf("unknown fallback-backend: %s (valid: sql, mock)", cfg.fallbackBackend)
-		}
-
-		dmlConfig := transpiler.DMLConfig{
-			Backend:          backendType,
-			FallbackBackend:  fallbackBackendType,
-			FallbackExplicit: fallbackExplicit,
-			SQLDialect:       cfg.sqlDialect,
-			StoreVar:         cfg.storeVar,
-			Receiver:         cfg.receiver,
-			ReceiverType:     cfg.receiverType,
-			PreserveGo:       cfg.preserveGo,
-			SequenceMode:     cfg.sequenceMode,
-			NewidMode:        cfg.newidMode,
-			IDServiceVar:     cfg.idServiceVar,
-			SkipDDL:          cfg.skipDDL,
-			StrictDDL:        cfg.strictDDL,
-			ExtractDDL:       cfg.extractDDL,
-			GRPCClientVar:    cfg.grpcClient,
-			ProtoPackage:     cfg.grpcPackage,
-			MockStoreVar:     cfg.mockStore,
-			TableToService:   parseMapping(cfg.tableService),
-			TableToClient:    parseMapping(cfg.tableClient),
-			GRPCMappings:     parseMapping(cfg.grpcMappings),
-			ServiceToPackage: make(map[string]string),
-			UseSPLogger:      cfg.useSPLogger,
-			SPLoggerVar:      cfg.spLoggerVar,
-			SPLoggerType:     cfg.spLoggerType,
-			SPLoggerTable:    cfg.spLoggerTable,
-			SPLoggerFile:     cfg.spLoggerFile,
-			SPLoggerFormat:   cfg.spLoggerFormat,
-			GenLoggerInit:    cfg.genLoggerInit,
-			AnnotateLevel:    cfg.annotateLevel,
+	if cfg.script && !cfg.dmlMode && !cfg.genContracts && !cfg.genREST {
+		return "", fmt.Errorf("--script requires --dml")
+	}
+	if cfg.jobs && (!cfg.dmlMode || cfg.genContracts || cfg.genREST) {
+		return "", fmt.Errorf("--jobs requires --dml and Go output")
+	}
+
+	if cfg.dmlMode || cfg.genContracts || cfg.genREST {
+		dmlConfig, err := dmlConfigFor(cfg)
+		if err != nil {
+			return "", err
 		}
 		
 		// Use extended result to capture DDL for extraction
-		result, err := transpiler.TranspileWithDMLEx(source, cfg.packageName, dmlConfig)
+		transpile := transpiler.TranspileWithDMLEx
+		if cfg.jobs {
+			transpile = transpiler.TranspileJobs
+		}
+		result, err := transpile(source, cfg.packageName, dmlConfig)
 		if err != nil {
 			return "", err
 		}
 		
-		// Accumulate extracted DDL for later file writing
-		if cfg.extractDDL != "" && len(result.ExtractedDDL) > 0 {
-			cfg.collectedDDL = append(cfg.collectedDDL, result.ExtractedDDL...)
+		collectResult(cfg, result)
+		if cfg.migration != nil {
+			file := cfg.sourceFile
+			if file == "" {
+				file = "-"
+			}
+			if err := cfg.migration.Add(file, source, result); err != nil {
+				return "", err
+			}
+		}
+		
+		if cfg.transliterate {
+			transpiler.TransliterateContracts(result.Contracts)
+		}
+
+		if cfg.genREST {
+			cfg.collectedContracts = append(cfg.collectedContracts, result.Contracts...)
+		}
+		
+		if cfg.genContracts {
+			if cfg.contractsFormat == "yaml" {
+				return string(transpiler.MarshalContractsYAML(result.Contracts)), nil
+			}
+			data, err := transpiler.MarshalContractsJSON(result.Contracts)
+			if err != nil {
+				return "", err
+			}
+			return string(data), nil
 		}
 		
-		// Print DDL warnings to stderr
+		code, err := transliterateOutput(cfg, result.Code)
+		if err == nil && (cfg.genRepo || cfg.genInterface) {
+			cfg.collectedCode = append(cfg.collectedCode, code)
+		}
+		cfg.repoConfig = dmlConfig
+		return code, err
+	}
+	code, err := transpiler.Transpile(source, cfg.packageName)
+	if err != nil {
+		return "", err
+	}
+	return transliterateOutput(cfg, code)
+}
+
+// collectResult prints the warnings of a file's result to stderr and keeps
+// what the files after it and the reports need.
+func collectResult(cfg *config, result *transpiler.TranspileResult) {
+	// Accumulate extracted DDL for later file writing
+	if cfg.extractDDL != "" && len(result.ExtractedDDL) > 0 {
+		cfg.collectedDDL = append(cfg.collectedDDL, result.ExtractedDDL...)
+	}
+	cfg.issues = append(cfg.issues, result.Issues(cfg.sourceFile)...)
+	if cfg.diagnosticsFormat == "text" {
 		for _, warning := range result.DDLWarnings {
 			fmt.Fprintf(cfg.stderr, "warning: %s\n", warning)
 		}
-		
-		// Print temp table warnings to stderr
+		for _, warning := range result.Warnings {
+			fmt.Fprintf(cfg.stderr, "warning: %s\n", warning)
+		}
 		for _, warning := range result.TempTableWarnings {
 			fmt.Fprintf(cfg.stderr, "info: %s\n", warning)
 		}
-		
-		return result.Code, nil
 	}
-	return transpiler.Transpile(source, cfg.packageName)
+
+	if cfg.manifest != nil {
+		cfg.manifest.Warnings += len(result.DDLWarnings) + len(result.Warnings)
+	}
+
+	cfg.declaredTableTypes = result.TableTypes
+	cfg.declaredPassthroughs = result.Passthroughs
+	cfg.sideEffects = append(cfg.sideEffects, result.SideEffects...)
+	cfg.diagnostics = append(cfg.diagnostics, result.Diagnostics...)
 }
 
-func executeDirectory(cfg *config) error {
-	entries, err := os.ReadDir(cfg.inputDir)
+// writeIssues writes the warnings and diagnostics of the run as JSON or
+// SARIF, to --diagnostics-file or stderr.
+func writeIssues(cfg *config) error {
+	issues := cfg.issues
+	if issues == nil {
+		issues = []transpiler.Issue{}
+	}
+	var data []byte
+	var err error
+	if cfg.diagnosticsFormat == "sarif" {
+		data, err = transpiler.MarshalSARIF(issues, version)
+	} else {
+		data, err = json.MarshalIndent(issues, "", "  ")
+	}
 	if err != nil {
-		return fmt.Errorf("reading directory %s: %w", cfg.inputDir, err)
+		return err
+	}
+	data = append(data, '\n')
+	if cfg.diagnosticsFile == "" {
+		_, err = cfg.stderr.Write(data)
+		return err
+	}
+	if err := os.WriteFile(cfg.diagnosticsFile, data, 0644); err != nil {
+		return err
 	}
+	cfg.manifest.addFile(cfg.diagnosticsFile)
+	return nil
+}
 
-	// Create output directory if needed
-	if cfg.outDir != "" {
-		if err := os.MkdirAll(cfg.outDir, 0755); err != nil {
-			return fmt.Errorf("creating output directory: %w", err)
+// failOnRules returns the rules of --fail-on.
+func failOnRules(cfg *config) (map[string]bool, error) {
+	rules := map[string]bool{}
+	for _, rule := range strings.Split(cfg.failOn, ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		known := false
+		for _, r := range transpiler.IssueRules {
+			known = known || r.ID == rule
 		}
+		if !known {
+			ids := make([]string, len(transpiler.IssueRules))
+			for i, r := range transpiler.IssueRules {
+				ids[i] = r.ID
+			}
+			return nil, fmt.Errorf("unknown --fail-on rule: %s (valid: %s)", rule, strings.Join(ids, ", "))
+		}
+		rules[rule] = true
 	}
+	return rules, nil
+}
 
-	for _, entry := range entries {
-		if entry.IsDir() {
+// checkWarnings returns an error if the warnings of the run fail
+// --werror, --max-warnings or --fail-on. Notes aren't warnings.
+func checkWarnings(cfg *config) error {
+	failOn, err := failOnRules(cfg)
+	if err != nil {
+		return err
+	}
+	warnings := 0
+	failed := map[string]int{}
+	for _, issue := range cfg.issues {
+		if issue.Severity == transpiler.SeverityNote {
 			continue
 		}
-		if !strings.HasSuffix(strings.ToLower(entry.Name()), ".sql") {
-			continue
+		warnings++
+		if failOn[issue.Rule] {
+			failed[issue.Rule]++
+		}
+	}
+	switch {
+	case len(failed) > 0:
+		var counts []string
+		for _, rule := range sortedKeys(failed) {
+			counts = append(counts, fmt.Sprintf("%d %s", failed[rule], rule))
 		}
+		return fmt.Errorf("--fail-on: %s warning(s)", strings.Join(counts, ", "))
+	case cfg.werror && warnings > 0:
+		return fmt.Errorf("--werror: %d warning(s)", warnings)
+	case cfg.maxWarnings >= 0 && warnings > cfg.maxWarnings:
+		return fmt.Errorf("--max-warnings: %d warning(s), more than %d", warnings, cfg.maxWarnings)
+	}
+	return nil
+}
 
-		inputPath := filepath.Join(cfg.inputDir, entry.Name())
-		source, err := os.ReadFile(inputPath)
+// dmlConfigFor validates the DML flags and returns the DMLConfig they
+// give, loading --schema the first time.
+func dmlConfigFor(cfg *config) (transpiler.DMLConfig, error) {
+	// Map backend string to BackendType
+	if cfg.schemaPath != "" && cfg.generatedColumns == nil {
+		cols, types, err := loadSchema(cfg.schemaPath)
 		if err != nil {
-			return fmt.Errorf("reading %s: %w", inputPath, err)
+			return transpiler.DMLConfig{}, err
+		}
+		cfg.generatedColumns = cols
+		cfg.tableTypes = append(cfg.tableTypes, types...)
+	}
+
+	backendType, ok := parseBackend(cfg.backend)
+	if !ok {
+		return transpiler.DMLConfig{}, fmt.Errorf("unknown backend: %s (valid: sql, grpc, mock, inline, mongo, redis, procedure-call)", cfg.backend)
+	}
+	switch cfg.rowsMode {
+	case "", transpiler.RowsSlice:
+	case transpiler.RowsCallback, transpiler.RowsIter:
+		if backendType != transpiler.BackendProcedureCall {
+			return transpiler.DMLConfig{}, fmt.Errorf("--rows=%s requires --backend=procedure-call", cfg.rowsMode)
+		}
+	default:
+		return transpiler.DMLConfig{}, fmt.Errorf("unknown --rows: %s (valid: slice, callback, iter)", cfg.rowsMode)
+	}
+
+	// Per-table backends override --backend and --fallback-backend
+	var tableBackends map[string]transpiler.BackendType
+	for table, name := range parseMapping(cfg.tableBackend) {
+		tb, ok := parseBackend(name)
+		if !ok || tb == transpiler.BackendProcedureCall {
+			return transpiler.DMLConfig{}, fmt.Errorf("unknown backend for table %s: %s (valid: sql, grpc, mock, inline, mongo, redis)", table, name)
+		}
+		if tableBackends == nil {
+			tableBackends = make(map[string]transpiler.BackendType)
+		}
+		tableBackends[table] = tb
+	}
+
+	// Event topics must be valid Kafka topic names
+	tableEvents := parseMapping(cfg.tableEvent)
+	for table, topic := range tableEvents {
+		if !validTopicName(topic) {
+			return transpiler.DMLConfig{}, fmt.Errorf("invalid topic for table %s: %q (use letters, digits, '.', '_' and '-')", table, topic)
+		}
+	}
+
+	// Map fallback backend string to BackendType
+	var fallbackBackendType transpiler.BackendType
+	fallbackExplicit := cfg.fallbackBackend != ""
+	switch cfg.fallbackBackend {
+	case "sql", "":
+		fallbackBackendType = transpiler.BackendSQL
+	case "mock":
+		fallbackBackendType = transpiler.BackendMock
+	default:
+		return transpiler.DMLConfig{}, fmt.Errorf("unknown fallback-backend: %s (valid: sql, mock)", cfg.fallbackBackend)
+	}
+
+	// Validate UDF modes, including per-function overrides
+	udfOverrides := parseMapping(cfg.udfOverrides)
+	for _, mode := range append([]string{cfg.udfMode}, mapValues(udfOverrides)...) {
+		if mode != transpiler.UDFModeKeep && mode != transpiler.UDFModeCompute {
+			return transpiler.DMLConfig{}, fmt.Errorf("unknown udf mode: %s (valid: keep, compute)", mode)
+		}
+	}
+
+	// Contracts infer result sets from the SQL backend's queries, and the
+	// REST handlers call the SQL backend's repository methods, unless they
+	// call procedure-call wrappers for their result sets
+	if cfg.genREST && backendType != transpiler.BackendProcedureCall {
+		backendType = transpiler.BackendSQL
+		tableBackends = nil
+	}
+	if cfg.genContracts {
+		if cfg.contractsFormat != "json" && cfg.contractsFormat != "yaml" {
+			return transpiler.DMLConfig{}, fmt.Errorf("unknown contracts format: %s (valid: json, yaml)", cfg.contractsFormat)
+		}
+		backendType = transpiler.BackendSQL
+		tableBackends = nil
+	}
+
+	if cfg.style != transpiler.StyleMethods && cfg.style != transpiler.StyleFunctions {
+		return transpiler.DMLConfig{}, fmt.Errorf("unknown style: %s (valid: methods, functions)", cfg.style)
+	}
+
+	if cfg.genRepo || cfg.genInterface {
+		flag := "--gen-repo"
+		if !cfg.genRepo {
+			flag = "--gen-interface"
+		}
+		if !cfg.dmlMode || cfg.genContracts {
+			return transpiler.DMLConfig{}, fmt.Errorf("%s requires --dml and Go output", flag)
+		}
+		if cfg.style != transpiler.StyleMethods {
+			return transpiler.DMLConfig{}, fmt.Errorf("%s requires --style=methods", flag)
+		}
+	}
+	if cfg.timeout < 0 {
+		return transpiler.DMLConfig{}, fmt.Errorf("--timeout must not be negative")
+	}
+	if cfg.timeoutScope != transpiler.TimeoutProcedure && cfg.timeoutScope != transpiler.TimeoutStatement {
+		return transpiler.DMLConfig{}, fmt.Errorf("unknown --timeout-scope: %s (valid: procedure, statement)", cfg.timeoutScope)
+	}
+	switch cfg.nullMode {
+	case "", transpiler.NullZero, transpiler.NullSQL, transpiler.NullPointer:
+	default:
+		return transpiler.DMLConfig{}, fmt.Errorf("unknown --null-mode: %s (valid: zero, sqlnull, pointer)", cfg.nullMode)
+	}
+	switch cfg.decimalMode {
+	case "", transpiler.DecimalShopspring, transpiler.DecimalString, transpiler.DecimalFloat, transpiler.DecimalAPD:
+	default:
+		return transpiler.DMLConfig{}, fmt.Errorf("unknown --decimal-mode: %s (valid: shopspring, string, float, apd)", cfg.decimalMode)
+	}
+	switch cfg.timeMode {
+	case "", transpiler.TimeLocal, transpiler.TimeUTC:
+	default:
+		return transpiler.DMLConfig{}, fmt.Errorf("unknown --time-mode: %s (valid: local, utc)", cfg.timeMode)
+	}
+	switch cfg.nolockStrategy {
+	case "", transpiler.NoLockComment, transpiler.NoLockIgnore, transpiler.NoLockReadUncommitted:
+	default:
+		return transpiler.DMLConfig{}, fmt.Errorf("unknown --nolock-strategy: %s (valid: comment, ignore, read-uncommitted-tx)", cfg.nolockStrategy)
+	}
+	switch cfg.tryCatchMode {
+	case "", transpiler.TryCatchIIFE, transpiler.TryCatchErrors:
+	default:
+		return transpiler.DMLConfig{}, fmt.Errorf("unknown --trycatch-mode: %s (valid: iife, errors)", cfg.tryCatchMode)
+	}
+	switch cfg.printMode {
+	case "", transpiler.PrintFmt, transpiler.PrintSlog, transpiler.PrintDiscard:
+	default:
+		return transpiler.DMLConfig{}, fmt.Errorf("unknown --print-mode: %s (valid: fmt, slog, discard)", cfg.printMode)
+	}
+	switch cfg.spatialMode {
+	case "", transpiler.SpatialWKT:
+	case transpiler.SpatialPostGIS:
+		if cfg.sqlDialect != "postgres" {
+			return transpiler.DMLConfig{}, fmt.Errorf("--spatial-mode=postgis requires --dialect=postgres")
+		}
+	default:
+		return transpiler.DMLConfig{}, fmt.Errorf("unknown --spatial-mode: %s (valid: wkt, postgis)", cfg.spatialMode)
+	}
+	if cfg.retry < 0 || cfg.retryBackoff < 0 {
+		return transpiler.DMLConfig{}, fmt.Errorf("--retry and --retry-backoff must not be negative")
+	}
+	var retryOn []string
+	if cfg.retryOn != "" {
+		retryOn = strings.Split(cfg.retryOn, ",")
+	}
+	var passthrough []string
+	for _, proc := range strings.Split(cfg.passthrough, ",") {
+		if proc = strings.TrimSpace(proc); proc != "" {
+			passthrough = append(passthrough, proc)
+		}
+	}
+
+	if cfg.mockKind != "" {
+		if !cfg.genInterface {
+			return transpiler.DMLConfig{}, fmt.Errorf("--mock requires --gen-interface")
+		}
+		switch cfg.mockKind {
+		case transpiler.MockGomock, transpiler.MockMoq, transpiler.MockFunc:
+		default:
+			return transpiler.DMLConfig{}, fmt.Errorf("unknown --mock: %s (valid: gomock, moq, func)", cfg.mockKind)
+		}
+	}
+
+	if cfg.goVersion != "" {
+		if _, err := transpiler.ParseGoVersion(cfg.goVersion); err != nil {
+			return transpiler.DMLConfig{}, err
+		}
+	}
+
+	var scriptFunc string
+	if cfg.script {
+		scriptFunc = cfg.scriptName
+	}
+
+	return transpiler.DMLConfig{
+		Backend:          backendType,
+		FallbackBackend:  fallbackBackendType,
+		FallbackExplicit: fallbackExplicit,
+		TableToBackend:   tableBackends,
+		SQLDialect:       cfg.sqlDialect,
+		StoreVar:         cfg.storeVar,
+		Receiver:         cfg.receiver,
+		ReceiverType:     cfg.receiverType,
+		Style:            cfg.style,
+		GoVersion:        cfg.goVersion,
+		PreserveGo:       cfg.preserveGo,
+		SequenceMode:     cfg.sequenceMode,
+		NewidMode:        cfg.newidMode,
+		IDServiceVar:     cfg.idServiceVar,
+		ScriptName:       scriptFunc,
+		SkipDDL:          cfg.skipDDL,
+		StrictDDL:        cfg.strictDDL,
+		ExtractDDL:       cfg.extractDDL,
+		GeneratedColumns: cfg.generatedColumns,
+		TableTypes:       cfg.tableTypes,
+		DeclaredTableTypes: cfg.declaredTableTypes,
+		Constants:        cfg.constants,
+		Verbs:            cfg.verbs,
+		GRPCClientVar:    cfg.grpcClient,
+		ProtoPackage:     cfg.grpcPackage,
+		ProtoEnumFields:  cfg.protoEnumFields,
+		MockStoreVar:     cfg.mockStore,
+		TableToCollection: parseMapping(cfg.tableCollection),
+		MongoDatabaseVar: cfg.mongoDB,
+		RedisClientVar:   cfg.redisClient,
+		TableToRedisKey:  parseMapping(cfg.redisKeys),
+		TableToEvent:     tableEvents,
+		TableToEventKey:  parseMapping(cfg.eventKey),
+		EventPublisherVar: cfg.eventPublisher,
+		NotifierVar:      cfg.notifier,
+		TableToService:   parseMapping(cfg.tableService),
+		TableToClient:    parseMapping(cfg.tableClient),
+		GRPCMappings:     parseMapping(cfg.grpcMappings),
+		ServiceToPackage: make(map[string]string),
+		ModulePath:       cfg.modulePath,
+		PackagePaths:     parseMapping(cfg.packagePath),
+		SchemaToPackage:  parseMapping(cfg.schemaPackage),
+		Passthrough:      passthrough,
+		DeclaredPassthroughs: cfg.declaredPassthroughs,
+		UseSPLogger:      cfg.useSPLogger,
+		ExecStats:        cfg.execStats,
+		Metrics:          cfg.metrics,
+		MetricsVar:       cfg.metricsVar,
+		Timeout:          cfg.timeout,
+		TimeoutScope:     cfg.timeoutScope,
+		RetryAttempts:    cfg.retry,
+		RetryBackoff:     cfg.retryBackoff,
+		RetryOn:          retryOn,
+		Otel:             cfg.otel,
+		TracerVar:        cfg.tracerVar,
+		SPLoggerVar:      cfg.spLoggerVar,
+		SPLoggerType:     cfg.spLoggerType,
+		SPLoggerTable:    cfg.spLoggerTable,
+		SPLoggerFile:     cfg.spLoggerFile,
+		SPLoggerFormat:   cfg.spLoggerFormat,
+		GenLoggerInit:    cfg.genLoggerInit,
+		AnnotateLevel:    cfg.annotateLevel,
+		UDFMode:          cfg.udfMode,
+		UDFOverrides:     udfOverrides,
+		AllowAnyScan:     cfg.allowAnyScan,
+		NullMode:         cfg.nullMode,
+		DecimalMode:      cfg.decimalMode,
+		TimeMode:         cfg.timeMode,
+		NoLockStrategy:   cfg.nolockStrategy,
+		TryCatchMode:     cfg.tryCatchMode,
+		PrintMode:        cfg.printMode,
+		SpatialMode:      cfg.spatialMode,
+		RowsMode:         cfg.rowsMode,
+	}, nil
+}
+
+// transliterateOutput applies --transliterate to generated Go code.
+func transliterateOutput(cfg *config, code string) (string, error) {
+	if !cfg.transliterate {
+		return code, nil
+	}
+	return transpiler.TransliterateGoIdentifiers(code)
+}
+
+func executeDirectory(cfg *config) error {
+	if strings.EqualFold(filepath.Ext(cfg.inputDir), ".dacpac") {
+		return executeDacpac(cfg)
+	}
+
+	entries, err := os.ReadDir(cfg.inputDir)
+	if err != nil {
+		return fmt.Errorf("reading directory %s: %w", cfg.inputDir, err)
+	}
+
+	// Create output directory if needed
+	if cfg.outDir != "" {
+		if err := os.MkdirAll(cfg.outDir, 0755); err != nil {
+			return fmt.Errorf("creating output directory: %w", err)
+		}
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if ext != ".sql" && !(cfg.jobs && ext == ".json") {
+			continue
+		}
+
+		inputPath := filepath.Join(cfg.inputDir, entry.Name())
+		source, err := os.ReadFile(inputPath)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", inputPath, err)
+		}
+
+		if err := transpileEntry(cfg, inputPath, entry.Name(), string(source)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// transpileEntry transpiles one script of a directory, writing it to
+// cfg.outDir as name with the output extension, or to stdout.
+func transpileEntry(cfg *config, inputPath, name, source string) error {
+	cfg.scriptName = scriptName(name)
+	cfg.sourceFile = inputPath
+	cfg.manifest.addSource(inputPath, []byte(source))
+	result, err := doTranspile(cfg, source)
+	if err != nil {
+		return fmt.Errorf("%s: %w", inputPath, err)
+	}
+
+	if cfg.outDir == "" {
+		fmt.Fprintln(cfg.stdout, result)
+		return nil
+	}
+
+	outName := strings.TrimSuffix(name, filepath.Ext(name)) + outputExt(cfg)
+	outPath := filepath.Join(cfg.outDir, outName)
+
+	if !cfg.force {
+		if _, err := os.Stat(outPath); err == nil {
+			return fmt.Errorf("output file %s already exists (use --force to overwrite)", outPath)
+		}
+	}
+
+	if err := os.WriteFile(outPath, []byte(result), 0644); err != nil {
+		return fmt.Errorf("writing %s: %w", outPath, err)
+	}
+	cfg.manifest.addFile(outPath)
+	fmt.Fprintf(cfg.stderr, "%s -> %s\n", inputPath, outPath)
+	return nil
+}
+
+// watchPoll is how often --watch looks for saved files. A file is
+// transpiled once a poll finds it as the poll before did, as editors saving
+// a file often write it more than once.
+const watchPoll = 250 * time.Millisecond
+
+// executeWatch transpiles the files of the directory, then watches it
+// (--watch), transpiling each file again when it's saved and printing how
+// its Go code changed. Output files are overwritten, keeping them in step
+// with the SQL. A file that fails is reported and watching goes on, until
+// interrupted.
+func executeWatch(cfg *config) error {
+	switch {
+	case cfg.inputDir == "" || cfg.outDir == "":
+		return fmt.Errorf("--watch requires -d and -O")
+	case strings.EqualFold(filepath.Ext(cfg.inputDir), ".dacpac"):
+		return fmt.Errorf("--watch can't watch a dacpac")
+	case cfg.stream:
+		return fmt.Errorf("--watch can't be used with --stream")
+	}
+	cfg.force = true
+	if err := os.MkdirAll(cfg.outDir, 0755); err != nil {
+		return fmt.Errorf("creating output directory: %w", err)
+	}
+
+	seen, err := watchStamps(cfg)
+	if err != nil {
+		return fmt.Errorf("reading directory %s: %w", cfg.inputDir, err)
+	}
+	for _, path := range sortedKeys(seen) {
+		watchTranspile(cfg, path, false)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	fmt.Fprintf(cfg.stderr, "watching %s (Ctrl-C to stop)\n", cfg.inputDir)
+	// Files changed since they were last transpiled, as the last poll found them
+	pending := map[string]fileStamp{}
+	poll := time.NewTicker(watchPoll)
+	defer poll.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-poll.C:
+		}
+		stamps, err := watchStamps(cfg)
+		if err != nil {
+			fmt.Fprintf(cfg.stderr, "error: watching %s: %v\n", cfg.inputDir, err)
+			continue
+		}
+		for path := range seen {
+			if _, ok := stamps[path]; !ok {
+				delete(seen, path)
+				delete(pending, path)
+			}
+		}
+		for _, path := range sortedKeys(stamps) {
+			stamp := stamps[path]
+			switch {
+			case stamp == seen[path]:
+				delete(pending, path)
+			case stamp == pending[path]:
+				watchTranspile(cfg, path, true)
+				seen[path] = stamp
+				delete(pending, path)
+			default:
+				pending[path] = stamp
+			}
+		}
+	}
+}
+
+// fileStamp is what --watch compares to tell that a file was saved.
+type fileStamp struct {
+	modTime int64 // Unix nanoseconds
+	size    int64
+}
+
+// watchStamps returns the stamps of the files of the directory --watch
+// transpiles, by path.
+func watchStamps(cfg *config) (map[string]fileStamp, error) {
+	entries, err := os.ReadDir(cfg.inputDir)
+	if err != nil {
+		return nil, err
+	}
+	stamps := map[string]fileStamp{}
+	for _, entry := range entries {
+		path := filepath.Join(cfg.inputDir, entry.Name())
+		ext := strings.ToLower(filepath.Ext(path))
+		if ext != ".sql" && !(cfg.jobs && ext == ".json") {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		stamps[path] = fileStamp{info.ModTime().UnixNano(), info.Size()}
+	}
+	return stamps, nil
+}
+
+// watchTranspile transpiles inputPath into cfg.outDir for --watch,
+// printing errors rather than returning them and, with diff, the
+// difference from the code the file had before.
+func watchTranspile(cfg *config, inputPath string, diff bool) {
+	name := filepath.Base(inputPath)
+	outPath := filepath.Join(cfg.outDir, strings.TrimSuffix(name, filepath.Ext(name))+outputExt(cfg))
+	before, _ := os.ReadFile(outPath)
+	source, err := os.ReadFile(inputPath)
+	if err == nil {
+		err = transpileEntry(cfg, inputPath, name, string(source))
+	}
+	if err != nil {
+		fmt.Fprintf(cfg.stderr, "error: %v\n", err)
+		return
+	}
+	if !diff {
+		return
+	}
+	after, err := os.ReadFile(outPath)
+	if err != nil {
+		fmt.Fprintf(cfg.stderr, "error: %v\n", err)
+		return
+	}
+	if bytes.Equal(before, after) {
+		fmt.Fprintf(cfg.stdout, "%s: no change\n", outPath)
+		return
+	}
+	fmt.Fprint(cfg.stdout, unifiedDiff(outPath, string(before), string(after)))
+}
+
+// Bounds of the diffs --watch prints: lines of context around each change,
+// lines printed in all, and the largest table of lines lineEdits compares
+// one by one rather than replacing the lot.
+const (
+	watchDiffContext = 2
+	watchDiffLines   = 80
+	watchDiffCells   = 1 << 22
+)
+
+// lineEdit is a line kept (' '), removed ('-') or added ('+').
+type lineEdit struct {
+	op   byte
+	line string
+}
+
+// lineEdits returns the edits from lines a to lines b, keeping their
+// longest common subsequence. The lines both start and end with are kept
+// first, as a save usually changes a few lines in one place.
+func lineEdits(a, b []string) []lineEdit {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	var edits []lineEdit
+	for _, line := range a[:prefix] {
+		edits = append(edits, lineEdit{' ', line})
+	}
+	ma, mb := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if len(ma)*len(mb) > watchDiffCells {
+		for _, line := range ma {
+			edits = append(edits, lineEdit{'-', line})
+		}
+		for _, line := range mb {
+			edits = append(edits, lineEdit{'+', line})
+		}
+	} else {
+		// lcs[i*w+j] is the length of the LCS of ma[i:] and mb[j:]
+		w := len(mb) + 1
+		lcs := make([]int32, (len(ma)+1)*w)
+		for i := len(ma) - 1; i >= 0; i-- {
+			for j := len(mb) - 1; j >= 0; j-- {
+				if ma[i] == mb[j] {
+					lcs[i*w+j] = lcs[(i+1)*w+j+1] + 1
+				} else {
+					lcs[i*w+j] = max(lcs[(i+1)*w+j], lcs[i*w+j+1])
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < len(ma) || j < len(mb) {
+			switch {
+			case i < len(ma) && j < len(mb) && ma[i] == mb[j]:
+				edits = append(edits, lineEdit{' ', ma[i]})
+				i++
+				j++
+			case i < len(ma) && (j == len(mb) || lcs[(i+1)*w+j] >= lcs[i*w+j+1]):
+				edits = append(edits, lineEdit{'-', ma[i]})
+				i++
+			default:
+				edits = append(edits, lineEdit{'+', mb[j]})
+				j++
+			}
+		}
+	}
+	for _, line := range a[len(a)-suffix:] {
+		edits = append(edits, lineEdit{' ', line})
+	}
+	return edits
+}
+
+// unifiedDiff returns the unified diff of file from before to after, with
+// watchDiffContext lines of context and at most watchDiffLines lines.
+func unifiedDiff(file, before, after string) string {
+	split := func(s string) []string {
+		if s == "" {
+			return nil
+		}
+		return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	}
+	edits := lineEdits(split(before), split(after))
+
+	// Lines of before and after ahead of each edit
+	aLine := make([]int, len(edits)+1)
+	bLine := make([]int, len(edits)+1)
+	for i, e := range edits {
+		aLine[i+1], bLine[i+1] = aLine[i], bLine[i]
+		if e.op != '+' {
+			aLine[i+1]++
+		}
+		if e.op != '-' {
+			bLine[i+1]++
+		}
+	}
+
+	var lines []string
+	for i := 0; i < len(edits); {
+		if edits[i].op == ' ' {
+			i++
+			continue
+		}
+		// A hunk runs on while the next change is close enough to share context
+		start, end := max(0, i-watchDiffContext), i
+		for j := i; j < len(edits) && j <= end+2*watchDiffContext+1; j++ {
+			if edits[j].op != ' ' {
+				end = j
+			}
+		}
+		end = min(len(edits), end+watchDiffContext+1)
+		aStart, bStart := aLine[start]+1, bLine[start]+1
+		aCount, bCount := aLine[end]-aLine[start], bLine[end]-bLine[start]
+		if aCount == 0 {
+			aStart--
+		}
+		if bCount == 0 {
+			bStart--
+		}
+		lines = append(lines, fmt.Sprintf("@@ -%d,%d +%d,%d @@", aStart, aCount, bStart, bCount))
+		for _, e := range edits[start:end] {
+			lines = append(lines, string(e.op)+e.line)
+		}
+		i = end
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", file, file)
+	if len(lines) > watchDiffLines {
+		lines = append(lines[:watchDiffLines], fmt.Sprintf("... %d more lines", len(lines)-watchDiffLines))
+	}
+	for _, line := range lines {
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// executeStream transpiles the inputs batch by batch (--stream), writing
+// each batch's code as it's done rather than holding a whole file's AST and
+// code in memory. The files of a directory share one streamer.
+func executeStream(cfg *config) error {
+	switch {
+	case !cfg.dmlMode:
+		return fmt.Errorf("--stream requires --dml")
+	case cfg.script || cfg.jobs || cfg.genContracts || cfg.genRepo || cfg.genInterface || cfg.transliterate:
+		return fmt.Errorf("--stream can't be used with --script, --jobs, --gen-contracts, --gen-repo, --gen-interface or --transliterate")
+	case cfg.securityReport || cfg.performanceReport || cfg.reportFile != "":
+		return fmt.Errorf("--stream can't be used with --security-report, --performance-report or --report")
+	}
+	dmlConfig, err := dmlConfigFor(cfg)
+	if err != nil {
+		return err
+	}
+	cfg.repoConfig = dmlConfig
+	s := transpiler.NewStreamer(cfg.packageName, dmlConfig)
+
+	switch {
+	case cfg.inputFile != "":
+		return streamFile(cfg, s, cfg.inputFile, cfg.output)
+	case cfg.readStdin:
+		return streamFile(cfg, s, "", cfg.output)
+	}
+	if strings.EqualFold(filepath.Ext(cfg.inputDir), ".dacpac") {
+		return fmt.Errorf("--stream can't read a dacpac")
+	}
+	entries, err := os.ReadDir(cfg.inputDir)
+	if err != nil {
+		return fmt.Errorf("reading directory %s: %w", cfg.inputDir, err)
+	}
+	if cfg.outDir != "" {
+		if err := os.MkdirAll(cfg.outDir, 0755); err != nil {
+			return fmt.Errorf("creating output directory: %w", err)
+		}
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.EqualFold(filepath.Ext(entry.Name()), ".sql") {
+			continue
+		}
+		inputPath := filepath.Join(cfg.inputDir, entry.Name())
+		var outPath string
+		if cfg.outDir != "" {
+			outPath = filepath.Join(cfg.outDir, strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))+".go")
+		}
+		if err := streamFile(cfg, s, inputPath, outPath); err != nil {
+			return err
+		}
+		if outPath != "" {
+			fmt.Fprintf(cfg.stderr, "%s -> %s\n", inputPath, outPath)
+		} else {
+			fmt.Fprintln(cfg.stdout)
+		}
+	}
+	return nil
+}
+
+// streamFile streams inputPath, or stdin if it's "", to outPath, or stdout
+// if it's "". An output file is removed if the input doesn't transpile.
+func streamFile(cfg *config, s *transpiler.Streamer, inputPath, outPath string) error {
+	in := cfg.stdin
+	if inputPath != "" {
+		f, err := os.Open(inputPath)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", inputPath, err)
+		}
+		defer f.Close()
+		in = f
+	}
+	cfg.sourceFile = inputPath
+	hash := sha256.New()
+	in = io.TeeReader(in, hash)
+	addSource := func(result *transpiler.TranspileResult) {
+		path := inputPath
+		if path == "" {
+			path = "-"
+		}
+		cfg.manifest.addStreamedSource(path, hash.Sum(nil), result.Contracts)
+	}
+	fail := func(err error) error {
+		if inputPath != "" {
+			return fmt.Errorf("%s: %w", inputPath, err)
+		}
+		return err
+	}
+
+	if outPath == "" {
+		result, err := s.Transpile(in, cfg.stdout)
+		if err != nil {
+			return fail(err)
+		}
+		addSource(result)
+		collectResult(cfg, result)
+		return nil
+	}
+	if !cfg.force {
+		if _, err := os.Stat(outPath); err == nil {
+			return fmt.Errorf("output file %s already exists (use --force to overwrite)", outPath)
+		}
+	}
+	out, err := os.Create(outPath)
+	if err != nil {
+		return fmt.Errorf("writing %s: %w", outPath, err)
+	}
+	result, err := s.Transpile(in, out)
+	if closeErr := out.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("writing %s: %w", outPath, closeErr)
+	}
+	if err != nil {
+		os.Remove(outPath)
+		return fail(err)
+	}
+	addSource(result)
+	cfg.manifest.addFile(outPath)
+	collectResult(cfg, result)
+	return nil
+}
+
+// executeDacpac transpiles the procedures and functions of a dacpac as
+// executeDirectory does a directory's scripts, one output file per
+// routine. Unless --schema says otherwise, the package's tables and table
+// types are the schema.
+func executeDacpac(cfg *config) error {
+	model, err := dacpac.Read(cfg.inputDir)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", cfg.inputDir, err)
+	}
+	for _, name := range model.Skipped {
+		fmt.Fprintf(cfg.stderr, "warning: %s: no source for %s, skipped\n", cfg.inputDir, name)
+	}
+	if cfg.schemaPath == "" {
+		cfg.schemaPath = cfg.inputDir
+	}
+
+	if cfg.outDir != "" {
+		if err := os.MkdirAll(cfg.outDir, 0755); err != nil {
+			return fmt.Errorf("creating output directory: %w", err)
+		}
+	}
+
+	for _, obj := range model.Objects {
+		if !obj.IsRoutine() {
+			continue
+		}
+		name := obj.FileName()
+		if err := transpileEntry(cfg, cfg.inputDir+":"+name, name, obj.Script); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// outputExt returns the file extension for generated output.
+func outputExt(cfg *config) string {
+	if cfg.genContracts {
+		return "." + cfg.contractsFormat
+	}
+	return ".go"
+}
+
+func writeOutput(cfg *config, inputPath, content string) error {
+	if cfg.output != "" {
+		if !cfg.force {
+			if _, err := os.Stat(cfg.output); err == nil {
+				return fmt.Errorf("output file %s already exists (use --force to overwrite)", cfg.output)
+			}
+		}
+		if err := os.WriteFile(cfg.output, []byte(content), 0644); err != nil {
+			return fmt.Errorf("writing %s: %w", cfg.output, err)
+		}
+		cfg.manifest.addFile(cfg.output)
+		return nil
+	}
+
+	fmt.Fprint(cfg.stdout, content)
+	return nil
+}
+
+// executeRESTGen transpiles every input to collect procedure contracts, then
+// generates one set of handlers (and optionally an OpenAPI spec) for all of
+// them. With --outdir, both are written there as rest.go and openapi.json.
+func executeRESTGen(cfg *config) error {
+	if cfg.style == transpiler.StyleFunctions {
+		return fmt.Errorf("--gen-rest requires --style=methods")
+	}
+	if cfg.restRouter != protogen.RouterMux && cfg.restRouter != protogen.RouterChi {
+		return fmt.Errorf("unknown --router: %s (valid: mux, chi)", cfg.restRouter)
+	}
+	procedureCall := cfg.backend == "procedure-call"
+	if procedureCall && cfg.rowsMode != "" && cfg.rowsMode != transpiler.RowsSlice {
+		return fmt.Errorf("--gen-rest returns result sets whole and requires --rows=slice")
+	}
+	err := forEachInput(cfg, func(source string) error {
+		_, err := doTranspile(cfg, source)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	opts := protogen.DefaultRESTGenOptions()
+	opts.PackageName = cfg.packageName
+	opts.BasePath = cfg.restBasePath
+	opts.Router = cfg.restRouter
+	opts.ProcedureCall = procedureCall
+	gen := protogen.NewRESTGenerator(cfg.collectedContracts, opts)
+
+	var handlers bytes.Buffer
+	if err := gen.GenerateHandlers(&handlers); err != nil {
+		return err
+	}
+	if cfg.transliterate {
+		code, err := transpiler.TransliterateGoIdentifiers(handlers.String())
+		if err != nil {
+			return err
+		}
+		handlers.Reset()
+		handlers.WriteString(code)
+	}
+
+	openAPIPath := cfg.openAPIFile
+	if cfg.outDir != "" {
+		if err := os.MkdirAll(cfg.outDir, 0755); err != nil {
+			return fmt.Errorf("creating output directory: %w", err)
+		}
+		if openAPIPath == "" {
+			openAPIPath = filepath.Join(cfg.outDir, "openapi.json")
+		}
+		restPath := filepath.Join(cfg.outDir, "rest.go")
+		if err := writeGeneratedFile(cfg, restPath, handlers.Bytes()); err != nil {
+			return err
+		}
+	} else if err := writeOutput(cfg, "", handlers.String()); err != nil {
+		return err
+	}
+
+	if openAPIPath != "" {
+		var spec bytes.Buffer
+		if err := gen.GenerateOpenAPI(&spec); err != nil {
+			return err
+		}
+		if err := writeGeneratedFile(cfg, openAPIPath, spec.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// forEachInput calls fn with the source of every input: the .sql files in
+// --dir, the input file or stdin.
+func forEachInput(cfg *config, fn func(source string) error) error {
+	switch {
+	case cfg.inputDir != "":
+		entries, err := os.ReadDir(cfg.inputDir)
+		if err != nil {
+			return fmt.Errorf("reading directory %s: %w", cfg.inputDir, err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasSuffix(strings.ToLower(entry.Name()), ".sql") {
+				continue
+			}
+			inputPath := filepath.Join(cfg.inputDir, entry.Name())
+			source, err := os.ReadFile(inputPath)
+			if err != nil {
+				return fmt.Errorf("reading %s: %w", inputPath, err)
+			}
+			cfg.sourceFile = inputPath
+			cfg.manifest.addSource(inputPath, source)
+			if err := fn(string(source)); err != nil {
+				return fmt.Errorf("%s: %w", inputPath, err)
+			}
+		}
+	case cfg.inputFile != "":
+		source, err := os.ReadFile(cfg.inputFile)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", cfg.inputFile, err)
+		}
+		cfg.sourceFile = cfg.inputFile
+		cfg.manifest.addSource(cfg.inputFile, source)
+		if err := fn(string(source)); err != nil {
+			return fmt.Errorf("%s: %w", cfg.inputFile, err)
+		}
+	case cfg.readStdin:
+		source, err := io.ReadAll(cfg.stdin)
+		if err != nil {
+			return fmt.Errorf("reading stdin: %w", err)
+		}
+		cfg.manifest.addSource("-", source)
+		return fn(string(source))
+	default:
+		return fmt.Errorf("no input specified")
+	}
+	return nil
+}
+
+// executeClusterReport parses every input for the tables each procedure
+// uses and the procedures it calls, then reports the services they cluster
+// into. The ownership of each table is also a suggestion, so
+// --apply-suggestions writes the --table-service mapping into the config
+// file.
+func executeClusterReport(cfg *config) error {
+	if cfg.clusterThreshold < 0 || cfg.clusterThreshold > 1 {
+		return fmt.Errorf("--cluster-threshold must be between 0 and 1")
+	}
+	var usage []transpiler.ProcedureContract
+	err := forEachInput(cfg, func(source string) error {
+		contracts, err := transpiler.ProcedureUsage(source)
+		usage = append(usage, contracts...)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	opts := transpiler.DefaultClusterOptions()
+	opts.Threshold = cfg.clusterThreshold
+	report := transpiler.ClusterProcedures(usage, opts)
+	cfg.diagnostics = append(cfg.diagnostics, report.Diagnostics()...)
+
+	var out string
+	switch cfg.outputFormat {
+	case "json":
+		data, err := transpiler.MarshalClusterJSON(report)
+		if err != nil {
+			return err
+		}
+		out = string(data)
+	case "html":
+		out = clusterReportHTML(report, len(usage))
+	case "text":
+		out = clusterReportText(report, len(usage))
+	default:
+		return fmt.Errorf("unknown --output-format for --cluster-report: %s (valid: text, json, html)", cfg.outputFormat)
+	}
+	return writeOutput(cfg, "", out)
+}
+
+// executeFeatureMatrix lists the features each procedure in every input
+// uses, for estimating and scheduling its migration.
+func executeFeatureMatrix(cfg *config) error {
+	var matrix []transpiler.ProcedureFeatures
+	err := forEachInput(cfg, func(source string) error {
+		features, err := transpiler.FeatureMatrix(source)
+		matrix = append(matrix, features...)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	switch cfg.outputFormat {
+	case "csv":
+		data, err = transpiler.MarshalFeatureMatrixCSV(matrix)
+	case "json":
+		data, err = transpiler.MarshalFeatureMatrixJSON(matrix)
+	case "text":
+		data = []byte(featureMatrixText(matrix))
+	default:
+		return fmt.Errorf("unknown --output-format for --feature-matrix: %s (valid: text, csv, json)", cfg.outputFormat)
+	}
+	if err != nil {
+		return err
+	}
+	return writeOutput(cfg, "", string(data))
+}
+
+// featureMatrixText renders a feature matrix for the terminal: each
+// procedure with the features it uses, then how many procedures use each.
+func featureMatrixText(matrix []transpiler.ProcedureFeatures) string {
+	var b strings.Builder
+	width := 0
+	for _, p := range matrix {
+		width = max(width, len(p.Procedure))
+	}
+	counts := make([]int, len(transpiler.FeatureNames))
+	for _, p := range matrix {
+		var uses []string
+		for i, used := range p.Flags() {
+			if used {
+				uses = append(uses, transpiler.FeatureNames[i])
+				counts[i]++
+			}
+		}
+		switch {
+		case p.ResultSets == 1:
+			uses = append(uses, "1 result set")
+		case p.ResultSets > 1:
+			uses = append(uses, fmt.Sprintf("%d result sets", p.ResultSets))
+		}
+		if len(uses) == 0 {
+			uses = []string{"-"}
+		}
+		fmt.Fprintf(&b, "%-*s  %s\n", width, p.Procedure, strings.Join(uses, ", "))
+	}
+	fmt.Fprintf(&b, "\nProcedures: %d\n", len(matrix))
+	for i, name := range transpiler.FeatureNames {
+		fmt.Fprintf(&b, "  %-15s %d\n", name+":", counts[i])
+	}
+	return b.String()
+}
+
+// executeAnalyze scores the procedures of every input and lists them in
+// the suggested migration order.
+func executeAnalyze(cfg *config) error {
+	var procs []transpiler.ProcedureComplexity
+	err := forEachInput(cfg, func(source string) error {
+		analysis, err := transpiler.AnalyzeComplexity(source)
+		procs = append(procs, analysis...)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	procs = transpiler.RankComplexity(procs)
+
+	var data []byte
+	switch cfg.outputFormat {
+	case "json":
+		data, err = transpiler.MarshalComplexityJSON(procs)
+	case "text":
+		data = []byte(analyzeText(procs))
+	default:
+		return fmt.Errorf("unknown --output-format for --analyze: %s (valid: text, json)", cfg.outputFormat)
+	}
+	if err != nil {
+		return err
+	}
+	return writeOutput(cfg, "", string(data))
+}
+
+// analyzeText renders a complexity analysis for the terminal: the
+// procedures in migration order with their score, rank and what makes it up.
+func analyzeText(procs []transpiler.ProcedureComplexity) string {
+	var b strings.Builder
+	width := len("Procedure")
+	total := 0
+	for _, p := range procs {
+		width = max(width, len(p.Procedure))
+		total += p.Score
+	}
+	fmt.Fprintf(&b, "%5s  %-*s  %5s  %4s  %s\n", "Order", width, "Procedure", "Score", "Rank", "Complexity")
+	for _, p := range procs {
+		parts := []string{fmt.Sprintf("%d statements", p.Statements)}
+		if p.Depth > 0 {
+			parts = append(parts, fmt.Sprintf("depth %d", p.Depth))
+		}
+		for _, f := range []struct {
+			used bool
+			name string
+		}{{p.Cursors, "cursors"}, {p.DynamicSQL, "dynamic SQL"}, {p.TempTables, "temp tables"}} {
+			if f.used {
+				parts = append(parts, f.name)
+			}
+		}
+		if len(p.Calls) > 0 {
+			parts = append(parts, "calls "+strings.Join(p.Calls, ", "))
+		}
+		fmt.Fprintf(&b, "%5d  %-*s  %5d  %4d  %s\n", p.Order, width, p.Procedure, p.Score, p.Rank, strings.Join(parts, "; "))
+	}
+	fmt.Fprintf(&b, "\nProcedures: %d, total score %d\n", len(procs), total)
+	b.WriteString("Order: procedures after those they call, otherwise the simplest first\n")
+	return b.String()
+}
+
+// executeDryRun transpiles every input without writing code and reports
+// how many of each file's statements are handled, left with TODOs,
+// skipped or failed. A file that doesn't parse is reported rather than
+// stopping the run.
+func executeDryRun(cfg *config) error {
+	dmlConfig, err := dmlConfigFor(cfg)
+	if err != nil {
+		return err
+	}
+	var files []*transpiler.FileCoverage
+	err = forEachInput(cfg, func(source string) error {
+		file := cfg.sourceFile
+		if file == "" {
+			file = "-"
+		}
+		coverage, err := transpiler.StatementCoverage(file, source, cfg.packageName, dmlConfig)
+		if err != nil {
+			coverage = &transpiler.FileCoverage{File: file, Error: err.Error()}
+		}
+		files = append(files, coverage)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	switch cfg.outputFormat {
+	case "json":
+		if files == nil {
+			files = []*transpiler.FileCoverage{}
+		}
+		if data, err = json.MarshalIndent(files, "", "  "); err != nil {
+			return err
+		}
+		data = append(data, '\n')
+	case "text":
+		data = []byte(dryRunText(files))
+	default:
+		return fmt.Errorf("unknown --output-format for --dry-run: %s (valid: text, json)", cfg.outputFormat)
+	}
+	return writeOutput(cfg, "", string(data))
+}
+
+// dryRunText renders statement coverage for the terminal: a row for each
+// file and the total, then the statements that failed.
+func dryRunText(files []*transpiler.FileCoverage) string {
+	var b strings.Builder
+	width := len("Total")
+	for _, f := range files {
+		width = max(width, len(f.File))
+	}
+	row := func(name string, c *transpiler.FileCoverage) {
+		fmt.Fprintf(&b, "%-*s  %10d  %7d  %4d  %7d  %6d  %7.1f%%\n", width, name, c.Statements(), c.Handled, c.TODO, c.Skipped, c.Failed, c.Percent())
+	}
+	fmt.Fprintf(&b, "%-*s  %10s  %7s  %4s  %7s  %6s  %8s\n", width, "File", "Statements", "Handled", "TODO", "Skipped", "Failed", "Coverage")
+	total := &transpiler.FileCoverage{}
+	for _, f := range files {
+		if f.Error != "" {
+			fmt.Fprintf(&b, "%-*s  %s\n", width, f.File, firstLine(f.Error))
+			continue
+		}
+		row(f.File, f)
+		total.Handled += f.Handled
+		total.TODO += f.TODO
+		total.Skipped += f.Skipped
+		total.Failed += f.Failed
+	}
+	if len(files) > 1 {
+		row("Total", total)
+	}
+
+	var failures []string
+	for _, f := range files {
+		for _, failure := range f.Failures {
+			where := f.File
+			if failure.Line > 0 {
+				where = fmt.Sprintf("%s:%d", f.File, failure.Line)
+			}
+			if failure.Procedure != "" {
+				where += " " + failure.Procedure
+			}
+			failures = append(failures, fmt.Sprintf("  %s (%d failed): %s", where, failure.Statements, firstLine(failure.Error)))
+		}
+	}
+	if len(failures) > 0 {
+		fmt.Fprintf(&b, "\nFailed:\n%s\n", strings.Join(failures, "\n"))
+	}
+	return b.String()
+}
+
+// firstLine returns the first line of an error message, with the line
+// after it when it only introduces a list ("parse errors:").
+func firstLine(msg string) string {
+	lines := strings.Split(strings.TrimSpace(msg), "\n")
+	if len(lines) > 1 && strings.HasSuffix(lines[0], ":") {
+		return lines[0] + " " + strings.TrimSpace(lines[1])
+	}
+	return lines[0]
+}
+
+// clusterReportText renders a cluster report for the terminal.
+func clusterReportText(report *transpiler.ClusterReport, procedures int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Suggested services: %d (from %d procedures)\n", len(report.Clusters), procedures)
+	for _, c := range report.Clusters {
+		fmt.Fprintf(&b, "\n%s (%d procedures, cohesion %.2f)\n", c.Service, len(c.Procedures), c.Cohesion)
+		fmt.Fprintf(&b, "  procedures: %s\n", strings.Join(c.Procedures, ", "))
+		if len(c.Tables) > 0 {
+			fmt.Fprintf(&b, "  owns:       %s\n", strings.Join(c.Tables, ", "))
+		}
+		if len(c.UsesTables) > 0 {
+			fmt.Fprintf(&b, "  uses:       %s\n", strings.Join(c.UsesTables, ", "))
+		}
+		if len(c.Calls) > 0 {
+			fmt.Fprintf(&b, "  calls:      %s\n", strings.Join(c.Calls, ", "))
+		}
+	}
+	if len(report.Unclustered) > 0 {
+		fmt.Fprintf(&b, "\nUnclustered (no tables): %s\n", strings.Join(report.Unclustered, ", "))
+	}
+	if flag := report.TableServiceFlag(); flag != "" {
+		fmt.Fprintf(&b, "\n--table-service=%s\n", flag)
+	}
+	return b.String()
+}
+
+// clusterReportHTML renders a cluster report as a standalone page, styled
+// like the --show-mappings report.
+func clusterReportHTML(report *transpiler.ClusterReport, procedures int) string {
+	var b strings.Builder
+	tables := len(report.TableToService)
+	fmt.Fprintf(&b, `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="UTF-8">
+<meta name="viewport" content="width=device-width, initial-scale=1.0">
+<title>tgpiler Service Clusters</title>
+<style>
+:root { --bg: #f8f9fa; --card: #fff; --text: #1a1a2e; --border: rgba(0,0,0,0.1); --hover: rgba(0,0,0,0.05); }
+@media (prefers-color-scheme: dark) {
+  :root { --bg: #1a1a2e; --card: #16213e; --text: #eee; --border: rgba(255,255,255,0.1); --hover: rgba(255,255,255,0.1); }
+}
+* { box-sizing: border-box; margin: 0; padding: 0; }
+body { font-family: system-ui, -apple-system, sans-serif; background: var(--bg); color: var(--text); padding: 2rem; }
+h1 { margin-bottom: 1.5rem; }
+.stats { display: grid; grid-template-columns: repeat(auto-fit, minmax(150px, 1fr)); gap: 1rem; margin-bottom: 2rem; }
+.stat-card { background: var(--card); padding: 1rem; border-radius: 8px; text-align: center; box-shadow: 0 1px 3px var(--border); }
+.stat-value { font-size: 2rem; font-weight: bold; }
+.stat-label { font-size: 0.875rem; opacity: 0.7; }
+.service { background: var(--card); border-radius: 8px; margin-bottom: 1rem; overflow: hidden; box-shadow: 0 1px 3px var(--border); }
+.service-header { padding: 1rem; background: var(--hover); }
+table { width: 100%%; border-collapse: collapse; }
+th, td { padding: 0.75rem 1rem; text-align: left; border-bottom: 1px solid var(--border); vertical-align: top; }
+th { width: 10rem; font-weight: 600; }
+code, pre { font-family: monospace; font-size: 0.875rem; }
+pre { background: var(--card); padding: 1rem; border-radius: 8px; margin-top: 1rem; white-space: pre-wrap; word-break: break-all; box-shadow: 0 1px 3px var(--border); }
+</style>
+</head>
+<body>
+<h1>tgpiler Service Clusters</h1>
+
+<div class="stats">
+<div class="stat-card"><div class="stat-value">%d</div><div class="stat-label">Services</div></div>
+<div class="stat-card"><div class="stat-value">%d</div><div class="stat-label">Procedures</div></div>
+<div class="stat-card"><div class="stat-value">%d</div><div class="stat-label">Tables</div></div>
+<div class="stat-card"><div class="stat-value">%d</div><div class="stat-label">Unclustered</div></div>
+</div>
+`, len(report.Clusters), procedures, tables, len(report.Unclustered))
+
+	codeList := func(items []string) string {
+		escaped := make([]string, len(items))
+		for i, item := range items {
+			escaped[i] = "<code>" + html.EscapeString(item) + "</code>"
+		}
+		return strings.Join(escaped, ", ")
+	}
+	for _, c := range report.Clusters {
+		fmt.Fprintf(&b, `<div class="service">
+<div class="service-header"><strong>%s</strong> (%d procedures, cohesion %.2f)</div>
+<table>
+<tr><th>Procedures</th><td>%s</td></tr>
+`, html.EscapeString(c.Service), len(c.Procedures), c.Cohesion, codeList(c.Procedures))
+		if len(c.Tables) > 0 {
+			fmt.Fprintf(&b, "<tr><th>Owns</th><td>%s</td></tr>\n", codeList(c.Tables))
+		}
+		if len(c.UsesTables) > 0 {
+			fmt.Fprintf(&b, "<tr><th>Uses</th><td>%s</td></tr>\n", codeList(c.UsesTables))
+		}
+		if len(c.Calls) > 0 {
+			fmt.Fprintf(&b, "<tr><th>Calls</th><td>%s</td></tr>\n", codeList(c.Calls))
+		}
+		b.WriteString("</table></div>\n")
+	}
+	if len(report.Unclustered) > 0 {
+		fmt.Fprintf(&b, "<h3>Unclustered Procedures (%d)</h3>\n<p>%s</p>\n", len(report.Unclustered), codeList(report.Unclustered))
+	}
+	if flag := report.TableServiceFlag(); flag != "" {
+		fmt.Fprintf(&b, "<pre>--table-service=%s</pre>\n", html.EscapeString(flag))
+	}
+	b.WriteString("</body>\n</html>\n")
+	return b.String()
+}
+
+// writeGeneratedFile writes an auxiliary output file, honouring --force.
+func writeGeneratedFile(cfg *config, path string, data []byte) error {
+	if !cfg.force {
+		if _, err := os.Stat(path); err == nil {
+			return fmt.Errorf("output file %s already exists (use --force to overwrite)", path)
+		}
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	cfg.manifest.addFile(path)
+	fmt.Fprintf(cfg.stderr, "wrote %s\n", path)
+	return nil
+}
+
+// manifest lists what a run read and wrote (--manifest), for tools that
+// package the output, assign it for review or re-run only what changed.
+// Files written to stdout aren't listed.
+type manifest struct {
+	Tgpiler     string           `json:"tgpiler"`
+	ConfigHash  string           `json:"config_hash"` // See configHash
+	Sources     []manifestSource `json:"sources"`
+	Files       []manifestFile   `json:"files"`
+	Warnings    int              `json:"warnings"`
+	Diagnostics int              `json:"diagnostics"`
+
+	written int // Sources before this one are in a file already
+}
+
+// manifestSource is an input of a run.
+type manifestSource struct {
+	Path       string   `json:"path"` // "-" for stdin
+	SHA256     string   `json:"sha256"`
+	Procedures []string `json:"procedures,omitempty"`
+}
+
+// manifestFile is a file a run wrote.
+type manifestFile struct {
+	Path       string   `json:"path"`
+	SHA256     string   `json:"sha256"`
+	Sources    []string `json:"sources,omitempty"`
+	Procedures []string `json:"procedures,omitempty"`
+}
+
+// addSource records an input and the procedures in it. A source that
+// doesn't parse is listed without them.
+func (m *manifest) addSource(path string, source []byte) {
+	if m == nil {
+		return
+	}
+	usage, _ := transpiler.ProcedureUsage(string(source))
+	sum := sha256.Sum256(source)
+	m.addStreamedSource(path, sum[:], usage)
+}
+
+// addStreamedSource records an input with the hash of its content and the
+// contracts of its procedures.
+func (m *manifest) addStreamedSource(path string, sum []byte, contracts []transpiler.ProcedureContract) {
+	if m == nil {
+		return
+	}
+	src := manifestSource{Path: path, SHA256: hex.EncodeToString(sum)}
+	for _, c := range contracts {
+		src.Procedures = append(src.Procedures, c.Name)
+	}
+	m.Sources = append(m.Sources, src)
+}
+
+// addFile records a written file. Its sources are those read since the
+// last file was written, or every source for a file written after them
+// all, such as repository.go or openapi.json.
+func (m *manifest) addFile(path string) {
+	if m == nil {
+		return
+	}
+	sources := m.Sources[m.written:]
+	if len(sources) == 0 {
+		sources = m.Sources
+	}
+	m.written = len(m.Sources)
+	f := manifestFile{Path: path}
+	for _, src := range sources {
+		f.Sources = append(f.Sources, src.Path)
+		f.Procedures = append(f.Procedures, src.Procedures...)
+	}
+	m.Files = append(m.Files, f)
+}
+
+// write hashes the files written and writes the manifest to path.
+func (m *manifest) write(cfg *config, path string) error {
+	for i := range m.Files {
+		f, err := os.Open(m.Files[i].Path)
+		if err != nil {
+			return err
+		}
+		hash := sha256.New()
+		_, err = io.Copy(hash, f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", m.Files[i].Path, err)
+		}
+		m.Files[i].SHA256 = hex.EncodeToString(hash.Sum(nil))
+	}
+	if m.Sources == nil {
+		m.Sources = []manifestSource{}
+	}
+	if m.Files == nil {
+		m.Files = []manifestFile{}
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeGeneratedFile(cfg, path, append(data, '\n'))
+}
+
+// configHash hashes the flags set, on the command line or in the config
+// file, that shape the output: runs with the same hash generate the same
+// code from the same sources. Where the input and output go doesn't count.
+func configHash(fs *flag.FlagSet) string {
+	long := map[string]string{"p": "pkg"}
+	ignored := map[string]bool{
+		"d": true, "dir": true, "s": true, "stdin": true, "o": true, "output": true,
+		"O": true, "outdir": true, "f": true, "force": true, "config": true, "manifest": true,
+	}
+	var settings []string
+	fs.Visit(func(f *flag.Flag) {
+		if ignored[f.Name] {
+			return
+		}
+		name := f.Name
+		if l, ok := long[name]; ok {
+			name = l
+		}
+		settings = append(settings, name+"="+f.Value.String())
+	})
+	sort.Strings(settings)
+	sum := sha256.Sum256([]byte(strings.Join(settings, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// printSideEffectsReport lists the mail and events that generated code
+// hands to application interfaces, which need real implementations.
+func printSideEffectsReport(w io.Writer, effects []transpiler.SideEffect) {
+	fmt.Fprintf(w, "\nExternal Side Effects\n=====================\n")
+	if len(effects) == 0 {
+		fmt.Fprintln(w, "No mail or events are sent.")
+		return
+	}
+	counts := map[string]int{}
+	for _, e := range effects {
+		counts[e.Kind]++
+	}
+	fmt.Fprintf(w, "%d call(s) need a real implementation (mail: %d, event: %d)\n\n", len(effects), counts["mail"], counts["event"])
+	for _, e := range effects {
+		fmt.Fprintf(w, "  %s\n", e)
+	}
+}
+
+// printPerformanceReport writes the plan hints found in the input, the
+// queries whose plans to check on the target database.
+func printPerformanceReport(w io.Writer, notes []transpiler.PerformanceNote) {
+	fmt.Fprintf(w, "\nPerformance Notes\n=================\n")
+	if len(notes) == 0 {
+		fmt.Fprintln(w, "No plan hints are used.")
+		return
+	}
+	recompile, optimizeFor := 0, 0
+	for _, n := range notes {
+		if strings.Contains(n.Hint, "RECOMPILE") {
+			recompile++
+		}
+		if strings.Contains(n.Hint, "OPTIMIZE FOR") {
+			optimizeFor++
+		}
+	}
+	fmt.Fprintf(w, "%d plan hint(s) aren't carried over (RECOMPILE: %d, OPTIMIZE FOR: %d); check these queries' plans on the target database\n\n",
+		len(notes), recompile, optimizeFor)
+	for _, n := range notes {
+		fmt.Fprintf(w, "  %s\n", n)
+	}
+}
+
+// mappingDiagnostic returns the suggestion to pin a mapping whose
+// confidence is below threshold with --grpc-mappings.
+func mappingDiagnostic(key string, mapping *storage.MethodMapping, threshold float64) (transpiler.Diagnostic, bool) {
+	if mapping.Confidence >= threshold {
+		return transpiler.Diagnostic{}, false
+	}
+	return transpiler.Diagnostic{
+		Message: fmt.Sprintf("%s -> %s has low confidence (%.0f%%)", key, mapping.Procedure.Name, mapping.Confidence*100),
+		Suggestion: transpiler.Suggestion{Flag: "grpc-mappings", Key: mapping.Procedure.Name, Value: key},
+	}, true
+}
+
+// rpcLocation returns the proto file and line the rpc Service.Method of
+// key is declared on, the line 0 if the file can't be read.
+func rpcLocation(proto *storage.ProtoParseResult, key string) (string, int) {
+	service, method, _ := strings.Cut(key, ".")
+	for _, file := range proto.Files {
+		if file.GetService(service) == nil {
+			continue
+		}
+		source, err := os.ReadFile(file.Path)
+		if err != nil {
+			return file.Path, 0
+		}
+		rpc := regexp.MustCompile(`^\s*rpc\s+` + regexp.QuoteMeta(method) + `\s*\(`)
+		for i, line := range strings.Split(string(source), "\n") {
+			if rpc.MatchString(line) {
+				return file.Path, i + 1
+			}
+		}
+		return file.Path, 0
+	}
+	return "", 0
+}
+
+// sortedKeys returns the keys of m in order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// uniqueDiagnostics drops diagnostics suggesting the same setting as an
+// earlier one, such as the same table reported by several files.
+func uniqueDiagnostics(diags []transpiler.Diagnostic) []transpiler.Diagnostic {
+	seen := map[string]bool{}
+	var out []transpiler.Diagnostic
+	for _, d := range diags {
+		if s := d.Suggestion.String(); !seen[s] {
+			seen[s] = true
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// Config file
+//
+// tgpiler.yaml holds flag defaults, one "flag: value" per line, with
+// flags given on the command line taking precedence. A list of mappings
+// can also be written as YAML list items under its flag, joined with
+// commas:
+//
+//	# tgpiler.yaml
+//	backend: grpc
+//	table-service:
+//	  - Orders:OrderService
+//	  - Products:CatalogService
+//
+// Only this subset of YAML is read, as it is in naming and verbs files.
+// --apply-suggestions merges suggested fixes into the file, keeping its
+// other lines as they are.
+
+const defaultConfigFile = "tgpiler.yaml"
+
+var configLineRe = regexp.MustCompile(`^([a-z][a-z0-9-]*)\s*:\s*(.*)$`)
+
+// configEntry is a flag set in a config file, on lines start to end - 1.
+type configEntry struct {
+	name, value string
+	start, end  int
+	list        bool // Given no value on its line, so list items may follow
+}
+
+// parseConfig returns the flags set by the lines of path.
+func parseConfig(path string, lines []string) ([]configEntry, error) {
+	var entries []configEntry
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if item, ok := strings.CutPrefix(line, "- "); ok {
+			// An item of the list the last flag started
+			last := len(entries) - 1
+			if last < 0 || !entries[last].list {
+				return nil, fmt.Errorf("%s:%d: list item %q is not under a flag without a value", path, i+1, item)
+			}
+			value, err := configValue(entries[last].name, strings.TrimSpace(item))
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", path, i+1, err)
+			}
+			e := &entries[last]
+			e.value = strings.TrimPrefix(e.value+","+value, ",")
+			e.end = i + 1
+			continue
+		}
+		m := configLineRe.FindStringSubmatch(line)
+		if m == nil {
+			return nil, fmt.Errorf("%s:%d: expected \"flag: value\", got %q", path, i+1, line)
+		}
+		value, err := configValue(m[1], m[2])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, i+1, err)
+		}
+		entries = append(entries, configEntry{name: m[1], value: value, start: i, end: i + 1, list: m[2] == ""})
+	}
+	return entries, nil
+}
+
+// configValue returns the value of a config line, unquoted.
+func configValue(name, value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		unquoted, err := strconv.Unquote(value)
+		if err != nil {
+			return "", fmt.Errorf("bad quoted value for %s: %s", name, value)
+		}
+		return unquoted, nil
+	case strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'") && len(value) > 1:
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'"), nil
+	}
+	return value, nil
+}
+
+// loadConfigFile sets each flag in path that the command line didn't. A
+// missing default file is ignored.
+func loadConfigFile(fs *flag.FlagSet, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) && path == defaultConfigFile {
+			return nil
+		}
+		return fmt.Errorf("reading config: %w", err)
+	}
+	entries, err := parseConfig(path, strings.Split(string(data), "\n"))
+	if err != nil {
+		return err
+	}
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	for _, e := range entries {
+		if set[e.name] {
+			continue
 		}
-
-		result, err := doTranspile(cfg, string(source))
-		if err != nil {
-			return fmt.Errorf("%s: %w", inputPath, err)
+		if fs.Lookup(e.name) == nil {
+			return fmt.Errorf("%s:%d: unknown flag %q", path, e.start+1, e.name)
 		}
+		if err := fs.Set(e.name, e.value); err != nil {
+			return fmt.Errorf("%s:%d: %s: %v", path, e.start+1, e.name, err)
+		}
+	}
+	return nil
+}
 
-		if cfg.outDir != "" {
-			outName := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name())) + ".go"
-			outPath := filepath.Join(cfg.outDir, outName)
+// applySuggestions merges the suggested settings into the config file at
+// path, creating it if needed, and returns how many changed it. A mapping
+// entry replaces the entry with the same key; other settings replace the
+// flag's value. A flag written as a list is rewritten on one line.
+func applySuggestions(path string, diags []transpiler.Diagnostic) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+	var lines []string
+	if len(data) > 0 {
+		lines = strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	}
 
-			if !cfg.force {
-				if _, err := os.Stat(outPath); err == nil {
-					return fmt.Errorf("output file %s already exists (use --force to overwrite)", outPath)
-				}
+	changed := 0
+	for _, d := range diags {
+		s := d.Suggestion
+		entries, err := parseConfig(path, lines)
+		if err != nil {
+			return 0, err
+		}
+		found := false
+		for _, e := range entries {
+			if e.name != s.Flag {
+				continue
 			}
-
-			if err := os.WriteFile(outPath, []byte(result), 0644); err != nil {
-				return fmt.Errorf("writing %s: %w", outPath, err)
+			found = true
+			merged := s.Setting()
+			if s.Key != "" && e.value != "" {
+				merged = mergeMappingEntry(e.value, s.Key, s.Value)
 			}
-			fmt.Fprintf(cfg.stderr, "%s -> %s\n", inputPath, outPath)
-		} else {
-			fmt.Fprintln(cfg.stdout, result)
+			if merged != e.value {
+				line := fmt.Sprintf("%s: %s", s.Flag, strconv.Quote(merged))
+				lines = append(lines[:e.start], append([]string{line}, lines[e.end:]...)...)
+				changed++
+			}
+			break
 		}
+		if !found {
+			lines = append(lines, fmt.Sprintf("%s: %s", s.Flag, strconv.Quote(s.Setting())))
+			changed++
+		}
+	}
+	if changed == 0 {
+		return 0, nil
 	}
+	return changed, os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
 
-	return nil
+// mergeMappingEntry sets key to value in a Key:Value,Key:Value list.
+func mergeMappingEntry(list, key, value string) string {
+	entries := strings.Split(list, ",")
+	for i, entry := range entries {
+		if k, _, ok := strings.Cut(strings.TrimSpace(entry), ":"); ok && strings.EqualFold(k, key) {
+			entries[i] = key + ":" + value
+			return strings.Join(entries, ",")
+		}
+	}
+	return list + "," + key + ":" + value
 }
 
-func writeOutput(cfg *config, inputPath, content string) error {
-	if cfg.output != "" {
-		if !cfg.force {
-			if _, err := os.Stat(cfg.output); err == nil {
-				return fmt.Errorf("output file %s already exists (use --force to overwrite)", cfg.output)
+// printSecurityReport writes the dynamic SQL audit as a report section,
+// most severe findings first.
+func printSecurityReport(w io.Writer, findings []transpiler.SecurityFinding) {
+	fmt.Fprintf(w, "\nSecurity Report\n===============\n")
+	if len(findings) == 0 {
+		fmt.Fprintln(w, "No variables are concatenated into dynamic SQL.")
+		return
+	}
+	counts := map[string]int{}
+	for _, f := range findings {
+		counts[f.Severity]++
+	}
+	fmt.Fprintf(w, "%d variable(s) concatenated into dynamic SQL (high: %d, medium: %d, low: %d)\n\n",
+		len(findings), counts[transpiler.SeverityHigh], counts[transpiler.SeverityMedium], counts[transpiler.SeverityLow])
+	for _, severity := range []string{transpiler.SeverityHigh, transpiler.SeverityMedium, transpiler.SeverityLow} {
+		for _, f := range findings {
+			if f.Severity == severity {
+				fmt.Fprintf(w, "  %s\n", f)
 			}
 		}
-		if err := os.WriteFile(cfg.output, []byte(content), 0644); err != nil {
-			return fmt.Errorf("writing %s: %w", cfg.output, err)
+	}
+}
+
+// executeLint checks a directory of generated code. Protos and source SQL
+// are optional and enable the gRPC method and procedure drift checks.
+func executeLint(cfg *config) error {
+	files, err := lint.LoadDir(cfg.lintDir)
+	if err != nil {
+		return err
+	}
+
+	var opts lint.Options
+	if cfg.protoDir != "" || cfg.protoFile != "" {
+		if opts.Protos, err = parseProtoFiles(cfg); err != nil {
+			return err
+		}
+	}
+	if cfg.sqlDir != "" {
+		if opts.Procedures, err = parseSQLProcedures(cfg); err != nil {
+			return err
 		}
-		return nil
 	}
 
-	fmt.Fprint(cfg.stdout, content)
+	findings, err := lint.Run(files, opts)
+	if err != nil {
+		return err
+	}
+	for _, f := range findings {
+		fmt.Fprintln(cfg.stdout, f)
+	}
+	if len(findings) > 0 {
+		return fmt.Errorf("lint: %d finding(s) in %s", len(findings), cfg.lintDir)
+	}
+	fmt.Fprintf(cfg.stderr, "lint: %d file(s) OK\n", len(files))
 	return nil
 }
 
@@ -676,6 +3067,73 @@ func parseSQLProcedures(cfg *config) ([]*storage.Procedure, error) {
 	return allProcs, nil
 }
 
+// loadSchema reads the computed and identity columns and the table types
+// declared in a schema script, in every .sql file of a directory, or in
+// the tables and table types of a dacpac.
+func loadSchema(path string) (map[string]map[string]string, []transpiler.TableType, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading schema: %w", err)
+	}
+	if strings.EqualFold(filepath.Ext(path), ".dacpac") {
+		model, err := dacpac.Read(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading %s: %w", path, err)
+		}
+		var scripts []string
+		for _, obj := range model.Objects {
+			if obj.Type == dacpac.Table || obj.Type == dacpac.TableType {
+				scripts = append(scripts, obj.Script)
+			}
+		}
+		return schemaOf(path, strings.Join(scripts, "\n\n"))
+	}
+	files := []string{path}
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading directory %s: %w", path, err)
+		}
+		files = nil
+		for _, entry := range entries {
+			if !entry.IsDir() && strings.HasSuffix(strings.ToLower(entry.Name()), ".sql") {
+				files = append(files, filepath.Join(path, entry.Name()))
+			}
+		}
+	}
+
+	all := map[string]map[string]string{}
+	var tableTypes []transpiler.TableType
+	for _, file := range files {
+		source, err := os.ReadFile(file)
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading %s: %w", file, err)
+		}
+		tables, types, err := schemaOf(file, string(source))
+		if err != nil {
+			return nil, nil, err
+		}
+		for table, cols := range tables {
+			all[table] = cols
+		}
+		tableTypes = append(tableTypes, types...)
+	}
+	return all, tableTypes, nil
+}
+
+// schemaOf reads the generated columns and table types of one script.
+func schemaOf(file, source string) (map[string]map[string]string, []transpiler.TableType, error) {
+	tables, err := transpiler.GeneratedColumns(source)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", file, err)
+	}
+	types, err := transpiler.TableTypes(source)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return tables, types, nil
+}
+
 // parseSQLFile parses a single SQL file and extracts procedures
 func parseSQLFile(path string) ([]*storage.Procedure, error) {
 	source, err := os.ReadFile(path)
@@ -695,9 +3153,39 @@ func parseSQLFile(path string) ([]*storage.Procedure, error) {
 // showMappings displays procedure-to-method mappings
 func showMappings(cfg *config, proto *storage.ProtoParseResult, procedures []*storage.Procedure) error {
 	mapper := storage.NewEnsembleMapper(proto, procedures)
+	if cfg.verbsFile != "" {
+		mapper.SetVerbs(cfg.verbs.Verbs(), cfg.verbs.Remove)
+	}
+	if cfg.mappingWeights != "" {
+		weights := map[string]float64{}
+		for name, value := range parseMapping(cfg.mappingWeights) {
+			w, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("--mapping-weights: %s: %s is not a number", name, value)
+			}
+			weights[name] = w
+		}
+		if err := mapper.SetWeights(weights); err != nil {
+			return fmt.Errorf("--mapping-weights: %w", err)
+		}
+	}
 	mappings := mapper.MapAll()
 	stats := mapper.GetStats()
 
+	if cfg.mappingDiff != "" {
+		return showMappingsDiff(cfg, mappingData(cfg, mappings, stats, procedures))
+	}
+
+	// Pinning a low-confidence mapping makes it explicit and reviewable
+	threshold := float64(cfg.warnThreshold) / 100.0
+	for _, key := range sortedKeys(mappings) {
+		if d, ok := mappingDiagnostic(key, mappings[key], threshold); ok {
+			cfg.diagnostics = append(cfg.diagnostics, d)
+			file, line := rpcLocation(proto, key)
+			cfg.issues = append(cfg.issues, d.Issue(file, line))
+		}
+	}
+
 	switch cfg.outputFormat {
 	case "json":
 		return showMappingsJSON(cfg, mappings, stats, procedures)
@@ -728,6 +3216,7 @@ type MethodMapping struct {
 	Confidence float64  `json:"confidence"`
 	Signals    []string `json:"signals"`
 	Warnings   []string `json:"warnings,omitempty"`
+	Suggestion *transpiler.Suggestion `json:"suggestion,omitempty"`
 }
 
 type MappingStats struct {
@@ -921,12 +3410,12 @@ func splitWords(s string) []string {
 				words = append(words, current.String())
 				current.Reset()
 			}
-		} else if i > 0 && r >= 'A' && r <= 'Z' {
+		} else if i > 0 && unicode.IsUpper(r) {
 			if current.Len() > 0 {
 				words = append(words, current.String())
 				current.Reset()
 			}
-			current.WriteRune(r + 32) // lowercase
+			current.WriteRune(unicode.ToLower(r))
 		} else {
 			current.WriteRune(r)
 		}
@@ -938,6 +3427,13 @@ func splitWords(s string) []string {
 }
 
 func showMappingsJSON(cfg *config, mappings map[string]*storage.MethodMapping, stats storage.MappingStats, procedures []*storage.Procedure) error {
+	enc := json.NewEncoder(cfg.stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(mappingData(cfg, mappings, stats, procedures))
+}
+
+// mappingData returns the mappings as --output-format json writes them.
+func mappingData(cfg *config, mappings map[string]*storage.MethodMapping, stats storage.MappingStats, procedures []*storage.Procedure) MappingData {
 	data := MappingData{
 		Statistics: MappingStats{
 			Total:            stats.TotalMethods,
@@ -972,6 +3468,9 @@ func showMappingsJSON(cfg *config, mappings map[string]*storage.MethodMapping, s
 		if mapping.Confidence < 0.5 {
 			mm.Warnings = append(mm.Warnings, "Low confidence - manual review recommended")
 		}
+		if d, ok := mappingDiagnostic(key, mapping, float64(cfg.warnThreshold)/100.0); ok {
+			mm.Suggestion = &d.Suggestion
+		}
 		serviceMap[svcName].Mappings = append(serviceMap[svcName].Mappings, mm)
 	}
 
@@ -990,9 +3489,121 @@ func showMappingsJSON(cfg *config, mappings map[string]*storage.MethodMapping, s
 		}
 	}
 
-	enc := json.NewEncoder(cfg.stdout)
-	enc.SetIndent("", "  ")
-	return enc.Encode(data)
+	return data
+}
+
+// mappingRegression is the fall in confidence --diff reports, 5 points.
+const mappingRegression = 0.05
+
+// MappingDiff is how mappings changed since an earlier run (--diff).
+type MappingDiff struct {
+	Previous  string          `json:"previous"`
+	Added     []MappingChange `json:"added"`
+	Removed   []MappingChange `json:"removed"`
+	Changed   []MappingChange `json:"changed"`   // To another procedure
+	Regressed []MappingChange `json:"regressed"` // Less confident by mappingRegression or more
+}
+
+// MappingChange is a method's mapping in a MappingDiff, before and after.
+type MappingChange struct {
+	RPC                string  `json:"rpc"` // Service.Method
+	Procedure          string  `json:"procedure,omitempty"`
+	Confidence         float64 `json:"confidence,omitempty"`
+	PreviousProcedure  string  `json:"previous_procedure,omitempty"`
+	PreviousConfidence float64 `json:"previous_confidence,omitempty"`
+}
+
+// drift reports whether a mapping was lost, moved or weakened, which
+// --diff fails on. New mappings are not drift.
+func (d MappingDiff) drift() int {
+	return len(d.Removed) + len(d.Changed) + len(d.Regressed)
+}
+
+// diffMappings compares current with previous, by service and method.
+func diffMappings(previous, current MappingData) MappingDiff {
+	flatten := func(data MappingData) map[string]MethodMapping {
+		byRPC := map[string]MethodMapping{}
+		for _, svc := range data.Services {
+			for _, m := range svc.Mappings {
+				byRPC[svc.Name+"."+m.RPC] = m
+			}
+		}
+		return byRPC
+	}
+	before, after := flatten(previous), flatten(current)
+
+	diff := MappingDiff{Added: []MappingChange{}, Removed: []MappingChange{}, Changed: []MappingChange{}, Regressed: []MappingChange{}}
+	for _, rpc := range sortedKeys(after) {
+		now := after[rpc]
+		change := MappingChange{RPC: rpc, Procedure: now.Procedure, Confidence: now.Confidence}
+		was, ok := before[rpc]
+		if !ok {
+			diff.Added = append(diff.Added, change)
+			continue
+		}
+		change.PreviousProcedure, change.PreviousConfidence = was.Procedure, was.Confidence
+		switch {
+		case now.Procedure != was.Procedure:
+			diff.Changed = append(diff.Changed, change)
+		case was.Confidence-now.Confidence >= mappingRegression:
+			diff.Regressed = append(diff.Regressed, change)
+		}
+	}
+	for _, rpc := range sortedKeys(before) {
+		if _, ok := after[rpc]; !ok {
+			was := before[rpc]
+			diff.Removed = append(diff.Removed, MappingChange{RPC: rpc, PreviousProcedure: was.Procedure, PreviousConfidence: was.Confidence})
+		}
+	}
+	return diff
+}
+
+// showMappingsDiff writes how current differs from the mappings in
+// cfg.mappingDiff, and fails if any were lost, moved or weakened.
+func showMappingsDiff(cfg *config, current MappingData) error {
+	source, err := os.ReadFile(cfg.mappingDiff)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", cfg.mappingDiff, err)
+	}
+	var previous MappingData
+	if err := json.Unmarshal(source, &previous); err != nil {
+		return fmt.Errorf("%s: not --show-mappings --output-format json output: %w", cfg.mappingDiff, err)
+	}
+	diff := diffMappings(previous, current)
+	diff.Previous = cfg.mappingDiff
+
+	switch cfg.outputFormat {
+	case "json":
+		enc := json.NewEncoder(cfg.stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(diff); err != nil {
+			return err
+		}
+	case "text", "":
+		fmt.Fprintf(cfg.stdout, "Mappings since %s: %d added, %d removed, %d changed, %d regressed\n",
+			cfg.mappingDiff, len(diff.Added), len(diff.Removed), len(diff.Changed), len(diff.Regressed))
+		for _, c := range diff.Added {
+			fmt.Fprintf(cfg.stdout, "  + %s -> %s (%.0f%%)\n", c.RPC, c.Procedure, c.Confidence*100)
+		}
+		for _, c := range diff.Removed {
+			fmt.Fprintf(cfg.stdout, "  - %s -> %s (%.0f%%)\n", c.RPC, c.PreviousProcedure, c.PreviousConfidence*100)
+		}
+		for _, c := range diff.Changed {
+			fmt.Fprintf(cfg.stdout, "  ~ %s -> %s (%.0f%%), was %s (%.0f%%)\n",
+				c.RPC, c.Procedure, c.Confidence*100, c.PreviousProcedure, c.PreviousConfidence*100)
+		}
+		for _, c := range diff.Regressed {
+			fmt.Fprintf(cfg.stdout, "  ! %s -> %s: %.0f%%, was %.0f%%\n",
+				c.RPC, c.Procedure, c.Confidence*100, c.PreviousConfidence*100)
+		}
+	default:
+		return fmt.Errorf("unknown --output-format for --diff: %s (valid: text, json)", cfg.outputFormat)
+	}
+
+	if n := diff.drift(); n > 0 {
+		return fmt.Errorf("mappings: %d removed, changed or regressed since %s", n, cfg.mappingDiff)
+	}
+	return nil
 }
 
 func showMappingsMarkdown(cfg *config, mappings map[string]*storage.MethodMapping, stats storage.MappingStats, procedures []*storage.Procedure) error {
@@ -1065,6 +3676,231 @@ func showMappingsMarkdown(cfg *config, mappings map[string]*storage.MethodMappin
 	return nil
 }
 
+// writeMigrationReport writes the --report of the run, as HTML if the file
+// ends in .html or .htm and Markdown otherwise.
+func writeMigrationReport(cfg *config) error {
+	var out string
+	switch strings.ToLower(filepath.Ext(cfg.reportFile)) {
+	case ".html", ".htm":
+		out = migrationReportHTML(cfg.migration)
+	default:
+		out = migrationReportMarkdown(cfg.migration)
+	}
+	if err := os.WriteFile(cfg.reportFile, []byte(out), 0644); err != nil {
+		return err
+	}
+	cfg.manifest.addFile(cfg.reportFile)
+	fmt.Fprintf(cfg.stderr, "wrote %s\n", cfg.reportFile)
+	return nil
+}
+
+// migrationHotspots is how many procedures a migration report lists as
+// hotspots.
+const migrationHotspots = 10
+
+// usedFeatures returns the names of the features p uses.
+func usedFeatures(p transpiler.ProcedureReport) []string {
+	var uses []string
+	for i, used := range p.Features.Flags() {
+		if used {
+			uses = append(uses, transpiler.FeatureNames[i])
+		}
+	}
+	return uses
+}
+
+// issueLocation returns where an issue is, file:line.
+func issueLocation(issue transpiler.Issue) string {
+	if issue.Line > 0 {
+		return fmt.Sprintf("%s:%d", issue.File, issue.Line)
+	}
+	return issue.File
+}
+
+// migrationReportMarkdown renders a migration report as Markdown.
+func migrationReportMarkdown(r *transpiler.MigrationReport) string {
+	var b strings.Builder
+	statements := 0
+	for _, n := range r.Statements {
+		statements += n
+	}
+	b.WriteString("# tgpiler Migration Report\n\n")
+	b.WriteString("| Files | Procedures | Statements | TODOs | Warnings | Unsupported |\n")
+	b.WriteString("|------:|-----------:|-----------:|------:|---------:|------------:|\n")
+	fmt.Fprintf(&b, "| %d | %d | %d | %d | %d | %d |\n",
+		len(r.Files), len(r.Procedures), statements, r.TODOs, r.Warnings, len(r.Unsupported))
+
+	if hot := r.Hotspots(migrationHotspots); len(hot) > 0 {
+		b.WriteString("\n## Hotspots\n\n")
+		b.WriteString("Procedures likely to need the most work by hand.\n\n")
+		b.WriteString("| Procedure | File | Effort | TODOs | Warnings | Features |\n")
+		b.WriteString("|-----------|------|-------:|------:|---------:|----------|\n")
+		for _, p := range hot {
+			fmt.Fprintf(&b, "| `%s` | %s | %d | %d | %d | %s |\n",
+				p.Features.Procedure, p.File, p.Effort, p.TODOs, p.Warnings, strings.Join(usedFeatures(p), ", "))
+		}
+	}
+
+	b.WriteString("\n## Statements\n\n")
+	b.WriteString("| Statement | Count |\n")
+	b.WriteString("|-----------|------:|\n")
+	for _, kind := range r.StatementKinds() {
+		fmt.Fprintf(&b, "| %s | %d |\n", kind, r.Statements[kind])
+	}
+
+	b.WriteString("\n## Features\n\n")
+	b.WriteString("| Feature | Procedures |\n")
+	b.WriteString("|---------|-----------:|\n")
+	for i, n := range r.FeatureCounts() {
+		fmt.Fprintf(&b, "| %s | %d |\n", transpiler.FeatureNames[i], n)
+	}
+
+	if len(r.Unsupported) > 0 {
+		b.WriteString("\n## Unsupported\n\n")
+		for _, issue := range r.Unsupported {
+			fmt.Fprintf(&b, "- %s `%s`: %s\n", issueLocation(issue), issue.Rule, issue.Message)
+		}
+	}
+
+	b.WriteString("\n## Procedures\n\n")
+	b.WriteString("| Procedure | Go | File | Statements | TODOs | Warnings |\n")
+	b.WriteString("|-----------|----|------|-----------:|------:|---------:|\n")
+	for _, p := range r.Procedures {
+		goName := "-"
+		if p.GoName != "" {
+			goName = "`" + p.GoName + "`"
+		}
+		fmt.Fprintf(&b, "| `%s` | %s | %s | %d | %d | %d |\n",
+			p.Features.Procedure, goName, p.File, p.Statements, p.TODOs, p.Warnings)
+	}
+	return b.String()
+}
+
+// migrationReportHTML renders a migration report as a standalone page,
+// styled like the --show-mappings report.
+func migrationReportHTML(r *transpiler.MigrationReport) string {
+	var b strings.Builder
+	statements := 0
+	for _, n := range r.Statements {
+		statements += n
+	}
+	fmt.Fprintf(&b, `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="UTF-8">
+<meta name="viewport" content="width=device-width, initial-scale=1.0">
+<title>tgpiler Migration Report</title>
+<style>
+%s
+h2 { margin: 2rem 0 1rem; }
+.section { background: var(--card); border-radius: 8px; overflow: hidden; box-shadow: 0 1px 3px var(--border); }
+.num { text-align: right; }
+code { font-family: monospace; font-size: 0.875rem; }
+</style>
+</head>
+<body>
+<h1>tgpiler Migration Report</h1>
+
+<div class="stats">
+<div class="stat-card"><div class="stat-value">%d</div><div class="stat-label">Files</div></div>
+<div class="stat-card"><div class="stat-value">%d</div><div class="stat-label">Procedures</div></div>
+<div class="stat-card"><div class="stat-value">%d</div><div class="stat-label">Statements</div></div>
+<div class="stat-card"><div class="stat-value" style="color:var(--yellow)">%d</div><div class="stat-label">TODOs</div></div>
+<div class="stat-card"><div class="stat-value" style="color:var(--yellow)">%d</div><div class="stat-label">Warnings</div></div>
+<div class="stat-card"><div class="stat-value" style="color:var(--red)">%d</div><div class="stat-label">Unsupported</div></div>
+</div>
+`, reportStyle, len(r.Files), len(r.Procedures), statements, r.TODOs, r.Warnings, len(r.Unsupported))
+
+	esc := html.EscapeString
+	// Effort against the greatest, as the confidence classes colour mappings
+	effortClass := func(effort, most int) string {
+		switch {
+		case effort*2 > most:
+			return "conf-low"
+		case effort*4 > most:
+			return "conf-med"
+		}
+		return "conf-high"
+	}
+	if hot := r.Hotspots(migrationHotspots); len(hot) > 0 {
+		b.WriteString(`<h2>Hotspots</h2>
+<div class="section"><table>
+<thead><tr><th>Procedure</th><th>File</th><th class="num">Effort</th><th class="num">TODOs</th><th class="num">Warnings</th><th>Features</th></tr></thead>
+<tbody>
+`)
+		for _, p := range hot {
+			fmt.Fprintf(&b, "<tr><td><code>%s</code></td><td>%s</td><td class=\"num %s\">%d</td><td class=\"num\">%d</td><td class=\"num\">%d</td><td>%s</td></tr>\n",
+				esc(p.Features.Procedure), esc(p.File), effortClass(p.Effort, hot[0].Effort), p.Effort, p.TODOs, p.Warnings, esc(strings.Join(usedFeatures(p), ", ")))
+		}
+		b.WriteString("</tbody></table></div>\n")
+	}
+
+	b.WriteString(`<h2>Statements</h2>
+<div class="section"><table>
+<thead><tr><th>Statement</th><th class="num">Count</th></tr></thead>
+<tbody>
+`)
+	for _, kind := range r.StatementKinds() {
+		fmt.Fprintf(&b, "<tr><td>%s</td><td class=\"num\">%d</td></tr>\n", esc(kind), r.Statements[kind])
+	}
+	b.WriteString("</tbody></table></div>\n")
+
+	b.WriteString(`<h2>Features</h2>
+<div class="section"><table>
+<thead><tr><th>Feature</th><th class="num">Procedures</th></tr></thead>
+<tbody>
+`)
+	for i, n := range r.FeatureCounts() {
+		fmt.Fprintf(&b, "<tr><td>%s</td><td class=\"num\">%d</td></tr>\n", esc(transpiler.FeatureNames[i]), n)
+	}
+	b.WriteString("</tbody></table></div>\n")
+
+	if len(r.Unsupported) > 0 {
+		b.WriteString(`<h2>Unsupported</h2>
+<div class="section"><table>
+<thead><tr><th>Location</th><th>Rule</th><th>Message</th></tr></thead>
+<tbody>
+`)
+		for _, issue := range r.Unsupported {
+			fmt.Fprintf(&b, "<tr><td><code>%s</code></td><td>%s</td><td>%s</td></tr>\n",
+				esc(issueLocation(issue)), esc(issue.Rule), esc(issue.Message))
+		}
+		b.WriteString("</tbody></table></div>\n")
+	}
+
+	b.WriteString(`<h2>Procedures</h2>
+<div class="section"><table>
+<thead><tr><th>Procedure</th><th>Go</th><th>File</th><th class="num">Statements</th><th class="num">TODOs</th><th class="num">Warnings</th></tr></thead>
+<tbody>
+`)
+	for _, p := range r.Procedures {
+		fmt.Fprintf(&b, "<tr><td><code>%s</code></td><td><code>%s</code></td><td>%s</td><td class=\"num\">%d</td><td class=\"num\">%d</td><td class=\"num\">%d</td></tr>\n",
+			esc(p.Features.Procedure), esc(p.GoName), esc(p.File), p.Statements, p.TODOs, p.Warnings)
+	}
+	b.WriteString("</tbody></table></div>\n</body>\n</html>\n")
+	return b.String()
+}
+
+// reportStyle is the CSS of the --show-mappings and --report pages: the
+// colours, light and dark, the stat cards and the tables.
+const reportStyle = `:root { --bg: #f8f9fa; --card: #fff; --text: #1a1a2e; --border: rgba(0,0,0,0.1); --hover: rgba(0,0,0,0.05); --green: #16a34a; --yellow: #ca8a04; --red: #dc2626; --blue: #2563eb; }
+@media (prefers-color-scheme: dark) {
+  :root { --bg: #1a1a2e; --card: #16213e; --text: #eee; --border: rgba(255,255,255,0.1); --hover: rgba(255,255,255,0.1); --green: #4ade80; --yellow: #fbbf24; --red: #f87171; --blue: #60a5fa; }
+}
+* { box-sizing: border-box; margin: 0; padding: 0; }
+body { font-family: system-ui, -apple-system, sans-serif; background: var(--bg); color: var(--text); padding: 2rem; }
+h1 { margin-bottom: 1.5rem; }
+.stats { display: grid; grid-template-columns: repeat(auto-fit, minmax(150px, 1fr)); gap: 1rem; margin-bottom: 2rem; }
+.stat-card { background: var(--card); padding: 1rem; border-radius: 8px; text-align: center; box-shadow: 0 1px 3px var(--border); }
+.stat-value { font-size: 2rem; font-weight: bold; }
+.stat-label { font-size: 0.875rem; opacity: 0.7; }
+table { width: 100%; border-collapse: collapse; }
+th, td { padding: 0.75rem 1rem; text-align: left; border-bottom: 1px solid var(--border); }
+th { background: var(--hover); font-weight: 600; }
+.conf-high { color: var(--green); }
+.conf-med { color: var(--yellow); }
+.conf-low { color: var(--red); }`
+
 func showMappingsHTML(cfg *config, mappings map[string]*storage.MethodMapping, stats storage.MappingStats, procedures []*storage.Procedure) error {
 	// Group by service first
 	serviceMethodMappings := make(map[string][]*storage.MethodMapping)
@@ -1099,17 +3935,7 @@ func showMappingsHTML(cfg *config, mappings map[string]*storage.MethodMapping, s
 <meta name="viewport" content="width=device-width, initial-scale=1.0">
 <title>tgpiler Mapping Report</title>
 <style>
-:root { --bg: #f8f9fa; --card: #fff; --text: #1a1a2e; --border: rgba(0,0,0,0.1); --hover: rgba(0,0,0,0.05); --green: #16a34a; --yellow: #ca8a04; --red: #dc2626; --blue: #2563eb; }
-@media (prefers-color-scheme: dark) {
-  :root { --bg: #1a1a2e; --card: #16213e; --text: #eee; --border: rgba(255,255,255,0.1); --hover: rgba(255,255,255,0.1); --green: #4ade80; --yellow: #fbbf24; --red: #f87171; --blue: #60a5fa; }
-}
-* { box-sizing: border-box; margin: 0; padding: 0; }
-body { font-family: system-ui, -apple-system, sans-serif; background: var(--bg); color: var(--text); padding: 2rem; }
-h1 { margin-bottom: 1.5rem; }
-.stats { display: grid; grid-template-columns: repeat(auto-fit, minmax(150px, 1fr)); gap: 1rem; margin-bottom: 2rem; }
-.stat-card { background: var(--card); padding: 1rem; border-radius: 8px; text-align: center; box-shadow: 0 1px 3px var(--border); }
-.stat-value { font-size: 2rem; font-weight: bold; }
-.stat-label { font-size: 0.875rem; opacity: 0.7; }
+%s
 .chart-container { background: var(--card); padding: 1rem; border-radius: 8px; margin-bottom: 2rem; display: flex; gap: 2rem; align-items: center; box-shadow: 0 1px 3px var(--border); }
 .pie-chart { width: 150px; height: 150px; border-radius: 50%%; position: relative; }
 .legend { display: flex; flex-direction: column; gap: 0.5rem; }
@@ -1118,12 +3944,6 @@ h1 { margin-bottom: 1.5rem; }
 .service { background: var(--card); border-radius: 8px; margin-bottom: 1rem; overflow: hidden; box-shadow: 0 1px 3px var(--border); }
 .service-header { padding: 1rem; background: var(--hover); cursor: pointer; }
 .service-header:hover { background: var(--border); }
-table { width: 100%%; border-collapse: collapse; }
-th, td { padding: 0.75rem 1rem; text-align: left; border-bottom: 1px solid var(--border); }
-th { background: var(--hover); font-weight: 600; }
-.conf-high { color: var(--green); }
-.conf-med { color: var(--yellow); }
-.conf-low { color: var(--red); }
 .filter-bar { margin-bottom: 1rem; display: flex; gap: 1rem; align-items: center; }
 input[type="text"] { padding: 0.5rem 1rem; border-radius: 4px; border: 1px solid var(--border); background: var(--card); color: var(--text); width: 300px; }
 .unmapped { background: var(--card); padding: 1rem; border-radius: 8px; margin-top: 2rem; box-shadow: 0 1px 3px var(--border); }
@@ -1158,6 +3978,7 @@ input[type="text"] { padding: 0.5rem 1rem; border-radius: 4px; border: 1px solid
 
 <h2 style="margin-bottom:1rem">Mappings by Service</h2>
 `,
+		reportStyle,
 		stats.TotalMethods, stats.MappedMethods, stats.UnmappedMethods,
 		stats.HighConfidence, stats.MediumConfidence, stats.LowConfidence,
 		float64(stats.HighConfidence)/float64(stats.MappedMethods)*100,
@@ -1244,6 +4065,13 @@ func generateImpl(cfg *config, proto *storage.ProtoParseResult, procedures []*st
 	opts.PackageName = cfg.packageName
 	opts.Dialect = cfg.sqlDialect
 
+	if cfg.outDir != "" {
+		return generateImplFiles(cfg, gen, opts)
+	}
+	if cfg.implPkgDirs {
+		return fmt.Errorf("--impl-package-dirs requires --outdir")
+	}
+
 	var buf bytes.Buffer
 	if cfg.serviceName != "" {
 		// Single service - use original method
@@ -1265,6 +4093,37 @@ func generateImpl(cfg *config, proto *storage.ProtoParseResult, procedures []*st
 	return writeOutput(cfg, "", buf.String())
 }
 
+// generateImplFiles writes a file per service (or just --service) into the
+// output directory, in package subdirectories with --impl-package-dirs.
+func generateImplFiles(cfg *config, gen *protogen.ImplementationGenerator, opts protogen.ServerGenOptions) error {
+	files, err := gen.GenerateServiceImplFiles(opts, cfg.implPkgDirs)
+	if err != nil {
+		return err
+	}
+	written := 0
+	for _, f := range files {
+		if cfg.serviceName != "" && f.Service != cfg.serviceName {
+			continue
+		}
+		path := filepath.Join(cfg.outDir, f.Path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("creating directory for %s: %w", path, err)
+		}
+		if err := writeGeneratedFile(cfg, path, f.Content); err != nil {
+			return err
+		}
+		written++
+	}
+	if written == 0 {
+		return fmt.Errorf("service not found: %s", cfg.serviceName)
+	}
+
+	stats := gen.GetStats()
+	fmt.Fprintf(cfg.stderr, "Generated implementations: %d methods mapped, %d unmapped\n",
+		stats.MappedMethods, stats.UnmappedMethods)
+	return nil
+}
+
 // generateMock generates mock server code
 func generateMock(cfg *config, proto *storage.ProtoParseResult) error {
 	var buf bytes.Buffer
@@ -1283,6 +4142,23 @@ func generateMock(cfg *config, proto *storage.ProtoParseResult) error {
 	buf.WriteString("\treturn protogen.NewMockServer(proto)\n")
 	buf.WriteString("}\n\n")
 
+	// Generate a typed On helper per method, so expectations don't depend
+	// on spelling method names right
+	svcNames := make([]string, 0, len(proto.AllServices))
+	for svcName := range proto.AllServices {
+		svcNames = append(svcNames, svcName)
+	}
+	sort.Strings(svcNames)
+	for _, svcName := range svcNames {
+		for _, method := range proto.AllServices[svcName].Methods {
+			fn := "On" + svcName + method.Name
+			buf.WriteString(fmt.Sprintf("// %s scripts calls of %s.%s.\n", fn, svcName, method.Name))
+			buf.WriteString(fmt.Sprintf("func %s(s *protogen.MockServer) *protogen.Expectation {\n", fn))
+			buf.WriteString(fmt.Sprintf("\treturn s.On(%q)\n", svcName+"."+method.Name))
+			buf.WriteString("}\n\n")
+		}
+	}
+
 	// List services and methods
 	buf.WriteString("/*\nAvailable services and methods:\n\n")
 	for svcName, svc := range proto.AllServices {
@@ -1310,11 +4186,14 @@ Usage:
   tgpiler --gen-server --proto <file> [options]
   tgpiler --gen-server --proto-dir <path> [options]
   tgpiler --gen-impl --proto-dir <path> --sql-dir <path> [options]
+  tgpiler --lint <dir> [--proto-dir <path>] [--sql-dir <path>]
 
 Input (mutually exclusive):
   <file.sql>            Read single file
   -s, --stdin           Read from stdin
-  -d, --dir <path>      Read all .sql files from directory
+  -d, --dir <path>      Read all .sql files from directory, or the procedures
+                        and functions of a .dacpac (its tables and types are
+                        the schema unless --schema is given)
 
 Output (mutually exclusive):
   (no flag)             Write to stdout
@@ -1328,7 +4207,16 @@ General Options:
   --store <var>         Store variable name (default: r.db)
   --receiver <var>      Receiver variable name (default: r, empty for standalone functions)
   --receiver-type <t>   Receiver type (default: *Repository)
+  --style <s>           Generation style (default: methods)
+                          methods   - func (r *Repository) Proc(ctx, ...)
+                          functions - func Proc(ctx, db, ...), store passed explicitly
+  --go-version <v>      Target Go version, e.g. 1.22 (default: conservative baseline)
+                          1.21+ - min/max builtins for GREATEST/LEAST
+                          1.22+ - sql.Null[T] scan intermediaries
   --preserve-go         Don't strip GO batch separators (default: strip them)
+  --script              Transpile statements outside procedures (job scripts)
+                        into one function named after the file:
+                        nightly_cleanup.sql becomes NightlyCleanup
   --sequence-mode <m>   Sequence handling: db, uuid, stub (default: db)
   --annotate[=level]    Add code annotations (default level if no value: standard)
                         Levels: none, minimal, standard, verbose
@@ -1336,30 +4224,293 @@ General Options:
                           standard - TODOs + original SQL comments
                           verbose  - All + type annotations + section markers
   -f, --force           Allow overwriting existing files
+  --config <file>       Flag defaults, one "flag: value" per line; flags on
+                        the command line take precedence (default: tgpiler.yaml,
+                        if present)
+  --apply-suggestions   Merge the suggested fixes printed as "suggestion:"
+                        into the --config file
   -h, --help            Show help
   -v, --version         Show version
 
 Backend Options (requires --dml):
-  --backend <type>      Backend: sql, grpc, mock, inline (default: sql)
+  --backend <type>      Backend: sql, grpc, mock, inline, mongo, redis,
+                        procedure-call (default: sql). procedure-call
+                        generates typed wrappers that run the original
+                        procedures on SQL Server instead of porting them
+  --rows <mode>         Result sets of procedure-call wrappers: slice, callback
+                        (a function called with each row) or iter (an
+                        iter.Seq2, needs --go-version=1.23) (default: slice)
   --fallback-backend <type>  Backend for temp tables: sql, mock (default: sql)
+  --table-backend <map> Per-table backends, overriding --backend and
+                        --fallback-backend (format: Orders:grpc,AuditLog:sql,#tmp:mock)
   --grpc-client <var>   gRPC client variable name (default: client)
-  --grpc-package <path> Import path for generated gRPC package
+  --grpc-package <path> Proto package for gRPC messages: a name (orderpb) or an
+                        import path, whose last element names the package
+  --enum-overrides <file>  With --proto or --proto-dir, literals for request
+                        fields of enum types become the enum's constants
+                        (orderpb.OrderStatus_ORDER_STATUS_SHIPPED for
+                        'Shipped'). The file maps other literals, in blocks
+                        per enum ("OrderStatus:" then indented
+                        "'Approved': ORDER_STATUS_CONFIRMED")
   --mock-store <var>    Mock store variable name (default: store)
+  --table-collection <map>  Table-to-collection mappings for --backend=mongo
+                        (format: Table:coll,Table:coll; default: lowerCamel table name)
+  --mongo-db <var>      *mongo.Database variable for tables routed to mongo
+                        with --table-backend (default: --store)
+  --redis-client <var>  go-redis client variable for --backend=redis (default: r.redis)
+  --redis-key <map>     Key columns for --backend=redis (format: Table:Column,Table:Column;
+                        default: ID, <Table>ID or <Singular>ID)
+  --table-event <map>   Publish INSERTs into outbox/queue tables as JSON events
+                        instead of writing them (format: EventQueue:order-events)
+  --event-key <map>     Message key column per event table (format: Table:Column)
+  --event-publisher <var>  tsqlruntime.EventPublisher variable (default: r.events)
+  --notifier <var>      tsqlruntime.Notifier variable that sp_send_dbmail and
+                        xp_sendmail calls go to (default: r.notifier)
+
+Query Translation Options (requires --dml):
+  --schema <path>       CREATE TABLE script, directory of them, or .dacpac. Computed,
+                        identity and rowversion columns are dropped from
+                        INSERT column lists and UPDATE SET clauses. Table
+                        types (CREATE TYPE ... AS TABLE) are used for
+                        table-valued parameters
+  --types-file <file>   CREATE TYPE ... AS TABLE script. Its structs and
+                        TVP helpers are written once to table_types.go (in
+                        -O, beside -o, or after the code on stdout) and
+                        procedures using the types refer to them. Runs
+                        without an input to generate just the types
+  --constants <file>    Constants file naming status strings and codes, in
+                        blocks per entity ("OrderStatus:" then indented
+                        "Approved: 'Approved'"). They are written to
+                        constants.go and literals in Go code with their
+                        values refer to them
+  --naming-config <file> Naming config: "words:" splitting ALL-CAPS and
+                        lowercase identifiers (PEDIDOCLIENTE), "acronyms:"
+                        written in capitals (ClienteID), and "overrides:"
+                        giving Go names ("tbl_Cli: Customer")
+  --verbs-file <file>   Verbs of inferred gRPC method names: "add:" then
+                        "Liquidate: liquidated, liquidation" (the forms
+                        found in column and variable names), "remove:"
+                        then "Sign". --show-mappings uses them too
+  --udf-mode <m>        Scalar UDF calls inside queries (default: keep)
+                          keep    - leave the call in SQL and warn
+                          compute - evaluate in Go, bind the result as a parameter
+  --udf-override <map>  Per-function UDF modes (format: fn_Name:compute,fn_Other:keep)
+                        Only functions declared in the input or named here
+                        are treated as UDFs
+  --allow-any-scan      Scan columns of unknown type into interface{} (default: string)
+  --null-mode <m>       Go types for nullable parameters (NULL default, or
+                        tested with IS NULL/ISNULL/COALESCE) and result
+                        columns (default: zero):
+                          zero    - plain types, NULL reads as the zero value
+                          sqlnull - sql.NullString, sql.NullInt64, ...
+                          pointer - *string, *int64, ... (nil for NULL)
+  --decimal-mode <m>    Go type for DECIMAL, NUMERIC and MONEY (default: shopspring):
+                          shopspring - shopspring/decimal decimal.Decimal
+                          string     - strings, arithmetic via tsqlruntime
+                          float      - float64 (may lose precision, warns)
+                          apd        - cockroachdb/apd/v3 apd.Decimal
+  --time-mode <m>       Clock GETDATE(), SYSDATETIME() and CURRENT_TIMESTAMP
+                        read, in Go code and queries (default: local):
+                          local - the program's local time, time.Now()
+                          utc   - UTC, time.Now().UTC(), for UTC servers
+  --nolock-strategy <s> What becomes of WITH (NOLOCK) and READUNCOMMITTED hints,
+                        which no target keeps (default: comment):
+                          comment             - removed, with a comment and a warning
+                          read-uncommitted-tx - SELECTs run in a READ UNCOMMITTED
+                                                transaction (sqlserver, mysql)
+                          ignore              - removed silently
+  --trycatch-mode <m>   What TRY/CATCH becomes (default: iife):
+                          iife   - a closure returning the TRY block's error
+                          errors - the blocks inline, errors jumping to the
+                                   CATCH with goto, so RETURN, BREAK and
+                                   CONTINUE in TRY work as written
+  --print-mode <m>      What PRINT becomes (default: fmt):
+                          fmt     - fmt.Println, or the SPLogger with --splogger
+                          slog    - slog.InfoContext(ctx, msg)
+                          discard - nothing
+  --spatial-mode <m>    GEOMETRY and GEOGRAPHY values, which are Go strings
+                        (default: wkt):
+                          wkt     - WKT, "POINT(-122.3 47.6)"
+                          postgis - PostGIS EWKT, "SRID=4326;POINT(-122.3 47.6)",
+                                    with methods in queries as ST_ functions
+                                    (postgres)
 
 gRPC Mapping Options (requires --dml --backend=grpc):
   --table-service <map> Table-to-service mappings (format: Table:Service,Table:Service)
   --table-client <map>  Table-to-client var mappings (format: Table:clientVar,Table:clientVar)
   --grpc-mappings <map> Procedure-to-method mappings (format: proc:Service.Method,proc:Service.Method)
 
+Cross-Package References (requires --dml):
+  --module-path <path>  Import path of the output root. Packages the code
+                        refers to are imported from under it (billing ->
+                        <path>/billing) unless --package-path says otherwise
+  --package-path <map>  Import paths by package name, for proto packages and
+                        packages outside the module (format:
+                        orderpb:github.com/acme/protos/order/v1,pkg:path)
+  --schema-package <map>  Package each SQL schema's procedures are generated
+                        into (format: Billing:billing). EXEC Billing.usp_X
+                        from another package calls billing.X
+
+Phased Migration (requires --dml, SQL backend):
+  --passthrough <list>  Procedures not migrated yet (format: usp_A,usp_B).
+                        EXEC of one calls a generated stub, with the name
+                        and signature of the transpiled procedure, that runs
+                        it in the database with tsqlruntime.CallProcedure
+
+SQL Agent Jobs (requires --dml):
+  --jobs                Input is SQL Server Agent jobs: the script SSMS
+                        generates with Script Job as CREATE, or JSON with
+                        msdb's column names. T-SQL steps are transpiled as
+                        scripts; each job gets a function returning a
+                        tsqlruntime.Job with its step sequencing, retries
+                        and schedules as cron expressions
+
 Proto/gRPC Generation (mutually exclusive with transpilation):
-  --proto <file>        Proto file for gRPC operations
+  --proto <file>        Proto file for gRPC operations (with --dml, its enums
+                        are used for gRPC request fields)
   --proto-dir <path>    Directory of proto files
   --sql-dir <path>      Directory of SQL procedure files (for mapping)
   --service <name>      Target service name (defaults to all)
   --gen-server          Generate gRPC server stubs from proto
-  --gen-impl            Generate repository implementations with procedure mappings
+  --gen-impl            Generate repository implementations with procedure mappings.
+                        With -O, one file per service (order_service.go)
+  --impl-package-dirs   With --gen-impl -O, put each service in a package
+                        of its own (order/order_service.go, package order)
   --gen-mock            Generate mock server code
   --show-mappings       Display procedure-to-method mappings
+  --diff <file>         With --show-mappings, list the mappings added,
+                        removed, moved to another procedure or down 5
+                        points in confidence since a --output-format json
+                        run, failing on all but additions
+  --mapping-weights <w> Weights of the mapping strategies, as
+                        naming=2,types=0.5 (default: 1 each; 0 leaves
+                        one out): naming, dml_table, params, verb_entity,
+                        types
+
+Contract Extraction (implies --dml):
+  --gen-contracts       Emit each procedure's contract instead of Go code:
+                        parameters, return code, result set columns with
+                        Go types, tables read and written
+  --contracts-format <f> Contract format: json, yaml (default: json)
+
+Service Decomposition:
+  --cluster-report      Group procedures into suggested services by the tables
+                        they share and the procedures they call. Each table
+                        goes to the service using it most, giving a
+                        --table-service mapping (also printed as suggestions,
+                        so --apply-suggestions writes it to the config file)
+  --cluster-threshold <n> Lowest similarity, 0-1, at which procedures are
+                        grouped (default: 0.25; higher gives more services)
+  --output-format <f>   Report format: text, json, html (default: text)
+
+Migration Planning:
+  --feature-matrix      List each procedure with the features that shape its
+                        migration: cursors, temp tables, transactions,
+                        dynamic SQL, XML, linked servers, TRY/CATCH and the
+                        number of result sets. Only parses, so procedures
+                        that don't transpile yet are included
+  --analyze             Score each procedure's complexity from its statements,
+                        nesting depth, cursors, dynamic SQL, temp tables and
+                        calls, and list them in a suggested migration order:
+                        callees before their callers, otherwise the simplest
+                        first. Only parses; no Go code is generated
+  --dry-run             Transpile without writing code and report, for each
+                        file, the share of statements handled, left with a
+                        TODO or warning, skipped or failed, and where they
+                        failed. A failure doesn't stop the run. Requires --dml
+  --output-format <f>   Format: text, csv, json (default: text; csv is for
+                        --feature-matrix only)
+
+Security:
+  --security-report     After transpiling, report every variable concatenated
+                        into SQL run by EXEC() or sp_executesql, traced
+                        through local assignments (written to stderr)
+  --side-effects-report After transpiling, list the mail and events handed to
+                        application interfaces, with any parameters dropped
+                        (written to stderr)
+  --performance-report  After transpiling, list the procedures and queries
+                        that had WITH RECOMPILE, OPTION (RECOMPILE), OPTIMIZE
+                        FOR or other plan hints, which aren't carried over
+                        (written to stderr)
+  --report <file>       After transpiling, write a migration report: the
+                        procedures, statements by type, features used, TODOs,
+                        unsupported constructs and the procedures likely to
+                        need the most work. HTML if <file> ends in .html,
+                        else Markdown. Requires --dml
+
+Large Inputs:
+  --stream              Read each input a GO batch at a time, writing each
+                        batch's functions before reading the next, so memory
+                        stays bounded on scripts of tens of thousands of
+                        lines. Requires --dml; not with --script, --jobs,
+                        contracts, scaffolding or the reports that read the
+                        whole file
+
+Watch:
+  --watch               With -d and -O, transpile the directory, then again
+                        each file saved, printing a diff of its regenerated
+                        Go code. Output files are overwritten; a file that
+                        fails is reported and watching goes on until Ctrl-C
+
+Manifest:
+  --manifest <file>     After the run, write a JSON manifest of the sources
+                        read and the files written, with their SHA-256
+                        hashes and procedures, a hash of the flags that
+                        shape the output and the warning and suggestion counts
+
+Diagnostics:
+  --diagnostics <fmt>   Format of warnings and suggestions: text (default,
+                        "warning:" and "suggestion:" lines on stderr), json
+                        or sarif, with the file, line, rule and severity of
+                        each, for code scanning and editors
+  --diagnostics-file <file>
+                        Write --diagnostics=json or sarif to this file
+                        instead of stderr
+  --werror              Exit with status 2 if there are any warnings
+  --max-warnings <n>    Exit with status 2 if there are more than n warnings
+  --fail-on <rules>     Exit with status 2 on any warning of these rules
+                        (format: complex-field,ddl-skipped); the rules are
+                        those of --diagnostics. Notes never fail a run
+
+Identifiers:
+  --transliterate       Rewrite accented letters in generated Go identifiers
+                        to ASCII (Dirección -> Direccion). SQL text and
+                        struct tags keep the original names
+
+Lint:
+  --lint <dir>          Check generated Go code for drift that per-file
+                        transpilation can't see: query placeholder counts,
+                        TODOs in files marked "tgpiler:reviewed", and
+                        receiver/store consistency across the directory.
+                        With --proto/--proto-dir, gRPC methods called must
+                        exist; with --sql-dir, every procedure must have an
+                        up-to-date generated function
+
+Repository Scaffolding (requires --dml, methods style only):
+  --gen-repo            Also generate the Repository struct with a field per
+                        dependency the methods use (r.db, r.redis, ...), a
+                        NewRepository constructor and a RepositoryAPI
+                        interface of every method. Written to repository.go
+                        beside -o or in -O, else after the code on stdout
+  --gen-interface       Also generate RepositoryAPI, an interface of every
+                        method, as interface.go (with --gen-repo it moves
+                        there from repository.go)
+  --mock <kind>         Add a mock of the interface to interface.go:
+                          gomock - //go:generate stanza for mockgen
+                          moq    - //go:generate stanza for moq
+                          func   - RepositoryMock with a func field per method
+
+REST Generation (implies --dml, methods style only):
+  --gen-rest            Generate net/http JSON handlers that call the
+                        repository method of every procedure in the input
+  --openapi <file>      Also write an OpenAPI 3 spec (default with -O:
+                        <outdir>/openapi.json)
+  --rest-base-path <p>  Path prefix for every endpoint (e.g. /api)
+  --router <r>          Router the handlers register with: mux (net/http
+                        ServeMux) or chi (github.com/go-chi/chi/v5) (default: mux)
+  --gen-http-handlers   Same as --gen-rest
+                        With --backend=procedure-call the handlers call the
+                        wrappers and return the procedures' result sets too
 
 SPLogger Options (requires --dml):
   --splogger            Enable SPLogger for CATCH block error logging
@@ -1370,6 +4521,47 @@ SPLogger Options (requires --dml):
   --logger-format <f>   Format for file logger: json, text (default: json)
   --logger-init         Generate SPLogger initialization code
 
+Timeouts (requires --dml):
+  --timeout <d>         Deadline for generated procedures, as a Go duration
+                        (e.g. 30s, 500ms). WHILE and cursor loops also check
+                        ctx.Err() on every iteration
+  --timeout-scope <s>   What the deadline bounds (default: procedure):
+                          procedure - the whole call
+                          statement - each statement that reaches the
+                                      database
+
+Transaction Retry (requires --dml):
+  --retry <n>           Retry each BEGIN TRANSACTION ... COMMIT up to n
+                        attempts when it fails with a transient error of
+                        --dialect (deadlock, lock timeout, serialization
+                        failure), using tsqlruntime.Retry
+  --retry-backoff <d>   Delay before the first retry, doubled for each one
+                        after (default: 100ms)
+  --retry-on <codes>    Extra retryable error numbers or SQLSTATEs,
+                        comma-separated (e.g. 1222,40613)
+
+OpenTelemetry (requires --dml):
+  --otel                Wrap each procedure in a span named after it, and
+                        its SQL and gRPC calls in child spans with
+                        db.statement and rpc.method; failures set an error
+                        status. Spans go through a tsqlruntime.Tracer, so
+                        the output needs no OpenTelemetry dependency
+                        (tsqlruntime/traceotel adapts a trace.Tracer)
+  --tracer <var>        tsqlruntime.Tracer variable (default: r.tracer);
+                        a nil Tracer traces nothing
+
+Execution Statistics (requires --dml):
+  --exec-stats          Record each call's count, elapsed and worker time in
+                        tsqlruntime.ProcStats, with the fields of
+                        sys.dm_exec_procedure_stats (served as JSON over
+                        HTTP or expvar)
+  --metrics             Record each call's outcome and latency through a
+                        tsqlruntime.Metrics, labelled with the procedure
+                        name (tsqlruntime/metricsprom exports them as
+                        Prometheus counters and histograms)
+  --metrics-recorder <var> tsqlruntime.Metrics variable (default: r.metrics);
+                        a nil Metrics records nothing
+
 Examples:
   # Basic transpilation
   tgpiler input.sql                       # file to stdout
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ha1tch/tgpiler/transpiler"
+)
+
+func TestLineEdits(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"same", "a b c", "a b c", " a  b  c"},
+		{"added", "a c", "a b c", " a +b  c"},
+		{"removed", "a b c", "a c", " a -b  c"},
+		{"replaced", "a b c", "a x c", " a -b +x  c"},
+		{"from nothing", "", "a b", "+a +b"},
+		{"to nothing", "a b", "", "-a -b"},
+		// Not a prefix or suffix: the common subsequence is kept
+		{"reordered", "x a b c y", "z a c b w", "-x +z  a -b  c -y +b +w"},
+	}
+	for _, tt := range tests {
+		var edits []string
+		for _, e := range lineEdits(strings.Fields(tt.a), strings.Fields(tt.b)) {
+			edits = append(edits, string(e.op)+e.line)
+		}
+		if got := strings.Join(edits, " "); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	var lines []string
+	for i := 1; i <= 20; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+	before := strings.Join(lines, "\n") + "\n"
+	lines[2] = "changed 3"
+	lines[5] = "changed 6"
+	lines = append(lines[:15], lines[16:]...)
+	after := strings.Join(lines, "\n") + "\n"
+
+	// The changes to lines 3 and 6 share their context; line 16 has its own hunk
+	want := `--- out.go
++++ out.go
+@@ -1,8 +1,8 @@
+ line 1
+ line 2
+-line 3
++changed 3
+ line 4
+ line 5
+-line 6
++changed 6
+ line 7
+ line 8
+@@ -14,5 +14,4 @@
+ line 14
+ line 15
+-line 16
+ line 17
+ line 18
+`
+	if got := unifiedDiff("out.go", before, after); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	// A new file is all additions from line 0
+	if got := unifiedDiff("new.go", "", "a\nb\n"); got != "--- new.go\n+++ new.go\n@@ -0,0 +1,2 @@\n+a\n+b\n" {
+		t.Errorf("unexpected diff of a new file:\n%s", got)
+	}
+
+	// Long diffs are cut short
+	got := unifiedDiff("long.go", "", strings.Repeat("x\n", 2*watchDiffLines))
+	if n := strings.Count(got, "\n+x"); n != watchDiffLines-1 || !strings.HasSuffix(got, fmt.Sprintf("... %d more lines\n", watchDiffLines+1)) {
+		t.Errorf("expected %d lines then a count of the rest, got:\n%s", watchDiffLines, got)
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	lines := strings.Split(`# tgpiler.yaml
+backend: grpc
+table-service:
+  - Orders:OrderService
+
+  # Products too
+  - "Products:CatalogService"
+package: 'o''brien'
+`, "\n")
+	entries, err := parseConfig("tgpiler.yaml", lines)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, fmt.Sprintf("%s=%s@%d-%d", e.name, e.value, e.start, e.end))
+	}
+	want := "backend=grpc@1-2 table-service=Orders:OrderService,Products:CatalogService@2-7 package=o'brien@7-8"
+	if strings.Join(got, " ") != want {
+		t.Errorf("got %q, want %q", strings.Join(got, " "), want)
+	}
+
+	for _, bad := range []string{
+		"- Orders:OrderService\n",
+		"table-service: Orders:OrderService\n  - Products:CatalogService\n",
+		"backend grpc\n",
+	} {
+		if _, err := parseConfig("tgpiler.yaml", strings.Split(bad, "\n")); err == nil || !strings.HasPrefix(err.Error(), "tgpiler.yaml:") {
+			t.Errorf("%q: expected an error with the file and line, got %v", bad, err)
+		}
+	}
+}
+
+func TestApplySuggestionsToList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tgpiler.yaml")
+	config := "backend: grpc\ntable-service:\n  - Orders:OrderService\n  - Products:CatalogService\n# end\n"
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	diags := []transpiler.Diagnostic{{Suggestion: transpiler.Suggestion{Flag: "table-service", Key: "Products", Value: "ProductService"}}}
+	if n, err := applySuggestions(path, diags); err != nil || n != 1 {
+		t.Fatalf("got %d, %v", n, err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "backend: grpc\ntable-service: \"Orders:OrderService,Products:ProductService\"\n# end\n"
+	if string(data) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", data, want)
+	}
+}
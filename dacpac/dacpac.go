@@ -0,0 +1,352 @@
+// Package dacpac reads the schema objects of a SQL Server data-tier
+// application package (.dacpac), as built by SSDT projects and
+// SqlPackage, back into T-SQL scripts.
+//
+// A dacpac is a zip archive whose model.xml describes every object.
+// Procedures and functions keep their source there: the header up to AS
+// in a SysCommentsObjectAnnotation and the rest in a BodyScript property.
+// Tables and table types are rebuilt from their columns, with the parts
+// that matter to tgpiler: types, nullability, identity and computed
+// columns.
+package dacpac
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Object types, as model.xml names them.
+const (
+	Procedure                   = "SqlProcedure"
+	ScalarFunction              = "SqlScalarFunction"
+	InlineTableValuedFunction   = "SqlInlineTableValuedFunction"
+	MultiStatementTableFunction = "SqlMultiStatementTableValuedFunction"
+	Table                       = "SqlTable"
+	TableType                   = "SqlTableType"
+)
+
+// Object is a schema object with the script that creates it.
+type Object struct {
+	Type   string // One of the object types above
+	Schema string
+	Name   string
+	Script string
+}
+
+// FileName returns the name of a file for the object's script,
+// schema.name.sql.
+func (o Object) FileName() string {
+	name := o.Name
+	if o.Schema != "" {
+		name = o.Schema + "." + name
+	}
+	return strings.NewReplacer("/", "_", "\\", "_").Replace(name) + ".sql"
+}
+
+// IsRoutine reports whether the object is a procedure or function.
+func (o Object) IsRoutine() bool {
+	switch o.Type {
+	case Procedure, ScalarFunction, InlineTableValuedFunction, MultiStatementTableFunction:
+		return true
+	}
+	return false
+}
+
+// Model is the objects of a dacpac, in the order model.xml lists them.
+type Model struct {
+	Objects []Object
+	Skipped []string // Routines whose script couldn't be rebuilt
+}
+
+// Read reads the dacpac at path.
+func Read(path string) (*Model, error) {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return readZip(&r.Reader)
+}
+
+// ReadFrom reads a dacpac of the given size from r.
+func ReadFrom(r io.ReaderAt, size int64) (*Model, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return readZip(zr)
+}
+
+func readZip(zr *zip.Reader) (*Model, error) {
+	for _, f := range zr.File {
+		if !strings.EqualFold(f.Name, "model.xml") {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		data, err := io.ReadAll(rc)
+		if err != nil {
+			return nil, err
+		}
+		return ParseModel(data)
+	}
+	return nil, fmt.Errorf("no model.xml in package")
+}
+
+// model.xml, as far as it is read here
+type xmlModel struct {
+	Elements []xmlElement `xml:"Model>Element"`
+}
+
+type xmlElement struct {
+	Type          string            `xml:"Type,attr"`
+	Name          string            `xml:"Name,attr"`
+	Properties    []xmlProperty     `xml:"Property"`
+	Relationships []xmlRelationship `xml:"Relationship"`
+	Annotations   []xmlAnnotation   `xml:"Annotation"`
+}
+
+type xmlProperty struct {
+	Name  string `xml:"Name,attr"`
+	Value string `xml:"Value,attr"`
+	Text  string `xml:"Value"` // Scripts are in a Value element, as CDATA
+}
+
+type xmlRelationship struct {
+	Name    string     `xml:"Name,attr"`
+	Entries []xmlEntry `xml:"Entry"`
+}
+
+type xmlEntry struct {
+	Elements   []xmlElement   `xml:"Element"`
+	References []xmlReference `xml:"References"`
+}
+
+type xmlReference struct {
+	Name           string `xml:"Name,attr"`
+	ExternalSource string `xml:"ExternalSource,attr"`
+}
+
+type xmlAnnotation struct {
+	Type       string        `xml:"Type,attr"`
+	Properties []xmlProperty `xml:"Property"`
+}
+
+func (e *xmlElement) property(name string) (string, bool) {
+	for _, p := range e.Properties {
+		if p.Name == name {
+			if p.Text != "" {
+				return p.Text, true
+			}
+			return p.Value, true
+		}
+	}
+	return "", false
+}
+
+func (e *xmlElement) flag(name string) bool {
+	v, _ := e.property(name)
+	return strings.EqualFold(v, "True")
+}
+
+func (e *xmlElement) relationship(name string) []xmlEntry {
+	for _, r := range e.Relationships {
+		if r.Name == name {
+			return r.Entries
+		}
+	}
+	return nil
+}
+
+// ParseModel reads the objects in the contents of model.xml.
+func ParseModel(data []byte) (*Model, error) {
+	var doc xmlModel
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("model.xml: %w", err)
+	}
+	m := &Model{}
+	for i := range doc.Elements {
+		e := &doc.Elements[i]
+		parts := splitName(e.Name)
+		if len(parts) != 2 {
+			continue
+		}
+		obj := Object{Type: e.Type, Schema: parts[0], Name: parts[1]}
+		switch e.Type {
+		case Procedure, ScalarFunction, InlineTableValuedFunction, MultiStatementTableFunction:
+			obj.Script = routineScript(e)
+			if obj.Script == "" {
+				m.Skipped = append(m.Skipped, e.Name)
+				continue
+			}
+		case Table:
+			obj.Script = tableScript("CREATE TABLE "+e.Name+" (", e)
+		case TableType:
+			obj.Script = tableScript("CREATE TYPE "+e.Name+" AS TABLE (", e)
+		default:
+			continue
+		}
+		m.Objects = append(m.Objects, obj)
+	}
+	return m, nil
+}
+
+// routineScript returns the CREATE statement of a procedure or function:
+// its header and body when the header was kept, else, for procedures, a
+// header rebuilt from the parameters.
+func routineScript(e *xmlElement) string {
+	body, ok := e.property("BodyScript")
+	if !ok {
+		return ""
+	}
+	for _, a := range e.Annotations {
+		if a.Type != "SysCommentsObjectAnnotation" {
+			continue
+		}
+		for _, p := range a.Properties {
+			if p.Name == "HeaderContents" {
+				return normalizeNewlines(p.Value + "\n" + body)
+			}
+		}
+	}
+	if e.Type != Procedure {
+		return ""
+	}
+
+	var params []string
+	for _, entry := range e.relationship("Parameters") {
+		for i := range entry.Elements {
+			p := &entry.Elements[i]
+			parts := splitName(p.Name)
+			param := parts[len(parts)-1] + " " + typeName(p.relationship("Type"))
+			if def, ok := p.property("DefaultExpressionScript"); ok {
+				param += " = " + def
+			}
+			if p.flag("IsOutput") {
+				param += " OUTPUT"
+			}
+			if p.flag("IsReadOnly") {
+				param += " READONLY"
+			}
+			params = append(params, param)
+		}
+	}
+	header := "CREATE PROCEDURE " + e.Name
+	if len(params) > 0 {
+		header += "\n    " + strings.Join(params, ",\n    ")
+	}
+	return normalizeNewlines(header + "\nAS\n" + body)
+}
+
+// tableScript returns a CREATE TABLE or CREATE TYPE ... AS TABLE
+// statement for a table's columns.
+func tableScript(head string, e *xmlElement) string {
+	var cols []string
+	for _, entry := range e.relationship("Columns") {
+		for i := range entry.Elements {
+			c := &entry.Elements[i]
+			parts := splitName(c.Name)
+			col := quoteName(parts[len(parts)-1])
+			if expr, ok := c.property("ExpressionScript"); ok {
+				cols = append(cols, col+" AS "+expr)
+				continue
+			}
+			col += " " + typeName(c.relationship("TypeSpecifier"))
+			if c.flag("IsIdentity") {
+				col += " IDENTITY"
+			}
+			if v, ok := c.property("IsNullable"); ok && strings.EqualFold(v, "False") {
+				col += " NOT NULL"
+			}
+			cols = append(cols, col)
+		}
+	}
+	return head + "\n    " + strings.Join(cols, ",\n    ") + "\n)"
+}
+
+// typeName returns the T-SQL type of a SqlTypeSpecifier relationship.
+func typeName(entries []xmlEntry) string {
+	for _, entry := range entries {
+		for i := range entry.Elements {
+			spec := &entry.Elements[i]
+			var name string
+			for _, te := range spec.relationship("Type") {
+				for _, ref := range te.References {
+					name = ref.Name
+					if ref.ExternalSource == "BuiltIns" {
+						name = strings.ToUpper(strings.Trim(name, "[]"))
+					}
+				}
+			}
+			length, hasLength := spec.property("Length")
+			precision, hasPrecision := spec.property("Precision")
+			scale, hasScale := spec.property("Scale")
+			switch {
+			case spec.flag("IsMax"):
+				name += "(MAX)"
+			case hasLength:
+				name += "(" + length + ")"
+			case hasPrecision && hasScale:
+				name += "(" + precision + ", " + scale + ")"
+			case hasPrecision:
+				name += "(" + precision + ")"
+			case hasScale:
+				name += "(" + scale + ")"
+			}
+			return name
+		}
+	}
+	return "SQL_VARIANT"
+}
+
+// splitName splits a model name such as [dbo].[Orders].[OrderID] into its
+// parts, without brackets.
+func splitName(name string) []string {
+	var parts []string
+	for len(name) > 0 {
+		if name[0] == '.' {
+			name = name[1:]
+			continue
+		}
+		if name[0] != '[' {
+			end := strings.IndexByte(name, '.')
+			if end < 0 {
+				end = len(name)
+			}
+			parts = append(parts, name[:end])
+			name = name[end:]
+			continue
+		}
+		var part strings.Builder
+		i := 1
+		for i < len(name) {
+			if name[i] == ']' {
+				if i+1 < len(name) && name[i+1] == ']' {
+					part.WriteByte(']')
+					i += 2
+					continue
+				}
+				break
+			}
+			part.WriteByte(name[i])
+			i++
+		}
+		parts = append(parts, part.String())
+		name = name[min(i+1, len(name)):]
+	}
+	return parts
+}
+
+func quoteName(name string) string {
+	return "[" + strings.ReplaceAll(name, "]", "]]") + "]"
+}
+
+func normalizeNewlines(s string) string {
+	return strings.ReplaceAll(s, "\r\n", "\n")
+}
@@ -0,0 +1,195 @@
+package dacpac
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// modelXML is trimmed from the model.xml of an SSDT build.
+const modelXML = `<?xml version="1.0" encoding="utf-8"?>
+<DataSchemaModel FileFormatVersion="1.2" SchemaVersion="2.9" DspName="Microsoft.Data.Tools.Schema.Sql.Sql150DatabaseSchemaProvider" xmlns="http://schemas.microsoft.com/sqlserver/dac/Serialization/2012/02">
+	<Model>
+		<Element Type="SqlSchema" Name="[sales]" />
+		<Element Type="SqlTable" Name="[dbo].[Orders]">
+			<Relationship Name="Columns">
+				<Entry>
+					<Element Type="SqlSimpleColumn" Name="[dbo].[Orders].[OrderID]">
+						<Property Name="IsNullable" Value="False" />
+						<Property Name="IsIdentity" Value="True" />
+						<Relationship Name="TypeSpecifier">
+							<Entry>
+								<Element Type="SqlTypeSpecifier">
+									<Relationship Name="Type">
+										<Entry>
+											<References ExternalSource="BuiltIns" Name="[int]" />
+										</Entry>
+									</Relationship>
+								</Element>
+							</Entry>
+						</Relationship>
+					</Element>
+				</Entry>
+				<Entry>
+					<Element Type="SqlSimpleColumn" Name="[dbo].[Orders].[Amount]">
+						<Relationship Name="TypeSpecifier">
+							<Entry>
+								<Element Type="SqlTypeSpecifier">
+									<Property Name="Precision" Value="10" />
+									<Property Name="Scale" Value="2" />
+									<Relationship Name="Type">
+										<Entry>
+											<References ExternalSource="BuiltIns" Name="[decimal]" />
+										</Entry>
+									</Relationship>
+								</Element>
+							</Entry>
+						</Relationship>
+					</Element>
+				</Entry>
+				<Entry>
+					<Element Type="SqlComputedColumn" Name="[dbo].[Orders].[Total]">
+						<Property Name="ExpressionScript">
+							<Value><![CDATA[([Amount]*(1.2))]]></Value>
+						</Property>
+					</Element>
+				</Entry>
+			</Relationship>
+		</Element>
+		<Element Type="SqlTableType" Name="[dbo].[OrderLines]">
+			<Relationship Name="Columns">
+				<Entry>
+					<Element Type="SqlTableTypeSimpleColumn" Name="[dbo].[OrderLines].[Sku]">
+						<Property Name="IsNullable" Value="False" />
+						<Relationship Name="TypeSpecifier">
+							<Entry>
+								<Element Type="SqlTypeSpecifier">
+									<Property Name="Length" Value="20" />
+									<Relationship Name="Type">
+										<Entry>
+											<References ExternalSource="BuiltIns" Name="[nvarchar]" />
+										</Entry>
+									</Relationship>
+								</Element>
+							</Entry>
+						</Relationship>
+					</Element>
+				</Entry>
+			</Relationship>
+		</Element>
+		<Element Type="SqlProcedure" Name="[dbo].[usp_GetOrder]">
+			<Property Name="BodyScript">
+				<Value><![CDATA[
+BEGIN
+    SELECT Amount FROM Orders WHERE OrderID = @OrderID
+END]]></Value>
+			</Property>
+			<Annotation Type="SysCommentsObjectAnnotation">
+				<Property Name="HeaderContents" Value="CREATE PROCEDURE [dbo].[usp_GetOrder]&#xD;&#xA;    @OrderID INT&#xD;&#xA;AS" />
+			</Annotation>
+		</Element>
+		<Element Type="SqlProcedure" Name="[sales].[usp_Add]">
+			<Property Name="BodyScript">
+				<Value><![CDATA[SET @Total = @Amount]]></Value>
+			</Property>
+			<Relationship Name="Parameters">
+				<Entry>
+					<Element Type="SqlSubroutineParameter" Name="[sales].[usp_Add].[@Amount]">
+						<Property Name="DefaultExpressionScript">
+							<Value><![CDATA[0]]></Value>
+						</Property>
+						<Relationship Name="Type">
+							<Entry>
+								<Element Type="SqlTypeSpecifier">
+									<Property Name="Precision" Value="10" />
+									<Property Name="Scale" Value="2" />
+									<Relationship Name="Type">
+										<Entry>
+											<References ExternalSource="BuiltIns" Name="[decimal]" />
+										</Entry>
+									</Relationship>
+								</Element>
+							</Entry>
+						</Relationship>
+					</Element>
+				</Entry>
+				<Entry>
+					<Element Type="SqlSubroutineParameter" Name="[sales].[usp_Add].[@Total]">
+						<Property Name="IsOutput" Value="True" />
+						<Relationship Name="Type">
+							<Entry>
+								<Element Type="SqlTypeSpecifier">
+									<Property Name="IsMax" Value="True" />
+									<Relationship Name="Type">
+										<Entry>
+											<References ExternalSource="BuiltIns" Name="[varchar]" />
+										</Entry>
+									</Relationship>
+								</Element>
+							</Entry>
+						</Relationship>
+					</Element>
+				</Entry>
+			</Relationship>
+		</Element>
+		<Element Type="SqlScalarFunction" Name="[dbo].[fn_NoSource]" />
+	</Model>
+</DataSchemaModel>`
+
+func TestReadFrom(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range map[string]string{"model.xml": modelXML, "Origin.xml": "<DacOrigin />"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	model, err := ReadFrom(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("ReadFrom failed: %v", err)
+	}
+	if len(model.Objects) != 4 {
+		t.Fatalf("Expected 4 objects, got %+v", model.Objects)
+	}
+	if len(model.Skipped) != 1 || model.Skipped[0] != "[dbo].[fn_NoSource]" {
+		t.Errorf("Skipped = %v", model.Skipped)
+	}
+
+	tests := []struct {
+		fileName string
+		routine  bool
+		script   string
+	}{
+		{"dbo.Orders.sql", false, "CREATE TABLE [dbo].[Orders] (\n    [OrderID] INT IDENTITY NOT NULL,\n    [Amount] DECIMAL(10, 2),\n    [Total] AS ([Amount]*(1.2))\n)"},
+		{"dbo.OrderLines.sql", false, "CREATE TYPE [dbo].[OrderLines] AS TABLE (\n    [Sku] NVARCHAR(20) NOT NULL\n)"},
+		{"dbo.usp_GetOrder.sql", true, "CREATE PROCEDURE [dbo].[usp_GetOrder]\n    @OrderID INT\nAS\n\nBEGIN\n    SELECT Amount FROM Orders WHERE OrderID = @OrderID\nEND"},
+		{"sales.usp_Add.sql", true, "CREATE PROCEDURE [sales].[usp_Add]\n    @Amount DECIMAL(10, 2) = 0,\n    @Total VARCHAR(MAX) OUTPUT\nAS\nSET @Total = @Amount"},
+	}
+	for i, tt := range tests {
+		obj := model.Objects[i]
+		if obj.FileName() != tt.fileName || obj.IsRoutine() != tt.routine {
+			t.Errorf("object %d: got %s, routine %v", i, obj.FileName(), obj.IsRoutine())
+		}
+		if obj.Script != tt.script {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.fileName, obj.Script, tt.script)
+		}
+	}
+
+	if _, err := ReadFrom(bytes.NewReader(nil), 0); err == nil {
+		t.Error("Expected an error for an empty package")
+	}
+}
+
+func TestSplitName(t *testing.T) {
+	got := strings.Join(splitName("[dbo].[Odd]]Name].[@P]"), "|")
+	if got != "dbo|Odd]Name|@P" {
+		t.Errorf("splitName = %q", got)
+	}
+}
@@ -0,0 +1,386 @@
+// Package lint checks invariants across a directory of generated Go code
+// and the sources it came from. Per-file transpilation cannot see drift
+// between files, stale outputs or protos that changed underneath the
+// generated calls; lint can.
+package lint
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ha1tch/tgpiler/storage"
+)
+
+// Rule names reported in findings.
+const (
+	RulePlaceholders = "placeholders"  // Query placeholder count differs from args
+	RuleReviewedTODO = "reviewed-todo" // TODO left in a file marked reviewed
+	RuleGRPCMethod   = "grpc-method"   // Called gRPC method is not in any proto
+	RuleReceiver     = "receiver"      // Receiver/store differs from the rest of the directory
+	RuleProcedure    = "procedure"     // Source procedure missing or out of date
+)
+
+// ReviewedMarker marks a generated file as hand-reviewed. Reviewed files
+// must not contain TODO markers.
+const ReviewedMarker = "tgpiler:reviewed"
+
+// Finding is a single lint result.
+type Finding struct {
+	File    string // Empty for findings about source SQL
+	Line    int
+	Rule    string
+	Message string
+}
+
+func (f Finding) String() string {
+	if f.File == "" {
+		return fmt.Sprintf("[%s] %s", f.Rule, f.Message)
+	}
+	return fmt.Sprintf("%s:%d: [%s] %s", f.File, f.Line, f.Rule, f.Message)
+}
+
+// Options enables the checks that need more than the generated code.
+type Options struct {
+	Protos     *storage.ProtoParseResult // Enables the grpc-method check
+	Procedures []*storage.Procedure      // Enables the procedure check
+}
+
+// File is a generated Go source file.
+type File struct {
+	Path string
+	Src  []byte
+}
+
+// LoadDir reads every .go file in dir, excluding tests.
+func LoadDir(dir string) ([]File, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading directory %s: %w", dir, err)
+	}
+	var files []File
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", path, err)
+		}
+		files = append(files, File{Path: path, Src: src})
+	}
+	return files, nil
+}
+
+// Run checks files and returns findings sorted by file and line.
+func Run(files []File, opts Options) ([]Finding, error) {
+	l := &linter{
+		fset:       token.NewFileSet(),
+		opts:       opts,
+		receivers:  map[string][]token.Position{},
+		stores:     map[string][]token.Position{},
+		funcParams: map[string]int{},
+	}
+	for _, f := range files {
+		file, err := parser.ParseFile(l.fset, f.Path, f.Src, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		l.checkFile(file)
+	}
+	l.checkConsistency(RuleReceiver, "receiver type", l.receivers)
+	l.checkConsistency(RuleReceiver, "store", l.stores)
+	l.checkProcedures()
+
+	sort.SliceStable(l.findings, func(i, j int) bool {
+		a, b := l.findings[i], l.findings[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Line < b.Line
+	})
+	return l.findings, nil
+}
+
+type linter struct {
+	fset     *token.FileSet
+	opts     Options
+	findings []Finding
+
+	// Directory-wide state for consistency checks
+	receivers  map[string][]token.Position // receiver type -> procedure methods
+	stores     map[string][]token.Position // store expression -> query calls
+	funcParams map[string]int              // normalised procedure name -> input parameter count
+}
+
+func (l *linter) report(pos token.Pos, rule, format string, args ...interface{}) {
+	p := l.fset.Position(pos)
+	l.findings = append(l.findings, Finding{File: p.Filename, Line: p.Line, Rule: rule, Message: fmt.Sprintf(format, args...)})
+}
+
+func (l *linter) checkFile(file *ast.File) {
+	l.checkReviewedTODOs(file)
+
+	ast.Inspect(file, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if queryArg, ok := queryMethods[sel.Sel.Name]; ok {
+			l.checkPlaceholders(call, queryArg)
+			// Queries inside a transaction go through tx, not the store
+			if store := exprString(sel.X); store != "tx" {
+				l.stores[store] = append(l.stores[store], l.fset.Position(call.Pos()))
+			}
+		}
+		l.checkGRPCMethod(call, sel)
+		return true
+	})
+
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok {
+			l.recordProcedure(fn)
+		}
+	}
+}
+
+// queryMethods maps database/sql methods to the index of their query argument.
+var queryMethods = map[string]int{
+	"QueryContext":    1,
+	"QueryRowContext": 1,
+	"ExecContext":     1,
+	"Query":           0,
+	"QueryRow":        0,
+	"Exec":            0,
+}
+
+var (
+	numberedPlaceholder = regexp.MustCompile(`\$(\d+)|@p(\d+)`)
+	quotedSQLString     = regexp.MustCompile(`'(?:[^']|'')*'`)
+)
+
+// checkPlaceholders compares the placeholders in a literal query with the
+// number of arguments passed after it. Calls that spread a slice (args...)
+// are skipped since the count isn't known statically.
+func (l *linter) checkPlaceholders(call *ast.CallExpr, queryArg int) {
+	if len(call.Args) <= queryArg || call.Ellipsis.IsValid() {
+		return
+	}
+	lit, ok := call.Args[queryArg].(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return
+	}
+	query, err := strconv.Unquote(lit.Value)
+	if err != nil {
+		return
+	}
+	want := placeholderCount(query)
+	got := len(call.Args) - queryArg - 1
+	if want != got {
+		l.report(call.Pos(), RulePlaceholders, "query has %d placeholder(s) but %d argument(s): %q", want, got, query)
+	}
+}
+
+// placeholderCount returns the number of distinct arguments a query needs:
+// the highest $N/@pN for numbered dialects, or the number of ? otherwise.
+func placeholderCount(query string) int {
+	query = quotedSQLString.ReplaceAllString(query, "''")
+	highest := 0
+	for _, m := range numberedPlaceholder.FindAllStringSubmatch(query, -1) {
+		digits := m[1]
+		if digits == "" {
+			digits = m[2]
+		}
+		if n, err := strconv.Atoi(digits); err == nil && n > highest {
+			highest = n
+		}
+	}
+	if highest > 0 {
+		return highest
+	}
+	return strings.Count(query, "?")
+}
+
+func (l *linter) checkReviewedTODOs(file *ast.File) {
+	reviewed := false
+	for _, cg := range file.Comments {
+		if strings.Contains(cg.Text(), ReviewedMarker) {
+			reviewed = true
+			break
+		}
+	}
+	if !reviewed {
+		return
+	}
+	for _, cg := range file.Comments {
+		for _, c := range cg.List {
+			if strings.Contains(c.Text, "TODO") {
+				l.report(c.Pos(), RuleReviewedTODO, "TODO in reviewed file: %s", strings.TrimSpace(strings.TrimPrefix(c.Text, "//")))
+			}
+		}
+	}
+}
+
+// checkGRPCMethod verifies calls shaped like generated gRPC client calls,
+// client.Method(ctx, &pb.MethodRequest{...}), against the parsed protos.
+func (l *linter) checkGRPCMethod(call *ast.CallExpr, sel *ast.SelectorExpr) {
+	if l.opts.Protos == nil || len(call.Args) != 2 {
+		return
+	}
+	unary, ok := call.Args[1].(*ast.UnaryExpr)
+	if !ok || unary.Op != token.AND {
+		return
+	}
+	lit, ok := unary.X.(*ast.CompositeLit)
+	if !ok {
+		return
+	}
+	typ, ok := lit.Type.(*ast.SelectorExpr)
+	if !ok || !strings.HasSuffix(typ.Sel.Name, "Request") {
+		return
+	}
+	method := sel.Sel.Name
+	for _, m := range l.opts.Protos.AllMethods {
+		if m.Name == method {
+			return
+		}
+	}
+	l.report(call.Pos(), RuleGRPCMethod, "gRPC method %s is not defined in any proto service", method)
+}
+
+// recordProcedure records a transpiled procedure: a function whose first
+// parameter is ctx context.Context.
+func (l *linter) recordProcedure(fn *ast.FuncDecl) {
+	params := fn.Type.Params.List
+	if len(params) == 0 || exprString(params[0].Type) != "context.Context" {
+		return
+	}
+	// Only methods that query the store count towards the receiver check,
+	// so hand-written or server code sharing the directory is ignored.
+	if fn.Recv != nil && len(fn.Recv.List) == 1 && callsQueryMethod(fn.Body) {
+		recv := exprString(fn.Recv.List[0].Type)
+		l.receivers[recv] = append(l.receivers[recv], l.fset.Position(fn.Pos()))
+	}
+
+	count := 0
+	for i, field := range params {
+		if i == 0 {
+			continue // ctx
+		}
+		n := len(field.Names)
+		if n == 0 {
+			n = 1
+		}
+		count += n
+	}
+	// Functional style threads the store as the second parameter
+	if fn.Recv == nil && len(params) > 1 && isStoreType(exprString(params[1].Type)) {
+		count--
+	}
+	l.funcParams[normaliseName(fn.Name.Name)] = count
+}
+
+func callsQueryMethod(body *ast.BlockStmt) bool {
+	found := false
+	if body == nil {
+		return false
+	}
+	ast.Inspect(body, func(n ast.Node) bool {
+		if call, ok := n.(*ast.CallExpr); ok {
+			if sel, ok := call.Fun.(*ast.SelectorExpr); ok {
+				if _, ok := queryMethods[sel.Sel.Name]; ok {
+					found = true
+				}
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+func isStoreType(t string) bool {
+	return t == "tsqlruntime.DBTX" || t == "*sql.DB" || t == "*sql.Tx"
+}
+
+// checkConsistency reports every use of a value that differs from the
+// one most of the directory uses.
+func (l *linter) checkConsistency(rule, what string, uses map[string][]token.Position) {
+	if len(uses) < 2 {
+		return
+	}
+	common := ""
+	for value, positions := range uses {
+		if len(positions) > len(uses[common]) || (len(positions) == len(uses[common]) && value < common) {
+			common = value
+		}
+	}
+	for value, positions := range uses {
+		if value == common {
+			continue
+		}
+		for _, p := range positions {
+			l.findings = append(l.findings, Finding{
+				File:    p.Filename,
+				Line:    p.Line,
+				Rule:    rule,
+				Message: fmt.Sprintf("%s %s differs from %s used in %d other place(s)", what, value, common, len(uses[common])),
+			})
+		}
+	}
+}
+
+// checkProcedures reports source procedures with no generated function, or
+// whose input parameter count no longer matches it.
+func (l *linter) checkProcedures() {
+	for _, proc := range l.opts.Procedures {
+		inputs := 0
+		for _, p := range proc.Parameters {
+			if !p.IsOutput {
+				inputs++
+			}
+		}
+		got, ok := l.funcParams[normaliseName(proc.Name)]
+		switch {
+		case !ok:
+			l.findings = append(l.findings, Finding{Rule: RuleProcedure, Message: fmt.Sprintf("procedure %s has no generated function", proc.Name)})
+		case got != inputs:
+			l.findings = append(l.findings, Finding{Rule: RuleProcedure, Message: fmt.Sprintf("procedure %s has %d input parameter(s) but the generated function takes %d", proc.Name, inputs, got)})
+		}
+	}
+}
+
+// normaliseName compares procedure and Go names ignoring case, schema and
+// underscores (usp_GetOrder matches UspGetOrder).
+func normaliseName(name string) string {
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.Trim(name, "[]")
+	return strings.ToLower(strings.ReplaceAll(name, "_", ""))
+}
+
+func exprString(e ast.Expr) string {
+	switch x := e.(type) {
+	case *ast.Ident:
+		return x.Name
+	case *ast.SelectorExpr:
+		return exprString(x.X) + "." + x.Sel.Name
+	case *ast.StarExpr:
+		return "*" + exprString(x.X)
+	default:
+		return fmt.Sprintf("%T", e)
+	}
+}
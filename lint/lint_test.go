@@ -0,0 +1,150 @@
+package lint
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ha1tch/tgpiler/storage"
+)
+
+const orders = `package repo
+
+import "context"
+
+func (r *Repository) GetOrder(ctx context.Context, id int64) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE Orders SET Seen = 'a?b' WHERE ID = $1 AND Owner = $1", id)
+	return err
+}
+
+func (r *Repository) DeleteOrder(ctx context.Context, id int64) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM Orders WHERE ID = $1 AND Status = $2", id)
+	return err
+}
+`
+
+const customers = `package repo
+
+import "context"
+
+// tgpiler:reviewed
+
+func (s *Store) GetCustomer(ctx context.Context, id int64) error {
+	// TODO(tgpiler): verify
+	_, err := s.conn.ExecContext(ctx, "DELETE FROM Customers WHERE ID = ?", id)
+	return err
+}
+
+func (s *Store) FindCustomer(ctx context.Context, name string) error {
+	_, err := s.conn.GetCustomerByName(ctx, &customerpb.GetCustomerByNameRequest{Name: name})
+	return err
+}
+`
+
+func findingsByRule(t *testing.T, opts Options) map[string][]Finding {
+	t.Helper()
+	findings, err := Run([]File{
+		{Path: "orders.go", Src: []byte(orders)},
+		{Path: "orders_more.go", Src: []byte(strings.Replace(orders, "Order(", "OrderItem(", 2))},
+		{Path: "customers.go", Src: []byte(customers)},
+	}, opts)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	byRule := map[string][]Finding{}
+	for _, f := range findings {
+		byRule[f.Rule] = append(byRule[f.Rule], f)
+	}
+	return byRule
+}
+
+func TestRun_GeneratedCodeChecks(t *testing.T) {
+	byRule := findingsByRule(t, Options{})
+
+	// Reused $1 and the quoted ? don't count; DeleteOrder is one argument short
+	placeholders := byRule[RulePlaceholders]
+	if len(placeholders) != 2 {
+		t.Fatalf("expected 2 placeholder findings, got %v", placeholders)
+	}
+	for _, f := range placeholders {
+		if !strings.Contains(f.Message, "2 placeholder(s) but 1 argument(s)") {
+			t.Errorf("unexpected placeholder finding: %s", f)
+		}
+	}
+
+	todos := byRule[RuleReviewedTODO]
+	if len(todos) != 1 || todos[0].File != "customers.go" || todos[0].Line != 8 {
+		t.Errorf("expected one TODO in customers.go:8, got %v", todos)
+	}
+
+	// customers.go is the odd one out for both receiver type and store
+	receivers := byRule[RuleReceiver]
+	if len(receivers) != 2 {
+		t.Fatalf("expected 2 receiver findings, got %v", receivers)
+	}
+	for _, f := range receivers {
+		if f.File != "customers.go" {
+			t.Errorf("expected receiver findings in customers.go, got %s", f)
+		}
+	}
+
+	if len(byRule[RuleGRPCMethod]) != 0 || len(byRule[RuleProcedure]) != 0 {
+		t.Errorf("proto and SQL checks should be off without options: %v", byRule)
+	}
+}
+
+func TestRun_GRPCMethods(t *testing.T) {
+	protos := storage.NewProtoParseResult([]storage.ProtoFile{{
+		Services: []storage.ProtoServiceInfo{{
+			Name:    "CustomerService",
+			Methods: []storage.ProtoMethodInfo{{Name: "GetCustomer"}},
+		}},
+	}})
+
+	byRule := findingsByRule(t, Options{Protos: protos})
+	methods := byRule[RuleGRPCMethod]
+	if len(methods) != 1 || !strings.Contains(methods[0].Message, "GetCustomerByName") {
+		t.Errorf("expected GetCustomerByName to be reported, got %v", methods)
+	}
+}
+
+func TestRun_Procedures(t *testing.T) {
+	procs := []*storage.Procedure{
+		{Name: "dbo.Get_Order", Parameters: []storage.ProcParameter{{Name: "ID"}}},
+		{Name: "DeleteOrder", Parameters: []storage.ProcParameter{{Name: "ID"}, {Name: "Force"}, {Name: "Count", IsOutput: true}}},
+		{Name: "ArchiveOrders"},
+	}
+
+	byRule := findingsByRule(t, Options{Procedures: procs})
+	var messages []string
+	for _, f := range byRule[RuleProcedure] {
+		messages = append(messages, f.Message)
+	}
+	got := strings.Join(messages, "\n")
+	for _, want := range []string{
+		"procedure DeleteOrder has 2 input parameter(s) but the generated function takes 1",
+		"procedure ArchiveOrders has no generated function",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "Get_Order") {
+		t.Errorf("dbo.Get_Order should match GetOrder:\n%s", got)
+	}
+}
+
+func TestPlaceholderCount(t *testing.T) {
+	tests := map[string]int{
+		"SELECT 1":                                  0,
+		"SELECT * FROM T WHERE a = $1 OR b = $1":    1,
+		"SELECT * FROM T WHERE a = $2 AND b = $1":   2,
+		"SELECT * FROM T WHERE a = ? AND b = ?":     2,
+		"SELECT * FROM T WHERE a = @p1":             1,
+		"SELECT '?', 'it''s $3' FROM T WHERE a = ?": 1,
+	}
+	for query, want := range tests {
+		if got := placeholderCount(query); got != want {
+			t.Errorf("placeholderCount(%q) = %d, want %d", query, got, want)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package protogen
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/ha1tch/tgpiler/storage"
+	"github.com/ha1tch/tgpiler/transpiler"
+)
+
+// EnumFields returns the fields of enum types in the messages of proto, for
+// transpiler.DMLConfig.ProtoEnumFields. Each value of an enum is matched
+// by its name, its name without the enum's prefix (PENDING for
+// ORDER_STATUS_PENDING in OrderStatus) and its number.
+//
+// overrides, the contents of an overrides file, maps other literals to
+// values, in a block per enum:
+//
+//	OrderStatus:
+//	  'Approved': ORDER_STATUS_CONFIRMED
+//	  9: ORDER_STATUS_CANCELLED
+func EnumFields(proto *storage.ProtoParseResult, overrides string) (map[string]*transpiler.ProtoEnum, error) {
+	enums := map[string]*transpiler.ProtoEnum{}
+	infos := map[string]storage.ProtoEnumInfo{}
+	for _, f := range proto.Files {
+		for _, e := range f.Enums {
+			enums[e.Name] = enumValues(e)
+			infos[e.Name] = e
+		}
+	}
+	if err := applyEnumOverrides(enums, infos, overrides); err != nil {
+		return nil, err
+	}
+
+	fields := map[string]*transpiler.ProtoEnum{}
+	byField := map[string]*transpiler.ProtoEnum{}
+	ambiguous := map[string]bool{}
+	for _, msg := range proto.AllMessages {
+		for _, field := range msg.Fields {
+			t := field.ProtoType
+			if i := strings.LastIndex(t, "."); i >= 0 {
+				t = t[i+1:]
+			}
+			enum, ok := enums[t]
+			if !ok || field.IsRepeated {
+				continue
+			}
+			fields[transpiler.EnumFieldKey(msg.Name, field.Name)] = enum
+			key := transpiler.EnumFieldKey("", field.Name)
+			if other, ok := byField[key]; ok && other != enum {
+				ambiguous[key] = true
+			}
+			byField[key] = enum
+		}
+	}
+	// A field name is enough when it has the same enum in every message
+	for key, enum := range byField {
+		if !ambiguous[key] {
+			fields[key] = enum
+		}
+	}
+	return fields, nil
+}
+
+// enumValues returns the values of e by the literals that match them.
+func enumValues(e storage.ProtoEnumInfo) *transpiler.ProtoEnum {
+	enum := &transpiler.ProtoEnum{Name: e.Name, Values: map[string]string{}}
+	prefix := enumPrefix(e.Name)
+	for _, v := range e.Values {
+		constant := e.Name + "_" + v.Name
+		enum.Values[transpiler.EnumKey(v.Name)] = constant
+		if short := strings.TrimPrefix(v.Name, prefix); short != v.Name && short != "" {
+			enum.Values[transpiler.EnumKey(short)] = constant
+		}
+		enum.Values[strconv.Itoa(v.Number)] = constant
+	}
+	return enum
+}
+
+// enumPrefix returns the prefix of the values of an enum by the style
+// guide: its name in upper snake case, ORDER_STATUS_ for OrderStatus.
+func enumPrefix(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if unicode.IsUpper(r) && i > 0 {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String() + "_"
+}
+
+// applyEnumOverrides adds the literals of an overrides file to enums.
+func applyEnumOverrides(enums map[string]*transpiler.ProtoEnum, infos map[string]storage.ProtoEnumInfo, source string) error {
+	var enum *transpiler.ProtoEnum
+	for n, line := range strings.Split(source, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		i := strings.LastIndex(trimmed, ":")
+		if i < 0 {
+			return fmt.Errorf("line %d: expected \"Enum:\" or \"literal: VALUE\", got %q", n+1, trimmed)
+		}
+		literal, value := strings.TrimSpace(trimmed[:i]), strings.TrimSpace(trimmed[i+1:])
+		if line[0] != ' ' && line[0] != '\t' {
+			e, ok := enums[literal]
+			if !ok || value != "" {
+				return fmt.Errorf("line %d: %s is not an enum of the protos", n+1, literal)
+			}
+			enum = e
+			continue
+		}
+		if enum == nil {
+			return fmt.Errorf("line %d: %s is not in an enum's block", n+1, literal)
+		}
+		var key string
+		if len(literal) >= 2 && literal[0] == '\'' && literal[len(literal)-1] == '\'' {
+			key = transpiler.EnumKey(strings.ReplaceAll(literal[1:len(literal)-1], "''", "'"))
+		} else if i, err := strconv.ParseInt(literal, 10, 64); err == nil {
+			key = strconv.FormatInt(i, 10)
+		} else {
+			return fmt.Errorf("line %d: %s is neither a string in single quotes nor an integer", n+1, literal)
+		}
+		constant := ""
+		for _, v := range infos[enum.Name].Values {
+			if v.Name == value || v.Name == enumPrefix(enum.Name)+value {
+				constant = enum.Name + "_" + v.Name
+			}
+		}
+		if constant == "" {
+			return fmt.Errorf("line %d: %s has no value %s", n+1, enum.Name, value)
+		}
+		enum.Values[key] = constant
+	}
+	return nil
+}
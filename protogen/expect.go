@@ -0,0 +1,242 @@
+package protogen
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Expectations
+//
+// Expectations script how a MockServer answers particular calls, so tests
+// of migrated callers can set up realistic scenarios without writing
+// handlers:
+//
+//	server.On("OrderService.ApproveOrder").
+//		WithRequest(map[string]interface{}{"order_id": int64(7)}).
+//		ReturnError(protogen.CodeUnavailable, "approvals offline").
+//		Times(2)
+//
+// A call is answered by the first expectation, in the order they were
+// added, whose method and request match and whose Times are not used up.
+// Calls no expectation matches go to the method's handler as before. An
+// expectation with latency but no Return delays the call and then passes
+// it on, which injects latency alone.
+
+// ErrorCode is a status code for injected errors. The values are the
+// gRPC canonical codes, so callers that map codes behave as they would
+// against the real service.
+type ErrorCode int
+
+// Error codes
+const (
+	CodeOK                 ErrorCode = 0
+	CodeCanceled           ErrorCode = 1
+	CodeUnknown            ErrorCode = 2
+	CodeInvalidArgument    ErrorCode = 3
+	CodeDeadlineExceeded   ErrorCode = 4
+	CodeNotFound           ErrorCode = 5
+	CodeAlreadyExists      ErrorCode = 6
+	CodePermissionDenied   ErrorCode = 7
+	CodeResourceExhausted  ErrorCode = 8
+	CodeFailedPrecondition ErrorCode = 9
+	CodeAborted            ErrorCode = 10
+	CodeOutOfRange         ErrorCode = 11
+	CodeUnimplemented      ErrorCode = 12
+	CodeInternal           ErrorCode = 13
+	CodeUnavailable        ErrorCode = 14
+	CodeDataLoss           ErrorCode = 15
+	CodeUnauthenticated    ErrorCode = 16
+)
+
+var errorCodeNames = [...]string{
+	"OK", "Canceled", "Unknown", "InvalidArgument", "DeadlineExceeded",
+	"NotFound", "AlreadyExists", "PermissionDenied", "ResourceExhausted",
+	"FailedPrecondition", "Aborted", "OutOfRange", "Unimplemented",
+	"Internal", "Unavailable", "DataLoss", "Unauthenticated",
+}
+
+// String returns the code's name, e.g. "Unavailable".
+func (c ErrorCode) String() string {
+	if c >= 0 && int(c) < len(errorCodeNames) {
+		return errorCodeNames[c]
+	}
+	return fmt.Sprintf("Code(%d)", int(c))
+}
+
+// MockError is the error returned by ReturnError.
+type MockError struct {
+	Code    ErrorCode
+	Message string
+}
+
+func (e *MockError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// Expectation is a scripted answer to calls of one method. Build it with
+// MockServer.On and the chained methods below.
+type Expectation struct {
+	service string // "" matches any service
+	method  string
+
+	match   func(req map[string]interface{}) bool
+	latency time.Duration
+
+	responds bool
+	resp     map[string]interface{}
+	err      error
+
+	times int // 0 = unlimited
+	calls int
+
+	mu *sync.Mutex // The server's expectMu, guarding calls
+}
+
+// On adds an expectation for method, given as "Service.Method" or as a
+// bare method name matching it on any service.
+func (s *MockServer) On(method string) *Expectation {
+	e := &Expectation{method: method, mu: &s.expectMu}
+	if i := strings.LastIndex(method, "."); i >= 0 {
+		e.service, e.method = method[:i], method[i+1:]
+	}
+	s.expectMu.Lock()
+	s.expectations = append(s.expectations, e)
+	s.expectMu.Unlock()
+	return e
+}
+
+// WithRequestMatching makes the expectation apply only to requests for
+// which match returns true.
+func (e *Expectation) WithRequestMatching(match func(req map[string]interface{}) bool) *Expectation {
+	e.match = match
+	return e
+}
+
+// WithRequest makes the expectation apply only to requests that have
+// every field of fields with an equal value.
+func (e *Expectation) WithRequest(fields map[string]interface{}) *Expectation {
+	return e.WithRequestMatching(func(req map[string]interface{}) bool {
+		for k, v := range fields {
+			if rv, ok := req[k]; !ok || !valuesEqual(rv, v) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// Return answers matching calls with resp and err.
+func (e *Expectation) Return(resp map[string]interface{}, err error) *Expectation {
+	e.responds = true
+	e.resp, e.err = resp, err
+	return e
+}
+
+// ReturnError answers matching calls with a *MockError.
+func (e *Expectation) ReturnError(code ErrorCode, message string) *Expectation {
+	return e.Return(nil, &MockError{Code: code, Message: message})
+}
+
+// WithLatency delays matching calls by d. A call whose context ends first
+// returns the context's error.
+func (e *Expectation) WithLatency(d time.Duration) *Expectation {
+	e.latency = d
+	return e
+}
+
+// Times limits the expectation to n calls, after which calls fall through
+// to later expectations or the handler.
+func (e *Expectation) Times(n int) *Expectation {
+	e.times = n
+	return e
+}
+
+// Once is Times(1).
+func (e *Expectation) Once() *Expectation {
+	return e.Times(1)
+}
+
+// Calls returns the number of calls the expectation has answered.
+func (e *Expectation) Calls() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.calls
+}
+
+// String returns the expectation's method, e.g. "OrderService.ApproveOrder".
+func (e *Expectation) String() string {
+	if e.service == "" {
+		return e.method
+	}
+	return e.service + "." + e.method
+}
+
+// matches reports whether e answers a call of service.method with req.
+func (e *Expectation) matches(service, method string, req map[string]interface{}) bool {
+	if e.method != method || (e.service != "" && e.service != service) {
+		return false
+	}
+	if e.times > 0 && e.calls >= e.times {
+		return false
+	}
+	return e.match == nil || e.match(req)
+}
+
+// findExpectation returns the expectation answering a call, counting the
+// call against it, or nil.
+func (s *MockServer) findExpectation(service, method string, req map[string]interface{}) *Expectation {
+	s.expectMu.Lock()
+	defer s.expectMu.Unlock()
+	for _, e := range s.expectations {
+		if e.matches(service, method, req) {
+			e.calls++
+			return e
+		}
+	}
+	return nil
+}
+
+// apply waits out e's latency. It reports whether e answers the call
+// itself, and with what.
+func (e *Expectation) apply(ctx context.Context) (bool, map[string]interface{}, error) {
+	if e.latency > 0 {
+		timer := time.NewTimer(e.latency)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return true, nil, ctx.Err()
+		}
+	}
+	if !e.responds {
+		return false, nil, nil
+	}
+	return true, e.resp, e.err
+}
+
+// ExpectationsMet returns an error listing the expectations limited with
+// Times that were called fewer times than that, or nil.
+func (s *MockServer) ExpectationsMet() error {
+	s.expectMu.Lock()
+	defer s.expectMu.Unlock()
+	var unmet []string
+	for _, e := range s.expectations {
+		if e.times > 0 && e.calls < e.times {
+			unmet = append(unmet, fmt.Sprintf("%s: called %d of %d times", e, e.calls, e.times))
+		}
+	}
+	if len(unmet) > 0 {
+		return fmt.Errorf("unmet expectations:\n  %s", strings.Join(unmet, "\n  "))
+	}
+	return nil
+}
+
+// ClearExpectations removes every expectation.
+func (s *MockServer) ClearExpectations() {
+	s.expectMu.Lock()
+	defer s.expectMu.Unlock()
+	s.expectations = nil
+}
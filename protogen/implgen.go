@@ -4,8 +4,12 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 	"text/template"
+	"unicode"
 
 	"github.com/ha1tch/tgpiler/storage"
 )
@@ -398,24 +402,81 @@ func getPlaceholder(dialect string, n int) string {
 	}
 }
 
-// GenerateAll generates implementation files for all services.
+// GenerateAll writes one implementation file per service into outputDir,
+// each service in its own package subdirectory.
 func (g *ImplementationGenerator) GenerateAll(outputDir string, opts ServerGenOptions) error {
-	for svcName := range g.proto.AllServices {
-		opts.PackageName = strings.ToLower(strings.TrimSuffix(svcName, "Service"))
-		
-		var buf bytes.Buffer
-		if err := g.GenerateServiceImpl(svcName, opts, &buf); err != nil {
-			return fmt.Errorf("generate %s: %w", svcName, err)
+	files, err := g.GenerateServiceImplFiles(opts, true)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		path := filepath.Join(outputDir, f.Path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, f.Content, 0644); err != nil {
+			return fmt.Errorf("generate %s: %w", f.Service, err)
 		}
-		
-		// Write would happen here with file I/O
-		// For now, we just collect the output
 	}
 	return nil
 }
 
+// ImplFile is one file of generated service implementations.
+type ImplFile struct {
+	Service string // Service it implements
+	Package string // Go package name
+	Path    string // Relative to the output directory, e.g. order/order_service.go
+	Content []byte
+}
+
+// GenerateServiceImplFiles generates the implementation of each service as
+// a file of its own, with only the imports that service needs. Files are
+// named after the service (OrderService -> order_service.go). With
+// packageDirs every service gets its own package in a subdirectory
+// (order/order_service.go, package order); otherwise all share
+// opts.PackageName.
+func (g *ImplementationGenerator) GenerateServiceImplFiles(opts ServerGenOptions, packageDirs bool) ([]ImplFile, error) {
+	var files []ImplFile
+	for _, svcName := range g.serviceNames() {
+		svcOpts := opts
+		path := implFileName(svcName)
+		if packageDirs {
+			svcOpts.PackageName = servicePackageName(svcName)
+			path = filepath.Join(svcOpts.PackageName, path)
+		}
+
+		var buf bytes.Buffer
+		if err := g.generateServicesImpl([]string{svcName}, svcOpts, &buf); err != nil {
+			return nil, fmt.Errorf("generate %s: %w", svcName, err)
+		}
+		files = append(files, ImplFile{
+			Service: svcName,
+			Package: svcOpts.PackageName,
+			Path:    path,
+			Content: buf.Bytes(),
+		})
+	}
+	return files, nil
+}
+
 // GenerateAllServicesImpl generates all services in a single output with one package header.
 func (g *ImplementationGenerator) GenerateAllServicesImpl(opts ServerGenOptions, w io.Writer) error {
+	return g.generateServicesImpl(g.serviceNames(), opts, w)
+}
+
+// serviceNames returns the names of all services, sorted so output is
+// stable.
+func (g *ImplementationGenerator) serviceNames() []string {
+	names := make([]string, 0, len(g.proto.AllServices))
+	for name := range g.proto.AllServices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// generateServicesImpl generates the named services in one file.
+func (g *ImplementationGenerator) generateServicesImpl(services []string, opts ServerGenOptions, w io.Writer) error {
 	dialect := opts.Dialect
 	if dialect == "" {
 		dialect = "postgres"
@@ -432,8 +493,8 @@ func (g *ImplementationGenerator) GenerateAllServicesImpl(opts ServerGenOptions,
 	data.Imports["database/sql"] = true
 	data.Imports["fmt"] = true
 
-	// Collect all services
-	for svcName, svc := range g.proto.AllServices {
+	for _, svcName := range services {
+		svc := g.proto.AllServices[svcName]
 		svcData := implServiceData{
 			ServiceName: svcName,
 			RepoName:    svcName + "Repository",
@@ -482,6 +543,35 @@ func (g *ImplementationGenerator) GenerateAllServicesImpl(opts ServerGenOptions,
 	return multiServiceImplTemplate.Execute(w, data)
 }
 
+// servicePackageName returns the package a service gets with package
+// directories: OrderService -> order.
+func servicePackageName(svcName string) string {
+	name := strings.ToLower(strings.TrimSuffix(svcName, "Service"))
+	if name == "" {
+		name = strings.ToLower(svcName)
+	}
+	return name
+}
+
+// implFileName returns the file a service is written to: OrderService ->
+// order_service.go.
+func implFileName(svcName string) string {
+	var b strings.Builder
+	runes := []rune(svcName)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			// Start a word at a lower-to-upper change, or at the last
+			// capital of an acronym (HTTPServer -> http_server)
+			if i > 0 && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]))) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String() + ".go"
+}
+
 // multiServiceImplTemplate generates all services with a single package header
 var multiServiceImplTemplate = template.Must(template.New("multiImpl").Funcs(template.FuncMap{
 	"join":       strings.Join,
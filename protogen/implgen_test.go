@@ -2,6 +2,8 @@ package protogen
 
 import (
 	"bytes"
+	goparser "go/parser"
+	"go/token"
 	"os"
 	"path/filepath"
 	"strings"
@@ -173,6 +175,66 @@ func TestImplementationGenerator_ShopEasy(t *testing.T) {
 	t.Logf("Output directory: %s", outputDir)
 }
 
+func TestGenerateServiceImplFiles(t *testing.T) {
+	protoResult, err := NewParser().ParseDir("../examples/shopeasy/protos")
+	if err != nil {
+		t.Fatalf("Failed to parse protos: %v", err)
+	}
+	var allProcs []*storage.Procedure
+	files, _ := filepath.Glob("../examples/shopeasy/procedures/*.sql")
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		procs, err := storage.NewProcedureExtractor().ExtractAll(string(content))
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		allProcs = append(allProcs, procs...)
+	}
+	gen := NewImplementationGenerator(protoResult, allProcs)
+
+	opts := DefaultServerGenOptions()
+	opts.PackageName = "repo"
+	flat, err := gen.GenerateServiceImplFiles(opts, false)
+	if err != nil {
+		t.Fatalf("GenerateServiceImplFiles failed: %v", err)
+	}
+	if len(flat) != len(protoResult.AllServices) {
+		t.Fatalf("expected a file per service, got %d for %d services", len(flat), len(protoResult.AllServices))
+	}
+	for _, f := range flat {
+		content := string(f.Content)
+		if f.Package != "repo" || !strings.HasPrefix(content, "// Code generated") || !strings.Contains(content, "\npackage repo\n") {
+			t.Errorf("%s: unexpected package %q", f.Path, f.Package)
+		}
+		if strings.Count(content, "Repository Implementation") != 1 || !strings.Contains(content, "type "+f.Service+"Repository interface") {
+			t.Errorf("%s: expected only %s", f.Path, f.Service)
+		}
+		if _, err := goparser.ParseFile(token.NewFileSet(), f.Path, f.Content, 0); err != nil {
+			t.Errorf("%s doesn't parse: %v", f.Path, err)
+		}
+	}
+	if flat[0].Service != "CartService" || flat[0].Path != "cart_service.go" {
+		t.Errorf("expected services in name order, got %s (%s) first", flat[0].Service, flat[0].Path)
+	}
+
+	dirs, err := gen.GenerateServiceImplFiles(opts, true)
+	if err != nil {
+		t.Fatalf("GenerateServiceImplFiles failed: %v", err)
+	}
+	if f := dirs[0]; f.Package != "cart" || f.Path != filepath.Join("cart", "cart_service.go") || !strings.Contains(string(f.Content), "\npackage cart\n") {
+		t.Errorf("expected package cart in cart/cart_service.go, got %s in %s", f.Package, f.Path)
+	}
+
+	for name, want := range map[string]string{"OrderService": "order_service.go", "HTTPGateway": "http_gateway.go", "Users": "users.go"} {
+		if got := implFileName(name); got != want {
+			t.Errorf("implFileName(%s) = %s, want %s", name, got, want)
+		}
+	}
+}
+
 func TestProcedureExtractor(t *testing.T) {
 	sql := `
 CREATE PROCEDURE usp_GetUserById
@@ -19,6 +19,9 @@ type MockServer struct {
 	handlers map[string]MethodHandler            // "Service.Method" -> handler
 	nextID   map[string]int64
 	hooks    *MockHooks
+
+	expectMu     sync.Mutex
+	expectations []*Expectation
 }
 
 // MethodHandler handles a single RPC method.
@@ -76,6 +79,16 @@ func (s *MockServer) Call(ctx context.Context, service, method string, req map[s
 		s.hooks.BeforeCall(service, method, req)
 	}
 
+	// Scripted expectations take precedence over handlers
+	if e := s.findExpectation(service, method, req); e != nil {
+		if answered, resp, err := e.apply(ctx); answered {
+			if s.hooks.AfterCall != nil {
+				s.hooks.AfterCall(service, method, req, resp, err)
+			}
+			return resp, err
+		}
+	}
+
 	// Find handler
 	handler, ok := s.handlers[key]
 	if !ok {
@@ -6,8 +6,10 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ha1tch/tgpiler/storage"
+	"github.com/ha1tch/tgpiler/transpiler"
 )
 
 // Sample proto content for testing
@@ -391,6 +393,73 @@ func TestMockServer_CustomHandler(t *testing.T) {
 	}
 }
 
+func TestMockServer_Expectations(t *testing.T) {
+	parser := NewParser()
+	pf, _ := parser.Parse(strings.NewReader(testProto), "test.proto")
+	result := storage.NewProtoParseResult([]storage.ProtoFile{*pf})
+
+	server := NewMockServer(result)
+	server.SeedData("Product", []map[string]interface{}{
+		{"id": int64(1), "name": "Widget"},
+	})
+	ctx := context.Background()
+
+	// Fail twice for id 1, then fall through to the default handler
+	server.On("CatalogService.GetProduct").
+		WithRequest(map[string]interface{}{"id": int64(1)}).
+		ReturnError(CodeUnavailable, "catalog offline").
+		Times(2)
+	// Scripted response for id 2, on any service
+	server.On("GetProduct").
+		WithRequestMatching(func(req map[string]interface{}) bool { return req["id"] == int64(2) }).
+		Return(map[string]interface{}{"name": "Scripted"}, nil)
+
+	for i := 0; i < 2; i++ {
+		_, err := server.Call(ctx, "CatalogService", "GetProduct", map[string]interface{}{"id": int64(1)})
+		mockErr, ok := err.(*MockError)
+		if !ok || mockErr.Code != CodeUnavailable {
+			t.Fatalf("call %d: expected Unavailable MockError, got %v", i+1, err)
+		}
+	}
+	if err := server.ExpectationsMet(); err != nil {
+		t.Errorf("ExpectationsMet: %v", err)
+	}
+	if _, err := server.Call(ctx, "CatalogService", "GetProduct", map[string]interface{}{"id": int64(1)}); err != nil {
+		t.Errorf("third call should reach the handler, got %v", err)
+	}
+
+	resp, err := server.Call(ctx, "CatalogService", "GetProduct", map[string]interface{}{"id": int64(2)})
+	if err != nil || resp["name"] != "Scripted" {
+		t.Errorf("expected scripted response, got %v, %v", resp, err)
+	}
+
+	// Unmet expectations are reported
+	server.On("CatalogService.DeleteProduct").Once()
+	if err := server.ExpectationsMet(); err == nil || !strings.Contains(err.Error(), "CatalogService.DeleteProduct: called 0 of 1 times") {
+		t.Errorf("expected unmet DeleteProduct, got %v", err)
+	}
+	server.ClearExpectations()
+
+	// Latency alone delays the handler; a cancelled context cuts it short
+	e := server.On("CatalogService.GetProduct").WithLatency(20 * time.Millisecond)
+	start := time.Now()
+	if _, err := server.Call(ctx, "CatalogService", "GetProduct", map[string]interface{}{"id": int64(1)}); err != nil {
+		t.Errorf("delayed call failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("expected at least 20ms latency, got %v", elapsed)
+	}
+	e.WithLatency(time.Hour)
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := server.Call(cctx, "CatalogService", "GetProduct", map[string]interface{}{"id": int64(1)}); err != context.DeadlineExceeded {
+		t.Errorf("expected DeadlineExceeded, got %v", err)
+	}
+	if e.Calls() != 2 {
+		t.Errorf("expected 2 calls, got %d", e.Calls())
+	}
+}
+
 func TestServerGenerator_GenerateService(t *testing.T) {
 	parser := NewParser()
 	pf, _ := parser.Parse(strings.NewReader(testProto), "test.proto")
@@ -617,3 +686,62 @@ func BenchmarkParser_Parse(b *testing.B) {
 		parser.Parse(strings.NewReader(testProto), "test.proto")
 	}
 }
+
+func TestEnumFields(t *testing.T) {
+	enumProto := `
+syntax = "proto3";
+package orders.v1;
+
+enum OrderStatus {
+  ORDER_STATUS_UNSPECIFIED = 0;
+  ORDER_STATUS_PENDING = 1;
+  ORDER_STATUS_CONFIRMED = 2;
+  ORDER_STATUS_SHIPPED = 3;
+}
+
+message Order {
+  int64 order_id = 1;
+  OrderStatus status = 2;
+}
+
+message UpdateOrderStatusRequest {
+  int64 order_id = 1;
+  OrderStatus status = 2;
+}
+`
+	parser := NewParser()
+	pf, err := parser.Parse(strings.NewReader(enumProto), "orders.proto")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	fields, err := EnumFields(storage.NewProtoParseResult([]storage.ProtoFile{*pf}), `OrderStatus:
+  'Approved': CONFIRMED
+  9: ORDER_STATUS_SHIPPED
+`)
+	if err != nil {
+		t.Fatalf("EnumFields failed: %v", err)
+	}
+
+	enum := fields[transpiler.EnumFieldKey("UpdateOrderStatusRequest", "Status")]
+	if enum == nil {
+		t.Fatalf("UpdateOrderStatusRequest.status not found in %v", fields)
+	}
+	if fields[transpiler.EnumFieldKey("", "status")] != enum {
+		t.Error("status should be found by name alone")
+	}
+	for literal, want := range map[string]string{
+		transpiler.EnumKey("Pending"):              "OrderStatus_ORDER_STATUS_PENDING",
+		transpiler.EnumKey("order_status_shipped"): "OrderStatus_ORDER_STATUS_SHIPPED",
+		transpiler.EnumKey("Approved"):             "OrderStatus_ORDER_STATUS_CONFIRMED",
+		"2":                                        "OrderStatus_ORDER_STATUS_CONFIRMED",
+		"9":                                        "OrderStatus_ORDER_STATUS_SHIPPED",
+	} {
+		if got := enum.Values[literal]; got != want {
+			t.Errorf("%s: expected %s, got %q", literal, want, got)
+		}
+	}
+
+	if _, err := EnumFields(storage.NewProtoParseResult([]storage.ProtoFile{*pf}), "OrderStatus:\n  'Lost': LOST\n"); err == nil {
+		t.Error("expected an error for an override to a value the enum doesn't have")
+	}
+}
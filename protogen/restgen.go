@@ -0,0 +1,520 @@
+package protogen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"io"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/ha1tch/tgpiler/transpiler"
+)
+
+// ============================================================================
+// REST Generator
+// ============================================================================
+
+// RESTGenerator generates net/http JSON handlers and an OpenAPI 3 spec from
+// procedure contracts. Each procedure becomes a POST endpoint that decodes
+// its input parameters, calls the repository method generated by --dml and
+// encodes the OUTPUT parameters and return code. With ProcedureCall it calls
+// the wrappers of --backend=procedure-call instead, which also return the
+// procedure's result sets, encoded as arrays of rows.
+type RESTGenerator struct {
+	contracts []transpiler.ProcedureContract
+	opts      RESTGenOptions
+}
+
+// RESTGenOptions configures REST generation.
+type RESTGenOptions struct {
+	PackageName string // Go package name for generated code
+	BasePath    string // Path prefix for every endpoint (e.g. "/api")
+	Title       string // OpenAPI info.title
+	Version     string // OpenAPI info.version
+
+	Router        string // RouterMux (http.ServeMux) or RouterChi; empty is RouterMux
+	ProcedureCall bool   // Call the wrappers of --backend=procedure-call, returning result sets
+}
+
+// Routers the handlers can be registered with.
+const (
+	RouterMux = "mux" // net/http ServeMux
+	RouterChi = "chi" // github.com/go-chi/chi/v5
+)
+
+// DefaultRESTGenOptions returns sensible defaults.
+func DefaultRESTGenOptions() RESTGenOptions {
+	return RESTGenOptions{
+		PackageName: "api",
+		Title:       "tgpiler generated API",
+		Version:     "1.0.0",
+	}
+}
+
+// NewRESTGenerator creates a REST generator.
+func NewRESTGenerator(contracts []transpiler.ProcedureContract, opts RESTGenOptions) *RESTGenerator {
+	if opts.PackageName == "" {
+		opts.PackageName = "api"
+	}
+	opts.BasePath = strings.TrimSuffix(opts.BasePath, "/")
+	return &RESTGenerator{contracts: contracts, opts: opts}
+}
+
+// GenerateHandlers writes the Go handler code.
+func (g *RESTGenerator) GenerateHandlers(w io.Writer) error {
+	data := restTemplateData{PackageName: g.opts.PackageName, Chi: g.opts.Router == RouterChi}
+	imports := map[string]bool{
+		"context":       true,
+		"encoding/json": true,
+		"errors":        true,
+		"io":            true,
+		"net/http":      true,
+	}
+	if data.Chi {
+		imports["github.com/go-chi/chi/v5"] = true
+	}
+
+	for _, c := range g.contracts {
+		ep := restEndpointData{
+			Name:         c.GoName,
+			Path:         g.endpointPath(c),
+			ReturnCode:   c.ReturnCode,
+			ReturnsError: c.ReturnsError,
+		}
+		if g.opts.ProcedureCall {
+			// Wrappers always return the return code and an error
+			ep.StoreReturnCode = true
+			ep.ReturnsError = true
+			for i := range c.ResultSets {
+				rs := restResultSetData{Field: "Rows", Param: "rows", JSON: "rows", Type: c.RowType(i)}
+				if len(c.ResultSets) > 1 {
+					n := fmt.Sprint(i + 1)
+					rs.Field, rs.Param, rs.JSON = rs.Field+n, rs.Param+n, rs.JSON+n
+				}
+				ep.ResultSets = append(ep.ResultSets, rs)
+			}
+		}
+		ep.StoreReturnCode = ep.StoreReturnCode || ep.ReturnCode
+		for _, p := range c.Inputs {
+			ep.Inputs = append(ep.Inputs, restFieldFor(p))
+			addTypeImport(imports, p.GoType)
+		}
+		for _, p := range c.Outputs {
+			ep.Outputs = append(ep.Outputs, restFieldFor(p))
+			addTypeImport(imports, p.GoType)
+		}
+		ep.Results = restCallResults(ep)
+		data.Endpoints = append(data.Endpoints, ep)
+	}
+	for imp := range imports {
+		if strings.Contains(imp, ".") {
+			data.ThirdPartyImports = append(data.ThirdPartyImports, imp)
+		} else {
+			data.Imports = append(data.Imports, imp)
+		}
+	}
+	sort.Strings(data.Imports)
+	sort.Strings(data.ThirdPartyImports)
+
+	var buf bytes.Buffer
+	if err := restTemplate.Execute(&buf, data); err != nil {
+		return err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("formatting generated handlers: %w", err)
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+// GenerateOpenAPI writes the OpenAPI 3 spec as JSON.
+func (g *RESTGenerator) GenerateOpenAPI(w io.Writer) error {
+	spec := openAPIDoc{
+		OpenAPI: "3.0.3",
+		Info:    openAPIInfo{Title: g.opts.Title, Version: g.opts.Version},
+		Paths:   map[string]openAPIPath{},
+		Components: openAPIComponents{Schemas: map[string]*openAPISchema{
+			"Error": {
+				Type:       "object",
+				Properties: map[string]*openAPISchema{"error": {Type: "string"}},
+			},
+		}},
+	}
+
+	for _, c := range g.contracts {
+		reqName, respName := c.GoName+"Request", c.GoName+"Response"
+		spec.Components.Schemas[reqName] = requestSchema(c.Inputs)
+		resp := responseSchema(c.Outputs, c.ReturnCode)
+		if g.opts.ProcedureCall {
+			for i, rs := range c.ResultSets {
+				rowName, prop := c.RowType(i), "rows"
+				if len(c.ResultSets) > 1 {
+					prop += fmt.Sprint(i + 1)
+				}
+				spec.Components.Schemas[rowName] = rowSchema(rs)
+				resp.Properties[prop] = &openAPISchema{Type: "array", Items: &openAPISchema{Ref: "#/components/schemas/" + rowName}}
+				resp.Required = append(resp.Required, prop)
+			}
+		}
+		spec.Components.Schemas[respName] = resp
+
+		op := &openAPIOperation{
+			OperationID: c.GoName,
+			Summary:     "Calls stored procedure " + c.Name,
+			RequestBody: &openAPIRequestBody{
+				Required: true,
+				Content:  jsonContent(reqName),
+			},
+			Responses: map[string]openAPIResponse{
+				"200": {Description: "Procedure completed", Content: jsonContent(respName)},
+				"400": {Description: "Invalid request body", Content: jsonContent("Error")},
+				"500": {Description: "Procedure failed", Content: jsonContent("Error")},
+			},
+		}
+		spec.Paths[g.endpointPath(c)] = openAPIPath{Post: op}
+	}
+
+	data, err := json.MarshalIndent(spec, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// endpointPath derives the URL path from the Go method name:
+// GetCustomerOrders -> /get-customer-orders.
+func (g *RESTGenerator) endpointPath(c transpiler.ProcedureContract) string {
+	var b strings.Builder
+	runes := []rune(c.GoName)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			prevLower := i > 0 && !unicode.IsUpper(runes[i-1])
+			nextLower := i > 0 && i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if prevLower || nextLower {
+				b.WriteByte('-')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return g.opts.BasePath + "/" + strings.TrimPrefix(b.String(), "-")
+}
+
+type restTemplateData struct {
+	PackageName       string
+	Chi               bool
+	Imports           []string
+	ThirdPartyImports []string
+	Endpoints         []restEndpointData
+}
+
+type restEndpointData struct {
+	Name            string
+	Path            string
+	Inputs          []restFieldData
+	Outputs         []restFieldData
+	ResultSets      []restResultSetData
+	ReturnCode      bool // The response has the return code
+	StoreReturnCode bool // The store method returns one
+	ReturnsError    bool
+	Results         string // Left-hand side of the store call, empty if it returns nothing
+}
+
+// restResultSetData is a result set returned by a procedure-call wrapper.
+type restResultSetData struct {
+	Field string // Response struct field
+	Param string // Result name in the wrapper
+	Type  string // Row struct
+	JSON  string
+}
+
+type restFieldData struct {
+	Field  string // Exported struct field
+	Param  string // Parameter name in the repository method
+	GoType string
+	JSON   string
+}
+
+func restFieldFor(p transpiler.ContractParam) restFieldData {
+	return restFieldData{
+		Field:  exportedName(p.GoName),
+		Param:  p.GoName,
+		GoType: p.GoType,
+		JSON:   p.GoName,
+	}
+}
+
+// restCallResults builds the assignment targets for the store call, in the
+// order the generated repository method returns them.
+func restCallResults(ep restEndpointData) string {
+	var targets []string
+	for _, rs := range ep.ResultSets {
+		targets = append(targets, "resp."+rs.Field)
+	}
+	for _, o := range ep.Outputs {
+		targets = append(targets, "resp."+o.Field)
+	}
+	if ep.ReturnCode {
+		targets = append(targets, "resp.ReturnCode")
+	} else if ep.StoreReturnCode {
+		targets = append(targets, "_")
+	}
+	if ep.ReturnsError {
+		targets = append(targets, "err")
+	}
+	return strings.Join(targets, ", ")
+}
+
+func exportedName(s string) string {
+	if s == "" {
+		return s
+	}
+	r := []rune(s)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
+
+func addTypeImport(imports map[string]bool, goType string) {
+	switch {
+	case strings.HasPrefix(goType, "decimal."):
+		imports["github.com/shopspring/decimal"] = true
+	case strings.HasPrefix(goType, "time."):
+		imports["time"] = true
+	}
+}
+
+var restTemplate = template.Must(template.New("rest").Parse(`// Code generated by tgpiler. DO NOT EDIT.
+
+package {{.PackageName}}
+
+import (
+{{- range .Imports}}
+	"{{.}}"
+{{- end}}
+{{- if .ThirdPartyImports}}
+{{range .ThirdPartyImports}}
+	"{{.}}"
+{{- end}}
+{{- end}}
+)
+
+// RESTStore is the repository the handlers call. The *Repository generated
+// by tgpiler --dml satisfies it.
+type RESTStore interface {
+{{- range .Endpoints}}
+	{{.Name}}(ctx context.Context{{range .Inputs}}, {{.Param}} {{.GoType}}{{end}}) ({{range .ResultSets}}{{.Param}} []{{.Type}}, {{end}}{{range .Outputs}}{{.Param}} {{.GoType}}, {{end}}{{if .StoreReturnCode}}returnCode int32, {{end}}{{if .ReturnsError}}err error{{end}})
+{{- end}}
+}
+
+// RESTHandler exposes each procedure as a JSON POST endpoint.
+type RESTHandler struct {
+	Store RESTStore
+}
+
+// NewRESTHandler creates a RESTHandler.
+func NewRESTHandler(store RESTStore) *RESTHandler {
+	return &RESTHandler{Store: store}
+}
+
+{{- if .Chi}}
+// Register adds every endpoint to r.
+func (h *RESTHandler) Register(r chi.Router) {
+{{- range .Endpoints}}
+	r.Post("{{.Path}}", h.{{.Name}})
+{{- end}}
+}
+{{- else}}
+// Register adds every endpoint to mux.
+func (h *RESTHandler) Register(mux *http.ServeMux) {
+{{- range .Endpoints}}
+	mux.HandleFunc("{{.Path}}", h.{{.Name}})
+{{- end}}
+}
+{{- end}}
+{{range .Endpoints}}
+// {{.Name}}Request is the request body for {{.Path}}.
+type {{.Name}}Request struct {
+{{- range .Inputs}}
+	{{.Field}} {{.GoType}} ` + "`json:\"{{.JSON}}\"`" + `
+{{- end}}
+}
+
+// {{.Name}}Response is the response body for {{.Path}}.
+type {{.Name}}Response struct {
+{{- range .ResultSets}}
+	{{.Field}} []{{.Type}} ` + "`json:\"{{.JSON}}\"`" + `
+{{- end}}
+{{- range .Outputs}}
+	{{.Field}} {{.GoType}} ` + "`json:\"{{.JSON}}\"`" + `
+{{- end}}
+{{- if .ReturnCode}}
+	ReturnCode int32 ` + "`json:\"returnCode\"`" + `
+{{- end}}
+}
+
+// {{.Name}} handles POST {{.Path}}.
+func (h *RESTHandler) {{.Name}}(w http.ResponseWriter, r *http.Request) {
+	{{- if not $.Chi}}
+	if r.Method != http.MethodPost {
+		writeRESTError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	{{- end}}
+	var req {{.Name}}Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeRESTError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var resp {{.Name}}Response
+	{{- if .ReturnsError}}
+	var err error
+	{{- end}}
+	{{if .Results}}{{.Results}} = {{end}}h.Store.{{.Name}}(r.Context(){{range .Inputs}}, req.{{.Field}}{{end}})
+	{{- if .ReturnsError}}
+	if err != nil {
+		writeRESTError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	{{- end}}
+	writeRESTJSON(w, http.StatusOK, resp)
+}
+{{end}}
+func writeRESTJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeRESTError(w http.ResponseWriter, status int, msg string) {
+	writeRESTJSON(w, status, map[string]string{"error": msg})
+}
+`))
+
+// OpenAPI document model. Only the subset needed for the generated spec.
+
+type openAPIDoc struct {
+	OpenAPI    string                 `json:"openapi"`
+	Info       openAPIInfo            `json:"info"`
+	Paths      map[string]openAPIPath `json:"paths"`
+	Components openAPIComponents      `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type openAPIPath struct {
+	Post *openAPIOperation `json:"post,omitempty"`
+}
+
+type openAPIOperation struct {
+	OperationID string                     `json:"operationId"`
+	Summary     string                     `json:"summary,omitempty"`
+	RequestBody *openAPIRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]openAPIResponse `json:"responses"`
+}
+
+type openAPIRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]openAPIMediaType `json:"content"`
+}
+
+type openAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIMediaType struct {
+	Schema *openAPISchema `json:"schema"`
+}
+
+type openAPIComponents struct {
+	Schemas map[string]*openAPISchema `json:"schemas"`
+}
+
+type openAPISchema struct {
+	Ref        string                    `json:"$ref,omitempty"`
+	Type       string                    `json:"type,omitempty"`
+	Format     string                    `json:"format,omitempty"`
+	Properties map[string]*openAPISchema `json:"properties,omitempty"`
+	Items      *openAPISchema            `json:"items,omitempty"`
+	Required   []string                  `json:"required,omitempty"`
+}
+
+func jsonContent(schemaName string) map[string]openAPIMediaType {
+	return map[string]openAPIMediaType{
+		"application/json": {Schema: &openAPISchema{Ref: "#/components/schemas/" + schemaName}},
+	}
+}
+
+// requestSchema builds the request body schema. Inputs without a default
+// value are required.
+func requestSchema(params []transpiler.ContractParam) *openAPISchema {
+	s := &openAPISchema{Type: "object", Properties: map[string]*openAPISchema{}}
+	for _, p := range params {
+		s.Properties[p.GoName] = goTypeSchema(p.GoType)
+		if p.Default == "" {
+			s.Required = append(s.Required, p.GoName)
+		}
+	}
+	return s
+}
+
+// responseSchema builds the response body schema. Every field is always
+// present in the response.
+func responseSchema(params []transpiler.ContractParam, returnCode bool) *openAPISchema {
+	s := &openAPISchema{Type: "object", Properties: map[string]*openAPISchema{}}
+	for _, p := range params {
+		s.Properties[p.GoName] = goTypeSchema(p.GoType)
+		s.Required = append(s.Required, p.GoName)
+	}
+	if returnCode {
+		s.Properties["returnCode"] = goTypeSchema("int32")
+		s.Required = append(s.Required, "returnCode")
+	}
+	return s
+}
+
+// rowSchema builds the schema of a row of a result set, keyed by the
+// fields of its row struct, which has no JSON tags.
+func rowSchema(rs transpiler.ContractResultSet) *openAPISchema {
+	s := &openAPISchema{Type: "object", Properties: map[string]*openAPISchema{}}
+	for i, field := range rs.Fields() {
+		s.Properties[field] = goTypeSchema(rs.Columns[i].GoType)
+		s.Required = append(s.Required, field)
+	}
+	return s
+}
+
+// goTypeSchema maps a transpiled Go type to an OpenAPI schema. Decimals
+// marshal as JSON strings to preserve precision.
+func goTypeSchema(goType string) *openAPISchema {
+	switch goType {
+	case "int32", "int16", "uint8":
+		return &openAPISchema{Type: "integer", Format: "int32"}
+	case "int64", "int":
+		return &openAPISchema{Type: "integer", Format: "int64"}
+	case "float32":
+		return &openAPISchema{Type: "number", Format: "float"}
+	case "float64":
+		return &openAPISchema{Type: "number", Format: "double"}
+	case "decimal.Decimal":
+		return &openAPISchema{Type: "string", Format: "decimal"}
+	case "bool":
+		return &openAPISchema{Type: "boolean"}
+	case "time.Time":
+		return &openAPISchema{Type: "string", Format: "date-time"}
+	case "[]byte":
+		return &openAPISchema{Type: "string", Format: "byte"}
+	case "string":
+		return &openAPISchema{Type: "string"}
+	default:
+		return &openAPISchema{}
+	}
+}
@@ -0,0 +1,177 @@
+package protogen
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ha1tch/tgpiler/transpiler"
+)
+
+const restTestSQL = `
+CREATE PROCEDURE dbo.GetCustomerOrders
+    @CustomerID INT,
+    @MinTotal DECIMAL(18,2) = 0,
+    @OrderCount INT OUTPUT
+AS
+BEGIN
+    SET @OrderCount = 1
+    SELECT OrderID, Total FROM Orders WHERE CustomerID = @CustomerID
+    RETURN 0
+END
+GO
+CREATE PROCEDURE dbo.Ping
+AS
+BEGIN
+    DECLARE @x INT
+    SET @x = 1
+END
+`
+
+func restTestContracts(t *testing.T) []transpiler.ProcedureContract {
+	t.Helper()
+	contracts, err := transpiler.ExtractContracts(restTestSQL, transpiler.DefaultDMLConfig())
+	if err != nil {
+		t.Fatalf("ExtractContracts failed: %v", err)
+	}
+	if len(contracts) != 2 {
+		t.Fatalf("expected 2 contracts, got %d", len(contracts))
+	}
+	return contracts
+}
+
+func TestRESTGenerator_GenerateHandlers(t *testing.T) {
+	opts := DefaultRESTGenOptions()
+	opts.PackageName = "api"
+	opts.BasePath = "/v1/"
+	gen := NewRESTGenerator(restTestContracts(t), opts)
+
+	var buf bytes.Buffer
+	if err := gen.GenerateHandlers(&buf); err != nil {
+		t.Fatalf("GenerateHandlers failed: %v", err)
+	}
+	output := buf.String()
+
+	expected := []string{
+		"package api",
+		"Code generated by tgpiler",
+		`"github.com/shopspring/decimal"`,
+		// Store method signatures mirror the generated repository
+		"GetCustomerOrders(ctx context.Context, customerId int32, minTotal decimal.Decimal) (orderCount int32, returnCode int32, err error)",
+		"Ping(ctx context.Context)",
+		`mux.HandleFunc("/v1/get-customer-orders", h.GetCustomerOrders)`,
+		`MinTotal   decimal.Decimal ` + "`json:\"minTotal\"`",
+		`ReturnCode int32 ` + "`json:\"returnCode\"`",
+		"resp.OrderCount, resp.ReturnCode, err = h.Store.GetCustomerOrders(r.Context(), req.CustomerId, req.MinTotal)",
+		"h.Store.Ping(r.Context())",
+	}
+	for _, want := range expected {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected %q in output:\n%s", want, output)
+		}
+	}
+}
+
+func TestRESTGenerator_GenerateOpenAPI(t *testing.T) {
+	gen := NewRESTGenerator(restTestContracts(t), DefaultRESTGenOptions())
+
+	var buf bytes.Buffer
+	if err := gen.GenerateOpenAPI(&buf); err != nil {
+		t.Fatalf("GenerateOpenAPI failed: %v", err)
+	}
+
+	var spec openAPIDoc
+	if err := json.Unmarshal(buf.Bytes(), &spec); err != nil {
+		t.Fatalf("spec is not valid JSON: %v", err)
+	}
+	if spec.OpenAPI != "3.0.3" {
+		t.Errorf("openapi = %q", spec.OpenAPI)
+	}
+	path, ok := spec.Paths["/get-customer-orders"]
+	if !ok || path.Post == nil {
+		t.Fatalf("missing POST /get-customer-orders: %v", spec.Paths)
+	}
+	if path.Post.OperationID != "GetCustomerOrders" {
+		t.Errorf("operationId = %q", path.Post.OperationID)
+	}
+
+	req := spec.Components.Schemas["GetCustomerOrdersRequest"]
+	if req == nil {
+		t.Fatal("missing request schema")
+	}
+	if got := req.Properties["minTotal"]; got == nil || got.Type != "string" || got.Format != "decimal" {
+		t.Errorf("minTotal schema = %+v", got)
+	}
+	// @MinTotal has a default, so only @CustomerID is required
+	if len(req.Required) != 1 || req.Required[0] != "customerId" {
+		t.Errorf("required = %v", req.Required)
+	}
+
+	resp := spec.Components.Schemas["GetCustomerOrdersResponse"]
+	if resp == nil || resp.Properties["returnCode"] == nil || resp.Properties["orderCount"] == nil {
+		t.Errorf("response schema = %+v", resp)
+	}
+}
+
+func TestRESTGenerator_ProcedureCall(t *testing.T) {
+	opts := DefaultRESTGenOptions()
+	opts.Router = RouterChi
+	opts.ProcedureCall = true
+	gen := NewRESTGenerator(restTestContracts(t), opts)
+
+	var buf bytes.Buffer
+	if err := gen.GenerateHandlers(&buf); err != nil {
+		t.Fatalf("GenerateHandlers failed: %v", err)
+	}
+	output := buf.String()
+	expected := []string{
+		`"github.com/go-chi/chi/v5"`,
+		"func (h *RESTHandler) Register(r chi.Router) {",
+		`r.Post("/get-customer-orders", h.GetCustomerOrders)`,
+		// Wrappers return the result set first and always a return code and an error
+		"GetCustomerOrders(ctx context.Context, customerId int32, minTotal decimal.Decimal) (rows []GetCustomerOrdersRow, orderCount int32, returnCode int32, err error)",
+		"Ping(ctx context.Context) (returnCode int32, err error)",
+		"Rows       []GetCustomerOrdersRow `json:\"rows\"`",
+		"resp.Rows, resp.OrderCount, resp.ReturnCode, err = h.Store.GetCustomerOrders(r.Context(), req.CustomerId, req.MinTotal)",
+		"_, err = h.Store.Ping(r.Context())",
+	}
+	for _, want := range expected {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected %q in output:\n%s", want, output)
+		}
+	}
+	if strings.Contains(output, "http.MethodPost") {
+		t.Errorf("expected chi to check the method, got:\n%s", output)
+	}
+
+	buf.Reset()
+	if err := gen.GenerateOpenAPI(&buf); err != nil {
+		t.Fatalf("GenerateOpenAPI failed: %v", err)
+	}
+	var spec openAPIDoc
+	if err := json.Unmarshal(buf.Bytes(), &spec); err != nil {
+		t.Fatalf("spec is not valid JSON: %v", err)
+	}
+	rows := spec.Components.Schemas["GetCustomerOrdersResponse"].Properties["rows"]
+	if rows == nil || rows.Type != "array" || rows.Items == nil || rows.Items.Ref != "#/components/schemas/GetCustomerOrdersRow" {
+		t.Errorf("rows schema = %+v", rows)
+	}
+	if row := spec.Components.Schemas["GetCustomerOrdersRow"]; row == nil || row.Properties["OrderId"] == nil {
+		t.Errorf("row schema = %+v", row)
+	}
+}
+
+func TestRESTGenerator_EndpointPath(t *testing.T) {
+	gen := NewRESTGenerator(nil, DefaultRESTGenOptions())
+	tests := map[string]string{
+		"GetCustomerOrders": "/get-customer-orders",
+		"Ping":              "/ping",
+		"ImportCSVFile":     "/import-csv-file",
+	}
+	for goName, want := range tests {
+		if got := gen.endpointPath(transpiler.ProcedureContract{GoName: goName}); got != want {
+			t.Errorf("endpointPath(%s) = %q, want %q", goName, got, want)
+		}
+	}
+}
@@ -1,5 +1,10 @@
 package storage
 
+import (
+	"strings"
+	"unicode"
+)
+
 // Detector analyzes T-SQL AST to extract data operations.
 // The proc parameter is *ast.CreateProcedure from tsqlparser.
 type Detector interface {
@@ -328,21 +333,20 @@ func GenerateMethodName(pattern SelectPattern, info *SelectInfo) string {
 
 // toPascalCase converts snake_case to PascalCase.
 func toPascalCase(s string) string {
-	result := make([]byte, 0, len(s))
+	var result strings.Builder
 	capitalizeNext := true
 	
-	for i := 0; i < len(s); i++ {
-		c := s[i]
+	for _, c := range s {
 		if c == '_' {
 			capitalizeNext = true
 			continue
 		}
-		if capitalizeNext && c >= 'a' && c <= 'z' {
-			c -= 'a' - 'A'
+		if capitalizeNext {
+			c = unicode.ToUpper(c)
 		}
 		capitalizeNext = false
-		result = append(result, c)
+		result.WriteRune(c)
 	}
 	
-	return string(result)
+	return result.String()
 }
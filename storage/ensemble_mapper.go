@@ -1,7 +1,9 @@
 package storage
 
 import (
+	"fmt"
 	"regexp"
+	"sort"
 	"strings"
 )
 
@@ -16,6 +18,7 @@ type MatchContext struct {
 	ServiceName   string
 	AllMessages   map[string]*ProtoMessageInfo
 	AllProcedures []*Procedure
+	Verbs         []string // Verbs of procedure and method names; nil for knownVerbs
 }
 
 // StrategyResult is the output of a single strategy.
@@ -32,6 +35,8 @@ type EnsembleMapper struct {
 	procedures []*Procedure
 	strategies []MatchStrategy
 	mappings   map[string]*MethodMapping
+	verbs      []string
+	weights    map[string]float64 // By strategy name; 1 if absent
 }
 
 // NewEnsembleMapper creates a mapper with all available strategies.
@@ -44,11 +49,63 @@ func NewEnsembleMapper(proto *ProtoParseResult, procedures []*Procedure) *Ensemb
 			&DMLTableStrategy{},
 			&ParameterSignatureStrategy{},
 			&VerbEntityStrategy{},
+			&TypeSignatureStrategy{},
 		},
 		mappings: make(map[string]*MethodMapping),
 	}
 }
 
+// SetVerbs adds verbs to those recognised in procedure and method names,
+// ahead of the known ones, and removes others, as a verbs file does for
+// the transpiler.
+func (m *EnsembleMapper) SetVerbs(add, remove []string) {
+	removed := map[string]bool{}
+	for _, v := range remove {
+		removed[strings.ToLower(v)] = true
+	}
+	m.verbs = []string{}
+	for _, v := range append(append([]string{}, add...), knownVerbs...) {
+		if !removed[strings.ToLower(v)] {
+			m.verbs = append(m.verbs, v)
+		}
+	}
+}
+
+// SetWeights weights the strategies, by name, in the confidence of a
+// mapping: 2 counts a strategy twice, 0 leaves it out. Strategies not
+// named keep a weight of 1.
+func (m *EnsembleMapper) SetWeights(weights map[string]float64) error {
+	names := m.StrategyNames()
+	for name, w := range weights {
+		i := sort.SearchStrings(names, name)
+		if i == len(names) || names[i] != name {
+			return fmt.Errorf("unknown strategy %q (valid: %s)", name, strings.Join(names, ", "))
+		}
+		if w < 0 {
+			return fmt.Errorf("%s: weight %g is negative", name, w)
+		}
+	}
+	m.weights = weights
+	return nil
+}
+
+// StrategyNames returns the names of the strategies, sorted.
+func (m *EnsembleMapper) StrategyNames() []string {
+	var names []string
+	for _, s := range m.strategies {
+		names = append(names, s.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (m *EnsembleMapper) weight(strategy string) float64 {
+	if w, ok := m.weights[strategy]; ok {
+		return w
+	}
+	return 1
+}
+
 // MapAll maps all proto methods using ensemble of strategies.
 func (m *EnsembleMapper) MapAll() map[string]*MethodMapping {
 	for svcName, svc := range m.proto.AllServices {
@@ -56,6 +113,7 @@ func (m *EnsembleMapper) MapAll() map[string]*MethodMapping {
 			ServiceName:   svcName,
 			AllMessages:   m.proto.AllMessages,
 			AllProcedures: m.procedures,
+			Verbs:         m.verbs,
 		}
 
 		for _, method := range svc.Methods {
@@ -89,13 +147,17 @@ func (m *EnsembleMapper) mapMethodEnsemble(serviceName string, method *ProtoMeth
 		}
 
 		for _, strategy := range m.strategies {
+			weight := m.weight(strategy.Name())
+			if weight == 0 {
+				continue
+			}
 			result := strategy.Match(method, proc, ctx)
 			if result != nil && result.Matched {
 				ps.strategyVotes[strategy.Name()] = result
 				
-				// Weight by strategy confidence
-				ps.totalScore += result.Score * result.Confidence
-				ps.totalWeight += result.Confidence
+				// Weight by strategy confidence and the weight set
+				ps.totalScore += result.Score * result.Confidence * weight
+				ps.totalWeight += result.Confidence * weight
 				ps.agreement++
 				
 				// Track if naming gave a high score (exact/verb match)
@@ -117,7 +179,12 @@ func (m *EnsembleMapper) mapMethodEnsemble(serviceName string, method *ProtoMeth
 	var bestFinalScore float64
 
 	// Total number of strategies available
-	numStrategies := len(m.strategies)
+	numStrategies := 0
+	for _, strategy := range m.strategies {
+		if m.weight(strategy.Name()) > 0 {
+			numStrategies++
+		}
+	}
 
 	for _, ps := range scores {
 		if ps.totalWeight == 0 {
@@ -298,7 +365,7 @@ func (m *EnsembleMapper) computeTieBreakScore(method *ProtoMethodInfo, proc *Pro
 	score += nameSpec * 0.20
 
 	// 4. Entity-table alignment (weight: 0.20)
-	_, methodEntity := parseVerbEntity(method.Name)
+	_, methodEntity := ctx.parseVerbEntity(method.Name)
 	if methodEntity != "" {
 		methodEntityLower := strings.ToLower(methodEntity)
 		entityScore := 0.3 // Default if no match
@@ -817,7 +884,7 @@ func (s *VerbEntityStrategy) Name() string { return "verb_entity" }
 
 func (s *VerbEntityStrategy) Match(method *ProtoMethodInfo, proc *Procedure, ctx *MatchContext) *StrategyResult {
 	// Parse method into verb + entity
-	methodVerb, methodEntity := parseVerbEntity(method.Name)
+	methodVerb, methodEntity := ctx.parseVerbEntity(method.Name)
 	if methodVerb == "" || methodEntity == "" {
 		return nil
 	}
@@ -827,7 +894,7 @@ func (s *VerbEntityStrategy) Match(method *ProtoMethodInfo, proc *Procedure, ctx
 	for _, prefix := range []string{"usp_", "sp_", "proc_", "p_"} {
 		procName = strings.TrimPrefix(procName, prefix)
 	}
-	procVerb, procEntity := parseVerbEntity(procName)
+	procVerb, procEntity := ctx.parseVerbEntity(procName)
 	if procVerb == "" {
 		return nil
 	}
@@ -855,143 +922,158 @@ func (s *VerbEntityStrategy) Match(method *ProtoMethodInfo, proc *Procedure, ctx
 	}
 }
 
+// parseVerbEntity splits a procedure or method name into a known verb and
+// the entity it acts on.
 func parseVerbEntity(name string) (verb, entity string) {
-	// Known verb patterns (order matters - longer first for proper matching)
-	verbs := []string{
-		// Multi-word patterns first (longer matches before shorter)
-		"Authenticate", "Authorize", "IsValid", "Validate", "Calculate", "Generate",
-		"GetActive", "GetValid", "GetAvailable",
-		"CheckDatabase", "Healthcheck",
-		"CreateTransfer", "UpdateOrder",
-		"Regenerate", "Revalidate", "Reinitialize", "Reconfigure",
-
-		// CRUD operations
-		"Create", "Insert", "Add", "New", "Register", "Enroll", "Subscribe",
-		"Update", "Modify", "Edit", "Change", "Set", "Patch", "Amend",
-		"Delete", "Remove", "Drop", "Unsubscribe", "Deregister", "Purge",
-		"List", "GetAll", "FindAll", "Search", "Query", "Lookup",
-		"Get", "Fetch", "Find", "Load", "Retrieve", "Read", "Select",
+	return splitVerbEntity(name, knownVerbs)
+}
 
-		// Validation & verification
-		"Check", "Confirm", "Verify", "Test", "Validate",
+// parseVerbEntity is parseVerbEntity with the verbs of c.
+func (c *MatchContext) parseVerbEntity(name string) (verb, entity string) {
+	if c == nil || c.Verbs == nil {
+		return parseVerbEntity(name)
+	}
+	return splitVerbEntity(name, c.Verbs)
+}
 
-		// Transformation
-		"Convert", "Transform", "Translate", "Parse", "Serialize", "Deserialize",
-		"Encode", "Decode", "Encrypt", "Decrypt", "Compress", "Decompress",
-		"Normalize", "Format", "Sanitize", "Cleanse",
+func splitVerbEntity(name string, verbs []string) (verb, entity string) {
+	nameLower := strings.ToLower(name)
+	for _, v := range verbs {
+		vLower := strings.ToLower(v)
+		if strings.HasPrefix(nameLower, vLower) {
+			verb = v
+			entity = name[len(v):]
+			break
+		}
+	}
 
-		// Token/session operations
-		"Issue", "Reissue", "Rotate", "Refresh", "Renew", "Extend", "Prolong",
+	// Clean up entity
+	if entity != "" {
+		// Remove ById, ByEmail, etc suffixes
+		re := regexp.MustCompile(`(?i)(By\w+)$`)
+		entity = re.ReplaceAllString(entity, "")
+	}
 
-		// Generation & calculation
-		"Compute", "Estimate", "Forecast", "Project", "Calculate", "Calc",
-		"Generate", "Produce", "Build", "Render", "Compile",
-		"Aggregate", "Summarize", "Consolidate", "Merge", "Combine",
-		"Count", "Sum", "Average",
+	return verb, entity
+}
 
-		// Process & execution
-		"Process", "Execute", "Run", "Handle", "Perform", "Invoke",
-		"Batch", "Bulk", "Retry", "Rerun", "Reprocess", "Replay",
+// knownVerbs are the verbs of procedure and method names (order matters -
+// longer first for proper matching).
+var knownVerbs = []string{
+	// Multi-word patterns first (longer matches before shorter)
+	"Authenticate", "Authorize", "IsValid", "Validate", "Calculate", "Generate",
+	"GetActive", "GetValid", "GetAvailable",
+	"CheckDatabase", "Healthcheck",
+	"CreateTransfer", "UpdateOrder",
+	"Regenerate", "Revalidate", "Reinitialize", "Reconfigure",
 
-		// Communication
-		"Send", "Transmit", "Dispatch", "Deliver", "Forward", "Route",
-		"Receive", "Accept", "Collect",
-		"Notify", "Alert", "Warn", "Inform", "Remind", "Broadcast", "Publish",
-		"Email", "Print",
+	// CRUD operations
+	"Create", "Insert", "Add", "New", "Register", "Enroll", "Subscribe",
+	"Update", "Modify", "Edit", "Change", "Set", "Patch", "Amend",
+	"Delete", "Remove", "Drop", "Unsubscribe", "Deregister", "Purge",
+	"List", "GetAll", "FindAll", "Search", "Query", "Lookup",
+	"Get", "Fetch", "Find", "Load", "Retrieve", "Read", "Select",
 
-		// Resource management
-		"Reserve", "Hold", "Lock", "Allocate", "Claim", "Acquire",
-		"Release", "Free", "Unlock", "Deallocate", "Relinquish",
-		"Unclaim", "Take", "Pickup",
+	// Validation & verification
+	"Check", "Confirm", "Verify", "Test", "Validate",
 
-		// Lifecycle & state transitions
-		"Cancel", "Abort", "Revoke", "Void", "Annul", "Terminate",
-		"Suspend", "Pause", "Freeze", "Deactivate", "Disable", "Ban",
-		"Resume", "Reactivate", "Unfreeze", "Unpause", "Enable", "Activate", "Unban",
-		"Complete", "Finish", "Finalize", "Close", "Conclude", "End",
-		"Initiate", "Start", "Begin", "Open", "Launch", "Trigger",
-		"Expire", "Invalidate",
-		"Reset", "Initialize", "Configure", "Setup",
+	// Transformation
+	"Convert", "Transform", "Translate", "Parse", "Serialize", "Deserialize",
+	"Encode", "Decode", "Encrypt", "Decrypt", "Compress", "Decompress",
+	"Normalize", "Format", "Sanitize", "Cleanse",
 
-		// Approval workflow
-		"Approve", "Grant", "Allow", "Permit", "Sanction",
-		"Reject", "Deny", "Decline", "Refuse", "Disallow", "Veto",
-		"Certify", "Recertify", "Decertify", "Attest", "Endorse", "Accredit", "License",
-		"Review", "Assess", "Evaluate", "Inspect", "Audit", "Examine", "Appraise", "Moderate",
-		"Escalate", "Elevate", "Refer", "Delegate", "Reassign", "Transfer",
-		"Submit", "Propose", "Request",
+	// Token/session operations
+	"Issue", "Reissue", "Rotate", "Refresh", "Renew", "Extend", "Prolong",
 
-		// Acknowledgment & signing
-		"Acknowledge", "Receipt",
-		"Sign", "Countersign", "Cosign", "Seal", "Notarize",
+	// Generation & calculation
+	"Compute", "Estimate", "Forecast", "Project", "Calculate", "Calc",
+	"Generate", "Produce", "Build", "Render", "Compile",
+	"Aggregate", "Summarize", "Consolidate", "Merge", "Combine",
+	"Count", "Sum", "Average",
 
-		// Synchronization & data movement
-		"Sync", "Synchronize", "Replicate", "Mirror",
-		"Archive", "Backup", "Snapshot", "Preserve", "Store",
-		"Import", "Export", "Upload", "Download", "Copy", "Clone", "Duplicate",
-		"Restore", "Recover", "Rollback",
-		"Migrate", "Move",
+	// Process & execution
+	"Process", "Execute", "Run", "Handle", "Perform", "Invoke",
+	"Batch", "Bulk", "Retry", "Rerun", "Reprocess", "Replay",
 
-		// Authentication
-		"Login", "Logout", "Signin", "Signout",
+	// Communication
+	"Send", "Transmit", "Dispatch", "Deliver", "Forward", "Route",
+	"Receive", "Accept", "Collect",
+	"Notify", "Alert", "Warn", "Inform", "Remind", "Broadcast", "Publish",
+	"Email", "Print",
 
-		// Financial
-		"Bill", "Invoice", "Charge", "Credit", "Debit", "Refund", "Reimburse",
-		"Pay", "Settle", "Post", "Reconcile",
-		"Capture", "Withdraw", "Payout", "Disburse", "Deposit",
+	// Resource management
+	"Reserve", "Hold", "Lock", "Allocate", "Claim", "Acquire",
+	"Release", "Free", "Unlock", "Deallocate", "Relinquish",
+	"Unclaim", "Take", "Pickup",
 
-		// E-commerce
-		"Checkout", "Purchase", "Buy", "Order", "Return", "Exchange",
-		"Ship", "Fulfill", "Pack",
+	// Lifecycle & state transitions
+	"Cancel", "Abort", "Revoke", "Void", "Annul", "Terminate",
+	"Suspend", "Pause", "Freeze", "Deactivate", "Disable", "Ban",
+	"Resume", "Reactivate", "Unfreeze", "Unpause", "Enable", "Activate", "Unban",
+	"Complete", "Finish", "Finalize", "Close", "Conclude", "End",
+	"Initiate", "Start", "Begin", "Open", "Launch", "Trigger",
+	"Expire", "Invalidate",
+	"Reset", "Initialize", "Configure", "Setup",
 
-		// Scheduling & assignment
-		"Book", "Schedule", "Reschedule", "Assign", "Unassign",
-		"Enqueue", "Dequeue", "Queue",
+	// Approval workflow
+	"Approve", "Grant", "Allow", "Permit", "Sanction",
+	"Reject", "Deny", "Decline", "Refuse", "Disallow", "Veto",
+	"Certify", "Recertify", "Decertify", "Attest", "Endorse", "Accredit", "License",
+	"Review", "Assess", "Evaluate", "Inspect", "Audit", "Examine", "Appraise", "Moderate",
+	"Escalate", "Elevate", "Refer", "Delegate", "Reassign", "Transfer",
+	"Submit", "Propose", "Request",
 
-		// Linking & relationships
-		"Attach", "Detach", "Link", "Unlink", "Associate", "Dissociate",
-		"Tag", "Untag", "Label", "Categorize", "Classify",
-		"Flag", "Unflag", "Mark", "Unmark", "Pin", "Unpin",
+	// Acknowledgment & signing
+	"Acknowledge", "Receipt",
+	"Sign", "Countersign", "Cosign", "Seal", "Notarize",
 
-		// Social actions
-		"Share", "Unshare", "Invite",
-		"Follow", "Unfollow", "Block", "Unblock", "Mute", "Unmute",
-		"Vote", "Rate", "Score", "Rank", "Like", "Upvote", "Downvote",
+	// Synchronization & data movement
+	"Sync", "Synchronize", "Replicate", "Mirror",
+	"Archive", "Backup", "Snapshot", "Preserve", "Store",
+	"Import", "Export", "Upload", "Download", "Copy", "Clone", "Duplicate",
+	"Restore", "Recover", "Rollback",
+	"Migrate", "Move",
 
-		// Content & publishing
-		"Publish", "Unpublish", "Draft", "Compose", "Write",
-		"Stage", "Deploy", "Undeploy",
-		"Promote", "Demote", "Upgrade", "Downgrade",
-		"Feature", "Unfeature", "Highlight", "Spotlight",
+	// Authentication
+	"Login", "Logout", "Signin", "Signout",
 
-		// Monitoring
-		"Monitor", "Track", "Observe", "Measure", "Log", "Ping", "Poll", "Probe",
+	// Financial
+	"Bill", "Invoice", "Charge", "Credit", "Debit", "Refund", "Reimburse",
+	"Pay", "Settle", "Post", "Reconcile",
+	"Capture", "Withdraw", "Payout", "Disburse", "Deposit",
 
-		// Display
-		"Preview", "Display", "Show", "Hide", "Mask", "Reveal",
+	// E-commerce
+	"Checkout", "Purchase", "Buy", "Order", "Return", "Exchange",
+	"Ship", "Fulfill", "Pack",
 
-		// Navigation
-		"Navigate", "Browse", "Explore",
-	}
+	// Scheduling & assignment
+	"Book", "Schedule", "Reschedule", "Assign", "Unassign",
+	"Enqueue", "Dequeue", "Queue",
 
-	nameLower := strings.ToLower(name)
-	for _, v := range verbs {
-		vLower := strings.ToLower(v)
-		if strings.HasPrefix(nameLower, vLower) {
-			verb = v
-			entity = name[len(v):]
-			break
-		}
-	}
+	// Linking & relationships
+	"Attach", "Detach", "Link", "Unlink", "Associate", "Dissociate",
+	"Tag", "Untag", "Label", "Categorize", "Classify",
+	"Flag", "Unflag", "Mark", "Unmark", "Pin", "Unpin",
 
-	// Clean up entity
-	if entity != "" {
-		// Remove ById, ByEmail, etc suffixes
-		re := regexp.MustCompile(`(?i)(By\w+)$`)
-		entity = re.ReplaceAllString(entity, "")
-	}
+	// Social actions
+	"Share", "Unshare", "Invite",
+	"Follow", "Unfollow", "Block", "Unblock", "Mute", "Unmute",
+	"Vote", "Rate", "Score", "Rank", "Like", "Upvote", "Downvote",
 
-	return verb, entity
+	// Content & publishing
+	"Publish", "Unpublish", "Draft", "Compose", "Write",
+	"Stage", "Deploy", "Undeploy",
+	"Promote", "Demote", "Upgrade", "Downgrade",
+	"Feature", "Unfeature", "Highlight", "Spotlight",
+
+	// Monitoring
+	"Monitor", "Track", "Observe", "Measure", "Log", "Ping", "Poll", "Probe",
+
+	// Display
+	"Preview", "Display", "Show", "Hide", "Mask", "Reveal",
+
+	// Navigation
+	"Navigate", "Browse", "Explore",
 }
 
 // Verb compatibility groups - verbs in the same group are considered synonymous
@@ -1172,6 +1254,118 @@ func scoreEntityMatch(e1, e2 string) float64 {
 	return 0
 }
 
+// ============================================================================
+// Strategy 5: Type Signature
+// ============================================================================
+
+// TypeSignatureStrategy compares the procedure's input parameters with the
+// request message's fields, and its first result set's columns with the
+// response's fields (or those of the message it lists): how many there
+// are, how many names match, and how many of those have compatible types.
+type TypeSignatureStrategy struct{}
+
+func (s *TypeSignatureStrategy) Name() string { return "types" }
+
+func (s *TypeSignatureStrategy) Match(method *ProtoMethodInfo, proc *Procedure, ctx *MatchContext) *StrategyResult {
+	var scores []float64
+	var reasons []string
+
+	if reqMsg := ctx.AllMessages[method.RequestType]; reqMsg != nil && len(reqMsg.Fields) > 0 {
+		var params []typedName
+		for _, p := range proc.Parameters {
+			if !p.IsOutput {
+				params = append(params, typedName{p.Name, p.GoType})
+			}
+		}
+		if score, named, typed := compareSignature(reqMsg.Fields, params); named > 0 {
+			scores = append(scores, score)
+			reasons = append(reasons, fmt.Sprintf("request %d/%d fields, %d typed", named, len(reqMsg.Fields), typed))
+		}
+	}
+
+	if fields := responseFields(method, ctx); len(fields) > 0 && len(proc.ResultSets) > 0 {
+		var columns []typedName
+		for _, c := range proc.ResultSets[0].Columns {
+			if c.Name != "*" {
+				columns = append(columns, typedName{c.Name, c.GoType})
+			}
+		}
+		if score, named, typed := compareSignature(fields, columns); named > 0 {
+			scores = append(scores, score)
+			reasons = append(reasons, fmt.Sprintf("response %d/%d fields, %d typed", named, len(fields), typed))
+		}
+	}
+
+	if len(scores) == 0 {
+		return nil
+	}
+	total := 0.0
+	for _, score := range scores {
+		total += score
+	}
+	return &StrategyResult{
+		Matched:    true,
+		Score:      total / float64(len(scores)),
+		Reason:     strings.Join(reasons, ", "),
+		Confidence: 0.7,
+	}
+}
+
+// typedName is a parameter or column, by name and Go type ("" if unknown).
+type typedName struct {
+	name   string
+	goType string
+}
+
+// responseFields returns the fields of method's response, or of the
+// message it lists, for a response that's a repeated message and little
+// else (a next page token, a count).
+func responseFields(method *ProtoMethodInfo, ctx *MatchContext) []ProtoFieldInfo {
+	respMsg := ctx.AllMessages[method.ResponseType]
+	if respMsg == nil {
+		return nil
+	}
+	for _, f := range respMsg.Fields {
+		if f.IsRepeated && f.IsMessage {
+			if listed := ctx.AllMessages[f.MessageType]; listed != nil {
+				return listed.Fields
+			}
+		}
+	}
+	return respMsg.Fields
+}
+
+// compareSignature scores how well names match fields, 0 to 1: 20% for
+// the counts being alike, 40% for the names matched, 40% for the matches
+// with compatible types. An unknown type counts as compatible.
+func compareSignature(fields []ProtoFieldInfo, names []typedName) (score float64, named, typed int) {
+	if len(names) == 0 {
+		return 0, 0, 0
+	}
+	byName := make(map[string]*ProtoFieldInfo)
+	for i := range fields {
+		byName[strings.ToLower(strings.ReplaceAll(fields[i].Name, "_", ""))] = &fields[i]
+	}
+	for _, n := range names {
+		field := byName[strings.ToLower(strings.ReplaceAll(n.name, "_", ""))]
+		if field == nil {
+			continue
+		}
+		named++
+		if n.goType == "" || isTieBreakTypeCompatible(field.ProtoType, n.goType) {
+			typed++
+		}
+	}
+	most, fewest := len(fields), len(names)
+	if fewest > most {
+		most, fewest = fewest, most
+	}
+	score = 0.2*float64(fewest)/float64(most) +
+		0.4*float64(named)/float64(most) +
+		0.4*float64(typed)/float64(most)
+	return score, named, typed
+}
+
 // Helper functions for parameter and result mapping (shared with existing code)
 func mapParametersFromContext(method *ProtoMethodInfo, proc *Procedure, ctx *MatchContext) []ParamMapping {
 	var mappings []ParamMapping
@@ -357,6 +357,29 @@ func TestVerbEntityParsing(t *testing.T) {
 	}
 }
 
+func TestEnsembleMapper_SetVerbs(t *testing.T) {
+	mapper := NewEnsembleMapper(&ProtoParseResult{}, nil)
+	mapper.SetVerbs([]string{"Liquidate"}, []string{"Sign"})
+	ctx := &MatchContext{Verbs: mapper.verbs}
+
+	testCases := []struct {
+		name           string
+		expectedVerb   string
+		expectedEntity string
+	}{
+		{"LiquidateLoan", "Liquidate", "Loan"},
+		{"SignContract", "", ""},
+		{"GetUserById", "Get", "User"},
+	}
+	for _, tc := range testCases {
+		verb, entity := ctx.parseVerbEntity(tc.name)
+		if verb != tc.expectedVerb || entity != tc.expectedEntity {
+			t.Errorf("%s: expected (%s, %s), got (%s, %s)",
+				tc.name, tc.expectedVerb, tc.expectedEntity, verb, entity)
+		}
+	}
+}
+
 func TestVerbGroupMatching(t *testing.T) {
 	testCases := []struct {
 		v1, v2   string
@@ -539,3 +562,73 @@ func TestEnsembleMapper_BusinessProcessVerbs(t *testing.T) {
 		t.Logf("%s -> %s (%.0f%% confidence)", tc.method, mapping.Procedure.Name, mapping.Confidence*100)
 	}
 }
+
+func TestEnsembleMapper_TypeSignature(t *testing.T) {
+	proto := &ProtoParseResult{
+		AllServices: map[string]*ProtoServiceInfo{
+			"CatalogService": {
+				Name: "CatalogService",
+				Methods: []ProtoMethodInfo{
+					{Name: "GetProduct", RequestType: "GetProductRequest", ResponseType: "GetProductResponse"},
+				},
+			},
+		},
+		AllMessages: map[string]*ProtoMessageInfo{
+			"GetProductRequest": {Name: "GetProductRequest", Fields: []ProtoFieldInfo{
+				{Name: "product_id", ProtoType: "int64", Number: 1},
+			}},
+			"GetProductResponse": {Name: "GetProductResponse", Fields: []ProtoFieldInfo{
+				{Name: "product_id", ProtoType: "int64", Number: 1},
+				{Name: "name", ProtoType: "string", Number: 2},
+				{Name: "price", ProtoType: "double", Number: 3},
+			}},
+		},
+		AllMethods: make(map[string]*ProtoMethodInfo),
+	}
+
+	procs := []*Procedure{
+		{
+			Name:       "usp_FetchItem",
+			Parameters: []ProcParameter{{Name: "ProductId", SQLType: "BIGINT", GoType: "int64"}},
+			ResultSets: []ResultSet{{Columns: []ResultColumn{
+				{Name: "ProductId", GoType: "int64"},
+				{Name: "Name", GoType: "string"},
+				{Name: "Price", GoType: "float64"},
+			}}},
+		},
+		{
+			Name:       "usp_FetchLabel",
+			Parameters: []ProcParameter{{Name: "ProductId", SQLType: "NVARCHAR", GoType: "string"}},
+			ResultSets: []ResultSet{{Columns: []ResultColumn{
+				{Name: "Label", GoType: "string"},
+			}}},
+		},
+	}
+
+	s := &TypeSignatureStrategy{}
+	ctx := &MatchContext{AllMessages: proto.AllMessages}
+	method := &proto.AllServices["CatalogService"].Methods[0]
+	item, label := s.Match(method, procs[0], ctx), s.Match(method, procs[1], ctx)
+	if item == nil || item.Score != 1 || item.Reason != "request 1/1 fields, 1 typed, response 3/3 fields, 3 typed" {
+		t.Fatalf("usp_FetchItem: got %+v", item)
+	}
+	if label == nil || label.Score >= item.Score {
+		t.Errorf("usp_FetchLabel should score below usp_FetchItem, got %+v", label)
+	}
+
+	mapper := NewEnsembleMapper(proto, procs)
+	if err := mapper.SetWeights(map[string]float64{"naming": 0, "types": 2}); err != nil {
+		t.Fatalf("SetWeights failed: %v", err)
+	}
+	mapping := mapper.MapAll()["CatalogService.GetProduct"]
+	if mapping == nil || mapping.Procedure.Name != "usp_FetchItem" {
+		t.Errorf("expected GetProduct -> usp_FetchItem, got %+v", mapping)
+	}
+
+	if err := mapper.SetWeights(map[string]float64{"nmaing": 1}); err == nil {
+		t.Error("SetWeights: expected an error for an unknown strategy")
+	}
+	if err := mapper.SetWeights(map[string]float64{"types": -1}); err == nil {
+		t.Error("SetWeights: expected an error for a negative weight")
+	}
+}
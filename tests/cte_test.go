@@ -515,10 +515,11 @@ func TestExistsExpression(t *testing.T) {
 				END
 			`,
 			expected: []string{
-				"func() bool",
+				"CheckExists(ctx context.Context, id int32) (err error) {",
+				"if exists, err := tsqlruntime.ReadExists(",
 				"SELECT 1 WHERE EXISTS",
 				"FROM Users WHERE",
-				"!func()",
+				"} else if !exists {",
 			},
 		},
 		{
@@ -535,9 +536,10 @@ func TestExistsExpression(t *testing.T) {
 				END
 			`,
 			expected: []string{
-				"func() bool",
+				"tsqlruntime.ReadExists(",
 				"SELECT 1 WHERE EXISTS",
 				"IsActive = 1",
+				"return err\n\t} else if exists {",
 			},
 		},
 		{
@@ -554,10 +556,42 @@ func TestExistsExpression(t *testing.T) {
 				END
 			`,
 			expected: []string{
-				"func() bool",
+				"tsqlruntime.ReadExists(",
 				"FROM Users WHERE", // NOLOCK should be stripped
 			},
 		},
+		{
+			name: "EXISTS in WHILE",
+			sql: `
+				CREATE PROCEDURE ReleaseLocks
+					@ID INT
+				AS
+				BEGIN
+					WHILE EXISTS(SELECT 1 FROM Locks WHERE UserID = @ID)
+						DELETE TOP (100) FROM Locks WHERE UserID = @ID
+				END
+			`,
+			expected: []string{
+				"for {\n\t\tif exists, err := tsqlruntime.ReadExists(",
+				"return err\n\t\t} else if !exists {\n\t\t\tbreak\n\t\t}",
+			},
+		},
+		{
+			// A function has no error to return the query's with
+			name: "EXISTS in a function",
+			sql: `
+				CREATE FUNCTION HasOrders(@ID INT) RETURNS BIT
+				AS
+				BEGIN
+					IF EXISTS(SELECT 1 FROM Orders WHERE UserID = @ID)
+						RETURN 1
+					RETURN 0
+				END
+			`,
+			expected: []string{
+				"if tsqlruntime.QueryExists(",
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -581,6 +615,52 @@ func TestExistsExpression(t *testing.T) {
 	}
 }
 
+// TestScalarSubqueryHelper tests that scalar subqueries call the runtime helpers
+func TestScalarSubqueryHelper(t *testing.T) {
+	sql := `
+		CREATE PROCEDURE CountOrders
+			@UserID INT,
+			@Many BIT OUTPUT,
+			@Status NVARCHAR(20) OUTPUT,
+			@Total BIGINT OUTPUT
+		AS
+		BEGIN
+			IF (SELECT COUNT(*) FROM Orders WHERE UserID = @UserID) > 5
+				SET @Many = 1
+			ELSE IF (SELECT Status FROM Users WHERE UserID = @UserID) = 'X'
+				SET @Status = 'x'
+			WHILE (SELECT COUNT(*) FROM Queue) > 0
+				DELETE FROM Queue WHERE UserID = @UserID
+			SET @Total = (SELECT COUNT(*) FROM Orders WHERE UserID = @UserID) + 1
+		END
+	`
+	config := transpiler.DefaultDMLConfig()
+	config.SQLDialect = "postgres"
+
+	result, err := transpiler.TranspileWithDML(sql, "main", config)
+	if err != nil {
+		t.Fatalf("Transpilation failed: %v", err)
+	}
+
+	// Statements read the subqueries ahead, returning their errors
+	for _, want := range []string{
+		"if count, err := tsqlruntime.ReadScalarInt64(ctx, r.db, \"SELECT COUNT(*) FROM Orders WHERE (UserID = $1)\", userId); err != nil {\n\t\treturn many, status, total, err\n\t} else if count > 5 {",
+		"} else if scalar, err := tsqlruntime.ReadScalar(ctx, r.db, \"SELECT Status FROM Users WHERE (UserID = $1)\", userId); err != nil {\n\t\treturn many, status, total, err\n\t} else if scalar == \"X\" {",
+		"for {\n\t\tif count, err := tsqlruntime.ReadScalarInt64(ctx, r.db, \"SELECT COUNT(*) FROM Queue\"); err != nil {\n\t\t\treturn many, status, total, err\n\t\t} else if !(count > 0) {\n\t\t\tbreak\n\t\t}",
+		"if count, err := tsqlruntime.ReadScalarInt64(ctx, r.db, \"SELECT COUNT(*) FROM Orders WHERE (UserID = $1)\", userId); err != nil {\n\t\treturn many, status, total, err\n\t} else {\n\t\ttotal = count + 1\n\t}",
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("Expected %q, got:\n%s", want, result)
+		}
+	}
+	if strings.Contains(result, "tsqlruntime.QueryScalar") {
+		t.Errorf("Expected no query helpers dropping errors, got:\n%s", result)
+	}
+	if strings.Contains(result, "func() any") {
+		t.Errorf("Expected no inline subquery closure, got:\n%s", result)
+	}
+}
+
 // TestTryCatchErrorLogging tests TRY/CATCH with error logging pattern
 func TestTryCatchErrorLogging(t *testing.T) {
 	sql := `
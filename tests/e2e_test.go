@@ -302,23 +302,38 @@ func setupWorkspace(t *testing.T) string {
 		t.Fatalf("Failed to create temp dir: %v", err)
 	}
 
+	// Generated code may call tsqlruntime helpers, so point the workspace
+	// at this checkout rather than a published tgpiler version.
+	repoRoot, err := filepath.Abs("..")
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		t.Fatalf("Failed to resolve repo root: %v", err)
+	}
+
 	// Create go.mod
-	goMod := `module e2etest
+	goMod := fmt.Sprintf(`module e2etest
 
 go 1.21
 
-require github.com/shopspring/decimal v1.3.1
-`
+require (
+	github.com/ha1tch/tgpiler v0.0.0
+	github.com/shopspring/decimal v1.3.1
+)
+
+replace github.com/ha1tch/tgpiler => %s
+`, repoRoot)
 	if err := os.WriteFile(filepath.Join(tmpDir, "go.mod"), []byte(goMod), 0644); err != nil {
 		os.RemoveAll(tmpDir)
 		t.Fatalf("Failed to write go.mod: %v", err)
 	}
 
-	// Create go.sum
-	goSum := `github.com/shopspring/decimal v1.3.1 h1:2Usl1nmF/WZucqkFZhnfFYxxxu8LG21F6nPQBE5gKV8=
-github.com/shopspring/decimal v1.3.1/go.mod h1:DKyhrW/HYNuLGql+MJL6WCR6knT2jwCFRcu2hWCYk4o=
-`
-	if err := os.WriteFile(filepath.Join(tmpDir, "go.sum"), []byte(goSum), 0644); err != nil {
+	// Create go.sum from the repo's own, which covers tgpiler's dependencies
+	goSum, err := os.ReadFile(filepath.Join(repoRoot, "go.sum"))
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		t.Fatalf("Failed to read go.sum: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "go.sum"), goSum, 0644); err != nil {
 		os.RemoveAll(tmpDir)
 		t.Fatalf("Failed to write go.sum: %v", err)
 	}
@@ -347,6 +362,7 @@ func transpileAndExecute(t *testing.T, workspace, tgpiler, sqlFile, testCode str
 	usesMath := strings.Contains(generatedCode, "math.")
 	usesStrings := strings.Contains(generatedCode, "strings.")
 	usesUtf8 := strings.Contains(generatedCode, "utf8.")
+	usesStrfn := strings.Contains(generatedCode, "strfn.")
 
 	// Build imports (fmt always needed for test output)
 	var imports []string
@@ -366,6 +382,9 @@ func transpileAndExecute(t *testing.T, workspace, tgpiler, sqlFile, testCode str
 	if usesUtf8 {
 		imports = append(imports, `"unicode/utf8"`)
 	}
+	if usesStrfn {
+		imports = append(imports, `"github.com/ha1tch/tgpiler/tsqlruntime/strfn"`)
+	}
 
 	// Extract function definitions (skip package line and imports)
 	lines := strings.Split(generatedCode, "\n")
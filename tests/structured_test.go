@@ -5,6 +5,7 @@
 package tests
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"os/exec"
@@ -53,10 +54,13 @@ func testTranspileDirectoryDML(t *testing.T, dir string) {
 
 		t.Run(baseName, func(t *testing.T) {
 			// Transpile with --dml flag
+			// Warnings go to stderr; only stdout is Go source
 			cmd := exec.Command(tgpiler, "--dml", sqlFile)
-			output, err := cmd.CombinedOutput()
+			var stderr bytes.Buffer
+			cmd.Stderr = &stderr
+			output, err := cmd.Output()
 			if err != nil {
-				t.Fatalf("Transpilation failed: %v\nOutput: %s", err, string(output))
+				t.Fatalf("Transpilation failed: %v\nOutput: %s", err, stderr.String())
 			}
 
 			// Write to temp file
@@ -120,9 +124,11 @@ replace github.com/ha1tch/tgpiler => ` + mustAbs(t, "..") + `
 		goPath := filepath.Join(workspace, goName)
 
 		cmd := exec.Command(tgpiler, "--dml", sqlFile)
-		output, err := cmd.CombinedOutput()
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		output, err := cmd.Output()
 		if err != nil {
-			t.Fatalf("Transpilation of %s failed: %v\nOutput: %s", baseName, err, string(output))
+			t.Fatalf("Transpilation of %s failed: %v\nOutput: %s", baseName, err, stderr.String())
 		}
 
 		if err := os.WriteFile(goPath, output, 0644); err != nil {
@@ -282,9 +288,11 @@ replace github.com/ha1tch/tgpiler => ` + mustAbs(t, "..") + `
 func transpileAndExecuteStructured(t *testing.T, workspace, tgpiler, sqlFile, testCode string) string {
 	// Transpile with --dml
 	cmd := exec.Command(tgpiler, "--dml", sqlFile)
-	output, err := cmd.CombinedOutput()
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
 	if err != nil {
-		t.Fatalf("Transpilation failed: %v\nOutput: %s", err, string(output))
+		t.Fatalf("Transpilation failed: %v\nOutput: %s", err, stderr.String())
 	}
 
 	generatedCode := string(output)
@@ -294,6 +302,8 @@ func transpileAndExecuteStructured(t *testing.T, workspace, tgpiler, sqlFile, te
 	usesTime := strings.Contains(generatedCode, "time.")
 	usesStrings := strings.Contains(generatedCode, "strings.")
 	usesStrconv := strings.Contains(generatedCode, "strconv.")
+	usesXmlfn := strings.Contains(generatedCode, "xmlfn.")
+	usesRuntime := strings.Contains(generatedCode, "tsqlruntime.")
 
 	// Build imports
 	var imports []string
@@ -312,6 +322,12 @@ func transpileAndExecuteStructured(t *testing.T, workspace, tgpiler, sqlFile, te
 	if usesStrconv {
 		imports = append(imports, `"strconv"`)
 	}
+	if usesXmlfn {
+		imports = append(imports, `"github.com/ha1tch/tgpiler/tsqlruntime/xmlfn"`)
+	}
+	if usesRuntime {
+		imports = append(imports, `"github.com/ha1tch/tgpiler/tsqlruntime"`)
+	}
 
 	// Extract function definitions
 	lines := strings.Split(generatedCode, "\n")
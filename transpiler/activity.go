@@ -0,0 +1,104 @@
+package transpiler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// activityPragma, placed in the comments leading a procedure, marks it as
+// long-running batch work to run as a worker activity, such as a Temporal
+// activity:
+//
+//	-- tgpiler:activity
+//	CREATE PROCEDURE dbo.RebuildTotals ...
+//
+// The procedure always returns an error, which makes it a valid Temporal
+// activity, and calls tsqlruntime.Heartbeat at the top of every WHILE and
+// cursor loop iteration. Heartbeat records progress with the worker's
+// heartbeater and returns ctx.Err(), so a cancelled activity stops at the
+// next loop boundary, or during a WAITFOR.
+const activityPragma = "tgpiler:activity"
+
+// hasPragma reports whether a procedure's leading comments contain pragma.
+func hasPragma(comments []string, pragma string) bool {
+	for _, c := range comments {
+		if strings.EqualFold(strings.TrimSpace(c), pragma) {
+			return true
+		}
+	}
+	return false
+}
+
+// transpileWaitfor turns WAITFOR DELAY and WAITFOR TIME into a sleep that
+// ends early when ctx is cancelled, returning its error. Without a context
+// or an error to return, the sleep is time.Sleep.
+func (t *transpiler) transpileWaitfor(s *ast.WaitforStatement) (string, error) {
+	d, err := t.waitforDuration(s)
+	if err != nil {
+		return "", err
+	}
+	t.imports["time"] = true
+	if !t.dmlEnabled || !t.inProcBody || (!t.hasDMLStatements && !t.inTryBlock && t.catchLabel == "") {
+		return fmt.Sprintf("time.Sleep(%s)", d), nil
+	}
+	t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+
+	code := t.ctxCheck(fmt.Sprintf("tsqlruntime.Sleep(ctx, %s)", d), false)
+	return strings.TrimSuffix(strings.TrimPrefix(code, t.indentStr()), "\n"), nil
+}
+
+// waitforDuration returns the Go expression for how long a WAITFOR waits.
+func (t *transpiler) waitforDuration(s *ast.WaitforStatement) (string, error) {
+	var d string
+	if lit, ok := s.Duration.(*ast.StringLiteral); ok {
+		parsed, err := parseWaitforTime(lit.Value)
+		if err != nil {
+			return "", fmt.Errorf("WAITFOR %s: %w", s.Type, err)
+		}
+		d = goDuration(parsed)
+		if parsed == 0 {
+			d = "0"
+		}
+	} else {
+		expr, err := t.transpileExpression(s.Duration)
+		if err != nil {
+			return "", err
+		}
+		d = fmt.Sprintf("tsqlruntime.Delay(%s)", expr)
+		t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+	}
+	if strings.EqualFold(s.Type, "TIME") {
+		t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+		return fmt.Sprintf("tsqlruntime.Until(%s)", d), nil
+	}
+	return d, nil
+}
+
+// parseWaitforTime parses a WAITFOR duration or time of day,
+// hh:mm[:ss[.mmm]].
+func parseWaitforTime(s string) (time.Duration, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("invalid time %q (want hh:mm[:ss[.mmm]])", s)
+	}
+	var d time.Duration
+	for i, unit := range []time.Duration{time.Hour, time.Minute} {
+		n, err := strconv.Atoi(parts[i])
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid time %q (want hh:mm[:ss[.mmm]])", s)
+		}
+		d += time.Duration(n) * unit
+	}
+	if len(parts) == 3 {
+		secs, err := strconv.ParseFloat(parts[2], 64)
+		if err != nil || secs < 0 {
+			return 0, fmt.Errorf("invalid time %q (want hh:mm[:ss[.mmm]])", s)
+		}
+		d += time.Duration(secs * float64(time.Second)).Round(time.Millisecond)
+	}
+	return d, nil
+}
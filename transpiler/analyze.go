@@ -0,0 +1,169 @@
+package transpiler
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ha1tch/tsqlparser"
+)
+
+// Complexity analysis
+//
+// AnalyzeComplexity scores each procedure for how much its migration is
+// likely to take, from what parsing alone shows, so procedures that don't
+// transpile yet are scored too:
+//
+//	1 per statement
+//	2 per level of IF, WHILE and TRY/CATCH nesting, at the deepest
+//	5 for cursors and dynamic SQL, each
+//	2 for temp tables
+//	2 per procedure called
+//
+// RankComplexity ranks the procedures of every file by score and suggests
+// an order to migrate them in: a procedure comes after the procedures it
+// calls, so callers can be tested against migrated code, and otherwise the
+// simplest first. Calls in a cycle can't all come first; the cycle is
+// broken at its simplest procedure.
+
+// ProcedureComplexity is a procedure's complexity analysis.
+type ProcedureComplexity struct {
+	Procedure  string   `json:"procedure"`
+	Score      int      `json:"score"`
+	Rank       int      `json:"rank"`  // 1 for the highest score
+	Order      int      `json:"order"` // Place in the suggested migration order, from 1
+	Statements int      `json:"statements"`
+	Depth      int      `json:"nesting_depth"`
+	Cursors    bool     `json:"cursors"`
+	DynamicSQL bool     `json:"dynamic_sql"`
+	TempTables bool     `json:"temp_tables"`
+	Calls      []string `json:"calls,omitempty"`
+	CalledBy   []string `json:"called_by,omitempty"` // Set by RankComplexity
+}
+
+// AnalyzeComplexity scores each procedure in source.
+func AnalyzeComplexity(source string) ([]ProcedureComplexity, error) {
+	program, errors := tsqlparser.Parse(stripGoStatements(source))
+	if len(errors) > 0 {
+		return nil, fmt.Errorf("parse errors:\n%s", strings.Join(errors, "\n"))
+	}
+	// Both list the procedures in the order of the source
+	usage := procedureUsage(program)
+	var procs []ProcedureComplexity
+	for i, f := range featureScans(program) {
+		p := ProcedureComplexity{
+			Procedure:  f.features.Procedure,
+			Depth:      f.maxDepth,
+			Cursors:    f.features.Cursors,
+			DynamicSQL: f.features.DynamicSQL,
+			TempTables: f.features.TempTables,
+			Calls:      usage[i].Calls,
+		}
+		for _, n := range f.kinds {
+			p.Statements += n
+		}
+		p.Score = complexityScore(p)
+		procs = append(procs, p)
+	}
+	return procs, nil
+}
+
+// complexityScore weighs p (see AnalyzeComplexity).
+func complexityScore(p ProcedureComplexity) int {
+	score := p.Statements + 2*p.Depth + 2*len(p.Calls)
+	for _, hard := range []bool{p.Cursors, p.DynamicSQL} {
+		if hard {
+			score += 5
+		}
+	}
+	if p.TempTables {
+		score += 2
+	}
+	return score
+}
+
+// RankComplexity sets the Rank, Order and CalledBy of procs and returns
+// them in the suggested migration order.
+func RankComplexity(procs []ProcedureComplexity) []ProcedureComplexity {
+	ranked := append([]ProcedureComplexity(nil), procs...)
+	byScore := make([]int, len(ranked))
+	for i := range byScore {
+		byScore[i] = i
+	}
+	sort.SliceStable(byScore, func(a, b int) bool {
+		return ranked[byScore[a]].Score > ranked[byScore[b]].Score
+	})
+	for rank, i := range byScore {
+		ranked[i].Rank = rank + 1
+	}
+
+	// Calls are unqualified; the first procedure of a name is the one called
+	index := map[string]int{}
+	for i, p := range ranked {
+		key := strings.ToLower(unqualifiedName(p.Procedure))
+		if _, ok := index[key]; !ok {
+			index[key] = i
+		}
+	}
+	callees := make([]map[int]bool, len(ranked))
+	for i, p := range ranked {
+		callees[i] = map[int]bool{}
+		for _, callee := range p.Calls {
+			if j, ok := index[strings.ToLower(callee)]; ok && j != i {
+				callees[i][j] = true
+				ranked[j].CalledBy = append(ranked[j].CalledBy, p.Procedure)
+			}
+		}
+	}
+
+	// Lowest score first, of those whose callees are all placed; if none
+	// is, a cycle is left and the simplest of it goes next regardless
+	placed := make([]bool, len(ranked))
+	ready := func(i int) bool {
+		for j := range callees[i] {
+			if !placed[j] {
+				return false
+			}
+		}
+		return true
+	}
+	simpler := func(i, j int) bool {
+		return j < 0 || ranked[i].Score < ranked[j].Score
+	}
+	for order := 1; order <= len(ranked); order++ {
+		next, fallback := -1, -1
+		for _, i := range byScore {
+			if placed[i] {
+				continue
+			}
+			if simpler(i, fallback) {
+				fallback = i
+			}
+			if ready(i) && simpler(i, next) {
+				next = i
+			}
+		}
+		if next < 0 {
+			next = fallback
+		}
+		placed[next] = true
+		ranked[next].Order = order
+	}
+	sort.SliceStable(ranked, func(a, b int) bool {
+		return ranked[a].Order < ranked[b].Order
+	})
+	return ranked
+}
+
+// MarshalComplexityJSON renders a complexity analysis as indented JSON.
+func MarshalComplexityJSON(procs []ProcedureComplexity) ([]byte, error) {
+	if procs == nil {
+		procs = []ProcedureComplexity{}
+	}
+	data, err := json.MarshalIndent(procs, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
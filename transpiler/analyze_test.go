@@ -0,0 +1,86 @@
+package transpiler
+
+import "testing"
+
+const analyzeSQL = `
+CREATE PROCEDURE dbo.usp_PlaceOrder @CustomerID INT
+AS
+BEGIN
+    BEGIN TRY
+        IF @CustomerID IS NULL
+        BEGIN
+            WHILE 1 = 1
+                BREAK
+        END
+        EXEC dbo.usp_GetCustomer @CustomerID
+        EXEC usp_LogOrder @CustomerID
+    END TRY
+    BEGIN CATCH
+        THROW
+    END CATCH
+END
+GO
+CREATE PROCEDURE dbo.usp_LogOrder @CustomerID INT
+AS
+BEGIN
+    CREATE TABLE #Log (CustomerID INT)
+    INSERT INTO #Log (CustomerID) VALUES (@CustomerID)
+    EXEC usp_LogOrder @CustomerID
+END
+GO
+CREATE PROCEDURE dbo.usp_GetCustomer @CustomerID INT
+AS
+BEGIN
+    SELECT Name FROM Customers WHERE CustomerID = @CustomerID
+END
+`
+
+func TestAnalyzeComplexity(t *testing.T) {
+	procs, err := AnalyzeComplexity(analyzeSQL)
+	if err != nil {
+		t.Fatalf("AnalyzeComplexity failed: %v", err)
+	}
+	if len(procs) != 3 {
+		t.Fatalf("Expected 3 procedures, got %+v", procs)
+	}
+	place := procs[0]
+	if place.Depth != 3 || place.Statements != 7 || len(place.Calls) != 2 {
+		t.Errorf("Expected depth 3, 7 statements and 2 calls, got %+v", place)
+	}
+	// 7 statements, 3 levels deep, 2 calls
+	if place.Score != 7+2*3+2*2 {
+		t.Errorf("Expected score 17, got %d", place.Score)
+	}
+	if log := procs[1]; !log.TempTables || log.Depth != 0 || log.Score != 3+2+2 {
+		t.Errorf("Expected a score of 7 with temp tables, got %+v", log)
+	}
+
+	ranked := RankComplexity(procs)
+	var order []string
+	for _, p := range ranked {
+		order = append(order, p.Procedure)
+	}
+	want := []string{"dbo.usp_GetCustomer", "dbo.usp_LogOrder", "dbo.usp_PlaceOrder"}
+	for i := range want {
+		if order[i] != want[i] || ranked[i].Order != i+1 {
+			t.Fatalf("Expected migration order %v, got %v", want, order)
+		}
+	}
+	if ranked[2].Rank != 1 || ranked[0].Rank != 3 {
+		t.Errorf("Expected usp_PlaceOrder ranked first and usp_GetCustomer last, got %+v", ranked)
+	}
+	if len(ranked[0].CalledBy) != 1 || ranked[0].CalledBy[0] != "dbo.usp_PlaceOrder" {
+		t.Errorf("Expected usp_GetCustomer called by usp_PlaceOrder, got %v", ranked[0].CalledBy)
+	}
+}
+
+func TestRankComplexityCycle(t *testing.T) {
+	ranked := RankComplexity([]ProcedureComplexity{
+		{Procedure: "A", Score: 5, Calls: []string{"B"}},
+		{Procedure: "B", Score: 3, Calls: []string{"A"}},
+		{Procedure: "C", Score: 9, Calls: []string{"A"}},
+	})
+	if ranked[0].Procedure != "B" || ranked[1].Procedure != "A" || ranked[2].Procedure != "C" {
+		t.Errorf("Expected the cycle broken at B, got %+v", ranked)
+	}
+}
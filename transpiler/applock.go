@@ -0,0 +1,174 @@
+package transpiler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// Application locks
+//
+// Procedures serialize work with sp_getapplock and sp_releaseapplock. A
+// procedure calling them gets a tsqlruntime.AppLocks, released when it
+// returns as the session's locks would be, and the calls become its Get
+// and Release:
+//
+//	EXEC @r = sp_getapplock @Resource = 'nightly', @LockMode = 'Exclusive', @LockTimeout = 5000
+//	-> r, err = appLocks.Get(ctx, "nightly", "Exclusive", 5000*time.Millisecond)
+//
+// On PostgreSQL the locks are advisory locks, on MySQL GET_LOCK locks and
+// on SQL Server sp_getapplock itself. Other dialects and backends hold
+// them in the process. Locks owned by a transaction are held until they
+// are released or the procedure returns, not until COMMIT.
+
+// isAppLockProc reports whether s calls sp_getapplock or sp_releaseapplock.
+func isAppLockProc(s *ast.ExecStatement) bool {
+	if s.Procedure == nil || len(s.Procedure.Parts) == 0 {
+		return false
+	}
+	name := s.Procedure.Parts[len(s.Procedure.Parts)-1].Value
+	return strings.EqualFold(name, "sp_getapplock") || strings.EqualFold(name, "sp_releaseapplock")
+}
+
+// usesAppLocksIn reports whether body calls sp_getapplock or
+// sp_releaseapplock.
+func usesAppLocksIn(body *ast.BeginEndBlock) bool {
+	uses := false
+	forEachStatement(body, func(stmt ast.Statement) {
+		if s, ok := stmt.(*ast.ExecStatement); ok && isAppLockProc(s) {
+			uses = true
+		}
+	})
+	return uses
+}
+
+// appLocksPrologue returns the declaration of the procedure's appLocks.
+func (t *transpiler) appLocksPrologue() string {
+	db, dialect := "nil", ""
+	if t.dmlConfig.Backend == BackendSQL {
+		db, dialect = t.dmlConfig.StoreVar, t.dmlConfig.SQLDialect
+	}
+	t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+	ind := t.indentStr()
+	return fmt.Sprintf("%sappLocks := tsqlruntime.NewAppLocks(%s, %q)\n%sdefer appLocks.ReleaseAll()\n", ind, db, dialect, ind)
+}
+
+// getAppLockParams and releaseAppLockParams are the procedures'
+// parameters, in order.
+var (
+	getAppLockParams     = []string{"@resource", "@lockmode", "@lockowner", "@locktimeout", "@dbprincipal"}
+	releaseAppLockParams = []string{"@resource", "@lockowner", "@dbprincipal"}
+)
+
+// transpileAppLock converts EXEC sp_getapplock and sp_releaseapplock to
+// appLocks.Get and appLocks.Release, assigning the status to the return
+// variable.
+func (dt *dmlTranspiler) transpileAppLock(s *ast.ExecStatement) (string, error) {
+	proc := strings.ToLower(s.Procedure.Parts[len(s.Procedure.Parts)-1].Value)
+	params := getAppLockParams
+	if proc == "sp_releaseapplock" {
+		params = releaseAppLockParams
+	}
+	args := map[string]ast.Expression{}
+	for i, p := range s.Parameters {
+		name := strings.ToLower(p.Name)
+		if name == "" {
+			if i >= len(params) {
+				continue
+			}
+			name = params[i]
+		}
+		if !strings.HasPrefix(name, "@") {
+			name = "@" + name
+		}
+		args[name] = p.Value
+	}
+	if args["@resource"] == nil {
+		return "", fmt.Errorf("%s requires @Resource", proc)
+	}
+	if !dt.usesAppLocks {
+		return "", fmt.Errorf("%s outside a procedure body is not supported", proc)
+	}
+
+	resource := dt.appLockString(args["@resource"])
+	var call string
+	if proc == "sp_releaseapplock" {
+		call = fmt.Sprintf("appLocks.Release(ctx, %s)", resource)
+	} else {
+		if args["@lockmode"] == nil {
+			return "", fmt.Errorf("sp_getapplock requires @LockMode")
+		}
+		if lit, ok := args["@lockmode"].(*ast.StringLiteral); ok && !isAppLockMode(lit.Value) {
+			return "", fmt.Errorf("sp_getapplock: unknown @LockMode %s", lit.Value)
+		}
+		timeout := "-1"
+		if e := args["@locktimeout"]; e != nil {
+			timeout = dt.appLockTimeout(e)
+		}
+		call = fmt.Sprintf("appLocks.Get(ctx, %s, %s, %s)", resource, dt.appLockString(args["@lockmode"]), timeout)
+	}
+
+	ind := dt.indentStr()
+	var out strings.Builder
+	if dt.emitOriginal() {
+		out.WriteString(fmt.Sprintf("// Original: %s\n", truncateSQL(s.String(), 100)))
+		out.WriteString(ind)
+	}
+	out.WriteString(fmt.Sprintf("// EXEC %s\n", proc))
+	if s.ReturnVariable == nil {
+		out.WriteString(fmt.Sprintf("%sif _, err := %s; err != nil {\n", ind, call))
+		out.WriteString(ind + "\t" + dt.buildErrorReturn() + "\n")
+		out.WriteString(ind + "}")
+		return out.String(), nil
+	}
+	result := &ast.Variable{Name: "@" + strings.TrimPrefix(s.ReturnVariable.Value, "@")}
+	value := "status"
+	if ti := dt.inferType(result); ti != nil && ti.goType != "int32" {
+		value = fmt.Sprintf("%s(%s)", ti.goType, value)
+	}
+	out.WriteString(fmt.Sprintf("%sif status, err := %s; err != nil {\n", ind, call))
+	out.WriteString(ind + "\t" + dt.buildErrorReturn() + "\n")
+	out.WriteString(ind + "} else {\n")
+	out.WriteString(fmt.Sprintf("%s\t%s = %s\n", ind, goIdentifier(strings.TrimPrefix(result.Name, "@")), value))
+	out.WriteString(ind + "}")
+	return out.String(), nil
+}
+
+// isAppLockMode reports whether mode is one sp_getapplock accepts.
+func isAppLockMode(mode string) bool {
+	for _, m := range []string{"Shared", "Update", "IntentShared", "IntentExclusive", "Exclusive"} {
+		if strings.EqualFold(mode, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// appLockString returns e, a lock's resource or mode, as a Go string.
+func (dt *dmlTranspiler) appLockString(e ast.Expression) string {
+	if lit, ok := e.(*ast.StringLiteral); ok {
+		return fmt.Sprintf("%q", lit.Value)
+	}
+	value := dt.exprToGoValue(e)
+	if ti := dt.inferType(e); ti != nil && ti.goType != "string" {
+		value = fmt.Sprintf("fmt.Sprint(%s)", value)
+		dt.imports["fmt"] = true
+	}
+	return value
+}
+
+// appLockTimeout returns @LockTimeout, in milliseconds, as a
+// time.Duration; -1 waits until the context is done.
+func (dt *dmlTranspiler) appLockTimeout(e ast.Expression) string {
+	if p, ok := e.(*ast.PrefixExpression); ok && p.Operator == "-" {
+		if _, ok := p.Right.(*ast.IntegerLiteral); ok {
+			return "-1"
+		}
+	}
+	dt.imports["time"] = true
+	if lit, ok := e.(*ast.IntegerLiteral); ok {
+		return fmt.Sprintf("%d*time.Millisecond", lit.Value)
+	}
+	return fmt.Sprintf("time.Duration(%s)*time.Millisecond", dt.exprToGoValue(e))
+}
@@ -0,0 +1,168 @@
+package transpiler
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// CROSS APPLY and OUTER APPLY
+//
+// APPLY is SQL Server's lateral join. PostgreSQL and MySQL (8.0.14 and
+// later) have LATERAL, so
+//
+//	FROM Customers c CROSS APPLY (SELECT ...) AS o   -> CROSS JOIN LATERAL (SELECT ...) AS o
+//	FROM Customers c OUTER APPLY (SELECT ...) AS o   -> LEFT JOIN LATERAL (SELECT ...) AS o ON TRUE
+//
+// SQLite has no lateral join. A subquery that returns exactly one row, an
+// aggregate without GROUP BY or an OUTER APPLY of TOP 1, is dropped from
+// the FROM clause instead, and each reference to one of its columns is
+// replaced by a correlated scalar subquery. Other APPLYs, and APPLYs of a
+// table-valued function where the dialect has no such functions, are kept
+// as they are with a warning.
+
+// tableSQL returns the SQL of a table in the FROM clause of s for the
+// dialect. Columns of an APPLY rewritten as scalar subqueries are added to
+// rewrites, by lower-cased alias.column.
+func (dt *dmlTranspiler) tableSQL(ref ast.TableReference, s *ast.SelectStatement, rewrites map[string]string) string {
+	if pivot, ok := dt.pivotTableSQL(ref, s); ok {
+		return pivot
+	}
+	jc, ok := ref.(*ast.JoinClause)
+	if !ok {
+		return ref.String()
+	}
+	left := dt.tableSQL(jc.Left, s, rewrites)
+	if isApplyJoin(jc) {
+		if dt.config.SQLDialect == "sqlite" && dt.applyAsSubqueries(jc, rewrites) {
+			return left
+		}
+		return left + " " + dt.applyJoinSQL(jc, jc.Right.String())
+	}
+	join := jc.Type
+	if jc.Hint != "" {
+		join += " " + jc.Hint
+	}
+	out := left + " " + join + " JOIN " + dt.tableSQL(jc.Right, s, rewrites)
+	if jc.Condition != nil {
+		out += " ON " + jc.Condition.String()
+	}
+	return out
+}
+
+func isApplyJoin(jc *ast.JoinClause) bool {
+	return jc.Type == "CROSS APPLY" || jc.Type == "OUTER APPLY"
+}
+
+// applyJoinSQL returns the join of an APPLY to right for the dialect,
+// keeping APPLY with a warning where it has no translation.
+func (dt *dmlTranspiler) applyJoinSQL(jc *ast.JoinClause, right string) string {
+	dialect := dt.config.SQLDialect
+	_, derived := jc.Right.(*ast.DerivedTable)
+	switch {
+	case dialect == "sqlserver":
+		return jc.Type + " " + right
+	case dialect == "postgres" || (dialect == "mysql" && derived):
+		if jc.Type == "OUTER APPLY" {
+			return "LEFT JOIN LATERAL " + right + " ON TRUE"
+		}
+		return "CROSS JOIN LATERAL " + right
+	}
+	reason := "which has no lateral joins"
+	if dialect == "mysql" {
+		reason = "which has no table-valued functions"
+	}
+	dt.warn(RuleUntranslated, fmt.Sprintf("%s: %s %s has no %s translation, %s; it is kept as it is",
+		dt.currentProcName, jc.Type, truncateSQL(jc.Right.String(), 60), dialect, reason))
+	return jc.Type + " " + right
+}
+
+// applyAsSubqueries rewrites an APPLY of a subquery returning exactly one
+// row as a scalar subquery per column, for dialects without LATERAL.
+func (dt *dmlTranspiler) applyAsSubqueries(jc *ast.JoinClause, rewrites map[string]string) bool {
+	derived, ok := jc.Right.(*ast.DerivedTable)
+	if !ok || derived.Alias == nil || derived.Subquery == nil {
+		return false
+	}
+	sub := derived.Subquery
+	if sub.From == nil || sub.Distinct || len(sub.GroupBy) > 0 || sub.Having != nil || sub.Union != nil {
+		return false
+	}
+	oneRow := sub.Top == nil && allAggregates(sub.Columns)
+	if !oneRow && jc.Type == "OUTER APPLY" && sub.Top != nil && !sub.Top.Percent {
+		lit, isInt := sub.Top.Count.(*ast.IntegerLiteral)
+		oneRow = isInt && lit.Value == 1
+	}
+	if !oneRow {
+		return false
+	}
+
+	names := pivotNames(derived.ColumnAliases, nil)
+	if len(names) == 0 {
+		var ok bool
+		if names, ok = selectColumnNames(sub); !ok {
+			return false
+		}
+	}
+	if len(names) != len(sub.Columns) {
+		return false
+	}
+	tail := " " + sub.From.String()
+	if sub.Where != nil {
+		tail += " WHERE " + sub.Where.String()
+	}
+	if len(sub.OrderBy) > 0 {
+		var items []string
+		for _, item := range sub.OrderBy {
+			items = append(items, item.String())
+		}
+		tail += " ORDER BY " + strings.Join(items, ", ")
+	}
+	if sub.Top != nil {
+		tail += " LIMIT 1"
+	}
+	for i, col := range sub.Columns {
+		key := strings.ToLower(derived.Alias.Value + "." + names[i])
+		rewrites[key] = "(SELECT " + col.Expression.String() + tail + ")"
+	}
+	return true
+}
+
+var aggregateFunctions = map[string]bool{
+	"COUNT": true, "COUNT_BIG": true, "SUM": true, "MIN": true, "MAX": true, "AVG": true,
+	"STDEV": true, "STDEVP": true, "VAR": true, "VARP": true, "STRING_AGG": true,
+}
+
+// allAggregates reports whether every column is an aggregate, so a SELECT
+// without GROUP BY returns exactly one row.
+func allAggregates(cols []ast.SelectColumn) bool {
+	if len(cols) == 0 {
+		return false
+	}
+	for _, col := range cols {
+		fc, ok := col.Expression.(*ast.FunctionCall)
+		if !ok || fc.Over != nil || !aggregateFunctions[strings.ToUpper(fc.Function.String())] {
+			return false
+		}
+	}
+	return true
+}
+
+// applyColumnRewrites replaces the references in sql to columns of APPLYs
+// rewritten as scalar subqueries.
+func applyColumnRewrites(sql string, rewrites map[string]string) string {
+	keys := make([]string, 0, len(rewrites))
+	for key := range rewrites {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		alias, col, _ := strings.Cut(key, ".")
+		re := regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(alias) + `\.` + regexp.QuoteMeta(col) + `\b`)
+		sql = re.ReplaceAllLiteralString(sql, rewrites[key])
+	}
+	return sql
+}
@@ -0,0 +1,251 @@
+package transpiler
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// Bulk loads
+//
+// BULK INSERT and OPENROWSET(BULK ...) read files on the database server.
+// In Go the file is read by the application instead:
+//
+//	BULK INSERT T FROM 'f' WITH (...)          -> tsqlruntime.BulkInsert(ctx, db, "T", nil, "f", opts)
+//	SELECT @v = BulkColumn FROM OPENROWSET(
+//	    BULK 'f', SINGLE_CLOB | SINGLE_NCLOB)  -> tsqlruntime.ReadBulkText("f", wide)
+//	    BULK 'f', SINGLE_BLOB)                 -> os.ReadFile("f")
+//
+// The terminator, FORMAT = 'CSV', FIRSTROW/LASTROW, BATCHSIZE and MAXERRORS
+// options are carried over. Options that tune the server (TABLOCK,
+// FIRE_TRIGGERS, ...) are dropped. Format files and native data files
+// have no equivalent and are rejected.
+
+// bulkIgnoredOptions are BULK INSERT options with no effect on how the
+// file is read.
+var bulkIgnoredOptions = map[string]bool{
+	"TABLOCK": true, "CHECK_CONSTRAINTS": true, "FIRE_TRIGGERS": true,
+	"KEEPIDENTITY": true, "KEEPNULLS": true, "ORDER": true,
+	"KILOBYTES_PER_BATCH": true, "ROWS_PER_BATCH": true, "CODEPAGE": true,
+}
+
+func (t *transpiler) transpileBulkInsert(s *ast.BulkInsertStatement) (string, error) {
+	dt := &dmlTranspiler{transpiler: t, config: t.dmlConfig}
+	return dt.transpileBulkInsert(s)
+}
+
+func (dt *dmlTranspiler) transpileBulkInsert(s *ast.BulkInsertStatement) (string, error) {
+	table := s.Table.String()
+	if s.DataFile == "" {
+		return "", fmt.Errorf("BULK INSERT %s: the data file must be a string literal (a variable path can't be translated)", table)
+	}
+	if isTempTable(table) {
+		return "", fmt.Errorf("BULK INSERT into temp table %s is not supported; load a permanent staging table instead", table)
+	}
+	if backend := dt.getEffectiveBackend(unqualifiedName(table)); backend != BackendSQL && backend != BackendRedis {
+		return "", fmt.Errorf("BULK INSERT %s needs the SQL backend, not %s (route the table with --table-backend=%s:sql)",
+			table, backend, unqualifiedName(table))
+	}
+
+	var opts []string
+	names := make([]string, 0, len(s.Options))
+	for name := range s.Options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := s.Options[name]
+		switch strings.ToUpper(name) {
+		case "FIELDTERMINATOR", "ROWTERMINATOR":
+			field := "FieldTerminator"
+			if strings.EqualFold(name, "ROWTERMINATOR") {
+				field = "RowTerminator"
+			}
+			opts = append(opts, fmt.Sprintf("%s: %q", field, decodeBulkTerminator(value)))
+		case "FORMAT":
+			if !strings.EqualFold(value, "CSV") {
+				return "", fmt.Errorf("BULK INSERT %s: FORMAT = '%s' is not supported", table, value)
+			}
+			opts = append(opts, "CSV: true")
+		case "FIELDQUOTE":
+			if value != "" && value != `"` {
+				opts = append(opts, fmt.Sprintf("FieldQuote: %q", []rune(value)[0]))
+			}
+		case "FIRSTROW", "LASTROW", "BATCHSIZE", "MAXERRORS":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return "", fmt.Errorf("BULK INSERT %s: %s must be a number, got %q", table, name, value)
+			}
+			field := map[string]string{"FIRSTROW": "FirstRow", "LASTROW": "LastRow", "BATCHSIZE": "BatchSize", "MAXERRORS": "MaxErrors"}[strings.ToUpper(name)]
+			opts = append(opts, fmt.Sprintf("%s: %d", field, n))
+		case "DATAFILETYPE":
+			if !strings.EqualFold(value, "char") {
+				return "", fmt.Errorf("BULK INSERT %s: DATAFILETYPE = '%s' is not supported, only 'char'", table, value)
+			}
+		case "FORMATFILE":
+			return "", fmt.Errorf("BULK INSERT %s: format files are not supported; use FIELDTERMINATOR and ROWTERMINATOR", table)
+		case "ERRORFILE":
+			dt.warnings = append(dt.warnings, fmt.Sprintf("%s: BULK INSERT %s: ERRORFILE is ignored; malformed rows are skipped without being logged",
+				dt.currentProcName, table))
+		default:
+			if !bulkIgnoredOptions[strings.ToUpper(name)] {
+				dt.warnings = append(dt.warnings, fmt.Sprintf("%s: BULK INSERT %s: option %s is ignored", dt.currentProcName, table, name))
+			}
+		}
+	}
+	opts = append([]string{"Dialect: " + runtimeDialect(dt.config.SQLDialect)}, opts...)
+
+	dt.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+	var out strings.Builder
+	ind := dt.indentStr()
+	if dt.emitTODOs() {
+		out.WriteString("// TODO(tgpiler): BULK INSERT read this path on the database server; it is now read by the application\n")
+		out.WriteString(ind)
+	}
+	out.WriteString(fmt.Sprintf("// BULK INSERT %s\n", table))
+	out.WriteString(ind)
+	target := "_"
+	if dt.usesRowCount {
+		target = "n"
+	}
+	out.WriteString(fmt.Sprintf("if %s, err := tsqlruntime.BulkInsert(ctx, %s, %q, nil, %q, tsqlruntime.BulkOptions{%s}); err != nil {\n",
+		target, dt.getDBVar(), table, s.DataFile, strings.Join(opts, ", ")))
+	out.WriteString(ind + "\t" + dt.buildErrorReturn() + "\n")
+	if dt.usesRowCount {
+		out.WriteString(ind + "} else {\n")
+		out.WriteString(ind + "\trowsAffected = int32(n)\n")
+	}
+	out.WriteString(ind + "}")
+	return out.String(), nil
+}
+
+// decodeBulkTerminator turns the escapes BULK INSERT accepts in a
+// terminator (\t, \n, \r, \0, \\ and 0xNN) into the characters they stand
+// for. As on the server, \n also matches \r\n.
+func decodeBulkTerminator(value string) string {
+	if strings.HasPrefix(strings.ToLower(value), "0x") {
+		if n, err := strconv.ParseUint(value[2:], 16, 8); err == nil {
+			return string(rune(n))
+		}
+	}
+	var out strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' || i+1 == len(value) {
+			out.WriteByte(value[i])
+			continue
+		}
+		i++
+		switch value[i] {
+		case 't':
+			out.WriteByte('\t')
+		case 'n':
+			out.WriteByte('\n')
+		case 'r':
+			out.WriteByte('\r')
+		case '0':
+			out.WriteByte(0)
+		default:
+			out.WriteByte(value[i])
+		}
+	}
+	return out.String()
+}
+
+// runtimeDialect returns the tsqlruntime.Dialect constant for a
+// DMLConfig.SQLDialect.
+func runtimeDialect(dialect string) string {
+	switch dialect {
+	case "postgres":
+		return "tsqlruntime.DialectPostgres"
+	case "mysql":
+		return "tsqlruntime.DialectMySQL"
+	case "sqlite":
+		return "tsqlruntime.DialectSQLite"
+	case "sqlserver":
+		return "tsqlruntime.DialectSQLServer"
+	default:
+		return "tsqlruntime.DialectGeneric"
+	}
+}
+
+// openRowsetBulk returns the file and single-value mode (SINGLE_CLOB,
+// SINGLE_NCLOB or SINGLE_BLOB) of a SELECT reading from
+// OPENROWSET(BULK ...). ok is false for any other SELECT.
+func openRowsetBulk(s *ast.SelectStatement) (path, mode string, ok bool) {
+	if s.From == nil || len(s.From.Tables) != 1 {
+		return "", "", false
+	}
+	fn, isFn := s.From.Tables[0].(*ast.TableValuedFunction)
+	if !isFn || fn.Function == nil || !strings.EqualFold(fn.Function.String(), "OPENROWSET") || len(fn.Arguments) < 2 {
+		return "", "", false
+	}
+	if id, isID := fn.Arguments[0].(*ast.Identifier); !isID || !strings.EqualFold(id.Value, "BULK") {
+		return "", "", false
+	}
+	if lit, isLit := fn.Arguments[1].(*ast.StringLiteral); isLit {
+		path = lit.Value
+	}
+	for _, arg := range fn.Arguments[2:] {
+		if id, isID := arg.(*ast.Identifier); isID {
+			switch strings.ToUpper(id.Value) {
+			case "SINGLE_CLOB", "SINGLE_NCLOB", "SINGLE_BLOB":
+				mode = strings.ToUpper(id.Value)
+			}
+		}
+	}
+	return path, mode, true
+}
+
+// transpileOpenRowsetBulk translates SELECT @v = BulkColumn FROM
+// OPENROWSET(BULK 'f', SINGLE_CLOB) AS x and its NCLOB and BLOB variants.
+func (dt *dmlTranspiler) transpileOpenRowsetBulk(s *ast.SelectStatement, path, mode string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("OPENROWSET(BULK ...): the data file must be a string literal")
+	}
+	if mode == "" {
+		return "", fmt.Errorf("OPENROWSET(BULK '%s') with a format file is not supported; use BULK INSERT into a staging table", path)
+	}
+	if len(s.Columns) != 1 || s.Columns[0].Variable == nil || s.Where != nil {
+		return "", fmt.Errorf("OPENROWSET(BULK '%s', %s) is only supported as SELECT @var = BulkColumn FROM OPENROWSET(...)", path, mode)
+	}
+	target := goIdentifier(strings.TrimPrefix(s.Columns[0].Variable.Name, "@"))
+	goType := "string"
+	if ti := dt.symbols.lookup(target); ti != nil {
+		goType = ti.goType
+	}
+
+	var call, value string
+	switch {
+	case mode == "SINGLE_BLOB":
+		dt.imports["os"] = true
+		call = fmt.Sprintf("os.ReadFile(%q)", path)
+		value = "string(data)"
+		if goType == "[]byte" {
+			value = "data"
+		}
+	default:
+		dt.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+		call = fmt.Sprintf("tsqlruntime.ReadBulkText(%q, %v)", path, mode == "SINGLE_NCLOB")
+		value = "data"
+		if goType == "[]byte" {
+			value = "[]byte(data)"
+		}
+	}
+
+	var out strings.Builder
+	ind := dt.indentStr()
+	if dt.emitTODOs() {
+		out.WriteString("// TODO(tgpiler): OPENROWSET read this path on the database server; it is now read by the application\n")
+		out.WriteString(ind)
+	}
+	out.WriteString(fmt.Sprintf("// OPENROWSET(BULK '%s', %s)\n", path, mode))
+	out.WriteString(ind + fmt.Sprintf("if data, err := %s; err != nil {\n", call))
+	out.WriteString(ind + "\t" + dt.buildErrorReturn() + "\n")
+	out.WriteString(ind + "} else {\n")
+	out.WriteString(ind + fmt.Sprintf("\t%s = %s\n", target, value))
+	out.WriteString(ind + "}")
+	return out.String(), nil
+}
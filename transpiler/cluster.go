@@ -0,0 +1,455 @@
+package transpiler
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ha1tch/tsqlparser"
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// Procedure clustering
+//
+// ClusterProcedures groups procedures into candidate services from their
+// contracts, or just the table usage and calls ProcedureUsage finds: procedures that work on the same tables, or call each other,
+// end up together. Each table is then owned by the group that uses it most,
+// which gives a --table-service mapping to start from instead of one made
+// up table by table.
+//
+// Two procedures are as similar as the tables they use overlap (weighted
+// Jaccard, writes counting twice as much as reads), plus CallWeight when one
+// calls the other. Groups are merged bottom-up while the average similarity
+// between their procedures reaches Threshold.
+
+// ClusterOptions tunes ClusterProcedures.
+type ClusterOptions struct {
+	Threshold  float64 // Lowest average similarity at which two groups merge (0-1)
+	CallWeight float64 // Added to the similarity of a caller and its callee
+}
+
+// DefaultClusterOptions returns the default clustering options.
+func DefaultClusterOptions() ClusterOptions {
+	return ClusterOptions{Threshold: 0.25, CallWeight: 0.5}
+}
+
+// ServiceCluster is a suggested service: procedures and the tables they own.
+type ServiceCluster struct {
+	Service    string   `json:"service"`
+	Procedures []string `json:"procedures"`
+	Tables     []string `json:"tables,omitempty"`      // Tables the service owns
+	UsesTables []string `json:"uses_tables,omitempty"` // Tables owned by other services
+	Calls      []string `json:"calls,omitempty"`       // Other services its procedures call
+	Cohesion   float64  `json:"cohesion"`              // Average similarity of its procedures
+}
+
+// ClusterReport is the suggested decomposition of a set of procedures.
+type ClusterReport struct {
+	Clusters       []ServiceCluster  `json:"clusters"`
+	Unclustered    []string          `json:"unclustered,omitempty"` // Procedures using no tables or other procedures
+	TableToService map[string]string `json:"table_service"`
+}
+
+// TableServiceFlag returns the report's table ownership as a
+// --table-service value, e.g. "OrderLines:OrderService,Orders:OrderService".
+func (r *ClusterReport) TableServiceFlag() string {
+	tables := make([]string, 0, len(r.TableToService))
+	for table := range r.TableToService {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	pairs := make([]string, len(tables))
+	for i, table := range tables {
+		pairs[i] = table + ":" + r.TableToService[table]
+	}
+	return strings.Join(pairs, ",")
+}
+
+// Diagnostics returns a --table-service suggestion for each table, so the
+// report can be merged into tgpiler.yaml with --apply-suggestions.
+func (r *ClusterReport) Diagnostics() []Diagnostic {
+	var diags []Diagnostic
+	for _, c := range r.Clusters {
+		for _, table := range c.Tables {
+			diags = append(diags, Diagnostic{
+				Message:    fmt.Sprintf("table %s is used most by the %d procedures clustered as %s", table, len(c.Procedures), c.Service),
+				Suggestion: Suggestion{Flag: "table-service", Key: table, Value: c.Service},
+			})
+		}
+	}
+	return diags
+}
+
+// ProcedureUsage returns a contract for each procedure in source with only
+// the tables it reads and writes and the procedures it calls. Unlike
+// ExtractContracts it only parses, so procedures using statements the
+// transpiler doesn't handle yet are still included.
+func ProcedureUsage(source string) ([]ProcedureContract, error) {
+	program, errors := tsqlparser.Parse(stripGoStatements(source))
+	if len(errors) > 0 {
+		return nil, fmt.Errorf("parse errors:\n%s", strings.Join(errors, "\n"))
+	}
+	return procedureUsage(program), nil
+}
+
+// procedureUsage is ProcedureUsage for a parsed program.
+func procedureUsage(program *ast.Program) []ProcedureContract {
+	var contracts []ProcedureContract
+	for _, stmt := range program.Statements {
+		proc, ok := stmt.(*ast.CreateProcedureStatement)
+		if !ok {
+			continue
+		}
+		procName := proc.Name.Parts[len(proc.Name.Parts)-1].Value
+		tables := &tableAccess{read: map[string]bool{}, written: map[string]bool{}, calls: map[string]bool{}}
+		if proc.Body != nil {
+			tables.statements(proc.Body.Statements)
+		}
+		contracts = append(contracts, ProcedureContract{
+			Name:          procName,
+			GoName:        goExportedIdentifier(procName),
+			TablesRead:    sortedKeys(tables.read),
+			TablesWritten: sortedKeys(tables.written),
+			Calls:         sortedKeys(tables.calls),
+		})
+	}
+	return contracts
+}
+
+// clusterProc is a procedure being clustered.
+type clusterProc struct {
+	name   string
+	tables map[string]float64 // Unqualified table -> weight (2 written, 1 read)
+	calls  map[string]bool
+}
+
+// ClusterProcedures groups contracts into suggested services.
+func ClusterProcedures(contracts []ProcedureContract, opts ClusterOptions) *ClusterReport {
+	report := &ClusterReport{Clusters: []ServiceCluster{}, TableToService: map[string]string{}}
+
+	// One entry per procedure, in name order so results are stable
+	byName := map[string]*clusterProc{}
+	for _, c := range contracts {
+		key := strings.ToLower(c.Name)
+		p := byName[key]
+		if p == nil {
+			p = &clusterProc{name: c.Name, tables: map[string]float64{}, calls: map[string]bool{}}
+			byName[key] = p
+		}
+		for _, t := range c.TablesRead {
+			p.tables[unqualifiedName(t)] = max(p.tables[unqualifiedName(t)], 1)
+		}
+		for _, t := range c.TablesWritten {
+			p.tables[unqualifiedName(t)] = 2
+		}
+		for _, callee := range c.Calls {
+			p.calls[strings.ToLower(callee)] = true
+		}
+	}
+	linked := map[string]bool{} // Procedures that call or are called by another
+	for key, p := range byName {
+		for callee := range p.calls {
+			if byName[callee] != nil && callee != key {
+				linked[key] = true
+				linked[callee] = true
+			}
+		}
+	}
+	var procs []*clusterProc
+	for key, p := range byName {
+		if len(p.tables) == 0 && !linked[key] {
+			report.Unclustered = append(report.Unclustered, p.name)
+			continue
+		}
+		procs = append(procs, p)
+	}
+	sort.Strings(report.Unclustered)
+	sort.Slice(procs, func(i, j int) bool { return procs[i].name < procs[j].name })
+
+	// Average-linkage agglomeration over the similarity matrix, updated in
+	// place as groups merge
+	n := len(procs)
+	sim := make([][]float64, n)
+	for i := range sim {
+		sim[i] = make([]float64, n)
+		for j := 0; j < i; j++ {
+			sim[i][j] = procSimilarity(procs[i], procs[j], opts.CallWeight)
+			sim[j][i] = sim[i][j]
+		}
+	}
+	groups := make([][]int, n)
+	for i := range groups {
+		groups[i] = []int{i}
+	}
+	for {
+		bi, bj, best := -1, -1, opts.Threshold
+		for i := 0; i < n; i++ {
+			if groups[i] == nil {
+				continue
+			}
+			for j := i + 1; j < n; j++ {
+				if groups[j] != nil && sim[i][j] >= best && (bi < 0 || sim[i][j] > best) {
+					bi, bj, best = i, j, sim[i][j]
+				}
+			}
+		}
+		if bi < 0 {
+			break
+		}
+		ni, nj := float64(len(groups[bi])), float64(len(groups[bj]))
+		for k := 0; k < n; k++ {
+			if groups[k] != nil && k != bi && k != bj {
+				sim[bi][k] = (ni*sim[bi][k] + nj*sim[bj][k]) / (ni + nj)
+				sim[k][bi] = sim[bi][k]
+			}
+		}
+		groups[bi] = append(groups[bi], groups[bj]...)
+		groups[bj] = nil
+	}
+
+	var members [][]*clusterProc
+	for _, g := range groups {
+		if g == nil {
+			continue
+		}
+		var ps []*clusterProc
+		for _, i := range g {
+			ps = append(ps, procs[i])
+		}
+		members = append(members, ps)
+	}
+	members = sortGroups(members)
+
+	// A group that ends up owning no table, such as the read-only
+	// procedures of another group's tables, joins the group owning the
+	// table it uses most, or failing that a group it calls or is called by
+	usage, owner := tableOwners(members)
+	procGroup := map[string]int{}
+	for ci, ps := range members {
+		for _, p := range ps {
+			procGroup[strings.ToLower(p.name)] = ci
+		}
+	}
+	folded := false
+	for ci, ps := range members {
+		if ownsAny(owner, ci) {
+			continue
+		}
+		target := -1
+		if top := topTable(usage[ci], sortedTables(usage[ci])); top != "" {
+			target = owner[top]
+		} else {
+			target = callLinkedGroup(members, procGroup, ci)
+		}
+		if target >= 0 && members[target] != nil {
+			members[target] = append(members[target], ps...)
+			members[ci] = nil
+			folded = true
+		}
+	}
+	if folded {
+		var kept [][]*clusterProc
+		for _, ps := range members {
+			if ps != nil {
+				kept = append(kept, ps)
+			}
+		}
+		members = sortGroups(kept)
+		usage, owner = tableOwners(members)
+	}
+
+	// Name each service after its most used table, as suggestTableService
+	// does for a single table
+	seen := map[string]int{}
+	procCluster := map[string]int{}
+	for ci, ps := range members {
+		c := ServiceCluster{Cohesion: groupCohesion(ps, opts.CallWeight)}
+		for _, p := range ps {
+			c.Procedures = append(c.Procedures, p.name)
+			procCluster[strings.ToLower(p.name)] = ci
+		}
+		for t := range usage[ci] {
+			if owner[t] == ci {
+				c.Tables = append(c.Tables, t)
+			} else {
+				c.UsesTables = append(c.UsesTables, t)
+			}
+		}
+		sort.Strings(c.Tables)
+		sort.Strings(c.UsesTables)
+
+		base := "Service"
+		if top := topTable(usage[ci], c.Tables); top != "" {
+			base = singularize(top) + "Service"
+		}
+		seen[base]++
+		c.Service = base
+		if seen[base] > 1 {
+			c.Service = fmt.Sprintf("%s%d", base, seen[base])
+		}
+		for _, t := range c.Tables {
+			report.TableToService[t] = c.Service
+		}
+		report.Clusters = append(report.Clusters, c)
+	}
+
+	for ci, ps := range members {
+		called := map[string]bool{}
+		for _, p := range ps {
+			for callee := range p.calls {
+				if cj, ok := procCluster[callee]; ok && cj != ci {
+					called[report.Clusters[cj].Service] = true
+				}
+			}
+		}
+		report.Clusters[ci].Calls = sortedKeys(called)
+	}
+	return report
+}
+
+// sortGroups sorts the procedures of each group by name, and the groups
+// largest first.
+func sortGroups(members [][]*clusterProc) [][]*clusterProc {
+	for _, ps := range members {
+		sort.Slice(ps, func(i, j int) bool { return ps[i].name < ps[j].name })
+	}
+	sort.SliceStable(members, func(i, j int) bool {
+		if len(members[i]) != len(members[j]) {
+			return len(members[i]) > len(members[j])
+		}
+		return members[i][0].name < members[j][0].name
+	})
+	return members
+}
+
+// tableOwners returns how much each group uses each table, and the group
+// owning each table: the one that uses it most, the first on a tie.
+func tableOwners(members [][]*clusterProc) ([]map[string]float64, map[string]int) {
+	usage := make([]map[string]float64, len(members))
+	owner := map[string]int{}
+	for ci, ps := range members {
+		usage[ci] = map[string]float64{}
+		for _, p := range ps {
+			for t, w := range p.tables {
+				usage[ci][t] += w
+			}
+		}
+	}
+	for ci := range members {
+		for t, w := range usage[ci] {
+			if o, ok := owner[t]; !ok || w > usage[o][t] || (w == usage[o][t] && ci < o) {
+				owner[t] = ci
+			}
+		}
+	}
+	return usage, owner
+}
+
+// callLinkedGroup returns the first group with a procedure that calls, or
+// is called by, a procedure of group ci, or -1.
+func callLinkedGroup(members [][]*clusterProc, procGroup map[string]int, ci int) int {
+	for _, p := range members[ci] {
+		for _, callee := range sortedKeys(p.calls) {
+			if cj, ok := procGroup[callee]; ok && cj != ci && members[cj] != nil {
+				return cj
+			}
+		}
+	}
+	for cj, ps := range members {
+		if cj == ci || ps == nil {
+			continue
+		}
+		for _, p := range ps {
+			for _, callee := range members[ci] {
+				if p.calls[strings.ToLower(callee.name)] {
+					return cj
+				}
+			}
+		}
+	}
+	return -1
+}
+
+// ownsAny reports whether group ci owns a table.
+func ownsAny(owner map[string]int, ci int) bool {
+	for _, o := range owner {
+		if o == ci {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedTables returns the tables of usage in name order.
+func sortedTables(usage map[string]float64) []string {
+	tables := make([]string, 0, len(usage))
+	for t := range usage {
+		tables = append(tables, t)
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+// procSimilarity is the weighted Jaccard similarity of two procedures'
+// tables, plus callWeight when one calls the other, at most 1.
+func procSimilarity(a, b *clusterProc, callWeight float64) float64 {
+	var minSum, maxSum float64
+	for t, wa := range a.tables {
+		wb := b.tables[t]
+		minSum += min(wa, wb)
+		maxSum += max(wa, wb)
+	}
+	for t, wb := range b.tables {
+		if _, ok := a.tables[t]; !ok {
+			maxSum += wb
+		}
+	}
+	s := 0.0
+	if maxSum > 0 {
+		s = minSum / maxSum
+	}
+	if a.calls[strings.ToLower(b.name)] || b.calls[strings.ToLower(a.name)] {
+		s += callWeight
+	}
+	return min(s, 1)
+}
+
+// groupCohesion is the average similarity between the procedures of a
+// group, 1 for a single procedure.
+func groupCohesion(ps []*clusterProc, callWeight float64) float64 {
+	if len(ps) < 2 {
+		return 1
+	}
+	var sum float64
+	pairs := 0
+	for i := range ps {
+		for j := i + 1; j < len(ps); j++ {
+			sum += procSimilarity(ps[i], ps[j], callWeight)
+			pairs++
+		}
+	}
+	return float64(int(sum/float64(pairs)*100+0.5)) / 100
+}
+
+// topTable returns the most used of tables. On a tie the shortest name
+// wins, as the root of the others (Orders rather than OrderLines), then
+// the first by name.
+func topTable(usage map[string]float64, tables []string) string {
+	top := ""
+	for _, t := range tables {
+		if top == "" || usage[t] > usage[top] || (usage[t] == usage[top] && len(t) < len(top)) {
+			top = t
+		}
+	}
+	return top
+}
+
+// MarshalClusterJSON renders a cluster report as indented JSON.
+func MarshalClusterJSON(report *ClusterReport) ([]byte, error) {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
@@ -0,0 +1,112 @@
+package transpiler
+
+import (
+	"reflect"
+	"testing"
+)
+
+const clusterSQL = `
+CREATE PROCEDURE usp_CreateOrder @CustomerID INT
+AS
+BEGIN
+    INSERT INTO Orders (CustomerID) VALUES (@CustomerID)
+    INSERT INTO OrderLines (OrderID) VALUES (SCOPE_IDENTITY())
+    EXEC usp_NotifyOrder @CustomerID
+END
+GO
+CREATE PROCEDURE usp_CancelOrder @OrderID INT
+AS
+BEGIN
+    UPDATE Orders SET Status = 'Cancelled' WHERE OrderID = @OrderID
+    DELETE FROM OrderLines WHERE OrderID = @OrderID
+END
+GO
+CREATE PROCEDURE usp_GetOrder @OrderID INT
+AS
+BEGIN
+    SELECT o.OrderID, l.Amount, c.Name FROM Orders o
+    JOIN OrderLines l ON l.OrderID = o.OrderID
+    JOIN Customers c ON c.CustomerID = o.CustomerID
+    WHERE o.OrderID = @OrderID
+END
+GO
+CREATE PROCEDURE usp_NotifyOrder @CustomerID INT
+AS
+BEGIN
+    PRINT 'notify'
+END
+GO
+CREATE PROCEDURE usp_CreateCustomer @Name NVARCHAR(100)
+AS
+BEGIN
+    INSERT INTO dbo.Customers (Name) VALUES (@Name)
+END
+GO
+CREATE PROCEDURE usp_RenameCustomer @ID INT, @Name NVARCHAR(100)
+AS
+BEGIN
+    MERGE Customers AS t USING (SELECT @ID AS ID) AS s ON t.CustomerID = s.ID
+    WHEN MATCHED THEN UPDATE SET Name = @Name;
+END
+GO
+CREATE PROCEDURE usp_Ping
+AS
+BEGIN
+    SELECT 1
+END
+`
+
+func TestProcedureUsage(t *testing.T) {
+	usage, err := ProcedureUsage(clusterSQL)
+	if err != nil {
+		t.Fatalf("ProcedureUsage failed: %v", err)
+	}
+	if len(usage) != 7 {
+		t.Fatalf("Expected 7 procedures, got %d", len(usage))
+	}
+	c := usage[0]
+	if c.Name != "usp_CreateOrder" || !reflect.DeepEqual(c.TablesWritten, []string{"OrderLines", "Orders"}) ||
+		!reflect.DeepEqual(c.Calls, []string{"usp_NotifyOrder"}) {
+		t.Errorf("Unexpected usage %+v", c)
+	}
+	if got := usage[5].TablesWritten; !reflect.DeepEqual(got, []string{"Customers"}) {
+		t.Errorf("Expected MERGE to write Customers, got %v", got)
+	}
+}
+
+func TestClusterProcedures(t *testing.T) {
+	usage, err := ProcedureUsage(clusterSQL)
+	if err != nil {
+		t.Fatalf("ProcedureUsage failed: %v", err)
+	}
+	report := ClusterProcedures(usage, DefaultClusterOptions())
+
+	want := []ServiceCluster{
+		{
+			Service:    "OrderService",
+			Procedures: []string{"usp_CancelOrder", "usp_CreateOrder", "usp_GetOrder", "usp_NotifyOrder"},
+			Tables:     []string{"OrderLines", "Orders"},
+			UsesTables: []string{"Customers"},
+			Cohesion:   0.38,
+		},
+		{
+			Service:    "CustomerService",
+			Procedures: []string{"usp_CreateCustomer", "usp_RenameCustomer"},
+			Tables:     []string{"Customers"},
+			Cohesion:   1,
+		},
+	}
+	if !reflect.DeepEqual(report.Clusters, want) {
+		t.Errorf("Clusters = %+v, want %+v", report.Clusters, want)
+	}
+	if !reflect.DeepEqual(report.Unclustered, []string{"usp_Ping"}) {
+		t.Errorf("Expected usp_Ping unclustered, got %v", report.Unclustered)
+	}
+	if got, want := report.TableServiceFlag(), "Customers:CustomerService,OrderLines:OrderService,Orders:OrderService"; got != want {
+		t.Errorf("TableServiceFlag() = %q, want %q", got, want)
+	}
+	diags := report.Diagnostics()
+	if len(diags) != 3 || diags[0].Suggestion.String() != "--table-service=OrderLines:OrderService" {
+		t.Errorf("Unexpected diagnostics %v", diags)
+	}
+}
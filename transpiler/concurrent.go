@@ -0,0 +1,190 @@
+package transpiler
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// concurrentPragma, placed in the comments leading a procedure, opts the
+// procedure in to running independent SELECT @var = ... statements
+// concurrently:
+//
+//	-- tgpiler:concurrent
+//	CREATE PROCEDURE dbo.GetDashboard ...
+const concurrentPragma = "tgpiler:concurrent"
+
+var sqlVariableRef = regexp.MustCompile(`@@?\w+`)
+
+// concurrentRun returns how many statements starting at stmts[i] can run
+// concurrently, or 0 unless at least two consecutive statements qualify.
+// A run only contains variable-assigning SELECTs against the SQL backend
+// where no statement mentions a variable another one assigns, so the
+// order they complete in cannot change the result.
+func (t *transpiler) concurrentRun(stmts []ast.Statement, i int) int {
+	// Queries in a transaction share one connection, CATCH blocks cannot
+	// return the error, and @@ROWCOUNT depends on statement order.
+	if !t.concurrentSelects || t.inTransaction || t.inCatchBlock || t.usesRowCount {
+		return 0
+	}
+
+	var assigned, mentioned []map[string]bool
+	for j := i; j < len(stmts); j++ {
+		sel, ok := stmts[j].(*ast.SelectStatement)
+		if !ok || !t.concurrentCandidate(sel) {
+			break
+		}
+		a, m := selectVariables(sel)
+		independent := true
+		for k := range assigned {
+			if intersects(assigned[k], m) || intersects(a, mentioned[k]) {
+				independent = false
+				break
+			}
+		}
+		if !independent {
+			break
+		}
+		assigned = append(assigned, a)
+		mentioned = append(mentioned, m)
+	}
+
+	if len(assigned) < 2 {
+		return 0
+	}
+	return len(assigned)
+}
+
+// concurrentCandidate reports whether sel only assigns variables from a
+// query against permanent tables on the SQL backend. Temp tables are
+// connection-scoped, so queries against them must stay on one connection.
+func (t *transpiler) concurrentCandidate(sel *ast.SelectStatement) bool {
+	if sel.From == nil || len(sel.Columns) == 0 || sel.Into != nil || sel.Union != nil {
+		return false
+	}
+	for _, col := range sel.Columns {
+		if col.Variable == nil {
+			return false
+		}
+	}
+	dt := &dmlTranspiler{transpiler: t, config: t.dmlConfig}
+	if dt.getEffectiveBackend(dt.extractMainTable(sel)) != BackendSQL {
+		return false
+	}
+	tables := &tableAccess{read: map[string]bool{}, written: map[string]bool{}}
+	tables.selectStmt(sel)
+	return !tables.temp
+}
+
+// selectVariables returns the variables sel assigns and every variable it
+// mentions, lower-cased without the @ prefix.
+func selectVariables(sel *ast.SelectStatement) (assigned, mentioned map[string]bool) {
+	assigned = map[string]bool{}
+	mentioned = map[string]bool{}
+	for _, col := range sel.Columns {
+		assigned[strings.ToLower(strings.TrimPrefix(col.Variable.Name, "@"))] = true
+	}
+	for _, ref := range sqlVariableRef.FindAllString(sel.String(), -1) {
+		if strings.HasPrefix(ref, "@@") {
+			continue
+		}
+		mentioned[strings.ToLower(ref[1:])] = true
+	}
+	return assigned, mentioned
+}
+
+func intersects(a, b map[string]bool) bool {
+	for k := range a {
+		if b[k] {
+			return true
+		}
+	}
+	return false
+}
+
+// transpileConcurrentSelects runs a group of independent SELECT @var = ...
+// statements concurrently with errgroup. Each goroutine scans into distinct
+// variables, and the first error cancels the others.
+func (t *transpiler) transpileConcurrentSelects(stmts []ast.Statement) (string, error) {
+	dt := &dmlTranspiler{transpiler: t, config: t.dmlConfig}
+	t.imports["database/sql"] = true
+	t.imports["golang.org/x/sync/errgroup"] = true
+
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("// %d independent queries run concurrently (%s)\n", len(stmts), concurrentPragma))
+	out.WriteString(t.indentStr())
+	out.WriteString("{\n")
+	t.indent++
+	ind := t.indentStr()
+	out.WriteString(ind + "g, gctx := errgroup.WithContext(ctx)\n")
+
+	for _, stmt := range stmts {
+		sel := stmt.(*ast.SelectStatement)
+		if dt.emitOriginal() {
+			out.WriteString(fmt.Sprintf("%s// Original: %s\n", ind, truncateSQL(sel.String(), 100)))
+		}
+
+		query, args := dt.buildSelectQuery(sel)
+		query, args = dt.bindQueryVariables(query, args)
+
+		decls, scanTargets, assigns := dt.varScanTargets(dt.extractSelectAssignments(sel))
+
+		out.WriteString(ind + "g.Go(func() error {\n")
+		for _, decl := range decls {
+			out.WriteString(ind + "\t" + decl + "\n")
+		}
+		out.WriteString(fmt.Sprintf("%s\tif err := %s.QueryRowContext(gctx, %q", ind, dt.getDBVar(), query))
+		for _, arg := range args {
+			out.WriteString(", " + arg)
+		}
+		out.WriteString(").Scan(" + strings.Join(scanTargets, ", ") + "); err == sql.ErrNoRows {\n")
+		out.WriteString(ind + "\t\treturn nil\n")
+		out.WriteString(ind + "\t} else if err != nil {\n")
+		out.WriteString(ind + "\t\treturn err\n")
+		out.WriteString(ind + "\t}\n")
+		for _, assign := range assigns {
+			out.WriteString(ind + "\t" + assign + "\n")
+		}
+		out.WriteString(ind + "\treturn nil\n")
+		out.WriteString(ind + "})\n")
+	}
+
+	out.WriteString(ind + "if err := g.Wait(); err != nil {\n")
+	out.WriteString(ind + "\t" + dt.buildErrorReturn() + "\n")
+	out.WriteString(ind + "}\n")
+	t.indent--
+	out.WriteString(t.indentStr())
+	out.WriteString("}")
+
+	return out.String(), nil
+}
+
+// transpileStatementList transpiles stmts one per line at the current
+// indent, grouping runs of independent SELECTs when the procedure opted in
+// to concurrency, and transactions to retry.
+func (t *transpiler) transpileStatementList(out *strings.Builder, stmts []ast.Statement) error {
+	for i := 0; i < len(stmts); i++ {
+		var s string
+		var err error
+		if n := t.concurrentRun(stmts, i); n > 0 {
+			s, err = t.transpileConcurrentSelects(stmts[i : i+n])
+			i += n - 1
+		} else if n := t.retriedTransaction(stmts, i); n > 0 {
+			s, err = t.transpileRetriedTransaction(stmts[i : i+n])
+			i += n - 1
+		} else {
+			s, err = t.transpileStatement(stmts[i])
+		}
+		if err != nil {
+			return err
+		}
+		if s != "" {
+			out.WriteString(t.indentStr())
+			out.WriteString(s)
+			out.WriteString("\n")
+		}
+	}
+	return nil
+}
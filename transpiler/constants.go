@@ -0,0 +1,178 @@
+package transpiler
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// Named constants
+//
+// Procedures tend to repeat status strings ('Approved', 'Pending') and
+// error codes (50001) as literals. A constants file (--constants) names
+// them, in a block per entity:
+//
+//	# constants.yaml
+//	OrderStatus:
+//	  Approved: 'Approved'
+//	  Pending: 'Pending'
+//	ErrorCode:
+//	  OrderNotFound: 50001
+//
+// GenerateConstants declares the blocks, a block of strings as a type of
+// its own and a block of integers as untyped constants, since T-SQL
+// integer literals take the type of what they are compared with:
+//
+//	type OrderStatus string
+//
+//	const (
+//		OrderStatusApproved OrderStatus = "Approved"
+//		OrderStatusPending  OrderStatus = "Pending"
+//	)
+//
+// Literals in Go expressions and query arguments with the value of a
+// constant then refer to it, as string(OrderStatusApproved) or
+// ErrorCodeOrderNotFound. A value in more than one block refers to the
+// first. Literals kept in SQL text are left alone.
+
+// ConstantBlock is a group of named values for one entity, such as the
+// statuses of an order.
+type ConstantBlock struct {
+	Name      string
+	Constants []Constant
+}
+
+// Constant is a value in a ConstantBlock.
+type Constant struct {
+	Name  string // Without the block's name
+	Value string // SQL literal: a string in single quotes or an integer
+}
+
+// isString reports whether the block's values are strings.
+func (b ConstantBlock) isString() bool {
+	return len(b.Constants) > 0 && strings.HasPrefix(b.Constants[0].Value, "'")
+}
+
+var constantName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ParseConstants parses a constants file: lines "Block:" starting a block,
+// and indented lines "Name: value" in it, with a value in single quotes or
+// an integer. Lines starting with # are comments.
+func ParseConstants(source string) ([]ConstantBlock, error) {
+	var blocks []ConstantBlock
+	goNames := map[string]bool{}
+	for n, line := range strings.Split(source, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(trimmed, ":")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !ok || !constantName.MatchString(name) {
+			return nil, fmt.Errorf("line %d: expected \"Name:\" or \"Name: value\", got %q", n+1, trimmed)
+		}
+		if line[0] != ' ' && line[0] != '\t' {
+			if value != "" {
+				return nil, fmt.Errorf("line %d: %s: constants go on indented lines under their block", n+1, name)
+			}
+			blocks = append(blocks, ConstantBlock{Name: toPascalCase(name)})
+			continue
+		}
+		if len(blocks) == 0 {
+			return nil, fmt.Errorf("line %d: %s is not in a block", n+1, name)
+		}
+		block := &blocks[len(blocks)-1]
+		s, isString := sqlUnquote(value)
+		if isString {
+			value = sqlQuote(s)
+		} else if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+			value = strconv.FormatInt(i, 10)
+		} else {
+			return nil, fmt.Errorf("line %d: %s: %s is neither a string in single quotes nor an integer", n+1, name, value)
+		}
+		if len(block.Constants) > 0 && block.isString() != isString {
+			return nil, fmt.Errorf("line %d: %s: %s mixes strings and integers", n+1, name, block.Name)
+		}
+		goName := block.Name + toPascalCase(name)
+		if goNames[goName] {
+			return nil, fmt.Errorf("line %d: %s is declared twice", n+1, goName)
+		}
+		goNames[goName] = true
+		block.Constants = append(block.Constants, Constant{Name: toPascalCase(name), Value: value})
+	}
+	for _, b := range blocks {
+		if len(b.Constants) == 0 {
+			return nil, fmt.Errorf("%s has no constants", b.Name)
+		}
+	}
+	return blocks, nil
+}
+
+// GenerateConstants returns Go source declaring blocks, for a constants
+// file shared by the files of a package.
+func GenerateConstants(blocks []ConstantBlock, packageName string) (string, error) {
+	var out strings.Builder
+	writeScaffoldHeader(&out, packageName, nil)
+	for i, b := range blocks {
+		if i > 0 {
+			out.WriteString("\n")
+		}
+		typ := ""
+		if b.isString() {
+			out.WriteString(fmt.Sprintf("// %s values.\ntype %s string\n\n", b.Name, b.Name))
+			typ = " " + b.Name
+		} else {
+			out.WriteString(fmt.Sprintf("// %s values.\n", b.Name))
+		}
+		out.WriteString("const (\n")
+		for _, c := range b.Constants {
+			value := c.Value
+			if s, ok := sqlUnquote(value); ok {
+				value = strconv.Quote(s)
+			}
+			out.WriteString(fmt.Sprintf("\t%s%s%s = %s\n", b.Name, c.Name, typ, value))
+		}
+		out.WriteString(")\n")
+	}
+	return formatScaffold(out.String(), "constants")
+}
+
+// constantRefs maps the values of blocks, as "'text'" or "123", to the Go
+// expressions referring to their constants.
+func constantRefs(blocks []ConstantBlock) map[string]string {
+	refs := map[string]string{}
+	for _, b := range blocks {
+		for _, c := range b.Constants {
+			if _, ok := refs[c.Value]; ok {
+				continue
+			}
+			ref := b.Name + c.Name
+			if b.isString() {
+				ref = "string(" + ref + ")"
+			}
+			refs[c.Value] = ref
+		}
+	}
+	return refs
+}
+
+// constantFor returns the constant a string or integer literal refers to.
+func (t *transpiler) constantFor(lit ast.Expression) (string, bool) {
+	if len(t.constantRefs) == 0 {
+		return "", false
+	}
+	var key string
+	switch e := lit.(type) {
+	case *ast.StringLiteral:
+		key = sqlQuote(e.Value)
+	case *ast.IntegerLiteral:
+		key = strconv.FormatInt(e.Value, 10)
+	default:
+		return "", false
+	}
+	ref, ok := t.constantRefs[key]
+	return ref, ok
+}
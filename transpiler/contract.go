@@ -0,0 +1,393 @@
+package transpiler
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// ProcedureContract is the statically extracted interface of a stored
+// procedure: what it takes, what it returns, which tables it touches and
+// which procedures it calls.
+// Contracts are collected while transpiling in DML mode, so Go types agree
+// with the generated code.
+type ProcedureContract struct {
+	Name          string              `json:"name"`
+	GoName        string              `json:"go_name"`
+	Inputs        []ContractParam     `json:"inputs,omitempty"`
+	Outputs       []ContractParam     `json:"outputs,omitempty"`
+	ReturnCode    bool                `json:"return_code"`
+	ResultSets    []ContractResultSet `json:"result_sets,omitempty"`
+	TablesRead    []string            `json:"tables_read,omitempty"`
+	TablesWritten []string            `json:"tables_written,omitempty"`
+	Calls         []string            `json:"calls,omitempty"` // Procedures run with EXEC
+
+	// ReturnsError reports whether the generated Go function ends with an
+	// err return value. It describes the Go signature, not the procedure.
+	ReturnsError bool `json:"-"`
+}
+
+// ContractParam is a procedure parameter.
+type ContractParam struct {
+	Name    string `json:"name"` // Without the @ prefix
+	GoName  string `json:"go_name"`
+	SQLType string `json:"sql_type"`
+	GoType  string `json:"go_type"`
+	Default string `json:"default,omitempty"`
+}
+
+// ContractResultSet is a result set returned by a SELECT in the procedure.
+type ContractResultSet struct {
+	Columns []ContractColumn `json:"columns"`
+}
+
+// ContractColumn is a result set column with its inferred Go type.
+type ContractColumn struct {
+	Name   string `json:"name"`
+	GoType string `json:"go_type"`
+}
+
+// ExtractContracts transpiles source in DML mode and returns the contract of
+// every procedure in it. The SQL backend is always used, since result sets
+// are only inferred from the queries it generates.
+func ExtractContracts(source string, dmlConfig DMLConfig) ([]ProcedureContract, error) {
+	dmlConfig.Backend = BackendSQL
+	result, err := TranspileWithDMLEx(source, "contracts", dmlConfig)
+	if err != nil {
+		return nil, err
+	}
+	return result.Contracts, nil
+}
+
+// beginContract starts collecting the contract for a procedure.
+func (t *transpiler) beginContract(proc *ast.CreateProcedureStatement, procName string, hasReturn bool) error {
+	c := &ProcedureContract{
+		Name:         procName,
+		GoName:       goExportedIdentifier(procName),
+		ReturnCode:   hasReturn,
+		ReturnsError: t.hasDMLStatements,
+	}
+	for _, p := range proc.Parameters {
+		goType, err := t.mapDataType(p.DataType)
+		if err != nil {
+			return fmt.Errorf("parameter %s: %w", p.Name, err)
+		}
+		if ti := t.symbols.lookup(goIdentifier(strings.TrimPrefix(p.Name, "@"))); ti != nil && ti.nullable {
+			goType = t.nullType(goType)
+		}
+		param := ContractParam{
+			Name:    strings.TrimPrefix(p.Name, "@"),
+			GoName:  goIdentifier(strings.TrimPrefix(p.Name, "@")),
+			SQLType: p.DataType.String(),
+			GoType:  goType,
+		}
+		if p.Default != nil {
+			param.Default = p.Default.String()
+		}
+		if p.Output {
+			c.Outputs = append(c.Outputs, param)
+		} else {
+			c.Inputs = append(c.Inputs, param)
+		}
+	}
+
+	tables := &tableAccess{read: map[string]bool{}, written: map[string]bool{}, calls: map[string]bool{}}
+	if proc.Body != nil {
+		tables.statements(proc.Body.Statements)
+	}
+	c.TablesRead = sortedKeys(tables.read)
+	c.TablesWritten = sortedKeys(tables.written)
+	c.Calls = sortedKeys(tables.calls)
+
+	t.currentContract = c
+	t.contracts = append(t.contracts, c)
+	return nil
+}
+
+// recordResultSet adds a result set to the current procedure's contract.
+func (t *transpiler) recordResultSet(columns []ContractColumn) {
+	if t.currentContract == nil || len(columns) == 0 {
+		return
+	}
+	t.currentContract.ResultSets = append(t.currentContract.ResultSets, ContractResultSet{Columns: columns})
+}
+
+// tableAccess collects the permanent tables a procedure reads and writes,
+// and the procedures it calls. Temp tables and table variables are internal
+// to the procedure and omitted.
+type tableAccess struct {
+	read    map[string]bool
+	written map[string]bool
+	calls   map[string]bool
+	ctes    map[string]bool
+	temp    bool // A temp table or table variable was referenced
+}
+
+func (ta *tableAccess) statements(stmts []ast.Statement) {
+	for _, stmt := range stmts {
+		ta.statement(stmt)
+	}
+}
+
+func (ta *tableAccess) statement(stmt ast.Statement) {
+	switch s := stmt.(type) {
+	case *ast.SelectStatement:
+		ta.selectStmt(s)
+	case *ast.InsertStatement:
+		ta.add(ta.written, s.Table)
+		if s.Select != nil {
+			ta.selectStmt(s.Select)
+		}
+	case *ast.UpdateStatement:
+		ta.addTarget(s.Table, s.From)
+		ta.from(s.From)
+		ta.expr(s.Where)
+	case *ast.DeleteStatement:
+		ta.addTarget(s.Table, s.From)
+		ta.from(s.From)
+		ta.expr(s.Where)
+	case *ast.MergeStatement:
+		ta.add(ta.written, s.Target)
+		ta.tableRef(s.Source)
+	case *ast.TruncateTableStatement:
+		ta.add(ta.written, s.Table)
+	case *ast.ExecStatement:
+		if s.Procedure != nil && ta.calls != nil {
+			ta.calls[unqualifiedName(s.Procedure.String())] = true
+		}
+	case *ast.WithStatement:
+		if ta.ctes == nil {
+			ta.ctes = map[string]bool{}
+		}
+		for _, cte := range s.CTEs {
+			ta.ctes[strings.ToLower(cte.Name.Value)] = true
+			if cte.Query != nil {
+				ta.selectStmt(cte.Query)
+			}
+		}
+		ta.statement(s.Query)
+	case *ast.DeclareCursorStatement:
+		ta.selectStmt(s.ForSelect)
+	case *ast.IfStatement:
+		ta.expr(s.Condition)
+		ta.statement(s.Consequence)
+		if s.Alternative != nil {
+			ta.statement(s.Alternative)
+		}
+	case *ast.WhileStatement:
+		ta.expr(s.Condition)
+		ta.statement(s.Body)
+	case *ast.BeginEndBlock:
+		ta.statements(s.Statements)
+	case *ast.TryCatchStatement:
+		if s.TryBlock != nil {
+			ta.statements(s.TryBlock.Statements)
+		}
+		if s.CatchBlock != nil {
+			ta.statements(s.CatchBlock.Statements)
+		}
+	}
+}
+
+func (ta *tableAccess) selectStmt(s *ast.SelectStatement) {
+	if s == nil {
+		return
+	}
+	ta.from(s.From)
+	ta.expr(s.Where)
+	for _, col := range s.Columns {
+		ta.expr(col.Expression)
+	}
+	if s.Union != nil {
+		ta.selectStmt(s.Union.Right)
+	}
+}
+
+func (ta *tableAccess) from(from *ast.FromClause) {
+	if from == nil {
+		return
+	}
+	for _, ref := range from.Tables {
+		ta.tableRef(ref)
+	}
+}
+
+func (ta *tableAccess) tableRef(ref ast.TableReference) {
+	switch r := ref.(type) {
+	case *ast.TableName:
+		ta.add(ta.read, r.Name)
+	case *ast.JoinClause:
+		ta.tableRef(r.Left)
+		ta.tableRef(r.Right)
+		ta.expr(r.Condition)
+	case *ast.DerivedTable:
+		ta.selectStmt(r.Subquery)
+	}
+}
+
+// expr finds subqueries inside predicates (EXISTS, IN, scalar subqueries).
+func (ta *tableAccess) expr(e ast.Expression) {
+	switch x := e.(type) {
+	case *ast.ExistsExpression:
+		ta.selectStmt(x.Subquery)
+	case *ast.SubqueryExpression:
+		ta.selectStmt(x.Subquery)
+	case *ast.InExpression:
+		ta.selectStmt(x.Subquery)
+	case *ast.InfixExpression:
+		ta.expr(x.Left)
+		ta.expr(x.Right)
+	case *ast.PrefixExpression:
+		ta.expr(x.Right)
+	}
+}
+
+// addTarget records the target of an UPDATE/DELETE, resolving an alias
+// against the FROM clause (UPDATE o SET ... FROM Orders o).
+func (ta *tableAccess) addTarget(target *ast.QualifiedIdentifier, from *ast.FromClause) {
+	if target == nil {
+		return
+	}
+	if from != nil {
+		if name := aliasedTable(from.Tables, target.String()); name != nil {
+			ta.add(ta.written, name)
+			return
+		}
+	}
+	ta.add(ta.written, target)
+}
+
+func aliasedTable(refs []ast.TableReference, alias string) *ast.QualifiedIdentifier {
+	for _, ref := range refs {
+		switch r := ref.(type) {
+		case *ast.TableName:
+			if r.Alias != nil && strings.EqualFold(r.Alias.Value, alias) {
+				return r.Name
+			}
+		case *ast.JoinClause:
+			if name := aliasedTable([]ast.TableReference{r.Left, r.Right}, alias); name != nil {
+				return name
+			}
+		}
+	}
+	return nil
+}
+
+func (ta *tableAccess) add(set map[string]bool, name *ast.QualifiedIdentifier) {
+	if name == nil {
+		return
+	}
+	table := name.String()
+	if strings.HasPrefix(table, "#") || strings.HasPrefix(table, "@") {
+		ta.temp = true
+		return
+	}
+	if ta.ctes[strings.ToLower(table)] {
+		return
+	}
+	set[table] = true
+}
+
+func sortedKeys(m map[string]bool) []string {
+	if len(m) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// MarshalContractsJSON renders contracts as indented JSON.
+func MarshalContractsJSON(contracts []ProcedureContract) ([]byte, error) {
+	if contracts == nil {
+		contracts = []ProcedureContract{}
+	}
+	data, err := json.MarshalIndent(contracts, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// MarshalContractsYAML renders contracts as YAML. The structure is fixed
+// and shallow, so it is written directly rather than via a YAML library.
+func MarshalContractsYAML(contracts []ProcedureContract) []byte {
+	var b strings.Builder
+	if len(contracts) == 0 {
+		b.WriteString("[]\n")
+		return []byte(b.String())
+	}
+	for _, c := range contracts {
+		fmt.Fprintf(&b, "- name: %s\n", yamlString(c.Name))
+		fmt.Fprintf(&b, "  go_name: %s\n", yamlString(c.GoName))
+		writeYAMLParams(&b, "inputs", c.Inputs)
+		writeYAMLParams(&b, "outputs", c.Outputs)
+		fmt.Fprintf(&b, "  return_code: %t\n", c.ReturnCode)
+		if len(c.ResultSets) > 0 {
+			b.WriteString("  result_sets:\n")
+			for _, rs := range c.ResultSets {
+				b.WriteString("    - columns:\n")
+				for _, col := range rs.Columns {
+					fmt.Fprintf(&b, "        - name: %s\n", yamlString(col.Name))
+					fmt.Fprintf(&b, "          go_type: %s\n", yamlString(col.GoType))
+				}
+			}
+		}
+		writeYAMLList(&b, "tables_read", c.TablesRead)
+		writeYAMLList(&b, "tables_written", c.TablesWritten)
+		writeYAMLList(&b, "calls", c.Calls)
+	}
+	return []byte(b.String())
+}
+
+func writeYAMLParams(b *strings.Builder, key string, params []ContractParam) {
+	if len(params) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "  %s:\n", key)
+	for _, p := range params {
+		fmt.Fprintf(b, "    - name: %s\n", yamlString(p.Name))
+		fmt.Fprintf(b, "      go_name: %s\n", yamlString(p.GoName))
+		fmt.Fprintf(b, "      sql_type: %s\n", yamlString(p.SQLType))
+		fmt.Fprintf(b, "      go_type: %s\n", yamlString(p.GoType))
+		if p.Default != "" {
+			fmt.Fprintf(b, "      default: %s\n", yamlString(p.Default))
+		}
+	}
+}
+
+func writeYAMLList(b *strings.Builder, key string, items []string) {
+	if len(items) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "  %s:\n", key)
+	for _, item := range items {
+		fmt.Fprintf(b, "    - %s\n", yamlString(item))
+	}
+}
+
+// yamlString quotes a scalar when it could be misread as another YAML type
+// or contains indicator characters (*Repository, [dbo].[T], 'x', null).
+func yamlString(s string) string {
+	if s == "" {
+		return `""`
+	}
+	switch strings.ToLower(s) {
+	case "true", "false", "yes", "no", "null", "~":
+		return strconv.Quote(s)
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return strconv.Quote(s)
+	}
+	if strings.ContainsAny(s, ":#{}[],&*!|>'\"%@`") || strings.TrimSpace(s) != s {
+		return strconv.Quote(s)
+	}
+	return s
+}
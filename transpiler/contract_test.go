@@ -0,0 +1,114 @@
+package transpiler
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const contractSQL = `
+CREATE PROCEDURE dbo.usp_GetCustomerOrders
+    @CustomerID INT,
+    @Status NVARCHAR(20) = 'Open',
+    @Total DECIMAL(18,2) OUTPUT
+AS
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM Customers WHERE CustomerID = @CustomerID)
+        RETURN 1
+    SELECT o.OrderID, o.OrderDate, c.Name
+    FROM Orders o JOIN Customers c ON c.CustomerID = o.CustomerID
+    WHERE o.CustomerID = @CustomerID AND o.Status = @Status
+    SELECT @Total = SUM(Amount) FROM OrderLines WHERE CustomerID = @CustomerID
+    UPDATE o SET LastViewed = GETDATE() FROM Orders o WHERE o.CustomerID = @CustomerID
+    INSERT INTO #Seen (CustomerID) VALUES (@CustomerID)
+    INSERT INTO AuditLog (Msg) VALUES ('viewed')
+    RETURN 0
+END
+`
+
+func TestExtractContracts(t *testing.T) {
+	contracts, err := ExtractContracts(contractSQL, DefaultDMLConfig())
+	if err != nil {
+		t.Fatalf("ExtractContracts failed: %v", err)
+	}
+	if len(contracts) != 1 {
+		t.Fatalf("Expected 1 contract, got %d", len(contracts))
+	}
+	c := contracts[0]
+
+	if c.Name != "usp_GetCustomerOrders" || c.GoName != "UspGetCustomerOrders" {
+		t.Errorf("Unexpected names %q / %q", c.Name, c.GoName)
+	}
+	wantInputs := []ContractParam{
+		{Name: "CustomerID", GoName: "customerId", SQLType: "INT", GoType: "int32"},
+		{Name: "Status", GoName: "status", SQLType: "NVARCHAR(20)", GoType: "string", Default: "'Open'"},
+	}
+	if !reflect.DeepEqual(c.Inputs, wantInputs) {
+		t.Errorf("Inputs = %+v, want %+v", c.Inputs, wantInputs)
+	}
+	if len(c.Outputs) != 1 || c.Outputs[0].GoType != "decimal.Decimal" {
+		t.Errorf("Expected decimal.Decimal output Total, got %+v", c.Outputs)
+	}
+	if !c.ReturnCode {
+		t.Error("Expected return_code to be true")
+	}
+
+	// SELECT @Total = ... assigns a variable and is not a result set
+	if len(c.ResultSets) != 1 {
+		t.Fatalf("Expected 1 result set, got %+v", c.ResultSets)
+	}
+	wantCols := []ContractColumn{
+		{Name: "OrderID", GoType: "int64"},
+		{Name: "OrderDate", GoType: "time.Time"},
+		{Name: "Name", GoType: "string"},
+	}
+	if !reflect.DeepEqual(c.ResultSets[0].Columns, wantCols) {
+		t.Errorf("Columns = %+v, want %+v", c.ResultSets[0].Columns, wantCols)
+	}
+
+	// Temp tables are internal; UPDATE through an alias resolves to Orders
+	if want := []string{"Customers", "OrderLines", "Orders"}; !reflect.DeepEqual(c.TablesRead, want) {
+		t.Errorf("TablesRead = %v, want %v", c.TablesRead, want)
+	}
+	if want := []string{"AuditLog", "Orders"}; !reflect.DeepEqual(c.TablesWritten, want) {
+		t.Errorf("TablesWritten = %v, want %v", c.TablesWritten, want)
+	}
+}
+
+func TestMarshalContracts(t *testing.T) {
+	contracts, err := ExtractContracts(contractSQL, DefaultDMLConfig())
+	if err != nil {
+		t.Fatalf("ExtractContracts failed: %v", err)
+	}
+
+	data, err := MarshalContractsJSON(contracts)
+	if err != nil {
+		t.Fatalf("MarshalContractsJSON failed: %v", err)
+	}
+	var decoded []ProcedureContract
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("JSON does not round-trip: %v", err)
+	}
+	// ReturnsError describes the Go signature and is not serialized
+	for i := range contracts {
+		contracts[i].ReturnsError = false
+	}
+	if !reflect.DeepEqual(decoded, contracts) {
+		t.Errorf("JSON round-trip mismatch:\n%s", data)
+	}
+
+	yaml := string(MarshalContractsYAML(contracts))
+	for _, want := range []string{
+		"- name: usp_GetCustomerOrders\n",
+		"      default: \"'Open'\"\n",
+		"      sql_type: \"DECIMAL(18, 2)\"\n",
+		"  return_code: true\n",
+		"        - name: OrderDate\n          go_type: time.Time\n",
+		"  tables_written:\n    - AuditLog\n    - Orders\n",
+	} {
+		if !strings.Contains(yaml, want) {
+			t.Errorf("Expected %q in YAML:\n%s", want, yaml)
+		}
+	}
+}
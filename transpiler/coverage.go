@@ -0,0 +1,199 @@
+package transpiler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ha1tch/tsqlparser"
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// Statement coverage
+//
+// StatementCoverage transpiles a source without keeping the code and counts
+// how each statement fares, to judge a migration before committing to its
+// output:
+//
+//	handled  translated with no warning or TODO of its own
+//	todo     translated, but with a warning or a TODO left to finish by hand
+//	skipped  left out, as DDL that belongs in database migrations is
+//	failed   not translated: it, or a statement in it, is an error
+//
+// Statements are counted as the feature matrix counts them: at every
+// level, IF and WHILE and TRY/CATCH as well as what is in them, BEGIN/END
+// blocks and the CREATE PROCEDURE or FUNCTION around a body not at all.
+// Unlike a transpile, an error doesn't stop the file: the procedure it is
+// in is given up, with the statements after it counted as failed, and the
+// next top-level statement is transpiled.
+
+// FileCoverage is the statement coverage of a file.
+type FileCoverage struct {
+	File     string            `json:"file"`
+	Handled  int               `json:"handled"`
+	TODO     int               `json:"todo"`
+	Skipped  int               `json:"skipped"`
+	Failed   int               `json:"failed"`
+	Failures []CoverageFailure `json:"failures,omitempty"`
+	Error    string            `json:"error,omitempty"` // Why the file has no statements counted, such as parse errors
+}
+
+// CoverageFailure is a top-level statement that failed to transpile.
+type CoverageFailure struct {
+	Line       int    `json:"line,omitempty"`
+	Procedure  string `json:"procedure,omitempty"`
+	Statements int    `json:"statements"` // Counted as failed
+	Error      string `json:"error"`
+}
+
+// Statements returns how many statements c counted.
+func (c *FileCoverage) Statements() int {
+	return c.Handled + c.TODO + c.Skipped + c.Failed
+}
+
+// Percent returns the share of the statements handled, 0-100; 100 if there
+// are none.
+func (c *FileCoverage) Percent() float64 {
+	if c.Statements() == 0 {
+		return 100
+	}
+	return 100 * float64(c.Handled) / float64(c.Statements())
+}
+
+// StatementCoverage returns the statement coverage of source, read from
+// file, transpiled with config. The error is for a source that doesn't
+// parse; statements that fail to transpile are counted instead.
+func StatementCoverage(file, source, packageName string, config DMLConfig) (*FileCoverage, error) {
+	if config.ScriptName != "" || config.Backend == BackendProcedureCall {
+		return nil, fmt.Errorf("scripts and the procedure-call backend have no statement coverage")
+	}
+	program, errors := tsqlparser.Parse(stripGoStatements(source))
+	if len(errors) > 0 {
+		return nil, fmt.Errorf("parse errors:\n%s", strings.Join(errors, "\n"))
+	}
+	t := newDMLTranspiler(source, packageName, config)
+	c := &FileCoverage{File: file}
+	t.coverage = &coverageScan{file: c}
+	for _, stmt := range program.Statements {
+		counted, failed := c.Statements(), c.Failed
+		if _, err := t.transpileStatement(stmt); err != nil {
+			// Statements not reached count as failed too
+			c.Failed += max(0, coverageStatements(stmt)-(c.Statements()-counted))
+			name := ""
+			switch s := stmt.(type) {
+			case *ast.CreateProcedureStatement:
+				name = s.Name.String()
+			case *ast.CreateFunctionStatement:
+				name = s.Name.String()
+			}
+			c.Failures = append(c.Failures, CoverageFailure{
+				Line:       topLevelLine(stmt),
+				Procedure:  name,
+				Statements: c.Failed - failed,
+				Error:      err.Error(),
+			})
+			t.abandonProcedure()
+		}
+	}
+	return c, nil
+}
+
+// coverageScan counts statements for StatementCoverage. Each statement
+// being transpiled has a frame; a statement's own warnings, DDL warnings
+// and TODOs are those it added less those the statements in it added.
+type coverageScan struct {
+	file   *FileCoverage
+	frames []*coverageFrame
+}
+
+type coverageFrame struct {
+	stmt                          ast.Statement
+	warnings, ddlWarnings         int // When it started
+	innerWarnings, innerDDL, TODO int // Added by the statements in it
+}
+
+// coversStatement reports whether stmt is yet to be counted, rather than
+// passed on again by a wrapper such as transpileTimedStatement.
+func (t *transpiler) coversStatement(stmt ast.Statement) bool {
+	s := t.coverage
+	if s == nil {
+		return false
+	}
+	return len(s.frames) == 0 || s.frames[len(s.frames)-1].stmt != stmt
+}
+
+// transpileCoveredStatement transpiles stmt, counting its outcome.
+func (t *transpiler) transpileCoveredStatement(stmt ast.Statement) (string, error) {
+	s := t.coverage
+	frame := &coverageFrame{stmt: stmt, warnings: len(t.warnings), ddlWarnings: len(t.ddlWarnings)}
+	s.frames = append(s.frames, frame)
+	code, err := t.transpileStatement(stmt)
+	s.frames = s.frames[:len(s.frames)-1]
+
+	warnings := len(t.warnings) - frame.warnings
+	ddlWarnings := len(t.ddlWarnings) - frame.ddlWarnings
+	todos := strings.Count(code, "TODO")
+	if len(s.frames) > 0 {
+		parent := s.frames[len(s.frames)-1]
+		parent.innerWarnings += warnings
+		parent.innerDDL += ddlWarnings
+		parent.TODO += todos
+	}
+	if !countsAsStatement(stmt) {
+		return code, err
+	}
+	switch {
+	case err != nil:
+		s.file.Failed++
+	case ddlWarnings > frame.innerDDL:
+		s.file.Skipped++
+	case warnings > frame.innerWarnings || todos > frame.TODO:
+		s.file.TODO++
+	default:
+		s.file.Handled++
+	}
+	return code, err
+}
+
+// countsAsStatement reports whether stmt is counted by itself, rather than
+// as the statements in it.
+func countsAsStatement(stmt ast.Statement) bool {
+	switch stmt.(type) {
+	case nil, *ast.BeginEndBlock, *ast.CreateProcedureStatement, *ast.CreateFunctionStatement:
+		return false
+	}
+	return true
+}
+
+// coverageStatements returns how many statements of stmt, a top-level
+// statement, StatementCoverage counts.
+func coverageStatements(stmt ast.Statement) int {
+	f := &featureScan{kinds: map[string]int{}}
+	switch s := stmt.(type) {
+	case *ast.CreateProcedureStatement:
+		if s.Body != nil {
+			f.statements(s.Body.Statements)
+		}
+	case *ast.CreateFunctionStatement:
+		if s.Body != nil {
+			f.statements(s.Body.Statements)
+		}
+	default:
+		f.statement(stmt)
+	}
+	n := 0
+	for _, count := range f.kinds {
+		n += count
+	}
+	return n
+}
+
+// abandonProcedure clears what a procedure that failed part way through
+// left set, so the next top-level statement is transpiled as one.
+func (t *transpiler) abandonProcedure() {
+	t.coverage.frames = nil
+	t.indent = 0
+	t.inProcBody = false
+	t.outputParams = nil
+	t.hasReturnCode = false
+	t.currentProcName = ""
+}
@@ -0,0 +1,61 @@
+package transpiler
+
+import (
+	"strings"
+	"testing"
+)
+
+const coverageSQL = `CREATE SEQUENCE dbo.OrderSeq START WITH 1;
+GO
+CREATE PROCEDURE dbo.usp_MergeStock @ProductID INT, @Qty INT
+AS
+BEGIN
+    SET NOCOUNT ON
+    MERGE Stock AS t
+    USING (SELECT @ProductID AS ProductID) AS s ON t.ProductID = s.ProductID
+    WHEN MATCHED THEN UPDATE SET Qty = t.Qty + @Qty
+    WHEN NOT MATCHED THEN INSERT (ProductID, Qty) VALUES (s.ProductID, @Qty);
+    IF @Qty > 100
+        PRINT 'large'
+    RETURN 0
+END
+GO
+CREATE PROCEDURE dbo.usp_GetOrderDates
+AS
+BEGIN
+    IF 1 = 1
+    BEGIN
+        SELECT FORMAT(OrderDate, 'd', 'de-DE') AS OrderDate FROM Orders
+    END
+    SELECT OrderID FROM Orders
+END
+`
+
+func TestStatementCoverage(t *testing.T) {
+	config := DefaultDMLConfig()
+	config.SkipDDL = true
+	c, err := StatementCoverage("orders.sql", coverageSQL, "main", config)
+	if err != nil {
+		t.Fatalf("StatementCoverage failed: %v", err)
+	}
+	// The sequence is skipped. usp_MergeStock fails at the MERGE after SET,
+	// leaving IF, PRINT and RETURN unreached. In usp_GetOrderDates the
+	// FORMAT is a TODO of the SELECT, not of the IF around it.
+	if c.Skipped != 1 || c.Failed != 4 || c.TODO != 1 || c.Handled != 3 {
+		t.Errorf("Expected 3 handled, 1 TODO, 1 skipped and 4 failed, got %+v", c)
+	}
+	if c.Statements() != 9 || int(c.Percent()) != 33 {
+		t.Errorf("Expected 9 statements, 33%% handled, got %d, %.1f%%", c.Statements(), c.Percent())
+	}
+	if len(c.Failures) != 1 {
+		t.Fatalf("Expected one failure, got %+v", c.Failures)
+	}
+	f := c.Failures[0]
+	if f.Line != 3 || f.Procedure != "dbo.usp_MergeStock" || f.Statements != 4 || !strings.Contains(f.Error, "MergeStatement") {
+		t.Errorf("Expected usp_MergeStock on line 3 with 4 statements failed, got %+v", f)
+	}
+
+	if _, err := StatementCoverage("bad.sql", "SELECT * FROM (", "main", config); err == nil {
+		t.Error("Expected an error for a source that doesn't parse")
+	}
+}
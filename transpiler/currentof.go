@@ -0,0 +1,209 @@
+package transpiler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// WHERE CURRENT OF
+//
+// UPDATE and DELETE ... WHERE CURRENT OF c change the row the cursor is
+// on. Go's rows have no position in the table, so the cursor's query also
+// selects the key columns of its table, each FETCH keeps them in a
+// variable, and the statement becomes WHERE key = that variable:
+//
+//	DECLARE c CURSOR FOR SELECT Price FROM Products
+//	UPDATE Products SET Price = 0 WHERE CURRENT OF c
+//
+//	SELECT Price, ProductID FROM Products               (scanned into &price, &cKeyProductId)
+//	UPDATE Products SET Price = $1 WHERE ProductID = $2 (0, cKeyProductId)
+//
+// The keys are the table's primary key when the source creates it or
+// DMLConfig.KeyColumns names it, else its identity column, else a selected
+// column called ID, <Table>ID or <Singular>ID.
+
+// keyColumnsIn returns the primary key columns of every CREATE TABLE in
+// program, by table.
+func keyColumnsIn(program *ast.Program) map[string][]string {
+	tables := map[string][]string{}
+	if program == nil {
+		return tables
+	}
+	for _, stmt := range program.Statements {
+		create, ok := stmt.(*ast.CreateTableStatement)
+		if !ok || create.IsTemporary || create.Name == nil || len(create.Name.Parts) == 0 {
+			continue
+		}
+		table := create.Name.Parts[len(create.Name.Parts)-1].Value
+		for _, col := range create.Columns {
+			for _, c := range col.Constraints {
+				if c.IsPrimaryKey || c.Type == ast.ConstraintPrimaryKey {
+					tables[table] = append(tables[table], col.Name.Value)
+				}
+			}
+		}
+		for _, c := range create.Constraints {
+			if c.Type == ast.ConstraintPrimaryKey {
+				for _, col := range c.Columns {
+					tables[table] = append(tables[table], col.Name.Value)
+				}
+			}
+		}
+	}
+	return tables
+}
+
+func (t *transpiler) collectKeyColumns(program *ast.Program) {
+	t.keyColumns = map[string][]string{}
+	t.addKeyColumns(t.dmlConfig.KeyColumns)
+	t.addKeyColumns(keyColumnsIn(program))
+}
+
+func (t *transpiler) addKeyColumns(tables map[string][]string) {
+	for table, cols := range tables {
+		if len(cols) > 0 {
+			t.keyColumns[strings.ToLower(unqualifiedName(table))] = cols
+		}
+	}
+}
+
+// currentOfCursorsIn returns the cursors named by WHERE CURRENT OF in
+// body, by lower-cased name.
+func currentOfCursorsIn(body *ast.BeginEndBlock) map[string]bool {
+	cursors := map[string]bool{}
+	forEachStatement(body, func(stmt ast.Statement) {
+		switch s := stmt.(type) {
+		case *ast.UpdateStatement:
+			if s.CurrentOfCursor != nil {
+				cursors[strings.ToLower(s.CurrentOfCursor.Value)] = true
+			}
+		case *ast.DeleteStatement:
+			if s.CurrentOfCursor != nil {
+				cursors[strings.ToLower(s.CurrentOfCursor.Value)] = true
+			}
+		}
+	})
+	return cursors
+}
+
+// addCursorKeys adds the key columns of the cursor's table to the end of
+// its query, for WHERE CURRENT OF, and names the variables holding them.
+func (t *transpiler) addCursorKeys(cursor *cursorInfo) error {
+	query := cursor.query
+	if query == nil || query.From == nil || len(query.From.Tables) != 1 {
+		return fmt.Errorf("WHERE CURRENT OF %s: the cursor's query must read one table", cursor.name)
+	}
+	from, ok := query.From.Tables[0].(*ast.TableName)
+	if !ok || from.Name == nil || len(from.Name.Parts) == 0 {
+		return fmt.Errorf("WHERE CURRENT OF %s: the cursor's query must read one table", cursor.name)
+	}
+	table := from.Name.Parts[len(from.Name.Parts)-1].Value
+	keys := t.cursorKeyColumns(table, query)
+	if len(keys) == 0 {
+		return fmt.Errorf("WHERE CURRENT OF %s: no key is known for %s; select its key column in the cursor, create the table in the source or set DMLConfig.KeyColumns", cursor.name, table)
+	}
+
+	extended := *query
+	extended.Columns = append([]ast.SelectColumn{}, query.Columns...)
+	qualifier := table
+	if from.Alias != nil {
+		qualifier = from.Alias.Value
+	}
+	cursor.keyIndex = len(query.Columns)
+	cursor.keyColumns = keys
+	cursor.keyVars = nil
+	for _, key := range keys {
+		extended.Columns = append(extended.Columns, ast.SelectColumn{
+			Expression: &ast.QualifiedIdentifier{Parts: []*ast.Identifier{{Value: qualifier}, {Value: key}}},
+		})
+		cursor.keyVars = append(cursor.keyVars, goIdentifier(cursor.name+"_key_"+key))
+	}
+	cursor.query = &extended
+	return nil
+}
+
+// cursorKeyColumns returns the key columns of table, or nil.
+func (t *transpiler) cursorKeyColumns(table string, query *ast.SelectStatement) []string {
+	if keys := t.keyColumns[strings.ToLower(table)]; len(keys) > 0 {
+		return keys
+	}
+	for col, kind := range t.generatedColumns[strings.ToLower(table)] {
+		if kind == GeneratedIdentity {
+			return []string{col}
+		}
+	}
+	dt := &dmlTranspiler{transpiler: t, config: t.dmlConfig}
+	for _, name := range []string{"ID", table + "ID", singularTableName(table) + "ID"} {
+		for _, col := range query.Columns {
+			if col.Expression != nil && strings.EqualFold(dt.extractColumnName(col.Expression), name) {
+				return []string{dt.extractColumnName(col.Expression)}
+			}
+		}
+	}
+	return nil
+}
+
+// declareCursorKeys returns the declarations of the variables holding
+// the cursor's current keys, or "".
+func (t *transpiler) declareCursorKeys(cursor *cursorInfo) string {
+	var out strings.Builder
+	for _, v := range cursor.keyVars {
+		out.WriteString(fmt.Sprintf("\n%svar %s any // Key of the current row, for WHERE CURRENT OF", t.indentStr(), v))
+		t.symbols.define(v, &typeInfo{goType: "any"})
+		t.symbols.markDeclared(v)
+	}
+	return out.String()
+}
+
+// currentOfWhere returns the WHERE clause matching the keys of the row
+// the cursor called name is on.
+func (t *transpiler) currentOfWhere(name *ast.Identifier) (ast.Expression, error) {
+	cursor, ok := t.cursors[name.Value]
+	if !ok {
+		return nil, fmt.Errorf("WHERE CURRENT OF %s: cursor not declared", name.Value)
+	}
+	if len(cursor.keyVars) == 0 {
+		return nil, fmt.Errorf("WHERE CURRENT OF %s: the cursor's keys are not known", name.Value)
+	}
+	var where ast.Expression
+	for i, key := range cursor.keyColumns {
+		match := &ast.InfixExpression{
+			Left:     &ast.Identifier{Value: key},
+			Operator: "=",
+			Right:    &ast.Variable{Name: "@" + cursor.name + "_key_" + key},
+		}
+		t.symbols.markUsed(cursor.keyVars[i])
+		if where == nil {
+			where = match
+		} else {
+			where = &ast.InfixExpression{Left: where, Operator: "AND", Right: match}
+		}
+	}
+	return where, nil
+}
+
+// currentOfUpdate returns s with WHERE CURRENT OF replaced by its keys.
+func (dt *dmlTranspiler) currentOfUpdate(s *ast.UpdateStatement) (*ast.UpdateStatement, error) {
+	where, err := dt.currentOfWhere(s.CurrentOfCursor)
+	if err != nil {
+		return nil, err
+	}
+	keyed := *s
+	keyed.Where = where
+	keyed.CurrentOfCursor = nil
+	return &keyed, nil
+}
+
+// currentOfDelete returns s with WHERE CURRENT OF replaced by its keys.
+func (dt *dmlTranspiler) currentOfDelete(s *ast.DeleteStatement) (*ast.DeleteStatement, error) {
+	where, err := dt.currentOfWhere(s.CurrentOfCursor)
+	if err != nil {
+		return nil, err
+	}
+	keyed := *s
+	keyed.Where = where
+	keyed.CurrentOfCursor = nil
+	return &keyed, nil
+}
@@ -0,0 +1,707 @@
+package transpiler
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ha1tch/tgpiler/tsqlruntime"
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// Date functions
+//
+// In Go expressions DATEADD, DATEDIFF, DATEPART, DATENAME, EOMONTH and
+// FORMAT become time.Time arithmetic, inline where it matches T-SQL and
+// through tsqlruntime helpers where it doesn't: DATEADD by months clamps
+// to the end of the month, DATEDIFF counts boundaries, and DATEPART(week)
+// starts weeks on Sunday. Kept inside queries, they are rewritten for the
+// SQL dialect by normalizeDateSQL.
+
+// datepart returns the full name of the datepart argument of a date
+// function, such as "day" for DD.
+func datepart(fn string, arg ast.Expression) (string, error) {
+	raw := strings.Trim(arg.String(), "'\"[]")
+	name, ok := tsqlruntime.DatePartName(raw)
+	if !ok {
+		return "", fmt.Errorf("unsupported %s interval: %s", fn, raw)
+	}
+	return name, nil
+}
+
+// dateLiteralLayouts are the layouts of the date strings T-SQL reads the
+// same whatever the language and DATEFORMAT settings.
+var dateLiteralLayouts = []string{
+	"2006-01-02",
+	"20060102",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"20060102 15:04:05.999999999",
+}
+
+// dateLiteral returns a string literal compared with a date as a
+// time.Date in UTC, as DATEFROMPARTS builds dates.
+func (t *transpiler) dateLiteral(expr ast.Expression) (string, bool) {
+	lit, ok := expr.(*ast.StringLiteral)
+	if !ok {
+		return "", false
+	}
+	for _, layout := range dateLiteralLayouts {
+		v, err := time.Parse(layout, strings.TrimSpace(lit.Value))
+		if err != nil {
+			continue
+		}
+		t.imports["time"] = true
+		return fmt.Sprintf("time.Date(%d, time.%s, %d, %d, %d, %d, %d, time.UTC)",
+			v.Year(), v.Month(), v.Day(), v.Hour(), v.Minute(), v.Second(), v.Nanosecond()), true
+	}
+	return "", false
+}
+
+// transpileDateAdd converts DATEADD(interval, number, date).
+func (t *transpiler) transpileDateAdd(fc *ast.FunctionCall, args []string) (string, error) {
+	part, err := datepart("DATEADD", fc.Arguments[0])
+	if err != nil {
+		return "", err
+	}
+	number := t.intArg(fc.Arguments[1], args[1])
+	dateW := wrapForMethodCall(args[2])
+	t.imports["time"] = true
+	switch part {
+	case "year", "quarter", "month":
+		// Months clamp to the end of the month, which AddDate doesn't do
+		t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+		return fmt.Sprintf("tsqlruntime.DateAdd(%q, %s, %s)", part, number, args[2]), nil
+	case "day", "dayofyear", "weekday":
+		return fmt.Sprintf("%s.AddDate(0, 0, %s)", dateW, number), nil
+	case "week":
+		return fmt.Sprintf("%s.AddDate(0, 0, 7*%s)", dateW, number), nil
+	}
+	unit := map[string]string{
+		"hour":        "time.Hour",
+		"minute":      "time.Minute",
+		"second":      "time.Second",
+		"millisecond": "time.Millisecond",
+		"microsecond": "time.Microsecond",
+		"nanosecond":  "time.Nanosecond",
+	}[part]
+	if unit == "" {
+		return "", fmt.Errorf("unsupported DATEADD interval: %s", part)
+	}
+	return fmt.Sprintf("%s.Add(time.Duration(%s) * %s)", dateW, args[1], unit), nil
+}
+
+// transpileDateDiff emits a call to tsqlruntime.DateDiff, which counts
+// datepart boundaries the way T-SQL does rather than elapsed time.
+func (t *transpiler) transpileDateDiff(fn string, interval ast.Expression, start, end string) (string, error) {
+	part, err := datepart(fn, interval)
+	if err != nil {
+		return "", err
+	}
+	switch part {
+	case "weekday", "iso_week", "tzoffset":
+		return "", fmt.Errorf("unsupported %s interval: %s", fn, part)
+	}
+	t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+	if fn == "DATEDIFF_BIG" {
+		return fmt.Sprintf("func() int64 { n, _ := tsqlruntime.DateDiffBig(%q, %s, %s); return n }()", part, start, end), nil
+	}
+	return fmt.Sprintf("tsqlruntime.DateDiff(%q, %s, %s)", part, start, end), nil
+}
+
+// transpileDatePart converts DATEPART and DATENAME.
+func (t *transpiler) transpileDatePart(fn string, interval ast.Expression, date string) (string, error) {
+	part, err := datepart(fn, interval)
+	if err != nil {
+		return "", err
+	}
+	dateW := wrapForMethodCall(date)
+	if fn == "DATENAME" {
+		switch part {
+		case "month":
+			return dateW + ".Month().String()", nil
+		case "weekday":
+			return dateW + ".Weekday().String()", nil
+		}
+		t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+		return fmt.Sprintf("tsqlruntime.DateName(%q, %s)", part, date), nil
+	}
+
+	switch part {
+	case "year":
+		return fmt.Sprintf("int32(%s.Year())", dateW), nil
+	case "month":
+		return fmt.Sprintf("int32(%s.Month())", dateW), nil
+	case "day":
+		return fmt.Sprintf("int32(%s.Day())", dateW), nil
+	case "hour":
+		return fmt.Sprintf("int32(%s.Hour())", dateW), nil
+	case "minute":
+		return fmt.Sprintf("int32(%s.Minute())", dateW), nil
+	case "second":
+		return fmt.Sprintf("int32(%s.Second())", dateW), nil
+	case "weekday":
+		// T-SQL: Sunday=1, Monday=2, ... Saturday=7
+		// Go: Sunday=0, Monday=1, ... Saturday=6
+		return fmt.Sprintf("int32(%s.Weekday() + 1)", dateW), nil
+	case "dayofyear":
+		return fmt.Sprintf("int32(%s.YearDay())", dateW), nil
+	case "quarter":
+		return fmt.Sprintf("int32((%s.Month()-1)/3 + 1)", dateW), nil
+	}
+	t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+	return fmt.Sprintf("tsqlruntime.DatePart(%q, %s)", part, date), nil
+}
+
+// transpileFormat converts FORMAT(value, format [, culture]). Dates with a
+// literal format become a time.Format call with the equivalent Go layout.
+func (t *transpiler) transpileFormat(fc *ast.FunctionCall, args []string) (string, error) {
+	if len(args) > 2 {
+		t.warnings = append(t.warnings, fmt.Sprintf("%s: FORMAT culture %s is ignored; values are formatted for en-US",
+			t.currentProcName, fc.Arguments[2].String()))
+	}
+	lit, isLit := fc.Arguments[1].(*ast.StringLiteral)
+	ti := t.inferType(fc.Arguments[0])
+	isDate := ti.isDateTime || (!ti.isNumeric && isLit && !isNumericFormat(lit.Value))
+	if isDate {
+		if isLit {
+			return fmt.Sprintf("%s.Format(%q)", wrapForMethodCall(args[0]), tsqlruntime.DotNetLayout(lit.Value)), nil
+		}
+		t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+		return fmt.Sprintf("tsqlruntime.FormatDate(%s, %s)", args[0], args[1]), nil
+	}
+
+	value := fmt.Sprintf("float64(%s)", args[0])
+	if ti.isDecimal {
+		value = t.decimalToFloat(args[0])
+	} else if ti.goType == "float64" {
+		value = args[0]
+	}
+	t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+	return fmt.Sprintf("tsqlruntime.FormatNumber(%s, %s)", value, args[1]), nil
+}
+
+// isNumericFormat reports whether a FORMAT format string is for numbers,
+// such as 'N2' or '#,##0.00', rather than dates.
+func isNumericFormat(format string) bool {
+	if len(format) >= 1 && strings.ContainsRune("CcEeNnPpXx", rune(format[0])) &&
+		strings.Trim(format[1:], "0123456789") == "" {
+		return true
+	}
+	return strings.ContainsAny(format, "0#")
+}
+
+// sqlDateFuncs are the date functions normalizeDateSQL rewrites.
+var sqlDateFuncs = map[string]bool{
+	"DATEADD": true, "DATEDIFF": true, "DATEDIFF_BIG": true, "DATEPART": true, "DATENAME": true,
+	"YEAR": true, "MONTH": true, "DAY": true, "EOMONTH": true, "FORMAT": true,
+}
+
+// normalizeDateSQL rewrites the date functions in a query for the SQL
+// dialect. Calls it can't translate, such as FORMAT with a format held in
+// a variable, are kept with a warning.
+func (dt *dmlTranspiler) normalizeDateSQL(query string) string {
+	var dialect func(name string, args []string) (string, bool)
+	switch dt.config.SQLDialect {
+	case "postgres":
+		dialect = postgresDateSQL
+	case "mysql":
+		dialect = mysqlDateSQL
+	case "sqlite":
+		dialect = sqliteDateSQL
+	default:
+		return query
+	}
+	return rewriteSQLCalls(query, sqlDateFuncs, func(name string, args []string) (string, bool) {
+		switch name {
+		case "YEAR", "MONTH", "DAY":
+			if len(args) != 1 {
+				return "", false
+			}
+			name, args = "DATEPART", []string{strings.ToLower(name), args[0]}
+		case "EOMONTH":
+			if len(args) < 1 || len(args) > 2 {
+				return "", false
+			}
+			if len(args) == 1 {
+				args = append(args, "")
+			}
+		}
+		if out, ok := dialect(name, args); ok {
+			return out, true
+		}
+		dt.warn(RuleUntranslated, fmt.Sprintf("%s: %s(%s) has no %s translation; it is kept as it is",
+			dt.currentProcName, name, strings.Join(args, ", "), dt.config.SQLDialect))
+		return "", false
+	})
+}
+
+// sqlDateArgs returns the datepart and other arguments of a date function
+// call in a query, checking their number.
+func sqlDateArgs(args []string, n int) (string, []string, bool) {
+	if len(args) != n {
+		return "", nil, false
+	}
+	part, ok := tsqlruntime.DatePartName(strings.Trim(args[0], "'\"[]"))
+	return part, args[1:], ok
+}
+
+// sqlDateFormat converts a FORMAT call's format argument for a dialect,
+// with token converting each .NET format character run.
+func sqlDateFormat(args []string, token func(c byte, n int) (string, bool), literal func(string) string) (string, bool) {
+	if len(args) != 2 {
+		return "", false
+	}
+	format, ok := sqlUnquote(args[1])
+	if !ok || isNumericFormat(format) {
+		return "", false
+	}
+	return tsqlruntime.ConvertDotNetFormat(format, token, literal)
+}
+
+// pickToken chooses a conversion by how many times a format character is
+// repeated, the last one for longer runs.
+func pickToken(n int, tokens ...string) (string, bool) {
+	if n > len(tokens) {
+		n = len(tokens)
+	}
+	return tokens[n-1], tokens[n-1] != ""
+}
+
+// sqlVariableRe matches an operand that is a single variable.
+var sqlVariableRe = regexp.MustCompile(`^@[\pL_][\pL\pN_]*$`)
+
+// pgTimestamp casts a placeholder, or a variable to become one, to
+// timestamp, as Postgres can't infer its type in date arithmetic; other
+// operands are left as they are.
+func pgTimestamp(expr string) string {
+	if strings.HasPrefix(expr, "$") || sqlVariableRe.MatchString(expr) {
+		return expr + "::timestamp"
+	}
+	return sqlOperand(expr)
+}
+
+func postgresDateSQL(name string, args []string) (string, bool) {
+	extract := func(field, d string) string {
+		return fmt.Sprintf("EXTRACT(%s FROM %s)", field, d)
+	}
+	switch name {
+	case "DATEADD":
+		part, rest, ok := sqlDateArgs(args, 3)
+		unit := map[string]string{
+			"year": "1 year", "quarter": "3 months", "month": "1 month", "week": "1 week",
+			"day": "1 day", "dayofyear": "1 day", "weekday": "1 day", "hour": "1 hour",
+			"minute": "1 minute", "second": "1 second", "millisecond": "1 millisecond",
+			"microsecond": "1 microsecond",
+		}[part]
+		if !ok || unit == "" {
+			return "", false
+		}
+		return fmt.Sprintf("(%s + %s * INTERVAL '%s')", pgTimestamp(rest[1]), sqlOperand(rest[0]), unit), true
+
+	case "DATEDIFF", "DATEDIFF_BIG":
+		part, rest, ok := sqlDateArgs(args, 3)
+		if !ok {
+			return "", false
+		}
+		cast := "int"
+		if name == "DATEDIFF_BIG" {
+			cast = "bigint"
+		}
+		a, b := pgTimestamp(rest[0]), pgTimestamp(rest[1])
+		periods := func(field string, per int) string {
+			return fmt.Sprintf("((%s - %s) * %d + %s - %s)::%s", extract("YEAR", b), extract("YEAR", a), per,
+				extract(field, b), extract(field, a), cast)
+		}
+		truncated := func(unit string, seconds int) string {
+			return fmt.Sprintf("(EXTRACT(EPOCH FROM (DATE_TRUNC('%s', %s) - DATE_TRUNC('%s', %s))) / %d)::%s",
+				unit, b, unit, a, seconds, cast)
+		}
+		switch part {
+		case "year":
+			return fmt.Sprintf("(%s - %s)::%s", extract("YEAR", b), extract("YEAR", a), cast), true
+		case "quarter":
+			return periods("QUARTER", 4), true
+		case "month":
+			return periods("MONTH", 12), true
+		case "day", "dayofyear":
+			return fmt.Sprintf("(%s::date - %s::date)", b, a), true
+		case "week":
+			// Weeks start on Sunday
+			return fmt.Sprintf("(((%s::date - EXTRACT(DOW FROM %s)::int) - (%s::date - EXTRACT(DOW FROM %s)::int)) / 7)",
+				b, b, a, a), true
+		case "hour":
+			return truncated("hour", 3600), true
+		case "minute":
+			return truncated("minute", 60), true
+		case "second":
+			return truncated("second", 1), true
+		case "millisecond":
+			return fmt.Sprintf("(EXTRACT(EPOCH FROM (%s - %s)) * 1000)::%s", b, a, cast), true
+		case "microsecond":
+			return fmt.Sprintf("(EXTRACT(EPOCH FROM (%s - %s)) * 1000000)::bigint", b, a), true
+		}
+
+	case "DATEPART":
+		part, rest, ok := sqlDateArgs(args, 2)
+		if !ok {
+			return "", false
+		}
+		d := pgTimestamp(rest[0])
+		field := map[string]string{
+			"year": "YEAR", "quarter": "QUARTER", "month": "MONTH", "dayofyear": "DOY",
+			"day": "DAY", "hour": "HOUR", "minute": "MINUTE", "iso_week": "WEEK",
+		}[part]
+		switch {
+		case field != "":
+			return extract(field, d) + "::int", true
+		case part == "second":
+			return fmt.Sprintf("FLOOR(%s)::int", extract("SECOND", d)), true
+		case part == "weekday":
+			return fmt.Sprintf("(%s::int + 1)", extract("DOW", d)), true
+		case part == "week":
+			return fmt.Sprintf("((%s::int - 1 + EXTRACT(DOW FROM DATE_TRUNC('year', %s))::int) / 7 + 1)",
+				extract("DOY", d), d), true
+		case part == "millisecond":
+			return fmt.Sprintf("(%s::int %% 1000)", extract("MILLISECONDS", d)), true
+		case part == "microsecond":
+			return fmt.Sprintf("(%s::int %% 1000000)", extract("MICROSECONDS", d)), true
+		}
+
+	case "DATENAME":
+		part, rest, ok := sqlDateArgs(args, 2)
+		if !ok {
+			return "", false
+		}
+		switch part {
+		case "month":
+			return fmt.Sprintf("TO_CHAR(%s, 'FMMonth')", rest[0]), true
+		case "weekday":
+			return fmt.Sprintf("TO_CHAR(%s, 'FMDay')", rest[0]), true
+		}
+		if n, ok := postgresDateSQL("DATEPART", args); ok {
+			return fmt.Sprintf("CAST(%s AS TEXT)", n), true
+		}
+
+	case "EOMONTH":
+		d := pgTimestamp(args[0])
+		if args[1] == "" {
+			return fmt.Sprintf("(DATE_TRUNC('month', %s) + INTERVAL '1 month' - INTERVAL '1 day')::date", d), true
+		}
+		return fmt.Sprintf("(DATE_TRUNC('month', %s) + (%s + 1) * INTERVAL '1 month' - INTERVAL '1 day')::date",
+			d, sqlOperand(args[1])), true
+
+	case "FORMAT":
+		format, ok := sqlDateFormat(args, func(c byte, n int) (string, bool) {
+			switch c {
+			case 'y':
+				return pickToken(n, "YY", "YY", "YYYY")
+			case 'M':
+				return pickToken(n, "FMMM", "MM", "Mon", "FMMonth")
+			case 'd':
+				return pickToken(n, "FMDD", "DD", "Dy", "FMDay")
+			case 'H':
+				return pickToken(n, "FMHH24", "HH24")
+			case 'h':
+				return pickToken(n, "FMHH12", "HH12")
+			case 'm':
+				return pickToken(n, "FMMI", "MI")
+			case 's':
+				return pickToken(n, "FMSS", "SS")
+			case 'f':
+				return pickToken(n, "", "", "MS", "", "", "US")
+			case 't':
+				return "AM", true
+			}
+			return "", false
+		}, func(text string) string {
+			if strings.Trim(text, " -/:.,") == "" {
+				return text
+			}
+			return `"` + text + `"`
+		})
+		if ok {
+			return fmt.Sprintf("TO_CHAR(%s, %s)", args[0], sqlQuote(format)), true
+		}
+	}
+	return "", false
+}
+
+func mysqlDateSQL(name string, args []string) (string, bool) {
+	switch name {
+	case "DATEADD":
+		part, rest, ok := sqlDateArgs(args, 3)
+		unit := map[string]string{
+			"year": "YEAR", "quarter": "QUARTER", "month": "MONTH", "week": "WEEK", "day": "DAY",
+			"dayofyear": "DAY", "weekday": "DAY", "hour": "HOUR", "minute": "MINUTE", "second": "SECOND",
+			"microsecond": "MICROSECOND",
+		}[part]
+		if ok && part == "millisecond" {
+			return fmt.Sprintf("DATE_ADD(%s, INTERVAL %s * 1000 MICROSECOND)", rest[1], sqlOperand(rest[0])), true
+		}
+		if !ok || unit == "" {
+			return "", false
+		}
+		return fmt.Sprintf("DATE_ADD(%s, INTERVAL %s %s)", rest[1], rest[0], unit), true
+
+	case "DATEDIFF", "DATEDIFF_BIG":
+		part, rest, ok := sqlDateArgs(args, 3)
+		if !ok {
+			return "", false
+		}
+		a, b := rest[0], rest[1]
+		periods := func(fn string, per int) string {
+			return fmt.Sprintf("((YEAR(%s) - YEAR(%s)) * %d + %s(%s) - %s(%s))", b, a, per, fn, b, fn, a)
+		}
+		truncated := func(unit, format string) string {
+			return fmt.Sprintf("TIMESTAMPDIFF(%s, DATE_FORMAT(%s, '%s'), DATE_FORMAT(%s, '%s'))", unit, a, format, b, format)
+		}
+		switch part {
+		case "year":
+			return fmt.Sprintf("(YEAR(%s) - YEAR(%s))", b, a), true
+		case "quarter":
+			return periods("QUARTER", 4), true
+		case "month":
+			return periods("MONTH", 12), true
+		case "day", "dayofyear":
+			return fmt.Sprintf("DATEDIFF(%s, %s)", b, a), true
+		case "week":
+			// Weeks start on Sunday
+			return fmt.Sprintf("((DATEDIFF(%s, %s) + DAYOFWEEK(%s) - DAYOFWEEK(%s)) DIV 7)", b, a, a, b), true
+		case "hour":
+			return truncated("HOUR", "%Y-%m-%d %H:00:00"), true
+		case "minute":
+			return truncated("MINUTE", "%Y-%m-%d %H:%i:00"), true
+		case "second":
+			return fmt.Sprintf("TIMESTAMPDIFF(SECOND, %s, %s)", a, b), true
+		case "millisecond":
+			return fmt.Sprintf("(TIMESTAMPDIFF(MICROSECOND, %s, %s) DIV 1000)", a, b), true
+		case "microsecond":
+			return fmt.Sprintf("TIMESTAMPDIFF(MICROSECOND, %s, %s)", a, b), true
+		}
+
+	case "DATEPART":
+		part, rest, ok := sqlDateArgs(args, 2)
+		if !ok {
+			return "", false
+		}
+		d := rest[0]
+		fn := map[string]string{
+			"year": "YEAR", "month": "MONTH", "day": "DAY", "quarter": "QUARTER", "dayofyear": "DAYOFYEAR", "hour": "HOUR", "minute": "MINUTE",
+			"second": "SECOND", "weekday": "DAYOFWEEK", "microsecond": "MICROSECOND",
+		}[part]
+		switch {
+		case fn != "":
+			return fmt.Sprintf("%s(%s)", fn, d), true
+		case part == "week":
+			return fmt.Sprintf("((DAYOFYEAR(%s) - 1 + DAYOFWEEK(MAKEDATE(YEAR(%s), 1)) - 1) DIV 7 + 1)", d, d), true
+		case part == "iso_week":
+			return fmt.Sprintf("WEEK(%s, 3)", d), true
+		case part == "millisecond":
+			return fmt.Sprintf("(MICROSECOND(%s) DIV 1000)", d), true
+		}
+
+	case "DATENAME":
+		part, rest, ok := sqlDateArgs(args, 2)
+		if !ok {
+			return "", false
+		}
+		switch part {
+		case "month":
+			return fmt.Sprintf("MONTHNAME(%s)", rest[0]), true
+		case "weekday":
+			return fmt.Sprintf("DAYNAME(%s)", rest[0]), true
+		}
+		if n, ok := mysqlDateSQL("DATEPART", args); ok {
+			return fmt.Sprintf("CAST(%s AS CHAR)", n), true
+		}
+
+	case "EOMONTH":
+		if args[1] == "" {
+			return fmt.Sprintf("LAST_DAY(%s)", args[0]), true
+		}
+		return fmt.Sprintf("LAST_DAY(DATE_ADD(%s, INTERVAL %s MONTH))", args[0], args[1]), true
+
+	case "FORMAT":
+		format, ok := sqlDateFormat(args, func(c byte, n int) (string, bool) {
+			switch c {
+			case 'y':
+				return pickToken(n, "%y", "%y", "%Y")
+			case 'M':
+				return pickToken(n, "%c", "%m", "%b", "%M")
+			case 'd':
+				return pickToken(n, "%e", "%d", "%a", "%W")
+			case 'H':
+				return pickToken(n, "%k", "%H")
+			case 'h':
+				return pickToken(n, "%l", "%h")
+			case 'm':
+				return "%i", n == 2
+			case 's':
+				return "%s", n == 2
+			case 'f':
+				return "%f", n == 6
+			case 't':
+				return "%p", true
+			}
+			return "", false
+		}, func(text string) string { return strings.ReplaceAll(text, "%", "%%") })
+		if ok {
+			return fmt.Sprintf("DATE_FORMAT(%s, %s)", args[0], sqlQuote(format)), true
+		}
+		// MySQL's own FORMAT(x, d) groups thousands, as 'N' does
+		if len(args) == 2 {
+			if f, ok := sqlUnquote(args[1]); ok && len(f) >= 1 && (f[0] == 'N' || f[0] == 'n') {
+				decimals := f[1:]
+				if decimals == "" {
+					decimals = "2"
+				}
+				return fmt.Sprintf("FORMAT(%s, %s)", args[0], decimals), true
+			}
+		}
+	}
+	return "", false
+}
+
+func sqliteDateSQL(name string, args []string) (string, bool) {
+	strftime := func(format, d string) string {
+		return fmt.Sprintf("CAST(strftime('%s', %s) AS INTEGER)", format, d)
+	}
+	switch name {
+	case "DATEADD":
+		part, rest, ok := sqlDateArgs(args, 3)
+		if !ok {
+			return "", false
+		}
+		n := sqlOperand(rest[0])
+		unit := map[string]string{
+			"year": "years", "month": "months", "day": "days", "dayofyear": "days", "weekday": "days",
+			"hour": "hours", "minute": "minutes", "second": "seconds",
+		}[part]
+		switch part {
+		case "quarter":
+			n, unit = "("+n+" * 3)", "months"
+		case "week":
+			n, unit = "("+n+" * 7)", "days"
+		case "millisecond":
+			n, unit = "("+n+" / 1000.0)", "seconds"
+		}
+		if unit == "" {
+			return "", false
+		}
+		if lit, err := strconv.Atoi(n); err == nil {
+			return fmt.Sprintf("datetime(%s, '%+d %s')", rest[1], lit, unit), true
+		}
+		return fmt.Sprintf("datetime(%s, %s || ' %s')", rest[1], n, unit), true
+
+	case "DATEDIFF", "DATEDIFF_BIG":
+		part, rest, ok := sqlDateArgs(args, 3)
+		if !ok {
+			return "", false
+		}
+		a, b := rest[0], rest[1]
+		years := fmt.Sprintf("(%s - %s)", strftime("%Y", b), strftime("%Y", a))
+		julian := func(format string, per int) string {
+			return fmt.Sprintf("CAST(ROUND((julianday(strftime('%s', %s)) - julianday(strftime('%s', %s))) * %d) AS INTEGER)",
+				format, b, format, a, per)
+		}
+		switch part {
+		case "year":
+			return years, true
+		case "quarter":
+			return fmt.Sprintf("(%s * 4 + (%s + 2) / 3 - (%s + 2) / 3)", years, strftime("%m", b), strftime("%m", a)), true
+		case "month":
+			return fmt.Sprintf("(%s * 12 + %s - %s)", years, strftime("%m", b), strftime("%m", a)), true
+		case "day", "dayofyear":
+			return julian("%Y-%m-%d", 1), true
+		case "week":
+			// Weeks start on Sunday
+			return fmt.Sprintf("CAST(ROUND((julianday(date(%s, '-' || strftime('%%w', %s) || ' days')) - julianday(date(%s, '-' || strftime('%%w', %s) || ' days'))) / 7) AS INTEGER)",
+				b, b, a, a), true
+		case "hour":
+			return julian("%Y-%m-%d %H:00:00", 24), true
+		case "minute":
+			return julian("%Y-%m-%d %H:%M:00", 1440), true
+		case "second":
+			return fmt.Sprintf("(%s - %s)", strftime("%s", b), strftime("%s", a)), true
+		}
+
+	case "DATEPART":
+		part, rest, ok := sqlDateArgs(args, 2)
+		if !ok {
+			return "", false
+		}
+		d := rest[0]
+		format := map[string]string{
+			"year": "%Y", "month": "%m", "day": "%d", "dayofyear": "%j", "hour": "%H", "minute": "%M", "second": "%S",
+		}[part]
+		switch {
+		case format != "":
+			return strftime(format, d), true
+		case part == "weekday":
+			return fmt.Sprintf("(%s + 1)", strftime("%w", d)), true
+		case part == "quarter":
+			return fmt.Sprintf("((%s + 2) / 3)", strftime("%m", d)), true
+		case part == "week":
+			return fmt.Sprintf("((%s - 1 + CAST(strftime('%%w', strftime('%%Y-01-01', %s)) AS INTEGER)) / 7 + 1)",
+				strftime("%j", d), d), true
+		}
+
+	case "DATENAME":
+		part, rest, ok := sqlDateArgs(args, 2)
+		if !ok {
+			return "", false
+		}
+		var names []string
+		var format string
+		switch part {
+		case "month":
+			format = "%m"
+			for m := time.January; m <= time.December; m++ {
+				names = append(names, fmt.Sprintf("WHEN '%02d' THEN '%s'", int(m), m))
+			}
+		case "weekday":
+			format = "%w"
+			for d := time.Sunday; d <= time.Saturday; d++ {
+				names = append(names, fmt.Sprintf("WHEN '%d' THEN '%s'", int(d), d))
+			}
+		default:
+			if n, ok := sqliteDateSQL("DATEPART", args); ok {
+				return fmt.Sprintf("CAST(%s AS TEXT)", n), true
+			}
+			return "", false
+		}
+		return fmt.Sprintf("CASE strftime('%s', %s) %s END", format, rest[0], strings.Join(names, " ")), true
+
+	case "EOMONTH":
+		if args[1] == "" {
+			return fmt.Sprintf("date(%s, 'start of month', '+1 month', '-1 day')", args[0]), true
+		}
+		return fmt.Sprintf("date(%s, 'start of month', (%s + 1) || ' months', '-1 day')", args[0], sqlOperand(args[1])), true
+
+	case "FORMAT":
+		format, ok := sqlDateFormat(args, func(c byte, n int) (string, bool) {
+			switch c {
+			case 'y':
+				return "%Y", n == 4
+			case 'M':
+				return "%m", n == 2
+			case 'd':
+				return "%d", n == 2
+			case 'H':
+				return "%H", n == 2
+			case 'm':
+				return "%M", n == 2
+			case 's':
+				return "%S", n == 2
+			}
+			return "", false
+		}, func(text string) string { return strings.ReplaceAll(text, "%", "%%") })
+		if ok {
+			return fmt.Sprintf("strftime(%s, %s)", sqlQuote(format), args[0]), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,389 @@
+package transpiler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// Decimal modes
+//
+// DECIMAL, NUMERIC and MONEY map to one of:
+//
+//   - shopspring: github.com/shopspring/decimal's decimal.Decimal (default)
+//   - string: strings such as "12.50", as drivers return them, with exact
+//     arithmetic done by tsqlruntime.DecimalAdd and friends
+//   - float: float64, which may lose precision; a warning says so
+//   - apd: github.com/cockroachdb/apd/v3's apd.Decimal, with arithmetic in
+//     a 38 digit context, SQL Server's largest precision
+//
+// Code generating decimal values and arithmetic goes through the methods
+// below rather than writing decimal.Decimal calls itself.
+const (
+	DecimalShopspring = "shopspring"
+	DecimalString     = "string"
+	DecimalFloat      = "float"
+	DecimalAPD        = "apd"
+)
+
+const (
+	shopspringImport = "github.com/shopspring/decimal"
+	apdImport        = "github.com/cockroachdb/apd/v3"
+	apdContext       = "apd.BaseContext.WithPrecision(38)"
+)
+
+// decimalMode returns the decimal mode in effect.
+func (t *transpiler) decimalMode() string {
+	if t.dmlConfig.DecimalMode == "" {
+		return DecimalShopspring
+	}
+	return t.dmlConfig.DecimalMode
+}
+
+// decimalType returns the Go type of decimal values, without importing
+// its package.
+func (t *transpiler) decimalType() string {
+	switch t.decimalMode() {
+	case DecimalString:
+		return "string"
+	case DecimalFloat:
+		return "float64"
+	case DecimalAPD:
+		return "apd.Decimal"
+	}
+	return "decimal.Decimal"
+}
+
+// useDecimalType returns the Go type of decimal values, importing its
+// package. In float mode it records that precision may be lost.
+func (t *transpiler) useDecimalType() string {
+	if t.decimalMode() == DecimalFloat && !t.decimalWarned {
+		t.decimalWarned = true
+		t.warnings = append(t.warnings, "DECIMAL, NUMERIC and MONEY values are float64 (--decimal-mode=float) and may lose precision")
+	}
+	t.importDecimal()
+	return t.decimalType()
+}
+
+// importDecimal imports the package of the decimal type, if it has one.
+func (t *transpiler) importDecimal() {
+	switch t.decimalMode() {
+	case DecimalShopspring:
+		t.imports[shopspringImport] = true
+	case DecimalAPD:
+		t.imports[apdImport] = true
+	}
+}
+
+// decimalInfo returns the typeInfo of decimal values. Float decimals are
+// plain float64 values.
+func (t *transpiler) decimalInfo() *typeInfo {
+	if t.decimalMode() == DecimalFloat {
+		return &typeInfo{goType: "float64", isNumeric: true}
+	}
+	return &typeInfo{goType: t.decimalType(), isDecimal: true, isNumeric: true}
+}
+
+// isDecimalType reports whether goType is the decimal type.
+func (t *transpiler) isDecimalType(goType string) bool {
+	return t.decimalMode() != DecimalString && t.decimalMode() != DecimalFloat && goType == t.decimalType()
+}
+
+// decimalZero returns the decimal zero.
+func (t *transpiler) decimalZero() string {
+	t.importDecimal()
+	switch t.decimalMode() {
+	case DecimalString:
+		return `"0"`
+	case DecimalFloat:
+		return "0.0"
+	case DecimalAPD:
+		return "apd.Decimal{}"
+	}
+	return "decimal.Zero"
+}
+
+// decimalLiteral returns the decimal for numeric literal text such as 1.50.
+func (t *transpiler) decimalLiteral(lit string) string {
+	t.importDecimal()
+	switch t.decimalMode() {
+	case DecimalString:
+		return strconv.Quote(lit)
+	case DecimalFloat:
+		return lit
+	case DecimalAPD:
+		if coeff, exp, ok := splitDecimalLiteral(lit); ok {
+			return fmt.Sprintf("*apd.New(%d, %d)", coeff, exp)
+		}
+		return t.decimalParse(strconv.Quote(lit))
+	}
+	return fmt.Sprintf("decimal.RequireFromString(%q)", lit)
+}
+
+// splitDecimalLiteral splits 1.50 into the coefficient 150 and exponent -2.
+func splitDecimalLiteral(lit string) (int64, int32, bool) {
+	whole, frac, _ := strings.Cut(lit, ".")
+	coeff, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return coeff, -int32(len(frac)), true
+}
+
+// decimalFromInt returns the decimal for expr, an int64 or an integer
+// literal.
+func (t *transpiler) decimalFromInt(expr string) string {
+	t.importDecimal()
+	switch t.decimalMode() {
+	case DecimalString:
+		if _, err := strconv.ParseInt(expr, 10, 64); err == nil {
+			return strconv.Quote(expr)
+		}
+		t.imports["strconv"] = true
+		return fmt.Sprintf("strconv.FormatInt(%s, 10)", expr)
+	case DecimalFloat:
+		return fmt.Sprintf("float64(%s)", expr)
+	case DecimalAPD:
+		return fmt.Sprintf("*apd.New(%s, 0)", expr)
+	}
+	return fmt.Sprintf("decimal.NewFromInt(%s)", expr)
+}
+
+// decimalFromFloat returns the decimal for expr, a float64.
+func (t *transpiler) decimalFromFloat(expr string) string {
+	t.importDecimal()
+	switch t.decimalMode() {
+	case DecimalString:
+		t.imports["strconv"] = true
+		return fmt.Sprintf("strconv.FormatFloat(%s, 'f', -1, 64)", expr)
+	case DecimalFloat:
+		return expr
+	case DecimalAPD:
+		return fmt.Sprintf("func() apd.Decimal { var d apd.Decimal; d.SetFloat64(%s); return d }()", expr)
+	}
+	return fmt.Sprintf("decimal.NewFromFloat(%s)", expr)
+}
+
+// decimalParse returns the decimal for expr, a string. Strings that aren't
+// numbers are zero, except in shopspring mode, where they panic as
+// CONVERT would fail.
+func (t *transpiler) decimalParse(expr string) string {
+	t.importDecimal()
+	switch t.decimalMode() {
+	case DecimalString:
+		return expr
+	case DecimalFloat:
+		t.imports["strconv"] = true
+		return fmt.Sprintf("func() float64 { v, _ := strconv.ParseFloat(%s, 64); return v }()", expr)
+	case DecimalAPD:
+		return fmt.Sprintf("func() apd.Decimal { var d apd.Decimal; d.SetString(%s); return d }()", expr)
+	}
+	return fmt.Sprintf("decimal.RequireFromString(%s)", expr)
+}
+
+// decimalArith returns x op y for an arithmetic operator.
+func (t *transpiler) decimalArith(op, x, y string) string {
+	methods := map[string][3]string{
+		"+": {"Add", "DecimalAdd", "Add"},
+		"-": {"Sub", "DecimalSub", "Sub"},
+		"*": {"Mul", "DecimalMul", "Mul"},
+		"/": {"Div", "DecimalDiv", "Quo"},
+		"%": {"Mod", "DecimalMod", "Rem"},
+	}[op]
+	switch t.decimalMode() {
+	case DecimalString:
+		t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+		return fmt.Sprintf("tsqlruntime.%s(%s, %s)", methods[1], x, y)
+	case DecimalAPD:
+		t.imports[apdImport] = true
+		return fmt.Sprintf("func(x, y apd.Decimal) apd.Decimal { var d apd.Decimal; %s.%s(&d, &x, &y); return d }(%s, %s)",
+			apdContext, methods[2], x, y)
+	}
+	return fmt.Sprintf("%s.%s(%s)", x, methods[0], y)
+}
+
+// decimalCompare returns x op y for a comparison operator.
+func (t *transpiler) decimalCompare(op, x, y string) string {
+	switch t.decimalMode() {
+	case DecimalString, DecimalAPD:
+		goOp := map[string]string{"=": "==", "<>": "!=", "!=": "!=", "<": "<", "<=": "<=", ">": ">", ">=": ">=", "!<": ">=", "!>": "<="}[op]
+		return fmt.Sprintf("%s %s 0", t.decimalCmp(x, y), goOp)
+	}
+	switch op {
+	case "=":
+		return fmt.Sprintf("%s.Equal(%s)", x, y)
+	case "<>", "!=":
+		return fmt.Sprintf("!%s.Equal(%s)", x, y)
+	case "<":
+		return fmt.Sprintf("%s.LessThan(%s)", x, y)
+	case "<=", "!>":
+		return fmt.Sprintf("%s.LessThanOrEqual(%s)", x, y)
+	case ">":
+		return fmt.Sprintf("%s.GreaterThan(%s)", x, y)
+	}
+	return fmt.Sprintf("%s.GreaterThanOrEqual(%s)", x, y)
+}
+
+// decimalCmp returns the comparison of x and y, -1, 0 or +1.
+func (t *transpiler) decimalCmp(x, y string) string {
+	switch t.decimalMode() {
+	case DecimalString:
+		t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+		return fmt.Sprintf("tsqlruntime.DecimalCmp(%s, %s)", x, y)
+	case DecimalAPD:
+		return fmt.Sprintf("func(x, y apd.Decimal) int { return x.Cmp(&y) }(%s, %s)", x, y)
+	}
+	return fmt.Sprintf("%s.Cmp(%s)", x, y)
+}
+
+// decimalFunc returns fn(x) for fn one of Neg, Abs, Ceil or Floor.
+func (t *transpiler) decimalFunc(fn, x string) string {
+	switch t.decimalMode() {
+	case DecimalString:
+		t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+		return fmt.Sprintf("tsqlruntime.Decimal%s(%s)", fn, x)
+	case DecimalAPD:
+		call := fmt.Sprintf("d.%s(&x)", fn)
+		if fn == "Ceil" || fn == "Floor" {
+			call = fmt.Sprintf("%s.%s(&d, &x)", apdContext, fn)
+		}
+		return fmt.Sprintf("func(x apd.Decimal) apd.Decimal { var d apd.Decimal; %s; return d }(%s)", call, x)
+	}
+	return fmt.Sprintf("%s.%s()", x, fn)
+}
+
+// decimalIsZero returns whether x is zero, or with not, whether it isn't.
+func (t *transpiler) decimalIsZero(x string, not bool) string {
+	if t.decimalMode() == DecimalString {
+		if not {
+			return t.decimalCmp(x, `"0"`) + " != 0"
+		}
+		return t.decimalCmp(x, `"0"`) + " == 0"
+	}
+	check := x + ".IsZero()"
+	if t.decimalMode() == DecimalAPD {
+		check = apdMethod(x, "IsZero()", "bool")
+	}
+	if not {
+		return "!" + check
+	}
+	return check
+}
+
+// decimalToFloat returns x as a float64.
+func (t *transpiler) decimalToFloat(x string) string {
+	switch t.decimalMode() {
+	case DecimalString:
+		t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+		return fmt.Sprintf("tsqlruntime.DecimalFloat(%s)", x)
+	case DecimalAPD:
+		return fmt.Sprintf("func(x apd.Decimal) float64 { f, _ := x.Float64(); return f }(%s)", x)
+	}
+	return x + ".InexactFloat64()"
+}
+
+// decimalToInt returns the integer part of x as an int64.
+func (t *transpiler) decimalToInt(x string) string {
+	switch t.decimalMode() {
+	case DecimalString:
+		t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+		return fmt.Sprintf("tsqlruntime.DecimalInt(%s)", x)
+	case DecimalAPD:
+		return fmt.Sprintf("func(x apd.Decimal) int64 { c := %s; c.Rounding = apd.RoundDown; c.RoundToIntegralValue(&x, &x); i, _ := x.Int64(); return i }(%s)",
+			apdContext, x)
+	}
+	return x + ".IntPart()"
+}
+
+// decimalToString returns x as a string.
+func (t *transpiler) decimalToString(x string) string {
+	switch t.decimalMode() {
+	case DecimalString:
+		return x
+	case DecimalAPD:
+		return apdMethod(x, "String()", "string")
+	}
+	return x + ".String()"
+}
+
+// decimalRound returns ROUND(x, length [, function]). length and function
+// are ints.
+func (t *transpiler) decimalRound(x string, rest []string) string {
+	switch t.decimalMode() {
+	case DecimalString:
+		t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+		return fmt.Sprintf("tsqlruntime.DecimalRound(%s, %s)", x, strings.Join(rest, ", "))
+	case DecimalAPD:
+		rounding := "apd.RoundHalfUp"
+		if len(rest) > 1 && rest[1] != "0" {
+			rounding = "apd.RoundDown"
+		}
+		return fmt.Sprintf("func(x apd.Decimal) apd.Decimal { var d apd.Decimal; c := %s; c.Rounding = %s; c.Quantize(&d, &x, -int32(%s)); return d }(%s)",
+			apdContext, rounding, rest[0], x)
+	}
+	t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+	return fmt.Sprintf("tsqlruntime.RoundDecimal(%s, %s)", x, strings.Join(rest, ", "))
+}
+
+// decimalMinMax returns the least or greatest of decimal values.
+func (t *transpiler) decimalMinMax(values []string, greatest bool) string {
+	if t.decimalMode() == DecimalShopspring {
+		fn := "decimal.Min"
+		if greatest {
+			fn = "decimal.Max"
+		}
+		return fmt.Sprintf("%s(%s)", fn, strings.Join(values, ", "))
+	}
+	op := "<"
+	if greatest {
+		op = ">"
+	}
+	typ := t.decimalType()
+	return fmt.Sprintf("func() %s { m := %s; for _, v := range []%s{%s} { if %s { m = v } }; return m }()",
+		typ, values[0], typ, strings.Join(values[1:], ", "), t.decimalCompare(op, "v", "m"))
+}
+
+// castToDecimal converts expr, of sourceType, to a decimal for CAST and
+// CONVERT.
+func (t *transpiler) castToDecimal(src ast.Expression, expr string, sourceType *typeInfo) string {
+	t.importDecimal()
+	switch {
+	case sourceType.isDecimal:
+		return expr
+	case sourceType.isString:
+		return t.decimalParse(expr)
+	}
+	// For literals, use the text to avoid float64 precision loss
+	switch src.(type) {
+	case *ast.FloatLiteral:
+		return t.decimalLiteral(expr)
+	case *ast.IntegerLiteral:
+		return t.decimalFromInt(expr)
+	}
+	return t.decimalFromFloat(fmt.Sprintf("float64(%s)", expr))
+}
+
+// apdMethod calls a method of apd.Decimal, which has pointer receivers,
+// on x.
+func apdMethod(x, call, result string) string {
+	if isGoIdentifier(x) {
+		return x + "." + call
+	}
+	return fmt.Sprintf("func(x apd.Decimal) %s { return x.%s }(%s)", result, call, x)
+}
+
+// isGoIdentifier reports whether s is a plain identifier, such as a
+// variable name.
+func isGoIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		if r != '_' && !(r >= 'a' && r <= 'z') && !(r >= 'A' && r <= 'Z') && (i == 0 || !(r >= '0' && r <= '9')) {
+			return false
+		}
+	}
+	return true
+}
@@ -7,7 +7,11 @@ package transpiler
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/ha1tch/tsqlparser/ast"
 )
@@ -20,6 +24,16 @@ const (
 	BackendGRPC   BackendType = "grpc"   // gRPC client calls
 	BackendMock   BackendType = "mock"   // Mock store calls
 	BackendInline BackendType = "inline" // Inline SQL strings (for migration)
+	BackendMongo  BackendType = "mongo"  // mongo-go-driver collection calls
+	BackendRedis  BackendType = "redis"  // go-redis hash lookups, SQL otherwise
+	// Typed wrappers that run the original procedures on SQL Server
+	BackendProcedureCall BackendType = "procedure-call"
+)
+
+// Code generation styles for procedures in DML mode.
+const (
+	StyleMethods   = "methods"   // func (r *Repository) Proc(ctx, ...)
+	StyleFunctions = "functions" // func Proc(ctx, db, ...)
 )
 
 // DMLConfig configures DML transpilation.
@@ -32,6 +46,11 @@ type DMLConfig struct {
 	FallbackBackend  BackendType
 	FallbackExplicit bool // True if user explicitly set --fallback-backend
 
+	// Per-table backends, overriding both Backend and FallbackBackend
+	// (e.g. "Orders" -> grpc, "#tmp" -> mock). Names are matched without
+	// schema and case-insensitively.
+	TableToBackend map[string]BackendType
+
 	// SQL dialect (postgres, mysql, sqlite, sqlserver)
 	SQLDialect string
 
@@ -42,6 +61,11 @@ type DMLConfig struct {
 	Receiver     string // Receiver variable name (e.g., "r") - empty means no receiver
 	ReceiverType string // Receiver type (e.g., "*Repository", "*Service")
 
+	// Generation style: "methods" (default) or "functions". In functional
+	// style procedures have no receiver; with the SQL backend the store is
+	// passed as the first parameter after ctx, named after StoreVar.
+	Style string
+
 	// GO statement handling
 	PreserveGo bool // If true, don't strip GO statements (default: false, strip them)
 
@@ -81,9 +105,110 @@ type DMLConfig struct {
 	TableToClient    map[string]string // table -> client variable (e.g., "Products" -> "catalogClient")
 	ServiceToPackage map[string]string // service -> proto package (e.g., "CatalogService" -> "catalogpb")
 
-	// Mock backend options
+	// Import paths for packages the generated code refers to (see
+	// packages.go). ModulePath is the import path of the output root;
+	// PackagePaths maps a package name to its import path; SchemaToPackage
+	// maps a SQL schema to the package its procedures are generated into.
+	ModulePath      string
+	PackagePaths    map[string]string
+	SchemaToPackage map[string]string
+
+	// Mock backend options. With Backend=mock the store is StoreVar;
+	// MockStoreVar names it when TableToBackend mixes mock with another backend.
 	MockStoreVar string // Mock store variable name (e.g., "store", "mockDB")
 
+	// Computed, identity and rowversion columns by table (table -> column ->
+	// kind, see GeneratedColumns). They are dropped from INSERT column lists
+	// and UPDATE SET clauses. Tables created in the source are added.
+	GeneratedColumns map[string]map[string]string
+
+	// Columns whose DEFAULT is NEXT VALUE FOR a sequence (table -> column
+	// -> sequence, see SequenceDefaults). On dialects without sequences,
+	// INSERTs leaving them out get them added. Tables created in the source
+	// are added.
+	SequenceDefaults map[string]map[string]string
+
+	// Key columns by table, for UPDATE and DELETE ... WHERE CURRENT OF (see
+	// currentof.go). Primary keys of tables created in the source are added.
+	KeyColumns map[string][]string
+
+	// User-defined table types (see TableTypes), for procedure parameters
+	// of a type not created in the source. DeclaredTableTypes names the
+	// ones whose structs an earlier file of the package already declares.
+	TableTypes         []TableType
+	DeclaredTableTypes []string
+
+	// Named constants (see constants.go). Literals in Go expressions with
+	// the value of one refer to it.
+	Constants []ConstantBlock
+
+	// Verbs added to and removed from those found in column and variable
+	// names for gRPC and mock method names (see verbs.go).
+	Verbs VerbsConfig
+
+	// Request fields of proto enum types (see protoenums.go), by
+	// EnumFieldKey. The gRPC backend sets them to the enum's constants.
+	ProtoEnumFields map[string]*ProtoEnum
+
+	// Procedures not migrated yet (see passthrough.go). An EXEC of one
+	// calls a generated stub that runs it in the database.
+	// DeclaredPassthroughs names the stubs an earlier file already declares.
+	Passthrough          []string
+	DeclaredPassthroughs []string
+
+	// Script mode (see script.go): statements outside any procedure become
+	// the body of one function with this name.
+	ScriptName string
+
+	// MongoDB backend options. StoreVar holds the *mongo.Database unless
+	// MongoDatabaseVar is set, as it must be when SQL tables share StoreVar.
+	TableToCollection map[string]string // table -> collection (default: lowerCamel table name)
+	MongoDatabaseVar  string            // *mongo.Database variable (default: StoreVar)
+
+	// Redis backend options. Statements that aren't single-key lookups use
+	// the SQL backend through StoreVar.
+	RedisClientVar  string            // go-redis client variable (e.g., "r.redis")
+	TableToRedisKey map[string]string // table -> key column (default: ID, <Table>ID or <Singular>ID)
+
+	// Event tables. INSERTs into these tables publish the row to a topic
+	// through a tsqlruntime.EventPublisher instead of writing it.
+	TableToEvent      map[string]string // table -> topic (e.g., "EventQueue" -> "order-events")
+	TableToEventKey   map[string]string // table -> column used as the message key (default: none)
+	EventPublisherVar string            // tsqlruntime.EventPublisher variable (e.g., "r.events")
+
+	// tsqlruntime.Notifier variable for Database Mail (sp_send_dbmail,
+	// xp_sendmail), e.g. "r.notifier"
+	NotifierVar string
+
+	// Deadline for generated procedures (0 for none), applied to the whole
+	// call or to each database statement (TimeoutScope "procedure" or
+	// "statement"). Loops check for cancellation whenever it is set.
+	Timeout      time.Duration
+	TimeoutScope string
+
+	// ExecStats records each procedure's executions in tsqlruntime.ProcStats,
+	// with the fields of sys.dm_exec_procedure_stats
+	ExecStats bool
+
+	// Metrics records each call's outcome and latency through the
+	// tsqlruntime.Metrics variable MetricsVar (e.g., "r.metrics")
+	Metrics    bool
+	MetricsVar string
+
+	// Retry whole transactions that fail with a transient error of
+	// SQLDialect (deadlocks, lock timeouts, serialization failures), up to
+	// RetryAttempts attempts with exponential backoff from RetryBackoff.
+	// RetryOn adds error codes to the dialect's defaults.
+	RetryAttempts int
+	RetryBackoff  time.Duration
+	RetryOn       []string
+
+	// Otel wraps each procedure, and its SQL and gRPC calls, in spans
+	// started through the tsqlruntime.Tracer variable TracerVar (e.g.,
+	// "r.tracer")
+	Otel      bool
+	TracerVar string
+
 	// SPLogger configuration
 	UseSPLogger    bool   // Use SPLogger for CATCH blocks
 	SPLoggerVar    string // Variable name for logger (e.g., "spLogger", "r.logger")
@@ -98,6 +223,65 @@ type DMLConfig struct {
 	// standard: TODOs + Original SQL comments
 	// verbose: All of the above + type annotations + section markers
 	AnnotateLevel string
+
+	// Scalar UDF calls inside queries (e.g. WHERE x > dbo.fn_CalcTax(@a))
+	// "keep" - leave the call in SQL with a warning (default)
+	// "compute" - evaluate the call in Go and bind the result as a parameter
+	UDFMode      string
+	UDFOverrides map[string]string // function name -> mode, overriding UDFMode
+
+	// AllowAnyScan permits interface{} scan targets for result columns whose
+	// type can't be inferred. By default such columns are scanned as strings.
+	AllowAnyScan bool
+
+	// Target Go version for generated code (e.g. "1.22"). Empty means the
+	// conservative baseline; see goversion.go for what newer versions enable.
+	GoVersion string
+
+	// NullMode maps nullable parameters and result columns to Go types:
+	// NullZero (zero values), NullSQL (sql.Null*) or NullPointer (*T).
+	// Empty is NullZero, except that nullable table type columns are
+	// pointers. See null.go.
+	NullMode string
+
+	// DecimalMode maps DECIMAL, NUMERIC and MONEY to Go types:
+	// DecimalShopspring (decimal.Decimal), DecimalString, DecimalFloat
+	// (float64) or DecimalAPD (apd.Decimal). Empty is DecimalShopspring.
+	// See decimal.go.
+	DecimalMode string
+
+	// TimeMode sets the clock GETDATE(), SYSDATETIME() and CURRENT_TIMESTAMP
+	// read: TimeUTC or TimeLocal. Empty is TimeLocal. See timezone.go.
+	TimeMode string
+
+	// NoLockStrategy says what becomes of NOLOCK and READUNCOMMITTED
+	// hints: NoLockComment, NoLockReadUncommitted or NoLockIgnore. Empty
+	// is NoLockComment. See nolock.go.
+	NoLockStrategy string
+
+	// TryCatchMode says what TRY/CATCH becomes: TryCatchIIFE, a closure
+	// returning the TRY block's error, or TryCatchErrors, the blocks inline
+	// with errors jumping to the CATCH. Empty is TryCatchIIFE. See
+	// trycatch.go.
+	TryCatchMode string
+
+	// PrintMode says what PRINT and informational RAISERROR become:
+	// PrintFmt, fmt.Println (or the SPLogger with UseSPLogger), PrintSlog,
+	// slog.InfoContext, or PrintDiscard, nothing. Empty is PrintFmt. See
+	// print.go.
+	PrintMode string
+
+	// SpatialMode says how GEOMETRY and GEOGRAPHY values, Go strings, are
+	// written: SpatialWKT or SpatialPostGIS (EWKT, with spatial methods in
+	// queries becoming PostGIS functions). Empty is SpatialWKT. See
+	// spatial.go.
+	SpatialMode string
+
+	// RowsMode says how the wrappers of the procedure-call backend return
+	// result sets: RowsSlice (a slice each), RowsCallback (a function
+	// called with each row) or RowsIter (an iter.Seq2, Go 1.23). Empty is
+	// RowsSlice. See proccall.go.
+	RowsMode string
 }
 
 // DefaultDMLConfig returns sensible defaults.
@@ -109,6 +293,7 @@ func DefaultDMLConfig() DMLConfig {
 		StoreVar:         "r.db",
 		Receiver:         "r",
 		ReceiverType:     "*Repository",
+		Style:            StyleMethods,
 		SequenceMode:     "db",
 		NewidMode:        "app",
 		SkipDDL:          true,
@@ -120,6 +305,11 @@ func DefaultDMLConfig() DMLConfig {
 		TableToClient:    make(map[string]string),
 		ServiceToPackage: make(map[string]string),
 		MockStoreVar:     "store",
+		RedisClientVar:   "r.redis",
+		EventPublisherVar: "r.events",
+		NotifierVar:      "r.notifier",
+		TracerVar:        "r.tracer",
+		MetricsVar:       "r.metrics",
 		UseSPLogger:      false,
 		SPLoggerVar:      "spLogger",
 		SPLoggerType:     "slog",
@@ -157,10 +347,15 @@ func (dt *dmlTranspiler) buildErrorReturn() string {
 	if dt.transpiler.inTryBlock {
 		return "return err"
 	}
+
+	// In an inline TRY block, jump to the CATCH
+	if exit, ok := dt.catchExit("err", dt.indentStr()+"\t"); ok {
+		return exit
+	}
 	
 	// In CATCH block, we're inside an if block - cannot return from outer func
 	// Use _ = err to acknowledge error but continue
-	if dt.transpiler.inCatchBlock {
+	if dt.transpiler.inCatchBlock && !dt.tryCatchErrors() {
 		return "_ = err // Operation failed in error handler"
 	}
 
@@ -190,22 +385,104 @@ func (t *transpiler) transpileSelect(s *ast.SelectStatement) (string, error) {
 }
 
 func (dt *dmlTranspiler) transpileSelect(s *ast.SelectStatement) (string, error) {
+	// OPENROWSET(BULK ...) reads a file rather than a table
+	if path, mode, ok := openRowsetBulk(s); ok {
+		return dt.transpileOpenRowsetBulk(s, path, mode)
+	}
+
+	// nodes() and OPENXML read an XML document held in Go
+	if src, err := dt.xmlRowSource(s); err != nil || src != nil {
+		if err != nil {
+			return "", err
+		}
+		return dt.transpileSelectXML(s, src)
+	}
+
+	// SELECT @id = SCOPE_IDENTITY() assigns in Go (see identity.go)
+	if sets := dt.identityAssignments(s); sets != nil {
+		var parts []string
+		for _, set := range sets {
+			code, err := dt.transpileSet(set)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, code)
+		}
+		return strings.Join(parts, "\n"+dt.indentStr()), nil
+	}
+
+	// SELECT @a = a, b both assigns and returns rows, which SQL Server
+	// rejects. Assign the variables and drop the other columns, saying so.
+	note := ""
+	if dropped := unassignedColumns(s); len(dropped) > 0 {
+		dt.warnings = append(dt.warnings, fmt.Sprintf(
+			"%s: SELECT assigns variables and also returns %s, which SQL Server rejects; only the variables are assigned",
+			dt.currentProcName, strings.Join(dropped, ", ")))
+		note = fmt.Sprintf("// Not assigned to a variable, dropped: %s\n%s", strings.Join(dropped, ", "), dt.indentStr())
+		assigned := *s
+		assigned.Columns = nil
+		for _, col := range s.Columns {
+			if col.Variable != nil {
+				assigned.Columns = append(assigned.Columns, col)
+			}
+		}
+		s = &assigned
+	}
+
+	// Temp tables the procedure creates are read in memory (see memtable.go)
+	if table := dt.memorySelectTable(s); table != nil {
+		code, err := dt.transpileSelectMemory(s, table)
+		return note + code, err
+	}
+
 	// Determine effective backend (use fallback for temp tables)
 	tableName := dt.extractMainTable(s)
 	backend := dt.getEffectiveBackend(tableName)
+	if err := dt.tableParamBackendError(s, backend); err != nil {
+		return "", err
+	}
+	if backend != BackendSQL {
+		dt.warnPivotBackend(s, backend)
+	}
 	
+	var code string
+	var err error
 	switch backend {
-	case BackendSQL:
-		return dt.transpileSelectSQL(s)
 	case BackendGRPC:
-		return dt.transpileSelectGRPC(s)
+		code, err = dt.transpileSelectGRPC(s)
 	case BackendMock:
-		return dt.transpileSelectMock(s)
+		code, err = dt.transpileSelectMock(s)
+	case BackendMongo:
+		code, err = dt.transpileSelectMongo(s)
+	case BackendRedis:
+		code, err = dt.transpileSelectRedis(s)
 	case BackendInline:
-		return dt.transpileSelectInline(s)
+		code, err = dt.transpileSelectInline(s)
 	default:
-		return dt.transpileSelectSQL(s)
+		code, err = dt.transpileSelectSQL(s)
 	}
+	if err != nil {
+		return "", err
+	}
+	return note + code, nil
+}
+
+// unassignedColumns returns the columns of a SELECT that assigns variables
+// but not to these columns, as Email in SELECT @Name = Name, Email.
+func unassignedColumns(s *ast.SelectStatement) []string {
+	assigns := false
+	var others []string
+	for _, col := range s.Columns {
+		if col.Variable != nil {
+			assigns = true
+		} else {
+			others = append(others, col.String())
+		}
+	}
+	if !assigns {
+		return nil
+	}
+	return others
 }
 
 // transpileSelectSQL generates database/sql code for SELECT.
@@ -217,20 +494,24 @@ func (dt *dmlTranspiler) transpileSelectSQL(s *ast.SelectStatement) (string, err
 	if len(assignments) > 0 {
 		return dt.transpileSelectIntoVars(s, assignments)
 	}
+	if isForJSON(s) {
+		if code, ok := dt.transpileSelectForJSON(s); ok {
+			return code, nil
+		}
+	}
 
 	// Build the query string
 	query, args := dt.buildSelectQuery(s)
 	
 	// Post-process to catch any remaining @variable references
-	query, extraArgs := dt.substituteVariablesInQuery(query)
-	args = append(args, extraArgs...)
+	query, args = dt.bindQueryVariables(query, args)
 	
 	// Get the database variable (tx if in transaction, StoreVar otherwise)
 	dbVar := dt.getDBVar()
 	
 	// Extract column names for scan targets
 	columns := dt.extractSelectColumns(s)
-	scanDecl, scanTargets := dt.generateScanTargets(columns)
+	scanDecl, scanTargets, scanAssigns := dt.generateScanTargets(columns)
 
 	// Generate the Go code
 	out.WriteString("// SELECT query\n")
@@ -258,6 +539,7 @@ func (dt *dmlTranspiler) transpileSelectSQL(s *ast.SelectStatement) (string, err
 		out.WriteString("\n")
 		out.WriteString(dt.indentStr())
 		out.WriteString("}")
+		dt.writeScanAssigns(&out, scanAssigns, "")
 	} else {
 		// Use Query for multi-row SELECT - check if rows/err already declared
 		rowsDeclared := dt.symbols.isDeclared("rows")
@@ -294,7 +576,9 @@ func (dt *dmlTranspiler) transpileSelectSQL(s *ast.SelectStatement) (string, err
 		out.WriteString(dt.buildErrorReturn())
 		out.WriteString("\n")
 		out.WriteString(dt.indentStr())
-		out.WriteString("\t}\n")
+		out.WriteString("\t}")
+		dt.writeScanAssigns(&out, scanAssigns, "\t")
+		out.WriteString("\n")
 		out.WriteString(dt.indentStr())
 		out.WriteString("}")
 	}
@@ -319,16 +603,16 @@ func (dt *dmlTranspiler) transpileSelectIntoVars(s *ast.SelectStatement, assignm
 	query, args := dt.buildSelectQuery(s)
 	
 	// Post-process to catch any remaining @variable references
-	query, extraArgs := dt.substituteVariablesInQuery(query)
-	args = append(args, extraArgs...)
+	query, args = dt.bindQueryVariables(query, args)
 	
 	// Get the database variable (tx if in transaction, StoreVar otherwise)
 	dbVar := dt.getDBVar()
 
 	// Generate Scan targets from assignments
-	var scanTargets []string
-	for _, a := range assignments {
-		scanTargets = append(scanTargets, "&"+a.varName)
+	scanDecls, scanTargets, scanAssigns := dt.varScanTargets(assignments)
+	for _, decl := range scanDecls {
+		out.WriteString(decl + "\n")
+		out.WriteString(dt.indentStr())
 	}
 
 	// Check if err is already declared
@@ -354,6 +638,15 @@ func (dt *dmlTranspiler) transpileSelectIntoVars(s *ast.SelectStatement, assignm
 	out.WriteString("\n")
 	out.WriteString(dt.indentStr())
 	out.WriteString("}\n")
+	if len(scanAssigns) > 0 {
+		// No row leaves the variables as they were
+		out.WriteString(dt.indentStr())
+		out.WriteString("if err == nil {")
+		dt.writeScanAssigns(&out, scanAssigns, "\t")
+		out.WriteString("\n")
+		out.WriteString(dt.indentStr())
+		out.WriteString("}\n")
+	}
 	
 	// Update rowsAffected for @@ROWCOUNT support
 	if dt.usesRowCount {
@@ -414,10 +707,21 @@ func (dt *dmlTranspiler) transpileSelectGRPC(s *ast.SelectStatement) (string, er
 		if wf.isComplex {
 			hasComplexFields = true
 			complexWarnings = append(complexWarnings, fmt.Sprintf("%s: %s", wf.column, wf.rawExpr))
+			dt.warn(RuleComplexField, fmt.Sprintf("%s: %s leaves out %s; its WHERE value %s needs converting by hand",
+				dt.currentProcName, methodName, wf.column, wf.rawExpr))
 			continue // Skip complex fields in request
 		}
 		out.WriteString(dt.indentStr())
-		out.WriteString(fmt.Sprintf("\t%s: %s,\n", goExportedIdentifier(wf.column), wf.value))
+		out.WriteString(fmt.Sprintf("\t%s: %s,\n", goExportedIdentifier(wf.column),
+			dt.grpcFieldValue(methodName, tableName, wf.column, wf.value, wf.expr, protoPackage)))
+	}
+	if search := fullTextSearch(s.Where); search != nil {
+		query, err := dt.transpileExpression(search)
+		if err != nil {
+			return "", err
+		}
+		out.WriteString(dt.indentStr())
+		out.WriteString(fmt.Sprintf("\tQuery: %s,\n", query))
 	}
 	
 	// Add warning comment for complex fields that were skipped
@@ -462,6 +766,16 @@ func (dt *dmlTranspiler) transpileSelectGRPC(s *ast.SelectStatement) (string, er
 	return out.String(), nil
 }
 
+// mockStoreVar returns the mock store variable. StoreVar is the mock store
+// when the whole file uses it; with per-table routing StoreVar belongs to
+// the primary backend.
+func (dt *dmlTranspiler) mockStoreVar() string {
+	if dt.config.Backend != BackendMock && len(dt.config.TableToBackend) > 0 && dt.config.MockStoreVar != "" {
+		return dt.config.MockStoreVar
+	}
+	return dt.config.StoreVar
+}
+
 // transpileSelectMock generates mock store code for SELECT.
 func (dt *dmlTranspiler) transpileSelectMock(s *ast.SelectStatement) (string, error) {
 	tableName := dt.extractMainTable(s)
@@ -479,7 +793,7 @@ func (dt *dmlTranspiler) transpileSelectMock(s *ast.SelectStatement) (string, er
 	dt.symbols.markDeclared("result")
 	dt.symbols.markDeclared("err")
 	
-	out.WriteString(fmt.Sprintf("result, err %s %s.%s(", assignOp, dt.config.StoreVar, methodName))
+	out.WriteString(fmt.Sprintf("result, err %s %s.%s(", assignOp, dt.mockStoreVar(), methodName))
 
 	// Add arguments from WHERE clause
 	whereFields := dt.extractWhereFields(s)
@@ -518,8 +832,7 @@ func (dt *dmlTranspiler) transpileSelectInline(s *ast.SelectStatement) (string,
 	query, args := dt.buildSelectQuery(s)
 	
 	// Post-process to catch any remaining @variable references
-	query, extraArgs := dt.substituteVariablesInQuery(query)
-	args = append(args, extraArgs...)
+	query, args = dt.bindQueryVariables(query, args)
 
 	var out strings.Builder
 	out.WriteString(fmt.Sprintf("query := %q\n", query))
@@ -540,20 +853,77 @@ func (t *transpiler) transpileInsert(s *ast.InsertStatement) (string, error) {
 }
 
 func (dt *dmlTranspiler) transpileInsert(s *ast.InsertStatement) (string, error) {
+	// Computed and identity columns are filled in by the database
+	keepsIdentity := dt.identityInserts[s]
+	s, note := dt.omitGeneratedInsertColumns(s)
+	s = dt.fillSequenceDefaults(s)
+	s, fetch := dt.fetchInsertNextValues(s)
+	note = dt.withFetch(fetch, note)
+	if keepsIdentity {
+		dt.identityInserts[s] = true
+	}
+
+	if s.Select != nil {
+		if path, _, ok := openRowsetBulk(s.Select); ok {
+			return "", fmt.Errorf("INSERT ... SELECT FROM OPENROWSET(BULK '%s') is not supported; use BULK INSERT into a staging table", path)
+		}
+	}
+
 	// Determine effective backend (use fallback for temp tables)
 	tableName := dt.extractInsertTable(s)
+	if table := dt.memoryTable(tableName); table != nil {
+		code, err := dt.transpileInsertMemory(s, table)
+		return dt.prependNote(note, code), err
+	}
+	if topic, ok := dt.eventTopic(tableName); ok {
+		code, err := dt.transpileInsertEvent(s, topic)
+		return dt.prependNote(note, code), err
+	}
 	backend := dt.getEffectiveBackend(tableName)
+	if src, err := dt.xmlRowSource(s.Select); err != nil || src != nil {
+		if err != nil {
+			return "", err
+		}
+		code, err := dt.transpileInsertXML(s, src, backend)
+		return dt.prependNote(note, code), err
+	}
+	if p, ok := dt.selectTableParam(s.Select); ok && backend == BackendGRPC {
+		code, err := dt.transpileInsertTableParamGRPC(s, p)
+		return dt.prependNote(note, code), err
+	}
+	if tvf, ok := dt.selectOpenJSON(s.Select); ok && backend == BackendGRPC {
+		code, err := dt.transpileInsertOpenJSONGRPC(s, tvf)
+		return dt.prependNote(note, code), err
+	}
+	if err := dt.tableParamBackendError(s, backend); err != nil {
+		return "", err
+	}
 	
+	var code string
+	var err error
 	switch backend {
 	case BackendSQL:
-		return dt.transpileInsertSQL(s)
+		code, err = dt.transpileInsertSQL(s)
 	case BackendGRPC:
-		return dt.transpileInsertGRPC(s)
+		code, err = dt.transpileInsertGRPC(s)
 	case BackendMock:
-		return dt.transpileInsertMock(s)
+		code, err = dt.transpileInsertMock(s)
+	case BackendMongo:
+		code, err = dt.transpileInsertMongo(s)
+	case BackendRedis:
+		code, err = dt.transpileInsertRedis(s)
 	default:
-		return dt.transpileInsertSQL(s)
+		code, err = dt.transpileInsertSQL(s)
+	}
+	return dt.prependNote(note, code), err
+}
+
+// prependNote puts a comment line before generated statement code.
+func (dt *dmlTranspiler) prependNote(note, code string) string {
+	if note == "" {
+		return code
 	}
+	return note + "\n" + dt.indentStr() + code
 }
 
 func (dt *dmlTranspiler) transpileInsertSQL(s *ast.InsertStatement) (string, error) {
@@ -568,72 +938,72 @@ func (dt *dmlTranspiler) transpileInsertSQL(s *ast.InsertStatement) (string, err
 	query, args := dt.buildInsertQuery(s)
 	
 	// Post-process to catch any remaining @variable references
-	query, extraArgs := dt.substituteVariablesInQuery(query)
-	args = append(args, extraArgs...)
+	query, args = dt.bindQueryVariables(query, args)
 	
 	// Get the database variable (tx if in transaction, StoreVar otherwise)
 	dbVar := dt.getDBVar()
 
-	// Check for OUTPUT clause (SQL Server) or RETURNING (PostgreSQL)
-	hasOutput := s.Output != nil
+	// SCOPE_IDENTITY() reads this INSERT's identity value (see identity.go)
+	keepsIdentity := dt.identityInserts[s]
+
+	// OUTPUT rows come back from RETURNING (or OUTPUT on SQL Server)
+	if dt.returnsOutput(s.Output, "INSERT") {
+		if keepsIdentity && !dt.outputKeepsIdentity(s) {
+			// OUTPUT ... INTO a table returns no rows to add it to
+			if dt.config.SQLDialect != "sqlserver" {
+				return "", fmt.Errorf("SCOPE_IDENTITY() after INSERT INTO %s ... OUTPUT INTO a table is not supported on %s; OUTPUT into a table variable instead",
+					dt.extractInsertTable(s), dt.config.SQLDialect)
+			}
+			out.WriteString(dt.transpileIdentityInsert(s, query, args))
+			return out.String(), nil
+		}
+		out.WriteString(dt.transpileOutputSQL(s.Output, "INSERT", query, args, keepsIdentity))
+		return out.String(), nil
+	}
+
+	if keepsIdentity && (dt.config.SQLDialect == "postgres" || dt.config.SQLDialect == "sqlserver") {
+		out.WriteString(dt.transpileIdentityInsert(s, query, args))
+		return out.String(), nil
+	}
 
 	out.WriteString("// INSERT query\n")
 	out.WriteString(dt.indentStr())
 
-	if hasOutput && dt.config.SQLDialect == "postgres" {
-		// PostgreSQL: use RETURNING
-		if dt.emitTODOs() {
-			out.WriteString("// TODO(tgpiler): OUTPUT clause converted to RETURNING - verify column mapping\n")
-			out.WriteString(dt.indentStr())
-		}
-		out.WriteString(fmt.Sprintf("row := %s.QueryRowContext(ctx, %q", dbVar, query))
-		for _, arg := range args {
-			out.WriteString(", " + arg)
-		}
-		out.WriteString(")\n")
-		out.WriteString(dt.indentStr())
-		out.WriteString("if err := row.Scan(/* TODO: RETURNING columns */); err != nil {\n")
-		out.WriteString(dt.indentStr())
-		if dt.transpiler.inCatchBlock {
-			// In CATCH block, just log and continue - don't return
-			out.WriteString("\t_ = err // Error logging failed, but we're already in error handling\n")
-		} else {
-			out.WriteString("\t" + dt.buildErrorReturn() + "\n")
-		}
-		out.WriteString(dt.indentStr())
-		out.WriteString("}")
+	// Standard INSERT - check if result/err already declared
+	// Use := if either variable is new, = if both are already declared
+	resultDeclared := dt.symbols.isDeclared("result")
+	errDeclared := dt.symbols.isDeclared("err")
+	
+	assignOp := ":="
+	if resultDeclared && errDeclared {
+		assignOp = "="
+	}
+	dt.symbols.markDeclared("result")
+	dt.symbols.markDeclared("err")
+	
+	out.WriteString(fmt.Sprintf("result, err %s %s.ExecContext(ctx, %q", assignOp, dbVar, query))
+	for _, arg := range args {
+		out.WriteString(", " + arg)
+	}
+	out.WriteString(")\n")
+	out.WriteString(dt.indentStr())
+	out.WriteString("if err != nil {\n")
+	out.WriteString(dt.indentStr())
+	if dt.transpiler.inCatchBlock {
+		// In CATCH block, just log and continue - don't return
+		// We're already in error handling, so failing to log is not critical
+		out.WriteString("\t_ = err // Error logging failed, but we're already in error handling\n")
+	} else {
+		out.WriteString("\t")
+		out.WriteString(dt.buildErrorReturn())
+		out.WriteString("\n")
+	}
+	out.WriteString(dt.indentStr())
+	out.WriteString("}\n")
+	if keepsIdentity {
+		out.WriteString(dt.identityResult(s))
+		dt.emitResultHandling(&out, "")
 	} else {
-		// Standard INSERT - check if result/err already declared
-		// Use := if either variable is new, = if both are already declared
-		resultDeclared := dt.symbols.isDeclared("result")
-		errDeclared := dt.symbols.isDeclared("err")
-		
-		assignOp := ":="
-		if resultDeclared && errDeclared {
-			assignOp = "="
-		}
-		dt.symbols.markDeclared("result")
-		dt.symbols.markDeclared("err")
-		
-		out.WriteString(fmt.Sprintf("result, err %s %s.ExecContext(ctx, %q", assignOp, dbVar, query))
-		for _, arg := range args {
-			out.WriteString(", " + arg)
-		}
-		out.WriteString(")\n")
-		out.WriteString(dt.indentStr())
-		out.WriteString("if err != nil {\n")
-		out.WriteString(dt.indentStr())
-		if dt.transpiler.inCatchBlock {
-			// In CATCH block, just log and continue - don't return
-			// We're already in error handling, so failing to log is not critical
-			out.WriteString("\t_ = err // Error logging failed, but we're already in error handling\n")
-		} else {
-			out.WriteString("\t")
-			out.WriteString(dt.buildErrorReturn())
-			out.WriteString("\n")
-		}
-		out.WriteString(dt.indentStr())
-		out.WriteString("}\n")
 		dt.emitResultHandling(&out, "Use result.LastInsertId() if needed")
 	}
 
@@ -666,7 +1036,8 @@ func (dt *dmlTranspiler) transpileInsertGRPC(s *ast.InsertStatement) (string, er
 	// Add request fields from INSERT columns/values
 	for _, f := range insertFields {
 		out.WriteString(dt.indentStr())
-		out.WriteString(fmt.Sprintf("\t%s: %s,\n", goExportedIdentifier(f.column), f.value))
+		out.WriteString(fmt.Sprintf("\t%s: %s,\n", goExportedIdentifier(f.column),
+			dt.grpcFieldValue(methodName, tableName, f.column, f.value, f.expr, protoPackage)))
 	}
 
 	out.WriteString(dt.indentStr())
@@ -745,12 +1116,12 @@ func (dt *dmlTranspiler) inferInsertGRPCMethod(table string, fields []insertFiel
 	
 	// Check for verb hints in column/value names
 	for _, f := range fields {
-		if verb := extractActionVerb(f.column); verb != "" {
+		if verb := dt.actionVerb(f.column); verb != "" {
 			if !verbConflictsWithEntity(verb, entityName) {
 				return verb + entityName
 			}
 		}
-		if verb := extractActionVerb(f.value); verb != "" {
+		if verb := dt.actionVerb(f.value); verb != "" {
 			if !verbConflictsWithEntity(verb, entityName) {
 				return verb + entityName
 			}
@@ -777,7 +1148,7 @@ func (dt *dmlTranspiler) transpileInsertMock(s *ast.InsertStatement) (string, er
 	dt.symbols.markDeclared("result")
 	dt.symbols.markDeclared("err")
 	
-	out.WriteString(fmt.Sprintf("result, err %s %s.%s(", assignOp, dt.config.StoreVar, methodName))
+	out.WriteString(fmt.Sprintf("result, err %s %s.%s(", assignOp, dt.mockStoreVar(), methodName))
 
 	insertFields := dt.extractInsertFields(s)
 	var argList []string
@@ -804,20 +1175,49 @@ func (t *transpiler) transpileUpdate(s *ast.UpdateStatement) (string, error) {
 }
 
 func (dt *dmlTranspiler) transpileUpdate(s *ast.UpdateStatement) (string, error) {
+	// Computed columns can't be assigned; an UPDATE that only set
+	// generated columns has nothing left to do
+	s, note := dt.omitGeneratedUpdateColumns(s)
+	if s == nil {
+		return note, nil
+	}
+	if s.CurrentOfCursor != nil {
+		keyed, err := dt.currentOfUpdate(s)
+		if err != nil {
+			return "", err
+		}
+		s = keyed
+	}
+	s, fetch := dt.fetchUpdateNextValues(s)
+	note = dt.withFetch(fetch, note)
+
 	// Determine effective backend (use fallback for temp tables)
 	tableName := dt.extractUpdateTable(s)
+	if table := dt.memoryTable(tableName); table != nil {
+		code, err := dt.transpileUpdateMemory(s, table)
+		return dt.prependNote(note, code), err
+	}
+	dt.warnEventTable("UPDATE", tableName)
 	backend := dt.getEffectiveBackend(tableName)
+	if err := dt.tableParamBackendError(s, backend); err != nil {
+		return "", err
+	}
 	
+	var code string
+	var err error
 	switch backend {
 	case BackendSQL:
-		return dt.transpileUpdateSQL(s)
+		code, err = dt.transpileUpdateSQL(s)
 	case BackendGRPC:
-		return dt.transpileUpdateGRPC(s)
+		code, err = dt.transpileUpdateGRPC(s)
 	case BackendMock:
-		return dt.transpileUpdateMock(s)
+		code, err = dt.transpileUpdateMock(s)
+	case BackendMongo:
+		code, err = dt.transpileUpdateMongo(s)
 	default:
-		return dt.transpileUpdateSQL(s)
+		code, err = dt.transpileUpdateSQL(s)
 	}
+	return dt.prependNote(note, code), err
 }
 
 func (dt *dmlTranspiler) transpileUpdateSQL(s *ast.UpdateStatement) (string, error) {
@@ -832,12 +1232,17 @@ func (dt *dmlTranspiler) transpileUpdateSQL(s *ast.UpdateStatement) (string, err
 	query, args := dt.buildUpdateQuery(s)
 	
 	// Post-process to catch any remaining @variable references
-	query, extraArgs := dt.substituteVariablesInQuery(query)
-	args = append(args, extraArgs...)
+	query, args = dt.bindQueryVariables(query, args)
 	
 	// Get the database variable (tx if in transaction, StoreVar otherwise)
 	dbVar := dt.getDBVar()
 
+	// OUTPUT rows come back from RETURNING (or OUTPUT on SQL Server)
+	if dt.returnsOutput(s.Output, "UPDATE") {
+		out.WriteString(dt.transpileOutputSQL(s.Output, "UPDATE", query, args, false))
+		return out.String(), nil
+	}
+
 	// Check if result and err are already declared
 	resultDeclared := dt.symbols.isDeclared("result")
 	errDeclared := dt.symbols.isDeclared("err")
@@ -893,7 +1298,8 @@ func (dt *dmlTranspiler) transpileUpdateGRPC(s *ast.UpdateStatement) (string, er
 	// Add SET fields
 	for _, f := range setFields {
 		out.WriteString(dt.indentStr())
-		out.WriteString(fmt.Sprintf("\t%s: %s,\n", goExportedIdentifier(f.column), f.value))
+		out.WriteString(fmt.Sprintf("\t%s: %s,\n", goExportedIdentifier(f.column),
+			dt.grpcFieldValue(methodName, tableName, f.column, f.value, f.expr, protoPackage)))
 	}
 
 	// Add WHERE fields (for identifying the record)
@@ -927,7 +1333,7 @@ func (dt *dmlTranspiler) inferUpdateGRPCMethod(table string, setFields []setFiel
 	// e.g., UPDATE Orders SET ApprovalStatus = 'Approved' → ApproveOrder
 	for _, f := range setFields {
 		// Check column name
-		if verb := extractActionVerb(f.column); verb != "" {
+		if verb := dt.actionVerb(f.column); verb != "" {
 			// Skip if verb would duplicate or is a prefix of entity name
 			// e.g., Transfer + Transfer, Transfer + TransferAccounting
 			if !verbConflictsWithEntity(verb, entityName) {
@@ -935,7 +1341,7 @@ func (dt *dmlTranspiler) inferUpdateGRPCMethod(table string, setFields []setFiel
 			}
 		}
 		// Check value for state indicators (e.g., 'Approved', 'Rejected', 'Suspended')
-		if verb := extractActionVerb(f.value); verb != "" {
+		if verb := dt.actionVerb(f.value); verb != "" {
 			if !verbConflictsWithEntity(verb, entityName) {
 				return verb + entityName
 			}
@@ -944,12 +1350,12 @@ func (dt *dmlTranspiler) inferUpdateGRPCMethod(table string, setFields []setFiel
 
 	// Check WHERE clause for verb hints
 	for _, wf := range whereFields {
-		if verb := extractActionVerb(wf.column); verb != "" {
+		if verb := dt.actionVerb(wf.column); verb != "" {
 			if !verbConflictsWithEntity(verb, entityName) {
 				return verb + entityName
 			}
 		}
-		if verb := extractActionVerb(wf.variable); verb != "" {
+		if verb := dt.actionVerb(wf.variable); verb != "" {
 			if !verbConflictsWithEntity(verb, entityName) {
 				return verb + entityName
 			}
@@ -984,7 +1390,7 @@ func (dt *dmlTranspiler) transpileUpdateMock(s *ast.UpdateStatement) (string, er
 	}
 	dt.symbols.markDeclared("err")
 	
-	out.WriteString(fmt.Sprintf("err %s %s.%s(", assignOp, dt.config.StoreVar, methodName))
+	out.WriteString(fmt.Sprintf("err %s %s.%s(", assignOp, dt.mockStoreVar(), methodName))
 
 	// Combine SET and WHERE fields
 	var argList []string
@@ -1016,9 +1422,31 @@ func (t *transpiler) transpileDelete(s *ast.DeleteStatement) (string, error) {
 }
 
 func (dt *dmlTranspiler) transpileDelete(s *ast.DeleteStatement) (string, error) {
+	// The parser reads the table of DELETE FROM t OUTPUT ... as an alias
+	if s.Table == nil && s.Alias != nil && s.From == nil && s.Output != nil {
+		fixed := *s
+		fixed.Table = &ast.QualifiedIdentifier{Parts: []*ast.Identifier{s.Alias}}
+		fixed.Alias = nil
+		s = &fixed
+	}
+	if s.CurrentOfCursor != nil {
+		keyed, err := dt.currentOfDelete(s)
+		if err != nil {
+			return "", err
+		}
+		s = keyed
+	}
+
 	// Determine effective backend (use fallback for temp tables)
 	tableName := dt.extractDeleteTable(s)
+	if table := dt.memoryTable(tableName); table != nil {
+		return dt.transpileDeleteMemory(s, table)
+	}
+	dt.warnEventTable("DELETE", tableName)
 	backend := dt.getEffectiveBackend(tableName)
+	if err := dt.tableParamBackendError(s, backend); err != nil {
+		return "", err
+	}
 	
 	switch backend {
 	case BackendSQL:
@@ -1027,6 +1455,10 @@ func (dt *dmlTranspiler) transpileDelete(s *ast.DeleteStatement) (string, error)
 		return dt.transpileDeleteGRPC(s)
 	case BackendMock:
 		return dt.transpileDeleteMock(s)
+	case BackendMongo:
+		return dt.transpileDeleteMongo(s)
+	case BackendRedis:
+		return dt.transpileDeleteRedis(s)
 	default:
 		return dt.transpileDeleteSQL(s)
 	}
@@ -1044,12 +1476,17 @@ func (dt *dmlTranspiler) transpileDeleteSQL(s *ast.DeleteStatement) (string, err
 	query, args := dt.buildDeleteQuery(s)
 	
 	// Post-process to catch any remaining @variable references
-	query, extraArgs := dt.substituteVariablesInQuery(query)
-	args = append(args, extraArgs...)
+	query, args = dt.bindQueryVariables(query, args)
 	
 	// Get the database variable (tx if in transaction, StoreVar otherwise)
 	dbVar := dt.getDBVar()
 
+	// OUTPUT rows come back from RETURNING (or OUTPUT on SQL Server)
+	if dt.returnsOutput(s.Output, "DELETE") {
+		out.WriteString(dt.transpileOutputSQL(s.Output, "DELETE", query, args, false))
+		return out.String(), nil
+	}
+
 	// Check if result and err are already declared
 	resultDeclared := dt.symbols.isDeclared("result")
 	errDeclared := dt.symbols.isDeclared("err")
@@ -1130,12 +1567,12 @@ func (dt *dmlTranspiler) inferDeleteGRPCMethod(table string, whereFields []where
 	
 	// Check WHERE clause for verb hints
 	for _, wf := range whereFields {
-		if verb := extractActionVerb(wf.column); verb != "" {
+		if verb := dt.actionVerb(wf.column); verb != "" {
 			if !verbConflictsWithEntity(verb, entityName) {
 				return verb + entityName
 			}
 		}
-		if verb := extractActionVerb(wf.variable); verb != "" {
+		if verb := dt.actionVerb(wf.variable); verb != "" {
 			if !verbConflictsWithEntity(verb, entityName) {
 				return verb + entityName
 			}
@@ -1151,7 +1588,7 @@ func (dt *dmlTranspiler) transpileDeleteMock(s *ast.DeleteStatement) (string, er
 	methodName := "Delete" + toPascalCase(singularize(tableName))
 
 	var out strings.Builder
-	out.WriteString(fmt.Sprintf("err := %s.%s(", dt.config.StoreVar, methodName))
+	out.WriteString(fmt.Sprintf("err := %s.%s(", dt.mockStoreVar(), methodName))
 
 	whereFields := dt.extractWhereFieldsFromDelete(s)
 	var argList []string
@@ -1199,7 +1636,7 @@ func (dt *dmlTranspiler) transpileWithSelect(ws *ast.WithStatement, sel *ast.Sel
 	var out strings.Builder
 
 	// Build the full CTE query and strip table hints
-	query := stripTableHints(ws.String())
+	query := dt.removeTableHints(ws.String())
 	
 	// Convert @variable references to parameter placeholders
 	query, args := dt.substituteVariablesInQuery(query)
@@ -1215,7 +1652,7 @@ func (dt *dmlTranspiler) transpileWithSelect(ws *ast.WithStatement, sel *ast.Sel
 	
 	// Extract column names from the main SELECT for scan targets
 	columns := dt.extractSelectColumns(sel)
-	scanDecl, scanTargets := dt.generateScanTargets(columns)
+	scanDecl, scanTargets, scanAssigns := dt.generateScanTargets(columns)
 
 	// Generate CTE names for comment
 	cteNames := make([]string, len(ws.CTEs))
@@ -1251,6 +1688,7 @@ func (dt *dmlTranspiler) transpileWithSelect(ws *ast.WithStatement, sel *ast.Sel
 		out.WriteString("\n")
 		out.WriteString(dt.indentStr())
 		out.WriteString("}")
+		dt.writeScanAssigns(&out, scanAssigns, "")
 	} else {
 		// Use Query for multi-row SELECT
 		rowsDeclared := dt.symbols.isDeclared("rows")
@@ -1287,7 +1725,9 @@ func (dt *dmlTranspiler) transpileWithSelect(ws *ast.WithStatement, sel *ast.Sel
 		out.WriteString(dt.buildErrorReturn())
 		out.WriteString("\n")
 		out.WriteString(dt.indentStr())
-		out.WriteString("\t}\n")
+		out.WriteString("\t}")
+		dt.writeScanAssigns(&out, scanAssigns, "\t")
+		out.WriteString("\n")
 		out.WriteString(dt.indentStr())
 		out.WriteString("}")
 	}
@@ -1306,10 +1746,7 @@ func (dt *dmlTranspiler) transpileWithSelectIntoVars(ws *ast.WithStatement, sel
 	dbVar := dt.getDBVar()
 	
 	// Build scan targets from assignments
-	var scanTargets []string
-	for _, a := range assignments {
-		scanTargets = append(scanTargets, "&"+a.varName)
-	}
+	scanDecls, scanTargets, scanAssigns := dt.varScanTargets(assignments)
 
 	// Generate CTE names for comment
 	cteNames := make([]string, len(ws.CTEs))
@@ -1321,6 +1758,10 @@ func (dt *dmlTranspiler) transpileWithSelectIntoVars(ws *ast.WithStatement, sel
 
 	out.WriteString(fmt.Sprintf("// WITH %s - CTE SELECT INTO variables\n", strings.Join(cteNames, ", ")))
 	out.WriteString(dt.indentStr())
+	for _, decl := range scanDecls {
+		out.WriteString(decl + "\n")
+		out.WriteString(dt.indentStr())
+	}
 	out.WriteString(fmt.Sprintf("row := %s.QueryRowContext(ctx, %q", dbVar, query))
 	for _, arg := range args {
 		out.WriteString(", " + arg)
@@ -1338,6 +1779,13 @@ func (dt *dmlTranspiler) transpileWithSelectIntoVars(ws *ast.WithStatement, sel
 	out.WriteString("\t}\n")
 	out.WriteString(dt.indentStr())
 	out.WriteString("}")
+	if len(scanAssigns) > 0 {
+		out.WriteString(" else {")
+		dt.writeScanAssigns(&out, scanAssigns, "\t")
+		out.WriteString("\n")
+		out.WriteString(dt.indentStr())
+		out.WriteString("}")
+	}
 
 	return out.String(), nil
 }
@@ -1347,7 +1795,7 @@ func (dt *dmlTranspiler) transpileWithInsert(ws *ast.WithStatement, ins *ast.Ins
 	var out strings.Builder
 
 	// Build the full CTE query and strip table hints
-	query := stripTableHints(ws.String())
+	query := dt.removeTableHints(ws.String())
 	
 	// Convert @variable references to parameter placeholders
 	query, args := dt.substituteVariablesInQuery(query)
@@ -1399,7 +1847,7 @@ func (dt *dmlTranspiler) transpileWithUpdate(ws *ast.WithStatement, upd *ast.Upd
 	var out strings.Builder
 
 	// Build the full CTE query and strip table hints
-	query := stripTableHints(ws.String())
+	query := dt.removeTableHints(ws.String())
 	
 	// Convert @variable references to parameter placeholders
 	query, args := dt.substituteVariablesInQuery(query)
@@ -1451,7 +1899,7 @@ func (dt *dmlTranspiler) transpileWithDelete(ws *ast.WithStatement, del *ast.Del
 	var out strings.Builder
 
 	// Build the full CTE query and strip table hints
-	query := stripTableHints(ws.String())
+	query := dt.removeTableHints(ws.String())
 	
 	// Convert @variable references to parameter placeholders
 	query, args := dt.substituteVariablesInQuery(query)
@@ -1501,16 +1949,78 @@ func (dt *dmlTranspiler) transpileWithDelete(ws *ast.WithStatement, del *ast.Del
 // substituteVariablesInQuery replaces @variable references with parameter placeholders
 // Same variable appearing multiple times reuses the same placeholder number.
 func (dt *dmlTranspiler) substituteVariablesInQuery(query string) (string, []string) {
+	return dt.bindQueryVariables(query, nil)
+}
+
+// bindQueryVariables replaces the @variable references left in a query
+// whose placeholders are already bound to args, numbering old and new
+// placeholders in the order they appear and returning the arguments in
+// that order. ? placeholders take an argument per occurrence, as a
+// variable used twice is bound twice.
+func (dt *dmlTranspiler) bindQueryVariables(query string, bound []string) (string, []string) {
+	// A tgpiler:dialect variant replaces the first query of its statement
+	// and is kept as written (see variants.go)
+	variant := dt.variantSQL != ""
+	if variant {
+		query, bound = dt.variantSQL, nil
+		dt.variantSQL = ""
+	}
+
+	// Spatial and hierarchyid methods, while variables are still names
+	if !variant {
+		query = dt.rewriteCLRSQL(query)
+	}
+
+	// Scalar UDF calls evaluated in Go become @markers bound like variables
+	query, hoisted := dt.rewriteUDFCallsInSQL(query)
+	query, hoisted = dt.bindIdentityReads(query, hoisted)
+
+	// Date functions too, as their rewrites can use an operand more than
+	// once or out of order, and a ? placeholder is bound at each use
+	if !variant {
+		query = dt.normalizeDateSQL(query)
+	}
+	
 	var args []string
 	var result strings.Builder
 	paramIndex := 1 // Start at 1 for the existing getPlaceholder
+	positional := dt.getPlaceholder(1) == "?"
+	nextBound := 0 // Next bound argument of a ? placeholder
+	usedBound := make(map[int]bool)
 	
 	// Track variable -> placeholder index mapping for reuse
 	varToPlaceholder := make(map[string]int)
+	bind := func(key, arg string) {
+		if idx, seen := varToPlaceholder[key]; seen && !positional {
+			result.WriteString(dt.getPlaceholder(idx))
+			return
+		}
+		result.WriteString(dt.getPlaceholder(paramIndex))
+		varToPlaceholder[key] = paramIndex
+		args = append(args, arg)
+		paramIndex++
+	}
 	
 	pos := 0
 	inSingleQuote := false
 	for pos < len(query) {
+		// Placeholders bound before, renumbered with the new ones
+		if !inSingleQuote && len(bound) > 0 {
+			if positional && query[pos] == '?' && nextBound < len(bound) {
+				bind("?"+strconv.Itoa(nextBound), bound[nextBound])
+				usedBound[nextBound] = true
+				nextBound++
+				pos++
+				continue
+			}
+			if n, end := dt.boundPlaceholder(query, pos); n >= 1 && n <= len(bound) {
+				bind("$"+strconv.Itoa(n), bound[n-1])
+				usedBound[n-1] = true
+				pos = end
+				continue
+			}
+		}
+
 		// Track whether we're inside a single-quoted string
 		if query[pos] == '\'' {
 			// Check for escaped quote ''
@@ -1554,20 +2064,20 @@ func (dt *dmlTranspiler) substituteVariablesInQuery(query string) (string, []str
 				goVar := goIdentifier(varName)
 				varKey := strings.ToLower(varName) // Case-insensitive lookup
 				
-				// Check if we've seen this variable before
-				if existingIdx, seen := varToPlaceholder[varKey]; seen {
-					// Reuse existing placeholder
-					placeholder := dt.getPlaceholder(existingIdx)
-					result.WriteString(placeholder)
+				// Table-valued parameters are expanded at runtime (see tvp.go)
+				if _, ok := dt.tableParams[varKey]; ok {
+					result.WriteString(query[pos:end])
+					pos = end
+					continue
+				}
+				
+				// A variable seen before reuses its placeholder
+				if goExpr, ok := hoisted[varKey]; ok {
+					bind(varKey, goExpr)
 				} else {
-					// New variable - assign next placeholder
-					placeholder := dt.getPlaceholder(paramIndex)
-					result.WriteString(placeholder)
-					varToPlaceholder[varKey] = paramIndex
-					args = append(args, goVar)
+					bind(varKey, goVar)
 					// Mark variable as used (read) for unused variable detection
 					dt.symbols.markUsed(goVar)
-					paramIndex++
 				}
 				
 				pos = end
@@ -1577,15 +2087,55 @@ func (dt *dmlTranspiler) substituteVariablesInQuery(query string) (string, []str
 		result.WriteByte(query[pos])
 		pos++
 	}
+
+	// Arguments whose placeholders weren't found are kept, for the
+	// placeholder check to report
+	for i, arg := range bound {
+		if !usedBound[i] {
+			args = append(args, arg)
+		}
+	}
 	
+	if variant {
+		return result.String(), args
+	}
+
 	// Apply dialect-specific SQL normalization
 	finalQuery := dt.normalizeDialectSQL(result.String())
 	
 	return finalQuery, args
 }
 
+// boundPlaceholder returns the number and end of the dialect's numbered
+// placeholder at query[pos], or 0 if there is none.
+func (dt *dmlTranspiler) boundPlaceholder(query string, pos int) (int, int) {
+	prefix := strings.TrimSuffix(dt.getPlaceholder(1), "1")
+	if prefix == "?" || !strings.HasPrefix(query[pos:], prefix) {
+		return 0, pos
+	}
+	end := pos + len(prefix)
+	for end < len(query) && query[end] >= '0' && query[end] <= '9' {
+		end++
+	}
+	if end < len(query) && (isAlphaNumForCTE(query[end]) || query[end] == '_') {
+		return 0, pos
+	}
+	n, err := strconv.Atoi(query[pos+len(prefix) : end])
+	if err != nil {
+		return 0, pos
+	}
+	return n, end
+}
+
 // normalizeDialectSQL converts T-SQL specific syntax to target dialect
 func (dt *dmlTranspiler) normalizeDialectSQL(query string) string {
+	query = dt.normalizeTimeSQL(query)
+	query = dt.normalizeSequenceSQL(query)
+	query = dt.normalizeForXMLSQL(query)
+	query = dt.normalizeXMLSQL(query)
+	query = dt.normalizeJSONSQL(query)
+	query = dt.normalizeStringSQL(query)
+	query = dt.normalizeFullTextSQL(query)
 	if dt.config.SQLDialect == "postgres" {
 		// ISNULL(x, y) -> COALESCE(x, y)
 		query = strings.ReplaceAll(query, "ISNULL(", "COALESCE(")
@@ -1606,9 +2156,11 @@ func (dt *dmlTranspiler) normalizeDialectSQL(query string) string {
 	return query
 }
 
-// isAlphaForCTE checks if a character is alphabetic
+// isAlphaForCTE checks if a character is alphabetic. Every byte of a
+// multi-byte UTF-8 sequence is >= 0x80, so non-ASCII letters (@año) are
+// scanned as part of the identifier rather than ending it.
 func isAlphaForCTE(c byte) bool {
-	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= utf8.RuneSelf
 }
 
 // isAlphaNumForCTE checks if a character is alphanumeric
@@ -1632,6 +2184,28 @@ func (dt *dmlTranspiler) transpileExec(s *ast.ExecStatement) (string, error) {
 	// Clean up procedure name (remove dbo. prefix, etc.)
 	procName = cleanProcedureName(procName)
 
+	// Database Mail goes to the application's Notifier
+	if proc := dbMailProc(s); proc != "" {
+		return dt.transpileSendMail(s, proc)
+	}
+
+	if proc := xmlDocumentProc(s); proc != "" {
+		return dt.transpileXMLDocument(s, proc)
+	}
+
+	if isSequenceRangeProc(s) {
+		return dt.transpileSequenceRange(s)
+	}
+
+	if isAppLockProc(s) {
+		return dt.transpileAppLock(s)
+	}
+
+	// Procedures still in the database are called through a stub
+	if dt.isPassthrough(s.Procedure) {
+		return dt.transpilePassthroughExec(s)
+	}
+
 	// Check if gRPC backend with explicit mapping
 	if dt.config.Backend == BackendGRPC {
 		if mapping, ok := dt.lookupGRPCMapping(procName); ok {
@@ -1844,6 +2418,9 @@ func (dt *dmlTranspiler) inferMethodFromProcedure(procName string) string {
 // transpileExecFunction generates a Go function call for EXEC (default behavior).
 func (dt *dmlTranspiler) transpileExecFunction(s *ast.ExecStatement, procName string) (string, error) {
 	funcName := goExportedIdentifier(procName)
+	if pkg := dt.procedurePackage(s.Procedure); pkg != "" {
+		funcName = pkg + "." + funcName
+	}
 
 	var out strings.Builder
 	out.WriteString(fmt.Sprintf("// EXEC %s\n", procName))
@@ -1867,6 +2444,10 @@ func (dt *dmlTranspiler) transpileExecFunction(s *ast.ExecStatement, procName st
 			args = append(args, argVal)
 		}
 		resultVar := goIdentifier(s.ReturnVariable.Value)
+		args = append(dt.execLeadingArgs(), args...)
+		if dt.config.Style == StyleFunctions {
+			return out.String() + dt.execCallChecked([]string{resultVar}, funcName, args), nil
+		}
 		out.WriteString(fmt.Sprintf("%s = %s(%s)", resultVar, funcName, strings.Join(args, ", ")))
 	} else {
 		// Check for OUTPUT params that need to capture return values
@@ -1885,7 +2466,7 @@ func (dt *dmlTranspiler) transpileExecFunction(s *ast.ExecStatement, procName st
 		}
 
 		// Build non-output args (these ARE being read, so transpileExpression is correct)
-		var callArgs []string
+		callArgs := dt.execLeadingArgs()
 		for _, p := range s.Parameters {
 			if !p.Output {
 				argVal, _ := dt.transpileExpression(p.Value)
@@ -1893,6 +2474,9 @@ func (dt *dmlTranspiler) transpileExecFunction(s *ast.ExecStatement, procName st
 			}
 		}
 
+		if dt.config.Style == StyleFunctions {
+			return out.String() + dt.execCallChecked(outputVars, funcName, callArgs), nil
+		}
 		if len(outputVars) > 0 {
 			out.WriteString(strings.Join(outputVars, ", "))
 			out.WriteString(" = ")
@@ -1903,6 +2487,40 @@ func (dt *dmlTranspiler) transpileExecFunction(s *ast.ExecStatement, procName st
 	return out.String(), nil
 }
 
+// execCallChecked calls a functional-style procedure, which always returns
+// an error after its results, assigning the results to targets and
+// returning the error.
+func (dt *dmlTranspiler) execCallChecked(targets []string, funcName string, args []string) string {
+	call := fmt.Sprintf("%s(%s)", funcName, strings.Join(args, ", "))
+	if len(targets) == 0 {
+		call = "err := " + call
+	} else {
+		call = strings.Join(append(targets, "err"), ", ") + " = " + call
+	}
+	return fmt.Sprintf("if %s; err != nil {\n%s\t%s\n%s}", call, dt.indentStr(), dt.buildErrorReturn(), dt.indentStr())
+}
+
+// execLeadingArgs returns the arguments every call to another transpiled
+// procedure starts with. Functional style threads ctx and the store through
+// explicitly since there is no receiver to carry them; within a transaction
+// the store is the transaction, so the callee's statements are part of it.
+func (dt *dmlTranspiler) execLeadingArgs() []string {
+	if dt.config.Style != StyleFunctions {
+		return nil
+	}
+	if dt.hasStoreParam() {
+		return []string{"ctx", dt.getDBVar()}
+	}
+	return []string{"ctx"}
+}
+
+// hasStoreParam reports whether functional-style procedures take the store
+// as a parameter. Only the SQL backend has a store; gRPC clients and mock
+// stores remain free variables.
+func (t *transpiler) hasStoreParam() bool {
+	return t.dmlConfig.Style == StyleFunctions && (t.dmlConfig.Backend == BackendSQL || t.dmlConfig.Backend == "")
+}
+
 // Helper types and functions
 
 type varAssignment struct {
@@ -1920,6 +2538,7 @@ type whereField struct {
 type whereFieldWithValue struct {
 	column    string
 	value     string // Go code for the value (variable name or literal)
+	expr      ast.Expression
 	operator  string
 	isComplex bool   // True if expression couldn't be converted to Go
 	rawExpr   string // Original T-SQL for complex expressions
@@ -1928,11 +2547,13 @@ type whereFieldWithValue struct {
 type insertField struct {
 	column string
 	value  string
+	expr   ast.Expression
 }
 
 type setField struct {
 	column string
 	value  string
+	expr   ast.Expression
 }
 
 // extractSelectAssignments extracts SELECT @var = col patterns.
@@ -2066,8 +2687,14 @@ func (dt *dmlTranspiler) walkWhereExprWithLiterals(expr ast.Expression, fields *
 			value = goIdentifier(strings.TrimPrefix(v.Name, "@"))
 		case *ast.StringLiteral:
 			value = fmt.Sprintf("%q", v.Value)
+			if ref, ok := dt.constantFor(v); ok {
+				value = ref
+			}
 		case *ast.IntegerLiteral:
 			value = fmt.Sprintf("%d", v.Value)
+			if ref, ok := dt.constantFor(v); ok {
+				value = ref
+			}
 		case *ast.FloatLiteral:
 			value = fmt.Sprintf("%v", v.Value)
 		case *ast.NullLiteral:
@@ -2098,6 +2725,7 @@ func (dt *dmlTranspiler) walkWhereExprWithLiterals(expr ast.Expression, fields *
 			*fields = append(*fields, whereFieldWithValue{
 				column:   colName,
 				value:    value,
+				expr:     e.Right,
 				operator: op,
 			})
 		} else if isComplex {
@@ -2128,9 +2756,8 @@ func (dt *dmlTranspiler) tryTranspileSimpleFunc(f *ast.FunctionCall) (string, bo
 	}
 	
 	switch funcName {
-	case "GETDATE", "GETUTCDATE", "SYSDATETIME", "SYSUTCDATETIME":
-		dt.imports["time"] = true
-		return "time.Now()", true
+	case "GETDATE", "GETUTCDATE", "SYSDATETIME", "SYSUTCDATETIME", "SYSDATETIMEOFFSET":
+		return dt.timeNow(funcName), true
 	case "NEWID":
 		dt.imports["github.com/google/uuid"] = true
 		return "uuid.New().String()", true
@@ -2168,12 +2795,14 @@ func (dt *dmlTranspiler) extractInsertFields(s *ast.InsertStatement) []insertFie
 		colName := col.Value
 
 		value := ""
+		var expr ast.Expression
 		if len(s.Values) > 0 && i < len(s.Values[0]) {
-			value = dt.exprToGoValue(s.Values[0][i])
+			expr = s.Values[0][i]
+			value = dt.exprToGoValue(expr)
 		}
 
 		if colName != "" {
-			fields = append(fields, insertField{column: colName, value: value})
+			fields = append(fields, insertField{column: colName, value: value, expr: expr})
 		}
 	}
 
@@ -2197,7 +2826,7 @@ func (dt *dmlTranspiler) extractUpdateSetFields(s *ast.UpdateStatement) []setFie
 		value := dt.exprToGoValue(set.Value)
 
 		if colName != "" {
-			fields = append(fields, setField{column: colName, value: value})
+			fields = append(fields, setField{column: colName, value: value, expr: set.Value})
 		}
 	}
 
@@ -2255,6 +2884,7 @@ func isTempTable(tableName string) bool {
 }
 
 // getEffectiveBackend returns the backend to use for a given table.
+// Tables listed in TableToBackend use their configured backend.
 // For temp tables, it returns the fallback backend (typically SQL).
 // For regular tables, it returns the primary backend.
 // Also tracks temp tables encountered for warning purposes.
@@ -2262,6 +2892,11 @@ func (dt *dmlTranspiler) getEffectiveBackend(tableName string) BackendType {
 	if isTempTable(tableName) {
 		// Record this temp table for warning purposes
 		dt.recordTempTable(tableName)
+	}
+	if backend, ok := lookupTableBackend(dt.config.TableToBackend, tableName); ok {
+		return backend
+	}
+	if isTempTable(tableName) {
 		if dt.config.FallbackBackend != "" {
 			return dt.config.FallbackBackend
 		}
@@ -2269,6 +2904,23 @@ func (dt *dmlTranspiler) getEffectiveBackend(tableName string) BackendType {
 	return dt.config.Backend
 }
 
+// lookupTableBackend finds tableName in a TableToBackend map, ignoring case
+// and any schema prefix on the configured name.
+func lookupTableBackend(routes map[string]BackendType, tableName string) (BackendType, bool) {
+	if backend, ok := routes[tableName]; ok {
+		return backend, true
+	}
+	for name, backend := range routes {
+		if idx := strings.LastIndex(name, "."); idx >= 0 {
+			name = name[idx+1:]
+		}
+		if strings.EqualFold(strings.Trim(name, "[]"), tableName) {
+			return backend, true
+		}
+	}
+	return "", false
+}
+
 // recordTempTable adds a temp table name to the tracking list (deduped).
 func (dt *dmlTranspiler) recordTempTable(name string) {
 	for _, existing := range dt.transpiler.tempTablesUsed {
@@ -2285,42 +2937,193 @@ func (dt *dmlTranspiler) buildSelectQuery(s *ast.SelectStatement) (string, []str
 	// Build dialect-appropriate SELECT query
 	// NOTE: This function does NOT substitute @variables - it preserves them
 	// for substituteVariablesInQuery to handle in one coordinated pass
+	if s.Union == nil {
+		return dt.selectBranchSQL(s) + dt.lockingClause(s), nil
+	}
+
+	// UNION, INTERSECT and EXCEPT chain the branches through Union.Right.
+	// Each is built as a query of its own, its variables bound with the
+	// rest, and the columns scanned are those of the first. The parser
+	// leaves the ORDER BY and OFFSET of the whole result on the last
+	// branch, where they end the query as they should.
 	var query strings.Builder
+	query.WriteString(dt.setBranchSQL(s))
+	for u := s.Union; u != nil && u.Right != nil; u = u.Right.Union {
+		op := u.Type
+		if op == "EXCEPT" && dt.config.SQLDialect == "oracle" {
+			op = "MINUS"
+		}
+		if u.All {
+			op += " ALL"
+		}
+		query.WriteString(" " + op + " ")
+		query.WriteString(dt.setBranchSQL(u.Right))
+	}
+	return query.String(), nil
+}
+
+// setBranchSQL returns a branch of a set operation. A TOP limits only its
+// own branch, so outside SQL Server the branch is parenthesized to keep
+// its LIMIT there; SQLite takes no parenthesized branches and selects
+// from it instead.
+func (dt *dmlTranspiler) setBranchSQL(s *ast.SelectStatement) string {
+	branch := dt.selectBranchSQL(s)
+	switch {
+	case s.Top == nil || dt.config.SQLDialect == "sqlserver":
+		return branch
+	case dt.config.SQLDialect == "sqlite":
+		return "SELECT * FROM (" + branch + ")"
+	}
+	return "(" + branch + ")"
+}
+
+// selectBranchSQL returns a SELECT without the queries set operations
+// combine it with.
+func (dt *dmlTranspiler) selectBranchSQL(s *ast.SelectStatement) string {
+	var query strings.Builder
+
+	// FROM, with PIVOT, UNPIVOT (see pivot.go) and APPLY (see apply.go)
+	// rewritten for the dialect. APPLYs turned into scalar subqueries
+	// replace the references to their columns.
+	rewrites := map[string]string{}
+	var from string
+	if s.From != nil {
+		var tables []string
+		for _, t := range s.From.Tables {
+			tables = append(tables, dt.tableSQL(t, s, rewrites))
+		}
+		from = " FROM " + strings.Join(tables, ", ")
+	}
 
 	query.WriteString("SELECT ")
+	if s.Distinct {
+		query.WriteString("DISTINCT ")
+	}
+	top, limit := dt.selectLimit(s)
+	if top != "" {
+		query.WriteString(top + " ")
+	}
 
 	// Columns - strip @Var = assignment syntax (handled by Scan)
+	listed := s
+	if s.From != nil {
+		listed = dt.quotePivotColumns(s)
+	}
 	if s.Columns != nil {
 		var cols []string
-		for _, item := range s.Columns {
+		for _, item := range listed.Columns {
 			// If this is a SELECT @var = expr, output only expr
 			if item.Variable != nil && item.Expression != nil {
-				cols = append(cols, item.Expression.String())
+				cols = append(cols, dt.clrColumnSQL(item.Variable.Name, item.Expression.String()))
 			} else {
 				cols = append(cols, item.String())
 			}
 		}
-		query.WriteString(strings.Join(cols, ", "))
-	}
-
-	// FROM
-	if s.From != nil {
-		query.WriteString(" FROM ")
-		var tables []string
-		for _, t := range s.From.Tables {
-			tables = append(tables, t.String())
-		}
-		query.WriteString(strings.Join(tables, ", "))
+		query.WriteString(applyColumnRewrites(strings.Join(cols, ", "), rewrites))
 	}
+	query.WriteString(from)
 
 	// WHERE - preserve @variables, don't substitute yet
 	if s.Where != nil {
 		query.WriteString(" WHERE ")
-		query.WriteString(s.Where.String())
+		query.WriteString(applyColumnRewrites(s.Where.String(), rewrites))
+	}
+	if len(s.GroupBy) > 0 {
+		var groups []string
+		for _, g := range s.GroupBy {
+			groups = append(groups, g.String())
+		}
+		query.WriteString(" GROUP BY ")
+		query.WriteString(applyColumnRewrites(strings.Join(groups, ", "), rewrites))
+	}
+	if s.Having != nil {
+		query.WriteString(" HAVING ")
+		query.WriteString(applyColumnRewrites(s.Having.String(), rewrites))
 	}
+	if len(s.OrderBy) > 0 {
+		var items []string
+		for _, item := range s.OrderBy {
+			items = append(items, item.String())
+		}
+		query.WriteString(" ORDER BY ")
+		query.WriteString(applyColumnRewrites(strings.Join(items, ", "), rewrites))
+	}
+	query.WriteString(limit)
 
 	// No args returned - all substitution done by substituteVariablesInQuery
-	return stripTableHints(query.String()), nil
+	return dt.removeTableHints(query.String())
+}
+
+// selectLimit returns the row limit of a SELECT, from TOP or OFFSET/FETCH,
+// in the dialect's syntax: top goes after SELECT (SQL Server's own TOP),
+// limit at the end of the query.
+//
+//	TOP 10                        LIMIT 10 (FETCH FIRST 10 ROWS ONLY on Oracle)
+//	OFFSET 20 ROWS FETCH NEXT 10  LIMIT 10 OFFSET 20
+//
+// PostgreSQL and Oracle keep WITH TIES, Oracle PERCENT. Elsewhere they
+// have no equivalent and are dropped with a warning.
+func (dt *dmlTranspiler) selectLimit(s *ast.SelectStatement) (top, limit string) {
+	dialect := dt.config.SQLDialect
+	if dialect == "sqlserver" {
+		if s.Top != nil {
+			top = s.Top.String()
+		}
+		if s.Offset != nil {
+			limit = " OFFSET " + s.Offset.String() + " ROWS"
+			if s.Fetch != nil {
+				limit += " FETCH NEXT " + s.Fetch.String() + " ROWS ONLY"
+			}
+		}
+		return top, limit
+	}
+
+	if s.Top != nil {
+		count := s.Top.Count.String()
+		switch {
+		case dialect == "oracle":
+			if s.Top.Percent {
+				count += " PERCENT"
+			}
+			if s.Top.WithTies {
+				return "", " FETCH FIRST " + count + " ROWS WITH TIES"
+			}
+			return "", " FETCH FIRST " + count + " ROWS ONLY"
+		case s.Top.Percent:
+			dt.warnings = append(dt.warnings, fmt.Sprintf(
+				"%s: TOP %s PERCENT has no %s equivalent and is dropped", dt.currentProcName, count, dialect))
+			return "", ""
+		case s.Top.WithTies && dialect == "postgres":
+			return "", " FETCH FIRST " + count + " ROWS WITH TIES"
+		case s.Top.WithTies:
+			dt.warnings = append(dt.warnings, fmt.Sprintf(
+				"%s: TOP %s WITH TIES has no %s equivalent; ties past the last row are dropped", dt.currentProcName, count, dialect))
+		}
+		return "", " LIMIT " + count
+	}
+
+	if s.Offset == nil {
+		return "", ""
+	}
+	offset := s.Offset.String()
+	if dialect == "oracle" {
+		limit = " OFFSET " + offset + " ROWS"
+		if s.Fetch != nil {
+			limit += " FETCH NEXT " + s.Fetch.String() + " ROWS ONLY"
+		}
+		return "", limit
+	}
+	if s.Fetch != nil {
+		return "", " LIMIT " + s.Fetch.String() + " OFFSET " + offset
+	}
+	switch dialect {
+	case "mysql":
+		// MySQL has no OFFSET without a LIMIT
+		return "", " LIMIT 18446744073709551615 OFFSET " + offset
+	case "sqlite":
+		return "", " LIMIT -1 OFFSET " + offset
+	}
+	return "", " OFFSET " + offset
 }
 
 func (dt *dmlTranspiler) buildInsertQuery(s *ast.InsertStatement) (string, []string) {
@@ -2343,19 +3146,39 @@ func (dt *dmlTranspiler) buildInsertQuery(s *ast.InsertStatement) (string, []str
 		query.WriteString(strings.Join(cols, ", "))
 		query.WriteString(")")
 	}
+	output, returning := dt.outputClause(s.Output, "INSERT")
+	if dt.outputKeepsIdentity(s) {
+		// Each row ends with the identity value, for SCOPE_IDENTITY()
+		column := dt.identityColumn(dt.extractInsertTable(s))
+		if output != "" {
+			output += ", INSERTED." + column
+		} else {
+			returning += ", " + column
+		}
+	}
+	query.WriteString(output)
 
 	// VALUES or SELECT
 	if s.Values != nil && len(s.Values) > 0 && len(s.Values[0]) > 0 {
-		query.WriteString(" VALUES (")
-		var placeholders []string
-		for _, val := range s.Values[0] {
-			placeholder := dt.getPlaceholder(argNum)
-			argNum++
-			placeholders = append(placeholders, placeholder)
-			args = append(args, dt.exprToGoValue(val))
-		}
-		query.WriteString(strings.Join(placeholders, ", "))
-		query.WriteString(")")
+		query.WriteString(" VALUES ")
+		var rows []string
+		for _, row := range s.Values {
+			var placeholders []string
+			for _, val := range row {
+				if next, ok := val.(*ast.NextValueForExpression); ok {
+					if sql, ok := dt.nextValueSQL(sequenceName(next.SequenceName)); ok {
+						placeholders = append(placeholders, sql)
+						continue
+					}
+				}
+				placeholder := dt.getPlaceholder(argNum)
+				argNum++
+				placeholders = append(placeholders, placeholder)
+				args = append(args, dt.exprToGoValue(val))
+			}
+			rows = append(rows, "("+strings.Join(placeholders, ", ")+")")
+		}
+		query.WriteString(strings.Join(rows, ", "))
 	} else if s.Select != nil {
 		// INSERT...SELECT
 		query.WriteString(" ")
@@ -2365,8 +3188,9 @@ func (dt *dmlTranspiler) buildInsertQuery(s *ast.InsertStatement) (string, []str
 	} else if s.DefaultValues {
 		query.WriteString(" DEFAULT VALUES")
 	}
+	query.WriteString(returning)
 
-	return stripTableHints(query.String()), args
+	return dt.removeTableHints(query.String()), args
 }
 
 func (dt *dmlTranspiler) buildUpdateQuery(s *ast.UpdateStatement) (string, []string) {
@@ -2385,28 +3209,38 @@ func (dt *dmlTranspiler) buildUpdateQuery(s *ast.UpdateStatement) (string, []str
 		query.WriteString(s.Alias.Value)
 	}
 
-	// SET
+	// SET, with a variable used by several clauses bound once
 	query.WriteString(" SET ")
 	var setClauses []string
+	pt := dt.paramTracker(argNum)
 	for _, set := range s.SetClauses {
 		col := set.Column.String()
+		if next, ok := set.Value.(*ast.NextValueForExpression); ok {
+			if sql, ok := dt.nextValueSQL(sequenceName(next.SequenceName)); ok {
+				setClauses = append(setClauses, fmt.Sprintf("%s = %s", col, sql))
+				continue
+			}
+		}
 		
 		// Check if the value expression contains column references
-		// If so, we need to keep the SQL expression and only parameterize variables
-		if dt.exprContainsColumnRef(set.Value) {
+		// If so, we need to keep the SQL expression and only parameterize variables.
+		// CASE is kept in SQL either way, rather than evaluated in Go.
+		if _, isCase := set.Value.(*ast.CaseExpression); isCase || dt.exprContainsColumnRef(set.Value) {
 			// Build SQL expression with only variables as placeholders
-			sqlExpr, exprArgs := dt.buildSQLExprWithPlaceholders(set.Value, &argNum)
-			setClauses = append(setClauses, fmt.Sprintf("%s = %s", col, sqlExpr))
-			args = append(args, exprArgs...)
+			setClauses = append(setClauses, fmt.Sprintf("%s = %s", col, dt.buildSQLExprTracked(set.Value, pt)))
 		} else {
 			// Simple value - use placeholder
-			placeholder := dt.getPlaceholder(argNum)
-			argNum++
+			placeholder := dt.getPlaceholder(pt.nextNum)
+			pt.nextNum++
 			setClauses = append(setClauses, fmt.Sprintf("%s = %s", col, placeholder))
-			args = append(args, dt.exprToGoValue(set.Value))
+			pt.addArg(dt.exprToGoValue(set.Value))
 		}
 	}
+	argNum = pt.nextNum
+	args = append(args, pt.args...)
 	query.WriteString(strings.Join(setClauses, ", "))
+	output, returning := dt.outputClause(s.Output, "UPDATE")
+	query.WriteString(output)
 
 	// FROM clause (T-SQL specific, but supported by PostgreSQL too)
 	if s.From != nil {
@@ -2423,8 +3257,9 @@ func (dt *dmlTranspiler) buildUpdateQuery(s *ast.UpdateStatement) (string, []str
 		query.WriteString(whereSQL)
 		args = append(args, whereArgs...)
 	}
+	query.WriteString(returning)
 
-	return stripTableHints(query.String()), args
+	return dt.removeTableHints(query.String()), args
 }
 
 // buildFromClause builds the FROM clause for UPDATE/DELETE with JOINs
@@ -2469,18 +3304,21 @@ func (dt *dmlTranspiler) buildTableReferenceSQL(tableRef ast.TableReference, arg
 		out.WriteString(leftSQL)
 		args = append(args, leftArgs...)
 		
-		// Join type
+		// APPLY becomes a LATERAL join for the dialect (see apply.go)
 		out.WriteString(" ")
-		if t.Type == "CROSS APPLY" || t.Type == "OUTER APPLY" {
-			out.WriteString(t.Type)
-		} else {
-			out.WriteString(t.Type)
-			if t.Hint != "" {
-				out.WriteString(" ")
-				out.WriteString(t.Hint)
-			}
-			out.WriteString(" JOIN")
+		if isApplyJoin(t) {
+			rightSQL, rightArgs := dt.buildTableReferenceSQL(t.Right, argNum)
+			out.WriteString(dt.applyJoinSQL(t, rightSQL))
+			return out.String(), append(args, rightArgs...)
+		}
+
+		// Join type
+		out.WriteString(t.Type)
+		if t.Hint != "" {
+			out.WriteString(" ")
+			out.WriteString(t.Hint)
 		}
+		out.WriteString(" JOIN")
 		out.WriteString(" ")
 		
 		// Right side
@@ -2524,6 +3362,32 @@ func (dt *dmlTranspiler) exprContainsColumnRef(expr ast.Expression) bool {
 		return dt.exprContainsColumnRef(e.Left) || dt.exprContainsColumnRef(e.Right)
 	case *ast.PrefixExpression:
 		return dt.exprContainsColumnRef(e.Right)
+	case *ast.IsNullExpression:
+		return dt.exprContainsColumnRef(e.Expr)
+	case *ast.BetweenExpression:
+		return dt.exprContainsColumnRef(e.Expr) || dt.exprContainsColumnRef(e.Low) || dt.exprContainsColumnRef(e.High)
+	case *ast.InExpression:
+		if dt.exprContainsColumnRef(e.Expr) {
+			return true
+		}
+		for _, v := range e.Values {
+			if dt.exprContainsColumnRef(v) {
+				return true
+			}
+		}
+		return false
+	case *ast.LikeExpression:
+		return dt.exprContainsColumnRef(e.Expr) || dt.exprContainsColumnRef(e.Pattern)
+	case *ast.CaseExpression:
+		if dt.exprContainsColumnRef(e.Operand) || dt.exprContainsColumnRef(e.ElseClause) {
+			return true
+		}
+		for _, when := range e.WhenClauses {
+			if dt.exprContainsColumnRef(when.Condition) || dt.exprContainsColumnRef(when.Result) {
+				return true
+			}
+		}
+		return false
 	case *ast.FunctionCall:
 		// Check function arguments
 		for _, arg := range e.Arguments {
@@ -2532,6 +3396,14 @@ func (dt *dmlTranspiler) exprContainsColumnRef(expr ast.Expression) bool {
 			}
 		}
 		return false
+	case *ast.MethodCallExpression:
+		// Schema-qualified UDF call (dbo.fn_X(...)) - check arguments
+		for _, arg := range e.Arguments {
+			if dt.exprContainsColumnRef(arg) {
+				return true
+			}
+		}
+		return false
 	}
 	
 	return false
@@ -2540,7 +3412,7 @@ func (dt *dmlTranspiler) exprContainsColumnRef(expr ast.Expression) bool {
 // buildSQLExprWithPlaceholders builds a SQL expression string, replacing only variables with placeholders
 func (dt *dmlTranspiler) buildSQLExprWithPlaceholders(expr ast.Expression, argNum *int) (string, []string) {
 	// Legacy wrapper without tracking - each call gets fresh tracker
-	pt := &paramTracker{nextNum: *argNum, varToNum: make(map[string]int), args: nil}
+	pt := dt.paramTracker(*argNum)
 	sql := dt.buildSQLExprTracked(expr, pt)
 	*argNum = pt.nextNum
 	return sql, pt.args
@@ -2579,17 +3451,90 @@ func (dt *dmlTranspiler) buildSQLExprTracked(expr ast.Expression, pt *paramTrack
 		
 	case *ast.StringLiteral:
 		return fmt.Sprintf("'%s'", e.Value)
+
+	case *ast.NullLiteral:
+		return "NULL"
 		
 	case *ast.InfixExpression:
 		leftSQL := dt.buildSQLExprTracked(e.Left, pt)
 		rightSQL := dt.buildSQLExprTracked(e.Right, pt)
+		// Operands that bind less tightly keep their parentheses
+		if needsSQLParens(e.Left, e.Operator, false) {
+			leftSQL = "(" + leftSQL + ")"
+		}
+		if needsSQLParens(e.Right, e.Operator, true) {
+			rightSQL = "(" + rightSQL + ")"
+		}
 		return fmt.Sprintf("%s %s %s", leftSQL, e.Operator, rightSQL)
+
+	case *ast.CaseExpression:
+		// CASE stays in SQL, with only its variables parameterized
+		var out strings.Builder
+		out.WriteString("CASE")
+		if e.Operand != nil {
+			out.WriteString(" " + dt.buildSQLExprTracked(e.Operand, pt))
+		}
+		for _, when := range e.WhenClauses {
+			out.WriteString(" WHEN " + dt.buildSQLExprTracked(when.Condition, pt))
+			out.WriteString(" THEN " + dt.buildSQLExprTracked(when.Result, pt))
+		}
+		if e.ElseClause != nil {
+			out.WriteString(" ELSE " + dt.buildSQLExprTracked(e.ElseClause, pt))
+		}
+		out.WriteString(" END")
+		return out.String()
 		
 	case *ast.PrefixExpression:
 		rightSQL := dt.buildSQLExprTracked(e.Right, pt)
+		if _, ok := e.Right.(*ast.InfixExpression); ok {
+			rightSQL = "(" + rightSQL + ")"
+		}
+		if strings.EqualFold(e.Operator, "NOT") {
+			return "NOT " + rightSQL
+		}
 		return fmt.Sprintf("%s%s", e.Operator, rightSQL)
+
+	// Conditions of a searched CASE
+	case *ast.IsNullExpression:
+		if e.Not {
+			return dt.buildSQLExprTracked(e.Expr, pt) + " IS NOT NULL"
+		}
+		return dt.buildSQLExprTracked(e.Expr, pt) + " IS NULL"
+
+	case *ast.BetweenExpression:
+		return dt.buildSQLExprTracked(e.Expr, pt) + notSQL(e.Not) + " BETWEEN " +
+			dt.buildSQLExprTracked(e.Low, pt) + " AND " + dt.buildSQLExprTracked(e.High, pt)
+
+	case *ast.InExpression:
+		if e.Subquery == nil {
+			values := make([]string, len(e.Values))
+			for i, v := range e.Values {
+				values[i] = dt.buildSQLExprTracked(v, pt)
+			}
+			return dt.buildSQLExprTracked(e.Expr, pt) + notSQL(e.Not) + " IN (" + strings.Join(values, ", ") + ")"
+		}
+
+	case *ast.LikeExpression:
+		like := dt.buildSQLExprTracked(e.Expr, pt) + notSQL(e.Not) + " LIKE " + dt.buildSQLExprTracked(e.Pattern, pt)
+		if e.Escape != nil {
+			like += " ESCAPE " + dt.buildSQLExprTracked(e.Escape, pt)
+		}
+		return like
+
+	case *ast.CastExpression:
+		name := "CAST"
+		if e.IsTry {
+			name = "TRY_CAST"
+		}
+		return name + "(" + dt.buildSQLExprTracked(e.Expression, pt) + " AS " + e.TargetType.String() + ")"
 		
 	case *ast.FunctionCall:
+		if goExpr, ok := dt.tryHoistUDFExpr(e); ok {
+			num := pt.nextNum
+			pt.nextNum++
+			pt.addArg(goExpr)
+			return dt.getPlaceholder(num)
+		}
 		var funcArgs []string
 		for _, arg := range e.Arguments {
 			argSQL := dt.buildSQLExprTracked(arg, pt)
@@ -2597,11 +3542,67 @@ func (dt *dmlTranspiler) buildSQLExprTracked(expr ast.Expression, pt *paramTrack
 		}
 		funcName := e.Function.String()
 		return fmt.Sprintf("%s(%s)", funcName, strings.Join(funcArgs, ", "))
+		
+	case *ast.MethodCallExpression:
+		// dbo.fn_Name(...) parses as a method call on the schema
+		if goExpr, ok := dt.tryHoistUDFExpr(e); ok {
+			num := pt.nextNum
+			pt.nextNum++
+			pt.addArg(goExpr)
+			return dt.getPlaceholder(num)
+		}
 	}
 	
 	return expr.String()
 }
 
+// notSQL returns " NOT" for a negated predicate.
+func notSQL(not bool) string {
+	if not {
+		return " NOT"
+	}
+	return ""
+}
+
+// sqlPrecedence ranks SQL operators, higher binding more tightly.
+func sqlPrecedence(op string) int {
+	switch strings.ToUpper(op) {
+	case "OR":
+		return 1
+	case "AND":
+		return 2
+	case "=", "<>", "!=", "<", ">", "<=", ">=", "LIKE", "NOT LIKE", "IN", "NOT IN":
+		return 3
+	case "+", "-", "&", "|", "^", "||":
+		return 4
+	case "*", "/", "%":
+		return 5
+	}
+	return 6
+}
+
+// needsSQLParens reports whether an operand of op must be parenthesized:
+// it binds less tightly, or, on the right, as tightly with an operator
+// that isn't associative, as in a - (b - c).
+func needsSQLParens(operand ast.Expression, op string, right bool) bool {
+	inner, ok := operand.(*ast.InfixExpression)
+	if !ok {
+		return false
+	}
+	p, q := sqlPrecedence(inner.Operator), sqlPrecedence(op)
+	if p != q {
+		return p < q
+	}
+	if !right {
+		return false
+	}
+	switch strings.ToUpper(op) {
+	case "+", "*", "AND", "OR":
+		return !strings.EqualFold(inner.Operator, op)
+	}
+	return true
+}
+
 func (dt *dmlTranspiler) buildDeleteQuery(s *ast.DeleteStatement) (string, []string) {
 	var query strings.Builder
 	var args []string
@@ -2611,6 +3612,8 @@ func (dt *dmlTranspiler) buildDeleteQuery(s *ast.DeleteStatement) (string, []str
 	if s.Table != nil {
 		query.WriteString(s.Table.String())
 	}
+	output, returning := dt.outputClause(s.Output, "DELETE")
+	query.WriteString(output)
 
 	// WHERE
 	if s.Where != nil {
@@ -2619,13 +3622,14 @@ func (dt *dmlTranspiler) buildDeleteQuery(s *ast.DeleteStatement) (string, []str
 		query.WriteString(whereSQL)
 		args = append(args, whereArgs...)
 	}
+	query.WriteString(returning)
 
-	return stripTableHints(query.String()), args
+	return dt.removeTableHints(query.String()), args
 }
 
 func (dt *dmlTranspiler) buildWhereClause(expr ast.Expression, argNum *int) (string, []string) {
 	// Legacy wrapper - create a tracker and use the new implementation
-	pt := &paramTracker{nextNum: *argNum, varToNum: make(map[string]int), args: nil}
+	pt := dt.paramTracker(*argNum)
 	sql := dt.buildWhereClauseTracked(expr, pt)
 	*argNum = pt.nextNum
 	return sql, pt.args
@@ -2670,6 +3674,7 @@ type paramTracker struct {
 	nextNum      int            // Next placeholder number to assign
 	varToNum     map[string]int // Variable name (lowercase) -> placeholder number
 	args         []string       // Ordered list of Go variable names for arguments
+	positional   bool           // ? placeholders: each use of a variable takes an argument
 }
 
 // newParamTracker creates a new parameter tracker starting at placeholder 1
@@ -2685,7 +3690,7 @@ func newParamTracker() *paramTracker {
 // Returns the placeholder number and whether this is a new variable (requiring an arg).
 func (pt *paramTracker) getOrAssign(varName string) (int, bool) {
 	key := strings.ToLower(varName)
-	if num, exists := pt.varToNum[key]; exists {
+	if num, exists := pt.varToNum[key]; exists && !pt.positional {
 		return num, false
 	}
 	num := pt.nextNum
@@ -2694,6 +3699,11 @@ func (pt *paramTracker) getOrAssign(varName string) (int, bool) {
 	return num, true
 }
 
+// paramTracker returns a tracker numbering placeholders from n.
+func (dt *dmlTranspiler) paramTracker(n int) *paramTracker {
+	return &paramTracker{nextNum: n, varToNum: make(map[string]int), positional: dt.getPlaceholder(1) == "?"}
+}
+
 // addArg adds a Go variable name to the argument list
 func (pt *paramTracker) addArg(goVarName string) {
 	pt.args = append(pt.args, goVarName)
@@ -2737,6 +3747,11 @@ func (dt *dmlTranspiler) isSingleRowSelect(s *ast.SelectStatement) bool {
 // inferGRPCMethod determines the gRPC method name for a SELECT statement.
 // Priority: explicit GRPCMappings > table-to-service + verb detection > default inference
 func (dt *dmlTranspiler) inferGRPCMethod(s *ast.SelectStatement, table string) string {
+	// A full-text predicate makes it a search
+	if fullTextSearch(s.Where) != nil {
+		return "Search" + pluralize(toPascalCase(table))
+	}
+
 	whereFields := dt.extractWhereFields(s)
 	entityName := toPascalCase(singularize(table))
 
@@ -2775,12 +3790,12 @@ func (dt *dmlTranspiler) detectVerbFromWhereFields(whereFields []whereField) str
 	for _, wf := range whereFields {
 		// Check variable name for verb hints
 		if wf.variable != "" {
-			if verb := extractActionVerb(wf.variable); verb != "" {
+			if verb := dt.actionVerb(wf.variable); verb != "" {
 				return verb
 			}
 		}
 		// Check column name for verb hints
-		if verb := extractActionVerb(wf.column); verb != "" {
+		if verb := dt.actionVerb(wf.column); verb != "" {
 			return verb
 		}
 	}
@@ -2794,13 +3809,13 @@ func (dt *dmlTranspiler) detectVerbFromSelectColumns(s *ast.SelectStatement) str
 	}
 	for _, item := range s.Columns {
 		if item.Alias != nil {
-			if verb := extractActionVerb(item.Alias.Value); verb != "" {
+			if verb := dt.actionVerb(item.Alias.Value); verb != "" {
 				return verb
 			}
 		}
 		// Check column expression for identifiers
 		if ident, ok := item.Expression.(*ast.Identifier); ok {
-			if verb := extractActionVerb(ident.Value); verb != "" {
+			if verb := dt.actionVerb(ident.Value); verb != "" {
 				return verb
 			}
 		}
@@ -2808,77 +3823,6 @@ func (dt *dmlTranspiler) detectVerbFromSelectColumns(s *ast.SelectStatement) str
 	return ""
 }
 
-// extractActionVerb detects business process verbs in identifiers.
-// Returns the verb in PascalCase if found, empty string otherwise.
-func extractActionVerb(name string) string {
-	nameLower := strings.ToLower(name)
-
-	// Verb patterns in priority order (longer/more specific patterns first)
-	// This ensures "deactivate" is matched before "activate", etc.
-	verbPatterns := []struct {
-		verb     string
-		patterns []string
-	}{
-		// Compound verbs first (to avoid substring issues)
-		{"Countersign", []string{"countersign", "countersigned", "countersigning"}},
-		{"Deactivate", []string{"deactivate", "deactivated", "deactivating", "deactivation"}},
-		{"Acknowledge", []string{"acknowledge", "acknowledged", "acknowledging", "acknowledgment", "acknowledgement"}},
-
-		// Approval workflow verbs
-		{"Approve", []string{"approve", "approved", "approving", "approval"}},
-		{"Reject", []string{"reject", "rejected", "rejecting", "rejection"}},
-		{"Certify", []string{"certify", "certified", "certifying", "certification"}},
-		{"Attest", []string{"attest", "attested", "attesting", "attestation"}},
-		{"Review", []string{"review", "reviewed", "reviewing"}},
-		{"Assess", []string{"assess", "assessed", "assessing", "assessment"}},
-		{"Audit", []string{"audit", "audited", "auditing"}},
-		{"Authorize", []string{"authorize", "authorized", "authorizing", "authorization"}},
-		{"Grant", []string{"grant", "granted", "granting"}},
-		{"Deny", []string{"deny", "denied", "denying", "denial"}},
-		{"Escalate", []string{"escalate", "escalated", "escalating", "escalation"}},
-		{"Delegate", []string{"delegate", "delegated", "delegating", "delegation"}},
-
-		// Lifecycle verbs
-		{"Suspend", []string{"suspend", "suspended", "suspending", "suspension"}},
-		{"Resume", []string{"resume", "resumed", "resuming"}},
-		{"Cancel", []string{"cancel", "cancelled", "canceled", "cancelling", "canceling", "cancellation"}},
-		{"Terminate", []string{"terminate", "terminated", "terminating", "termination"}},
-		{"Complete", []string{"complete", "completed", "completing", "completion"}},
-		{"Finalize", []string{"finalize", "finalized", "finalizing", "finalization"}},
-		{"Activate", []string{"activate", "activated", "activating", "activation"}},
-
-		// Communication verbs
-		{"Notify", []string{"notify", "notified", "notifying", "notification"}},
-		{"Alert", []string{"alert", "alerted", "alerting"}},
-
-		// Signing verbs
-		{"Sign", []string{"sign", "signed", "signing", "signature"}},
-
-		// Calculation verbs
-		{"Calculate", []string{"calculate", "calculated", "calculating", "calculation"}},
-		{"Compute", []string{"compute", "computed", "computing", "computation"}},
-		{"Estimate", []string{"estimate", "estimated", "estimating", "estimation"}},
-
-		// Validation verbs
-		{"Validate", []string{"validate", "validated", "validating", "validation"}},
-		{"Verify", []string{"verify", "verified", "verifying", "verification"}},
-
-		// Transfer verbs
-		{"Transfer", []string{"transfer", "transferred", "transferring"}},
-		{"Submit", []string{"submit", "submitted", "submitting", "submission"}},
-	}
-
-	for _, vp := range verbPatterns {
-		for _, pattern := range vp.patterns {
-			if strings.Contains(nameLower, pattern) {
-				return vp.verb
-			}
-		}
-	}
-
-	return ""
-}
-
 // getGRPCClientForTable returns the gRPC client variable for a table based on configuration.
 func (dt *dmlTranspiler) getGRPCClientForTable(table string) string {
 	tableLower := strings.ToLower(table)
@@ -2908,6 +3852,12 @@ func (dt *dmlTranspiler) getGRPCClientForTable(table string) string {
 		return dt.config.GRPCClientVar
 	}
 
+	dt.suggestTableService(table)
+	return dt.defaultGRPCClient()
+}
+
+// defaultGRPCClient returns the client variable for tables with no mapping.
+func (dt *dmlTranspiler) defaultGRPCClient() string {
 	// Fall back to StoreVar for backwards compatibility
 	if dt.config.StoreVar != "" {
 		return dt.config.StoreVar
@@ -3021,10 +3971,16 @@ func (dt *dmlTranspiler) exprToGoValue(expr ast.Expression) string {
 		dt.symbols.markUsed(goVar)
 		return goVar
 	case *ast.IntegerLiteral:
+		if ref, ok := dt.constantFor(e); ok {
+			return ref
+		}
 		return fmt.Sprintf("%d", e.Value)
 	case *ast.FloatLiteral:
 		return fmt.Sprintf("%v", e.Value)
 	case *ast.StringLiteral:
+		if ref, ok := dt.constantFor(e); ok {
+			return ref
+		}
 		return fmt.Sprintf("%q", e.Value)
 	case *ast.NullLiteral:
 		return "nil"
@@ -3042,6 +3998,9 @@ func (dt *dmlTranspiler) exprToGoValue(expr ast.Expression) string {
 
 // getDBVar returns the appropriate database variable: "tx" if in transaction, StoreVar otherwise
 func (dt *dmlTranspiler) getDBVar() string {
+	if dt.nolockTx != "" {
+		return dt.nolockTx
+	}
 	if dt.inTransaction {
 		return "tx"
 	}
@@ -3053,8 +4012,9 @@ func (dt *dmlTranspiler) getDBVar() string {
 //   DECLARE cursor CURSOR FOR SELECT ... -> (stored, emitted on OPEN)
 //   OPEN cursor                           -> rows, err := db.QueryContext(...)
 //   FETCH NEXT INTO @var1, @var2          -> (first one absorbed, rest ignored)
-//   WHILE @@FETCH_STATUS = 0              -> for rows.Next()
+//   WHILE @@FETCH_STATUS = 0              -> for rows.Next() over the cursor of the nearest FETCH
 //   CLOSE/DEALLOCATE                      -> (handled by defer rows.Close())
+// Cursors fetched other than NEXT are buffered instead (see scrollcursor.go).
 
 func (t *transpiler) transpileDeclareCursor(s *ast.DeclareCursorStatement) (string, error) {
 	cursorName := s.Name.Value
@@ -3065,6 +4025,14 @@ func (t *transpiler) transpileDeclareCursor(s *ast.DeclareCursorStatement) (stri
 		query:   s.ForSelect,
 		rowsVar: goIdentifier(cursorName) + "Rows",
 	}
+	if t.isScrollCursor(cursorName) {
+		t.cursors[cursorName].rowsVar = goIdentifier(cursorName) + "Cursor"
+	}
+	if t.currentOfCursors[strings.ToLower(cursorName)] {
+		if err := t.addCursorKeys(t.cursors[cursorName]); err != nil {
+			return "", err
+		}
+	}
 	
 	// Don't emit anything - query executed on OPEN
 	return fmt.Sprintf("// DECLARE CURSOR %s (query stored for OPEN)", cursorName), nil
@@ -3079,15 +4047,18 @@ func (t *transpiler) transpileOpenCursor(s *ast.OpenCursorStatement) (string, er
 	}
 	
 	cursor.isOpen = true
+	cursor.inLoop = t.loopDepth > 0
 	t.activeCursor = cursorName
+	if t.isScrollCursor(cursorName) {
+		return t.transpileOpenScrollCursor(cursor)
+	}
 	
 	// Build the query
 	dt := &dmlTranspiler{transpiler: t, config: t.dmlConfig}
 	query, args := dt.buildSelectQuery(cursor.query)
 	
 	// Post-process to catch any remaining @variable references
-	query, extraArgs := dt.substituteVariablesInQuery(query)
-	args = append(args, extraArgs...)
+	query, args = dt.bindQueryVariables(query, args)
 	
 	dbVar := dt.getDBVar()
 	
@@ -3107,6 +4078,7 @@ func (t *transpiler) transpileOpenCursor(s *ast.OpenCursorStatement) (string, er
 	out.WriteString("}\n")
 	out.WriteString(t.indentStr())
 	out.WriteString(fmt.Sprintf("defer %s.Close()", cursor.rowsVar))
+	out.WriteString(t.declareCursorKeys(cursor))
 	
 	return out.String(), nil
 }
@@ -3122,6 +4094,12 @@ func (t *transpiler) transpileFetch(s *ast.FetchStatement) (string, error) {
 		return "", fmt.Errorf("cursor %s not declared", cursorName)
 	}
 	
+	// @@FETCH_STATUS reports on the last FETCH, whichever cursor it was on
+	t.activeCursor = cursorName
+	if t.isScrollCursor(cursorName) {
+		return t.transpileScrollFetch(s, cursor)
+	}
+
 	// Store fetch variables for use in WHILE loop detection
 	cursor.fetchVars = s.IntoVars
 	
@@ -3136,6 +4114,13 @@ func (t *transpiler) transpileCloseCursor(s *ast.CloseCursorStatement) (string,
 	
 	if cursor, exists := t.cursors[cursorName]; exists {
 		cursor.isOpen = false
+		if t.isScrollCursor(cursorName) {
+			return fmt.Sprintf("// CLOSE %s (%s is released when unreferenced)", cursorName, cursor.rowsVar), nil
+		}
+		if cursor.inLoop {
+			// Each iteration opens it again; the defers only run on return
+			return fmt.Sprintf("// CLOSE %s\n%s%s.Close()", cursorName, t.indentStr(), cursor.rowsVar), nil
+		}
 	}
 	
 	// Cleanup handled by defer rows.Close()
@@ -3320,6 +4305,9 @@ func (t *transpiler) transpileCursorWhile(whileStmt *ast.WhileStatement) (string
 		varName := goIdentifier(strings.TrimPrefix(v.Name, "@"))
 		scanTargets = append(scanTargets, "&"+varName)
 	}
+	for _, v := range cursor.keyVars {
+		scanTargets = append(scanTargets, "&"+v)
+	}
 	scanList := strings.Join(scanTargets, ", ")
 	if scanList == "" {
 		scanList = "/* TODO: add scan targets */"
@@ -3327,6 +4315,17 @@ func (t *transpiler) transpileCursorWhile(whileStmt *ast.WhileStatement) (string
 	
 	out.WriteString(fmt.Sprintf("for %s.Next() {\n", cursor.rowsVar))
 	t.indent++
+	savedSymbols := t.symbols
+	t.symbols = t.symbols.pushScope()
+	t.loopDepth++
+	defer func() {
+		t.symbols = savedSymbols
+		t.loopDepth--
+		// A cursor opened and looped over in the body leaves the FETCH
+		// status to this one's again
+		t.activeCursor = cursor.name
+	}()
+	out.WriteString(t.cancelCheck())
 	out.WriteString(t.indentStr())
 	out.WriteString(fmt.Sprintf("if err := %s.Scan(%s); err != nil {\n", cursor.rowsVar, scanList))
 	out.WriteString(t.indentStr())
@@ -3353,7 +4352,7 @@ func (t *transpiler) transpileCursorWhile(whileStmt *ast.WhileStatement) (string
 	
 	// Process body, filtering out FETCH statements
 	if whileStmt.Body != nil {
-		bodyCode, err := t.transpileCursorLoopBody(whileStmt.Body)
+		bodyCode, err := t.transpileCursorLoopBody(whileStmt.Body, cursor.name)
 		if err != nil {
 			return "", err
 		}
@@ -3361,6 +4360,12 @@ func (t *transpiler) transpileCursorWhile(whileStmt *ast.WhileStatement) (string
 			out.WriteString(bodyCode)
 		}
 	}
+	if unusedVars := t.symbols.getUnusedVars(); len(unusedVars) > 0 {
+		out.WriteString(t.indentStr() + "// Unused variables in this scope\n")
+		for _, v := range unusedVars {
+			out.WriteString(t.indentStr() + "_ = " + v + "\n")
+		}
+	}
 	
 	t.indent--
 	out.WriteString(t.indentStr())
@@ -3369,14 +4374,15 @@ func (t *transpiler) transpileCursorWhile(whileStmt *ast.WhileStatement) (string
 	return out.String(), nil
 }
 
-// transpileCursorLoopBody processes a WHILE body, filtering out FETCH statements
-func (t *transpiler) transpileCursorLoopBody(stmt ast.Statement) (string, error) {
+// transpileCursorLoopBody processes a WHILE body, filtering out the FETCH
+// statements on cursorName, which the loop's rows.Next() does
+func (t *transpiler) transpileCursorLoopBody(stmt ast.Statement, cursorName string) (string, error) {
 	switch s := stmt.(type) {
 	case *ast.BeginEndBlock:
 		var parts []string
 		for _, innerStmt := range s.Statements {
 			// Skip FETCH statements inside the loop
-			if _, isFetch := innerStmt.(*ast.FetchStatement); isFetch {
+			if fetch, isFetch := innerStmt.(*ast.FetchStatement); isFetch && fetchesCursor(fetch, cursorName) {
 				continue
 			}
 			code, err := t.transpileStatement(innerStmt)
@@ -3389,8 +4395,15 @@ func (t *transpiler) transpileCursorLoopBody(stmt ast.Statement) (string, error)
 		}
 		return strings.Join(parts, "\n") + "\n", nil
 	case *ast.FetchStatement:
-		// Skip FETCH inside loop
-		return "", nil
+		if fetchesCursor(s, cursorName) {
+			// Skip FETCH inside loop
+			return "", nil
+		}
+		code, err := t.transpileStatement(s)
+		if err != nil {
+			return "", err
+		}
+		return t.indentStr() + code + "\n", nil
 	default:
 		code, err := t.transpileStatement(s)
 		if err != nil {
@@ -3403,6 +4416,11 @@ func (t *transpiler) transpileCursorLoopBody(stmt ast.Statement) (string, error)
 	}
 }
 
+// fetchesCursor reports whether s fetches from the cursor called name.
+func fetchesCursor(s *ast.FetchStatement, name string) bool {
+	return s.CursorName != nil && strings.EqualFold(s.CursorName.Value, name)
+}
+
 // Column extraction and scan target generation
 
 // selectColumn represents a column from a SELECT clause
@@ -3472,22 +4490,25 @@ func (dt *dmlTranspiler) extractColumnName(expr ast.Expression) string {
 	return "col"
 }
 
-// generateScanTargets generates variable declarations and scan arguments
-func (dt *dmlTranspiler) generateScanTargets(columns []selectColumn) (string, string) {
+// generateScanTargets generates variable declarations, scan arguments and the
+// conversions to run after Scan when columns go through sql.Null* intermediaries
+func (dt *dmlTranspiler) generateScanTargets(columns []selectColumn) (string, string, []string) {
 	if len(columns) == 0 {
-		return "", "/* no columns */"
+		return "", "/* no columns */", nil
 	}
 	
 	// Check for SELECT *
 	for _, col := range columns {
 		if col.name == "*" {
-			return "", "/* TODO: SELECT * requires explicit columns */"
+			return "", "/* TODO: SELECT * requires explicit columns */", nil
 		}
 	}
 	
 	var decls []string
 	var targets []string
-	usedNames := make(map[string]int)
+	var assigns []string
+	var contractCols []ContractColumn
+	usedNames := make(map[string]bool)
 	
 	for _, col := range columns {
 		// Get a valid Go identifier
@@ -3496,25 +4517,25 @@ func (dt *dmlTranspiler) generateScanTargets(columns []selectColumn) (string, st
 			name = "col"
 		}
 		
-		// Handle duplicate names
-		if count, exists := usedNames[name]; exists {
-			usedNames[name] = count + 1
-			name = fmt.Sprintf("%s%d", name, count+1)
-		} else {
-			usedNames[name] = 1
+		// Handle duplicate names, and names the procedure already has, such
+		// as a parameter or an earlier result set's column
+		base := name
+		for i := 2; usedNames[name] || dt.scanNameTaken(name); i++ {
+			name = fmt.Sprintf("%s%d", base, i)
 		}
+		usedNames[name] = true
 		
 		// First, try to infer type from the actual expression
 		goType := "any"
 		if col.expression != nil {
-			if ti := dt.transpiler.inferType(col.expression); ti != nil && ti.goType != "" && ti.goType != "any" {
+			expr := col.expression
+			// A qualified column, such as OUTPUT's INSERTED.Total, takes the
+			// type of a variable of its name, as an unqualified one does
+			if qid, ok := expr.(*ast.QualifiedIdentifier); ok && len(qid.Parts) > 0 {
+				expr = qid.Parts[len(qid.Parts)-1]
+			}
+			if ti := dt.transpiler.inferType(expr); ti != nil && ti.goType != "" && ti.goType != "any" {
 				goType = ti.goType
-				// Add imports if needed
-				if ti.goType == "decimal.Decimal" {
-					dt.imports["github.com/shopspring/decimal"] = true
-				} else if ti.goType == "time.Time" {
-					dt.imports["time"] = true
-				}
 			}
 		}
 		
@@ -3526,28 +4547,177 @@ func (dt *dmlTranspiler) generateScanTargets(columns []selectColumn) (string, st
 				goType = "int64"
 			case strings.HasSuffix(lowerName, "at") || strings.HasSuffix(lowerName, "date") || strings.HasSuffix(lowerName, "time"):
 				goType = "time.Time"
-				dt.imports["time"] = true
 			case lowerName == "count" || lowerName == "sum" || lowerName == "total":
 				goType = "int64"
 			case strings.HasPrefix(lowerName, "is") || strings.HasPrefix(lowerName, "has") || strings.HasSuffix(lowerName, "active"):
 				goType = "bool"
 			case strings.Contains(lowerName, "price") || strings.Contains(lowerName, "amount") || strings.Contains(lowerName, "total"):
-				goType = "decimal.Decimal"
-				dt.imports["github.com/shopspring/decimal"] = true
+				goType = dt.decimalType()
 			case strings.Contains(lowerName, "name") || strings.Contains(lowerName, "email") || 
 				strings.Contains(lowerName, "title") || strings.Contains(lowerName, "description"):
 				goType = "string"
 			}
 		}
 		
+		// Unknown types would scan into interface{}, which gives driver-specific
+		// results ([]byte vs string). Scan as text unless explicitly allowed.
+		if goType == "any" && !dt.config.AllowAnyScan {
+			goType = "string"
+			dt.warnings = append(dt.warnings, fmt.Sprintf(
+				"%s: could not infer type of column %s; scanning as string (use --allow-any-scan to scan into any)",
+				dt.currentProcName, col.name))
+		}
+		
+		// Nullable columns scan as they are, keeping NULL
+		if dt.isDecimalType(goType) {
+			dt.importDecimal()
+		}
+		if dt.nullable(goType) {
+			nullType := dt.nullType(goType)
+			decls = append(decls, fmt.Sprintf("var %s %s", name, nullType))
+			contractCols = append(contractCols, ContractColumn{Name: col.name, GoType: nullType})
+			targets = append(targets, "&"+name)
+			dt.symbols.markDeclared(name)
+			dt.symbols.markUsed(name)
+			continue
+		}
+
+		if goType == "time.Time" {
+			dt.imports["time"] = true
+		}
 		decls = append(decls, fmt.Sprintf("var %s %s", name, goType))
-		targets = append(targets, "&"+name)
+		contractCols = append(contractCols, ContractColumn{Name: col.name, GoType: goType})
+		
+		// Scan through a sql.Null* intermediary so NULLs don't fail the Scan
+		nullType, conv := dt.scanNullType(goType)
+		if nullType == "" {
+			targets = append(targets, "&"+name)
+			dt.symbols.markDeclared(name)
+			dt.symbols.markUsed(name)
+			continue
+		}
+		nullName := name + "Null"
+		decls = append(decls, fmt.Sprintf("var %s %s", nullName, nullType))
+		targets = append(targets, "&"+nullName)
+		assigns = append(assigns, fmt.Sprintf("%s = %s", name, fmt.Sprintf(conv, nullName)))
+		// Only assigned now, not scanned by address: let the unused
+		// variable pass suppress it if nothing reads it later
+		dt.symbols.markDeclared(name)
+		dt.symbols.markDeclared(nullName)
+		dt.symbols.markUsed(nullName)
 	}
 	
+	dt.recordResultSet(contractCols)
+	
 	declStr := strings.Join(decls, "\n"+dt.indentStr())
 	targetStr := strings.Join(targets, ", ")
 	
-	return declStr, targetStr
+	return declStr, targetStr, assigns
+}
+
+// scanNameTaken reports whether a result set's scan variable, or its
+// sql.Null* intermediary, would redeclare a name the procedure already has.
+func (dt *dmlTranspiler) scanNameTaken(name string) bool {
+	for _, n := range []string{name, name + "Null"} {
+		if dt.symbols.isDeclared(n) || dt.symbols.lookup(n) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// varScanTargets returns the Scan targets of SELECT @var = col
+// assignments. Variables of a nullable type scan as they are; the others
+// scan through a sql.Null* intermediary, declared in decls, so a NULL
+// column doesn't fail the Scan, and take its value in assigns once the Scan
+// succeeds.
+func (dt *dmlTranspiler) varScanTargets(assignments []varAssignment) (decls, targets, assigns []string) {
+	for _, a := range assignments {
+		ti := dt.symbols.lookup(a.varName)
+		if ti == nil || ti.nullable {
+			targets = append(targets, "&"+a.varName)
+			continue
+		}
+		nullType, conv := dt.scanNullType(ti.goType)
+		if nullType == "" {
+			targets = append(targets, "&"+a.varName)
+			continue
+		}
+		nullName := a.varName + "Null"
+		for i := 2; dt.symbols.isDeclared(nullName); i++ {
+			nullName = fmt.Sprintf("%sNull%d", a.varName, i)
+		}
+		dt.symbols.markDeclared(nullName)
+		dt.symbols.markUsed(nullName)
+		decls = append(decls, fmt.Sprintf("var %s %s", nullName, nullType))
+		targets = append(targets, "&"+nullName)
+		assigns = append(assigns, fmt.Sprintf("%s = %s", a.varName, fmt.Sprintf(conv, nullName)))
+	}
+	return decls, targets, assigns
+}
+
+// scanNullType returns the sql.Null* intermediary goType scans through, and
+// the format string converting it back, as nullScanType does; on Go 1.22
+// or later it is sql.Null[T].
+func (dt *dmlTranspiler) scanNullType(goType string) (string, string) {
+	nullType, conv := nullScanType(goType)
+	if nullType == "" {
+		return "", ""
+	}
+	if dt.goAtLeast(22) {
+		// sql.Null[T] scans any type directly, no conversion needed
+		nullType, conv = fmt.Sprintf("sql.Null[%s]", goType), "%s.V"
+	}
+	if strings.HasPrefix(nullType, "sql.") {
+		dt.imports["database/sql"] = true
+	}
+	return nullType, conv
+}
+
+// nullScanType returns the nullable scan type for a Go type and a format
+// string converting it back (applied to the intermediary's name). An empty
+// type means the value can be scanned directly.
+func nullScanType(goType string) (string, string) {
+	switch goType {
+	case "string":
+		return "sql.NullString", "%s.String"
+	case "int64":
+		return "sql.NullInt64", "%s.Int64"
+	case "int32":
+		return "sql.NullInt32", "%s.Int32"
+	case "int16":
+		return "sql.NullInt16", "%s.Int16"
+	case "int":
+		return "sql.NullInt64", "int(%s.Int64)"
+	case "uint8":
+		return "sql.NullByte", "%s.Byte"
+	case "float64":
+		return "sql.NullFloat64", "%s.Float64"
+	case "float32":
+		return "sql.NullFloat64", "float32(%s.Float64)"
+	case "bool":
+		return "sql.NullBool", "%s.Bool"
+	case "time.Time":
+		return "sql.NullTime", "%s.Time"
+	case "decimal.Decimal":
+		return "decimal.NullDecimal", "%s.Decimal"
+	case "apd.Decimal":
+		return "apd.NullDecimal", "%s.Decimal"
+	default:
+		// any, []byte and anything custom scan directly
+		return "", ""
+	}
+}
+
+// writeScanAssigns emits the conversions from sql.Null* intermediaries
+// back to the declared scan variables after a successful Scan.
+func (dt *dmlTranspiler) writeScanAssigns(out *strings.Builder, assigns []string, extraIndent string) {
+	for _, a := range assigns {
+		out.WriteString("\n")
+		out.WriteString(dt.indentStr())
+		out.WriteString(extraIndent)
+		out.WriteString(a)
+	}
 }
 
 // String helpers
@@ -3564,7 +4734,10 @@ func cleanProcedureName(name string) string {
 	return name
 }
 
-func toPascalCase(s string) string {
+// pascalCase converts a table or other name to PascalCase, splitting
+// ALL-CAPS names with knownWords. It's the default Namer's; call sites use
+// toPascalCase (see naming.go).
+func pascalCase(s string) string {
 	// Strip T-SQL-specific prefixes
 	s = strings.TrimPrefix(s, "#")  // temp table prefix
 	s = strings.TrimPrefix(s, "##") // global temp table prefix
@@ -3587,23 +4760,23 @@ func toPascalCase(s string) string {
 		}
 	}
 	
-	result := make([]byte, 0, len(s))
+	var result strings.Builder
 	capitalizeNext := true
 
-	for i := 0; i < len(s); i++ {
-		c := s[i]
+	// Work on runes so accented names (dirección_envío) stay intact
+	for _, c := range s {
 		if c == '_' || c == '-' || c == ' ' || c == '#' || c == '@' {
 			capitalizeNext = true
 			continue
 		}
-		if capitalizeNext && c >= 'a' && c <= 'z' {
-			c -= 'a' - 'A'
+		if capitalizeNext {
+			c = unicode.ToUpper(c)
 		}
 		capitalizeNext = false
-		result = append(result, c)
+		result.WriteRune(c)
 	}
 
-	return string(result)
+	return result.String()
 }
 
 // knownWords contains words used for splitting ALL_CAPS identifiers.
@@ -3690,9 +4863,10 @@ func splitAllCapsIdentifier(s string) string {
 		
 		if !matched {
 			// No known word matched - check if remaining is very short
-			if len(lower) <= 2 {
+			if utf8.RuneCountInString(lower) <= 2 {
 				// Just capitalize what's left (likely an abbreviation like "Id")
-				result.WriteString(strings.ToUpper(lower[:1]) + lower[1:])
+				first, size := utf8.DecodeRuneInString(lower)
+				result.WriteString(string(unicode.ToUpper(first)) + lower[size:])
 				lower = ""
 			} else {
 				// Can't split this identifier reliably
@@ -3713,10 +4887,10 @@ func isAllCapsOrUnderscored(s string) bool {
 	}
 	hasLetter := false
 	for _, c := range s {
-		if c >= 'a' && c <= 'z' {
+		if unicode.IsLower(c) {
 			return false // Has lowercase, not ALL_CAPS
 		}
-		if c >= 'A' && c <= 'Z' {
+		if unicode.IsUpper(c) {
 			hasLetter = true
 		}
 	}
@@ -3810,18 +4984,33 @@ func (dt *dmlTranspiler) transpileCreateTempTable(s *ast.CreateTableStatement) (
 		out.WriteString(dt.indentStr())
 	}
 	
-	// Generate column definitions
 	out.WriteString("// CREATE TABLE " + tableName + "\n")
 	out.WriteString("{\n")
+	out.WriteString(dt.tempTableColumns(s.Columns))
+	out.WriteString(fmt.Sprintf("\tif _, err := tempTables.CreateTempTable(%q, columns); err != nil {\n", tableName))
+	out.WriteString("\t\t")
+	out.WriteString(dt.buildErrorReturn())
+	out.WriteString("\n")
+	out.WriteString("\t}\n")
+	out.WriteString("}")
+	
+	return out.String(), nil
+}
+
+// tempTableColumns returns the declaration of the columns of a temp table
+// or table variable, as a columns variable.
+func (dt *dmlTranspiler) tempTableColumns(cols []*ast.ColumnDefinition) string {
+	var out strings.Builder
 	out.WriteString("\tcolumns := []tsqlruntime.TempTableColumn{\n")
 	
-	for _, col := range s.Columns {
+	for _, col := range cols {
 		out.WriteString("\t\t{\n")
 		out.WriteString(fmt.Sprintf("\t\t\tName: %q,\n", col.Name.Value))
 		
 		// Parse data type
+		goType := "tsqlruntime.TypeUnknown"
 		if col.DataType != nil {
-			goType := dt.dataTypeToRuntimeType(col.DataType)
+			goType = dt.dataTypeToRuntimeType(col.DataType)
 			out.WriteString(fmt.Sprintf("\t\t\tType: %s,\n", goType))
 			
 			if col.DataType.Precision != nil {
@@ -3837,11 +5026,12 @@ func (dt *dmlTranspiler) transpileCreateTempTable(s *ast.CreateTableStatement) (
 			}
 		}
 		
-		// Nullable
-		if col.Nullable != nil {
-			out.WriteString(fmt.Sprintf("\t\t\tNullable: %v,\n", *col.Nullable))
+		// Nullable, and NULL when an INSERT leaves it out
+		if col.Nullable != nil && !*col.Nullable {
+			out.WriteString("\t\t\tNullable: false,\n")
 		} else {
 			out.WriteString("\t\t\tNullable: true,\n")
+			out.WriteString(fmt.Sprintf("\t\t\tDefaultValue: tsqlruntime.Null(%s),\n", goType))
 		}
 		
 		// Identity
@@ -3855,14 +5045,21 @@ func (dt *dmlTranspiler) transpileCreateTempTable(s *ast.CreateTableStatement) (
 	}
 	
 	out.WriteString("\t}\n")
-	out.WriteString(fmt.Sprintf("\tif _, err := tempTables.CreateTempTable(%q, columns); err != nil {\n", tableName))
-	out.WriteString("\t\t")
-	out.WriteString(dt.buildErrorReturn())
-	out.WriteString("\n")
+	return out.String()
+}
+
+// transpileDeclareTableVariable declares a table variable in tempTables.
+func (dt *dmlTranspiler) transpileDeclareTableVariable(v *ast.VariableDef) string {
+	dt.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+	var out strings.Builder
+	out.WriteString("// DECLARE " + v.Name + " TABLE\n")
+	out.WriteString("{\n")
+	out.WriteString(dt.tempTableColumns(v.TableType.Columns))
+	out.WriteString(fmt.Sprintf("\tif _, err := tempTables.CreateTableVariable(%q, columns); err != nil {\n", v.Name))
+	out.WriteString("\t\t" + dt.buildErrorReturn() + "\n")
 	out.WriteString("\t}\n")
 	out.WriteString("}")
-	
-	return out.String(), nil
+	return out.String()
 }
 
 // transpileCreateTableSQL generates SQL DDL for CREATE TABLE
@@ -3889,6 +5086,12 @@ func (dt *dmlTranspiler) transpileCreateTableSQL(s *ast.CreateTableStatement) (s
 		if col.Nullable != nil && !*col.Nullable {
 			sqlBuilder.WriteString(" NOT NULL")
 		}
+		if seq := columnSequence(col); seq != "" {
+			// MySQL and SQLite INSERTs fill the column in instead
+			if next, ok := dt.nextValueSQL(seq); ok {
+				sqlBuilder.WriteString(" DEFAULT " + next)
+			}
+		}
 		if col.Identity != nil {
 			// Convert IDENTITY to dialect-specific syntax
 			switch dt.config.SQLDialect {
@@ -3,6 +3,7 @@ package transpiler
 import (
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestTranspileWithDML_Select(t *testing.T) {
@@ -103,6 +104,209 @@ END
 	t.Logf("Generated code:\n%s", result)
 }
 
+func TestTranspileWithDML_UpdateCase(t *testing.T) {
+	sql := `
+CREATE PROCEDURE dbo.Reprice
+    @Pct DECIMAL(5,2),
+    @Category INT,
+    @Label NVARCHAR(20)
+AS
+BEGIN
+    UPDATE Products
+    SET Price = CASE WHEN Category = @Category THEN Price * (1 + @Pct / 100) ELSE Price END,
+        Label = CASE WHEN @Pct > 10 THEN @Label ELSE 'Standard' END
+    WHERE Discontinued = 0
+END
+`
+	result, err := TranspileWithDML(sql, "main", DefaultDMLConfig())
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+	want := `"UPDATE Products SET Price = CASE WHEN Category = $1 THEN Price * (1 + $2 / 100) ELSE Price END, ` +
+		`Label = CASE WHEN $2 > 10 THEN $3 ELSE 'Standard' END WHERE Discontinued = 0", category, pct, label)`
+	if !strings.Contains(result, want) {
+		t.Errorf("Expected the CASE kept in SQL:\n%s\ngot:\n%s", want, result)
+	}
+}
+
+func TestTranspileWithDML_CaseWithVariables(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect string
+		body    string
+		want    []string
+	}{
+		{
+			name: "searched CASE conditions",
+			body: `UPDATE T SET A = CASE WHEN @X IS NULL THEN A ELSE @X END,
+        B = CASE WHEN Col BETWEEN @Lo AND @Hi THEN 1 WHEN Col NOT IN (@Lo, 7) THEN 2 ELSE NULL END,
+        C = CASE WHEN NOT (Col > @X) THEN CAST(@X AS VARCHAR(10)) ELSE Name END
+    WHERE Id = @Id`,
+			want: []string{
+				`"UPDATE T SET A = CASE WHEN $1 IS NULL THEN A ELSE $1 END, ` +
+					`B = CASE WHEN Col BETWEEN $2 AND $3 THEN 1 WHEN Col NOT IN ($2, 7) THEN 2 ELSE NULL END, ` +
+					`C = CASE WHEN NOT (Col > $1) THEN CAST($1 AS VARCHAR(10)) ELSE Name END WHERE Id = $4", x, lo, hi, id)`,
+			},
+		},
+		{
+			name: "simple CASE",
+			body: `UPDATE T SET Tier = CASE Tier WHEN @Lo THEN @Name ELSE Tier END WHERE Id = @Id`,
+			want: []string{`"UPDATE T SET Tier = CASE Tier WHEN $1 THEN $2 ELSE Tier END WHERE Id = $3", lo, name, id)`},
+		},
+		{
+			name:    "? binds each use",
+			dialect: "mysql",
+			body: `UPDATE T SET A = CASE WHEN Col > @X THEN @X ELSE 0 END WHERE Id = @Id
+    SELECT Id, CASE WHEN Col > @X THEN @Name END AS Label FROM T WHERE Id = @Id`,
+			want: []string{
+				`"UPDATE T SET A = CASE WHEN Col > ? THEN ? ELSE 0 END WHERE Id = ?", x, x, id)`,
+				// The column takes its type from the variable
+				"var label string",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultDMLConfig()
+			if tt.dialect != "" {
+				config.SQLDialect = tt.dialect
+			}
+			sql := "CREATE PROCEDURE dbo.P @X INT, @Lo INT, @Hi INT, @Name NVARCHAR(20), @Id INT\nAS\nBEGIN\n    " + tt.body + "\nEND\n"
+			result, err := TranspileWithDMLEx(sql, "main", config)
+			if err != nil {
+				t.Fatalf("TranspileWithDMLEx failed: %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(result.Code, want) {
+					t.Errorf("Expected %s, got:\n%s", want, result.Code)
+				}
+			}
+			if len(result.Warnings) > 0 {
+				t.Errorf("Unexpected warnings: %v", result.Warnings)
+			}
+		})
+	}
+}
+
+func TestTranspileWithDML_SelectClauses(t *testing.T) {
+	grouped := `SELECT DISTINCT TOP 10 CustomerID, SUM(Total) AS Total FROM Orders
+    WHERE Total > @Min GROUP BY CustomerID HAVING SUM(Total) > @Min ORDER BY Total DESC`
+	paged := `SELECT Id FROM Orders ORDER BY Id OFFSET @Skip ROWS FETCH NEXT 5 ROWS ONLY`
+	tests := []struct {
+		name    string
+		dialect string
+		body    string
+		want    string
+		warning string
+	}{
+		{
+			name: "postgres",
+			body: grouped,
+			want: `"SELECT DISTINCT CustomerID, SUM(Total) AS Total FROM Orders WHERE (Total > $1) GROUP BY CustomerID HAVING (SUM(Total) > $1) ORDER BY Total DESC LIMIT 10", min)`,
+		},
+		{
+			name:    "sqlserver",
+			dialect: "sqlserver",
+			body:    grouped,
+			want:    `"SELECT DISTINCT TOP 10 CustomerID, SUM(Total) AS Total FROM Orders WHERE (Total > @p1) GROUP BY CustomerID HAVING (SUM(Total) > @p1) ORDER BY Total DESC", min)`,
+		},
+		{
+			name:    "oracle",
+			dialect: "oracle",
+			body:    grouped,
+			want:    `ORDER BY Total DESC FETCH FIRST 10 ROWS ONLY", min)`,
+		},
+		{
+			name: "OFFSET/FETCH",
+			body: paged,
+			want: `"SELECT Id FROM Orders ORDER BY Id ASC LIMIT 5 OFFSET $1", skip)`,
+		},
+		{
+			name:    "OFFSET/FETCH on SQL Server",
+			dialect: "sqlserver",
+			body:    paged,
+			want:    `"SELECT Id FROM Orders ORDER BY Id ASC OFFSET @p1 ROWS FETCH NEXT 5 ROWS ONLY", skip)`,
+		},
+		{
+			name:    "OFFSET alone on MySQL",
+			dialect: "mysql",
+			body:    `SELECT Id FROM Orders ORDER BY Id OFFSET @Skip ROWS`,
+			want:    `"SELECT Id FROM Orders ORDER BY Id ASC LIMIT 18446744073709551615 OFFSET ?", skip)`,
+		},
+		{
+			name: "TOP WITH TIES",
+			body: `SELECT TOP 3 WITH TIES Id FROM Orders ORDER BY Total DESC`,
+			want: `"SELECT Id FROM Orders ORDER BY Total DESC FETCH FIRST 3 ROWS WITH TIES")`,
+		},
+		{
+			name:    "TOP PERCENT",
+			dialect: "mysql",
+			body:    `SELECT TOP 10 PERCENT Id FROM Orders ORDER BY Total DESC`,
+			want:    `"SELECT Id FROM Orders ORDER BY Total DESC")`,
+			warning: "TOP 10 PERCENT has no mysql equivalent",
+		},
+		{
+			name: "JOINs",
+			body: `SELECT o.Id, c.Name FROM Orders o
+    INNER JOIN Customers c ON c.Id = o.CustomerID AND c.Region = @Min
+    LEFT JOIN Shipments s ON s.OrderId = o.Id
+    RIGHT JOIN Regions r ON r.Id = c.RegionId
+    FULL OUTER JOIN Notes n ON n.OrderId = o.Id AND n.Kind > @Skip
+    WHERE o.Total > @Min`,
+			want: `"SELECT o.Id, c.Name FROM Orders AS o INNER JOIN Customers AS c ON ((c.Id = o.CustomerID) AND (c.Region = $1)) ` +
+				`LEFT JOIN Shipments AS s ON (s.OrderId = o.Id) RIGHT JOIN Regions AS r ON (r.Id = c.RegionId) ` +
+				`FULL JOIN Notes AS n ON ((n.OrderId = o.Id) AND (n.Kind > $2)) WHERE (o.Total > $1)", min, skip)`,
+		},
+		{
+			name:    "JOIN of a derived table on SQL Server",
+			dialect: "sqlserver",
+			body:    `SELECT o.Id FROM Orders o JOIN (SELECT Id FROM Customers WHERE Region = @Min) c ON c.Id = o.CustomerID`,
+			want:    `"SELECT o.Id FROM Orders AS o INNER JOIN (SELECT Id FROM Customers WHERE (Region = @p1)) AS c ON (c.Id = o.CustomerID)", min)`,
+		},
+		{
+			name: "UNION and EXCEPT",
+			body: `SELECT Id, Name FROM Customers WHERE Region = @Min
+    UNION ALL
+    SELECT Id, Name FROM Suppliers WHERE Region = @Skip
+    EXCEPT
+    SELECT Id, Name FROM Blocked WHERE Region = @Min
+    ORDER BY Name`,
+			want: `"SELECT Id, Name FROM Customers WHERE (Region = $1) UNION ALL SELECT Id, Name FROM Suppliers WHERE (Region = $2) ` +
+				`EXCEPT SELECT Id, Name FROM Blocked WHERE (Region = $1) ORDER BY Name ASC", min, skip)`,
+		},
+		{
+			name:    "EXCEPT on Oracle",
+			dialect: "oracle",
+			body:    `SELECT Id FROM Customers EXCEPT SELECT Id FROM Blocked WHERE Region = @Min`,
+			want:    `"SELECT Id FROM Customers MINUS SELECT Id FROM Blocked WHERE (Region = :p1)", min)`,
+		},
+		{
+			name: "TOP in a UNION branch",
+			body: `SELECT TOP 3 Id FROM Customers ORDER BY Id INTERSECT SELECT Id FROM Suppliers WHERE Region = @Min`,
+			want: `"(SELECT Id FROM Customers ORDER BY Id ASC LIMIT 3) INTERSECT SELECT Id FROM Suppliers WHERE (Region = $1)", min)`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultDMLConfig()
+			if tt.dialect != "" {
+				config.SQLDialect = tt.dialect
+			}
+			sql := "CREATE PROCEDURE dbo.P @Min INT, @Skip INT\nAS\nBEGIN\n    " + tt.body + "\nEND\n"
+			result, err := TranspileWithDMLEx(sql, "main", config)
+			if err != nil {
+				t.Fatalf("TranspileWithDMLEx failed: %v", err)
+			}
+			if !strings.Contains(result.Code, tt.want) {
+				t.Errorf("Expected %s, got:\n%s", tt.want, result.Code)
+			}
+			if got := strings.Join(result.Warnings, "\n"); tt.warning == "" && got != "" || !strings.Contains(got, tt.warning) {
+				t.Errorf("Warnings = %q, want %q", got, tt.warning)
+			}
+		})
+	}
+}
+
 func TestTranspileWithDML_Delete(t *testing.T) {
 	sql := `
 CREATE PROCEDURE dbo.DeleteUser
@@ -429,491 +633,4248 @@ END
 	}
 }
 
-func TestTranspileWithDML_MultiRowSelect(t *testing.T) {
+func TestTranspileWithDML_WindowFunctions(t *testing.T) {
 	sql := `
-CREATE PROCEDURE ListUsersByStatus
-    @IsActive BIT
+CREATE PROCEDURE RankOrders @Region INT, @Rate FLOAT
 AS
 BEGIN
-    SELECT ID, Username, Email
-    FROM Users
-    WHERE IsActive = @IsActive;
+    SELECT ID,
+        ROW_NUMBER() OVER (PARTITION BY CASE WHEN Region = @Region THEN 1 ELSE 0 END ORDER BY Total DESC) AS RowNum,
+        PERCENT_RANK() OVER (ORDER BY Total) AS Pct,
+        SUM(@Region) OVER (PARTITION BY CustomerID) AS Weighted,
+        AVG(@Rate) OVER () AS AvgRate,
+        COUNT_BIG(*) OVER () AS Cnt
+    FROM Orders WHERE Region = @Region
 END
 `
-
-	config := DefaultDMLConfig()
-	config.SQLDialect = "postgres"
-
-	result, err := TranspileWithDML(sql, "users", config)
+	result, err := TranspileWithDML(sql, "main", DefaultDMLConfig())
 	if err != nil {
 		t.Fatalf("TranspileWithDML failed: %v", err)
 	}
-
-	t.Logf("Generated code:\n%s", result)
-
-	// Multi-row SELECT should use QueryContext and rows iteration
-	if !strings.Contains(result, "QueryContext") {
-		t.Error("Expected QueryContext for multi-row SELECT")
-	}
-	if !strings.Contains(result, "rows.Next()") {
-		t.Error("Expected rows.Next() for multi-row iteration")
-	}
-	if !strings.Contains(result, "rows.Close()") {
-		t.Error("Expected rows.Close() for cleanup")
+	for _, want := range []string{
+		`"SELECT ID, ROW_NUMBER() OVER (PARTITION BY CASE WHEN (Region = $1) THEN 1 ELSE 0 END ORDER BY Total DESC) AS RowNum, ` +
+			`PERCENT_RANK() OVER (ORDER BY Total ASC) AS Pct, SUM($1) OVER (PARTITION BY CustomerID) AS Weighted, ` +
+			`AVG($2) OVER () AS AvgRate, COUNT_BIG(*) OVER () AS Cnt FROM Orders WHERE (Region = $1)", region, rate)`,
+		"var rowNum int64",
+		"var pct float64",
+		"var weighted int64",
+		"var avgRate float64",
+		"var cnt int64",
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("Expected %s, got:\n%s", want, result)
+		}
 	}
 }
 
-func TestTranspileWithDML_Cursor(t *testing.T) {
+func TestTranspileWithDML_NullScanIntermediaries(t *testing.T) {
 	sql := `
-CREATE PROCEDURE ProcessAllUsers
+CREATE PROCEDURE GetItem
+    @ItemID INT
 AS
 BEGIN
-    DECLARE @UserID INT
-    DECLARE @Email VARCHAR(255)
-    
-    DECLARE user_cursor CURSOR FOR
-        SELECT ID, Email FROM Users WHERE IsActive = 1
-    
-    OPEN user_cursor
-    FETCH NEXT FROM user_cursor INTO @UserID, @Email
-    
-    WHILE @@FETCH_STATUS = 0
-    BEGIN
-        PRINT @Email
-        FETCH NEXT FROM user_cursor INTO @UserID, @Email
-    END
-    
-    CLOSE user_cursor
-    DEALLOCATE user_cursor
+    SELECT Name, CreatedAt, Foo + Bar AS Combined
+    FROM Items
+    WHERE ItemID = @ItemID;
 END
 `
 
 	config := DefaultDMLConfig()
 	config.SQLDialect = "postgres"
 
-	result, err := TranspileWithDML(sql, "users", config)
+	result, err := TranspileWithDMLEx(sql, "items", config)
 	if err != nil {
-		t.Fatalf("TranspileWithDML failed: %v", err)
+		t.Fatalf("TranspileWithDMLEx failed: %v", err)
 	}
 
-	t.Logf("Generated code:\n%s", result)
-
-	// Should have QueryContext for cursor
-	if !strings.Contains(result, "QueryContext") {
-		t.Error("Expected QueryContext for cursor OPEN")
+	for _, want := range []string{
+		"var nameNull sql.NullString",
+		"var createdAtNull sql.NullTime",
+		"row.Scan(&nameNull, &createdAtNull, &combinedNull)",
+		"name = nameNull.String",
+		"createdAt = createdAtNull.Time",
+		"var combined string",
+	} {
+		if !strings.Contains(result.Code, want) {
+			t.Errorf("Expected %q, got:\n%s", want, result.Code)
+		}
 	}
-	// Should have rows.Next() loop
-	if !strings.Contains(result, "userCursorRows.Next()") {
-		t.Error("Expected userCursorRows.Next() for WHILE @@FETCH_STATUS loop")
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "column Combined") {
+		t.Errorf("Expected a warning for column Combined, got %v", result.Warnings)
 	}
-	// Should have Scan with cursor variables
-	if !strings.Contains(result, "Scan(&userId, &email)") {
-		t.Error("Expected Scan(&userId, &email) for FETCH INTO")
+
+	// interface{} targets only when explicitly allowed
+	config.AllowAnyScan = true
+	result, err = TranspileWithDMLEx(sql, "items", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDMLEx failed: %v", err)
 	}
-	// Should have defer rows.Close()
-	if !strings.Contains(result, "defer userCursorRows.Close()") {
-		t.Error("Expected defer userCursorRows.Close()")
+	if !strings.Contains(result.Code, "var combined any") || !strings.Contains(result.Code, "&combined)") {
+		t.Errorf("Expected any scan target with AllowAnyScan, got:\n%s", result.Code)
 	}
 }
 
-func TestTranspileWithDML_CursorWithProcessing(t *testing.T) {
+func TestTranspileWithDML_FunctionsStyle(t *testing.T) {
 	sql := `
-CREATE PROCEDURE UpdateAllPrices
-    @Multiplier DECIMAL(5,2)
+CREATE PROCEDURE ApproveOrder
+    @OrderID BIGINT
 AS
 BEGIN
-    DECLARE @ProductID INT
-    DECLARE @CurrentPrice DECIMAL(18,2)
-    
-    DECLARE price_cursor CURSOR FOR
-        SELECT ID, Price FROM Products
-    
-    OPEN price_cursor
-    FETCH NEXT FROM price_cursor INTO @ProductID, @CurrentPrice
-    
-    WHILE @@FETCH_STATUS = 0
-    BEGIN
-        UPDATE Products 
-        SET Price = @CurrentPrice * @Multiplier
-        WHERE ID = @ProductID
-        
-        FETCH NEXT FROM price_cursor INTO @ProductID, @CurrentPrice
-    END
-    
-    CLOSE price_cursor
-    DEALLOCATE price_cursor
+    UPDATE Orders SET Status = 'Approved' WHERE OrderID = @OrderID
+    EXEC dbo.LogApproval @OrderID
+END
+GO
+CREATE PROCEDURE Transfer
+    @From BIGINT
+AS
+BEGIN
+    DECLARE @Balance MONEY
+    BEGIN TRANSACTION
+    UPDATE Accounts SET Balance = Balance - 1 WHERE Id = @From
+    EXEC dbo.LogTransfer @From
+    EXEC dbo.GetBalance @From, @Balance OUTPUT
+    COMMIT TRANSACTION
+END
+GO
+CREATE PROCEDURE Touch
+AS
+BEGIN
+    PRINT 'touched'
 END
 `
-
 	config := DefaultDMLConfig()
-	config.SQLDialect = "postgres"
+	config.Style = StyleFunctions
 
-	result, err := TranspileWithDML(sql, "products", config)
+	result, err := TranspileWithDML(sql, "orders", config)
 	if err != nil {
 		t.Fatalf("TranspileWithDML failed: %v", err)
 	}
 
-	t.Logf("Generated code:\n%s", result)
-
-	// Should have UPDATE inside the loop
-	if !strings.Contains(result, "ExecContext") {
-		t.Error("Expected ExecContext for UPDATE inside cursor loop")
+	for _, want := range []string{
+		"func ApproveOrder(ctx context.Context, db tsqlruntime.DBTX, orderId int64)",
+		"db.ExecContext(ctx, ",
+		"if err := LogApproval(ctx, db, orderId); err != nil {\n\t\treturn err\n\t}",
+		"func Transfer(ctx context.Context, db tsqlruntime.DBTX, from int64)",
+		"tsqlruntime.BeginTx(ctx, db, nil)",
+		// Calls within the transaction take part in it
+		"if err := LogTransfer(ctx, tx, from); err != nil {\n\t\treturn err\n\t}",
+		"if balance, err = GetBalance(ctx, tx, from); err != nil {",
+		// Every procedure returns an error, for callers to check
+		"func Touch(ctx context.Context, db tsqlruntime.DBTX) (err error) {",
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("Expected %q, got:\n%s", want, result)
+		}
 	}
-	// Should have rows iteration
-	if !strings.Contains(result, ".Next()") {
-		t.Error("Expected .Next() for cursor iteration")
+	if strings.Contains(result, "r.db") || strings.Contains(result, "*Repository") {
+		t.Errorf("Functional style should not reference the receiver, got:\n%s", result)
 	}
 }
 
-// === Verb Detection Tests ===
+func TestTranspileWithDML_ConcurrentSelects(t *testing.T) {
+	body := `
+AS
+BEGIN
+    DECLARE @Tier VARCHAR(20)
+    SELECT @OrderCount = COUNT(*) FROM Orders WHERE CustomerID = @CustomerID
+    SELECT @Balance = Balance FROM Accounts WHERE CustomerID = @CustomerID
+    SELECT @Tier = Tier FROM Customers WHERE CustomerID = @CustomerID
+    SELECT @Balance = Balance * Discount FROM Tiers WHERE Name = @Tier
+END
+`
+	params := `
+    @CustomerID INT,
+    @OrderCount INT OUTPUT,
+    @Balance DECIMAL(18,2) OUTPUT`
 
-func TestTranspileWithDML_VerbDetection_ApprovalStatus(t *testing.T) {
+	result, err := TranspileWithDML("-- tgpiler:concurrent\nCREATE PROCEDURE GetDashboard"+params+body, "main", DefaultDMLConfig())
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+	for _, want := range []string{
+		`"golang.org/x/sync/errgroup"`,
+		"// 3 independent queries run concurrently",
+		"g, gctx := errgroup.WithContext(ctx)",
+		"r.db.QueryRowContext(gctx, ",
+		"if err := g.Wait(); err != nil {",
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("Expected %q, got:\n%s", want, result)
+		}
+	}
+	// The last SELECT reads @Tier and writes @Balance, so it must run after the group
+	if n := strings.Count(result, "g.Go(func() error {"); n != 3 {
+		t.Errorf("Expected 3 concurrent queries, got %d:\n%s", n, result)
+	}
+
+	// Without the pragma, statements stay sequential
+	result, err = TranspileWithDML("CREATE PROCEDURE GetDashboard"+params+body, "main", DefaultDMLConfig())
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+	if strings.Contains(result, "errgroup") {
+		t.Errorf("Expected no errgroup without the pragma, got:\n%s", result)
+	}
+}
+
+func TestTranspileWithDML_MongoBackend(t *testing.T) {
 	sql := `
-CREATE PROCEDURE dbo.ApproveOrder
-    @OrderId INT
+CREATE PROCEDURE CloseOrders
+    @CustomerID INT,
+    @Status VARCHAR(20) OUTPUT
 AS
 BEGIN
-    UPDATE Orders SET ApprovalStatus = 'Approved', ApprovedAt = GETDATE()
-    WHERE OrderId = @OrderId
+    DECLARE @Open INT
+    SELECT @Status = Status FROM Orders WHERE CustomerID = @CustomerID AND Total >= 10
+    SELECT @Open = COUNT(*) FROM OrderItems WHERE OrderID IN (1, 2) OR ShippedAt IS NULL
+    INSERT INTO AuditLog (CustomerID, Action) VALUES (@CustomerID, 'close')
+    UPDATE Orders SET Status = 'closed', Version = Version + 1 WHERE CustomerID = @CustomerID
+    DELETE FROM OrderItems WHERE (Sku LIKE 'tmp%')
+    IF @@ROWCOUNT = 0 RETURN 1
 END
 `
 	config := DefaultDMLConfig()
-	config.Backend = BackendGRPC
-	config.StoreVar = "r.client"
-	config.ProtoPackage = "orderpb"
+	config.Backend = BackendMongo
+	config.TableToCollection = map[string]string{"AuditLog": "audit"}
 
 	result, err := TranspileWithDML(sql, "main", config)
 	if err != nil {
 		t.Fatalf("TranspileWithDML failed: %v", err)
 	}
-
-	// Should detect "Approve" verb from SET ApprovalStatus = 'Approved'
-	if !strings.Contains(result, "ApproveOrder") {
-		t.Errorf("Expected ApproveOrder method (verb detection), got:\n%s", result)
+	for _, want := range []string{
+		`"go.mongodb.org/mongo-driver/bson"`,
+		`r.db.Collection("orders").FindOne(ctx, bson.M{"CustomerID": customerId, "Total": bson.M{"$gte": 10}}`,
+		`err != mongo.ErrNoDocuments`,
+		`r.db.Collection("orderItems").CountDocuments(ctx, bson.M{"$or": bson.A{bson.M{"OrderID": bson.M{"$in": bson.A{1, 2}}}, bson.M{"ShippedAt": nil}}})`,
+		`r.db.Collection("audit").InsertOne(ctx, bson.M{"CustomerID": customerId, "Action": "close"})`,
+		`bson.M{"$set": bson.M{"Status": "closed"}, "$inc": bson.M{"Version": 1}}`,
+		`r.db.Collection("orderItems").DeleteMany(ctx, bson.M{"Sku": bson.M{"$regex": "^tmp.*$"}})`,
+		"rowsAffected = int32(result.DeletedCount)",
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("Expected %q, got:\n%s", want, result)
+		}
 	}
 
-	t.Logf("Generated code:\n%s", result)
+	// Conditions that can't become a filter fail rather than widening the DELETE
+	_, err = TranspileWithDML(`
+CREATE PROCEDURE PurgeOrders
+AS
+BEGIN
+    DELETE FROM Orders WHERE ShippedAt > CreatedAt
+END
+`, "main", config)
+	if err == nil || !strings.Contains(err.Error(), "--backend=mongo") {
+		t.Errorf("Expected a mongo filter error, got %v", err)
+	}
 }
 
-func TestTranspileWithDML_VerbDetection_Certification(t *testing.T) {
+func TestTranspileWithDML_RedisBackend(t *testing.T) {
 	sql := `
-CREATE PROCEDURE dbo.CertifyDocument
-    @DocumentId INT,
-    @CertifierId INT
+CREATE PROCEDURE TouchSession
+    @SessionID VARCHAR(64),
+    @UserID INT,
+    @Expires DATETIME OUTPUT
 AS
 BEGIN
-    UPDATE Documents SET CertificationStatus = 'Certified', CertifiedBy = @CertifierId
-    WHERE DocumentId = @DocumentId
+    SELECT @UserID = UserID, @Expires = ExpiresAt FROM Sessions WHERE SessionID = @SessionID
+    INSERT INTO Sessions (SessionID, UserID) VALUES (@SessionID, @UserID)
+    UPDATE Sessions SET UserID = @UserID WHERE SessionID = @SessionID
+    DELETE FROM Sessions WHERE UserID = @UserID
+    DELETE FROM Sessions WHERE SessionID = @SessionID
 END
 `
 	config := DefaultDMLConfig()
-	config.Backend = BackendGRPC
-	config.StoreVar = "r.client"
-	config.ProtoPackage = "docpb"
+	config.Backend = BackendRedis
 
 	result, err := TranspileWithDML(sql, "main", config)
 	if err != nil {
 		t.Fatalf("TranspileWithDML failed: %v", err)
 	}
-
-	// Should detect "Certify" verb
-	if !strings.Contains(result, "Certif") {
-		t.Errorf("Expected Certify-related method, got:\n%s", result)
+	for _, want := range []string{
+		`res := r.redis.HGetAll(ctx, fmt.Sprintf("sessions:%v", sessionId))`,
+		"F1 string `redis:\"ExpiresAt\"`",
+		"time.Parse(time.RFC3339Nano, doc.F1)",
+		`r.redis.HSet(ctx, fmt.Sprintf("sessions:%v", sessionId), "SessionID", sessionId, "UserID", userId).Err()`,
+		`r.redis.Del(ctx, fmt.Sprintf("sessions:%v", sessionId)).Err()`,
+		// UPDATE and non-key lookups run on SQL
+		`r.db.ExecContext(ctx, "UPDATE Sessions SET UserID = $1 WHERE SessionID = $2"`,
+		`r.db.ExecContext(ctx, "DELETE FROM Sessions WHERE UserID = $1"`,
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("Expected %q, got:\n%s", want, result)
+		}
 	}
 
-	t.Logf("Generated code:\n%s", result)
+	// An explicit key column replaces the ID heuristic
+	config.TableToRedisKey = map[string]string{"Sessions": "UserID"}
+	result, err = TranspileWithDML(sql, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+	if !strings.Contains(result, `r.redis.Del(ctx, fmt.Sprintf("sessions:%v", userId))`) {
+		t.Errorf("Expected the DELETE by UserID to use redis, got:\n%s", result)
+	}
+	if strings.Contains(result, `HGetAll(ctx, fmt.Sprintf("sessions:%v", sessionId))`) {
+		t.Errorf("Expected the SELECT by SessionID to use SQL, got:\n%s", result)
+	}
 }
 
-func TestTranspileWithDML_GRPCMappings_ExplicitMapping(t *testing.T) {
+func TestTranspileWithDML_TableBackends(t *testing.T) {
 	sql := `
-CREATE PROCEDURE dbo.ProcessOrder
-    @OrderId INT
+CREATE PROCEDURE PlaceOrder
+    @CustomerID INT,
+    @Amount DECIMAL(10,2)
 AS
 BEGIN
-    EXEC usp_ValidateOrder @OrderId
+    DECLARE @Name NVARCHAR(100)
+    SELECT @Name = Name FROM Customers WHERE ID = @CustomerID
+    INSERT INTO Orders (CustomerID, Amount) VALUES (@CustomerID, @Amount)
+    INSERT INTO AuditLog (Message) VALUES ('order placed')
+    CREATE TABLE #tmp (ID INT)
+    INSERT INTO #tmp (ID) VALUES (@CustomerID)
 END
 `
 	config := DefaultDMLConfig()
 	config.Backend = BackendGRPC
-	config.StoreVar = "orderClient"
-	config.ProtoPackage = "orderpb"
-	config.GRPCMappings = map[string]string{
-		"usp_ValidateOrder": "OrderService.ValidateOrder",
+	config.GRPCClientVar = "r.orders"
+	config.MockStoreVar = "r.mock"
+	config.MongoDatabaseVar = "r.mongo"
+	config.TableToBackend = map[string]BackendType{
+		"dbo.Customers": BackendMongo,
+		"AUDITLOG":      BackendSQL,
+		"#tmp":          BackendMock,
 	}
 
-	result, err := TranspileWithDML(sql, "main", config)
+	result, err := TranspileWithDMLEx(sql, "main", config)
 	if err != nil {
-		t.Fatalf("TranspileWithDML failed: %v", err)
+		t.Fatalf("TranspileWithDMLEx failed: %v", err)
 	}
-
-	// Should use explicit mapping
-	if !strings.Contains(result, "ValidateOrder") {
-		t.Errorf("Expected ValidateOrder from explicit mapping, got:\n%s", result)
+	for _, want := range []string{
+		`r.mongo.Collection("customers").FindOne(ctx, bson.M{"ID": customerId}`,
+		"r.orders.CreateOrder(ctx, &CreateOrderRequest{",
+		`r.db.ExecContext(ctx, "INSERT INTO AuditLog (Message) VALUES ($1)", "order placed")`,
+		"r.mock.CreateTmp(customerId)",
+	} {
+		if !strings.Contains(result.Code, want) {
+			t.Errorf("Expected %q, got:\n%s", want, result.Code)
+		}
 	}
-	if !strings.Contains(result, "gRPC") {
-		t.Errorf("Expected gRPC comment, got:\n%s", result)
+	// #tmp is routed explicitly, so the fallback warning doesn't apply
+	if len(result.TempTableWarnings) != 0 {
+		t.Errorf("Expected no temp table warnings, got %v", result.TempTableWarnings)
 	}
-
-	t.Logf("Generated code:\n%s", result)
 }
 
-func TestTranspileWithDML_TableToService_Mapping(t *testing.T) {
+func TestTranspileWithDML_TempTablesInMemory(t *testing.T) {
 	sql := `
-CREATE PROCEDURE dbo.GetProductInfo
-    @ProductId INT
+CREATE PROCEDURE Rank @Region INT, @Min INT, @Best INT OUTPUT
 AS
 BEGIN
-    SELECT ProductId, Name, Price FROM Products WHERE ProductId = @ProductId
+    CREATE TABLE #Work (ID INT NOT NULL, Name VARCHAR(50), Total DECIMAL(10,2))
+    INSERT INTO #Work (ID, Name, Total) VALUES (1, 'a', 10)
+    INSERT INTO #Work (ID, Name, Total) SELECT ID, Name, Total FROM Customers WHERE Region = @Region
+    UPDATE #Work SET Total += 1 WHERE Name IS NOT NULL AND ID IN (1, 2)
+    DELETE FROM #Work WHERE Total BETWEEN 0 AND @Min
+    SELECT TOP 1 @Best = ID FROM #Work ORDER BY Total DESC
+    SELECT COUNT(*) AS N, ISNULL(SUM(Total), 0) AS Total FROM #Work
+    CREATE TABLE #Other (ID INT)
+    INSERT INTO #Other (ID) VALUES (@Region)
+    SELECT o.ID FROM #Other o JOIN Customers c ON c.ID = o.ID
 END
 `
 	config := DefaultDMLConfig()
 	config.Backend = BackendGRPC
-	config.ProtoPackage = "catalogpb"
-	config.TableToService = map[string]string{
-		"Products": "CatalogService",
+	config.TableToBackend = map[string]BackendType{"Customers": BackendSQL}
+
+	result, err := TranspileWithDMLEx(sql, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDMLEx failed: %v", err)
 	}
-	config.TableToClient = map[string]string{
-		"Products": "catalogClient",
+	for _, want := range []string{
+		`table.InsertScanned([]string{"ID", "Name", "Total"}, []any{1, "a", 10})`,
+		`r.db.QueryContext(ctx, "SELECT ID, Name, Total FROM Customers WHERE (Region = $1)", region)`,
+		`return tsqlruntime.NewBit(!row[1].IsNull).And(row[0].Equals(tsqlruntime.ToValue(1)).Or(row[0].Equals(tsqlruntime.ToValue(2)))).IsTruthy()`,
+		`return map[string]tsqlruntime.Value{"Total": row[2].Add(tsqlruntime.ToValue(1))}`,
+		`table.Delete(func(row []tsqlruntime.Value) bool {`,
+		`tsqlruntime.SortRows(rows, tsqlruntime.SortKey{Column: 2, Desc: true})`,
+		`best = int32(row[0].AsInt())`,
+		`n = int64(len(rows))`,
+		`total = tsqlruntime.Aggregate("SUM", rows, func(row []tsqlruntime.Value) tsqlruntime.Value { return row[2] }).Coalesce(tsqlruntime.ToValue(0)).AsDecimal()`,
+		// #Other is joined, so it stays on the fallback backend
+		`r.db.ExecContext(ctx, "INSERT INTO #Other (ID) VALUES ($1)", region)`,
+	} {
+		if !strings.Contains(result.Code, want) {
+			t.Errorf("Expected %q, got:\n%s", want, result.Code)
+		}
+	}
+	for _, sql := range []string{"INTO #Work (", "UPDATE #Work SET", "FROM #Work WHERE"} {
+		if strings.Contains(result.Code, sql) {
+			t.Errorf("Expected no SQL for #Work, got:\n%s", result.Code)
+		}
 	}
+	if !strings.Contains(strings.Join(result.Warnings, "\n"), "statements on #Other use the sql backend rather than tempTables") {
+		t.Errorf("Expected a warning for #Other, got %v", result.Warnings)
+	}
+}
 
-	result, err := TranspileWithDML(sql, "main", config)
+func TestTranspileWithDML_TempTableOmittedColumn(t *testing.T) {
+	sql := `
+CREATE PROCEDURE Totals @Total DECIMAL(10,2) OUTPUT, @Cnt INT OUTPUT
+AS
+BEGIN
+    CREATE TABLE #t (Id INT NOT NULL, Amount DECIMAL(10,2), Note NVARCHAR(20) NULL)
+    INSERT INTO #t (Id, Amount) VALUES (1, 10.5), (2, 20)
+    SELECT @Total = SUM(Amount), @Cnt = COUNT(*) FROM #t WHERE Note IS NULL
+END
+`
+	config := DefaultDMLConfig()
+	config.Backend = BackendGRPC
+
+	code, err := TranspileWithDML(sql, "main", config)
 	if err != nil {
 		t.Fatalf("TranspileWithDML failed: %v", err)
 	}
-
-	// Should use catalogClient for Products table
-	if !strings.Contains(result, "catalogClient") {
-		t.Errorf("Expected catalogClient from TableToClient mapping, got:\n%s", result)
+	// Note is left out of the INSERT, so it must be NULL for the filter
+	for _, want := range []string{
+		"\t\t\tNullable: false,\n\t\t},",
+		"\t\t\tNullable: true,\n\t\t\tDefaultValue: tsqlruntime.Null(tsqlruntime.TypeDecimal),\n",
+		"\t\t\tNullable: true,\n\t\t\tDefaultValue: tsqlruntime.Null(tsqlruntime.TypeNVarChar),\n",
+		`table.InsertScanned([]string{"Id", "Amount"}, []any{2, 20})`,
+		"return tsqlruntime.NewBit(row[2].IsNull).IsTruthy()",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("Expected %q, got:\n%s", want, code)
+		}
 	}
+}
 
-	t.Logf("Generated code:\n%s", result)
+func TestTranspileWithDML_GlobalTempTables(t *testing.T) {
+	sql := `
+CREATE PROCEDURE LoadStaging
+AS
+BEGIN
+    CREATE TABLE ##Staging (ID INT, Name VARCHAR(50))
+    INSERT INTO ##Staging (ID, Name) SELECT CustomerID, Name FROM Customers
+END
+GO
+CREATE PROCEDURE ReadStaging @ID INT, @Name VARCHAR(50) OUTPUT
+AS
+BEGIN
+    SELECT @Name = Name FROM ##Staging WHERE ID = @ID
+    DROP TABLE ##Staging
+END
+`
+	result, err := TranspileWithDMLEx(sql, "main", DefaultDMLConfig())
+	if err != nil {
+		t.Fatalf("TranspileWithDMLEx failed: %v", err)
+	}
+	read := result.Code[strings.Index(result.Code, "func (r *Repository) ReadStaging"):]
+	for _, want := range []string{
+		"tempTables := tsqlruntime.NewTempTableManager()",
+		`table, err := tempTables.Table("##Staging")`,
+		`tempTables.DropTempTable("##Staging")`,
+	} {
+		if !strings.Contains(read, want) {
+			t.Errorf("Expected %q in ReadStaging, got:\n%s", want, read)
+		}
+	}
+	if strings.Contains(result.Code, "FROM ##Staging WHERE") {
+		t.Errorf("Expected no SQL for ##Staging, got:\n%s", result.Code)
+	}
+	if !strings.Contains(strings.Join(result.Warnings, "\n"), "##Staging is shared by LoadStaging (creates it), ReadStaging") {
+		t.Errorf("Expected a warning for ##Staging, got %v", result.Warnings)
+	}
 }
 
-func TestExtractActionVerb(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected string
-	}{
-		// Approval verbs
-		{"ApprovalStatus", "Approve"},
-		{"ApprovedAt", "Approve"},
-		{"ApprovedBy", "Approve"},
-		{"IsApproved", "Approve"},
-		{"RejectionReason", "Reject"},
-		{"RejectedDate", "Reject"},
-		{"DenialCode", "Deny"},
-
-		// Certification verbs
-		{"CertificationDate", "Certify"},
-		{"CertifiedBy", "Certify"},
-		{"AttestationId", "Attest"},
-
-		// Lifecycle verbs
-		{"SuspendedUntil", "Suspend"},
-		{"SuspensionReason", "Suspend"},
-		{"CancelledBy", "Cancel"},
-		{"CancellationDate", "Cancel"},
-		{"TerminatedAt", "Terminate"},
-		{"TerminationReason", "Terminate"},
-		{"CompletedDate", "Complete"},
-		{"CompletionStatus", "Complete"},
-		{"ActivatedAt", "Activate"},
-		{"DeactivatedBy", "Deactivate"},
+func TestTranspileWithDML_Suggestions(t *testing.T) {
+	sql := `
+CREATE PROCEDURE PlaceOrder @CustomerID INT, @Amount INT
+AS
+BEGIN
+    INSERT INTO Orders (CustomerID, Amount) VALUES (@CustomerID, @Amount)
+    UPDATE Orders SET Amount = @Amount WHERE CustomerID = @CustomerID
+    INSERT INTO Products (Name) VALUES ('gift')
+    CREATE TABLE #tmp (ID INT)
+    INSERT INTO #tmp (ID) VALUES (@CustomerID)
+    SELECT t.ID FROM #tmp t JOIN Orders o ON o.CustomerID = t.ID
+END
+`
+	config := DefaultDMLConfig()
+	config.Backend = BackendGRPC
+	config.TableToService = map[string]string{"Products": "CatalogService"}
 
-		// Communication verbs
-		{"NotificationSent", "Notify"},
-		{"NotifiedAt", "Notify"},
-		{"AlertTriggered", "Alert"},
+	result, err := TranspileWithDMLEx(sql, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDMLEx failed: %v", err)
+	}
+	var got []string
+	for _, d := range result.Diagnostics {
+		got = append(got, d.Suggestion.String())
+	}
+	// Orders once, Products not at all, and the fallback for the temp
+	// table the join keeps out of memory
+	want := []string{"--table-service=Orders:OrderService", "--fallback-backend=sql"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("Expected suggestions %v, got %v", want, got)
+	}
+	if d := result.Diagnostics[0]; d.Procedure != "PlaceOrder" || !strings.Contains(d.Message, "table Orders has no --table-service entry") {
+		t.Errorf("Unexpected diagnostic %+v", d)
+	}
 
-		// Validation verbs
-		{"VerificationCode", "Verify"},
-		{"ValidatedBy", "Validate"},
-		{"ValidationStatus", "Validate"},
+	config.TableToService["Orders"] = "OrderService"
+	config.FallbackExplicit = true
+	result, err = TranspileWithDMLEx(sql, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDMLEx failed: %v", err)
+	}
+	if len(result.Diagnostics) != 0 {
+		t.Errorf("Expected no diagnostics once the suggestions are applied, got %v", result.Diagnostics)
+	}
+}
 
-		// Calculation verbs
-		{"CalculatedAmount", "Calculate"},
-		{"ComputedTotal", "Compute"},
-		{"EstimatedValue", "Estimate"},
+func TestTranspileWithDML_GeneratedColumns(t *testing.T) {
+	sql := `
+CREATE TABLE dbo.Orders (
+    OrderID INT IDENTITY(1,1) PRIMARY KEY,
+    Qty INT NOT NULL,
+    Price DECIMAL(10,2) NOT NULL,
+    Total AS (Qty * Price) PERSISTED
+)
+GO
+CREATE PROCEDURE CopyOrder
+    @OrderID INT,
+    @Qty INT,
+    @Price DECIMAL(10,2),
+    @Total DECIMAL(10,2)
+AS
+BEGIN
+    INSERT INTO Orders (OrderID, Qty, Price, Total) VALUES (@OrderID, @Qty, @Price, @Total)
+    INSERT INTO Orders (OrderID, Qty, Price, Total) SELECT OrderID, Qty, Price, Total FROM OldOrders
+    INSERT INTO Orders (Qty, Price, Total) SELECT * FROM OldOrders
+    UPDATE Orders SET Total = @Total, Qty = @Qty WHERE OrderID = @OrderID
+    UPDATE Orders SET Total = @Total WHERE OrderID = @OrderID
+    INSERT INTO Audit (ID, Note) VALUES (@OrderID, 'copied')
+END
+`
+	config := DefaultDMLConfig()
+	config.GeneratedColumns = map[string]map[string]string{"Audit": {"id": GeneratedIdentity}}
 
-		// Signing verbs
-		{"SignedAt", "Sign"},
-		{"SignatureId", "Sign"},
-		{"CountersignedBy", "Countersign"},
+	result, err := TranspileWithDMLEx(sql, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDMLEx failed: %v", err)
+	}
+	for _, want := range []string{
+		"// Omitted OrderID (identity), Total (computed) from INSERT: generated by the database",
+		`"INSERT INTO Orders (Qty, Price) VALUES ($1, $2)", qty, price)`,
+		`"INSERT INTO Orders (Qty, Price) SELECT Qty, Price FROM OldOrders"`,
+		// SELECT * can't be matched up, so the statement is left alone
+		`"INSERT INTO Orders (Qty, Price, Total) SELECT * FROM OldOrders"`,
+		`"UPDATE Orders SET Qty = $1 WHERE OrderID = $2", qty, orderId)`,
+		"// Omitted Total (computed) from UPDATE: generated by the database",
+		// Configured schema applies to tables not created in the source
+		`"INSERT INTO Audit (Note) VALUES ($1)", "copied")`,
+	} {
+		if !strings.Contains(result.Code, want) {
+			t.Errorf("Expected %q, got:\n%s", want, result.Code)
+		}
+	}
+	if strings.Count(result.Code, "UPDATE Orders") != 1 {
+		t.Errorf("Expected the UPDATE of only Total to be dropped, got:\n%s", result.Code)
+	}
+	warnings := strings.Join(result.Warnings, "\n")
+	if !strings.Contains(warnings, "can't be matched up") || !strings.Contains(warnings, "UPDATE Orders omits generated column(s) Total (computed)") {
+		t.Errorf("Unexpected warnings:\n%s", warnings)
+	}
+}
 
-		// Review verbs
-		{"ReviewedBy", "Review"},
-		{"AssessmentScore", "Assess"},
-		{"AuditTrailId", "Audit"},
+func TestTranspileWithDML_BulkInsert(t *testing.T) {
+	sql := `
+CREATE PROCEDURE LoadOrders
+AS
+BEGIN
+    DECLARE @Config NVARCHAR(MAX)
+    BULK INSERT dbo.Staging FROM 'C:\data\orders.csv' WITH (FIELDTERMINATOR = ';', ROWTERMINATOR = '\n', FIRSTROW = 2, TABLOCK, FORMAT = 'CSV')
+    IF @@ROWCOUNT = 0 RETURN 1
+    BULK INSERT Staging FROM '/data/orders.txt' WITH (FIELDTERMINATOR = '|', ROWTERMINATOR = '0x0a', ERRORFILE = '/data/errors.log')
+    SELECT @Config = BulkColumn FROM OPENROWSET(BULK '/data/config.json', SINGLE_CLOB) AS j
+    RETURN 0
+END
+`
+	config := DefaultDMLConfig()
+	config.SQLDialect = "sqlserver"
+	result, err := TranspileWithDMLEx(sql, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDMLEx failed: %v", err)
+	}
+	for _, want := range []string{
+		`if n, err := tsqlruntime.BulkInsert(ctx, r.db, "dbo.Staging", nil, "C:\\data\\orders.csv", tsqlruntime.BulkOptions{Dialect: tsqlruntime.DialectSQLServer, FieldTerminator: ";", FirstRow: 2, CSV: true, RowTerminator: "\n"}); err != nil {`,
+		"rowsAffected = int32(n)",
+		`tsqlruntime.BulkOptions{Dialect: tsqlruntime.DialectSQLServer, FieldTerminator: "|", RowTerminator: "\n"}`,
+		`if data, err := tsqlruntime.ReadBulkText("/data/config.json", false); err != nil {`,
+		"config = data",
+	} {
+		if !strings.Contains(result.Code, want) {
+			t.Errorf("Expected %q, got:\n%s", want, result.Code)
+		}
+	}
+	if warnings := strings.Join(result.Warnings, "\n"); !strings.Contains(warnings, "ERRORFILE is ignored") {
+		t.Errorf("Expected an ERRORFILE warning, got:\n%s", warnings)
+	}
 
-		// Escalation verbs
-		{"EscalatedTo", "Escalate"},
-		{"EscalationLevel", "Escalate"},
-		{"DelegatedBy", "Delegate"},
+	for _, tc := range []struct{ stmt, want string }{
+		{"BULK INSERT Staging FROM 'f.dat' WITH (DATAFILETYPE = 'native')", "DATAFILETYPE = 'native' is not supported"},
+		{"BULK INSERT Staging FROM 'f.dat' WITH (FORMATFILE = 'f.fmt')", "format files are not supported"},
+		{"INSERT INTO Staging (A) SELECT A FROM OPENROWSET(BULK 'f.dat', FORMATFILE = 'f.fmt') AS src", "use BULK INSERT into a staging table"},
+	} {
+		_, err := TranspileWithDMLEx("CREATE PROCEDURE P AS\nBEGIN\n"+tc.stmt+"\nEND", "main", DefaultDMLConfig())
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: expected error containing %q, got %v", tc.stmt, tc.want, err)
+		}
+	}
+}
 
-		// Transfer verbs
-		{"TransferredAt", "Transfer"},
-		{"SubmittedDate", "Submit"},
-		{"SubmissionId", "Submit"},
+func TestTranspileWithDML_EventTables(t *testing.T) {
+	sql := `
+CREATE PROCEDURE PlaceOrder
+    @OrderID INT,
+    @Amount DECIMAL(10,2)
+AS
+BEGIN
+    INSERT INTO Orders (OrderID, Amount) VALUES (@OrderID, @Amount)
+    INSERT INTO dbo.EventQueue (EventType, OrderID) VALUES ('OrderPlaced', @OrderID), ('Audit', @OrderID)
+    DELETE FROM EventQueue WHERE OrderID = @OrderID
+END
+`
+	config := DefaultDMLConfig()
+	config.TableToEvent = map[string]string{"dbo.EventQueue": "order-events"}
+	config.TableToEventKey = map[string]string{"EventQueue": "OrderID"}
+	config.EventPublisherVar = "r.publisher"
 
-		// Negative cases - no verb detected
-		{"ProductName", ""},
-		{"UserId", ""},
-		{"CreatedAt", ""},          // Create is CRUD, not action verb
-		{"UpdatedBy", ""},          // Update is CRUD, not action verb
-		{"OrderTotal", ""},
-		{"CustomerEmail", ""},
-		{"Price", ""},
-		{"Quantity", ""},
-		{"Description", ""},
+	result, err := TranspileWithDMLEx(sql, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDMLEx failed: %v", err)
+	}
+	for _, want := range []string{
+		`"INSERT INTO Orders (OrderID, Amount) VALUES ($1, $2)"`,
+		"// INSERT INTO EventQueue -> publish to order-events",
+		`tsqlruntime.PublishEvent(ctx, r.publisher, "order-events", orderId, map[string]any{"EventType": "OrderPlaced", "OrderID": orderId})`,
+		`tsqlruntime.PublishEvent(ctx, r.publisher, "order-events", orderId, map[string]any{"EventType": "Audit", "OrderID": orderId})`,
+	} {
+		if !strings.Contains(result.Code, want) {
+			t.Errorf("Expected %q, got:\n%s", want, result.Code)
+		}
+	}
+	if strings.Contains(result.Code, "INSERT INTO dbo.EventQueue") {
+		t.Errorf("Expected no SQL INSERT into the event table, got:\n%s", result.Code)
+	}
+	if warnings := strings.Join(result.Warnings, "\n"); !strings.Contains(warnings, "DELETE EventQueue still runs against the database") {
+		t.Errorf("Expected a warning for the DELETE, got:\n%s", warnings)
 	}
 
-	for _, tc := range tests {
-		t.Run(tc.input, func(t *testing.T) {
-			result := extractActionVerb(tc.input)
-			if result != tc.expected {
-				t.Errorf("extractActionVerb(%q) = %q, want %q", tc.input, result, tc.expected)
-			}
-		})
+	_, err = TranspileWithDMLEx("CREATE PROCEDURE P AS\nBEGIN\nINSERT INTO EventQueue (EventType) SELECT Name FROM Types\nEND", "main", config)
+	if err == nil || !strings.Contains(err.Error(), "needs a VALUES list") {
+		t.Errorf("Expected an error for INSERT ... SELECT, got %v", err)
 	}
 }
 
-func TestInferProtoPackage(t *testing.T) {
-	tests := []struct {
-		serviceName string
-		expected    string
-	}{
-		{"CatalogService", "catalogpb"},
-		{"OrderService", "orderpb"},
-		{"UserAccountService", "useraccountpb"},
-		{"InventorySvc", "inventorypb"},
-		{"PaymentAPI", "paymentpb"},
-		{"ShippingApi", "shippingpb"},
-		{"Catalog", "catalogpb"},
-		{"Orders", "orderspb"},
-	}
+func TestTranspileWithDML_DatabaseMail(t *testing.T) {
+	sql := `
+CREATE PROCEDURE NotifyLowStock
+    @ProductID INT
+AS
+BEGIN
+    DECLARE @msg NVARCHAR(200) = 'Product ' + CAST(@ProductID AS NVARCHAR(10)) + ' is low'
+    EXEC msdb.dbo.sp_send_dbmail @profile_name = 'Ops', @recipients = 'ops@example.com',
+        @subject = 'Low stock', @body = @msg
+    EXEC master.dbo.xp_sendmail 'ops@example.com', @message = @msg
+END
+`
+	config := DefaultDMLConfig()
+	config.NotifierVar = "r.mailer"
 
-	for _, tc := range tests {
-		t.Run(tc.serviceName, func(t *testing.T) {
-			result := inferProtoPackage(tc.serviceName)
-			if result != tc.expected {
-				t.Errorf("inferProtoPackage(%q) = %q, want %q", tc.serviceName, result, tc.expected)
-			}
-		})
+	result, err := TranspileWithDMLEx(sql, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDMLEx failed: %v", err)
+	}
+	for _, want := range []string{
+		`r.mailer.Send(ctx, "ops@example.com", "Low stock", msg)`,
+		`r.mailer.Send(ctx, "ops@example.com", "", msg)`,
+	} {
+		if !strings.Contains(result.Code, want) {
+			t.Errorf("Expected %q, got:\n%s", want, result.Code)
+		}
+	}
+	if warnings := strings.Join(result.Warnings, "\n"); !strings.Contains(warnings, "@profile_name are not passed to r.mailer.Send") {
+		t.Errorf("Expected a warning for @profile_name, got:\n%s", warnings)
+	}
+	if len(result.SideEffects) != 2 {
+		t.Fatalf("Expected 2 side effects, got %v", result.SideEffects)
+	}
+	if e := result.SideEffects[0]; e.Kind != "mail" || e.Original != "sp_send_dbmail" || len(e.Dropped) != 1 {
+		t.Errorf("Unexpected side effect %v", e)
 	}
 }
 
-func TestTranspileWithDML_ServiceToPackageInference(t *testing.T) {
+func TestTranspileWithDML_ExecStats(t *testing.T) {
 	sql := `
-CREATE PROCEDURE dbo.GetProductDetails
-    @ProductId INT
+CREATE PROCEDURE Sales.TouchOrder @OrderID INT
 AS
 BEGIN
-    SELECT ProductId, Name, Price FROM Products WHERE ProductId = @ProductId
+    UPDATE Orders SET Touched = 1 WHERE OrderID = @OrderID
+END
+GO
+CREATE PROCEDURE Ping
+AS
+BEGIN
+    RETURN 0
 END
 `
 	config := DefaultDMLConfig()
-	config.Backend = BackendGRPC
-	// No explicit ProtoPackage - should infer from service name
-	config.TableToService = map[string]string{
-		"Products": "CatalogService",
-	}
+	config.ExecStats = true
 
-	result, err := TranspileWithDML(sql, "main", config)
+	code, err := TranspileWithDML(sql, "main", config)
 	if err != nil {
 		t.Fatalf("TranspileWithDML failed: %v", err)
 	}
-
-	// Should infer catalogpb from CatalogService
-	if !strings.Contains(result, "catalogpb") {
-		t.Errorf("Expected inferred catalogpb package, got:\n%s", result)
+	for _, want := range []string{
+		`"github.com/ha1tch/tgpiler/tsqlruntime"`,
+		"(err error) {\n\tdefer tsqlruntime.TrackProcedure(\"Sales.TouchOrder\")()\n",
+		`defer tsqlruntime.TrackProcedure("dbo.Ping")()`,
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("Expected %q, got:\n%s", want, code)
+		}
 	}
 
-	t.Logf("Generated code:\n%s", result)
+	config.ExecStats = false
+	code, err = TranspileWithDML(sql, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+	if strings.Contains(code, "TrackProcedure") {
+		t.Errorf("Expected no statistics without ExecStats, got:\n%s", code)
+	}
 }
 
-func TestTranspileWithDML_VerbDetection_Suspend(t *testing.T) {
+func TestTranspileWithDML_Metrics(t *testing.T) {
 	sql := `
-CREATE PROCEDURE dbo.SuspendAccount
-    @AccountId INT,
-    @Reason VARCHAR(500)
+CREATE PROCEDURE Sales.TouchOrder @OrderID INT
 AS
 BEGIN
-    UPDATE Accounts SET SuspendedAt = GETDATE(), SuspensionReason = @Reason
-    WHERE AccountId = @AccountId
+    UPDATE Orders SET Touched = 1 WHERE OrderID = @OrderID
+END
+GO
+CREATE PROCEDURE Ping
+AS
+BEGIN
+    RETURN 0
 END
 `
 	config := DefaultDMLConfig()
-	config.Backend = BackendGRPC
-	config.StoreVar = "r.client"
-	config.ProtoPackage = "accountpb"
+	config.Metrics = true
 
-	result, err := TranspileWithDML(sql, "main", config)
+	code, err := TranspileWithDML(sql, "main", config)
 	if err != nil {
 		t.Fatalf("TranspileWithDML failed: %v", err)
 	}
-
-	// Should detect "Suspend" verb from SuspendedAt column
-	if !strings.Contains(result, "SuspendAccount") {
-		t.Errorf("Expected SuspendAccount method (verb detection), got:\n%s", result)
+	for _, want := range []string{
+		"(err error) {\n\tobserve := tsqlruntime.ObserveProcedure(r.metrics, \"TouchOrder\")\n\tdefer func() { observe(err) }()\n",
+		`defer tsqlruntime.ObserveProcedure(r.metrics, "Ping")(nil)`,
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("Expected %q, got:\n%s", want, code)
+		}
 	}
 
-	t.Logf("Generated code:\n%s", result)
+	config.Metrics = false
+	code, err = TranspileWithDML(sql, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+	if strings.Contains(code, "ObserveProcedure") {
+		t.Errorf("Expected no metrics without Metrics, got:\n%s", code)
+	}
 }
 
-func TestTranspileWithDML_VerbDetection_Escalate(t *testing.T) {
+func TestTranspileWithDML_TableValuedParameter(t *testing.T) {
 	sql := `
-CREATE PROCEDURE dbo.EscalateTicket
-    @TicketId INT,
-    @EscalatedTo INT
+CREATE TYPE dbo.OrderItemList AS TABLE (
+    ProductID INT NOT NULL,
+    Quantity INT NOT NULL,
+    UnitPrice DECIMAL(18,2) NULL
+)
+GO
+CREATE PROCEDURE AddOrderItems @OrderID INT, @Items dbo.OrderItemList READONLY
 AS
 BEGIN
-    UPDATE Tickets SET EscalationLevel = EscalationLevel + 1, EscalatedTo = @EscalatedTo
-    WHERE TicketId = @TicketId
+    INSERT INTO OrderItems (OrderID, ProductID, Quantity)
+    SELECT @OrderID, ProductID, Quantity FROM @Items
 END
 `
 	config := DefaultDMLConfig()
-	config.Backend = BackendGRPC
-	config.StoreVar = "r.client"
-	config.ProtoPackage = "ticketpb"
+	code, err := TranspileWithDML(sql, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+	for _, want := range []string{
+		"type OrderItemList struct {\n\tProductId int32\n\tQuantity  int32\n\tUnitPrice *decimal.Decimal\n}",
+		`Types:   []string{"integer", "integer", "numeric(18,2)"},`,
+		"AddOrderItems(ctx context.Context, orderId int32, items []OrderItemList)",
+		`tsqlruntime.ExecTableParams(ctx, r.db, tsqlruntime.DialectPostgres, "INSERT INTO OrderItems (OrderID, ProductID, Quantity) SELECT $1, ProductID, Quantity FROM @Items", []tsqlruntime.TableParam{orderItemListParam("Items", items)}, orderId)`,
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("Expected %q, got:\n%s", want, code)
+		}
+	}
 
-	result, err := TranspileWithDML(sql, "main", config)
+	// Declared by another file of the package, from the schema
+	proc := sql[strings.Index(sql, "CREATE PROCEDURE"):]
+	types, err := TableTypes(sql)
+	if err != nil || len(types) != 1 {
+		t.Fatalf("TableTypes: %v, %v", types, err)
+	}
+	config.TableTypes = types
+	config.DeclaredTableTypes = []string{"OrderItemList"}
+	code, err = TranspileWithDML(proc, "main", config)
 	if err != nil {
 		t.Fatalf("TranspileWithDML failed: %v", err)
 	}
+	if strings.Contains(code, "type OrderItemList") || !strings.Contains(code, "items []OrderItemList") {
+		t.Errorf("Expected the declared struct to be used but not redeclared, got:\n%s", code)
+	}
 
-	// Should detect "Escalate" verb from EscalationLevel or EscalatedTo
-	if !strings.Contains(result, "Escalate") {
-		t.Errorf("Expected Escalate-related method, got:\n%s", result)
+	config = DefaultDMLConfig()
+	config.Backend = BackendGRPC
+	config.ProtoPackage = "orderpb"
+	code, err = TranspileWithDML(sql, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
 	}
+	for _, want := range []string{
+		"itemsMsgs = append(itemsMsgs, &orderpb.OrderItem{ProductId: row.ProductId, Quantity: row.Quantity})",
+		"CreateOrderItems(ctx, &orderpb.CreateOrderItemsRequest{\n\t\tOrderId: orderId,\n\t\tOrderItems: itemsMsgs,",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("Expected %q, got:\n%s", want, code)
+		}
+	}
+}
 
-	t.Logf("Generated code:\n%s", result)
+func TestGenerateTableTypes(t *testing.T) {
+	types, err := TableTypes(`
+CREATE TYPE dbo.IdList AS TABLE (ID BIGINT PRIMARY KEY)
+GO
+CREATE TYPE dbo.PriceList AS TABLE (ProductID INT NOT NULL, Price DECIMAL(18,2) NULL)
+`)
+	if err != nil || len(types) != 2 {
+		t.Fatalf("TableTypes: %v, %v", types, err)
+	}
+	code, err := GenerateTableTypes(types, "repo", DefaultDMLConfig())
+	if err != nil {
+		t.Fatalf("GenerateTableTypes failed: %v", err)
+	}
+	for _, want := range []string{
+		"package repo\n\nimport (\n\t\"github.com/ha1tch/tgpiler/tsqlruntime\"\n\t\"github.com/shopspring/decimal\"\n)",
+		"type IdList struct {\n\tId int64\n}",
+		"func idListParam(name string, rows []IdList) tsqlruntime.TableParam {",
+		"type PriceList struct {\n\tProductId int32\n\tPrice     *decimal.Decimal\n}",
+		"func priceListParam(name string, rows []PriceList) tsqlruntime.TableParam {",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("Expected %q, got:\n%s", want, code)
+		}
+	}
 }
 
-func TestTranspileWithDML_VerbDetection_Notify(t *testing.T) {
+func TestTranspileWithDML_Passthrough(t *testing.T) {
 	sql := `
-CREATE PROCEDURE dbo.SendNotification
-    @UserId INT,
-    @Message VARCHAR(1000)
+CREATE PROCEDURE usp_PlaceOrder @OrderID INT, @Amount DECIMAL(10,2)
 AS
 BEGIN
-    INSERT INTO Notifications (UserId, Message, NotificationSent, NotifiedAt)
-    VALUES (@UserId, @Message, 1, GETDATE())
+    DECLARE @Status INT
+    DECLARE @Ref NVARCHAR(50)
+    EXEC dbo.usp_Charge @OrderID, @Amount, @Ref OUTPUT
+    EXEC @Status = usp_Notify @OrderID = @OrderID, @Note = N'placed'
+    EXEC usp_Notify @OrderID = @OrderID, @Note = N'again'
 END
 `
 	config := DefaultDMLConfig()
-	config.Backend = BackendGRPC
-	config.StoreVar = "r.client"
-	config.ProtoPackage = "notifypb"
+	config.Passthrough = []string{"usp_Charge", "dbo.usp_Notify"}
+	result, err := TranspileWithDMLEx(sql, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+	code := result.Code
+	for _, want := range []string{
+		"ref, _, err = r.UspCharge(ctx, orderId, amount)",
+		"status, err = r.UspNotify(ctx, orderId, \"placed\")",
+		"if _, err := r.UspNotify(ctx, orderId, \"again\"); err != nil {",
+		"func (r *Repository) UspCharge(ctx context.Context, orderId int32, amount decimal.Decimal) (ref string, returnCode int32, err error) {",
+		"returnCode, err = tsqlruntime.CallProcedure(ctx, r.db, tsqlruntime.DialectPostgres, \"dbo.usp_Charge\",",
+		"tsqlruntime.ProcParam{Value: &ref, Output: true},",
+		"tsqlruntime.ProcParam{Name: \"Note\", Value: note},",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("Expected %q, got:\n%s", want, code)
+		}
+	}
+	if n := strings.Count(code, "func (r *Repository) UspNotify("); n != 1 {
+		t.Errorf("Expected one UspNotify stub, got %d", n)
+	}
+	if got := strings.Join(result.Passthroughs, ","); got != "UspCharge,UspNotify" {
+		t.Errorf("Passthroughs = %v", result.Passthroughs)
+	}
 
-	result, err := TranspileWithDML(sql, "main", config)
+	// Declared by an earlier file of the package
+	config.DeclaredPassthroughs = result.Passthroughs
+	code, err = TranspileWithDML(sql, "main", config)
 	if err != nil {
 		t.Fatalf("TranspileWithDML failed: %v", err)
 	}
+	if strings.Contains(code, "tsqlruntime.CallProcedure") {
+		t.Errorf("Expected no stubs, got:\n%s", code)
+	}
 
-	// Should detect "Notify" verb from NotificationSent or NotifiedAt columns
-	if !strings.Contains(result, "Notify") {
-		t.Errorf("Expected Notify-related method, got:\n%s", result)
+	config = DefaultDMLConfig()
+	config.Backend = BackendGRPC
+	config.Passthrough = []string{"usp_Charge"}
+	if _, err := TranspileWithDML(sql, "main", config); err == nil || !strings.Contains(err.Error(), "SQL backend") {
+		t.Errorf("Expected a backend error, got %v", err)
 	}
+}
 
-	t.Logf("Generated code:\n%s", result)
+func TestTranspileWithDML_ProcedureCall(t *testing.T) {
+	sql := `
+CREATE PROCEDURE dbo.usp_GetOrder @OrderID INT, @Status NVARCHAR(20) OUTPUT
+AS
+BEGIN
+    SELECT OrderID, CreatedAt FROM Orders WHERE OrderID = @OrderID
+    SET @Status = 'ok'
+END
+GO
+CREATE PROCEDURE usp_Touch @OrderID INT
+AS
+    UPDATE Orders SET Touched = 1 WHERE OrderID = @OrderID
+`
+	config := DefaultDMLConfig()
+	config.Backend = BackendProcedureCall
+	code, err := TranspileWithDML(sql, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+	for _, want := range []string{
+		"type UspGetOrderRow struct {\n\tOrderId   int32\n\tCreatedAt time.Time\n}",
+		"func (r *Repository) UspGetOrder(ctx context.Context, orderId int32) (rows []UspGetOrderRow, status string, returnCode int32, err error) {",
+		`returnCode, err = tsqlruntime.QueryProcedure(ctx, r.db, tsqlruntime.DialectSQLServer, "dbo.usp_GetOrder", func(set int, rs *sql.Rows) error {`,
+		"if err := rs.Scan(tsqlruntime.Nullable(&row.OrderId), tsqlruntime.Nullable(&row.CreatedAt)); err != nil {",
+		`tsqlruntime.ProcParam{Name: "Status", Value: &status, Output: true},`,
+		`returnCode, err = tsqlruntime.CallProcedure(ctx, r.db, tsqlruntime.DialectSQLServer, "usp_Touch",`,
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("Expected %q, got:\n%s", want, code)
+		}
+	}
+	if strings.Contains(code, "UPDATE Orders") {
+		t.Errorf("Expected the body not to be transpiled, got:\n%s", code)
+	}
+
+	config.Style = StyleFunctions
+	code, err = TranspileWithDML(sql, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+	if !strings.Contains(code, "func UspTouch(ctx context.Context, db tsqlruntime.DBTX, orderId int32) (returnCode int32, err error) {") {
+		t.Errorf("Expected a functional wrapper, got:\n%s", code)
+	}
+}
+
+func TestTranspileWithDML_ProcedureCallRows(t *testing.T) {
+	sql := `
+CREATE PROCEDURE dbo.usp_GetOrders @CustomerID INT
+AS
+BEGIN
+    SELECT OrderID, Total FROM Orders WHERE CustomerID = @CustomerID
+END
+GO
+CREATE PROCEDURE dbo.usp_GetOrder @OrderID INT, @Status NVARCHAR(20) OUTPUT
+AS
+BEGIN
+    SELECT OrderID FROM Orders WHERE OrderID = @OrderID
+    SET @Status = 'ok'
+END
+`
+	config := DefaultDMLConfig()
+	config.Backend = BackendProcedureCall
+	config.RowsMode = RowsCallback
+	code, err := TranspileWithDML(sql, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+	for _, want := range []string{
+		"func (r *Repository) UspGetOrders(ctx context.Context, customerId int32, eachRow func(UspGetOrdersRow) error) (returnCode int32, err error) {",
+		"\t\t\t\tif err := eachRow(row); err != nil {\n\t\t\t\t\treturn err\n",
+		"\treturn returnCode, err\n",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("Expected %q, got:\n%s", want, code)
+		}
+	}
+
+	config.RowsMode = RowsIter
+	if _, err := TranspileWithDML(sql, "main", config); err == nil || !strings.Contains(err.Error(), "Go 1.23") {
+		t.Errorf("Expected an error for iterators before Go 1.23, got %v", err)
+	}
+	config.GoVersion = "1.23"
+	result, err := TranspileWithDMLEx(sql, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDMLEx failed: %v", err)
+	}
+	for _, want := range []string{
+		`"iter"`,
+		"func (r *Repository) UspGetOrders(ctx context.Context, customerId int32) iter.Seq2[UspGetOrdersRow, error] {",
+		`return tsqlruntime.ProcedureRows(ctx, r.db, tsqlruntime.DialectSQLServer, "dbo.usp_GetOrders", func(rs *sql.Rows) (row UspGetOrdersRow, err error) {`,
+		"err = rs.Scan(tsqlruntime.Nullable(&row.OrderId), tsqlruntime.Nullable(&row.Total))",
+		// An OUTPUT parameter doesn't fit an iterator
+		"func (r *Repository) UspGetOrder(ctx context.Context, orderId int32, eachRow func(UspGetOrderRow) error) (status string, returnCode int32, err error) {",
+	} {
+		if !strings.Contains(result.Code, want) {
+			t.Errorf("Expected %q, got:\n%s", want, result.Code)
+		}
+	}
+	if len(result.Warnings) == 0 || !strings.Contains(result.Warnings[len(result.Warnings)-1], "usp_GetOrder: ") {
+		t.Errorf("Expected a warning for usp_GetOrder, got %v", result.Warnings)
+	}
+}
+
+func TestTranspileWithDML_CrossPackage(t *testing.T) {
+	sql := `
+CREATE PROCEDURE Sales.usp_PlaceOrder @OrderID INT
+AS
+BEGIN
+    UPDATE Orders SET Status = 'placed' WHERE OrderID = @OrderID
+    EXEC Billing.usp_Charge @OrderID
+    EXEC Sales.usp_Notify @OrderID
+END
+`
+	config := DefaultDMLConfig()
+	config.Style = StyleFunctions
+	config.ModulePath = "github.com/acme/app/gen"
+	config.SchemaToPackage = map[string]string{"Billing": "billing", "Sales": "sales"}
+
+	code, err := TranspileWithDML(sql, "sales", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+	for _, want := range []string{
+		`"github.com/acme/app/gen/billing"`,
+		"billing.Charge(ctx, db, orderId)",
+		"if err := Notify(ctx, db, orderId); err != nil {",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("Expected %q, got:\n%s", want, code)
+		}
+	}
+	if strings.Contains(code, "gen/sales") {
+		t.Errorf("Expected no import of the package itself, got:\n%s", code)
+	}
+
+	sql = `
+CREATE PROCEDURE TouchOrder @OrderID INT
+AS
+BEGIN
+    UPDATE Orders SET Touched = 1 WHERE OrderID = @OrderID
+END
+`
+	config = DefaultDMLConfig()
+	config.Backend = BackendGRPC
+	config.ProtoPackage = "github.com/acme/protos/orderpb"
+	config.TableToService = map[string]string{"Orders": "OrderService"}
+	config.ServiceToPackage = map[string]string{"OrderService": "ordersvc"}
+	config.PackagePaths = map[string]string{"ordersvc": "github.com/acme/protos/order/v1"}
+
+	code, err = TranspileWithDML(sql, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+	for _, want := range []string{
+		`ordersvc "github.com/acme/protos/order/v1"`,
+		"&ordersvc.UpdateOrderRequest{",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("Expected %q, got:\n%s", want, code)
+		}
+	}
+	if strings.Contains(code, "orderpb\"") {
+		t.Errorf("Expected no import of the unused proto package, got:\n%s", code)
+	}
+}
+
+func TestTranspileWithDML_Timeout(t *testing.T) {
+	sql := `
+CREATE PROCEDURE Bump @Times INT
+AS
+BEGIN
+    DECLARE @n INT = 0
+    WHILE @n < @Times
+    BEGIN
+        UPDATE Stats SET Runs = Runs + 1
+        SET @n = @n + 1
+    END
+END
+`
+	config := DefaultDMLConfig()
+	config.Timeout = 90 * time.Second
+
+	code, err := TranspileWithDML(sql, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+	for _, want := range []string{
+		"ctx, cancelTimeout := context.WithTimeout(ctx, 90*time.Second)\n\tdefer cancelTimeout()\n",
+		"for n < times {\n\t\tif err := ctx.Err(); err != nil {\n\t\t\treturn err\n\t\t}\n",
+		`r.db.ExecContext(ctx, "UPDATE Stats`,
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("Expected %q, got:\n%s", want, code)
+		}
+	}
+
+	config.Timeout = 500 * time.Millisecond
+	config.TimeoutScope = TimeoutStatement
+	code, err = TranspileWithDML(sql, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+	for _, want := range []string{
+		"stmtTimeout := tsqlruntime.NewStatementTimeout(ctx, 500*time.Millisecond)",
+		"defer stmtTimeout.Stop()",
+		"stmtCtx = stmtTimeout.Next()\n\t\tresult, err := r.db.ExecContext(stmtCtx, ",
+		"if err := ctx.Err(); err != nil {",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("Expected %q, got:\n%s", want, code)
+		}
+	}
+	if strings.Contains(code, "cancelTimeout") {
+		t.Errorf("Expected no procedure deadline with statement scope, got:\n%s", code)
+	}
+}
+
+func TestTranspileWithDML_Retry(t *testing.T) {
+	sql := `
+CREATE PROCEDURE Transfer @From INT, @To INT, @Amount INT
+AS
+BEGIN
+    BEGIN TRANSACTION
+    UPDATE Accounts SET Balance = Balance - @Amount WHERE ID = @From
+    UPDATE Accounts SET Balance = Balance + @Amount WHERE ID = @To
+    COMMIT TRANSACTION
+END
+GO
+CREATE PROCEDURE RetryByHand @ID INT
+AS
+BEGIN
+    DECLARE @Retries INT = 3
+    WHILE @Retries > 0
+    BEGIN
+        BEGIN TRY
+            UPDATE Accounts SET Balance = 0 WHERE ID = @ID
+            SET @Retries = 0
+        END TRY
+        BEGIN CATCH
+            IF ERROR_NUMBER() = 1205
+                SET @Retries = @Retries - 1
+            ELSE
+                THROW
+        END CATCH
+    END
+END
+`
+	config := DefaultDMLConfig()
+	config.SQLDialect = "sqlserver"
+	config.RetryAttempts = 4
+	config.RetryOn = []string{"1222"}
+
+	result, err := TranspileWithDMLEx(sql, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDMLEx failed: %v", err)
+	}
+	code := result.Code
+	for _, want := range []string{
+		`if err := tsqlruntime.Retry(ctx, tsqlruntime.NewRetryPolicy("sqlserver", 4, 100*time.Millisecond, "1222"), func() error {`,
+		"\t\ttx, err := r.db.BeginTx(ctx, nil)\n\t\tif err != nil {\n\t\t\treturn err\n\t\t}\n\t\tdefer tx.Rollback()\n",
+		"tx.ExecContext(ctx, \"UPDATE Accounts SET Balance = Balance - @p1",
+		"\t\treturn tx.Commit()\n\t}); err != nil {\n\t\treturn err\n\t}",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("Expected %q, got:\n%s", want, code)
+		}
+	}
+	// The hand-written loop is retried as many times as it ran
+	if !strings.Contains(code, `tsqlruntime.NewRetryPolicy("sqlserver", 3, 100*time.Millisecond, "1222")`) {
+		t.Errorf("Expected the hand-written retry loop to become a Retry, got:\n%s", code)
+	}
+	if len(result.Warnings) != 0 {
+		t.Errorf("Expected no warnings, got %v", result.Warnings)
+	}
+
+	config.RetryAttempts = 0
+	code, err = TranspileWithDML(sql, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+	if strings.Count(code, "tsqlruntime.Retry(") != 1 {
+		t.Errorf("Expected only the hand-written loop retried without RetryAttempts, got:\n%s", code)
+	}
+}
+
+func TestTranspileWithDML_RetryReturn(t *testing.T) {
+	sql := `
+CREATE PROCEDURE Withdraw @Id INT, @Amount DECIMAL(10,2), @NewBal DECIMAL(10,2) OUTPUT
+AS
+BEGIN
+    BEGIN TRANSACTION
+    UPDATE Accounts SET Balance = Balance - @Amount WHERE Id = @Id
+    SELECT @NewBal = Balance FROM Accounts WHERE Id = @Id
+    IF @NewBal < 0
+    BEGIN
+        ROLLBACK TRANSACTION
+        RETURN 1
+    END
+    COMMIT TRANSACTION
+    RETURN 0
+END
+`
+	config := DefaultDMLConfig()
+	config.RetryAttempts = 3
+
+	code, err := TranspileWithDML(sql, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+	// RETURN 1 ends the retries and the procedure with its return code
+	for _, want := range []string{
+		"\t\t\treturnCode = 1\n\t\t\treturn tsqlruntime.ErrReturn\n",
+		"\t}); err == tsqlruntime.ErrReturn {\n\t\treturn newBal, returnCode, nil\n\t} else if err != nil {\n",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("Expected %q, got:\n%s", want, code)
+		}
+	}
+	if strings.Contains(code, "return nil\n\t\t}") {
+		t.Errorf("Expected RETURN not to end the closure successfully, got:\n%s", code)
+	}
+}
+
+func TestTranspileWithDML_RetryLoop(t *testing.T) {
+	sql := `
+CREATE PROCEDURE TransferFunds @From INT, @To INT, @Amount INT
+AS
+BEGIN
+    DECLARE @RetryCount INT = 0, @MaxRetries INT = 5, @Done BIT = 0
+    WHILE @RetryCount < @MaxRetries AND @Done = 0
+    BEGIN
+        BEGIN TRY
+            BEGIN TRANSACTION
+            UPDATE Accounts SET Balance = Balance - @Amount WHERE ID = @From
+            UPDATE Accounts SET Balance = Balance + @Amount WHERE ID = @To
+            COMMIT TRANSACTION
+            SET @Done = 1
+        END TRY
+        BEGIN CATCH
+            IF @@TRANCOUNT > 0 ROLLBACK TRANSACTION
+            IF ERROR_NUMBER() = 1205 AND @RetryCount < @MaxRetries - 1
+            BEGIN
+                SET @RetryCount = @RetryCount + 1
+                WAITFOR DELAY '00:00:00.250'
+            END
+            ELSE
+                THROW
+        END CATCH
+    END
+END
+GO
+CREATE PROCEDURE LogsAndRetries @ID INT
+AS
+BEGIN
+    DECLARE @Retries INT = 3
+    WHILE @Retries > 0
+    BEGIN
+        BEGIN TRY
+            UPDATE Accounts SET Balance = 0 WHERE ID = @ID
+            SET @Retries = 0
+        END TRY
+        BEGIN CATCH
+            INSERT INTO ErrorLog (Number) VALUES (ERROR_NUMBER())
+            IF ERROR_NUMBER() = 1205
+                SET @Retries = @Retries - 1
+            ELSE
+                THROW
+        END CATCH
+    END
+END
+`
+	result, err := TranspileWithDMLEx(sql, "main", DefaultDMLConfig())
+	if err != nil {
+		t.Fatalf("TranspileWithDMLEx failed: %v", err)
+	}
+	code := result.Code
+	for _, want := range []string{
+		"// WHILE loop retrying deadlocks (ERROR_NUMBER() = 1205), 5 attempts\n",
+		`if err := tsqlruntime.Retry(ctx, tsqlruntime.NewRetryPolicy("postgres", 5, 250*time.Millisecond), func() error {`,
+		"\t\tdefer tx.Rollback()\n",
+		"\t\treturn tx.Commit()\n\t}); err != nil {\n\t\treturn err\n\t}",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("Expected %q, got:\n%s", want, code)
+		}
+	}
+	if strings.Contains(code, "done = true") {
+		t.Errorf("Expected the statement ending the loop to be dropped, got:\n%s", code)
+	}
+
+	// A CATCH doing more than deciding to retry is left as a loop
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "LogsAndRetries: WHILE loop retries deadlocks") {
+		t.Errorf("Expected a warning about the loop left as written, got %v", result.Warnings)
+	}
+}
+
+func TestTranspileWithDML_TryCatchErrors(t *testing.T) {
+	sql := `
+CREATE PROCEDURE ProcessOrder @OrderID INT, @Status NVARCHAR(20) OUTPUT
+AS
+BEGIN
+    DECLARE @Qty INT
+    BEGIN TRY
+        SELECT @Qty = Quantity FROM Orders WHERE OrderID = @OrderID
+        IF @Qty > 100
+        BEGIN
+            SET @Status = 'too large'
+            RETURN 1
+        END
+        UPDATE Orders SET Status = 'processed' WHERE OrderID = @OrderID
+    END TRY
+    BEGIN CATCH
+        SET @Status = ERROR_MESSAGE()
+        THROW
+    END CATCH
+    RETURN 0
+END
+GO
+CREATE PROCEDURE Sweep
+AS
+BEGIN
+    DECLARE @i INT = 0
+    WHILE @i < 10
+    BEGIN
+        SET @i = @i + 1
+        BEGIN TRY
+            DELETE FROM Items WHERE Batch = @i
+            IF @@ROWCOUNT = 0 BREAK
+        END TRY
+        BEGIN CATCH
+            PRINT 'failed'
+        END CATCH
+    END
+END
+`
+	config := DefaultDMLConfig()
+	config.TryCatchMode = TryCatchErrors
+	result, err := TranspileWithDML(sql, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+	for _, want := range []string{
+		"\t// BEGIN TRY\n\tvar qtyNull sql.NullInt32\n\tvar result sql.Result\n\tvar tryErr1 error\n\t{\n\t\terr = r.db.QueryRowContext(",
+		"\t\t\ttryErr1 = err\n\t\t\tgoto catch1\n",
+		// RETURN leaves the procedure, not just the TRY block
+		"\t\t\treturn status, 1, nil\n",
+		"\t}\ncatch1:\n\tif tryErr1 != nil {\n",
+		"status = tryErr1.Error()",
+		"return status, 0, tryErr1 // THROW (rethrow)",
+		// BREAK leaves the loop around the TRY block
+		"\t\t\tif rowsAffected == 0 {\n\t\t\t\tbreak\n",
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("Expected %q, got:\n%s", want, result)
+		}
+	}
+	if strings.Contains(result, "func() error") {
+		t.Errorf("Expected no closures, got:\n%s", result)
+	}
+}
+
+func TestTranspileWithDML_TryCatchErrorsTransaction(t *testing.T) {
+	sql := `
+CREATE PROCEDURE Transfer @From INT, @To INT, @Amount DECIMAL(10,2)
+AS
+BEGIN
+    BEGIN TRY
+        BEGIN TRANSACTION
+        UPDATE Accounts SET Balance = Balance - @Amount WHERE Id = @From
+        UPDATE Accounts SET Balance = Balance + @Amount WHERE Id = @To
+        COMMIT TRANSACTION
+    END TRY
+    BEGIN CATCH
+        ROLLBACK TRANSACTION
+        THROW
+    END CATCH
+END
+`
+	config := DefaultDMLConfig()
+	config.TryCatchMode = TryCatchErrors
+	result, err := TranspileWithDML(sql, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+	for _, want := range []string{
+		// The CATCH rolls back the transaction the TRY began
+		"\t// BEGIN TRY\n\tvar tx *sql.Tx\n\tvar result sql.Result\n\tvar tryErr1 error\n\t{\n",
+		"\t\ttx, err = r.db.BeginTx(ctx, nil)\n",
+		"\t\tresult, err = tx.ExecContext(",
+		"catch1:\n\tif tryErr1 != nil {\n",
+		"\t\ttx.Rollback()\n",
+		"return tryErr1 // THROW (rethrow)",
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("Expected %q, got:\n%s", want, result)
+		}
+	}
+	for _, unwanted := range []string{"tx, err :=", "result, err :=", "\"fmt\""} {
+		if strings.Contains(result, unwanted) {
+			t.Errorf("Did not expect %q, got:\n%s", unwanted, result)
+		}
+	}
+}
+
+func TestTranspileWithDML_Goto(t *testing.T) {
+	sql := `
+CREATE PROCEDURE Transfer @From INT, @To INT, @Amount DECIMAL(10,2)
+AS
+BEGIN
+    DECLARE @Tries INT = 0
+    IF @Amount <= 0 GOTO Invalid
+Again:
+    SET @Tries = @Tries + 1
+    UPDATE Accounts SET Balance = Balance - @Amount WHERE Id = @From
+    IF @@ROWCOUNT = 0
+    BEGIN
+        IF @Tries < 3 GOTO Again
+        GOTO Failed
+    END
+    DECLARE @Note NVARCHAR(50) = 'moved'
+    UPDATE Accounts SET Balance = Balance + @Amount, Note = @Note WHERE Id = @To
+    RETURN 0
+Invalid:
+    PRINT 'invalid amount'
+Failed:
+    RETURN -1
+Unused:
+    RETURN -2
+END
+`
+	result, err := TranspileWithDML(sql, "main", DefaultDMLConfig())
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+	for _, want := range []string{
+		"\t\tgoto invalid\n",
+		"\nagain:\n\ttries = tries + 1\n",
+		"\t\t\tgoto again\n",
+		"\t\tgoto failed\n",
+		"\ninvalid:\n",
+		"\nfailed:\n\treturn -1, nil\n",
+		"// Unused: (no GOTO jumps here)",
+		// The declarations GOTO Invalid jumps over are moved up
+		"\tvar result sql.Result\n",
+		"\tvar note string\n",
+		"\tresult, err = r.db.ExecContext(",
+		"\tnote = \"moved\"\n",
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("Expected %q, got:\n%s", want, result)
+		}
+	}
+
+	for sql, want := range map[string]string{
+		`CREATE PROCEDURE P AS BEGIN GOTO Nowhere END`: "there is no label Nowhere",
+		`CREATE PROCEDURE P AS
+BEGIN
+    BEGIN TRY
+        GOTO Done
+    END TRY
+    BEGIN CATCH
+        PRINT 'failed'
+    END CATCH
+Done:
+    RETURN 0
+END`: "GOTO Done can't leave a TRY block",
+	} {
+		_, err := TranspileWithDML(sql, "main", DefaultDMLConfig())
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error %q, got %v", want, err)
+		}
+	}
+}
+
+func TestTranspileWithDML_PrintLogging(t *testing.T) {
+	sql := `
+CREATE PROCEDURE PurgeLogs
+AS
+BEGIN
+    DECLARE @Batch INT = 0, @Started DATETIME = GETDATE()
+    WHILE @Batch < 10
+    BEGIN
+        DELETE FROM Logs WHERE Archived = 1
+        SET @Batch = @Batch + 1
+        PRINT 'Batch ' + CAST(@Batch AS VARCHAR(10)) + ' since ' + CONVERT(VARCHAR(30), @Started, 120)
+        PRINT CONCAT('Batch ', @Batch, ' done')
+        RAISERROR('Deleted batch %d', 0, 1, @Batch) WITH NOWAIT
+        PRINT @Batch
+    END
+    RAISERROR('Purge failed', 16, 1)
+END
+`
+	config := DefaultDMLConfig()
+	config.UseSPLogger = true
+	result, err := TranspileWithDML(sql, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+	for _, want := range []string{
+		`spLogger.LogMessage(ctx, "PurgeLogs", ((("Batch " + fmt.Sprintf("%v", batch)) + " since ") + tsqlruntime.FormatDateTime(started, 120)))`,
+		`spLogger.LogMessage(ctx, "PurgeLogs", ("Batch " + fmt.Sprint(batch) + " done"))`,
+		// Informational RAISERROR carries on
+		`spLogger.LogMessage(ctx, "PurgeLogs", fmt.Sprintf("Deleted batch %d", batch))`,
+		`spLogger.LogMessage(ctx, "PurgeLogs", fmt.Sprint(batch))`,
+		`return fmt.Errorf("Purge failed")`,
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("Expected %q, got:\n%s", want, result)
+		}
+	}
+
+	// Without the SPLogger messages still go to stdout
+	result, err = TranspileWithDML(sql, "main", DefaultDMLConfig())
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+	if !strings.Contains(result, `fmt.Println(fmt.Sprintf("Deleted batch %d", batch))`) {
+		t.Errorf("Expected informational RAISERROR to print, got:\n%s", result)
+	}
+
+	config.PrintMode = PrintSlog
+	result, err = TranspileWithDML(sql, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+	for _, want := range []string{
+		`slog.InfoContext(ctx, fmt.Sprintf("Deleted batch %d", batch))`,
+		`slog.InfoContext(ctx, fmt.Sprint(batch))`,
+		`"log/slog"`,
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("Expected %q, got:\n%s", want, result)
+		}
+	}
+
+	config.PrintMode = PrintDiscard
+	result, err = TranspileWithDML(sql, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+	if strings.Contains(result, "LogMessage") || !strings.Contains(result, "// PRINT @Batch (discarded)") {
+		t.Errorf("Expected PRINT to be discarded, got:\n%s", result)
+	}
+}
+
+func TestTranspileWithDML_Otel(t *testing.T) {
+	sql := `
+CREATE PROCEDURE usp_GetOrder @OrderID INT
+AS
+BEGIN
+    UPDATE Orders SET Viewed = 1 WHERE OrderID = @OrderID
+END
+`
+	config := DefaultDMLConfig()
+	config.Otel = true
+
+	code, err := TranspileWithDML(sql, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+	for _, want := range []string{
+		"\tctx, span := tsqlruntime.StartSpan(ctx, r.tracer, \"usp_GetOrder\")\n\tdefer func() { span.End(err) }()\n",
+		"tsqlruntime.TracedExecContext(ctx, r.tracer, r.db, \"UPDATE Orders SET Viewed = $1",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("Expected %q, got:\n%s", want, code)
+		}
+	}
+
+	config.Backend = BackendGRPC
+	code, err = TranspileWithDML(sql, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+	for _, want := range []string{
+		"\tvar rpcCtx context.Context\n\tvar rpcSpan tsqlruntime.Span\n",
+		"\trpcCtx, rpcSpan = tsqlruntime.StartRPCSpan(ctx, r.tracer, \"UpdateOrder\")\n\tresp, err := r.db.UpdateOrder(rpcCtx, &",
+		"\t})\n\trpcSpan.End(err)\n",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("Expected %q, got:\n%s", want, code)
+		}
+	}
+
+	config.Otel = false
+	code, err = TranspileWithDML(sql, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+	if strings.Contains(code, "Span") {
+		t.Errorf("Expected no spans without Otel, got:\n%s", code)
+	}
+}
+
+func TestTranspileWithDML_MultiRowSelect(t *testing.T) {
+	sql := `
+CREATE PROCEDURE ListUsersByStatus
+    @IsActive BIT
+AS
+BEGIN
+    SELECT ID, Username, Email
+    FROM Users
+    WHERE IsActive = @IsActive;
+END
+`
+
+	config := DefaultDMLConfig()
+	config.SQLDialect = "postgres"
+
+	result, err := TranspileWithDML(sql, "users", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+
+	t.Logf("Generated code:\n%s", result)
+
+	// Multi-row SELECT should use QueryContext and rows iteration
+	if !strings.Contains(result, "QueryContext") {
+		t.Error("Expected QueryContext for multi-row SELECT")
+	}
+	if !strings.Contains(result, "rows.Next()") {
+		t.Error("Expected rows.Next() for multi-row iteration")
+	}
+	if !strings.Contains(result, "rows.Close()") {
+		t.Error("Expected rows.Close() for cleanup")
+	}
+}
+
+func TestTranspileWithDML_Cursor(t *testing.T) {
+	sql := `
+CREATE PROCEDURE ProcessAllUsers
+AS
+BEGIN
+    DECLARE @UserID INT
+    DECLARE @Email VARCHAR(255)
+    
+    DECLARE user_cursor CURSOR FOR
+        SELECT ID, Email FROM Users WHERE IsActive = 1
+    
+    OPEN user_cursor
+    FETCH NEXT FROM user_cursor INTO @UserID, @Email
+    
+    WHILE @@FETCH_STATUS = 0
+    BEGIN
+        PRINT @Email
+        FETCH NEXT FROM user_cursor INTO @UserID, @Email
+    END
+    
+    CLOSE user_cursor
+    DEALLOCATE user_cursor
+END
+`
+
+	config := DefaultDMLConfig()
+	config.SQLDialect = "postgres"
+
+	result, err := TranspileWithDML(sql, "users", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+
+	t.Logf("Generated code:\n%s", result)
+
+	// Should have QueryContext for cursor
+	if !strings.Contains(result, "QueryContext") {
+		t.Error("Expected QueryContext for cursor OPEN")
+	}
+	// Should have rows.Next() loop
+	if !strings.Contains(result, "userCursorRows.Next()") {
+		t.Error("Expected userCursorRows.Next() for WHILE @@FETCH_STATUS loop")
+	}
+	// Should have Scan with cursor variables
+	if !strings.Contains(result, "Scan(&userId, &email)") {
+		t.Error("Expected Scan(&userId, &email) for FETCH INTO")
+	}
+	// Should have defer rows.Close()
+	if !strings.Contains(result, "defer userCursorRows.Close()") {
+		t.Error("Expected defer userCursorRows.Close()")
+	}
+}
+
+func TestTranspileWithDML_CursorWithProcessing(t *testing.T) {
+	sql := `
+CREATE PROCEDURE UpdateAllPrices
+    @Multiplier DECIMAL(5,2)
+AS
+BEGIN
+    DECLARE @ProductID INT
+    DECLARE @CurrentPrice DECIMAL(18,2)
+    
+    DECLARE price_cursor CURSOR FOR
+        SELECT ID, Price FROM Products
+    
+    OPEN price_cursor
+    FETCH NEXT FROM price_cursor INTO @ProductID, @CurrentPrice
+    
+    WHILE @@FETCH_STATUS = 0
+    BEGIN
+        UPDATE Products 
+        SET Price = @CurrentPrice * @Multiplier
+        WHERE ID = @ProductID
+        
+        FETCH NEXT FROM price_cursor INTO @ProductID, @CurrentPrice
+    END
+    
+    CLOSE price_cursor
+    DEALLOCATE price_cursor
+END
+`
+
+	config := DefaultDMLConfig()
+	config.SQLDialect = "postgres"
+
+	result, err := TranspileWithDML(sql, "products", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+
+	t.Logf("Generated code:\n%s", result)
+
+	// Should have UPDATE inside the loop
+	if !strings.Contains(result, "ExecContext") {
+		t.Error("Expected ExecContext for UPDATE inside cursor loop")
+	}
+	// Should have rows iteration
+	if !strings.Contains(result, ".Next()") {
+		t.Error("Expected .Next() for cursor iteration")
+	}
+}
+
+func TestTranspileWithDML_ScrollCursor(t *testing.T) {
+	sql := `
+CREATE PROCEDURE LastOrders
+    @CustomerID INT,
+    @N INT
+AS
+BEGIN
+    DECLARE @OrderID INT, @Count INT = 0
+    DECLARE order_cursor CURSOR SCROLL FOR
+        SELECT OrderID FROM Orders WHERE CustomerID = @CustomerID ORDER BY OrderID
+
+    OPEN order_cursor
+    FETCH LAST FROM order_cursor INTO @OrderID
+
+    WHILE @@FETCH_STATUS = 0 AND @Count < @N
+    BEGIN
+        SET @Count = @Count + 1
+        FETCH PRIOR FROM order_cursor INTO @OrderID
+    END
+
+    FETCH ABSOLUTE 2 FROM order_cursor INTO @OrderID
+    CLOSE order_cursor
+    DEALLOCATE order_cursor
+END
+`
+	result, err := TranspileWithDMLEx(sql, "main", DefaultDMLConfig())
+	if err != nil {
+		t.Fatalf("TranspileWithDMLEx failed: %v", err)
+	}
+	for _, want := range []string{
+		"fetchStatus := int32(-1)",
+		`orderCursorCursor, err := tsqlruntime.OpenScrollCursor(ctx, r.db, "order_cursor", "SELECT OrderID FROM Orders WHERE (CustomerID = $1) ORDER BY OrderID ASC", customerId)`,
+		"row, status := orderCursorCursor.FetchLast()",
+		"orderId = int32(row[0].AsInt())",
+		"fetchStatus = int32(status)",
+		"for fetchStatus == 0 && count < n {",
+		"row, status := orderCursorCursor.FetchPrior()",
+		"row, status := orderCursorCursor.FetchAbsolute(int(2))",
+	} {
+		if !strings.Contains(result.Code, want) {
+			t.Errorf("Expected %q, got:\n%s", want, result.Code)
+		}
+	}
+	if strings.Contains(result.Code, ".Next()") {
+		t.Errorf("Expected no rows.Next() loop for a scrolled cursor, got:\n%s", result.Code)
+	}
+	if !strings.Contains(strings.Join(result.Warnings, "\n"), "cursor order_cursor is fetched other than NEXT, so OPEN buffers all of its rows in memory") {
+		t.Errorf("Expected a memory warning, got %v", result.Warnings)
+	}
+}
+
+func TestTranspileWithDML_NestedCursors(t *testing.T) {
+	sql := `
+CREATE PROCEDURE MarkOrders
+AS
+BEGIN
+    DECLARE @CustomerID INT, @OrderID INT
+    DECLARE cust CURSOR FOR SELECT CustomerID FROM Customers
+    OPEN cust
+    FETCH NEXT FROM cust INTO @CustomerID
+    WHILE @@FETCH_STATUS = 0
+    BEGIN
+        DECLARE ord CURSOR FOR SELECT OrderID FROM Orders WHERE CustomerID = @CustomerID
+        OPEN ord
+        FETCH NEXT FROM ord INTO @OrderID
+        WHILE @@FETCH_STATUS = 0
+        BEGIN
+            UPDATE Orders SET Seen = 1 WHERE OrderID = @OrderID
+            FETCH NEXT FROM ord INTO @OrderID
+        END
+        CLOSE ord
+        DEALLOCATE ord
+        FETCH NEXT FROM cust INTO @CustomerID
+    END
+    CLOSE cust
+    DEALLOCATE cust
+END
+`
+	result, err := TranspileWithDML(sql, "main", DefaultDMLConfig())
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+	outer := strings.Index(result, "for custRows.Next() {")
+	inner := strings.Index(result, "for ordRows.Next() {")
+	if outer < 0 || inner < outer {
+		t.Fatalf("Expected the ord loop inside the cust loop, got:\n%s", result)
+	}
+	for _, want := range []string{
+		"custRows.Scan(&customerId)",
+		"ordRows.Scan(&orderId)",
+		// ord is opened on every iteration, so CLOSE closes it there
+		"// CLOSE ord\n\t\tordRows.Close()",
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("Expected %q, got:\n%s", want, result)
+		}
+	}
+}
+
+func TestTranspileWithDML_WhereCurrentOf(t *testing.T) {
+	sql := `
+CREATE PROCEDURE DoublePrices
+AS
+BEGIN
+    DECLARE @Price DECIMAL(10,2)
+    DECLARE price_cursor CURSOR FOR SELECT Price FROM Products p WHERE Active = 1
+    OPEN price_cursor
+    FETCH NEXT FROM price_cursor INTO @Price
+    WHILE @@FETCH_STATUS = 0
+    BEGIN
+        UPDATE Products SET Price = @Price * 2 WHERE CURRENT OF price_cursor
+        FETCH NEXT FROM price_cursor INTO @Price
+    END
+    CLOSE price_cursor
+    DEALLOCATE price_cursor
+END
+`
+	config := DefaultDMLConfig()
+	config.KeyColumns = map[string][]string{"dbo.Products": {"ProductID"}}
+
+	result, err := TranspileWithDML(sql, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+	for _, want := range []string{
+		`"SELECT Price, p.ProductID FROM Products AS p WHERE (Active = 1)"`,
+		"var priceCursorKeyProductId any",
+		"priceCursorRows.Scan(&price, &priceCursorKeyProductId)",
+		`"UPDATE Products SET Price = $1 WHERE ProductID = $2", price.Mul(decimal.NewFromInt(2)), priceCursorKeyProductId)`,
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("Expected %q, got:\n%s", want, result)
+		}
+	}
+
+	// Without a known key the UPDATE would change every row
+	_, err = TranspileWithDML(sql, "main", DefaultDMLConfig())
+	if err == nil || !strings.Contains(err.Error(), "no key is known for Products") {
+		t.Errorf("Expected an error for an unknown key, got %v", err)
+	}
+}
+
+func TestTranspileWithDML_AppLocks(t *testing.T) {
+	sql := `
+CREATE PROCEDURE RunNightly
+    @Batch NVARCHAR(50)
+AS
+BEGIN
+    DECLARE @rc INT
+    EXEC @rc = sp_getapplock @Resource = 'nightly', @LockMode = 'Exclusive', @LockTimeout = 5000
+    IF @rc < 0
+        RETURN 1
+    EXEC sp_getapplock @Batch, 'Shared'
+    UPDATE Jobs SET Status = 'running' WHERE Batch = @Batch
+    EXEC sp_releaseapplock @Resource = 'nightly'
+    RETURN 0
+END
+`
+	config := DefaultDMLConfig()
+	config.SQLDialect = "mysql"
+	result, err := TranspileWithDML(sql, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+	for _, want := range []string{
+		`appLocks := tsqlruntime.NewAppLocks(r.db, "mysql")`,
+		"defer appLocks.ReleaseAll()",
+		`if status, err := appLocks.Get(ctx, "nightly", "Exclusive", 5000*time.Millisecond); err != nil {`,
+		"rc = status",
+		`if _, err := appLocks.Get(ctx, batch, "Shared", -1); err != nil {`,
+		`if _, err := appLocks.Release(ctx, "nightly"); err != nil {`,
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("Expected %q, got:\n%s", want, result)
+		}
+	}
+
+	// Without a database the locks are held in the process
+	config = DefaultDMLConfig()
+	config.Backend = BackendMock
+	result, err = TranspileWithDML(sql, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+	if !strings.Contains(result, `appLocks := tsqlruntime.NewAppLocks(nil, "")`) {
+		t.Errorf("Expected in-process locks, got:\n%s", result)
+	}
+}
+
+func TestTranspileWithDML_IsolationAndLockHints(t *testing.T) {
+	sql := `
+CREATE PROCEDURE ReserveStock
+    @ProductID INT
+AS
+BEGIN
+    DECLARE @Qty INT
+    SET TRANSACTION ISOLATION LEVEL SNAPSHOT
+    BEGIN TRANSACTION
+    SELECT @Qty = Quantity FROM Inventory WITH (UPDLOCK, HOLDLOCK) WHERE ProductID = @ProductID
+    UPDATE Inventory SET Quantity = @Qty - 1 WHERE ProductID = @ProductID
+    COMMIT TRANSACTION
+    SELECT j.JobID FROM Jobs j WITH (UPDLOCK, READPAST) JOIN Queues q ON q.QueueID = j.QueueID
+    SELECT Status FROM Jobs WITH (HOLDLOCK, NOWAIT)
+END
+`
+	for dialect, wants := range map[string][]string{
+		"postgres": {
+			"BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead})",
+			"WHERE (ProductID = $1) FOR UPDATE\"",
+			"ON (q.QueueID = j.QueueID) FOR UPDATE OF j SKIP LOCKED\"",
+			"FROM Jobs FOR SHARE NOWAIT\"",
+		},
+		"sqlserver": {
+			"BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSnapshot})",
+			"WHERE (ProductID = @p1)\"",
+		},
+	} {
+		config := DefaultDMLConfig()
+		config.SQLDialect = dialect
+		result, err := TranspileWithDML(sql, "main", config)
+		if err != nil {
+			t.Fatalf("%s: TranspileWithDML failed: %v", dialect, err)
+		}
+		for _, want := range wants {
+			if !strings.Contains(result, want) {
+				t.Errorf("%s: expected %q, got:\n%s", dialect, want, result)
+			}
+		}
+		if dialect == "sqlserver" && strings.Contains(result, " FOR ") {
+			t.Errorf("sqlserver: expected no locking clause, got:\n%s", result)
+		}
+	}
+}
+
+// === Verb Detection Tests ===
+
+func TestTranspileWithDML_VerbDetection_ApprovalStatus(t *testing.T) {
+	sql := `
+CREATE PROCEDURE dbo.ApproveOrder
+    @OrderId INT
+AS
+BEGIN
+    UPDATE Orders SET ApprovalStatus = 'Approved', ApprovedAt = GETDATE()
+    WHERE OrderId = @OrderId
+END
+`
+	config := DefaultDMLConfig()
+	config.Backend = BackendGRPC
+	config.StoreVar = "r.client"
+	config.ProtoPackage = "orderpb"
+
+	result, err := TranspileWithDML(sql, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+
+	// Should detect "Approve" verb from SET ApprovalStatus = 'Approved'
+	if !strings.Contains(result, "ApproveOrder") {
+		t.Errorf("Expected ApproveOrder method (verb detection), got:\n%s", result)
+	}
+
+	t.Logf("Generated code:\n%s", result)
+}
+
+func TestTranspileWithDML_VerbDetection_Certification(t *testing.T) {
+	sql := `
+CREATE PROCEDURE dbo.CertifyDocument
+    @DocumentId INT,
+    @CertifierId INT
+AS
+BEGIN
+    UPDATE Documents SET CertificationStatus = 'Certified', CertifiedBy = @CertifierId
+    WHERE DocumentId = @DocumentId
+END
+`
+	config := DefaultDMLConfig()
+	config.Backend = BackendGRPC
+	config.StoreVar = "r.client"
+	config.ProtoPackage = "docpb"
+
+	result, err := TranspileWithDML(sql, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+
+	// Should detect "Certify" verb
+	if !strings.Contains(result, "Certif") {
+		t.Errorf("Expected Certify-related method, got:\n%s", result)
+	}
+
+	t.Logf("Generated code:\n%s", result)
+}
+
+func TestTranspileWithDML_GRPCMappings_ExplicitMapping(t *testing.T) {
+	sql := `
+CREATE PROCEDURE dbo.ProcessOrder
+    @OrderId INT
+AS
+BEGIN
+    EXEC usp_ValidateOrder @OrderId
+END
+`
+	config := DefaultDMLConfig()
+	config.Backend = BackendGRPC
+	config.StoreVar = "orderClient"
+	config.ProtoPackage = "orderpb"
+	config.GRPCMappings = map[string]string{
+		"usp_ValidateOrder": "OrderService.ValidateOrder",
+	}
+
+	result, err := TranspileWithDML(sql, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+
+	// Should use explicit mapping
+	if !strings.Contains(result, "ValidateOrder") {
+		t.Errorf("Expected ValidateOrder from explicit mapping, got:\n%s", result)
+	}
+	if !strings.Contains(result, "gRPC") {
+		t.Errorf("Expected gRPC comment, got:\n%s", result)
+	}
+
+	t.Logf("Generated code:\n%s", result)
+}
+
+func TestTranspileWithDML_TableToService_Mapping(t *testing.T) {
+	sql := `
+CREATE PROCEDURE dbo.GetProductInfo
+    @ProductId INT
+AS
+BEGIN
+    SELECT ProductId, Name, Price FROM Products WHERE ProductId = @ProductId
+END
+`
+	config := DefaultDMLConfig()
+	config.Backend = BackendGRPC
+	config.ProtoPackage = "catalogpb"
+	config.TableToService = map[string]string{
+		"Products": "CatalogService",
+	}
+	config.TableToClient = map[string]string{
+		"Products": "catalogClient",
+	}
+
+	result, err := TranspileWithDML(sql, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+
+	// Should use catalogClient for Products table
+	if !strings.Contains(result, "catalogClient") {
+		t.Errorf("Expected catalogClient from TableToClient mapping, got:\n%s", result)
+	}
+
+	t.Logf("Generated code:\n%s", result)
+}
+
+func TestExtractActionVerb(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// Approval verbs
+		{"ApprovalStatus", "Approve"},
+		{"ApprovedAt", "Approve"},
+		{"ApprovedBy", "Approve"},
+		{"IsApproved", "Approve"},
+		{"RejectionReason", "Reject"},
+		{"RejectedDate", "Reject"},
+		{"DenialCode", "Deny"},
+
+		// Certification verbs
+		{"CertificationDate", "Certify"},
+		{"CertifiedBy", "Certify"},
+		{"AttestationId", "Attest"},
+
+		// Lifecycle verbs
+		{"SuspendedUntil", "Suspend"},
+		{"SuspensionReason", "Suspend"},
+		{"CancelledBy", "Cancel"},
+		{"CancellationDate", "Cancel"},
+		{"TerminatedAt", "Terminate"},
+		{"TerminationReason", "Terminate"},
+		{"CompletedDate", "Complete"},
+		{"CompletionStatus", "Complete"},
+		{"ActivatedAt", "Activate"},
+		{"DeactivatedBy", "Deactivate"},
+
+		// Communication verbs
+		{"NotificationSent", "Notify"},
+		{"NotifiedAt", "Notify"},
+		{"AlertTriggered", "Alert"},
+
+		// Validation verbs
+		{"VerificationCode", "Verify"},
+		{"ValidatedBy", "Validate"},
+		{"ValidationStatus", "Validate"},
+
+		// Calculation verbs
+		{"CalculatedAmount", "Calculate"},
+		{"ComputedTotal", "Compute"},
+		{"EstimatedValue", "Estimate"},
+
+		// Signing verbs
+		{"SignedAt", "Sign"},
+		{"SignatureId", "Sign"},
+		{"CountersignedBy", "Countersign"},
+
+		// Review verbs
+		{"ReviewedBy", "Review"},
+		{"AssessmentScore", "Assess"},
+		{"AuditTrailId", "Audit"},
+
+		// Escalation verbs
+		{"EscalatedTo", "Escalate"},
+		{"EscalationLevel", "Escalate"},
+		{"DelegatedBy", "Delegate"},
+
+		// Transfer verbs
+		{"TransferredAt", "Transfer"},
+		{"SubmittedDate", "Submit"},
+		{"SubmissionId", "Submit"},
+
+		// Negative cases - no verb detected
+		{"ProductName", ""},
+		{"UserId", ""},
+		{"CreatedAt", ""},          // Create is CRUD, not action verb
+		{"UpdatedBy", ""},          // Update is CRUD, not action verb
+		{"OrderTotal", ""},
+		{"CustomerEmail", ""},
+		{"Price", ""},
+		{"Quantity", ""},
+		{"Description", ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			result := extractActionVerb(tc.input)
+			if result != tc.expected {
+				t.Errorf("extractActionVerb(%q) = %q, want %q", tc.input, result, tc.expected)
+			}
+		})
+	}
+}
+
+func TestInferProtoPackage(t *testing.T) {
+	tests := []struct {
+		serviceName string
+		expected    string
+	}{
+		{"CatalogService", "catalogpb"},
+		{"OrderService", "orderpb"},
+		{"UserAccountService", "useraccountpb"},
+		{"InventorySvc", "inventorypb"},
+		{"PaymentAPI", "paymentpb"},
+		{"ShippingApi", "shippingpb"},
+		{"Catalog", "catalogpb"},
+		{"Orders", "orderspb"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.serviceName, func(t *testing.T) {
+			result := inferProtoPackage(tc.serviceName)
+			if result != tc.expected {
+				t.Errorf("inferProtoPackage(%q) = %q, want %q", tc.serviceName, result, tc.expected)
+			}
+		})
+	}
+}
+
+func TestTranspileWithDML_ServiceToPackageInference(t *testing.T) {
+	sql := `
+CREATE PROCEDURE dbo.GetProductDetails
+    @ProductId INT
+AS
+BEGIN
+    SELECT ProductId, Name, Price FROM Products WHERE ProductId = @ProductId
+END
+`
+	config := DefaultDMLConfig()
+	config.Backend = BackendGRPC
+	// No explicit ProtoPackage - should infer from service name
+	config.TableToService = map[string]string{
+		"Products": "CatalogService",
+	}
+
+	result, err := TranspileWithDML(sql, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+
+	// Should infer catalogpb from CatalogService
+	if !strings.Contains(result, "catalogpb") {
+		t.Errorf("Expected inferred catalogpb package, got:\n%s", result)
+	}
+
+	t.Logf("Generated code:\n%s", result)
+}
+
+func TestTranspileWithDML_VerbDetection_Suspend(t *testing.T) {
+	sql := `
+CREATE PROCEDURE dbo.SuspendAccount
+    @AccountId INT,
+    @Reason VARCHAR(500)
+AS
+BEGIN
+    UPDATE Accounts SET SuspendedAt = GETDATE(), SuspensionReason = @Reason
+    WHERE AccountId = @AccountId
+END
+`
+	config := DefaultDMLConfig()
+	config.Backend = BackendGRPC
+	config.StoreVar = "r.client"
+	config.ProtoPackage = "accountpb"
+
+	result, err := TranspileWithDML(sql, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+
+	// Should detect "Suspend" verb from SuspendedAt column
+	if !strings.Contains(result, "SuspendAccount") {
+		t.Errorf("Expected SuspendAccount method (verb detection), got:\n%s", result)
+	}
+
+	t.Logf("Generated code:\n%s", result)
+}
+
+func TestTranspileWithDML_VerbsFile(t *testing.T) {
+	verbs, err := ParseVerbs(`# verbs
+add:
+  - Liquidate: liquidated, liquidation
+  Amortize
+remove:
+  - Sign
+`)
+	if err != nil {
+		t.Fatalf("ParseVerbs failed: %v", err)
+	}
+	sql := `
+CREATE PROCEDURE dbo.CloseLoan
+    @LoanId INT
+AS
+BEGIN
+    UPDATE Loans SET LiquidatedAt = GETDATE() WHERE LoanId = @LoanId
+    UPDATE Contracts SET SignedAt = GETDATE() WHERE LoanId = @LoanId
+    UPDATE Installments SET AmortizeMonthly = 1 WHERE LoanId = @LoanId
+END
+`
+	config := DefaultDMLConfig()
+	config.Backend = BackendGRPC
+	config.StoreVar = "r.client"
+	config.ProtoPackage = "loanpb"
+	config.Verbs = verbs
+
+	result, err := TranspileWithDML(sql, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+	for _, want := range []string{"LiquidateLoan(", "UpdateContract(", "AmortizeInstallment("} {
+		if !strings.Contains(result, want) {
+			t.Errorf("expected %q, got:\n%s", want, result)
+		}
+	}
+
+	for _, bad := range []string{
+		"  Liquidate\n",
+		"verbs:\n  Liquidate\n",
+		"add:\n  liquidate\n",
+		"add:\n  Liquidate: Liquidated\n",
+		"remove:\n  Sign: signed\n",
+		"add:\n  - - Liquidate\n",
+	} {
+		if _, err := ParseVerbs(bad); err == nil {
+			t.Errorf("ParseVerbs(%q): expected an error", bad)
+		}
+	}
+}
+
+func TestTranspileWithDML_VerbDetection_Escalate(t *testing.T) {
+	sql := `
+CREATE PROCEDURE dbo.EscalateTicket
+    @TicketId INT,
+    @EscalatedTo INT
+AS
+BEGIN
+    UPDATE Tickets SET EscalationLevel = EscalationLevel + 1, EscalatedTo = @EscalatedTo
+    WHERE TicketId = @TicketId
+END
+`
+	config := DefaultDMLConfig()
+	config.Backend = BackendGRPC
+	config.StoreVar = "r.client"
+	config.ProtoPackage = "ticketpb"
+
+	result, err := TranspileWithDML(sql, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+
+	// Should detect "Escalate" verb from EscalationLevel or EscalatedTo
+	if !strings.Contains(result, "Escalate") {
+		t.Errorf("Expected Escalate-related method, got:\n%s", result)
+	}
+
+	t.Logf("Generated code:\n%s", result)
+}
+
+func TestTranspileWithDML_VerbDetection_Notify(t *testing.T) {
+	sql := `
+CREATE PROCEDURE dbo.SendNotification
+    @UserId INT,
+    @Message VARCHAR(1000)
+AS
+BEGIN
+    INSERT INTO Notifications (UserId, Message, NotificationSent, NotifiedAt)
+    VALUES (@UserId, @Message, 1, GETDATE())
+END
+`
+	config := DefaultDMLConfig()
+	config.Backend = BackendGRPC
+	config.StoreVar = "r.client"
+	config.ProtoPackage = "notifypb"
+
+	result, err := TranspileWithDML(sql, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+
+	// Should detect "Notify" verb from NotificationSent or NotifiedAt columns
+	if !strings.Contains(result, "Notify") {
+		t.Errorf("Expected Notify-related method, got:\n%s", result)
+	}
+
+	t.Logf("Generated code:\n%s", result)
+}
+
+func TestTranspileWithDML_Script(t *testing.T) {
+	sql := `
+DECLARE @Cutoff DATETIME = DATEADD(DAY, -30, GETDATE())
+GO
+DELETE FROM Sessions WHERE LastSeen < @Cutoff
+GO
+CREATE PROCEDURE usp_Touch @ID INT
+AS
+BEGIN
+    UPDATE Sessions SET LastSeen = GETDATE() WHERE ID = @ID
+END
+`
+	script := sql[:strings.Index(sql, "CREATE PROCEDURE")]
+	if _, err := TranspileWithDML(script, "main", DefaultDMLConfig()); err == nil || !strings.Contains(err.Error(), "--script") {
+		t.Fatalf("Expected a no procedures error suggesting --script, got %v", err)
+	}
+
+	config := DefaultDMLConfig()
+	config.ScriptName = "nightly_cleanup"
+	code, err := TranspileWithDML(sql, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+	for _, want := range []string{
+		"func (r *Repository) NightlyCleanup(ctx context.Context) (err error) {",
+		"var cutoff time.Time",
+		"\"DELETE FROM Sessions WHERE LastSeen < $1\", cutoff)",
+		"func (r *Repository) UspTouch(ctx context.Context, id int32) (err error) {",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("Expected %q, got:\n%s", want, code)
+		}
+	}
+	if strings.Index(code, "NightlyCleanup") > strings.Index(code, "UspTouch") {
+		t.Errorf("Expected the script function first, got:\n%s", code)
+	}
+}
+
+func TestTranspileWithDML_Activity(t *testing.T) {
+	body := ` @N INT, @Total INT OUTPUT
+AS
+BEGIN
+    SET @Total = 0
+    WHILE @Total < @N
+    BEGIN
+        WAITFOR DELAY '00:00:01.5'
+        SET @Total = @Total + 1
+    END
+    WAITFOR TIME '22:30'
+END
+`
+	result, err := TranspileWithDML("-- tgpiler:activity\nCREATE PROCEDURE Spin"+body, "main", DefaultDMLConfig())
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+	for _, want := range []string{
+		"func (r *Repository) Spin(ctx context.Context, n int32) (total int32, err error) {",
+		"for total < n {\n\t\tif err := tsqlruntime.Heartbeat(ctx); err != nil {\n\t\t\treturn total, err\n\t\t}",
+		"if err := tsqlruntime.Sleep(ctx, 1500*time.Millisecond); err != nil {\n\t\t\treturn total, err\n\t\t}",
+		"tsqlruntime.Sleep(ctx, tsqlruntime.Until(1350*time.Minute))",
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("Expected %q, got:\n%s", want, result)
+		}
+	}
+
+	// Without the pragma, loops don't heartbeat
+	result, err = TranspileWithDML("CREATE PROCEDURE Spin"+body, "main", DefaultDMLConfig())
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+	if strings.Contains(result, "Heartbeat") || !strings.Contains(result, "tsqlruntime.Sleep(ctx, ") {
+		t.Errorf("Expected WAITFOR sleeps and no heartbeat, got:\n%s", result)
+	}
+
+	if _, err := TranspileWithDML("CREATE PROCEDURE Wait AS WAITFOR DELAY 'soon'", "main", DefaultDMLConfig()); err == nil {
+		t.Error("Expected an error for an invalid WAITFOR DELAY")
+	}
+}
+
+func TestTranspileWithDML_NullMode(t *testing.T) {
+	source := `CREATE TYPE dbo.Lines AS TABLE (Sku NVARCHAR(20) NOT NULL, Note NVARCHAR(100) NULL)
+GO
+CREATE PROCEDURE dbo.GetCustomers
+    @CustomerID INT,
+    @Region NVARCHAR(20) = NULL,
+    @Lines dbo.Lines READONLY
+AS
+BEGIN
+    IF @Region IS NULL
+        SET @Region = 'EU'
+    SELECT CustomerID, Email FROM Customers WHERE Region = @Region AND CustomerID = @CustomerID
+END
+`
+	tests := []struct {
+		mode string
+		want []string
+	}{
+		{"sqlnull", []string{
+			"Note sql.NullString",
+			"GetCustomers(ctx context.Context, customerId int32, region sql.NullString, lines []Lines)",
+			"if !region.Valid {\n\t\tregion = sql.NullString{String: \"EU\", Valid: true}\n\t}",
+			"var email sql.NullString",
+			"rows.Scan(&customerId2, &email)",
+		}},
+		{"pointer", []string{
+			"Note *string",
+			"GetCustomers(ctx context.Context, customerId int32, region *string, lines []Lines)",
+			"if region == nil {\n\t\tregion = tsqlruntime.Ptr(\"EU\")\n\t}",
+			"var email *string",
+			"rows.Scan(&customerId2, &email)",
+		}},
+		{"", []string{
+			"Note *string",
+			"GetCustomers(ctx context.Context, customerId int32, region string, lines []Lines)",
+			"var emailNull sql.NullString",
+		}},
+		{"zero", []string{
+			"Note string",
+			"region string",
+		}},
+	}
+	for _, tt := range tests {
+		config := DefaultDMLConfig()
+		config.NullMode = tt.mode
+		result, err := TranspileWithDML(source, "main", config)
+		if err != nil {
+			t.Fatalf("%s: TranspileWithDML failed: %v", tt.mode, err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(result, want) {
+				t.Errorf("%s: expected %q, got:\n%s", tt.mode, want, result)
+			}
+		}
+	}
+}
+
+func TestTranspileWithDML_NullConditions(t *testing.T) {
+	source := `CREATE PROCEDURE dbo.Classify
+    @Name NVARCHAR(50) = NULL,
+    @Fallback NVARCHAR(50),
+    @Qty INT = NULL,
+    @Amount DECIMAL(10,2),
+    @Since DATETIME
+AS
+BEGIN
+    DECLARE @Label NVARCHAR(50)
+    DECLARE @N BIGINT
+    IF @Qty BETWEEN 1 AND 10
+        SET @Label = 'few'
+    IF @Qty < 3 OR @Qty <> 5
+        SET @Label = 'some'
+    IF @Amount NOT BETWEEN 1.5 AND 100
+        SET @Label = 'odd'
+    IF @Since BETWEEN '2024-01-01' AND '2024-12-31 23:59:59'
+        SET @Label = 'recent'
+    IF @Name IS NOT NULL
+        SET @Label = COALESCE(@Name, @Fallback, 'none')
+    SET @N = COALESCE(@Qty, @N, 0)
+END
+`
+	tests := []struct {
+		mode string
+		want []string
+	}{
+		{"sqlnull", []string{
+			"if qty.Valid && (qty.Int32 >= 1 && qty.Int32 <= 10) {",
+			"if (qty.Valid && qty.Int32 < 3) || (qty.Valid && qty.Int32 != 5) {",
+			"if name.Valid {",
+			`label = func() string { if name.Valid { return name.String }; return fallback }()`,
+			`n = func() int64 { if qty.Valid { return int64(qty.Int32) }; return n }()`,
+		}},
+		{"pointer", []string{
+			"if qty != nil && (tsqlruntime.Deref(qty) >= 1 && tsqlruntime.Deref(qty) <= 10) {",
+			"if (qty != nil && tsqlruntime.Deref(qty) < 3) || (qty != nil && tsqlruntime.Deref(qty) != 5) {",
+			"if name != nil {",
+			`label = func() string { if name != nil { return tsqlruntime.Deref(name) }; return fallback }()`,
+		}},
+		{"", []string{
+			"if qty >= 1 && qty <= 10 {",
+			"if qty < 3 || qty != 5 {",
+			`if name != "" {`,
+			`label = tsqlruntime.Coalesce(name, fallback, "none")`,
+			"n = tsqlruntime.Coalesce(int64(qty), n, 0)",
+		}},
+	}
+	for _, tt := range tests {
+		config := DefaultDMLConfig()
+		config.NullMode = tt.mode
+		result, err := TranspileWithDML(source, "main", config)
+		if err != nil {
+			t.Fatalf("%s: TranspileWithDML failed: %v", tt.mode, err)
+		}
+		for _, want := range append(tt.want,
+			"if amount.LessThan(decimal.RequireFromString(\"1.5\")) || amount.GreaterThan(decimal.NewFromInt(100)) {",
+			"if !since.Before(time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)) && !since.After(time.Date(2024, time.December, 31, 23, 59, 59, 0, time.UTC)) {",
+		) {
+			if !strings.Contains(result, want) {
+				t.Errorf("%s: expected %q, got:\n%s", tt.mode, want, result)
+			}
+		}
+	}
+}
+
+func TestTranspileWithDML_DecimalMode(t *testing.T) {
+	source := `CREATE PROCEDURE dbo.ApplyDiscount
+    @Rate DECIMAL(5,2),
+    @Total DECIMAL(10,2) OUTPUT
+AS
+BEGIN
+    DECLARE @Qty INT = 3
+    SET @Total = @Total * (1 - @Rate / 100) + @Qty
+    IF @Total > 1000.50
+        SET @Total = ROUND(@Total, 1)
+END
+`
+	tests := []struct {
+		mode string
+		want []string
+	}{
+		{"", []string{
+			"rate decimal.Decimal) (total decimal.Decimal)",
+			"total = total.Mul(decimal.NewFromInt(1).Sub(rate.Div(decimal.NewFromInt(100)))).Add(decimal.NewFromInt(int64(qty)))",
+			"if total.GreaterThan(decimal.RequireFromString(\"1000.5\")) {",
+		}},
+		{"string", []string{
+			"rate string) (total string)",
+			"total = tsqlruntime.DecimalAdd(tsqlruntime.DecimalMul(total, tsqlruntime.DecimalSub(\"1\", tsqlruntime.DecimalDiv(rate, \"100\"))), strconv.FormatInt(int64(qty), 10))",
+			"if tsqlruntime.DecimalCmp(total, \"1000.5\") > 0 {",
+			"total = tsqlruntime.DecimalRound(total, 1)",
+		}},
+		{"float", []string{
+			"rate float64) (total float64)",
+			"total = (total * (1 - (rate / 100))) + float64(qty)",
+			"if total > 1000.5 {",
+		}},
+		{"apd", []string{
+			"\"github.com/cockroachdb/apd/v3\"",
+			"rate apd.Decimal) (total apd.Decimal)",
+			"apd.BaseContext.WithPrecision(38).Quo(&d, &x, &y)",
+			"if func(x, y apd.Decimal) int { return x.Cmp(&y) }(total, *apd.New(10005, -1)) > 0 {",
+		}},
+	}
+	for _, tt := range tests {
+		config := DefaultDMLConfig()
+		config.DecimalMode = tt.mode
+		result, err := TranspileWithDMLEx(source, "main", config)
+		if err != nil {
+			t.Fatalf("%s: TranspileWithDMLEx failed: %v", tt.mode, err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(result.Code, want) {
+				t.Errorf("%s: expected %q, got:\n%s", tt.mode, want, result.Code)
+			}
+		}
+		if tt.mode != "" && strings.Contains(result.Code, "shopspring") {
+			t.Errorf("%s: expected no shopspring/decimal import, got:\n%s", tt.mode, result.Code)
+		}
+		if warned := len(result.Warnings) > 0; warned != (tt.mode == "float") {
+			t.Errorf("%s: warnings = %v", tt.mode, result.Warnings)
+		}
+	}
+}
+
+func TestTranspileWithDML_UnusedVarsSorted(t *testing.T) {
+	source := `CREATE PROCEDURE dbo.Touch @ID INT
+AS
+BEGIN
+    DECLARE @Zeta INT, @Alpha INT, @Mid INT, @Beta INT, @Omega INT
+    UPDATE Customers SET Touched = 1 WHERE CustomerID = @ID
+END
+`
+	want := "_ = alpha\n\t_ = beta\n\t_ = err\n\t_ = mid\n\t_ = omega\n\t_ = result\n\t_ = zeta\n"
+	for i := 0; i < 10; i++ {
+		result, err := TranspileWithDMLEx(source, "main", DefaultDMLConfig())
+		if err != nil {
+			t.Fatalf("TranspileWithDMLEx failed: %v", err)
+		}
+		if !strings.Contains(result.Code, want) {
+			t.Fatalf("expected the unused variables in order, got:\n%s", result.Code)
+		}
+	}
+}
+
+func TestTranspileWithDML_MixedSelectAssignment(t *testing.T) {
+	source := `CREATE PROCEDURE dbo.GetName @ID INT
+AS
+BEGIN
+    DECLARE @Name NVARCHAR(50)
+    SELECT @Name = Name, Email, CreatedAt FROM Customers WHERE CustomerID = @ID
+END
+`
+	result, err := TranspileWithDMLEx(source, "main", DefaultDMLConfig())
+	if err != nil {
+		t.Fatalf("TranspileWithDMLEx failed: %v", err)
+	}
+	for _, want := range []string{
+		"// Not assigned to a variable, dropped: Email, CreatedAt",
+		`QueryRowContext(ctx, "SELECT Name FROM Customers WHERE (CustomerID = $1)", id).Scan(&nameNull)`,
+	} {
+		if !strings.Contains(result.Code, want) {
+			t.Errorf("Expected %q, got:\n%s", want, result.Code)
+		}
+	}
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "also returns Email, CreatedAt") {
+		t.Errorf("Warnings = %v", result.Warnings)
+	}
+}
+
+func TestTranspileWithDML_SelectIntoVarsNull(t *testing.T) {
+	source := `CREATE PROCEDURE dbo.GetCustomer @ID INT, @Region NVARCHAR(20) = NULL OUTPUT
+AS
+BEGIN
+    DECLARE @Name NVARCHAR(50), @Limit INT
+    SELECT @Name = Name, @Limit = CreditLimit, @Region = Region FROM Customers WHERE CustomerID = @ID
+    SELECT @Limit = CreditLimit FROM Customers WHERE CustomerID = @ID + 1
+END
+`
+	config := DefaultDMLConfig()
+	config.NullMode = NullSQL
+	result, err := TranspileWithDMLEx(source, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDMLEx failed: %v", err)
+	}
+	for _, want := range []string{
+		"var nameNull sql.NullString\n\tvar limitNull sql.NullInt32\n",
+		// The nullable parameter keeps NULL by itself
+		".Scan(&nameNull, &limitNull, &region)",
+		"if err == nil {\n\t\tname = nameNull.String\n\t\tlimit = limitNull.Int32\n\t}",
+		".Scan(&limitNull2)",
+		"limit = limitNull2.Int32",
+	} {
+		if !strings.Contains(result.Code, want) {
+			t.Errorf("expected %q, got:\n%s", want, result.Code)
+		}
+	}
+}
+
+func TestTranspileWithDML_TimeZones(t *testing.T) {
+	source := `CREATE PROCEDURE dbo.OrderTimes
+    @OrderID INT,
+    @Placed DATETIMEOFFSET
+AS
+BEGIN
+    DECLARE @Now SMALLDATETIME = GETDATE()
+    DECLARE @Local DATETIMEOFFSET = @Placed AT TIME ZONE 'Pacific Standard Time'
+    DECLARE @Shifted DATETIMEOFFSET = SWITCHOFFSET(@Placed, '-08:00')
+    SELECT Total, CreatedAt AT TIME ZONE 'UTC' AT TIME ZONE 'Pacific Standard Time' AS LocalCreated
+    FROM Orders WHERE OrderID = @OrderID AND CreatedAt < GETDATE()
+END
+`
+	tests := []struct {
+		dialect  string
+		timeMode string
+		want     []string
+		warns    bool
+	}{
+		{"postgres", "", []string{
+			"var now time.Time = tsqlruntime.SmallDateTime(time.Now())",
+			"tsqlruntime.AtTimeZone(placed, \"Pacific Standard Time\")",
+			"tsqlruntime.SwitchOffset(placed, \"-08:00\")",
+			"CreatedAt AT TIME ZONE 'UTC' AT TIME ZONE 'America/Los_Angeles' AS LocalCreated",
+			"CreatedAt < NOW()",
+		}, false},
+		{"postgres", "utc", []string{
+			"tsqlruntime.SmallDateTime(time.Now().UTC())",
+			"CreatedAt < (NOW() AT TIME ZONE 'UTC')",
+		}, false},
+		{"mysql", "utc", []string{
+			"CONVERT_TZ(CreatedAt, 'UTC', 'America/Los_Angeles') AS LocalCreated",
+			"CreatedAt < UTC_TIMESTAMP()",
+		}, false},
+		{"sqlserver", "utc", []string{
+			"CreatedAt AT TIME ZONE 'UTC' AT TIME ZONE 'Pacific Standard Time' AS LocalCreated",
+			"CreatedAt < SYSUTCDATETIME()",
+		}, false},
+		{"sqlite", "", []string{
+			"CreatedAt AT TIME ZONE 'UTC'",
+		}, true},
+	}
+	for _, tt := range tests {
+		config := DefaultDMLConfig()
+		config.SQLDialect = tt.dialect
+		config.TimeMode = tt.timeMode
+		result, err := TranspileWithDMLEx(source, "main", config)
+		if err != nil {
+			t.Fatalf("%s/%s: TranspileWithDMLEx failed: %v", tt.dialect, tt.timeMode, err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(result.Code, want) {
+				t.Errorf("%s/%s: expected %q, got:\n%s", tt.dialect, tt.timeMode, want, result.Code)
+			}
+		}
+		if warned := len(result.Warnings) > 0; warned != tt.warns {
+			t.Errorf("%s/%s: warnings = %v", tt.dialect, tt.timeMode, result.Warnings)
+		}
+	}
+}
+
+func TestTranspileWithDML_DateFunctions(t *testing.T) {
+	source := `CREATE PROCEDURE dbo.OrderDates
+    @Since DATETIME,
+    @Months INT,
+    @Pattern NVARCHAR(20)
+AS
+BEGIN
+    DECLARE @Due DATETIME = DATEADD(MONTH, @Months, @Since)
+    DECLARE @Soon DATETIME = DATEADD(DAY, 7, @Since)
+    DECLARE @Week INT = DATEPART(WEEK, @Due)
+    DECLARE @Label NVARCHAR(50) = DATENAME(MONTH, @Due) + ' ' + FORMAT(@Due, 'yyyy-MM-dd')
+    DECLARE @Custom NVARCHAR(50) = FORMAT(@Due, @Pattern)
+    DECLARE @Days INT = DATEDIFF(DAY, @Since, @Due)
+    SELECT Total, DATEDIFF(day, OrderDate, GETDATE()) AS Age, FORMAT(OrderDate, 'dd/MM/yyyy') AS Shown,
+           EOMONTH(OrderDate) AS MonthEnd
+    FROM Orders
+    WHERE OrderDate >= DATEADD(MONTH, -@Months, @Since) AND DATEPART(QUARTER, OrderDate) = 2
+END
+`
+	tests := []struct {
+		dialect string
+		want    []string
+	}{
+		{"postgres", []string{
+			"var due time.Time = tsqlruntime.DateAdd(\"month\", int(months), since)",
+			"var soon time.Time = since.AddDate(0, 0, 7)",
+			"var week int32 = tsqlruntime.DatePart(\"week\", due)",
+			"((due.Month().String() + \" \") + due.Format(\"2006-01-02\"))",
+			"tsqlruntime.FormatDate(due, pattern)",
+			"var days int32 = tsqlruntime.DateDiff(\"day\", since, due)",
+			"(NOW()::date - OrderDate::date) AS Age",
+			"TO_CHAR(OrderDate, 'DD/MM/YYYY') AS Shown",
+			"(DATE_TRUNC('month', OrderDate) + INTERVAL '1 month' - INTERVAL '1 day')::date AS MonthEnd",
+			"OrderDate >= ($1::timestamp + (- $2) * INTERVAL '1 month')",
+			"EXTRACT(QUARTER FROM OrderDate)::int = 2",
+		}},
+		{"mysql", []string{
+			"DATEDIFF(NOW(), OrderDate) AS Age",
+			"DATE_FORMAT(OrderDate, '%d/%m/%Y') AS Shown",
+			"LAST_DAY(OrderDate) AS MonthEnd",
+			"OrderDate >= DATE_ADD(?, INTERVAL (- ?) MONTH)",
+			"QUARTER(OrderDate) = 2",
+		}},
+		{"sqlite", []string{
+			"strftime('%d/%m/%Y', OrderDate) AS Shown",
+			"date(OrderDate, 'start of month', '+1 month', '-1 day') AS MonthEnd",
+			"OrderDate >= datetime(?, (- ?) || ' months')",
+			"datetime('now', 'localtime')",
+		}},
+		{"sqlserver", []string{
+			"DATEDIFF(day, OrderDate, GETDATE()) AS Age",
+			"FORMAT(OrderDate, 'dd/MM/yyyy') AS Shown",
+			"EOMONTH(OrderDate) AS MonthEnd",
+		}},
+	}
+	for _, tt := range tests {
+		config := DefaultDMLConfig()
+		config.SQLDialect = tt.dialect
+		result, err := TranspileWithDMLEx(source, "main", config)
+		if err != nil {
+			t.Fatalf("%s: TranspileWithDMLEx failed: %v", tt.dialect, err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(result.Code, want) {
+				t.Errorf("%s: expected %q, got:\n%s", tt.dialect, want, result.Code)
+			}
+		}
+		if len(result.Warnings) > 0 {
+			t.Errorf("%s: unexpected warnings: %v", tt.dialect, result.Warnings)
+		}
+	}
+
+	// A format that isn't a literal can't be translated for the dialect
+	untranslatable := strings.Replace(source, "'dd/MM/yyyy'", "@Pattern", 1)
+	config := DefaultDMLConfig()
+	config.SQLDialect = "postgres"
+	result, err := TranspileWithDMLEx(untranslatable, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDMLEx failed: %v", err)
+	}
+	if len(result.Warnings) == 0 || !strings.Contains(result.Warnings[0], "FORMAT") {
+		t.Errorf("expected a FORMAT warning, got %v", result.Warnings)
+	}
+}
+
+func TestTranspileWithDML_DateDiffVariables(t *testing.T) {
+	// The rewrites use operands twice, and the later one first
+	source := `CREATE PROCEDURE dbo.OrderAges
+    @From DATETIME,
+    @To DATETIME
+AS
+BEGIN
+    SELECT OrderID, DATEDIFF(month, OrderDate, @From) AS Months
+    FROM Orders
+    WHERE DATEDIFF(week, @From, @To) > 2 AND DATEDIFF(quarter, @To, OrderDate) = 0
+END
+`
+	tests := []struct {
+		dialect string
+		want    []string
+	}{
+		{"postgres", []string{
+			"EXTRACT(MONTH FROM $1::timestamp) - EXTRACT(MONTH FROM OrderDate)",
+			"($2::timestamp::date - EXTRACT(DOW FROM $2::timestamp)::int) - ($1::timestamp::date",
+			`::int = 0))", from, to)`,
+		}},
+		{"mysql", []string{
+			"((YEAR(?) - YEAR(OrderDate)) * 12 + MONTH(?) - MONTH(OrderDate)) AS Months",
+			"((DATEDIFF(?, ?) + DAYOFWEEK(?) - DAYOFWEEK(?)) DIV 7) > 2",
+			`QUARTER(?)) = 0))", from, from, to, from, from, to, to, to)`,
+		}},
+		{"sqlite", []string{
+			"CAST(strftime('%Y', ?) AS INTEGER) - CAST(strftime('%Y', OrderDate) AS INTEGER)) * 12",
+			`julianday(date(?, '-' || strftime('%w', ?) || ' days')) - julianday(date(?, '-' || strftime('%w', ?) || ' days'))`,
+			`AS INTEGER) + 2) / 3) = 0))", from, from, to, to, from, from, to, to)`,
+		}},
+	}
+	for _, tt := range tests {
+		config := DefaultDMLConfig()
+		config.SQLDialect = tt.dialect
+		code, err := TranspileWithDML(source, "main", config)
+		if err != nil {
+			t.Fatalf("%s: TranspileWithDML failed: %v", tt.dialect, err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(code, want) {
+				t.Errorf("%s: expected %q, got:\n%s", tt.dialect, want, code)
+			}
+		}
+		if problems := checkPlaceholders(code, tt.dialect); len(problems) > 0 {
+			t.Errorf("%s: placeholder problems: %v", tt.dialect, problems)
+		}
+	}
+}
+
+func TestTranspileWithDML_NoLockStrategy(t *testing.T) {
+	source := `CREATE PROCEDURE dbo.GetOpenOrders
+    @CustomerID INT
+AS
+BEGIN
+    SELECT o.OrderID, o.Total FROM Orders o WITH (NOLOCK)
+    INNER JOIN Customers AS c WITH (READUNCOMMITTED, ROWLOCK) ON c.CustomerID = o.CustomerID
+    WHERE o.CustomerID = @CustomerID
+    UPDATE Customers SET LastSeen = 1 WHERE CustomerID IN (SELECT CustomerID FROM Orders WITH (NOLOCK))
+END
+`
+	tests := []struct {
+		strategy string
+		dialect  string
+		want     []string
+		warnings int
+	}{
+		{NoLockComment, "postgres", []string{
+			"// Orders (NOLOCK), Customers (READUNCOMMITTED) removed: reads committed data only",
+			"// Orders (NOLOCK) removed: reads committed data only",
+		}, 3},
+		{NoLockReadUncommitted, "sqlserver", []string{
+			"// Orders (NOLOCK), Customers (READUNCOMMITTED): read uncommitted, in a transaction of its own",
+			"if tx, err := r.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadUncommitted, ReadOnly: true}); err != nil {",
+			"defer nolockTx1.Rollback()",
+			"nolockTx1.QueryRowContext(ctx, \"SELECT o.OrderID, o.Total FROM Orders AS o INNER JOIN Customers AS c",
+			"// Orders (NOLOCK) removed: reads committed data only",
+		}, 1},
+		{NoLockReadUncommitted, "postgres", []string{
+			"// Orders (NOLOCK), Customers (READUNCOMMITTED) removed: reads committed data only",
+		}, 3},
+		{NoLockIgnore, "postgres", nil, 0},
+	}
+	for _, tt := range tests {
+		config := DefaultDMLConfig()
+		config.SQLDialect = tt.dialect
+		config.NoLockStrategy = tt.strategy
+		result, err := TranspileWithDMLEx(source, "main", config)
+		if err != nil {
+			t.Fatalf("%s/%s: TranspileWithDMLEx failed: %v", tt.strategy, tt.dialect, err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(result.Code, want) {
+				t.Errorf("%s/%s: expected %q, got:\n%s", tt.strategy, tt.dialect, want, result.Code)
+			}
+		}
+		if strings.Contains(result.Code, "NOLOCK)") && tt.strategy == NoLockIgnore {
+			t.Errorf("%s/%s: expected no NOLOCK annotations, got:\n%s", tt.strategy, tt.dialect, result.Code)
+		}
+		if strings.Contains(result.Code, "WITH (") {
+			t.Errorf("%s/%s: expected the hints stripped, got:\n%s", tt.strategy, tt.dialect, result.Code)
+		}
+		if len(result.Warnings) != tt.warnings {
+			t.Errorf("%s/%s: expected %d warnings, got %v", tt.strategy, tt.dialect, tt.warnings, result.Warnings)
+		}
+	}
+}
+
+func TestTranspileWithDML_StringFunctions(t *testing.T) {
+	source := `CREATE PROCEDURE dbo.FormatCodes
+    @Code NVARCHAR(50),
+    @Ids NVARCHAR(MAX),
+    @Width INT
+AS
+BEGIN
+    DECLARE @Masked NVARCHAR(50) = STUFF(@Code, 2, 3, '***')
+    DECLARE @Tail NVARCHAR(10) = RIGHT(@Code, @Width)
+    DECLARE @Dash INT = CHARINDEX('-', @Code)
+    DECLARE @Next INT = CHARINDEX('-', @Code, @Dash + 1)
+    DECLARE @Digit INT = PATINDEX('%[0-9]%', @Code)
+    DECLARE @Pad NVARCHAR(50) = REPLICATE('0', @Width) + REPLICATE('-', 3)
+    DECLARE @Msg NVARCHAR(200) = FORMATMESSAGE('Code %s is %d wide', QUOTENAME(@Code), @Width)
+    SELECT p.ProductID, STUFF(p.Code, 1, 2, 'X') AS Hidden, CHARINDEX('-', p.Code) AS Hyphen,
+           REPLICATE('*', 3) AS Starred, QUOTENAME(p.Name) AS Bracketed
+    FROM Products p
+    INNER JOIN STRING_SPLIT(@Ids, ',') s ON s.value = p.ProductID
+    WHERE p.Code IN (SELECT value FROM STRING_SPLIT(@Code, ';', 1))
+END
+`
+	goCode := []string{
+		`masked := strfn.Stuff(code, 2, 3, "***")`,
+		`tail := strfn.Right(code, int(width))`,
+		`var dash int32 = strfn.CharIndex("-", code)`,
+		`strfn.CharIndex("-", code, int((dash + 1)))`,
+		`strfn.PatIndex("%[0-9]%", code)`,
+		`(strfn.Replicate("0", int(width)) + strings.Repeat("-", 3))`,
+		`strfn.FormatMessage("Code %s is %d wide", strfn.QuoteName(code), width)`,
+	}
+	tests := []struct {
+		dialect string
+		want    []string
+	}{
+		{"postgres", []string{
+			"OVERLAY(p.Code PLACING 'X' FROM 1 FOR 2) AS Hidden",
+			"STRPOS(p.Code, '-') AS Hyphen",
+			"REPEAT('*', 3) AS Starred",
+			"'[' || REPLACE(p.Name, ']', ']]') || ']' AS Bracketed",
+			"INNER JOIN unnest(string_to_array($1, ',')) AS s(value) ON",
+			"FROM unnest(string_to_array($2, ';')) WITH ORDINALITY AS string_split(value, ordinal)",
+		}},
+		{"mysql", []string{
+			"INSERT(p.Code, 1, 2, 'X') AS Hidden",
+			"LOCATE('-', p.Code) AS Hyphen",
+			"CONCAT('[', REPLACE(p.Name, ']', ']]'), ']') AS Bracketed",
+			`'$[*]' COLUMNS (value TEXT PATH '$')) AS s ON`,
+			`COLUMNS (value TEXT PATH '$', ordinal FOR ORDINALITY)) AS string_split`,
+		}},
+		{"sqlite", []string{
+			"(substr(p.Code, 1, 1 - 1) || 'X' || substr(p.Code, 1 + 2)) AS Hidden",
+			"instr(p.Code, '-') AS Hyphen",
+			"replace(hex(zeroblob(3)), '00', '*') AS Starred",
+			`'\"]') AS s ON`,
+			"(SELECT value, key + 1 AS ordinal FROM json_each(",
+		}},
+		{"sqlserver", []string{
+			"STUFF(p.Code, 1, 2, 'X') AS Hidden",
+			"INNER JOIN STRING_SPLIT(@p1, ',') AS s ON",
+		}},
+	}
+	for _, tt := range tests {
+		config := DefaultDMLConfig()
+		config.SQLDialect = tt.dialect
+		result, err := TranspileWithDMLEx(source, "main", config)
+		if err != nil {
+			t.Fatalf("%s: TranspileWithDMLEx failed: %v", tt.dialect, err)
+		}
+		for _, want := range append(goCode, tt.want...) {
+			if !strings.Contains(result.Code, want) {
+				t.Errorf("%s: expected %q, got:\n%s", tt.dialect, want, result.Code)
+			}
+		}
+		if len(result.Warnings) > 0 {
+			t.Errorf("%s: unexpected warnings: %v", tt.dialect, result.Warnings)
+		}
+	}
+
+	// Message numbers refer to sys.messages
+	numbered := strings.Replace(source, "'Code %s is %d wide'", "50001", 1)
+	if _, err := TranspileWithDMLEx(numbered, "main", DefaultDMLConfig()); err == nil || !strings.Contains(err.Error(), "sys.messages") {
+		t.Errorf("expected a sys.messages error, got %v", err)
+	}
+}
+
+func TestTranspileWithDML_ForXML(t *testing.T) {
+	source := `CREATE PROCEDURE dbo.PostTags
+    @PostID INT,
+    @List NVARCHAR(MAX) OUTPUT
+AS
+BEGIN
+    SET @List = STUFF((SELECT ', ' + t.Name FROM Tags t WHERE t.PostID = @PostID ORDER BY t.Name FOR XML PATH('')), 1, 2, '')
+    DECLARE @Typed NVARCHAR(MAX) = STUFF((SELECT ',' + t.Name FROM Tags t WHERE t.PostID = @PostID FOR XML PATH(''), TYPE).value('.', 'NVARCHAR(MAX)'), 1, 1, '')
+    DECLARE @Xml NVARCHAR(MAX) = (SELECT t.TagID, t.Name FROM Tags t WHERE t.PostID = @PostID FOR XML RAW('tag'), ROOT('tags'))
+    SELECT p.PostID AS PID, STUFF((SELECT ';' + t.Name FROM Tags t WHERE t.PostID = p.PostID FOR XML PATH('')), 1, 1, '') AS TagList
+    FROM Posts p WHERE p.PostID = @PostID
+END
+`
+	tests := []struct {
+		dialect  string
+		want     []string
+		warnings int
+	}{
+		{"postgres", []string{
+			// Statements return the query's error
+			"if v, err := tsqlruntime.ReadScalarString(ctx, r.db, \"SELECT STRING_AGG(t.Name, ', ' ORDER BY t.Name ASC) FROM Tags AS t WHERE (t.PostID = $1)\", postId); err != nil {\n\t\treturn list, err\n\t} else {\n\t\tlist = v\n\t}",
+			`"SELECT STRING_AGG(t.Name, ',') FROM Tags AS t WHERE (t.PostID = $1)"`,
+			"var xml string\n\tif v, err := tsqlruntime.ReadForXML(ctx, r.db, tsqlruntime.ForXMLOptions{Mode: tsqlruntime.ForXMLRaw, ElementName: \"tag\", RootName: \"tags\"}, \"SELECT t.TagID, t.Name FROM Tags AS t WHERE (t.PostID = $1)\", postId); err != nil {",
+			"(SELECT STRING_AGG(t.Name, ';') FROM Tags AS t WHERE (t.PostID = p.PostID)) AS TagList",
+		}, 1},
+		{"mysql", []string{
+			`"SELECT GROUP_CONCAT(t.Name ORDER BY t.Name ASC SEPARATOR ', ') FROM Tags AS t WHERE (t.PostID = ?)"`,
+			"(SELECT GROUP_CONCAT(t.Name SEPARATOR ';') FROM Tags AS t WHERE (t.PostID = p.PostID)) AS TagList",
+		}, 1},
+		{"sqlite", []string{
+			`"SELECT group_concat(t.Name, ', ' ORDER BY t.Name ASC) FROM Tags AS t WHERE (t.PostID = ?)"`,
+			"(SELECT group_concat(t.Name, ';') FROM Tags AS t WHERE (t.PostID = p.PostID)) AS TagList",
+		}, 1},
+		{"sqlserver", []string{
+			`"SELECT STRING_AGG(t.Name, ', ') WITHIN GROUP (ORDER BY t.Name ASC) FROM Tags AS t WHERE (t.PostID = @p1)"`,
+			`if v, err := tsqlruntime.ReadScalarString(ctx, r.db, "SELECT t.TagID, t.Name FROM Tags AS t WHERE (t.PostID = @p1) FOR XML RAW('tag'), ROOT('tags')", postId); err != nil {`,
+		}, 0},
+	}
+	for _, tt := range tests {
+		config := DefaultDMLConfig()
+		config.SQLDialect = tt.dialect
+		result, err := TranspileWithDMLEx(source, "main", config)
+		if err != nil {
+			t.Fatalf("%s: TranspileWithDMLEx failed: %v", tt.dialect, err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(result.Code, want) {
+				t.Errorf("%s: expected %q, got:\n%s", tt.dialect, want, result.Code)
+			}
+		}
+		if strings.Contains(result.Code, "strfn.Stuff") || strings.Contains(result.Code, "XmlValueString") {
+			t.Errorf("%s: expected the STUFF and .value to be folded into the aggregate, got:\n%s", tt.dialect, result.Code)
+		}
+		if len(result.Warnings) != tt.warnings {
+			t.Errorf("%s: expected %d warnings, got %v", tt.dialect, tt.warnings, result.Warnings)
+		}
+	}
+}
+
+func TestTranspileWithDML_ForXMLOnlyQuery(t *testing.T) {
+	source := `CREATE PROCEDURE dbo.PostTags @PostID INT, @List NVARCHAR(MAX) OUTPUT
+AS
+BEGIN
+    SET @List = STUFF((SELECT ', ' + t.Name FROM Tags t WHERE t.PostID = @PostID FOR XML PATH('')), 1, 2, '')
+END
+GO
+CREATE PROCEDURE dbo.PostTagsJSON @PostID INT, @Json NVARCHAR(MAX) OUTPUT
+AS
+BEGIN
+    SET @Json = (SELECT t.Name FROM Tags t WHERE t.PostID = @PostID FOR JSON PATH)
+END
+`
+	result, err := TranspileWithDML(source, "main", DefaultDMLConfig())
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+	// The query's error is returned, so the procedures return one
+	for _, want := range []string{
+		"PostTags(ctx context.Context, postId int32) (list string, err error) {",
+		"\t\treturn list, err\n",
+		"PostTagsJson(ctx context.Context, postId int32) (json string, err error) {",
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("Expected %q, got:\n%s", want, result)
+		}
+	}
+}
+
+func TestTranspileWithDML_Constants(t *testing.T) {
+	blocks, err := ParseConstants(`# constants
+OrderStatus:
+  Approved: 'Approved'
+  Pending: N'Pending'
+ErrorCode:
+  ORDER_NOT_FOUND: 50001
+`)
+	if err != nil {
+		t.Fatalf("ParseConstants failed: %v", err)
+	}
+	code, err := GenerateConstants(blocks, "repo")
+	if err != nil {
+		t.Fatalf("GenerateConstants failed: %v", err)
+	}
+	for _, want := range []string{
+		"type OrderStatus string",
+		`OrderStatusPending  OrderStatus = "Pending"`,
+		"ErrorCodeOrderNotFound = 50001",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("expected %q in constants, got:\n%s", want, code)
+		}
+	}
+
+	source := `CREATE PROCEDURE dbo.ApproveOrder
+    @OrderID INT,
+    @Status NVARCHAR(20) OUTPUT,
+    @Code INT OUTPUT
+AS
+BEGIN
+    IF @Status = 'Pending'
+    BEGIN
+        UPDATE Orders SET Status = 'Approved' WHERE OrderID = @OrderID
+        SET @Status = 'Approved'
+    END
+    ELSE
+        SET @Code = 50001
+END
+`
+	config := DefaultDMLConfig()
+	config.Constants = blocks
+	result, err := TranspileWithDMLEx(source, "repo", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDMLEx failed: %v", err)
+	}
+	for _, want := range []string{
+		"if status == string(OrderStatusPending) {",
+		"status = string(OrderStatusApproved)",
+		"code = ErrorCodeOrderNotFound",
+		`"UPDATE Orders SET Status = $1 WHERE OrderID = $2", string(OrderStatusApproved), orderId)`,
+	} {
+		if !strings.Contains(result.Code, want) {
+			t.Errorf("expected %q, got:\n%s", want, result.Code)
+		}
+	}
+
+	for _, bad := range []string{
+		"  Approved: 'Approved'\n",
+		"OrderStatus: 'Approved'\n",
+		"OrderStatus:\n  Approved: 'Approved'\n  Code: 1\n",
+		"OrderStatus:\n  Approved: Approved\n",
+		"Empty:\n",
+	} {
+		if _, err := ParseConstants(bad); err == nil {
+			t.Errorf("ParseConstants(%q): expected an error", bad)
+		}
+	}
+}
+
+func TestTranspileWithDML_NamingConfig(t *testing.T) {
+	naming, err := ParseNamingConfig(`# naming
+words:
+  - obtener
+  - pedido
+  cliente
+  destino
+acronyms:
+  - ID
+  - URL
+overrides:
+  tbl_Cli: Customer
+`)
+	if err != nil {
+		t.Fatalf("ParseNamingConfig failed: %v", err)
+	}
+	if strings.Join(naming.Words, ",") != "obtener,pedido,cliente,destino" || strings.Join(naming.Acronyms, ",") != "ID,URL" {
+		t.Errorf("unexpected words and acronyms: %+v", naming)
+	}
+	SetNamer(NewNamer(naming))
+	defer SetNamer(nil)
+
+	source := `CREATE PROCEDURE dbo.OBTENERPEDIDOCLIENTE
+    @PEDIDOID INT,
+    @URLDESTINO NVARCHAR(200) OUTPUT
+AS
+BEGIN
+    SELECT @URLDESTINO = Url FROM tbl_Cli WHERE PedidoID = @PEDIDOID
+END
+`
+	code, err := TranspileWithDML(source, "repo", DefaultDMLConfig())
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+	for _, want := range []string{
+		"ObtenerPedidoCliente(ctx context.Context, pedidoID int32) (urlDestino string, err error)",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("expected %q, got:\n%s", want, code)
+		}
+	}
+
+	for in, want := range map[string]string{"tbl_Cli": "Customer", "PEDIDOCLIENTE": "PedidoCliente", "url_cliente": "URLCliente"} {
+		if got := toPascalCase(in); got != want {
+			t.Errorf("toPascalCase(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if got := goUnexportedIdentifier("@tbl_Cli"); got != "customer" {
+		t.Errorf("goUnexportedIdentifier(@tbl_Cli) = %q, want customer", got)
+	}
+	// Names the config doesn't touch are named as before
+	if got := goExportedIdentifier("HTTPServer"); got != "HttpServer" {
+		t.Errorf("goExportedIdentifier(HTTPServer) = %q, want HttpServer", got)
+	}
+
+	for _, bad := range []string{
+		"  pedido\n",
+		"palabras:\n  pedido\n",
+		"words:\n  pedido_id\n",
+		"acronyms:\n  gRPC\n",
+		"overrides:\n  tbl_Cli: customer\n",
+		"overrides:\n  tbl_Cli: Customer\n  TBL_CLI: Client\n",
+	} {
+		if _, err := ParseNamingConfig(bad); err == nil {
+			t.Errorf("ParseNamingConfig(%q): expected an error", bad)
+		}
+	}
+}
+
+func TestTranspileWithDML_ProtoEnums(t *testing.T) {
+	source := `CREATE PROCEDURE dbo.ShipOrder
+    @OrderID INT
+AS
+BEGIN
+    UPDATE Orders SET Status = 'Shipped' WHERE OrderID = @OrderID
+    UPDATE Orders SET Status = 'Lost' WHERE OrderID = @OrderID
+END
+`
+	status := &ProtoEnum{Name: "OrderStatus", Values: map[string]string{
+		EnumKey("SHIPPED"): "OrderStatus_ORDER_STATUS_SHIPPED",
+	}}
+	config := DefaultDMLConfig()
+	config.Backend = BackendGRPC
+	config.StoreVar = "r.client"
+	config.ProtoPackage = "orderpb"
+	config.ProtoEnumFields = map[string]*ProtoEnum{EnumFieldKey("Order", "status"): status}
+
+	result, err := TranspileWithDMLEx(source, "repo", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDMLEx failed: %v", err)
+	}
+	if !strings.Contains(result.Code, "Status: orderpb.OrderStatus_ORDER_STATUS_SHIPPED,") {
+		t.Errorf("expected the enum constant for 'Shipped', got:\n%s", result.Code)
+	}
+	if !strings.Contains(result.Code, `Status: "Lost",`) {
+		t.Errorf("expected 'Lost' to be kept, got:\n%s", result.Code)
+	}
+	warned := false
+	for _, w := range result.Warnings {
+		warned = warned || strings.Contains(w, "'Lost' has no OrderStatus value")
+	}
+	if !warned {
+		t.Errorf("expected a warning for 'Lost', got %v", result.Warnings)
+	}
+}
+
+func TestTranspileWithDML_ForJSON(t *testing.T) {
+	source := `CREATE PROCEDURE dbo.CustomerOrders
+    @CustomerID INT,
+    @Json NVARCHAR(MAX) OUTPUT
+AS
+BEGIN
+    SET @Json = (SELECT OrderID, Total AS Amount FROM Orders WHERE CustomerID = @CustomerID FOR JSON PATH)
+    SELECT c.Name AS [Customer.Name], o.OrderID FROM Orders o JOIN Customers c ON c.ID = o.CustomerID
+    WHERE o.CustomerID = @CustomerID ORDER BY o.OrderID FOR JSON PATH, ROOT('orders')
+END
+`
+	tests := []struct {
+		dialect string
+		want    []string
+	}{
+		{"postgres", []string{
+			`if err := r.db.QueryRowContext(ctx, "SELECT json_strip_nulls(json_agg(json_build_object('OrderID', j.OrderID, 'Amount', j.Amount))) FROM (SELECT OrderID, Total AS Amount FROM Orders WHERE (CustomerID = $1)) AS j", customerId).Scan(tsqlruntime.Nullable(&json)); err != nil {
+		return json, err
+	}`,
+			"var jsonResult string\n",
+			`if v, err := tsqlruntime.ReadForJSON(ctx, r.db, tsqlruntime.ForJSONOptions{Mode: tsqlruntime.ForJSONPath, RootName: "orders", Columns: []string{"Customer.Name", "OrderID"}}, "SELECT c.Name AS json1, o.OrderID FROM`,
+		}},
+		{"mysql", []string{
+			`if v, err := tsqlruntime.ReadForJSON(ctx, r.db, tsqlruntime.ForJSONOptions{Mode: tsqlruntime.ForJSONPath, Columns: []string{"OrderID", "Amount"}}, "SELECT OrderID, Total AS Amount FROM Orders WHERE (CustomerID = ?)", customerId); err != nil {
+		return json, err
+	} else {
+		json = v
+	}`,
+		}},
+		{"sqlserver", []string{
+			`if err := r.db.QueryRowContext(ctx, "SELECT (SELECT OrderID, Total AS Amount FROM Orders WHERE (CustomerID = @p1) FOR JSON PATH)", customerId).Scan(tsqlruntime.Nullable(&json)); err != nil {`,
+			`"SELECT (SELECT c.Name AS [Customer.Name], o.OrderID FROM`,
+		}},
+	}
+	for _, tt := range tests {
+		config := DefaultDMLConfig()
+		config.SQLDialect = tt.dialect
+		result, err := TranspileWithDMLEx(source, "main", config)
+		if err != nil {
+			t.Fatalf("%s: TranspileWithDMLEx failed: %v", tt.dialect, err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(result.Code, want) {
+				t.Errorf("%s: expected %q, got:\n%s", tt.dialect, want, result.Code)
+			}
+		}
+		if len(result.Warnings) != 0 {
+			t.Errorf("%s: expected no warnings, got %v", tt.dialect, result.Warnings)
+		}
+	}
+}
+
+func TestTranspileWithDML_OpenJSON(t *testing.T) {
+	source := `CREATE PROCEDURE dbo.AddOrderItems
+    @OrderID INT,
+    @Items NVARCHAR(MAX)
+AS
+BEGIN
+    INSERT INTO OrderItems (OrderID, ProductID, Quantity)
+    SELECT @OrderID, ProductID, Quantity
+    FROM OPENJSON(@Items, '$.items') WITH (ProductID INT '$.id', Quantity INT '$.qty')
+END
+`
+	tests := []struct {
+		dialect string
+		backend BackendType
+		want    string
+	}{
+		{"postgres", BackendSQL, "FROM (SELECT CAST(e.value #>> '{id}' AS integer) AS ProductID, CAST(e.value #>> '{qty}' AS integer) AS Quantity " +
+			"FROM json_array_elements((CAST($2 AS json) #> '{items}')) AS e(value)) AS openjson"},
+		{"mysql", BackendSQL, "FROM JSON_TABLE(?, '$.items[*]' COLUMNS (ProductID INT PATH '$.id', Quantity INT PATH '$.qty')) AS openjson"},
+		{"sqlite", BackendSQL, "FROM (SELECT json_extract(e.value, '$.id') AS ProductID, json_extract(e.value, '$.qty') AS Quantity FROM json_each(?, '$.items') AS e) AS openjson"},
+		{"sqlserver", BackendSQL, "FROM OPENJSON(@p2, '$.items') WITH (ProductID INT '$.id', Quantity INT '$.qty')"},
+		{"postgres", BackendGRPC, `if err := tsqlruntime.OpenJSONInto(items, "$.items", &itemsRows); err != nil {`},
+	}
+	for _, tt := range tests {
+		config := DefaultDMLConfig()
+		config.SQLDialect = tt.dialect
+		config.Backend = tt.backend
+		config.ProtoPackage = "orderpb"
+		result, err := TranspileWithDMLEx(source, "main", config)
+		if err != nil {
+			t.Fatalf("%s/%s: TranspileWithDMLEx failed: %v", tt.dialect, tt.backend, err)
+		}
+		if !strings.Contains(result.Code, tt.want) {
+			t.Errorf("%s/%s: expected %q, got:\n%s", tt.dialect, tt.backend, tt.want, result.Code)
+		}
+		if tt.backend == BackendGRPC && !strings.Contains(result.Code, "&orderpb.OrderItem{ProductId: row.ProductId, Quantity: row.Quantity}") {
+			t.Errorf("expected a message per decoded row, got:\n%s", result.Code)
+		}
+	}
+}
+
+func TestTranspileWithDML_XMLMethods(t *testing.T) {
+	source := `CREATE PROCEDURE dbo.ImportOrders
+    @Doc XML,
+    @BatchID INT
+AS
+BEGIN
+    DECLARE @h INT
+    DECLARE @Count INT = @Doc.value('count(/Root/Order)', 'INT')
+    IF @Doc.exist('/Root/Order[@status="Open"]') = 1
+        PRINT 'open orders'
+    EXEC sp_xml_preparedocument @h OUTPUT, @Doc
+    INSERT INTO Orders (OrderID, Name, BatchID)
+    SELECT OrderID, Name, @BatchID FROM OPENXML(@h, '/Root/Order', 2) WITH (OrderID INT, Name NVARCHAR(50) '@name')
+    EXEC sp_xml_removedocument @h
+    INSERT INTO Lines (LineNo, Qty)
+    SELECT ROW_NUMBER() OVER (ORDER BY (SELECT NULL)), T.c.value('@qty', 'INT')
+    FROM @Doc.nodes('/Root/Line') AS T(c) WHERE T.c.exist('@qty') = 1
+END
+`
+	result, err := TranspileWithDMLEx(source, "main", DefaultDMLConfig())
+	if err != nil {
+		t.Fatalf("TranspileWithDMLEx failed: %v", err)
+	}
+	for _, want := range []string{
+		`strconv.ParseInt(strings.TrimSpace(xmlfn.Value(doc, "count(/Root/Order)")), 10, 32)`,
+		`if xmlfn.Exist(doc, "/Root/Order[@status=\"Open\"]") {`,
+		"hXML, err := xmlfn.Parse(doc)",
+		`hNodes := hXML.Nodes("/Root/Order")`,
+		`"INSERT INTO Orders (OrderID, Name, BatchID) VALUES ($1, $2, $3)"`,
+		`node.Value("@name"), batchId); err != nil {`,
+		`docNodes, err := xmlfn.Nodes(doc, "/Root/Line")`,
+		"if !(cNode.Exist(\"@qty\")) {\n\t\t\tcontinue\n\t\t}\n\t\trowNumber++",
+		`"INSERT INTO Lines (LineNo, Qty) VALUES ($1, $2)", rowNumber, func() int32`,
+	} {
+		if !strings.Contains(result.Code, want) {
+			t.Errorf("expected %q, got:\n%s", want, result.Code)
+		}
+	}
+	if strings.Contains(result.Code, "XmlValueString") || strings.Contains(result.Code, "ExecContext(ctx, \"SELECT") {
+		t.Errorf("expected the XML to be read in Go, got:\n%s", result.Code)
+	}
+
+	unprepared := strings.Replace(source, "EXEC sp_xml_preparedocument @h OUTPUT, @Doc", "", 1)
+	if _, err := TranspileWithDMLEx(unprepared, "main", DefaultDMLConfig()); err == nil || !strings.Contains(err.Error(), "sp_xml_preparedocument") {
+		t.Errorf("expected an error for OPENXML without sp_xml_preparedocument, got %v", err)
+	}
+}
+
+func TestTranspileWithDML_Pivot(t *testing.T) {
+	source := `CREATE PROCEDURE dbo.SalesByQuarter @Year INT
+AS
+BEGIN
+    SELECT ProductID, [Q1], [Q2]
+    FROM (SELECT ProductID, Quarter, Amount FROM Sales WHERE SalesYear = @Year) AS src
+    PIVOT (SUM(Amount) FOR Quarter IN ([Q1], [Q2])) AS pvt
+END
+GO
+CREATE PROCEDURE dbo.QuarterRows
+AS
+BEGIN
+    SELECT ProductID, Quarter, Amount FROM QuarterlySales UNPIVOT (Amount FOR Quarter IN ([Q1], [Q2])) AS u
+END
+`
+	tests := []struct {
+		dialect string
+		want    []string
+	}{
+		{"postgres", []string{
+			"FROM (SELECT ProductID, SUM(Amount) FILTER (WHERE Quarter = 'Q1') AS Q1, SUM(Amount) FILTER (WHERE Quarter = 'Q2') AS Q2 " +
+				"FROM (SELECT ProductID, Quarter, Amount FROM Sales WHERE (SalesYear = $1)) AS src GROUP BY ProductID) AS pvt",
+			"FROM (SELECT QuarterlySales.*, 'Q1' AS Quarter, QuarterlySales.Q1 AS Amount FROM QuarterlySales WHERE QuarterlySales.Q1 IS NOT NULL " +
+				"UNION ALL SELECT QuarterlySales.*, 'Q2' AS Quarter, QuarterlySales.Q2 AS Amount FROM QuarterlySales WHERE QuarterlySales.Q2 IS NOT NULL) AS u",
+		}},
+		{"mysql", []string{
+			"SUM(CASE WHEN Quarter = 'Q1' THEN Amount END) AS Q1, SUM(CASE WHEN Quarter = 'Q2' THEN Amount END) AS Q2",
+		}},
+		{"sqlserver", []string{
+			"AS src PIVOT (SUM(Amount) FOR Quarter IN (Q1, Q2)) AS pvt",
+			"FROM QuarterlySales UNPIVOT (Amount FOR Quarter IN (Q1, Q2)) AS u",
+		}},
+	}
+	for _, tt := range tests {
+		config := DefaultDMLConfig()
+		config.SQLDialect = tt.dialect
+		result, err := TranspileWithDMLEx(source, "main", config)
+		if err != nil {
+			t.Fatalf("%s: TranspileWithDMLEx failed: %v", tt.dialect, err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(result.Code, want) {
+				t.Errorf("%s: expected %q, got:\n%s", tt.dialect, want, result.Code)
+			}
+		}
+	}
+
+	// A table source's grouping columns come from the SELECT list, and
+	// values that aren't identifiers are quoted
+	byYear := `CREATE PROCEDURE dbo.OrdersByYear
+AS
+BEGIN
+    SELECT Region, [2024] FROM Orders PIVOT (COUNT(OrderID) FOR OrderYear IN ([2024])) AS p
+END
+`
+	result, err := TranspileWithDMLEx(byYear, "main", DefaultDMLConfig())
+	if err != nil {
+		t.Fatalf("TranspileWithDMLEx failed: %v", err)
+	}
+	want := `SELECT Region, \"2024\" FROM (SELECT Region, COUNT(OrderID) FILTER (WHERE OrderYear = 2024) AS \"2024\" FROM Orders GROUP BY Region) AS p`
+	if !strings.Contains(result.Code, want) {
+		t.Errorf("expected %q, got:\n%s", want, result.Code)
+	}
+	if !strings.Contains(strings.Join(result.Warnings, "\n"), "groups by Region from the SELECT list") {
+		t.Errorf("expected a warning about the grouping columns, got %v", result.Warnings)
+	}
+
+	config := DefaultDMLConfig()
+	config.Backend = BackendGRPC
+	result, err = TranspileWithDMLEx(source, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDMLEx failed: %v", err)
+	}
+	if !strings.Contains(strings.Join(result.Warnings, "\n"), "PIVOT has no grpc backend translation (aggregate: SUM(Amount), pivot column: Quarter, values: Q1, Q2)") ||
+		!strings.Contains(strings.Join(result.Warnings, "\n"), "UNPIVOT has no grpc backend translation (value column: Amount, name column: Quarter, columns: Q1, Q2)") {
+		t.Errorf("expected PIVOT and UNPIVOT warnings, got %v", result.Warnings)
+	}
+}
+
+func TestTranspileWithDML_Apply(t *testing.T) {
+	source := `CREATE PROCEDURE dbo.CustomerOrders @Min INT
+AS
+BEGIN
+    SELECT c.CustomerID, o.OrderID FROM Customers c
+    CROSS APPLY (SELECT OrderID FROM Orders WHERE Orders.CustomerID = c.CustomerID AND Total > @Min) AS o
+    SELECT c.CustomerID, x.Cnt FROM Customers c
+    OUTER APPLY (SELECT COUNT(*) AS Cnt FROM Orders WHERE Orders.CustomerID = c.CustomerID) AS x
+END
+`
+	tests := []struct {
+		dialect  string
+		want     []string
+		warnings int
+	}{
+		{"postgres", []string{
+			"FROM Customers AS c CROSS JOIN LATERAL (SELECT OrderID FROM Orders WHERE ((Orders.CustomerID = c.CustomerID) AND (Total > $1))) AS o",
+			"FROM Customers AS c LEFT JOIN LATERAL (SELECT COUNT(*) AS Cnt FROM Orders WHERE (Orders.CustomerID = c.CustomerID)) AS x ON TRUE",
+		}, 0},
+		{"mysql", []string{
+			"CROSS JOIN LATERAL (SELECT OrderID FROM Orders",
+			"LEFT JOIN LATERAL (SELECT COUNT(*) AS Cnt FROM Orders WHERE (Orders.CustomerID = c.CustomerID)) AS x ON TRUE",
+		}, 0},
+		{"sqlite", []string{
+			"FROM Customers AS c CROSS APPLY (SELECT OrderID",
+			`"SELECT c.CustomerID, (SELECT COUNT(*) FROM Orders WHERE (Orders.CustomerID = c.CustomerID)) FROM Customers AS c"`,
+		}, 1},
+		{"sqlserver", []string{
+			"FROM Customers AS c CROSS APPLY (SELECT OrderID",
+			"FROM Customers AS c OUTER APPLY (SELECT COUNT(*) AS Cnt",
+		}, 0},
+	}
+	for _, tt := range tests {
+		config := DefaultDMLConfig()
+		config.SQLDialect = tt.dialect
+		result, err := TranspileWithDMLEx(source, "main", config)
+		if err != nil {
+			t.Fatalf("%s: TranspileWithDMLEx failed: %v", tt.dialect, err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(result.Code, want) {
+				t.Errorf("%s: expected %q, got:\n%s", tt.dialect, want, result.Code)
+			}
+		}
+		applyWarnings := 0
+		for _, w := range result.Warnings {
+			if strings.Contains(w, "APPLY") {
+				applyWarnings++
+			}
+		}
+		if applyWarnings != tt.warnings {
+			t.Errorf("%s: expected %d APPLY warnings, got %v", tt.dialect, tt.warnings, result.Warnings)
+		}
+	}
+}
+
+func TestCheckPlaceholders(t *testing.T) {
+	code := `package main
+
+func (r *Repo) Adjust(ctx context.Context, id int32, amt int64) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE Accounts SET Balance = $1 WHERE Id = $2", amt, id)
+	_, err = r.db.ExecContext(ctx, "UPDATE Accounts SET Balance = $1 WHERE Id = $3", amt, id)
+	_, err = r.db.ExecContext(ctx, "DELETE FROM Accounts WHERE Id = $1 AND Note = '$2'", id, amt)
+	_, err = r.db.ExecContext(ctx, "DELETE FROM Accounts WHERE Id = $1", args...)
+	return err
+}
+`
+	problems := checkPlaceholders(code, "postgres")
+	if len(problems) != 2 {
+		t.Fatalf("expected 2 postgres problems, got %v", problems)
+	}
+	if !strings.Contains(problems[0], "Adjust: ") || !strings.Contains(problems[0], "uses placeholder $3 but has 2 arguments") {
+		t.Errorf("unexpected problem: %s", problems[0])
+	}
+	if !strings.Contains(problems[1], "has 2 arguments but no placeholder $2") {
+		t.Errorf("unexpected problem: %s", problems[1])
+	}
+
+	problems = checkPlaceholders(`package main
+
+func (r *Repo) Adjust(ctx context.Context, id int32, amt int64) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE Accounts SET Balance = ? WHERE Id = ?", amt, id)
+	_, err = r.db.ExecContext(ctx, "UPDATE Accounts SET Balance = ? WHERE Id = ?", amt)
+	return err
+}
+`, "mysql")
+	if len(problems) != 1 || !strings.Contains(problems[0], "has 2 placeholders but 1 arguments") {
+		t.Errorf("expected a ? count mismatch, got %v", problems)
+	}
+}
+
+func TestTranspileWithDML_RebindsPlaceholders(t *testing.T) {
+	source := `CREATE PROCEDURE dbo.Adjust @Id INT, @Amt INT, @Note VARCHAR(50)
+AS
+BEGIN
+    UPDATE Accounts SET Balance = Balance + @Amt, Note = @Note WHERE Id = @Id AND Balance > @Amt
+END
+`
+	tests := []struct {
+		dialect string
+		want    string
+	}{
+		{"postgres", `"UPDATE Accounts SET Balance = Balance + $1, Note = $2 WHERE (Id = $3 AND Balance > $4)", amt, note, id, amt`},
+		{"mysql", `"UPDATE Accounts SET Balance = Balance + ?, Note = ? WHERE (Id = ? AND Balance > ?)", amt, note, id, amt`},
+		{"sqlserver", `"UPDATE Accounts SET Balance = Balance + @p1, Note = @p2 WHERE (Id = @p3 AND Balance > @p4)", amt, note, id, amt`},
+	}
+	for _, tt := range tests {
+		config := DefaultDMLConfig()
+		config.SQLDialect = tt.dialect
+		result, err := TranspileWithDML(source, "main", config)
+		if err != nil {
+			t.Fatalf("%s: TranspileWithDML failed: %v", tt.dialect, err)
+		}
+		if !strings.Contains(result, tt.want) {
+			t.Errorf("%s: expected %s, got:\n%s", tt.dialect, tt.want, result)
+		}
+	}
+}
+
+func TestTranspileWithDML_Output(t *testing.T) {
+	source := `CREATE PROCEDURE dbo.Rename @Id INT, @Name VARCHAR(50)
+AS
+BEGIN
+    DECLARE @NewId INT
+    INSERT INTO Customers (Name) OUTPUT INSERTED.CustomerID INTO @NewId VALUES (@Name)
+    UPDATE Customers SET Name = @Name OUTPUT DELETED.Name AS OldName, INSERTED.Name AS NewName WHERE CustomerID = @Id
+    DELETE FROM Customers OUTPUT DELETED.CustomerID WHERE CustomerID = @Id
+END
+`
+	tests := []struct {
+		dialect  string
+		want     []string
+		warnings int
+	}{
+		{"postgres", []string{
+			`rows, err := r.db.QueryContext(ctx, "INSERT INTO Customers (Name) VALUES ($1) RETURNING CustomerID", name)`,
+			"if err := rows.Scan(&newId); err != nil {",
+			`"UPDATE Customers SET Name = $1 WHERE CustomerID = $2 RETURNING old.Name AS OldName, Name AS NewName", name, id)`,
+			"if err := rows.Scan(&oldNameNull, &newNameNull); err != nil {",
+			`"DELETE FROM Customers WHERE CustomerID = $1 RETURNING CustomerID", id)`,
+			"}\n\tif err := rows.Err(); err != nil {\n\t\treturn err\n\t}",
+		}, 0},
+		{"sqlserver", []string{
+			`"INSERT INTO Customers (Name) OUTPUT INSERTED.CustomerID VALUES (@p1)", name)`,
+			`"UPDATE Customers SET Name = @p1 OUTPUT DELETED.Name AS OldName, INSERTED.Name AS NewName WHERE CustomerID = @p2", name, id)`,
+			`"DELETE FROM Customers OUTPUT DELETED.CustomerID WHERE CustomerID = @p1", id)`,
+		}, 0},
+		{"sqlite", []string{
+			`"INSERT INTO Customers (Name) VALUES (?) RETURNING CustomerID", name)`,
+			`result, err := r.db.ExecContext(ctx, "UPDATE Customers SET Name = ? WHERE CustomerID = ?", name, id)`,
+			`"DELETE FROM Customers WHERE CustomerID = ? RETURNING CustomerID", id)`,
+		}, 1},
+		{"mysql", []string{
+			`result, err := r.db.ExecContext(ctx, "INSERT INTO Customers (Name) VALUES (?)", name)`,
+			`result, err = r.db.ExecContext(ctx, "DELETE FROM Customers WHERE CustomerID = ?", id)`,
+		}, 3},
+	}
+	for _, tt := range tests {
+		config := DefaultDMLConfig()
+		config.SQLDialect = tt.dialect
+		result, err := TranspileWithDMLEx(source, "main", config)
+		if err != nil {
+			t.Fatalf("%s: TranspileWithDMLEx failed: %v", tt.dialect, err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(result.Code, want) {
+				t.Errorf("%s: expected %q, got:\n%s", tt.dialect, want, result.Code)
+			}
+		}
+		outputWarnings := 0
+		for _, w := range result.Warnings {
+			if strings.Contains(w, "the statement runs without it") {
+				outputWarnings++
+			}
+		}
+		if outputWarnings != tt.warnings {
+			t.Errorf("%s: expected %d OUTPUT warnings, got %v", tt.dialect, tt.warnings, result.Warnings)
+		}
+	}
+}
+
+func TestTranspileWithDML_OutputNamedLikeParameter(t *testing.T) {
+	source := `CREATE PROCEDURE dbo.AddOrder @CustomerID INT, @Total DECIMAL(10,2) OUTPUT
+AS
+BEGIN
+    INSERT INTO Orders (CustomerID, Total) OUTPUT INSERTED.Total VALUES (@CustomerID, 10.5)
+    SELECT CustomerID FROM Orders WHERE CustomerID = @CustomerID
+END
+`
+	result, err := TranspileWithDML(source, "main", DefaultDMLConfig())
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+	for _, want := range []string{
+		"(total decimal.Decimal, err error) {",
+		// The OUTPUT column takes the parameter's type, not its name
+		"\tvar total2 decimal.Decimal\n\tvar total2Null decimal.NullDecimal\n",
+		"if err := rows.Scan(&total2Null); err != nil {",
+		"var customerId2 int32",
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("Expected %q, got:\n%s", want, result)
+		}
+	}
+	for _, unwanted := range []string{"var total ", "var customerId "} {
+		if strings.Contains(result, unwanted) {
+			t.Errorf("Did not expect %q, got:\n%s", unwanted, result)
+		}
+	}
+}
+
+func TestTranspileWithDML_OutputInto(t *testing.T) {
+	source := `CREATE PROCEDURE dbo.Archive @Id INT, @Name VARCHAR(50)
+AS
+BEGIN
+    DECLARE @Changes TABLE (OldName VARCHAR(50), NewName VARCHAR(50))
+    CREATE TABLE #Audit (Id INT, Name VARCHAR(50))
+    INSERT INTO Customers (Name) OUTPUT INSERTED.CustomerID, INSERTED.Name INTO #Audit (Id, Name) VALUES (@Name)
+    UPDATE Customers SET Name = @Name OUTPUT DELETED.Name, INSERTED.Name INTO @Changes WHERE CustomerID = @Id
+    DELETE FROM Customers OUTPUT DELETED.CustomerID, DELETED.Name INTO CustomerArchive (CustomerID, Name) WHERE CustomerID = @Id
+END
+`
+	tests := []struct {
+		dialect  string
+		want     []string
+		warnings int
+	}{
+		{"postgres", []string{
+			`if _, err := tempTables.CreateTableVariable("@Changes", columns); err != nil {`,
+			`outputTable, err := tempTables.Table("#Audit")`,
+			`"INSERT INTO Customers (Name) VALUES ($1) RETURNING CustomerID, Name", name)`,
+			"if err := rows.Scan(&outputRow[0], &outputRow[1]); err != nil {",
+			`if err := outputTable.InsertScanned([]string{"Id", "Name"}, outputRow); err != nil {`,
+			`outputTable, err = tempTables.Table("@Changes")`,
+			"if err := outputTable.InsertScanned(nil, outputRow); err != nil {",
+			`result, err := r.db.ExecContext(ctx, "WITH output_rows AS (DELETE FROM Customers WHERE CustomerID = $1 RETURNING CustomerID, Name) INSERT INTO CustomerArchive (CustomerID, Name) SELECT * FROM output_rows", id)`,
+		}, 0},
+		{"sqlserver", []string{
+			`"INSERT INTO Customers (Name) OUTPUT INSERTED.CustomerID, INSERTED.Name VALUES (@p1)", name)`,
+			`"UPDATE Customers SET Name = @p1 OUTPUT DELETED.Name, INSERTED.Name WHERE CustomerID = @p2", name, id)`,
+			`result, err := r.db.ExecContext(ctx, "DELETE FROM Customers OUTPUT DELETED.CustomerID, DELETED.Name INTO CustomerArchive (CustomerID, Name) WHERE CustomerID = @p1", id)`,
+		}, 0},
+		{"sqlite", []string{
+			`if err := outputTable.InsertScanned([]string{"Id", "Name"}, outputRow); err != nil {`,
+			`result, err = r.db.ExecContext(ctx, "DELETE FROM Customers WHERE CustomerID = ?", id)`,
+		}, 2},
+	}
+	for _, tt := range tests {
+		config := DefaultDMLConfig()
+		config.SQLDialect = tt.dialect
+		result, err := TranspileWithDMLEx(source, "main", config)
+		if err != nil {
+			t.Fatalf("%s: TranspileWithDMLEx failed: %v", tt.dialect, err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(result.Code, want) {
+				t.Errorf("%s: expected %q, got:\n%s", tt.dialect, want, result.Code)
+			}
+		}
+		outputWarnings := 0
+		for _, w := range result.Warnings {
+			if strings.Contains(w, "the statement runs without it") {
+				outputWarnings++
+			}
+		}
+		if outputWarnings != tt.warnings {
+			t.Errorf("%s: expected %d OUTPUT warnings, got %v", tt.dialect, tt.warnings, result.Warnings)
+		}
+	}
+}
+
+func TestTranspileWithDML_DialectVariants(t *testing.T) {
+	source := `CREATE PROCEDURE dbo.SearchDocs @Term NVARCHAR(100), @Limit INT
+AS
+BEGIN
+    -- tgpiler:dialect postgres SELECT Id, Title FROM Docs WHERE to_tsvector(Body) @@ plainto_tsquery(@Term) LIMIT @Limit
+    /* tgpiler:dialect mysql
+       SELECT Id, Title FROM Docs
+       WHERE MATCH (Body) AGAINST (@Term) LIMIT @Limit */
+    /* tgpiler:dialect oracle SELECT Id, Title FROM Docs */
+    SELECT TOP (@Limit) Id, Title FROM Docs WHERE CONTAINS(Body, @Term)
+    DELETE FROM Docs WHERE Title = @Term
+END
+`
+	tests := []struct {
+		dialect string
+		want    []string
+	}{
+		{"postgres", []string{
+			"// SQL for postgres from tgpiler:dialect",
+			`"SELECT Id, Title FROM Docs WHERE to_tsvector(Body) @@ plainto_tsquery($1) LIMIT $2", term, limit)`,
+			`"DELETE FROM Docs WHERE Title = $1", term)`,
+		}},
+		{"mysql", []string{
+			"// SQL for mysql from tgpiler:dialect",
+			`"SELECT Id, Title FROM Docs WHERE MATCH (Body) AGAINST (?) LIMIT ?", term, limit)`,
+		}},
+		{"sqlite", []string{
+			"CONTAINS(Body, ?)",
+		}},
+	}
+	for _, tt := range tests {
+		config := DefaultDMLConfig()
+		config.SQLDialect = tt.dialect
+		result, err := TranspileWithDMLEx(source, "main", config)
+		if err != nil {
+			t.Fatalf("%s: TranspileWithDMLEx failed: %v", tt.dialect, err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(result.Code, want) {
+				t.Errorf("%s: expected %q, got:\n%s", tt.dialect, want, result.Code)
+			}
+		}
+		if tt.dialect == "sqlite" && strings.Contains(result.Code, "tgpiler:dialect") {
+			t.Errorf("sqlite: unexpected variant in:\n%s", result.Code)
+		}
+		unknown := 0
+		for _, w := range result.Warnings {
+			if strings.Contains(w, "tgpiler:dialect oracle: unknown dialect") {
+				unknown++
+			}
+		}
+		if unknown != 1 {
+			t.Errorf("%s: expected one unknown dialect warning, got %v", tt.dialect, result.Warnings)
+		}
+	}
+
+	// A backend that doesn't run SQL leaves the variant unused
+	config := DefaultDMLConfig()
+	config.Backend = BackendMock
+	config.SQLDialect = "postgres"
+	result, err := TranspileWithDMLEx(source, "main", config)
+	if err != nil {
+		t.Fatalf("mock: TranspileWithDMLEx failed: %v", err)
+	}
+	found := false
+	for _, w := range result.Warnings {
+		if strings.Contains(w, "is unused") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("mock: expected an unused variant warning, got %v", result.Warnings)
+	}
+}
+
+func TestTranspileWithDML_ScopeIdentity(t *testing.T) {
+	source := `CREATE PROCEDURE dbo.CreateOrder @CustomerID INT, @Sku VARCHAR(20), @OrderID INT OUTPUT
+AS
+BEGIN
+    DECLARE @LineID BIGINT
+    DECLARE @Current INT
+    INSERT INTO AuditLog (Message) VALUES ('start')
+    INSERT INTO Orders (CustomerID) VALUES (@CustomerID)
+    SET @OrderID = SCOPE_IDENTITY()
+    INSERT INTO OrderLines (OrderID, Sku) VALUES (SCOPE_IDENTITY(), @Sku)
+    SELECT @LineID = @@IDENTITY
+    SET @Current = IDENT_CURRENT('Orders')
+END
+`
+	tests := []struct {
+		dialect string
+		want    []string
+	}{
+		{"postgres", []string{
+			"var lastInsertID int64",
+			`rows, err := r.db.QueryContext(ctx, "INSERT INTO Orders (CustomerID) VALUES ($1) RETURNING OrderID", customerId)`,
+			"if err := rows.Scan(&lastInsertID); err != nil {",
+			"orderId = int32(lastInsertID)",
+			`"INSERT INTO OrderLines (OrderID, Sku) VALUES ($1, $2) RETURNING OrderLineID", lastInsertID, sku)`,
+			"lineId = lastInsertID",
+			`if v, err := tsqlruntime.IdentCurrent(ctx, r.db, "postgres", "Orders", "OrderID"); err != nil {`,
+			"current = int32(v)",
+		}},
+		{"mysql", []string{
+			`result, err = r.db.ExecContext(ctx, "INSERT INTO Orders (CustomerID) VALUES (?)", customerId)`,
+			"if id, err := result.LastInsertId(); err != nil {",
+			"lastInsertID = id",
+			`"INSERT INTO OrderLines (OrderID, Sku) VALUES (?, ?)", lastInsertID, sku)`,
+		}},
+		{"sqlserver", []string{
+			`if err := r.db.QueryRowContext(ctx, "INSERT INTO Orders (CustomerID) VALUES (@p1); SELECT CAST(SCOPE_IDENTITY() AS BIGINT)", customerId).Scan(&lastInsertID); err != nil {`,
+		}},
+	}
+	for _, tt := range tests {
+		config := DefaultDMLConfig()
+		config.SQLDialect = tt.dialect
+		result, err := TranspileWithDMLEx(source, "main", config)
+		if err != nil {
+			t.Fatalf("%s: TranspileWithDMLEx failed: %v", tt.dialect, err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(result.Code, want) {
+				t.Errorf("%s: expected %q, got:\n%s", tt.dialect, want, result.Code)
+			}
+		}
+		// The audit INSERT's identity value is never read
+		if strings.Count(result.Code, "lastInsertID = id")+strings.Count(result.Code, "Scan(&lastInsertID") != 2 {
+			t.Errorf("%s: expected two INSERTs keeping their identity value, got:\n%s", tt.dialect, result.Code)
+		}
+		if strings.Contains(result.Code, "lastInsertId") || strings.Contains(result.Code, "TODO") {
+			t.Errorf("%s: unexpected placeholder in:\n%s", tt.dialect, result.Code)
+		}
+	}
+
+	// The schema names the identity column
+	config := DefaultDMLConfig()
+	config.SQLDialect = "postgres"
+	config.GeneratedColumns = map[string]map[string]string{"Orders": {"Id": GeneratedIdentity}}
+	result, err := TranspileWithDMLEx(source, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDMLEx failed: %v", err)
+	}
+	if !strings.Contains(result.Code, "VALUES ($1) RETURNING id") {
+		t.Errorf("expected RETURNING id from the schema, got:\n%s", result.Code)
+	}
+	for _, w := range result.Warnings {
+		if strings.Contains(w, "INSERT INTO Orders: identity column") {
+			t.Errorf("unexpected warning: %s", w)
+		}
+	}
+}
+
+func TestTranspileWithDML_ScopeIdentityAfterOutput(t *testing.T) {
+	source := `CREATE PROCEDURE dbo.CreateOrder @CustomerID INT, @Total INT OUTPUT, @OrderID INT OUTPUT
+AS
+BEGIN
+    INSERT INTO Orders (CustomerID) OUTPUT INSERTED.Total VALUES (@CustomerID)
+    SET @OrderID = SCOPE_IDENTITY()
+END
+`
+	tests := []struct {
+		dialect string
+		want    string
+	}{
+		{"postgres", `"INSERT INTO Orders (CustomerID) VALUES ($1) RETURNING Total, OrderID", customerId)`},
+		{"sqlserver", `"INSERT INTO Orders (CustomerID) OUTPUT INSERTED.Total, INSERTED.OrderID VALUES (@p1)", customerId)`},
+	}
+	for _, tt := range tests {
+		config := DefaultDMLConfig()
+		config.SQLDialect = tt.dialect
+		result, err := TranspileWithDMLEx(source, "main", config)
+		if err != nil {
+			t.Fatalf("%s: TranspileWithDMLEx failed: %v", tt.dialect, err)
+		}
+		for _, want := range []string{tt.want, ", &lastInsertID); err != nil {", "orderId = int32(lastInsertID)"} {
+			if !strings.Contains(result.Code, want) {
+				t.Errorf("%s: expected %q, got:\n%s", tt.dialect, want, result.Code)
+			}
+		}
+	}
+
+	// OUTPUT INTO a table returns no rows to read it from
+	source = strings.Replace(source, "OUTPUT INSERTED.Total", "OUTPUT INSERTED.OrderID INTO AuditLog (OrderID)", 1)
+	config := DefaultDMLConfig()
+	config.SQLDialect = "sqlserver"
+	result, err := TranspileWithDMLEx(source, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDMLEx failed: %v", err)
+	}
+	if !strings.Contains(result.Code, `INTO AuditLog (OrderID) VALUES (@p1); SELECT CAST(SCOPE_IDENTITY() AS BIGINT)", customerId).Scan(&lastInsertID)`) {
+		t.Errorf("expected SCOPE_IDENTITY() after the INSERT, got:\n%s", result.Code)
+	}
+	config.SQLDialect = "postgres"
+	if _, err := TranspileWithDMLEx(source, "main", config); err == nil || !strings.Contains(err.Error(), "SCOPE_IDENTITY()") {
+		t.Errorf("expected a SCOPE_IDENTITY() error, got %v", err)
+	}
+}
+
+func TestTranspileWithDML_FullTextSearch(t *testing.T) {
+	source := `CREATE PROCEDURE dbo.SearchDocs @Term NVARCHAR(100)
+AS
+BEGIN
+    SELECT Id, Title FROM Docs WHERE CONTAINS(Body, @Term) AND Active = 1
+    SELECT Id FROM Docs WHERE FREETEXT((Title, Body), @Term)
+    SELECT Id FROM Docs WHERE CONTAINS(Body, '"fast car" OR "quick*"')
+    SELECT Id FROM Docs WHERE CONTAINS((Title, Body), 'red AND blue AND NOT green')
+    SELECT Id FROM Docs WHERE CONTAINS(Body, 'NEAR((red, blue), 5)')
+END
+`
+	tests := []struct {
+		dialect string
+		want    []string
+	}{
+		{"postgres", []string{
+			"WHERE (to_tsvector(Body) @@ websearch_to_tsquery($1) AND (Active = 1))",
+			"WHERE to_tsvector(concat_ws(' ', Title, Body)) @@ replace(plainto_tsquery($1)::text, '&', '|')::tsquery",
+			"WHERE to_tsvector(Body) @@ to_tsquery('(fast <-> car) | quick:*')",
+			"to_tsquery('red & blue & !green')",
+			"WHERE CONTAINS(Body, 'NEAR((red, blue), 5)')",
+		}},
+		{"mysql", []string{
+			"WHERE (MATCH (Body) AGAINST (? IN BOOLEAN MODE) AND (Active = 1))",
+			"WHERE MATCH (Title, Body) AGAINST (? IN NATURAL LANGUAGE MODE)",
+			`AGAINST ('\"fast car\" quick*' IN BOOLEAN MODE)`,
+			"MATCH (Title, Body) AGAINST ('+red +blue -green' IN BOOLEAN MODE)",
+			"WHERE CONTAINS(Body, 'NEAR((red, blue), 5)')",
+		}},
+		{"sqlite", []string{
+			"WHERE (CONTAINS(Body, ?) AND (Active = 1))",
+		}},
+		{"sqlserver", []string{
+			"WHERE (CONTAINS(Body, @p1) AND (Active = 1))",
+		}},
+	}
+	for _, tt := range tests {
+		config := DefaultDMLConfig()
+		config.SQLDialect = tt.dialect
+		result, err := TranspileWithDMLEx(source, "main", config)
+		if err != nil {
+			t.Fatalf("%s: TranspileWithDMLEx failed: %v", tt.dialect, err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(result.Code, want) {
+				t.Errorf("%s: expected %q, got:\n%s", tt.dialect, want, result.Code)
+			}
+		}
+		translated, kept := 0, 0
+		for _, w := range result.Warnings {
+			switch {
+			case strings.Contains(w, "full-text search, whose stemming"):
+				translated++
+			case strings.Contains(w, "translation; it is kept as it is"):
+				kept++
+			}
+		}
+		switch tt.dialect {
+		case "postgres", "mysql":
+			if translated != 4 || kept != 1 {
+				t.Errorf("%s: expected 4 translation and 1 kept warnings, got %v", tt.dialect, result.Warnings)
+			}
+		case "sqlite":
+			if kept != 5 {
+				t.Errorf("sqlite: expected 5 kept warnings, got %v", result.Warnings)
+			}
+		case "sqlserver":
+			if translated+kept != 0 {
+				t.Errorf("sqlserver: unexpected warnings %v", result.Warnings)
+			}
+		}
+	}
+
+	// The gRPC backend calls a Search RPC with the search as Query
+	config := DefaultDMLConfig()
+	config.Backend = BackendGRPC
+	result, err := TranspileWithDMLEx(source, "main", config)
+	if err != nil {
+		t.Fatalf("grpc: TranspileWithDMLEx failed: %v", err)
+	}
+	for _, want := range []string{"SearchDocs(ctx, &SearchDocsRequest{", "Query: term,", `Query: "\"fast car\" OR \"quick*\"",`} {
+		if !strings.Contains(result.Code, want) {
+			t.Errorf("grpc: expected %q, got:\n%s", want, result.Code)
+		}
+	}
+}
+
+func TestTranspileWithDML_SpatialAndHierarchyID(t *testing.T) {
+	source := `CREATE PROCEDURE dbo.NearbyStores @Location GEOGRAPHY, @Node HIERARCHYID
+AS
+BEGIN
+    DECLARE @P GEOGRAPHY = geography::Point(47.6, -122.3, 4326)
+    DECLARE @Parent HIERARCHYID = @Node.GetAncestor(1)
+    DECLARE @Lvl SMALLINT = @Node.GetLevel()
+    DECLARE @Root HIERARCHYID = hierarchyid::GetRoot()
+    SELECT Id FROM Stores WHERE Location.STDistance(@Location) < 1000
+    SELECT Id FROM Staff WHERE OrgNode.IsDescendantOf(@Parent) = 1 AND OrgNode.GetLevel() = 2
+    SELECT @P = Location FROM Stores WHERE Id = 1
+END
+`
+	tests := []struct {
+		dialect string
+		mode    string
+		want    []string
+		kept    int
+	}{
+		{"postgres", SpatialPostGIS, []string{
+			"p := tsqlruntime.EWKT(4326, tsqlruntime.WKTPoint(-122.3, 47.6))",
+			"WHERE (ST_Distance(Location, CAST($1 AS geography)) < 1000)",
+			"WHERE ((OrgNode LIKE $1 || '%') AND ((LENGTH(OrgNode) - LENGTH(REPLACE(OrgNode, '/', '')) - 1) = 2))",
+			"SELECT ST_AsEWKT(Location) FROM Stores",
+		}, 0},
+		{"mysql", SpatialWKT, []string{
+			"p := tsqlruntime.WKTPoint(-122.3, 47.6)",
+			"WHERE (Location.STDistance(?) < 1000)",
+			"(OrgNode LIKE CONCAT(?, '%'))",
+			"SELECT Location FROM Stores",
+		}, 1},
+		{"sqlserver", SpatialWKT, []string{
+			"WHERE (Location.STDistance(@p1) < 1000)",
+			"WHERE ((OrgNode.IsDescendantOf(@p1) = 1) AND (OrgNode.GetLevel() = 2))",
+		}, 0},
+	}
+	for _, tt := range tests {
+		config := DefaultDMLConfig()
+		config.SQLDialect = tt.dialect
+		config.SpatialMode = tt.mode
+		result, err := TranspileWithDMLEx(source, "main", config)
+		if err != nil {
+			t.Fatalf("%s: TranspileWithDMLEx failed: %v", tt.dialect, err)
+		}
+		for _, want := range append(tt.want,
+			"parent := tsqlruntime.HierarchyGetAncestor(node, 1)",
+			"var lvl int16 = tsqlruntime.HierarchyGetLevel(node)",
+			`root := "/"`,
+		) {
+			if !strings.Contains(result.Code, want) {
+				t.Errorf("%s: expected %q, got:\n%s", tt.dialect, want, result.Code)
+			}
+		}
+		kept := 0
+		for _, w := range result.Warnings {
+			if strings.Contains(w, "translation; it is kept as it is") {
+				kept++
+			}
+			if strings.Contains(w, "scalar UDF") {
+				t.Errorf("%s: spatial method taken for a UDF: %s", tt.dialect, w)
+			}
+		}
+		if kept != tt.kept {
+			t.Errorf("%s: expected %d kept warnings, got %v", tt.dialect, tt.kept, result.Warnings)
+		}
+	}
+}
+
+func TestTranspile_LikeInGo(t *testing.T) {
+	source := `CREATE PROCEDURE dbo.Classify @Name NVARCHAR(50), @Pattern NVARCHAR(50), @Code INT
+AS
+BEGIN
+    DECLARE @Kind INT = 0
+    IF @Name LIKE 'ABC%' SET @Kind = 1
+    IF @Name NOT LIKE '%x_y%' ESCAPE 'x' SET @Kind = 2
+    IF @Name LIKE '[A-C]%' SET @Kind = 3
+    IF @Name LIKE '%.txt' SET @Kind = 4
+    IF @Name LIKE 'Smith' SET @Kind = 5
+    IF @Name LIKE '12 %' SET @Kind = 6
+    IF @Name LIKE @Pattern ESCAPE '!' SET @Kind = 7
+    IF @Code LIKE '4%' SET @Kind = 8
+    RETURN @Kind
+END
+`
+	code, err := Transpile(source, "main")
+	if err != nil {
+		t.Fatalf("Transpile failed: %v", err)
+	}
+	for _, want := range []string{
+		`if strings.HasPrefix(strings.ToLower(name), "abc") {`,
+		`if !strings.Contains(strings.ToLower(name), "_y") {`,
+		`if strfn.Like(name, "[A-C]%") {`,
+		`if strings.HasSuffix(strings.ToLower(name), ".txt") {`,
+		`if strings.EqualFold(name, "Smith") {`,
+		`if strings.HasPrefix(name, "12 ") {`,
+		`if strfn.LikeEscape(name, pattern, "!") {`,
+		`if strings.HasPrefix(fmt.Sprint(code), "4") {`,
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("expected %q, got:\n%s", want, code)
+		}
+	}
+}
+
+func TestTranspileWithDML_InLists(t *testing.T) {
+	source := `CREATE TYPE dbo.IdList AS TABLE (Id INT NOT NULL PRIMARY KEY)
+GO
+CREATE PROCEDURE dbo.CheckOrders @Ids dbo.IdList READONLY, @A INT, @B INT, @X BIGINT, @Region NVARCHAR(20)
+AS
+BEGIN
+    SELECT OrderID FROM Orders WHERE CustomerID IN (@A, @B, @A)
+    IF @X IN (SELECT Id FROM @Ids)
+        SET @A = 1
+    IF @B NOT IN (SELECT Id FROM @Ids)
+        SET @A = 2
+    IF @B NOT IN (SELECT CustomerID FROM Customers WHERE Region = @Region)
+        SET @A = 3
+END
+`
+	tests := []struct {
+		dialect string
+		want    []string
+	}{
+		{"postgres", []string{
+			`"SELECT OrderID FROM Orders WHERE CustomerID IN ($1, $2, $1)", a, b)`,
+			`"SELECT 1 WHERE $2 NOT IN (SELECT CustomerID FROM Customers WHERE (Region = $1))", region, b)`,
+		}},
+		{"mysql", []string{
+			`"SELECT OrderID FROM Orders WHERE CustomerID IN (?, ?, ?)", a, b, a)`,
+			`"SELECT 1 WHERE ? NOT IN (SELECT CustomerID FROM Customers WHERE (Region = ?))", b, region)`,
+		}},
+	}
+	for _, tt := range tests {
+		config := DefaultDMLConfig()
+		config.SQLDialect = tt.dialect
+		result, err := TranspileWithDMLEx(source, "main", config)
+		if err != nil {
+			t.Fatalf("%s: TranspileWithDMLEx failed: %v", tt.dialect, err)
+		}
+		for _, want := range append(tt.want,
+			`if slices.ContainsFunc(ids, func(row IdList) bool { return int64(row.Id) == x }) {`,
+			`if !slices.ContainsFunc(ids, func(row IdList) bool { return row.Id == b }) {`,
+		) {
+			if !strings.Contains(result.Code, want) {
+				t.Errorf("%s: expected %q, got:\n%s", tt.dialect, want, result.Code)
+			}
+		}
+	}
 }
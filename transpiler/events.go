@@ -0,0 +1,114 @@
+package transpiler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// Event tables
+//
+// Outbox and queue tables (INSERT INTO EventQueue ...) exist so that a
+// relay can pick rows up and publish them. With TableToEvent the INSERT
+// publishes the row directly instead:
+//
+//	INSERT INTO EventQueue (EventType, OrderID) VALUES ('Created', @id)
+//	  -> tsqlruntime.PublishEvent(ctx, r.events, "order-events", nil,
+//	         map[string]any{"EventType": "Created", "OrderID": id})
+//
+// The row is sent as a JSON object keyed by column name. TableToEventKey
+// names the column whose value becomes the message key.
+
+// eventTopic returns the topic an event table is published to.
+func (dt *dmlTranspiler) eventTopic(table string) (string, bool) {
+	return lookupTableName(dt.config.TableToEvent, table)
+}
+
+// lookupTableName finds tableName in a table-keyed map, ignoring case and
+// any schema prefix or brackets on the configured name.
+func lookupTableName(m map[string]string, tableName string) (string, bool) {
+	if value, ok := m[tableName]; ok {
+		return value, true
+	}
+	for name, value := range m {
+		if strings.EqualFold(strings.Trim(unqualifiedName(name), "[]"), tableName) {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// transpileInsertEvent publishes each row of an INSERT into an event table.
+func (dt *dmlTranspiler) transpileInsertEvent(s *ast.InsertStatement, topic string) (string, error) {
+	table := dt.extractInsertTable(s)
+	if s.Select != nil {
+		return "", fmt.Errorf("INSERT INTO %s is published to %s, which needs a VALUES list (INSERT ... SELECT can't be published)", table, topic)
+	}
+	if len(s.Columns) == 0 {
+		return "", fmt.Errorf("INSERT INTO %s is published to %s, which needs a column list to name the event fields", table, topic)
+	}
+	if s.Output != nil {
+		return "", fmt.Errorf("INSERT INTO %s is published to %s, which has no OUTPUT", table, topic)
+	}
+	keyColumn, _ := lookupTableName(dt.config.TableToEventKey, table)
+	if dt.inTransaction {
+		dt.warnings = append(dt.warnings, fmt.Sprintf("%s: INSERT INTO %s publishes to %s immediately; the event is not rolled back with the transaction",
+			dt.currentProcName, table, topic))
+	}
+
+	dt.sideEffects = append(dt.sideEffects, SideEffect{
+		Procedure: dt.currentProcName,
+		Line:      dt.fileLine(s.Token.Line),
+		Kind:      "event",
+		Original:  "INSERT INTO " + table,
+		Call:      fmt.Sprintf("tsqlruntime.PublishEvent(%s, %q)", dt.config.EventPublisherVar, topic),
+	})
+
+	dt.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+	var out strings.Builder
+	if dt.emitOriginal() {
+		out.WriteString(fmt.Sprintf("// Original: %s\n", truncateSQL(s.String(), 100)))
+		out.WriteString(dt.indentStr())
+	}
+	ind := dt.indentStr()
+	out.WriteString(fmt.Sprintf("// INSERT INTO %s -> publish to %s\n", table, topic))
+	for r, row := range s.Values {
+		if len(row) != len(s.Columns) {
+			return "", fmt.Errorf("INSERT INTO %s: row %d has %d values for %d columns", table, r+1, len(row), len(s.Columns))
+		}
+		key := "nil"
+		var fields []string
+		for i, col := range s.Columns {
+			if referencesColumn(row[i]) {
+				return "", fmt.Errorf("INSERT INTO %s is published to %s, so its values can't refer to columns", table, topic)
+			}
+			value := dt.exprToGoValue(row[i])
+			if keyColumn != "" && strings.EqualFold(col.Value, keyColumn) {
+				key = value
+			}
+			fields = append(fields, fmt.Sprintf("%q: %s", col.Value, value))
+		}
+		if keyColumn != "" && key == "nil" {
+			return "", fmt.Errorf("INSERT INTO %s doesn't set %s, the key column for %s", table, keyColumn, topic)
+		}
+		out.WriteString(ind)
+		out.WriteString(fmt.Sprintf("if err := tsqlruntime.PublishEvent(ctx, %s, %q, %s, map[string]any{%s}); err != nil {\n",
+			dt.config.EventPublisherVar, topic, key, strings.Join(fields, ", ")))
+		out.WriteString(ind + "\t" + dt.buildErrorReturn() + "\n")
+		out.WriteString(ind + "}\n")
+	}
+	if dt.usesRowCount {
+		out.WriteString(fmt.Sprintf("%srowsAffected = %d\n", ind, len(s.Values)))
+	}
+	return strings.TrimSuffix(out.String(), "\n"), nil
+}
+
+// warnEventTable warns about statements other than INSERT on an event
+// table, which still run against the database.
+func (dt *dmlTranspiler) warnEventTable(verb, table string) {
+	if topic, ok := dt.eventTopic(table); ok {
+		dt.warnings = append(dt.warnings, fmt.Sprintf("%s: %s %s still runs against the database, though INSERTs into it are published to %s",
+			dt.currentProcName, verb, table, topic))
+	}
+}
@@ -14,9 +14,15 @@ func (t *transpiler) transpileExpression(expr ast.Expression) (string, error) {
 
 	switch e := expr.(type) {
 	case *ast.Identifier:
+		if col, ok := t.xmlColumnFor(e); ok {
+			return col.code, nil
+		}
 		return goIdentifier(e.Value), nil
 
 	case *ast.QualifiedIdentifier:
+		if col, ok := t.xmlColumnFor(e); ok && len(e.Parts) == 2 {
+			return col.code, nil
+		}
 		var parts []string
 		for _, p := range e.Parts {
 			parts = append(parts, goIdentifier(p.Value))
@@ -32,6 +38,11 @@ func (t *transpiler) transpileExpression(expr ast.Expression) (string, error) {
 		case "@@ROWCOUNT":
 			// rowsAffected is declared at function start if @@ROWCOUNT is used
 			return "rowsAffected", nil
+		case "@@FETCH_STATUS":
+			if t.usesFetchStatus {
+				// fetchStatus is declared at function start for scrollable cursors
+				return "fetchStatus", nil
+			}
 		case "@@ERROR":
 			// In Go, errors are returned explicitly
 			return "0 /* @@ERROR: check err != nil instead */", nil
@@ -42,15 +53,24 @@ func (t *transpiler) transpileExpression(expr ast.Expression) (string, error) {
 		// Mark variable as used (read)
 		varName := goIdentifier(e.Name)
 		t.symbols.markUsed(varName)
+		if ti := t.symbols.lookup(varName); ti != nil && ti.nullable {
+			return t.nullValue(varName, ti.goType), nil
+		}
 		return varName, nil
 
 	case *ast.IntegerLiteral:
+		if ref, ok := t.constantFor(e); ok {
+			return ref, nil
+		}
 		return fmt.Sprintf("%d", e.Value), nil
 
 	case *ast.FloatLiteral:
 		return fmt.Sprintf("%v", e.Value), nil
 
 	case *ast.StringLiteral:
+		if ref, ok := t.constantFor(e); ok {
+			return ref, nil
+		}
 		// Go string literal
 		return fmt.Sprintf("%q", e.Value), nil
 
@@ -63,10 +83,9 @@ func (t *transpiler) transpileExpression(expr ast.Expression) (string, error) {
 		return fmt.Sprintf("[]byte(%q)", e.Value), nil
 
 	case *ast.MoneyLiteral:
-		t.imports["github.com/shopspring/decimal"] = true
 		// Strip currency symbol and convert to decimal
 		val := strings.TrimPrefix(e.Value, "$")
-		return fmt.Sprintf("decimal.RequireFromString(%q)", val), nil
+		return t.decimalLiteral(val), nil
 
 	case *ast.PrefixExpression:
 		return t.transpilePrefixExpression(e)
@@ -75,6 +94,9 @@ func (t *transpiler) transpileExpression(expr ast.Expression) (string, error) {
 		return t.transpileInfixExpression(e)
 
 	case *ast.FunctionCall:
+		if code, ok, err := t.transpileXMLRowNumber(e); ok || err != nil {
+			return code, err
+		}
 		return t.transpileFunctionCall(e)
 
 	case *ast.CaseExpression:
@@ -121,17 +143,17 @@ func (t *transpiler) transpileExpression(expr ast.Expression) (string, error) {
 	case *ast.MethodCallExpression:
 		return t.transpileMethodCallExpression(e)
 
+	case *ast.StaticMethodCall:
+		return t.transpileStaticMethodCall(e)
+
+	case *ast.LikeExpression:
+		return t.transpileLikeExpression(e)
+
+	case *ast.AtTimeZoneExpression:
+		return t.transpileAtTimeZone(e)
+
 	case *ast.NextValueForExpression:
-		seqName := ""
-		if e.SequenceName != nil {
-			for _, part := range e.SequenceName.Parts {
-				if seqName != "" {
-					seqName += "."
-				}
-				seqName += part.Value
-			}
-		}
-		return t.transpileNextValueFor(seqName)
+		return t.transpileNextValueFor(sequenceName(e.SequenceName))
 
 	default:
 		return "", unsupportedExpressionError(expr)
@@ -146,9 +168,7 @@ func unsupportedExpressionError(expr ast.Expression) error {
 	switch {
 	case strings.Contains(typeName, "NextValueFor"):
 		return fmt.Errorf("unsupported expression type: %s\n"+
-			"      Hint: NEXT VALUE FOR sequences are not yet supported.\n"+
-			"      Workaround: Replace with a placeholder and implement sequence\n"+
-			"      logic in Go using result.LastInsertId() or uuid.New().", typeName)
+			"      Hint: NEXT VALUE FOR requires --dml (see --sequence-mode).", typeName)
 	
 	case strings.Contains(typeName, "Over"):
 		return fmt.Errorf("unsupported expression type: %s\n"+
@@ -158,7 +178,7 @@ func unsupportedExpressionError(expr ast.Expression) error {
 	
 	case strings.Contains(typeName, "Pivot") || strings.Contains(typeName, "Unpivot"):
 		return fmt.Errorf("unsupported expression type: %s\n"+
-			"      Hint: PIVOT/UNPIVOT are not yet supported.\n"+
+			"      Hint: PIVOT/UNPIVOT are translated in the FROM clause of queries with --dml.\n"+
 			"      Workaround: Transform the data in Go after fetching,\n"+
 			"      or use a view in the database.", typeName)
 	
@@ -220,7 +240,7 @@ func (t *transpiler) transpilePrefixExpression(e *ast.PrefixExpression) (string,
 	if op == "-" {
 		rightType := t.inferType(e.Right)
 		if rightType != nil && rightType.isDecimal {
-			return fmt.Sprintf("%s.Neg()", right), nil
+			return t.decimalFunc("Neg", right), nil
 		}
 	}
 
@@ -234,6 +254,19 @@ func (t *transpiler) transpilePrefixExpression(e *ast.PrefixExpression) (string,
 }
 
 func (t *transpiler) transpileInfixExpression(e *ast.InfixExpression) (string, error) {
+	result, err := t.transpileInfix(e)
+	if err != nil {
+		return "", err
+	}
+	// A comparison with NULL is never true
+	if guard := t.nullGuard(e); guard != "" {
+		result = fmt.Sprintf("(%s && %s)", guard, result)
+	}
+	return result, nil
+}
+
+// transpileInfix is transpileInfixExpression without the NULL checks.
+func (t *transpiler) transpileInfix(e *ast.InfixExpression) (string, error) {
 	left, err := t.transpileExpression(e.Left)
 	if err != nil {
 		return "", err
@@ -347,7 +380,8 @@ func (t *transpiler) transpileInfixExpression(e *ast.InfixExpression) (string, e
 	leftIsLiteral := isIntegerLiteral(e.Left)
 	rightIsLiteral := isIntegerLiteral(e.Right)
 
-	if isArithmetic && leftType != nil && rightType != nil && leftType.isNumeric && rightType.isNumeric && !leftIsLiteral && !rightIsLiteral {
+	isOrdering := op == "<" || op == ">" || op == "<=" || op == ">=" || op == "=" || op == "<>" || op == "!="
+	if (isArithmetic || isOrdering) && leftType != nil && rightType != nil && leftType.isNumeric && rightType.isNumeric && !leftIsLiteral && !rightIsLiteral {
 		// Both are typed expressions - promote to the larger type
 		if leftType.goType != rightType.goType {
 			targetType := t.promoteNumericType(leftType.goType, rightType.goType)
@@ -362,6 +396,11 @@ func (t *transpiler) transpileInfixExpression(e *ast.InfixExpression) (string, e
 
 	// Handle time.Time comparisons - Go doesn't support comparison operators on structs
 	if (leftType != nil && leftType.isDateTime) || (rightType != nil && rightType.isDateTime) {
+		if date, ok := t.dateLiteral(e.Right); ok {
+			right = date
+		} else if date, ok := t.dateLiteral(e.Left); ok {
+			left = date
+		}
 		switch op {
 		case "=":
 			return fmt.Sprintf("%s.Equal(%s)", left, right), nil
@@ -398,7 +437,7 @@ func (t *transpiler) transpileInfixExpression(e *ast.InfixExpression) (string, e
 
 // transpileDecimalInfix handles arithmetic/comparison when at least one operand is decimal.
 func (t *transpiler) transpileDecimalInfix(left, right string, leftExpr, rightExpr ast.Expression, leftType, rightType *typeInfo, op string) (string, error) {
-	t.imports["github.com/shopspring/decimal"] = true
+	t.importDecimal()
 
 	// Ensure both operands are decimal
 	leftDec := left
@@ -412,30 +451,12 @@ func (t *transpiler) transpileDecimalInfix(left, right string, leftExpr, rightEx
 
 	// Arithmetic operators
 	switch op {
-	case "+":
-		return fmt.Sprintf("%s.Add(%s)", leftDec, rightDec), nil
-	case "-":
-		return fmt.Sprintf("%s.Sub(%s)", leftDec, rightDec), nil
-	case "*":
-		return fmt.Sprintf("%s.Mul(%s)", leftDec, rightDec), nil
-	case "/":
-		return fmt.Sprintf("%s.Div(%s)", leftDec, rightDec), nil
-	case "%":
-		return fmt.Sprintf("%s.Mod(%s)", leftDec, rightDec), nil
+	case "+", "-", "*", "/", "%":
+		return t.decimalArith(op, leftDec, rightDec), nil
 
 	// Comparison operators - return bool expressions
-	case "=":
-		return fmt.Sprintf("%s.Equal(%s)", leftDec, rightDec), nil
-	case "<>", "!=":
-		return fmt.Sprintf("!%s.Equal(%s)", leftDec, rightDec), nil
-	case "<":
-		return fmt.Sprintf("%s.LessThan(%s)", leftDec, rightDec), nil
-	case "<=":
-		return fmt.Sprintf("%s.LessThanOrEqual(%s)", leftDec, rightDec), nil
-	case ">":
-		return fmt.Sprintf("%s.GreaterThan(%s)", leftDec, rightDec), nil
-	case ">=":
-		return fmt.Sprintf("%s.GreaterThanOrEqual(%s)", leftDec, rightDec), nil
+	case "=", "<>", "!=", "<", "<=", ">", ">=":
+		return t.decimalCompare(op, leftDec, rightDec), nil
 
 	default:
 		// For other operators (AND, OR, etc.), fall back to standard
@@ -449,9 +470,9 @@ func (t *transpiler) transpileDecimalInfix(left, right string, leftExpr, rightEx
 	}
 }
 
-// ensureDecimal wraps a non-decimal expression to convert it to decimal.Decimal.
+// ensureDecimal wraps a non-decimal expression to convert it to a decimal.
 func (t *transpiler) ensureDecimal(expr ast.Expression, transpiled string) string {
-	t.imports["github.com/shopspring/decimal"] = true
+	t.importDecimal()
 
 	ti := t.inferType(expr)
 
@@ -462,28 +483,28 @@ func (t *transpiler) ensureDecimal(expr ast.Expression, transpiled string) strin
 
 	// Integer literal
 	if _, ok := expr.(*ast.IntegerLiteral); ok {
-		return fmt.Sprintf("decimal.NewFromInt(%s)", transpiled)
+		return t.decimalFromInt(transpiled)
 	}
 
-	// Float literal - use RequireFromString to avoid float64 precision loss
+	// Float literal - parse the text to avoid float64 precision loss
 	if _, ok := expr.(*ast.FloatLiteral); ok {
-		return fmt.Sprintf("decimal.RequireFromString(\"%s\")", transpiled)
+		return t.decimalLiteral(transpiled)
 	}
 
 	// Integer variable/expression
 	if ti.isNumeric && !ti.isDecimal {
 		switch ti.goType {
 		case "int32", "int16", "uint8":
-			return fmt.Sprintf("decimal.NewFromInt(int64(%s))", transpiled)
+			return t.decimalFromInt(fmt.Sprintf("int64(%s)", transpiled))
 		case "int64":
-			return fmt.Sprintf("decimal.NewFromInt(%s)", transpiled)
+			return t.decimalFromInt(transpiled)
 		case "float64":
-			return fmt.Sprintf("decimal.NewFromFloat(%s)", transpiled)
+			return t.decimalFromFloat(transpiled)
 		}
 	}
 
 	// Default: try NewFromFloat for numeric expressions
-	return fmt.Sprintf("decimal.NewFromFloat(float64(%s))", transpiled)
+	return t.decimalFromFloat(fmt.Sprintf("float64(%s)", transpiled))
 }
 
 // ensureBool converts T-SQL BIT semantics (0/1) to Go bool (false/true).
@@ -519,11 +540,17 @@ func (t *transpiler) ensureBool(expr ast.Expression, transpiled string) string {
 func (t *transpiler) inferType(expr ast.Expression) *typeInfo {
 	switch e := expr.(type) {
 	case *ast.Variable:
+		if strings.EqualFold(e.Name, "@@IDENTITY") {
+			return &typeInfo{goType: "int64", isNumeric: true}
+		}
 		name := goIdentifier(e.Name)
 		if ti := t.symbols.lookup(name); ti != nil {
 			return ti
 		}
 	case *ast.Identifier:
+		if col, ok := t.xmlColumnFor(e); ok {
+			return t.typeInfoFromDataType(col.typ)
+		}
 		name := goIdentifier(e.Value)
 		if ti := t.symbols.lookup(name); ti != nil {
 			return ti
@@ -537,7 +564,7 @@ func (t *transpiler) inferType(expr ast.Expression) *typeInfo {
 	case *ast.NullLiteral:
 		return &typeInfo{goType: "any"}
 	case *ast.MoneyLiteral:
-		return &typeInfo{goType: "decimal.Decimal", isDecimal: true, isNumeric: true}
+		return t.decimalInfo()
 	case *ast.PrefixExpression:
 		// Unary operators preserve the type of their operand
 		return t.inferType(e.Right)
@@ -545,9 +572,13 @@ func (t *transpiler) inferType(expr ast.Expression) *typeInfo {
 		// For arithmetic, result type depends on operands
 		leftType := t.inferType(e.Left)
 		rightType := t.inferType(e.Right)
+		// + on a string concatenates
+		if e.Operator == "+" && ((leftType != nil && leftType.isString) || (rightType != nil && rightType.isString)) {
+			return &typeInfo{goType: "string", isString: true}
+		}
 		// If either is decimal, result is decimal
 		if (leftType != nil && leftType.isDecimal) || (rightType != nil && rightType.isDecimal) {
-			return &typeInfo{goType: "decimal.Decimal", isDecimal: true, isNumeric: true}
+			return t.decimalInfo()
 		}
 		// If either is float, result is float
 		if (leftType != nil && leftType.goType == "float64") || (rightType != nil && rightType.goType == "float64") {
@@ -584,10 +615,14 @@ func (t *transpiler) inferType(expr ast.Expression) *typeInfo {
 				if len(e.Arguments) > 0 {
 					argType := t.inferType(e.Arguments[0])
 					if argType.isDecimal {
-						return &typeInfo{goType: "decimal.Decimal", isDecimal: true, isNumeric: true}
+						return t.decimalInfo()
 					}
 				}
-			case "ISNULL", "COALESCE":
+			case "COALESCE":
+				if len(e.Arguments) > 0 {
+					return t.coalesceType(e.Arguments)
+				}
+			case "ISNULL", "GREATEST", "LEAST":
 				// Return type is the type of the first argument
 				if len(e.Arguments) > 0 {
 					return t.inferType(e.Arguments[0])
@@ -596,10 +631,19 @@ func (t *transpiler) inferType(expr ast.Expression) *typeInfo {
 			return t.inferFunctionReturnType(id.Value)
 		}
 	case *ast.CastExpression:
-		return typeInfoFromDataType(e.TargetType)
+		return t.typeInfoFromDataType(e.TargetType)
 	case *ast.ConvertExpression:
-		return typeInfoFromDataType(e.TargetType)
+		return t.typeInfoFromDataType(e.TargetType)
+	case *ast.AtTimeZoneExpression:
+		return timeTypeInfo("DATETIMEOFFSET")
+	case *ast.StaticMethodCall:
+		return staticMethodType(e)
+	case *ast.LikeExpression:
+		return &typeInfo{goType: "bool", isBool: true}
 	case *ast.MethodCallExpression:
+		if ti := t.clrMethodType(e); ti != nil {
+			return ti
+		}
 		// XML method return types
 		switch strings.ToLower(e.MethodName) {
 		case "value":
@@ -607,21 +651,7 @@ func (t *transpiler) inferType(expr ast.Expression) *typeInfo {
 			if len(e.Arguments) >= 2 {
 				// Get the type argument (second argument)
 				if str, ok := e.Arguments[1].(*ast.StringLiteral); ok {
-					typeUpper := strings.ToUpper(str.Value)
-					switch {
-					case strings.HasPrefix(typeUpper, "INT"):
-						return &typeInfo{goType: "int32", isNumeric: true}
-					case strings.HasPrefix(typeUpper, "BIGINT"):
-						return &typeInfo{goType: "int64", isNumeric: true}
-					case strings.HasPrefix(typeUpper, "BIT"):
-						return &typeInfo{goType: "bool", isBool: true}
-					case strings.HasPrefix(typeUpper, "DECIMAL"), strings.HasPrefix(typeUpper, "NUMERIC"), strings.HasPrefix(typeUpper, "MONEY"):
-						return &typeInfo{goType: "decimal.Decimal", isDecimal: true, isNumeric: true}
-					case strings.HasPrefix(typeUpper, "FLOAT"), strings.HasPrefix(typeUpper, "REAL"):
-						return &typeInfo{goType: "float64", isNumeric: true}
-					default:
-						return &typeInfo{goType: "string", isString: true}
-					}
+					return t.typeInfoFromDataType(xmlDataType(str.Value))
 				}
 			}
 			return &typeInfo{goType: "string", isString: true}
@@ -639,13 +669,14 @@ func (t *transpiler) inferType(expr ast.Expression) *typeInfo {
 	case *ast.CaseExpression:
 		// CASE expression type is determined by the result expressions
 		goType := t.inferCaseResultType(e)
+		if t.isDecimalType(goType) {
+			return t.decimalInfo()
+		}
 		switch goType {
 		case "int64", "int32":
 			return &typeInfo{goType: goType, isNumeric: true}
 		case "float64":
 			return &typeInfo{goType: "float64", isNumeric: true}
-		case "decimal.Decimal":
-			return &typeInfo{goType: "decimal.Decimal", isDecimal: true, isNumeric: true}
 		case "string":
 			return &typeInfo{goType: "string", isString: true}
 		case "bool":
@@ -666,16 +697,23 @@ func (t *transpiler) inferFunctionReturnType(funcName string) *typeInfo {
 	case "LEN", "DATALENGTH", "CHARINDEX", "PATINDEX", "ASCII", "UNICODE":
 		return &typeInfo{goType: "int32", isNumeric: true}
 	// String manipulation functions
-	case "UPPER", "LOWER", "LTRIM", "RTRIM", "TRIM", "SUBSTRING", "LEFT", "RIGHT", "REPLACE", "REPLICATE", "REVERSE", "CONCAT", "CONCAT_WS", "NCHAR", "CHAR":
+	case "UPPER", "LOWER", "LTRIM", "RTRIM", "TRIM", "SUBSTRING", "LEFT", "RIGHT", "REPLACE", "REPLICATE", "REVERSE", "CONCAT", "CONCAT_WS", "NCHAR", "CHAR",
+		"STUFF", "SPACE", "TRANSLATE", "QUOTENAME", "FORMATMESSAGE":
 		return &typeInfo{goType: "string", isString: true}
 	// Math functions
 	case "ABS", "CEILING", "CEIL", "FLOOR", "ROUND", "POWER", "SQRT", "SIGN":
 		return &typeInfo{goType: "float64", isNumeric: true}
 	// Date/time functions
-	case "GETDATE", "SYSDATETIME", "GETUTCDATE", "SYSUTCDATETIME", "DATEADD":
+	case "GETDATE", "SYSDATETIME", "GETUTCDATE", "SYSUTCDATETIME", "DATEADD", "EOMONTH", "DATEFROMPARTS":
 		return &typeInfo{goType: "time.Time", isDateTime: true}
-	case "DATEDIFF", "YEAR", "MONTH", "DAY", "DATEPART":
+	case "SYSDATETIMEOFFSET", "SWITCHOFFSET", "TODATETIMEOFFSET":
+		return timeTypeInfo("DATETIMEOFFSET")
+	case "DATEDIFF", "YEAR", "MONTH", "DAY", "DATEPART", "ISNUMERIC":
 		return &typeInfo{goType: "int32", isNumeric: true}
+	case "DATEDIFF_BIG", "SCOPE_IDENTITY", "IDENT_CURRENT":
+		return &typeInfo{goType: "int64", isNumeric: true}
+	case "DATENAME", "FORMAT":
+		return &typeInfo{goType: "string", isString: true}
 	// JSON functions
 	case "JSON_VALUE", "JSON_QUERY", "JSON_MODIFY":
 		return &typeInfo{goType: "string", isString: true}
@@ -699,7 +737,7 @@ func (t *transpiler) inferFunctionReturnType(funcName string) *typeInfo {
 		return &typeInfo{goType: "int64", isNumeric: true}
 	case "SUM", "AVG", "MIN", "MAX":
 		// These need argument type - handled specially in inferType
-		return &typeInfo{goType: "decimal.Decimal", isDecimal: true, isNumeric: true}
+		return t.decimalInfo()
 	default:
 		return &typeInfo{goType: "any"}
 	}
@@ -727,24 +765,26 @@ func (t *transpiler) inferWindowFunctionType(funcName string, fc *ast.FunctionCa
 		return &typeInfo{goType: "any"}
 	
 	// Aggregate functions with OVER - COUNT always returns int64
-	case "COUNT":
+	case "COUNT", "COUNT_BIG":
 		return &typeInfo{goType: "int64", isNumeric: true}
 	
-	// SUM, AVG, MIN, MAX - return type matches argument
+	// SUM of integers is a BIGINT, SUM and AVG of floats a FLOAT; the rest,
+	// and arguments of unknown type such as columns, scan as decimals
 	case "SUM", "AVG":
 		if len(fc.Arguments) > 0 {
 			argType := t.inferType(fc.Arguments[0])
-			if argType != nil {
-				// SUM/AVG of integers typically returns the same or larger type
-				if argType.isDecimal {
-					return &typeInfo{goType: "decimal.Decimal", isDecimal: true, isNumeric: true}
-				}
-				if argType.isNumeric {
-					return &typeInfo{goType: "decimal.Decimal", isDecimal: true, isNumeric: true}
+			switch {
+			case argType == nil || !argType.isNumeric || argType.isDecimal:
+			case argType.goType == "float64" || argType.goType == "float32":
+				return &typeInfo{goType: "float64", isNumeric: true}
+			case funcName == "SUM":
+				switch argType.goType {
+				case "int", "int64", "int32", "int16", "uint8":
+					return &typeInfo{goType: "int64", isNumeric: true}
 				}
 			}
 		}
-		return &typeInfo{goType: "decimal.Decimal", isDecimal: true, isNumeric: true}
+		return t.decimalInfo()
 	
 	case "MIN", "MAX":
 		if len(fc.Arguments) > 0 {
@@ -917,37 +957,10 @@ func (t *transpiler) transpileFunctionCall(fc *ast.FunctionCall) (string, error)
 			return fmt.Sprintf("strings.TrimSpace(%s)", args[0]), nil
 		}
 
-	case "SUBSTRING":
-		// SUBSTRING(str, start, length) -> str[start-1 : start-1+length]
-		// Note: T-SQL is 1-indexed, Go is 0-indexed
-		if len(args) == 3 {
-			return fmt.Sprintf("(%s)[(%s)-1:(%s)-1+(%s)]", args[0], args[1], args[1], args[2]), nil
-		}
-
-	case "LEFT":
-		if len(args) == 2 {
-			return fmt.Sprintf("(%s)[:(%s)]", args[0], args[1]), nil
-		}
-
-	case "RIGHT":
-		if len(args) == 2 {
-			return fmt.Sprintf("(%s)[len(%s)-(%s):]", args[0], args[0], args[1]), nil
-		}
-
-	case "CHARINDEX":
-		t.imports["strings"] = true
-		if len(args) >= 2 {
-			// CHARINDEX(substring, string [, start_position])
-			// returns 0 if not found, 1-based index otherwise
-			// strings.Index returns -1 if not found, 0-based index otherwise
-			if len(args) == 3 {
-				// With start position: need to slice string and adjust result
-				// CHARINDEX(@sub, @str, @start) where @start is 1-based
-				// = strings.Index(@str[@start-1:], @sub) + @start (if found), else 0
-				return fmt.Sprintf("func() int32 { idx := strings.Index((%s)[int(%s)-1:], %s); if idx < 0 { return 0 }; return int32(idx) + %s }()", 
-					args[1], args[2], args[0], args[2]), nil
-			}
-			return fmt.Sprintf("int32(strings.Index(%s, %s) + 1)", args[1], args[0]), nil
+	case "SUBSTRING", "LEFT", "RIGHT", "STUFF", "CHARINDEX", "PATINDEX", "REPLICATE", "SPACE", "REVERSE",
+		"TRANSLATE", "QUOTENAME", "FORMATMESSAGE":
+		if code, ok, err := t.transpileStringFunction(funcName, fc, args); ok || err != nil {
+			return code, err
 		}
 
 	case "ASCII":
@@ -974,19 +987,15 @@ func (t *transpiler) transpileFunctionCall(fc *ast.FunctionCall) (string, error)
 			return fmt.Sprintf("strings.ReplaceAll(%s, %s, %s)", args[0], args[1], args[2]), nil
 		}
 
-	case "REPLICATE":
-		t.imports["strings"] = true
-		if len(args) == 2 {
-			return fmt.Sprintf("strings.Repeat(%s, %s)", args[0], args[1]), nil
-		}
-
-	case "REVERSE":
-		// Go doesn't have a built-in reverse; we'd need a helper function
-		// For now, mark as needing runtime support
-		return "", fmt.Errorf("REVERSE function requires runtime helper (not yet implemented)")
-
 	case "CONCAT":
-		// CONCAT in T-SQL ignores NULLs; in Go we just concatenate
+		// CONCAT in T-SQL ignores NULLs and converts its arguments to
+		// strings; in Go we just concatenate
+		for i, arg := range fc.Arguments {
+			if ti := t.inferType(arg); ti != nil && !ti.isString {
+				t.imports["fmt"] = true
+				args[i] = fmt.Sprintf("fmt.Sprint(%s)", args[i])
+			}
+		}
 		return fmt.Sprintf("(%s)", strings.Join(args, " + ")), nil
 
 	case "CONCAT_WS":
@@ -999,6 +1008,9 @@ func (t *transpiler) transpileFunctionCall(fc *ast.FunctionCall) (string, error)
 		// ISNULL(a, b) -> returns a if not null, else b
 		// For strings: check if empty
 		// For value types: use the value (Go doesn't have null for value types)
+		if name, ti, ok := t.nullableVariable(fc.Arguments[0]); ok && len(args) == 2 {
+			return t.nullCoalesce(name, ti, fc.Arguments[1], args[1]), nil
+		}
 		if len(args) == 2 {
 			argType := t.inferType(fc.Arguments[0])
 			if argType != nil && argType.isString {
@@ -1010,15 +1022,16 @@ func (t *transpiler) transpileFunctionCall(fc *ast.FunctionCall) (string, error)
 			}
 			if argType != nil && argType.isDecimal {
 				// For decimal, check if zero
-				// If second arg is literal 0, use decimal.Zero
-				// If second arg is a float literal, convert to decimal using RequireFromString
+				// A literal 0 default is the decimal zero; other literals
+				// are converted exactly
 				defaultVal := args[1]
 				if defaultVal == "0" || defaultVal == "0.0" {
-					defaultVal = "decimal.Zero"
-				} else if isFloatLiteral(defaultVal) {
-					defaultVal = fmt.Sprintf("decimal.RequireFromString(\"%s\")", defaultVal)
+					defaultVal = t.decimalZero()
+				} else if isFloatLiteral(defaultVal) || isIntegerLiteral(fc.Arguments[1]) {
+					defaultVal = t.ensureDecimal(fc.Arguments[1], defaultVal)
 				}
-				return fmt.Sprintf("func() decimal.Decimal { if !%s.IsZero() { return %s }; return %s }()", args[0], args[0], defaultVal), nil
+				return fmt.Sprintf("func() %s { if %s { return %s }; return %s }()", argType.goType,
+					t.decimalIsZero(args[0], true), args[0], defaultVal), nil
 			}
 			if argType != nil && argType.isBool {
 				// For bool, just use the value (no null concept for bool in Go)
@@ -1040,12 +1053,20 @@ func (t *transpiler) transpileFunctionCall(fc *ast.FunctionCall) (string, error)
 	case "COALESCE":
 		// COALESCE returns first non-null value
 		// For strings: return first non-empty, or last value as default
+		if name, ti, ok := t.nullableVariable(fc.Arguments[0]); ok && len(args) == 2 {
+			return t.nullCoalesce(name, ti, fc.Arguments[1], args[1]), nil
+		}
 		if len(args) > 0 {
 			argType := t.inferType(fc.Arguments[0])
-			if argType.isString && len(args) == 2 {
+			if argType.isString && len(args) == 2 && !t.nullModeKeepsNull() {
 				return fmt.Sprintf("func() string { if %s != \"\" { return %s }; return %s }()", args[0], args[0], args[1]), nil
 			}
-			// For other types or >2 args, return first value (simplified)
+			if len(args) >= 2 {
+				if code, ok := t.coalesce(fc, args); ok {
+					return code, nil
+				}
+			}
+			// For unknown types, return first value (simplified)
 			return args[0], nil
 		}
 
@@ -1059,7 +1080,7 @@ func (t *transpiler) transpileFunctionCall(fc *ast.FunctionCall) (string, error)
 		if len(args) == 1 {
 			argType := t.inferType(fc.Arguments[0])
 			if argType.isDecimal {
-				return fmt.Sprintf("%s.Abs()", args[0]), nil
+				return t.decimalFunc("Abs", args[0]), nil
 			}
 			t.imports["math"] = true
 			return fmt.Sprintf("math.Abs(float64(%s))", args[0]), nil
@@ -1069,7 +1090,7 @@ func (t *transpiler) transpileFunctionCall(fc *ast.FunctionCall) (string, error)
 		if len(args) == 1 {
 			argType := t.inferType(fc.Arguments[0])
 			if argType.isDecimal {
-				return fmt.Sprintf("%s.Ceil()", args[0]), nil
+				return t.decimalFunc("Ceil", args[0]), nil
 			}
 			t.imports["math"] = true
 			return fmt.Sprintf("math.Ceil(float64(%s))", args[0]), nil
@@ -1079,34 +1100,43 @@ func (t *transpiler) transpileFunctionCall(fc *ast.FunctionCall) (string, error)
 		if len(args) == 1 {
 			argType := t.inferType(fc.Arguments[0])
 			if argType.isDecimal {
-				return fmt.Sprintf("%s.Floor()", args[0]), nil
+				return t.decimalFunc("Floor", args[0]), nil
 			}
 			t.imports["math"] = true
 			return fmt.Sprintf("math.Floor(float64(%s))", args[0]), nil
 		}
 
 	case "ROUND":
+		// ROUND(x, length [, function]) - T-SQL semantics live in tsqlruntime
 		if len(args) >= 1 {
+			rest := []string{"0"}
+			if len(args) >= 2 {
+				rest = []string{t.intArg(fc.Arguments[1], args[1])}
+			}
+			if len(args) == 3 {
+				rest = append(rest, t.intArg(fc.Arguments[2], args[2]))
+			}
 			argType := t.inferType(fc.Arguments[0])
 			if argType.isDecimal {
-				if len(args) == 1 {
-					return fmt.Sprintf("%s.Round(0)", args[0]), nil
-				}
-				return fmt.Sprintf("%s.Round(%s)", args[0], args[1]), nil
+				return t.decimalRound(args[0], rest), nil
 			}
-			t.imports["math"] = true
-			if len(args) == 1 {
-				return fmt.Sprintf("math.Round(%s)", args[0]), nil
+			t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+			value := args[0]
+			if argType.goType != "float64" && !isFloatLiteral(value) {
+				value = fmt.Sprintf("float64(%s)", value)
 			}
-			// ROUND(x, decimals) - more complex
-			return fmt.Sprintf("math.Round(%s*math.Pow(10, float64(%s)))/math.Pow(10, float64(%s))", args[0], args[1], args[1]), nil
+			return fmt.Sprintf("tsqlruntime.Round(%s, %s)", value, strings.Join(rest, ", ")), nil
 		}
 
 	case "POWER":
 		if len(args) == 2 {
 			argType := t.inferType(fc.Arguments[0])
 			if argType.isDecimal {
-				return fmt.Sprintf("%s.Pow(decimal.NewFromInt(int64(%s)))", args[0], args[1]), nil
+				if t.decimalMode() == DecimalShopspring {
+					return fmt.Sprintf("%s.Pow(decimal.NewFromInt(int64(%s)))", args[0], args[1]), nil
+				}
+				t.imports["math"] = true
+				return t.decimalFromFloat(fmt.Sprintf("math.Pow(%s, float64(%s))", t.decimalToFloat(args[0]), args[1])), nil
 			}
 			t.imports["math"] = true
 			return fmt.Sprintf("math.Pow(float64(%s), float64(%s))", args[0], args[1]), nil
@@ -1118,8 +1148,7 @@ func (t *transpiler) transpileFunctionCall(fc *ast.FunctionCall) (string, error)
 			if argType.isDecimal {
 				// decimal doesn't have Sqrt, convert to float and back
 				t.imports["math"] = true
-				t.imports["github.com/shopspring/decimal"] = true
-				return fmt.Sprintf("decimal.NewFromFloat(math.Sqrt(%s.InexactFloat64()))", args[0]), nil
+				return t.decimalFromFloat(fmt.Sprintf("math.Sqrt(%s)", t.decimalToFloat(args[0]))), nil
 			}
 			t.imports["math"] = true
 			return fmt.Sprintf("math.Sqrt(float64(%s))", args[0]), nil
@@ -1131,28 +1160,45 @@ func (t *transpiler) transpileFunctionCall(fc *ast.FunctionCall) (string, error)
 			return fmt.Sprintf("int(math.Copysign(1, float64(%s)))", args[0]), nil
 		}
 
-	case "GETDATE", "SYSDATETIME", "CURRENT_TIMESTAMP":
-		t.imports["time"] = true
-		return "time.Now()", nil
+	case "GETDATE", "SYSDATETIME", "SYSDATETIMEOFFSET", "CURRENT_TIMESTAMP", "GETUTCDATE", "SYSUTCDATETIME":
+		return t.timeNow(funcName), nil
 
-	case "GETUTCDATE", "SYSUTCDATETIME":
-		t.imports["time"] = true
-		return "time.Now().UTC()", nil
+	case "SWITCHOFFSET", "TODATETIMEOFFSET":
+		return t.transpileOffsetFunc(funcName, args)
 
 	case "DATEADD":
 		// DATEADD(interval, number, date)
-		t.imports["time"] = true
 		if len(args) == 3 {
-			interval := strings.Trim(args[0], "\"")
-			return t.transpileDateAdd(interval, args[1], args[2])
+			return t.transpileDateAdd(fc, args)
 		}
 
-	case "DATEDIFF":
+	case "DATEDIFF", "DATEDIFF_BIG":
 		// DATEDIFF(interval, start, end)
-		t.imports["time"] = true
 		if len(args) == 3 {
-			interval := strings.Trim(args[0], "\"")
-			return t.transpileDateDiff(interval, args[1], args[2])
+			return t.transpileDateDiff(funcName, fc.Arguments[0], args[1], args[2])
+		}
+
+	case "EOMONTH":
+		// EOMONTH(date [, months])
+		t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+		if len(args) == 1 {
+			return fmt.Sprintf("tsqlruntime.EOMonth(%s)", args[0]), nil
+		}
+		if len(args) == 2 {
+			return fmt.Sprintf("tsqlruntime.EOMonth(%s, %s)", args[0], t.intArg(fc.Arguments[1], args[1])), nil
+		}
+
+	case "DATEFROMPARTS":
+		t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+		if len(args) == 3 {
+			return fmt.Sprintf("tsqlruntime.DateFromParts(%s, %s, %s)",
+				t.intArg(fc.Arguments[0], args[0]), t.intArg(fc.Arguments[1], args[1]), t.intArg(fc.Arguments[2], args[2])), nil
+		}
+
+	case "ISNUMERIC":
+		t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+		if len(args) == 1 {
+			return fmt.Sprintf("tsqlruntime.IsNumeric(%s)", args[0]), nil
 		}
 
 	case "YEAR":
@@ -1173,27 +1219,36 @@ func (t *transpiler) transpileFunctionCall(fc *ast.FunctionCall) (string, error)
 			return fmt.Sprintf("%s.Day()", wrapForMethodCall(args[0])), nil
 		}
 
-	case "DATEPART":
+	case "DATEPART", "DATENAME":
 		// DATEPART(interval, date)
-		t.imports["time"] = true
 		if len(args) == 2 {
-			interval := strings.ToLower(strings.Trim(args[0], "\""))
-			return t.transpileDatePart(interval, args[1])
+			return t.transpileDatePart(funcName, fc.Arguments[0], args[1])
+		}
+
+	case "FORMAT":
+		// FORMAT(value, format [, culture])
+		if len(args) >= 2 {
+			return t.transpileFormat(fc, args)
 		}
 
 	case "NEWID":
 		return t.transpileNewid()
 
+	case "GREATEST", "LEAST":
+		if len(args) >= 1 {
+			return t.transpileGreatestLeast(fc, args, funcName == "GREATEST"), nil
+		}
+
 	case "IIF":
 		// IIF(condition, true_value, false_value)
 		if len(args) == 3 {
 			return fmt.Sprintf("func() any { if %s { return %s }; return %s }()", args[0], args[1], args[2]), nil
 		}
 
-	// Error functions for TRY/CATCH - _tryErr is set in the CATCH block
+	// Error functions for TRY/CATCH - caughtErr() is set in the CATCH block
 	case "ERROR_MESSAGE":
-		// _tryErr is the error from the TRY block
-		return "_tryErr.Error()", nil
+		// The error from the TRY block
+		return t.caughtErr() + ".Error()", nil
 
 	case "ERROR_NUMBER":
 		// No direct equivalent in Go - return 0
@@ -1252,77 +1307,6 @@ func (t *transpiler) transpileFunctionCall(fc *ast.FunctionCall) (string, error)
 	return fmt.Sprintf("%s(%s)", goExportedIdentifier(funcName), strings.Join(args, ", ")), nil
 }
 
-func (t *transpiler) transpileDateAdd(interval, number, date string) (string, error) {
-	interval = strings.ToUpper(interval)
-	dateW := wrapForMethodCall(date)
-	switch interval {
-	case "YEAR", "YY", "YYYY":
-		return fmt.Sprintf("%s.AddDate(%s, 0, 0)", dateW, number), nil
-	case "MONTH", "MM", "M":
-		return fmt.Sprintf("%s.AddDate(0, %s, 0)", dateW, number), nil
-	case "DAY", "DD", "D":
-		return fmt.Sprintf("%s.AddDate(0, 0, %s)", dateW, number), nil
-	case "HOUR", "HH":
-		return fmt.Sprintf("%s.Add(time.Duration(%s) * time.Hour)", dateW, number), nil
-	case "MINUTE", "MI", "N":
-		return fmt.Sprintf("%s.Add(time.Duration(%s) * time.Minute)", dateW, number), nil
-	case "SECOND", "SS", "S":
-		return fmt.Sprintf("%s.Add(time.Duration(%s) * time.Second)", dateW, number), nil
-	default:
-		return "", fmt.Errorf("unsupported DATEADD interval: %s", interval)
-	}
-}
-
-func (t *transpiler) transpileDateDiff(interval, start, end string) (string, error) {
-	interval = strings.ToUpper(interval)
-	startW := wrapForMethodCall(start)
-	endW := wrapForMethodCall(end)
-	switch interval {
-	case "YEAR", "YY", "YYYY":
-		return fmt.Sprintf("(%s.Year() - %s.Year())", endW, startW), nil
-	case "MONTH", "MM", "M":
-		return fmt.Sprintf("((%s.Year()-%s.Year())*12 + int(%s.Month()) - int(%s.Month()))", endW, startW, endW, startW), nil
-	case "DAY", "DD", "D":
-		return fmt.Sprintf("int(%s.Sub(%s).Hours() / 24)", endW, startW), nil
-	case "HOUR", "HH":
-		return fmt.Sprintf("int(%s.Sub(%s).Hours())", endW, startW), nil
-	case "MINUTE", "MI", "N":
-		return fmt.Sprintf("int(%s.Sub(%s).Minutes())", endW, startW), nil
-	case "SECOND", "SS", "S":
-		return fmt.Sprintf("int(%s.Sub(%s).Seconds())", endW, startW), nil
-	default:
-		return "", fmt.Errorf("unsupported DATEDIFF interval: %s", interval)
-	}
-}
-
-func (t *transpiler) transpileDatePart(interval, date string) (string, error) {
-	dateW := wrapForMethodCall(date)
-	switch strings.ToUpper(interval) {
-	case "YEAR", "YY", "YYYY":
-		return fmt.Sprintf("int32(%s.Year())", dateW), nil
-	case "MONTH", "MM", "M":
-		return fmt.Sprintf("int32(%s.Month())", dateW), nil
-	case "DAY", "DD", "D":
-		return fmt.Sprintf("int32(%s.Day())", dateW), nil
-	case "HOUR", "HH":
-		return fmt.Sprintf("int32(%s.Hour())", dateW), nil
-	case "MINUTE", "MI", "N":
-		return fmt.Sprintf("int32(%s.Minute())", dateW), nil
-	case "SECOND", "SS", "S":
-		return fmt.Sprintf("int32(%s.Second())", dateW), nil
-	case "WEEKDAY", "DW", "W":
-		// T-SQL: Sunday=1, Monday=2, ... Saturday=7
-		// Go: Sunday=0, Monday=1, ... Saturday=6
-		return fmt.Sprintf("int32(%s.Weekday() + 1)", dateW), nil
-	case "DAYOFYEAR", "DY", "Y":
-		return fmt.Sprintf("int32(%s.YearDay())", dateW), nil
-	case "QUARTER", "QQ", "Q":
-		return fmt.Sprintf("int32((%s.Month()-1)/3 + 1)", dateW), nil
-	default:
-		return "", fmt.Errorf("unsupported DATEPART interval: %s", interval)
-	}
-}
-
 func (t *transpiler) transpileCaseExpression(c *ast.CaseExpression) (string, error) {
 	var out strings.Builder
 
@@ -1423,7 +1407,7 @@ func (t *transpiler) inferExpressionType(expr ast.Expression) string {
 	case *ast.Variable:
 		// Look up variable type from symbols
 		varName := strings.TrimPrefix(e.Name, "@")
-		if sym := t.symbols.lookup(varName); sym != nil {
+		if sym := t.symbols.lookup(goIdentifier(varName)); sym != nil {
 			return sym.goType
 		}
 		// Infer from name patterns
@@ -1431,8 +1415,8 @@ func (t *transpiler) inferExpressionType(expr ast.Expression) string {
 		if strings.Contains(upperName, "DECIMAL") || strings.Contains(upperName, "AMOUNT") ||
 			strings.Contains(upperName, "PRICE") || strings.Contains(upperName, "TOTAL") ||
 			strings.Contains(upperName, "COST") {
-			t.imports["github.com/shopspring/decimal"] = true
-			return "decimal.Decimal"
+			t.importDecimal()
+			return t.decimalType()
 		}
 		return "any"
 	case *ast.InfixExpression:
@@ -1441,9 +1425,9 @@ func (t *transpiler) inferExpressionType(expr ast.Expression) string {
 		rightType := t.inferExpressionType(e.Right)
 		
 		// If either is decimal, result is decimal
-		if leftType == "decimal.Decimal" || rightType == "decimal.Decimal" {
-			t.imports["github.com/shopspring/decimal"] = true
-			return "decimal.Decimal"
+		if t.isDecimalType(leftType) || t.isDecimalType(rightType) {
+			t.importDecimal()
+			return t.decimalType()
 		}
 		// If either is float, result is float
 		if leftType == "float64" || rightType == "float64" {
@@ -1474,8 +1458,8 @@ func (t *transpiler) inferExpressionType(expr ast.Expression) string {
 	// Use existing inferType for declared variables
 	typeInfo := t.inferType(expr)
 	if typeInfo.isDecimal {
-		t.imports["github.com/shopspring/decimal"] = true
-		return "decimal.Decimal"
+		t.importDecimal()
+		return t.decimalType()
 	}
 	if typeInfo.isNumeric {
 		// Check if it's a float type by looking at goType
@@ -1496,6 +1480,9 @@ func (t *transpiler) inferExpressionType(expr ast.Expression) string {
 
 // zeroValueFor returns the zero value for a Go type
 func (t *transpiler) zeroValueFor(goType string) string {
+	if t.isDecimalType(goType) {
+		return t.decimalZero()
+	}
 	switch goType {
 	case "int32", "int64", "int":
 		return "0"
@@ -1505,9 +1492,6 @@ func (t *transpiler) zeroValueFor(goType string) string {
 		return `""`
 	case "bool":
 		return "false"
-	case "decimal.Decimal":
-		t.imports["github.com/shopspring/decimal"] = true
-		return "decimal.Zero"
 	default:
 		return "nil"
 	}
@@ -1527,6 +1511,11 @@ func (t *transpiler) transpileCastExpression(c *ast.CastExpression) (string, err
 	// Get source type to handle string-to-numeric conversions
 	sourceType := t.inferType(c.Expression)
 
+	// Decimal targets depend on the decimal mode
+	if t.typeInfoFromDataType(c.TargetType).isDecimal {
+		return t.castToDecimal(c.Expression, expr, sourceType), nil
+	}
+
 	// Handle string-to-numeric conversions (need strconv)
 	if sourceType.isString {
 		switch goType {
@@ -1541,9 +1530,6 @@ func (t *transpiler) transpileCastExpression(c *ast.CastExpression) (string, err
 		case "float64":
 			t.imports["strconv"] = true
 			return fmt.Sprintf("func() float64 { v, _ := strconv.ParseFloat(%s, 64); return v }()", expr), nil
-		case "decimal.Decimal":
-			t.imports["github.com/shopspring/decimal"] = true
-			return fmt.Sprintf("decimal.RequireFromString(%s)", expr), nil
 		case "bool":
 			t.imports["strings"] = true
 			// Handle "true", "false", "1", "0" string values
@@ -1559,16 +1545,20 @@ func (t *transpiler) transpileCastExpression(c *ast.CastExpression) (string, err
 	if sourceType.isDecimal {
 		switch goType {
 		case "int32":
-			return fmt.Sprintf("int32(%s.IntPart())", expr), nil
+			return fmt.Sprintf("int32(%s)", t.decimalToInt(expr)), nil
 		case "int64":
-			return fmt.Sprintf("%s.IntPart()", expr), nil
+			return t.decimalToInt(expr), nil
 		case "float64":
-			return fmt.Sprintf("%s.InexactFloat64()", expr), nil
+			return t.decimalToFloat(expr), nil
 		case "string":
-			return fmt.Sprintf("%s.String()", expr), nil
+			return t.decimalToString(expr), nil
 		}
 	}
 
+	if sourceType.isDateTime && !sourceType.nullable && goType == "string" {
+		return t.formatDateTime(expr, nil)
+	}
+
 	// Simple type conversion for non-string sources
 	switch goType {
 	case "string":
@@ -1580,16 +1570,6 @@ func (t *transpiler) transpileCastExpression(c *ast.CastExpression) (string, err
 		return fmt.Sprintf("int64(%s)", expr), nil
 	case "float64":
 		return fmt.Sprintf("float64(%s)", expr), nil
-	case "decimal.Decimal":
-		t.imports["github.com/shopspring/decimal"] = true
-		// For literals, use RequireFromString to avoid float64 precision loss
-		if _, ok := c.Expression.(*ast.FloatLiteral); ok {
-			return fmt.Sprintf("decimal.RequireFromString(\"%s\")", expr), nil
-		}
-		if _, ok := c.Expression.(*ast.IntegerLiteral); ok {
-			return fmt.Sprintf("decimal.NewFromInt(%s)", expr), nil
-		}
-		return fmt.Sprintf("decimal.NewFromFloat(float64(%s))", expr), nil
 	default:
 		return fmt.Sprintf("%s(%s)", goType, expr), nil
 	}
@@ -1610,6 +1590,11 @@ func (t *transpiler) transpileConvertExpression(c *ast.ConvertExpression) (strin
 	// Get source type to handle string-to-numeric conversions
 	sourceType := t.inferType(c.Expression)
 
+	// Decimal targets depend on the decimal mode
+	if t.typeInfoFromDataType(c.TargetType).isDecimal {
+		return t.castToDecimal(c.Expression, expr, sourceType), nil
+	}
+
 	// Handle string-to-numeric conversions (need strconv)
 	if sourceType.isString {
 		switch goType {
@@ -1622,9 +1607,6 @@ func (t *transpiler) transpileConvertExpression(c *ast.ConvertExpression) (strin
 		case "float64":
 			t.imports["strconv"] = true
 			return fmt.Sprintf("func() float64 { v, _ := strconv.ParseFloat(%s, 64); return v }()", expr), nil
-		case "decimal.Decimal":
-			t.imports["github.com/shopspring/decimal"] = true
-			return fmt.Sprintf("decimal.RequireFromString(%s)", expr), nil
 		}
 	}
 
@@ -1632,17 +1614,21 @@ func (t *transpiler) transpileConvertExpression(c *ast.ConvertExpression) (strin
 	if sourceType.isDecimal {
 		switch goType {
 		case "int32":
-			return fmt.Sprintf("int32(%s.IntPart())", expr), nil
+			return fmt.Sprintf("int32(%s)", t.decimalToInt(expr)), nil
 		case "int64":
-			return fmt.Sprintf("%s.IntPart()", expr), nil
+			return t.decimalToInt(expr), nil
 		case "float64":
-			return fmt.Sprintf("%s.InexactFloat64()", expr), nil
+			return t.decimalToFloat(expr), nil
 		case "string":
-			return fmt.Sprintf("%s.String()", expr), nil
+			return t.decimalToString(expr), nil
 		}
 	}
 
-	// Style parameter is ignored for now
+	if sourceType.isDateTime && !sourceType.nullable && goType == "string" {
+		return t.formatDateTime(expr, c.Style)
+	}
+
+	// Style parameter is ignored for other conversions
 	switch goType {
 	case "string":
 		t.imports["fmt"] = true
@@ -1653,21 +1639,28 @@ func (t *transpiler) transpileConvertExpression(c *ast.ConvertExpression) (strin
 		return fmt.Sprintf("int64(%s)", expr), nil
 	case "float64":
 		return fmt.Sprintf("float64(%s)", expr), nil
-	case "decimal.Decimal":
-		t.imports["github.com/shopspring/decimal"] = true
-		// For literals, use RequireFromString to avoid float64 precision loss
-		if _, ok := c.Expression.(*ast.FloatLiteral); ok {
-			return fmt.Sprintf("decimal.RequireFromString(\"%s\")", expr), nil
-		}
-		if _, ok := c.Expression.(*ast.IntegerLiteral); ok {
-			return fmt.Sprintf("decimal.NewFromInt(%s)", expr), nil
-		}
-		return fmt.Sprintf("decimal.NewFromFloat(float64(%s))", expr), nil
 	default:
 		return fmt.Sprintf("%s(%s)", goType, expr), nil
 	}
 }
 
+// formatDateTime returns the string CONVERT gives for expr, a time.Time,
+// with style, or with CAST's style when style is nil.
+func (t *transpiler) formatDateTime(expr string, style ast.Expression) (string, error) {
+	t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+	goStyle := "0"
+	if lit, ok := style.(*ast.IntegerLiteral); ok {
+		goStyle = fmt.Sprint(lit.Value)
+	} else if style != nil {
+		s, err := t.transpileExpression(style)
+		if err != nil {
+			return "", err
+		}
+		goStyle = fmt.Sprintf("int(%s)", s)
+	}
+	return fmt.Sprintf("tsqlruntime.FormatDateTime(%s, %s)", expr, goStyle), nil
+}
+
 func (t *transpiler) transpileIsNullExpression(e *ast.IsNullExpression) (string, error) {
 	// Special case: OBJECT_ID('tempdb..#tableName') IS [NOT] NULL
 	// Can be simplified to just tempTables.TempTableExists("#tableName")
@@ -1692,6 +1685,14 @@ func (t *transpiler) transpileIsNullExpression(e *ast.IsNullExpression) (string,
 		}
 	}
 
+	if name, _, ok := t.nullableVariable(e.Expr); ok {
+		t.symbols.markUsed(name)
+		if e.Not {
+			return t.nullValid(name), nil
+		}
+		return t.nullInvalid(name), nil
+	}
+
 	expr, err := t.transpileExpression(e.Expr)
 	if err != nil {
 		return "", err
@@ -1718,10 +1719,7 @@ func (t *transpiler) transpileIsNullExpression(e *ast.IsNullExpression) (string,
 	
 	// For decimal types, use IsZero() method
 	if exprType != nil && exprType.isDecimal {
-		if e.Not {
-			return fmt.Sprintf("!%s.IsZero()", expr), nil
-		}
-		return fmt.Sprintf("%s.IsZero()", expr), nil
+		return t.decimalIsZero(expr, e.Not), nil
 	}
 	
 	// For numeric types (int32, int64, float64, etc.), use zero comparison
@@ -1748,24 +1746,31 @@ func (t *transpiler) transpileIsNullExpression(e *ast.IsNullExpression) (string,
 	return fmt.Sprintf("%s == nil", expr), nil
 }
 
+// transpileBetweenExpression turns BETWEEN into the two comparisons, made
+// as the infix operators make them so decimals and times compare by their
+// methods. A NULL value is neither between nor outside the range.
 func (t *transpiler) transpileBetweenExpression(e *ast.BetweenExpression) (string, error) {
-	expr, err := t.transpileExpression(e.Expr)
-	if err != nil {
-		return "", err
+	compare := func(op string, bound ast.Expression) (string, error) {
+		return t.transpileInfix(&ast.InfixExpression{Token: e.Token, Left: e.Expr, Operator: op, Right: bound})
 	}
-	low, err := t.transpileExpression(e.Low)
+	lowOp, highOp, join := ">=", "<=", "&&"
+	if e.Not {
+		lowOp, highOp, join = "<", ">", "||"
+	}
+	low, err := compare(lowOp, e.Low)
 	if err != nil {
 		return "", err
 	}
-	high, err := t.transpileExpression(e.High)
+	high, err := compare(highOp, e.High)
 	if err != nil {
 		return "", err
 	}
 
-	if e.Not {
-		return fmt.Sprintf("(%s < %s || %s > %s)", expr, low, expr, high), nil
+	result := fmt.Sprintf("(%s %s %s)", low, join, high)
+	if name, _, ok := t.nullableVariable(e.Expr); ok {
+		result = fmt.Sprintf("(%s && %s)", t.nullValid(name), result)
 	}
-	return fmt.Sprintf("(%s >= %s && %s <= %s)", expr, low, expr, high), nil
+	return result, nil
 }
 
 func (t *transpiler) transpileInExpression(e *ast.InExpression) (string, error) {
@@ -1774,6 +1779,10 @@ func (t *transpiler) transpileInExpression(e *ast.InExpression) (string, error)
 		return "", err
 	}
 
+	if e.Subquery != nil {
+		return t.transpileInSubquery(e, expr)
+	}
+
 	// Optimization: NOT IN (single_value) -> expr != value
 	if e.Not && len(e.Values) == 1 {
 		v, err := t.transpileExpression(e.Values[0])
@@ -1809,9 +1818,102 @@ func (t *transpiler) transpileInExpression(e *ast.InExpression) (string, error)
 	return result, nil
 }
 
+// transpileInSubquery handles expr IN (SELECT ...). A column of a
+// table-valued parameter is searched for in the parameter's slice; other
+// subqueries go to the database, with NOT IN kept in SQL so a NULL in the
+// subquery makes it false, as in T-SQL.
+func (t *transpiler) transpileInSubquery(e *ast.InExpression, expr string) (string, error) {
+	if !t.dmlEnabled {
+		return "", fmt.Errorf("IN (SELECT ...) not supported in procedural transpilation")
+	}
+	if p, col, ok := t.tableParamList(e.Subquery); ok {
+		return t.tableParamContains(e, expr, p, col)
+	}
+
+	sql := t.removeTableHints(e.Subquery.String())
+	query, args := t.substituteVariablesForExists(sql)
+	value := getPlaceholderForDialect(t.dmlConfig.SQLDialect, len(args)+1)
+	if value == "?" {
+		args = append([]string{expr}, args...)
+	} else {
+		args = append(args, expr)
+	}
+	op := "IN"
+	if e.Not {
+		op = "NOT IN"
+	}
+	t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+	return fmt.Sprintf("tsqlruntime.QueryExists(ctx, %s, %q, %s)", t.dmlConfig.StoreVar,
+		fmt.Sprintf("SELECT 1 WHERE %s %s (%s)", value, op, query), strings.Join(args, ", ")), nil
+}
+
+// tableParamList returns the table-valued parameter and column a subquery
+// selects with nothing else, as in SELECT ProductID FROM @Items.
+func (t *transpiler) tableParamList(s *ast.SelectStatement) (*tableParam, TableTypeColumn, bool) {
+	if s == nil || len(s.Columns) != 1 || s.From == nil || len(s.From.Tables) != 1 ||
+		s.Where != nil || s.GroupBy != nil || s.Having != nil || s.Top != nil {
+		return nil, TableTypeColumn{}, false
+	}
+	names := tableRefNames(s.From.Tables[0])
+	if len(names) != 1 {
+		return nil, TableTypeColumn{}, false
+	}
+	p, ok := t.tableParamFor(names[0])
+	if !ok {
+		return nil, TableTypeColumn{}, false
+	}
+	name, ok := tableParamColumn(s.Columns[0].Expression, p)
+	if !ok {
+		return nil, TableTypeColumn{}, false
+	}
+	for _, col := range p.typ.Columns {
+		if col.Name == name {
+			return p, col, true
+		}
+	}
+	return nil, TableTypeColumn{}, false
+}
+
+// tableParamContains searches the slice of a table-valued parameter for
+// expr in column col.
+func (t *transpiler) tableParamContains(e *ast.InExpression, expr string, p *tableParam, col TableTypeColumn) (string, error) {
+	goType, err := t.mapDataType(col.Type)
+	if err != nil {
+		return "", err
+	}
+	if col.Nullable {
+		return "", fmt.Errorf("IN (SELECT %s FROM @%s): column %s is nullable; only NOT NULL columns are searched in Go", col.Name, p.name, col.Name)
+	}
+	field := "row." + goExportedIdentifier(col.Name)
+	// Numbers of different types are compared as the wider type
+	if info := t.inferType(e.Expr); info.goType != goType && info.isNumeric && !info.isDecimal && goType != "decimal.Decimal" {
+		if info.goType == "int64" || info.goType == "float64" {
+			field = fmt.Sprintf("%s(%s)", info.goType, field)
+		} else {
+			expr = fmt.Sprintf("%s(%s)", goType, expr)
+		}
+	}
+	match := fmt.Sprintf("%s == %s", field, expr)
+	if goType == "decimal.Decimal" {
+		match = fmt.Sprintf("%s.Equal(%s)", field, expr)
+	}
+	t.imports["slices"] = true
+	t.symbols.markUsed(p.goVar)
+	check := fmt.Sprintf("slices.ContainsFunc(%s, func(row %s) bool { return %s })", p.goVar, tableTypeGoName(p.typ), match)
+	if e.Not {
+		check = "!" + check
+	}
+	return check, nil
+}
+
 // transpileMethodCallExpression handles XML method calls like @xml.value('/xpath', 'type')
 // and also user-defined function calls like dbo.fn_GenerateTransferNumber()
 func (t *transpiler) transpileMethodCallExpression(e *ast.MethodCallExpression) (string, error) {
+	// Methods of spatial and hierarchyid values (see spatial.go)
+	if clrType := t.inferType(e.Object).clrType; clrType != "" {
+		return t.transpileCLRMethod(e, clrType)
+	}
+
 	// Check if this is a user-defined function call (e.g., dbo.fn_MyFunction())
 	// The "Object" would be a schema name like "dbo" and "MethodName" is the function name
 	if id, ok := e.Object.(*ast.Identifier); ok {
@@ -1833,101 +1935,15 @@ func (t *transpiler) transpileMethodCallExpression(e *ast.MethodCallExpression)
 		}
 	}
 
-	// Get the object (variable) being called on
-	obj, err := t.transpileExpression(e.Object)
-	if err != nil {
-		return "", err
-	}
-
-	// Handle XML methods
-	switch strings.ToLower(e.MethodName) {
-	case "value":
-		// @xml.value('/xpath', 'type') -> XmlValueType(xml, "/xpath")
-		if len(e.Arguments) < 2 {
-			return "", fmt.Errorf("XML .value() requires 2 arguments (xpath, type)")
-		}
-		xpath, err := t.transpileExpression(e.Arguments[0])
-		if err != nil {
-			return "", err
+	// (SELECT ... FOR XML PATH(''), TYPE).value('.', ...) is a string aggregate
+	if isXMLValueOfSubquery(e) {
+		if code, ok := t.transpileXMLConcat(e); ok {
+			return code, nil
 		}
-		typeName, err := t.transpileExpression(e.Arguments[1])
-		if err != nil {
-			return "", err
-		}
-		
-		// Generate type-specific wrapper based on target type
-		typeUpper := strings.ToUpper(strings.Trim(typeName, "\"'"))
-		switch {
-		case strings.HasPrefix(typeUpper, "INT"):
-			t.imports["strconv"] = true
-			return fmt.Sprintf("func() int32 { s := XmlValueString(%s, %s); if s == \"\" { return 0 }; v, _ := strconv.ParseInt(s, 10, 32); return int32(v) }()", obj, xpath), nil
-		case strings.HasPrefix(typeUpper, "BIGINT"):
-			t.imports["strconv"] = true
-			return fmt.Sprintf("func() int64 { s := XmlValueString(%s, %s); if s == \"\" { return 0 }; v, _ := strconv.ParseInt(s, 10, 64); return v }()", obj, xpath), nil
-		case strings.HasPrefix(typeUpper, "BIT"):
-			t.imports["strings"] = true
-			return fmt.Sprintf("(XmlValueString(%s, %s) == \"1\" || strings.ToLower(XmlValueString(%s, %s)) == \"true\")", obj, xpath, obj, xpath), nil
-		case strings.HasPrefix(typeUpper, "DECIMAL") || strings.HasPrefix(typeUpper, "NUMERIC") || strings.HasPrefix(typeUpper, "MONEY"):
-			t.imports["github.com/shopspring/decimal"] = true
-			return fmt.Sprintf("func() decimal.Decimal { s := XmlValueString(%s, %s); if s == \"\" { return decimal.Zero }; v, _ := decimal.NewFromString(s); return v }()", obj, xpath), nil
-		case strings.HasPrefix(typeUpper, "FLOAT") || strings.HasPrefix(typeUpper, "REAL"):
-			t.imports["strconv"] = true
-			return fmt.Sprintf("func() float64 { s := XmlValueString(%s, %s); if s == \"\" { return 0 }; v, _ := strconv.ParseFloat(s, 64); return v }()", obj, xpath), nil
-		case strings.HasPrefix(typeUpper, "DATE") || strings.HasPrefix(typeUpper, "DATETIME") || strings.HasPrefix(typeUpper, "DATETIME2"):
-			t.imports["time"] = true
-			return fmt.Sprintf("func() time.Time { s := XmlValueString(%s, %s); if s == \"\" { return time.Time{} }; t, _ := time.Parse(\"2006-01-02\", s); return t }()", obj, xpath), nil
-		default:
-			// String types (NVARCHAR, VARCHAR, CHAR, etc.)
-			return fmt.Sprintf("XmlValueString(%s, %s)", obj, xpath), nil
-		}
-
-	case "query":
-		// @xml.query('/xpath') -> XmlQuery(xml, "/xpath")
-		if len(e.Arguments) < 1 {
-			return "", fmt.Errorf("XML .query() requires 1 argument (xpath)")
-		}
-		xpath, err := t.transpileExpression(e.Arguments[0])
-		if err != nil {
-			return "", err
-		}
-		return fmt.Sprintf("XmlQuery(%s, %s)", obj, xpath), nil
-
-	case "exist":
-		// @xml.exist('/xpath') -> XmlExist(xml, "/xpath")
-		if len(e.Arguments) < 1 {
-			return "", fmt.Errorf("XML .exist() requires 1 argument (xpath)")
-		}
-		xpath, err := t.transpileExpression(e.Arguments[0])
-		if err != nil {
-			return "", err
-		}
-		return fmt.Sprintf("XmlExist(%s, %s)", obj, xpath), nil
-
-	case "nodes":
-		// @xml.nodes('/xpath') -> XmlNodes(xml, "/xpath")
-		if len(e.Arguments) < 1 {
-			return "", fmt.Errorf("XML .nodes() requires 1 argument (xpath)")
-		}
-		xpath, err := t.transpileExpression(e.Arguments[0])
-		if err != nil {
-			return "", err
-		}
-		return fmt.Sprintf("XmlNodes(%s, %s)", obj, xpath), nil
-
-	case "modify":
-		// @xml.modify('...') -> XmlModify(xml, "...")
-		if len(e.Arguments) < 1 {
-			return "", fmt.Errorf("XML .modify() requires 1 argument (dml)")
-		}
-		dml, err := t.transpileExpression(e.Arguments[0])
-		if err != nil {
-			return "", err
-		}
-		return fmt.Sprintf("XmlModify(%s, %s)", obj, dml), nil
-
-	default:
-		return "", fmt.Errorf("unsupported method: %s", e.MethodName)
 	}
+
+	// Handle XML methods (see xmlmethods.go)
+	return t.transpileXMLMethod(e)
 }
 
 // transpileIdentityFunction handles SCOPE_IDENTITY() and @@IDENTITY
@@ -1944,51 +1960,16 @@ func (t *transpiler) transpileIdentityFunction() (string, error) {
 	case "stub":
 		return "0 /* TODO: implement SCOPE_IDENTITY() - capture LastInsertId() after INSERT */", nil
 	case "db", "":
-		// In database mode, SCOPE_IDENTITY() should use the result from the previous INSERT.
-		// The developer needs to capture result.LastInsertId() after their INSERT.
-		// We generate a variable reference that they need to set up.
+		// INSERTs read later keep their identity value (see identity.go)
+		if t.usesIdentity {
+			return "lastInsertID", nil
+		}
 		return "lastInsertId /* set this from result.LastInsertId() after INSERT */", nil
 	default:
 		return "lastInsertId /* set this from result.LastInsertId() after INSERT */", nil
 	}
 }
 
-// transpileNextValueFor handles NEXT VALUE FOR <sequence> expressions
-func (t *transpiler) transpileNextValueFor(seqName string) (string, error) {
-	if !t.dmlEnabled {
-		return "", fmt.Errorf("NEXT VALUE FOR requires DML mode")
-	}
-
-	switch t.dmlConfig.SequenceMode {
-	case "uuid":
-		t.imports["github.com/google/uuid"] = true
-		return "uuid.New().String()", nil
-	case "stub":
-		return fmt.Sprintf("0 /* TODO: implement NEXT VALUE FOR %s */", seqName), nil
-	case "db", "":
-		// Database-specific sequence handling
-		// Generate an inline query to fetch the next sequence value
-		switch t.dmlConfig.SQLDialect {
-		case "postgres":
-			// Postgres: SELECT nextval('sequence_name')
-			seqLower := strings.ToLower(seqName)
-			return fmt.Sprintf("func() int64 { var id int64; %s.QueryRowContext(ctx, \"SELECT nextval('%s')\").Scan(&id); return id }()",
-				t.dmlConfig.StoreVar, seqLower), nil
-		case "mysql":
-			// MySQL doesn't have sequences - use AUTO_INCREMENT
-			return fmt.Sprintf("0 /* MySQL: no sequences - use AUTO_INCREMENT and LastInsertId() after INSERT */"), nil
-		case "sqlserver":
-			// SQL Server: keep the expression for passthrough mode
-			return fmt.Sprintf("func() int64 { var id int64; %s.QueryRowContext(ctx, \"SELECT NEXT VALUE FOR %s\").Scan(&id); return id }()",
-				t.dmlConfig.StoreVar, seqName), nil
-		default:
-			return fmt.Sprintf("0 /* TODO: NEXT VALUE FOR %s - implement for dialect %s */", seqName, t.dmlConfig.SQLDialect), nil
-		}
-	default:
-		return fmt.Sprintf("0 /* TODO: NEXT VALUE FOR %s */", seqName), nil
-	}
-}
-
 // transpileNewid handles NEWID() based on the configured mode
 func (t *transpiler) transpileNewid() (string, error) {
 	if !t.dmlEnabled {
@@ -2049,6 +2030,120 @@ func (t *transpiler) transpileNewid() (string, error) {
 	}
 }
 
+// intArg adapts an integer argument for a tsqlruntime helper taking int.
+// Literals are untyped in Go and pass through; typed values are converted.
+func (t *transpiler) intArg(expr ast.Expression, transpiled string) string {
+	if isIntegerLiteral(expr) {
+		return transpiled
+	}
+	if ti := t.inferType(expr); ti != nil && ti.goType == "int" {
+		return transpiled
+	}
+	return fmt.Sprintf("int(%s)", transpiled)
+}
+
+// transpileGreatestLeast converts GREATEST/LEAST. Targets of Go 1.21 or
+// later use the min/max builtins; older targets get an inline loop.
+// Decimals and times aren't ordered types, so they use their own methods.
+func (t *transpiler) transpileGreatestLeast(fc *ast.FunctionCall, args []string, greatest bool) string {
+	// The widest argument type wins, as with T-SQL data type precedence
+	resultType := ""
+	isDecimal := false
+	for _, arg := range fc.Arguments {
+		ti := t.inferType(arg)
+		if ti == nil || ti.goType == "" || ti.goType == "any" || isLiteralExpr(arg) {
+			continue
+		}
+		if ti.isDecimal && !isDecimal {
+			resultType, isDecimal = ti.goType, true
+		} else if !isDecimal && (resultType == "" || typePrecedence(ti.goType) > typePrecedence(resultType)) {
+			resultType = ti.goType
+		}
+	}
+	if resultType == "" {
+		resultType = "float64"
+	}
+
+	converted := make([]string, len(args))
+	for i, arg := range fc.Arguments {
+		switch {
+		case isDecimal:
+			converted[i] = t.ensureDecimal(arg, args[i])
+		case isLiteralExpr(arg):
+			converted[i] = args[i]
+		case t.inferType(arg).goType != resultType:
+			converted[i] = fmt.Sprintf("%s(%s)", resultType, args[i])
+		default:
+			converted[i] = args[i]
+		}
+	}
+
+	if isDecimal {
+		return t.decimalMinMax(converted, greatest)
+	}
+	switch resultType {
+	case "time.Time":
+		cmp := "v.Before(m)"
+		if greatest {
+			cmp = "v.After(m)"
+		}
+		return fmt.Sprintf("func() time.Time { m := %s; for _, v := range []time.Time{%s} { if %s { m = v } }; return m }()",
+			converted[0], strings.Join(converted[1:], ", "), cmp)
+	}
+
+	if len(converted) == 1 {
+		return converted[0]
+	}
+	if t.goAtLeast(21) {
+		fn := "min"
+		if greatest {
+			fn = "max"
+		}
+		return fmt.Sprintf("%s(%s)", fn, strings.Join(converted, ", "))
+	}
+	op := "<"
+	if greatest {
+		op = ">"
+	}
+	first := converted[0]
+	if isLiteralExpr(fc.Arguments[0]) {
+		first = fmt.Sprintf("%s(%s)", resultType, first)
+	}
+	return fmt.Sprintf("func() %s { m := %s; for _, v := range []%s{%s} { if v %s m { m = v } }; return m }()",
+		resultType, first, resultType, strings.Join(converted[1:], ", "), op)
+}
+
+// typePrecedence ranks Go types for GREATEST/LEAST argument unification.
+func typePrecedence(goType string) int {
+	switch goType {
+	case "uint8":
+		return 1
+	case "int16":
+		return 2
+	case "int32":
+		return 3
+	case "int", "int64":
+		return 4
+	case "float32":
+		return 5
+	case "float64":
+		return 6
+	case "decimal.Decimal":
+		return 7
+	case "time.Time":
+		return 8
+	}
+	return 0
+}
+
+func isLiteralExpr(expr ast.Expression) bool {
+	switch expr.(type) {
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral:
+		return true
+	}
+	return false
+}
+
 // wrapForMethodCall wraps an expression in parentheses only if needed for method call chaining.
 // Simple expressions like "time.Now()" or variable names don't need wrapping.
 // Complex expressions with operators like "a + b" need wrapping to become "(a + b).Method()".
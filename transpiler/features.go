@@ -0,0 +1,253 @@
+package transpiler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ha1tch/tsqlparser"
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// Feature matrix
+//
+// FeatureMatrix lists, for each procedure, the T-SQL features that decide
+// how much work its migration is: cursors, temp tables, transactions,
+// dynamic SQL, XML, linked servers, TRY/CATCH and how many result sets it
+// returns. Like ProcedureUsage it only parses, so procedures the transpiler
+// can't handle yet are still listed, which is usually the point.
+
+// ProcedureFeatures is a procedure's row in the feature matrix.
+type ProcedureFeatures struct {
+	Procedure     string `json:"procedure"`
+	Cursors       bool   `json:"cursors"`
+	TempTables    bool   `json:"temp_tables"`    // #temp or ##global tables
+	Transactions  bool   `json:"transactions"`   // BEGIN/COMMIT/ROLLBACK/SAVE TRANSACTION
+	DynamicSQL    bool   `json:"dynamic_sql"`    // EXEC() or sp_executesql
+	XML           bool   `json:"xml"`            // XML variables, FOR XML, OPENXML or XML methods
+	LinkedServers bool   `json:"linked_servers"` // Four-part names, OPENQUERY/OPENROWSET/OPENDATASOURCE or EXEC ... AT
+	TryCatch      bool   `json:"try_catch"`
+	ResultSets    int    `json:"result_sets"` // SELECTs returning rows, counting every branch
+}
+
+// FeatureMatrix returns the features of each procedure in source.
+func FeatureMatrix(source string) ([]ProcedureFeatures, error) {
+	scans, err := scanFeatures(source)
+	if err != nil {
+		return nil, err
+	}
+	var matrix []ProcedureFeatures
+	for _, f := range scans {
+		matrix = append(matrix, f.features)
+	}
+	return matrix, nil
+}
+
+// scanFeatures scans each procedure in source.
+func scanFeatures(source string) ([]*featureScan, error) {
+	program, errors := tsqlparser.Parse(stripGoStatements(source))
+	if len(errors) > 0 {
+		return nil, fmt.Errorf("parse errors:\n%s", strings.Join(errors, "\n"))
+	}
+	return featureScans(program), nil
+}
+
+// featureScans is scanFeatures for a parsed program.
+func featureScans(program *ast.Program) []*featureScan {
+	var scans []*featureScan
+	for _, stmt := range program.Statements {
+		proc, ok := stmt.(*ast.CreateProcedureStatement)
+		if !ok {
+			continue
+		}
+		f := &featureScan{features: ProcedureFeatures{Procedure: proc.Name.String()}, kinds: map[string]int{}}
+		for _, p := range proc.Parameters {
+			if p.DataType != nil {
+				f.text(p.DataType.String())
+			}
+		}
+		if proc.Body != nil {
+			f.statements(proc.Body.Statements)
+		}
+		scans = append(scans, f)
+	}
+	return scans
+}
+
+var (
+	sqlStringLiteral  = regexp.MustCompile(`N?'(?:[^']|'')*'`)
+	tempTableRef      = regexp.MustCompile(`(?:^|[^\w@#$])##?[A-Za-z_]`)
+	xmlFeature        = regexp.MustCompile(`(?i)\bXML\b|\bOPENXML\b|\bsp_xml_\w+|\.(?:value|nodes|query|exist|modify)\s*\(`)
+	linkedServerCall  = regexp.MustCompile(`(?i)\bOPEN(?:QUERY|ROWSET|DATASOURCE)\s*\(|\)\s*AT\s+[\w\[]`)
+	fourPartName      = regexp.MustCompile(`(?:^|[^\w.\]@#])(?:\[[^\]]+\]|[A-Za-z_]\w*)\.(?:\[[^\]]+\]|[A-Za-z_]\w*)\.(?:\[[^\]]+\]|[A-Za-z_]\w*)?\.(?:\[[^\]]+\]|[A-Za-z_]\w*)`)
+	featureCSVHeading = []string{"procedure", "cursors", "temp_tables", "transactions", "dynamic_sql", "xml", "linked_servers", "try_catch", "result_sets"}
+)
+
+// featureScan collects the features of one procedure. Statements that
+// nest others are walked; the rest are matched as text, with string
+// literals blanked so SQL held in strings doesn't count.
+type featureScan struct {
+	features ProcedureFeatures
+	kinds    map[string]int // Statements by statementKind
+	depth    int            // IF, WHILE and TRY/CATCH the statement scanned is in
+	maxDepth int
+}
+
+// nested scans what fn does one level of control flow deeper.
+func (f *featureScan) nested(fn func()) {
+	f.depth++
+	f.maxDepth = max(f.maxDepth, f.depth)
+	fn()
+	f.depth--
+}
+
+func (f *featureScan) statements(stmts []ast.Statement) {
+	for _, stmt := range stmts {
+		f.statement(stmt)
+	}
+}
+
+func (f *featureScan) statement(stmt ast.Statement) {
+	if _, block := stmt.(*ast.BeginEndBlock); stmt != nil && !block {
+		f.kinds[statementKind(stmt)]++
+	}
+	switch s := stmt.(type) {
+	case nil:
+		return
+	case *ast.IfStatement:
+		f.expression(s.Condition)
+		f.nested(func() {
+			f.statement(s.Consequence)
+			f.statement(s.Alternative)
+		})
+		return
+	case *ast.WhileStatement:
+		f.expression(s.Condition)
+		f.nested(func() { f.statement(s.Body) })
+		return
+	case *ast.BeginEndBlock:
+		f.statements(s.Statements)
+		return
+	case *ast.TryCatchStatement:
+		f.features.TryCatch = true
+		f.nested(func() {
+			if s.TryBlock != nil {
+				f.statements(s.TryBlock.Statements)
+			}
+			if s.CatchBlock != nil {
+				f.statements(s.CatchBlock.Statements)
+			}
+		})
+		return
+	case *ast.DeclareCursorStatement:
+		f.features.Cursors = true
+	case *ast.BeginTransactionStatement, *ast.CommitTransactionStatement,
+		*ast.RollbackTransactionStatement, *ast.SaveTransactionStatement:
+		f.features.Transactions = true
+	case *ast.ExecStatement:
+		if s.DynamicSQL != nil || isExecuteSQL(s.Procedure) {
+			f.features.DynamicSQL = true
+		}
+	case *ast.SelectStatement:
+		if returnsRows(s) {
+			f.features.ResultSets++
+		}
+	case *ast.WithStatement:
+		if sel, ok := s.Query.(*ast.SelectStatement); ok && returnsRows(sel) {
+			f.features.ResultSets++
+		}
+	}
+	f.text(stmt.String())
+}
+
+func (f *featureScan) expression(e ast.Expression) {
+	if e != nil {
+		f.text(e.String())
+	}
+}
+
+func (f *featureScan) text(sql string) {
+	sql = sqlStringLiteral.ReplaceAllString(sql, "''")
+	if tempTableRef.MatchString(sql) {
+		f.features.TempTables = true
+	}
+	if xmlFeature.MatchString(sql) {
+		f.features.XML = true
+	}
+	if linkedServerCall.MatchString(sql) || fourPartName.MatchString(sql) {
+		f.features.LinkedServers = true
+	}
+}
+
+// statementKind names the kind of stmt as T-SQL writes it: SELECT,
+// BEGIN TRANSACTION, TRY/CATCH.
+func statementKind(stmt ast.Statement) string {
+	if _, ok := stmt.(*ast.TryCatchStatement); ok {
+		return "TRY/CATCH"
+	}
+	name := strings.TrimPrefix(fmt.Sprintf("%T", stmt), "*ast.")
+	name = strings.TrimSuffix(name, "Statement")
+	return strings.ToUpper(strings.Join(splitOnCaseTransition(name), " "))
+}
+
+// returnsRows reports whether a SELECT statement sends rows to the caller,
+// rather than assigning variables or filling a table.
+func returnsRows(s *ast.SelectStatement) bool {
+	if s.Into != nil {
+		return false
+	}
+	for _, col := range s.Columns {
+		if col.Variable != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// MarshalFeatureMatrixJSON renders a feature matrix as indented JSON.
+func MarshalFeatureMatrixJSON(matrix []ProcedureFeatures) ([]byte, error) {
+	if matrix == nil {
+		matrix = []ProcedureFeatures{}
+	}
+	data, err := json.MarshalIndent(matrix, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// MarshalFeatureMatrixCSV renders a feature matrix as CSV with a heading
+// row, features as true or false.
+func MarshalFeatureMatrixCSV(matrix []ProcedureFeatures) ([]byte, error) {
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+	if err := w.Write(featureCSVHeading); err != nil {
+		return nil, err
+	}
+	for _, p := range matrix {
+		row := []string{p.Procedure}
+		for _, v := range p.Flags() {
+			row = append(row, strconv.FormatBool(v))
+		}
+		row = append(row, strconv.Itoa(p.ResultSets))
+		if err := w.Write(row); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, err
+	}
+	return []byte(b.String()), nil
+}
+
+// FeatureNames are the names of the features Flags returns, in order.
+var FeatureNames = []string{"cursors", "temp tables", "transactions", "dynamic SQL", "XML", "linked servers", "TRY/CATCH"}
+
+// Flags returns whether the procedure uses each of FeatureNames.
+func (p ProcedureFeatures) Flags() []bool {
+	return []bool{p.Cursors, p.TempTables, p.Transactions, p.DynamicSQL, p.XML, p.LinkedServers, p.TryCatch}
+}
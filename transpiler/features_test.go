@@ -0,0 +1,73 @@
+package transpiler
+
+import (
+	"strings"
+	"testing"
+)
+
+const featuresSQL = `
+CREATE PROCEDURE usp_ArchiveOrders @Before DATE
+AS
+BEGIN
+    DECLARE @ID INT
+    CREATE TABLE #Archive (OrderID INT)
+    DECLARE c CURSOR FOR SELECT OrderID FROM Orders WHERE OrderDate < @Before
+    BEGIN TRY
+        BEGIN TRANSACTION
+        INSERT INTO Reporting.Archive.dbo.Orders (OrderID) SELECT OrderID FROM #Archive
+        COMMIT
+    END TRY
+    BEGIN CATCH
+        ROLLBACK
+    END CATCH
+    SELECT COUNT(*) AS Archived FROM #Archive
+END
+GO
+CREATE PROCEDURE usp_SearchOrders @Where NVARCHAR(200)
+AS
+BEGIN
+    DECLARE @sql NVARCHAR(MAX) = N'SELECT * FROM #Ignored, Srv.Db.dbo.Ignored WHERE ' + @Where
+    EXEC sp_executesql @sql
+END
+GO
+CREATE PROCEDURE usp_OrderXML @OrderID INT
+AS
+BEGIN
+    DECLARE @Total DECIMAL(10,2)
+    SELECT @Total = Total FROM Orders WHERE OrderID = @OrderID
+    IF @Total > 100
+        SELECT OrderID, Total FROM Orders WHERE OrderID = @OrderID FOR XML PATH('Order')
+    ELSE
+        SELECT OrderID FROM OPENQUERY(Legacy, 'SELECT OrderID FROM Orders')
+END
+`
+
+func TestFeatureMatrix(t *testing.T) {
+	matrix, err := FeatureMatrix(featuresSQL)
+	if err != nil {
+		t.Fatalf("FeatureMatrix failed: %v", err)
+	}
+	want := []ProcedureFeatures{
+		{Procedure: "usp_ArchiveOrders", Cursors: true, TempTables: true, Transactions: true, LinkedServers: true, TryCatch: true, ResultSets: 1},
+		{Procedure: "usp_SearchOrders", DynamicSQL: true},
+		{Procedure: "usp_OrderXML", XML: true, LinkedServers: true, ResultSets: 2},
+	}
+	if len(matrix) != len(want) {
+		t.Fatalf("Expected %d procedures, got %d", len(want), len(matrix))
+	}
+	for i := range want {
+		if matrix[i] != want[i] {
+			t.Errorf("Expected %+v, got %+v", want[i], matrix[i])
+		}
+	}
+
+	data, err := MarshalFeatureMatrixCSV(matrix)
+	if err != nil {
+		t.Fatalf("MarshalFeatureMatrixCSV failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if lines[0] != "procedure,cursors,temp_tables,transactions,dynamic_sql,xml,linked_servers,try_catch,result_sets" ||
+		lines[2] != "usp_SearchOrders,false,false,false,true,false,false,false,0" {
+		t.Errorf("Unexpected CSV:\n%s", data)
+	}
+}
@@ -0,0 +1,611 @@
+package transpiler
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// FOR JSON and OPENJSON
+//
+// A FOR JSON query in a Go expression, or standing alone as the result of
+// a procedure, keeps its clause on SQL Server, where it runs wrapped in
+// SELECT (...) so the JSON comes back as one value rather than split over
+// rows. On PostgreSQL a plain PATH or AUTO query becomes an aggregate:
+//
+//	SELECT json_strip_nulls(json_agg(json_build_object('OrderID', j.OrderID, 'Total', j.Total)))
+//	FROM (SELECT OrderID, Total FROM Orders WHERE CustomerID = $1) AS j
+//
+// Elsewhere, and for queries the aggregate can't express (nested
+// Customer.Name keys, WITHOUT_ARRAY_WRAPPER, ORDER BY), the query runs
+// without the clause and tsqlruntime.QueryForJSON encodes its rows in Go,
+// keeping the column order and FOR JSON's handling of NULLs.
+//
+// OPENJSON in a query becomes the dialect's JSON table function: a
+// derived table over json_array_elements on PostgreSQL, JSON_TABLE on
+// MySQL and json_each on SQLite, with the WITH columns read by their
+// paths. Without WITH it returns key, value and type. On PostgreSQL and
+// MySQL the JSON must be an array. With the gRPC backend, an INSERT ...
+// SELECT FROM OPENJSON(@param) decodes the rows in Go, into a slice of a
+// struct generated from the WITH clause, and sends them as one request:
+//
+//	var itemsRows []struct {
+//		ProductID int32 `json:"id"`
+//		Quantity  int32 `json:"qty"`
+//	}
+//	if err := tsqlruntime.OpenJSONInto(items, "$", &itemsRows); err != nil {
+//		return err
+//	}
+
+// forJSONClause matches a FOR JSON clause left in a query.
+var forJSONClause = regexp.MustCompile(`(?i)\bFOR\s+JSON\b`)
+
+// openJSONCall finds OPENJSON calls.
+var openJSONCall = regexp.MustCompile(`(?i)\bOPENJSON\s*\(`)
+
+// jsonKeyName matches a property name a JSON path can have unquoted, and
+// an alias a query can.
+var jsonKeyName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// openJSONWith matches the WITH that starts the schema of an OPENJSON call.
+var openJSONWith = regexp.MustCompile(`(?i)^\s*WITH\s*\(`)
+
+// isForJSON reports whether sel has a FOR JSON clause.
+func isForJSON(sel *ast.SelectStatement) bool {
+	return sel != nil && sel.ForClause != nil && strings.EqualFold(sel.ForClause.ForType, "JSON")
+}
+
+// forJSONKeys returns the keys FOR JSON gives the columns of sel: their
+// aliases or column names. It returns nil for a SELECT *, and the first
+// column without a name and false when there is one.
+func forJSONKeys(sel *ast.SelectStatement) ([]string, string, bool) {
+	var keys []string
+	for _, col := range sel.Columns {
+		switch {
+		case col.AllColumns || (col.Expression != nil && strings.HasSuffix(col.Expression.String(), "*")):
+			return nil, "", true
+		case col.Alias != nil:
+			keys = append(keys, strings.Trim(col.Alias.Value, `[]'"`))
+		default:
+			name := ""
+			switch e := col.Expression.(type) {
+			case *ast.Identifier:
+				name = e.Value
+			case *ast.QualifiedIdentifier:
+				name = e.Parts[len(e.Parts)-1].Value
+			}
+			if name == "" {
+				return nil, col.String(), false
+			}
+			keys = append(keys, name)
+		}
+	}
+	return keys, "", true
+}
+
+// forJSONQuery is how a FOR JSON query runs: a query returning the JSON
+// text as one value, or, with options, a query whose rows
+// tsqlruntime.QueryForJSON encodes.
+type forJSONQuery struct {
+	query   string
+	args    string // Go arguments, each after a comma
+	options string // A tsqlruntime.ForJSONOptions literal, or ""
+}
+
+// transpileForJSON transpiles a FOR JSON query to a Go expression for its
+// JSON text, "" for no rows. The expression can't return the query's
+// error; statements use assignForJSON, which does.
+func (t *transpiler) transpileForJSON(sel *ast.SelectStatement) (string, bool) {
+	q, ok := t.forJSON(sel)
+	if !ok {
+		return "", false
+	}
+	if q.options == "" {
+		return fmt.Sprintf("tsqlruntime.QueryScalarString(ctx, %s, %q%s)", t.dmlConfig.StoreVar, q.query, q.args), true
+	}
+	return fmt.Sprintf("tsqlruntime.QueryForJSON(ctx, %s, %s, %q%s)", t.dmlConfig.StoreVar, q.options, q.query, q.args), true
+}
+
+// assignForJSON transpiles target = the JSON text of a FOR JSON query,
+// returning the query's error. ti is the type of target.
+func (t *transpiler) assignForJSON(target string, ti *typeInfo, sel *ast.SelectStatement) (string, bool) {
+	q, ok := t.forJSON(sel)
+	if !ok {
+		return "", false
+	}
+	nullable := ti != nil && ti.nullable
+	ind := t.indentStr()
+	var out strings.Builder
+	if q.options == "" {
+		dest := "&" + target
+		if !nullable {
+			dest = fmt.Sprintf("tsqlruntime.Nullable(&%s)", target)
+		}
+		out.WriteString(fmt.Sprintf("if err := %s.QueryRowContext(ctx, %q%s).Scan(%s); err != nil {\n",
+			t.dmlConfig.StoreVar, q.query, q.args, dest))
+		out.WriteString(fmt.Sprintf("%s\t%s\n", ind, t.buildErrorReturn()))
+		out.WriteString(ind + "}")
+		return out.String(), true
+	}
+	value := "v"
+	if nullable {
+		value = t.nullWrap(value, "string")
+	}
+	out.WriteString(fmt.Sprintf("if v, err := tsqlruntime.ReadForJSON(ctx, %s, %s, %q%s); err != nil {\n",
+		t.dmlConfig.StoreVar, q.options, q.query, q.args))
+	out.WriteString(fmt.Sprintf("%s\t%s\n", ind, t.buildErrorReturn()))
+	out.WriteString(fmt.Sprintf("%s} else {\n", ind))
+	out.WriteString(fmt.Sprintf("%s\t%s = %s\n", ind, target, value))
+	out.WriteString(ind + "}")
+	return out.String(), true
+}
+
+// forJSON returns how the FOR JSON query sel runs.
+func (t *transpiler) forJSON(sel *ast.SelectStatement) (*forJSONQuery, bool) {
+	t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+	fc := sel.ForClause
+	mode := strings.ToUpper(fc.Mode)
+	keys, unnamed, ok := forJSONKeys(sel)
+	if !ok {
+		t.warn(RuleUntranslated, fmt.Sprintf("%s: FOR JSON column %s has no name, which FOR JSON needs; it is kept as it is",
+			t.currentProcName, unnamed))
+		return nil, false
+	}
+
+	// The query without FOR JSON, with aliases that aren't identifiers
+	// quoted on SQL Server and replaced elsewhere, as the keys say them
+	plain := *sel
+	plain.Columns = append([]ast.SelectColumn(nil), sel.Columns...)
+	for i, col := range plain.Columns {
+		if col.Alias == nil || jsonKeyName.MatchString(col.Alias.Value) {
+			continue
+		}
+		name := fmt.Sprintf("json%d", i+1)
+		if t.dmlConfig.SQLDialect == "sqlserver" {
+			name = "[" + keys[i] + "]"
+		}
+		plain.Columns[i].Alias = &ast.Identifier{Value: name}
+	}
+
+	dt := &dmlTranspiler{transpiler: t, config: t.dmlConfig}
+	if t.dmlConfig.SQLDialect == "sqlserver" {
+		query := t.removeTableHints(plain.String())
+		query, args := t.substituteVariablesForExists(query)
+		return &forJSONQuery{query: "SELECT (" + query + ")", args: joinArgs(args)}, true
+	}
+	plain.ForClause = nil
+	query := t.removeTableHints(plain.String())
+	query, args := t.substituteVariablesForExists(dt.normalizeDateSQL(query))
+	query = dt.normalizeDialectSQL(query)
+
+	if agg, ok := postgresForJSON(t.dmlConfig.SQLDialect, sel, keys, query); ok {
+		return &forJSONQuery{query: agg, args: joinArgs(args)}, true
+	}
+	opts := []string{"Mode: tsqlruntime.ForJSON" + map[string]string{"AUTO": "Auto", "PATH": "Path", "RAW": "Raw"}[mode]}
+	if fc.Root != "" {
+		opts = append(opts, fmt.Sprintf("RootName: %q", fc.Root))
+	}
+	if fc.IncludeNullValues {
+		opts = append(opts, "IncludeNullValues: true")
+	}
+	if fc.WithoutArrayWrapper {
+		opts = append(opts, "WithoutArrayWrapper: true")
+	}
+	if keys != nil {
+		quoted := make([]string, len(keys))
+		for i, k := range keys {
+			quoted[i] = strconv.Quote(k)
+		}
+		opts = append(opts, "Columns: []string{"+strings.Join(quoted, ", ")+"}")
+	}
+	return &forJSONQuery{query: query, args: joinArgs(args), options: "tsqlruntime.ForJSONOptions{" + strings.Join(opts, ", ") + "}"}, true
+}
+
+// postgresForJSON returns a PostgreSQL query aggregating the rows of query
+// into the JSON a FOR JSON PATH or AUTO clause on sel would give, when
+// its keys are plain names and it has no ORDER BY, which the derived table
+// wouldn't keep.
+func postgresForJSON(dialect string, sel *ast.SelectStatement, keys []string, query string) (string, bool) {
+	fc := sel.ForClause
+	mode := strings.ToUpper(fc.Mode)
+	if dialect != "postgres" || (mode != "PATH" && mode != "AUTO") || fc.WithoutArrayWrapper || len(sel.OrderBy) > 0 || keys == nil {
+		return "", false
+	}
+	var pairs []string
+	for i, key := range keys {
+		if !jsonKeyName.MatchString(key) {
+			return "", false
+		}
+		column := key
+		if alias := sel.Columns[i].Alias; alias != nil {
+			column = alias.Value
+		}
+		pairs = append(pairs, fmt.Sprintf("%s, j.%s", sqlQuote(key), column))
+	}
+	agg := fmt.Sprintf("json_agg(json_build_object(%s))", strings.Join(pairs, ", "))
+	if !fc.IncludeNullValues {
+		agg = "json_strip_nulls(" + agg + ")"
+	}
+	if fc.Root != "" {
+		agg = fmt.Sprintf("json_build_object(%s, %s)", sqlQuote(fc.Root), agg)
+	}
+	return fmt.Sprintf("SELECT %s FROM (%s) AS j", agg, query), true
+}
+
+// transpileSelectForJSON transpiles a FOR JSON query standing alone, whose
+// result set is one row with the JSON text.
+func (dt *dmlTranspiler) transpileSelectForJSON(s *ast.SelectStatement) (string, bool) {
+	code, ok := dt.assignForJSON("jsonResult", nil, s)
+	if !ok {
+		return "", false
+	}
+	comment := fmt.Sprintf("// SELECT ... %s: the result set is one row with the JSON text\n%s", s.ForClause.String(), dt.indentStr())
+	if !dt.symbols.isDeclared("jsonResult") {
+		dt.symbols.markDeclared("jsonResult")
+		comment += "var jsonResult string\n" + dt.indentStr()
+	}
+	return comment + code, true
+}
+
+// normalizeJSONSQL rewrites OPENJSON in a query for the SQL dialect, and
+// warns about FOR JSON clauses left in it.
+func (dt *dmlTranspiler) normalizeJSONSQL(query string) string {
+	if dt.config.SQLDialect == "sqlserver" || dt.config.SQLDialect == "" {
+		return query
+	}
+	if forJSONClause.MatchString(query) {
+		dt.warn(RuleUntranslated, fmt.Sprintf("%s: FOR JSON has no %s translation inside a query; it is kept as it is",
+			dt.currentProcName, dt.config.SQLDialect))
+	}
+	var b strings.Builder
+	for {
+		loc := openJSONCall.FindStringIndex(query)
+		if loc == nil {
+			break
+		}
+		end := sqlParenEnd(query, loc[1]-1)
+		if end < 0 {
+			break
+		}
+		call := openJSONSource{args: splitSQLArgs(query[loc[1]:end])}
+		rest := query[end+1:]
+		if m := openJSONWith.FindStringIndex(rest); m != nil {
+			close := sqlParenEnd(rest, m[1]-1)
+			if close < 0 {
+				break
+			}
+			call.with = true
+			for _, def := range splitSQLArgs(rest[m[1]:close]) {
+				col, ok := parseOpenJSONColumn(def)
+				if !ok {
+					call.with = false
+					break
+				}
+				call.columns = append(call.columns, col)
+			}
+			if !call.with {
+				break
+			}
+			rest = rest[close+1:]
+		}
+		call.alias = "openjson"
+		if m := tableAlias.FindStringSubmatch(rest); m != nil && !isClauseKeyword(m[1]) {
+			call.alias = m[1]
+			rest = rest[len(m[0]):]
+		}
+		b.WriteString(query[:loc[0]])
+		if out, ok := openJSONSQL(dt.config.SQLDialect, call); ok {
+			b.WriteString(out)
+		} else {
+			dt.warn(RuleUntranslated, fmt.Sprintf("%s: OPENJSON(%s) has no %s translation; it is kept as it is",
+				dt.currentProcName, strings.Join(call.args, ", "), dt.config.SQLDialect))
+			b.WriteString(query[loc[0] : len(query)-len(rest)])
+		}
+		query = rest
+	}
+	b.WriteString(query)
+	return b.String()
+}
+
+// openJSONSource is an OPENJSON table source in a query.
+type openJSONSource struct {
+	args    []string
+	with    bool
+	columns []openJSONColumn
+	alias   string
+}
+
+// openJSONColumn is a column of the WITH clause of an OPENJSON call.
+type openJSONColumn struct {
+	name   string
+	typ    *ast.DataType
+	path   string // JSON path, $.name by default
+	asJSON bool
+}
+
+// openJSONColumnDef matches a column of an OPENJSON WITH clause.
+var openJSONColumnDef = regexp.MustCompile(`(?is)^\s*(\[[^\]]+\]|[A-Za-z_@#][\w@#$]*)\s+([A-Za-z]+)\s*(?:\(\s*(\d+|MAX)\s*(?:,\s*(\d+)\s*)?\))?\s*(?:N?'((?:[^']|'')*)')?\s*(AS\s+JSON)?\s*$`)
+
+// parseOpenJSONColumn parses a column of an OPENJSON WITH clause.
+func parseOpenJSONColumn(def string) (openJSONColumn, bool) {
+	m := openJSONColumnDef.FindStringSubmatch(def)
+	if m == nil {
+		return openJSONColumn{}, false
+	}
+	col := openJSONColumn{name: strings.Trim(m[1], "[]"), typ: &ast.DataType{Name: strings.ToUpper(m[2])}, asJSON: m[6] != ""}
+	if strings.EqualFold(m[3], "MAX") {
+		col.typ.Max = true
+	} else if m[3] != "" {
+		n, _ := strconv.Atoi(m[3])
+		col.typ.Length = &n
+		if m[4] != "" {
+			s, _ := strconv.Atoi(m[4])
+			col.typ.Precision, col.typ.Scale, col.typ.Length = &n, &s, nil
+		} else if col.typ.Name == "DECIMAL" || col.typ.Name == "NUMERIC" {
+			col.typ.Precision, col.typ.Length = &n, nil
+		}
+	}
+	col.path = strings.ReplaceAll(m[5], "''", "'")
+	if col.path == "" {
+		col.path = "$." + col.name
+	}
+	return col, true
+}
+
+// jsonPathSteps splits a JSON path into its property names and array
+// indexes, without the lax or strict mode.
+func jsonPathSteps(path string) ([]string, bool) {
+	path = strings.TrimSpace(path)
+	for _, mode := range []string{"lax ", "strict "} {
+		if strings.HasPrefix(strings.ToLower(path), mode) {
+			path = strings.TrimSpace(path[len(mode):])
+		}
+	}
+	if !strings.HasPrefix(path, "$") {
+		return nil, false
+	}
+	var steps []string
+	for rest := path[1:]; rest != ""; {
+		switch {
+		case strings.HasPrefix(rest, `."`):
+			end := strings.Index(rest[2:], `"`)
+			if end < 0 {
+				return nil, false
+			}
+			steps = append(steps, rest[2:2+end])
+			rest = rest[3+end:]
+		case rest[0] == '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			steps = append(steps, rest[1:1+end])
+			rest = rest[1+end:]
+		case rest[0] == '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, false
+			}
+			steps = append(steps, rest[1:end])
+			rest = rest[end+1:]
+		default:
+			return nil, false
+		}
+	}
+	return steps, true
+}
+
+// openJSONSQL returns the dialect's table source for an OPENJSON call.
+func openJSONSQL(dialect string, call openJSONSource) (string, bool) {
+	if len(call.args) != 1 && len(call.args) != 2 {
+		return "", false
+	}
+	source, path := call.args[0], "'$'"
+	if len(call.args) == 2 {
+		path = call.args[1]
+	}
+	root, ok := sqlUnquote(path)
+	if !ok {
+		return "", false
+	}
+	rootSteps, ok := jsonPathSteps(root)
+	if !ok {
+		return "", false
+	}
+	// JSON paths as the dialects write them, from the steps
+	pgPath := func(steps []string) string {
+		return sqlQuote("{" + strings.Join(steps, ",") + "}")
+	}
+	jsPath := func(steps []string) string {
+		var b strings.Builder
+		b.WriteString("$")
+		for _, s := range steps {
+			switch _, err := strconv.Atoi(s); {
+			case err == nil:
+				b.WriteString("[" + s + "]")
+			case jsonKeyName.MatchString(s):
+				b.WriteString("." + s)
+			default:
+				b.WriteString(`."` + s + `"`)
+			}
+		}
+		return b.String()
+	}
+
+	var cols []string
+	switch dialect {
+	case "postgres":
+		elements := fmt.Sprintf("CAST(%s AS json)", source)
+		if len(rootSteps) > 0 {
+			elements = fmt.Sprintf("(%s #> %s)", elements, pgPath(rootSteps))
+		}
+		if !call.with {
+			return fmt.Sprintf("(SELECT (e.n - 1)::text AS key, e.value #>> '{}' AS value, "+
+				"CASE json_typeof(e.value) WHEN 'null' THEN 0 WHEN 'string' THEN 1 WHEN 'number' THEN 2 WHEN 'boolean' THEN 3 WHEN 'array' THEN 4 ELSE 5 END AS type "+
+				"FROM json_array_elements(%s) WITH ORDINALITY AS e(value, n)) AS %s", elements, call.alias), true
+		}
+		for _, c := range call.columns {
+			steps, ok := jsonPathSteps(c.path)
+			if !ok {
+				return "", false
+			}
+			if c.asJSON {
+				cols = append(cols, fmt.Sprintf("e.value #> %s AS %s", pgPath(steps), c.name))
+			} else {
+				cols = append(cols, fmt.Sprintf("CAST(e.value #>> %s AS %s) AS %s", pgPath(steps), postgresType(c.typ), c.name))
+			}
+		}
+		return fmt.Sprintf("(SELECT %s FROM json_array_elements(%s) AS e(value)) AS %s", strings.Join(cols, ", "), elements, call.alias), true
+	case "mysql":
+		rows := sqlQuote(jsPath(rootSteps) + "[*]")
+		if !call.with {
+			return fmt.Sprintf("(SELECT e.n - 1 AS `key`, JSON_UNQUOTE(e.v) AS value, "+
+				"CASE JSON_TYPE(e.v) WHEN 'NULL' THEN 0 WHEN 'STRING' THEN 1 WHEN 'BOOLEAN' THEN 3 WHEN 'ARRAY' THEN 4 WHEN 'OBJECT' THEN 5 ELSE 2 END AS type "+
+				"FROM JSON_TABLE(%s, %s COLUMNS (n FOR ORDINALITY, v JSON PATH '$')) AS e) AS %s", source, rows, call.alias), true
+		}
+		for _, c := range call.columns {
+			steps, ok := jsonPathSteps(c.path)
+			if !ok {
+				return "", false
+			}
+			typ := mysqlJSONType(c.typ)
+			if c.asJSON {
+				typ = "JSON"
+			}
+			cols = append(cols, fmt.Sprintf("%s %s PATH %s", c.name, typ, sqlQuote(jsPath(steps))))
+		}
+		return fmt.Sprintf("JSON_TABLE(%s, %s COLUMNS (%s)) AS %s", source, rows, strings.Join(cols, ", "), call.alias), true
+	case "sqlite":
+		each := source
+		if len(rootSteps) > 0 {
+			each += ", " + sqlQuote(jsPath(rootSteps))
+		}
+		if !call.with {
+			return fmt.Sprintf("(SELECT key, value, "+
+				"CASE type WHEN 'null' THEN 0 WHEN 'text' THEN 1 WHEN 'true' THEN 3 WHEN 'false' THEN 3 WHEN 'array' THEN 4 WHEN 'object' THEN 5 ELSE 2 END AS type "+
+				"FROM json_each(%s)) AS %s", each, call.alias), true
+		}
+		for _, c := range call.columns {
+			steps, ok := jsonPathSteps(c.path)
+			if !ok {
+				return "", false
+			}
+			// json_extract returns numbers as numbers and objects as JSON text
+			cols = append(cols, fmt.Sprintf("json_extract(e.value, %s) AS %s", sqlQuote(jsPath(steps)), c.name))
+		}
+		return fmt.Sprintf("(SELECT %s FROM json_each(%s) AS e) AS %s", strings.Join(cols, ", "), each, call.alias), true
+	}
+	return "", false
+}
+
+// mysqlJSONType returns the type of a JSON_TABLE column for a T-SQL type.
+func mysqlJSONType(dt *ast.DataType) string {
+	switch name := strings.ToUpper(dt.Name); name {
+	case "TINYINT", "SMALLINT", "INT", "INTEGER", "BIGINT", "DATE", "TIME", "REAL":
+		return name
+	case "FLOAT":
+		return "DOUBLE"
+	case "DECIMAL", "NUMERIC":
+		if dt.Precision != nil && dt.Scale != nil {
+			return fmt.Sprintf("DECIMAL(%d,%d)", *dt.Precision, *dt.Scale)
+		}
+		return "DECIMAL(18,0)"
+	case "MONEY", "SMALLMONEY":
+		return "DECIMAL(19,4)"
+	case "BIT":
+		return "BOOLEAN"
+	case "DATETIME", "DATETIME2", "SMALLDATETIME", "DATETIMEOFFSET":
+		return "DATETIME(6)"
+	case "UNIQUEIDENTIFIER":
+		return "CHAR(36)"
+	case "CHAR", "NCHAR", "VARCHAR", "NVARCHAR":
+		if dt.Length != nil && !dt.Max {
+			return fmt.Sprintf("VARCHAR(%d)", *dt.Length)
+		}
+	}
+	return "TEXT"
+}
+
+// selectOpenJSON returns the OPENJSON(@param) a SELECT reads as its only
+// table, with a WITH clause.
+func (dt *dmlTranspiler) selectOpenJSON(s *ast.SelectStatement) (*ast.TableValuedFunction, bool) {
+	if s == nil || s.From == nil || len(s.From.Tables) != 1 {
+		return nil, false
+	}
+	tvf, ok := s.From.Tables[0].(*ast.TableValuedFunction)
+	if !ok || !strings.EqualFold(tvf.Function.String(), "OPENJSON") || len(tvf.OpenJsonColumns) == 0 || len(tvf.Arguments) == 0 {
+		return nil, false
+	}
+	if _, ok := tvf.Arguments[0].(*ast.Variable); !ok {
+		return nil, false
+	}
+	return tvf, true
+}
+
+// transpileInsertOpenJSONGRPC decodes the rows of INSERT ... SELECT FROM
+// OPENJSON(@param) WITH (...) in Go and sends them as one request, as
+// transpileInsertTableParamGRPC does for a table-valued parameter.
+func (dt *dmlTranspiler) transpileInsertOpenJSONGRPC(s *ast.InsertStatement, tvf *ast.TableValuedFunction) (string, error) {
+	if s.Select.Where != nil || len(s.Select.GroupBy) > 0 || s.Select.Distinct || s.Select.Top != nil {
+		return "", fmt.Errorf("INSERT ... SELECT FROM OPENJSON with WHERE, GROUP BY, DISTINCT or TOP needs the SQL backend, not grpc")
+	}
+	source := tvf.Arguments[0].(*ast.Variable)
+	path := "$"
+	if len(tvf.Arguments) > 1 {
+		lit, ok := tvf.Arguments[1].(*ast.StringLiteral)
+		if !ok {
+			return "", fmt.Errorf("OPENJSON(%s, %s) needs a literal path for the gRPC backend", source.Name, tvf.Arguments[1].String())
+		}
+		path = lit.Value
+	}
+
+	name := strings.TrimPrefix(source.Name, "@")
+	tt := &TableType{Name: "OPENJSON(" + source.Name + ")"}
+	width := 0
+	for _, col := range tvf.OpenJsonColumns {
+		width = max(width, len(goExportedIdentifier(col.Name)))
+		tt.Columns = append(tt.Columns, TableTypeColumn{Name: col.Name, Type: col.DataType, Nullable: true})
+	}
+	p := &tableParam{name: name, goVar: goIdentifier(name) + "Rows", typ: tt}
+
+	var fields []string
+	for _, col := range tvf.OpenJsonColumns {
+		goType, err := dt.mapDataType(col.DataType)
+		if err != nil {
+			return "", fmt.Errorf("OPENJSON column %s: %w", col.Name, err)
+		}
+		key := "$." + col.Name
+		if col.Path != "" {
+			key = col.Path
+		}
+		steps, ok := jsonPathSteps(key)
+		if !ok || len(steps) != 1 || col.AsJson {
+			return "", fmt.Errorf("OPENJSON column %s reads %s, which needs the SQL backend, not grpc; only top-level properties can be decoded in Go", col.Name, key)
+		}
+		fields = append(fields, fmt.Sprintf("%-*s %s `json:%q`", width, goExportedIdentifier(col.Name), goType, steps[0]))
+	}
+
+	dt.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+	goSource := goIdentifier(name)
+	dt.symbols.markUsed(goSource)
+	ind := dt.indentStr()
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("// OPENJSON(%s): rows decoded in Go\n", source.Name))
+	out.WriteString(ind + fmt.Sprintf("var %s []struct {\n", p.goVar))
+	for _, f := range fields {
+		out.WriteString(ind + "\t" + f + "\n")
+	}
+	out.WriteString(ind + "}\n")
+	out.WriteString(ind + fmt.Sprintf("if err := tsqlruntime.OpenJSONInto(%s, %q, &%s); err != nil {\n", goSource, path, p.goVar))
+	out.WriteString(ind + "\t" + dt.buildErrorReturn() + "\n")
+	out.WriteString(ind + "}\n")
+	code, err := dt.transpileInsertTableParamGRPC(s, p)
+	if err != nil {
+		return "", err
+	}
+	out.WriteString(ind + code)
+	return out.String(), nil
+}
@@ -0,0 +1,409 @@
+package transpiler
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// FOR XML
+//
+// FOR XML PATH('') is mostly used to concatenate rows into a string:
+//
+//	STUFF((SELECT ', ' + Name FROM Tags WHERE PostID = @ID FOR XML PATH('')), 1, 2, '')
+//
+// Subqueries like this are rewritten to the dialect's string aggregate:
+// STRING_AGG ... WITHIN GROUP on SQL Server (2017 and later), STRING_AGG
+// with ORDER BY on PostgreSQL, GROUP_CONCAT on MySQL and group_concat on
+// SQLite (ordered from 3.44). When the STUFF only strips the leading
+// separator, the separator is passed to the aggregate and the STUFF goes.
+// A trailing .value('.', ...) is dropped, as the aggregate is a string
+// already; values are no longer XML-escaped either way.
+//
+// This happens in queries and in Go expressions, where the rewritten query
+// runs through tsqlruntime.QueryScalarString. Other FOR XML subqueries in
+// Go expressions (RAW, AUTO, PATH('name')) run without the FOR XML clause,
+// and tsqlruntime.QueryForXML builds the XML from their rows, with a
+// warning. Within queries they are only kept on SQL Server. SET and
+// DECLARE assigning one call ReadScalarString and ReadForXML instead, which
+// return the query's error for the statement to return.
+
+// forXMLPathTail matches the FOR XML PATH clause, without an element
+// name, ending a subquery.
+var forXMLPathTail = regexp.MustCompile(`(?is)\s+FOR\s+XML\s+PATH(?:\s*\(\s*''\s*\))?(\s*,\s*TYPE)?$`)
+
+// xmlValueSuffix matches the .value('.', type) that turns the result of a
+// FOR XML PATH subquery with TYPE into a string.
+var xmlValueSuffix = regexp.MustCompile(`(?i)^\.value\s*\(\s*'\.'\s*,\s*N?'[^']*'\s*\)`)
+
+// forXMLClause matches a FOR XML clause left in a query.
+var forXMLClause = regexp.MustCompile(`(?i)\bFOR\s+XML\b`)
+
+// xmlConcat is a FOR XML PATH subquery concatenating a single column.
+type xmlConcat struct {
+	value   string
+	from    string
+	orderBy string
+	end     int // index after the subquery and any .value('.', ...)
+}
+
+// parseXMLConcat parses the concatenating FOR XML PATH subquery whose
+// opening parenthesis is query[open].
+func parseXMLConcat(query string, open int) (xmlConcat, bool) {
+	close := sqlParenEnd(query, open)
+	if close < 0 {
+		return xmlConcat{}, false
+	}
+	inner := strings.TrimSpace(query[open+1 : close])
+	tail := forXMLPathTail.FindStringSubmatchIndex(inner)
+	if tail == nil || len(inner) < 7 || !strings.EqualFold(inner[:7], "SELECT ") {
+		return xmlConcat{}, false
+	}
+	body := inner[7:tail[0]]
+	from := topLevelSQLIndex(body, " FROM ")
+	if from < 0 {
+		return xmlConcat{}, false
+	}
+	c := xmlConcat{value: strings.TrimSpace(body[:from]), from: body[from+6:], end: close + 1}
+	if len(splitSQLArgs(c.value)) != 1 || topLevelSQLIndex(c.value, " AS ") >= 0 ||
+		topLevelSQLIndex(" "+c.value, " DISTINCT ") >= 0 || topLevelSQLIndex(" "+c.value, " TOP ") >= 0 {
+		return xmlConcat{}, false
+	}
+	if i := topLevelSQLIndex(c.from, " ORDER BY "); i >= 0 {
+		c.from, c.orderBy = c.from[:i], c.from[i+10:]
+	}
+	if tail[2] >= 0 {
+		if m := xmlValueSuffix.FindString(query[c.end:]); m != "" {
+			c.end += len(m)
+		}
+	}
+	return c, true
+}
+
+// topLevelSQLIndex returns the index of keyword in query outside string
+// literals and parentheses, ignoring case, or -1.
+func topLevelSQLIndex(query, keyword string) int {
+	depth := 0
+	for i := 0; i < len(query); i++ {
+		switch query[i] {
+		case '\'':
+			i = sqlStringEnd(query, i) - 1
+			continue
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+		if depth == 0 && i+len(keyword) <= len(query) && strings.EqualFold(query[i:i+len(keyword)], keyword) {
+			return i
+		}
+	}
+	return -1
+}
+
+// splitConcatSeparator splits a concatenation starting with a string
+// literal, such as ', ' + Name, into the literal's value and the rest.
+func splitConcatSeparator(value string) (string, string, bool) {
+	if isSQLTerm(value) && value[0] == '(' {
+		value = strings.TrimSpace(value[1 : len(value)-1])
+	}
+	lit := value
+	if strings.HasPrefix(lit, "N'") {
+		lit = lit[1:]
+	}
+	if !strings.HasPrefix(lit, "'") {
+		return "", "", false
+	}
+	end := sqlStringEnd(lit, 0)
+	sep, ok := sqlUnquote(lit[:end])
+	rest := strings.TrimSpace(lit[end:])
+	if !ok || !strings.HasPrefix(rest, "+") || topLevelSQLIndex(rest[1:], "+") >= 0 {
+		return "", "", false
+	}
+	return sep, strings.TrimSpace(rest[1:]), true
+}
+
+// stringAggSQL returns a subquery aggregating c's value with sep, a SQL
+// string literal, for the dialect.
+func (dt *dmlTranspiler) stringAggSQL(c xmlConcat, value, sep string) string {
+	var agg string
+	switch dt.config.SQLDialect {
+	case "postgres":
+		agg = fmt.Sprintf("STRING_AGG(%s, %s", value, sep)
+		if c.orderBy != "" {
+			agg += " ORDER BY " + c.orderBy
+		}
+		agg += ")"
+	case "mysql":
+		agg = "GROUP_CONCAT(" + value
+		if c.orderBy != "" {
+			agg += " ORDER BY " + c.orderBy
+		}
+		agg += " SEPARATOR " + sep + ")"
+	case "sqlite":
+		agg = fmt.Sprintf("group_concat(%s, %s", value, sep)
+		if c.orderBy != "" {
+			agg += " ORDER BY " + c.orderBy
+		}
+		agg += ")"
+	default:
+		agg = fmt.Sprintf("STRING_AGG(%s, %s)", value, sep)
+		if c.orderBy != "" {
+			agg += " WITHIN GROUP (ORDER BY " + c.orderBy + ")"
+		}
+	}
+	return fmt.Sprintf("(SELECT %s FROM %s)", agg, c.from)
+}
+
+// normalizeForXMLSQL rewrites the FOR XML PATH subqueries in a query that
+// concatenate a column to the dialect's string aggregate.
+func (dt *dmlTranspiler) normalizeForXMLSQL(query string) string {
+	if !forXMLClause.MatchString(query) {
+		return query
+	}
+	query = dt.rewriteXMLConcat(query)
+	if dt.config.SQLDialect != "sqlserver" && forXMLClause.MatchString(query) {
+		dt.warn(RuleUntranslated, fmt.Sprintf("%s: FOR XML has no %s translation; it is kept as it is",
+			dt.currentProcName, dt.config.SQLDialect))
+	}
+	return query
+}
+
+// rewriteXMLConcat rewrites the concatenating FOR XML PATH subqueries in
+// query, folding a STUFF that strips the leading separator.
+func (dt *dmlTranspiler) rewriteXMLConcat(query string) string {
+	query = rewriteSQLCalls(query, map[string]bool{"STUFF": true}, func(name string, args []string) (string, bool) {
+		if len(args) != 4 || args[1] != "1" || args[3] != "''" || !strings.HasPrefix(args[0], "(") {
+			return "", false
+		}
+		c, ok := parseXMLConcat(args[0], 0)
+		if !ok || c.end != len(args[0]) {
+			return "", false
+		}
+		sep, value, ok := splitConcatSeparator(c.value)
+		if !ok || args[2] != strconv.Itoa(utf8.RuneCountInString(sep)) {
+			return "", false
+		}
+		return dt.stringAggSQL(c, value, sqlQuote(sep)), true
+	})
+
+	var b strings.Builder
+	for i := 0; i < len(query); i++ {
+		switch query[i] {
+		case '\'':
+			end := sqlStringEnd(query, i)
+			b.WriteString(query[i:end])
+			i = end - 1
+			continue
+		case '(':
+			if c, ok := parseXMLConcat(query, i); ok {
+				b.WriteString(dt.stringAggSQL(c, c.value, "''"))
+				i = c.end - 1
+				continue
+			}
+		}
+		b.WriteByte(query[i])
+	}
+	return b.String()
+}
+
+// forXMLQuery is how a FOR XML subquery runs in Go: a query returning the
+// text as one value, or, with options, a query whose rows
+// tsqlruntime.QueryForXML builds the XML from.
+type forXMLQuery struct {
+	query   string
+	args    string // Go arguments, each after a comma
+	options string // A tsqlruntime.ForXMLOptions literal, or ""
+}
+
+// forXMLCall returns the tsqlruntime call running q: QueryScalarString or
+// QueryForXML with verb "Query", for an expression, which can't return the
+// query's error, and ReadScalarString or ReadForXML with "Read".
+func (t *transpiler) forXMLCall(q *forXMLQuery, verb string) string {
+	t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+	if q.options == "" {
+		return fmt.Sprintf("tsqlruntime.%sScalarString(ctx, %s, %q%s)", verb, t.dmlConfig.StoreVar, q.query, q.args)
+	}
+	return fmt.Sprintf("tsqlruntime.%sForXML(ctx, %s, %s, %q%s)", verb, t.dmlConfig.StoreVar, q.options, q.query, q.args)
+}
+
+// transpileXMLConcat transpiles expr, a concatenating FOR XML PATH
+// subquery or a STUFF or .value over one, to a query for its aggregate. It returns false
+// unless the whole of expr becomes a single query. The expression can't
+// return the query's error; statements use assignForXML, which does.
+func (t *transpiler) transpileXMLConcat(expr ast.Expression) (string, bool) {
+	q, ok := t.forXMLConcat(expr)
+	if !ok {
+		return "", false
+	}
+	return t.forXMLCall(q, "Query"), true
+}
+
+// forXMLConcat returns how expr, as transpileXMLConcat takes it, runs.
+func (t *transpiler) forXMLConcat(expr ast.Expression) (*forXMLQuery, bool) {
+	text := expr.String()
+	if !forXMLClause.MatchString(text) {
+		return nil, false
+	}
+	dt := &dmlTranspiler{transpiler: t, config: t.dmlConfig}
+	query := dt.rewriteXMLConcat(text)
+	if !strings.HasPrefix(query, "(SELECT ") || !isSQLTerm(query) || forXMLClause.MatchString(query) {
+		return nil, false
+	}
+	query = t.removeTableHints(query[1 : len(query)-1])
+	query, args := t.substituteVariablesForExists(dt.normalizeDateSQL(query))
+	query = dt.normalizeDialectSQL(query)
+	return &forXMLQuery{query: query, args: joinArgs(args)}, true
+}
+
+// transpileForXMLSubquery transpiles a FOR XML subquery in a Go
+// expression: one concatenating a column as an aggregate, the others as
+// they are on SQL Server and elsewhere by building the XML from the rows
+// of the query without FOR XML.
+func (t *transpiler) transpileForXMLSubquery(subq *ast.SubqueryExpression) (string, bool) {
+	q, ok := t.forXMLSubquery(subq)
+	if !ok {
+		return "", false
+	}
+	return t.forXMLCall(q, "Query"), true
+}
+
+// assignForXML transpiles target = value, a FOR XML subquery or a STUFF or
+// .value over one, returning the query's error. It returns false when value
+// isn't one, or can't run in Go. In a CATCH block FOR XML subqueries are
+// left to transpileSubqueryExpression, which builds error logging XML in Go.
+func (t *transpiler) assignForXML(target string, ti *typeInfo, value ast.Expression) (string, bool) {
+	var q *forXMLQuery
+	var ok bool
+	if subq, isSubq := value.(*ast.SubqueryExpression); isSubq && subq.Subquery.ForClause != nil {
+		if t.inCatchBlock || !strings.EqualFold(subq.Subquery.ForClause.ForType, "XML") {
+			return "", false
+		}
+		q, ok = t.forXMLSubquery(subq)
+	} else {
+		q, ok = t.forXMLConcat(value)
+	}
+	if !ok {
+		return "", false
+	}
+	v := "v"
+	if ti != nil && ti.nullable {
+		v = t.nullWrap(v, "string")
+	}
+	ind := t.indentStr()
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("if v, err := %s; err != nil {\n", t.forXMLCall(q, "Read")))
+	out.WriteString(fmt.Sprintf("%s\t%s\n", ind, t.buildErrorReturn()))
+	out.WriteString(fmt.Sprintf("%s} else {\n", ind))
+	out.WriteString(fmt.Sprintf("%s\t%s = %s\n", ind, target, v))
+	out.WriteString(ind + "}")
+	return out.String(), true
+}
+
+// forXMLSubquery returns how the FOR XML subquery subq runs.
+func (t *transpiler) forXMLSubquery(subq *ast.SubqueryExpression) (*forXMLQuery, bool) {
+	if q, ok := t.forXMLConcat(subq); ok {
+		return q, true
+	}
+	if t.dmlConfig.SQLDialect == "sqlserver" {
+		query := t.removeTableHints(subq.Subquery.String())
+		query, args := t.substituteVariablesForExists(query)
+		return &forXMLQuery{query: query, args: joinArgs(args)}, true
+	}
+	fc := subq.Subquery.ForClause
+	mode := strings.ToUpper(fc.Mode)
+	opts := []string{"Mode: tsqlruntime.ForXML" + map[string]string{"RAW": "Raw", "AUTO": "Auto", "PATH": "Path"}[mode]}
+	element := fc.ElementName
+	switch mode {
+	case "RAW":
+	case "AUTO":
+		element = autoElementName(subq.Subquery)
+		if element == "" {
+			return nil, false
+		}
+	case "PATH":
+		if element == "" {
+			element = "row"
+		}
+	default:
+		return nil, false
+	}
+	if element != "" {
+		opts = append(opts, fmt.Sprintf("ElementName: %q", element))
+	}
+	if fc.Root != "" {
+		opts = append(opts, fmt.Sprintf("RootName: %q", fc.Root))
+	}
+	if fc.Elements || mode == "PATH" {
+		opts = append(opts, "Elements: true")
+	}
+
+	// PATH columns named '@name' are attributes, which the query can't
+	// call them; nested paths ('a/b') aren't supported
+	plain := *subq.Subquery
+	plain.ForClause = nil
+	plain.Columns = append([]ast.SelectColumn(nil), plain.Columns...)
+	var attrs []string
+	for i, col := range plain.Columns {
+		if col.Alias == nil {
+			continue
+		}
+		name := col.Alias.Value
+		if mode == "PATH" && strings.HasPrefix(name, "@") {
+			name = name[1:]
+			attrs = append(attrs, fmt.Sprintf("%q", name))
+			plain.Columns[i].Alias = &ast.Identifier{Value: name}
+		}
+		if !isSQLTerm(name) || strings.ContainsAny(name, "@.$?") {
+			t.warn(RuleUntranslated, fmt.Sprintf("%s: FOR XML %s column %s has no %s translation; it is kept as it is",
+				t.currentProcName, mode, col.Alias.Value, t.dmlConfig.SQLDialect))
+			return nil, false
+		}
+	}
+	if len(attrs) > 0 {
+		opts = append(opts, "Attributes: []string{"+strings.Join(attrs, ", ")+"}")
+	}
+	dt := &dmlTranspiler{transpiler: t, config: t.dmlConfig}
+	query := t.removeTableHints(plain.String())
+	query, args := t.substituteVariablesForExists(dt.normalizeDateSQL(query))
+	query = dt.normalizeDialectSQL(query)
+
+	t.warnings = append(t.warnings, fmt.Sprintf("%s: FOR XML %s is built in Go from the rows of the query; check the element and attribute names",
+		t.currentProcName, mode))
+	return &forXMLQuery{query: query, args: joinArgs(args), options: "tsqlruntime.ForXMLOptions{" + strings.Join(opts, ", ") + "}"}, true
+}
+
+// autoElementName returns the element FOR XML AUTO names rows after: the
+// alias or name of the first table.
+func autoElementName(sel *ast.SelectStatement) string {
+	if sel.From == nil || len(sel.From.Tables) == 0 {
+		return ""
+	}
+	tn, ok := sel.From.Tables[0].(*ast.TableName)
+	if !ok {
+		return ""
+	}
+	if tn.Alias != nil {
+		return tn.Alias.Value
+	}
+	return tn.Name.Parts[len(tn.Name.Parts)-1].Value
+}
+
+// isXMLValueOfSubquery reports whether e is .value('.', ...) over a FOR
+// XML subquery.
+func isXMLValueOfSubquery(e *ast.MethodCallExpression) bool {
+	subq, ok := e.Object.(*ast.SubqueryExpression)
+	return ok && strings.EqualFold(e.MethodName, "value") && subq.Subquery.ForClause != nil &&
+		len(e.Arguments) == 2 && e.Arguments[0].String() == "'.'"
+}
+
+func joinArgs(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	return ", " + strings.Join(args, ", ")
+}
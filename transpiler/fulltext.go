@@ -0,0 +1,300 @@
+package transpiler
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// Full-text search
+//
+// CONTAINS and FREETEXT predicates become the dialect's own full-text
+// search:
+//
+//	CONTAINS(Body, @Term)       -> to_tsvector(Body) @@ websearch_to_tsquery($1)         (PostgreSQL)
+//	                            -> MATCH (Body) AGAINST (? IN BOOLEAN MODE)              (MySQL)
+//	FREETEXT((Title, Body), @T) -> to_tsvector(concat_ws(' ', Title, Body)) @@ ...      (PostgreSQL)
+//	                            -> MATCH (Title, Body) AGAINST (? IN NATURAL LANGUAGE MODE) (MySQL)
+//
+// A search condition written as a literal is translated too, so
+// '"fast car" OR "quick*"' becomes to_tsquery('(fast <-> car) | quick:*')
+// on PostgreSQL. Stemming, stop words and ranking differ from SQL Server's,
+// so each translation is warned about. NEAR, FORMSOF, ISABOUT, grouping and
+// searches over every indexed column (*) are kept as they are, with a
+// warning, as is anything on SQLite; a tgpiler:dialect comment (see
+// variants.go) can give the SQL instead. On the gRPC backend a SELECT
+// with a full-text predicate calls a Search RPC with the search as Query.
+
+var fullTextFuncs = map[string]bool{"CONTAINS": true, "FREETEXT": true}
+
+// normalizeFullTextSQL rewrites the CONTAINS and FREETEXT predicates in a
+// query for the dialect.
+func (dt *dmlTranspiler) normalizeFullTextSQL(query string) string {
+	dialect := dt.config.SQLDialect
+	if dialect == "sqlserver" {
+		return query
+	}
+	upper := strings.ToUpper(query)
+	if !strings.Contains(upper, "CONTAINS") && !strings.Contains(upper, "FREETEXT") {
+		return query
+	}
+	return rewriteSQLCalls(query, fullTextFuncs, func(name string, args []string) (string, bool) {
+		call := fmt.Sprintf("%s(%s)", name, strings.Join(args, ", "))
+		var out string
+		ok := false
+		if len(args) >= 2 {
+			switch dialect {
+			case "postgres":
+				out, ok = postgresFullTextSQL(name, args[0], args[1])
+			case "mysql":
+				out, ok = mysqlFullTextSQL(name, args[0], args[1])
+			}
+		}
+		if !ok {
+			dt.warn(RuleUntranslated, fmt.Sprintf("%s: %s has no %s translation; it is kept as it is (a tgpiler:dialect comment can give the SQL)",
+				dt.currentProcName, call, dialect))
+			return "", false
+		}
+		dt.warnings = append(dt.warnings, fmt.Sprintf("%s: %s becomes %s full-text search, whose stemming, stop words and ranking differ from SQL Server's",
+			dt.currentProcName, call, dialect))
+		return out, true
+	})
+}
+
+// fullTextColumns returns the columns of a full-text predicate, or false
+// for * and PROPERTY().
+func fullTextColumns(arg string) ([]string, bool) {
+	arg = strings.TrimSpace(arg)
+	if strings.HasPrefix(arg, "(") && strings.HasSuffix(arg, ")") {
+		arg = arg[1 : len(arg)-1]
+	}
+	cols := splitSQLArgs(arg)
+	for _, col := range cols {
+		if col == "" || strings.Contains(col, "*") || strings.Contains(col, "(") {
+			return nil, false
+		}
+	}
+	return cols, len(cols) > 0
+}
+
+func postgresFullTextSQL(name, columnArg, search string) (string, bool) {
+	cols, ok := fullTextColumns(columnArg)
+	if !ok {
+		return "", false
+	}
+	doc := cols[0]
+	if len(cols) > 1 {
+		doc = fmt.Sprintf("concat_ws(' ', %s)", strings.Join(cols, ", "))
+	}
+	var query string
+	switch {
+	case name == "FREETEXT":
+		// Any of the words, as FREETEXT matches
+		query = fmt.Sprintf("replace(plainto_tsquery(%s)::text, '&', '|')::tsquery", search)
+	default:
+		if cond, isLiteral := sqlUnquote(search); isLiteral {
+			terms, ok := parseFullTextCondition(cond)
+			if !ok {
+				return "", false
+			}
+			query = fmt.Sprintf("to_tsquery(%s)", sqlQuote(postgresTSQuery(terms)))
+		} else {
+			query = fmt.Sprintf("websearch_to_tsquery(%s)", search)
+		}
+	}
+	return fmt.Sprintf("to_tsvector(%s) @@ %s", doc, query), true
+}
+
+func mysqlFullTextSQL(name, columnArg, search string) (string, bool) {
+	cols, ok := fullTextColumns(columnArg)
+	if !ok {
+		return "", false
+	}
+	match := fmt.Sprintf("MATCH (%s) AGAINST", strings.Join(cols, ", "))
+	if name == "FREETEXT" {
+		return fmt.Sprintf("%s (%s IN NATURAL LANGUAGE MODE)", match, search), true
+	}
+	if cond, isLiteral := sqlUnquote(search); isLiteral {
+		terms, ok := parseFullTextCondition(cond)
+		if !ok {
+			return "", false
+		}
+		boolean, ok := mysqlBooleanQuery(terms)
+		if !ok {
+			return "", false
+		}
+		search = sqlQuote(boolean)
+	}
+	return fmt.Sprintf("%s (%s IN BOOLEAN MODE)", match, search), true
+}
+
+// fullTextTerm is a word or phrase of a CONTAINS search condition.
+type fullTextTerm struct {
+	op     string   // AND, OR or AND NOT, joining it to the term before
+	words  []string // The word, or the words of a phrase
+	prefix bool     // "word*"
+}
+
+// parseFullTextCondition parses a CONTAINS search condition made of words,
+// phrases and prefix terms joined by AND, OR and AND NOT (or &, | and &!).
+// It returns false for anything else.
+func parseFullTextCondition(cond string) ([]fullTextTerm, bool) {
+	var terms []fullTextTerm
+	op := ""
+	for i := 0; i < len(cond); {
+		c := cond[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+			continue
+		case c == '&' || c == '|' || c == '!':
+			word := map[byte]string{'&': "AND", '|': "OR", '!': "NOT"}[c]
+			if op, i = joinFullTextOp(op, word), i+1; op == "" {
+				return nil, false
+			}
+			continue
+		}
+
+		var text string
+		if c == '"' {
+			end := strings.IndexByte(cond[i+1:], '"')
+			if end < 0 {
+				return nil, false
+			}
+			text = cond[i+1 : i+1+end]
+			i += end + 2
+		} else {
+			j := i
+			for j < len(cond) && !strings.ContainsRune(" \t\r\n\"&|!()~,", rune(cond[j])) {
+				j++
+			}
+			if j == i {
+				return nil, false // Grouping, NEAR's ~ and the like
+			}
+			text = cond[i:j]
+			i = j
+			if word := strings.ToUpper(text); word == "AND" || word == "OR" || word == "NOT" {
+				if op = joinFullTextOp(op, word); op == "" {
+					return nil, false
+				}
+				continue
+			}
+		}
+
+		term := fullTextTerm{op: op}
+		text = strings.TrimSpace(text)
+		if strings.HasSuffix(text, "*") {
+			term.prefix = true
+			text = strings.TrimSuffix(text, "*")
+		}
+		term.words = strings.Fields(text)
+		if len(term.words) == 0 || (len(terms) == 0) != (op == "") || op == "NOT" {
+			return nil, false
+		}
+		for _, w := range term.words {
+			for _, r := range w {
+				if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+					return nil, false
+				}
+			}
+		}
+		terms = append(terms, term)
+		op = ""
+	}
+	return terms, len(terms) > 0 && op == ""
+}
+
+// joinFullTextOp adds an operator word to the one before it, returning ""
+// for a sequence that isn't AND, OR or AND NOT.
+func joinFullTextOp(before, word string) string {
+	switch {
+	case before == "":
+		return word
+	case before == "AND" && word == "NOT":
+		return "AND NOT"
+	}
+	return ""
+}
+
+// postgresTSQuery returns a search condition in to_tsquery syntax.
+func postgresTSQuery(terms []fullTextTerm) string {
+	var b strings.Builder
+	for _, t := range terms {
+		switch t.op {
+		case "AND":
+			b.WriteString(" & ")
+		case "OR":
+			b.WriteString(" | ")
+		case "AND NOT":
+			b.WriteString(" & !")
+		}
+		words := append([]string(nil), t.words...)
+		if t.prefix {
+			words[len(words)-1] += ":*"
+		}
+		if len(words) == 1 {
+			b.WriteString(words[0])
+		} else {
+			b.WriteString("(" + strings.Join(words, " <-> ") + ")")
+		}
+	}
+	return b.String()
+}
+
+// mysqlBooleanQuery returns a search condition in MySQL's boolean mode
+// syntax, which can't mix AND with OR.
+func mysqlBooleanQuery(terms []fullTextTerm) (string, bool) {
+	ands, ors := false, false
+	for _, t := range terms[1:] {
+		if t.op == "OR" {
+			ors = true
+		} else {
+			ands = true
+		}
+		if t.prefix && len(t.words) > 1 {
+			return "", false
+		}
+	}
+	if (ands && ors) || (terms[0].prefix && len(terms[0].words) > 1) {
+		return "", false
+	}
+	var parts []string
+	for _, t := range terms {
+		term := strings.Join(t.words, " ")
+		if len(t.words) > 1 {
+			term = `"` + term + `"`
+		}
+		if t.prefix {
+			term += "*"
+		}
+		switch {
+		case t.op == "AND NOT":
+			term = "-" + term
+		case ands:
+			term = "+" + term
+		}
+		parts = append(parts, term)
+	}
+	return strings.Join(parts, " "), true
+}
+
+// fullTextSearch returns the search condition of the first CONTAINS or
+// FREETEXT in a WHERE clause, or nil.
+func fullTextSearch(e ast.Expression) ast.Expression {
+	switch v := e.(type) {
+	case *ast.ContainsExpression:
+		return v.SearchTerm
+	case *ast.FreetextExpression:
+		return v.SearchTerm
+	case *ast.InfixExpression:
+		if search := fullTextSearch(v.Left); search != nil {
+			return search
+		}
+		return fullTextSearch(v.Right)
+	case *ast.PrefixExpression:
+		return fullTextSearch(v.Right)
+	}
+	return nil
+}
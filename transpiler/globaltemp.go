@@ -0,0 +1,147 @@
+package transpiler
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// Global temp tables
+//
+// SQL Server shares a ##table between every session, and legacy systems
+// use that to hand rows from one procedure to another: a nightly job fills
+// ##Staging and the procedures it calls read it. The generated code shares
+// them the same way. Every procedure's tempTables keeps its ##tables in
+// tsqlruntime.GlobalTables, the process's registry, and a ##table created
+// by any procedure of the source is kept in memory in every procedure
+// naming it, as long as all of their statements on it translate there
+// (see memtable.go).
+//
+// That sharing is a coupling the procedures' signatures don't show, so a
+// ##table named by more than one procedure is reported with a warning:
+// they only see each other's rows when they run in the same process, and
+// the table lives until it is dropped rather than until the session that
+// created it ends (see tsqlruntime.GlobalTempTables for its lifetime).
+
+// globalTempTablePattern matches the names of global temp tables.
+var globalTempTablePattern = regexp.MustCompile(`##[A-Za-z0-9_@$#]+`)
+
+// globalTempUse is a global temp table and the procedures naming it.
+type globalTempUse struct {
+	name     string   // As first written
+	procs    []string // In the order transpiled
+	creators map[string]bool
+}
+
+// isGlobalTempTable reports whether name is that of a global temp table.
+func isGlobalTempTable(name string) bool {
+	return strings.HasPrefix(name, "##")
+}
+
+// addGlobalTempTables adds the global temp tables the procedures of
+// program create to those kept in memory, unless a statement on one of
+// them doesn't translate there.
+func (t *transpiler) addGlobalTempTables(program *ast.Program) {
+	if t.globalTempTables == nil {
+		t.globalTempTables = map[string]*memoryTable{}
+	}
+	if !t.dmlEnabled || program == nil {
+		return
+	}
+	dt := &dmlTranspiler{transpiler: t, config: t.dmlConfig}
+	dt.memoryTables = map[string]*memoryTable{}
+	var uses []memoryUse
+	for _, stmt := range program.Statements {
+		proc, ok := stmt.(*ast.CreateProcedureStatement)
+		if !ok || proc.Body == nil {
+			continue
+		}
+		name := proc.Name.Parts[len(proc.Name.Parts)-1].Value
+		collectMemoryUses(proc.Body, name, &uses, func(s *ast.CreateTableStatement) {
+			if isGlobalTempTable(s.Name.String()) {
+				dt.addMemoryTable(s)
+			}
+		})
+	}
+	dt.keepInMemory(uses)
+	for name, table := range dt.memoryTables {
+		t.globalTempTables[name] = table
+	}
+}
+
+// namesGlobalTempTable reports whether body names a global temp table
+// kept in memory, so the procedure needs tempTables.
+func (t *transpiler) namesGlobalTempTable(body *ast.BeginEndBlock) bool {
+	if body == nil || len(t.globalTempTables) == 0 {
+		return false
+	}
+	sql := body.String()
+	for _, table := range t.globalTempTables {
+		if namesTable(sql, table.name) {
+			return true
+		}
+	}
+	return false
+}
+
+// recordGlobalTempTables records the global temp tables proc names and
+// creates, for globalTempWarnings.
+func (t *transpiler) recordGlobalTempTables(proc *ast.CreateProcedureStatement, procName string) {
+	if proc.Body == nil {
+		return
+	}
+	if t.globalTempUses == nil {
+		t.globalTempUses = map[string]*globalTempUse{}
+	}
+	use := func(name string) *globalTempUse {
+		key := strings.ToLower(name)
+		u, ok := t.globalTempUses[key]
+		if !ok {
+			u = &globalTempUse{name: name, creators: map[string]bool{}}
+			t.globalTempUses[key] = u
+		}
+		if n := len(u.procs); n == 0 || u.procs[n-1] != procName {
+			u.procs = append(u.procs, procName)
+		}
+		return u
+	}
+	for _, name := range globalTempTablePattern.FindAllString(proc.Body.String(), -1) {
+		use(name)
+	}
+	var uses []memoryUse
+	collectMemoryUses(proc.Body, procName, &uses, func(s *ast.CreateTableStatement) {
+		if name := s.Name.String(); isGlobalTempTable(name) {
+			use(name).creators[procName] = true
+		}
+	})
+}
+
+// globalTempWarnings returns a warning for each global temp table named
+// by more than one procedure.
+func (t *transpiler) globalTempWarnings() []string {
+	keys := make([]string, 0, len(t.globalTempUses))
+	for key, u := range t.globalTempUses {
+		if len(u.procs) > 1 {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	var warnings []string
+	for _, key := range keys {
+		u := t.globalTempUses[key]
+		procs := make([]string, len(u.procs))
+		for i, proc := range u.procs {
+			procs[i] = proc
+			if u.creators[proc] {
+				procs[i] += " (creates it)"
+			}
+		}
+		warnings = append(warnings, fmt.Sprintf(
+			"global temp table %s is shared by %s: they see each other's rows through tsqlruntime.GlobalTables only when run in one process, and it lives until dropped rather than until its session ends",
+			u.name, strings.Join(procs, ", ")))
+	}
+	return warnings
+}
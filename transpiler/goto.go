@@ -0,0 +1,213 @@
+package transpiler
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// GOTO and labels
+//
+// A label becomes a Go label, and GOTO a goto:
+//
+//	IF @err <> 0 GOTO ErrorHandler   ->  if err != 0 {
+//	                                         goto errorHandler
+//	                                     }
+//	...
+//	ErrorHandler:                    ->  errorHandler:
+//
+// Go is stricter than T-SQL about where goto may jump: not into a block
+// (to a label in an IF or WHILE the GOTO is outside of), not out of a
+// closure (a TRY block with --trycatch-mode=iife, a retried transaction),
+// and not forward over a variable declared in the label's block. The
+// declarations a GOTO would jump over are moved to the top of the body,
+// which T-SQL's procedure-wide variables allow; other GOTOs Go can't
+// make are reported as errors saying why.
+// Labels no GOTO jumps to become comments, as Go doesn't compile unused
+// labels.
+
+// labelsIn returns the labels defined in body, keyed by their lower-case
+// names, and the names GOTOs in body jump to.
+func labelsIn(body *ast.BeginEndBlock) (map[string]string, map[string]bool) {
+	labels := map[string]string{}
+	targets := map[string]bool{}
+	forEachStatement(body, func(stmt ast.Statement) {
+		switch s := stmt.(type) {
+		case *ast.LabelStatement:
+			labels[strings.ToLower(s.Name.Value)] = s.Name.Value
+		case *ast.GotoStatement:
+			targets[strings.ToLower(s.Label.Value)] = true
+		}
+	})
+	return labels, targets
+}
+
+// enterGotoScope restricts GOTOs to the labels of stmts, which are
+// written in a closure described by where, until the returned function
+// is called.
+func (t *transpiler) enterGotoScope(stmts []ast.Statement, where string) func() {
+	outerScope, outerWhere := t.gotoScope, t.gotoScopeName
+	scope := map[string]bool{}
+	forEachStatement(&ast.BeginEndBlock{Statements: stmts}, func(stmt ast.Statement) {
+		if s, ok := stmt.(*ast.LabelStatement); ok {
+			scope[strings.ToLower(s.Name.Value)] = true
+		}
+	})
+	t.gotoScope, t.gotoScopeName = scope, where
+	return func() {
+		t.gotoScope, t.gotoScopeName = outerScope, outerWhere
+	}
+}
+
+func (t *transpiler) transpileGoto(s *ast.GotoStatement) (string, error) {
+	key := strings.ToLower(s.Label.Value)
+	label, ok := t.labels[key]
+	if !ok {
+		return "", fmt.Errorf("GOTO %s: there is no label %s", s.Label.Value, s.Label.Value)
+	}
+	if t.gotoScope != nil && !t.gotoScope[key] {
+		return "", fmt.Errorf("GOTO %s can't leave %s", label, t.gotoScopeName)
+	}
+	return "goto " + goIdentifier(label), nil
+}
+
+func (t *transpiler) transpileLabel(s *ast.LabelStatement) (string, error) {
+	key := strings.ToLower(s.Name.Value)
+	if !t.gotoTargets[key] {
+		return fmt.Sprintf("// %s: (no GOTO jumps here)", s.Name.Value), nil
+	}
+	return goIdentifier(t.labels[key]) + ":", nil
+}
+
+// declaration matches a line declaring variables.
+var declaration = regexp.MustCompile(`^(?:var (\w+) |(\w+(?:, \w+)*) := )`)
+
+// labelLine matches a line holding a label.
+var labelLine = regexp.MustCompile(`^\t*\w+:$`)
+
+// declaredTypes are the types of the variables DML statements declare.
+var declaredTypes = map[string]string{
+	"result": "sql.Result",
+	"rows":   "*sql.Rows",
+	"tx":     "*sql.Tx",
+}
+
+// placeLabels checks that the gotos of the body written to out from
+// bodyStart jump where Go allows, and outdents their labels as gofmt
+// does. Declarations a goto jumps over are moved to the top of the body
+// when their types are known, leaving assignments in their place.
+func (t *transpiler) placeLabels(out *strings.Builder, bodyStart int) error {
+	if len(t.gotoTargets) == 0 {
+		return nil
+	}
+	content := out.String()
+	lines := strings.Split(content[bodyStart:], "\n")
+	indent := func(line string) int {
+		return len(line) - len(strings.TrimLeft(line, "\t"))
+	}
+
+	names := map[string]string{}
+	for key := range t.gotoTargets {
+		if label, ok := t.labels[key]; ok {
+			names[goIdentifier(label)] = label
+		}
+	}
+	at := map[string]int{}
+	for i, line := range lines {
+		if label := strings.TrimSuffix(strings.TrimSpace(line), ":"); labelLine.MatchString(line) && names[label] != "" {
+			at[label] = i
+		}
+	}
+
+	var hoisted []string
+	declared := map[string]bool{}
+	for g, line := range lines {
+		label := strings.TrimPrefix(strings.TrimSpace(line), "goto ")
+		l, ok := at[label]
+		if names[label] == "" || !ok {
+			continue
+		}
+		depth := indent(lines[l])
+		from, to := g, l
+		if l < g {
+			from, to = l, g
+		}
+		if indent(line) < depth {
+			return fmt.Errorf("GOTO %s jumps into a block, which Go doesn't allow", names[label])
+		}
+		for i := from + 1; i < to; i++ {
+			between := lines[i]
+			// Labels are outdented, and don't end blocks
+			if strings.TrimSpace(between) == "" || labelLine.MatchString(between) {
+				continue
+			}
+			if indent(between) < depth {
+				return fmt.Errorf("GOTO %s jumps into a block, which Go doesn't allow", names[label])
+			}
+			if g > l || indent(between) != depth || !declaration.MatchString(between[depth:]) {
+				continue
+			}
+			decls, assign, ok := t.hoistDeclaration(between[depth:])
+			if !ok {
+				m := declaration.FindStringSubmatch(between[depth:])
+				return fmt.Errorf("GOTO %s jumps over the declaration of %s, which Go doesn't allow; declare it before the GOTO",
+					names[label], m[1]+m[2])
+			}
+			for _, decl := range decls {
+				if name := strings.Fields(decl)[1]; !declared[name] {
+					declared[name] = true
+					hoisted = append(hoisted, "\t"+decl)
+				}
+			}
+			lines[i] = between[:depth] + assign
+		}
+	}
+
+	for _, l := range at {
+		lines[l] = strings.TrimPrefix(lines[l], "\t")
+	}
+	var body []string
+	for _, line := range lines {
+		// Hoisted declarations without values leave nothing behind
+		if strings.TrimSpace(line) != "" || line == "" {
+			body = append(body, line)
+		}
+	}
+	if len(hoisted) > 0 {
+		body = append(append([]string{"\t// Declared here, as GOTOs below may not jump over declarations"}, hoisted...), body...)
+	}
+	out.Reset()
+	out.WriteString(content[:bodyStart] + strings.Join(body, "\n"))
+	return nil
+}
+
+// hoistDeclaration returns the declarations the declaration line would
+// make, and the assignment left in its place, or false when the types
+// of the variables aren't known.
+func (t *transpiler) hoistDeclaration(line string) ([]string, string, bool) {
+	if rest, ok := strings.CutPrefix(line, "var "); ok {
+		decl, value, hasValue := strings.Cut(rest, " = ")
+		if !hasValue {
+			return []string{line}, "", true
+		}
+		return []string{"var " + decl}, strings.Fields(decl)[0] + " = " + value, true
+	}
+	lhs, rhs, _ := strings.Cut(line, " := ")
+	var decls []string
+	for _, name := range strings.Split(lhs, ", ") {
+		switch {
+		case name == "err" && t.hasDMLStatements:
+			// A named result
+		case declaredTypes[name] != "":
+			t.imports["database/sql"] = true
+			decls = append(decls, fmt.Sprintf("var %s %s", name, declaredTypes[name]))
+		case t.symbols.lookup(name) != nil:
+			decls = append(decls, fmt.Sprintf("var %s %s", name, t.symbols.lookup(name).goType))
+		default:
+			return nil, "", false
+		}
+	}
+	return decls, lhs + " = " + rhs, true
+}
@@ -0,0 +1,40 @@
+package transpiler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Target Go toolchain (--go-version).
+//
+// Generated code defaults to a conservative baseline that builds with older
+// toolchains. Naming a newer version opts in to constructs introduced since:
+// the min/max builtins (Go 1.21) and the generic sql.Null[T] (Go 1.22).
+const baselineGoMinor = 20
+
+// ParseGoVersion parses a Go version such as "1.22", "1.21.5" or "go1.22"
+// and returns its minor version number.
+func ParseGoVersion(v string) (int, error) {
+	s := strings.TrimPrefix(strings.TrimSpace(v), "go")
+	parts := strings.Split(s, ".")
+	if len(parts) < 2 || parts[0] != "1" {
+		return 0, fmt.Errorf("invalid Go version %q (expected e.g. 1.22)", v)
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil || minor < 0 {
+		return 0, fmt.Errorf("invalid Go version %q (expected e.g. 1.22)", v)
+	}
+	return minor, nil
+}
+
+// goAtLeast reports whether generated code may use features of Go 1.minor.
+func (t *transpiler) goAtLeast(minor int) bool {
+	target := baselineGoMinor
+	if t.dmlConfig.GoVersion != "" {
+		if m, err := ParseGoVersion(t.dmlConfig.GoVersion); err == nil {
+			target = m
+		}
+	}
+	return target >= minor
+}
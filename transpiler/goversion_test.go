@@ -0,0 +1,78 @@
+package transpiler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseGoVersion(t *testing.T) {
+	tests := []struct {
+		in      string
+		minor   int
+		wantErr bool
+	}{
+		{"1.22", 22, false},
+		{"go1.21", 21, false},
+		{"1.21.5", 21, false},
+		{"2.0", 0, true},
+		{"1", 0, true},
+		{"latest", 0, true},
+	}
+	for _, tt := range tests {
+		minor, err := ParseGoVersion(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseGoVersion(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if minor != tt.minor {
+			t.Errorf("ParseGoVersion(%q) = %d, want %d", tt.in, minor, tt.minor)
+		}
+	}
+}
+
+func TestGoVersionFeatures(t *testing.T) {
+	sql := `
+CREATE PROCEDURE Clamp
+    @A INT,
+    @B BIGINT,
+    @D DECIMAL(10,2)
+AS
+BEGIN
+    DECLARE @X BIGINT = GREATEST(@A, @B, 0)
+    DECLARE @Y DECIMAL(10,2) = LEAST(@D, 5)
+    SELECT Name FROM Items WHERE Qty > @X AND Price < @Y
+END
+`
+	tests := []struct {
+		version string
+		want    []string
+	}{
+		{"", []string{
+			"func() int64 { m := int64(a); for _, v := range []int64{b, 0} { if v > m { m = v } }; return m }()",
+			"decimal.Min(d, decimal.NewFromInt(5))",
+			"var nameNull sql.NullString",
+		}},
+		{"1.21", []string{
+			"max(int64(a), b, 0)",
+			"var nameNull sql.NullString",
+		}},
+		{"1.22", []string{
+			"max(int64(a), b, 0)",
+			"var nameNull sql.Null[string]",
+			"name = nameNull.V",
+		}},
+	}
+	for _, tt := range tests {
+		config := DefaultDMLConfig()
+		config.GoVersion = tt.version
+		result, err := TranspileWithDML(sql, "main", config)
+		if err != nil {
+			t.Fatalf("go-version %q: TranspileWithDML failed: %v", tt.version, err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(result, want) {
+				t.Errorf("go-version %q: expected %q, got:\n%s", tt.version, want, result)
+			}
+		}
+	}
+}
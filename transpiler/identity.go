@@ -0,0 +1,302 @@
+package transpiler
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// Identity values
+//
+// SCOPE_IDENTITY() and @@IDENTITY read the identity value of the last
+// INSERT. A procedure that reads them declares lastInsertID, and each
+// INSERT a later read may see keeps its identity value there:
+//
+//   - PostgreSQL adds RETURNING with the table's identity column
+//   - MySQL and SQLite take result.LastInsertId()
+//   - SQL Server runs SELECT SCOPE_IDENTITY() in the INSERT's batch, since
+//     a batch of its own is another scope and would read NULL
+//
+// An INSERT with an OUTPUT clause already returns rows, so the identity
+// column is added as their last column instead (see outputKeepsIdentity).
+// OUTPUT INTO a permanent table returns none: SQL Server still runs SELECT
+// SCOPE_IDENTITY() after it, and PostgreSQL fails.
+//
+// The identity column comes from the schema (--schema, or a CREATE TABLE
+// in the source); failing that it is the table's singular name plus ID,
+// with a warning. The reads become lastInsertID, in Go and in queries.
+//
+// IDENT_CURRENT('table') assigned to a variable calls
+// tsqlruntime.IdentCurrent, which asks the database.
+
+var identityReadRe = regexp.MustCompile(`(?i)\bSCOPE_IDENTITY\s*\(\s*\)|@@IDENTITY\b`)
+
+// identityScan finds the INSERTs whose identity value is read, taking the
+// statements in source order: a read sees the INSERT before it.
+type identityScan struct {
+	last    *ast.InsertStatement
+	inserts map[*ast.InsertStatement]bool
+}
+
+func (s *identityScan) statements(stmts []ast.Statement) {
+	for _, stmt := range stmts {
+		s.statement(stmt)
+	}
+}
+
+func (s *identityScan) statement(stmt ast.Statement) {
+	switch st := stmt.(type) {
+	case *ast.BeginEndBlock:
+		if st != nil {
+			s.statements(st.Statements)
+		}
+	case *ast.IfStatement:
+		s.read(st.Condition.String())
+		s.statement(st.Consequence)
+		if st.Alternative != nil {
+			s.statement(st.Alternative)
+		}
+	case *ast.WhileStatement:
+		s.read(st.Condition.String())
+		s.statement(st.Body)
+	case *ast.TryCatchStatement:
+		if st.TryBlock != nil {
+			s.statements(st.TryBlock.Statements)
+		}
+		if st.CatchBlock != nil {
+			s.statements(st.CatchBlock.Statements)
+		}
+	case *ast.InsertStatement:
+		s.read(st.String())
+		s.last = st
+	case nil:
+	default:
+		s.read(st.String())
+	}
+}
+
+func (s *identityScan) read(sql string) {
+	if s.last != nil && identityReadRe.MatchString(sql) {
+		s.inserts[s.last] = true
+	}
+}
+
+// scanIdentityReads notes whether a procedure body reads identity values
+// and which of its INSERTs they read.
+func (t *transpiler) scanIdentityReads(body *ast.BeginEndBlock) {
+	t.usesIdentity = false
+	t.identityInserts = map[*ast.InsertStatement]bool{}
+	if !t.dmlEnabled || body == nil || (t.dmlConfig.SequenceMode != "db" && t.dmlConfig.SequenceMode != "") ||
+		!identityReadRe.MatchString(body.String()) {
+		return
+	}
+	t.usesIdentity = true
+	scan := &identityScan{inserts: t.identityInserts}
+	scan.statements(body.Statements)
+}
+
+// isIdentityRead reports whether e is SCOPE_IDENTITY() or @@IDENTITY.
+func isIdentityRead(e ast.Expression) bool {
+	switch v := e.(type) {
+	case *ast.FunctionCall:
+		return strings.EqualFold(v.Function.String(), "SCOPE_IDENTITY") && len(v.Arguments) == 0
+	case *ast.Variable:
+		return strings.EqualFold(v.Name, "@@IDENTITY")
+	}
+	return false
+}
+
+// identityValue converts lastInsertID, the value of e, to the type of the
+// variable it is assigned to. Other values are returned as they are.
+func (t *transpiler) identityValue(ti *typeInfo, e ast.Expression, value string) string {
+	if !t.usesIdentity || !isIdentityRead(e) || ti == nil {
+		return value
+	}
+	switch ti.goType {
+	case "int", "int32", "int16", "uint8", "float64":
+		return fmt.Sprintf("%s(%s)", ti.goType, value)
+	case "string":
+		t.imports["strconv"] = true
+		return fmt.Sprintf("strconv.FormatInt(%s, 10)", value)
+	}
+	return value
+}
+
+// identityAssignments returns SELECT @a = SCOPE_IDENTITY(), with no FROM,
+// as SET statements, or nil for other SELECTs.
+func (t *transpiler) identityAssignments(s *ast.SelectStatement) []*ast.SetStatement {
+	if !t.usesIdentity || s.From != nil || s.Where != nil || len(s.Columns) == 0 {
+		return nil
+	}
+	var sets []*ast.SetStatement
+	for _, col := range s.Columns {
+		if col.Variable == nil || !isIdentityRead(col.Expression) {
+			return nil
+		}
+		sets = append(sets, &ast.SetStatement{Variable: col.Variable, Value: col.Expression})
+	}
+	return sets
+}
+
+// bindIdentityReads turns the identity reads in a query into a variable
+// bound to lastInsertID.
+func (dt *dmlTranspiler) bindIdentityReads(query string, hoisted map[string]string) (string, map[string]string) {
+	if !dt.usesIdentity || !identityReadRe.MatchString(query) {
+		return query, hoisted
+	}
+	if hoisted == nil {
+		hoisted = map[string]string{}
+	}
+	hoisted["lastinsertid"] = "lastInsertID"
+	return identityReadRe.ReplaceAllString(query, "@lastInsertID"), hoisted
+}
+
+// identityColumn returns the identity column of table, from the schema or
+// guessed from its name.
+func (dt *dmlTranspiler) identityColumn(table string) string {
+	for col, kind := range dt.generatedColumns[strings.ToLower(unqualifiedName(table))] {
+		if kind == GeneratedIdentity {
+			return col
+		}
+	}
+	col := singularTableName(unqualifiedName(table)) + "ID"
+	dt.warnings = append(dt.warnings, fmt.Sprintf("%s: INSERT INTO %s: identity column not in the schema, RETURNING %s assumed; pass --schema to use the declared one",
+		dt.currentProcName, table, col))
+	return col
+}
+
+// singularTableName returns the singular of a table name, as Orders gives
+// Order and Addresses gives Address.
+func singularTableName(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, "ies"):
+		return name[:len(name)-3] + "y"
+	case strings.HasSuffix(lower, "sses"), strings.HasSuffix(lower, "xes"),
+		strings.HasSuffix(lower, "ches"), strings.HasSuffix(lower, "shes"):
+		return name[:len(name)-2]
+	case strings.HasSuffix(lower, "s") && !strings.HasSuffix(lower, "ss"):
+		return name[:len(name)-1]
+	}
+	return name
+}
+
+// transpileIdentityInsert runs an INSERT that keeps its identity value in
+// lastInsertID, for dialects that return it from the query. query and args
+// are the bound INSERT.
+func (dt *dmlTranspiler) transpileIdentityInsert(s *ast.InsertStatement, query string, args []string) string {
+	var out strings.Builder
+	ind := dt.indentStr()
+	onErr := dt.buildErrorReturn()
+	if dt.inCatchBlock {
+		onErr = "_ = err // Error logging failed, but we're already in error handling"
+	}
+	argList := ""
+	for _, arg := range args {
+		argList += ", " + arg
+	}
+
+	out.WriteString("// INSERT query, keeping the identity value\n")
+	if dt.config.SQLDialect == "sqlserver" {
+		// @@ROWCOUNT in the same SELECT still counts the INSERT
+		targets := "&lastInsertID"
+		query += "; SELECT CAST(SCOPE_IDENTITY() AS BIGINT)"
+		if dt.usesRowCount {
+			query += ", @@ROWCOUNT"
+			targets += ", &rowsAffected"
+		}
+		out.WriteString(fmt.Sprintf("%sif err := %s.QueryRowContext(ctx, %q%s).Scan(%s); err != nil {\n", ind, dt.getDBVar(), query, argList, targets))
+		out.WriteString(fmt.Sprintf("%s\t%s\n", ind, onErr))
+		out.WriteString(ind + "}")
+		return out.String()
+	}
+
+	// PostgreSQL returns a row per row inserted; the last one wins, as
+	// with SCOPE_IDENTITY()
+	query += " RETURNING " + dt.identityColumn(dt.extractInsertTable(s))
+	assignOp := ":="
+	if dt.symbols.isDeclared("rows") && dt.symbols.isDeclared("err") {
+		assignOp = "="
+	}
+	dt.symbols.markDeclared("rows")
+	dt.symbols.markDeclared("err")
+	out.WriteString(fmt.Sprintf("%srows, err %s %s.QueryContext(ctx, %q%s)\n", ind, assignOp, dt.getDBVar(), query, argList))
+	out.WriteString(ind + "if err != nil {\n")
+	out.WriteString(fmt.Sprintf("%s\t%s\n", ind, onErr))
+	out.WriteString(ind + "}\n")
+	out.WriteString(ind + "defer rows.Close()\n")
+	if dt.usesRowCount {
+		out.WriteString(ind + "rowsAffected = 0\n")
+	}
+	out.WriteString(ind + "for rows.Next() {\n")
+	out.WriteString(fmt.Sprintf("%s\tif err := rows.Scan(&lastInsertID); err != nil {\n", ind))
+	out.WriteString(fmt.Sprintf("%s\t\t%s\n", ind, onErr))
+	out.WriteString(ind + "\t}\n")
+	if dt.usesRowCount {
+		out.WriteString(ind + "\trowsAffected++\n")
+	}
+	out.WriteString(ind + "}")
+	return out.String()
+}
+
+// identityResult keeps the identity value of an INSERT run with
+// ExecContext, from result.LastInsertId(). MySQL gives the first value of a
+// multi-row INSERT, not the last.
+func (dt *dmlTranspiler) identityResult(s *ast.InsertStatement) string {
+	if dt.config.SQLDialect == "mysql" && (len(s.Values) > 1 || s.Select != nil) {
+		dt.warnings = append(dt.warnings, fmt.Sprintf("%s: INSERT INTO %s adds several rows; MySQL's LastInsertId is the first identity value, where SCOPE_IDENTITY() reads the last",
+			dt.currentProcName, dt.extractInsertTable(s)))
+	}
+	onErr := dt.buildErrorReturn()
+	if dt.inCatchBlock {
+		onErr = "_ = err // Error logging failed, but we're already in error handling"
+	}
+	ind := dt.indentStr()
+	var out strings.Builder
+	out.WriteString(ind + "if id, err := result.LastInsertId(); err != nil {\n")
+	out.WriteString(fmt.Sprintf("%s\t%s\n", ind, onErr))
+	out.WriteString(ind + "} else {\n")
+	out.WriteString(ind + "\tlastInsertID = id\n")
+	out.WriteString(ind + "}\n")
+	return out.String()
+}
+
+// transpileIdentCurrentAssign assigns IDENT_CURRENT('table') to target,
+// returning the error. It returns false where the argument isn't a table
+// name or the variable isn't numeric.
+func (t *transpiler) transpileIdentCurrentAssign(target string, ti *typeInfo, e ast.Expression) (string, bool) {
+	fc, ok := e.(*ast.FunctionCall)
+	if !ok || !t.dmlEnabled || !strings.EqualFold(fc.Function.String(), "IDENT_CURRENT") || len(fc.Arguments) != 1 || ti == nil {
+		return "", false
+	}
+	lit, ok := fc.Arguments[0].(*ast.StringLiteral)
+	if !ok {
+		return "", false
+	}
+	value := "v"
+	switch ti.goType {
+	case "int64":
+	case "int", "int32", "int16", "uint8", "float64":
+		value = fmt.Sprintf("%s(v)", ti.goType)
+	default:
+		return "", false
+	}
+	dt := &dmlTranspiler{transpiler: t, config: t.dmlConfig}
+	column := ""
+	if t.dmlConfig.SQLDialect == "postgres" {
+		column = dt.identityColumn(lit.Value)
+	}
+	t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+	ind := t.indentStr()
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("// IDENT_CURRENT('%s')\n", lit.Value))
+	out.WriteString(fmt.Sprintf("%sif v, err := tsqlruntime.IdentCurrent(ctx, %s, %q, %q, %q); err != nil {\n",
+		ind, dt.getDBVar(), t.dmlConfig.SQLDialect, lit.Value, column))
+	out.WriteString(fmt.Sprintf("%s\t%s\n", ind, t.buildErrorReturn()))
+	out.WriteString(fmt.Sprintf("%s} else {\n", ind))
+	out.WriteString(fmt.Sprintf("%s\t%s = %s\n", ind, target, value))
+	out.WriteString(ind + "}")
+	return out.String(), true
+}
@@ -0,0 +1,95 @@
+package transpiler
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Interface and mock generation
+//
+// Service layers that call the generated procedures are easier to test
+// against an interface than against the concrete Repository. GenerateInterface
+// writes that interface on its own, for users who keep their own Repository
+// struct, along with a mock in one of three forms:
+//
+//	MockGomock  //go:generate mockgen -source=$GOFILE ...
+//	MockMoq     //go:generate moq ...
+//	MockFunc    a RepositoryMock struct with one func field per method,
+//	            written directly so no tool is needed
+
+// Mock kinds for GenerateInterface
+const (
+	MockNone   = ""
+	MockGomock = "gomock" // go:generate stanza for go.uber.org/mock/mockgen
+	MockMoq    = "moq"    // go:generate stanza for github.com/matryer/moq
+	MockFunc   = "func"   // Generated func-field mock
+)
+
+// GenerateInterface returns Go source declaring an interface of every
+// exported method of the receiver type in code, named <Type>API, and the
+// mock of the given kind.
+func GenerateInterface(code []string, packageName string, config DMLConfig, mock string) (string, error) {
+	scan, err := scanReceiver(code, config)
+	if err != nil {
+		return "", err
+	}
+	typeName := scan.typeName
+	api := typeName + "API"
+	base := strings.ToLower(typeName)
+
+	var out strings.Builder
+	writeScaffoldHeader(&out, packageName, scan.imports)
+	switch mock {
+	case MockNone, MockFunc:
+	case MockGomock:
+		out.WriteString(fmt.Sprintf("//go:generate mockgen -source=$GOFILE -destination=%s_mock.go -package=%s\n\n", base, packageName))
+	case MockMoq:
+		out.WriteString(fmt.Sprintf("//go:generate moq -out %s_moq.go . %s\n\n", base, api))
+	default:
+		return "", fmt.Errorf("unknown mock kind %q (valid: %s, %s, %s)", mock, MockGomock, MockMoq, MockFunc)
+	}
+	writeRepoInterface(&out, scan, config)
+
+	if mock == MockFunc {
+		out.WriteString("\n")
+		writeFuncMock(&out, scan)
+	}
+	return formatScaffold(out.String(), "interface")
+}
+
+// writeFuncMock writes <Type>Mock, whose methods call the func field of the
+// same name. Calling a method whose field is unset panics, naming it.
+func writeFuncMock(out *strings.Builder, scan *repoScan) {
+	mock := scan.typeName + "Mock"
+	out.WriteString(fmt.Sprintf("// %s is a %sAPI for tests. Each method calls\n// the field of the same name with a Func suffix; set the ones the test\n// needs.\n", mock, scan.typeName))
+	out.WriteString(fmt.Sprintf("type %s struct {\n", mock))
+	for _, m := range scan.methods {
+		out.WriteString(fmt.Sprintf("\t%sFunc func%s\n", m.name, m.sig))
+	}
+	out.WriteString("}\n\n")
+	out.WriteString(fmt.Sprintf("var _ %sAPI = (*%s)(nil)\n", scan.typeName, mock))
+
+	for _, m := range scan.methods {
+		args := strings.Join(m.args, ", ")
+		if m.variadic {
+			args += "..."
+		}
+		// The receiver can't share a name with a parameter
+		recv := "m"
+		for _, arg := range m.args {
+			if arg == recv {
+				recv = "mock"
+			}
+		}
+		call := fmt.Sprintf("%s.%sFunc(%s)", recv, m.name, args)
+		if m.results {
+			call = "return " + call
+		}
+		out.WriteString(fmt.Sprintf("\nfunc (%s *%s) %s%s {\n", recv, mock, m.name, m.sig))
+		out.WriteString(fmt.Sprintf("\tif %s.%sFunc == nil {\n", recv, m.name))
+		out.WriteString(fmt.Sprintf("\t\tpanic(\"%s.%s called but %sFunc is not set\")\n", mock, m.name, m.name))
+		out.WriteString("\t}\n")
+		out.WriteString(fmt.Sprintf("\t%s\n", call))
+		out.WriteString("}\n")
+	}
+}
@@ -0,0 +1,189 @@
+package transpiler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// Isolation levels and locking hints
+//
+// SET TRANSACTION ISOLATION LEVEL sets the level of the transactions the
+// procedure begins after it, which pass it to BeginTx:
+//
+//	SET TRANSACTION ISOLATION LEVEL SERIALIZABLE
+//	BEGIN TRANSACTION -> tx, err := r.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+//
+// SNAPSHOT is SQL Server's own; PostgreSQL's and MySQL's REPEATABLE READ
+// read from a snapshot too, so it becomes that there. SQLite transactions
+// are always serializable, and take no level.
+//
+// Table hints are stripped from queries (see stripTableHints), but on
+// PostgreSQL and MySQL a SELECT reading a table WITH (UPDLOCK) or (XLOCK)
+// ends in FOR UPDATE instead, and one WITH (HOLDLOCK), (REPEATABLEREAD)
+// or (SERIALIZABLE) in FOR SHARE, so the rows stay locked until the
+// transaction ends as they would on SQL Server. NOWAIT and READPAST
+// become NOWAIT and SKIP LOCKED. When only some of the tables are hinted
+// the clause names them: FOR UPDATE OF i.
+
+// isolationLevels maps T-SQL's isolation levels to database/sql's.
+var isolationLevels = map[string]string{
+	"READ UNCOMMITTED": "sql.LevelReadUncommitted",
+	"READ COMMITTED":   "sql.LevelReadCommitted",
+	"REPEATABLE READ":  "sql.LevelRepeatableRead",
+	"SERIALIZABLE":     "sql.LevelSerializable",
+	"SNAPSHOT":         "sql.LevelSnapshot",
+}
+
+// transpileSetIsolation records the isolation level of the transactions
+// begun after s.
+func (t *transpiler) transpileSetIsolation(s *ast.SetTransactionIsolationStatement) (string, error) {
+	level := strings.Join(strings.Fields(strings.ToUpper(s.Level)), " ")
+	goLevel, ok := isolationLevels[level]
+	if !ok {
+		return "", fmt.Errorf("unknown isolation level %s", s.Level)
+	}
+	comment := fmt.Sprintf("// SET TRANSACTION ISOLATION LEVEL %s", level)
+	switch t.dmlConfig.SQLDialect {
+	case "sqlite":
+		t.isolationLevel = ""
+		if level != "SERIALIZABLE" {
+			t.warnings = append(t.warnings, fmt.Sprintf("%s: SET TRANSACTION ISOLATION LEVEL %s was dropped; SQLite transactions are always serializable",
+				t.currentProcName, level))
+		}
+		return comment + ": SQLite transactions are always serializable", nil
+	case "postgres", "mysql":
+		if level == "SNAPSHOT" {
+			goLevel = "sql.LevelRepeatableRead"
+			comment += " (REPEATABLE READ, which reads from a snapshot)"
+		}
+	}
+	t.isolationLevel = goLevel
+	return fmt.Sprintf("%s: transactions begun below use %s", comment, goLevel), nil
+}
+
+// txOptions returns the options BeginTx is called with for a transaction
+// begun now.
+func (t *transpiler) txOptions() string {
+	if t.isolationLevel == "" {
+		return "nil"
+	}
+	t.imports["database/sql"] = true
+	return fmt.Sprintf("&sql.TxOptions{Isolation: %s}", t.isolationLevel)
+}
+
+// lockedTable is a table a SELECT reads with a locking hint.
+type lockedTable struct {
+	name   string // Alias, or table name
+	update bool   // UPDLOCK or XLOCK, rather than HOLDLOCK
+	hints  []string
+}
+
+// lockedTables returns the tables of from read with locking hints, and
+// how many tables it reads in all.
+func lockedTables(from *ast.FromClause) ([]lockedTable, int) {
+	var locked []lockedTable
+	count := 0
+	var walk func(ref ast.TableReference)
+	walk = func(ref ast.TableReference) {
+		switch r := ref.(type) {
+		case *ast.JoinClause:
+			walk(r.Left)
+			walk(r.Right)
+		case *ast.TableName:
+			count++
+			table := lockedTable{hints: r.Hints}
+			hinted := false
+			for _, hint := range r.Hints {
+				switch strings.ToUpper(strings.TrimSpace(hint)) {
+				case "UPDLOCK", "XLOCK":
+					table.update, hinted = true, true
+				case "HOLDLOCK", "REPEATABLEREAD", "SERIALIZABLE":
+					hinted = true
+				}
+			}
+			if !hinted {
+				return
+			}
+			table.name = r.Name.Parts[len(r.Name.Parts)-1].Value
+			if r.Alias != nil {
+				table.name = r.Alias.Value
+			}
+			locked = append(locked, table)
+		default:
+			count++
+		}
+	}
+	if from != nil {
+		for _, ref := range from.Tables {
+			walk(ref)
+		}
+	}
+	return locked, count
+}
+
+// lockingClause returns the FOR UPDATE or FOR SHARE clause that keeps the
+// locks s's table hints take, or "".
+func (dt *dmlTranspiler) lockingClause(s *ast.SelectStatement) string {
+	if dt.config.SQLDialect != "postgres" && dt.config.SQLDialect != "mysql" {
+		return ""
+	}
+	locked, count := lockedTables(s.From)
+	if len(locked) == 0 {
+		return ""
+	}
+	if s.Distinct || len(s.GroupBy) > 0 || s.Having != nil || hasAggregate(s.Columns) {
+		dt.warnOnce(fmt.Sprintf("%s: the locking hints on %s were removed; FOR UPDATE and FOR SHARE can't lock the rows of a grouped or DISTINCT SELECT",
+			dt.currentProcName, locked[0].name))
+		return ""
+	}
+
+	clause := " FOR SHARE"
+	var names []string
+	nowait, skipLocked := false, false
+	for _, table := range locked {
+		if table.update {
+			clause = " FOR UPDATE"
+		}
+		names = append(names, table.name)
+		for _, hint := range table.hints {
+			switch strings.ToUpper(strings.TrimSpace(hint)) {
+			case "NOWAIT":
+				nowait = true
+			case "READPAST":
+				skipLocked = true
+			}
+		}
+	}
+	if len(locked) < count {
+		clause += " OF " + strings.Join(names, ", ")
+	}
+	switch {
+	case nowait:
+		clause += " NOWAIT"
+	case skipLocked:
+		clause += " SKIP LOCKED"
+	}
+	return clause
+}
+
+// hasAggregate reports whether any of cols is an aggregate.
+func hasAggregate(cols []ast.SelectColumn) bool {
+	for _, col := range cols {
+		if fc, ok := col.Expression.(*ast.FunctionCall); ok && fc.Over == nil && aggregateFunctions[strings.ToUpper(fc.Function.String())] {
+			return true
+		}
+	}
+	return false
+}
+
+// warnOnce records warning unless it already has been.
+func (t *transpiler) warnOnce(warning string) {
+	for _, w := range t.warnings {
+		if w == warning {
+			return
+		}
+	}
+	t.warnings = append(t.warnings, warning)
+}
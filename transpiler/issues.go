@@ -0,0 +1,315 @@
+package transpiler
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// Structured diagnostics
+//
+// Warnings and diagnostics are strings and Diagnostics in a
+// TranspileResult, printed to stderr by the command. For code scanning and
+// editors they are also Issues: each has the file and line it comes from,
+// a rule and a severity. The line is that of the top-level statement that
+// gave rise to it, the CREATE PROCEDURE of a warning about its body or the
+// skipped DDL statement itself; 0 where there is none, as for temp tables
+// left on the fallback backend. MarshalSARIF writes Issues as a SARIF 2.1.0
+// log, which GitHub code scanning reads.
+
+// Severity is how serious an Issue is, as SARIF levels go.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	SeverityNote    Severity = "note"
+)
+
+// Rules of Issues.
+const (
+	RuleDDLSkipped           = "ddl-skipped"
+	RuleTranslation          = "translation"
+	RuleUntranslated         = "untranslated"
+	RuleComplexField         = "complex-field"
+	RuleTempTableFallback    = "temp-table-fallback"
+	RuleUnroutedTable        = "unrouted-table"
+	RuleLowConfidenceMapping = "low-confidence-mapping"
+	RuleSuggestion           = "suggestion"
+)
+
+// IssueRule describes a rule of Issues.
+type IssueRule struct {
+	ID          string
+	Description string
+	Severity    Severity
+}
+
+// IssueRules are the rules an Issue may have.
+var IssueRules = []IssueRule{
+	{RuleDDLSkipped, "DDL statement skipped; it belongs in database migrations", SeverityWarning},
+	{RuleTranslation, "T-SQL with no exact Go translation", SeverityWarning},
+	{RuleUntranslated, "T-SQL with no translation for the backend, kept as it is", SeverityWarning},
+	{RuleComplexField, "WHERE expression left out of a gRPC request", SeverityWarning},
+	{RuleTempTableFallback, "Temp tables use the default fallback backend", SeverityNote},
+	{RuleUnroutedTable, "Table with no --table-service entry", SeverityWarning},
+	{RuleLowConfidenceMapping, "Proto method mapped to a procedure with low confidence", SeverityWarning},
+	{RuleSuggestion, "Problem with a suggested flag setting", SeverityWarning},
+}
+
+// Issue is a warning or diagnostic located in its source.
+type Issue struct {
+	File       string      `json:"file,omitempty"`
+	Line       int         `json:"line,omitempty"`
+	Rule       string      `json:"rule"`
+	Severity   Severity    `json:"severity"`
+	Procedure  string      `json:"procedure,omitempty"`
+	Message    string      `json:"message"`
+	Suggestion *Suggestion `json:"suggestion,omitempty"`
+}
+
+// Issues returns the warnings and diagnostics of r as Issues of file.
+// TempTableWarnings are left out, as their Diagnostic says the same.
+func (r *TranspileResult) Issues(file string) []Issue {
+	var issues []Issue
+	for i, w := range r.DDLWarnings {
+		issues = append(issues, Issue{File: file, Line: lineAt(r.ddlWarningLines, i), Rule: RuleDDLSkipped, Severity: SeverityWarning, Message: w})
+	}
+	for i, w := range r.Warnings {
+		rule := RuleTranslation
+		if id, ok := r.warningRules[i]; ok {
+			rule = id
+		}
+		issues = append(issues, Issue{File: file, Line: lineAt(r.warningLines, i), Rule: rule, Severity: SeverityWarning, Message: w})
+	}
+	for i, d := range r.Diagnostics {
+		issues = append(issues, d.Issue(file, lineAt(r.diagnosticLines, i)))
+	}
+	return issues
+}
+
+// Issue returns d as an Issue on line of file, its rule from the flag its
+// suggestion sets.
+func (d Diagnostic) Issue(file string, line int) Issue {
+	rule, severity := RuleSuggestion, SeverityWarning
+	switch d.Suggestion.Flag {
+	case "table-service":
+		rule = RuleUnroutedTable
+	case "fallback-backend":
+		rule, severity = RuleTempTableFallback, SeverityNote
+	case "grpc-mappings":
+		rule = RuleLowConfidenceMapping
+	}
+	suggestion := d.Suggestion
+	return Issue{
+		File:       file,
+		Line:       line,
+		Rule:       rule,
+		Severity:   severity,
+		Procedure:  d.Procedure,
+		Message:    fmt.Sprintf("%s (fix: %s)", d.Message, d.Suggestion),
+		Suggestion: &suggestion,
+	}
+}
+
+func lineAt(lines []int, i int) int {
+	if i < len(lines) {
+		return lines[i]
+	}
+	return 0
+}
+
+// warn adds a warning of a rule other than RuleTranslation.
+func (t *transpiler) warn(rule, warning string) {
+	if t.warningRules == nil {
+		t.warningRules = map[int]string{}
+	}
+	t.warningRules[len(t.warnings)] = rule
+	t.warnings = append(t.warnings, warning)
+}
+
+// locate records the line stmt, a top-level statement, starts on as that
+// of the warnings and diagnostics added since the last call.
+func (t *transpiler) locate(stmt ast.Statement) {
+	line := topLevelLine(stmt)
+	if line > 0 {
+		line = t.fileLine(line)
+	}
+	for len(t.warningLines) < len(t.warnings) {
+		t.warningLines = append(t.warningLines, line)
+	}
+	for len(t.ddlWarningLines) < len(t.ddlWarnings) {
+		t.ddlWarningLines = append(t.ddlWarningLines, line)
+	}
+	for len(t.diagnosticLines) < len(t.diagnostics) {
+		t.diagnosticLines = append(t.diagnosticLines, line)
+	}
+}
+
+// topLevelLine returns the line a procedure, function or DDL statement
+// starts on, or 0.
+func topLevelLine(stmt ast.Statement) int {
+	switch s := stmt.(type) {
+	case *ast.CreateProcedureStatement:
+		return s.Token.Line
+	case *ast.CreateFunctionStatement:
+		return s.Token.Line
+	case *ast.CreateTriggerStatement:
+		return s.Token.Line
+	case *ast.CreateTableStatement:
+		return s.Token.Line
+	case *ast.CreateSequenceStatement:
+		return s.Token.Line
+	case *ast.CreateViewStatement:
+		return s.Token.Line
+	case *ast.CreateIndexStatement:
+		return s.Token.Line
+	case *ast.AlterTableStatement:
+		return s.Token.Line
+	case *ast.AlterSequenceStatement:
+		return s.Token.Line
+	case *ast.AlterIndexStatement:
+		return s.Token.Line
+	case *ast.AlterViewStatement:
+		return s.Token.Line
+	case *ast.DropSequenceStatement:
+		return s.Token.Line
+	case *ast.DropIndexStatement:
+		return s.Token.Line
+	case *ast.UseStatement:
+		return s.Token.Line
+	case *ast.IfStatement:
+		return s.Token.Line
+	}
+	return 0
+}
+
+// sarifLog is the part of SARIF 2.1.0 MarshalSARIF writes.
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version,omitempty"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string       `json:"id"`
+	ShortDescription     sarifMessage `json:"shortDescription"`
+	DefaultConfiguration struct {
+		Level Severity `json:"level"`
+	} `json:"defaultConfiguration"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID     string            `json:"ruleId"`
+	RuleIndex  int               `json:"ruleIndex"`
+	Level      Severity          `json:"level"`
+	Message    sarifMessage      `json:"message"`
+	Locations  []sarifLocation   `json:"locations,omitempty"`
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation struct {
+		ArtifactLocation struct {
+			URI string `json:"uri"`
+		} `json:"artifactLocation"`
+		Region *sarifRegion `json:"region,omitempty"`
+	} `json:"physicalLocation"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+// MarshalSARIF returns issues as a SARIF 2.1.0 log of one run of
+// tgpiler at version. Files are written as given, so relative paths
+// resolve against the repository root when tgpiler is run from it.
+func MarshalSARIF(issues []Issue, version string) ([]byte, error) {
+	// The rules the issues have, in the order of IssueRules
+	used := map[string]bool{}
+	for _, issue := range issues {
+		used[issue.Rule] = true
+	}
+	driver := sarifDriver{
+		Name:           "tgpiler",
+		Version:        version,
+		InformationURI: "https://github.com/ha1tch/tgpiler",
+		Rules:          []sarifRule{},
+	}
+	index := map[string]int{}
+	for _, rule := range IssueRules {
+		if !used[rule.ID] {
+			continue
+		}
+		r := sarifRule{ID: rule.ID, ShortDescription: sarifMessage{rule.Description}}
+		r.DefaultConfiguration.Level = rule.Severity
+		index[rule.ID] = len(driver.Rules)
+		driver.Rules = append(driver.Rules, r)
+	}
+	var unknown []string
+	for id := range used {
+		if _, ok := index[id]; !ok {
+			unknown = append(unknown, id)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown rule %s", unknown[0])
+	}
+
+	results := []sarifResult{}
+	for _, issue := range issues {
+		result := sarifResult{
+			RuleID:    issue.Rule,
+			RuleIndex: index[issue.Rule],
+			Level:     issue.Severity,
+			Message:   sarifMessage{issue.Message},
+		}
+		if issue.File != "" {
+			var loc sarifLocation
+			loc.PhysicalLocation.ArtifactLocation.URI = filepath.ToSlash(issue.File)
+			if issue.Line > 0 {
+				loc.PhysicalLocation.Region = &sarifRegion{StartLine: issue.Line}
+			}
+			result.Locations = []sarifLocation{loc}
+		}
+		if issue.Procedure != "" || issue.Suggestion != nil {
+			result.Properties = map[string]string{}
+			if issue.Procedure != "" {
+				result.Properties["procedure"] = issue.Procedure
+			}
+			if issue.Suggestion != nil {
+				result.Properties["suggestion"] = issue.Suggestion.String()
+			}
+		}
+		results = append(results, result)
+	}
+	return json.MarshalIndent(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{{Tool: sarifTool{Driver: driver}, Results: results}},
+	}, "", "  ")
+}
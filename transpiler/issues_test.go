@@ -0,0 +1,128 @@
+package transpiler
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+)
+
+const issuesSource = `CREATE SEQUENCE dbo.OrderSeq START WITH 1;
+GO
+
+CREATE PROCEDURE dbo.GetOrders @CustomerID INT
+AS
+BEGIN
+    SELECT OrderID FROM Orders WHERE CustomerID = @CustomerID
+END
+GO
+`
+
+func TestTranspileResultIssues(t *testing.T) {
+	config := DefaultDMLConfig()
+	config.Backend = BackendGRPC
+	config.SkipDDL = true
+	result, err := TranspileWithDMLEx(issuesSource, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDMLEx failed: %v", err)
+	}
+	issues := result.Issues("orders.sql")
+	if len(issues) != 2 {
+		t.Fatalf("expected 2 issues, got %+v", issues)
+	}
+	if i := issues[0]; i.File != "orders.sql" || i.Line != 1 || i.Rule != RuleDDLSkipped || i.Severity != SeverityWarning {
+		t.Errorf("expected a ddl-skipped warning on line 1, got %+v", i)
+	}
+	if i := issues[1]; i.Line != 4 || i.Rule != RuleUnroutedTable || i.Procedure != "GetOrders" || i.Suggestion == nil || i.Suggestion.String() != "--table-service=Orders:OrderService" {
+		t.Errorf("expected an unrouted-table warning on line 4 of GetOrders, got %+v", i)
+	}
+
+	// Streamed, the lines are the same
+	streamed, err := TranspileStream(strings.NewReader(issuesSource), io.Discard, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileStream failed: %v", err)
+	}
+	for i, issue := range streamed.Issues("orders.sql") {
+		if issue.Line != issues[i].Line {
+			t.Errorf("issue %d streamed is on line %d, want %d", i, issue.Line, issues[i].Line)
+		}
+	}
+}
+
+func TestMarshalSARIF(t *testing.T) {
+	issues := []Issue{
+		{File: "sql/orders.sql", Line: 4, Rule: RuleTranslation, Severity: SeverityWarning, Procedure: "GetOrders", Message: "GetOrders: FOR XML has no mongo translation"},
+		{Rule: RuleTempTableFallback, Severity: SeverityNote, Message: "temp tables #t use the default fallback backend"},
+	}
+	data, err := MarshalSARIF(issues, "0.1.0")
+	if err != nil {
+		t.Fatalf("MarshalSARIF failed: %v", err)
+	}
+	var log sarifLog
+	if err := json.Unmarshal(data, &log); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, data)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("expected one SARIF 2.1.0 run, got:\n%s", data)
+	}
+	run := log.Runs[0]
+	if len(run.Tool.Driver.Rules) != 2 || run.Tool.Driver.Rules[1].ID != RuleTempTableFallback {
+		t.Errorf("expected the two rules used, got %+v", run.Tool.Driver.Rules)
+	}
+	if len(run.Results) != 2 {
+		t.Fatalf("expected 2 results, got %+v", run.Results)
+	}
+	r := run.Results[0]
+	if r.RuleID != RuleTranslation || r.Level != SeverityWarning || len(r.Locations) != 1 {
+		t.Fatalf("unexpected first result %+v", r)
+	}
+	loc := r.Locations[0].PhysicalLocation
+	if loc.ArtifactLocation.URI != "sql/orders.sql" || loc.Region == nil || loc.Region.StartLine != 4 {
+		t.Errorf("expected sql/orders.sql line 4, got %+v", loc)
+	}
+	if r := run.Results[1]; r.RuleIndex != 1 || r.Level != SeverityNote || r.Locations != nil {
+		t.Errorf("expected a note without a location, got %+v", r)
+	}
+
+	if _, err := MarshalSARIF([]Issue{{Rule: "nope"}}, ""); err == nil {
+		t.Error("expected an error for an unknown rule")
+	}
+}
+
+func TestTranspileResultIssueRules(t *testing.T) {
+	rules := func(source string, config DMLConfig) map[string]string {
+		t.Helper()
+		result, err := TranspileWithDMLEx(source, "main", config)
+		if err != nil {
+			t.Fatalf("TranspileWithDMLEx failed: %v", err)
+		}
+		rules := map[string]string{}
+		for _, issue := range result.Issues("orders.sql") {
+			rules[issue.Rule] = issue.Message
+		}
+		return rules
+	}
+
+	config := DefaultDMLConfig()
+	config.Backend = BackendGRPC
+	config.TableToService = map[string]string{"Orders": "OrderService"}
+	got := rules(`CREATE PROCEDURE dbo.GetRecentOrders @CustomerID INT
+AS
+BEGIN
+    SELECT OrderID FROM Orders WHERE CustomerID = @CustomerID AND CreatedAt = DATEADD(day, -1, GETDATE())
+END
+`, config)
+	if !strings.Contains(got[RuleComplexField], "leaves out CreatedAt") {
+		t.Errorf("expected a complex-field warning for CreatedAt, got %v", got)
+	}
+
+	got = rules(`CREATE PROCEDURE dbo.GetOrderDates
+AS
+BEGIN
+    SELECT FORMAT(OrderDate, 'd', 'de-DE') AS OrderDate FROM Orders
+END
+`, DefaultDMLConfig())
+	if !strings.Contains(got[RuleUntranslated], "FORMAT") {
+		t.Errorf("expected an untranslated warning for FORMAT, got %v", got)
+	}
+}
@@ -0,0 +1,655 @@
+package transpiler
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ha1tch/tsqlparser"
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// SQL Server Agent jobs
+//
+// TranspileJobs migrates Agent jobs, read from the script SSMS generates
+// with "Script Job as > CREATE To" or from JSON with msdb's column names.
+// Each T-SQL step is transpiled as a script (see script.go) into a
+// function named after the job and step, and each job gets a function
+// returning a tsqlruntime.Job that runs those steps with the original
+// sequencing and retries, and lists its schedules as cron expressions:
+//
+//	func (r *Repository) NightlyCleanupJob() *tsqlruntime.Job {
+//		return &tsqlruntime.Job{
+//			Name:      "Nightly Cleanup",
+//			StartStep: 1,
+//			Steps: []tsqlruntime.JobStep{
+//				{
+//					ID:            1,
+//					Name:          "Purge sessions",
+//					Run:           r.NightlyCleanupPurgeSessions,
+//					RetryAttempts: 2,
+//					RetryInterval: 5 * time.Minute,
+//					OnSuccess:     tsqlruntime.GoToNextStep,
+//					OnFailure:     tsqlruntime.QuitWithFailure,
+//				},
+//			},
+//			Schedules: []string{
+//				"0 2 * * *", // Nightly at 2am
+//			},
+//		}
+//	}
+//
+// Steps of other subsystems (CmdExec, PowerShell, SSIS) aren't migrated:
+// they fail when run, with a warning.
+
+// Job is a SQL Server Agent job.
+type Job struct {
+	Name        string        `json:"name"`
+	Description string        `json:"description,omitempty"`
+	StartStepID int           `json:"start_step_id,omitempty"`
+	Steps       []JobStep     `json:"steps"`
+	Schedules   []JobSchedule `json:"schedules,omitempty"`
+}
+
+// JobStep is a step of a job. Actions have msdb's values: 1 quit with
+// success, 2 quit with failure, 3 go to the next step, 4 go to the step
+// in OnSuccessStep or OnFailStep.
+type JobStep struct {
+	ID            int    `json:"step_id"`
+	Name          string `json:"step_name"`
+	Subsystem     string `json:"subsystem,omitempty"` // TSQL when empty
+	Database      string `json:"database_name,omitempty"`
+	Command       string `json:"command"`
+	OnSuccess     int    `json:"on_success_action,omitempty"` // 0 means 1
+	OnSuccessStep int    `json:"on_success_step_id,omitempty"`
+	OnFail        int    `json:"on_fail_action,omitempty"` // 0 means 2
+	OnFailStep    int    `json:"on_fail_step_id,omitempty"`
+	RetryAttempts int    `json:"retry_attempts,omitempty"`
+	RetryInterval int    `json:"retry_interval,omitempty"` // Minutes
+}
+
+// JobSchedule is a schedule of a job, with the columns of
+// msdb.dbo.sysschedules.
+type JobSchedule struct {
+	Name                 string `json:"name"`
+	Enabled              bool   `json:"enabled"`
+	FreqType             int    `json:"freq_type"`
+	FreqInterval         int    `json:"freq_interval"`
+	FreqSubdayType       int    `json:"freq_subday_type"`
+	FreqSubdayInterval   int    `json:"freq_subday_interval"`
+	FreqRelativeInterval int    `json:"freq_relative_interval"`
+	FreqRecurrenceFactor int    `json:"freq_recurrence_factor"`
+	ActiveStartTime      int    `json:"active_start_time"` // HHMMSS
+	ActiveEndTime        int    `json:"active_end_time"`   // HHMMSS; 0 means 235959
+}
+
+// UnmarshalJSON reads enabled as msdb stores it, 0 or 1, or as a boolean.
+// Schedules are enabled unless it says otherwise.
+func (s *JobSchedule) UnmarshalJSON(data []byte) error {
+	type plain JobSchedule
+	v := struct {
+		*plain
+		Enabled interface{} `json:"enabled"`
+	}{plain: (*plain)(s)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	s.Enabled = v.Enabled == nil || v.Enabled == true || v.Enabled == float64(1)
+	return nil
+}
+
+// Cron returns the schedule as a cron expression: minute, hour, day of
+// month, month and day of week. Schedules that run every N days restart
+// on the first of each month, as */N does. Cron can't express one-off
+// runs, runs when Agent starts or the CPU is idle, intervals in seconds
+// or that don't divide an hour or a day, every N weeks, or days relative
+// to the month ("second Tuesday"); for those Cron returns an error.
+func (s JobSchedule) Cron() (string, error) {
+	hour, minute := s.ActiveStartTime/10000, s.ActiveStartTime/100%100
+	endHour := 23
+	if s.ActiveEndTime != 0 {
+		endHour = s.ActiveEndTime / 10000
+	}
+	hours := "*"
+	if hour != 0 || endHour != 23 {
+		hours = fmt.Sprintf("%d-%d", hour, endHour)
+	}
+
+	var minutes string
+	switch n := s.FreqSubdayInterval; s.FreqSubdayType {
+	case 0, 1: // At the start time
+		minutes, hours = strconv.Itoa(minute), strconv.Itoa(hour)
+	case 2:
+		return "", fmt.Errorf("runs every %d seconds", n)
+	case 4:
+		if n <= 0 || 60%n != 0 {
+			return "", fmt.Errorf("runs every %d minutes", n)
+		}
+		minutes = "*/" + strconv.Itoa(n)
+		if minute%n != 0 {
+			minutes = fmt.Sprintf("%d-59/%d", minute, n)
+		}
+	case 8:
+		if n <= 0 || 24%n != 0 {
+			return "", fmt.Errorf("runs every %d hours", n)
+		}
+		minutes = strconv.Itoa(minute)
+		if hours == "*" {
+			hours = "*/" + strconv.Itoa(n)
+		} else if n > 1 {
+			hours += "/" + strconv.Itoa(n)
+		}
+	default:
+		return "", fmt.Errorf("unknown freq_subday_type %d", s.FreqSubdayType)
+	}
+
+	days, months, weekdays := "*", "*", "*"
+	switch s.FreqType {
+	case 1:
+		return "", fmt.Errorf("runs once")
+	case 4: // Every freq_interval days
+		if s.FreqInterval > 1 {
+			days = "*/" + strconv.Itoa(s.FreqInterval)
+		}
+	case 8: // On the days in the freq_interval bitmask, 1 = Sunday
+		if s.FreqRecurrenceFactor > 1 {
+			return "", fmt.Errorf("runs every %d weeks", s.FreqRecurrenceFactor)
+		}
+		var list []string
+		for day := 0; day < 7; day++ {
+			if s.FreqInterval&(1<<day) != 0 {
+				list = append(list, strconv.Itoa(day))
+			}
+		}
+		if len(list) == 0 {
+			return "", fmt.Errorf("runs weekly on no days")
+		}
+		weekdays = strings.Join(list, ",")
+	case 16: // On day freq_interval of every freq_recurrence_factor months
+		days = strconv.Itoa(s.FreqInterval)
+		if s.FreqRecurrenceFactor > 1 {
+			months = "*/" + strconv.Itoa(s.FreqRecurrenceFactor)
+		}
+	case 32:
+		return "", fmt.Errorf("runs on a day relative to the month")
+	case 64:
+		return "", fmt.Errorf("runs when SQL Server Agent starts")
+	case 128:
+		return "", fmt.Errorf("runs when the CPU is idle")
+	default:
+		return "", fmt.Errorf("unknown freq_type %d", s.FreqType)
+	}
+	return strings.Join([]string{minutes, hours, days, months, weekdays}, " "), nil
+}
+
+// ParseJobs reads jobs from a JSON array of jobs, a single JSON job, or a
+// T-SQL script of msdb calls (sp_add_job, sp_add_jobstep,
+// sp_add_jobschedule, ...).
+func ParseJobs(source string) ([]Job, error) {
+	trimmed := strings.TrimSpace(source)
+	var jobs []Job
+	switch {
+	case strings.HasPrefix(trimmed, "["):
+		if err := json.Unmarshal([]byte(trimmed), &jobs); err != nil {
+			return nil, err
+		}
+	case strings.HasPrefix(trimmed, "{"):
+		var job Job
+		if err := json.Unmarshal([]byte(trimmed), &job); err != nil {
+			return nil, err
+		}
+		jobs = []Job{job}
+	default:
+		var err error
+		if jobs, err = parseJobScript(source); err != nil {
+			return nil, err
+		}
+	}
+	if len(jobs) == 0 {
+		return nil, fmt.Errorf("no jobs found")
+	}
+	for i := range jobs {
+		if jobs[i].Name == "" {
+			return nil, fmt.Errorf("job %d has no name", i+1)
+		}
+		for j := range jobs[i].Steps {
+			if jobs[i].Steps[j].ID == 0 {
+				jobs[i].Steps[j].ID = j + 1
+			}
+		}
+	}
+	return jobs, nil
+}
+
+// parseJobScript reads the msdb calls of a job script. The boilerplate
+// around them in SSMS's scripts (a ROLLBACK TRANSACTION followed by a
+// label) doesn't parse, so parse errors only matter when no job is found.
+func parseJobScript(source string) ([]Job, error) {
+	program, errors := tsqlparser.Parse(stripGoStatements(source))
+	var execs []*ast.ExecStatement
+	var collect func(stmt ast.Statement)
+	collect = func(stmt ast.Statement) {
+		switch s := stmt.(type) {
+		case *ast.ExecStatement:
+			execs = append(execs, s)
+		case *ast.BeginEndBlock:
+			for _, inner := range s.Statements {
+				collect(inner)
+			}
+		case *ast.IfStatement:
+			collect(s.Consequence)
+			collect(s.Alternative)
+		}
+	}
+	for _, stmt := range program.Statements {
+		collect(stmt)
+	}
+
+	var jobs []*Job
+	jobVars := map[string]*Job{}
+	schedules := map[string]*JobSchedule{} // sp_add_schedule's, by name and @schedule_id variable
+	lookupJob := func(args map[string]ast.Expression) (*Job, error) {
+		if v, ok := args["job_id"].(*ast.Variable); ok && jobVars[strings.ToLower(v.Name)] != nil {
+			return jobVars[strings.ToLower(v.Name)], nil
+		}
+		if name := jobArgString(args["job_name"]); name != "" {
+			for _, job := range jobs {
+				if strings.EqualFold(job.Name, name) {
+					return job, nil
+				}
+			}
+			return nil, fmt.Errorf("job %q not added", name)
+		}
+		if len(jobs) == 0 {
+			return nil, fmt.Errorf("no sp_add_job before it")
+		}
+		return jobs[len(jobs)-1], nil
+	}
+
+	for _, exec := range execs {
+		if exec.Procedure == nil || len(exec.Procedure.Parts) == 0 {
+			continue
+		}
+		proc := strings.ToLower(exec.Procedure.Parts[len(exec.Procedure.Parts)-1].Value)
+		args := map[string]ast.Expression{}
+		for _, p := range exec.Parameters {
+			args[strings.ToLower(strings.TrimPrefix(p.Name, "@"))] = p.Value
+		}
+		switch proc {
+		case "sp_add_job":
+			job := &Job{
+				Name:        jobArgString(args["job_name"]),
+				Description: jobArgString(args["description"]),
+				StartStepID: jobArgInt(args["start_step_id"], 0),
+			}
+			if job.Description == "No description available." {
+				job.Description = ""
+			}
+			jobs = append(jobs, job)
+			if v, ok := args["job_id"].(*ast.Variable); ok {
+				jobVars[strings.ToLower(v.Name)] = job
+			}
+		case "sp_update_job":
+			job, err := lookupJob(args)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", proc, err)
+			}
+			job.StartStepID = jobArgInt(args["start_step_id"], job.StartStepID)
+		case "sp_add_jobstep":
+			job, err := lookupJob(args)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", proc, err)
+			}
+			job.Steps = append(job.Steps, JobStep{
+				ID:            jobArgInt(args["step_id"], len(job.Steps)+1),
+				Name:          jobArgString(args["step_name"]),
+				Subsystem:     jobArgString(args["subsystem"]),
+				Database:      jobArgString(args["database_name"]),
+				Command:       jobArgString(args["command"]),
+				OnSuccess:     jobArgInt(args["on_success_action"], 0),
+				OnSuccessStep: jobArgInt(args["on_success_step_id"], 0),
+				OnFail:        jobArgInt(args["on_fail_action"], 0),
+				OnFailStep:    jobArgInt(args["on_fail_step_id"], 0),
+				RetryAttempts: jobArgInt(args["retry_attempts"], 0),
+				RetryInterval: jobArgInt(args["retry_interval"], 0),
+			})
+		case "sp_add_jobschedule", "sp_add_schedule":
+			name := args["name"]
+			if proc == "sp_add_schedule" {
+				name = args["schedule_name"]
+			}
+			schedule := JobSchedule{
+				Name:                 jobArgString(name),
+				Enabled:              jobArgInt(args["enabled"], 1) != 0,
+				FreqType:             jobArgInt(args["freq_type"], 0),
+				FreqInterval:         jobArgInt(args["freq_interval"], 0),
+				FreqSubdayType:       jobArgInt(args["freq_subday_type"], 0),
+				FreqSubdayInterval:   jobArgInt(args["freq_subday_interval"], 0),
+				FreqRelativeInterval: jobArgInt(args["freq_relative_interval"], 0),
+				FreqRecurrenceFactor: jobArgInt(args["freq_recurrence_factor"], 0),
+				ActiveStartTime:      jobArgInt(args["active_start_time"], 0),
+				ActiveEndTime:        jobArgInt(args["active_end_time"], 0),
+			}
+			if proc == "sp_add_jobschedule" {
+				job, err := lookupJob(args)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", proc, err)
+				}
+				job.Schedules = append(job.Schedules, schedule)
+				continue
+			}
+			// Shared schedules are attached to jobs with sp_attach_schedule
+			schedules[strings.ToLower(schedule.Name)] = &schedule
+			if v, ok := args["schedule_id"].(*ast.Variable); ok {
+				schedules[strings.ToLower(v.Name)] = &schedule
+			}
+		case "sp_attach_schedule":
+			job, err := lookupJob(args)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", proc, err)
+			}
+			key := strings.ToLower(jobArgString(args["schedule_name"]))
+			if v, ok := args["schedule_id"].(*ast.Variable); ok {
+				key = strings.ToLower(v.Name)
+			}
+			schedule, ok := schedules[key]
+			if !ok {
+				return nil, fmt.Errorf("%s: schedule not added with sp_add_schedule", proc)
+			}
+			job.Schedules = append(job.Schedules, *schedule)
+		}
+	}
+
+	if len(jobs) == 0 {
+		if len(errors) > 0 {
+			return nil, fmt.Errorf("parse errors:\n%s", strings.Join(errors, "\n"))
+		}
+		return nil, fmt.Errorf("no sp_add_job calls found")
+	}
+	result := make([]Job, len(jobs))
+	for i, job := range jobs {
+		result[i] = *job
+	}
+	return result, nil
+}
+
+// jobArgString returns the value of a string argument of an msdb call.
+func jobArgString(e ast.Expression) string {
+	if s, ok := e.(*ast.StringLiteral); ok {
+		return s.Value
+	}
+	return ""
+}
+
+// jobArgInt returns the value of an integer argument of an msdb call, or
+// def if it wasn't passed.
+func jobArgInt(e ast.Expression, def int) int {
+	switch v := e.(type) {
+	case *ast.IntegerLiteral:
+		return int(v.Value)
+	case *ast.PrefixExpression:
+		if n, ok := v.Right.(*ast.IntegerLiteral); ok && v.Operator == "-" {
+			return -int(n.Value)
+		}
+	}
+	return def
+}
+
+// TranspileJobs transpiles the jobs in source (see ParseJobs): the steps
+// of each, and a function returning its tsqlruntime.Job.
+func TranspileJobs(source string, packageName string, dmlConfig DMLConfig) (*TranspileResult, error) {
+	jobs, err := ParseJobs(source)
+	if err != nil {
+		return nil, err
+	}
+	if dmlConfig.Backend == BackendProcedureCall {
+		return nil, fmt.Errorf("jobs can't use the procedure-call backend")
+	}
+
+	var commands []string
+	for _, job := range jobs {
+		for _, step := range job.Steps {
+			commands = append(commands, step.Command)
+		}
+	}
+	t := newDMLTranspiler(strings.Join(commands, "\n"), packageName, dmlConfig)
+
+	var stmts []ast.Statement
+	for _, job := range jobs {
+		runner, steps, err := t.jobRunner(job)
+		if err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, steps...)
+		t.jobRunners = append(t.jobRunners, runner)
+	}
+	code, err := t.transpile(&ast.Program{Statements: stmts})
+	if err != nil {
+		return nil, err
+	}
+	return t.result(code), nil
+}
+
+// jobRunner returns the function returning the tsqlruntime.Job for job,
+// and the statements to transpile for its steps.
+func (t *transpiler) jobRunner(job Job) (string, []ast.Statement, error) {
+	t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+	jobName := goExportedIdentifier(job.Name) + "Job"
+
+	var stmts []ast.Statement
+	var steps []string
+	databases := map[string]bool{}
+	for _, step := range job.Steps {
+		where := fmt.Sprintf("job %s, step %d (%s)", job.Name, step.ID, step.Name)
+		var run string
+		if subsystem := step.Subsystem; subsystem != "" && !strings.EqualFold(subsystem, "TSQL") {
+			// Only T-SQL is transpiled; the step fails until it's migrated
+			t.imports["context"] = true
+			t.imports["errors"] = true
+			t.warnings = append(t.warnings, fmt.Sprintf("%s: %s steps aren't migrated; the step fails when run", where, subsystem))
+			run = fmt.Sprintf("// %s: %s\nRun: func(ctx context.Context) error {\n\treturn errors.New(%q)\n},",
+				subsystem, summarizeStatement(step.Command, 60), subsystem+" step not migrated")
+		} else {
+			command := step.Command
+			if !t.dmlConfig.PreserveGo {
+				command = stripGoStatements(command)
+			}
+			program, errs := tsqlparser.Parse(command)
+			if len(errs) > 0 {
+				return "", nil, fmt.Errorf("%s: parse errors:\n%s", where, strings.Join(errs, "\n"))
+			}
+			procName := job.Name + " " + step.Name
+			program, proc := scriptProgram(program, procName)
+			if proc == nil {
+				proc = &ast.CreateProcedureStatement{
+					Name: &ast.QualifiedIdentifier{Parts: []*ast.Identifier{{Value: procName}}},
+					Body: &ast.BeginEndBlock{},
+				}
+				program.Statements = append(program.Statements, proc)
+			}
+			stmts = append(stmts, program.Statements...)
+			run = "Run: " + t.jobStepCall(proc) + ","
+			databases[strings.ToLower(step.Database)] = true
+		}
+
+		fields := []string{fmt.Sprintf("ID: %d,", step.ID), fmt.Sprintf("Name: %q,", step.Name), run}
+		if step.RetryAttempts > 0 {
+			t.imports["time"] = true
+			fields = append(fields,
+				fmt.Sprintf("RetryAttempts: %d,", step.RetryAttempts),
+				fmt.Sprintf("RetryInterval: %d * time.Minute,", step.RetryInterval))
+		}
+		fields = append(fields, "OnSuccess: "+jobStepAction(step.OnSuccess, 1)+",")
+		if step.OnSuccess == 4 {
+			fields = append(fields, fmt.Sprintf("OnSuccessStep: %d,", step.OnSuccessStep))
+		}
+		fields = append(fields, "OnFailure: "+jobStepAction(step.OnFail, 2)+",")
+		if step.OnFail == 4 {
+			fields = append(fields, fmt.Sprintf("OnFailureStep: %d,", step.OnFailStep))
+		}
+		steps = append(steps, "{\n"+indentLines(alignFields(fields), 1)+"\n},")
+	}
+	if len(databases) > 1 {
+		t.warnings = append(t.warnings, fmt.Sprintf("job %s: steps run in different databases, all through %s", job.Name, t.dmlConfig.StoreVar))
+	}
+
+	var schedules []string
+	for _, s := range job.Schedules {
+		if !s.Enabled {
+			schedules = append(schedules, fmt.Sprintf("// %s: disabled", s.Name))
+			continue
+		}
+		cron, err := s.Cron()
+		if err != nil {
+			t.warnings = append(t.warnings, fmt.Sprintf("job %s: schedule %s %v, which cron can't express", job.Name, s.Name, err))
+			schedules = append(schedules, fmt.Sprintf("// %s: %v", s.Name, err))
+			continue
+		}
+		schedules = append(schedules, fmt.Sprintf("%q, // %s", cron, s.Name))
+	}
+
+	fields := []string{fmt.Sprintf("Name: %q,", job.Name)}
+	if job.StartStepID != 0 {
+		fields = append(fields, fmt.Sprintf("StartStep: %d,", job.StartStepID))
+	}
+	fields = append(fields, "Steps: []tsqlruntime.JobStep{\n"+indentLines(strings.Join(steps, "\n"), 1)+"\n},")
+	if len(schedules) > 0 {
+		fields = append(fields, "Schedules: []string{\n"+indentLines(alignComments(schedules), 1)+"\n},")
+	}
+
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("// %s returns the SQL Server Agent job %s.\n", jobName, job.Name))
+	if job.Description != "" {
+		for _, line := range strings.Split(strings.TrimSpace(job.Description), "\n") {
+			out.WriteString("// " + strings.TrimSpace(line) + "\n")
+		}
+	}
+	switch {
+	case t.dmlConfig.Style != StyleFunctions:
+		out.WriteString(fmt.Sprintf("func (%s %s) %s() *tsqlruntime.Job {\n", t.dmlConfig.Receiver, t.dmlConfig.ReceiverType, jobName))
+	case t.hasStoreParam():
+		// *sql.DB, as steps that open a transaction need it
+		t.imports["database/sql"] = true
+		out.WriteString(fmt.Sprintf("func %s(%s *sql.DB) *tsqlruntime.Job {\n", jobName, t.dmlConfig.StoreVar))
+	default:
+		out.WriteString(fmt.Sprintf("func %s() *tsqlruntime.Job {\n", jobName))
+	}
+	out.WriteString("\treturn &tsqlruntime.Job{\n")
+	out.WriteString(indentLines(alignFields(fields), 2) + "\n")
+	out.WriteString("\t}\n")
+	out.WriteString("}")
+	return out.String(), stmts, nil
+}
+
+// jobStepCall returns the Run function of a step transpiled from proc:
+// the step's method itself, or a closure adapting its signature.
+func (t *transpiler) jobStepCall(proc *ast.CreateProcedureStatement) string {
+	name := goExportedIdentifier(proc.Name.Parts[0].Value)
+	args := "ctx"
+	if t.dmlConfig.Style == StyleFunctions {
+		if t.hasStoreParam() {
+			args += ", " + t.dmlConfig.StoreVar
+		}
+	} else {
+		name = t.dmlConfig.Receiver + "." + name
+	}
+	returnsErr := t.blockHasDML(proc.Body) || t.dmlConfig.Style == StyleFunctions
+	returnsCode := t.procedureHasReturn(proc)
+	if returnsErr && !returnsCode && t.dmlConfig.Style != StyleFunctions {
+		return name
+	}
+
+	t.imports["context"] = true
+	var body string
+	switch {
+	case returnsErr && returnsCode:
+		body = fmt.Sprintf("_, err := %s(%s)\n\treturn err", name, args)
+	case returnsErr:
+		body = fmt.Sprintf("return %s(%s)", name, args)
+	case returnsCode:
+		body = fmt.Sprintf("_ = %s(%s)\n\treturn nil", name, args)
+	default:
+		body = fmt.Sprintf("%s(%s)\n\treturn nil", name, args)
+	}
+	return "func(ctx context.Context) error {\n\t" + body + "\n}"
+}
+
+// jobStepAction returns the tsqlruntime.StepAction for an msdb action
+// code, def when it is 0.
+func jobStepAction(action, def int) string {
+	if action == 0 {
+		action = def
+	}
+	switch action {
+	case 1:
+		return "tsqlruntime.QuitWithSuccess"
+	case 2:
+		return "tsqlruntime.QuitWithFailure"
+	case 3:
+		return "tsqlruntime.GoToNextStep"
+	case 4:
+		return "tsqlruntime.GoToStep"
+	}
+	return fmt.Sprintf("tsqlruntime.StepAction(%d)", action)
+}
+
+// alignFields aligns the values of "Key: value" lines the way gofmt does
+// within a composite literal, for runs of single-line fields.
+func alignFields(fields []string) string {
+	var out []string
+	for start := 0; start < len(fields); {
+		end := start
+		width := 0
+		for end < len(fields) && !strings.Contains(fields[end], "\n") && !strings.HasPrefix(fields[end], "//") {
+			width = max(width, strings.Index(fields[end], ":")+1)
+			end++
+		}
+		for _, f := range fields[start:end] {
+			colon := strings.Index(f, ":") + 1
+			out = append(out, fmt.Sprintf("%-*s %s", width, f[:colon], strings.TrimSpace(f[colon:])))
+		}
+		if end < len(fields) {
+			out = append(out, fields[end])
+			end++
+		}
+		start = end
+	}
+	return strings.Join(out, "\n")
+}
+
+// alignComments aligns the trailing comments of runs of lines that have
+// one, as gofmt does.
+func alignComments(lines []string) string {
+	out := make([]string, len(lines))
+	for start := 0; start < len(lines); {
+		end := start
+		width := 0
+		for end < len(lines) && strings.Contains(lines[end], ", // ") {
+			width = max(width, strings.Index(lines[end], ", // ")+1)
+			end++
+		}
+		for i := start; i < end; i++ {
+			at := strings.Index(lines[i], ", // ") + 1
+			out[i] = fmt.Sprintf("%-*s %s", width, lines[i][:at], lines[i][at+1:])
+		}
+		if end == start {
+			out[end] = lines[end]
+			end++
+		}
+		start = end
+	}
+	return strings.Join(out, "\n")
+}
+
+// indentLines indents every non-empty line of s by depth tabs.
+func indentLines(s string, depth int) string {
+	prefix := strings.Repeat("\t", depth)
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,164 @@
+package transpiler
+
+import (
+	"strings"
+	"testing"
+)
+
+// nightlyJob is trimmed from SSMS's "Script Job as CREATE" output.
+const nightlyJob = `
+USE [msdb]
+GO
+BEGIN TRANSACTION
+DECLARE @ReturnCode INT
+SELECT @ReturnCode = 0
+DECLARE @jobId BINARY(16)
+EXEC @ReturnCode =  msdb.dbo.sp_add_job @job_name=N'Nightly Cleanup',
+		@enabled=1,
+		@description=N'Purges old sessions.',
+		@owner_login_name=N'sa', @job_id = @jobId OUTPUT
+IF (@@ERROR <> 0 OR @ReturnCode <> 0) GOTO QuitWithRollback
+EXEC @ReturnCode = msdb.dbo.sp_add_jobstep @job_id=@jobId, @step_name=N'Purge sessions',
+		@step_id=1,
+		@on_success_action=3,
+		@on_fail_action=4,
+		@on_fail_step_id=2,
+		@retry_attempts=2,
+		@retry_interval=5,
+		@subsystem=N'TSQL',
+		@command=N'DECLARE @Cutoff DATETIME = DATEADD(DAY, -30, GETDATE())
+DELETE FROM Sessions WHERE LastSeen < @Cutoff',
+		@database_name=N'AppDb'
+IF (@@ERROR <> 0 OR @ReturnCode <> 0) GOTO QuitWithRollback
+EXEC @ReturnCode = msdb.dbo.sp_add_jobstep @job_id=@jobId, @step_name=N'Log',
+		@step_id=2,
+		@on_success_action=2,
+		@on_fail_action=2,
+		@subsystem=N'TSQL',
+		@command=N'PRINT ''cleanup failed''',
+		@database_name=N'AppDb'
+IF (@@ERROR <> 0 OR @ReturnCode <> 0) GOTO QuitWithRollback
+EXEC @ReturnCode = msdb.dbo.sp_update_job @job_id = @jobId, @start_step_id = 1
+EXEC @ReturnCode = msdb.dbo.sp_add_jobschedule @job_id=@jobId, @name=N'Nightly at 2am',
+		@enabled=1,
+		@freq_type=4,
+		@freq_interval=1,
+		@freq_subday_type=1,
+		@freq_subday_interval=0,
+		@active_start_time=20000,
+		@active_end_time=235959
+IF (@@ERROR <> 0 OR @ReturnCode <> 0) GOTO QuitWithRollback
+COMMIT TRANSACTION
+GOTO EndSave
+QuitWithRollback:
+    IF (@@TRANCOUNT > 0) ROLLBACK TRANSACTION
+EndSave:
+GO
+`
+
+func TestParseJobs(t *testing.T) {
+	jobs, err := ParseJobs(nightlyJob)
+	if err != nil {
+		t.Fatalf("ParseJobs failed: %v", err)
+	}
+	if len(jobs) != 1 {
+		t.Fatalf("Expected 1 job, got %d", len(jobs))
+	}
+	job := jobs[0]
+	if job.Name != "Nightly Cleanup" || job.Description != "Purges old sessions." || job.StartStepID != 1 {
+		t.Errorf("Unexpected job %+v", job)
+	}
+	if len(job.Steps) != 2 || len(job.Schedules) != 1 {
+		t.Fatalf("Expected 2 steps and 1 schedule, got %+v", job)
+	}
+	step := job.Steps[0]
+	if step.OnSuccess != 3 || step.OnFail != 4 || step.OnFailStep != 2 || step.RetryAttempts != 2 || step.RetryInterval != 5 {
+		t.Errorf("Unexpected step %+v", step)
+	}
+	if got := job.Steps[1].Command; got != "PRINT 'cleanup failed'" {
+		t.Errorf("Command = %q", got)
+	}
+
+	jobs, err = ParseJobs(`{"name": "Stats", "steps": [{"step_name": "Count", "command": "PRINT 1"}],
+		"schedules": [{"name": "Off", "enabled": 0, "freq_type": 4}, {"name": "On", "freq_type": 4}]}`)
+	if err != nil {
+		t.Fatalf("ParseJobs failed: %v", err)
+	}
+	if jobs[0].Steps[0].ID != 1 || jobs[0].Schedules[0].Enabled || !jobs[0].Schedules[1].Enabled {
+		t.Errorf("Unexpected job %+v", jobs[0])
+	}
+
+	if _, err := ParseJobs("SELECT 1"); err == nil {
+		t.Error("Expected an error for a script without sp_add_job")
+	}
+}
+
+func TestJobScheduleCron(t *testing.T) {
+	tests := []struct {
+		schedule JobSchedule
+		want     string
+	}{
+		{JobSchedule{FreqType: 4, FreqInterval: 1, FreqSubdayType: 1, ActiveStartTime: 20000}, "0 2 * * *"},
+		{JobSchedule{FreqType: 4, FreqInterval: 2, FreqSubdayType: 1, ActiveStartTime: 233000}, "30 23 */2 * *"},
+		{JobSchedule{FreqType: 4, FreqInterval: 1, FreqSubdayType: 4, FreqSubdayInterval: 15}, "*/15 * * * *"},
+		{JobSchedule{FreqType: 4, FreqInterval: 1, FreqSubdayType: 4, FreqSubdayInterval: 10, ActiveStartTime: 80500, ActiveEndTime: 180000}, "5-59/10 8-18 * * *"},
+		{JobSchedule{FreqType: 4, FreqInterval: 1, FreqSubdayType: 8, FreqSubdayInterval: 6, ActiveStartTime: 3000}, "30 */6 * * *"},
+		{JobSchedule{FreqType: 8, FreqInterval: 62, FreqSubdayType: 1, ActiveStartTime: 63000}, "30 6 * * 1,2,3,4,5"},
+		{JobSchedule{FreqType: 16, FreqInterval: 1, FreqRecurrenceFactor: 3, FreqSubdayType: 1}, "0 0 1 */3 *"},
+		{JobSchedule{FreqType: 32, FreqInterval: 3, FreqRelativeInterval: 2, FreqSubdayType: 1}, ""},
+		{JobSchedule{FreqType: 8, FreqInterval: 2, FreqRecurrenceFactor: 2, FreqSubdayType: 1}, ""},
+		{JobSchedule{FreqType: 4, FreqInterval: 1, FreqSubdayType: 2, FreqSubdayInterval: 30}, ""},
+		{JobSchedule{FreqType: 64}, ""},
+	}
+	for _, tt := range tests {
+		got, err := tt.schedule.Cron()
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("%+v: expected an error, got %q", tt.schedule, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%+v: got %q, %v, want %q", tt.schedule, got, err, tt.want)
+		}
+	}
+}
+
+func TestTranspileJobs(t *testing.T) {
+	result, err := TranspileJobs(nightlyJob, "jobs", DefaultDMLConfig())
+	if err != nil {
+		t.Fatalf("TranspileJobs failed: %v", err)
+	}
+	code := result.Code
+	for _, want := range []string{
+		"func (r *Repository) NightlyCleanupPurgeSessions(ctx context.Context) (err error) {",
+		"\"DELETE FROM Sessions WHERE LastSeen < $1\", cutoff)",
+		"func (r *Repository) NightlyCleanupLog(ctx context.Context) {",
+		"func (r *Repository) NightlyCleanupJob() *tsqlruntime.Job {",
+		"Run:           r.NightlyCleanupPurgeSessions,",
+		"RetryInterval: 5 * time.Minute,",
+		"OnFailure:     tsqlruntime.GoToStep,\n\t\t\t\tOnFailureStep: 2,",
+		"Run: func(ctx context.Context) error {\n\t\t\t\t\tr.NightlyCleanupLog(ctx)\n\t\t\t\t\treturn nil\n\t\t\t\t},",
+		"\"0 2 * * *\", // Nightly at 2am",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("Expected %q, got:\n%s", want, code)
+		}
+	}
+
+	config := DefaultDMLConfig()
+	config.Style = StyleFunctions
+	result, err = TranspileJobs(nightlyJob, "jobs", config)
+	if err != nil {
+		t.Fatalf("TranspileJobs failed: %v", err)
+	}
+	code = result.Code
+	for _, want := range []string{
+		"func NightlyCleanupJob(db *sql.DB) *tsqlruntime.Job {",
+		"return NightlyCleanupPurgeSessions(ctx, db)",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("Expected %q, got:\n%s", want, code)
+		}
+	}
+}
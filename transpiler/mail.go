@@ -0,0 +1,134 @@
+package transpiler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// Database Mail
+//
+// sp_send_dbmail and the older xp_sendmail send mail from the database
+// server. They become calls to a tsqlruntime.Notifier, with the
+// recipients, subject and body taken from the original parameters by name:
+//
+//	EXEC msdb.dbo.sp_send_dbmail @recipients = 'ops@example.com',
+//	    @subject = 'Low stock', @body = @msg
+//	  -> r.notifier.Send(ctx, "ops@example.com", "Low stock", msg)
+//
+// Other parameters (copies, attachments, queries, the mail profile) are
+// dropped with a warning. Every call is recorded as a SideEffect so the
+// migration report can list what needs a real implementation.
+
+// SideEffect is a statement with an effect outside the database, which
+// generated code hands to an interface the application must implement.
+type SideEffect struct {
+	Procedure string
+	Line      int
+	Kind      string   // "mail" or "event"
+	Original  string   // e.g. sp_send_dbmail, INSERT INTO EventQueue
+	Call      string   // Generated call, e.g. r.notifier.Send
+	Dropped   []string // Original parameters that aren't passed on
+}
+
+func (e SideEffect) String() string {
+	s := fmt.Sprintf("%s:%d: [%s] %s -> %s", e.Procedure, e.Line, e.Kind, e.Original, e.Call)
+	if len(e.Dropped) > 0 {
+		s += fmt.Sprintf(" (dropped: %s)", strings.Join(e.Dropped, ", "))
+	}
+	return s
+}
+
+// dbMailProcs lists the positional parameters of the Database Mail
+// procedures, up to the ones the Notifier takes.
+var dbMailProcs = map[string][]string{
+	"sp_send_dbmail": {"@profile_name", "@recipients", "@copy_recipients", "@blind_copy_recipients",
+		"@from_address", "@reply_to", "@subject", "@body"},
+	"xp_sendmail": {"@recipients", "@message", "@query", "@attachments", "@copy_recipients",
+		"@blind_copy_recipients", "@subject"},
+}
+
+// dbMailProc returns the Database Mail procedure s calls, or "".
+func dbMailProc(s *ast.ExecStatement) string {
+	if s.Procedure == nil || len(s.Procedure.Parts) == 0 {
+		return ""
+	}
+	name := strings.ToLower(s.Procedure.Parts[len(s.Procedure.Parts)-1].Value)
+	if _, ok := dbMailProcs[name]; ok {
+		return name
+	}
+	return ""
+}
+
+func (dt *dmlTranspiler) transpileSendMail(s *ast.ExecStatement, proc string) (string, error) {
+	positional := dbMailProcs[proc]
+	args := map[string]ast.Expression{}
+	var dropped []string
+	for i, p := range s.Parameters {
+		name := strings.ToLower(p.Name)
+		if name == "" {
+			if i >= len(positional) {
+				return "", fmt.Errorf("%s: too many positional parameters; name them (@recipients = ...)", proc)
+			}
+			name = positional[i]
+		}
+		if !strings.HasPrefix(name, "@") {
+			name = "@" + name
+		}
+		switch name {
+		case "@recipients", "@subject", "@body", "@message":
+			args[name] = p.Value
+		default:
+			dropped = append(dropped, name)
+		}
+	}
+	body := args["@body"]
+	if proc == "xp_sendmail" {
+		body = args["@message"]
+	}
+
+	call := dt.config.NotifierVar + ".Send"
+	dt.sideEffects = append(dt.sideEffects, SideEffect{
+		Procedure: dt.currentProcName,
+		Line:      dt.fileLine(s.Token.Line),
+		Kind:      "mail",
+		Original:  proc,
+		Call:      call,
+		Dropped:   dropped,
+	})
+	if len(dropped) > 0 {
+		dt.warnings = append(dt.warnings, fmt.Sprintf("%s: %s parameter(s) %s are not passed to %s",
+			dt.currentProcName, proc, strings.Join(dropped, ", "), call))
+	}
+
+	var out strings.Builder
+	if dt.emitOriginal() {
+		out.WriteString(fmt.Sprintf("// Original: %s\n", truncateSQL(s.String(), 100)))
+		out.WriteString(dt.indentStr())
+	}
+	ind := dt.indentStr()
+	out.WriteString(fmt.Sprintf("// EXEC %s\n", proc))
+	out.WriteString(fmt.Sprintf("%sif err := %s(ctx, %s, %s, %s); err != nil {\n", ind, call,
+		dt.mailArg(args["@recipients"]), dt.mailArg(args["@subject"]), dt.mailArg(body)))
+	out.WriteString(ind + "\t" + dt.buildErrorReturn() + "\n")
+	out.WriteString(ind + "}")
+	return out.String(), nil
+}
+
+// mailArg returns a Database Mail parameter as a Go string expression.
+// Missing and NULL parameters are empty.
+func (dt *dmlTranspiler) mailArg(e ast.Expression) string {
+	if e == nil {
+		return `""`
+	}
+	if _, ok := e.(*ast.NullLiteral); ok {
+		return `""`
+	}
+	value := dt.exprToGoValue(e)
+	if ti := dt.inferType(e); ti != nil && ti.goType != "string" {
+		dt.imports["fmt"] = true
+		return fmt.Sprintf("fmt.Sprint(%s)", value)
+	}
+	return value
+}
@@ -0,0 +1,1008 @@
+package transpiler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// In-memory temp tables
+//
+// CREATE TABLE #name creates the table in tempTables, the procedure's
+// tsqlruntime.TempTableManager, whatever the backend. INSERT, SELECT,
+// UPDATE and DELETE against a temp table the procedure created run there
+// too, rather than as SQL or service calls for a table the database and
+// services don't have. WHERE and SET become closures over the row's
+// tsqlruntime.Values, whose comparisons keep T-SQL's NULL semantics:
+//
+//	UPDATE #Work SET Total = Total * 2 WHERE Name = @Name
+//
+// becomes
+//
+//	_, err = table.UpdateRows(func(row []tsqlruntime.Value) bool {
+//		return row[1].Equals(tsqlruntime.ToValue(name)).IsTruthy()
+//	}, func(row []tsqlruntime.Value) map[string]tsqlruntime.Value {
+//		return map[string]tsqlruntime.Value{"Total": row[2].Mul(tsqlruntime.ToValue(2))}
+//	})
+//
+// INSERT ... SELECT reads its rows from another temp table in memory, or
+// with SQL from a table of the database. A SELECT may filter, sort, take
+// the TOP rows and aggregate them without GROUP BY.
+//
+// Whether a table is kept in memory is decided for the whole procedure
+// before it is transpiled: if any statement naming the table has no
+// in-memory translation (a join, GROUP BY, FOR JSON, a subquery, a
+// condition of IF or WHILE, ...), every statement on it goes to the
+// fallback backend as before, with a warning. So do temp tables routed
+// with --table-backend and those created outside the procedure.
+
+// memoryTable is a temp table the procedure keeps in tempTables.
+type memoryTable struct {
+	name    string
+	columns []*ast.ColumnDefinition
+}
+
+// column returns the index of a column in a row of the table.
+func (m *memoryTable) column(name string) (int, bool) {
+	for i, col := range m.columns {
+		if strings.EqualFold(col.Name.Value, name) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// memoryTablesIn returns the temp tables created in body, and the global
+// temp tables of the source (see globaltemp.go), whose statements in body
+// all translate in memory, by lower-cased name.
+func (t *transpiler) memoryTablesIn(body *ast.BeginEndBlock) map[string]*memoryTable {
+	if !t.dmlEnabled || body == nil {
+		return nil
+	}
+	dt := &dmlTranspiler{transpiler: t, config: t.dmlConfig}
+	dt.memoryTables = map[string]*memoryTable{}
+	for name, table := range t.globalTempTables {
+		dt.memoryTables[name] = table
+	}
+	var uses []memoryUse
+	collectMemoryUses(body, t.currentProcName, &uses, func(s *ast.CreateTableStatement) {
+		if name := s.Name.String(); !isGlobalTempTable(name) {
+			dt.addMemoryTable(s)
+		}
+	})
+	dt.keepInMemory(uses)
+	return dt.memoryTables
+}
+
+// memoryUse is a statement that may name tables in memory, or the
+// condition of an IF or WHILE.
+type memoryUse struct {
+	proc string
+	stmt ast.Statement // nil for a condition
+	sql  string
+}
+
+// collectMemoryUses appends the statements of stmt in proc to uses,
+// passing the CREATE TABLEs of temp tables to create.
+func collectMemoryUses(stmt ast.Statement, proc string, uses *[]memoryUse, create func(*ast.CreateTableStatement)) {
+	walk := func(inner ast.Statement) { collectMemoryUses(inner, proc, uses, create) }
+	switch s := stmt.(type) {
+	case nil:
+	case *ast.CreateTableStatement:
+		if isTempTable(s.Name.String()) {
+			create(s)
+		}
+	case *ast.DropTableStatement, *ast.TruncateTableStatement:
+		// Both act on tempTables already
+	case *ast.BeginEndBlock:
+		if s == nil {
+			return
+		}
+		for _, inner := range s.Statements {
+			walk(inner)
+		}
+	case *ast.IfStatement:
+		*uses = append(*uses, memoryUse{proc: proc, sql: s.Condition.String()})
+		walk(s.Consequence)
+		walk(s.Alternative)
+	case *ast.WhileStatement:
+		*uses = append(*uses, memoryUse{proc: proc, sql: s.Condition.String()})
+		walk(s.Body)
+	case *ast.TryCatchStatement:
+		if s.TryBlock != nil {
+			walk(s.TryBlock)
+		}
+		if s.CatchBlock != nil {
+			walk(s.CatchBlock)
+		}
+	default:
+		*uses = append(*uses, memoryUse{proc: proc, stmt: s, sql: s.String()})
+	}
+}
+
+// addMemoryTable adds a temp table created by s to those kept in memory,
+// unless --table-backend routes it elsewhere.
+func (dt *dmlTranspiler) addMemoryTable(s *ast.CreateTableStatement) {
+	name := s.Name.String()
+	if _, routed := lookupTableBackend(dt.config.TableToBackend, name); !routed {
+		dt.memoryTables[strings.ToLower(name)] = &memoryTable{name: name, columns: s.Columns}
+	}
+}
+
+// keepInMemory drops from dt.memoryTables the tables named by a use that
+// doesn't translate in memory, warning of each.
+func (dt *dmlTranspiler) keepInMemory(uses []memoryUse) {
+	// A table dropped from memory can take others with it, as when an
+	// INSERT ... SELECT copies it into another
+	for changed := true; changed; {
+		changed = false
+		for _, u := range uses {
+			var named []*memoryTable
+			for _, table := range dt.memoryTables {
+				if namesTable(u.sql, table.name) {
+					named = append(named, table)
+				}
+			}
+			if len(named) == 0 {
+				continue
+			}
+			what := "the condition " + truncateSQL(u.sql, 60)
+			if u.stmt != nil {
+				what = dt.memoryUnsupported(u.stmt)
+			}
+			if what == "" {
+				continue
+			}
+			sort.Slice(named, func(i, j int) bool { return named[i].name < named[j].name })
+			for _, table := range named {
+				dt.warnings = append(dt.warnings, fmt.Sprintf(
+					"%s: %s has no in-memory translation, so statements on %s use the %s backend rather than tempTables",
+					u.proc, what, table.name, dt.config.FallbackBackend))
+				delete(dt.memoryTables, strings.ToLower(table.name))
+			}
+			changed = true
+		}
+	}
+}
+
+// namesTable reports whether sql names the temp table name, other than in
+// a string such as OBJECT_ID('tempdb..#name').
+func namesTable(sql, name string) bool {
+	sql, name = strings.ToLower(sql), strings.ToLower(name)
+	for i := 0; ; {
+		at := strings.Index(sql[i:], name)
+		if at < 0 {
+			return false
+		}
+		start, end := i+at, i+at+len(name)
+		before, after := byte(' '), byte(' ')
+		if start > 0 {
+			before = sql[start-1]
+		}
+		if end < len(sql) {
+			after = sql[end]
+		}
+		if !strings.ContainsRune(".'#", rune(before)) && !isIdentByte(before) && !isIdentByte(after) {
+			return true
+		}
+		i = end
+	}
+}
+
+func isIdentByte(b byte) bool {
+	return b == '_' || b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+}
+
+// memoryTable returns the temp table called name if the procedure keeps
+// it in tempTables.
+func (dt *dmlTranspiler) memoryTable(name string) *memoryTable {
+	if !isTempTable(name) {
+		return nil
+	}
+	return dt.memoryTables[strings.ToLower(name)]
+}
+
+// memorySelectTable returns the temp table a SELECT reads in memory, or
+// nil if it reads something else.
+func (dt *dmlTranspiler) memorySelectTable(s *ast.SelectStatement) *memoryTable {
+	if s == nil || s.From == nil || len(s.From.Tables) != 1 {
+		return nil
+	}
+	return dt.memoryTable(dt.extractMainTable(s))
+}
+
+// memoryUnsupported returns what a statement naming temp tables in memory
+// can't do there, or "" if it translates.
+func (dt *dmlTranspiler) memoryUnsupported(stmt ast.Statement) string {
+	var table *memoryTable
+	var what string
+	switch s := stmt.(type) {
+	case *ast.SelectStatement:
+		if table = dt.memorySelectTable(s); table != nil {
+			what = dt.memorySelectUnsupported(s, table)
+		}
+	case *ast.InsertStatement:
+		if table = dt.memoryTable(dt.extractInsertTable(s)); table != nil {
+			what = dt.memoryInsertUnsupported(s, table)
+		}
+	case *ast.UpdateStatement:
+		if table = dt.memoryTable(dt.extractUpdateTable(s)); table != nil {
+			what = dt.memoryUpdateUnsupported(s, table)
+		}
+	case *ast.DeleteStatement:
+		if table = dt.memoryTable(dt.extractDeleteTable(s)); table != nil {
+			what = dt.memoryDeleteUnsupported(s, table)
+		}
+	}
+	if table == nil {
+		return truncateSQL(stmt.String(), 60)
+	}
+	return what
+}
+
+// memorySelectUnsupported returns what a SELECT from a temp table in
+// memory can't do there, or "".
+func (dt *dmlTranspiler) memorySelectUnsupported(s *ast.SelectStatement, table *memoryTable) string {
+	switch {
+	case s.Distinct:
+		return "SELECT DISTINCT"
+	case len(s.GroupBy) > 0 || s.Having != nil:
+		return "GROUP BY"
+	case s.Union != nil:
+		return s.Union.Type
+	case s.Offset != nil:
+		return "OFFSET"
+	case s.Into != nil:
+		return "SELECT INTO"
+	case s.ForClause != nil:
+		return "FOR " + s.ForClause.ForType
+	case s.Top != nil && (s.Top.Percent || s.Top.WithTies):
+		return "TOP " + s.Top.String()
+	case s.Top != nil && dt.exprContainsColumnRef(s.Top.Count):
+		return "TOP " + s.Top.String()
+	}
+	for _, item := range s.OrderBy {
+		if _, ok := table.column(dt.extractColumnName(item.Expression)); !ok {
+			return "ORDER BY " + truncateSQL(item.Expression.String(), 60)
+		}
+	}
+	if what := dt.memoryExprUnsupported(s.Where, table, false); what != "" {
+		return what
+	}
+	aggregated, perRow := false, false
+	for _, col := range s.Columns {
+		if col.AllColumns {
+			perRow = true
+			continue
+		}
+		scope := &memoryScope{table: table, rows: true, check: true}
+		if _, err := dt.memoryValue(col.Expression, scope); err != nil {
+			return truncateSQL(col.Expression.String(), 60)
+		}
+		if scope.aggregated {
+			aggregated = true
+		} else {
+			perRow = true
+		}
+	}
+	if aggregated && perRow {
+		return "aggregates with other columns"
+	}
+	return ""
+}
+
+// memoryInsertUnsupported returns what an INSERT into a temp table in
+// memory can't do there, or "".
+func (dt *dmlTranspiler) memoryInsertUnsupported(s *ast.InsertStatement, table *memoryTable) string {
+	switch {
+	case s.Output != nil:
+		return "INSERT ... OUTPUT"
+	case s.Top != nil:
+		return "INSERT TOP"
+	case s.DefaultValues:
+		return ""
+	case len(s.Values) > 0:
+		for _, row := range s.Values {
+			for _, v := range row {
+				if what := dt.memoryExprUnsupported(v, table, false); what != "" {
+					return what
+				}
+			}
+		}
+		return ""
+	case s.Select == nil:
+		return "INSERT ... EXEC"
+	}
+	sel := s.Select
+	for _, col := range sel.Columns {
+		if col.AllColumns || col.Variable != nil {
+			return "INSERT ... " + truncateSQL(sel.String(), 60)
+		}
+	}
+
+	// INSERT ... SELECT of values, without a table
+	if sel.From == nil {
+		if sel.Where != nil || sel.Union != nil {
+			return "INSERT ... " + truncateSQL(sel.String(), 60)
+		}
+		for _, col := range sel.Columns {
+			if what := dt.memoryExprUnsupported(col.Expression, table, false); what != "" {
+				return what
+			}
+		}
+		return ""
+	}
+
+	// ... from another temp table in memory
+	if src := dt.memorySelectTable(sel); src != nil {
+		if what := dt.memorySelectUnsupported(sel, src); what != "" {
+			return what
+		}
+		if sel.Top != nil || len(sel.OrderBy) > 0 {
+			return "INSERT ... SELECT TOP"
+		}
+		for _, col := range sel.Columns {
+			if what := dt.memoryExprUnsupported(col.Expression, src, false); what != "" {
+				return what
+			}
+		}
+		return ""
+	}
+
+	// ... or from tables of the database, naming no table in memory
+	for _, ref := range sel.From.Tables {
+		if !databaseTables(ref) {
+			return "INSERT ... " + truncateSQL(sel.String(), 60)
+		}
+	}
+	if dt.getEffectiveBackend(dt.extractMainTable(sel)) != BackendSQL {
+		return "INSERT ... " + truncateSQL(sel.String(), 60)
+	}
+	for _, other := range dt.memoryTables {
+		if namesTable(sel.String(), other.name) {
+			return "INSERT ... " + truncateSQL(sel.String(), 60)
+		}
+	}
+	return ""
+}
+
+// databaseTables reports whether ref is a table of the database or a join
+// of them, rather than a temp table, table variable or function.
+func databaseTables(ref ast.TableReference) bool {
+	switch r := ref.(type) {
+	case *ast.TableName:
+		name := r.Name.String()
+		return !isTempTable(name) && !strings.HasPrefix(name, "@")
+	case *ast.JoinClause:
+		return databaseTables(r.Left) && databaseTables(r.Right)
+	}
+	return false
+}
+
+// memoryUpdateUnsupported returns what an UPDATE of a temp table in memory
+// can't do there, or "".
+func (dt *dmlTranspiler) memoryUpdateUnsupported(s *ast.UpdateStatement, table *memoryTable) string {
+	switch {
+	case s.From != nil:
+		return "UPDATE ... FROM"
+	case s.Output != nil:
+		return "UPDATE ... OUTPUT"
+	case s.Top != nil:
+		return "UPDATE TOP"
+	}
+	for _, set := range s.SetClauses {
+		_, known := memoryValueOps[strings.TrimSuffix(set.Operator, "=")]
+		if set.IsMethodCall || set.Operator != "=" && !known {
+			return "SET " + truncateSQL(set.Column.String(), 60)
+		}
+		if what := dt.memoryExprUnsupported(set.Value, table, false); what != "" {
+			return what
+		}
+	}
+	return dt.memoryExprUnsupported(s.Where, table, false)
+}
+
+// memoryDeleteUnsupported returns what a DELETE from a temp table in
+// memory can't do there, or "".
+func (dt *dmlTranspiler) memoryDeleteUnsupported(s *ast.DeleteStatement, table *memoryTable) string {
+	switch {
+	case s.From != nil:
+		return "DELETE ... FROM"
+	case s.Output != nil:
+		return "DELETE ... OUTPUT"
+	case s.Top != nil:
+		return "DELETE TOP"
+	}
+	return dt.memoryExprUnsupported(s.Where, table, false)
+}
+
+// memoryExprUnsupported returns expr if it has no in-memory translation,
+// or "".
+func (dt *dmlTranspiler) memoryExprUnsupported(expr ast.Expression, table *memoryTable, rows bool) string {
+	if expr == nil {
+		return ""
+	}
+	if _, err := dt.memoryValue(expr, &memoryScope{table: table, rows: rows, check: true}); err != nil {
+		return truncateSQL(expr.String(), 60)
+	}
+	return ""
+}
+
+// memoryError returns the error for a statement on a temp table in memory
+// that has no translation.
+func (dt *dmlTranspiler) memoryError(table *memoryTable, what string) error {
+	return fmt.Errorf("%s: %s on %s has no in-memory translation; the procedure creates %s in tempTables",
+		dt.currentProcName, what, table.name, table.name)
+}
+
+// memoryValueOps are the tsqlruntime.Value methods of operators.
+var memoryValueOps = map[string]string{
+	"+": "Add", "-": "Sub", "*": "Mul", "/": "Div", "%": "Mod",
+	"=": "Equals", "<>": "NotEquals", "!=": "NotEquals",
+	"<": "LessThan", "<=": "LessThanOrEqual", ">": "GreaterThan", ">=": "GreaterThanOrEqual",
+	"AND": "And", "OR": "Or",
+}
+
+// memoryScope is what memoryValue reads columns from.
+type memoryScope struct {
+	table      *memoryTable
+	rows       bool // Aggregates read the selected rows, in rows
+	aggregated bool // Set when an aggregate is read
+	check      bool // Only check that expr translates, generating nothing
+}
+
+// memoryValue returns a Go expression of the tsqlruntime.Value of expr,
+// reading columns of the table from row.
+func (dt *dmlTranspiler) memoryValue(expr ast.Expression, scope *memoryScope) (string, error) {
+	table := scope.table
+	not := func(v string, negate bool) string {
+		if negate {
+			return v + ".Not()"
+		}
+		return v
+	}
+	switch e := expr.(type) {
+	case *ast.Identifier, *ast.QualifiedIdentifier:
+		name := dt.extractColumnName(e)
+		i, ok := table.column(name)
+		if !ok {
+			return "", fmt.Errorf("%s: invalid column name '%s' of %s", dt.currentProcName, name, table.name)
+		}
+		return fmt.Sprintf("row[%d]", i), nil
+	case *ast.InfixExpression:
+		method, ok := memoryValueOps[strings.ToUpper(e.Operator)]
+		if !ok || !dt.exprContainsColumnRef(e) {
+			break
+		}
+		left, err := dt.memoryValue(e.Left, scope)
+		if err != nil {
+			return "", err
+		}
+		right, err := dt.memoryValue(e.Right, scope)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s.%s(%s)", left, method, right), nil
+	case *ast.PrefixExpression:
+		if !dt.exprContainsColumnRef(e.Right) {
+			break
+		}
+		right, err := dt.memoryValue(e.Right, scope)
+		if err != nil {
+			return "", err
+		}
+		switch strings.ToUpper(e.Operator) {
+		case "NOT":
+			return right + ".Not()", nil
+		case "-":
+			return right + ".Neg()", nil
+		case "+":
+			return right, nil
+		}
+	case *ast.IsNullExpression:
+		v, err := dt.memoryValue(e.Expr, scope)
+		if err != nil {
+			return "", err
+		}
+		if e.Not {
+			return fmt.Sprintf("tsqlruntime.NewBit(!%s.IsNull)", v), nil
+		}
+		return fmt.Sprintf("tsqlruntime.NewBit(%s.IsNull)", v), nil
+	case *ast.BetweenExpression:
+		v, err := dt.memoryValue(e.Expr, scope)
+		if err != nil {
+			return "", err
+		}
+		low, err := dt.memoryValue(e.Low, scope)
+		if err != nil {
+			return "", err
+		}
+		high, err := dt.memoryValue(e.High, scope)
+		if err != nil {
+			return "", err
+		}
+		return not(fmt.Sprintf("%s.GreaterThanOrEqual(%s).And(%s.LessThanOrEqual(%s))", v, low, v, high), e.Not), nil
+	case *ast.InExpression:
+		if e.Subquery != nil || len(e.Values) == 0 {
+			break
+		}
+		v, err := dt.memoryValue(e.Expr, scope)
+		if err != nil {
+			return "", err
+		}
+		var in string
+		for i, value := range e.Values {
+			item, err := dt.memoryValue(value, scope)
+			if err != nil {
+				return "", err
+			}
+			if i == 0 {
+				in = fmt.Sprintf("%s.Equals(%s)", v, item)
+			} else {
+				in += fmt.Sprintf(".Or(%s.Equals(%s))", v, item)
+			}
+		}
+		return not(in, e.Not), nil
+	case *ast.LikeExpression:
+		if e.Escape != nil {
+			break
+		}
+		v, err := dt.memoryValue(e.Expr, scope)
+		if err != nil {
+			return "", err
+		}
+		pattern, err := dt.memoryValue(e.Pattern, scope)
+		if err != nil {
+			return "", err
+		}
+		return not(fmt.Sprintf("%s.Like(%s)", v, pattern), e.Not), nil
+	case *ast.FunctionCall:
+		if e.Over != nil || !dt.exprContainsColumnRef(e) {
+			break
+		}
+		name := strings.ToUpper(e.Function.String())
+		switch {
+		case (name == "ISNULL" && len(e.Arguments) == 2) || (name == "COALESCE" && len(e.Arguments) > 1):
+			var args []string
+			for _, arg := range e.Arguments {
+				v, err := dt.memoryValue(arg, scope)
+				if err != nil {
+					return "", err
+				}
+				args = append(args, v)
+			}
+			return fmt.Sprintf("%s.Coalesce(%s)", args[0], strings.Join(args[1:], ", ")), nil
+		case isCountStar(e) && scope.rows:
+			scope.aggregated = true
+			return "tsqlruntime.NewInt(int64(len(rows)))", nil
+		case scope.rows && len(e.Arguments) == 1 && (name == "SUM" || name == "AVG" || name == "MIN" || name == "MAX" || name == "COUNT"):
+			// An aggregate reads each row; aggregates don't nest
+			inner := &memoryScope{table: table, check: scope.check}
+			v, err := dt.memoryValue(e.Arguments[0], inner)
+			if err != nil {
+				return "", err
+			}
+			scope.aggregated = true
+			return fmt.Sprintf("tsqlruntime.Aggregate(%q, rows, func(row []tsqlruntime.Value) tsqlruntime.Value { return %s })", name, v), nil
+		}
+	}
+	if dt.exprContainsColumnRef(expr) {
+		return "", dt.memoryError(table, truncateSQL(expr.String(), 60))
+	}
+	// Variables, literals and the like are evaluated in Go
+	if scope.check {
+		if strings.Contains(strings.ToUpper(expr.String()), "SELECT ") {
+			return "", dt.memoryError(table, "a subquery")
+		}
+		return "", nil
+	}
+	value, err := dt.transpileExpression(expr)
+	if err != nil {
+		return "", err
+	}
+	return "tsqlruntime.ToValue(" + value + ")", nil
+}
+
+// memoryFilter returns the filter of a WHERE clause on table, or nil.
+func (dt *dmlTranspiler) memoryFilter(where ast.Expression, table *memoryTable) (string, error) {
+	if where == nil {
+		return "nil", nil
+	}
+	cond, err := dt.memoryValue(where, &memoryScope{table: table})
+	if err != nil {
+		return "", err
+	}
+	ind := dt.indentStr()
+	return "func(row []tsqlruntime.Value) bool {\n" + ind + "\t\treturn " + cond + ".IsTruthy()\n" + ind + "\t}", nil
+}
+
+// memoryGoType returns the Go type of a column of a SELECT from table:
+// that of the table's column, or of an aggregate's argument.
+func (dt *dmlTranspiler) memoryGoType(expr ast.Expression, table *memoryTable) string {
+	switch e := expr.(type) {
+	case *ast.Identifier, *ast.QualifiedIdentifier:
+		if i, ok := table.column(dt.extractColumnName(e)); ok && table.columns[i].DataType != nil {
+			if goType, err := dt.mapDataType(table.columns[i].DataType); err == nil {
+				return goType
+			}
+		}
+	case *ast.FunctionCall:
+		switch name := strings.ToUpper(e.Function.String()); {
+		case name == "COUNT" || name == "COUNT_BIG":
+			return "int64"
+		case len(e.Arguments) > 0 && (name == "SUM" || name == "AVG" || name == "MIN" || name == "MAX" || name == "ISNULL" || name == "COALESCE"):
+			return dt.memoryGoType(e.Arguments[0], table)
+		}
+	}
+	if ti := dt.inferType(expr); ti != nil && ti.goType != "" && ti.goType != "any" {
+		return ti.goType
+	}
+	return "string"
+}
+
+// memoryGoValue converts a Go expression of a tsqlruntime.Value to
+// goType, reporting false for types it can't.
+func memoryGoValue(value, goType string) (string, bool) {
+	switch goType {
+	case "int64":
+		return value + ".AsInt()", true
+	case "int32", "int16", "uint8", "int":
+		return fmt.Sprintf("%s(%s.AsInt())", goType, value), true
+	case "float64":
+		return value + ".AsFloat()", true
+	case "float32":
+		return fmt.Sprintf("float32(%s.AsFloat())", value), true
+	case "string":
+		return value + ".AsString()", true
+	case "bool":
+		return value + ".AsBool()", true
+	case "time.Time":
+		return value + ".AsTime()", true
+	case "decimal.Decimal":
+		return value + ".AsDecimal()", true
+	case "any", "interface{}":
+		return "tsqlruntime.FromValue(" + value + ")", true
+	}
+	return "", false
+}
+
+// memoryBlock opens a block reading table from tempTables, returning its
+// first lines. The caller writes the indentation of the first.
+func (dt *dmlTranspiler) memoryBlock(comment string, table *memoryTable) string {
+	dt.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+	ind := dt.indentStr()
+	var out strings.Builder
+	out.WriteString(comment + "\n")
+	out.WriteString(ind + "{\n")
+	out.WriteString(ind + fmt.Sprintf("\ttable, err := tempTables.Table(%q)\n", table.name))
+	out.WriteString(ind + "\tif err != nil {\n")
+	out.WriteString(ind + "\t\t" + dt.buildErrorReturn() + "\n")
+	out.WriteString(ind + "\t}\n")
+	return out.String()
+}
+
+// transpileSelectMemory reads the rows of a temp table in memory into
+// variables, as transpileSelectSQL scans them.
+func (dt *dmlTranspiler) transpileSelectMemory(s *ast.SelectStatement, table *memoryTable) (string, error) {
+	if what := dt.memorySelectUnsupported(s, table); what != "" {
+		return "", dt.memoryError(table, what)
+	}
+	filter, err := dt.memoryFilter(s.Where, table)
+	if err != nil {
+		return "", err
+	}
+	ind := dt.indentStr()
+
+	columns := s.Columns
+	if len(columns) == 1 && columns[0].AllColumns {
+		columns = nil
+		for _, col := range table.columns {
+			columns = append(columns, ast.SelectColumn{Expression: &ast.Identifier{Value: col.Name.Value}})
+		}
+	}
+
+	// Each column is assigned to its variable, or to one declared for the
+	// result set; aggregates once, other columns from each row
+	var assigns, decls []string
+	var contractCols []ContractColumn
+	aggregated := false
+	used := map[string]int{}
+	for _, col := range columns {
+		goType := dt.memoryGoType(col.Expression, table)
+		var name string
+		if col.Variable != nil {
+			name = goIdentifier(strings.TrimPrefix(col.Variable.Name, "@"))
+			if ti := dt.symbols.lookup(name); ti != nil && ti.goType != "" {
+				goType = ti.goType
+			}
+		} else {
+			column := dt.extractColumnName(col.Expression)
+			if col.Alias != nil {
+				column = col.Alias.Value
+			}
+			name = goIdentifier(column)
+			if n := used[name]; n > 0 {
+				used[name] = n + 1
+				name = fmt.Sprintf("%s%d", name, n+1)
+			} else {
+				used[name] = 1
+			}
+			if goType == "time.Time" {
+				dt.imports["time"] = true
+			}
+			if dt.isDecimalType(goType) {
+				dt.importDecimal()
+			}
+			decls = append(decls, fmt.Sprintf("var %s %s", name, goType))
+			contractCols = append(contractCols, ContractColumn{Name: column, GoType: goType})
+			dt.symbols.markDeclared(name)
+		}
+
+		if isCountStar(col.Expression) {
+			aggregated = true
+			assigns = append(assigns, fmt.Sprintf("%s = %s(len(rows))", name, goType))
+			continue
+		}
+		scope := &memoryScope{table: table, rows: true}
+		value, err := dt.memoryValue(col.Expression, scope)
+		if err != nil {
+			return "", err
+		}
+		aggregated = aggregated || scope.aggregated
+		converted, ok := memoryGoValue(value, goType)
+		if !ok {
+			return "", dt.memoryError(table, fmt.Sprintf("SELECT of %s into %s", col.Expression.String(), goType))
+		}
+		assigns = append(assigns, fmt.Sprintf("%s = %s", name, converted))
+	}
+
+	var out strings.Builder
+	for _, decl := range decls {
+		out.WriteString(decl + "\n" + ind)
+	}
+	out.WriteString(dt.memoryBlock("// SELECT FROM "+table.name+" in memory", table))
+	out.WriteString(ind + fmt.Sprintf("\trows := table.Select(%s)\n", filter))
+	if len(s.OrderBy) > 0 && !aggregated {
+		var keys []string
+		for _, item := range s.OrderBy {
+			i, _ := table.column(dt.extractColumnName(item.Expression))
+			if item.Descending {
+				keys = append(keys, fmt.Sprintf("tsqlruntime.SortKey{Column: %d, Desc: true}", i))
+			} else {
+				keys = append(keys, fmt.Sprintf("tsqlruntime.SortKey{Column: %d}", i))
+			}
+		}
+		out.WriteString(ind + fmt.Sprintf("\ttsqlruntime.SortRows(rows, %s)\n", strings.Join(keys, ", ")))
+	}
+	if s.Top != nil && !aggregated {
+		count, err := dt.transpileExpression(s.Top.Count)
+		if err != nil {
+			return "", err
+		}
+		out.WriteString(ind + fmt.Sprintf("\tif n := int(%s); len(rows) > n {\n", count))
+		out.WriteString(ind + "\t\trows = rows[:n]\n")
+		out.WriteString(ind + "\t}\n")
+	}
+	if aggregated {
+		// Aggregates without GROUP BY make one row, whatever the rows read
+		for _, a := range assigns {
+			out.WriteString(ind + "\t" + a + "\n")
+		}
+		if dt.usesRowCount {
+			out.WriteString(ind + "\trowsAffected = 1\n")
+		}
+	} else {
+		out.WriteString(ind + "\tfor _, row := range rows {\n")
+		for _, a := range assigns {
+			out.WriteString(ind + "\t\t" + a + "\n")
+		}
+		out.WriteString(ind + "\t}\n")
+		if dt.usesRowCount {
+			out.WriteString(ind + "\trowsAffected = int32(len(rows))\n")
+		}
+	}
+	out.WriteString(ind + "}")
+	dt.recordResultSet(contractCols)
+	return out.String(), nil
+}
+
+// transpileInsertMemory inserts rows into a temp table in memory: the
+// rows of VALUES, or those of a SELECT from another temp table in memory
+// or, with SQL, from the database.
+func (dt *dmlTranspiler) transpileInsertMemory(s *ast.InsertStatement, table *memoryTable) (string, error) {
+	if what := dt.memoryInsertUnsupported(s, table); what != "" {
+		return "", dt.memoryError(table, what)
+	}
+	columns := "nil"
+	if len(s.Columns) > 0 {
+		var names []string
+		for _, c := range s.Columns {
+			if _, ok := table.column(c.Value); !ok {
+				return "", fmt.Errorf("%s: invalid column name '%s' of %s", dt.currentProcName, c.Value, table.name)
+			}
+			names = append(names, fmt.Sprintf("%q", c.Value))
+		}
+		columns = "[]string{" + strings.Join(names, ", ") + "}"
+	}
+	ind := dt.indentStr()
+	insert := func(values string) string {
+		return ind + fmt.Sprintf("\tif err := table.InsertScanned(%s, %s); err != nil {\n", columns, values) +
+			ind + "\t\t" + dt.buildErrorReturn() + "\n" +
+			ind + "\t}\n"
+	}
+	goValues := func(exprs []ast.Expression) (string, error) {
+		var values []string
+		for _, v := range exprs {
+			value, err := dt.transpileExpression(v)
+			if err != nil {
+				return "", err
+			}
+			values = append(values, value)
+		}
+		return "[]any{" + strings.Join(values, ", ") + "}", nil
+	}
+
+	var out strings.Builder
+	switch {
+	case s.DefaultValues:
+		out.WriteString(dt.memoryBlock("// INSERT INTO "+table.name+" in memory", table))
+		out.WriteString(insert("[]any{}"))
+		if dt.usesRowCount {
+			out.WriteString(ind + "\trowsAffected = 1\n")
+		}
+
+	case len(s.Values) > 0 || s.Select.From == nil:
+		rows := s.Values
+		if len(rows) == 0 {
+			var row []ast.Expression
+			for _, col := range s.Select.Columns {
+				row = append(row, col.Expression)
+			}
+			rows = [][]ast.Expression{row}
+		}
+		out.WriteString(dt.memoryBlock("// INSERT INTO "+table.name+" in memory", table))
+		for _, row := range rows {
+			values, err := goValues(row)
+			if err != nil {
+				return "", err
+			}
+			out.WriteString(insert(values))
+		}
+		if dt.usesRowCount {
+			out.WriteString(ind + fmt.Sprintf("\trowsAffected = %d\n", len(rows)))
+		}
+
+	case dt.memorySelectTable(s.Select) != nil:
+		src := dt.memorySelectTable(s.Select)
+		filter, err := dt.memoryFilter(s.Select.Where, src)
+		if err != nil {
+			return "", err
+		}
+		var values []string
+		for _, col := range s.Select.Columns {
+			value, err := dt.memoryValue(col.Expression, &memoryScope{table: src})
+			if err != nil {
+				return "", err
+			}
+			values = append(values, value)
+		}
+		out.WriteString(dt.memoryBlock("// INSERT INTO "+table.name+" ... SELECT FROM "+src.name+" in memory", table))
+		out.WriteString(ind + fmt.Sprintf("\tsource, err := tempTables.Table(%q)\n", src.name))
+		out.WriteString(ind + "\tif err != nil {\n")
+		out.WriteString(ind + "\t\t" + dt.buildErrorReturn() + "\n")
+		out.WriteString(ind + "\t}\n")
+		out.WriteString(ind + fmt.Sprintf("\trows := source.Select(%s)\n", filter))
+		out.WriteString(ind + "\tfor _, row := range rows {\n")
+		out.WriteString(strings.ReplaceAll(insert("[]any{"+strings.Join(values, ", ")+"}"), ind+"\t", ind+"\t\t"))
+		out.WriteString(ind + "\t}\n")
+		if dt.usesRowCount {
+			out.WriteString(ind + "\trowsAffected = int32(len(rows))\n")
+		}
+
+	default:
+		query, args := dt.buildSelectQuery(s.Select)
+		query, args = dt.bindQueryVariables(query, args)
+		n := len(s.Select.Columns)
+		var scan []string
+		for i := 0; i < n; i++ {
+			scan = append(scan, fmt.Sprintf("&values[%d]", i))
+		}
+		out.WriteString(dt.memoryBlock("// INSERT INTO "+table.name+" in memory ... SELECT from the database", table))
+		out.WriteString(ind + fmt.Sprintf("\trows, err := %s.QueryContext(ctx, %q", dt.getDBVar(), query))
+		for _, arg := range args {
+			out.WriteString(", " + arg)
+		}
+		out.WriteString(")\n")
+		out.WriteString(ind + "\tif err != nil {\n")
+		out.WriteString(ind + "\t\t" + dt.buildErrorReturn() + "\n")
+		out.WriteString(ind + "\t}\n")
+		out.WriteString(ind + "\tdefer rows.Close()\n")
+		if dt.usesRowCount {
+			out.WriteString(ind + "\trowsAffected = 0\n")
+		}
+		out.WriteString(ind + "\tfor rows.Next() {\n")
+		out.WriteString(ind + fmt.Sprintf("\t\tvalues := make([]any, %d)\n", n))
+		out.WriteString(ind + fmt.Sprintf("\t\tif err := rows.Scan(%s); err != nil {\n", strings.Join(scan, ", ")))
+		out.WriteString(ind + "\t\t\t" + dt.buildErrorReturn() + "\n")
+		out.WriteString(ind + "\t\t}\n")
+		out.WriteString(strings.ReplaceAll(insert("values"), ind+"\t", ind+"\t\t"))
+		if dt.usesRowCount {
+			out.WriteString(ind + "\t\trowsAffected++\n")
+		}
+		out.WriteString(ind + "\t}\n")
+		out.WriteString(ind + "\tif err := rows.Err(); err != nil {\n")
+		out.WriteString(ind + "\t\t" + dt.buildErrorReturn() + "\n")
+		out.WriteString(ind + "\t}\n")
+	}
+	out.WriteString(ind + "}")
+	return out.String(), nil
+}
+
+// transpileUpdateMemory updates the rows of a temp table in memory.
+func (dt *dmlTranspiler) transpileUpdateMemory(s *ast.UpdateStatement, table *memoryTable) (string, error) {
+	if what := dt.memoryUpdateUnsupported(s, table); what != "" {
+		return "", dt.memoryError(table, what)
+	}
+	filter, err := dt.memoryFilter(s.Where, table)
+	if err != nil {
+		return "", err
+	}
+	ind := dt.indentStr()
+	var sets []string
+	for _, set := range s.SetClauses {
+		name := dt.extractColumnName(set.Column)
+		i, ok := table.column(name)
+		if !ok {
+			return "", fmt.Errorf("%s: invalid column name '%s' of %s", dt.currentProcName, name, table.name)
+		}
+		value, err := dt.memoryValue(set.Value, &memoryScope{table: table})
+		if err != nil {
+			return "", err
+		}
+		if op := strings.TrimSuffix(set.Operator, "="); op != "" {
+			value = fmt.Sprintf("row[%d].%s(%s)", i, memoryValueOps[op], value)
+		}
+		sets = append(sets, fmt.Sprintf("%q: %s", table.columns[i].Name.Value, value))
+	}
+
+	var out strings.Builder
+	out.WriteString(dt.memoryBlock("// UPDATE "+table.name+" in memory", table))
+	n := "_, err ="
+	if dt.usesRowCount {
+		n = "n, err :="
+	}
+	out.WriteString(ind + fmt.Sprintf("\t%s table.UpdateRows(%s, func(row []tsqlruntime.Value) map[string]tsqlruntime.Value {\n", n, filter))
+	out.WriteString(ind + "\t\treturn map[string]tsqlruntime.Value{" + strings.Join(sets, ", ") + "}\n")
+	out.WriteString(ind + "\t})\n")
+	out.WriteString(ind + "\tif err != nil {\n")
+	out.WriteString(ind + "\t\t" + dt.buildErrorReturn() + "\n")
+	out.WriteString(ind + "\t}\n")
+	if dt.usesRowCount {
+		out.WriteString(ind + "\trowsAffected = int32(n)\n")
+	}
+	out.WriteString(ind + "}")
+	return out.String(), nil
+}
+
+// transpileDeleteMemory deletes rows of a temp table in memory.
+func (dt *dmlTranspiler) transpileDeleteMemory(s *ast.DeleteStatement, table *memoryTable) (string, error) {
+	if what := dt.memoryDeleteUnsupported(s, table); what != "" {
+		return "", dt.memoryError(table, what)
+	}
+	filter, err := dt.memoryFilter(s.Where, table)
+	if err != nil {
+		return "", err
+	}
+	ind := dt.indentStr()
+	var out strings.Builder
+	out.WriteString(dt.memoryBlock("// DELETE FROM "+table.name+" in memory", table))
+	if dt.usesRowCount {
+		out.WriteString(ind + fmt.Sprintf("\trowsAffected = int32(table.Delete(%s))\n", filter))
+	} else {
+		out.WriteString(ind + fmt.Sprintf("\ttable.Delete(%s)\n", filter))
+	}
+	out.WriteString(ind + "}")
+	return out.String(), nil
+}
@@ -0,0 +1,182 @@
+package transpiler
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Migration report
+//
+// A MigrationReport sums up a run for whoever plans the rest of the
+// migration: the procedures transpiled and their statements, the features
+// they use (as in the feature matrix), the TODOs left in the generated code,
+// the constructs with no translation, and the procedures likely to need the
+// most work by hand. Effort is a rough weighting, for ordering procedures
+// rather than estimating time:
+//
+//	2 per TODO and per warning
+//	3 for cursors, dynamic SQL and linked servers, each
+//	2 for XML
+//	1 for temp tables, transactions and TRY/CATCH, each
+
+// MigrationReport is the report of the files of a run added to it.
+type MigrationReport struct {
+	Files       []string
+	Procedures  []ProcedureReport
+	Statements  map[string]int // Statements of every procedure, by kind: SELECT, EXEC, ...
+	TODOs       int            // TODO comments in the generated code
+	Warnings    int            // Warnings and diagnostics that aren't notes
+	Unsupported []Issue        // Untranslated constructs, WHERE values left out and skipped DDL
+}
+
+// ProcedureReport is a procedure's part of a MigrationReport.
+type ProcedureReport struct {
+	File       string
+	GoName     string // "" if the procedure has no contract
+	Features   ProcedureFeatures
+	Statements int
+	TODOs      int
+	Warnings   int
+	Effort     int
+}
+
+// unsupportedRules are the rules of the Issues listed as unsupported.
+var unsupportedRules = map[string]bool{
+	RuleUntranslated: true,
+	RuleComplexField: true,
+	RuleDDLSkipped:   true,
+}
+
+// Add adds file, whose T-SQL is source, transpiled to result.
+func (r *MigrationReport) Add(file, source string, result *TranspileResult) error {
+	scans, err := scanFeatures(source)
+	if err != nil {
+		return err
+	}
+	if r.Statements == nil {
+		r.Statements = map[string]int{}
+	}
+	r.Files = append(r.Files, file)
+	r.TODOs += strings.Count(result.Code, "TODO")
+
+	goNames := map[string]string{}
+	for _, c := range result.Contracts {
+		goNames[strings.ToLower(unqualifiedName(c.Name))] = c.GoName
+	}
+	// Warnings of a procedure are "Name: ..." or have it as their Procedure
+	warnings := map[string]int{}
+	for _, issue := range result.Issues(file) {
+		if issue.Severity == SeverityNote {
+			continue
+		}
+		r.Warnings++
+		if unsupportedRules[issue.Rule] {
+			r.Unsupported = append(r.Unsupported, issue)
+		}
+		name := issue.Procedure
+		if name == "" {
+			name, _, _ = strings.Cut(issue.Message, ": ")
+		}
+		warnings[strings.ToLower(unqualifiedName(name))]++
+	}
+
+	for _, f := range scans {
+		key := strings.ToLower(unqualifiedName(f.features.Procedure))
+		p := ProcedureReport{
+			File:     file,
+			GoName:   goNames[key],
+			Features: f.features,
+			Warnings: warnings[key],
+		}
+		for kind, n := range f.kinds {
+			r.Statements[kind] += n
+			p.Statements += n
+		}
+		if p.GoName != "" {
+			p.TODOs = strings.Count(goFunction(result.Code, p.GoName), "TODO")
+		}
+		p.Effort = effort(p)
+		r.Procedures = append(r.Procedures, p)
+	}
+	return nil
+}
+
+// goFunction returns the generated function or method name in code, or "".
+func goFunction(code, name string) string {
+	start := regexp.MustCompile(`(?m)^func (?:\([^)]*\) )?` + regexp.QuoteMeta(name) + `\(`).FindStringIndex(code)
+	if start == nil {
+		return ""
+	}
+	body := code[start[0]:]
+	if end := strings.Index(body, "\n}\n"); end >= 0 {
+		body = body[:end+2]
+	}
+	return body
+}
+
+// effort weighs what p leaves to do by hand (see MigrationReport).
+func effort(p ProcedureReport) int {
+	f := p.Features
+	e := 2*p.TODOs + 2*p.Warnings
+	for _, hard := range []bool{f.Cursors, f.DynamicSQL, f.LinkedServers} {
+		if hard {
+			e += 3
+		}
+	}
+	if f.XML {
+		e += 2
+	}
+	for _, used := range []bool{f.TempTables, f.Transactions, f.TryCatch} {
+		if used {
+			e++
+		}
+	}
+	return e
+}
+
+// FeatureCounts returns how many procedures use each of FeatureNames.
+func (r *MigrationReport) FeatureCounts() []int {
+	counts := make([]int, len(FeatureNames))
+	for _, p := range r.Procedures {
+		for i, used := range p.Features.Flags() {
+			if used {
+				counts[i]++
+			}
+		}
+	}
+	return counts
+}
+
+// StatementKinds returns the kinds of statement in r, the most used first.
+func (r *MigrationReport) StatementKinds() []string {
+	kinds := make([]string, 0, len(r.Statements))
+	for kind := range r.Statements {
+		kinds = append(kinds, kind)
+	}
+	sort.Slice(kinds, func(i, j int) bool {
+		if r.Statements[kinds[i]] != r.Statements[kinds[j]] {
+			return r.Statements[kinds[i]] > r.Statements[kinds[j]]
+		}
+		return kinds[i] < kinds[j]
+	})
+	return kinds
+}
+
+// Hotspots returns the n procedures with the most Effort, leaving out
+// those with none.
+func (r *MigrationReport) Hotspots(n int) []ProcedureReport {
+	var hot []ProcedureReport
+	for _, p := range r.Procedures {
+		if p.Effort > 0 {
+			hot = append(hot, p)
+		}
+	}
+	sort.SliceStable(hot, func(i, j int) bool {
+		return hot[i].Effort > hot[j].Effort
+	})
+	if len(hot) > n {
+		hot = hot[:n]
+	}
+	return hot
+}
@@ -0,0 +1,65 @@
+package transpiler
+
+import (
+	"testing"
+)
+
+func TestMigrationReport(t *testing.T) {
+	source := `CREATE PROCEDURE dbo.GetOrders @CustomerID INT
+AS
+BEGIN
+    SELECT OrderID FROM Orders WHERE CustomerID = @CustomerID
+END
+GO
+CREATE PROCEDURE dbo.CloseOrders
+AS
+BEGIN
+    DECLARE @Id INT
+    DECLARE c CURSOR FOR SELECT OrderID FROM Orders
+    OPEN c
+    FETCH NEXT FROM c INTO @Id
+    WHILE @@FETCH_STATUS = 0
+    BEGIN
+        UPDATE Orders SET Closed = 1 WHERE OrderID = @Id
+        FETCH NEXT FROM c INTO @Id
+    END
+    CLOSE c
+    DEALLOCATE c
+END
+`
+	result, err := TranspileWithDMLEx(source, "main", DefaultDMLConfig())
+	if err != nil {
+		t.Fatalf("TranspileWithDMLEx failed: %v", err)
+	}
+	var report MigrationReport
+	if err := report.Add("orders.sql", source, result); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	if len(report.Files) != 1 || len(report.Procedures) != 2 {
+		t.Fatalf("expected 1 file and 2 procedures, got %v and %+v", report.Files, report.Procedures)
+	}
+	want := map[string]int{"SELECT": 1, "DECLARE": 1, "DECLARE CURSOR": 1, "OPEN CURSOR": 1, "FETCH": 2, "WHILE": 1, "UPDATE": 1, "CLOSE CURSOR": 1, "DEALLOCATE CURSOR": 1}
+	for kind, n := range want {
+		if report.Statements[kind] != n {
+			t.Errorf("expected %d %s statements, got %d (%v)", n, kind, report.Statements[kind], report.Statements)
+		}
+	}
+	if kinds := report.StatementKinds(); kinds[0] != "FETCH" {
+		t.Errorf("expected FETCH, the most used, first, got %v", kinds)
+	}
+
+	get, closeOrders := report.Procedures[0], report.Procedures[1]
+	if get.GoName != "GetOrders" || get.Statements != 1 || get.Effort != 0 {
+		t.Errorf("unexpected GetOrders report %+v", get)
+	}
+	if closeOrders.Statements != 9 || !closeOrders.Features.Cursors || closeOrders.Effort < 3 {
+		t.Errorf("unexpected CloseOrders report %+v", closeOrders)
+	}
+	if counts := report.FeatureCounts(); counts[0] != 1 {
+		t.Errorf("expected one procedure with cursors, got %v", counts)
+	}
+	if hot := report.Hotspots(10); len(hot) != 1 || hot[0].Features.Procedure != "dbo.CloseOrders" {
+		t.Errorf("expected CloseOrders as the only hotspot, got %+v", hot)
+	}
+}
@@ -0,0 +1,707 @@
+package transpiler
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// MongoDB backend
+//
+// Maps DML to mongo-go-driver calls on the *mongo.Database held in StoreVar
+// (MongoDatabaseVar when tables are routed here from another backend):
+//
+//	SELECT @a = Col FROM T WHERE ...  -> Collection("t").FindOne(ctx, filter).Decode(&doc)
+//	SELECT @n = COUNT(*) FROM T ...   -> Collection("t").CountDocuments(ctx, filter)
+//	SELECT Col FROM T WHERE ...       -> Collection("t").Find(ctx, filter, opts)
+//	INSERT INTO T (...) VALUES (...)  -> Collection("t").InsertOne / InsertMany
+//	UPDATE T SET ... WHERE ...        -> Collection("t").UpdateMany(ctx, filter, bson.M{"$set": ...})
+//	DELETE FROM T WHERE ...           -> Collection("t").DeleteMany(ctx, filter)
+//
+// WHERE clauses become bson filters. Conditions that can't be expressed as a
+// filter are an error rather than being dropped, since a dropped condition
+// would widen an UPDATE or DELETE.
+
+const (
+	mongoImport        = "go.mongodb.org/mongo-driver/mongo"
+	mongoBSONImport    = "go.mongodb.org/mongo-driver/bson"
+	mongoOptionsImport = "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoCollection returns the Go expression for a table's collection.
+// Collections default to the lowerCamel table name (OrderItems -> orderItems).
+func (dt *dmlTranspiler) mongoCollection(table string) string {
+	name := dt.config.TableToCollection[table]
+	if name == "" {
+		for t, c := range dt.config.TableToCollection {
+			if strings.EqualFold(t, table) {
+				name = c
+				break
+			}
+		}
+	}
+	if name == "" {
+		name = goUnexportedIdentifier(table)
+	}
+	db := dt.config.StoreVar
+	if dt.config.MongoDatabaseVar != "" {
+		db = dt.config.MongoDatabaseVar
+	}
+	return fmt.Sprintf("%s.Collection(%q)", db, name)
+}
+
+func (dt *dmlTranspiler) mongoUnsupported(stmt ast.Node, why string) error {
+	return fmt.Errorf("--backend=mongo: %s: %s", why, truncateSQL(stmt.String(), 80))
+}
+
+// ---------------------------------------------------------------------------
+// SELECT
+// ---------------------------------------------------------------------------
+
+func (dt *dmlTranspiler) transpileSelectMongo(s *ast.SelectStatement) (string, error) {
+	if s.From == nil || len(s.From.Tables) != 1 {
+		return "", dt.mongoUnsupported(s, "SELECT must read exactly one table (no joins)")
+	}
+	if _, ok := s.From.Tables[0].(*ast.TableName); !ok {
+		return "", dt.mongoUnsupported(s, "SELECT must read exactly one table (no joins)")
+	}
+	if len(s.GroupBy) > 0 || s.Having != nil || s.Union != nil || s.Into != nil || s.Distinct {
+		return "", dt.mongoUnsupported(s, "GROUP BY, HAVING, UNION, DISTINCT and SELECT INTO need an aggregation pipeline")
+	}
+
+	filter, err := dt.mongoFilter(s.Where)
+	if err != nil {
+		return "", err
+	}
+	coll := dt.mongoCollection(dt.extractMainTable(s))
+
+	var out strings.Builder
+	if dt.emitOriginal() {
+		out.WriteString(fmt.Sprintf("// Original: %s\n", truncateSQL(s.String(), 100)))
+		out.WriteString(dt.indentStr())
+	}
+
+	assignments := dt.extractSelectAssignments(s)
+	if len(assignments) > 0 {
+		if len(s.Columns) == 1 && isCountStar(s.Columns[0].Expression) {
+			return dt.mongoCount(&out, coll, filter, assignments[0].varName)
+		}
+		return dt.mongoFindOne(&out, s, coll, filter)
+	}
+	return dt.mongoFind(&out, s, coll, filter)
+}
+
+func isCountStar(expr ast.Expression) bool {
+	fc, ok := expr.(*ast.FunctionCall)
+	if !ok || !strings.EqualFold(fc.Function.String(), "COUNT") || len(fc.Arguments) != 1 {
+		return false
+	}
+	return fc.Arguments[0].String() == "*"
+}
+
+// mongoCount handles SELECT @n = COUNT(*).
+func (dt *dmlTranspiler) mongoCount(out *strings.Builder, coll, filter, varName string) (string, error) {
+	goType := "int64"
+	if ti := dt.symbols.lookup(varName); ti != nil && ti.goType != "" {
+		goType = ti.goType
+	}
+	value := "n"
+	if goType != "int64" {
+		value = fmt.Sprintf("%s(n)", goType)
+	}
+	out.WriteString(fmt.Sprintf("if n, err := %s.CountDocuments(ctx, %s); err != nil {\n", coll, filter))
+	out.WriteString(dt.indentStr() + "\t" + dt.buildErrorReturn() + "\n")
+	out.WriteString(dt.indentStr() + "} else {\n")
+	out.WriteString(fmt.Sprintf("%s\t%s = %s\n", dt.indentStr(), varName, value))
+	out.WriteString(dt.indentStr() + "}")
+	return out.String(), nil
+}
+
+// mongoFindOne handles SELECT @a = ColA, @b = ColB FROM T WHERE ...
+// As in T-SQL, the variables keep their values when nothing matches.
+func (dt *dmlTranspiler) mongoFindOne(out *strings.Builder, s *ast.SelectStatement, coll, filter string) (string, error) {
+	var fields []mongoField
+	var assigns []string
+	projection := map[string]bool{}
+	var projOrder []string
+	for i, col := range s.Columns {
+		field, err := exprColumnName(col.Expression)
+		if err != nil {
+			return "", dt.mongoUnsupported(s, "only plain columns can be assigned to variables")
+		}
+		varName := goIdentifier(strings.TrimPrefix(col.Variable.Name, "@"))
+		goType := "any"
+		if ti := dt.symbols.lookup(varName); ti != nil && ti.goType != "" {
+			goType = ti.goType
+		}
+		structField := fmt.Sprintf("F%d", i)
+		fields = append(fields, mongoField{structField, goType, field})
+		assigns = append(assigns, fmt.Sprintf("%s = doc.%s", varName, structField))
+		if !projection[field] {
+			projection[field] = true
+			projOrder = append(projOrder, field)
+		}
+	}
+
+	opts := fmt.Sprintf("options.FindOne().SetProjection(%s)", mongoProjection(projOrder))
+	if sort := dt.mongoSort(s.OrderBy); sort != "" {
+		opts += ".SetSort(" + sort + ")"
+	}
+	dt.imports[mongoImport] = true
+	dt.imports[mongoOptionsImport] = true
+
+	ind := dt.indentStr()
+	out.WriteString("{\n")
+	writeMongoDocStruct(out, ind+"\t", fields)
+	out.WriteString(fmt.Sprintf("%s\tif err := %s.FindOne(ctx, %s, %s).Decode(&doc); err == nil {\n", ind, coll, filter, opts))
+	for _, a := range assigns {
+		out.WriteString(ind + "\t\t" + a + "\n")
+	}
+	out.WriteString(ind + "\t} else if err != mongo.ErrNoDocuments {\n")
+	out.WriteString(ind + "\t\t" + dt.buildErrorReturn() + "\n")
+	out.WriteString(ind + "\t}\n")
+	out.WriteString(ind + "}")
+	return out.String(), nil
+}
+
+// mongoFind handles a SELECT returning rows: each document is decoded into
+// the same per-column variables the SQL backend scans into.
+func (dt *dmlTranspiler) mongoFind(out *strings.Builder, s *ast.SelectStatement, coll, filter string) (string, error) {
+	columns := dt.extractSelectColumns(s)
+	var fields []mongoField
+	var names, projOrder []string
+	var contractCols []ContractColumn
+	for i, col := range columns {
+		if col.name == "*" {
+			return "", dt.mongoUnsupported(s, "SELECT * needs explicit columns")
+		}
+		field, err := exprColumnName(col.expression)
+		if err != nil {
+			return "", dt.mongoUnsupported(s, "only plain columns can be selected")
+		}
+		goType := "any"
+		if ti := dt.inferType(col.expression); ti != nil && ti.goType != "" {
+			goType = ti.goType
+		}
+		name := goIdentifier(col.name)
+		names = append(names, name)
+		fields = append(fields, mongoField{fmt.Sprintf("F%d", i), goType, field})
+		projOrder = append(projOrder, field)
+		contractCols = append(contractCols, ContractColumn{Name: col.name, GoType: goType})
+	}
+	dt.recordResultSet(contractCols)
+
+	opts := fmt.Sprintf("options.Find().SetProjection(%s)", mongoProjection(projOrder))
+	if sort := dt.mongoSort(s.OrderBy); sort != "" {
+		opts += ".SetSort(" + sort + ")"
+	}
+	if s.Top != nil {
+		if lit, ok := s.Top.Count.(*ast.IntegerLiteral); ok && !s.Top.Percent {
+			opts += fmt.Sprintf(".SetLimit(%d)", lit.Value)
+		} else if v, ok := s.Top.Count.(*ast.Variable); ok && !s.Top.Percent {
+			opts += fmt.Sprintf(".SetLimit(int64(%s))", dt.exprToGoValue(v))
+		} else {
+			return "", dt.mongoUnsupported(s, "TOP must be an integer or variable")
+		}
+	}
+	dt.imports[mongoOptionsImport] = true
+
+	ind := dt.indentStr()
+	out.WriteString("// SELECT query\n")
+	out.WriteString(ind + "{\n")
+	out.WriteString(fmt.Sprintf("%s\tcursor, err := %s.Find(ctx, %s, %s)\n", ind, coll, filter, opts))
+	out.WriteString(ind + "\tif err != nil {\n")
+	out.WriteString(ind + "\t\t" + dt.buildErrorReturn() + "\n")
+	out.WriteString(ind + "\t}\n")
+	out.WriteString(ind + "\tdefer cursor.Close(ctx)\n")
+	out.WriteString(ind + "\tfor cursor.Next(ctx) {\n")
+	writeMongoDocStruct(out, ind+"\t\t", fields)
+	out.WriteString(ind + "\t\tif err := cursor.Decode(&doc); err != nil {\n")
+	out.WriteString(ind + "\t\t\t" + dt.buildErrorReturn() + "\n")
+	out.WriteString(ind + "\t\t}\n")
+	for i, name := range names {
+		out.WriteString(fmt.Sprintf("%s\t\t%s := doc.F%d\n", ind, name, i))
+		out.WriteString(fmt.Sprintf("%s\t\t_ = %s\n", ind, name))
+	}
+	out.WriteString(ind + "\t}\n")
+	out.WriteString(ind + "\tif err := cursor.Err(); err != nil {\n")
+	out.WriteString(ind + "\t\t" + dt.buildErrorReturn() + "\n")
+	out.WriteString(ind + "\t}\n")
+	out.WriteString(ind + "}")
+	return out.String(), nil
+}
+
+// mongoField is a field of the struct a document is decoded into.
+type mongoField struct {
+	name, goType, bsonName string
+}
+
+// writeMongoDocStruct declares "var doc struct{...}" with gofmt alignment.
+func writeMongoDocStruct(out *strings.Builder, ind string, fields []mongoField) {
+	width := 0
+	for _, f := range fields {
+		if len(f.goType) > width {
+			width = len(f.goType)
+		}
+	}
+	out.WriteString(ind + "var doc struct {\n")
+	for _, f := range fields {
+		out.WriteString(fmt.Sprintf("%s\t%s %-*s `bson:%q`\n", ind, f.name, width, f.goType, f.bsonName))
+	}
+	out.WriteString(ind + "}\n")
+}
+
+func mongoProjection(fields []string) string {
+	var parts []string
+	for _, f := range fields {
+		parts = append(parts, fmt.Sprintf("%q: 1", f))
+	}
+	return "bson.M{" + strings.Join(parts, ", ") + "}"
+}
+
+func (dt *dmlTranspiler) mongoSort(items []*ast.OrderByItem) string {
+	if len(items) == 0 {
+		return ""
+	}
+	var parts []string
+	for _, item := range items {
+		field, err := exprColumnName(item.Expression)
+		if err != nil {
+			continue
+		}
+		dir := 1
+		if item.Descending {
+			dir = -1
+		}
+		parts = append(parts, fmt.Sprintf("{Key: %q, Value: %d}", field, dir))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "bson.D{" + strings.Join(parts, ", ") + "}"
+}
+
+// ---------------------------------------------------------------------------
+// INSERT / UPDATE / DELETE
+// ---------------------------------------------------------------------------
+
+func (dt *dmlTranspiler) transpileInsertMongo(s *ast.InsertStatement) (string, error) {
+	if dt.inTransaction {
+		// Only reachable with --table-backend; whole-file mongo rejects BEGIN TRAN
+		return "", dt.mongoUnsupported(s, "writes can't join the surrounding SQL transaction")
+	}
+	if s.Select != nil || s.DefaultValues || len(s.Values) == 0 {
+		return "", dt.mongoUnsupported(s, "only INSERT ... VALUES is supported")
+	}
+	if len(s.Columns) == 0 {
+		return "", dt.mongoUnsupported(s, "INSERT needs an explicit column list")
+	}
+
+	var docs []string
+	for _, row := range s.Values {
+		if len(row) != len(s.Columns) {
+			return "", dt.mongoUnsupported(s, "column and value counts differ")
+		}
+		var parts []string
+		for i, col := range s.Columns {
+			value, err := dt.mongoValue(row[i])
+			if err != nil {
+				return "", dt.mongoUnsupported(s, err.Error())
+			}
+			parts = append(parts, fmt.Sprintf("%q: %s", col.Value, value))
+		}
+		docs = append(docs, "bson.M{"+strings.Join(parts, ", ")+"}")
+	}
+	dt.imports[mongoBSONImport] = true
+
+	coll := dt.mongoCollection(dt.extractInsertTable(s))
+	var call string
+	var count string
+	if len(docs) == 1 {
+		call = fmt.Sprintf("%s.InsertOne(ctx, %s)", coll, docs[0])
+		count = "1"
+	} else {
+		call = fmt.Sprintf("%s.InsertMany(ctx, []any{%s})", coll, strings.Join(docs, ", "))
+		count = "int32(len(result.InsertedIDs))"
+	}
+	return dt.mongoWrite(s, call, count)
+}
+
+func (dt *dmlTranspiler) transpileUpdateMongo(s *ast.UpdateStatement) (string, error) {
+	if dt.inTransaction {
+		// Only reachable with --table-backend; whole-file mongo rejects BEGIN TRAN
+		return "", dt.mongoUnsupported(s, "writes can't join the surrounding SQL transaction")
+	}
+	if s.From != nil || s.Top != nil || s.Output != nil || s.CurrentOfCursor != nil {
+		return "", dt.mongoUnsupported(s, "UPDATE with FROM, TOP, OUTPUT or CURRENT OF is not supported")
+	}
+	filter, err := dt.mongoFilter(s.Where)
+	if err != nil {
+		return "", err
+	}
+
+	ops := map[string][]string{}
+	var opOrder []string
+	add := func(op, field, value string) {
+		if _, ok := ops[op]; !ok {
+			opOrder = append(opOrder, op)
+		}
+		ops[op] = append(ops[op], fmt.Sprintf("%q: %s", field, value))
+	}
+	for _, set := range s.SetClauses {
+		if set.Column == nil || set.IsMethodCall {
+			return "", dt.mongoUnsupported(s, "only column assignments are supported in SET")
+		}
+		field := set.Column.Parts[len(set.Column.Parts)-1].Value
+		op, operand := set.Operator, set.Value
+		// SET Col = Col + x is an increment
+		if op == "" || op == "=" {
+			if infix, ok := set.Value.(*ast.InfixExpression); ok && (infix.Operator == "+" || infix.Operator == "-" || infix.Operator == "*") {
+				if left, err := exprColumnName(infix.Left); err == nil && strings.EqualFold(left, field) {
+					op, operand = infix.Operator+"=", infix.Right
+				}
+			}
+		}
+		value, err := dt.mongoValue(operand)
+		if err != nil {
+			return "", dt.mongoUnsupported(s, err.Error())
+		}
+		switch op {
+		case "", "=":
+			add("$set", field, value)
+		case "+=":
+			add("$inc", field, value)
+		case "-=":
+			add("$inc", field, "-"+mongoParen(value))
+		case "*=":
+			add("$mul", field, value)
+		default:
+			return "", dt.mongoUnsupported(s, "SET operator "+op+" is not supported")
+		}
+	}
+
+	var update []string
+	for _, op := range opOrder {
+		update = append(update, fmt.Sprintf("%q: bson.M{%s}", op, strings.Join(ops[op], ", ")))
+	}
+	dt.imports[mongoBSONImport] = true
+
+	call := fmt.Sprintf("%s.UpdateMany(ctx, %s, bson.M{%s})", dt.mongoCollection(dt.extractUpdateTable(s)), filter, strings.Join(update, ", "))
+	return dt.mongoWrite(s, call, "int32(result.MatchedCount)")
+}
+
+func (dt *dmlTranspiler) transpileDeleteMongo(s *ast.DeleteStatement) (string, error) {
+	if dt.inTransaction {
+		// Only reachable with --table-backend; whole-file mongo rejects BEGIN TRAN
+		return "", dt.mongoUnsupported(s, "writes can't join the surrounding SQL transaction")
+	}
+	if s.From != nil || s.Top != nil || s.Output != nil || s.CurrentOfCursor != nil {
+		return "", dt.mongoUnsupported(s, "DELETE with FROM, TOP, OUTPUT or CURRENT OF is not supported")
+	}
+	filter, err := dt.mongoFilter(s.Where)
+	if err != nil {
+		return "", err
+	}
+	call := fmt.Sprintf("%s.DeleteMany(ctx, %s)", dt.mongoCollection(dt.extractDeleteTable(s)), filter)
+	return dt.mongoWrite(s, call, "int32(result.DeletedCount)")
+}
+
+// mongoWrite emits a write call, capturing @@ROWCOUNT from the result when
+// the procedure uses it.
+func (dt *dmlTranspiler) mongoWrite(stmt ast.Node, call, rowCount string) (string, error) {
+	var out strings.Builder
+	if dt.emitOriginal() {
+		out.WriteString(fmt.Sprintf("// Original: %s\n", truncateSQL(stmt.String(), 100)))
+		out.WriteString(dt.indentStr())
+	}
+	result := "_"
+	if dt.usesRowCount && strings.Contains(rowCount, "result") {
+		result = "result"
+	}
+	ind := dt.indentStr()
+	out.WriteString(fmt.Sprintf("if %s, err := %s; err != nil {\n", result, call))
+	out.WriteString(ind + "\t" + dt.buildErrorReturn() + "\n")
+	if dt.usesRowCount {
+		out.WriteString(ind + "} else {\n")
+		out.WriteString(fmt.Sprintf("%s\trowsAffected = %s\n", ind, rowCount))
+	}
+	out.WriteString(ind + "}")
+	return out.String(), nil
+}
+
+// ---------------------------------------------------------------------------
+// Filters
+// ---------------------------------------------------------------------------
+
+// mongoFilter converts a WHERE clause to a bson filter expression.
+func (dt *dmlTranspiler) mongoFilter(where ast.Expression) (string, error) {
+	dt.imports[mongoBSONImport] = true
+	if where == nil {
+		return "bson.M{}", nil
+	}
+	conds, err := dt.mongoConjuncts(where)
+	if err != nil {
+		return "", dt.mongoUnsupported(where, err.Error())
+	}
+	return mongoAnd(conds), nil
+}
+
+// mongoCond is one filter condition, either on a single field
+// ("Status": "x") or a top-level operator ("$or": bson.A{...}).
+type mongoCond struct {
+	key   string
+	value string
+}
+
+func mongoAnd(conds []mongoCond) string {
+	seen := map[string]bool{}
+	for _, c := range conds {
+		if seen[c.key] {
+			// Repeated keys can't share one bson.M
+			var parts []string
+			for _, c := range conds {
+				parts = append(parts, mongoAnd([]mongoCond{c}))
+			}
+			return "bson.M{\"$and\": bson.A{" + strings.Join(parts, ", ") + "}}"
+		}
+		seen[c.key] = true
+	}
+	var parts []string
+	for _, c := range conds {
+		parts = append(parts, fmt.Sprintf("%q: %s", c.key, c.value))
+	}
+	return "bson.M{" + strings.Join(parts, ", ") + "}"
+}
+
+func (dt *dmlTranspiler) mongoConjuncts(expr ast.Expression) ([]mongoCond, error) {
+	if infix, ok := expr.(*ast.InfixExpression); ok && strings.EqualFold(infix.Operator, "AND") {
+		left, err := dt.mongoConjuncts(infix.Left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := dt.mongoConjuncts(infix.Right)
+		if err != nil {
+			return nil, err
+		}
+		return append(left, right...), nil
+	}
+	cond, err := dt.mongoCondition(expr)
+	if err != nil {
+		return nil, err
+	}
+	return []mongoCond{cond}, nil
+}
+
+var mongoComparison = map[string]string{
+	"<>": "$ne", "!=": "$ne", ">": "$gt", ">=": "$gte", "<": "$lt", "<=": "$lte",
+}
+
+func (dt *dmlTranspiler) mongoCondition(expr ast.Expression) (mongoCond, error) {
+	switch e := expr.(type) {
+	case *ast.InfixExpression:
+		op := strings.ToUpper(e.Operator)
+		if op == "OR" {
+			var branches []string
+			for _, side := range []ast.Expression{e.Left, e.Right} {
+				conds, err := dt.mongoConjuncts(side)
+				if err != nil {
+					return mongoCond{}, err
+				}
+				// Flatten nested ORs into one $or
+				if len(conds) == 1 && conds[0].key == "$or" {
+					branches = append(branches, strings.TrimSuffix(strings.TrimPrefix(conds[0].value, "bson.A{"), "}"))
+					continue
+				}
+				branches = append(branches, mongoAnd(conds))
+			}
+			return mongoCond{"$or", "bson.A{" + strings.Join(branches, ", ") + "}"}, nil
+		}
+		field, value, flipped, err := dt.mongoOperands(e.Left, e.Right)
+		if err != nil {
+			return mongoCond{}, err
+		}
+		if op == "=" {
+			return mongoCond{field, value}, nil
+		}
+		mop, ok := mongoComparison[op]
+		if !ok {
+			return mongoCond{}, fmt.Errorf("operator %s is not supported in filters", e.Operator)
+		}
+		if flipped {
+			mop = map[string]string{"$gt": "$lt", "$gte": "$lte", "$lt": "$gt", "$lte": "$gte", "$ne": "$ne"}[mop]
+		}
+		return mongoCond{field, fmt.Sprintf("bson.M{%q: %s}", mop, value)}, nil
+
+	case *ast.PrefixExpression:
+		if strings.EqualFold(e.Operator, "NOT") {
+			conds, err := dt.mongoConjuncts(e.Right)
+			if err != nil {
+				return mongoCond{}, err
+			}
+			return mongoCond{"$nor", "bson.A{" + mongoAnd(conds) + "}"}, nil
+		}
+
+	case *ast.IsNullExpression:
+		field, err := exprColumnName(e.Expr)
+		if err != nil {
+			return mongoCond{}, err
+		}
+		if e.Not {
+			return mongoCond{field, `bson.M{"$ne": nil}`}, nil
+		}
+		return mongoCond{field, "nil"}, nil
+
+	case *ast.BetweenExpression:
+		field, err := exprColumnName(e.Expr)
+		if err != nil {
+			return mongoCond{}, err
+		}
+		low, err := dt.mongoValue(e.Low)
+		if err != nil {
+			return mongoCond{}, err
+		}
+		high, err := dt.mongoValue(e.High)
+		if err != nil {
+			return mongoCond{}, err
+		}
+		if e.Not {
+			return mongoCond{"$or", fmt.Sprintf("bson.A{bson.M{%q: bson.M{\"$lt\": %s}}, bson.M{%q: bson.M{\"$gt\": %s}}}", field, low, field, high)}, nil
+		}
+		return mongoCond{field, fmt.Sprintf("bson.M{\"$gte\": %s, \"$lte\": %s}", low, high)}, nil
+
+	case *ast.InExpression:
+		if e.Subquery != nil {
+			return mongoCond{}, fmt.Errorf("IN (subquery) is not supported")
+		}
+		field, err := exprColumnName(e.Expr)
+		if err != nil {
+			return mongoCond{}, err
+		}
+		var values []string
+		for _, v := range e.Values {
+			value, err := dt.mongoValue(v)
+			if err != nil {
+				return mongoCond{}, err
+			}
+			values = append(values, value)
+		}
+		op := "$in"
+		if e.Not {
+			op = "$nin"
+		}
+		return mongoCond{field, fmt.Sprintf("bson.M{%q: bson.A{%s}}", op, strings.Join(values, ", "))}, nil
+
+	case *ast.LikeExpression:
+		field, err := exprColumnName(e.Expr)
+		if err != nil {
+			return mongoCond{}, err
+		}
+		pattern, ok := e.Pattern.(*ast.StringLiteral)
+		if !ok || e.Escape != nil {
+			return mongoCond{}, fmt.Errorf("LIKE needs a literal pattern without ESCAPE")
+		}
+		regex := fmt.Sprintf("bson.M{\"$regex\": %q}", likeToRegex(pattern.Value))
+		if e.Not {
+			return mongoCond{field, fmt.Sprintf("bson.M{\"$not\": bson.M{\"$regex\": %q}}", likeToRegex(pattern.Value))}, nil
+		}
+		return mongoCond{field, regex}, nil
+	}
+	return mongoCond{}, fmt.Errorf("condition %s is not supported in filters", expr.String())
+}
+
+// mongoOperands splits a comparison into field and value, accepting the
+// column on either side. flipped reports that the column was on the right.
+func (dt *dmlTranspiler) mongoOperands(left, right ast.Expression) (field, value string, flipped bool, err error) {
+	if f, ferr := exprColumnName(left); ferr == nil {
+		value, err = dt.mongoValue(right)
+		return f, value, false, err
+	}
+	if f, ferr := exprColumnName(right); ferr == nil {
+		value, err = dt.mongoValue(left)
+		return f, value, true, err
+	}
+	return "", "", false, fmt.Errorf("comparison %s %s needs a column on one side", left, right)
+}
+
+// exprColumnName returns the column a column reference names, without
+// any table qualifier.
+func exprColumnName(expr ast.Expression) (string, error) {
+	switch e := expr.(type) {
+	case *ast.Identifier:
+		return e.Value, nil
+	case *ast.QualifiedIdentifier:
+		if len(e.Parts) > 0 {
+			return e.Parts[len(e.Parts)-1].Value, nil
+		}
+	}
+	return "", fmt.Errorf("%s is not a column", expr)
+}
+
+// mongoValue converts a value expression to Go. Values computed from other
+// columns can't be evaluated client-side, so they are rejected.
+func (dt *dmlTranspiler) mongoValue(expr ast.Expression) (string, error) {
+	if referencesColumn(expr) {
+		return "", fmt.Errorf("value %s references a column", expr)
+	}
+	return dt.exprToGoValue(expr), nil
+}
+
+func referencesColumn(expr ast.Expression) bool {
+	switch e := expr.(type) {
+	case *ast.Identifier, *ast.QualifiedIdentifier:
+		return true
+	case *ast.InfixExpression:
+		return referencesColumn(e.Left) || referencesColumn(e.Right)
+	case *ast.PrefixExpression:
+		return referencesColumn(e.Right)
+	case *ast.FunctionCall:
+		for _, arg := range e.Arguments {
+			if referencesColumn(arg) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+var regexMeta = regexp.MustCompile(`[.*+?^${}()|\[\]\\]`)
+
+// likeToRegex converts a LIKE pattern to an anchored regular expression.
+// T-SQL character classes ([a-c], [^x]) carry over as regex classes.
+func likeToRegex(pattern string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	runes := []rune(pattern)
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; r {
+		case '%':
+			b.WriteString(".*")
+		case '_':
+			b.WriteString(".")
+		case '[':
+			end := i + 1
+			for end < len(runes) && runes[end] != ']' {
+				end++
+			}
+			if end == len(runes) {
+				b.WriteString(`\[`)
+				continue
+			}
+			b.WriteString("[" + strings.ReplaceAll(string(runes[i+1:end]), `\`, `\\`) + "]")
+			i = end
+		default:
+			b.WriteString(regexMeta.ReplaceAllString(string(r), `\$0`))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+func mongoParen(value string) string {
+	if strings.ContainsAny(value, " +-*/") {
+		return "(" + value + ")"
+	}
+	return value
+}
@@ -0,0 +1,328 @@
+package transpiler
+
+import (
+	"fmt"
+	"go/token"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Naming
+//
+// Go names come from T-SQL identifiers by splitting them into words and
+// casing each: usp_GetCustomer becomes GetCustomer, CUSTOMERNAME becomes
+// CustomerName by way of knownWords. The word list is English, so a
+// schema in another language splits badly (PEDIDOCLIENTE stays
+// Pedidocliente), and some names are better not derived at all.
+//
+// A Namer decides the names, and SetNamer installs one for the package. A
+// naming config (--naming-config) builds one on top of the default rules:
+//
+//	# naming.yaml
+//	words:
+//	  - pedido
+//	  - cliente
+//	acronyms:
+//	  - ID
+//	  - URL
+//	overrides:
+//	  tbl_Cli: Customer
+//
+// It is read as the subset of YAML the config files share: top-level keys,
+// and indented entries under them, with or without the "- " of a list item.
+//
+// Words and acronyms split identifiers whose letters are all one case,
+// before the built-in words are tried, so PEDIDOCLIENTE becomes
+// PedidoCliente. Acronyms
+// are written as given (ClienteID, apiURL) except at the start of an
+// unexported name (idCliente). Overrides are Go names for identifiers,
+// matched without regard to case; a table's is matched against its
+// singular, as that's what method names are built from.
+
+// Namer turns T-SQL identifiers into Go names.
+type Namer interface {
+	// Exported names procedures, functions, table types and fields.
+	Exported(name string) string
+	// Unexported names parameters and variables.
+	Unexported(name string) string
+	// Entity names tables in method and type names (GetCustomerByID),
+	// and the blocks and constants of a constants file.
+	Entity(name string) string
+}
+
+// defaultNamer is the built-in naming, in types.go and dml.go.
+type defaultNamer struct{}
+
+func (defaultNamer) Exported(name string) string   { return exportedIdentifier(name) }
+func (defaultNamer) Unexported(name string) string { return unexportedIdentifier(name) }
+func (defaultNamer) Entity(name string) string     { return pascalCase(name) }
+
+var (
+	namerMu sync.RWMutex
+	namer   Namer = defaultNamer{}
+)
+
+// SetNamer sets the Namer for every transpilation in the package, nil
+// restoring the default. Set it before transpiling, not during.
+func SetNamer(n Namer) {
+	namerMu.Lock()
+	defer namerMu.Unlock()
+	if n == nil {
+		n = defaultNamer{}
+	}
+	namer = n
+}
+
+func currentNamer() Namer {
+	namerMu.RLock()
+	defer namerMu.RUnlock()
+	return namer
+}
+
+// goExportedIdentifier converts a T-SQL identifier to an exported Go identifier (PascalCase).
+// Use for procedure names and other public API elements.
+// Examples:
+//   - "calculate_total" -> "CalculateTotal"
+//   - "CALCULATE_TOTAL" -> "CalculateTotal"
+//   - "calculateTotal"  -> "CalculateTotal"
+func goExportedIdentifier(name string) string {
+	return currentNamer().Exported(name)
+}
+
+// goUnexportedIdentifier converts a T-SQL identifier to an unexported Go identifier (camelCase).
+// Use for parameters, local variables, and other internal elements.
+// Examples:
+//   - "calculate_total" -> "calculateTotal"
+//   - "CALCULATE_TOTAL" -> "calculateTotal"
+//   - "CalculateTotal"  -> "calculateTotal"
+func goUnexportedIdentifier(name string) string {
+	return currentNamer().Unexported(name)
+}
+
+// toPascalCase converts a table or other entity name to PascalCase.
+func toPascalCase(s string) string {
+	return currentNamer().Entity(s)
+}
+
+// NamingConfig is a parsed naming config.
+type NamingConfig struct {
+	Words     []string          // Lowercase, splitting identifiers before knownWords
+	Acronyms  []string          // As written in Go names: ID, URL
+	Overrides map[string]string // Lowercase T-SQL identifier to Go name
+}
+
+var (
+	namingWord    = regexp.MustCompile(`^\pL+$`)
+	namingAcronym = regexp.MustCompile(`^\p{Lu}[\pL\pN]*$`)
+)
+
+// ParseNamingConfig parses a naming config: lines "words:", "acronyms:"
+// and "overrides:" starting a section, and indented lines in it, a word,
+// an acronym, or "identifier: GoName", each optionally a list item
+// ("- pedido"). Lines starting with # are comments.
+func ParseNamingConfig(source string) (NamingConfig, error) {
+	config := NamingConfig{Overrides: map[string]string{}}
+	section := ""
+	for n, line := range strings.Split(source, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if line[0] != ' ' && line[0] != '\t' {
+			switch trimmed {
+			case "words:", "acronyms:", "overrides:":
+				section = strings.TrimSuffix(trimmed, ":")
+			default:
+				return NamingConfig{}, fmt.Errorf("line %d: expected \"words:\", \"acronyms:\" or \"overrides:\", got %q", n+1, trimmed)
+			}
+			continue
+		}
+		trimmed = listItem(trimmed)
+		switch section {
+		case "":
+			return NamingConfig{}, fmt.Errorf("line %d: %s is not in a section", n+1, trimmed)
+		case "words":
+			if !namingWord.MatchString(trimmed) {
+				return NamingConfig{}, fmt.Errorf("line %d: word %q is not all letters", n+1, trimmed)
+			}
+			config.Words = append(config.Words, strings.ToLower(trimmed))
+		case "acronyms":
+			if !namingAcronym.MatchString(trimmed) {
+				return NamingConfig{}, fmt.Errorf("line %d: acronym %q is not a capital followed by letters and digits", n+1, trimmed)
+			}
+			config.Acronyms = append(config.Acronyms, trimmed)
+		case "overrides":
+			name, goName, ok := strings.Cut(trimmed, ":")
+			name, goName = strings.TrimSpace(name), strings.TrimSpace(goName)
+			if !ok || name == "" || goName == "" {
+				return NamingConfig{}, fmt.Errorf("line %d: expected \"identifier: GoName\", got %q", n+1, trimmed)
+			}
+			if !token.IsIdentifier(goName) || !token.IsExported(goName) {
+				return NamingConfig{}, fmt.Errorf("line %d: %s: %s is not an exported Go name", n+1, name, goName)
+			}
+			key := strings.ToLower(name)
+			if _, dup := config.Overrides[key]; dup {
+				return NamingConfig{}, fmt.Errorf("line %d: %s is overridden twice", n+1, name)
+			}
+			config.Overrides[key] = goName
+		}
+	}
+	return config, nil
+}
+
+// listItem returns the item of a YAML list line, "- item", or line as it is.
+func listItem(line string) string {
+	if item, ok := strings.CutPrefix(line, "- "); ok {
+		return strings.TrimSpace(item)
+	}
+	return line
+}
+
+// NewNamer returns a Namer applying config to the default naming.
+func NewNamer(config NamingConfig) Namer {
+	n := &configNamer{
+		custom:    map[string]bool{},
+		acronyms:  map[string]string{},
+		overrides: config.Overrides,
+	}
+	// Acronyms split identifiers too: URLDESTINO is URL and destino
+	for _, a := range config.Acronyms {
+		n.acronyms[strings.ToLower(a)] = a
+		n.custom[strings.ToLower(a)] = true
+	}
+	for _, w := range config.Words {
+		n.custom[w] = true
+	}
+	for w := range n.custom {
+		n.words = append(n.words, w)
+	}
+	// Longest first, as knownWords, for greedy matching
+	sort.Slice(n.words, func(i, j int) bool {
+		if len(n.words[i]) != len(n.words[j]) {
+			return len(n.words[i]) > len(n.words[j])
+		}
+		return n.words[i] < n.words[j]
+	})
+	n.words = append(n.words, knownWords...)
+	return n
+}
+
+type configNamer struct {
+	words     []string        // The config's words and acronyms, then knownWords
+	custom    map[string]bool // The config's words and acronyms
+	acronyms  map[string]string
+	overrides map[string]string
+}
+
+func (n *configNamer) Exported(name string) string {
+	if goName, ok := n.override(name); ok {
+		return goName
+	}
+	return n.casing(exportedIdentifier(n.split(name)), true)
+}
+
+func (n *configNamer) Unexported(name string) string {
+	if goName, ok := n.override(name); ok {
+		return unexportedOverride(goName)
+	}
+	return n.casing(unexportedIdentifier(n.split(name)), false)
+}
+
+func (n *configNamer) Entity(name string) string {
+	if goName, ok := n.override(name); ok {
+		return goName
+	}
+	return n.casing(pascalCase(n.split(name)), true)
+}
+
+// override returns the Go name config gives name, if any.
+func (n *configNamer) override(name string) (string, bool) {
+	goName, ok := n.overrides[strings.ToLower(strings.Trim(name, "@#[]"))]
+	return goName, ok
+}
+
+// split puts underscores between the words of the parts of name whose
+// letters are all one case, where one of the words is the config's, so the
+// default naming sees them as words.
+func (n *configNamer) split(name string) string {
+	if len(n.custom) == 0 {
+		return name
+	}
+	// The default naming drops these anyway
+	parts := strings.Split(strings.Trim(name, "@#[]"), "_")
+	for i, part := range parts {
+		if part != strings.ToLower(part) && part != strings.ToUpper(part) {
+			continue
+		}
+		words := splitWords(strings.ToLower(part), n.words)
+		for _, w := range words {
+			if n.custom[w] {
+				if part == strings.ToUpper(part) {
+					parts[i] = strings.ToUpper(strings.Join(words, "_"))
+				} else {
+					parts[i] = strings.Join(words, "_")
+				}
+				break
+			}
+		}
+	}
+	return strings.Join(parts, "_")
+}
+
+// casing writes the acronyms among the words of goName as the config
+// does, leaving the first word of an unexported name in lower case.
+func (n *configNamer) casing(goName string, exported bool) string {
+	if len(n.acronyms) == 0 {
+		return goName
+	}
+	var out strings.Builder
+	for i, word := range splitOnCaseTransition(goName) {
+		if a, ok := n.acronyms[strings.ToLower(word)]; ok && (exported || i > 0) {
+			word = a
+		}
+		out.WriteString(word)
+	}
+	return out.String()
+}
+
+// splitWords splits s into words, trying each in order at each position.
+// It returns nil unless the words cover s.
+func splitWords(s string, words []string) []string {
+	var out []string
+	for s != "" {
+		matched := false
+		for _, w := range words {
+			if strings.HasPrefix(s, w) {
+				out = append(out, w)
+				s = s[len(w):]
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return nil
+		}
+	}
+	return out
+}
+
+// unexportedOverride lowers the leading capitals of an override:
+// Customer, URLPath and ID become customer, urlPath and id.
+func unexportedOverride(goName string) string {
+	runes := []rune(goName)
+	upper := 0
+	for upper < len(runes) && unicode.IsUpper(runes[upper]) {
+		upper++
+	}
+	// The last of a run of capitals starts the next word
+	if upper > 1 && upper < len(runes) && unicode.IsLower(runes[upper]) {
+		upper--
+	}
+	for i := 0; i < upper; i++ {
+		runes[i] = unicode.ToLower(runes[i])
+	}
+	return string(runes)
+}
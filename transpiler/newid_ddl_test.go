@@ -355,3 +355,198 @@ END
 		t.Errorf("Expected uuid.New().String() as default, got:\n%s", result)
 	}
 }
+
+// TestSequence_DbMode tests NEXT VALUE FOR, sp_sequence_get_range and
+// sequence defaults in each dialect
+func TestSequence_DbMode(t *testing.T) {
+	sql := `
+CREATE TABLE dbo.Orders (
+    OrderID BIGINT NOT NULL DEFAULT (NEXT VALUE FOR dbo.OrderNumbers),
+    Total INT
+)
+GO
+CREATE PROCEDURE AddOrder
+    @Total INT
+AS
+BEGIN
+    DECLARE @ID BIGINT = NEXT VALUE FOR dbo.OrderNumbers
+    INSERT INTO Orders (OrderID, Total) VALUES (NEXT VALUE FOR dbo.OrderNumbers, @Total)
+    INSERT INTO Orders (Total) VALUES (@Total)
+    DECLARE @First SQL_VARIANT, @Last BIGINT
+    EXEC sp_sequence_get_range @sequence_name = N'dbo.OrderNumbers', @range_size = 10,
+        @range_first_value = @First OUTPUT, @range_last_value = @Last OUTPUT
+    ALTER SEQUENCE dbo.OrderNumbers RESTART WITH 1;
+END
+`
+	tests := []struct {
+		dialect string
+		want    []string
+	}{
+		{"postgres", []string{
+			`if v, err := tsqlruntime.NextSequenceValue(ctx, r.db, "postgres", "dbo.OrderNumbers"); err != nil {`,
+			"OrderID BIGINT NOT NULL DEFAULT nextval('dbo.OrderNumbers')",
+			"VALUES (nextval('dbo.OrderNumbers'), $1)",
+			`"INSERT INTO Orders (Total) VALUES ($1)"`,
+			`if firstValue, lastValue, err := tsqlruntime.SequenceRange(ctx, r.db, "postgres", "dbo.OrderNumbers", 10); err != nil {`,
+			"first = firstValue",
+			"last = lastValue",
+			`tsqlruntime.RestartSequence(ctx, r.db, "postgres", "dbo.OrderNumbers", 1)`,
+		}},
+		{"mysql", []string{
+			`tsqlruntime.NextSequenceValue(ctx, r.db, "mysql", "dbo.OrderNumbers")`,
+			"OrderID BIGINT NOT NULL, Total INT",
+			"var nextValue2 int64\n\tif v, err := tsqlruntime.NextSequenceValue(ctx, r.db, \"mysql\", \"dbo.OrderNumbers\"); err != nil {\n\t\treturn err\n\t} else {\n\t\tnextValue2 = v\n\t}\n",
+			`"INSERT INTO Orders (Total, OrderID) VALUES (?, ?)", total, nextValue2)`,
+		}},
+		{"sqlite", []string{
+			`if v, err := tsqlruntime.NextSequenceValue(ctx, r.db, "sqlite", "dbo.OrderNumbers"); err != nil {`,
+			`"INSERT INTO Orders (OrderID, Total) VALUES (?, ?)", nextValue1, total)`,
+		}},
+	}
+	for _, tt := range tests {
+		config := DefaultDMLConfig()
+		config.SQLDialect = tt.dialect
+		result, err := TranspileWithDMLEx(sql, "main", config)
+		if err != nil {
+			t.Fatalf("%s: TranspileWithDMLEx failed: %v", tt.dialect, err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(result.Code, want) {
+				t.Errorf("%s: expected %q, got:\n%s", tt.dialect, want, result.Code)
+			}
+		}
+	}
+}
+
+// TestSequence_MultiRowInsert tests that every row of an INSERT gets its
+// own sequence value, fetched before the statement
+func TestSequence_MultiRowInsert(t *testing.T) {
+	sql := `
+CREATE PROCEDURE AddOrders
+    @Total INT
+AS
+BEGIN
+    INSERT INTO Orders (OrderID, Total) VALUES (NEXT VALUE FOR dbo.OrderNumbers, @Total), (NEXT VALUE FOR dbo.OrderNumbers, 5)
+END
+`
+	config := DefaultDMLConfig()
+	config.SQLDialect = "mysql"
+	code, err := TranspileWithDML(sql, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+	for _, want := range []string{
+		"var nextValue1 int64\n",
+		"var nextValue2 int64\n",
+		`"INSERT INTO Orders (OrderID, Total) VALUES (?, ?), (?, ?)", nextValue1, total, nextValue2, 5)`,
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("expected %q, got:\n%s", want, code)
+		}
+	}
+	if strings.Contains(code, "v, _ :=") {
+		t.Errorf("expected the sequence errors to be checked, got:\n%s", code)
+	}
+}
+
+// TestSequence_SetAndUUIDMode tests NEXT VALUE FOR in UPDATE ... SET and
+// SET assignments in each sequence mode
+func TestSequence_SetAndUUIDMode(t *testing.T) {
+	sql := `
+CREATE PROCEDURE RenumberOrder
+    @ID BIGINT
+AS
+BEGIN
+    DECLARE @Next BIGINT, @Ref NVARCHAR(36)
+    SET @Next = NEXT VALUE FOR dbo.OrderNumbers
+    SET @Ref = NEXT VALUE FOR dbo.OrderNumbers
+    UPDATE Orders SET OrderRef = NEXT VALUE FOR dbo.OrderNumbers WHERE OrderID = @ID
+END
+`
+	tests := []struct {
+		mode, dialect string
+		want          []string
+	}{
+		{"db", "postgres", []string{
+			`"UPDATE Orders SET OrderRef = nextval('dbo.OrderNumbers') WHERE OrderID = $1", id)`,
+		}},
+		{"db", "sqlserver", []string{
+			`"UPDATE Orders SET OrderRef = NEXT VALUE FOR dbo.OrderNumbers WHERE OrderID = @p1", id)`,
+		}},
+		{"db", "mysql", []string{
+			"// NEXT VALUE FOR dbo.OrderNumbers\n\tvar nextValue1 int64\n",
+			`"UPDATE Orders SET OrderRef = ? WHERE OrderID = ?", nextValue1, id)`,
+		}},
+		{"uuid", "postgres", []string{
+			"next = 0 // TODO: NEXT VALUE FOR dbo.OrderNumbers gives a UUID string in uuid sequence mode",
+			"ref = uuid.New().String()",
+			`"UPDATE Orders SET OrderRef = $1 WHERE OrderID = $2", uuid.New().String(), id)`,
+		}},
+		{"stub", "mysql", []string{
+			"next = 0 /* TODO: implement NEXT VALUE FOR dbo.OrderNumbers */",
+			`"UPDATE Orders SET OrderRef = ? WHERE OrderID = ?", 0 /* TODO: implement NEXT VALUE FOR dbo.OrderNumbers */, id)`,
+		}},
+	}
+	for _, tt := range tests {
+		config := DefaultDMLConfig()
+		config.SQLDialect = tt.dialect
+		config.SequenceMode = tt.mode
+		result, err := TranspileWithDMLEx(sql, "main", config)
+		if err != nil {
+			t.Fatalf("%s/%s: TranspileWithDMLEx failed: %v", tt.mode, tt.dialect, err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(result.Code, want) {
+				t.Errorf("%s/%s: expected %q, got:\n%s", tt.mode, tt.dialect, want, result.Code)
+			}
+		}
+		warned := false
+		for _, w := range result.Warnings {
+			if strings.Contains(w, "is a UUID with --sequence-mode=uuid, which next (int64) can't hold") {
+				warned = true
+			}
+		}
+		if warned != (tt.mode == "uuid") {
+			t.Errorf("%s/%s: unexpected warnings %v", tt.mode, tt.dialect, result.Warnings)
+		}
+	}
+}
+
+// TestSequence_ExtractDDL tests that sequence DDL is converted for the
+// dialect when extracted
+func TestSequence_ExtractDDL(t *testing.T) {
+	sql := `
+CREATE SEQUENCE dbo.OrderNumbers AS INT START WITH 1000 INCREMENT BY 5 CACHE 20;
+GO
+DROP SEQUENCE IF EXISTS dbo.Tickets;
+GO
+CREATE PROCEDURE Noop AS BEGIN SELECT 1 AS One END
+`
+	tests := map[string][]string{
+		"postgres": {
+			"CREATE SEQUENCE dbo.OrderNumbers AS integer START WITH 1000 INCREMENT BY 5 CACHE 20",
+			"DROP SEQUENCE IF EXISTS dbo.Tickets",
+		},
+		"sqlite": {
+			"CREATE TABLE OrderNumbers (next_value BIGINT NOT NULL, increment_by BIGINT NOT NULL);\nINSERT INTO OrderNumbers (next_value, increment_by) VALUES (1000, 5)",
+			"DROP TABLE IF EXISTS Tickets",
+		},
+	}
+	for dialect, want := range tests {
+		config := DefaultDMLConfig()
+		config.SQLDialect = dialect
+		config.ExtractDDL = "schema.sql"
+		result, err := TranspileWithDMLEx(sql, "main", config)
+		if err != nil {
+			t.Fatalf("%s: TranspileWithDMLEx failed: %v", dialect, err)
+		}
+		if len(result.ExtractedDDL) != len(want) {
+			t.Fatalf("%s: extracted %q", dialect, result.ExtractedDDL)
+		}
+		for i := range want {
+			if result.ExtractedDDL[i] != want[i] {
+				t.Errorf("%s: extracted %q, want %q", dialect, result.ExtractedDDL[i], want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package transpiler
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// Dirty reads
+//
+// Table hints don't carry over to other databases, so they are stripped
+// from queries (see stripTableHints). Most are about locking, but NOLOCK
+// and READUNCOMMITTED change what a query reads: without them it no longer
+// sees uncommitted data. DMLConfig.NoLockStrategy says what happens to
+// them:
+//
+//   - NoLockComment (the default) strips them, with a comment at the query
+//     and a warning for each table, so the change can be reviewed.
+//   - NoLockReadUncommitted runs SELECTs that had them in a READ
+//     UNCOMMITTED transaction of their own, on SQL Server and MySQL.
+//     PostgreSQL never reads uncommitted data and SQLite drivers don't
+//     offer the level, so there, inside transactions and for other
+//     statements it falls back to NoLockComment.
+//   - NoLockIgnore strips them silently.
+//
+// The transaction is read-only and rolled back when the procedure returns:
+//
+//	var nolockTx1 *sql.Tx
+//	if tx, err := r.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadUncommitted, ReadOnly: true}); err != nil {
+//		return err
+//	} else {
+//		nolockTx1 = tx
+//	}
+//	defer nolockTx1.Rollback()
+const (
+	NoLockComment         = "comment"
+	NoLockReadUncommitted = "read-uncommitted-tx"
+	NoLockIgnore          = "ignore"
+)
+
+// dirtyReadHint matches a hint list stripTableHints removes that has
+// NOLOCK or READUNCOMMITTED.
+var dirtyReadHint = regexp.MustCompile(`(?i)(?:\bWITH\s*)?\(\s*(?:` + tableHintPattern + `\s*,\s*)*\b(?P<hint>NOLOCK|READUNCOMMITTED)\b(?:\s*,\s*` + tableHintPattern + `)*\s*\)`)
+
+// dirtyRead is a table read with NOLOCK or READUNCOMMITTED.
+type dirtyRead struct {
+	table string
+	hint  string
+}
+
+// removeTableHints strips the table hints from sql, recording the tables
+// read with NOLOCK or READUNCOMMITTED.
+func (t *transpiler) removeTableHints(sql string) string {
+	h := 2 * dirtyReadHint.SubexpIndex("hint")
+	for _, m := range dirtyReadHint.FindAllStringSubmatchIndex(sql, -1) {
+		read := dirtyRead{table: hintedTable(sql[:m[0]]), hint: strings.ToUpper(sql[m[h]:m[h+1]])}
+		seen := false
+		for _, r := range t.dirtyReads {
+			seen = seen || r == read
+		}
+		if !seen {
+			t.dirtyReads = append(t.dirtyReads, read)
+		}
+	}
+	return stripTableHints(sql)
+}
+
+// hintedTable returns the table a hint list follows, given the query text
+// before it: the last word, or the one before it when that is an alias.
+func hintedTable(before string) string {
+	fields := strings.Fields(before)
+	n := len(fields)
+	if n == 0 {
+		return ""
+	}
+	isBoundary := func(f string) bool {
+		switch strings.ToUpper(f) {
+		case "FROM", "JOIN", "UPDATE", "INTO", "APPLY":
+			return true
+		}
+		return strings.HasSuffix(f, ",") || strings.HasSuffix(f, ")") || strings.HasSuffix(f, "(")
+	}
+	switch {
+	case n == 1 || isBoundary(fields[n-2]):
+		return fields[n-1]
+	case strings.EqualFold(fields[n-2], "AS") && n >= 3:
+		return fields[n-3]
+	}
+	return fields[n-2]
+}
+
+// hintsStatement reports whether stmt reads a table with NOLOCK or
+// READUNCOMMITTED and gets its own annotation. Blocks are left to the
+// statements in them.
+func (t *transpiler) hintsStatement(stmt ast.Statement) bool {
+	if !t.dmlEnabled || stmt == t.hintedStatement || t.dmlConfig.NoLockStrategy == NoLockIgnore {
+		return false
+	}
+	switch stmt.(type) {
+	case *ast.CreateProcedureStatement, *ast.CreateFunctionStatement, *ast.BeginEndBlock, *ast.TryCatchStatement:
+		return false
+	}
+	return dirtyReadHint.MatchString(stmt.String())
+}
+
+// readsUncommittedTx reports whether stmt runs in a READ UNCOMMITTED
+// transaction of its own.
+func (t *transpiler) readsUncommittedTx(stmt ast.Statement) bool {
+	if t.dmlConfig.NoLockStrategy != NoLockReadUncommitted || t.inTransaction ||
+		(t.dmlConfig.SQLDialect != "sqlserver" && t.dmlConfig.SQLDialect != "mysql") {
+		return false
+	}
+	switch s := stmt.(type) {
+	case *ast.SelectStatement:
+		return s.Into == nil
+	case *ast.WithStatement:
+		_, ok := s.Query.(*ast.SelectStatement)
+		return ok
+	}
+	return false
+}
+
+// transpileHintedStatement transpiles a statement that reads tables with
+// NOLOCK or READUNCOMMITTED, as NoLockStrategy says.
+func (t *transpiler) transpileHintedStatement(stmt ast.Statement) (string, error) {
+	outerReads, outerStmt, outerTx := t.dirtyReads, t.hintedStatement, t.nolockTx
+	t.dirtyReads, t.hintedStatement = nil, stmt
+	if t.readsUncommittedTx(stmt) {
+		t.nolockTxCount++
+		t.nolockTx = fmt.Sprintf("nolockTx%d", t.nolockTxCount)
+	}
+	code, err := t.transpileStatement(stmt)
+	reads, tx := t.dirtyReads, t.nolockTx
+	t.dirtyReads, t.hintedStatement, t.nolockTx = outerReads, outerStmt, outerTx
+	if err != nil || len(reads) == 0 {
+		return code, err
+	}
+
+	var tables []string
+	for _, r := range reads {
+		tables = append(tables, fmt.Sprintf("%s (%s)", r.table, r.hint))
+	}
+	ind := t.indentStr()
+	if tx != "" && strings.Contains(code, tx+".") {
+		t.imports["database/sql"] = true
+		var out strings.Builder
+		out.WriteString(fmt.Sprintf("// %s: read uncommitted, in a transaction of its own\n", strings.Join(tables, ", ")))
+		out.WriteString(fmt.Sprintf("%svar %s *sql.Tx\n", ind, tx))
+		out.WriteString(fmt.Sprintf("%sif tx, err := %s; err != nil {\n",
+			ind, t.beginTx("&sql.TxOptions{Isolation: sql.LevelReadUncommitted, ReadOnly: true}")))
+		out.WriteString(fmt.Sprintf("%s\t%s\n%s} else {\n%s\t%s = tx\n%s}\n", ind, t.buildErrorReturn(), ind, ind, tx, ind))
+		out.WriteString(fmt.Sprintf("%sdefer %s.Rollback()\n", ind, tx))
+		out.WriteString(ind + code)
+		return out.String(), nil
+	}
+
+	why := "see --nolock-strategy"
+	if t.dmlConfig.NoLockStrategy == NoLockReadUncommitted {
+		why = "read-uncommitted-tx only covers SELECTs outside transactions on sqlserver and mysql"
+	}
+	for _, r := range reads {
+		t.warnings = append(t.warnings, fmt.Sprintf("%s: %s on %s was removed, so the query no longer reads uncommitted data (%s)",
+			t.currentProcName, r.hint, r.table, why))
+	}
+	return fmt.Sprintf("// %s removed: reads committed data only\n%s%s", strings.Join(tables, ", "), ind, code), nil
+}
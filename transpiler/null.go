@@ -0,0 +1,322 @@
+package transpiler
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// NULL handling
+//
+// By default NULLs read into Go zero values: result set columns scan
+// through sql.Null* intermediaries that are then dropped, and a parameter
+// IS NULL check compares with "" or 0. DMLConfig.NullMode keeps NULL
+// distinct for the values where it is usually meaningful:
+//
+//   - parameters with a NULL default, or that the procedure tests with
+//     IS [NOT] NULL, ISNULL, COALESCE or sets to NULL
+//   - result set columns
+//   - nullable columns of table types
+//
+// NullSQL maps them to sql.NullString, sql.NullInt64 and so on (or
+// sql.Null[T] where database/sql has no named type), NullPointer to *T.
+// Either way they go to and from the database as they are, so NULL
+// survives the round trip. In Go expressions a nullable value reads as its
+// value, or the zero value when NULL; IS NULL checks Valid or nil,
+// comparisons and BETWEEN check it too, since they are never true of NULL,
+// and ISNULL/COALESCE fall back to their default only when it is NULL.
+// Local variables keep plain types.
+
+// Null modes
+const (
+	NullZero    = "zero"    // NULL reads as the zero value (default)
+	NullSQL     = "sqlnull" // sql.Null* types
+	NullPointer = "pointer" // Pointers, nil for NULL
+)
+
+// sqlNullTypes are the named database/sql types for Go types, with the
+// name of the field holding the value.
+var sqlNullTypes = map[string][2]string{
+	"string":          {"sql.NullString", "String"},
+	"int64":           {"sql.NullInt64", "Int64"},
+	"int32":           {"sql.NullInt32", "Int32"},
+	"int16":           {"sql.NullInt16", "Int16"},
+	"uint8":           {"sql.NullByte", "Byte"},
+	"float64":         {"sql.NullFloat64", "Float64"},
+	"bool":            {"sql.NullBool", "Bool"},
+	"time.Time":       {"sql.NullTime", "Time"},
+	"decimal.Decimal": {"decimal.NullDecimal", "Decimal"},
+	"apd.Decimal":     {"apd.NullDecimal", "Decimal"},
+}
+
+// nullable reports whether values of goType get a nullable type in the
+// current null mode. Slices, any and table types already hold NULL as nil.
+func (t *transpiler) nullable(goType string) bool {
+	switch t.dmlConfig.NullMode {
+	case NullSQL:
+		_, named := sqlNullTypes[goType]
+		return named || (t.goAtLeast(22) && goType != "any" && !strings.HasPrefix(goType, "[]"))
+	case NullPointer:
+		return goType != "any" && !strings.HasPrefix(goType, "[]")
+	}
+	return false
+}
+
+// nullType returns the nullable type for goType in the current null mode.
+func (t *transpiler) nullType(goType string) string {
+	if t.dmlConfig.NullMode == NullPointer {
+		if goType == "time.Time" {
+			t.imports["time"] = true
+		}
+		return "*" + goType
+	}
+	if named, ok := sqlNullTypes[goType]; ok {
+		if strings.HasPrefix(named[0], "sql.") {
+			t.imports["database/sql"] = true
+		}
+		return named[0]
+	}
+	t.imports["database/sql"] = true
+	return fmt.Sprintf("sql.Null[%s]", goType)
+}
+
+// nullValue returns the expression reading the value of the nullable name,
+// the zero value when NULL.
+func (t *transpiler) nullValue(name, goType string) string {
+	if t.dmlConfig.NullMode == NullPointer {
+		t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+		return fmt.Sprintf("tsqlruntime.Deref(%s)", name)
+	}
+	if named, ok := sqlNullTypes[goType]; ok {
+		return name + "." + named[1]
+	}
+	return name + ".V"
+}
+
+// nullValid returns the expression reporting whether name is not NULL.
+func (t *transpiler) nullValid(name string) string {
+	if t.dmlConfig.NullMode == NullPointer {
+		return name + " != nil"
+	}
+	return name + ".Valid"
+}
+
+// nullInvalid returns the expression reporting whether name is NULL.
+func (t *transpiler) nullInvalid(name string) string {
+	if t.dmlConfig.NullMode == NullPointer {
+		return name + " == nil"
+	}
+	return "!" + name + ".Valid"
+}
+
+// nullWrap returns value as a non-NULL value of the nullable type.
+func (t *transpiler) nullWrap(value, goType string) string {
+	if t.dmlConfig.NullMode == NullPointer {
+		t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+		return fmt.Sprintf("tsqlruntime.Ptr(%s)", value)
+	}
+	nt := t.nullType(goType)
+	if named, ok := sqlNullTypes[goType]; ok {
+		return fmt.Sprintf("%s{%s: %s, Valid: true}", nt, named[1], value)
+	}
+	return fmt.Sprintf("%s{V: %s, Valid: true}", nt, value)
+}
+
+// nullLiteral returns NULL as a value of the nullable type.
+func (t *transpiler) nullLiteral(goType string) string {
+	if t.dmlConfig.NullMode == NullPointer {
+		return "nil"
+	}
+	return t.nullType(goType) + "{}"
+}
+
+// nullSet returns the assignment SET name = value to a nullable variable.
+// NULL and nullable variables of the same type are assigned as they are;
+// SET @v = ISNULL(@v, default) only assigns when @v is NULL.
+func (t *transpiler) nullSet(name string, ti *typeInfo, value ast.Expression, valExpr string) string {
+	if _, ok := value.(*ast.NullLiteral); ok {
+		return fmt.Sprintf("%s = %s", name, t.nullLiteral(ti.goType))
+	}
+	if src, srcType, ok := t.nullableVariable(value); ok && srcType.goType == ti.goType {
+		t.symbols.markUsed(src)
+		return fmt.Sprintf("%s = %s", name, src)
+	}
+	if fc, ok := value.(*ast.FunctionCall); ok && len(fc.Arguments) == 2 {
+		fn := strings.ToUpper(fc.Function.String())
+		if arg, _, ok := t.nullableVariable(fc.Arguments[0]); ok && arg == name && (fn == "ISNULL" || fn == "COALESCE") {
+			def, err := t.transpileExpression(fc.Arguments[1])
+			if err == nil {
+				if ti.isDecimal {
+					def = t.ensureDecimal(fc.Arguments[1], def)
+				} else if ti.isBool {
+					def = t.ensureBool(fc.Arguments[1], def)
+				}
+				return fmt.Sprintf("if %s {\n%s\t%s = %s\n%s}", t.nullInvalid(name), t.indentStr(),
+					name, t.nullWrap(stripOuterParens(def), ti.goType), t.indentStr())
+			}
+		}
+	}
+	return fmt.Sprintf("%s = %s", name, t.nullWrap(stripOuterParens(valExpr), ti.goType))
+}
+
+// nullableVariable returns the symbol of expr if it is a nullable variable.
+func (t *transpiler) nullableVariable(expr ast.Expression) (string, *typeInfo, bool) {
+	v, ok := expr.(*ast.Variable)
+	if !ok {
+		return "", nil, false
+	}
+	name := goIdentifier(v.Name)
+	ti := t.symbols.lookup(name)
+	if ti == nil || !ti.nullable {
+		return "", nil, false
+	}
+	return name, ti, true
+}
+
+// nullGuard returns the checks that the nullable variables e compares are
+// not NULL, joined with &&, or "" if e is not a comparison of any.
+func (t *transpiler) nullGuard(e *ast.InfixExpression) string {
+	switch e.Operator {
+	case "=", "<>", "!=", "<", ">", "<=", ">=", "!<", "!>":
+	default:
+		return ""
+	}
+	var guards []string
+	for _, operand := range []ast.Expression{e.Left, e.Right} {
+		if name, _, ok := t.nullableVariable(operand); ok {
+			guards = append(guards, t.nullValid(name))
+		}
+	}
+	return strings.Join(guards, " && ")
+}
+
+// nullCoalesce returns ISNULL(v, def) for a nullable variable v.
+func (t *transpiler) nullCoalesce(name string, ti *typeInfo, defExpr ast.Expression, def string) string {
+	t.symbols.markUsed(name)
+	if ti.isDecimal {
+		def = t.ensureDecimal(defExpr, def)
+	} else if ti.isBool {
+		def = t.ensureBool(defExpr, def)
+	}
+	return fmt.Sprintf("func() %s { if %s { return %s }; return %s }()",
+		ti.goType, t.nullValid(name), t.nullValue(name, ti.goType), def)
+}
+
+// nullModeKeepsNull reports whether the null mode keeps NULL distinct
+// from the zero value.
+func (t *transpiler) nullModeKeepsNull() bool {
+	return t.dmlConfig.NullMode == NullSQL || t.dmlConfig.NullMode == NullPointer
+}
+
+// coalesce returns COALESCE(args...), the first argument that isn't NULL,
+// as the type of the first. A nullable variable is checked with Valid or
+// nil; other values can't be NULL when the null mode keeps NULL, so the
+// first of them ends the chain. In the default mode, where NULL reads as
+// the zero value, tsqlruntime.Coalesce returns the first value that isn't
+// zero. It returns false for arguments of unknown type.
+func (t *transpiler) coalesce(fc *ast.FunctionCall, args []string) (string, bool) {
+	ti := t.coalesceType(fc.Arguments)
+	if ti == nil || ti.goType == "" || ti.goType == "any" || ti.goType == "interface{}" {
+		return "", false
+	}
+	goType := ti.goType
+
+	// Each argument as a value of goType
+	convert := func(expr ast.Expression, value string, vt *typeInfo) string {
+		switch {
+		case ti.isDecimal:
+			return t.ensureDecimal(expr, value)
+		case ti.isBool:
+			return t.ensureBool(expr, value)
+		case ti.isNumeric && vt.isNumeric && !vt.isDecimal && vt.goType != goType && !isIntegerLiteral(expr) && !isFloatLiteral(value):
+			return fmt.Sprintf("%s(%s)", goType, value)
+		}
+		return value
+	}
+
+	if !t.nullModeKeepsNull() && !ti.isDecimal {
+		if ti.isBool {
+			// A BIT read as false can't be told from NULL; ISNULL keeps it too
+			return args[0], true
+		}
+		values := make([]string, len(args))
+		for i, arg := range fc.Arguments {
+			values[i] = convert(arg, args[i], t.inferType(arg))
+		}
+		t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+		return fmt.Sprintf("tsqlruntime.Coalesce(%s)", strings.Join(values, ", ")), true
+	}
+
+	var body strings.Builder
+	last := len(args) - 1
+	for i, arg := range fc.Arguments {
+		value := convert(arg, args[i], t.inferType(arg))
+		check := ""
+		if name, _, ok := t.nullableVariable(arg); ok {
+			t.symbols.markUsed(name)
+			check = t.nullValid(name)
+		} else if !t.nullModeKeepsNull() {
+			// Decimals in the default mode: zero reads as NULL
+			check = t.decimalIsZero(value, true)
+		}
+		if check == "" || i == last {
+			body.WriteString("return " + value)
+			break
+		}
+		body.WriteString(fmt.Sprintf("if %s { return %s }; ", check, value))
+	}
+	return fmt.Sprintf("func() %s { %s }()", goType, body.String()), true
+}
+
+// coalesceType returns the type of COALESCE(args...): the first
+// argument's, widened to hold the other integers and floats.
+func (t *transpiler) coalesceType(args []ast.Expression) *typeInfo {
+	ti := t.inferType(args[0])
+	if ti == nil || !ti.isNumeric || ti.isDecimal {
+		return ti
+	}
+	goType := ti.goType
+	for _, arg := range args[1:] {
+		if vt := t.inferType(arg); vt != nil && vt.isNumeric && !vt.isDecimal && !isIntegerLiteral(arg) {
+			goType = t.promoteNumericType(goType, vt.goType)
+		}
+	}
+	if goType == ti.goType {
+		return ti
+	}
+	widened := *ti
+	widened.goType = goType
+	widened.nullable = false
+	return &widened
+}
+
+// nullableParams returns the parameters of proc whose NULLs are kept in
+// the current null mode, if their type can hold NULL.
+func (t *transpiler) nullableParams(proc *ast.CreateProcedureStatement) map[string]bool {
+	if t.dmlConfig.NullMode != NullSQL && t.dmlConfig.NullMode != NullPointer {
+		return nil
+	}
+	body := ""
+	if proc.Body != nil {
+		body = proc.Body.String()
+	}
+	params := map[string]bool{}
+	for _, p := range proc.Parameters {
+		_, nullDefault := p.Default.(*ast.NullLiteral)
+		if nullDefault || testsNull(body, p.Name) {
+			params[goIdentifier(strings.TrimPrefix(p.Name, "@"))] = true
+		}
+	}
+	return params
+}
+
+// testsNull reports whether a procedure body checks variable for NULL or
+// sets it to NULL.
+func testsNull(body, variable string) bool {
+	v := regexp.QuoteMeta(variable)
+	re := regexp.MustCompile(`(?i)` + v + `\s+IS\s+(NOT\s+)?NULL\b|\b(ISNULL|COALESCE)\s*\(\s*` + v + `\b|` +
+		`\bSET\s+` + v + `\s*=\s*NULL\b`)
+	return re.MatchString(body)
+}
@@ -0,0 +1,109 @@
+package transpiler
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// OpenTelemetry instrumentation
+//
+// With DMLConfig.Otel set, each generated procedure runs in a span, started
+// through the tsqlruntime.Tracer in TracerVar:
+//
+//	ctx, span := tsqlruntime.StartSpan(ctx, r.tracer, "usp_GetOrder")
+//	defer func() { span.End(err) }()
+//
+// SQL calls go through tsqlruntime's traced wrappers, which add a child
+// span with db.operation and db.statement:
+//
+//	row := tsqlruntime.TracedQueryRowContext(ctx, r.tracer, r.db, "SELECT ...", id)
+//
+// and gRPC calls are bracketed by a child span with rpc.method:
+//
+//	rpcCtx, rpcSpan = tsqlruntime.StartRPCSpan(ctx, r.tracer, "GetOrder")
+//	resp, err := client.GetOrder(rpcCtx, &GetOrderRequest{...})
+//	rpcSpan.End(err)
+//
+// The runtime has no OpenTelemetry dependency; the traceotel package
+// adapts a trace.Tracer, and a nil Tracer traces nothing.
+
+// sqlCallRe matches a database/sql call, capturing the store, the method
+// and the context.
+var sqlCallRe = regexp.MustCompile(`\b([\w.]+)\.(ExecContext|QueryContext|QueryRowContext)\((ctx|stmtCtx), `)
+
+// tableParamCallRe matches a call of a tsqlruntime helper for queries
+// reading table-valued parameters (see tvp.go), capturing the helper, the
+// context and the store.
+var tableParamCallRe = regexp.MustCompile(`\btsqlruntime\.(\w+TableParams)\((ctx|stmtCtx), ([\w.]+), `)
+
+// rpcCallRe matches the first line of a generated gRPC call, capturing the
+// method and the context.
+var rpcCallRe = regexp.MustCompile(`^(\s*)\w+, err :?= [\w.]+\.(\w+)\((ctx|stmtCtx), &`)
+
+// otelPrologue returns the statements that start a procedure's span, or "".
+func (t *transpiler) otelPrologue(procName string, hasErr bool) string {
+	if !t.dmlEnabled || !t.dmlConfig.Otel {
+		return ""
+	}
+	t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+	ind := t.indentStr()
+	end := "defer span.End(nil)"
+	if hasErr {
+		end = "defer func() { span.End(err) }()"
+	}
+	return fmt.Sprintf("%sctx, span := tsqlruntime.StartSpan(ctx, %s, %q)\n%s%s\n",
+		ind, t.dmlConfig.TracerVar, procName, ind, end)
+}
+
+// rpcSpanPrologue returns the declarations gRPC spans need, added at the
+// start of a procedure that has any.
+func (t *transpiler) rpcSpanPrologue() string {
+	t.imports["context"] = true
+	ind := t.indentStr()
+	return fmt.Sprintf("%svar rpcCtx context.Context\n%svar rpcSpan tsqlruntime.Span\n", ind, ind)
+}
+
+// tracesStatement reports whether the next statement's calls get spans. Statements are
+// rewritten once, at the outermost level.
+func (t *transpiler) tracesStatement() bool {
+	return t.dmlEnabled && t.dmlConfig.Otel && t.inProcBody && !t.inTracedStatement
+}
+
+// transpileTracedStatement transpiles stmt, adding spans to its SQL and
+// gRPC calls.
+func (t *transpiler) transpileTracedStatement(stmt ast.Statement) (string, error) {
+	t.inTracedStatement = true
+	code, err := t.transpileStatement(stmt)
+	t.inTracedStatement = false
+	if err != nil {
+		return code, err
+	}
+	tracer := t.dmlConfig.TracerVar
+	if sqlCallRe.MatchString(code) {
+		t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+		code = sqlCallRe.ReplaceAllString(code, "tsqlruntime.Traced$2($3, "+tracer+", $1, ")
+	}
+	code = tableParamCallRe.ReplaceAllString(code, "tsqlruntime.$1($2, tsqlruntime.TraceDB("+tracer+", $3), ")
+
+	// Only lines after the first carry their indentation
+	lines := strings.Split(t.indentStr()+code, "\n")
+	var out []string
+	closeIndent := ""
+	for _, line := range lines {
+		if m := rpcCallRe.FindStringSubmatch(line); m != nil {
+			t.usesRPCSpan = true
+			out = append(out, fmt.Sprintf("%srpcCtx, rpcSpan = tsqlruntime.StartRPCSpan(%s, %s, %q)", m[1], m[3], tracer, m[2]))
+			line = strings.Replace(line, "("+m[3]+", &", "(rpcCtx, &", 1)
+			closeIndent = m[1]
+		}
+		out = append(out, line)
+		if closeIndent != "" && line == closeIndent+"})" {
+			out = append(out, closeIndent+"rpcSpan.End(err)")
+			closeIndent = ""
+		}
+	}
+	return strings.TrimPrefix(strings.Join(out, "\n"), t.indentStr()), nil
+}
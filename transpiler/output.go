@@ -0,0 +1,337 @@
+package transpiler
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// OUTPUT clauses
+//
+// OUTPUT returns a row for each row an INSERT, UPDATE or DELETE touched.
+// PostgreSQL and SQLite (3.35 and later) have RETURNING for it, with
+// INSERTED.Col and DELETED.Col becoming plain column references; in an
+// UPDATE, PostgreSQL (18 and later) reads DELETED.Col as old.Col, which
+// SQLite has no way to do. SQL Server keeps the clause where it was. The
+// rows are scanned in a loop, into the variable of OUTPUT ... INTO @var
+// (the last row wins, as with SELECT @var = ...) or into a variable per
+// column as with SELECT.
+//
+// OUTPUT ... INTO a temp table or table variable appends each row to it in
+// tempTables. INTO a permanent table stays in the SQL on SQL Server, and on
+// PostgreSQL the statement becomes a data-modifying CTE feeding an INSERT:
+//
+//	WITH output_rows AS (UPDATE ... RETURNING ...) INSERT INTO Audit (...) SELECT * FROM output_rows
+//
+// Where there is no translation the statement runs without its OUTPUT,
+// with a warning.
+
+var outputPseudoTable = regexp.MustCompile(`(?i)\b(INSERTED|DELETED)\.`)
+
+// Where the rows of an OUTPUT clause go.
+const (
+	outputToColumns  = iota // A variable per column
+	outputToVariable        // INTO a scalar variable
+	outputToMemory          // INTO a temp table or table variable
+	outputToTable           // INTO a permanent table
+)
+
+// outputTarget returns where the rows of an OUTPUT clause go, and the Go
+// variable or table they go into.
+func (dt *dmlTranspiler) outputTarget(o *ast.OutputClause) (int, string) {
+	switch {
+	case o.IntoVariable != nil:
+		name := goIdentifier(strings.TrimPrefix(o.IntoVariable.Name, "@"))
+		if len(o.Columns) == 1 && dt.symbols.lookup(name) != nil {
+			return outputToVariable, name
+		}
+		return outputToMemory, o.IntoVariable.Name
+	case o.Into != nil:
+		table := o.Into.String()
+		if isTempTable(table) {
+			return outputToMemory, table
+		}
+		return outputToTable, table
+	}
+	return outputToColumns, ""
+}
+
+// outputClause returns the SQL of an OUTPUT clause for the dialect: the
+// clause where SQL Server puts it, or the RETURNING clause that ends the
+// statement elsewhere. Both are "" if the rows can't be returned.
+func (dt *dmlTranspiler) outputClause(o *ast.OutputClause, verb string) (inline, returning string) {
+	if o == nil {
+		return "", ""
+	}
+	if reason := dt.outputUnsupported(o, verb); reason != "" {
+		dt.warnings = append(dt.warnings, fmt.Sprintf("%s: %s ... %s: %s; the statement runs without it",
+			dt.currentProcName, verb, truncateSQL(o.String(), 60), reason))
+		return "", ""
+	}
+	var cols []string
+	for _, col := range o.Columns {
+		sql := col.String()
+		if col.Expression != nil {
+			sql = dt.outputColumnSQL(col.Expression.String(), verb)
+			if col.Alias != nil {
+				sql += " AS " + col.Alias.Value
+			}
+		}
+		cols = append(cols, sql)
+	}
+	if dt.config.SQLDialect == "sqlserver" {
+		inline = " OUTPUT " + strings.Join(cols, ", ")
+		if target, table := dt.outputTarget(o); target == outputToTable {
+			inline += " INTO " + table + outputIntoColumns(o)
+		}
+		return inline, ""
+	}
+	return "", " RETURNING " + strings.Join(cols, ", ")
+}
+
+// outputIntoColumns returns the column list of OUTPUT ... INTO, or "".
+func outputIntoColumns(o *ast.OutputClause) string {
+	if len(o.IntoColumns) == 0 {
+		return ""
+	}
+	var cols []string
+	for _, c := range o.IntoColumns {
+		cols = append(cols, c.Value)
+	}
+	return " (" + strings.Join(cols, ", ") + ")"
+}
+
+// outputColumnSQL rewrites the INSERTED and DELETED references of an OUTPUT
+// column for RETURNING.
+func (dt *dmlTranspiler) outputColumnSQL(sql, verb string) string {
+	if dt.config.SQLDialect == "sqlserver" {
+		return sql
+	}
+	return outputPseudoTable.ReplaceAllStringFunc(sql, func(m string) string {
+		if verb == "UPDATE" && strings.EqualFold(m, "DELETED.") {
+			return "old."
+		}
+		return ""
+	})
+}
+
+// outputUnsupported returns why the rows of an OUTPUT clause can't be
+// returned for the dialect, or "" if they can.
+func (dt *dmlTranspiler) outputUnsupported(o *ast.OutputClause, verb string) string {
+	target, _ := dt.outputTarget(o)
+	switch dialect := dt.config.SQLDialect; {
+	case dialect == "mysql":
+		return "MySQL has no RETURNING"
+	case dialect == "sqlite" && verb == "UPDATE" && outputReadsDeleted(o):
+		return "SQLite's RETURNING has no DELETED values"
+	case dialect == "sqlite" && target == outputToTable:
+		return "SQLite can't insert the rows of RETURNING into a table"
+	case dialect != "postgres" && dialect != "sqlite" && dialect != "sqlserver":
+		return dialect + " has no RETURNING"
+	}
+	return ""
+}
+
+// returnsOutput reports whether a statement with the OUTPUT clause o
+// returns rows to scan.
+func (dt *dmlTranspiler) returnsOutput(o *ast.OutputClause, verb string) bool {
+	return o != nil && dt.outputUnsupported(o, verb) == ""
+}
+
+func outputReadsDeleted(o *ast.OutputClause) bool {
+	for _, col := range o.Columns {
+		if col.Expression != nil && strings.Contains(strings.ToUpper(col.Expression.String()), "DELETED.") {
+			return true
+		}
+	}
+	return false
+}
+
+// outputColumns returns the columns of an OUTPUT clause as SELECT columns,
+// named by their alias or the column they read.
+func (dt *dmlTranspiler) outputColumns(o *ast.OutputClause) []selectColumn {
+	var columns []selectColumn
+	for _, item := range o.Columns {
+		col := selectColumn{expression: item.Expression, name: "*"}
+		if item.Expression != nil {
+			col.expr = item.Expression.String()
+			col.name = dt.extractColumnName(item.Expression)
+		}
+		if item.Alias != nil {
+			col.alias = item.Alias.Value
+			col.name = item.Alias.Value
+		}
+		columns = append(columns, col)
+	}
+	return columns
+}
+
+// outputKeepsIdentity reports whether the INSERT s returns its identity
+// value with the rows of its OUTPUT clause, as the last column, for
+// SCOPE_IDENTITY() to read (see identity.go).
+func (dt *dmlTranspiler) outputKeepsIdentity(s *ast.InsertStatement) bool {
+	if !dt.identityInserts[s] || !dt.returnsOutput(s.Output, "INSERT") {
+		return false
+	}
+	target, _ := dt.outputTarget(s.Output)
+	return target != outputToTable
+}
+
+// transpileOutputSQL runs an INSERT, UPDATE or DELETE whose query returns
+// the rows of its OUTPUT clause, scanning each one. With identity, each
+// row ends with the identity value, scanned into lastInsertID.
+func (dt *dmlTranspiler) transpileOutputSQL(o *ast.OutputClause, verb, query string, args []string, identity bool) string {
+	var out strings.Builder
+
+	target, into := dt.outputTarget(o)
+	if target == outputToTable {
+		if dt.config.SQLDialect == "postgres" {
+			query = fmt.Sprintf("WITH output_rows AS (%s) INSERT INTO %s%s SELECT * FROM output_rows", query, into, outputIntoColumns(o))
+		}
+		return dt.transpileOutputExec(verb, query, args)
+	}
+
+	var scanDecl, scanTargets string
+	var scanAssigns []string
+	switch target {
+	case outputToVariable:
+		scanTargets = "&" + into
+	case outputToMemory:
+		var targets []string
+		for i := range o.Columns {
+			targets = append(targets, fmt.Sprintf("&outputRow[%d]", i))
+		}
+		scanTargets = strings.Join(targets, ", ")
+	default:
+		scanDecl, scanTargets, scanAssigns = dt.generateScanTargets(dt.outputColumns(o))
+	}
+	if identity {
+		scanTargets += ", &lastInsertID"
+	}
+
+	out.WriteString(fmt.Sprintf("// %s query\n", verb))
+	out.WriteString(dt.indentStr())
+	if scanDecl != "" {
+		out.WriteString(scanDecl)
+		out.WriteString("\n")
+		out.WriteString(dt.indentStr())
+	}
+	if target == outputToMemory {
+		assignOp := ":="
+		if dt.symbols.isDeclared("outputTable") && dt.symbols.isDeclared("err") {
+			assignOp = "="
+		}
+		dt.symbols.markDeclared("outputTable")
+		dt.symbols.markDeclared("err")
+		out.WriteString(fmt.Sprintf("outputTable, err %s tempTables.Table(%q)\n", assignOp, into))
+		out.WriteString(dt.indentStr())
+		out.WriteString("if err != nil {\n")
+		out.WriteString(dt.indentStr())
+		out.WriteString("\t" + dt.buildErrorReturn() + "\n")
+		out.WriteString(dt.indentStr())
+		out.WriteString("}\n")
+		out.WriteString(dt.indentStr())
+	}
+
+	assignOp := ":="
+	if dt.symbols.isDeclared("rows") && dt.symbols.isDeclared("err") {
+		assignOp = "="
+	}
+	dt.symbols.markDeclared("rows")
+	dt.symbols.markDeclared("err")
+
+	out.WriteString(fmt.Sprintf("rows, err %s %s.QueryContext(ctx, %q", assignOp, dt.getDBVar(), query))
+	for _, arg := range args {
+		out.WriteString(", " + arg)
+	}
+	out.WriteString(")\n")
+	out.WriteString(dt.indentStr())
+	out.WriteString("if err != nil {\n")
+	out.WriteString(dt.indentStr())
+	out.WriteString("\t" + dt.buildErrorReturn() + "\n")
+	out.WriteString(dt.indentStr())
+	out.WriteString("}\n")
+	out.WriteString(dt.indentStr())
+	out.WriteString("defer rows.Close()\n")
+	if dt.usesRowCount {
+		out.WriteString(dt.indentStr())
+		out.WriteString("rowsAffected = 0\n")
+	}
+	out.WriteString(dt.indentStr())
+	out.WriteString("for rows.Next() {\n")
+	if target == outputToMemory {
+		out.WriteString(dt.indentStr())
+		out.WriteString(fmt.Sprintf("\toutputRow := make([]any, %d)\n", len(o.Columns)))
+	}
+	out.WriteString(dt.indentStr())
+	out.WriteString(fmt.Sprintf("\tif err := rows.Scan(%s); err != nil {\n", scanTargets))
+	out.WriteString(dt.indentStr())
+	out.WriteString("\t\t" + dt.buildErrorReturn() + "\n")
+	out.WriteString(dt.indentStr())
+	out.WriteString("\t}")
+	dt.writeScanAssigns(&out, scanAssigns, "\t")
+	if target == outputToMemory {
+		columns := "nil"
+		if len(o.IntoColumns) > 0 {
+			var names []string
+			for _, c := range o.IntoColumns {
+				names = append(names, fmt.Sprintf("%q", c.Value))
+			}
+			columns = "[]string{" + strings.Join(names, ", ") + "}"
+		}
+		out.WriteString("\n")
+		out.WriteString(dt.indentStr())
+		out.WriteString(fmt.Sprintf("\tif err := outputTable.InsertScanned(%s, outputRow); err != nil {\n", columns))
+		out.WriteString(dt.indentStr())
+		out.WriteString("\t\t" + dt.buildErrorReturn() + "\n")
+		out.WriteString(dt.indentStr())
+		out.WriteString("\t}")
+	}
+	if dt.usesRowCount {
+		out.WriteString("\n")
+		out.WriteString(dt.indentStr())
+		out.WriteString("\trowsAffected++")
+	}
+	out.WriteString("\n")
+	out.WriteString(dt.indentStr())
+	out.WriteString("}\n")
+	out.WriteString(dt.indentStr())
+	out.WriteString("if err := rows.Err(); err != nil {\n")
+	out.WriteString(dt.indentStr())
+	out.WriteString("\t" + dt.buildErrorReturn() + "\n")
+	out.WriteString(dt.indentStr())
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// transpileOutputExec runs a statement whose OUTPUT rows the database
+// inserts itself.
+func (dt *dmlTranspiler) transpileOutputExec(verb, query string, args []string) string {
+	var out strings.Builder
+
+	assignOp := ":="
+	if dt.symbols.isDeclared("result") && dt.symbols.isDeclared("err") {
+		assignOp = "="
+	}
+	dt.symbols.markDeclared("result")
+	dt.symbols.markDeclared("err")
+
+	out.WriteString(fmt.Sprintf("// %s query\n", verb))
+	out.WriteString(dt.indentStr())
+	out.WriteString(fmt.Sprintf("result, err %s %s.ExecContext(ctx, %q", assignOp, dt.getDBVar(), query))
+	for _, arg := range args {
+		out.WriteString(", " + arg)
+	}
+	out.WriteString(")\n")
+	out.WriteString(dt.indentStr())
+	out.WriteString("if err != nil {\n")
+	out.WriteString(dt.indentStr())
+	out.WriteString("\t" + dt.buildErrorReturn() + "\n")
+	out.WriteString(dt.indentStr())
+	out.WriteString("}\n")
+	dt.emitResultHandling(&out, "Use result.RowsAffected() if needed")
+	return out.String()
+}
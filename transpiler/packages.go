@@ -0,0 +1,118 @@
+package transpiler
+
+import (
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// Cross-package references
+//
+// When generated code is split across packages (one per schema or per
+// service), an EXEC of a procedure in another package and the messages of
+// a gRPC call are qualified with a package name, and that package has to
+// be imported. DMLConfig.ModulePath is the import path of the output root,
+// so package billing is imported as <ModulePath>/billing; PackagePaths
+// sets the path of any package explicitly, such as proto packages
+// generated elsewhere. SchemaToPackage says which package each SQL schema's
+// procedures are generated into: with Billing:billing, EXEC
+// Billing.usp_Charge from any other package calls billing.Charge.
+
+// normalizePackagePaths accepts import paths where a proto package name is
+// expected (--grpc-package github.com/acme/protos/orderpb): the code uses
+// the last element and the path goes to PackagePaths.
+func normalizePackagePaths(config *DMLConfig) {
+	split := func(pkg string) string {
+		if !strings.Contains(pkg, "/") {
+			return pkg
+		}
+		name := path.Base(pkg)
+		if config.PackagePaths == nil {
+			config.PackagePaths = map[string]string{}
+		}
+		if _, ok := config.PackagePaths[name]; !ok {
+			config.PackagePaths[name] = pkg
+		}
+		return name
+	}
+	config.ProtoPackage = split(config.ProtoPackage)
+	if len(config.ServiceToPackage) > 0 {
+		packages := make(map[string]string, len(config.ServiceToPackage))
+		for service, pkg := range config.ServiceToPackage {
+			packages[service] = split(pkg)
+		}
+		config.ServiceToPackage = packages
+	}
+}
+
+// packageImportPath returns the import path of package pkg, if known.
+func (t *transpiler) packageImportPath(pkg string) (string, bool) {
+	if p, ok := t.dmlConfig.PackagePaths[pkg]; ok {
+		return p, true
+	}
+	if t.dmlConfig.ModulePath != "" {
+		return strings.TrimSuffix(t.dmlConfig.ModulePath, "/") + "/" + pkg, true
+	}
+	return "", false
+}
+
+// procedurePackage returns the package a procedure is generated into,
+// when SchemaToPackage places it in one other than the package being
+// generated.
+func (t *transpiler) procedurePackage(name *ast.QualifiedIdentifier) string {
+	if name == nil || len(name.Parts) < 2 || len(t.dmlConfig.SchemaToPackage) == 0 {
+		return ""
+	}
+	schema := strings.Trim(name.Parts[len(name.Parts)-2].Value, "[]")
+	for s, pkg := range t.dmlConfig.SchemaToPackage {
+		if strings.EqualFold(s, schema) && pkg != t.packageName {
+			return pkg
+		}
+	}
+	return ""
+}
+
+// addPackageImports imports the packages the generated code refers to
+// that have a known import path. References are found in the code itself,
+// since proto packages are named in many places.
+func (t *transpiler) addPackageImports(code string) {
+	candidates := map[string]bool{t.dmlConfig.ProtoPackage: true}
+	for pkg := range t.dmlConfig.PackagePaths {
+		candidates[pkg] = true
+	}
+	for _, pkg := range t.dmlConfig.SchemaToPackage {
+		candidates[pkg] = true
+	}
+	for _, pkg := range t.dmlConfig.ServiceToPackage {
+		candidates[pkg] = true
+	}
+	for _, service := range t.dmlConfig.TableToService {
+		candidates[inferProtoPackage(service)] = true
+	}
+	delete(candidates, "")
+	delete(candidates, t.packageName)
+
+	names := make([]string, 0, len(candidates))
+	for pkg := range candidates {
+		names = append(names, pkg)
+	}
+	sort.Strings(names)
+	for _, pkg := range names {
+		if !regexp.MustCompile(`(^|[^\w."])` + regexp.QuoteMeta(pkg) + `\.[A-Z]`).MatchString(code) {
+			continue
+		}
+		importPath, ok := t.packageImportPath(pkg)
+		if !ok {
+			continue
+		}
+		if path.Base(importPath) == pkg {
+			t.imports[importPath] = true
+		} else {
+			// Named import, e.g. orderpb "github.com/acme/protos/order/v1"
+			t.imports[pkg+" "+importPath] = true
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package transpiler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// Passthrough procedures
+//
+// During a phased migration a transpiled procedure may EXEC one that is
+// still in the database. DMLConfig.Passthrough names those procedures; an
+// EXEC of one calls a stub, declared once per package, that runs the
+// original procedure through tsqlruntime.CallProcedure:
+//
+//	// EXEC usp_Charge (passthrough)
+//	ref, _, err = r.UspCharge(ctx, orderId, amount)
+//
+//	func (r *Repository) UspCharge(ctx context.Context, orderId int32, amount decimal.Decimal) (ref string, returnCode int32, err error) {
+//		returnCode, err = tsqlruntime.CallProcedure(ctx, r.db, tsqlruntime.DialectPostgres, "usp_Charge",
+//			tsqlruntime.ProcParam{Name: "OrderID", Value: orderId}, ...
+//
+// The stub has the name and signature the transpiled procedure will have,
+// with its parameter types taken from the first call's arguments, so
+// migrating the callee means deleting the stub.
+
+// isPassthrough reports whether the procedure an EXEC names is one of
+// DMLConfig.Passthrough, compared without schema and case.
+func (t *transpiler) isPassthrough(name *ast.QualifiedIdentifier) bool {
+	if name == nil || len(name.Parts) == 0 {
+		return false
+	}
+	proc := passthroughKey(name.Parts[len(name.Parts)-1].Value)
+	for _, p := range t.dmlConfig.Passthrough {
+		if passthroughKey(unqualifiedName(p)) == proc {
+			return true
+		}
+	}
+	return false
+}
+
+func passthroughKey(name string) string {
+	return strings.ToLower(strings.Trim(name, "[]"))
+}
+
+// passthroughArg is an argument of an EXEC of a passthrough procedure.
+type passthroughArg struct {
+	name   string // SQL parameter name without the @, "" when positional
+	goName string // Stub parameter or result name
+	goType string
+	value  string // Go expression the caller passes, or the variable receiving an OUTPUT
+	output bool
+}
+
+// transpilePassthroughExec calls the stub for an EXEC of a passthrough
+// procedure, declaring the stub if this is the package's first call.
+func (dt *dmlTranspiler) transpilePassthroughExec(s *ast.ExecStatement) (string, error) {
+	procName := strings.NewReplacer("[", "", "]", "").Replace(s.Procedure.String())
+	if dt.config.Backend != BackendSQL && dt.config.Backend != "" {
+		return "", fmt.Errorf("EXEC %s: passthrough procedures are called through the SQL backend, not %s", procName, dt.config.Backend)
+	}
+	if dt.config.Style != StyleFunctions && dt.config.Receiver == "" {
+		return "", fmt.Errorf("EXEC %s: passthrough procedures need a receiver or --style functions", procName)
+	}
+	goName := goExportedIdentifier(strings.Trim(s.Procedure.Parts[len(s.Procedure.Parts)-1].Value, "[]"))
+
+	var args []passthroughArg
+	used := map[string]bool{"ctx": true, "err": true, "returnCode": true, unqualifiedName(dt.config.StoreVar): true}
+	for i, p := range s.Parameters {
+		arg := passthroughArg{name: strings.TrimPrefix(p.Name, "@"), output: p.Output}
+		// Stub names come from the parameter's name, else the caller's variable
+		if arg.name != "" {
+			arg.goName = goIdentifier(arg.name)
+		} else if v, ok := p.Value.(*ast.Variable); ok {
+			arg.goName = goIdentifier(strings.TrimPrefix(v.Name, "@"))
+		}
+		if arg.goName == "" || used[arg.goName] {
+			arg.goName = fmt.Sprintf("arg%d", i+1)
+		}
+		used[arg.goName] = true
+		if v, ok := p.Value.(*ast.Variable); ok && p.Output {
+			arg.value = goIdentifier(strings.TrimPrefix(v.Name, "@"))
+		} else if p.Output {
+			return "", fmt.Errorf("EXEC %s: OUTPUT argument %s must be a variable", procName, p.Value.String())
+		} else {
+			value, err := dt.transpileExpression(p.Value)
+			if err != nil {
+				return "", err
+			}
+			arg.value = value
+		}
+		arg.goType = "interface{}"
+		if ti := dt.inferType(p.Value); ti != nil && ti.goType != "" && ti.goType != "any" {
+			arg.goType = ti.goType
+		}
+		args = append(args, arg)
+	}
+
+	if !dt.declaredPassthroughs[goName] {
+		dt.declaredPassthroughs[goName] = true
+		dt.passthroughStubs = append(dt.passthroughStubs, dt.passthroughStub(goName, procName, args))
+	}
+
+	// The call, with the stub's results assigned to the caller's variables
+	callee := goName
+	leading := []string{"ctx"}
+	if dt.config.Style == StyleFunctions {
+		leading = append(leading, dt.config.StoreVar)
+	} else {
+		callee = dt.config.Receiver + "." + goName
+	}
+	var callArgs, results []string
+	for _, a := range args {
+		if a.output {
+			results = append(results, a.value)
+		} else {
+			callArgs = append(callArgs, a.value)
+		}
+	}
+	if s.ReturnVariable != nil {
+		results = append(results, goIdentifier(strings.TrimPrefix(s.ReturnVariable.Value, "@")))
+	} else {
+		results = append(results, "_")
+	}
+	call := fmt.Sprintf("%s(%s)", callee, strings.Join(append(leading, callArgs...), ", "))
+
+	var out strings.Builder
+	ind := dt.indentStr()
+	out.WriteString(fmt.Sprintf("// EXEC %s (passthrough)\n", procName))
+	if len(results) == 1 && results[0] == "_" {
+		out.WriteString(fmt.Sprintf("%sif _, err := %s; err != nil {\n", ind, call))
+	} else {
+		out.WriteString(fmt.Sprintf("%s%s, err = %s\n", ind, strings.Join(results, ", "), call))
+		out.WriteString(ind + "if err != nil {\n")
+	}
+	out.WriteString(ind + "\t" + dt.buildErrorReturn() + "\n")
+	out.WriteString(ind + "}")
+	return out.String(), nil
+}
+
+// passthroughStub returns the declaration of the stub that runs procName
+// in the database. It always returns the return code, so that calls that
+// ignore it and calls that don't can share the stub.
+func (dt *dmlTranspiler) passthroughStub(goName, procName string, args []passthroughArg) string {
+	dt.imports["context"] = true
+	dt.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+
+	params := []string{"ctx context.Context"}
+	store := dt.config.StoreVar
+	if dt.config.Style == StyleFunctions {
+		params = append(params, store+" tsqlruntime.DBTX")
+	}
+	var results, names, procParams []string
+	for _, a := range args {
+		field := "Value: " + a.goName
+		if a.output {
+			results = append(results, a.goName+" "+a.goType)
+			names = append(names, a.goName)
+			field = "Value: &" + a.goName + ", Output: true"
+		} else {
+			params = append(params, a.goName+" "+a.goType)
+		}
+		if a.name != "" {
+			field = "Name: " + strconv.Quote(a.name) + ", " + field
+		}
+		procParams = append(procParams, "\t\ttsqlruntime.ProcParam{"+field+"},\n")
+	}
+	results = append(results, "returnCode int32", "err error")
+	names = append(names, "returnCode", "err")
+
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("// %s runs %s, which hasn't been migrated yet, in the database.\n", goName, procName))
+	out.WriteString("// Replace it with the transpiled procedure once it is.\n")
+	if dt.config.Style == StyleFunctions {
+		out.WriteString(fmt.Sprintf("func %s(", goName))
+	} else {
+		out.WriteString(fmt.Sprintf("func (%s %s) %s(", dt.config.Receiver, dt.config.ReceiverType, goName))
+	}
+	out.WriteString(fmt.Sprintf("%s) (%s) {\n", strings.Join(params, ", "), strings.Join(results, ", ")))
+	out.WriteString(fmt.Sprintf("\treturnCode, err = tsqlruntime.CallProcedure(ctx, %s, %s, %q", store, runtimeDialect(dt.config.SQLDialect), procName))
+	if len(procParams) > 0 {
+		out.WriteString(",\n")
+		out.WriteString(strings.Join(procParams, ""))
+		out.WriteString("\t")
+	}
+	out.WriteString(")\n")
+	out.WriteString(fmt.Sprintf("\treturn %s\n", strings.Join(names, ", ")))
+	out.WriteString("}")
+	return out.String()
+}
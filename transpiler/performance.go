@@ -0,0 +1,181 @@
+package transpiler
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ha1tch/tsqlparser"
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// Performance hints
+//
+// Procedures that suffered from parameter sniffing were often fixed with
+// plan hints: WITH RECOMPILE on the procedure or an EXEC, and OPTION
+// (RECOMPILE), OPTION (OPTIMIZE FOR ...) and the like on a query. None of
+// them survive translation, so each is listed in the doc comment of the
+// generated function and, with --performance-report, in a report of its
+// own, telling whoever tunes the target database which queries needed a
+// plan of their own:
+//
+//	// Performance notes (SQL Server plan hints, not carried over):
+//	//   - WITH RECOMPILE on the procedure
+//	//   - line 7: OPTION (OPTIMIZE FOR (@Status = 1)) on SELECT FROM Orders
+
+// PerformanceNote is a plan hint a procedure gave SQL Server.
+type PerformanceNote struct {
+	Procedure string
+	Line      int
+	Hint      string // e.g. WITH RECOMPILE, OPTION (RECOMPILE)
+	Statement string // e.g. SELECT FROM Orders, EXEC dbo.Refresh; "" for the procedure
+}
+
+func (n PerformanceNote) String() string {
+	return fmt.Sprintf("%s:%d: %s", n.Procedure, n.Line, n.describe())
+}
+
+func (n PerformanceNote) describe() string {
+	if n.Statement == "" {
+		return n.Hint + " on the procedure"
+	}
+	return n.Hint + " on " + n.Statement
+}
+
+// AnalyzePerformanceHints returns the plan hints of every procedure in
+// source.
+func AnalyzePerformanceHints(source string) ([]PerformanceNote, error) {
+	source = stripGoStatements(source)
+	program, errors := tsqlparser.Parse(source)
+	if len(errors) > 0 {
+		return nil, fmt.Errorf("parse errors:\n%s", strings.Join(errors, "\n"))
+	}
+	return performanceHints(program, source), nil
+}
+
+// performanceHints is AnalyzePerformanceHints for a program parsed from
+// source.
+func performanceHints(program *ast.Program, source string) []PerformanceNote {
+	recompiled := recompiledProcedures(source)
+	var notes []PerformanceNote
+	for _, stmt := range program.Statements {
+		if proc, ok := stmt.(*ast.CreateProcedureStatement); ok {
+			notes = append(notes, performanceNotes(proc, recompiled)...)
+		}
+	}
+	return notes
+}
+
+// performanceNotes returns the plan hints of proc. recompiled holds the
+// lines of the procedures declared WITH RECOMPILE, which the parser drops.
+func performanceNotes(proc *ast.CreateProcedureStatement, recompiled map[int]bool) []PerformanceNote {
+	name := proc.Name.String()
+	var notes []PerformanceNote
+	if recompiled[proc.Token.Line] {
+		notes = append(notes, PerformanceNote{Procedure: name, Line: proc.Token.Line, Hint: "WITH RECOMPILE"})
+	}
+	var walk func(stmts []ast.Statement)
+	statement := func(stmt ast.Statement) {
+		if stmt != nil {
+			walk([]ast.Statement{stmt})
+		}
+	}
+	walk = func(stmts []ast.Statement) {
+		for _, stmt := range stmts {
+			switch s := stmt.(type) {
+			case *ast.SelectStatement:
+				if len(s.Options) == 0 {
+					continue
+				}
+				var hints []string
+				for _, opt := range s.Options {
+					hints = append(hints, opt.String())
+				}
+				what := "SELECT"
+				if s.From != nil {
+					var tables []string
+					for _, ref := range s.From.Tables {
+						tables = append(tables, tableRefNames(ref)...)
+					}
+					if len(tables) > 0 {
+						what += " FROM " + strings.Join(tables, ", ")
+					}
+				}
+				notes = append(notes, PerformanceNote{Procedure: name, Line: s.Token.Line,
+					Hint: "OPTION (" + strings.Join(hints, ", ") + ")", Statement: what})
+			case *ast.WithStatement:
+				statement(s.Query)
+			case *ast.ExecStatement:
+				if s.Recompile && s.Procedure != nil {
+					notes = append(notes, PerformanceNote{Procedure: name, Line: s.Token.Line,
+						Hint: "WITH RECOMPILE", Statement: "EXEC " + s.Procedure.String()})
+				}
+			case *ast.IfStatement:
+				statement(s.Consequence)
+				statement(s.Alternative)
+			case *ast.WhileStatement:
+				statement(s.Body)
+			case *ast.BeginEndBlock:
+				walk(s.Statements)
+			case *ast.TryCatchStatement:
+				if s.TryBlock != nil {
+					walk(s.TryBlock.Statements)
+				}
+				if s.CatchBlock != nil {
+					walk(s.CatchBlock.Statements)
+				}
+			}
+		}
+	}
+	if proc.Body != nil {
+		walk(proc.Body.Statements)
+	}
+	return notes
+}
+
+var (
+	createProcRe    = regexp.MustCompile(`(?i)\bCREATE\s+(?:OR\s+ALTER\s+)?PROC(?:EDURE)?\b`)
+	procHeaderEndRe = regexp.MustCompile(`(?i)(\w+)?\s*\bAS\b`)
+	withRecompileRe = regexp.MustCompile(`(?is)\bWITH\b[^;]*\bRECOMPILE\b`)
+)
+
+// recompiledProcedures returns the lines of the CREATE PROCEDURE
+// statements in source whose options, between the parameters and the AS
+// of the body, include RECOMPILE.
+func recompiledProcedures(source string) map[int]bool {
+	lines := make(map[int]bool)
+	if !strings.Contains(strings.ToUpper(source), "RECOMPILE") {
+		return lines
+	}
+	for _, m := range createProcRe.FindAllStringIndex(source, -1) {
+		header := source[m[1]:]
+		for _, as := range procHeaderEndRe.FindAllStringSubmatchIndex(header, -1) {
+			// EXECUTE AS is an option, not the start of the body
+			if as[2] >= 0 && (strings.EqualFold(header[as[2]:as[3]], "EXECUTE") || strings.EqualFold(header[as[2]:as[3]], "EXEC")) {
+				continue
+			}
+			header = header[:as[1]]
+			break
+		}
+		if withRecompileRe.MatchString(header) {
+			lines[strings.Count(source[:m[0]], "\n")+1] = true
+		}
+	}
+	return lines
+}
+
+// writePerformanceNotes adds a procedure's plan hints to the doc comment
+// of its function.
+func writePerformanceNotes(out *strings.Builder, notes []PerformanceNote) {
+	if len(notes) == 0 {
+		return
+	}
+	out.WriteString("// Performance notes (SQL Server plan hints, not carried over):\n")
+	for _, n := range notes {
+		if n.Statement == "" {
+			out.WriteString(fmt.Sprintf("//   - %s\n", n.describe()))
+		} else {
+			out.WriteString(fmt.Sprintf("//   - line %d: %s\n", n.Line, n.describe()))
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package transpiler
+
+import (
+	"strings"
+	"testing"
+)
+
+const planHintsProc = `
+CREATE PROCEDURE dbo.GetOrders @CustomerID INT, @Status INT
+WITH EXECUTE AS OWNER, RECOMPILE
+AS
+BEGIN
+    SELECT Id FROM Orders WHERE CustomerID = @CustomerID OPTION (RECOMPILE)
+    IF @Status > 0
+    BEGIN
+        SELECT Id FROM Orders o JOIN Lines l ON l.OrderId = o.Id WHERE Status = @Status OPTION (OPTIMIZE FOR (@Status = 1))
+    END
+    EXEC dbo.Refresh @Status WITH RECOMPILE
+END
+GO
+CREATE PROCEDURE dbo.Plain @Id INT AS SELECT Id FROM Orders WHERE Id = @Id OPTION (OPTIMIZE FOR UNKNOWN)
+`
+
+func TestAnalyzePerformanceHints(t *testing.T) {
+	notes, err := AnalyzePerformanceHints(planHintsProc)
+	if err != nil {
+		t.Fatalf("AnalyzePerformanceHints failed: %v", err)
+	}
+	want := []string{
+		"dbo.GetOrders:2: WITH RECOMPILE on the procedure",
+		"dbo.GetOrders:6: OPTION (RECOMPILE) on SELECT FROM Orders",
+		"dbo.GetOrders:9: OPTION (OPTIMIZE FOR (@Status = 1)) on SELECT FROM Orders, Lines",
+		"dbo.GetOrders:11: WITH RECOMPILE on EXEC dbo.Refresh",
+		"dbo.Plain:14: OPTION (OPTIMIZE FOR UNKNOWN) on SELECT FROM Orders",
+	}
+	if len(notes) != len(want) {
+		t.Fatalf("expected %d notes, got %v", len(want), notes)
+	}
+	for i, n := range notes {
+		if n.String() != want[i] {
+			t.Errorf("note %d = %q, want %q", i, n, want[i])
+		}
+	}
+}
+
+func TestPerformanceNotesInDocComment(t *testing.T) {
+	result, err := TranspileWithDMLEx(planHintsProc, "main", DefaultDMLConfig())
+	if err != nil {
+		t.Fatalf("TranspileWithDMLEx failed: %v", err)
+	}
+	want := `// Performance notes (SQL Server plan hints, not carried over):
+//   - WITH RECOMPILE on the procedure
+//   - line 6: OPTION (RECOMPILE) on SELECT FROM Orders
+//   - line 9: OPTION (OPTIMIZE FOR (@Status = 1)) on SELECT FROM Orders, Lines
+//   - line 11: WITH RECOMPILE on EXEC dbo.Refresh
+func (r *Repository) GetOrders(`
+	if !strings.Contains(result.Code, want) {
+		t.Errorf("expected the notes before GetOrders, got:\n%s", result.Code)
+	}
+	if !strings.Contains(result.Code, "// Performance notes (SQL Server plan hints, not carried over):\n//   - line 14: OPTION (OPTIMIZE FOR UNKNOWN) on SELECT FROM Orders\nfunc (r *Repository) Plain(") {
+		t.Errorf("expected the notes before Plain, got:\n%s", result.Code)
+	}
+}
@@ -0,0 +1,247 @@
+package transpiler
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/ha1tch/tsqlparser"
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// Generation pipeline
+//
+// TranspileWithDMLEx runs four stages, each filling in part of a Unit:
+//
+//	parse    Source -> Program
+//	analyze  Program -> Analysis: table usage, dynamic SQL, plan hints,
+//	         each worked out the first time it's asked for
+//	plan     Program -> Plan: the statements to emit and their procedures
+//	emit     Plan -> Result: Go code, contracts and warnings
+//
+// A Pipeline runs the same stages with middleware around each, so a tool
+// can add its own analysis, such as finding PII columns, drop procedures
+// from the plan, or replace the emit stage with an emitter of its own
+// without parsing and analysing the source itself:
+//
+//	p := transpiler.NewPipeline("orders", config)
+//	p.Use(func(stage transpiler.Stage, next transpiler.StageFunc) transpiler.StageFunc {
+//		if stage != transpiler.StageAnalyze {
+//			return next
+//		}
+//		return func(u *transpiler.Unit) error {
+//			if err := next(u); err != nil {
+//				return err
+//			}
+//			u.Analysis.Custom["pii"] = findPII(u.Program)
+//			return nil
+//		}
+//	})
+//	unit, err := p.Run(source)
+
+// Stage is a step of the pipeline.
+type Stage string
+
+// Pipeline stages, in the order they run.
+const (
+	StageParse   Stage = "parse"
+	StageAnalyze Stage = "analyze"
+	StagePlan    Stage = "plan"
+	StageEmit    Stage = "emit"
+)
+
+// Stages lists the pipeline stages in the order they run.
+var Stages = []Stage{StageParse, StageAnalyze, StagePlan, StageEmit}
+
+// StageFunc runs a stage on a unit.
+type StageFunc func(u *Unit) error
+
+// Middleware wraps a stage. It returns next to leave the stage alone, or a
+// function that runs code before or after calling next, or instead of it.
+type Middleware func(stage Stage, next StageFunc) StageFunc
+
+// Unit is one source file going through the pipeline. Each stage fills in
+// its own field for the stages after it.
+type Unit struct {
+	Source      string // T-SQL, with GO separators stripped unless Config.PreserveGo
+	PackageName string
+	Config      DMLConfig
+
+	Program  *ast.Program     // Set by parse
+	Analysis *Analysis        // Set by analyze
+	Plan     *Plan            // Set by plan
+	Result   *TranspileResult // Set by emit
+}
+
+// Analysis holds what the analyze stage finds by reading the program,
+// before anything is generated. Each finding is worked out the first time
+// it's asked for, from the statements as they were at the analyze stage, so
+// generating code alone doesn't pay for them.
+type Analysis struct {
+	Custom map[string]any // Middleware's own findings, by keys of its choosing
+
+	program *ast.Program
+	source  string
+
+	usageOnce, dynamicOnce, hintsOnce sync.Once
+	usage                             []ProcedureContract
+	dynamic                           []SecurityFinding
+	hints                             []PerformanceNote
+}
+
+// Procedures returns the tables each procedure reads and writes and the
+// procedures it calls (see ProcedureUsage).
+func (a *Analysis) Procedures() []ProcedureContract {
+	a.usageOnce.Do(func() { a.usage = procedureUsage(a.program) })
+	return a.usage
+}
+
+// DynamicSQL returns the variables concatenated into dynamic SQL (see
+// AuditDynamicSQL).
+func (a *Analysis) DynamicSQL() []SecurityFinding {
+	a.dynamicOnce.Do(func() { a.dynamic = auditDynamicSQL(a.program) })
+	return a.dynamic
+}
+
+// PerformanceNotes returns the plan hints (see AnalyzePerformanceHints).
+func (a *Analysis) PerformanceNotes() []PerformanceNote {
+	a.hintsOnce.Do(func() { a.hints = performanceHints(a.program, a.source) })
+	return a.hints
+}
+
+// Plan is what the emit stage generates from.
+type Plan struct {
+	Program    *ast.Program // The statements to emit, a script's wrapped into its procedure
+	Procedures []PlannedProcedure
+}
+
+// PlannedProcedure is a procedure the plan emits.
+type PlannedProcedure struct {
+	Name      string // Without the schema
+	GoName    string
+	Statement *ast.CreateProcedureStatement
+}
+
+// Pipeline runs the stages of TranspileWithDMLEx with middleware.
+type Pipeline struct {
+	packageName string
+	config      DMLConfig
+	middleware  []Middleware
+}
+
+// NewPipeline returns a pipeline generating packageName with config.
+func NewPipeline(packageName string, config DMLConfig) *Pipeline {
+	return &Pipeline{packageName: packageName, config: config}
+}
+
+// Use adds middleware. The first added is the outermost.
+func (p *Pipeline) Use(mw ...Middleware) *Pipeline {
+	p.middleware = append(p.middleware, mw...)
+	return p
+}
+
+// EmitWith returns middleware replacing the emit stage with emit, for
+// generating something other than Go from the plan.
+func EmitWith(emit StageFunc) Middleware {
+	return func(stage Stage, next StageFunc) StageFunc {
+		if stage == StageEmit {
+			return emit
+		}
+		return next
+	}
+}
+
+// Run takes source through every stage, stopping at the first error.
+func (p *Pipeline) Run(source string) (*Unit, error) {
+	u := &Unit{Source: source, PackageName: p.packageName, Config: p.config}
+	if !u.Config.PreserveGo {
+		u.Source = stripGoStatements(source)
+	}
+	for _, stage := range Stages {
+		run := defaultStage(stage)
+		for i := len(p.middleware) - 1; i >= 0; i-- {
+			run = p.middleware[i](stage, run)
+		}
+		if err := run(u); err != nil {
+			return u, err
+		}
+	}
+	return u, nil
+}
+
+// defaultStage returns the built-in function of a stage.
+func defaultStage(stage Stage) StageFunc {
+	switch stage {
+	case StageParse:
+		return parseStage
+	case StageAnalyze:
+		return analyzeStage
+	case StagePlan:
+		return planStage
+	}
+	return emitStage
+}
+
+func parseStage(u *Unit) error {
+	program, errors := tsqlparser.Parse(u.Source)
+	if len(errors) > 0 {
+		return fmt.Errorf("parse errors:\n%s", strings.Join(errors, "\n"))
+	}
+	u.Program = program
+	return nil
+}
+
+func analyzeStage(u *Unit) error {
+	if u.Program == nil {
+		return fmt.Errorf("analyze: no program parsed")
+	}
+	// Later stages may drop statements; the analysis is of them all
+	program := &ast.Program{Statements: append([]ast.Statement(nil), u.Program.Statements...)}
+	u.Analysis = &Analysis{Custom: map[string]any{}, program: program, source: u.Source}
+	return nil
+}
+
+func planStage(u *Unit) error {
+	if u.Program == nil {
+		return fmt.Errorf("plan: no program parsed")
+	}
+	program := u.Program
+	if u.Config.ScriptName != "" && u.Config.Backend != BackendProcedureCall {
+		program, _ = scriptProgram(program, u.Config.ScriptName)
+	}
+	plan := &Plan{Program: program}
+	for _, stmt := range program.Statements {
+		if proc, ok := stmt.(*ast.CreateProcedureStatement); ok {
+			name := proc.Name.Parts[len(proc.Name.Parts)-1].Value
+			plan.Procedures = append(plan.Procedures, PlannedProcedure{
+				Name:      name,
+				GoName:    goExportedIdentifier(name),
+				Statement: proc,
+			})
+		}
+	}
+	u.Plan = plan
+	return nil
+}
+
+func emitStage(u *Unit) error {
+	if u.Plan == nil {
+		return fmt.Errorf("emit: no plan")
+	}
+	var result *TranspileResult
+	var err error
+	if u.Config.Backend == BackendProcedureCall {
+		result, err = transpileProcedureCalls(u.Plan.Program, u.Source, u.PackageName, u.Config)
+	} else {
+		t := newDMLTranspiler(u.Source, u.PackageName, u.Config)
+		var code string
+		if code, err = t.transpile(u.Plan.Program); err == nil {
+			result = t.result(code)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	u.Result = result
+	return nil
+}
@@ -0,0 +1,155 @@
+package transpiler
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const pipelineSource = `
+CREATE PROCEDURE dbo.GetCustomer @Id INT
+AS
+BEGIN
+    SELECT Name, Email FROM Customers WHERE Id = @Id OPTION (RECOMPILE)
+END
+GO
+CREATE PROCEDURE dbo.PurgeAudit
+AS
+BEGIN
+    DELETE FROM AuditLog
+END
+`
+
+func TestPipeline_MatchesTranspileWithDMLEx(t *testing.T) {
+	config := DefaultDMLConfig()
+	want, err := TranspileWithDMLEx(pipelineSource, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDMLEx failed: %v", err)
+	}
+	unit, err := NewPipeline("main", config).Run(pipelineSource)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if unit.Result.Code != want.Code {
+		t.Errorf("pipeline code differs from TranspileWithDMLEx:\n%s", unit.Result.Code)
+	}
+	if len(unit.Plan.Procedures) != 2 || unit.Plan.Procedures[0].GoName != "GetCustomer" {
+		t.Errorf("unexpected plan: %+v", unit.Plan.Procedures)
+	}
+	a := unit.Analysis
+	if a.usage != nil || a.dynamic != nil || a.hints != nil {
+		t.Errorf("expected nothing analysed until asked for, got %+v", a)
+	}
+	if usage := a.Procedures(); len(usage) != 2 || strings.Join(usage[1].TablesWritten, ",") != "AuditLog" {
+		t.Errorf("unexpected table usage: %+v", usage)
+	}
+	if notes := a.PerformanceNotes(); len(notes) != 1 || notes[0].Hint != "OPTION (RECOMPILE)" {
+		t.Errorf("unexpected performance notes: %v", notes)
+	}
+	if findings := a.DynamicSQL(); len(findings) != 0 {
+		t.Errorf("unexpected dynamic SQL findings: %v", findings)
+	}
+}
+
+func TestPipeline_Middleware(t *testing.T) {
+	var order []string
+	trace := func(name string) Middleware {
+		return func(stage Stage, next StageFunc) StageFunc {
+			return func(u *Unit) error {
+				order = append(order, name+">"+string(stage))
+				err := next(u)
+				order = append(order, name+"<"+string(stage))
+				return err
+			}
+		}
+	}
+	// Custom analysis: columns that look like personal data
+	pii := func(stage Stage, next StageFunc) StageFunc {
+		if stage != StageAnalyze {
+			return next
+		}
+		return func(u *Unit) error {
+			if err := next(u); err != nil {
+				return err
+			}
+			if strings.Contains(u.Source, "Email") {
+				u.Analysis.Custom["pii"] = []string{"Customers.Email"}
+			}
+			return nil
+		}
+	}
+	// Plan: leave out the purge
+	skipPurge := func(stage Stage, next StageFunc) StageFunc {
+		if stage != StagePlan {
+			return next
+		}
+		return func(u *Unit) error {
+			if err := next(u); err != nil {
+				return err
+			}
+			kept := u.Plan.Program.Statements[:0]
+			for _, stmt := range u.Plan.Program.Statements {
+				if !strings.Contains(stmt.String(), "PurgeAudit") {
+					kept = append(kept, stmt)
+				}
+			}
+			u.Plan.Program.Statements = kept
+			return nil
+		}
+	}
+
+	unit, err := NewPipeline("main", DefaultDMLConfig()).Use(trace("outer"), trace("inner"), pii, skipPurge).Run(pipelineSource)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if got := strings.Join(order[:4], " "); got != "outer>parse inner>parse inner<parse outer<parse" {
+		t.Errorf("middleware ran in the wrong order: %s", got)
+	}
+	if len(order) != 16 {
+		t.Errorf("expected each middleware around all four stages, got %v", order)
+	}
+	if got, _ := unit.Analysis.Custom["pii"].([]string); len(got) != 1 {
+		t.Errorf("custom analysis missing: %v", unit.Analysis.Custom)
+	}
+	// Analysed as parsed, before the plan dropped the purge
+	if usage := unit.Analysis.Procedures(); len(usage) != 2 {
+		t.Errorf("expected both procedures analysed, got %+v", usage)
+	}
+	if !strings.Contains(unit.Result.Code, "GetCustomer(") || strings.Contains(unit.Result.Code, "PurgeAudit(") {
+		t.Errorf("expected only GetCustomer, got:\n%s", unit.Result.Code)
+	}
+}
+
+func TestPipeline_EmitWith(t *testing.T) {
+	// Another emitter reusing parse, analyze and plan
+	unit, err := NewPipeline("main", DefaultDMLConfig()).Use(EmitWith(func(u *Unit) error {
+		var names []string
+		for _, p := range u.Plan.Procedures {
+			names = append(names, p.GoName)
+		}
+		u.Result = &TranspileResult{Code: strings.Join(names, "\n")}
+		return nil
+	})).Run(pipelineSource)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if unit.Result.Code != "GetCustomer\nPurgeAudit" {
+		t.Errorf("unexpected output %q", unit.Result.Code)
+	}
+
+	// An error stops the pipeline
+	stop := errors.New("stop")
+	ran := false
+	_, err = NewPipeline("main", DefaultDMLConfig()).Use(func(stage Stage, next StageFunc) StageFunc {
+		if stage == StageAnalyze {
+			return func(*Unit) error { return stop }
+		}
+		if stage == StageEmit {
+			ran = true
+		}
+		return next
+	}).Run(pipelineSource)
+	if !errors.Is(err, stop) || ran {
+		t.Errorf("expected the pipeline to stop at analyze, got err=%v emit=%v", err, ran)
+	}
+}
@@ -0,0 +1,269 @@
+package transpiler
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// PIVOT and UNPIVOT
+//
+// SQL Server is the only dialect with PIVOT and UNPIVOT, so for the others
+// the operator is rewritten as a derived table with the same alias:
+//
+//	src PIVOT (SUM(Amount) FOR Quarter IN ([Q1], [Q2])) AS p
+//	  -> (SELECT ProductID, SUM(Amount) FILTER (WHERE Quarter = 'Q1') AS Q1, ...
+//	      FROM src GROUP BY ProductID) AS p
+//
+// which is conditional aggregation: FILTER with postgres, CASE inside the
+// aggregate with MySQL and SQLite. PIVOT groups by the source columns it
+// doesn't pivot, taken from the derived table it reads or, for a table,
+// from the outer SELECT list. UNPIVOT becomes a UNION ALL with a branch
+// per column, skipping NULLs as UNPIVOT does. Backends other than SQL
+// can't run either, and are warned with the columns involved.
+
+var plainIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// quoteIdentifier quotes a name for the dialect if it isn't a plain
+// identifier, as a PIVOT value such as [2024] or [Not Shipped].
+func (dt *dmlTranspiler) quoteIdentifier(name string) string {
+	if plainIdentifier.MatchString(name) {
+		return name
+	}
+	switch dt.config.SQLDialect {
+	case "sqlserver":
+		return "[" + strings.ReplaceAll(name, "]", "]]") + "]"
+	case "mysql":
+		return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+	default:
+		return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+	}
+}
+
+// pivotValueLiteral returns the SQL literal a PIVOT value is compared as.
+func pivotValueLiteral(value string) string {
+	if numericLiteral.MatchString(value) {
+		return value
+	}
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+var numericLiteral = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+
+// pivotTableSQL returns the SQL for a PIVOT or UNPIVOT table in the FROM
+// clause of s, or false for other tables.
+func (dt *dmlTranspiler) pivotTableSQL(ref ast.TableReference, s *ast.SelectStatement) (string, bool) {
+	switch p := ref.(type) {
+	case *ast.PivotTable:
+		if dt.config.SQLDialect == "sqlserver" {
+			return p.Source.String() + " PIVOT (" + p.AggregateFunc + "(" + p.ValueColumn.String() + ") FOR " + p.PivotColumn.Value +
+				" IN (" + strings.Join(pivotNames(p.PivotValues, dt.quoteIdentifier), ", ") + "))" + aliasSQL(p.Alias), true
+		}
+		return dt.pivotSQL(p, s), true
+	case *ast.UnpivotTable:
+		if dt.config.SQLDialect == "sqlserver" {
+			return p.Source.String() + " UNPIVOT (" + p.ValueColumn.Value + " FOR " + p.PivotColumn.Value +
+				" IN (" + strings.Join(pivotNames(p.SourceColumns, dt.quoteIdentifier), ", ") + "))" + aliasSQL(p.Alias), true
+		}
+		return dt.unpivotSQL(p), true
+	}
+	return "", false
+}
+
+// pivotSQL rewrites PIVOT as conditional aggregation.
+func (dt *dmlTranspiler) pivotSQL(p *ast.PivotTable, s *ast.SelectStatement) string {
+	groupBy := dt.pivotGroupColumns(p, s)
+	cols := append([]string(nil), groupBy...)
+	value := p.ValueColumn.String()
+	for _, v := range p.PivotValues {
+		match := p.PivotColumn.Value + " = " + pivotValueLiteral(v.Value)
+		var agg string
+		if dt.config.SQLDialect == "postgres" {
+			agg = fmt.Sprintf("%s(%s) FILTER (WHERE %s)", p.AggregateFunc, value, match)
+		} else {
+			agg = fmt.Sprintf("%s(CASE WHEN %s THEN %s END)", p.AggregateFunc, match, value)
+		}
+		cols = append(cols, agg+" AS "+dt.quoteIdentifier(v.Value))
+	}
+	query := "SELECT " + strings.Join(cols, ", ") + " FROM " + p.Source.String()
+	if len(groupBy) > 0 {
+		query += " GROUP BY " + strings.Join(groupBy, ", ")
+	}
+	return "(" + query + ")" + aliasSQL(p.Alias)
+}
+
+// pivotGroupColumns returns the columns PIVOT groups by: the source's
+// columns other than the aggregated and pivoted ones.
+func (dt *dmlTranspiler) pivotGroupColumns(p *ast.PivotTable, s *ast.SelectStatement) []string {
+	skip := map[string]bool{strings.ToLower(p.PivotColumn.Value): true}
+	if name, ok := columnRefName(p.ValueColumn); ok {
+		skip[strings.ToLower(name)] = true
+	}
+	var groupBy []string
+	add := func(name string) {
+		if !skip[strings.ToLower(name)] {
+			skip[strings.ToLower(name)] = true
+			groupBy = append(groupBy, name)
+		}
+	}
+
+	if derived, ok := p.Source.(*ast.DerivedTable); ok && derived.Subquery != nil {
+		if len(derived.ColumnAliases) > 0 {
+			for _, c := range derived.ColumnAliases {
+				add(c.Value)
+			}
+			return groupBy
+		}
+		if names, ok := selectColumnNames(derived.Subquery); ok {
+			for _, name := range names {
+				add(name)
+			}
+			return groupBy
+		}
+	}
+
+	// The source's columns aren't known, so those of the outer SELECT
+	// that aren't pivot values stand in for them
+	for _, v := range p.PivotValues {
+		skip[strings.ToLower(v.Value)] = true
+	}
+	for _, col := range s.Columns {
+		if name, ok := columnRefName(col.Expression); ok {
+			add(name)
+		}
+	}
+	dt.warnings = append(dt.warnings, fmt.Sprintf("%s: PIVOT groups by the columns of %s it doesn't pivot, which aren't known; it groups by %s from the SELECT list",
+		dt.currentProcName, p.Source.String(), strings.Join(groupBy, ", ")))
+	return groupBy
+}
+
+// unpivotSQL rewrites UNPIVOT as a UNION ALL with a branch per column.
+func (dt *dmlTranspiler) unpivotSQL(p *ast.UnpivotTable) string {
+	// The source's columns are selected as qualifier.*, which MySQL needs
+	// qualified to allow more columns after it
+	source, qualifier := p.Source.String(), ""
+	switch src := p.Source.(type) {
+	case *ast.TableName:
+		qualifier = unqualifiedName(src.Name.String())
+		if src.Alias != nil {
+			qualifier = src.Alias.Value
+		}
+	case *ast.DerivedTable:
+		if src.Alias != nil {
+			qualifier = src.Alias.Value
+		}
+	}
+
+	var branches []string
+	for _, c := range p.SourceColumns {
+		col := qualifier + "." + dt.quoteIdentifier(c.Value)
+		branches = append(branches, fmt.Sprintf("SELECT %s.*, %s AS %s, %s AS %s FROM %s WHERE %s IS NOT NULL",
+			qualifier, pivotValueLiteral(c.Value), p.PivotColumn.Value, col, p.ValueColumn.Value, source, col))
+	}
+	return "(" + strings.Join(branches, " UNION ALL ") + ")" + aliasSQL(p.Alias)
+}
+
+// quotePivotColumns returns s with the SELECT list's references to PIVOT
+// values that aren't plain identifiers quoted, as the parser drops the
+// brackets of [2024] and the dialect would read a number.
+func (dt *dmlTranspiler) quotePivotColumns(s *ast.SelectStatement) *ast.SelectStatement {
+	quoted := map[string]string{}
+	for _, ref := range s.From.Tables {
+		if p, ok := ref.(*ast.PivotTable); ok {
+			for _, v := range p.PivotValues {
+				if q := dt.quoteIdentifier(v.Value); q != v.Value {
+					quoted[strings.ToLower(v.Value)] = q
+				}
+			}
+		}
+	}
+	if len(quoted) == 0 {
+		return s
+	}
+	out := *s
+	out.Columns = make([]ast.SelectColumn, len(s.Columns))
+	for i, col := range s.Columns {
+		if id, ok := col.Expression.(*ast.Identifier); ok {
+			if q, ok := quoted[strings.ToLower(id.Value)]; ok {
+				col.Expression = &ast.Identifier{Value: q}
+			}
+		}
+		out.Columns[i] = col
+	}
+	return &out
+}
+
+// warnPivotBackend warns that a backend other than SQL can't run the
+// PIVOT or UNPIVOT s reads, naming the columns involved.
+func (dt *dmlTranspiler) warnPivotBackend(s *ast.SelectStatement, backend BackendType) {
+	if s == nil || s.From == nil {
+		return
+	}
+	for _, ref := range s.From.Tables {
+		switch p := ref.(type) {
+		case *ast.PivotTable:
+			dt.warnings = append(dt.warnings, fmt.Sprintf("%s: PIVOT has no %s backend translation (aggregate: %s(%s), pivot column: %s, values: %s); pivot the rows of %s in Go",
+				dt.currentProcName, backend, p.AggregateFunc, p.ValueColumn.String(), p.PivotColumn.Value,
+				strings.Join(pivotNames(p.PivotValues, nil), ", "), p.Source.String()))
+		case *ast.UnpivotTable:
+			dt.warnings = append(dt.warnings, fmt.Sprintf("%s: UNPIVOT has no %s backend translation (value column: %s, name column: %s, columns: %s); unpivot the rows of %s in Go",
+				dt.currentProcName, backend, p.ValueColumn.Value, p.PivotColumn.Value,
+				strings.Join(pivotNames(p.SourceColumns, nil), ", "), p.Source.String()))
+		}
+	}
+}
+
+func pivotNames(ids []*ast.Identifier, quote func(string) string) []string {
+	names := make([]string, len(ids))
+	for i, id := range ids {
+		names[i] = id.Value
+		if quote != nil {
+			names[i] = quote(id.Value)
+		}
+	}
+	return names
+}
+
+func aliasSQL(alias *ast.Identifier) string {
+	if alias == nil {
+		return ""
+	}
+	return " AS " + alias.Value
+}
+
+// columnRefName returns the column an expression names, if it is a plain
+// column reference.
+func columnRefName(e ast.Expression) (string, bool) {
+	switch x := e.(type) {
+	case *ast.Identifier:
+		return x.Value, true
+	case *ast.QualifiedIdentifier:
+		if len(x.Parts) > 0 {
+			return x.Parts[len(x.Parts)-1].Value, true
+		}
+	}
+	return "", false
+}
+
+// selectColumnNames returns the names of the columns a SELECT returns,
+// or false if any is unnamed or *.
+func selectColumnNames(s *ast.SelectStatement) ([]string, bool) {
+	var names []string
+	for _, col := range s.Columns {
+		if col.AllColumns {
+			return nil, false
+		}
+		if col.Alias != nil {
+			names = append(names, col.Alias.Value)
+			continue
+		}
+		name, ok := columnRefName(col.Expression)
+		if !ok {
+			return nil, false
+		}
+		names = append(names, name)
+	}
+	return names, len(names) > 0
+}
@@ -0,0 +1,143 @@
+package transpiler
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Placeholder consistency
+//
+// A query's placeholders are numbered when it is built, and the T-SQL
+// variables left in it are replaced by a second pass, so a mistake in
+// either shows up only when database/sql rejects the call. Before the code
+// is returned, each query literal passed to a ...Context call is checked
+// against the arguments after it: numbered placeholders ($1, @p1, :p1)
+// must run from 1 to the number of arguments without a gap, and there
+// must be a ? per argument. Calls spreading a slice (args...) aren't
+// checked, nor is code that doesn't parse.
+
+var sqlQueryLiteral = regexp.MustCompile(`(?i)^\s*(SELECT|INSERT|UPDATE|DELETE|WITH|MERGE|CALL|EXEC)\b`)
+
+// checkPlaceholders returns a description of each query in code whose
+// placeholders don't match its arguments for the dialect.
+func checkPlaceholders(code, dialect string) []string {
+	file, err := parser.ParseFile(token.NewFileSet(), "", code, 0)
+	if err != nil {
+		return nil
+	}
+	var problems []string
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Body == nil {
+			continue
+		}
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok || call.Ellipsis.IsValid() {
+				return true
+			}
+			sel, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok || !strings.HasSuffix(sel.Sel.Name, "Context") {
+				return true
+			}
+			for i, arg := range call.Args {
+				query, ok := sqlLiteral(arg)
+				if !ok {
+					continue
+				}
+				if problem := placeholderMismatch(query, dialect, len(call.Args)-i-1); problem != "" {
+					problems = append(problems, fmt.Sprintf("%s: %s", fn.Name.Name, problem))
+				}
+				break
+			}
+			return true
+		})
+	}
+	return problems
+}
+
+// sqlLiteral returns the query a string literal holds, if it is one.
+func sqlLiteral(e ast.Expr) (string, bool) {
+	lit, ok := e.(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", false
+	}
+	s, err := strconv.Unquote(lit.Value)
+	if err != nil || !sqlQueryLiteral.MatchString(s) {
+		return "", false
+	}
+	return s, true
+}
+
+var numberedPlaceholder = map[string]*regexp.Regexp{
+	"postgres":  regexp.MustCompile(`\$([0-9]+)`),
+	"sqlserver": regexp.MustCompile(`@p([0-9]+)\b`),
+	"oracle":    regexp.MustCompile(`:p([0-9]+)\b`),
+}
+
+// placeholderMismatch describes how the placeholders of query differ from
+// args arguments, or returns "" if they match.
+func placeholderMismatch(query, dialect string, args int) string {
+	sql := stripSQLStrings(query)
+	re, numbered := numberedPlaceholder[dialect]
+	if !numbered {
+		if n := strings.Count(sql, "?"); n != args {
+			return fmt.Sprintf("query %q has %d placeholders but %d arguments", truncateSQL(query, 60), n, args)
+		}
+		return ""
+	}
+
+	seen := map[int]bool{}
+	for _, m := range re.FindAllStringSubmatch(sql, -1) {
+		n, _ := strconv.Atoi(m[1])
+		seen[n] = true
+	}
+	var missing []string
+	for n := 1; n <= args; n++ {
+		if !seen[n] {
+			missing = append(missing, getPlaceholderForDialect(dialect, n))
+		}
+	}
+	var extra []int
+	for n := range seen {
+		if n < 1 || n > args {
+			extra = append(extra, n)
+		}
+	}
+	sort.Ints(extra)
+	switch {
+	case len(extra) > 0:
+		return fmt.Sprintf("query %q uses placeholder %s but has %d arguments", truncateSQL(query, 60), getPlaceholderForDialect(dialect, extra[0]), args)
+	case len(missing) > 0:
+		return fmt.Sprintf("query %q has %d arguments but no placeholder %s", truncateSQL(query, 60), args, strings.Join(missing, ", "))
+	}
+	return ""
+}
+
+// stripSQLStrings returns sql with its quoted strings and identifiers
+// blanked, so a ? or $1 inside one isn't counted.
+func stripSQLStrings(sql string) string {
+	var b strings.Builder
+	var quote byte
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+			continue
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
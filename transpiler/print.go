@@ -0,0 +1,75 @@
+package transpiler
+
+import (
+	"fmt"
+
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// PRINT
+//
+// DMLConfig.PrintMode says what PRINT, and RAISERROR with a severity of
+// 10 or less, become. PrintFmt (the default) writes the message to stdout
+// with fmt.Println, or logs it with the SPLogger's LogMessage when
+// UseSPLogger is set, so batch jobs keep their progress output in
+// structured logs. PrintSlog logs it with slog.InfoContext, so the log
+// carries the request's context, and PrintDiscard drops it:
+//
+//	PRINT 'Batch ' + CAST(@n AS VARCHAR(10))
+//
+//	fmt.Println(("Batch " + fmt.Sprintf("%v", n)))                        // fmt
+//	spLogger.LogMessage(ctx, "Purge", ("Batch " + fmt.Sprintf("%v", n)))  // fmt, --splogger
+//	slog.InfoContext(ctx, ("Batch " + fmt.Sprintf("%v", n)))              // slog
+//	// PRINT 'Batch ' + CAST(@n AS VARCHAR(10)) (discarded)               // discard
+const (
+	PrintFmt     = "fmt"
+	PrintSlog    = "slog"
+	PrintDiscard = "discard"
+)
+
+func (t *transpiler) transpilePrint(print *ast.PrintStatement) (string, error) {
+	// Discarded before the expression is transpiled, which would count
+	// the variables it reads as used
+	if t.dmlConfig.PrintMode == PrintDiscard {
+		return discardedPrint(print), nil
+	}
+	expr, err := t.transpileExpression(print.Expression)
+	if err != nil {
+		return "", err
+	}
+
+	return t.printMessage(expr, t.inferType(print.Expression).isString), nil
+}
+
+// printMessage returns the statement printing msg.
+func (t *transpiler) printMessage(msg string, isString bool) string {
+	switch {
+	case t.dmlEnabled && t.dmlConfig.PrintMode == PrintSlog:
+		t.imports["log/slog"] = true
+	case t.dmlEnabled && t.dmlConfig.UseSPLogger:
+	default:
+		t.imports["fmt"] = true
+		return fmt.Sprintf("fmt.Println(%s)", msg)
+	}
+	if !isString {
+		t.imports["fmt"] = true
+		msg = fmt.Sprintf("fmt.Sprint(%s)", msg)
+	}
+	if t.dmlConfig.PrintMode == PrintSlog {
+		return fmt.Sprintf("slog.InfoContext(ctx, %s)", msg)
+	}
+	return fmt.Sprintf("%s.LogMessage(ctx, %q, %s)", t.dmlConfig.SPLoggerVar, t.currentProcName, msg)
+}
+
+// informational reports whether s only prints its message, which
+// RAISERROR does with a severity of 10 or less.
+func informational(s *ast.RaiserrorStatement) bool {
+	severity, ok := s.Severity.(*ast.IntegerLiteral)
+	return ok && severity.Value <= 10
+}
+
+// discardedPrint returns the comment left for a message PrintDiscard
+// drops.
+func discardedPrint(stmt ast.Statement) string {
+	return fmt.Sprintf("// %s (discarded)", truncateSQL(stmt.String(), 80))
+}
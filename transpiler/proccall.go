@@ -0,0 +1,371 @@
+package transpiler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// Procedure-call backend
+//
+// With Backend=procedure-call the procedures aren't ported: each becomes a
+// typed wrapper that runs the original procedure on SQL Server, for a data
+// access layer that works before the logic is migrated. Parameters and
+// result sets come from the procedure's contract (see contract.go):
+//
+//	// UspGetOrderRow is a row of the result set of usp_GetOrder.
+//	type UspGetOrderRow struct {
+//		OrderId int32
+//		Total   decimal.Decimal
+//	}
+//
+//	func (r *Repository) UspGetOrder(ctx context.Context, orderId int32) (rows []UspGetOrderRow, status string, returnCode int32, err error) {
+//		returnCode, err = tsqlruntime.QueryProcedure(ctx, r.db, tsqlruntime.DialectSQLServer, "dbo.usp_GetOrder", func(set int, rs *sql.Rows) error {
+//			...
+//		}, tsqlruntime.ProcParam{Name: "OrderID", Value: orderId}, tsqlruntime.ProcParam{Name: "Status", Value: &status, Output: true})
+//
+// Procedures without result sets use tsqlruntime.CallProcedure.
+//
+// A wrapper holds every row of a result set in memory before returning.
+// For large result sets, such as those the original procedures walked with
+// a cursor, RowsMode hands the rows to the caller as they're read instead.
+// RowsCallback takes a function per result set:
+//
+//	func (r *Repository) UspGetOrders(ctx context.Context, customerId int32, eachRow func(UspGetOrdersRow) error) (returnCode int32, err error)
+//
+// RowsIter returns an iterator (Go 1.23) for a range loop, through
+// tsqlruntime.ProcedureRows:
+//
+//	func (r *Repository) UspGetOrders(ctx context.Context, customerId int32) iter.Seq2[UspGetOrdersRow, error]
+//
+// An iterator has nowhere to put OUTPUT parameters or a RETURN value, so
+// procedures with them, or with more than one result set, take callbacks.
+
+// Rows modes
+const (
+	RowsSlice    = "slice"    // A slice per result set (default)
+	RowsCallback = "callback" // A function called with each row
+	RowsIter     = "iter"     // An iter.Seq2 of rows and errors
+)
+
+// transpileProcedureCalls generates the wrappers for the procedures in
+// program.
+func transpileProcedureCalls(program *ast.Program, source, packageName string, config DMLConfig) (*TranspileResult, error) {
+	var procs []*ast.CreateProcedureStatement
+	for _, stmt := range program.Statements {
+		if proc, ok := stmt.(*ast.CreateProcedureStatement); ok {
+			procs = append(procs, proc)
+		}
+	}
+	if len(procs) == 0 {
+		return nil, fmt.Errorf("no stored procedures found in input")
+	}
+
+	t := newTranspiler()
+	t.packageName = packageName
+	t.dmlConfig = config
+	t.dmlEnabled = true
+	if config.RowsMode == RowsIter && !t.goAtLeast(23) {
+		return nil, fmt.Errorf("iterators need Go 1.23 or later (--go-version=1.23)")
+	}
+	t.collectTableTypes(program)
+
+	// Result sets are inferred by transpiling the bodies. A body that
+	// doesn't transpile still gets a wrapper, without them.
+	contracts, err := ExtractContracts(source, config)
+	if err != nil || len(contracts) != len(procs) {
+		if err == nil {
+			err = fmt.Errorf("%d contracts for %d procedures", len(contracts), len(procs))
+		}
+		t.warnings = append(t.warnings, fmt.Sprintf("result sets not inferred, wrappers return none: %v", err))
+		contracts = nil
+		for _, proc := range procs {
+			c, err := t.signatureContract(proc)
+			if err != nil {
+				return nil, err
+			}
+			contracts = append(contracts, c)
+		}
+	}
+
+	var bodies []string
+	for i, proc := range procs {
+		bodies = append(bodies, t.procedureCallWrapper(proc, &contracts[i])...)
+	}
+	decls, err := t.declarePendingTableTypes()
+	if err != nil {
+		return nil, err
+	}
+	bodies = append(bodies, decls...)
+
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("package %s\n\n", packageName))
+	t.writeImports(&out)
+	out.WriteString(strings.Join(bodies, "\n\n"))
+	out.WriteString("\n")
+
+	result := &TranspileResult{
+		Code:       out.String(),
+		Warnings:   t.warnings,
+		Contracts:  contracts,
+		TableTypes: sortedKeys(t.declaredTableTypes),
+	}
+	return result, nil
+}
+
+// signatureContract is the contract of a procedure from its parameters
+// alone.
+func (t *transpiler) signatureContract(proc *ast.CreateProcedureStatement) (ProcedureContract, error) {
+	procName := proc.Name.Parts[len(proc.Name.Parts)-1].Value
+	c := ProcedureContract{Name: procName, GoName: goExportedIdentifier(procName)}
+	for _, p := range proc.Parameters {
+		goType, err := t.mapDataType(p.DataType)
+		if err != nil {
+			return c, fmt.Errorf("%s: parameter %s: %w", procName, p.Name, err)
+		}
+		param := ContractParam{
+			Name:    strings.TrimPrefix(p.Name, "@"),
+			GoName:  goIdentifier(strings.TrimPrefix(p.Name, "@")),
+			SQLType: p.DataType.String(),
+			GoType:  goType,
+		}
+		if p.Output {
+			c.Outputs = append(c.Outputs, param)
+		} else {
+			c.Inputs = append(c.Inputs, param)
+		}
+	}
+	return c, nil
+}
+
+// procedureCallWrapper returns the declarations for one procedure: a row
+// struct per result set and the wrapper function.
+func (t *transpiler) procedureCallWrapper(proc *ast.CreateProcedureStatement, c *ProcedureContract) []string {
+	t.imports["context"] = true
+	t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+
+	mode := t.rowsMode(c)
+	var decls []string
+	var results, names, callbacks, setVars, setTypes []string
+	for i, rs := range c.ResultSets {
+		typeName := c.RowType(i)
+		setVar := "rows"
+		if mode == RowsCallback {
+			setVar = "eachRow"
+		}
+		if len(c.ResultSets) > 1 {
+			setVar += strconv.Itoa(i + 1)
+		}
+		decls = append(decls, t.resultSetStruct(typeName, c.Name, i, len(c.ResultSets), rs))
+		setVars = append(setVars, setVar)
+		setTypes = append(setTypes, typeName)
+		switch mode {
+		case RowsSlice:
+			results = append(results, fmt.Sprintf("%s []%s", setVar, typeName))
+			names = append(names, setVar)
+		case RowsCallback:
+			callbacks = append(callbacks, fmt.Sprintf("%s func(%s) error", setVar, typeName))
+		}
+	}
+
+	params := []string{"ctx context.Context"}
+	store := t.dmlConfig.StoreVar
+	if t.dmlConfig.Style == StyleFunctions {
+		store = unqualifiedName(store)
+		params = append(params, store+" tsqlruntime.DBTX")
+	}
+	var procParams []string
+	for _, p := range proc.Parameters {
+		name := strings.TrimPrefix(p.Name, "@")
+		goName := goIdentifier(name)
+		goType := paramGoType(c, name)
+		if tt, ok := t.lookupTableType(p.DataType); ok {
+			goType = t.useTableType(tt)
+		}
+		t.addTypeImports(goType)
+		value := goName
+		if p.Output {
+			results = append(results, goName+" "+goType)
+			names = append(names, goName)
+			procParams = append(procParams, fmt.Sprintf("tsqlruntime.ProcParam{Name: %q, Value: &%s, Output: true}", name, goName))
+			continue
+		}
+		if tt, ok := t.lookupTableType(p.DataType); ok {
+			// Table-valued parameters aren't sent as TableParam rows here;
+			// the driver needs its own TVP type for them
+			value = fmt.Sprintf("%s(%q, %s)", tableParamFunc(tt), name, goName)
+			t.warnings = append(t.warnings, fmt.Sprintf(
+				"%s: table-valued parameter @%s is passed as a tsqlruntime.TableParam; convert it to the driver's TVP type", c.Name, name))
+		}
+		params = append(params, goName+" "+goType)
+		procParams = append(procParams, fmt.Sprintf("tsqlruntime.ProcParam{Name: %q, Value: %s}", name, value))
+	}
+	params = append(params, callbacks...)
+	results = append(results, "returnCode int32", "err error")
+	names = append(names, "returnCode", "err")
+
+	procName := proc.Name.String()
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("// %s runs the %s stored procedure.\n", c.GoName, procName))
+	switch mode {
+	case RowsCallback:
+		out.WriteString("// Each row is passed on as it's read; an error returned for it stops\n")
+		out.WriteString("// the reading and is returned.\n")
+	case RowsIter:
+		out.WriteString("// Its rows are read as the loop ranging over them asks for them.\n")
+	}
+	if t.dmlConfig.Style == StyleFunctions {
+		out.WriteString(fmt.Sprintf("func %s(", c.GoName))
+	} else {
+		out.WriteString(fmt.Sprintf("func (%s %s) %s(", t.dmlConfig.Receiver, t.dmlConfig.ReceiverType, c.GoName))
+	}
+	if mode == RowsIter {
+		t.imports["iter"] = true
+		out.WriteString(fmt.Sprintf("%s) iter.Seq2[%s, error] {\n", strings.Join(params, ", "), setTypes[0]))
+	} else {
+		out.WriteString(fmt.Sprintf("%s) (%s) {\n", strings.Join(params, ", "), strings.Join(results, ", ")))
+	}
+	switch {
+	case len(c.ResultSets) == 0:
+		out.WriteString(fmt.Sprintf("\treturnCode, err = tsqlruntime.CallProcedure(ctx, %s, tsqlruntime.DialectSQLServer, %q", store, procName))
+	case mode == RowsIter:
+		t.imports["database/sql"] = true
+		out.WriteString(fmt.Sprintf("\treturn tsqlruntime.ProcedureRows(ctx, %s, tsqlruntime.DialectSQLServer, %q, func(rs *sql.Rows) (row %s, err error) {\n", store, procName, setTypes[0]))
+		out.WriteString(fmt.Sprintf("\t\terr = rs.Scan(%s)\n", strings.Join(scanTargets(c.ResultSets[0]), ", ")))
+		out.WriteString("\t\treturn row, err\n")
+		out.WriteString("\t}")
+	default:
+		t.imports["database/sql"] = true
+		out.WriteString(fmt.Sprintf("\treturnCode, err = tsqlruntime.QueryProcedure(ctx, %s, tsqlruntime.DialectSQLServer, %q, func(set int, rs *sql.Rows) error {\n", store, procName))
+		out.WriteString("\t\tswitch set {\n")
+		for i, rs := range c.ResultSets {
+			out.WriteString(fmt.Sprintf("\t\tcase %d:\n", i))
+			out.WriteString("\t\t\tfor rs.Next() {\n")
+			out.WriteString(fmt.Sprintf("\t\t\t\tvar row %s\n", setTypes[i]))
+			out.WriteString(fmt.Sprintf("\t\t\t\tif err := rs.Scan(%s); err != nil {\n", strings.Join(scanTargets(rs), ", ")))
+			out.WriteString("\t\t\t\t\treturn err\n")
+			out.WriteString("\t\t\t\t}\n")
+			if mode == RowsCallback {
+				out.WriteString(fmt.Sprintf("\t\t\t\tif err := %s(row); err != nil {\n", setVars[i]))
+				out.WriteString("\t\t\t\t\treturn err\n")
+				out.WriteString("\t\t\t\t}\n")
+			} else {
+				out.WriteString(fmt.Sprintf("\t\t\t\t%s = append(%s, row)\n", setVars[i], setVars[i]))
+			}
+			out.WriteString("\t\t\t}\n")
+		}
+		out.WriteString("\t\t}\n")
+		out.WriteString("\t\treturn nil\n")
+		out.WriteString("\t}")
+	}
+	for _, p := range procParams {
+		out.WriteString(",\n\t\t" + p)
+	}
+	if len(procParams) > 0 {
+		out.WriteString(",\n\t")
+	}
+	out.WriteString(")\n")
+	if mode != RowsIter {
+		out.WriteString(fmt.Sprintf("\treturn %s\n", strings.Join(names, ", ")))
+	}
+	out.WriteString("}")
+	return append(decls, out.String())
+}
+
+// rowsMode returns how the wrapper for c returns its rows.
+func (t *transpiler) rowsMode(c *ProcedureContract) string {
+	mode := t.dmlConfig.RowsMode
+	switch {
+	case mode != RowsCallback && mode != RowsIter || len(c.ResultSets) == 0:
+		return RowsSlice
+	case mode == RowsIter && (len(c.ResultSets) > 1 || len(c.Outputs) > 0 || c.ReturnCode):
+		t.warnings = append(t.warnings, fmt.Sprintf(
+			"%s: several result sets, OUTPUT parameters or a return code don't fit an iterator; its rows are passed to callbacks", c.Name))
+		return RowsCallback
+	}
+	return mode
+}
+
+// scanTargets returns the arguments of the rs.Scan reading a row of a
+// result set into row.
+func scanTargets(rs ContractResultSet) []string {
+	var targets []string
+	for _, field := range rs.Fields() {
+		targets = append(targets, "tsqlruntime.Nullable(&row."+field+")")
+	}
+	return targets
+}
+
+// resultSetStruct declares the row type of a result set.
+func (t *transpiler) resultSetStruct(typeName, procName string, index, count int, rs ContractResultSet) string {
+	fields := rs.Fields()
+	width := 0
+	for _, f := range fields {
+		width = max(width, len(f))
+	}
+	var out strings.Builder
+	if count > 1 {
+		out.WriteString(fmt.Sprintf("// %s is a row of result set %d of %s.\n", typeName, index+1, procName))
+	} else {
+		out.WriteString(fmt.Sprintf("// %s is a row of the result set of %s.\n", typeName, procName))
+	}
+	out.WriteString(fmt.Sprintf("type %s struct {\n", typeName))
+	for i, col := range rs.Columns {
+		t.addTypeImports(col.GoType)
+		out.WriteString(fmt.Sprintf("\t%-*s %s\n", width, fields[i], col.GoType))
+	}
+	out.WriteString("}")
+	return out.String()
+}
+
+// RowType returns the name of the row struct the procedure-call backend
+// declares for result set i: <GoName>Row, or <GoName>Row1, <GoName>Row2,
+// ... when there are several.
+func (c *ProcedureContract) RowType(i int) string {
+	if len(c.ResultSets) > 1 {
+		return c.GoName + "Row" + strconv.Itoa(i+1)
+	}
+	return c.GoName + "Row"
+}
+
+// Fields returns the struct field of each column in the row struct of a
+// result set. Unnamed columns are Column1, Column2, ... by position.
+func (rs ContractResultSet) Fields() []string {
+	fields := make([]string, len(rs.Columns))
+	seen := map[string]bool{}
+	for i, col := range rs.Columns {
+		field := goExportedIdentifier(col.Name)
+		if field == "" || seen[field] {
+			field = fmt.Sprintf("Column%d", i+1)
+		}
+		seen[field] = true
+		fields[i] = field
+	}
+	return fields
+}
+
+// paramGoType returns the Go type of a procedure parameter in a contract.
+func paramGoType(c *ProcedureContract, name string) string {
+	for _, params := range [][]ContractParam{c.Inputs, c.Outputs} {
+		for _, p := range params {
+			if strings.EqualFold(p.Name, name) {
+				return p.GoType
+			}
+		}
+	}
+	return "interface{}"
+}
+
+// addTypeImports imports the packages a Go type from a contract refers to.
+func (t *transpiler) addTypeImports(goType string) {
+	switch {
+	case strings.Contains(goType, "decimal."):
+		t.imports["github.com/shopspring/decimal"] = true
+	case strings.Contains(goType, "apd."):
+		t.imports[apdImport] = true
+	case strings.Contains(goType, "time."):
+		t.imports["time"] = true
+	}
+}
@@ -0,0 +1,95 @@
+package transpiler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// Proto enums
+//
+// Status columns are often enums in the protos of a gRPC backend. With
+// DMLConfig.ProtoEnumFields, literals set in request fields of an enum
+// type become the enum's constants:
+//
+//	UPDATE Orders SET Status = 'SHIPPED' WHERE OrderID = @OrderID
+//
+//	resp, err := client.UpdateOrderStatus(ctx, &orderpb.UpdateOrderStatusRequest{
+//		Status:  orderpb.OrderStatus_ORDER_STATUS_SHIPPED,
+//		OrderId: orderId,
+//	})
+//
+// protogen.EnumFields builds the mapping from the protos: a string matches
+// a value's name with or without the enum's prefix (ORDER_STATUS_), with
+// spaces and hyphens as underscores and regardless of case, and an integer
+// matches its number. An overrides file maps other literals.
+
+// ProtoEnum is a proto enum, with the Go constants of its values by the SQL
+// literals that stand for them.
+type ProtoEnum struct {
+	Name   string            // Enum name, e.g. "OrderStatus"
+	Values map[string]string // EnumKey of a literal -> Go constant, e.g. "OrderStatus_ORDER_STATUS_SHIPPED"
+}
+
+// EnumKey returns the key of ProtoEnum.Values for a SQL string literal's
+// value. Integers are keyed by their decimal form.
+func EnumKey(s string) string {
+	return "'" + strings.ToUpper(strings.NewReplacer(" ", "_", "-", "_").Replace(strings.TrimSpace(s))) + "'"
+}
+
+// EnumFieldKey returns the key of DMLConfig.ProtoEnumFields for a field of
+// a request message, or with message "" for the field in every request.
+func EnumFieldKey(message, field string) string {
+	norm := func(s string) string {
+		return strings.ToLower(strings.ReplaceAll(s, "_", ""))
+	}
+	if message == "" {
+		return norm(field)
+	}
+	return norm(message) + "." + norm(field)
+}
+
+// grpcFieldValue returns the value of the field for column in a request to
+// method: the enum constant for a literal when the field is an enum, else
+// value, the Go code for expr. Without the request message in the protos,
+// the field is looked up in the table's entity message, then by name alone.
+func (dt *dmlTranspiler) grpcFieldValue(method, table, column, value string, expr ast.Expression, protoPackage string) string {
+	if len(dt.config.ProtoEnumFields) == 0 {
+		return value
+	}
+	var enum *ProtoEnum
+	for _, key := range []string{
+		EnumFieldKey(method+"Request", column),
+		EnumFieldKey(toPascalCase(singularize(table)), column),
+		EnumFieldKey("", column),
+	} {
+		if e, ok := dt.config.ProtoEnumFields[key]; ok {
+			enum = e
+			break
+		}
+	}
+	if enum == nil {
+		return value
+	}
+	var key string
+	switch lit := expr.(type) {
+	case *ast.StringLiteral:
+		key = EnumKey(lit.Value)
+	case *ast.IntegerLiteral:
+		key = strconv.FormatInt(lit.Value, 10)
+	default:
+		return value
+	}
+	constant, ok := enum.Values[key]
+	if !ok {
+		dt.warn(RuleUntranslated, fmt.Sprintf("%s: %s has no %s value for %s; it is kept as it is (see --enum-overrides)",
+			dt.currentProcName, expr.String(), enum.Name, column))
+		return value
+	}
+	if protoPackage != "" {
+		return protoPackage + "." + constant
+	}
+	return constant
+}
@@ -0,0 +1,291 @@
+package transpiler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// Redis backend
+//
+// Serves lookup-style statements from go-redis, storing each row as a hash
+// at "<table>:<key value>":
+//
+//	SELECT @a = Col FROM T WHERE Key = @k  -> HGetAll(ctx, "t:"+k).Scan(&doc)
+//	SELECT Col FROM T WHERE Key = @k       -> HGetAll(ctx, "t:"+k).Scan(&doc)
+//	INSERT INTO T (Key, Col) VALUES (...)  -> HSet(ctx, "t:"+k, "Key", k, "Col", v)
+//	DELETE FROM T WHERE Key = @k           -> Del(ctx, "t:"+k)
+//
+// Everything else, including UPDATE, statements inside a transaction and
+// any WHERE clause other than a single key equality, runs on the SQL
+// backend through StoreVar.
+
+// redisNativeTypes are the Go types go-redis can scan hash fields into.
+// Other types are scanned as strings and parsed.
+var redisNativeTypes = map[string]bool{
+	"string": true, "bool": true,
+	"int": true, "int8": true, "int16": true, "int32": true, "int64": true,
+	"uint8": true, "uint16": true, "uint32": true, "uint64": true,
+	"float32": true, "float64": true,
+}
+
+// redisKeyColumn reports whether column is the key of table: the column
+// configured with TableToRedisKey, or else ID, <Table>ID or <Singular>ID.
+func (dt *dmlTranspiler) redisKeyColumn(table, column string) bool {
+	for t, key := range dt.config.TableToRedisKey {
+		if strings.EqualFold(t, table) {
+			return strings.EqualFold(key, column)
+		}
+	}
+	for _, candidate := range []string{"ID", table + "ID", singularize(table) + "ID", strings.TrimSuffix(table, "s") + "ID"} {
+		if strings.EqualFold(candidate, column) {
+			return true
+		}
+	}
+	return false
+}
+
+// redisKey returns the Go expression for the hash key holding a row.
+func (dt *dmlTranspiler) redisKey(table string, value ast.Expression) string {
+	dt.imports["fmt"] = true
+	return fmt.Sprintf("fmt.Sprintf(\"%s:%%v\", %s)", goUnexportedIdentifier(table), dt.exprToGoValue(value))
+}
+
+// redisLookupKey returns the key value of a WHERE clause that compares the
+// table's key column with a value, or nil if the clause is anything else.
+func (dt *dmlTranspiler) redisLookupKey(table string, where ast.Expression) ast.Expression {
+	infix, ok := where.(*ast.InfixExpression)
+	if !ok || infix.Operator != "=" {
+		return nil
+	}
+	col, value := infix.Left, infix.Right
+	if referencesColumn(value) {
+		col, value = value, col
+	}
+	field, err := exprColumnName(col)
+	if err != nil || referencesColumn(value) || !dt.redisKeyColumn(table, field) {
+		return nil
+	}
+	return value
+}
+
+func (dt *dmlTranspiler) transpileSelectRedis(s *ast.SelectStatement) (string, error) {
+	table := dt.extractMainTable(s)
+	if dt.inTransaction || s.From == nil || len(s.From.Tables) != 1 || s.Where == nil ||
+		len(s.GroupBy) > 0 || s.Having != nil || s.Union != nil || s.Into != nil || s.Top != nil || s.Distinct {
+		return dt.transpileSelectSQL(s)
+	}
+	key := dt.redisLookupKey(table, s.Where)
+	if key == nil {
+		return dt.transpileSelectSQL(s)
+	}
+
+	var fields []redisField
+	for i, col := range s.Columns {
+		if col.AllColumns {
+			return dt.transpileSelectSQL(s)
+		}
+		field, err := exprColumnName(col.Expression)
+		if err != nil {
+			return dt.transpileSelectSQL(s)
+		}
+		f := redisField{name: fmt.Sprintf("F%d", i), column: field}
+		if col.Variable != nil {
+			f.target = goIdentifier(strings.TrimPrefix(col.Variable.Name, "@"))
+			if ti := dt.symbols.lookup(f.target); ti != nil {
+				f.goType = ti.goType
+			}
+		} else {
+			name := field
+			if col.Alias != nil {
+				name = col.Alias.Value
+			}
+			f.local = goIdentifier(name)
+			if ti := dt.inferType(col.Expression); ti != nil {
+				f.goType = ti.goType
+			}
+		}
+		if f.goType == "" {
+			f.goType = "string"
+		}
+		fields = append(fields, f)
+	}
+	// A SELECT must either assign every column or none
+	if fields[0].target == "" {
+		var cols []ContractColumn
+		for _, f := range fields {
+			if f.target != "" {
+				return dt.transpileSelectSQL(s)
+			}
+			cols = append(cols, ContractColumn{Name: f.column, GoType: f.goType})
+		}
+		dt.recordResultSet(cols)
+	}
+
+	var out strings.Builder
+	if dt.emitOriginal() {
+		out.WriteString(fmt.Sprintf("// Original: %s\n", truncateSQL(s.String(), 100)))
+		out.WriteString(dt.indentStr())
+	}
+	ind := dt.indentStr()
+	out.WriteString("{\n")
+	out.WriteString(fmt.Sprintf("%s\tres := %s.HGetAll(ctx, %s)\n", ind, dt.config.RedisClientVar, dt.redisKey(table, key)))
+	out.WriteString(ind + "\tif err := res.Err(); err != nil {\n")
+	out.WriteString(ind + "\t\t" + dt.buildErrorReturn() + "\n")
+	out.WriteString(ind + "\t}\n")
+	// An empty hash means no row, which leaves variables unchanged
+	out.WriteString(ind + "\tif len(res.Val()) > 0 {\n")
+	width := 0
+	for _, f := range fields {
+		if len(f.scanType()) > width {
+			width = len(f.scanType())
+		}
+	}
+	out.WriteString(ind + "\t\tvar doc struct {\n")
+	for _, f := range fields {
+		out.WriteString(fmt.Sprintf("%s\t\t\t%s %-*s `redis:%q`\n", ind, f.name, width, f.scanType(), f.column))
+	}
+	out.WriteString(ind + "\t\t}\n")
+	out.WriteString(ind + "\t\tif err := res.Scan(&doc); err != nil {\n")
+	out.WriteString(ind + "\t\t\t" + dt.buildErrorReturn() + "\n")
+	out.WriteString(ind + "\t\t}\n")
+	for _, f := range fields {
+		dt.writeRedisAssign(&out, ind+"\t\t", f)
+	}
+	if dt.usesRowCount {
+		out.WriteString(ind + "\t\trowsAffected = 1\n")
+		out.WriteString(ind + "\t} else {\n")
+		out.WriteString(ind + "\t\trowsAffected = 0\n")
+	}
+	out.WriteString(ind + "\t}\n")
+	out.WriteString(ind + "}")
+	return out.String(), nil
+}
+
+// redisField is a hash field decoded by a SELECT, assigned either to a
+// variable (target) or to a result column local.
+type redisField struct {
+	name, column, goType string
+	target, local        string
+}
+
+func (f redisField) scanType() string {
+	if redisNativeTypes[f.goType] {
+		return f.goType
+	}
+	return "string"
+}
+
+// writeRedisAssign copies a decoded field to its variable, parsing types
+// go-redis can't scan.
+func (dt *dmlTranspiler) writeRedisAssign(out *strings.Builder, ind string, f redisField) {
+	value := "doc." + f.name
+	var parse string
+	switch f.goType {
+	case "decimal.Decimal":
+		parse = fmt.Sprintf("decimal.NewFromString(%s)", value)
+	case "apd.Decimal":
+		parse = fmt.Sprintf("func() (apd.Decimal, error) { var d apd.Decimal; _, _, err := d.SetString(%s); return d, err }()", value)
+	case "time.Time":
+		dt.imports["time"] = true
+		parse = fmt.Sprintf("time.Parse(time.RFC3339Nano, %s)", value)
+	}
+
+	if parse == "" {
+		if f.target != "" {
+			out.WriteString(fmt.Sprintf("%s%s = %s\n", ind, f.target, value))
+		} else {
+			out.WriteString(fmt.Sprintf("%s%s := %s\n%s_ = %s\n", ind, f.local, value, ind, f.local))
+		}
+		return
+	}
+
+	target := f.target
+	if target == "" {
+		target = f.local
+		out.WriteString(fmt.Sprintf("%svar %s %s\n", ind, target, f.goType))
+	}
+	out.WriteString(fmt.Sprintf("%sif %s != \"\" {\n", ind, value))
+	out.WriteString(fmt.Sprintf("%s\tv, err := %s\n", ind, parse))
+	out.WriteString(ind + "\tif err != nil {\n")
+	out.WriteString(ind + "\t\t" + dt.buildErrorReturn() + "\n")
+	out.WriteString(ind + "\t}\n")
+	out.WriteString(fmt.Sprintf("%s\t%s = v\n", ind, target))
+	out.WriteString(ind + "}\n")
+	if f.target == "" {
+		out.WriteString(fmt.Sprintf("%s_ = %s\n", ind, target))
+	}
+}
+
+func (dt *dmlTranspiler) transpileInsertRedis(s *ast.InsertStatement) (string, error) {
+	table := dt.extractInsertTable(s)
+	if dt.inTransaction || s.Select != nil || len(s.Values) != 1 || len(s.Columns) != len(s.Values[0]) || s.Output != nil {
+		return dt.transpileInsertSQL(s)
+	}
+
+	var key ast.Expression
+	var args []string
+	for i, col := range s.Columns {
+		value := s.Values[0][i]
+		if referencesColumn(value) {
+			return dt.transpileInsertSQL(s)
+		}
+		if key == nil && dt.redisKeyColumn(table, col.Value) {
+			key = value
+		}
+		goValue := dt.exprToGoValue(value)
+		// Decimals would otherwise be written in their binary encoding
+		if ti := dt.inferType(value); ti != nil && ti.isDecimal {
+			goValue = dt.decimalToString(goValue)
+		}
+		args = append(args, fmt.Sprintf("%q, %s", col.Value, goValue))
+	}
+	if key == nil {
+		return dt.transpileInsertSQL(s)
+	}
+
+	call := fmt.Sprintf("%s.HSet(ctx, %s, %s)", dt.config.RedisClientVar, dt.redisKey(table, key), strings.Join(args, ", "))
+	return dt.redisWrite(s, call, "1")
+}
+
+func (dt *dmlTranspiler) transpileDeleteRedis(s *ast.DeleteStatement) (string, error) {
+	table := dt.extractDeleteTable(s)
+	if dt.inTransaction || s.From != nil || s.Top != nil || s.Output != nil || s.CurrentOfCursor != nil {
+		return dt.transpileDeleteSQL(s)
+	}
+	key := dt.redisLookupKey(table, s.Where)
+	if key == nil {
+		return dt.transpileDeleteSQL(s)
+	}
+
+	call := fmt.Sprintf("%s.Del(ctx, %s)", dt.config.RedisClientVar, dt.redisKey(table, key))
+	return dt.redisWrite(s, call, "int32(n)")
+}
+
+// redisWrite emits a write command, capturing @@ROWCOUNT when the
+// procedure uses it. rowCount may refer to n, the command's result.
+func (dt *dmlTranspiler) redisWrite(stmt ast.Node, call, rowCount string) (string, error) {
+	var out strings.Builder
+	if dt.emitOriginal() {
+		out.WriteString(fmt.Sprintf("// Original: %s\n", truncateSQL(stmt.String(), 100)))
+		out.WriteString(dt.indentStr())
+	}
+	ind := dt.indentStr()
+	if !dt.usesRowCount {
+		out.WriteString(fmt.Sprintf("if err := %s.Err(); err != nil {\n", call))
+		out.WriteString(ind + "\t" + dt.buildErrorReturn() + "\n")
+		out.WriteString(ind + "}")
+		return out.String(), nil
+	}
+	result := "_"
+	if strings.Contains(rowCount, "(n)") {
+		result = "n"
+	}
+	out.WriteString(fmt.Sprintf("if %s, err := %s.Result(); err != nil {\n", result, call))
+	out.WriteString(ind + "\t" + dt.buildErrorReturn() + "\n")
+	out.WriteString(ind + "} else {\n")
+	out.WriteString(fmt.Sprintf("%s\trowsAffected = %s\n", ind, rowCount))
+	out.WriteString(ind + "}")
+	return out.String(), nil
+}
@@ -0,0 +1,343 @@
+package transpiler
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Repository scaffolding
+//
+// Generated methods hang off a receiver (r *Repository) and reach their
+// dependencies through it: r.db, r.redis, r.events and so on. GenerateRepository
+// reads the generated code back and writes the pieces that were left to
+// the user: the struct with one field per dependency, a constructor, and
+// an interface listing every generated method for mocking.
+
+// RepositoryField is a dependency of the generated methods.
+type RepositoryField struct {
+	Name   string // field name, e.g. "db"
+	GoType string // e.g. "*sql.DB"; "any" when it can't be told from the config
+}
+
+// repoFieldTypes are the Go types (and their import paths) of the
+// dependencies the transpiler knows about.
+var repoFieldTypes = map[string][2]string{
+	"sql":      {"*sql.DB", "database/sql"},
+	"mongo":    {"*mongo.Database", "go.mongodb.org/mongo-driver/mongo"},
+	"redis":    {"*redis.Client", "github.com/redis/go-redis/v9"},
+	"events":   {"tsqlruntime.EventPublisher", "github.com/ha1tch/tgpiler/tsqlruntime"},
+	"splogger": {"tsqlruntime.SPLogger", "github.com/ha1tch/tgpiler/tsqlruntime"},
+	"notifier": {"tsqlruntime.Notifier", "github.com/ha1tch/tgpiler/tsqlruntime"},
+	"tracer":   {"tsqlruntime.Tracer", "github.com/ha1tch/tgpiler/tsqlruntime"},
+	"metrics":  {"tsqlruntime.Metrics", "github.com/ha1tch/tgpiler/tsqlruntime"},
+}
+
+// repoFieldKind says which kind of dependency a receiver field is, or ""
+// when the config doesn't say.
+func repoFieldKind(config DMLConfig, ref string) string {
+	switch ref {
+	case config.StoreVar:
+		switch config.Backend {
+		case BackendSQL, BackendRedis, BackendInline, BackendProcedureCall, "":
+			return "sql"
+		case BackendMongo:
+			return "mongo"
+		}
+	case config.MongoDatabaseVar:
+		return "mongo"
+	case config.RedisClientVar:
+		return "redis"
+	case config.EventPublisherVar:
+		return "events"
+	case config.SPLoggerVar:
+		return "splogger"
+	case config.NotifierVar:
+		return "notifier"
+	case config.TracerVar:
+		return "tracer"
+	case config.MetricsVar:
+		return "metrics"
+	}
+	return ""
+}
+
+// repoMethod is an exported method of the receiver type.
+type repoMethod struct {
+	name     string
+	sig      string   // signature without "func", e.g. "(ctx context.Context) error"
+	args     []string // parameter names, to forward a call
+	variadic bool
+	results  bool
+}
+
+// repoScan is what the generated code says about the receiver type.
+type repoScan struct {
+	typeName string
+	methods  []repoMethod
+	fields   []RepositoryField
+	imports  map[string]bool
+}
+
+// importName returns the name an import of path is assumed to be used by,
+// as goimports assumes it: a major version element is skipped
+// (github.com/cockroachdb/apd/v3 is apd), a go- prefix dropped
+// (github.com/redis/go-redis/v9 is redis) and the name ends where it stops
+// being an identifier (gopkg.in/yaml.v3 is yaml).
+func importName(path string) string {
+	elems := strings.Split(path, "/")
+	name := elems[len(elems)-1]
+	if len(elems) > 1 && strings.HasPrefix(name, "v") {
+		if _, err := strconv.Atoi(name[1:]); err == nil {
+			name = elems[len(elems)-2]
+		}
+	}
+	name = strings.TrimPrefix(name, "go-")
+	if i := strings.IndexFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	}); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// scanReceiver finds the exported methods of config.ReceiverType in code,
+// the receiver fields they use, and the imports their signatures and the
+// field types need.
+func scanReceiver(code []string, config DMLConfig) (*repoScan, error) {
+	if config.Style == StyleFunctions || config.Receiver == "" {
+		return nil, fmt.Errorf("repository generation needs methods style (a receiver)")
+	}
+	scan := &repoScan{
+		typeName: strings.TrimPrefix(config.ReceiverType, "*"),
+		imports:  map[string]bool{},
+	}
+	seenMethod := map[string]bool{}
+	fieldSet := map[string]bool{}
+
+	fset := token.NewFileSet()
+	for i, src := range code {
+		file, err := parser.ParseFile(fset, fmt.Sprintf("file%d.go", i+1), src, 0)
+		if err != nil {
+			return nil, fmt.Errorf("parsing generated code: %w", err)
+		}
+		pkgPaths := map[string]string{}
+		for _, imp := range file.Imports {
+			path, _ := strconv.Unquote(imp.Path.Value)
+			name := importName(path)
+			if imp.Name != nil {
+				name = imp.Name.Name
+			}
+			pkgPaths[name] = path
+		}
+
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Recv == nil || len(fn.Recv.List) != 1 || !fn.Name.IsExported() {
+				continue
+			}
+			recv := fn.Recv.List[0]
+			if types.ExprString(recv.Type) != config.ReceiverType || len(recv.Names) != 1 {
+				continue
+			}
+			recvName := recv.Names[0].Name
+
+			if !seenMethod[fn.Name.Name] {
+				seenMethod[fn.Name.Name] = true
+				m := repoMethod{name: fn.Name.Name, results: fn.Type.Results != nil && len(fn.Type.Results.List) > 0}
+				// Unnamed parameters get names so a mock can forward them
+				for j, param := range fn.Type.Params.List {
+					if len(param.Names) == 0 {
+						param.Names = []*ast.Ident{ast.NewIdent(fmt.Sprintf("p%d", j))}
+					}
+					for _, name := range param.Names {
+						m.args = append(m.args, name.Name)
+					}
+					if _, ok := param.Type.(*ast.Ellipsis); ok {
+						m.variadic = true
+					}
+				}
+				var sig bytes.Buffer
+				if err := printer.Fprint(&sig, fset, fn.Type); err != nil {
+					return nil, err
+				}
+				m.sig = strings.TrimPrefix(sig.String(), "func")
+				scan.methods = append(scan.methods, m)
+				ast.Inspect(fn.Type, func(n ast.Node) bool {
+					if sel, ok := n.(*ast.SelectorExpr); ok {
+						if pkg, ok := sel.X.(*ast.Ident); ok && pkgPaths[pkg.Name] != "" {
+							scan.imports[pkgPaths[pkg.Name]] = true
+						}
+					}
+					return true
+				})
+			}
+			if fn.Body != nil {
+				ast.Inspect(fn.Body, func(n ast.Node) bool {
+					if sel, ok := n.(*ast.SelectorExpr); ok {
+						if id, ok := sel.X.(*ast.Ident); ok && id.Name == recvName {
+							fieldSet[sel.Sel.Name] = true
+						}
+					}
+					return true
+				})
+			}
+		}
+	}
+	if len(scan.methods) == 0 {
+		return nil, fmt.Errorf("no %s methods found in the generated code", config.ReceiverType)
+	}
+
+	// Receiver selectors that aren't methods are fields. The store comes
+	// first and the logger last, the rest in name order.
+	rank := func(f RepositoryField) int {
+		switch config.Receiver + "." + f.Name {
+		case config.StoreVar:
+			return 0
+		case config.SPLoggerVar:
+			return 2
+		}
+		return 1
+	}
+	for name := range fieldSet {
+		if seenMethod[name] {
+			continue
+		}
+		f := RepositoryField{Name: name, GoType: "any"}
+		if kind := repoFieldKind(config, config.Receiver+"."+name); kind != "" {
+			f.GoType = repoFieldTypes[kind][0]
+		}
+		scan.fields = append(scan.fields, f)
+	}
+	sort.Slice(scan.fields, func(i, j int) bool {
+		if rank(scan.fields[i]) != rank(scan.fields[j]) {
+			return rank(scan.fields[i]) < rank(scan.fields[j])
+		}
+		return scan.fields[i].Name < scan.fields[j].Name
+	})
+	return scan, nil
+}
+
+// GenerateRepository returns Go source declaring the receiver type used by
+// code (the output of TranspileWithDML for one or more files), its
+// constructor and an interface of its methods. Fields whose type can't be
+// told from config are declared as any with a TODO.
+func GenerateRepository(code []string, packageName string, config DMLConfig) (string, error) {
+	return generateRepository(code, packageName, config, true)
+}
+
+// GenerateRepositoryStruct is GenerateRepository without the interface, for
+// use alongside GenerateInterface.
+func GenerateRepositoryStruct(code []string, packageName string, config DMLConfig) (string, error) {
+	return generateRepository(code, packageName, config, false)
+}
+
+func generateRepository(code []string, packageName string, config DMLConfig, withInterface bool) (string, error) {
+	scan, err := scanReceiver(code, config)
+	if err != nil {
+		return "", err
+	}
+	typeName := scan.typeName
+	imports := scan.imports
+	if !withInterface {
+		imports = map[string]bool{}
+	}
+	for _, f := range scan.fields {
+		if kind := repoFieldKind(config, config.Receiver+"."+f.Name); kind != "" {
+			imports[repoFieldTypes[kind][1]] = true
+		}
+	}
+
+	var out strings.Builder
+	writeScaffoldHeader(&out, packageName, imports)
+
+	out.WriteString(fmt.Sprintf("// %s holds the dependencies of the generated procedures.\n", typeName))
+	out.WriteString(fmt.Sprintf("type %s struct {\n", typeName))
+	for _, f := range scan.fields {
+		out.WriteString(fmt.Sprintf("\t%s %s", f.Name, f.GoType))
+		if f.GoType == "any" {
+			out.WriteString(fmt.Sprintf(" // TODO(tgpiler): set the type of %s.%s", config.Receiver, f.Name))
+		}
+		out.WriteString("\n")
+	}
+	out.WriteString("}\n\n")
+
+	var params, assigns []string
+	for _, f := range scan.fields {
+		params = append(params, fmt.Sprintf("%s %s", f.Name, f.GoType))
+		assigns = append(assigns, fmt.Sprintf("%s: %s", f.Name, f.Name))
+	}
+	out.WriteString(fmt.Sprintf("// New%s returns a %s using the given dependencies.\n", typeName, typeName))
+	out.WriteString(fmt.Sprintf("func New%s(%s) *%s {\n", typeName, strings.Join(params, ", "), typeName))
+	out.WriteString(fmt.Sprintf("\treturn &%s{%s}\n", typeName, strings.Join(assigns, ", ")))
+	out.WriteString("}\n")
+
+	if withInterface {
+		out.WriteString("\n")
+		writeRepoInterface(&out, scan, config)
+	}
+	return formatScaffold(out.String(), "repository")
+}
+
+// writeScaffoldHeader writes the generated-code header, package clause and
+// imports, standard library first as goimports would.
+func writeScaffoldHeader(out *strings.Builder, packageName string, imports map[string]bool) {
+	out.WriteString("// Code generated by tgpiler. DO NOT EDIT.\n\n")
+	out.WriteString(fmt.Sprintf("package %s\n\n", packageName))
+	if len(imports) == 0 {
+		return
+	}
+	paths := make([]string, 0, len(imports))
+	for path := range imports {
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		iStd := !strings.Contains(strings.Split(paths[i], "/")[0], ".")
+		jStd := !strings.Contains(strings.Split(paths[j], "/")[0], ".")
+		if iStd != jStd {
+			return iStd
+		}
+		return paths[i] < paths[j]
+	})
+	out.WriteString("import (\n")
+	thirdParty := false
+	for i, path := range paths {
+		if strings.Contains(strings.Split(path, "/")[0], ".") && !thirdParty {
+			thirdParty = true
+			if i > 0 {
+				out.WriteString("\n")
+			}
+		}
+		out.WriteString(fmt.Sprintf("\t%q\n", path))
+	}
+	out.WriteString(")\n\n")
+}
+
+// writeRepoInterface writes the <Type>API interface and the assertion that
+// the receiver type implements it.
+func writeRepoInterface(out *strings.Builder, scan *repoScan, config DMLConfig) {
+	out.WriteString(fmt.Sprintf("// %sAPI lists the generated procedures, so callers can depend on an\n// interface and substitute a mock in tests.\n", scan.typeName))
+	out.WriteString(fmt.Sprintf("type %sAPI interface {\n", scan.typeName))
+	for _, m := range scan.methods {
+		out.WriteString(fmt.Sprintf("\t%s%s\n", m.name, m.sig))
+	}
+	out.WriteString("}\n\n")
+	out.WriteString(fmt.Sprintf("var _ %sAPI = (%s)(nil)\n", scan.typeName, config.ReceiverType))
+}
+
+func formatScaffold(src, what string) (string, error) {
+	formatted, err := format.Source([]byte(src))
+	if err != nil {
+		return "", fmt.Errorf("formatting %s: %w", what, err)
+	}
+	return string(formatted), nil
+}
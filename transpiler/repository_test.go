@@ -0,0 +1,168 @@
+package transpiler
+
+import (
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+func TestGenerateRepository(t *testing.T) {
+	source := `
+CREATE PROCEDURE dbo.GetCustomer @CustomerID INT, @Name NVARCHAR(100) OUTPUT
+AS
+BEGIN
+    SELECT @Name = Name FROM Customers WHERE CustomerID = @CustomerID
+END
+GO
+CREATE PROCEDURE dbo.PlaceOrder @OrderID INT, @Amount DECIMAL(10,2)
+AS
+BEGIN
+    INSERT INTO Orders (OrderID, Amount) VALUES (@OrderID, @Amount)
+    INSERT INTO EventQueue (OrderID) VALUES (@OrderID)
+END
+`
+	config := DefaultDMLConfig()
+	config.TableToEvent = map[string]string{"EventQueue": "orders"}
+	code, err := TranspileWithDML(source, "store", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+	// A second file whose method uses a dependency the config doesn't know
+	other := `package store
+
+import "context"
+
+func (r *Repository) Ping(ctx context.Context) error {
+	return r.health.Check(ctx)
+}
+
+func (r *Repository) helper() {}
+`
+	repo, err := GenerateRepository([]string{code, other}, "store", config)
+	if err != nil {
+		t.Fatalf("GenerateRepository failed: %v", err)
+	}
+	for _, want := range []string{
+		"package store",
+		"\"database/sql\"\n\n\t\"github.com/ha1tch/tgpiler/tsqlruntime\"",
+		"\tdb     *sql.DB\n",
+		"\tevents tsqlruntime.EventPublisher\n",
+		"health any // TODO(tgpiler): set the type of r.health",
+		"func NewRepository(db *sql.DB, events tsqlruntime.EventPublisher, health any) *Repository {",
+		"GetCustomer(ctx context.Context, customerId int32) (name string, err error)",
+		"PlaceOrder(ctx context.Context, orderId int32, amount decimal.Decimal) (err error)",
+		"Ping(ctx context.Context) error",
+		"var _ RepositoryAPI = (*Repository)(nil)",
+	} {
+		if !strings.Contains(repo, want) {
+			t.Errorf("expected %q in:\n%s", want, repo)
+		}
+	}
+	if strings.Contains(repo, "helper") {
+		t.Errorf("unexported methods should not be in the interface:\n%s", repo)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "repository.go", repo, 0); err != nil {
+		t.Errorf("generated repository doesn't parse: %v", err)
+	}
+
+	config.Style = StyleFunctions
+	if _, err := GenerateRepository([]string{code}, "store", config); err == nil {
+		t.Error("expected an error for functional style")
+	}
+}
+
+func TestGenerateRepositoryVersionedImport(t *testing.T) {
+	source := `
+CREATE PROCEDURE dbo.PlaceOrder @OrderID INT, @Amount DECIMAL(10,2)
+AS
+BEGIN
+    INSERT INTO Orders (OrderID, Amount) VALUES (@OrderID, @Amount)
+END
+`
+	config := DefaultDMLConfig()
+	config.DecimalMode = DecimalAPD
+	code, err := TranspileWithDML(source, "store", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDML failed: %v", err)
+	}
+	repo, err := GenerateRepository([]string{code}, "store", config)
+	if err != nil {
+		t.Fatalf("GenerateRepository failed: %v", err)
+	}
+	for _, want := range []string{
+		"\"github.com/cockroachdb/apd/v3\"",
+		"PlaceOrder(ctx context.Context, orderId int32, amount apd.Decimal) (err error)",
+	} {
+		if !strings.Contains(repo, want) {
+			t.Errorf("expected %q in:\n%s", want, repo)
+		}
+	}
+
+	for path, want := range map[string]string{
+		"github.com/cockroachdb/apd/v3": "apd",
+		"github.com/redis/go-redis/v9":  "redis",
+		"gopkg.in/yaml.v3":              "yaml",
+		"database/sql":                  "sql",
+		"example.com/v2api":             "v2api",
+		"v3":                            "v3",
+	} {
+		if got := importName(path); got != want {
+			t.Errorf("importName(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestGenerateInterface(t *testing.T) {
+	code := `package store
+
+import "context"
+
+func (r *Repository) GetName(ctx context.Context, m int32) (name string, err error) {
+	return "", r.db.PingContext(ctx)
+}
+
+func (r *Repository) Touch(ctx context.Context, ids ...int32) {}
+`
+	config := DefaultDMLConfig()
+
+	iface, err := GenerateInterface([]string{code}, "store", config, MockFunc)
+	if err != nil {
+		t.Fatalf("GenerateInterface failed: %v", err)
+	}
+	for _, want := range []string{
+		"GetName(ctx context.Context, m int32) (name string, err error)",
+		"var _ RepositoryAPI = (*Repository)(nil)",
+		"\tTouchFunc   func(ctx context.Context, ids ...int32)\n",
+		"func (mock *RepositoryMock) GetName(ctx context.Context, m int32) (name string, err error) {",
+		"return mock.GetNameFunc(ctx, m)",
+		"\tm.TouchFunc(ctx, ids...)\n",
+		"var _ RepositoryAPI = (*RepositoryMock)(nil)",
+	} {
+		if !strings.Contains(iface, want) {
+			t.Errorf("expected %q in:\n%s", want, iface)
+		}
+	}
+	if strings.Contains(iface, "type Repository struct") || strings.Contains(iface, "database/sql") {
+		t.Errorf("expected only the interface and mock:\n%s", iface)
+	}
+
+	iface, err = GenerateInterface([]string{code}, "store", config, MockGomock)
+	if err != nil {
+		t.Fatalf("GenerateInterface failed: %v", err)
+	}
+	if !strings.Contains(iface, "//go:generate mockgen -source=$GOFILE -destination=repository_mock.go -package=store") {
+		t.Errorf("expected a mockgen stanza in:\n%s", iface)
+	}
+	if _, err := GenerateInterface([]string{code}, "store", config, "mockery"); err == nil {
+		t.Error("expected an error for an unknown mock kind")
+	}
+
+	repo, err := GenerateRepositoryStruct([]string{code}, "store", config)
+	if err != nil {
+		t.Fatalf("GenerateRepositoryStruct failed: %v", err)
+	}
+	if strings.Contains(repo, "RepositoryAPI") || strings.Contains(repo, "\"context\"") {
+		t.Errorf("expected no interface in:\n%s", repo)
+	}
+}
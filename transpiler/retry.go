@@ -0,0 +1,443 @@
+package transpiler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// Transaction retry
+//
+// With DMLConfig.RetryAttempts set, a BEGIN TRANSACTION ... COMMIT run in
+// one statement list becomes a closure retried by tsqlruntime.Retry when it
+// fails with a transient error of the target dialect:
+//
+//	// BEGIN TRANSACTION (retried on transient errors)
+//	if err := tsqlruntime.Retry(ctx, tsqlruntime.NewRetryPolicy("postgres", 3, 100*time.Millisecond), func() error {
+//		tx, err := r.db.BeginTx(ctx, nil)
+//		if err != nil {
+//			return err
+//		}
+//		defer tx.Rollback()
+//		...
+//		// COMMIT TRANSACTION
+//		return tx.Commit()
+//	}); err != nil {
+//		return err
+//	}
+//
+// The deferred Rollback undoes a failed attempt before the next one, and
+// is a no-op after Commit. A RETURN in the closure sets the named results
+// and returns tsqlruntime.ErrReturn, which ends the retries and the
+// procedure with them:
+//
+//	}); err == tsqlruntime.ErrReturn {
+//		return returnCode, nil
+//	} else if err != nil {
+//		return err
+//	}
+//
+// Procedures that already retry by hand, in a WHILE loop around a TRY
+// whose CATCH checks ERROR_NUMBER() for 1205, get the same closure when
+// the loop's shape is the usual one (see retryLoop), and a warning when
+// it isn't.
+
+// defaultRetryBackoff is the first delay when DMLConfig.RetryBackoff is 0.
+const defaultRetryBackoff = 100 * time.Millisecond
+
+// retriedTransaction returns the number of statements from stmts[i] that
+// make up a transaction to retry, or 0: a BEGIN TRANSACTION, the
+// statements after it, and the first COMMIT in the same list.
+func (t *transpiler) retriedTransaction(stmts []ast.Statement, i int) int {
+	if !t.dmlEnabled || t.dmlConfig.RetryAttempts < 2 || !t.inProcBody ||
+		t.inTransaction || t.inCatchBlock || t.dmlConfig.Backend == BackendMongo {
+		return 0
+	}
+	if _, ok := stmts[i].(*ast.BeginTransactionStatement); !ok {
+		return 0
+	}
+	for j := i + 1; j < len(stmts); j++ {
+		switch stmts[j].(type) {
+		case *ast.CommitTransactionStatement:
+			return j - i + 1
+		case *ast.BeginTransactionStatement:
+			return 0
+		}
+		if t.statementUsesTransactions(stmts[j]) {
+			return 0
+		}
+	}
+	return 0
+}
+
+// transpileRetriedTransaction transpiles a run found by retriedTransaction.
+func (t *transpiler) transpileRetriedTransaction(stmts []ast.Statement) (string, error) {
+	backoff := t.dmlConfig.RetryBackoff
+	if backoff <= 0 {
+		backoff = defaultRetryBackoff
+	}
+	return t.transpileRetry("// BEGIN TRANSACTION (retried on transient errors)\n", stmts, t.dmlConfig.RetryAttempts, backoff)
+}
+
+// transpileRetry transpiles stmts as a closure tsqlruntime.Retry calls up
+// to attempts times. When stmts are a BEGIN TRANSACTION, the statements
+// after it and a COMMIT, each attempt runs in a transaction of its own.
+// The statements are transpiled as a TRY block is, so their errors return
+// from the closure.
+func (t *transpiler) transpileRetry(comment string, stmts []ast.Statement, attempts int, backoff time.Duration) (string, error) {
+	t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+	t.imports["time"] = true
+	args := []string{fmt.Sprintf("%q", t.dmlConfig.SQLDialect), fmt.Sprint(attempts), goDuration(backoff)}
+	for _, code := range t.dmlConfig.RetryOn {
+		args = append(args, fmt.Sprintf("%q", code))
+	}
+
+	_, begins := stmts[0].(*ast.BeginTransactionStatement)
+	_, commits := stmts[len(stmts)-1].(*ast.CommitTransactionStatement)
+	inTx := begins && commits && len(stmts) > 1
+
+	var out strings.Builder
+	out.WriteString(comment)
+	out.WriteString(t.indentStr())
+	out.WriteString(fmt.Sprintf("if err := tsqlruntime.Retry(ctx, tsqlruntime.NewRetryPolicy(%s), func() error {\n", strings.Join(args, ", ")))
+	t.indent++
+	ind := t.indentStr()
+	if inTx {
+		out.WriteString(ind + "tx, err := " + t.beginTx(t.txOptions()) + "\n")
+		out.WriteString(ind + "if err != nil {\n")
+		out.WriteString(ind + "\treturn err\n")
+		out.WriteString(ind + "}\n")
+		out.WriteString(ind + "defer tx.Rollback()\n")
+		stmts = stmts[1 : len(stmts)-1]
+	}
+
+	wasInTryBlock, wasInRetry := t.inTryBlock, t.inRetry
+	t.inTryBlock = true
+	t.inRetry = true
+	t.inTransaction = inTx
+	savedSymbols := t.symbols
+	t.symbols = t.symbols.pushScope()
+
+	leaveGotoScope := t.enterGotoScope(stmts, "a retried transaction")
+	err := t.transpileStatementList(&out, stmts)
+	leaveGotoScope()
+	if err != nil {
+		return "", err
+	}
+	if unusedVars := t.symbols.getUnusedVars(); len(unusedVars) > 0 {
+		out.WriteString(ind + "// Unused variables in this scope\n")
+		for _, varName := range unusedVars {
+			out.WriteString(ind + fmt.Sprintf("_ = %s\n", varName))
+		}
+	}
+
+	t.symbols = savedSymbols
+	t.inTryBlock, t.inRetry = wasInTryBlock, wasInRetry
+	t.inTransaction = false
+	if inTx {
+		t.retriedTx = true
+		out.WriteString(ind + "// COMMIT TRANSACTION\n")
+		out.WriteString(ind + "return tx.Commit()\n")
+	} else {
+		out.WriteString(ind + "return nil\n")
+	}
+	t.indent--
+	out.WriteString(t.indentStr() + "})")
+	if returns(stmts) {
+		out.WriteString("; err == tsqlruntime.ErrReturn {\n")
+		out.WriteString(t.indentStr() + "\t" + t.namedReturn() + "\n")
+		out.WriteString(t.indentStr() + "} else if err != nil {\n")
+	} else {
+		out.WriteString("; err != nil {\n")
+	}
+	out.WriteString(t.indentStr() + "\t" + t.buildErrorReturn() + "\n")
+	out.WriteString(t.indentStr() + "}")
+	return out.String(), nil
+}
+
+// retryReturn transpiles a RETURN in a retried closure: it sets the
+// procedure's return code and returns tsqlruntime.ErrReturn, for
+// transpileRetry to return from the procedure.
+func (t *transpiler) retryReturn(ret *ast.ReturnStatement) (string, error) {
+	if !t.hasReturnCode {
+		return "return tsqlruntime.ErrReturn", nil
+	}
+	code := "0"
+	if ret.Value != nil {
+		val, err := t.transpileExpression(ret.Value)
+		if err != nil {
+			return "", err
+		}
+		code = val
+	}
+	return fmt.Sprintf("returnCode = %s\n%sreturn tsqlruntime.ErrReturn", code, t.indentStr()), nil
+}
+
+// namedReturn returns from the procedure with the values its named
+// results hold.
+func (t *transpiler) namedReturn() string {
+	var parts []string
+	for _, p := range t.outputParams {
+		parts = append(parts, goIdentifier(strings.TrimPrefix(p.Name, "@")))
+	}
+	if t.hasReturnCode {
+		parts = append(parts, "returnCode")
+	}
+	if t.hasDMLStatements {
+		parts = append(parts, "nil")
+	}
+	if len(parts) == 0 {
+		return "return"
+	}
+	return "return " + strings.Join(parts, ", ")
+}
+
+// returns reports whether stmts have a RETURN.
+func returns(stmts []ast.Statement) bool {
+	found := false
+	forEachStatement(&ast.BeginEndBlock{Statements: stmts}, func(stmt ast.Statement) {
+		if _, ok := stmt.(*ast.ReturnStatement); ok {
+			found = true
+		}
+	})
+	return found
+}
+
+// warnRetryLoop warns when w looks like a hand-written deadlock retry
+// loop: a WHILE around a TRY whose CATCH checks ERROR_NUMBER() for 1205.
+func (t *transpiler) warnRetryLoop(w *ast.WhileStatement) {
+	if !t.dmlEnabled || !isRetryLoop(w.Body) {
+		return
+	}
+	msg := fmt.Sprintf("%s: WHILE loop retries deadlocks (ERROR_NUMBER() = 1205) by hand; --retry generates a retry around each transaction", t.currentProcName)
+	if t.dmlConfig.RetryAttempts > 1 {
+		msg = fmt.Sprintf("%s: WHILE loop retries deadlocks (ERROR_NUMBER() = 1205) by hand, around a transaction --retry also retries", t.currentProcName)
+	}
+	t.warnings = append(t.warnings, msg)
+}
+
+// isRetryLoop reports whether body contains a TRY/CATCH whose CATCH
+// checks ERROR_NUMBER() for deadlock 1205.
+func isRetryLoop(body ast.Statement) bool {
+	switch s := body.(type) {
+	case *ast.TryCatchStatement:
+		if s.CatchBlock == nil {
+			return false
+		}
+		catch := strings.ToUpper(s.CatchBlock.String())
+		return strings.Contains(catch, "ERROR_NUMBER()") && strings.Contains(catch, "1205")
+	case *ast.BeginEndBlock:
+		for _, stmt := range s.Statements {
+			if isRetryLoop(stmt) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// retryLoop is a hand-written deadlock retry loop:
+//
+//	DECLARE @retry INT = 3
+//	WHILE @retry > 0
+//	BEGIN
+//	    BEGIN TRY
+//	        BEGIN TRANSACTION ... COMMIT TRANSACTION
+//	        SET @retry = 0
+//	    END TRY
+//	    BEGIN CATCH
+//	        IF @@TRANCOUNT > 0 ROLLBACK TRANSACTION
+//	        IF ERROR_NUMBER() = 1205 AND @retry > 1
+//	        BEGIN
+//	            SET @retry = @retry - 1
+//	            WAITFOR DELAY '00:00:01'
+//	        END
+//	        ELSE THROW
+//	    END CATCH
+//	END
+//
+// It becomes a tsqlruntime.Retry of the TRY block, without the statements
+// ending the loop, as many times as the loop runs, waiting as long as its
+// WAITFOR first. Retry retries the dialect's transient errors, deadlocks
+// among them.
+type retryLoop struct {
+	body     []ast.Statement
+	attempts int
+	backoff  time.Duration
+	rethrows bool // Whether the CATCH raises the error once retries run out
+}
+
+// retryLoopOf returns the retry loop w is, or nil. The CATCH may only roll
+// back, wait, set the loop's variables, print and raise the error, so the
+// loop does nothing Retry doesn't.
+func (t *transpiler) retryLoopOf(w *ast.WhileStatement) *retryLoop {
+	if !t.dmlEnabled || !t.inProcBody || t.inTransaction || t.inCatchBlock ||
+		t.dmlConfig.Backend == BackendMongo || !isRetryLoop(w.Body) {
+		return nil
+	}
+	body := w.Body
+	if block, ok := body.(*ast.BeginEndBlock); ok && len(block.Statements) == 1 {
+		body = block.Statements[0]
+	}
+	try, ok := body.(*ast.TryCatchStatement)
+	if !ok || try.TryBlock == nil || try.CatchBlock == nil {
+		return nil
+	}
+
+	// The condition bounds a counter, and may test flags the loop sets
+	var counter, bound ast.Expression
+	op := ""
+	loopVars := map[string]bool{}
+	var conjuncts []ast.Expression
+	var split func(e ast.Expression)
+	split = func(e ast.Expression) {
+		if in, ok := e.(*ast.InfixExpression); ok && strings.EqualFold(in.Operator, "AND") {
+			split(in.Left)
+			split(in.Right)
+			return
+		}
+		conjuncts = append(conjuncts, e)
+	}
+	split(w.Condition)
+	flip := map[string]string{"<": ">", "<=": ">=", ">": "<", ">=": "<="}
+	for _, c := range conjuncts {
+		in, ok := c.(*ast.InfixExpression)
+		if !ok {
+			return nil
+		}
+		left, right, cmp := in.Left, in.Right, in.Operator
+		if _, ok := left.(*ast.Variable); !ok {
+			left, right, cmp = right, left, flip[cmp]
+		}
+		v, ok := left.(*ast.Variable)
+		if !ok {
+			return nil
+		}
+		loopVars[strings.ToLower(v.Name)] = true
+		switch cmp {
+		case "<", "<=", ">", ">=":
+			if counter != nil {
+				return nil
+			}
+			counter, bound, op = v, right, cmp
+		case "=", "<>", "!=":
+		default:
+			return nil
+		}
+	}
+	if counter == nil {
+		return nil
+	}
+	from, ok1 := t.literalInit(counter)
+	to, ok2 := t.literalInit(bound)
+	if !ok1 || !ok2 {
+		return nil
+	}
+	loop := &retryLoop{backoff: t.dmlConfig.RetryBackoff}
+	switch op {
+	case "<":
+		loop.attempts = int(to - from)
+	case "<=":
+		loop.attempts = int(to - from + 1)
+	case ">":
+		loop.attempts = int(from - to)
+	case ">=":
+		loop.attempts = int(from - to + 1)
+	}
+	if loop.attempts < 1 {
+		return nil
+	}
+
+	// The TRY block, without the statements ending the loop
+	setsLoopVar := func(stmt ast.Statement) bool {
+		s, ok := stmt.(*ast.SetStatement)
+		if !ok {
+			return false
+		}
+		v, ok := s.Variable.(*ast.Variable)
+		return ok && loopVars[strings.ToLower(v.Name)]
+	}
+	for _, stmt := range try.TryBlock.Statements {
+		if _, ok := stmt.(*ast.BreakStatement); ok || setsLoopVar(stmt) {
+			continue
+		}
+		loop.body = append(loop.body, stmt)
+	}
+	if len(loop.body) == 0 {
+		return nil
+	}
+	escapes := false
+	forEachStatement(&ast.BeginEndBlock{Statements: loop.body}, func(stmt ast.Statement) {
+		switch stmt.(type) {
+		case *ast.BreakStatement, *ast.ContinueStatement, *ast.WhileStatement, *ast.ReturnStatement:
+			escapes = true
+		}
+	})
+	if escapes {
+		return nil
+	}
+
+	// The CATCH only decides whether to go round again
+	handled := true
+	forEachStatement(try.CatchBlock, func(stmt ast.Statement) {
+		switch s := stmt.(type) {
+		case *ast.BeginEndBlock, *ast.IfStatement, *ast.RollbackTransactionStatement, *ast.PrintStatement, *ast.BreakStatement:
+		case *ast.ThrowStatement, *ast.RaiserrorStatement:
+			loop.rethrows = true
+		case *ast.WaitforStatement:
+			lit, ok := s.Duration.(*ast.StringLiteral)
+			if !ok || !strings.EqualFold(s.Type, "DELAY") {
+				handled = false
+				return
+			}
+			if d, err := parseWaitforTime(lit.Value); err == nil && d > 0 {
+				loop.backoff = d
+			}
+		default:
+			handled = handled && setsLoopVar(stmt)
+		}
+	})
+	if !handled {
+		return nil
+	}
+	if loop.backoff <= 0 {
+		loop.backoff = defaultRetryBackoff
+	}
+	return loop
+}
+
+// literalInit returns the value of e, an integer or a variable the
+// procedure declares with one.
+func (t *transpiler) literalInit(e ast.Expression) (int64, bool) {
+	switch v := e.(type) {
+	case *ast.IntegerLiteral:
+		return v.Value, true
+	case *ast.Variable:
+		var value ast.Expression
+		forEachStatement(t.procBody, func(stmt ast.Statement) {
+			if d, ok := stmt.(*ast.DeclareStatement); ok {
+				for _, def := range d.Variables {
+					if strings.EqualFold(def.Name, v.Name) && def.Value != nil {
+						value = def.Value
+					}
+				}
+			}
+		})
+		if lit, ok := value.(*ast.IntegerLiteral); ok {
+			return lit.Value, true
+		}
+	}
+	return 0, false
+}
+
+// transpileRetryLoop transpiles a hand-written deadlock retry loop as a
+// tsqlruntime.Retry (see retryLoop).
+func (t *transpiler) transpileRetryLoop(loop *retryLoop) (string, error) {
+	if !loop.rethrows {
+		t.warnings = append(t.warnings, fmt.Sprintf("%s: deadlock retry loop dropped the error once its retries ran out; the translation returns it", t.currentProcName))
+	}
+	comment := fmt.Sprintf("// WHILE loop retrying deadlocks (ERROR_NUMBER() = 1205), %d attempts\n", loop.attempts)
+	return t.transpileRetry(comment, loop.body, loop.attempts, loop.backoff)
+}
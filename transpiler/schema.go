@@ -0,0 +1,210 @@
+package transpiler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ha1tch/tsqlparser"
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// Generated columns
+//
+// Legacy procedures often list every column of a table in their INSERTs,
+// including ones SQL Server fills in or rejects anyway. Carried over
+// verbatim they fail at runtime on other databases (postgres rejects values
+// for GENERATED ALWAYS AS IDENTITY and computed columns), so when the
+// schema is known those columns are dropped from INSERT and UPDATE with a
+// comment and a warning.
+
+// Kinds of generated column.
+const (
+	GeneratedComputed   = "computed"   // Col AS (expr)
+	GeneratedIdentity   = "identity"   // Col INT IDENTITY(1,1)
+	GeneratedRowVersion = "rowversion" // Col ROWVERSION / TIMESTAMP
+)
+
+// GeneratedColumns returns the computed, identity and rowversion columns of
+// every CREATE TABLE in source, as table -> column -> kind. Other
+// statements are ignored, so a full schema script can be passed as is.
+func GeneratedColumns(source string) (map[string]map[string]string, error) {
+	program, errors := tsqlparser.Parse(stripGoStatements(source))
+	if len(errors) > 0 {
+		return nil, fmt.Errorf("parse errors:\n%s", strings.Join(errors, "\n"))
+	}
+	return generatedColumnsIn(program), nil
+}
+
+// generatedColumnsIn is GeneratedColumns for a parsed program.
+func generatedColumnsIn(program *ast.Program) map[string]map[string]string {
+	tables := map[string]map[string]string{}
+	if program == nil {
+		return tables
+	}
+	for _, stmt := range program.Statements {
+		create, ok := stmt.(*ast.CreateTableStatement)
+		if !ok || create.IsTemporary || create.Name == nil || len(create.Name.Parts) == 0 {
+			continue
+		}
+		table := create.Name.Parts[len(create.Name.Parts)-1].Value
+		if isTempTable(table) {
+			continue
+		}
+		for _, col := range create.Columns {
+			if kind := generatedKind(col); kind != "" {
+				if tables[table] == nil {
+					tables[table] = map[string]string{}
+				}
+				tables[table][col.Name.Value] = kind
+			}
+		}
+	}
+	return tables
+}
+
+func generatedKind(col *ast.ColumnDefinition) string {
+	switch {
+	case col.Computed != nil:
+		return GeneratedComputed
+	case col.Identity != nil:
+		return GeneratedIdentity
+	case col.DataType != nil && (strings.EqualFold(col.DataType.Name, "ROWVERSION") || strings.EqualFold(col.DataType.Name, "TIMESTAMP")):
+		return GeneratedRowVersion
+	}
+	return ""
+}
+
+// collectGeneratedColumns merges the configured generated columns with the
+// tables created in the program being transpiled. Keys are lower-cased.
+func (t *transpiler) collectGeneratedColumns(program *ast.Program) {
+	t.generatedColumns = map[string]map[string]string{}
+	t.addGeneratedColumns(t.dmlConfig.GeneratedColumns)
+	t.addGeneratedColumns(generatedColumnsIn(program))
+}
+
+func (t *transpiler) addGeneratedColumns(tables map[string]map[string]string) {
+	for table, cols := range tables {
+		key := strings.ToLower(unqualifiedName(table))
+		if t.generatedColumns[key] == nil {
+			t.generatedColumns[key] = map[string]string{}
+		}
+		for col, kind := range cols {
+			t.generatedColumns[key][strings.ToLower(col)] = kind
+		}
+	}
+}
+
+// generatedColumn returns the kind of a generated column, or "".
+func (dt *dmlTranspiler) generatedColumn(table, column string) string {
+	return dt.generatedColumns[strings.ToLower(table)][strings.ToLower(column)]
+}
+
+// omitGeneratedInsertColumns returns s without the generated columns in its
+// column list, along with a note describing what was dropped. s itself is
+// not modified. Identity columns are kept under WITH (KEEPIDENTITY).
+func (dt *dmlTranspiler) omitGeneratedInsertColumns(s *ast.InsertStatement) (*ast.InsertStatement, string) {
+	if len(s.Columns) == 0 {
+		return s, ""
+	}
+	table := dt.extractInsertTable(s)
+	keepIdentity := false
+	for _, hint := range s.Hints {
+		if strings.EqualFold(hint, "KEEPIDENTITY") {
+			keepIdentity = true
+		}
+	}
+
+	var keep []int
+	var omitted []string
+	for i, col := range s.Columns {
+		kind := dt.generatedColumn(table, col.Value)
+		if kind == "" || (kind == GeneratedIdentity && keepIdentity) {
+			keep = append(keep, i)
+			continue
+		}
+		omitted = append(omitted, fmt.Sprintf("%s (%s)", col.Value, kind))
+	}
+	if len(omitted) == 0 {
+		return s, ""
+	}
+	if s.Select != nil && !selectColumnsMatch(s.Select, len(s.Columns)) {
+		dt.warnings = append(dt.warnings, fmt.Sprintf("%s: INSERT INTO %s lists generated column(s) %s, but its SELECT columns can't be matched up to drop them",
+			dt.currentProcName, table, strings.Join(omitted, ", ")))
+		return s, ""
+	}
+
+	copied := *s
+	copied.Columns = nil
+	for _, i := range keep {
+		copied.Columns = append(copied.Columns, s.Columns[i])
+	}
+	if len(s.Values) > 0 {
+		copied.Values = make([][]ast.Expression, len(s.Values))
+		for r, row := range s.Values {
+			for _, i := range keep {
+				if i < len(row) {
+					copied.Values[r] = append(copied.Values[r], row[i])
+				}
+			}
+		}
+	}
+	if s.Select != nil {
+		sel := *s.Select
+		sel.Columns = nil
+		for _, i := range keep {
+			sel.Columns = append(sel.Columns, s.Select.Columns[i])
+		}
+		copied.Select = &sel
+	}
+
+	dt.warnings = append(dt.warnings, fmt.Sprintf("%s: INSERT INTO %s omits generated column(s) %s",
+		dt.currentProcName, table, strings.Join(omitted, ", ")))
+	return &copied, fmt.Sprintf("// Omitted %s from INSERT: generated by the database", strings.Join(omitted, ", "))
+}
+
+// selectColumnsMatch reports whether a SELECT feeding an INSERT has one
+// explicit column per inserted column.
+func selectColumnsMatch(sel *ast.SelectStatement, n int) bool {
+	if sel.Union != nil || len(sel.Columns) != n {
+		return false
+	}
+	for _, col := range sel.Columns {
+		if col.AllColumns {
+			return false
+		}
+	}
+	return true
+}
+
+// omitGeneratedUpdateColumns returns s without SET clauses that assign
+// generated columns, along with a note describing what was dropped. If
+// every clause is dropped the returned statement is nil.
+func (dt *dmlTranspiler) omitGeneratedUpdateColumns(s *ast.UpdateStatement) (*ast.UpdateStatement, string) {
+	table := dt.extractUpdateTable(s)
+	var keep []*ast.SetClause
+	var omitted []string
+	for _, set := range s.SetClauses {
+		kind := ""
+		if set.Column != nil && len(set.Column.Parts) > 0 && !set.IsMethodCall {
+			kind = dt.generatedColumn(table, set.Column.Parts[len(set.Column.Parts)-1].Value)
+		}
+		if kind == "" {
+			keep = append(keep, set)
+			continue
+		}
+		omitted = append(omitted, fmt.Sprintf("%s (%s)", set.Column.Parts[len(set.Column.Parts)-1].Value, kind))
+	}
+	if len(omitted) == 0 {
+		return s, ""
+	}
+
+	dt.warnings = append(dt.warnings, fmt.Sprintf("%s: UPDATE %s omits generated column(s) %s",
+		dt.currentProcName, table, strings.Join(omitted, ", ")))
+	note := fmt.Sprintf("// Omitted %s from UPDATE: generated by the database", strings.Join(omitted, ", "))
+	if len(keep) == 0 {
+		return nil, note
+	}
+	copied := *s
+	copied.SetClauses = keep
+	return &copied, note
+}
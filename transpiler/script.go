@@ -0,0 +1,53 @@
+package transpiler
+
+import (
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// Batch scripts
+//
+// Job scripts and other ad-hoc batches have no CREATE PROCEDURE: their
+// statements run at the top level, with variables declared in one batch
+// and used in the next. With DMLConfig.ScriptName set, the statements
+// outside procedures become the body of a function of that name, as if
+// the script were a procedure without parameters:
+//
+//	DECLARE @Cutoff DATETIME = DATEADD(DAY, -30, GETDATE())
+//	DELETE FROM Sessions WHERE LastSeen < @Cutoff
+//
+// becomes, for nightly_cleanup.sql,
+//
+//	func (r *Repository) NightlyCleanup(ctx context.Context) (err error) {
+//		var cutoff time.Time = ...
+//
+// Procedures, functions and types in the script are transpiled as usual.
+
+// scriptProgram returns program with its top-level statements moved into
+// a procedure named name, placed where the first of them was, and that
+// procedure. The procedure is nil if there were no such statements.
+func scriptProgram(program *ast.Program, name string) (*ast.Program, *ast.CreateProcedureStatement) {
+	var body []ast.Statement
+	at := -1
+	var stmts []ast.Statement
+	for _, stmt := range program.Statements {
+		switch stmt.(type) {
+		case *ast.CreateProcedureStatement, *ast.CreateFunctionStatement, *ast.CreateTypeStatement:
+			stmts = append(stmts, stmt)
+			continue
+		}
+		if at < 0 {
+			at = len(stmts)
+			stmts = append(stmts, nil)
+		}
+		body = append(body, stmt)
+	}
+	if at < 0 {
+		return program, nil
+	}
+	proc := &ast.CreateProcedureStatement{
+		Name: &ast.QualifiedIdentifier{Parts: []*ast.Identifier{{Value: name}}},
+		Body: &ast.BeginEndBlock{Statements: body},
+	}
+	stmts[at] = proc
+	return &ast.Program{Statements: stmts}, proc
+}
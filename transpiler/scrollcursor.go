@@ -0,0 +1,183 @@
+package transpiler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// Scrollable cursors
+//
+// A cursor only fetched with FETCH NEXT becomes a rows.Next() loop (see
+// transpileCursorWhile). One fetched PRIOR, FIRST, LAST, ABSOLUTE or
+// RELATIVE can move back, so OPEN buffers its rows in a
+// tsqlruntime.Cursor and each FETCH moves through them:
+//
+//	OPEN c                     -> cCursor, err := tsqlruntime.OpenScrollCursor(ctx, r.db, "c", query, args...)
+//	FETCH PRIOR FROM c INTO @x -> row, status := cCursor.FetchPrior(); x = row[0]...
+//	WHILE @@FETCH_STATUS = 0   -> for fetchStatus == 0 (FETCHes in the body run as written)
+//
+// The whole result set is held in memory while the cursor is open, which
+// is reported with a warning.
+
+// scrollCursorsIn returns the cursors fetched other than NEXT in body, by
+// lower-cased name.
+func scrollCursorsIn(body *ast.BeginEndBlock) map[string]bool {
+	scroll := map[string]bool{}
+	forEachStatement(body, func(stmt ast.Statement) {
+		if s, ok := stmt.(*ast.FetchStatement); ok && s.CursorName != nil && s.Direction != "" && !strings.EqualFold(s.Direction, "NEXT") {
+			scroll[strings.ToLower(s.CursorName.Value)] = true
+		}
+	})
+	return scroll
+}
+
+// forEachStatement calls visit for each statement in body, including those
+// nested in blocks, IFs, WHILEs and TRY/CATCH.
+func forEachStatement(body *ast.BeginEndBlock, visit func(ast.Statement)) {
+	var walk func(stmt ast.Statement)
+	walk = func(stmt ast.Statement) {
+		visit(stmt)
+		switch s := stmt.(type) {
+		case *ast.BeginEndBlock:
+			for _, inner := range s.Statements {
+				walk(inner)
+			}
+		case *ast.IfStatement:
+			walk(s.Consequence)
+			if s.Alternative != nil {
+				walk(s.Alternative)
+			}
+		case *ast.WhileStatement:
+			walk(s.Body)
+		case *ast.TryCatchStatement:
+			if s.TryBlock != nil {
+				walk(s.TryBlock)
+			}
+			if s.CatchBlock != nil {
+				walk(s.CatchBlock)
+			}
+		}
+	}
+	if body != nil {
+		walk(body)
+	}
+}
+
+// usesFetchStatusIn reports whether body reads @@FETCH_STATUS.
+func usesFetchStatusIn(body *ast.BeginEndBlock) bool {
+	return body != nil && strings.Contains(strings.ToUpper(body.String()), "@@FETCH_STATUS")
+}
+
+// isScrollCursor reports whether the cursor called name is buffered.
+func (t *transpiler) isScrollCursor(name string) bool {
+	return t.scrollCursors[strings.ToLower(name)]
+}
+
+// transpileOpenScrollCursor buffers the rows of cursor in a tsqlruntime.Cursor.
+func (t *transpiler) transpileOpenScrollCursor(cursor *cursorInfo) (string, error) {
+	dt := &dmlTranspiler{transpiler: t, config: t.dmlConfig}
+	query, args := dt.buildSelectQuery(cursor.query)
+	query, args = dt.bindQueryVariables(query, args)
+
+	t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+	t.warnings = append(t.warnings, fmt.Sprintf(
+		"%s: cursor %s is fetched other than NEXT, so OPEN buffers all of its rows in memory; large result sets may need a query per FETCH instead",
+		t.currentProcName, cursor.name))
+
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("// OPEN %s: rows buffered in memory for scrolling\n", cursor.name))
+	out.WriteString(t.indentStr())
+	out.WriteString(fmt.Sprintf("%s, err := tsqlruntime.OpenScrollCursor(ctx, %s, %q, %q", cursor.rowsVar, dt.getDBVar(), cursor.name, query))
+	for _, arg := range args {
+		out.WriteString(", " + arg)
+	}
+	out.WriteString(")\n")
+	out.WriteString(t.indentStr())
+	out.WriteString("if err != nil {\n")
+	out.WriteString(t.indentStr())
+	out.WriteString("\t" + dt.buildErrorReturn() + "\n")
+	out.WriteString(t.indentStr())
+	out.WriteString("}")
+	out.WriteString(t.declareCursorKeys(cursor))
+	return out.String(), nil
+}
+
+// transpileScrollFetch moves cursor as s says, assigning the row to the
+// INTO variables and its status to fetchStatus.
+func (t *transpiler) transpileScrollFetch(s *ast.FetchStatement, cursor *cursorInfo) (string, error) {
+	direction := strings.ToUpper(s.Direction)
+	if direction == "" {
+		direction = "NEXT"
+	}
+	var call string
+	switch direction {
+	case "NEXT", "PRIOR", "FIRST", "LAST":
+		call = fmt.Sprintf("%s.Fetch%s%s()", cursor.rowsVar, direction[:1], strings.ToLower(direction[1:]))
+	case "ABSOLUTE", "RELATIVE":
+		if s.Offset == nil {
+			return "", fmt.Errorf("FETCH %s from %s has no position", direction, cursor.name)
+		}
+		offset, err := t.transpileExpression(s.Offset)
+		if err != nil {
+			return "", err
+		}
+		call = fmt.Sprintf("%s.Fetch%s%s(int(%s))", cursor.rowsVar, direction[:1], strings.ToLower(direction[1:]), offset)
+	default:
+		return "", fmt.Errorf("FETCH %s from %s is not supported", direction, cursor.name)
+	}
+
+	var assigns []string
+	for i, v := range s.IntoVars {
+		name := goIdentifier(strings.TrimPrefix(v.Name, "@"))
+		goType := "string"
+		if ti := t.symbols.lookup(name); ti != nil && ti.goType != "" {
+			goType = ti.goType
+		}
+		value, ok := memoryGoValue(fmt.Sprintf("row[%d]", i), goType)
+		if !ok {
+			return "", fmt.Errorf("FETCH %s from %s into %s: %s has no conversion from a cursor row", direction, cursor.name, v.Name, goType)
+		}
+		assigns = append(assigns, fmt.Sprintf("%s = %s", name, value))
+	}
+	for i, v := range cursor.keyVars {
+		assigns = append(assigns, fmt.Sprintf("%s = tsqlruntime.FromValue(row[%d])", v, cursor.keyIndex+i))
+	}
+
+	comment := fmt.Sprintf("// FETCH %s FROM %s\n", direction, cursor.name)
+	if s.Offset != nil {
+		comment = fmt.Sprintf("// FETCH %s %s FROM %s\n", direction, s.Offset.String(), cursor.name)
+	}
+	if len(assigns) == 0 && !t.usesFetchStatus {
+		return comment + t.indentStr() + call, nil
+	}
+
+	var out strings.Builder
+	out.WriteString(comment)
+	out.WriteString(t.indentStr())
+	if !t.usesFetchStatus {
+		out.WriteString(fmt.Sprintf("if row, status := %s; status == 0 {\n", call))
+		for _, assign := range assigns {
+			out.WriteString(t.indentStr() + "\t" + assign + "\n")
+		}
+		out.WriteString(t.indentStr() + "}")
+		return out.String(), nil
+	}
+	row := "row"
+	if len(assigns) == 0 {
+		row = "_"
+	}
+	out.WriteString("{\n")
+	out.WriteString(fmt.Sprintf("%s\t%s, status := %s\n", t.indentStr(), row, call))
+	if len(assigns) > 0 {
+		out.WriteString(t.indentStr() + "\tif status == 0 {\n")
+		for _, assign := range assigns {
+			out.WriteString(t.indentStr() + "\t\t" + assign + "\n")
+		}
+		out.WriteString(t.indentStr() + "\t}\n")
+	}
+	out.WriteString(t.indentStr() + "\tfetchStatus = int32(status)\n")
+	out.WriteString(t.indentStr() + "}")
+	return out.String(), nil
+}
@@ -0,0 +1,474 @@
+package transpiler
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/ha1tch/tsqlparser"
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// Severity of a security finding.
+const (
+	SeverityHigh   = "high"   // Caller-controlled text spliced into SQL
+	SeverityMedium = "medium" // Escaped by hand, or read back from a table
+	SeverityLow    = "low"    // Non-text value (numbers, dates) spliced into SQL
+)
+
+// SecurityFinding is a variable concatenated into dynamic SQL. Generated
+// queries always bind values as parameters; dynamic SQL run with EXEC() or
+// sp_executesql is the one place string-built SQL survives a migration.
+type SecurityFinding struct {
+	Procedure string
+	Line      int
+	Severity  string
+	Sink      string // EXEC() or sp_executesql
+	Variable  string // With the @ prefix
+	Message   string
+}
+
+func (f SecurityFinding) String() string {
+	return fmt.Sprintf("%s:%d: [%s] %s", f.Procedure, f.Line, f.Severity, f.Message)
+}
+
+// AuditDynamicSQL finds variables concatenated into dynamic SQL in every
+// procedure in source. Variables are traced through local assignments, so
+// SET @sql = @sql + @Name followed by EXEC(@sql) reports @Name. Only the
+// assignments that can reach a sink count: a variable reassigned after one
+// EXEC is traced from its new value at the next. Values wrapped in
+// QUOTENAME or cast to a non-text type are not reported.
+func AuditDynamicSQL(source string) ([]SecurityFinding, error) {
+	program, errors := tsqlparser.Parse(stripGoStatements(source))
+	if len(errors) > 0 {
+		return nil, fmt.Errorf("parse errors:\n%s", strings.Join(errors, "\n"))
+	}
+	return auditDynamicSQL(program), nil
+}
+
+// auditDynamicSQL is AuditDynamicSQL for a parsed program.
+func auditDynamicSQL(program *ast.Program) []SecurityFinding {
+	var findings []SecurityFinding
+	for _, stmt := range program.Statements {
+		proc, ok := stmt.(*ast.CreateProcedureStatement)
+		if !ok || proc.Body == nil {
+			continue
+		}
+		a := &injectionAudit{
+			proc:   proc.Name.String(),
+			names:  map[string]string{},
+			types:  map[string]*ast.DataType{},
+			env:    reaching{},
+			envs:   map[ast.Expression]reaching{},
+			sinkAt: map[ast.Statement]*dynamicSQLSink{},
+		}
+		for _, p := range proc.Parameters {
+			a.declare(p.Name, p.DataType)
+		}
+		a.statements(proc.Body.Statements)
+		findings = append(findings, a.findings()...)
+	}
+	return findings
+}
+
+// injectionAudit traces one procedure. The body is walked in statement
+// order, keeping the assignments that reach each statement; IF branches
+// are merged after the IF, and a WHILE body is walked until what reaches
+// its start stops growing. A variable that is unsafe on any path to a
+// sink is reported.
+type injectionAudit struct {
+	proc   string
+	names  map[string]string           // lower-cased name -> name as declared
+	types  map[string]*ast.DataType    // lower-cased name -> declared type
+	env    reaching                    // At the statement being walked
+	envs   map[ast.Expression]reaching // Assigned value -> what reached its assignment
+	loops  []*loopFlow
+	sinks  []*dynamicSQLSink
+	sinkAt map[ast.Statement]*dynamicSQLSink
+	sink   ast.Expression // SQL text of the sink being traced
+}
+
+type dynamicSQLSink struct {
+	line int
+	name string
+	sql  ast.Expression
+	env  reaching
+}
+
+// loopFlow is what reaches the BREAKs and CONTINUEs of a WHILE body; nil
+// if there are none.
+type loopFlow struct {
+	breaks, continues reaching
+}
+
+// reaching maps a lower-cased variable name to the values that may have
+// been assigned to it last. A nil value is one the audit can't see, such
+// as a parameter's or a FETCH INTO's; a name not in the map has only that.
+type reaching map[string][]ast.Expression
+
+func (r reaching) values(name string) []ast.Expression {
+	if values, ok := r[name]; ok {
+		return values
+	}
+	return []ast.Expression{nil}
+}
+
+// mergeReaching returns what reaches the point where a and b join. A nil
+// reaching is a path that doesn't get there.
+func mergeReaching(a, b reaching) reaching {
+	if a == nil {
+		a, b = b, a
+	}
+	merged := reaching{}
+	for name, values := range a {
+		merged[name] = values
+	}
+	if b == nil {
+		return merged
+	}
+	for name := range b {
+		if _, ok := a[name]; !ok {
+			merged[name] = nil
+		}
+	}
+	for name := range merged {
+		values := slices.Clone(a.values(name))
+		for _, v := range b.values(name) {
+			if !slices.Contains(values, v) {
+				values = append(values, v)
+			}
+		}
+		merged[name] = values
+	}
+	return merged
+}
+
+func sameReaching(a, b reaching) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, values := range a {
+		other, ok := b[name]
+		if !ok || len(other) != len(values) {
+			return false
+		}
+		for _, v := range values {
+			if !slices.Contains(other, v) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// assign makes value, nil if unknown, the only one reaching name. A value
+// met again, in a WHILE body, keeps what reached it each time.
+func (a *injectionAudit) assign(name string, value ast.Expression) {
+	values := []ast.Expression{value}
+	if value != nil {
+		a.envs[value] = mergeReaching(a.envs[value], a.env)
+	}
+	a.setValues(name, values)
+}
+
+func (a *injectionAudit) setValues(name string, values []ast.Expression) {
+	env := make(reaching, len(a.env)+1)
+	for n, v := range a.env {
+		env[n] = v
+	}
+	env[name] = values
+	a.env = env
+}
+
+// splice is a variable that reaches a sink.
+type splice struct {
+	severity string
+	reason   string // concat, caller, table, stored or escaped
+}
+
+var severityRank = map[string]int{SeverityLow: 1, SeverityMedium: 2, SeverityHigh: 3}
+
+func (a *injectionAudit) declare(name string, dt *ast.DataType) string {
+	key := strings.ToLower(strings.TrimPrefix(name, "@"))
+	a.names[key] = strings.TrimPrefix(name, "@")
+	a.types[key] = dt
+	return key
+}
+
+func (a *injectionAudit) statements(stmts []ast.Statement) {
+	for _, stmt := range stmts {
+		a.statement(stmt)
+	}
+}
+
+func (a *injectionAudit) statement(stmt ast.Statement) {
+	switch s := stmt.(type) {
+	case *ast.DeclareStatement:
+		for _, v := range s.Variables {
+			name := a.declare(v.Name, v.DataType)
+			if v.Value != nil {
+				a.assign(name, v.Value)
+			} else {
+				// NULL until assigned
+				a.setValues(name, []ast.Expression{})
+			}
+		}
+	case *ast.SetStatement:
+		if v, ok := s.Variable.(*ast.Variable); ok && s.Value != nil {
+			a.assign(variableKey(v), s.Value)
+		}
+	case *ast.SelectStatement:
+		for _, col := range s.Columns {
+			if col.Variable != nil {
+				a.assign(variableKey(col.Variable), col.Expression)
+			}
+		}
+	case *ast.FetchStatement:
+		for _, v := range s.IntoVars {
+			a.assign(variableKey(v), nil)
+		}
+	case *ast.ExecStatement:
+		if s.DynamicSQL != nil {
+			a.addSink(s, "EXEC()", s.DynamicSQL)
+		} else if isExecuteSQL(s.Procedure) && len(s.Parameters) > 0 {
+			// Only the statement text matters; values passed as
+			// sp_executesql parameters are bound, not spliced
+			a.addSink(s, "sp_executesql", s.Parameters[0].Value)
+		}
+		for _, p := range s.Parameters {
+			if v, ok := p.Value.(*ast.Variable); ok && p.Output {
+				a.assign(variableKey(v), nil)
+			}
+		}
+	case *ast.IfStatement:
+		before := a.env
+		a.statement(s.Consequence)
+		then := a.env
+		a.env = before
+		if s.Alternative != nil {
+			a.statement(s.Alternative)
+		}
+		a.env = mergeReaching(then, a.env)
+	case *ast.WhileStatement:
+		entry, start := a.env, a.env
+		for {
+			flow := &loopFlow{}
+			a.loops = append(a.loops, flow)
+			a.env = start
+			a.statement(s.Body)
+			a.loops = a.loops[:len(a.loops)-1]
+			next := mergeReaching(entry, mergeReaching(a.env, flow.continues))
+			if sameReaching(next, start) {
+				a.env = mergeReaching(start, flow.breaks)
+				break
+			}
+			start = next
+		}
+	case *ast.BreakStatement:
+		if len(a.loops) > 0 {
+			flow := a.loops[len(a.loops)-1]
+			flow.breaks = mergeReaching(flow.breaks, a.env)
+		}
+	case *ast.ContinueStatement:
+		if len(a.loops) > 0 {
+			flow := a.loops[len(a.loops)-1]
+			flow.continues = mergeReaching(flow.continues, a.env)
+		}
+	case *ast.BeginEndBlock:
+		a.statements(s.Statements)
+	case *ast.TryCatchStatement:
+		// The CATCH block may start before or after the TRY block's
+		// assignments
+		before := a.env
+		if s.TryBlock != nil {
+			a.statements(s.TryBlock.Statements)
+		}
+		tried := a.env
+		if s.CatchBlock != nil {
+			a.env = mergeReaching(before, tried)
+			a.statements(s.CatchBlock.Statements)
+			a.env = mergeReaching(tried, a.env)
+		}
+	}
+}
+
+func variableKey(v *ast.Variable) string {
+	return strings.ToLower(strings.TrimPrefix(v.Name, "@"))
+}
+
+// addSink records a sink at stmt with what reaches it, added to what
+// reached it before if stmt is in a WHILE body.
+func (a *injectionAudit) addSink(stmt ast.Statement, name string, sql ast.Expression) {
+	if sink, ok := a.sinkAt[stmt]; ok {
+		sink.env = mergeReaching(sink.env, a.env)
+		return
+	}
+	sink := &dynamicSQLSink{line: stmt.(*ast.ExecStatement).Token.Line, name: name, sql: sql, env: a.env}
+	a.sinkAt[stmt] = sink
+	a.sinks = append(a.sinks, sink)
+}
+
+func isExecuteSQL(proc *ast.QualifiedIdentifier) bool {
+	return proc != nil && len(proc.Parts) > 0 && strings.EqualFold(proc.Parts[len(proc.Parts)-1].Value, "sp_executesql")
+}
+
+func (a *injectionAudit) findings() []SecurityFinding {
+	var findings []SecurityFinding
+	for _, sink := range a.sinks {
+		spliced := map[string]*splice{}
+		a.sink = sink.sql
+		a.trace(sink.sql, sink.env, "", false, map[ast.Expression]bool{}, spliced)
+
+		names := make([]string, 0, len(spliced))
+		for name := range spliced {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			sp := spliced[name]
+			if v, ok := sink.sql.(*ast.Variable); ok && sp.reason == "table" && strings.EqualFold(strings.TrimPrefix(v.Name, "@"), name) {
+				sp.reason = "stored"
+			}
+			findings = append(findings, SecurityFinding{
+				Procedure: a.proc,
+				Line:      sink.line,
+				Severity:  sp.severity,
+				Sink:      sink.name,
+				Variable:  a.variable(name),
+				Message:   a.message(name, sp, sink.name),
+			})
+		}
+	}
+	return findings
+}
+
+func (a *injectionAudit) variable(name string) string {
+	if declared, ok := a.names[name]; ok {
+		return "@" + declared
+	}
+	return "@" + name
+}
+
+func (a *injectionAudit) message(name string, sp *splice, sink string) string {
+	v := a.variable(name)
+	if dt := a.types[name]; dt != nil {
+		v += " " + dt.String()
+	}
+	switch sp.reason {
+	case "caller":
+		return fmt.Sprintf("%s runs %s as SQL; callers control the whole statement", sink, v)
+	case "stored":
+		return fmt.Sprintf("%s runs %s, read from a table, as SQL; anyone who can write that table controls the statement", sink, v)
+	case "table":
+		return fmt.Sprintf("%s is read from a table and concatenated into SQL run by %s (second-order injection); pass it as an sp_executesql parameter", v, sink)
+	case "escaped":
+		return fmt.Sprintf("%s is escaped with REPLACE and concatenated into SQL run by %s; pass it as an sp_executesql parameter instead", v, sink)
+	}
+	return fmt.Sprintf("%s is concatenated into SQL run by %s; pass it as an sp_executesql parameter, or wrap identifiers in QUOTENAME", v, sink)
+}
+
+// trace records every variable whose value reaches expr, with env what
+// reaches it. owner is the local variable being resolved, if any, so
+// values read from tables are charged to it; escaped caps severity for
+// values passed through REPLACE.
+func (a *injectionAudit) trace(expr ast.Expression, env reaching, owner string, escaped bool, seen map[ast.Expression]bool, out map[string]*splice) {
+	switch e := expr.(type) {
+	case nil, *ast.StringLiteral, *ast.IntegerLiteral, *ast.FloatLiteral, *ast.NullLiteral:
+		return
+
+	case *ast.Variable:
+		if strings.HasPrefix(e.Name, "@@") {
+			return
+		}
+		name := variableKey(e)
+		unknown := false
+		for _, v := range env.values(name) {
+			if v == nil {
+				unknown = true
+			} else if !seen[v] {
+				// Locals are resolved through what was assigned to them
+				seen[v] = true
+				a.trace(v, a.envs[v], name, escaped, seen, out)
+			}
+		}
+		if !unknown {
+			return
+		}
+		sp := &splice{severity: injectionSeverity(a.types[name]), reason: "concat"}
+		if expr == a.sink {
+			// The sink runs the variable itself, not a concatenation
+			sp.reason = "caller"
+		}
+		if escaped && severityRank[sp.severity] > severityRank[SeverityMedium] {
+			sp.severity, sp.reason = SeverityMedium, "escaped"
+		}
+		addSplice(out, name, sp)
+
+	case *ast.Identifier, *ast.QualifiedIdentifier:
+		if owner != "" {
+			addSplice(out, owner, &splice{severity: SeverityMedium, reason: "table"})
+		}
+
+	case *ast.InfixExpression:
+		a.trace(e.Left, env, owner, escaped, seen, out)
+		a.trace(e.Right, env, owner, escaped, seen, out)
+
+	case *ast.CastExpression:
+		if !isTextType(e.TargetType) {
+			return
+		}
+		a.trace(e.Expression, env, owner, escaped, seen, out)
+
+	case *ast.ConvertExpression:
+		if !isTextType(e.TargetType) {
+			return
+		}
+		a.trace(e.Expression, env, owner, escaped, seen, out)
+
+	case *ast.FunctionCall:
+		switch strings.ToUpper(e.Function.String()) {
+		case "QUOTENAME":
+			return
+		case "REPLACE":
+			escaped = true
+		}
+		for _, arg := range e.Arguments {
+			a.trace(arg, env, owner, escaped, seen, out)
+		}
+
+	default:
+		// Anything else (CASE, subqueries, ...) is treated as splicing
+		// every variable it mentions
+		for _, ref := range sqlVariableRef.FindAllString(expr.String(), -1) {
+			a.trace(&ast.Variable{Name: ref}, env, owner, escaped, seen, out)
+		}
+	}
+}
+
+func addSplice(out map[string]*splice, name string, sp *splice) {
+	if prev, ok := out[name]; ok && severityRank[prev.severity] >= severityRank[sp.severity] {
+		return
+	}
+	out[name] = sp
+}
+
+// injectionSeverity rates splicing a value of type dt. Text can carry SQL;
+// numbers and dates can't, though concatenating them is still flagged.
+func injectionSeverity(dt *ast.DataType) string {
+	if dt == nil || isTextType(dt) {
+		return SeverityHigh
+	}
+	return SeverityLow
+}
+
+func isTextType(dt *ast.DataType) bool {
+	if dt == nil {
+		return true
+	}
+	switch strings.ToUpper(dt.Name) {
+	case "CHAR", "VARCHAR", "NCHAR", "NVARCHAR", "TEXT", "NTEXT", "SYSNAME", "SQL_VARIANT", "XML":
+		return true
+	}
+	return false
+}
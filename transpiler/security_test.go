@@ -0,0 +1,132 @@
+package transpiler
+
+import (
+	"strings"
+	"testing"
+)
+
+const dynamicSQLProc = `
+CREATE PROCEDURE dbo.SearchCustomers
+    @Name NVARCHAR(50),
+    @MinId INT,
+    @SortCol SYSNAME,
+    @Filter NVARCHAR(200)
+AS
+BEGIN
+    DECLARE @sql NVARCHAR(MAX) = N'SELECT * FROM Customers WHERE 1=1'
+    DECLARE @tmpl NVARCHAR(MAX)
+    SELECT @tmpl = Body FROM Templates WHERE Id = 1
+    SET @sql = @sql + N' AND Name LIKE ''' + @Name + '%'''
+    SET @sql = @sql + ' AND Id > ' + CAST(@MinId AS VARCHAR(10))
+    SET @sql = @sql + ' ORDER BY ' + QUOTENAME(@SortCol)
+    EXEC(@sql)
+    EXEC sp_executesql @tmpl, N'@n NVARCHAR(50)', @n = @Name
+    EXEC('SELECT 1 WHERE x = ' + REPLACE(@Filter, '''', ''''''))
+END
+`
+
+func TestAuditDynamicSQL(t *testing.T) {
+	findings, err := AuditDynamicSQL(dynamicSQLProc)
+	if err != nil {
+		t.Fatalf("AuditDynamicSQL failed: %v", err)
+	}
+
+	got := map[string]string{}
+	for _, f := range findings {
+		got[f.Variable] = f.Severity
+		if f.Procedure != "dbo.SearchCustomers" {
+			t.Errorf("unexpected procedure in %s", f)
+		}
+	}
+	want := map[string]string{
+		"@Name":   SeverityHigh,   // Traced through @sql
+		"@MinId":  SeverityLow,    // Cast from INT
+		"@tmpl":   SeverityMedium, // Statement read from a table
+		"@Filter": SeverityMedium, // Escaped with REPLACE
+	}
+	for v, severity := range want {
+		if got[v] != severity {
+			t.Errorf("%s: severity %q, want %q (findings: %v)", v, got[v], severity, findings)
+		}
+	}
+	// QUOTENAME'd identifiers and sp_executesql parameters are safe
+	if len(got) != len(want) {
+		t.Errorf("expected %d findings, got %v", len(want), findings)
+	}
+
+	for _, f := range findings {
+		if f.Variable == "@Name" && (f.Sink != "EXEC()" || f.Line != 15 || !strings.Contains(f.Message, "NVARCHAR(50)")) {
+			t.Errorf("unexpected @Name finding: %+v", f)
+		}
+	}
+}
+
+func TestAuditDynamicSQL_Parameterised(t *testing.T) {
+	findings, err := AuditDynamicSQL(`
+CREATE PROCEDURE dbo.FindCustomer
+    @Name NVARCHAR(50)
+AS
+BEGIN
+    DECLARE @sql NVARCHAR(MAX) = N'SELECT * FROM Customers WHERE Name = @n'
+    EXEC sp_executesql @sql, N'@n NVARCHAR(50)', @n = @Name
+END
+`)
+	if err != nil {
+		t.Fatalf("AuditDynamicSQL failed: %v", err)
+	}
+	if len(findings) != 0 {
+		t.Errorf("expected no findings for parameterised dynamic SQL, got %v", findings)
+	}
+}
+
+func TestAuditDynamicSQL_Reassigned(t *testing.T) {
+	findings, err := AuditDynamicSQL(`
+CREATE PROCEDURE dbo.Report
+    @Name NVARCHAR(50),
+    @Col SYSNAME,
+    @Region NVARCHAR(20),
+    @Extra NVARCHAR(50)
+AS
+BEGIN
+    DECLARE @sql NVARCHAR(MAX) = N'SELECT * FROM Customers WHERE Name = ''' + @Name + ''''
+    EXEC(@sql)
+    SET @sql = 'SELECT ' + QUOTENAME(@Col) + ' FROM Customers'
+    EXEC(@sql)
+    SET @sql = 'SELECT 1'
+    IF @Region IS NOT NULL
+        SET @sql = @sql + ' WHERE Region = ''' + @Region + ''''
+    EXEC(@sql)
+    DECLARE @i INT = 0
+    SET @sql = 'SELECT 2'
+    WHILE @i < 3
+    BEGIN
+        EXEC(@sql)
+        SET @sql = @sql + @Extra
+        SET @i = @i + 1
+    END
+END
+`)
+	if err != nil {
+		t.Fatalf("AuditDynamicSQL failed: %v", err)
+	}
+
+	got := map[int][]string{}
+	for _, f := range findings {
+		got[f.Line] = append(got[f.Line], f.Variable+" "+f.Severity)
+	}
+	want := map[int][]string{
+		10: {"@Name high"},
+		16: {"@Region high"}, // Through one branch of the IF
+		21: {"@Extra high"},  // From the loop's previous pass
+	}
+	for line, vars := range want {
+		if strings.Join(got[line], ", ") != strings.Join(vars, ", ") {
+			t.Errorf("line %d: got %v, want %v", line, got[line], vars)
+		}
+	}
+	// @sql is reassigned before the EXEC at line 12, so @Name doesn't
+	// reach it
+	if len(findings) != 3 {
+		t.Errorf("expected 3 findings, got %v", findings)
+	}
+}
@@ -0,0 +1,590 @@
+package transpiler
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ha1tch/tgpiler/tsqlruntime"
+	"github.com/ha1tch/tsqlparser"
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// Sequences
+//
+// DMLConfig.SequenceMode says what NEXT VALUE FOR becomes: "db" (the
+// default) takes values from the database's sequence, "uuid" generates a
+// UUID instead and "stub" leaves a TODO. A UUID assigned to a variable
+// that can't hold one is left as a TODO too, with a warning. In db mode:
+//
+//   - DECLARE and SET from NEXT VALUE FOR call tsqlruntime.NextSequenceValue
+//     and check its error; elsewhere in Go expressions the call is inline.
+//   - Inside INSERT ... VALUES, UPDATE ... SET and other queries, NEXT
+//     VALUE FOR becomes nextval('name') on PostgreSQL and stays on SQL
+//     Server. MySQL and SQLite have no sequences, so the value is fetched
+//     in Go before the statement, checking the error, from the one-row
+//     table tsqlruntime uses in their place, and passed as an argument.
+//   - sp_sequence_get_range becomes tsqlruntime.SequenceRange, and ALTER
+//     SEQUENCE ... RESTART WITH in a procedure tsqlruntime.RestartSequence.
+//   - Columns whose DEFAULT is NEXT VALUE FOR keep it on PostgreSQL and SQL
+//     Server. On MySQL and SQLite, INSERTs that leave such a column out get
+//     it added, with the next value.
+//
+// CREATE, ALTER and DROP SEQUENCE are DDL, skipped with a warning; with
+// --extract-ddl they are written out for the dialect, as CREATE TABLE and
+// INSERT statements for the emulating table on MySQL and SQLite.
+
+// sequenceName returns the name of the sequence in NEXT VALUE FOR, without
+// brackets.
+func sequenceName(name *ast.QualifiedIdentifier) string {
+	if name == nil {
+		return ""
+	}
+	var parts []string
+	for _, part := range name.Parts {
+		parts = append(parts, part.Value)
+	}
+	return strings.Join(parts, ".")
+}
+
+// hasSequences reports whether db mode can use sequences in the dialect.
+func (t *transpiler) hasSequences() bool {
+	switch t.dmlConfig.SQLDialect {
+	case "postgres", "sqlserver", "mysql", "sqlite":
+		return true
+	}
+	return false
+}
+
+// nextValueCall returns the call reserving the next value of seqName.
+func (t *transpiler) nextValueCall(seqName string) string {
+	t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+	dt := &dmlTranspiler{transpiler: t, config: t.dmlConfig}
+	return fmt.Sprintf("tsqlruntime.NextSequenceValue(ctx, %s, %q, %q)", dt.getDBVar(), t.dmlConfig.SQLDialect, seqName)
+}
+
+// transpileNextValueFor handles NEXT VALUE FOR <sequence> expressions
+func (t *transpiler) transpileNextValueFor(seqName string) (string, error) {
+	if !t.dmlEnabled {
+		return "", fmt.Errorf("NEXT VALUE FOR requires DML mode")
+	}
+
+	switch t.dmlConfig.SequenceMode {
+	case "uuid":
+		t.imports["github.com/google/uuid"] = true
+		return "uuid.New().String()", nil
+	case "stub":
+		return fmt.Sprintf("0 /* TODO: implement NEXT VALUE FOR %s */", seqName), nil
+	case "db", "":
+		if !t.hasSequences() {
+			return fmt.Sprintf("0 /* TODO: NEXT VALUE FOR %s - implement for dialect %s */", seqName, t.dmlConfig.SQLDialect), nil
+		}
+		// An expression can't return the error; DECLARE and SET do (see
+		// transpileNextValueAssign)
+		return fmt.Sprintf("func() int64 { v, _ := %s; return v }()", t.nextValueCall(seqName)), nil
+	default:
+		return fmt.Sprintf("0 /* TODO: NEXT VALUE FOR %s */", seqName), nil
+	}
+}
+
+// transpileNextValueAssign assigns NEXT VALUE FOR to target, an integer
+// variable, returning the error. It returns false where the value isn't
+// taken from the database, or target isn't an integer. In uuid mode a
+// target that can't hold a UUID is left as a TODO, with a warning.
+func (t *transpiler) transpileNextValueAssign(target string, ti *typeInfo, e *ast.NextValueForExpression) (string, bool) {
+	if t.dmlEnabled && t.dmlConfig.SequenceMode == "uuid" && ti != nil && ti.goType != "string" {
+		seqName := sequenceName(e.SequenceName)
+		t.warnings = append(t.warnings, fmt.Sprintf("%s: NEXT VALUE FOR %s is a UUID with --sequence-mode=uuid, which %s (%s) can't hold; it is left as a TODO",
+			t.currentProcName, seqName, target, ti.goType))
+		return fmt.Sprintf("%s = 0 // TODO: NEXT VALUE FOR %s gives a UUID string in uuid sequence mode", target, seqName), true
+	}
+	if !t.dmlEnabled || (t.dmlConfig.SequenceMode != "db" && t.dmlConfig.SequenceMode != "") || !t.hasSequences() || ti == nil {
+		return "", false
+	}
+	value := "v"
+	switch ti.goType {
+	case "int64":
+	case "int", "int32", "int16", "uint8":
+		value = fmt.Sprintf("%s(v)", ti.goType)
+	default:
+		return "", false
+	}
+	seqName := sequenceName(e.SequenceName)
+	ind := t.indentStr()
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("// NEXT VALUE FOR %s\n", seqName))
+	out.WriteString(fmt.Sprintf("%sif v, err := %s; err != nil {\n", ind, t.nextValueCall(seqName)))
+	out.WriteString(fmt.Sprintf("%s\t%s\n", ind, t.buildErrorReturn()))
+	out.WriteString(fmt.Sprintf("%s} else {\n", ind))
+	out.WriteString(fmt.Sprintf("%s\t%s = %s\n", ind, target, value))
+	out.WriteString(ind + "}")
+	return out.String(), true
+}
+
+// fetchNextValues returns values with each NEXT VALUE FOR the dialect
+// can't run in SQL replaced by a variable, and the code fetching their
+// values ahead of the statement, returning the error. values is not
+// modified.
+func (dt *dmlTranspiler) fetchNextValues(values []ast.Expression) ([]ast.Expression, string) {
+	if !dt.hasSequences() || (dt.config.SequenceMode != "db" && dt.config.SequenceMode != "") {
+		return values, ""
+	}
+	if _, ok := dt.nextValueSQL(""); ok {
+		return values, ""
+	}
+	var fetch strings.Builder
+	replaced := values
+	for i, val := range values {
+		next, ok := val.(*ast.NextValueForExpression)
+		if !ok {
+			continue
+		}
+		if fetch.Len() == 0 {
+			replaced = append([]ast.Expression(nil), values...)
+		} else {
+			fetch.WriteString("\n" + dt.indentStr())
+		}
+		dt.nextValueCount++
+		name := fmt.Sprintf("nextValue%d", dt.nextValueCount)
+		seqName := sequenceName(next.SequenceName)
+		ind := dt.indentStr()
+		fetch.WriteString(fmt.Sprintf("// NEXT VALUE FOR %s\n", seqName))
+		fetch.WriteString(fmt.Sprintf("%svar %s int64\n", ind, name))
+		fetch.WriteString(fmt.Sprintf("%sif v, err := %s; err != nil {\n", ind, dt.nextValueCall(seqName)))
+		fetch.WriteString(fmt.Sprintf("%s\t%s\n", ind, dt.buildErrorReturn()))
+		fetch.WriteString(fmt.Sprintf("%s} else {\n", ind))
+		fetch.WriteString(fmt.Sprintf("%s\t%s = v\n", ind, name))
+		fetch.WriteString(ind + "}")
+		replaced[i] = &ast.Variable{Name: "@" + name}
+	}
+	return replaced, fetch.String()
+}
+
+// withFetch puts the code fetching NEXT VALUE FOR before note, the note
+// generated code for a statement starts with.
+func (dt *dmlTranspiler) withFetch(fetch, note string) string {
+	if note == "" {
+		return fetch
+	}
+	return dt.prependNote(fetch, note)
+}
+
+// fetchInsertNextValues is fetchNextValues for the rows of an INSERT ...
+// VALUES. s is not modified.
+func (dt *dmlTranspiler) fetchInsertNextValues(s *ast.InsertStatement) (*ast.InsertStatement, string) {
+	var fetch []string
+	copied := *s
+	copied.Values = make([][]ast.Expression, len(s.Values))
+	for r, row := range s.Values {
+		var code string
+		if copied.Values[r], code = dt.fetchNextValues(row); code != "" {
+			fetch = append(fetch, code)
+		}
+	}
+	if len(fetch) == 0 {
+		return s, ""
+	}
+	return &copied, strings.Join(fetch, "\n"+dt.indentStr())
+}
+
+// fetchUpdateNextValues is fetchNextValues for the SET clauses of an
+// UPDATE. s is not modified.
+func (dt *dmlTranspiler) fetchUpdateNextValues(s *ast.UpdateStatement) (*ast.UpdateStatement, string) {
+	values := make([]ast.Expression, len(s.SetClauses))
+	for i, set := range s.SetClauses {
+		values[i] = set.Value
+	}
+	replaced, fetch := dt.fetchNextValues(values)
+	if fetch == "" {
+		return s, ""
+	}
+	copied := *s
+	copied.SetClauses = make([]*ast.SetClause, len(s.SetClauses))
+	for i, set := range s.SetClauses {
+		clause := *set
+		clause.Value = replaced[i]
+		copied.SetClauses[i] = &clause
+	}
+	return &copied, fetch
+}
+
+// nextValueSQL returns NEXT VALUE FOR as SQL for the dialect, or false
+// where the dialect has no sequences.
+func (dt *dmlTranspiler) nextValueSQL(seqName string) (string, bool) {
+	if dt.config.SequenceMode != "db" && dt.config.SequenceMode != "" {
+		return "", false
+	}
+	switch dt.config.SQLDialect {
+	case "postgres":
+		return fmt.Sprintf("nextval('%s')", seqName), true
+	case "sqlserver":
+		return "NEXT VALUE FOR " + seqName, true
+	}
+	return "", false
+}
+
+var nextValueForSQL = regexp.MustCompile(`(?i)\bNEXT\s+VALUE\s+FOR\s+([\w.\[\]]+)`)
+
+// normalizeSequenceSQL rewrites NEXT VALUE FOR left in a query for the
+// dialect, warning where it has no sequences.
+func (dt *dmlTranspiler) normalizeSequenceSQL(query string) string {
+	if dt.config.SQLDialect == "sqlserver" || !nextValueForSQL.MatchString(query) {
+		return query
+	}
+	return nextValueForSQL.ReplaceAllStringFunc(query, func(m string) string {
+		name := strings.NewReplacer("[", "", "]", "").Replace(nextValueForSQL.FindStringSubmatch(m)[1])
+		if sql, ok := dt.nextValueSQL(name); ok {
+			return sql
+		}
+		dt.warnings = append(dt.warnings, fmt.Sprintf("%s: NEXT VALUE FOR %s inside this query has no %s equivalent; assign it to a variable first",
+			dt.currentProcName, name, dt.config.SQLDialect))
+		return m
+	})
+}
+
+// isSequenceRangeProc reports whether s calls sp_sequence_get_range.
+func isSequenceRangeProc(s *ast.ExecStatement) bool {
+	if s.Procedure == nil || len(s.Procedure.Parts) == 0 {
+		return false
+	}
+	return strings.EqualFold(s.Procedure.Parts[len(s.Procedure.Parts)-1].Value, "sp_sequence_get_range")
+}
+
+// sequenceRangeParams are sp_sequence_get_range's parameters, in order.
+var sequenceRangeParams = []string{"@sequence_name", "@range_size", "@range_first_value", "@range_last_value"}
+
+// transpileSequenceRange converts EXEC sp_sequence_get_range to
+// tsqlruntime.SequenceRange, assigning the first and last values to the
+// OUTPUT variables.
+func (dt *dmlTranspiler) transpileSequenceRange(s *ast.ExecStatement) (string, error) {
+	args := map[string]ast.Expression{}
+	for i, p := range s.Parameters {
+		name := strings.ToLower(p.Name)
+		if name == "" {
+			if i >= len(sequenceRangeParams) {
+				continue
+			}
+			name = sequenceRangeParams[i]
+		}
+		if !strings.HasPrefix(name, "@") {
+			name = "@" + name
+		}
+		args[name] = p.Value
+	}
+	if args["@sequence_name"] == nil {
+		return "", fmt.Errorf("sp_sequence_get_range requires @sequence_name")
+	}
+	if (dt.config.SequenceMode != "db" && dt.config.SequenceMode != "") || !dt.hasSequences() {
+		return "", fmt.Errorf("sp_sequence_get_range requires --sequence-mode=db and a dialect with sequences (postgres, mysql, sqlite, sqlserver)")
+	}
+
+	name := dt.exprToGoValue(args["@sequence_name"])
+	if lit, ok := args["@sequence_name"].(*ast.StringLiteral); ok {
+		name = fmt.Sprintf("%q", strings.NewReplacer("[", "", "]", "").Replace(lit.Value))
+	}
+	size := "1"
+	if e := args["@range_size"]; e != nil {
+		size = dt.exprToGoValue(e)
+		if ti := dt.inferType(e); ti == nil || ti.goType != "int64" {
+			size = fmt.Sprintf("int64(%s)", size)
+		}
+	}
+	// OUTPUT variables are usually SQL_VARIANT (any) or BIGINT
+	var results, assigns []string
+	for _, out := range []struct{ param, value string }{
+		{"@range_first_value", "firstValue"},
+		{"@range_last_value", "lastValue"},
+	} {
+		v, ok := args[out.param].(*ast.Variable)
+		if !ok {
+			results = append(results, "_")
+			continue
+		}
+		results = append(results, out.value)
+		value := out.value
+		if ti := dt.inferType(v); ti != nil && ti.goType != "int64" && ti.goType != "any" && ti.goType != "interface{}" {
+			value = fmt.Sprintf("%s(%s)", ti.goType, value)
+		}
+		assigns = append(assigns, fmt.Sprintf("%s = %s", goIdentifier(strings.TrimPrefix(v.Name, "@")), value))
+	}
+
+	dt.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+	ind := dt.indentStr()
+	var out strings.Builder
+	if dt.emitOriginal() {
+		out.WriteString(fmt.Sprintf("// Original: %s\n", truncateSQL(s.String(), 100)))
+		out.WriteString(ind)
+	}
+	out.WriteString("// EXEC sp_sequence_get_range\n")
+	if len(assigns) == 0 {
+		out.WriteString(fmt.Sprintf("%sif _, _, err := tsqlruntime.SequenceRange(ctx, %s, %q, %s, %s); err != nil {\n",
+			ind, dt.getDBVar(), dt.config.SQLDialect, name, size))
+		out.WriteString(ind + "\t" + dt.buildErrorReturn() + "\n")
+		out.WriteString(ind + "}")
+		return out.String(), nil
+	}
+	out.WriteString(fmt.Sprintf("%sif %s, err := tsqlruntime.SequenceRange(ctx, %s, %q, %s, %s); err != nil {\n",
+		ind, strings.Join(results, ", "), dt.getDBVar(), dt.config.SQLDialect, name, size))
+	out.WriteString(ind + "\t" + dt.buildErrorReturn() + "\n")
+	out.WriteString(ind + "} else {\n")
+	for _, a := range assigns {
+		out.WriteString(ind + "\t" + a + "\n")
+	}
+	out.WriteString(ind + "}")
+	return out.String(), nil
+}
+
+// transpileAlterSequence converts ALTER SEQUENCE ... RESTART WITH in a
+// procedure to tsqlruntime.RestartSequence. Other changes to a sequence
+// are DDL, and skipped.
+func (t *transpiler) transpileAlterSequence(s *ast.AlterSequenceStatement) (string, bool) {
+	if !t.dmlEnabled || s.RestartWith == nil || s.IncrementBy != nil || s.MinValue != nil || s.MaxValue != nil ||
+		s.NoMinValue || s.NoMaxValue || s.Cycle || s.NoCycle || s.Cache != nil || s.NoCache ||
+		(t.dmlConfig.SequenceMode != "db" && t.dmlConfig.SequenceMode != "") || !t.hasSequences() {
+		return "", false
+	}
+	value, err := t.transpileExpression(s.RestartWith)
+	if err != nil {
+		return "", false
+	}
+	if ti := t.inferType(s.RestartWith); ti == nil || ti.goType != "int64" {
+		value = fmt.Sprintf("int64(%s)", value)
+	}
+	t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+	dt := &dmlTranspiler{transpiler: t, config: t.dmlConfig}
+	seqName := sequenceName(s.Name)
+	ind := t.indentStr()
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("// ALTER SEQUENCE %s RESTART\n", seqName))
+	out.WriteString(fmt.Sprintf("%sif err := tsqlruntime.RestartSequence(ctx, %s, %q, %q, %s); err != nil {\n",
+		ind, dt.getDBVar(), t.dmlConfig.SQLDialect, seqName, value))
+	out.WriteString(ind + "\t" + t.buildErrorReturn() + "\n")
+	out.WriteString(ind + "}")
+	return out.String(), true
+}
+
+// SequenceDefaults returns the columns of every CREATE TABLE in source
+// whose DEFAULT is NEXT VALUE FOR a sequence, as table -> column ->
+// sequence.
+func SequenceDefaults(source string) (map[string]map[string]string, error) {
+	program, errors := tsqlparser.Parse(stripGoStatements(source))
+	if len(errors) > 0 {
+		return nil, fmt.Errorf("parse errors:\n%s", strings.Join(errors, "\n"))
+	}
+	return sequenceDefaultsIn(program), nil
+}
+
+// sequenceDefaultsIn is SequenceDefaults for a parsed program.
+func sequenceDefaultsIn(program *ast.Program) map[string]map[string]string {
+	tables := map[string]map[string]string{}
+	if program == nil {
+		return tables
+	}
+	for _, stmt := range program.Statements {
+		create, ok := stmt.(*ast.CreateTableStatement)
+		if !ok || create.IsTemporary || create.Name == nil || len(create.Name.Parts) == 0 {
+			continue
+		}
+		table := create.Name.Parts[len(create.Name.Parts)-1].Value
+		for _, col := range create.Columns {
+			if seq := columnSequence(col); seq != "" {
+				if tables[table] == nil {
+					tables[table] = map[string]string{}
+				}
+				tables[table][col.Name.Value] = seq
+			}
+		}
+	}
+	return tables
+}
+
+// columnSequence returns the sequence a column's DEFAULT takes values
+// from, or "".
+func columnSequence(col *ast.ColumnDefinition) string {
+	if next, ok := col.Default.(*ast.NextValueForExpression); ok {
+		return sequenceName(next.SequenceName)
+	}
+	return ""
+}
+
+// collectSequenceDefaults merges the configured sequence defaults with the
+// tables created in the program being transpiled. Table names are
+// lower-cased; column names keep their case for the INSERTs they're added
+// to.
+func (t *transpiler) collectSequenceDefaults(program *ast.Program) {
+	t.sequenceDefaults = map[string]map[string]string{}
+	t.addSequenceDefaults(t.dmlConfig.SequenceDefaults)
+	t.addSequenceDefaults(sequenceDefaultsIn(program))
+}
+
+func (t *transpiler) addSequenceDefaults(tables map[string]map[string]string) {
+	for table, cols := range tables {
+		key := strings.ToLower(unqualifiedName(table))
+		if t.sequenceDefaults[key] == nil {
+			t.sequenceDefaults[key] = map[string]string{}
+		}
+		for col, seq := range cols {
+			t.sequenceDefaults[key][col] = seq
+		}
+	}
+}
+
+// fillSequenceDefaults returns s with the columns defaulting to a sequence
+// added where the dialect can't default them itself. s is not modified.
+func (dt *dmlTranspiler) fillSequenceDefaults(s *ast.InsertStatement) *ast.InsertStatement {
+	if len(s.Columns) == 0 || len(s.Values) == 0 || !dt.hasSequences() ||
+		(dt.config.SequenceMode != "db" && dt.config.SequenceMode != "") {
+		return s
+	}
+	if _, ok := dt.nextValueSQL(""); ok {
+		return s
+	}
+	defaults := dt.sequenceDefaults[strings.ToLower(dt.extractInsertTable(s))]
+	if len(defaults) == 0 {
+		return s
+	}
+	listed := map[string]bool{}
+	for _, col := range s.Columns {
+		listed[strings.ToLower(col.Value)] = true
+	}
+	var missing []string
+	for col := range defaults {
+		if !listed[strings.ToLower(col)] {
+			missing = append(missing, col)
+		}
+	}
+	if len(missing) == 0 {
+		return s
+	}
+	sort.Strings(missing)
+
+	copied := *s
+	copied.Columns = append([]*ast.Identifier(nil), s.Columns...)
+	copied.Values = make([][]ast.Expression, len(s.Values))
+	for r, row := range s.Values {
+		copied.Values[r] = append([]ast.Expression(nil), row...)
+	}
+	for _, col := range missing {
+		next := &ast.NextValueForExpression{SequenceName: &ast.QualifiedIdentifier{}}
+		for _, part := range strings.Split(defaults[col], ".") {
+			next.SequenceName.Parts = append(next.SequenceName.Parts, &ast.Identifier{Value: part})
+		}
+		copied.Columns = append(copied.Columns, &ast.Identifier{Value: col})
+		for r := range copied.Values {
+			copied.Values[r] = append(copied.Values[r], next)
+		}
+	}
+	return &copied
+}
+
+// sequenceDDL returns CREATE, ALTER or DROP SEQUENCE for the dialect, or
+// false if stmt isn't one. MySQL and SQLite get the table tsqlruntime
+// uses in place of a sequence.
+func (t *transpiler) sequenceDDL(stmt ast.Statement) (string, bool) {
+	dialect := t.dmlConfig.SQLDialect
+	switch s := stmt.(type) {
+	case *ast.CreateSequenceStatement:
+		name := sequenceName(s.Name)
+		start, minValue := sequenceStart(s)
+		increment := "1"
+		if s.IncrementBy != nil {
+			increment = s.IncrementBy.String()
+		}
+		switch dialect {
+		case "postgres":
+			ddl := "CREATE SEQUENCE " + name
+			if s.DataType != nil {
+				ddl += " AS " + postgresSequenceType(s.DataType.Name)
+			}
+			ddl += " START WITH " + start + " INCREMENT BY " + increment
+			if minValue != "" {
+				ddl += " MINVALUE " + minValue
+			}
+			if s.MaxValue != nil && !s.NoMaxValue {
+				ddl += " MAXVALUE " + s.MaxValue.String()
+			}
+			if s.Cache != nil && !s.NoCache {
+				ddl += " CACHE " + s.Cache.String()
+			}
+			if s.Cycle {
+				ddl += " CYCLE"
+			}
+			return ddl, true
+		case "mysql", "sqlite":
+			table := tsqlruntime.SequenceTable(name)
+			if s.Cycle || (s.MaxValue != nil && !s.NoMaxValue) {
+				t.ddlWarnings = append(t.ddlWarnings, fmt.Sprintf("Sequence %s: MAXVALUE and CYCLE aren't enforced on %s", name, dialect))
+			}
+			return fmt.Sprintf("CREATE TABLE %s (next_value BIGINT NOT NULL, increment_by BIGINT NOT NULL);\nINSERT INTO %s (next_value, increment_by) VALUES (%s, %s)",
+				table, table, start, increment), true
+		}
+	case *ast.AlterSequenceStatement:
+		if dialect != "mysql" && dialect != "sqlite" {
+			break
+		}
+		table := tsqlruntime.SequenceTable(sequenceName(s.Name))
+		var sets []string
+		if s.RestartWith != nil {
+			sets = append(sets, "next_value = "+s.RestartWith.String())
+		}
+		if s.IncrementBy != nil {
+			sets = append(sets, "increment_by = "+s.IncrementBy.String())
+		}
+		if len(sets) == 0 {
+			return "", false
+		}
+		return fmt.Sprintf("UPDATE %s SET %s", table, strings.Join(sets, ", ")), true
+	case *ast.DropSequenceStatement:
+		if dialect != "mysql" && dialect != "sqlite" {
+			break
+		}
+		ddl := "DROP TABLE "
+		if s.IfExists {
+			ddl += "IF EXISTS "
+		}
+		return ddl + tsqlruntime.SequenceTable(sequenceName(s.Name)), true
+	default:
+		return "", false
+	}
+	return stmt.String(), true
+}
+
+// sequenceStart returns a sequence's first value and, when that defaults
+// to the type's minimum as it does in SQL Server, the minimum to declare.
+func sequenceStart(s *ast.CreateSequenceStatement) (start, minValue string) {
+	if s.MinValue != nil && !s.NoMinValue {
+		minValue = s.MinValue.String()
+	}
+	if s.StartWith != nil {
+		return s.StartWith.String(), minValue
+	}
+	if minValue != "" {
+		return minValue, minValue
+	}
+	typeName := "BIGINT"
+	if s.DataType != nil {
+		typeName = strings.ToUpper(s.DataType.Name)
+	}
+	minimum := map[string]string{
+		"TINYINT":  "0",
+		"SMALLINT": "-32768",
+		"INT":      "-2147483648",
+	}[typeName]
+	if minimum == "" {
+		minimum = "-9223372036854775808"
+	}
+	return minimum, minimum
+}
+
+// postgresSequenceType returns the PostgreSQL type for a sequence's T-SQL
+// type; PostgreSQL sequences are smallint, integer or bigint.
+func postgresSequenceType(sqlType string) string {
+	switch strings.ToUpper(sqlType) {
+	case "TINYINT", "SMALLINT":
+		return "smallint"
+	case "INT":
+		return "integer"
+	}
+	return "bigint"
+}
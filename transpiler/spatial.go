@@ -0,0 +1,440 @@
+package transpiler
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// Spatial and hierarchyid types
+//
+// GEOMETRY, GEOGRAPHY and HIERARCHYID parameters, variables and scan
+// targets are Go strings. DMLConfig.SpatialMode says what a spatial string
+// holds:
+//
+//   - wkt: WKT, "POINT(-122.3 47.6)" (default)
+//   - postgis: PostGIS's EWKT, "SRID=4326;POINT(-122.3 47.6)". PostgreSQL
+//     parses it given for a geometry or geography parameter, SELECT @g =
+//     col reads col with ST_AsEWKT, and spatial methods in queries become
+//     ST_ functions: Location.STDistance(@p) is ST_Distance(Location,
+//     CAST($1 AS geography)).
+//
+// A hierarchyid is its materialized path, "/1/3/", as ToString() gives it.
+// In queries, which keep paths in text columns, OrgNode.IsDescendantOf(@p)
+// = 1 becomes a LIKE on the path's prefix and GetLevel() counts its
+// slashes. In Go code the methods of both and the static constructors
+// (geography::Point, hierarchyid::GetRoot and the like) become tsqlruntime
+// calls. SQL Server keeps them all as they are; what has no translation is
+// kept with a warning.
+
+// Spatial modes.
+const (
+	SpatialWKT     = "wkt"
+	SpatialPostGIS = "postgis"
+)
+
+// isCLRType reports whether a T-SQL type is one handled here.
+func isCLRType(name string) bool {
+	switch name {
+	case "GEOMETRY", "GEOGRAPHY", "HIERARCHYID":
+		return true
+	}
+	return false
+}
+
+// postGIS reports whether spatial values are EWKT for PostGIS.
+func (t *transpiler) postGIS() bool {
+	return t.dmlConfig.SpatialMode == SpatialPostGIS && t.dmlConfig.SQLDialect == "postgres"
+}
+
+// defaultSRID is the SRID Parse gives values of a spatial type.
+func defaultSRID(typeName string) string {
+	if typeName == "GEOGRAPHY" {
+		return "4326"
+	}
+	return "0"
+}
+
+// floatArg adapts a numeric argument for a tsqlruntime helper taking
+// float64.
+func (t *transpiler) floatArg(expr ast.Expression, transpiled string) string {
+	ti := t.inferType(expr)
+	switch {
+	case ti.goType == "float64" || isIntegerLiteral(expr):
+		return transpiled
+	case ti.isDecimal:
+		return t.decimalToFloat(transpiled)
+	}
+	return fmt.Sprintf("float64(%s)", transpiled)
+}
+
+// clrArgs transpiles the arguments of a method, NULL becoming "" as the
+// tsqlruntime helpers take it.
+func (t *transpiler) clrArgs(exprs []ast.Expression) ([]string, error) {
+	var args []string
+	for _, arg := range exprs {
+		if _, ok := arg.(*ast.NullLiteral); ok {
+			args = append(args, `""`)
+			continue
+		}
+		a, err := t.transpileExpression(arg)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, a)
+	}
+	return args, nil
+}
+
+// transpileStaticMethodCall converts geography::Point(...),
+// hierarchyid::GetRoot() and the other constructors.
+func (t *transpiler) transpileStaticMethodCall(e *ast.StaticMethodCall) (string, error) {
+	typeName := strings.ToUpper(e.TypeName)
+	method := strings.ToLower(e.MethodName)
+	args, err := t.clrArgs(e.Arguments)
+	if err != nil {
+		return "", err
+	}
+	withSRID := func(wkt string, srid ast.Expression, sridCode string) string {
+		if !t.postGIS() {
+			return wkt
+		}
+		t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+		if srid != nil {
+			sridCode = t.intArg(srid, sridCode)
+		}
+		return fmt.Sprintf("tsqlruntime.EWKT(%s, %s)", sridCode, wkt)
+	}
+
+	switch {
+	case typeName == "HIERARCHYID" && method == "getroot" && len(args) == 0:
+		return `"/"`, nil
+	case typeName == "HIERARCHYID" && method == "parse" && len(args) == 1:
+		return args[0], nil
+	case typeName != "GEOGRAPHY" && typeName != "GEOMETRY":
+	case method == "point" && len(args) == 3:
+		x, y := 0, 1
+		if typeName == "GEOGRAPHY" {
+			x, y = 1, 0 // Latitude first
+		}
+		t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+		wkt := fmt.Sprintf("tsqlruntime.WKTPoint(%s, %s)",
+			t.floatArg(e.Arguments[x], args[x]), t.floatArg(e.Arguments[y], args[y]))
+		return withSRID(wkt, e.Arguments[2], args[2]), nil
+	case strings.HasPrefix(method, "st") && strings.HasSuffix(method, "fromtext") && len(args) == 2:
+		return withSRID(args[0], e.Arguments[1], args[1]), nil
+	case method == "parse" && len(args) == 1:
+		return withSRID(args[0], nil, defaultSRID(typeName)), nil
+	}
+	return "", fmt.Errorf("%s::%s is not supported; supported are geography::Point, geometry::Point, STGeomFromText and the other ST...FromText constructors, Parse, hierarchyid::GetRoot and hierarchyid::Parse", e.TypeName, e.MethodName)
+}
+
+// staticMethodType returns the typeInfo of a static method's value.
+func staticMethodType(e *ast.StaticMethodCall) *typeInfo {
+	typeName := strings.ToUpper(e.TypeName)
+	if !isCLRType(typeName) {
+		return &typeInfo{goType: "any"}
+	}
+	return &typeInfo{goType: "string", isString: true, clrType: typeName}
+}
+
+// transpileCLRMethod converts a method called on a spatial or hierarchyid
+// value in Go code.
+func (t *transpiler) transpileCLRMethod(e *ast.MethodCallExpression, clrType string) (string, error) {
+	obj, err := t.transpileExpression(e.Object)
+	if err != nil {
+		return "", err
+	}
+	args, err := t.clrArgs(e.Arguments)
+	if err != nil {
+		return "", err
+	}
+	call := func(fn string, list ...string) (string, error) {
+		t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+		return fmt.Sprintf("tsqlruntime.%s(%s)", fn, strings.Join(append([]string{obj}, list...), ", ")), nil
+	}
+
+	method := strings.ToLower(e.MethodName)
+	if clrType == "HIERARCHYID" {
+		switch {
+		case method == "tostring" && len(args) == 0:
+			return obj, nil
+		case method == "getlevel" && len(args) == 0:
+			return call("HierarchyGetLevel")
+		case method == "getancestor" && len(args) == 1:
+			return call("HierarchyGetAncestor", t.intArg(e.Arguments[0], args[0]))
+		case method == "isdescendantof" && len(args) == 1:
+			return call("HierarchyIsDescendantOf", args[0])
+		case method == "getdescendant" && len(args) == 2:
+			return call("HierarchyGetDescendant", args...)
+		case method == "getreparentedvalue" && len(args) == 2:
+			return call("HierarchyGetReparentedValue", args...)
+		}
+		return "", fmt.Errorf("hierarchyid method %s is not supported; supported are ToString, GetLevel, GetAncestor, IsDescendantOf, GetDescendant and GetReparentedValue", e.MethodName)
+	}
+	if (method == "stastext" || method == "tostring") && len(args) == 0 {
+		return call("SpatialWKT")
+	}
+	return "", fmt.Errorf("%s method %s is not supported in Go code; supported are STAsText and ToString (spatial methods in queries are translated with --spatial-mode=postgis)",
+		strings.ToLower(clrType), e.MethodName)
+}
+
+// clrMethodType returns the typeInfo of a method called on a spatial or
+// hierarchyid value, or nil for other methods.
+func (t *transpiler) clrMethodType(e *ast.MethodCallExpression) *typeInfo {
+	clrType := t.inferType(e.Object).clrType
+	if clrType == "" {
+		return nil
+	}
+	switch strings.ToLower(e.MethodName) {
+	case "getlevel":
+		return &typeInfo{goType: "int16", isNumeric: true}
+	case "isdescendantof":
+		return &typeInfo{goType: "bool", isBool: true}
+	case "getancestor", "getdescendant", "getreparentedvalue":
+		return &typeInfo{goType: "string", isString: true, clrType: clrType}
+	case "tostring", "stastext":
+		return &typeInfo{goType: "string", isString: true}
+	}
+	return &typeInfo{goType: "any"}
+}
+
+// Methods of spatial and hierarchyid values rewritten in queries.
+var (
+	clrMethodSQLRe  = regexp.MustCompile(`(?i)^(@?[\w$#]+(?:\.[\w$#]+)?)\.(ToString|GetLevel|GetAncestor|IsDescendantOf|GetDescendant|GetReparentedValue|STAsText|STAsBinary|STDistance|STIntersects|STContains|STWithin|STEquals|STArea|STLength|STBuffer)\(`)
+	clrStaticSQLRe  = regexp.MustCompile(`(?i)^(geography|geometry|hierarchyid)::(\w+)\(`)
+	sqlBitCompareRe = regexp.MustCompile(`^\s*=\s*([01])\b`)
+)
+
+// clrMethods are the spatial and hierarchyid methods, which aren't UDFs
+// in schema.name(...) form.
+var clrMethods = map[string]bool{
+	"tostring": true, "getlevel": true, "getancestor": true, "isdescendantof": true,
+	"getdescendant": true, "getreparentedvalue": true, "stastext": true, "stasbinary": true,
+	"stdistance": true, "stintersects": true, "stcontains": true, "stwithin": true,
+	"stequals": true, "starea": true, "stlength": true, "stbuffer": true,
+}
+
+// postgisFunctions are the PostGIS functions of spatial methods.
+var postgisFunctions = map[string]string{
+	"STASTEXT": "ST_AsText", "STASBINARY": "ST_AsBinary", "STDISTANCE": "ST_Distance",
+	"STINTERSECTS": "ST_Intersects", "STCONTAINS": "ST_Contains", "STWITHIN": "ST_Within",
+	"STEQUALS": "ST_Equals", "STAREA": "ST_Area", "STLENGTH": "ST_Length", "STBUFFER": "ST_Buffer",
+}
+
+// rewriteCLRSQL rewrites the spatial and hierarchyid methods and
+// constructors in a query for the dialect, before its variables are bound.
+func (dt *dmlTranspiler) rewriteCLRSQL(query string) string {
+	if dt.config.SQLDialect == "sqlserver" {
+		return query
+	}
+	var b strings.Builder
+	for i := 0; i < len(query); {
+		if query[i] == '\'' {
+			end := sqlStringEnd(query, i)
+			b.WriteString(query[i:end])
+			i = end
+			continue
+		}
+		if i > 0 && (isSQLIdentChar(query[i-1]) || query[i-1] == '@' || query[i-1] == '.' || query[i-1] == ':') {
+			b.WriteByte(query[i])
+			i++
+			continue
+		}
+		static := true
+		m := clrStaticSQLRe.FindStringSubmatchIndex(query[i:])
+		if m == nil {
+			static = false
+			m = clrMethodSQLRe.FindStringSubmatchIndex(query[i:])
+		}
+		if m == nil {
+			b.WriteByte(query[i])
+			i++
+			continue
+		}
+		open := i + m[1] - 1
+		end := sqlParenEnd(query, open)
+		if end < 0 {
+			b.WriteString(query[i:])
+			break
+		}
+		first, name := query[i+m[2]:i+m[3]], query[i+m[4]:i+m[5]]
+		var args []string
+		if inner := strings.TrimSpace(query[open+1 : end]); inner != "" {
+			for _, arg := range splitSQLArgs(inner) {
+				args = append(args, dt.rewriteCLRSQL(strings.TrimSpace(arg)))
+			}
+		}
+		next := end + 1
+
+		var sql string
+		var ok bool
+		if static {
+			sql, ok = dt.clrStaticSQL(strings.ToUpper(first), strings.ToUpper(name), args)
+		} else {
+			// Predicates compared with 1 or 0 become booleans
+			compare := ""
+			if c := sqlBitCompareRe.FindStringSubmatchIndex(query[next:]); c != nil {
+				compare = query[next+c[2] : next+c[3]]
+				next += c[1]
+			}
+			sql, ok = dt.clrMethodSQL(first, strings.ToUpper(name), args, compare)
+			if !ok {
+				next = end + 1
+			}
+		}
+		if !ok {
+			call := query[i : end+1]
+			hint := ""
+			if !static && postgisFunctions[strings.ToUpper(name)] != "" || static && !strings.EqualFold(first, "hierarchyid") {
+				hint = " (--spatial-mode=postgis translates it for postgres)"
+				if dt.postGIS() {
+					hint = ""
+				}
+			}
+			dt.warn(RuleUntranslated, fmt.Sprintf("%s: %s has no %s translation; it is kept as it is%s",
+				dt.currentProcName, call, dt.config.SQLDialect, hint))
+			sql = call
+		}
+		b.WriteString(sql)
+		i = next
+	}
+	return b.String()
+}
+
+// clrStaticSQL returns a constructor as SQL, or false.
+func (dt *dmlTranspiler) clrStaticSQL(typeName, method string, args []string) (string, bool) {
+	if typeName == "HIERARCHYID" {
+		switch {
+		case method == "GETROOT" && len(args) == 0:
+			return "'/'", true
+		case method == "PARSE" && len(args) == 1:
+			return args[0], true
+		}
+		return "", false
+	}
+	if !dt.postGIS() {
+		return "", false
+	}
+	var sql string
+	switch {
+	case method == "POINT" && len(args) == 3:
+		x, y := args[0], args[1]
+		if typeName == "GEOGRAPHY" {
+			x, y = y, x
+		}
+		sql = fmt.Sprintf("ST_SetSRID(ST_MakePoint(%s, %s), %s)", x, y, args[2])
+	case strings.HasPrefix(method, "ST") && strings.HasSuffix(method, "FROMTEXT") && len(args) == 2:
+		sql = fmt.Sprintf("ST_GeomFromText(%s, %s)", args[0], args[1])
+	case method == "PARSE" && len(args) == 1:
+		sql = fmt.Sprintf("ST_GeomFromText(%s, %s)", args[0], defaultSRID(typeName))
+	default:
+		return "", false
+	}
+	if typeName == "GEOGRAPHY" {
+		sql += "::geography"
+	}
+	return sql, true
+}
+
+// clrMethodSQL returns a method called on obj as SQL, or false. compare is
+// the 1 or 0 a predicate is compared with, if any.
+func (dt *dmlTranspiler) clrMethodSQL(obj, method string, args []string, compare string) (string, bool) {
+	objType := dt.clrVariableType(obj)
+	if fn := postgisFunctions[method]; fn != "" || (method == "TOSTRING" && (objType == "GEOMETRY" || objType == "GEOGRAPHY")) {
+		if !dt.postGIS() {
+			if method == "TOSTRING" || method == "STASTEXT" {
+				return obj, true // The value is its WKT
+			}
+			return "", false
+		}
+		if fn == "" {
+			fn = "ST_AsText"
+		}
+		operands := []string{dt.postgisOperand(obj)}
+		for _, arg := range args {
+			operands = append(operands, dt.postgisOperand(arg))
+		}
+		sql := fmt.Sprintf("%s(%s)", fn, strings.Join(operands, ", "))
+		if compare == "0" {
+			sql = "NOT " + sql
+		}
+		return sql, true
+	}
+
+	switch {
+	case method == "TOSTRING" && len(args) == 0:
+		return obj, true
+	case method == "GETLEVEL" && len(args) == 0:
+		return fmt.Sprintf("(LENGTH(%s) - LENGTH(REPLACE(%s, '/', '')) - 1)", obj, obj), true
+	case method == "ISDESCENDANTOF" && len(args) == 1:
+		prefix := fmt.Sprintf("%s || '%%'", args[0])
+		if dt.config.SQLDialect == "mysql" {
+			prefix = fmt.Sprintf("CONCAT(%s, '%%')", args[0])
+		}
+		like := "LIKE"
+		if compare == "0" {
+			like = "NOT LIKE"
+		}
+		sql := fmt.Sprintf("%s %s %s", obj, like, prefix)
+		if compare == "" {
+			sql = "(" + sql + ")"
+		}
+		return sql, true
+	case method == "GETANCESTOR" && len(args) == 1 && isIntegerText(args[0]):
+		if dt.config.SQLDialect != "postgres" && dt.config.SQLDialect != "mysql" {
+			return "", false
+		}
+		return fmt.Sprintf("REGEXP_REPLACE(%s, '([^/]+/){%s}$', '')", obj, args[0]), true
+	}
+	return "", false
+}
+
+// clrVariableType returns the spatial or hierarchyid type of an @variable
+// in a query, or "".
+func (dt *dmlTranspiler) clrVariableType(sql string) string {
+	if !strings.HasPrefix(sql, "@") {
+		return ""
+	}
+	if ti := dt.symbols.lookup(goIdentifier(strings.TrimPrefix(sql, "@"))); ti != nil {
+		return ti.clrType
+	}
+	return ""
+}
+
+// postgisOperand casts a spatial variable's EWKT to its PostGIS type.
+func (dt *dmlTranspiler) postgisOperand(sql string) string {
+	switch dt.clrVariableType(sql) {
+	case "GEOMETRY":
+		return fmt.Sprintf("CAST(%s AS geometry)", sql)
+	case "GEOGRAPHY":
+		return fmt.Sprintf("CAST(%s AS geography)", sql)
+	}
+	return sql
+}
+
+// clrColumnSQL returns the SQL reading expr into variable, as EWKT where
+// variable is spatial and values are PostGIS's.
+func (dt *dmlTranspiler) clrColumnSQL(variable, expr string) string {
+	switch dt.clrVariableType(variable) {
+	case "GEOMETRY", "GEOGRAPHY":
+		if dt.postGIS() {
+			return fmt.Sprintf("ST_AsEWKT(%s)", expr)
+		}
+	}
+	return expr
+}
+
+func isIntegerText(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
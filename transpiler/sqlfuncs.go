@@ -0,0 +1,178 @@
+package transpiler
+
+import (
+	"strings"
+)
+
+// sqlCallRewriter rewrites a call to a T-SQL function in query text, given
+// its upper-case name and its arguments, with nested calls already
+// rewritten. It returns false to keep the call.
+type sqlCallRewriter func(name string, args []string) (string, bool)
+
+// rewriteSQLCalls rewrites the calls in query to the functions in names,
+// innermost first. String literals are left alone.
+func rewriteSQLCalls(query string, names map[string]bool, rewrite sqlCallRewriter) string {
+	var b strings.Builder
+	for i := 0; i < len(query); {
+		c := query[i]
+		if c == '\'' {
+			end := sqlStringEnd(query, i)
+			b.WriteString(query[i:end])
+			i = end
+			continue
+		}
+		if !isSQLIdentStart(c) || (i > 0 && (isSQLIdentChar(query[i-1]) || query[i-1] == '.' || query[i-1] == '@')) {
+			b.WriteByte(c)
+			i++
+			continue
+		}
+		j := i
+		for j < len(query) && isSQLIdentChar(query[j]) {
+			j++
+		}
+		word := query[i:j]
+		open := j
+		for open < len(query) && query[open] == ' ' {
+			open++
+		}
+		name := strings.ToUpper(word)
+		if !names[name] || open == len(query) || query[open] != '(' {
+			b.WriteString(word)
+			i = j
+			continue
+		}
+		end := sqlParenEnd(query, open)
+		if end < 0 {
+			b.WriteString(query[i:])
+			break
+		}
+		args := splitSQLArgs(query[open+1 : end])
+		for n := range args {
+			args[n] = rewriteSQLCalls(args[n], names, rewrite)
+		}
+		if out, ok := rewrite(name, args); ok {
+			b.WriteString(out)
+		} else {
+			b.WriteString(word + "(" + strings.Join(args, ", ") + ")")
+		}
+		i = end + 1
+	}
+	return b.String()
+}
+
+// sqlStringEnd returns the index after the string literal starting at
+// query[start], allowing for doubled quotes.
+func sqlStringEnd(query string, start int) int {
+	for i := start + 1; i < len(query); i++ {
+		if query[i] == '\'' {
+			if i+1 < len(query) && query[i+1] == '\'' {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(query)
+}
+
+// sqlParenEnd returns the index of the parenthesis closing the one at
+// query[open], or -1.
+func sqlParenEnd(query string, open int) int {
+	depth := 0
+	for i := open; i < len(query); i++ {
+		switch query[i] {
+		case '\'':
+			i = sqlStringEnd(query, i) - 1
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// splitSQLArgs splits a function's argument list at top-level commas.
+func splitSQLArgs(list string) []string {
+	var args []string
+	depth, start := 0, 0
+	for i := 0; i < len(list); i++ {
+		switch list[i] {
+		case '\'':
+			i = sqlStringEnd(list, i) - 1
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				args = append(args, strings.TrimSpace(list[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	if rest := strings.TrimSpace(list[start:]); rest != "" || len(args) > 0 {
+		args = append(args, rest)
+	}
+	return args
+}
+
+// sqlOperand parenthesises a SQL expression unless it is a single term, so
+// it can be used as an operand.
+func sqlOperand(expr string) string {
+	if isSQLTerm(expr) {
+		return expr
+	}
+	return "(" + expr + ")"
+}
+
+// isSQLTerm reports whether expr is a single term: a name, placeholder,
+// number, string or function call.
+func isSQLTerm(expr string) bool {
+	if expr == "" {
+		return false
+	}
+	if expr[0] == '\'' {
+		return sqlStringEnd(expr, 0) == len(expr)
+	}
+	if expr[0] == '(' {
+		return sqlParenEnd(expr, 0) == len(expr)-1
+	}
+	i := 0
+	if expr[0] == '-' || expr[0] == '$' || expr[0] == '@' || expr[0] == ':' {
+		i++
+	}
+	for i < len(expr) && (isSQLIdentChar(expr[i]) || expr[i] == '.' || expr[i] == '[' || expr[i] == ']' || expr[i] == '?') {
+		i++
+	}
+	if i < len(expr) && expr[i] == '(' {
+		return sqlParenEnd(expr, i) == len(expr)-1
+	}
+	return i == len(expr)
+}
+
+// sqlQuote returns s as a SQL string literal.
+func sqlQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// sqlUnquote returns the value of a SQL string literal, and whether lit is
+// one.
+func sqlUnquote(lit string) (string, bool) {
+	lit = strings.TrimPrefix(lit, "N")
+	if len(lit) < 2 || lit[0] != '\'' || sqlStringEnd(lit, 0) != len(lit) {
+		return "", false
+	}
+	return strings.ReplaceAll(lit[1:len(lit)-1], "''", "'"), true
+}
+
+func isSQLIdentStart(c byte) bool {
+	return isAlphaForCTE(c) || c == '_'
+}
+
+func isSQLIdentChar(c byte) bool {
+	return isAlphaNumForCTE(c) || c == '_'
+}
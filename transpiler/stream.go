@@ -0,0 +1,284 @@
+package transpiler
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ha1tch/tsqlparser"
+)
+
+// Streaming
+//
+// TranspileWithDMLEx holds the whole source, its AST, its comment index and
+// the generated code in memory at once, which for the largest legacy
+// scripts (tens of thousands of lines of procedures) runs to many times the
+// size of the file. A Streamer reads the source one GO-separated batch at a
+// time instead: each batch is parsed, transpiled and written to a spool
+// file, and its AST and comments are dropped before the next is read. The
+// package clause and imports are only known at the end, so they are
+// written first to the output and the spool copied after them. What
+// outlives a batch is what a later one may need: the table types, generated
+// columns and sequences created so far, the user-defined functions and the
+// warnings and contracts for the result.
+//
+// Lines reported in errors, side effects and performance notes are those
+// of the file, not of the batch. A file without GO separators is one batch
+// and gains nothing. Scripts (ScriptName) and the procedure-call backend need the
+// whole file and aren't streamed.
+//
+// A Streamer transpiling many files reuses its transpiler, clearing the
+// maps the last file grew rather than allocating them again:
+//
+//	s := transpiler.NewStreamer("orders", config)
+//	for _, path := range paths {
+//		in, _ := os.Open(path)
+//		out, _ := os.Create(goPath(path))
+//		result, err := s.Transpile(in, out)
+//		...
+//	}
+
+// maxStreamLine is the longest line a streamed source may have.
+const maxStreamLine = 16 << 20
+
+// TranspileStream transpiles the T-SQL read from r batch by batch, writing
+// the Go code to w. The result has no Code.
+func TranspileStream(r io.Reader, w io.Writer, packageName string, config DMLConfig) (*TranspileResult, error) {
+	return NewStreamer(packageName, config).Transpile(r, w)
+}
+
+// Streamer transpiles sources batch by batch (see TranspileStream).
+// Table types and passthrough stubs declared in one source are not
+// declared again in the next, as with --types-file over a directory.
+type Streamer struct {
+	packageName string
+	config      DMLConfig
+	last        *transpiler
+}
+
+// NewStreamer returns a streamer generating packageName with config.
+func NewStreamer(packageName string, config DMLConfig) *Streamer {
+	return &Streamer{packageName: packageName, config: config}
+}
+
+// Transpile transpiles the T-SQL read from r, writing the Go code to w.
+// The result has no Code.
+func (s *Streamer) Transpile(r io.Reader, w io.Writer) (*TranspileResult, error) {
+	if s.config.ScriptName != "" {
+		return nil, fmt.Errorf("scripts can't be streamed")
+	}
+	if s.config.Backend == BackendProcedureCall {
+		return nil, fmt.Errorf("the procedure-call backend can't be streamed")
+	}
+	t := s.next()
+
+	spool, err := os.CreateTemp("", "tgpiler-*.go")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		spool.Close()
+		os.Remove(spool.Name())
+	}()
+	body := bufio.NewWriter(spool)
+	written := 0
+	write := func(code string) error {
+		if written > 0 {
+			body.WriteString("\n\n")
+		}
+		written++
+		_, err := body.WriteString(code)
+		return err
+	}
+
+	batches := newBatchReader(r)
+	for {
+		batch, line, err := batches.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := t.transpileBatch(batch, line, write); err != nil {
+			return nil, err
+		}
+	}
+
+	decls, err := t.declarePendingTableTypes()
+	if err != nil {
+		return nil, err
+	}
+	tail := append(decls, t.passthroughStubs...)
+	for _, code := range tail {
+		if err := write(code); err != nil {
+			return nil, err
+		}
+	}
+	if !t.hasProcedures && written > 0 {
+		return nil, errNoProcedures()
+	}
+	t.addPackageImports(strings.Join(tail, "\n"))
+	if err := body.Flush(); err != nil {
+		return nil, err
+	}
+
+	var header strings.Builder
+	t.writeHeader(&header)
+	out := bufio.NewWriter(w)
+	out.WriteString(header.String())
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(out, spool); err != nil {
+		return nil, err
+	}
+	out.WriteString("\n")
+	if err := out.Flush(); err != nil {
+		return nil, err
+	}
+
+	result := t.result("")
+	s.config.DeclaredTableTypes = result.TableTypes
+	s.config.DeclaredPassthroughs = result.Passthroughs
+	return result, nil
+}
+
+// next returns the transpiler for the next source. The maps the last one
+// grew are cleared and handed on, keeping the space they took.
+func (s *Streamer) next() *transpiler {
+	t := newDMLTranspiler("", s.packageName, s.config)
+	if last := s.last; last != nil {
+		t.imports = cleared(last.imports)
+		t.cursors = cleared(last.cursors)
+		t.userFunctions = cleared(last.userFunctions)
+		t.generatedColumns = cleared(last.generatedColumns)
+		t.sequenceDefaults = cleared(last.sequenceDefaults)
+		t.addGeneratedColumns(t.dmlConfig.GeneratedColumns)
+		t.addSequenceDefaults(t.dmlConfig.SequenceDefaults)
+		t.keyColumns = cleared(last.keyColumns)
+		t.addKeyColumns(t.dmlConfig.KeyColumns)
+	}
+	s.last = t
+	return t
+}
+
+func cleared[K comparable, V any](m map[K]V) map[K]V {
+	clear(m)
+	return m
+}
+
+// parseErrorLine is the line of a parse error, "line 3, col 40: ...".
+var parseErrorLine = regexp.MustCompile(`^line \d+`)
+
+// fileLine returns the line of the file a line of the batch being
+// transpiled is on.
+func (t *transpiler) fileLine(line int) int {
+	return line + t.lineOffset
+}
+
+// transpileBatch transpiles a batch starting on line of its file, passing
+// each function to write.
+func (t *transpiler) transpileBatch(batch string, line int, write func(code string) error) error {
+	program, errors := tsqlparser.Parse(batch)
+	if len(errors) > 0 {
+		for i, e := range errors {
+			errors[i] = parseErrorLine.ReplaceAllStringFunc(e, func(m string) string {
+				n, _ := strconv.Atoi(m[len("line "):])
+				return fmt.Sprintf("line %d", n+line-1)
+			})
+		}
+		return fmt.Errorf("parse errors:\n%s", strings.Join(errors, "\n"))
+	}
+	t.lineOffset = line - 1
+	t.beginBatch(batch)
+	defer t.endBatch()
+	t.addGeneratedColumns(generatedColumnsIn(program))
+	t.addSequenceDefaults(sequenceDefaultsIn(program))
+	t.addTableTypes(tableTypesIn(program))
+	t.addKeyColumns(keyColumnsIn(program))
+	t.addGlobalTempTables(program)
+
+	for _, stmt := range program.Statements {
+		code, err := t.transpileStatement(stmt)
+		if err != nil {
+			return err
+		}
+		t.locate(stmt)
+		if code == "" {
+			continue
+		}
+		t.addPackageImports(code)
+		if problems := checkPlaceholders("package p\n\n"+code, t.dmlConfig.SQLDialect); len(problems) > 0 {
+			return fmt.Errorf("placeholder and argument mismatches:\n%s", strings.Join(problems, "\n"))
+		}
+		if err := write(code); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// beginBatch reads what t needs from the source of a batch.
+func (t *transpiler) beginBatch(source string) {
+	t.comments = buildCommentIndex(source)
+	t.recompiledProcs = recompiledProcedures(source)
+	t.dialectVariants = collectDialectVariants(source)
+}
+
+// endBatch drops what t holds of a batch, so its AST and source can be
+// freed before the next is read.
+func (t *transpiler) endBatch() {
+	t.comments = nil
+	t.recompiledProcs = nil
+	t.dialectVariants = nil
+	t.variantStatement = nil
+	t.hintedStatement = nil
+	t.identityInserts = nil
+	t.currentContract = nil
+	t.output.Reset()
+}
+
+// batchReader reads a source one GO-separated batch at a time.
+type batchReader struct {
+	scanner *bufio.Scanner
+	line    int // Lines read so far
+}
+
+func newBatchReader(r io.Reader) *batchReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxStreamLine)
+	return &batchReader{scanner: scanner}
+}
+
+// next returns the next batch that isn't blank and the line it starts on,
+// or io.EOF after the last.
+func (b *batchReader) next() (string, int, error) {
+	var batch strings.Builder
+	start := b.line + 1
+	for b.scanner.Scan() {
+		b.line++
+		text := b.scanner.Text()
+		if !goStatementPattern.MatchString(text) {
+			batch.WriteString(text)
+			batch.WriteByte('\n')
+			continue
+		}
+		if strings.TrimSpace(batch.String()) != "" {
+			return batch.String(), start, nil
+		}
+		batch.Reset()
+		start = b.line + 1
+	}
+	if err := b.scanner.Err(); err != nil {
+		return "", 0, err
+	}
+	if strings.TrimSpace(batch.String()) == "" {
+		return "", 0, io.EOF
+	}
+	return batch.String(), start, nil
+}
@@ -0,0 +1,123 @@
+package transpiler
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+const streamSource = `
+CREATE TYPE dbo.IdList AS TABLE (Id INT NOT NULL)
+GO
+-- Orders of a customer
+CREATE PROCEDURE dbo.GetOrders @CustomerId INT
+AS
+BEGIN
+    SELECT Id, Total FROM Orders WHERE CustomerId = @CustomerId
+END
+GO
+
+GO
+CREATE PROCEDURE dbo.CancelOrders @Ids dbo.IdList READONLY
+AS
+BEGIN
+    UPDATE Orders SET Status = 'cancelled' WHERE Id IN (SELECT Id FROM @Ids)
+END
+`
+
+func TestTranspileStream_MatchesTranspileWithDMLEx(t *testing.T) {
+	config := DefaultDMLConfig()
+	want, err := TranspileWithDMLEx(streamSource, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDMLEx failed: %v", err)
+	}
+	var out strings.Builder
+	result, err := TranspileStream(strings.NewReader(streamSource), &out, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileStream failed: %v", err)
+	}
+	// The same lines; the order of the unused-variable assignments varies
+	sorted := func(code string) string {
+		lines := strings.Split(code, "\n")
+		sort.Strings(lines)
+		return strings.Join(lines, "\n")
+	}
+	if sorted(out.String()) != sorted(want.Code) {
+		t.Errorf("streamed code differs.\nGot:\n%s\nWant:\n%s", out.String(), want.Code)
+	}
+	if result.Code != "" {
+		t.Errorf("Code = %q, want none", result.Code)
+	}
+	if strings.Join(result.TableTypes, ",") != "idlist" {
+		t.Errorf("TableTypes = %v, want [idlist]", result.TableTypes)
+	}
+}
+
+func TestStreamer_Reuse(t *testing.T) {
+	s := NewStreamer("main", DefaultDMLConfig())
+	var first, second strings.Builder
+	if _, err := s.Transpile(strings.NewReader(streamSource), &first); err != nil {
+		t.Fatalf("first Transpile failed: %v", err)
+	}
+	source := `
+CREATE PROCEDURE dbo.ArchiveOrders @Ids dbo.IdList READONLY
+AS
+BEGIN
+    DELETE FROM Orders WHERE Id IN (SELECT Id FROM @Ids)
+END
+`
+	if _, err := s.Transpile(strings.NewReader(source), &second); err == nil {
+		t.Fatal("expected an error for a table type the second source doesn't create")
+	}
+
+	// A source of its own starts afresh: no functions or imports carried over
+	var third strings.Builder
+	if _, err := s.Transpile(strings.NewReader(pipelineSource), &third); err != nil {
+		t.Fatalf("third Transpile failed: %v", err)
+	}
+	if strings.Contains(third.String(), "GetOrders") {
+		t.Errorf("functions of the first source carried over:\n%s", third.String())
+	}
+	if !strings.Contains(third.String(), "func (r *Repository) PurgeAudit(") {
+		t.Errorf("expected PurgeAudit:\n%s", third.String())
+	}
+}
+
+func TestTranspileStream_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		config func(*DMLConfig)
+		want   string
+	}{
+		{
+			name:   "line numbers of the file",
+			source: "CREATE PROCEDURE dbo.A AS BEGIN SELECT 1 END\nGO\n\nCREATE PROCEDURE dbo.B AS BEGIN SELECT FROM END\n",
+			want:   "line 4",
+		},
+		{
+			name:   "no procedures",
+			source: "CREATE TABLE T (Id INT)\nGO\n",
+			want:   "no stored procedures found",
+		},
+		{
+			name:   "scripts",
+			source: "SELECT 1\n",
+			config: func(c *DMLConfig) { c.ScriptName = "Nightly" },
+			want:   "scripts can't be streamed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultDMLConfig()
+			if tt.config != nil {
+				tt.config(&config)
+			}
+			var out strings.Builder
+			_, err := TranspileStream(strings.NewReader(tt.source), &out, "main", config)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,413 @@
+package transpiler
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// String functions
+//
+// In Go expressions the T-SQL string functions with a direct equivalent
+// become strings calls inline (REPLACE, UPPER). The others go through the
+// tsqlruntime/strfn package, which counts characters from 1 and clamps
+// positions as T-SQL does, so LEFT(@s, 10) of a shorter string doesn't
+// panic and CHARINDEX counts characters rather than bytes. Kept inside queries, they are rewritten
+// for the SQL dialect by normalizeStringSQL, and STRING_SPLIT in a FROM
+// clause becomes the dialect's way of turning a list into rows. LIKE in Go
+// code becomes a strings call or strfn.Like.
+
+const strfnImport = "github.com/ha1tch/tgpiler/tsqlruntime/strfn"
+
+// transpileStringFunction converts the string functions strfn backs. It
+// returns false for argument counts T-SQL doesn't accept.
+func (t *transpiler) transpileStringFunction(name string, fc *ast.FunctionCall, args []string) (string, bool, error) {
+	intArg := func(i int) string {
+		return t.intArg(fc.Arguments[i], args[i])
+	}
+	call := func(fn string, list ...string) (string, bool, error) {
+		t.imports[strfnImport] = true
+		return fmt.Sprintf("strfn.%s(%s)", fn, strings.Join(list, ", ")), true, nil
+	}
+	switch {
+	case name == "LEFT" && len(args) == 2:
+		return call("Left", args[0], intArg(1))
+	case name == "RIGHT" && len(args) == 2:
+		return call("Right", args[0], intArg(1))
+	case name == "SUBSTRING" && len(args) == 3:
+		return call("Substring", args[0], intArg(1), intArg(2))
+	case name == "STUFF" && len(args) == 4:
+		if code, ok := t.transpileXMLConcat(fc); ok {
+			return code, true, nil
+		}
+		return call("Stuff", args[0], intArg(1), intArg(2), args[3])
+	case name == "CHARINDEX" && len(args) == 2:
+		return call("CharIndex", args...)
+	case name == "CHARINDEX" && len(args) == 3:
+		return call("CharIndex", args[0], args[1], intArg(2))
+	case name == "PATINDEX" && len(args) == 2:
+		return call("PatIndex", args...)
+	case name == "REPLICATE" && len(args) == 2:
+		// A literal count can't be negative, which strings.Repeat panics on
+		if isIntegerLiteral(fc.Arguments[1]) {
+			t.imports["strings"] = true
+			return fmt.Sprintf("strings.Repeat(%s, %s)", args[0], args[1]), true, nil
+		}
+		return call("Replicate", args[0], intArg(1))
+	case name == "SPACE" && len(args) == 1:
+		return call("Space", intArg(0))
+	case name == "REVERSE" && len(args) == 1:
+		return call("Reverse", args...)
+	case name == "TRANSLATE" && len(args) == 3:
+		return call("Translate", args...)
+	case name == "QUOTENAME" && (len(args) == 1 || len(args) == 2):
+		return call("QuoteName", args...)
+	case name == "FORMATMESSAGE" && len(args) >= 1:
+		if isIntegerLiteral(fc.Arguments[0]) {
+			return "", false, fmt.Errorf("FORMATMESSAGE(%s, ...) reads sys.messages, which has no Go equivalent; pass the message text instead",
+				fc.Arguments[0].String())
+		}
+		return call("FormatMessage", args...)
+	}
+	return "", false, nil
+}
+
+// sqlStringFuncs are the string functions normalizeStringSQL rewrites.
+var sqlStringFuncs = map[string]bool{
+	"CHARINDEX": true, "PATINDEX": true, "STUFF": true, "REPLICATE": true, "SPACE": true, "REVERSE": true,
+	"TRANSLATE": true, "QUOTENAME": true, "FORMATMESSAGE": true, "LEFT": true, "RIGHT": true, "LEN": true,
+}
+
+// normalizeStringSQL rewrites the string functions in a query for the SQL
+// dialect. Calls it can't translate are kept with a warning.
+func (dt *dmlTranspiler) normalizeStringSQL(query string) string {
+	var dialect func(name string, args []string) (string, bool)
+	switch dt.config.SQLDialect {
+	case "postgres":
+		dialect = postgresStringSQL
+	case "mysql":
+		dialect = mysqlStringSQL
+	case "sqlite":
+		dialect = sqliteStringSQL
+	default:
+		return query
+	}
+	query = dt.rewriteStringSplit(query)
+	return rewriteSQLCalls(query, sqlStringFuncs, func(name string, args []string) (string, bool) {
+		if out, ok := dialect(name, args); ok {
+			return out, true
+		}
+		switch name {
+		case "LEFT", "RIGHT", "LEN":
+			// Native, or translated elsewhere
+			return "", false
+		}
+		dt.warn(RuleUntranslated, fmt.Sprintf("%s: %s(%s) has no %s translation; it is kept as it is",
+			dt.currentProcName, name, strings.Join(args, ", "), dt.config.SQLDialect))
+		return "", false
+	})
+}
+
+func postgresStringSQL(name string, args []string) (string, bool) {
+	switch {
+	case name == "CHARINDEX" && len(args) == 2:
+		return fmt.Sprintf("STRPOS(%s, %s)", args[1], args[0]), true
+	case name == "CHARINDEX" && len(args) == 3:
+		tail := fmt.Sprintf("STRPOS(SUBSTRING(%s FROM %s), %s)", args[1], args[2], args[0])
+		return fmt.Sprintf("(CASE WHEN %s = 0 THEN 0 ELSE %s + %s - 1 END)", tail, tail, sqlOperand(args[2])), true
+	case name == "STUFF" && len(args) == 4:
+		return fmt.Sprintf("OVERLAY(%s PLACING %s FROM %s FOR %s)", args[0], args[3], args[1], args[2]), true
+	case name == "REPLICATE" && len(args) == 2:
+		return fmt.Sprintf("REPEAT(%s, %s)", args[0], args[1]), true
+	case name == "SPACE" && len(args) == 1:
+		return fmt.Sprintf("REPEAT(' ', %s)", args[0]), true
+	case name == "REVERSE" && len(args) == 1, name == "TRANSLATE" && len(args) == 3:
+		return "", false
+	case name == "QUOTENAME":
+		return quoteNameSQL(args, func(parts ...string) string { return strings.Join(parts, " || ") })
+	case name == "FORMATMESSAGE" && len(args) >= 1:
+		// format() only has %s, which takes numbers too
+		format, ok := sqlUnquote(args[0])
+		if !ok || strings.ContainsAny(strings.NewReplacer("%s", "", "%d", "", "%i", "", "%%", "").Replace(format), "%") {
+			return "", false
+		}
+		format = strings.NewReplacer("%d", "%s", "%i", "%s").Replace(format)
+		return fmt.Sprintf("format(%s)", strings.Join(append([]string{sqlQuote(format)}, args[1:]...), ", ")), true
+	}
+	return "", false
+}
+
+func mysqlStringSQL(name string, args []string) (string, bool) {
+	switch {
+	case name == "CHARINDEX" && (len(args) == 2 || len(args) == 3):
+		return fmt.Sprintf("LOCATE(%s)", strings.Join(args, ", ")), true
+	case name == "STUFF" && len(args) == 4:
+		return fmt.Sprintf("INSERT(%s, %s, %s, %s)", args[0], args[1], args[2], args[3]), true
+	case name == "REPLICATE" && len(args) == 2:
+		return fmt.Sprintf("REPEAT(%s, %s)", args[0], args[1]), true
+	case name == "LEN" && len(args) == 1:
+		// LEN ignores trailing spaces
+		return fmt.Sprintf("CHAR_LENGTH(RTRIM(%s))", args[0]), true
+	case name == "QUOTENAME":
+		return quoteNameSQL(args, func(parts ...string) string { return "CONCAT(" + strings.Join(parts, ", ") + ")" })
+	}
+	return "", false
+}
+
+func sqliteStringSQL(name string, args []string) (string, bool) {
+	// SQLite has no REPEAT; hex(zeroblob(n)) is n "00"s to replace
+	repeat := func(s, n string) string {
+		return fmt.Sprintf("replace(hex(zeroblob(%s)), '00', %s)", n, s)
+	}
+	switch {
+	case name == "CHARINDEX" && len(args) == 2:
+		return fmt.Sprintf("instr(%s, %s)", args[1], args[0]), true
+	case name == "CHARINDEX" && len(args) == 3:
+		tail := fmt.Sprintf("instr(substr(%s, %s), %s)", args[1], args[2], args[0])
+		return fmt.Sprintf("(CASE WHEN %s = 0 THEN 0 ELSE %s + %s - 1 END)", tail, tail, sqlOperand(args[2])), true
+	case name == "STUFF" && len(args) == 4:
+		return fmt.Sprintf("(substr(%s, 1, %s - 1) || %s || substr(%s, %s + %s))",
+			args[0], sqlOperand(args[1]), args[3], args[0], sqlOperand(args[1]), sqlOperand(args[2])), true
+	case name == "REPLICATE" && len(args) == 2:
+		return repeat(args[0], args[1]), true
+	case name == "SPACE" && len(args) == 1:
+		return repeat("' '", args[0]), true
+	case name == "LEFT" && len(args) == 2:
+		return fmt.Sprintf("substr(%s, 1, %s)", args[0], args[1]), true
+	case name == "RIGHT" && len(args) == 2:
+		return fmt.Sprintf("substr(%s, -%s)", args[0], sqlOperand(args[1])), true
+	case name == "LEN" && len(args) == 1:
+		return fmt.Sprintf("length(rtrim(%s))", args[0]), true
+	case name == "QUOTENAME":
+		return quoteNameSQL(args, func(parts ...string) string { return strings.Join(parts, " || ") })
+	case name == "FORMATMESSAGE" && len(args) >= 1:
+		format, ok := sqlUnquote(args[0])
+		if !ok {
+			return "", false
+		}
+		format = strings.NewReplacer("%i", "%d", "%u", "%d").Replace(format)
+		return fmt.Sprintf("printf(%s)", strings.Join(append([]string{sqlQuote(format)}, args[1:]...), ", ")), true
+	}
+	return "", false
+}
+
+// quoteNameSQL converts QUOTENAME with brackets or a literal quote
+// character, joining the parts with concat.
+func quoteNameSQL(args []string, concat func(parts ...string) string) (string, bool) {
+	open, close := "[", "]"
+	if len(args) == 2 {
+		q, ok := sqlUnquote(args[1])
+		pairs := map[string][2]string{
+			"[": {"[", "]"}, "]": {"[", "]"}, "'": {"'", "'"}, `"`: {`"`, `"`},
+			"(": {"(", ")"}, ")": {"(", ")"}, "<": {"<", ">"}, ">": {"<", ">"},
+			"{": {"{", "}"}, "}": {"{", "}"}, "`": {"`", "`"},
+		}
+		pair, known := pairs[q]
+		if !ok || !known {
+			return "", false
+		}
+		open, close = pair[0], pair[1]
+	} else if len(args) != 1 {
+		return "", false
+	}
+	escaped := fmt.Sprintf("REPLACE(%s, %s, %s)", args[0], sqlQuote(close), sqlQuote(close+close))
+	return concat(sqlQuote(open), escaped, sqlQuote(close)), true
+}
+
+// stringSplitCall finds STRING_SPLIT calls.
+var stringSplitCall = regexp.MustCompile(`(?i)\bSTRING_SPLIT\s*\(`)
+
+// tableAlias matches the alias after a table source.
+var tableAlias = regexp.MustCompile(`(?i)^\s+(?:AS\s+)?([A-Za-z_][A-Za-z0-9_]*)`)
+
+// rewriteStringSplit turns STRING_SPLIT(list, separator [, enable_ordinal])
+// table sources into the dialect's equivalent, with the value column, and
+// ordinal when enabled:
+//
+//	postgres  unnest(string_to_array(list, sep)) AS s(value)
+//	mysql     JSON_TABLE(<list as a JSON array>, '$[*]' COLUMNS (value TEXT PATH '$')) AS s
+//	sqlite    json_each(<list as a JSON array>) AS s
+func (dt *dmlTranspiler) rewriteStringSplit(query string) string {
+	var b strings.Builder
+	for {
+		loc := stringSplitCall.FindStringIndex(query)
+		if loc == nil {
+			break
+		}
+		end := sqlParenEnd(query, loc[1]-1)
+		if end < 0 {
+			break
+		}
+		args := splitSQLArgs(query[loc[1]:end])
+		rest := query[end+1:]
+		alias := "string_split"
+		if m := tableAlias.FindStringSubmatch(rest); m != nil && !isClauseKeyword(m[1]) {
+			alias = m[1]
+			rest = rest[len(m[0]):]
+		}
+		b.WriteString(query[:loc[0]])
+		if out, ok := stringSplitSQL(dt.config.SQLDialect, args, alias); ok {
+			b.WriteString(out)
+		} else {
+			dt.warn(RuleUntranslated, fmt.Sprintf("%s: STRING_SPLIT(%s) has no %s translation; it is kept as it is",
+				dt.currentProcName, strings.Join(args, ", "), dt.config.SQLDialect))
+			b.WriteString(query[loc[0] : end+1])
+			b.WriteString(" AS " + alias)
+		}
+		query = rest
+	}
+	b.WriteString(query)
+	return b.String()
+}
+
+func stringSplitSQL(dialect string, args []string, alias string) (string, bool) {
+	if len(args) != 2 && len(args) != 3 {
+		return "", false
+	}
+	ordinal := len(args) == 3 && args[2] != "0" && args[2] != "NULL"
+	// A JSON array of the values, escaping backslashes and quotes
+	jsonArray := func(concat func(parts ...string) string, bs string) string {
+		escaped := fmt.Sprintf("REPLACE(REPLACE(%s, '%s', '%s%s'), '\"', '%s\"')", args[0], bs, bs, bs, bs)
+		return concat(`'["'`, fmt.Sprintf("REPLACE(%s, %s, '\",\"')", escaped, args[1]), `'"]'`)
+	}
+	switch dialect {
+	case "postgres":
+		if ordinal {
+			return fmt.Sprintf("unnest(string_to_array(%s, %s)) WITH ORDINALITY AS %s(value, ordinal)", args[0], args[1], alias), true
+		}
+		return fmt.Sprintf("unnest(string_to_array(%s, %s)) AS %s(value)", args[0], args[1], alias), true
+	case "mysql":
+		columns := "value TEXT PATH '$'"
+		if ordinal {
+			columns += ", ordinal FOR ORDINALITY"
+		}
+		list := jsonArray(func(parts ...string) string { return "CONCAT(" + strings.Join(parts, ", ") + ")" }, `\\`)
+		return fmt.Sprintf("JSON_TABLE(%s, '$[*]' COLUMNS (%s)) AS %s", list, columns, alias), true
+	case "sqlite":
+		list := jsonArray(func(parts ...string) string { return strings.Join(parts, " || ") }, `\`)
+		if ordinal {
+			return fmt.Sprintf("(SELECT value, key + 1 AS ordinal FROM json_each(%s)) AS %s", list, alias), true
+		}
+		return fmt.Sprintf("json_each(%s) AS %s", list, alias), true
+	}
+	return "", false
+}
+
+// isClauseKeyword reports whether word starts the clause after a table
+// source rather than naming its alias.
+func isClauseKeyword(word string) bool {
+	switch strings.ToUpper(word) {
+	case "WHERE", "JOIN", "INNER", "LEFT", "RIGHT", "FULL", "CROSS", "OUTER", "ON", "GROUP", "ORDER",
+		"HAVING", "UNION", "EXCEPT", "INTERSECT", "WITH", "OPTION", "FOR", "AS":
+		return true
+	}
+	return false
+}
+
+// transpileLikeExpression converts LIKE in Go code. A literal pattern that
+// only has % at its ends becomes a strings call, 'ABC%' a HasPrefix; any
+// other pattern, with _, [ranges] or ESCAPE, is matched by strfn.Like. As
+// with SQL Server's default collation, patterns with letters match
+// regardless of case.
+func (t *transpiler) transpileLikeExpression(e *ast.LikeExpression) (string, error) {
+	s, err := t.transpileExpression(e.Expr)
+	if err != nil {
+		return "", err
+	}
+	if !t.inferType(e.Expr).isString {
+		t.imports["fmt"] = true
+		s = fmt.Sprintf("fmt.Sprint(%s)", s)
+	}
+	not := ""
+	if e.Not {
+		not = "!"
+	}
+
+	var escape string
+	escapeLiteral := e.Escape == nil
+	if lit, ok := e.Escape.(*ast.StringLiteral); ok {
+		escape, escapeLiteral = lit.Value, true
+	}
+	if lit, ok := e.Pattern.(*ast.StringLiteral); ok && escapeLiteral {
+		if code, ok := t.likeStringsCall(s, lit.Value, escape, e.Not); ok {
+			return code, nil
+		}
+	}
+
+	pattern, err := t.transpileExpression(e.Pattern)
+	if err != nil {
+		return "", err
+	}
+	t.imports[strfnImport] = true
+	if e.Escape == nil {
+		return fmt.Sprintf("%sstrfn.Like(%s, %s)", not, s, pattern), nil
+	}
+	esc, err := t.transpileExpression(e.Escape)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%sstrfn.LikeEscape(%s, %s, %s)", not, s, pattern, esc), nil
+}
+
+// likeStringsCall returns the strings call matching s against a literal
+// pattern, or false if the pattern needs strfn.Like.
+func (t *transpiler) likeStringsCall(s, pattern, escape string, not bool) (string, bool) {
+	var esc rune
+	if escape != "" {
+		esc = []rune(escape)[0]
+	}
+	var text strings.Builder
+	p := []rune(pattern)
+	leading, trailing := false, false
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		switch {
+		case c == '%' && text.Len() == 0:
+			leading = true
+			continue
+		case c == '%':
+			trailing = true
+			continue
+		case trailing || c == '_' || c == '[':
+			return "", false // % inside the pattern, or a wildcard
+		case c == esc && i+1 < len(p):
+			i++
+			c = p[i]
+		}
+		text.WriteRune(c)
+	}
+	literal := text.String()
+	if literal == "" && (leading || trailing) {
+		return fmt.Sprint(!not), true // '%' matches any string
+	}
+
+	neg := ""
+	if not {
+		neg = "!"
+	}
+	if leading || trailing {
+		t.imports["strings"] = true
+	}
+	if strings.ToLower(literal) != strings.ToUpper(literal) {
+		if !leading && !trailing {
+			t.imports["strings"] = true
+			return fmt.Sprintf("%sstrings.EqualFold(%s, %q)", neg, s, literal), true
+		}
+		s = fmt.Sprintf("strings.ToLower(%s)", s)
+		literal = strings.ToLower(literal)
+	}
+	switch {
+	case leading && trailing:
+		return fmt.Sprintf("%sstrings.Contains(%s, %q)", neg, s, literal), true
+	case leading:
+		return fmt.Sprintf("%sstrings.HasSuffix(%s, %q)", neg, s, literal), true
+	case trailing:
+		return fmt.Sprintf("%sstrings.HasPrefix(%s, %q)", neg, s, literal), true
+	}
+	if not {
+		return fmt.Sprintf("%s != %q", s, literal), true
+	}
+	return fmt.Sprintf("%s == %q", s, literal), true
+}
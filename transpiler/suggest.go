@@ -0,0 +1,71 @@
+package transpiler
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Suggested fixes
+//
+// Some diagnostics have a fix that is just a flag setting: a table the gRPC
+// backend couldn't route, temp tables left on the default fallback backend,
+// a low-confidence proto mapping. Those come with a Suggestion that can be
+// passed on the command line as it is, or merged into tgpiler.yaml
+// (tgpiler --apply-suggestions).
+
+// Suggestion is a flag setting that fixes a diagnostic. Mapping flags
+// (Table:Service,...) set one entry, Key, leaving the others alone.
+type Suggestion struct {
+	Flag  string `json:"flag"`          // Flag name, without dashes
+	Key   string `json:"key,omitempty"` // Entry of a mapping flag
+	Value string `json:"value"`
+}
+
+// Setting returns the flag's value as the suggestion writes it, e.g.
+// Orders:OrderService.
+func (s Suggestion) Setting() string {
+	if s.Key != "" {
+		return s.Key + ":" + s.Value
+	}
+	return s.Value
+}
+
+// String returns the suggestion as a command-line flag, e.g.
+// --table-service=Orders:OrderService.
+func (s Suggestion) String() string {
+	return fmt.Sprintf("--%s=%s", s.Flag, s.Setting())
+}
+
+// Diagnostic is a problem with a suggested fix.
+type Diagnostic struct {
+	Procedure  string     `json:"procedure,omitempty"`
+	Message    string     `json:"message"`
+	Suggestion Suggestion `json:"suggestion"`
+}
+
+func (d Diagnostic) String() string {
+	if d.Procedure == "" {
+		return fmt.Sprintf("%s (fix: %s)", d.Message, d.Suggestion)
+	}
+	return fmt.Sprintf("%s: %s (fix: %s)", d.Procedure, d.Message, d.Suggestion)
+}
+
+// suggestTableService records that table has no --table-service entry,
+// suggesting the service its name implies (Orders -> OrderService). Each
+// table is reported once.
+func (dt *dmlTranspiler) suggestTableService(table string) {
+	key := strings.ToLower(table)
+	if strings.HasPrefix(table, "#") || dt.unroutedTables[key] {
+		return
+	}
+	if dt.unroutedTables == nil {
+		dt.unroutedTables = make(map[string]bool)
+	}
+	dt.unroutedTables[key] = true
+	service := singularize(unqualifiedName(table)) + "Service"
+	dt.diagnostics = append(dt.diagnostics, Diagnostic{
+		Procedure:  dt.currentProcName,
+		Message:    fmt.Sprintf("table %s has no --table-service entry; its calls go through %s", table, dt.defaultGRPCClient()),
+		Suggestion: Suggestion{Flag: "table-service", Key: unqualifiedName(table), Value: service},
+	})
+}
@@ -1,6 +1,8 @@
 package transpiler
 
 import (
+	"sort"
+
 	"github.com/ha1tch/tsqlparser/ast"
 )
 
@@ -12,6 +14,9 @@ type typeInfo struct {
 	isString   bool
 	isDateTime bool
 	isBool     bool
+	nullable   bool // Held in a nullable Go type (see null.go); goType is the value type
+	timeType   string // T-SQL type of date/time values, e.g. DATETIMEOFFSET (see timezone.go)
+	clrType    string // GEOMETRY, GEOGRAPHY or HIERARCHYID, for their methods (see spatial.go)
 }
 
 // symbolTable tracks variable declarations and their types.
@@ -102,7 +107,8 @@ func (st *symbolTable) isUsed(name string) bool {
 	return false
 }
 
-// getUnusedVars returns variables that were declared but never read
+// getUnusedVars returns variables that were declared but never read, sorted
+// so the generated code is the same from run to run
 func (st *symbolTable) getUnusedVars() []string {
 	var unused []string
 	for name := range st.declaredVars {
@@ -110,16 +116,26 @@ func (st *symbolTable) getUnusedVars() []string {
 			unused = append(unused, name)
 		}
 	}
+	sort.Strings(unused)
 	return unused
 }
 
 // typeInfoFromDataType creates typeInfo from a T-SQL DataType.
-func typeInfoFromDataType(dt *ast.DataType) *typeInfo {
+func (t *transpiler) typeInfoFromDataType(dt *ast.DataType) *typeInfo {
 	if dt == nil {
 		return &typeInfo{goType: "any"}
 	}
 
 	goType, isDecimal, isNumeric, isString, isDateTime, isBool := classifyDataType(dt)
+	if isDecimal {
+		return t.decimalInfo()
+	}
+	if isDateTime {
+		return timeTypeInfo(normaliseTypeName(dt.Name))
+	}
+	if name := normaliseTypeName(dt.Name); isCLRType(name) {
+		return &typeInfo{goType: "string", isString: true, clrType: name}
+	}
 	return &typeInfo{
 		goType:     goType,
 		isDecimal:  isDecimal,
@@ -153,7 +169,7 @@ func classifyDataType(dt *ast.DataType) (goType string, isDecimal, isNumeric, is
 		return "bool", false, false, false, false, true
 	case "BINARY", "VARBINARY", "IMAGE":
 		return "[]byte", false, false, false, false, false
-	case "UNIQUEIDENTIFIER", "XML":
+	case "UNIQUEIDENTIFIER", "XML", "GEOMETRY", "GEOGRAPHY", "HIERARCHYID":
 		return "string", false, false, true, false, false
 	default:
 		return "any", false, false, false, false, false
@@ -0,0 +1,155 @@
+package transpiler
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// Timeouts and cancellation
+//
+// With DMLConfig.Timeout set, generated procedures bound their work with a
+// deadline, either for the whole call:
+//
+//	ctx, cancelTimeout := context.WithTimeout(ctx, 30*time.Second)
+//	defer cancelTimeout()
+//
+// or for each statement that reaches the database, through a
+// tsqlruntime.StatementTimeout:
+//
+//	stmtCtx = stmtTimeout.Next()
+//	result, err := r.db.ExecContext(stmtCtx, ...)
+//
+// Either way, WHILE and cursor loops check ctx.Err() at the top of every
+// iteration, so a cancelled batch stops between rows rather than running
+// to the end.
+
+// Timeout scopes
+const (
+	TimeoutProcedure = "procedure" // One deadline for the whole call (default)
+	TimeoutStatement = "statement" // A deadline per database statement
+)
+
+// ctxArgRe matches ctx passed as the first argument of a call.
+var ctxArgRe = regexp.MustCompile(`\(ctx([,)])`)
+
+// goDuration returns d as a Go expression, e.g. 30*time.Second.
+func goDuration(d time.Duration) string {
+	for _, unit := range []struct {
+		d    time.Duration
+		name string
+	}{
+		{time.Hour, "time.Hour"},
+		{time.Minute, "time.Minute"},
+		{time.Second, "time.Second"},
+		{time.Millisecond, "time.Millisecond"},
+	} {
+		if d%unit.d == 0 {
+			return fmt.Sprintf("%d*%s", d/unit.d, unit.name)
+		}
+	}
+	return fmt.Sprintf("time.Duration(%d)", d)
+}
+
+// procTimeoutPrologue returns the statements that start a procedure with
+// a procedure-wide deadline, or "".
+func (t *transpiler) procTimeoutPrologue() string {
+	if !t.dmlEnabled || t.dmlConfig.Timeout <= 0 || t.dmlConfig.TimeoutScope == TimeoutStatement {
+		return ""
+	}
+	t.imports["context"] = true
+	t.imports["time"] = true
+	ind := t.indentStr()
+	return fmt.Sprintf("%sctx, cancelTimeout := context.WithTimeout(ctx, %s)\n%sdefer cancelTimeout()\n",
+		ind, goDuration(t.dmlConfig.Timeout), ind)
+}
+
+// stmtTimeoutPrologue returns the declarations statement timeouts need,
+// added at the start of a procedure that has any.
+func (t *transpiler) stmtTimeoutPrologue() string {
+	t.imports["context"] = true
+	t.imports["time"] = true
+	t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+	ind := t.indentStr()
+	return fmt.Sprintf("%sstmtTimeout := tsqlruntime.NewStatementTimeout(ctx, %s)\n%sdefer stmtTimeout.Stop()\n%svar stmtCtx context.Context\n",
+		ind, goDuration(t.dmlConfig.Timeout), ind, ind)
+}
+
+// timesStatement reports whether stmt gets its own deadline. Transaction
+// control and cursors are left on the procedure's context, since they
+// outlive the statement that starts them.
+func (t *transpiler) timesStatement(stmt ast.Statement) bool {
+	if !t.dmlEnabled || !t.inProcBody || t.inStatementTimeout ||
+		t.dmlConfig.Timeout <= 0 || t.dmlConfig.TimeoutScope != TimeoutStatement {
+		return false
+	}
+	switch stmt.(type) {
+	case *ast.SelectStatement, *ast.InsertStatement, *ast.UpdateStatement, *ast.DeleteStatement,
+		*ast.ExecStatement, *ast.TruncateTableStatement, *ast.BulkInsertStatement, *ast.WithStatement:
+		return true
+	}
+	return false
+}
+
+// transpileTimedStatement transpiles stmt with its own deadline. Statements
+// that turn out not to reach the database are left as they are.
+func (t *transpiler) transpileTimedStatement(stmt ast.Statement) (string, error) {
+	t.inStatementTimeout = true
+	code, err := t.transpileStatement(stmt)
+	t.inStatementTimeout = false
+	if err != nil || !ctxArgRe.MatchString(code) {
+		return code, err
+	}
+	t.usesStmtTimeout = true
+	code = ctxArgRe.ReplaceAllString(code, "(stmtCtx$1")
+
+	// Start the deadline after the statement's leading comments. Only lines
+	// after the first carry their indentation.
+	lines := strings.Split(code, "\n")
+	next := "stmtCtx = stmtTimeout.Next()"
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "//") {
+			continue
+		}
+		if i == 0 {
+			lines[0] = next + "\n" + t.indentStr() + line
+		} else {
+			lines = append(lines[:i], append([]string{t.indentStr() + next}, lines[i:]...)...)
+		}
+		break
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// cancelCheck returns a check of ctx.Err() for the top of a loop body, or
+// "" when the procedure has no deadline or can't return an error.
+// Activities (see activity.go) heartbeat instead.
+func (t *transpiler) cancelCheck() string {
+	if t.activity && t.inProcBody {
+		t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+		return t.ctxCheck("tsqlruntime.Heartbeat(ctx)", true)
+	}
+	if !t.dmlEnabled || t.dmlConfig.Timeout <= 0 || !t.inProcBody || (!t.hasDMLStatements && !t.inTryBlock && t.catchLabel == "") {
+		return ""
+	}
+	return t.ctxCheck("ctx.Err()", true)
+}
+
+// ctxCheck returns an indented statement that leaves the procedure with
+// the error of check, if any. CATCH blocks can't return, so in one a loop
+// check leaves the loop instead.
+func (t *transpiler) ctxCheck(check string, loop bool) string {
+	ind := t.indentStr()
+	exit := t.buildErrorReturn()
+	if t.inCatchBlock && loop && !t.tryCatchErrors() {
+		exit = "break"
+	}
+	var out strings.Builder
+	out.WriteString(ind + "if err := " + check + "; err != nil {\n")
+	out.WriteString(ind + "\t" + exit + "\n")
+	out.WriteString(ind + "}\n")
+	return out.String()
+}
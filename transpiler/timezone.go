@@ -0,0 +1,149 @@
+package transpiler
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/ha1tch/tgpiler/tsqlruntime"
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// Time modes
+//
+// SQL Server's GETDATE(), SYSDATETIME() and CURRENT_TIMESTAMP read the
+// server's clock in its own time zone. DMLConfig.TimeMode says which clock
+// that was: TimeLocal, the Go program's local time (the default), or
+// TimeUTC, for servers running in UTC such as Azure SQL Database. The
+// mode applies both to Go code and to the same functions in queries.
+// GETUTCDATE() and SYSUTCDATETIME() are UTC either way.
+//
+// All date and time types are time.Time. DATETIMEOFFSET values carry their
+// offset in the time.Time's location; SMALLDATETIME values are rounded to
+// the minute when assigned, as SQL Server stores them. AT TIME ZONE
+// becomes tsqlruntime.AtTimeZone for DATETIMEOFFSET values, which converts
+// the instant, or tsqlruntime.InTimeZone for values without an offset,
+// which keeps the wall clock time; in queries it is rewritten for the
+// dialect.
+const (
+	TimeUTC   = "utc"
+	TimeLocal = "local"
+)
+
+// timeNow returns the Go expression for a current time function such as
+// GETDATE.
+func (t *transpiler) timeNow(fn string) string {
+	t.imports["time"] = true
+	if fn == "GETUTCDATE" || fn == "SYSUTCDATETIME" || t.dmlConfig.TimeMode == TimeUTC {
+		return "time.Now().UTC()"
+	}
+	return "time.Now()"
+}
+
+// timeTypeInfo returns the typeInfo of values of a T-SQL date/time type.
+func timeTypeInfo(sqlType string) *typeInfo {
+	return &typeInfo{goType: "time.Time", isDateTime: true, timeType: sqlType}
+}
+
+// roundTime rounds expr, assigned to a variable of type ti, as storing it
+// would: SMALLDATETIME values to the minute.
+func (t *transpiler) roundTime(ti *typeInfo, expr string) string {
+	if ti == nil || ti.timeType != "SMALLDATETIME" {
+		return expr
+	}
+	t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+	return fmt.Sprintf("tsqlruntime.SmallDateTime(%s)", stripOuterParens(expr))
+}
+
+// transpileAtTimeZone converts expr AT TIME ZONE zone.
+func (t *transpiler) transpileAtTimeZone(e *ast.AtTimeZoneExpression) (string, error) {
+	expr, err := t.transpileExpression(e.Expr)
+	if err != nil {
+		return "", err
+	}
+	zone, err := t.transpileExpression(e.TimeZone)
+	if err != nil {
+		return "", err
+	}
+	t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+	fn := "InTimeZone"
+	if t.inferType(e.Expr).timeType == "DATETIMEOFFSET" {
+		fn = "AtTimeZone"
+	}
+	return fmt.Sprintf("tsqlruntime.%s(%s, %s)", fn, expr, zone), nil
+}
+
+// transpileOffsetFunc converts SWITCHOFFSET and TODATETIMEOFFSET.
+func (t *transpiler) transpileOffsetFunc(fn string, args []string) (string, error) {
+	if len(args) != 2 {
+		return "", fmt.Errorf("%s requires 2 arguments", fn)
+	}
+	t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+	if fn == "SWITCHOFFSET" {
+		return fmt.Sprintf("tsqlruntime.SwitchOffset(%s, %s)", args[0], args[1]), nil
+	}
+	return fmt.Sprintf("tsqlruntime.ToDateTimeOffset(%s, %s)", args[0], args[1]), nil
+}
+
+var (
+	nowSQLPattern = regexp.MustCompile(`(?i)\b(GETDATE|SYSDATETIME)\(\)|\bCURRENT_TIMESTAMP\b`)
+	utcSQLPattern = regexp.MustCompile(`(?i)\b(GETUTCDATE|SYSUTCDATETIME)\(\)`)
+	atTimeZoneSQL = regexp.MustCompile(`(?i)\s+AT\s+TIME\s+ZONE\s+'([^']*)'`)
+	// A simple operand followed by one or two AT TIME ZONE clauses.
+	atTimeZoneChain = regexp.MustCompile(`(?i)([\w.\[\]?$]+(?:\(\))?)\s+AT\s+TIME\s+ZONE\s+'([^']*)'(?:\s+AT\s+TIME\s+ZONE\s+'([^']*)')?`)
+)
+
+// normalizeTimeSQL rewrites the current time functions and AT TIME ZONE
+// for the SQL dialect.
+func (dt *dmlTranspiler) normalizeTimeSQL(query string) string {
+	utcNow := map[string]string{
+		"postgres":  "(NOW() AT TIME ZONE 'UTC')",
+		"mysql":     "UTC_TIMESTAMP()",
+		"sqlite":    "CURRENT_TIMESTAMP",
+		"sqlserver": "SYSUTCDATETIME()",
+	}[dt.config.SQLDialect]
+	if dt.config.SQLDialect != "sqlserver" && utcNow != "" {
+		query = utcSQLPattern.ReplaceAllString(query, utcNow)
+	}
+	if dt.config.TimeMode == TimeUTC {
+		if utcNow != "" {
+			query = nowSQLPattern.ReplaceAllString(query, utcNow)
+		}
+	} else if localNow := map[string]string{
+		"mysql":  "NOW()",
+		"sqlite": "datetime('now', 'localtime')",
+	}[dt.config.SQLDialect]; localNow != "" {
+		query = nowSQLPattern.ReplaceAllString(query, localNow)
+	}
+	if !atTimeZoneSQL.MatchString(query) {
+		return query
+	}
+
+	switch dt.config.SQLDialect {
+	case "sqlserver":
+		return query
+	case "postgres":
+		// Postgres has AT TIME ZONE, with IANA zone names
+		return atTimeZoneSQL.ReplaceAllStringFunc(query, func(m string) string {
+			zone := atTimeZoneSQL.FindStringSubmatch(m)[1]
+			return fmt.Sprintf(" AT TIME ZONE '%s'", tsqlruntime.IANAZone(zone))
+		})
+	case "mysql":
+		// x AT TIME ZONE 'from' AT TIME ZONE 'to' converts between zones.
+		// MySQL has no offset type, so x AT TIME ZONE 'zone' alone, which
+		// attaches an offset, leaves x as it is.
+		query = atTimeZoneChain.ReplaceAllStringFunc(query, func(m string) string {
+			parts := atTimeZoneChain.FindStringSubmatch(m)
+			if parts[3] == "" {
+				return parts[1]
+			}
+			return fmt.Sprintf("CONVERT_TZ(%s, '%s', '%s')", parts[1],
+				tsqlruntime.IANAZone(parts[2]), tsqlruntime.IANAZone(parts[3]))
+		})
+		if !atTimeZoneSQL.MatchString(query) {
+			return query
+		}
+	}
+	dt.warnings = append(dt.warnings, fmt.Sprintf("%s: AT TIME ZONE has no %s equivalent here; convert the value in Go with tsqlruntime.AtTimeZone",
+		dt.currentProcName, dt.config.SQLDialect))
+	return query
+}
@@ -0,0 +1,147 @@
+package transpiler
+
+import (
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+// Transliteration
+//
+// Go accepts any Unicode letter in an identifier, so Dirección is a valid
+// exported name and is what the transpiler emits by default. Some teams
+// prefer ASCII-only APIs (grep, keyboards, gRPC clients in other languages),
+// so --transliterate rewrites Latin letters with diacritics to their base
+// letters: Dirección -> Direccion, AñoFiscal -> AnoFiscal. Ligatures expand
+// (æ -> ae, ß -> ss); letters outside Latin-1 and Latin Extended-A are kept.
+
+// latin1Letters maps U+00C0..U+00FF to ASCII. Entries are space separated;
+// "-" marks the two non-letters in the block (× and ÷).
+var latin1Letters = strings.Fields(`
+	A A A A A A AE C E E E E I I I I
+	D N O O O O O - O U U U U Y TH ss
+	a a a a a a ae c e e e e i i i i
+	d n o o o o o - o u u u u y th y`)
+
+// latinExtendedALetters maps U+0100..U+017F to ASCII.
+var latinExtendedALetters = strings.Fields(`
+	A a A a A a C c C c C c C c D d
+	D d E e E e E e E e E e G g G g
+	G g G g H h H h I i I i I i I i
+	I i IJ ij J j K k k L l L l L l L
+	l L l N n N n N n n N n O o O o
+	O o OE oe R r R r R r S s S s S s
+	S s T t T t T t U u U u U u U u
+	U u U u W w Y y Y Z z Z z Z z s`)
+
+// TransliterateIdentifier replaces Latin letters with diacritics in name by
+// their ASCII base letters. Other characters are returned unchanged.
+func TransliterateIdentifier(name string) string {
+	var out strings.Builder
+	for _, r := range name {
+		if s, ok := transliterateRune(r); ok {
+			out.WriteString(s)
+		} else {
+			out.WriteRune(r)
+		}
+	}
+	return out.String()
+}
+
+func transliterateRune(r rune) (string, bool) {
+	switch {
+	case r >= 0xC0 && r <= 0xFF:
+		if s := latin1Letters[r-0xC0]; s != "-" {
+			return s, true
+		}
+	case r >= 0x100 && r <= 0x17F:
+		return latinExtendedALetters[r-0x100], true
+	}
+	return "", false
+}
+
+// TransliterateGoIdentifiers transliterates every identifier in Go source
+// code. Only identifier tokens are rewritten, so SQL text, struct tags and
+// comments keep the original names. It fails if two distinct identifiers
+// would end up with the same name (año and ano in the same file).
+func TransliterateGoIdentifiers(code string) (string, error) {
+	src := []byte(code)
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(src))
+
+	var s scanner.Scanner
+	s.Init(file, src, nil, 0)
+
+	type ident struct {
+		offset int
+		lit    string
+	}
+	var rewrites []ident
+	names := map[string]bool{}
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok != token.IDENT {
+			continue
+		}
+		names[lit] = true
+		if TransliterateIdentifier(lit) != lit {
+			rewrites = append(rewrites, ident{file.Offset(pos), lit})
+		}
+	}
+	if len(rewrites) == 0 {
+		return code, nil
+	}
+
+	// Check for collisions before rewriting anything
+	sources := map[string]string{}
+	for name := range names {
+		sources[name] = name
+	}
+	seen := map[string]bool{}
+	var collisions []string
+	for _, id := range rewrites {
+		ascii := TransliterateIdentifier(id.lit)
+		if prev, ok := sources[ascii]; ok && prev != id.lit {
+			if pair := fmt.Sprintf("%s and %s", prev, id.lit); !seen[pair] {
+				seen[pair] = true
+				collisions = append(collisions, pair)
+			}
+			continue
+		}
+		sources[ascii] = id.lit
+	}
+	if len(collisions) > 0 {
+		sort.Strings(collisions)
+		return "", fmt.Errorf("transliteration would merge identifiers: %s both become the same name", strings.Join(collisions, "; "))
+	}
+
+	var out strings.Builder
+	last := 0
+	for _, id := range rewrites {
+		out.WriteString(code[last:id.offset])
+		out.WriteString(TransliterateIdentifier(id.lit))
+		last = id.offset + len(id.lit)
+	}
+	out.WriteString(code[last:])
+	return out.String(), nil
+}
+
+// TransliterateContracts transliterates the Go names in contracts so they
+// match code passed through TransliterateGoIdentifiers. SQL names are kept.
+func TransliterateContracts(contracts []ProcedureContract) {
+	for i := range contracts {
+		c := &contracts[i]
+		c.GoName = TransliterateIdentifier(c.GoName)
+		for j := range c.Inputs {
+			c.Inputs[j].GoName = TransliterateIdentifier(c.Inputs[j].GoName)
+		}
+		for j := range c.Outputs {
+			c.Outputs[j].GoName = TransliterateIdentifier(c.Outputs[j].GoName)
+		}
+	}
+}
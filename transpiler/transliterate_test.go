@@ -0,0 +1,118 @@
+package transpiler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnicodeIdentifiers(t *testing.T) {
+	exported := map[string]string{
+		"Dirección":      "Dirección",
+		"año_fiscal":     "AñoFiscal",
+		"DirecciónEnvío": "DirecciónEnvío",
+		"ÉTAT_CIVIL":     "ÉtatCivil",
+		"Obtener_Año":    "ObtenerAño",
+		"名前":             "X名前",
+	}
+	for in, want := range exported {
+		if got := goExportedIdentifier(in); got != want {
+			t.Errorf("goExportedIdentifier(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	unexported := map[string]string{
+		"Año":            "año",
+		"DirecciónEnvío": "direcciónEnvío",
+		"Ñandú_ID":       "ñandúId",
+	}
+	for in, want := range unexported {
+		if got := goUnexportedIdentifier(in); got != want {
+			t.Errorf("goUnexportedIdentifier(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	if got := toPascalCase("dirección_envío"); got != "DirecciónEnvío" {
+		t.Errorf("toPascalCase(dirección_envío) = %q", got)
+	}
+}
+
+func TestTransliterateIdentifier(t *testing.T) {
+	if len(latin1Letters) != 64 || len(latinExtendedALetters) != 128 {
+		t.Fatalf("transliteration tables have %d and %d entries", len(latin1Letters), len(latinExtendedALetters))
+	}
+	tests := map[string]string{
+		"Dirección":  "Direccion",
+		"AñoFiscal":  "AnoFiscal",
+		"Größe":      "Grosse",
+		"ÆrøSkål":    "AEroSkal",
+		"Łódź":       "Lodz",
+		"Čeština":    "Cestina",
+		"plain_name": "plain_name",
+		"名前":         "名前",
+	}
+	for in, want := range tests {
+		if got := TransliterateIdentifier(in); got != want {
+			t.Errorf("TransliterateIdentifier(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestTransliterateGoIdentifiers(t *testing.T) {
+	code := `package main
+
+// ObtenerDirección reads the row for añoFiscal
+func ObtenerDirección(añoFiscal int32) string {
+	var direcciónEnvío string
+	_ = "SELECT DirecciónEnvío FROM Clientes WHERE AñoFiscal = $1"
+	return direcciónEnvío
+}
+`
+	got, err := TransliterateGoIdentifiers(code)
+	if err != nil {
+		t.Fatalf("TransliterateGoIdentifiers failed: %v", err)
+	}
+	for _, want := range []string{
+		"func ObtenerDireccion(anoFiscal int32) string",
+		"var direccionEnvio string",
+		"return direccionEnvio",
+		// Comments and SQL text keep the original spelling
+		"// ObtenerDirección reads the row for añoFiscal",
+		`"SELECT DirecciónEnvío FROM Clientes WHERE AñoFiscal = $1"`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in:\n%s", want, got)
+		}
+	}
+
+	_, err = TransliterateGoIdentifiers("package main\n\nvar año, ano int\n")
+	if err == nil || !strings.Contains(err.Error(), "ano and año") {
+		t.Errorf("expected a collision error for año and ano, got %v", err)
+	}
+}
+
+func TestTranspileWithDML_UnicodeNames(t *testing.T) {
+	source := `
+CREATE PROCEDURE dbo.ObtenerDirección
+    @año_fiscal INT,
+    @ClienteID INT
+AS
+BEGIN
+    DECLARE @DirecciónEnvío NVARCHAR(200)
+    SELECT @DirecciónEnvío = DirecciónEnvío FROM Clientes WHERE ClienteID = @ClienteID AND AñoFiscal = @año_fiscal
+    RETURN 0
+END
+`
+	config := DefaultDMLConfig()
+	result, err := TranspileWithDML(source, "main", config)
+	if err != nil {
+		t.Fatalf("Transpile failed: %v", err)
+	}
+	for _, want := range []string{
+		"func (r *Repository) ObtenerDirección(ctx context.Context, añoFiscal int32, clienteId int32)",
+		"AñoFiscal = $2", "clienteId, añoFiscal",
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("expected %q in:\n%s", want, result)
+		}
+	}
+}
@@ -13,10 +13,11 @@ import (
 
 // goStatementPattern matches GO batch separator lines.
 // GO is a client tool directive (SSMS, sqlcmd), not T-SQL itself.
-var goStatementPattern = regexp.MustCompile(`(?im)^\s*GO\s*$`)
+var goStatementPattern = regexp.MustCompile(`(?im)^[ \t]*GO[ \t]*\r?$`)
 
 // stripGoStatements removes GO batch separators from T-SQL source.
 // GO has no semantic meaning for transpilation - it's a client tool artifact.
+// The lines are left empty, so lines of the source keep their numbers.
 func stripGoStatements(source string) string {
 	return goStatementPattern.ReplaceAllString(source, "")
 }
@@ -34,6 +35,7 @@ func Transpile(source string, packageName string) (string, error) {
 	t := newTranspiler()
 	t.packageName = packageName
 	t.comments = buildCommentIndex(source)
+	t.recompiledProcs = recompiledProcedures(source)
 	return t.transpile(program)
 }
 
@@ -56,51 +58,115 @@ type TranspileResult struct {
 	ExtractedDDL      []string // DDL statements collected for extraction
 	TempTablesUsed    []string // Temp tables encountered (for fallback backend info)
 	TempTableWarnings []string // Warnings about temp tables with non-SQL backends
+	Warnings          []string // Other translation warnings (e.g. scalar UDFs kept in SQL)
+	Contracts         []ProcedureContract // Static contract of each procedure
+	SideEffects       []SideEffect        // Mail and events handed to application interfaces
+	Diagnostics       []Diagnostic        // Problems with a suggested flag setting
+	TableTypes        []string            // Table types whose structs are declared, this file's and DMLConfig.DeclaredTableTypes
+	Passthroughs      []string            // Passthrough stubs declared, this file's and DMLConfig.DeclaredPassthroughs
+
+	// Lines of the file the warnings and diagnostics come from, and the
+	// rules of the warnings (see Issues)
+	warningLines, ddlWarningLines, diagnosticLines []int
+	warningRules                                   map[int]string
 }
 
-// TranspileWithDMLEx is like TranspileWithDML but returns extended results
+// TranspileWithDMLEx is like TranspileWithDML but returns extended results.
+// It runs the stages of a Pipeline (see pipeline.go) without middleware.
 func TranspileWithDMLEx(source string, packageName string, dmlConfig DMLConfig) (*TranspileResult, error) {
-	if !dmlConfig.PreserveGo {
-		source = stripGoStatements(source)
-	}
-	program, errors := tsqlparser.Parse(source)
-	if len(errors) > 0 {
-		return nil, fmt.Errorf("parse errors:\n%s", strings.Join(errors, "\n"))
+	u, err := NewPipeline(packageName, dmlConfig).Run(source)
+	if err != nil {
+		return nil, err
 	}
+	return u.Result, nil
+}
 
+// newDMLTranspiler returns a transpiler for source in DML mode.
+func newDMLTranspiler(source, packageName string, dmlConfig DMLConfig) *transpiler {
 	t := newTranspiler()
 	t.packageName = packageName
 	t.comments = buildCommentIndex(source)
+	t.recompiledProcs = recompiledProcedures(source)
+	if dmlConfig.Style == StyleFunctions {
+		// No receiver to hang the store off: r.db becomes a db parameter
+		dmlConfig.StoreVar = unqualifiedName(dmlConfig.StoreVar)
+	}
+	normalizePackagePaths(&dmlConfig)
 	t.dmlConfig = dmlConfig
 	t.dmlEnabled = true
 	t.annotateLevel = dmlConfig.AnnotateLevel
-	
-	code, err := t.transpile(program)
-	if err != nil {
-		return nil, err
+	// Parsed once for the three; a source that doesn't parse adds nothing
+	program, errors := tsqlparser.Parse(stripGoStatements(source))
+	if len(errors) > 0 {
+		program = nil
 	}
-	
+	t.collectGeneratedColumns(program)
+	t.collectSequenceDefaults(program)
+	t.collectTableTypes(program)
+	t.collectKeyColumns(program)
+	t.addGlobalTempTables(program)
+	t.dialectVariants = collectDialectVariants(source)
+	t.constantRefs = constantRefs(dmlConfig.Constants)
+	t.declaredPassthroughs = map[string]bool{}
+	for _, name := range dmlConfig.DeclaredPassthroughs {
+		t.declaredPassthroughs[name] = true
+	}
+	return t
+}
+
+// result returns the TranspileResult for code transpiled by t.
+func (t *transpiler) result(code string) *TranspileResult {
+	dmlConfig := t.dmlConfig
+
 	// Generate temp table warnings if needed
 	var tempTableWarnings []string
-	if len(t.tempTablesUsed) > 0 && (dmlConfig.Backend == BackendGRPC || dmlConfig.Backend == BackendMock) {
+	diagnostics := t.diagnostics
+	// Temp tables routed with TableToBackend don't use the fallback
+	var fallbackTempTables []string
+	for _, name := range t.tempTablesUsed {
+		if _, ok := lookupTableBackend(dmlConfig.TableToBackend, name); !ok {
+			fallbackTempTables = append(fallbackTempTables, name)
+		}
+	}
+	if len(fallbackTempTables) > 0 && (dmlConfig.Backend == BackendGRPC || dmlConfig.Backend == BackendMock || dmlConfig.Backend == BackendMongo || dmlConfig.Backend == BackendRedis) {
 		if !dmlConfig.FallbackExplicit {
 			tempTableWarnings = append(tempTableWarnings,
 				fmt.Sprintf("Temp tables detected (%s) with --%s backend. "+
 					"Using --fallback-backend=%s (default). "+
 					"Use --fallback-backend to specify explicitly.",
-					strings.Join(t.tempTablesUsed, ", "),
+					strings.Join(fallbackTempTables, ", "),
 					dmlConfig.Backend,
 					dmlConfig.FallbackBackend))
+			diagnostics = append(diagnostics, Diagnostic{
+				Message: fmt.Sprintf("temp tables %s use the default fallback backend",
+					strings.Join(fallbackTempTables, ", ")),
+				Suggestion: Suggestion{Flag: "fallback-backend", Value: string(dmlConfig.FallbackBackend)},
+			})
 		}
 	}
 	
+	contracts := make([]ProcedureContract, len(t.contracts))
+	for i, c := range t.contracts {
+		contracts[i] = *c
+	}
+
 	return &TranspileResult{
 		Code:              code,
 		DDLWarnings:       t.ddlWarnings,
 		ExtractedDDL:      t.extractedDDL,
 		TempTablesUsed:    t.tempTablesUsed,
 		TempTableWarnings: tempTableWarnings,
-	}, nil
+		Warnings:          append(t.warnings[:len(t.warnings):len(t.warnings)], t.globalTempWarnings()...),
+		Contracts:         contracts,
+		SideEffects:       t.sideEffects,
+		Diagnostics:       diagnostics,
+		TableTypes:        sortedKeys(t.declaredTableTypes),
+		Passthroughs:      sortedKeys(t.declaredPassthroughs),
+		warningLines:      t.warningLines,
+		ddlWarningLines:   t.ddlWarningLines,
+		diagnosticLines:   t.diagnosticLines,
+		warningRules:      t.warningRules,
+	}
 }
 
 
@@ -111,12 +177,20 @@ type transpiler struct {
 	inProcBody    bool
 	inTryBlock    bool   // Track if we're inside a TRY block (anonymous function)
 	inCatchBlock  bool   // Track if we're inside a CATCH block
+
+	// TRY/CATCH written inline (see trycatch.go)
+	tryCount    int    // TRY blocks in the procedure, numbering their labels
+	catchLabel  string // Label of the CATCH errors jump to, or ""
+	catchErrVar string // Variable recording the error for catchLabel
+	catchJumped bool   // Whether anything jumps to catchLabel
+	tryErrVar   string // Variable holding the error the CATCH handles, or "" for _tryErr
 	currentProcName string // Current procedure name for ERROR_PROCEDURE()
 	symbols       *symbolTable
 	outputParams  []*ast.ParameterDef
 	hasReturnCode bool
 	packageName   string
 	comments      *commentIndex
+	recompiledProcs map[int]bool // Lines of procedures declared WITH RECOMPILE (see performance.go)
 	
 	// DML handling
 	dmlEnabled      bool
@@ -124,17 +198,96 @@ type transpiler struct {
 	inTransaction   bool // Track if we're inside a transaction block
 	hasDMLStatements bool // Track if procedure has DML requiring error return
 	usesRowCount    bool // Track if procedure uses @@ROWCOUNT
+	usesIdentity    bool // Procedure reads SCOPE_IDENTITY() or @@IDENTITY (see identity.go)
+	identityInserts map[*ast.InsertStatement]bool // INSERTs whose identity value is read
 	usesTempTables  bool // Track if procedure uses temp tables (#tables)
+	concurrentSelects bool // Procedure opted in to concurrent SELECTs (see concurrent.go)
+	activity        bool // Procedure runs as a worker activity (see activity.go)
 	
 	// Annotation level: none, minimal, standard, verbose
 	annotateLevel string
 	
 	// Cursor handling
 	cursors       map[string]*cursorInfo // name -> cursor info
-	activeCursor  string                 // currently open cursor (for FETCH detection)
+	activeCursor  string                 // cursor of the nearest FETCH, which @@FETCH_STATUS reports on
+	loopDepth     int                    // WHILE loops around the statement being transpiled
+
+	// Scalar subqueries read ahead of the IF, WHILE or SET using them, while
+	// readingScalars, so their errors can be returned (see readScalars)
+	readingScalars bool
+	scalarReads    []string
+
+	// Cursors buffered for FETCH other than NEXT, and whether @@FETCH_STATUS is read (see scrollcursor.go)
+	scrollCursors   map[string]bool
+	usesFetchStatus bool
+
+	// Cursors named by WHERE CURRENT OF, and the key columns of tables (see currentof.go)
+	currentOfCursors map[string]bool
+	keyColumns       map[string][]string // table (lower-cased) -> key columns
+
+	// Whether the procedure calls sp_getapplock or sp_releaseapplock (see applock.go)
+	usesAppLocks bool
+
+	// Body of the procedure being transpiled
+	procBody *ast.BeginEndBlock
+
+	// GOTO and labels (see goto.go)
+	labels        map[string]string // Labels of the procedure, by lower-case name
+	gotoTargets   map[string]bool   // Lower-case names GOTOs jump to
+	gotoScope     map[string]bool   // Labels GOTOs in the closure being written may jump to; nil outside one
+	gotoScopeName string            // What that closure is, for errors
+
+	// sql.Level of the transactions begun from here, after SET TRANSACTION ISOLATION LEVEL (see isolation.go)
+	isolationLevel string
 	
 	// User-defined function tracking
 	userFunctions map[string]*userFuncInfo // function name (lowercase) -> info
+	udfWarned     map[string]bool          // procedure/function pairs already warned about
+	udfHoistCount int                      // Counter for UDF calls hoisted out of queries
+	nextValueCount int                     // Counter for NEXT VALUE FOR fetched ahead of queries
+	
+	// Other translation warnings, surfaced via TranspileResult.Warnings
+	warnings      []string
+	decimalWarned bool // float decimal mode precision warning given
+
+	// Calls with effects outside the database (see mail.go)
+	sideEffects []SideEffect
+
+	// Problems with suggested fixes (see suggest.go), and the tables
+	// already reported as missing a --table-service entry
+	diagnostics    []Diagnostic
+	unroutedTables map[string]bool
+
+	// Lines of the warnings, DDL warnings and diagnostics, and the rules of
+	// the warnings that aren't RuleTranslation, by index (see issues.go)
+	warningLines, ddlWarningLines, diagnosticLines []int
+	warningRules                                   map[int]string
+
+	// Statements counted by StatementCoverage (see coverage.go)
+	coverage *coverageScan
+
+	// Statement timeouts (DMLConfig.TimeoutScope = "statement")
+	inStatementTimeout bool // Transpiling a statement that has its own deadline
+	usesStmtTimeout    bool // The current procedure has a statement with a deadline
+
+	// Tables read with NOLOCK or READUNCOMMITTED (see nolock.go)
+	dirtyReads      []dirtyRead
+	hintedStatement ast.Statement // Statement the tables are collected for
+	nolockTx        string        // Its READ UNCOMMITTED transaction, if any
+	nolockTxCount   int
+
+	// The current procedure has a transaction wrapped in tsqlruntime.Retry
+	// (see retry.go)
+	retriedTx bool
+	inRetry   bool // Transpiling a retried closure, where RETURN ends the retries
+
+	// OpenTelemetry spans (see otel.go)
+	inTracedStatement bool // Transpiling a statement whose calls get spans
+	usesRPCSpan       bool // The current procedure has a gRPC call in a span
+
+	// Procedure contracts collected in DML mode (see contract.go)
+	contracts       []*ProcedureContract
+	currentContract *ProcedureContract
 	
 	// DDL handling
 	ddlWarnings  []string // Collect DDL skip warnings
@@ -142,9 +295,54 @@ type transpiler struct {
 	
 	// Temp table tracking for fallback backend warnings
 	tempTablesUsed []string // Names of temp tables encountered
+
+	// Temp tables the procedure creates in tempTables, by lower-cased name (see memtable.go)
+	memoryTables map[string]*memoryTable
+
+	// Global temp tables kept in memory, and the procedures naming them (see globaltemp.go)
+	globalTempTables map[string]*memoryTable
+	globalTempUses   map[string]*globalTempUse
+
+	// Generated columns dropped from INSERT/UPDATE (see schema.go)
+	generatedColumns map[string]map[string]string // table -> column -> kind, lower-cased
+	sequenceDefaults map[string]map[string]string // table (lower-cased) -> column -> sequence
+
+	// Table-valued parameters (see tvp.go)
+	tableTypes            map[string]*TableType  // Lower-cased name without schema -> type
+	declaredTableTypes    map[string]bool        // Structs declared in this file or an earlier one
+	pendingTableTypes     map[string]bool        // Used by a procedure but not yet declared
+	tableParams           map[string]*tableParam // The current procedure's, by lower-cased name
+	inTableParamStatement bool                   // Transpiling a statement whose queries may read them
+
+	// XML documents and rows being shredded (see xmlmethods.go)
+	xmlDocuments map[string]string    // sp_xml_preparedocument handle, lower-cased without @ -> parsed document
+	xmlRows      map[string]string    // nodes() alias, T.c and c lower-cased -> Go node
+	xmlColumns   map[string]xmlColumn // OPENXML WITH column, lower-cased -> value read from the node
+	xmlRowNumber string               // Counter of the rows shredded, once ROW_NUMBER() reads it
+
+	// Named constants (see constants.go): literal value -> Go reference
+	constantRefs map[string]string
+
+	// DMLConfig.Verbs applied to actionVerbs, on first use
+	actionVerbs []ActionVerb
+
+	// Passthrough stubs (see passthrough.go)
+	declaredPassthroughs map[string]bool // Stubs declared in this file or an earlier one, by Go name
+	passthroughStubs     []string        // Stubs to declare in this file
+
+	// SQL Agent job runners (see jobs.go), declared after the steps
+	jobRunners []string
+
+	// Per-dialect SQL from tgpiler:dialect comments (see variants.go)
+	dialectVariants  map[int]map[string]string // Statement line -> dialect -> SQL
+	variantStatement ast.Statement             // Statement transpiled with its variant
+	variantSQL       string                    // The variant, until a query takes it
 	
 	// Track if any procedures/functions were transpiled
 	hasProcedures bool
+
+	// Lines of the file before the batch being streamed (see stream.go)
+	lineOffset int
 }
 
 // userFuncInfo tracks user-defined functions for call resolution
@@ -160,8 +358,12 @@ type cursorInfo struct {
 	name       string
 	query      *ast.SelectStatement
 	fetchVars  []*ast.Variable // Variables from FETCH INTO
-	rowsVar    string          // Generated Go variable name for rows
+	rowsVar    string          // Generated Go variable name for rows, or the tsqlruntime.Cursor if scrolled
 	isOpen     bool
+	inLoop     bool // Opened inside a WHILE, so CLOSE closes the rows rather than leaving it to defer
+	keyColumns []string // Key columns added to the query for WHERE CURRENT OF, from keyIndex
+	keyIndex   int
+	keyVars    []string // Go variables holding the current row's keys
 }
 
 func newTranspiler() *transpiler {
@@ -230,54 +432,60 @@ func (t *transpiler) transpile(program *ast.Program) (string, error) {
 		if err != nil {
 			return "", err
 		}
+		t.locate(stmt)
 		if body != "" {
 			bodies = append(bodies, body)
 		}
 	}
+	decls, err := t.declarePendingTableTypes()
+	if err != nil {
+		return "", err
+	}
+	bodies = append(bodies, decls...)
+	bodies = append(bodies, t.passthroughStubs...)
 
 	// Check for DDL-only files (no procedures/functions)
 	if !t.hasProcedures && len(bodies) > 0 {
-		// File contains statements but no procedures - likely a DDL/schema file
-		hint := "This file appears to contain only DDL statements (CREATE TABLE, etc.) without any stored procedures.\n" +
-			"      tgpiler transpiles stored procedures to Go functions.\n\n" +
-			"      For DDL/schema files, consider:\n" +
-			"        - Keep them as SQL migration scripts\n" +
-			"        - Use --extract-ddl=FILE to collect DDL from mixed files\n" +
-			"        - Use a migration tool like golang-migrate, goose, or atlas"
-		return "", fmt.Errorf("no stored procedures found in input\n\n      Hint: %s", hint)
+		return "", errNoProcedures()
+	}
+	bodies = append(bodies, t.jobRunners...)
+
+	if t.dmlEnabled {
+		t.addPackageImports(strings.Join(bodies, "\n"))
 	}
 
 	// Build final output with imports
 	var out strings.Builder
-	out.WriteString(fmt.Sprintf("package %s\n\n", t.packageName))
-
-	if len(t.imports) > 0 {
-		// Separate stdlib and third-party imports
-		var stdImports, thirdPartyImports []string
-		for imp := range t.imports {
-			if strings.Contains(imp, ".") {
-				thirdPartyImports = append(thirdPartyImports, imp)
-			} else {
-				stdImports = append(stdImports, imp)
-			}
-		}
-		sort.Strings(stdImports)
-		sort.Strings(thirdPartyImports)
+	t.writeHeader(&out)
+	out.WriteString(strings.Join(bodies, "\n\n"))
+	out.WriteString("\n")
 
-		out.WriteString("import (\n")
-		for _, imp := range stdImports {
-			out.WriteString(fmt.Sprintf("\t%q\n", imp))
-		}
-		if len(stdImports) > 0 && len(thirdPartyImports) > 0 {
-			out.WriteString("\n") // Blank line between groups
+	if t.dmlEnabled {
+		if problems := checkPlaceholders(out.String(), t.dmlConfig.SQLDialect); len(problems) > 0 {
+			return "", fmt.Errorf("placeholder and argument mismatches:\n%s", strings.Join(problems, "\n"))
 		}
-		for _, imp := range thirdPartyImports {
-			out.WriteString(fmt.Sprintf("\t%q\n", imp))
-		}
-		out.WriteString(")\n\n")
 	}
+	return out.String(), nil
+}
 
-	// Generate SPLogger initialization if requested
+// errNoProcedures is the error for a file with statements but no
+// procedures, likely a DDL/schema file.
+func errNoProcedures() error {
+	hint := "This file appears to contain only DDL statements (CREATE TABLE, etc.) without any stored procedures.\n" +
+		"      tgpiler transpiles stored procedures to Go functions.\n\n" +
+		"      For DDL/schema files, consider:\n" +
+		"        - Keep them as SQL migration scripts\n" +
+		"        - Use --extract-ddl=FILE to collect DDL from mixed files\n" +
+		"        - Use a migration tool like golang-migrate, goose, or atlas\n" +
+		"      For job scripts, --script transpiles the statements into one function"
+	return fmt.Errorf("no stored procedures found in input\n\n      Hint: %s", hint)
+}
+
+// writeHeader writes the package clause and imports, and the SPLogger
+// initialization if requested.
+func (t *transpiler) writeHeader(out *strings.Builder) {
+	out.WriteString(fmt.Sprintf("package %s\n\n", t.packageName))
+	t.writeImports(out)
 	if t.dmlEnabled && t.dmlConfig.UseSPLogger && t.dmlConfig.GenLoggerInit {
 		initCode := t.generateSPLoggerInit()
 		if initCode != "" {
@@ -285,11 +493,45 @@ func (t *transpiler) transpile(program *ast.Program) (string, error) {
 			out.WriteString("\n\n")
 		}
 	}
+}
 
-	out.WriteString(strings.Join(bodies, "\n\n"))
-	out.WriteString("\n")
+// writeImports writes the import declaration for t.imports: the standard
+// library first, then other packages, named imports by path.
+func (t *transpiler) writeImports(out *strings.Builder) {
+	if len(t.imports) == 0 {
+		return
+	}
+	// Separate stdlib and third-party imports
+	var stdImports, thirdPartyImports []string
+	for imp := range t.imports {
+		if strings.Contains(imp, ".") || strings.Contains(imp, " ") {
+			thirdPartyImports = append(thirdPartyImports, imp)
+		} else {
+			stdImports = append(stdImports, imp)
+		}
+	}
+	sort.Strings(stdImports)
+	// Named imports ("name path") sort by path
+	importPath := func(imp string) string { return imp[strings.LastIndex(imp, " ")+1:] }
+	sort.Slice(thirdPartyImports, func(i, j int) bool {
+		return importPath(thirdPartyImports[i]) < importPath(thirdPartyImports[j])
+	})
 
-	return out.String(), nil
+	out.WriteString("import (\n")
+	for _, imp := range stdImports {
+		out.WriteString(fmt.Sprintf("\t%q\n", imp))
+	}
+	if len(stdImports) > 0 && len(thirdPartyImports) > 0 {
+		out.WriteString("\n") // Blank line between groups
+	}
+	for _, imp := range thirdPartyImports {
+		if name, p, ok := strings.Cut(imp, " "); ok {
+			out.WriteString(fmt.Sprintf("\t%s %q\n", name, p))
+		} else {
+			out.WriteString(fmt.Sprintf("\t%q\n", imp))
+		}
+	}
+	out.WriteString(")\n\n")
 }
 
 // generateSPLoggerInit generates initialization code for SPLogger based on config
@@ -347,6 +589,24 @@ func (t *transpiler) generateSPLoggerInit() string {
 }
 
 func (t *transpiler) transpileStatement(stmt ast.Statement) (string, error) {
+	if t.coversStatement(stmt) {
+		return t.transpileCoveredStatement(stmt)
+	}
+	if sql, ok := t.dialectVariant(stmt); ok {
+		return t.transpileDialectVariant(stmt, sql)
+	}
+	if t.hintsStatement(stmt) {
+		return t.transpileHintedStatement(stmt)
+	}
+	if t.timesStatement(stmt) {
+		return t.transpileTimedStatement(stmt)
+	}
+	if t.tracesStatement() {
+		return t.transpileTracedStatement(stmt)
+	}
+	if t.bindsTableParams() {
+		return t.transpileTableParamStatement(stmt)
+	}
 	switch s := stmt.(type) {
 	case *ast.CreateProcedureStatement:
 		return t.transpileCreateProcedure(s)
@@ -370,6 +630,10 @@ func (t *transpiler) transpileStatement(stmt ast.Statement) (string, error) {
 		return "break", nil
 	case *ast.ContinueStatement:
 		return "continue", nil
+	case *ast.GotoStatement:
+		return t.transpileGoto(s)
+	case *ast.LabelStatement:
+		return t.transpileLabel(s)
 	case *ast.PrintStatement:
 		return t.transpilePrint(s)
 	
@@ -406,6 +670,11 @@ func (t *transpiler) transpileStatement(stmt ast.Statement) (string, error) {
 			return t.transpileBeginTransaction(s)
 		}
 		return "", fmt.Errorf("BEGIN TRANSACTION requires DML mode (use TranspileWithDML)")
+	case *ast.SetTransactionIsolationStatement:
+		if t.dmlEnabled {
+			return t.transpileSetIsolation(s)
+		}
+		return "", fmt.Errorf("SET TRANSACTION ISOLATION LEVEL requires DML mode (use TranspileWithDML)")
 	case *ast.CommitTransactionStatement:
 		if t.dmlEnabled {
 			return t.transpileCommitTransaction(s)
@@ -423,6 +692,11 @@ func (t *transpiler) transpileStatement(stmt ast.Statement) (string, error) {
 			return t.transpileCreateTable(s)
 		}
 		return "", fmt.Errorf("CREATE TABLE requires DML mode (use TranspileWithDML)")
+	case *ast.CreateTypeStatement:
+		if s.IsTableType && t.dmlEnabled {
+			return t.transpileCreateTableType(s)
+		}
+		return "", unsupportedStatementError(stmt)
 	case *ast.DropTableStatement:
 		if t.dmlEnabled {
 			return t.transpileDropTable(s)
@@ -433,6 +707,11 @@ func (t *transpiler) transpileStatement(stmt ast.Statement) (string, error) {
 			return t.transpileTruncateTable(s)
 		}
 		return "", fmt.Errorf("TRUNCATE TABLE requires DML mode (use TranspileWithDML)")
+	case *ast.BulkInsertStatement:
+		if t.dmlEnabled {
+			return t.transpileBulkInsert(s)
+		}
+		return "", fmt.Errorf("BULK INSERT requires DML mode (use TranspileWithDML)")
 	
 	// Cursor statements
 	case *ast.DeclareCursorStatement:
@@ -466,6 +745,8 @@ func (t *transpiler) transpileStatement(stmt ast.Statement) (string, error) {
 		return t.transpileRaiserror(s)
 	case *ast.ThrowStatement:
 		return t.transpileThrow(s)
+	case *ast.WaitforStatement:
+		return t.transpileWaitfor(s)
 	
 	// CTE (Common Table Expression) statements
 	case *ast.WithStatement:
@@ -474,6 +755,18 @@ func (t *transpiler) transpileStatement(stmt ast.Statement) (string, error) {
 		}
 		return "", fmt.Errorf("WITH/CTE statements require DML mode (use TranspileWithDML)")
 	
+	case *ast.AlterSequenceStatement:
+		// RESTART WITH resets a counter at runtime; other changes are DDL
+		if code, ok := t.transpileAlterSequence(s); ok {
+			return code, nil
+		}
+		if t.dmlEnabled && t.dmlConfig.SkipDDL && !t.dmlConfig.StrictDDL {
+			if skipped, comment := t.trySkipDDL(stmt); skipped {
+				return comment, nil
+			}
+		}
+		return "", unsupportedStatementError(stmt)
+
 	default:
 		// Check if this is a DDL statement that should be skipped
 		if t.dmlEnabled && t.dmlConfig.SkipDDL && !t.dmlConfig.StrictDDL {
@@ -536,8 +829,8 @@ func unsupportedStatementError(stmt ast.Statement) error {
 	case strings.Contains(typeName, "CreateSequence"):
 		return fmt.Errorf("unsupported statement type: %s\n"+
 			"      Hint: CREATE SEQUENCE is a DDL statement.\n"+
-			"      Sequences should remain in your database schema.\n"+
-			"      Use result.LastInsertId() or uuid.New() in Go.", typeName)
+			"      Sequences should remain in your database schema; use --dml\n"+
+			"      with --extract-ddl to write them out for the target dialect.", typeName)
 	
 	default:
 		return fmt.Errorf("unsupported statement type: %s\n"+
@@ -575,6 +868,16 @@ func (t *transpiler) trySkipDDL(stmt ast.Statement) (bool, string) {
 		if s := stmt.String(); s != "" {
 			ddlName = extractDDLName(s, "TABLE")
 		}
+	case strings.Contains(typeName, "AlterSequence"):
+		ddlType = "ALTER SEQUENCE"
+		if s := stmt.String(); s != "" {
+			ddlName = extractDDLName(s, "SEQUENCE")
+		}
+	case strings.Contains(typeName, "DropSequence"):
+		ddlType = "DROP SEQUENCE"
+		if s := stmt.String(); s != "" {
+			ddlName = extractDDLName(strings.Replace(s, "IF EXISTS ", "", 1), "SEQUENCE")
+		}
 	case strings.Contains(typeName, "AlterIndex"):
 		ddlType = "ALTER INDEX"
 	case strings.Contains(typeName, "AlterView"):
@@ -596,9 +899,14 @@ func (t *transpiler) trySkipDDL(stmt ast.Statement) (bool, string) {
 	}
 	t.ddlWarnings = append(t.ddlWarnings, warning)
 	
-	// Collect DDL for extraction if configured
+	// Collect DDL for extraction if configured, sequences converted for the
+	// dialect
 	if t.dmlConfig.ExtractDDL != "" {
-		t.extractedDDL = append(t.extractedDDL, stmt.String())
+		ddl, ok := t.sequenceDDL(stmt)
+		if !ok {
+			ddl = stmt.String()
+		}
+		t.extractedDDL = append(t.extractedDDL, ddl)
 	}
 	
 	// Return comment
@@ -750,15 +1058,26 @@ func (t *transpiler) transpileCreateProcedure(proc *ast.CreateProcedureStatement
 	
 	// Reset DML tracking
 	t.hasDMLStatements = false
+	t.concurrentSelects = false
+	t.activity = false
+	t.tableParams = nil
+	t.xmlDocuments = nil
 
 	// Pre-scan for DML statements if DML mode is enabled
 	if t.dmlEnabled && proc.Body != nil {
 		t.hasDMLStatements = t.blockHasDML(proc.Body)
 	}
+	if t.dmlEnabled && t.dmlConfig.Style == StyleFunctions {
+		// EXEC call sites in other files rely on every procedure returning one
+		t.hasDMLStatements = true
+	}
 
 	// Get procedure name for comment lookup and ERROR_PROCEDURE()
 	procName := proc.Name.Parts[len(proc.Name.Parts)-1].Value
 	t.currentProcName = procName // Store for ERROR_PROCEDURE() in CATCH blocks
+	t.tryCount = 0
+	t.procBody = proc.Body
+	t.labels, t.gotoTargets = labelsIn(proc.Body)
 	t.hasProcedures = true       // Mark that we found a procedure
 	sig := "PROC:" + strings.ToLower(procName)
 
@@ -788,24 +1107,43 @@ func (t *transpiler) transpileCreateProcedure(proc *ast.CreateProcedureStatement
 
 	// Emit leading comments for the procedure
 	if comments := t.comments.lookup(sig); len(comments) > 0 {
+		t.concurrentSelects = t.dmlEnabled && hasPragma(comments, concurrentPragma)
+		t.activity = t.dmlEnabled && hasPragma(comments, activityPragma)
+		if t.activity {
+			t.hasDMLStatements = true // Activities always return an error
+		}
 		for _, c := range comments {
 			out.WriteString("// " + c + "\n")
 		}
 	}
+	notes := performanceNotes(proc, t.recompiledProcs)
+	for i := range notes {
+		notes[i].Line = t.fileLine(notes[i].Line)
+	}
+	writePerformanceNotes(&out, notes)
 
 	// Separate input and output parameters
 	var inputParams []string
 	var outputParams []*ast.ParameterDef
 	
+	nullParams := t.nullableParams(proc)
 	for _, p := range proc.Parameters {
 		goType, err := t.mapDataType(p.DataType)
 		if err != nil {
 			return "", fmt.Errorf("parameter %s: %w", p.Name, err)
 		}
 		paramName := goIdentifier(strings.TrimPrefix(p.Name, "@"))
+		if tt, ok := t.lookupTableType(p.DataType); ok {
+			t.addTableParam(p, tt)
+		}
 		
 		// Record parameter type in symbol table
-		t.symbols.define(paramName, typeInfoFromDataType(p.DataType))
+		ti := t.typeInfoFromDataType(p.DataType)
+		if nullParams[paramName] && t.nullable(goType) {
+			goType = t.nullType(goType)
+			ti.nullable = true
+		}
+		t.symbols.define(paramName, ti)
 		
 		if p.Output {
 			outputParams = append(outputParams, p)
@@ -817,8 +1155,18 @@ func (t *transpiler) transpileCreateProcedure(proc *ast.CreateProcedureStatement
 	// Function signature
 	funcName := goExportedIdentifier(procName)
 	
-	// Add receiver if configured (DML mode with receiver)
-	if t.dmlEnabled && t.dmlConfig.Receiver != "" && t.dmlConfig.ReceiverType != "" {
+	if t.dmlEnabled && t.dmlConfig.Style == StyleFunctions {
+		// Functional style: no receiver, store threaded as a parameter
+		out.WriteString(fmt.Sprintf("func %s(", funcName))
+		leading := []string{"ctx context.Context"}
+		if t.hasStoreParam() {
+			t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+			leading = append(leading, t.dmlConfig.StoreVar+" tsqlruntime.DBTX")
+		}
+		out.WriteString(strings.Join(append(leading, inputParams...), ", "))
+		t.imports["context"] = true
+	} else if t.dmlEnabled && t.dmlConfig.Receiver != "" && t.dmlConfig.ReceiverType != "" {
+		// Add receiver if configured (DML mode with receiver)
 		out.WriteString(fmt.Sprintf("func (%s %s) %s(", t.dmlConfig.Receiver, t.dmlConfig.ReceiverType, funcName))
 		// Always add ctx as first parameter in DML mode with receiver
 		out.WriteString("ctx context.Context")
@@ -835,6 +1183,12 @@ func (t *transpiler) transpileCreateProcedure(proc *ast.CreateProcedureStatement
 
 	// Return type(s)
 	hasReturn := t.procedureHasReturn(proc)
+	if t.dmlEnabled {
+		if err := t.beginContract(proc, procName, hasReturn); err != nil {
+			return "", err
+		}
+		defer func() { t.currentContract = nil }()
+	}
 	needsErrorReturn := t.hasDMLStatements
 	
 	if len(outputParams) > 0 || hasReturn || needsErrorReturn {
@@ -843,6 +1197,9 @@ func (t *transpiler) transpileCreateProcedure(proc *ast.CreateProcedureStatement
 		for _, p := range outputParams {
 			goType, _ := t.mapDataType(p.DataType)
 			paramName := goIdentifier(strings.TrimPrefix(p.Name, "@"))
+			if ti := t.symbols.lookup(paramName); ti != nil && ti.nullable {
+				goType = t.nullType(goType)
+			}
 			returns = append(returns, fmt.Sprintf("%s %s", paramName, goType))
 		}
 		if hasReturn {
@@ -865,6 +1222,35 @@ func (t *transpiler) transpileCreateProcedure(proc *ast.CreateProcedureStatement
 	t.outputParams = outputParams
 	t.hasReturnCode = hasReturn
 
+	// Execution statistics, keyed by the name SQL Server would report
+	if t.dmlEnabled && t.dmlConfig.ExecStats {
+		out.WriteString(t.indentStr())
+		out.WriteString(fmt.Sprintf("defer tsqlruntime.TrackProcedure(%q)()\n", procStatsName(proc.Name)))
+		t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+	}
+	if t.dmlEnabled && t.dmlConfig.Metrics {
+		out.WriteString(t.indentStr())
+		if needsErrorReturn {
+			out.WriteString(fmt.Sprintf("observe := tsqlruntime.ObserveProcedure(%s, %q)\n", t.dmlConfig.MetricsVar, procName))
+			out.WriteString(t.indentStr() + "defer func() { observe(err) }()\n")
+		} else {
+			out.WriteString(fmt.Sprintf("defer tsqlruntime.ObserveProcedure(%s, %q)(nil)\n", t.dmlConfig.MetricsVar, procName))
+		}
+		t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+	}
+
+	// Span for the whole call
+	out.WriteString(t.otelPrologue(procName, needsErrorReturn))
+
+	// Deadline for the whole call; statement deadlines are added below
+	// once the body shows whether any statement needs one
+	out.WriteString(t.procTimeoutPrologue())
+	bodyStart := out.Len()
+	t.usesStmtTimeout = false
+	t.usesRPCSpan = false
+	t.nolockTxCount = 0
+	t.retriedTx = false
+
 	// Pre-scan for @@ROWCOUNT usage
 	t.usesRowCount = t.blockUsesRowCount(proc.Body)
 	if t.usesRowCount {
@@ -872,8 +1258,41 @@ func (t *transpiler) transpileCreateProcedure(proc *ast.CreateProcedureStatement
 		out.WriteString("var rowsAffected int32\n")
 	}
 
+	// Pre-scan for cursors fetched other than NEXT
+	t.scrollCursors = nil
+	t.currentOfCursors = nil
+	t.usesFetchStatus = false
+	if t.dmlEnabled {
+		t.scrollCursors = scrollCursorsIn(proc.Body)
+		t.currentOfCursors = currentOfCursorsIn(proc.Body)
+		t.usesFetchStatus = len(t.scrollCursors) > 0 && usesFetchStatusIn(proc.Body)
+	}
+	if t.usesFetchStatus {
+		out.WriteString(t.indentStr())
+		out.WriteString("fetchStatus := int32(-1)\n")
+	}
+
+	t.isolationLevel = ""
+
+	// Pre-scan for application locks
+	t.usesAppLocks = t.dmlEnabled && usesAppLocksIn(proc.Body)
+	if t.usesAppLocks {
+		out.WriteString(t.appLocksPrologue())
+	}
+
+	// Pre-scan for identity reads
+	t.scanIdentityReads(proc.Body)
+	if t.usesIdentity {
+		out.WriteString(t.indentStr())
+		out.WriteString("var lastInsertID int64\n")
+	}
+
 	// Pre-scan for temp table usage
-	t.usesTempTables = t.blockUsesTempTables(proc.Body)
+	t.usesTempTables = t.blockUsesTempTables(proc.Body) || t.namesGlobalTempTable(proc.Body)
+	t.memoryTables = t.memoryTablesIn(proc.Body)
+	if t.dmlEnabled {
+		t.recordGlobalTempTables(proc, procName)
+	}
 	if t.usesTempTables {
 		out.WriteString(t.indentStr())
 		out.WriteString("tempTables := tsqlruntime.NewTempTableManager()\n")
@@ -883,19 +1302,27 @@ func (t *transpiler) transpileCreateProcedure(proc *ast.CreateProcedureStatement
 	// Body
 	t.inProcBody = true
 	if proc.Body != nil {
-		for _, stmt := range proc.Body.Statements {
-			body, err := t.transpileStatement(stmt)
-			if err != nil {
-				return "", err
-			}
-			if body != "" {
-				out.WriteString(t.indentStr())
-				out.WriteString(body)
-				out.WriteString("\n")
-			}
+		if err := t.transpileStatementList(&out, proc.Body.Statements); err != nil {
+			return "", err
+		}
+		if err := t.placeLabels(&out, bodyStart); err != nil {
+			return "", err
 		}
 	}
 	t.inProcBody = false
+	t.activity = false
+	if t.usesStmtTimeout || t.usesRPCSpan {
+		var prologue string
+		if t.usesStmtTimeout {
+			prologue += t.stmtTimeoutPrologue()
+		}
+		if t.usesRPCSpan {
+			prologue += t.rpcSpanPrologue()
+		}
+		content := out.String()
+		out.Reset()
+		out.WriteString(content[:bodyStart] + prologue + content[bodyStart:])
+	}
 
 	// Emit blank assignments for genuinely unused local variables
 	// Skip this when the body is wrapped in TRY/CATCH (IIFE) since variables are scoped to the IIFE
@@ -958,12 +1385,27 @@ func (t *transpiler) transpileCreateProcedure(proc *ast.CreateProcedureStatement
 	return out.String(), nil
 }
 
+// procStatsName returns a procedure's name as schema.name, the way queries
+// over sys.dm_exec_procedure_stats usually label it.
+func procStatsName(name *ast.QualifiedIdentifier) string {
+	parts := name.Parts
+	if len(parts) > 2 {
+		parts = parts[len(parts)-2:]
+	}
+	if len(parts) == 1 {
+		return "dbo." + parts[0].Value
+	}
+	return parts[0].Value + "." + parts[1].Value
+}
+
 // transpileCreateFunction converts a T-SQL function to a Go function.
 func (t *transpiler) transpileCreateFunction(fn *ast.CreateFunctionStatement) (string, error) {
 	var out strings.Builder
 
 	// Reset symbol table for new function scope
 	t.symbols = newSymbolTable()
+	// Functions return no error, whatever the procedure before did
+	t.hasDMLStatements = false
 
 	// Get function name
 	funcName := fn.Name.Parts[len(fn.Name.Parts)-1].Value
@@ -1008,7 +1450,7 @@ func (t *transpiler) transpileCreateFunction(fn *ast.CreateFunctionStatement) (s
 			return "", fmt.Errorf("parameter %s: %w", p.Name, err)
 		}
 		paramName := goIdentifier(strings.TrimPrefix(p.Name, "@"))
-		t.symbols.define(paramName, typeInfoFromDataType(p.DataType))
+		t.symbols.define(paramName, t.typeInfoFromDataType(p.DataType))
 		params = append(params, fmt.Sprintf("%s %s", paramName, goType))
 	}
 	out.WriteString(strings.Join(params, ", "))
@@ -1021,18 +1463,24 @@ func (t *transpiler) transpileCreateFunction(fn *ast.CreateFunctionStatement) (s
 	// Transpile body
 	t.indent = 1
 	t.inProcBody = true
+	t.labels, t.gotoTargets = labelsIn(fn.Body)
+	bodyStart := out.Len()
 	
 	for _, stmt := range fn.Body.Statements {
 		body, err := t.transpileStatement(stmt)
 		if err != nil {
 			return "", err
 		}
+		t.locate(stmt)
 		if body != "" {
 			out.WriteString(t.indentStr())
 			out.WriteString(body)
 			out.WriteString("\n")
 		}
 	}
+	if err := t.placeLabels(&out, bodyStart); err != nil {
+		return "", err
+	}
 	
 	t.inProcBody = false
 
@@ -1098,14 +1546,18 @@ func (t *transpiler) statementHasDML(stmt ast.Statement) bool {
 	switch s := stmt.(type) {
 	case *ast.SelectStatement, *ast.InsertStatement, *ast.UpdateStatement, *ast.DeleteStatement:
 		return true
-	case *ast.CreateTableStatement, *ast.DropTableStatement, *ast.TruncateTableStatement:
+	case *ast.CreateTableStatement, *ast.DropTableStatement, *ast.TruncateTableStatement, *ast.BulkInsertStatement:
 		return true
 	case *ast.ExecStatement:
 		return true
+	case *ast.OpenCursorStatement:
+		return true // Runs the cursor's query
+	case *ast.WaitforStatement:
+		return true // Waits on ctx, returning its error
 	case *ast.BeginEndBlock:
 		return t.blockHasDML(s)
 	case *ast.IfStatement:
-		if t.statementHasDML(s.Consequence) {
+		if queriesSubquery(s.Condition) || t.statementHasDML(s.Consequence) {
 			return true
 		}
 		if s.Alternative != nil && t.statementHasDML(s.Alternative) {
@@ -1113,7 +1565,16 @@ func (t *transpiler) statementHasDML(stmt ast.Statement) bool {
 		}
 		return false
 	case *ast.WhileStatement:
-		return t.statementHasDML(s.Body)
+		return queriesSubquery(s.Condition) || t.statementHasDML(s.Body)
+	case *ast.SetStatement:
+		return queriesSubquery(s.Value)
+	case *ast.DeclareStatement:
+		for _, v := range s.Variables {
+			if queriesSubquery(v.Value) {
+				return true
+			}
+		}
+		return false
 	case *ast.TryCatchStatement:
 		if s.TryBlock != nil && t.blockHasDML(s.TryBlock) {
 			return true
@@ -1236,6 +1697,13 @@ func (t *transpiler) statementUsesTempTables(stmt ast.Statement) bool {
 	case *ast.CreateTableStatement:
 		tableName := s.Name.String()
 		return strings.HasPrefix(tableName, "#")
+	case *ast.DeclareStatement:
+		for _, v := range s.Variables {
+			if v.TableType != nil {
+				return true
+			}
+		}
+		return false
 	case *ast.DropTableStatement:
 		for _, table := range s.Tables {
 			tableName := table.String()
@@ -1269,6 +1737,60 @@ func (t *transpiler) statementUsesTempTables(stmt ast.Statement) bool {
 	}
 }
 
+// beginTx returns the call beginning a transaction with opts on the
+// store. In functional style the store is a tsqlruntime.DBTX, which
+// begins one through tsqlruntime.BeginTx.
+func (t *transpiler) beginTx(opts string) string {
+	if t.hasStoreParam() {
+		t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+		return fmt.Sprintf("tsqlruntime.BeginTx(ctx, %s, %s)", t.dmlConfig.StoreVar, opts)
+	}
+	return fmt.Sprintf("%s.BeginTx(ctx, %s)", t.dmlConfig.StoreVar, opts)
+}
+
+// blockUsesTransactions checks if a block contains BEGIN TRANSACTION
+func (t *transpiler) blockUsesTransactions(block *ast.BeginEndBlock) bool {
+	if block == nil {
+		return false
+	}
+	for _, stmt := range block.Statements {
+		if t.statementUsesTransactions(stmt) {
+			return true
+		}
+	}
+	return false
+}
+
+// statementUsesTransactions checks if a statement is or contains BEGIN TRANSACTION
+func (t *transpiler) statementUsesTransactions(stmt ast.Statement) bool {
+	switch s := stmt.(type) {
+	case *ast.BeginTransactionStatement:
+		return true
+	case *ast.IfStatement:
+		if t.statementUsesTransactions(s.Consequence) {
+			return true
+		}
+		if s.Alternative != nil && t.statementUsesTransactions(s.Alternative) {
+			return true
+		}
+		return false
+	case *ast.WhileStatement:
+		return t.statementUsesTransactions(s.Body)
+	case *ast.BeginEndBlock:
+		return t.blockUsesTransactions(s)
+	case *ast.TryCatchStatement:
+		if s.TryBlock != nil && t.blockUsesTransactions(s.TryBlock) {
+			return true
+		}
+		if s.CatchBlock != nil && t.blockUsesTransactions(s.CatchBlock) {
+			return true
+		}
+		return false
+	default:
+		return false
+	}
+}
+
 // procedureHasReturn checks if a procedure has any RETURN statements with values.
 func (t *transpiler) procedureHasReturn(proc *ast.CreateProcedureStatement) bool {
 	if proc.Body == nil {
@@ -1382,30 +1904,19 @@ func (t *transpiler) buildErrorReturn() string {
 	if t.inTryBlock {
 		return "return err"
 	}
+
+	// In an inline TRY block, jump to the CATCH
+	if exit, ok := t.catchExit("err", t.indentStr()+"\t"); ok {
+		return exit
+	}
 	
 	// In CATCH block, we're inside an if block - cannot return from outer func
 	// Use _ = err to acknowledge error but continue
-	if t.inCatchBlock {
+	if t.inCatchBlock && !t.tryCatchErrors() {
 		return "_ = err // Operation failed in error handler"
 	}
 
-	var parts []string
-	
-	// Add output params
-	for _, p := range t.outputParams {
-		paramName := goIdentifier(strings.TrimPrefix(p.Name, "@"))
-		parts = append(parts, paramName)
-	}
-	
-	// Add return code if present
-	if t.hasReturnCode {
-		parts = append(parts, "0")
-	}
-	
-	// Add error
-	parts = append(parts, "err")
-	
-	return "return " + strings.Join(parts, ", ")
+	return t.errorReturn("err")
 }
 
 // zeroValueForType returns the Go zero value for a given type.
@@ -1414,6 +1925,9 @@ func (t *transpiler) zeroValueForType(ti *typeInfo) string {
 	if ti == nil {
 		return "nil"
 	}
+	if ti.isDecimal {
+		return t.decimalZero()
+	}
 	switch ti.goType {
 	case "int32", "int16", "int64", "uint8", "int":
 		return "0"
@@ -1426,9 +1940,6 @@ func (t *transpiler) zeroValueForType(ti *typeInfo) string {
 	case "time.Time":
 		t.imports["time"] = true
 		return "time.Time{}"
-	case "decimal.Decimal":
-		t.imports["github.com/shopspring/decimal"] = true
-		return "decimal.Zero"
 	default:
 		return "nil"
 	}
@@ -1439,7 +1950,13 @@ func (t *transpiler) transpileDeclare(decl *ast.DeclareStatement) (string, error
 
 	for i, v := range decl.Variables {
 		if v.TableType != nil {
-			return "", fmt.Errorf("table variables not supported")
+			// Table variables live in tempTables alongside temp tables
+			if !t.dmlEnabled {
+				return "", fmt.Errorf("table variables not supported (use --dml)")
+			}
+			dt := &dmlTranspiler{transpiler: t, config: t.dmlConfig}
+			parts = append(parts, dt.transpileDeclareTableVariable(v))
+			continue
 		}
 
 		goType, err := t.mapDataType(v.DataType)
@@ -1450,7 +1967,7 @@ func (t *transpiler) transpileDeclare(decl *ast.DeclareStatement) (string, error
 		varName := goIdentifier(strings.TrimPrefix(v.Name, "@"))
 
 		// Record variable type in symbol table
-		t.symbols.define(varName, typeInfoFromDataType(v.DataType))
+		t.symbols.define(varName, t.typeInfoFromDataType(v.DataType))
 		// Mark as declared for unused variable tracking
 		t.symbols.markDeclared(varName)
 
@@ -1471,6 +1988,22 @@ func (t *transpiler) transpileDeclare(decl *ast.DeclareStatement) (string, error
 			typeComment = fmt.Sprintf(" // T-SQL: %s", strings.ToUpper(v.DataType.String()))
 		}
 
+		if next, ok := v.Value.(*ast.NextValueForExpression); ok {
+			if code, ok := t.transpileNextValueAssign(varName, t.symbols.lookup(varName), next); ok {
+				parts = append(parts, fmt.Sprintf("%svar %s %s%s", prefix, varName, goType, typeComment), code)
+				continue
+			}
+		}
+		if code, ok := t.transpileIdentCurrentAssign(varName, t.symbols.lookup(varName), v.Value); ok {
+			parts = append(parts, fmt.Sprintf("%svar %s %s%s", prefix, varName, goType, typeComment), code)
+			continue
+		}
+		if v.Value != nil && t.dmlEnabled {
+			if code, ok := t.assignForXML(varName, t.symbols.lookup(varName), v.Value); ok {
+				parts = append(parts, fmt.Sprintf("%svar %s %s%s", prefix, varName, goType, typeComment), code)
+				continue
+			}
+		}
 		if v.Value != nil {
 			valExpr, err := t.transpileExpression(v.Value)
 			if err != nil {
@@ -1478,6 +2011,7 @@ func (t *transpiler) transpileDeclare(decl *ast.DeclareStatement) (string, error
 			}
 			// Check if we need to convert the initialiser to match the variable's type
 			ti := t.symbols.lookup(varName)
+			valExpr = t.identityValue(ti, v.Value, valExpr)
 
 			// Handle NULL initialisation for value types
 			_, isNull := v.Value.(*ast.NullLiteral)
@@ -1492,6 +2026,9 @@ func (t *transpiler) transpileDeclare(decl *ast.DeclareStatement) (string, error
 			if ti != nil && ti.isBool && !isNull {
 				valExpr = t.ensureBool(v.Value, valExpr)
 			}
+			if !isNull {
+				valExpr = t.roundTime(ti, valExpr)
+			}
 			// Use short declaration for simple cases where type can be inferred
 			// Only use for bool and string - numeric types need explicit declaration
 			// to ensure correct types (int32 vs int, etc.)
@@ -1551,13 +2088,30 @@ func (t *transpiler) transpileSet(set *ast.SetStatement) (string, error) {
 		return t.transpileSetSubquery(set.Variable, subq, prefix)
 	}
 
-	valExpr, err := t.transpileExpression(set.Value)
+	if next, ok := set.Value.(*ast.NextValueForExpression); ok {
+		if code, ok := t.transpileNextValueAssign(varExpr, t.inferType(set.Variable), next); ok {
+			return prefix + code, nil
+		}
+	}
+
+	if code, ok := t.transpileIdentCurrentAssign(varExpr, t.inferType(set.Variable), set.Value); ok {
+		return prefix + code, nil
+	}
+
+	if t.dmlEnabled {
+		if code, ok := t.assignForXML(varExpr, t.inferType(set.Variable), set.Value); ok {
+			return prefix + code, nil
+		}
+	}
+
+	reads, valExpr, err := t.readScalars(set.Value)
 	if err != nil {
 		return "", err
 	}
 
 	// Check if we need to convert the value to match the variable's type
 	varType := t.inferType(set.Variable)
+	valExpr = t.identityValue(varType, set.Value, valExpr)
 
 	// Handle NULL assignment to value types (which can't be nil in Go)
 	_, isNull := set.Value.(*ast.NullLiteral)
@@ -1572,6 +2126,13 @@ func (t *transpiler) transpileSet(set *ast.SetStatement) (string, error) {
 	if varType != nil && varType.isBool && !isNull {
 		valExpr = t.ensureBool(set.Value, valExpr)
 	}
+	if !isNull {
+		valExpr = t.roundTime(varType, valExpr)
+	}
+
+	if varType != nil && varType.nullable {
+		return prefix + t.afterReads(reads, t.nullSet(varExpr, varType, set.Value, valExpr)), nil
+	}
 
 	// Detect SET @var = ISNULL(@var, default) pattern
 	// This pattern sets a default value when the variable is NULL (from a failed SELECT)
@@ -1611,7 +2172,7 @@ func (t *transpiler) transpileSet(set *ast.SetStatement) (string, error) {
 	// Strip unnecessary outer parentheses from RHS for cleaner assignments
 	valExpr = stripOuterParens(valExpr)
 
-	return fmt.Sprintf("%s%s = %s", prefix, varExpr, valExpr), nil
+	return prefix + t.afterReads(reads, fmt.Sprintf("%s = %s", varExpr, valExpr)), nil
 }
 
 func (t *transpiler) transpileIf(ifStmt *ast.IfStatement) (string, error) {
@@ -1623,7 +2184,7 @@ func (t *transpiler) transpileIf(ifStmt *ast.IfStatement) (string, error) {
 	
 	var out strings.Builder
 
-	cond, err := t.transpileExpression(ifStmt.Condition)
+	reads, cond, err := t.readScalars(ifStmt.Condition)
 	if err != nil {
 		return "", err
 	}
@@ -1639,6 +2200,11 @@ func (t *transpiler) transpileIf(ifStmt *ast.IfStatement) (string, error) {
 		}
 	}
 
+	if read, exists, ok := t.readExists(ifStmt.Condition, cond); ok {
+		reads, cond = []string{read}, exists
+	}
+	// Return the queries' errors rather than take the ELSE branch
+	out.WriteString(t.readChain(reads, t.buildErrorReturn()))
 	out.WriteString(fmt.Sprintf("if %s {\n", cond))
 
 	t.indent++
@@ -1760,13 +2326,17 @@ func (t *transpiler) transpileStatementBlock(stmt ast.Statement) (string, error)
 
 func (t *transpiler) transpileWhile(whileStmt *ast.WhileStatement) (string, error) {
 	// Check for WHILE @@FETCH_STATUS = 0 cursor pattern
-	if t.dmlEnabled && t.isFetchStatusCheck(whileStmt.Condition) {
+	if t.dmlEnabled && t.isFetchStatusCheck(whileStmt.Condition) && !t.isScrollCursor(t.activeCursor) {
 		return t.transpileCursorWhile(whileStmt)
 	}
+	if loop := t.retryLoopOf(whileStmt); loop != nil {
+		return t.transpileRetryLoop(loop)
+	}
+	t.warnRetryLoop(whileStmt)
 	
 	var out strings.Builder
 
-	cond, err := t.transpileExpression(whileStmt.Condition)
+	reads, cond, err := t.readScalars(whileStmt.Condition)
 	if err != nil {
 		return "", err
 	}
@@ -1782,13 +2352,43 @@ func (t *transpiler) transpileWhile(whileStmt *ast.WhileStatement) (string, erro
 		}
 	}
 
-	out.WriteString(fmt.Sprintf("for %s {\n", cond))
+	// The condition's queries are read at the top of the loop, which
+	// breaks when it's done
+	var done string
+	if read, exists, ok := t.readExists(whileStmt.Condition, cond); ok {
+		reads = []string{read}
+		var negated bool
+		if done, negated = strings.CutPrefix(exists, "!"); !negated {
+			done = "!" + exists
+		}
+	} else if len(reads) > 0 {
+		done = "!(" + cond + ")"
+	}
+	if len(reads) > 0 {
+		out.WriteString("for {\n")
+	} else {
+		out.WriteString(fmt.Sprintf("for %s {\n", cond))
+	}
 
 	t.indent++
+	out.WriteString(t.cancelCheck())
+	if len(reads) > 0 {
+		// Leave the procedure with the query's error, or in a CATCH block
+		// the loop, rather than run on
+		exit := t.buildErrorReturn()
+		if t.inCatchBlock && !t.tryCatchErrors() {
+			exit = "break"
+		}
+		ind := t.indentStr()
+		out.WriteString(ind + t.readChain(reads, exit))
+		out.WriteString(fmt.Sprintf("if %s {\n%s\tbreak\n%s}\n", done, ind, ind))
+	}
 	// Push scope for loop body
 	savedSymbols := t.symbols
 	t.symbols = t.symbols.pushScope()
+	t.loopDepth++
 	body, err := t.transpileStatementBlock(whileStmt.Body)
+	t.loopDepth--
 	if err != nil {
 		return "", err
 	}
@@ -1813,8 +2413,18 @@ func (t *transpiler) transpileWhile(whileStmt *ast.WhileStatement) (string, erro
 func (t *transpiler) transpileBlock(block *ast.BeginEndBlock) (string, error) {
 	var parts []string
 
-	for _, stmt := range block.Statements {
-		s, err := t.transpileStatement(stmt)
+	for i := 0; i < len(block.Statements); i++ {
+		var s string
+		var err error
+		if n := t.concurrentRun(block.Statements, i); n > 0 {
+			s, err = t.transpileConcurrentSelects(block.Statements[i : i+n])
+			i += n - 1
+		} else if n := t.retriedTransaction(block.Statements, i); n > 0 {
+			s, err = t.transpileRetriedTransaction(block.Statements[i : i+n])
+			i += n - 1
+		} else {
+			s, err = t.transpileStatement(block.Statements[i])
+		}
 		if err != nil {
 			return "", err
 		}
@@ -1827,6 +2437,9 @@ func (t *transpiler) transpileBlock(block *ast.BeginEndBlock) (string, error) {
 }
 
 func (t *transpiler) transpileTryCatch(tc *ast.TryCatchStatement) (string, error) {
+	if t.tryCatchErrors() {
+		return t.transpileTryCatchErrors(tc)
+	}
 	var out strings.Builder
 
 	// Add TODO marker if requested
@@ -1842,22 +2455,18 @@ func (t *transpiler) transpileTryCatch(tc *ast.TryCatchStatement) (string, error
 
 	// TRY block - set flag to handle RETURN statements correctly
 	// Push a new scope for the IIFE - variables declared here are in the IIFE scope
-	wasInTryBlock := t.inTryBlock
+	wasInTryBlock, wasInRetry := t.inTryBlock, t.inRetry
 	t.inTryBlock = true
+	t.inRetry = false
 	savedTrySymbols := t.symbols
 	t.symbols = t.symbols.pushScope()
 	
 	if tc.TryBlock != nil {
-		for _, stmt := range tc.TryBlock.Statements {
-			s, err := t.transpileStatement(stmt)
-			if err != nil {
-				return "", err
-			}
-			if s != "" {
-				out.WriteString(t.indentStr())
-				out.WriteString(s)
-				out.WriteString("\n")
-			}
+		leaveGotoScope := t.enterGotoScope(tc.TryBlock.Statements, "a TRY block with --trycatch-mode=iife; use --trycatch-mode=errors")
+		err := t.transpileStatementList(&out, tc.TryBlock.Statements)
+		leaveGotoScope()
+		if err != nil {
+			return "", err
 		}
 	}
 	
@@ -1874,7 +2483,7 @@ func (t *transpiler) transpileTryCatch(tc *ast.TryCatchStatement) (string, error
 	
 	// Pop the TRY block scope
 	t.symbols = savedTrySymbols
-	t.inTryBlock = wasInTryBlock
+	t.inTryBlock, t.inRetry = wasInTryBlock, wasInRetry
 
 	// Return nil at end of TRY block (no error)
 	out.WriteString(t.indentStr())
@@ -1884,8 +2493,22 @@ func (t *transpiler) transpileTryCatch(tc *ast.TryCatchStatement) (string, error
 	out.WriteString("}(); _tryErr != nil {\n")
 	t.indent++
 
-	// CATCH block - _tryErr contains the error
-	// Set inCatchBlock so we can handle ERROR_* functions and XML building specially
+	if err := t.transpileCatchBlock(&out, tc); err != nil {
+		return "", err
+	}
+
+	t.indent--
+	out.WriteString(t.indentStr())
+	out.WriteString("}")
+
+	return out.String(), nil
+}
+
+// transpileCatchBlock writes the statements of tc's CATCH block, in a
+// scope of their own, to out.
+func (t *transpiler) transpileCatchBlock(out *strings.Builder, tc *ast.TryCatchStatement) error {
+	// Set inCatchBlock so we can handle ERROR_* functions (which read
+	// caughtErr()) and XML building specially
 	wasInCatchBlock := t.inCatchBlock
 	t.inCatchBlock = true
 	
@@ -1897,8 +2520,8 @@ func (t *transpiler) transpileTryCatch(tc *ast.TryCatchStatement) (string, error
 	if t.dmlEnabled && t.dmlConfig.UseSPLogger {
 		t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
 		out.WriteString(t.indentStr())
-		out.WriteString(fmt.Sprintf("_spErr := tsqlruntime.CaptureError(%q, _tryErr, %s)\n",
-			t.currentProcName, t.buildParamsMap()))
+		out.WriteString(fmt.Sprintf("_spErr := tsqlruntime.CaptureError(%q, %s, %s)\n",
+			t.currentProcName, t.caughtErr(), t.buildParamsMap()))
 	}
 
 	if tc.CatchBlock != nil {
@@ -1920,7 +2543,7 @@ func (t *transpiler) transpileTryCatch(tc *ast.TryCatchStatement) (string, error
 
 			s, err := t.transpileStatement(stmt)
 			if err != nil {
-				return "", err
+				return err
 			}
 			if s != "" {
 				out.WriteString(t.indentStr())
@@ -1933,12 +2556,7 @@ func (t *transpiler) transpileTryCatch(tc *ast.TryCatchStatement) (string, error
 	// Pop the CATCH block scope
 	t.symbols = savedSymbols
 	t.inCatchBlock = wasInCatchBlock
-
-	t.indent--
-	out.WriteString(t.indentStr())
-	out.WriteString("}")
-
-	return out.String(), nil
+	return nil
 }
 
 // buildParamsMap builds a Go map literal of procedure parameters for SPLogger
@@ -2019,6 +2637,10 @@ func (t *transpiler) isXMLParameterDeclare(decl *ast.DeclareStatement) bool {
 }
 
 func (t *transpiler) transpileReturn(ret *ast.ReturnStatement) (string, error) {
+	if t.inRetry {
+		return t.retryReturn(ret)
+	}
+
 	// Inside a TRY block (error-returning IIFE), return nil to exit successfully
 	// The actual return values are set via named return parameters
 	if t.inTryBlock {
@@ -2027,7 +2649,7 @@ func (t *transpiler) transpileReturn(ret *ast.ReturnStatement) (string, error) {
 	
 	// Inside a CATCH block (after IIFE), just return to exit
 	// Cannot return values here - values are set via named return params
-	if t.inCatchBlock {
+	if t.inCatchBlock && !t.tryCatchErrors() {
 		return "return", nil
 	}
 
@@ -2047,26 +2669,20 @@ func (t *transpiler) transpileReturn(ret *ast.ReturnStatement) (string, error) {
 	return "return", nil
 }
 
-func (t *transpiler) transpilePrint(print *ast.PrintStatement) (string, error) {
-	t.imports["fmt"] = true
-
-	expr, err := t.transpileExpression(print.Expression)
-	if err != nil {
-		return "", err
-	}
-
-	return fmt.Sprintf("fmt.Println(%s)", expr), nil
-}
-
 // Transaction support
 
 func (t *transpiler) transpileBeginTransaction(s *ast.BeginTransactionStatement) (string, error) {
+	// MongoDB transactions run inside a client session, which the
+	// *mongo.Database in StoreVar can't start
+	if t.dmlEnabled && t.dmlConfig.Backend == BackendMongo {
+		return "", fmt.Errorf("--backend=mongo does not translate transactions; wrap the calls in a mongo.Session by hand")
+	}
 	t.inTransaction = true
 	
 	var out strings.Builder
 	out.WriteString("// BEGIN TRANSACTION\n")
 	out.WriteString(t.indentStr())
-	out.WriteString(fmt.Sprintf("tx, err := %s.BeginTx(ctx, nil)\n", t.dmlConfig.StoreVar))
+	out.WriteString("tx, err := " + t.beginTx(t.txOptions()) + "\n")
 	out.WriteString(t.indentStr())
 	out.WriteString("if err != nil {\n")
 	out.WriteString(t.indentStr())
@@ -2107,6 +2723,10 @@ func (t *transpiler) transpileCommitTransaction(s *ast.CommitTransactionStatemen
 }
 
 func (t *transpiler) transpileRollbackTransaction(s *ast.RollbackTransactionStatement) (string, error) {
+	// A retried transaction rolls back in its closure, where tx lives
+	if t.retriedTx && !t.inTransaction {
+		return "// ROLLBACK TRANSACTION (done by the retried transaction)", nil
+	}
 	t.inTransaction = false
 	
 	var out strings.Builder
@@ -2123,6 +2743,9 @@ func (t *transpiler) indentStr() string {
 
 // transpileRaiserror converts RAISERROR to Go error handling
 func (t *transpiler) transpileRaiserror(s *ast.RaiserrorStatement) (string, error) {
+	if informational(s) && t.dmlConfig.PrintMode == PrintDiscard {
+		return discardedPrint(s), nil
+	}
 	t.imports["fmt"] = true
 	
 	var out strings.Builder
@@ -2153,33 +2776,40 @@ func (t *transpiler) transpileRaiserror(s *ast.RaiserrorStatement) (string, erro
 		errExpr = "fmt.Errorf(" + msg + ")"
 	}
 	
-	// Build return statement with all output params
-	var parts []string
-	for _, p := range t.outputParams {
-		paramName := goIdentifier(strings.TrimPrefix(p.Name, "@"))
-		parts = append(parts, paramName)
+	// Severities up to 10 are informational: the message is printed, and
+	// the procedure carries on
+	if informational(s) {
+		message := msg
+		if len(s.Args) > 0 {
+			message = "fmt.Sprintf" + strings.TrimPrefix(errExpr, "fmt.Errorf")
+		}
+		return t.printMessage(message, true), nil
 	}
-	if t.hasReturnCode {
-		parts = append(parts, "0")
+
+	if t.tryCatchErrors() {
+		return t.raiseError(errExpr), nil
 	}
-	parts = append(parts, errExpr)
-	
-	out.WriteString("return " + strings.Join(parts, ", "))
+
+	// Build return statement with all output params
+	out.WriteString(t.errorReturn(errExpr))
 	
 	return out.String(), nil
 }
 
 // transpileThrow converts THROW to Go error handling
 func (t *transpiler) transpileThrow(s *ast.ThrowStatement) (string, error) {
-	t.imports["fmt"] = true
-	
 	var out strings.Builder
 	
+	if s.ErrorNum == nil && s.Message == nil && t.tryCatchErrors() {
+		// Rethrow the error the CATCH handles
+		return t.raiseError(t.caughtErr()) + " // THROW (rethrow)", nil
+	}
 	if s.ErrorNum == nil && s.Message == nil {
 		// THROW with no arguments - rethrow current error
 		out.WriteString("return err // THROW (rethrow)")
 	} else {
 		// THROW with arguments
+		t.imports["fmt"] = true
 		msg := "\"unknown error\""
 		if s.Message != nil {
 			var err error
@@ -2198,7 +2828,11 @@ func (t *transpiler) transpileThrow(s *ast.ThrowStatement) (string, error) {
 			}
 		}
 		
-		out.WriteString(fmt.Sprintf("return fmt.Errorf(\"error %%d: %%s\", %s, %s)", errNum, msg))
+		errExpr := fmt.Sprintf("fmt.Errorf(\"error %%d: %%s\", %s, %s)", errNum, msg)
+		if t.tryCatchErrors() {
+			return t.raiseError(errExpr), nil
+		}
+		out.WriteString("return " + errExpr)
 	}
 	
 	return out.String(), nil
@@ -2206,12 +2840,19 @@ func (t *transpiler) transpileThrow(s *ast.ThrowStatement) (string, error) {
 
 // transpileSetSubquery handles SET @var = (SELECT ...) assignments
 func (t *transpiler) transpileSetSubquery(variable ast.Expression, subq *ast.SubqueryExpression, prefix string) (string, error) {
-	t.imports["database/sql"] = true
-	
 	varExpr, err := t.transpileExpression(variable)
 	if err != nil {
 		return "", err
 	}
+	if code, ok := t.assignForXML(varExpr, t.inferType(variable), subq); ok {
+		return prefix + code, nil
+	}
+	if isForJSON(subq.Subquery) {
+		if code, ok := t.assignForJSON(varExpr, t.inferType(variable), subq.Subquery); ok {
+			return fmt.Sprintf("%s// SET from FOR JSON query\n%s%s", prefix, t.indentStr(), code), nil
+		}
+	}
+	t.imports["database/sql"] = true
 	
 	// Get variable type for proper scanning
 	varType := t.inferType(variable)
@@ -2282,9 +2923,19 @@ func (t *transpiler) transpileSubqueryExpression(subq *ast.SubqueryExpression) (
 		// This is safer because the DB might be the source of the error
 		return t.transpileErrorLoggingXML(subq.Subquery)
 	}
+	if isForXML && subq.Subquery.ForClause != nil {
+		if code, ok := t.transpileForXMLSubquery(subq); ok {
+			return code, nil
+		}
+	}
+	if isForJSON(subq.Subquery) {
+		if code, ok := t.transpileForJSON(subq.Subquery); ok {
+			return code, nil
+		}
+	}
 	
 	// Standard subquery handling - substitute variables
-	sql = stripTableHints(sql)
+	sql = t.removeTableHints(sql)
 	substitutedSQL, args := t.substituteVariablesForExists(sql)
 	
 	var argsStr string
@@ -2292,12 +2943,37 @@ func (t *transpiler) transpileSubqueryExpression(subq *ast.SubqueryExpression) (
 		argsStr = ", " + strings.Join(args, ", ")
 	}
 	
-	// Generate an anonymous function that executes and returns the result
-	return fmt.Sprintf("func() any {\n"+
-		"\t\tvar result any\n"+
-		"\t\t_ = %s.QueryRowContext(ctx, %q%s).Scan(&result)\n"+
-		"\t\treturn result\n"+
-		"\t}()", t.dmlConfig.StoreVar, substitutedSQL, argsStr), nil
+	// Call the shared runtime helper rather than emitting a closure per use.
+	// COUNT subqueries get an int64 so they can be compared directly.
+	t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+	helper, name := "Scalar", "scalar"
+	if isCountSubquery(subq.Subquery) {
+		helper, name = "ScalarInt64", "count"
+	}
+	if t.readingScalars {
+		name = t.scalarReadName(name)
+		t.scalarReads = append(t.scalarReads, fmt.Sprintf("%s, err := tsqlruntime.Read%s(ctx, %s, %q%s)",
+			name, helper, t.dmlConfig.StoreVar, substitutedSQL, argsStr))
+		return name, nil
+	}
+	return fmt.Sprintf("tsqlruntime.Query%s(ctx, %s, %q%s)", helper, t.dmlConfig.StoreVar, substitutedSQL, argsStr), nil
+}
+
+// isCountSubquery reports whether a subquery selects a single COUNT/COUNT_BIG.
+func isCountSubquery(sel *ast.SelectStatement) bool {
+	if sel == nil || len(sel.Columns) != 1 {
+		return false
+	}
+	fc, ok := sel.Columns[0].Expression.(*ast.FunctionCall)
+	if !ok {
+		return false
+	}
+	id, ok := fc.Function.(*ast.Identifier)
+	if !ok {
+		return false
+	}
+	name := strings.ToUpper(id.Value)
+	return (name == "COUNT" || name == "COUNT_BIG") && fc.Over == nil
 }
 
 // transpileErrorLoggingXML handles SELECT ... FOR XML in CATCH blocks
@@ -2402,7 +3078,7 @@ func (t *transpiler) transpileExistsExpression(exists *ast.ExistsExpression) (st
 	}
 	
 	// For gRPC backend, try to convert to a gRPC call (but not for temp tables)
-	if t.dmlEnabled && t.dmlConfig.Backend == BackendGRPC && !isTempTable(tableName) {
+	if t.dmlEnabled && t.existsBackend(tableName) == BackendGRPC {
 		if result, ok := t.tryExistsAsGRPC(exists); ok {
 			return result, nil
 		}
@@ -2413,23 +3089,167 @@ func (t *transpiler) transpileExistsExpression(exists *ast.ExistsExpression) (st
 	sql := exists.Subquery.String()
 	
 	// Strip table hints like (NOLOCK) that aren't supported by all databases
-	sql = stripTableHints(sql)
+	sql = t.removeTableHints(sql)
 	
 	// Substitute variables in the query
 	substitutedSQL, args := t.substituteVariablesForExists(sql)
 	
-	// Generate an inline function that checks if any rows exist
-	// Uses COUNT with LIMIT 1 for portability across databases
+	// Check for rows via the shared runtime helper
 	var argsStr string
 	if len(args) > 0 {
 		argsStr = ", " + strings.Join(args, ", ")
 	}
 	
-	return fmt.Sprintf("func() bool {\n"+
-		"\t\tvar exists int\n"+
-		"\t\terr := %s.QueryRowContext(ctx, \"SELECT 1 WHERE EXISTS(%s)\"%s).Scan(&exists)\n"+
-		"\t\treturn err == nil && exists == 1\n"+
-		"\t}()", t.dmlConfig.StoreVar, substitutedSQL, argsStr), nil
+	t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+	return fmt.Sprintf("tsqlruntime.QueryExists(ctx, %s, %q%s)",
+		t.dmlConfig.StoreVar, "SELECT 1 WHERE EXISTS("+substitutedSQL+")", argsStr), nil
+}
+
+// readExists returns the condition of an IF or WHILE, transpiled to cond,
+// as a statement reading the result and error of its query, e.g.
+// "exists, err := tsqlruntime.ReadExists(...)", and the test of the result,
+// "exists" or "!exists". ok is false unless the condition queriesExists
+// and runs through tsqlruntime.QueryExists, in a procedure returning an
+// error; functions have none to return.
+func (t *transpiler) readExists(condition ast.Expression, cond string) (read, exists string, ok bool) {
+	if !t.dmlEnabled || !t.hasDMLStatements || !queriesExists(condition) {
+		return "", "", false
+	}
+	not := ""
+	if strings.HasPrefix(cond, "!") {
+		not = "!"
+	}
+	call, isCall := strings.CutPrefix(strings.TrimPrefix(cond, not), "tsqlruntime.QueryExists(")
+	if !isCall || !strings.HasSuffix(call, ")") {
+		return "", "", false
+	}
+	name := "exists"
+	for n := 2; t.symbols.isDeclared(name); n++ {
+		name = fmt.Sprintf("exists%d", n)
+	}
+	return fmt.Sprintf("%s, err := tsqlruntime.ReadExists(%s", name, call), not + name, true
+}
+
+// readScalars transpiles expr, the condition of an IF or WHILE or the value
+// of a SET, with its scalar subqueries read ahead of it so their errors can
+// be returned. reads are the statements reading them, e.g.
+// "count, err := tsqlruntime.ReadScalarInt64(...)", and code is expr using
+// the values read. There are no reads outside procedures returning an
+// error; functions have none to return.
+func (t *transpiler) readScalars(expr ast.Expression) (reads []string, code string, err error) {
+	if !t.dmlEnabled || !t.hasDMLStatements {
+		code, err = t.transpileExpression(expr)
+		return nil, code, err
+	}
+	t.readingScalars, t.scalarReads = true, nil
+	code, err = t.transpileExpression(expr)
+	reads = t.scalarReads
+	t.readingScalars, t.scalarReads = false, nil
+	return reads, code, err
+}
+
+// scalarReadName returns a name for the value of a scalar subquery read by
+// readScalars, unused by the procedure and the reads before it.
+func (t *transpiler) scalarReadName(base string) string {
+	name := base
+	for n := 2; ; n++ {
+		taken := t.symbols.isDeclared(name) || t.symbols.lookup(name) != nil
+		for _, read := range t.scalarReads {
+			taken = taken || strings.HasPrefix(read, name+", ")
+		}
+		if !taken {
+			return name
+		}
+		name = fmt.Sprintf("%s%d", base, n)
+	}
+}
+
+// readChain returns reads, statements reading a value and err, as the
+// start of an if-else chain leaving with exit on the first error, e.g.
+// "if count, err := ...; err != nil {\n\treturn err\n} else ", for the
+// caller to end with its own if or block. It returns "" for no reads.
+func (t *transpiler) readChain(reads []string, exit string) string {
+	ind := t.indentStr()
+	var out strings.Builder
+	for _, read := range reads {
+		out.WriteString(fmt.Sprintf("if %s; err != nil {\n%s\t%s\n%s} else ", read, ind, exit, ind))
+	}
+	return out.String()
+}
+
+// afterReads returns stmt as the block ending the if-else chain of reads
+// (see readChain), where it can use the values read.
+func (t *transpiler) afterReads(reads []string, stmt string) string {
+	if len(reads) == 0 {
+		return stmt
+	}
+	ind := t.indentStr()
+	return fmt.Sprintf("%s{\n%s\t%s\n%s}", t.readChain(reads, t.buildErrorReturn()), ind, strings.ReplaceAll(stmt, "\n", "\n\t"), ind)
+}
+
+// queriesSubquery reports whether expr has a subquery, which runs as a
+// query whose error a procedure returns.
+func queriesSubquery(expr ast.Expression) bool {
+	switch e := expr.(type) {
+	case *ast.SubqueryExpression, *ast.ExistsExpression:
+		return true
+	case *ast.InExpression:
+		if e.Subquery != nil {
+			return true
+		}
+		for _, v := range e.Values {
+			if queriesSubquery(v) {
+				return true
+			}
+		}
+		return queriesSubquery(e.Expr)
+	case *ast.InfixExpression:
+		return queriesSubquery(e.Left) || queriesSubquery(e.Right)
+	case *ast.PrefixExpression:
+		return queriesSubquery(e.Right)
+	case *ast.BetweenExpression:
+		return queriesSubquery(e.Expr) || queriesSubquery(e.Low) || queriesSubquery(e.High)
+	case *ast.IsNullExpression:
+		return queriesSubquery(e.Expr)
+	case *ast.CastExpression:
+		return queriesSubquery(e.Expression)
+	case *ast.ConvertExpression:
+		return queriesSubquery(e.Expression)
+	case *ast.FunctionCall:
+		for _, arg := range e.Arguments {
+			if queriesSubquery(arg) {
+				return true
+			}
+		}
+	case *ast.MethodCallExpression:
+		return queriesSubquery(e.Object)
+	case *ast.CaseExpression:
+		if e.Operand != nil && queriesSubquery(e.Operand) {
+			return true
+		}
+		for _, when := range e.WhenClauses {
+			if queriesSubquery(when.Condition) || queriesSubquery(when.Result) {
+				return true
+			}
+		}
+		return e.ElseClause != nil && queriesSubquery(e.ElseClause)
+	}
+	return false
+}
+
+// queriesExists reports whether condition, of an IF or WHILE, is [NOT]
+// EXISTS or IN over a subquery, so its query's error can be returned.
+func queriesExists(condition ast.Expression) bool {
+	if p, ok := condition.(*ast.PrefixExpression); ok && strings.EqualFold(p.Operator, "NOT") {
+		condition = p.Right
+	}
+	switch e := condition.(type) {
+	case *ast.ExistsExpression:
+		return true
+	case *ast.InExpression:
+		return e.Subquery != nil
+	}
+	return false
 }
 
 // recordTempTableUsed adds a temp table to the tracking list (deduped).
@@ -2442,6 +3262,18 @@ func (t *transpiler) recordTempTableUsed(name string) {
 	t.tempTablesUsed = append(t.tempTablesUsed, name)
 }
 
+// existsBackend returns the backend an EXISTS subquery on tableName is
+// checked against. Unrouted temp tables always stay in SQL.
+func (t *transpiler) existsBackend(tableName string) BackendType {
+	if backend, ok := lookupTableBackend(t.dmlConfig.TableToBackend, tableName); ok {
+		return backend
+	}
+	if isTempTable(tableName) {
+		return BackendSQL
+	}
+	return t.dmlConfig.Backend
+}
+
 // tryExistsAsGRPC attempts to convert EXISTS to a gRPC call.
 // Returns the code and true if successful, empty and false otherwise.
 func (t *transpiler) tryExistsAsGRPC(exists *ast.ExistsExpression) (string, bool) {
@@ -2568,6 +3400,9 @@ func (t *transpiler) extractExistsWhereFields(expr ast.Expression) []struct{ col
 
 // substituteVariablesForExists replaces @variables with placeholders and returns args
 func (t *transpiler) substituteVariablesForExists(sql string) (string, []string) {
+	// Scalar UDF calls evaluated in Go become @markers bound like variables
+	sql, hoisted := t.rewriteUDFCallsInSQL(sql)
+	
 	var args []string
 	paramIndex := 0
 	
@@ -2600,7 +3435,11 @@ func (t *transpiler) substituteVariablesForExists(sql string) (string, []string)
 			result = append(result, placeholder...)
 			
 			// Add to args
-			args = append(args, goIdentifier(varName))
+			if goExpr, ok := hoisted[strings.ToLower(varName)]; ok {
+				args = append(args, goExpr)
+			} else {
+				args = append(args, goIdentifier(varName))
+			}
 			i = j
 		} else {
 			result = append(result, sql[i])
@@ -2625,10 +3464,12 @@ func getPlaceholderForDialect(dialect string, n int) string {
 	}
 }
 
+// tableHintPattern matches the table hints stripTableHints removes.
+const tableHintPattern = `(?i)\b(NOLOCK|READUNCOMMITTED|READCOMMITTED|REPEATABLEREAD|SERIALIZABLE|ROWLOCK|PAGLOCK|TABLOCK|TABLOCKX|UPDLOCK|XLOCK|HOLDLOCK|NOWAIT|READPAST)\b`
+
 // stripTableHints removes SQL Server table hints like (NOLOCK), WITH (NOLOCK), WITH (NOLOCK, ROWLOCK), etc.
 func stripTableHints(sql string) string {
-	// Common table hints - these will be matched case-insensitively
-	hintPattern := `(?i)\b(NOLOCK|READUNCOMMITTED|READCOMMITTED|REPEATABLEREAD|SERIALIZABLE|ROWLOCK|PAGLOCK|TABLOCK|TABLOCKX|UPDLOCK|XLOCK|HOLDLOCK|NOWAIT|READPAST)\b`
+	hintPattern := tableHintPattern
 	
 	// Pattern 1: WITH (hint) or WITH (hint1, hint2, ...)
 	// Matches: WITH (NOLOCK), WITH (NOLOCK, ROWLOCK), WITH ( NOLOCK , ROWLOCK )
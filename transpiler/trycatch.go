@@ -0,0 +1,207 @@
+package transpiler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// TRY/CATCH
+//
+// DMLConfig.TryCatchMode says what TRY/CATCH becomes. TryCatchIIFE (the
+// default) runs the TRY block in a closure returning its error, and the
+// CATCH when it isn't nil (see transpileTryCatch). RETURN in the TRY
+// block then only leaves the closure, BREAK and CONTINUE can't reach the
+// loop around it, and the CATCH can't return the error it handles.
+//
+// TryCatchErrors writes the TRY block inline, in a block of its own, and
+// each statement that fails records its error and jumps to the CATCH:
+//
+//	// BEGIN TRY
+//	var tx *sql.Tx
+//	var tryErr1 error
+//	{
+//		if _, err := r.db.ExecContext(ctx, ...); err != nil {
+//			tryErr1 = err
+//			goto catch1
+//		}
+//	}
+//	catch1:
+//	if tryErr1 != nil {
+//		// BEGIN CATCH
+//		...
+//	}
+//
+// Declarations at the top of the TRY block are made before it, as the
+// block is only there so the gotos don't jump over them: the CATCH can
+// roll back a transaction the TRY began, and use its variables, as
+// T-SQL's procedure-wide variables allow.
+//
+// RETURN, BREAK and CONTINUE in the TRY block work as written, errors in
+// the CATCH jump to the CATCH of an enclosing TRY or return from the
+// procedure, and THROW there returns the error handled. Statements that
+// run in closures of their own, such as retried transactions, return
+// their error from the closure and jump where the closure is called.
+const (
+	TryCatchIIFE   = "iife"
+	TryCatchErrors = "errors"
+)
+
+// tryCatchErrors reports whether TRY/CATCH is written inline.
+func (t *transpiler) tryCatchErrors() bool {
+	return t.dmlEnabled && t.dmlConfig.TryCatchMode == TryCatchErrors
+}
+
+// caughtErr returns the variable holding the error the CATCH being
+// transpiled handles.
+func (t *transpiler) caughtErr() string {
+	if t.tryErrVar != "" {
+		return t.tryErrVar
+	}
+	return "_tryErr"
+}
+
+// catchExit returns the statements recording errExpr and jumping to the
+// CATCH of the TRY block being transpiled, the second at ind, or false
+// outside one.
+func (t *transpiler) catchExit(errExpr, ind string) (string, bool) {
+	if t.catchLabel == "" {
+		return "", false
+	}
+	t.catchJumped = true
+	return fmt.Sprintf("%s = %s\n%sgoto %s", t.catchErrVar, errExpr, ind, t.catchLabel), true
+}
+
+// errorReturn returns the statement returning errExpr from the procedure.
+func (t *transpiler) errorReturn(errExpr string) string {
+	var parts []string
+	for _, p := range t.outputParams {
+		parts = append(parts, goIdentifier(strings.TrimPrefix(p.Name, "@")))
+	}
+	if t.hasReturnCode {
+		parts = append(parts, "0")
+	}
+	parts = append(parts, errExpr)
+	return "return " + strings.Join(parts, ", ")
+}
+
+// raiseError returns the statement raising errExpr, for THROW and
+// RAISERROR: a jump to the CATCH, or a return from the procedure.
+func (t *transpiler) raiseError(errExpr string) string {
+	if exit, ok := t.catchExit(errExpr, t.indentStr()); ok {
+		return exit
+	}
+	return t.errorReturn(errExpr)
+}
+
+// hoistTryDeclarations returns body, a TRY block written inline, with
+// the declarations at its top level made assignments, and the
+// declarations to make before the block. outer is the scope around the
+// block, whose variables need no declaring; the variables hoisted are
+// added to it. Declarations of unknown types stay in the block.
+func (t *transpiler) hoistTryDeclarations(body string, outer *symbolTable) (string, []string) {
+	depth := t.indentStr()
+	lines := strings.Split(body, "\n")
+	var hoisted []string
+	for i, line := range lines {
+		stmt, ok := strings.CutPrefix(line, depth)
+		if !ok || !declaration.MatchString(stmt) {
+			continue
+		}
+		decls, assign, ok := t.hoistDeclaration(stmt)
+		if !ok {
+			continue
+		}
+		for _, decl := range decls {
+			name := strings.Fields(decl)[1]
+			if outer.isDeclared(name) {
+				continue
+			}
+			hoisted = append(hoisted, decl)
+			if ti := t.symbols.lookup(name); ti != nil {
+				outer.define(name, ti)
+			}
+			outer.markDeclared(name)
+			outer.markUsed(name) // Used, or given a _ = in the block
+		}
+		if assign == "" {
+			lines[i] = ""
+		} else {
+			lines[i] = depth + assign
+		}
+	}
+	var kept []string
+	for _, line := range lines {
+		// Hoisted declarations without values leave nothing behind
+		if line != "" || len(kept) > 0 && kept[len(kept)-1] != "" {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\n"), hoisted
+}
+
+// transpileTryCatchErrors writes TRY/CATCH inline, with errors in the TRY
+// block jumping to the CATCH.
+func (t *transpiler) transpileTryCatchErrors(tc *ast.TryCatchStatement) (string, error) {
+	t.tryCount++
+	label := fmt.Sprintf("catch%d", t.tryCount)
+	errVar := fmt.Sprintf("tryErr%d", t.tryCount)
+	ind := t.indentStr()
+
+	var body strings.Builder
+	t.indent++
+
+	outerLabel, outerErrVar, outerJumped := t.catchLabel, t.catchErrVar, t.catchJumped
+	wasInTryBlock := t.inTryBlock
+	t.catchLabel, t.catchErrVar, t.catchJumped = label, errVar, false
+	t.inTryBlock = false
+	savedTrySymbols := t.symbols
+	t.symbols = t.symbols.pushScope()
+
+	if tc.TryBlock != nil {
+		if err := t.transpileStatementList(&body, tc.TryBlock.Statements); err != nil {
+			return "", err
+		}
+	}
+	if unusedVars := t.symbols.getUnusedVars(); len(unusedVars) > 0 {
+		body.WriteString(t.indentStr() + "// Unused variables in this scope\n")
+		for _, varName := range unusedVars {
+			body.WriteString(t.indentStr() + fmt.Sprintf("_ = %s\n", varName))
+		}
+	}
+	tryBody, hoisted := t.hoistTryDeclarations(body.String(), savedTrySymbols)
+
+	var out strings.Builder
+	out.WriteString("// BEGIN TRY\n")
+	for _, decl := range hoisted {
+		out.WriteString(ind + decl + "\n")
+	}
+	out.WriteString(fmt.Sprintf("%svar %s error\n", ind, errVar))
+	out.WriteString(ind + "{\n")
+	out.WriteString(tryBody)
+
+	t.symbols = savedTrySymbols
+	jumped := t.catchJumped
+	t.catchLabel, t.catchErrVar, t.catchJumped = outerLabel, outerErrVar, outerJumped
+	t.inTryBlock = wasInTryBlock
+	t.indent--
+	out.WriteString(ind + "}\n")
+	// Unused labels don't compile; used ones are outdented, as gofmt does
+	if jumped {
+		out.WriteString(strings.TrimPrefix(ind, "\t") + label + ":\n")
+	}
+
+	out.WriteString(fmt.Sprintf("%sif %s != nil {\n", ind, errVar))
+	t.indent++
+	out.WriteString(t.indentStr() + "// BEGIN CATCH\n")
+	outerTryErr := t.tryErrVar
+	t.tryErrVar = errVar
+	if err := t.transpileCatchBlock(&out, tc); err != nil {
+		return "", err
+	}
+	t.tryErrVar = outerTryErr
+	t.indent--
+	out.WriteString(ind + "}")
+	return out.String(), nil
+}
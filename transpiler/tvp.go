@@ -0,0 +1,519 @@
+package transpiler
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ha1tch/tsqlparser"
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// Table-valued parameters
+//
+// A procedure parameter of a user-defined table type
+//
+//	CREATE TYPE dbo.OrderItemList AS TABLE (ProductID INT NOT NULL, ...)
+//	CREATE PROCEDURE usp_AddOrderItems @OrderID INT, @Items dbo.OrderItemList READONLY
+//
+// becomes a slice of a struct generated from the type, items
+// []OrderItemList. The type comes from a CREATE TYPE in the source or in
+// DMLConfig.TableTypes (--schema). Statements reading the parameter run
+// through tsqlruntime, which expands FROM @Items into unnest() on postgres
+// and into batched rows elsewhere:
+//
+//	result, err := tsqlruntime.ExecTableParams(ctx, r.db, tsqlruntime.DialectPostgres, "INSERT ... FROM @Items",
+//		[]tsqlruntime.TableParam{orderItemListParam("Items", items)}, orderID)
+//
+// With the gRPC backend an INSERT ... SELECT FROM @Items sends the rows as
+// one request with a repeated message field.
+
+// TableType is a user-defined table type (CREATE TYPE ... AS TABLE).
+type TableType struct {
+	Name    string // As declared, e.g. dbo.OrderItemList
+	Columns []TableTypeColumn
+}
+
+// TableTypeColumn is a column of a table type.
+type TableTypeColumn struct {
+	Name     string
+	Type     *ast.DataType
+	Nullable bool
+}
+
+// TableTypes returns the table types declared with CREATE TYPE ... AS
+// TABLE in source. Other statements are ignored, so a full schema script
+// can be passed as is.
+func TableTypes(source string) ([]TableType, error) {
+	program, errors := tsqlparser.Parse(stripGoStatements(source))
+	if len(errors) > 0 {
+		return nil, fmt.Errorf("parse errors:\n%s", strings.Join(errors, "\n"))
+	}
+	return tableTypesIn(program), nil
+}
+
+// tableTypesIn is TableTypes for a parsed program.
+func tableTypesIn(program *ast.Program) []TableType {
+	if program == nil {
+		return nil
+	}
+	var types []TableType
+	for _, stmt := range program.Statements {
+		if create, ok := stmt.(*ast.CreateTypeStatement); ok && create.IsTableType && create.TableDef != nil {
+			types = append(types, tableTypeFromStatement(create))
+		}
+	}
+	return types
+}
+
+func tableTypeFromStatement(s *ast.CreateTypeStatement) TableType {
+	tt := TableType{Name: s.Name.String()}
+	for _, col := range s.TableDef.Columns {
+		nullable := col.Nullable == nil || *col.Nullable
+		for _, c := range col.Constraints {
+			if c.IsPrimaryKey || c.Type == ast.ConstraintPrimaryKey {
+				nullable = false
+			}
+		}
+		tt.Columns = append(tt.Columns, TableTypeColumn{Name: col.Name.Value, Type: col.DataType, Nullable: nullable})
+	}
+	return tt
+}
+
+// GenerateTableTypes returns Go source declaring the struct and the
+// TableParam function of each of types, for a types file shared by the
+// files of a package (--types-file). Code transpiled with the types in
+// DMLConfig.TableTypes and their names in DMLConfig.DeclaredTableTypes
+// uses them without declaring them again.
+func GenerateTableTypes(types []TableType, packageName string, config DMLConfig) (string, error) {
+	t := newTranspiler()
+	t.packageName = packageName
+	t.dmlConfig = config
+	t.dmlEnabled = true
+	t.tableTypes = map[string]*TableType{}
+	t.declaredTableTypes = map[string]bool{}
+	var decls []string
+	for i := range types {
+		t.tableTypes[strings.ToLower(unqualifiedName(types[i].Name))] = &types[i]
+		decl, err := t.declareTableType(&types[i])
+		if err != nil {
+			return "", err
+		}
+		if decl != "" {
+			decls = append(decls, decl)
+		}
+	}
+
+	var out strings.Builder
+	writeScaffoldHeader(&out, packageName, t.imports)
+	out.WriteString(strings.Join(decls, "\n\n"))
+	out.WriteString("\n")
+	return out.String(), nil
+}
+
+// tableParam is a procedure parameter of a table type.
+type tableParam struct {
+	name  string // Without the @
+	goVar string
+	typ   *TableType
+}
+
+// collectTableTypes merges the configured table types with the ones
+// created in the source being transpiled. Keys are lower-cased names
+// without the schema.
+func (t *transpiler) collectTableTypes(program *ast.Program) {
+	t.tableTypes = map[string]*TableType{}
+	t.declaredTableTypes = map[string]bool{}
+	t.addTableTypes(t.dmlConfig.TableTypes)
+	t.addTableTypes(tableTypesIn(program))
+	for _, name := range t.dmlConfig.DeclaredTableTypes {
+		t.declaredTableTypes[strings.ToLower(unqualifiedName(name))] = true
+	}
+}
+
+func (t *transpiler) addTableTypes(types []TableType) {
+	for i := range types {
+		t.tableTypes[strings.ToLower(unqualifiedName(types[i].Name))] = &types[i]
+	}
+}
+
+// lookupTableType returns the table type a data type names, if any.
+func (t *transpiler) lookupTableType(dt *ast.DataType) (*TableType, bool) {
+	if dt == nil || t.tableTypes == nil {
+		return nil, false
+	}
+	tt, ok := t.tableTypes[strings.ToLower(unqualifiedName(dt.Name))]
+	return tt, ok
+}
+
+// tableTypeGoName returns the name of the struct generated for a table type.
+func tableTypeGoName(tt *TableType) string {
+	return goExportedIdentifier(unqualifiedName(tt.Name))
+}
+
+// useTableType returns the Go type of a parameter of table type tt,
+// marking the type as needing a declaration in this file.
+func (t *transpiler) useTableType(tt *TableType) string {
+	key := strings.ToLower(unqualifiedName(tt.Name))
+	if !t.declaredTableTypes[key] && !t.pendingTableTypes[key] {
+		if t.pendingTableTypes == nil {
+			t.pendingTableTypes = map[string]bool{}
+		}
+		t.pendingTableTypes[key] = true
+	}
+	return "[]" + tableTypeGoName(tt)
+}
+
+// transpileCreateTableType declares the struct for a CREATE TYPE ... AS
+// TABLE, unless an earlier procedure already needed it.
+func (t *transpiler) transpileCreateTableType(s *ast.CreateTypeStatement) (string, error) {
+	tt, ok := t.tableTypes[strings.ToLower(unqualifiedName(s.Name.String()))]
+	if !ok {
+		return "", fmt.Errorf("CREATE TYPE %s: table type not collected", s.Name)
+	}
+	return t.declareTableType(tt)
+}
+
+// declareTableType returns the struct for a table type and the function
+// that turns a slice of it into a tsqlruntime.TableParam, once per file.
+func (t *transpiler) declareTableType(tt *TableType) (string, error) {
+	key := strings.ToLower(unqualifiedName(tt.Name))
+	if t.declaredTableTypes[key] {
+		return "", nil
+	}
+	t.declaredTableTypes[key] = true
+	delete(t.pendingTableTypes, key)
+	t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+
+	name := tableTypeGoName(tt)
+	width := 0
+	for _, col := range tt.Columns {
+		width = max(width, len(goExportedIdentifier(col.Name)))
+	}
+	var fields, columns, types, values []string
+	for _, col := range tt.Columns {
+		goType, err := t.mapDataType(col.Type)
+		if err != nil {
+			return "", fmt.Errorf("table type %s, column %s: %w", tt.Name, col.Name, err)
+		}
+		if col.Nullable {
+			switch {
+			case t.nullable(goType):
+				goType = t.nullType(goType)
+			case t.dmlConfig.NullMode == "":
+				goType = "*" + goType
+			}
+		}
+		field := goExportedIdentifier(col.Name)
+		fields = append(fields, fmt.Sprintf("\t%-*s %s", width, field, goType))
+		columns = append(columns, strconv.Quote(col.Name))
+		types = append(types, strconv.Quote(postgresType(col.Type)))
+		values = append(values, "row."+field)
+	}
+
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("// %s is a row of the %s table type.\n", name, tt.Name))
+	out.WriteString(fmt.Sprintf("type %s struct {\n%s\n}\n\n", name, strings.Join(fields, "\n")))
+	out.WriteString(fmt.Sprintf("// %s passes rows as the table-valued parameter @name.\n", tableParamFunc(tt)))
+	out.WriteString(fmt.Sprintf("func %s(name string, rows []%s) tsqlruntime.TableParam {\n", tableParamFunc(tt), name))
+	out.WriteString("\tp := tsqlruntime.TableParam{\n")
+	out.WriteString("\t\tName:    name,\n")
+	out.WriteString(fmt.Sprintf("\t\tColumns: []string{%s},\n", strings.Join(columns, ", ")))
+	out.WriteString(fmt.Sprintf("\t\tTypes:   []string{%s},\n", strings.Join(types, ", ")))
+	out.WriteString("\t}\n")
+	out.WriteString("\tfor _, row := range rows {\n")
+	out.WriteString(fmt.Sprintf("\t\tp.Rows = append(p.Rows, []interface{}{%s})\n", strings.Join(values, ", ")))
+	out.WriteString("\t}\n")
+	out.WriteString("\treturn p\n")
+	out.WriteString("}")
+	return out.String(), nil
+}
+
+// declarePendingTableTypes declares the table types procedures used
+// without a CREATE TYPE in this file, in name order.
+func (t *transpiler) declarePendingTableTypes() ([]string, error) {
+	var decls []string
+	for _, key := range sortedKeys(t.pendingTableTypes) {
+		decl, err := t.declareTableType(t.tableTypes[key])
+		if err != nil {
+			return nil, err
+		}
+		decls = append(decls, decl)
+	}
+	return decls, nil
+}
+
+// tableParamFunc returns the name of the function converting rows of tt.
+func tableParamFunc(tt *TableType) string {
+	return goUnexportedIdentifier(unqualifiedName(tt.Name)) + "Param"
+}
+
+// postgresType returns the postgres type unnest() reads a column as.
+func postgresType(dt *ast.DataType) string {
+	switch strings.ToUpper(dt.Name) {
+	case "TINYINT", "SMALLINT":
+		return "smallint"
+	case "INT", "INTEGER":
+		return "integer"
+	case "BIGINT":
+		return "bigint"
+	case "REAL":
+		return "real"
+	case "FLOAT":
+		return "double precision"
+	case "DECIMAL", "NUMERIC":
+		if dt.Precision != nil && dt.Scale != nil {
+			return fmt.Sprintf("numeric(%d,%d)", *dt.Precision, *dt.Scale)
+		}
+		return "numeric"
+	case "MONEY", "SMALLMONEY":
+		return "numeric(19,4)"
+	case "BIT":
+		return "boolean"
+	case "DATE":
+		return "date"
+	case "TIME":
+		return "time"
+	case "DATETIME", "DATETIME2", "SMALLDATETIME":
+		return "timestamp"
+	case "DATETIMEOFFSET":
+		return "timestamptz"
+	case "UNIQUEIDENTIFIER":
+		return "uuid"
+	case "BINARY", "VARBINARY", "IMAGE":
+		return "bytea"
+	default:
+		return "text"
+	}
+}
+
+// addTableParam records a procedure parameter of table type tt.
+func (t *transpiler) addTableParam(p *ast.ParameterDef, tt *TableType) {
+	if t.tableParams == nil {
+		t.tableParams = map[string]*tableParam{}
+	}
+	name := strings.TrimPrefix(p.Name, "@")
+	t.tableParams[strings.ToLower(name)] = &tableParam{name: name, goVar: goIdentifier(name), typ: tt}
+}
+
+// tableParamFor returns the table-valued parameter a table name refers
+// to, if any.
+func (t *transpiler) tableParamFor(table string) (*tableParam, bool) {
+	if !strings.HasPrefix(table, "@") {
+		return nil, false
+	}
+	p, ok := t.tableParams[strings.ToLower(strings.TrimPrefix(table, "@"))]
+	return p, ok
+}
+
+// selectTableParam returns the table-valued parameter a SELECT reads
+// first, if any.
+func (dt *dmlTranspiler) selectTableParam(s *ast.SelectStatement) (*tableParam, bool) {
+	if s == nil || s.From == nil {
+		return nil, false
+	}
+	for _, ref := range s.From.Tables {
+		for _, name := range tableRefNames(ref) {
+			if p, ok := dt.tableParamFor(name); ok {
+				return p, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// tableRefNames returns the table names in a table reference and its joins.
+func tableRefNames(ref ast.TableReference) []string {
+	switch r := ref.(type) {
+	case *ast.TableName:
+		if r.Name != nil && len(r.Name.Parts) > 0 {
+			return []string{r.Name.Parts[len(r.Name.Parts)-1].Value}
+		}
+	case *ast.JoinClause:
+		return append(tableRefNames(r.Left), tableRefNames(r.Right)...)
+	}
+	return nil
+}
+
+// readsTableParam returns the first table-valued parameter stmt reads, if
+// any. They can only be read as tables, so any reference is a read.
+func (t *transpiler) readsTableParam(stmt ast.Statement) (*tableParam, bool) {
+	if len(t.tableParams) == 0 {
+		return nil, false
+	}
+	sql := stmt.String()
+	for _, key := range t.tableParamKeys() {
+		p := t.tableParams[key]
+		if tableParamRefRe(p.name).MatchString(sql) {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// tableParamBackendError returns an error when stmt reads a table-valued
+// parameter but goes to a backend that can't read it. An INSERT ... SELECT
+// on the gRPC backend is handled by transpileInsertTableParamGRPC.
+func (dt *dmlTranspiler) tableParamBackendError(stmt ast.Statement, backend BackendType) error {
+	switch backend {
+	case BackendGRPC, BackendMock, BackendMongo, BackendRedis, BackendInline:
+	default:
+		return nil
+	}
+	p, ok := dt.readsTableParam(stmt)
+	if !ok {
+		return nil
+	}
+	return fmt.Errorf("%s reads table-valued parameter @%s, which needs the SQL backend, not %s",
+		truncateSQL(stmt.String(), 60), p.name, backend)
+}
+
+// tableParamKeys returns the keys of the current procedure's table-valued
+// parameters, sorted.
+func (t *transpiler) tableParamKeys() []string {
+	keys := make([]string, 0, len(t.tableParams))
+	for key := range t.tableParams {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// tableParamRefRe matches a reference to the table-valued parameter name
+// in SQL, but not a longer variable or an @@ name.
+func tableParamRefRe(name string) *regexp.Regexp {
+	return regexp.MustCompile(`(?i)(^|[^@\w])@` + regexp.QuoteMeta(name) + `\b`)
+}
+
+// bindsTableParams reports whether the next statement's queries may read
+// table-valued parameters. Statements are rewritten once, at the outermost
+// level.
+func (t *transpiler) bindsTableParams() bool {
+	return t.dmlEnabled && len(t.tableParams) > 0 && t.inProcBody && !t.inTableParamStatement
+}
+
+// tableParamQueryRe matches a database/sql call with a literal query,
+// capturing the store, the method, the context and the query.
+var tableParamQueryRe = regexp.MustCompile(`\b([\w.]+)\.(ExecContext|QueryContext|QueryRowContext)\((ctx|stmtCtx), ("(?:[^"\\]|\\.)*")`)
+
+// transpileTableParamStatement transpiles stmt, running the queries that
+// read table-valued parameters through tsqlruntime.
+func (t *transpiler) transpileTableParamStatement(stmt ast.Statement) (string, error) {
+	t.inTableParamStatement = true
+	code, err := t.transpileStatement(stmt)
+	t.inTableParamStatement = false
+	if err != nil {
+		return code, err
+	}
+	return tableParamQueryRe.ReplaceAllStringFunc(code, func(call string) string {
+		m := tableParamQueryRe.FindStringSubmatch(call)
+		query, err := strconv.Unquote(m[4])
+		if err != nil {
+			return call
+		}
+		var params []string
+		for _, key := range t.tableParamKeys() {
+			p := t.tableParams[key]
+			if tableParamRefRe(p.name).MatchString(query) {
+				params = append(params, fmt.Sprintf("%s(%q, %s)", tableParamFunc(p.typ), p.name, p.goVar))
+				t.symbols.markUsed(p.goVar)
+			}
+		}
+		if len(params) == 0 {
+			return call
+		}
+		t.imports["github.com/ha1tch/tgpiler/tsqlruntime"] = true
+		method := strings.TrimSuffix(m[2], "Context") + "TableParams"
+		return fmt.Sprintf("tsqlruntime.%s(%s, %s, %s, %s, []tsqlruntime.TableParam{%s}",
+			method, m[3], m[1], runtimeDialect(t.dmlConfig.SQLDialect), m[4], strings.Join(params, ", "))
+	}), nil
+}
+
+// transpileInsertTableParamGRPC sends the rows of INSERT ... SELECT FROM
+// @tvp as one request, with a repeated message holding the columns read
+// from the parameter. Other SELECT columns become request fields.
+func (dt *dmlTranspiler) transpileInsertTableParamGRPC(s *ast.InsertStatement, p *tableParam) (string, error) {
+	dt.symbols.markUsed(p.goVar)
+	return dt.transpileInsertRowsGRPC(s, "@"+p.name, p.goVar, "row", func(expr ast.Expression) (string, bool, error) {
+		column, ok := tableParamColumn(expr, p)
+		return "row." + goExportedIdentifier(column), ok, nil
+	})
+}
+
+// transpileInsertRowsGRPC sends the rows of an INSERT ... SELECT as one
+// request: a message per element of rows, with the columns rowValue reads
+// from the row, and the other SELECT columns as request fields.
+func (dt *dmlTranspiler) transpileInsertRowsGRPC(s *ast.InsertStatement, source, rows, rowVar string, rowValue func(ast.Expression) (string, bool, error)) (string, error) {
+	tableName := dt.extractInsertTable(s)
+	if len(s.Columns) == 0 || !selectColumnsMatch(s.Select, len(s.Columns)) {
+		return "", fmt.Errorf("INSERT INTO %s ... SELECT FROM %s needs a column list matching the SELECT for the gRPC backend", tableName, source)
+	}
+
+	entity := toPascalCase(singularize(unqualifiedName(tableName)))
+	methodName := "Create" + toPascalCase(unqualifiedName(tableName))
+	clientVar := dt.getGRPCClientForTable(tableName)
+	protoPackage := dt.getProtoPackageForTable(tableName)
+	prefix := ""
+	if protoPackage != "" {
+		prefix = protoPackage + "."
+	}
+	msgsVar := rows + "Msgs"
+
+	var rowFields, requestFields []string
+	for i, col := range s.Columns {
+		field := goExportedIdentifier(col.Value)
+		expr := s.Select.Columns[i].Expression
+		value, ok, err := rowValue(expr)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			rowFields = append(rowFields, fmt.Sprintf("%s: %s", field, value))
+		} else {
+			requestFields = append(requestFields, fmt.Sprintf("%s: %s", field, dt.exprToGoValue(expr)))
+		}
+	}
+
+	ind := dt.indentStr()
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("// gRPC call: %s.%s, one %s per row of %s\n", clientVar, methodName, entity, source))
+	out.WriteString(ind + fmt.Sprintf("%s := make([]*%s%s, 0, len(%s))\n", msgsVar, prefix, entity, rows))
+	out.WriteString(ind + fmt.Sprintf("for _, %s := range %s {\n", rowVar, rows))
+	out.WriteString(ind + fmt.Sprintf("\t%s = append(%s, &%s%s{%s})\n", msgsVar, msgsVar, prefix, entity, strings.Join(rowFields, ", ")))
+	out.WriteString(ind + "}\n")
+	out.WriteString(ind + fmt.Sprintf("_, err = %s.%s(ctx, &%s%sRequest{\n", clientVar, methodName, prefix, methodName))
+	for _, f := range requestFields {
+		out.WriteString(ind + "\t" + f + ",\n")
+	}
+	out.WriteString(ind + fmt.Sprintf("\t%s: %s,\n", toPascalCase(unqualifiedName(tableName)), msgsVar))
+	out.WriteString(ind + "})\n")
+	out.WriteString(ind + "if err != nil {\n")
+	out.WriteString(ind + "\t" + dt.buildErrorReturn() + "\n")
+	out.WriteString(ind + "}")
+	return out.String(), nil
+}
+
+// tableParamColumn returns the column of p an expression reads, if it is
+// a plain column reference.
+func tableParamColumn(expr ast.Expression, p *tableParam) (string, bool) {
+	var name string
+	switch e := expr.(type) {
+	case *ast.Identifier:
+		name = e.Value
+	case *ast.QualifiedIdentifier:
+		if len(e.Parts) == 0 {
+			return "", false
+		}
+		name = e.Parts[len(e.Parts)-1].Value
+	default:
+		return "", false
+	}
+	for _, col := range p.typ.Columns {
+		if strings.EqualFold(col.Name, name) {
+			return col.Name, true
+		}
+	}
+	return "", false
+}
@@ -3,6 +3,8 @@ package transpiler
 import (
 	"fmt"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/ha1tch/tsqlparser/ast"
 )
@@ -30,10 +32,9 @@ func (t *transpiler) mapDataType(dt *ast.DataType) (string, error) {
 	case "REAL", "FLOAT":
 		return "float64", nil
 
-	// Exact numeric types (use shopspring/decimal)
+	// Exact numeric types (see decimal.go)
 	case "DECIMAL", "NUMERIC", "MONEY", "SMALLMONEY":
-		t.imports["github.com/shopspring/decimal"] = true
-		return "decimal.Decimal", nil
+		return t.useDecimalType(), nil
 
 	// String types
 	case "CHAR", "VARCHAR", "TEXT", "NCHAR", "NVARCHAR", "NTEXT", "SYSNAME":
@@ -59,8 +60,13 @@ func (t *transpiler) mapDataType(dt *ast.DataType) (string, error) {
 		return "string", nil
 	case "SQL_VARIANT":
 		return "any", nil
+	case "GEOMETRY", "GEOGRAPHY", "HIERARCHYID":
+		return "string", nil // WKT, EWKT or a path (see spatial.go)
 
 	default:
+		if tt, ok := t.lookupTableType(dt); ok {
+			return t.useTableType(tt), nil
+		}
 		return "", fmt.Errorf("unsupported data type: %s", dt.Name)
 	}
 }
@@ -75,10 +81,11 @@ func sanitiseIdentifier(name string) string {
 	name = strings.TrimPrefix(name, "[")
 	name = strings.TrimSuffix(name, "]")
 
-	// Replace invalid characters with underscore
+	// Replace invalid characters with underscore. Go identifiers may hold
+	// any Unicode letter, so accented names such as Dirección are kept.
 	var result strings.Builder
 	for i, r := range name {
-		if r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (i > 0 && r >= '0' && r <= '9') {
+		if r == '_' || unicode.IsLetter(r) || (i > 0 && unicode.IsDigit(r)) {
 			result.WriteRune(r)
 		} else {
 			result.WriteRune('_')
@@ -146,10 +153,10 @@ func splitOnCaseTransition(s string) []string {
 
 		// Transition: uppercase -> lowercase in a run of uppercase
 		// "HTTPServer" -> at 'e', we need to break before 'S'
-		if prevUpper && !currUpper && current.Len() > 1 {
+		if prevUpper && !currUpper && utf8.RuneCountInString(current.String()) > 1 {
 			// Move the last character to the new word
 			str := current.String()
-			words = append(words, str[:len(str)-1])
+			words = append(words, strings.TrimSuffix(str, string(runes[i-1])))
 			current.Reset()
 			current.WriteRune(runes[i-1])
 		}
@@ -165,25 +172,19 @@ func splitOnCaseTransition(s string) []string {
 }
 
 func isUpper(r rune) bool {
-	return r >= 'A' && r <= 'Z'
+	return unicode.IsUpper(r)
 }
 
 func isLower(r rune) bool {
-	return r >= 'a' && r <= 'z'
+	return unicode.IsLower(r)
 }
 
 func toLowerRune(r rune) rune {
-	if isUpper(r) {
-		return r + 32
-	}
-	return r
+	return unicode.ToLower(r)
 }
 
 func toUpperRune(r rune) rune {
-	if isLower(r) {
-		return r - 32
-	}
-	return r
+	return unicode.ToUpper(r)
 }
 
 // toPascalCase converts a word to PascalCase (first letter uppercase, rest lowercase).
@@ -196,13 +197,13 @@ func wordToPascal(word string) string {
 	return string(runes)
 }
 
-// goExportedIdentifier converts a T-SQL identifier to an exported Go identifier (PascalCase).
-// Use for procedure names and other public API elements.
+// exportedIdentifier converts a T-SQL identifier to an exported Go identifier (PascalCase).
+// It's the default Namer's; call sites use goExportedIdentifier (see naming.go).
 // Examples:
 //   - "calculate_total" -> "CalculateTotal"
 //   - "CALCULATE_TOTAL" -> "CalculateTotal"
 //   - "calculateTotal"  -> "CalculateTotal"
-func goExportedIdentifier(name string) string {
+func exportedIdentifier(name string) string {
 	name = sanitiseIdentifier(name)
 	if name == "" {
 		return ""
@@ -225,16 +226,21 @@ func goExportedIdentifier(name string) string {
 		out = "_" + out
 	}
 
+	// Letters without case (e.g. CJK) can't start an exported identifier
+	if first := []rune(out)[0]; unicode.IsLetter(first) && !unicode.IsUpper(first) {
+		out = "X" + out
+	}
+
 	return out
 }
 
-// goUnexportedIdentifier converts a T-SQL identifier to an unexported Go identifier (camelCase).
-// Use for parameters, local variables, and other internal elements.
+// unexportedIdentifier converts a T-SQL identifier to an unexported Go identifier (camelCase).
+// It's the default Namer's; call sites use goUnexportedIdentifier (see naming.go).
 // Examples:
 //   - "calculate_total" -> "calculateTotal"
 //   - "CALCULATE_TOTAL" -> "calculateTotal"
 //   - "CalculateTotal"  -> "calculateTotal"
-func goUnexportedIdentifier(name string) string {
+func unexportedIdentifier(name string) string {
 	name = sanitiseIdentifier(name)
 	if name == "" {
 		return ""
@@ -0,0 +1,342 @@
+package transpiler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// Scalar UDF handling modes for calls embedded in SQL queries.
+//
+// A query such as SELECT ... WHERE Tax > dbo.fn_CalcTax(@Amount) is passed
+// to the database verbatim, which stops working once fn_CalcTax has been
+// transpiled to Go and dropped from the schema.
+const (
+	// UDFModeKeep leaves the call in the SQL text and records a warning.
+	UDFModeKeep = "keep"
+	// UDFModeCompute evaluates the call in Go and binds the result as a
+	// query parameter. Calls whose arguments reference columns cannot be
+	// hoisted out of the query and fall back to keep.
+	UDFModeCompute = "compute"
+)
+
+// udfPlaceholderPrefix marks a hoisted UDF call in rewritten SQL text so the
+// variable substitution pass binds it like any other @variable.
+const udfPlaceholderPrefix = "TgpilerUDF"
+
+// udfModeFor returns the configured mode for a scalar UDF, honouring
+// per-function overrides keyed by the unqualified function name.
+func (t *transpiler) udfModeFor(name string) string {
+	for fn, mode := range t.dmlConfig.UDFOverrides {
+		if strings.EqualFold(unqualifiedName(fn), name) {
+			return mode
+		}
+	}
+	if t.dmlConfig.UDFMode != "" {
+		return t.dmlConfig.UDFMode
+	}
+	return UDFModeKeep
+}
+
+// isScalarUDF reports whether a function call inside a query targets a
+// user-defined function: one declared in the same source, or one named in
+// UDFOverrides, which is how functions transpiled from other files are
+// declared. Other calls, schema-qualified or not, are left to the database.
+func (t *transpiler) isScalarUDF(name string) bool {
+	if _, ok := t.userFunctions[strings.ToLower(name)]; ok {
+		return true
+	}
+	for fn := range t.dmlConfig.UDFOverrides {
+		if strings.EqualFold(unqualifiedName(fn), name) {
+			return true
+		}
+	}
+	return false
+}
+
+// udfGoName returns the Go function a scalar UDF transpiles to, named as
+// transpileCreateFunction names it.
+func (t *transpiler) udfGoName(name string) string {
+	if udf, ok := t.userFunctions[strings.ToLower(name)]; ok {
+		return udf.goName
+	}
+	return goIdentifier(name)
+}
+
+// warnUDF records a once-per-procedure warning about a UDF kept in SQL.
+func (t *transpiler) warnUDF(name, reason string) {
+	key := t.currentProcName + "\x00" + strings.ToLower(name)
+	if t.udfWarned == nil {
+		t.udfWarned = make(map[string]bool)
+	}
+	if t.udfWarned[key] {
+		return
+	}
+	t.udfWarned[key] = true
+	t.warnings = append(t.warnings, fmt.Sprintf("%s: scalar UDF %s %s", t.currentProcName, name, reason))
+}
+
+// hoistUDFCall decides how a UDF call found in a query is handled. It
+// returns the Go expression to bind as a parameter, or false if the call
+// must stay in the SQL text.
+func (t *transpiler) hoistUDFCall(name string, goArgs []string, computable bool) (string, bool) {
+	if t.udfModeFor(name) != UDFModeCompute {
+		t.warnUDF(name, "kept in SQL; it must exist in the target database (use --udf-mode=compute to evaluate it in Go)")
+		return "", false
+	}
+	if !computable {
+		t.warnUDF(name, "references columns and cannot be evaluated in Go; kept in SQL")
+		return "", false
+	}
+	return fmt.Sprintf("%s(%s)", t.udfGoName(name), strings.Join(goArgs, ", ")), true
+}
+
+// tryHoistUDFExpr handles a UDF call node while building SQL from the AST.
+// Only variables and literals can be evaluated ahead of the query.
+func (dt *dmlTranspiler) tryHoistUDFExpr(expr ast.Expression) (string, bool) {
+	var name string
+	var args []ast.Expression
+	switch e := expr.(type) {
+	case *ast.FunctionCall:
+		switch fn := e.Function.(type) {
+		case *ast.Identifier:
+			name = fn.Value
+		case *ast.QualifiedIdentifier:
+			if len(fn.Parts) == 0 {
+				return "", false
+			}
+			name = fn.Parts[len(fn.Parts)-1].Value
+		}
+		args = e.Arguments
+	case *ast.MethodCallExpression:
+		if _, ok := e.Object.(*ast.Identifier); !ok {
+			return "", false
+		}
+		name, args = e.MethodName, e.Arguments
+	default:
+		return "", false
+	}
+	if name == "" || !dt.isScalarUDF(name) {
+		return "", false
+	}
+
+	computable := true
+	var goArgs []string
+	for _, arg := range args {
+		if dt.exprContainsColumnRef(arg) {
+			computable = false
+			break
+		}
+		goArg, err := dt.transpileExpression(arg)
+		if err != nil {
+			computable = false
+			break
+		}
+		goArgs = append(goArgs, goArg)
+	}
+	return dt.hoistUDFCall(name, goArgs, computable)
+}
+
+// rewriteUDFCallsInSQL scans query text for scalar UDF calls. Calls that
+// are evaluated in Go are replaced by @TgpilerUDFn markers; the returned map
+// gives the Go expression for each marker (keyed in lower case).
+func (t *transpiler) rewriteUDFCallsInSQL(sql string) (string, map[string]string) {
+	var out strings.Builder
+	var hoisted map[string]string
+	inQuote := false
+
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		if c == '\'' {
+			inQuote = !inQuote
+			out.WriteByte(c)
+			i++
+			continue
+		}
+		startsIdent := isAlphaForCTE(c) || c == '_' || c == '['
+		if inQuote || !startsIdent || (i > 0 && (isAlphaNumForCTE(sql[i-1]) || sql[i-1] == '_' || sql[i-1] == '@' || sql[i-1] == '#')) {
+			out.WriteByte(c)
+			i++
+			continue
+		}
+
+		parts, end := scanQualifiedName(sql, i)
+		open := end
+		for open < len(sql) && sql[open] == ' ' {
+			open++
+		}
+		if len(parts) == 0 || open >= len(sql) || sql[open] != '(' {
+			out.WriteString(sql[i:end])
+			i = end
+			continue
+		}
+
+		name := parts[len(parts)-1]
+		closeIdx := matchingParen(sql, open)
+		if closeIdx < 0 || !t.isScalarUDF(name) {
+			out.WriteString(sql[i:end])
+			i = end
+			continue
+		}
+
+		goArgs, computable := t.udfArgsFromSQL(sql[open+1 : closeIdx])
+		goExpr, ok := t.hoistUDFCall(name, goArgs, computable)
+		if !ok {
+			out.WriteString(sql[i:end])
+			i = end
+			continue
+		}
+		if hoisted == nil {
+			hoisted = make(map[string]string)
+		}
+		t.udfHoistCount++
+		marker := fmt.Sprintf("%s%d", udfPlaceholderPrefix, t.udfHoistCount)
+		hoisted[strings.ToLower(marker)] = goExpr
+		out.WriteString("@" + marker)
+		i = closeIdx + 1
+	}
+	return out.String(), hoisted
+}
+
+// udfArgsFromSQL converts the argument list of a UDF call in SQL text into
+// Go expressions. Only @variables and literals are computable.
+func (t *transpiler) udfArgsFromSQL(argList string) ([]string, bool) {
+	var goArgs []string
+	for _, raw := range splitTopLevelCommas(argList) {
+		arg := strings.TrimSpace(raw)
+		switch {
+		case arg == "":
+			continue
+		case strings.HasPrefix(arg, "@") && !strings.HasPrefix(arg, "@@") && isSimpleSQLName(arg[1:]):
+			goVar := goIdentifier(arg[1:])
+			t.symbols.markUsed(goVar)
+			goArgs = append(goArgs, goVar)
+		case isNumericSQLLiteral(arg):
+			goArgs = append(goArgs, arg)
+		case len(arg) >= 2 && strings.HasSuffix(arg, "'") && (strings.HasPrefix(arg, "'") || strings.HasPrefix(arg, "N'")):
+			lit := strings.TrimPrefix(arg, "N")
+			lit = strings.ReplaceAll(lit[1:len(lit)-1], "''", "'")
+			goArgs = append(goArgs, fmt.Sprintf("%q", lit))
+		default:
+			return nil, false
+		}
+	}
+	return goArgs, true
+}
+
+// scanQualifiedName reads a possibly bracketed, dot-separated name starting
+// at pos and returns its parts and the index just past it.
+func scanQualifiedName(s string, pos int) ([]string, int) {
+	var parts []string
+	i := pos
+	for i < len(s) {
+		if s[i] == '[' {
+			end := strings.IndexByte(s[i:], ']')
+			if end < 0 {
+				break
+			}
+			parts = append(parts, s[i+1:i+end])
+			i += end + 1
+		} else if isAlphaForCTE(s[i]) || s[i] == '_' {
+			start := i
+			for i < len(s) && (isAlphaNumForCTE(s[i]) || s[i] == '_') {
+				i++
+			}
+			parts = append(parts, s[start:i])
+		} else {
+			break
+		}
+		if i < len(s) && s[i] == '.' {
+			i++
+			continue
+		}
+		break
+	}
+	if len(parts) == 0 {
+		return nil, pos + 1
+	}
+	return parts, i
+}
+
+// matchingParen returns the index of the ')' closing the '(' at open,
+// ignoring parentheses inside string literals, or -1.
+func matchingParen(s string, open int) int {
+	depth := 0
+	inQuote := false
+	for i := open; i < len(s); i++ {
+		switch {
+		case s[i] == '\'':
+			inQuote = !inQuote
+		case inQuote:
+		case s[i] == '(':
+			depth++
+		case s[i] == ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// splitTopLevelCommas splits on commas outside parentheses and quotes.
+func splitTopLevelCommas(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	inQuote := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\'':
+			inQuote = !inQuote
+		case inQuote:
+		case s[i] == '(':
+			depth++
+		case s[i] == ')':
+			depth--
+		case s[i] == ',' && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func isSimpleSQLName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isAlphaNumForCTE(s[i]) && s[i] != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+func isNumericSQLLiteral(s string) bool {
+	s = strings.TrimPrefix(s, "-")
+	if s == "" {
+		return false
+	}
+	seenDot := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] >= '0' && s[i] <= '9':
+		case s[i] == '.' && !seenDot:
+			seenDot = true
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// unqualifiedName strips any schema prefix (dbo.fn_X -> fn_X).
+func unqualifiedName(name string) string {
+	if idx := strings.LastIndex(name, "."); idx >= 0 {
+		return name[idx+1:]
+	}
+	return name
+}
@@ -0,0 +1,105 @@
+package transpiler
+
+import (
+	"strings"
+	"testing"
+)
+
+const udfQuerySQL = `
+CREATE PROCEDURE dbo.GetTaxedOrders
+    @Amount DECIMAL(10,2)
+AS
+BEGIN
+    SELECT OrderID, Total
+    FROM Orders
+    WHERE Tax > dbo.fn_CalcTax(@Amount) AND Code = dbo.fn_Code(Total)
+END
+`
+
+func TestScalarUDFInQuery_Keep(t *testing.T) {
+	config := DefaultDMLConfig()
+	config.UDFOverrides = map[string]string{"fn_CalcTax": UDFModeKeep, "fn_Code": UDFModeKeep}
+
+	result, err := TranspileWithDMLEx(udfQuerySQL, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDMLEx failed: %v", err)
+	}
+
+	if !strings.Contains(result.Code, "Tax > dbo.fn_CalcTax($1)") {
+		t.Errorf("Expected UDF call kept in SQL, got:\n%s", result.Code)
+	}
+	if len(result.Warnings) != 2 || !strings.Contains(result.Warnings[0], "fn_CalcTax kept in SQL") {
+		t.Errorf("Expected a keep warning per UDF, got: %v", result.Warnings)
+	}
+}
+
+func TestScalarUDFInQuery_Compute(t *testing.T) {
+	config := DefaultDMLConfig()
+	config.UDFMode = UDFModeCompute
+	// Declared in other files
+	config.UDFOverrides = map[string]string{"dbo.fn_CalcTax": UDFModeCompute, "fn_Code": UDFModeCompute}
+
+	result, err := TranspileWithDMLEx(udfQuerySQL, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDMLEx failed: %v", err)
+	}
+
+	// Named as CREATE FUNCTION names the function it declares
+	if !strings.Contains(result.Code, `"SELECT OrderID, Total FROM Orders WHERE ((Tax > $1) AND (Code = dbo.fn_Code(Total)))", fnCalcTax(amount))`) {
+		t.Errorf("Expected fn_CalcTax evaluated in Go, got:\n%s", result.Code)
+	}
+	// fn_Code takes a column and has to stay in the query
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "fn_Code references columns") {
+		t.Errorf("Expected a column-reference warning for fn_Code, got: %v", result.Warnings)
+	}
+}
+
+func TestScalarUDFInQuery_Override(t *testing.T) {
+	config := DefaultDMLConfig()
+	config.UDFMode = UDFModeCompute
+	config.UDFOverrides = map[string]string{"dbo.fn_CalcTax": UDFModeKeep}
+
+	result, err := TranspileWithDMLEx(udfQuerySQL, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDMLEx failed: %v", err)
+	}
+
+	if !strings.Contains(result.Code, "dbo.fn_CalcTax($1)") {
+		t.Errorf("Expected override to keep fn_CalcTax in SQL, got:\n%s", result.Code)
+	}
+}
+
+func TestScalarUDFInQuery_Undeclared(t *testing.T) {
+	config := DefaultDMLConfig()
+	config.UDFMode = UDFModeCompute
+
+	result, err := TranspileWithDMLEx(udfQuerySQL, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDMLEx failed: %v", err)
+	}
+	// Schema-qualified calls aren't UDFs unless declared
+	if !strings.Contains(result.Code, "Tax > dbo.fn_CalcTax($1)") || len(result.Warnings) != 0 {
+		t.Errorf("Expected undeclared functions left in SQL without warnings, got %v:\n%s", result.Warnings, result.Code)
+	}
+}
+
+func TestScalarUDFInQuery_SameSource(t *testing.T) {
+	config := DefaultDMLConfig()
+	config.UDFMode = UDFModeCompute
+	source := `CREATE FUNCTION dbo.fn_CalcTax (@Amount DECIMAL(10,2))
+RETURNS DECIMAL(10,2)
+AS
+BEGIN
+    RETURN @Amount * 0.2
+END
+GO
+` + udfQuerySQL
+
+	result, err := TranspileWithDMLEx(source, "main", config)
+	if err != nil {
+		t.Fatalf("TranspileWithDMLEx failed: %v", err)
+	}
+	if !strings.Contains(result.Code, "func fnCalcTax(") || !strings.Contains(result.Code, "fnCalcTax(amount))") {
+		t.Errorf("Expected the call to use the declared fnCalcTax, got:\n%s", result.Code)
+	}
+}
@@ -0,0 +1,147 @@
+package transpiler
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// Per-dialect SQL
+//
+// Some statements have no translation every dialect accepts, full-text
+// search being the usual one. A tgpiler:dialect comment ahead of such a
+// statement gives the SQL to run in its place on one dialect, in a line
+// comment or a block comment that may span lines:
+//
+//	-- tgpiler:dialect postgres SELECT Id FROM Docs WHERE to_tsvector(Body) @@ plainto_tsquery(@Term)
+//	/* tgpiler:dialect mysql
+//	   SELECT Id FROM Docs WHERE MATCH (Body) AGAINST (@Term) */
+//	SELECT Id FROM Docs WHERE CONTAINS(Body, @Term)
+//
+// Generating for a dialect with a variant runs its SQL as written, with
+// the variables bound as parameters; other dialects get the statement's
+// own translation. The T-SQL statement still decides what is done with
+// the results, so a variant returns the same columns in the same order.
+
+// dialectPragma starts a comment giving a statement's SQL for a dialect.
+const dialectPragma = "tgpiler:dialect"
+
+var dialectPragmaRe = regexp.MustCompile(`(?is)^tgpiler:dialect\s+(\w+)\s+(.+)$`)
+
+// variantDialects are the dialects a variant can be given for.
+var variantDialects = map[string]bool{"postgres": true, "mysql": true, "sqlite": true, "sqlserver": true}
+
+// collectDialectVariants returns the tgpiler:dialect variants in source,
+// by the line of the statement they precede and then by dialect.
+func collectDialectVariants(source string) map[int]map[string]string {
+	variants := make(map[int]map[string]string)
+	if !strings.Contains(source, dialectPragma) {
+		return variants
+	}
+	pending := make(map[string]string)
+	lines := strings.Split(source, "\n")
+	for i := 0; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		var comment string
+		switch {
+		case trimmed == "":
+			continue
+		case strings.HasPrefix(trimmed, "--"):
+			comment = trimmed[2:]
+		case strings.HasPrefix(trimmed, "/*"):
+			text := trimmed[2:]
+			for !strings.Contains(text, "*/") && i+1 < len(lines) {
+				i++
+				text += "\n" + lines[i]
+			}
+			comment, _, _ = strings.Cut(text, "*/")
+		default:
+			if len(pending) > 0 {
+				variants[i+1] = pending
+				pending = make(map[string]string)
+			}
+			continue
+		}
+		if m := dialectPragmaRe.FindStringSubmatch(strings.TrimSpace(comment)); m != nil {
+			pending[strings.ToLower(m[1])] = joinLines(m[2])
+		}
+	}
+	return variants
+}
+
+// joinLines puts SQL written over several lines on one.
+func joinLines(sql string) string {
+	var parts []string
+	for _, line := range strings.Split(sql, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			parts = append(parts, line)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// statementLine returns the line a statement that runs SQL starts on, or 0.
+func statementLine(stmt ast.Statement) int {
+	switch s := stmt.(type) {
+	case *ast.SelectStatement:
+		return s.Token.Line
+	case *ast.InsertStatement:
+		return s.Token.Line
+	case *ast.UpdateStatement:
+		return s.Token.Line
+	case *ast.DeleteStatement:
+		return s.Token.Line
+	case *ast.WithStatement:
+		return s.Token.Line
+	}
+	return 0
+}
+
+// dialectVariant returns the SQL a tgpiler:dialect comment gives stmt for
+// the target dialect, if any. Variants for dialects tgpiler doesn't know
+// are warned about once and dropped.
+func (t *transpiler) dialectVariant(stmt ast.Statement) (string, bool) {
+	if !t.dmlEnabled || stmt == t.variantStatement {
+		return "", false
+	}
+	variants := t.dialectVariants[statementLine(stmt)]
+	if len(variants) == 0 {
+		return "", false
+	}
+	var unknown []string
+	for dialect := range variants {
+		if !variantDialects[dialect] {
+			unknown = append(unknown, dialect)
+			delete(variants, dialect)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		t.warnings = append(t.warnings, fmt.Sprintf("%s: %s %s: unknown dialect, expected postgres, mysql, sqlite or sqlserver",
+			t.currentProcName, dialectPragma, strings.Join(unknown, ", ")))
+	}
+	sql, ok := variants[t.dmlConfig.SQLDialect]
+	return sql, ok
+}
+
+// transpileDialectVariant transpiles stmt with its query replaced by sql,
+// the variant for the target dialect.
+func (t *transpiler) transpileDialectVariant(stmt ast.Statement, sql string) (string, error) {
+	outerStmt, outerSQL := t.variantStatement, t.variantSQL
+	t.variantStatement, t.variantSQL = stmt, sql
+	code, err := t.transpileStatement(stmt)
+	unused := t.variantSQL != ""
+	t.variantStatement, t.variantSQL = outerStmt, outerSQL
+	if err != nil {
+		return "", err
+	}
+	if unused {
+		t.warnings = append(t.warnings, fmt.Sprintf("%s: %s %s for %s is unused: the statement doesn't run SQL on this backend",
+			t.currentProcName, dialectPragma, t.dmlConfig.SQLDialect, truncateSQL(stmt.String(), 60)))
+		return code, nil
+	}
+	return fmt.Sprintf("// SQL for %s from %s\n%s%s", t.dmlConfig.SQLDialect, dialectPragma, t.indentStr(), code), nil
+}
@@ -0,0 +1,199 @@
+package transpiler
+
+import (
+	"fmt"
+	"go/token"
+	"regexp"
+	"strings"
+)
+
+// Action verbs
+//
+// gRPC and mock method names take a verb from the columns, values and
+// variables of a statement: an UPDATE of Orders setting ApprovalStatus
+// calls ApproveOrder. The verbs are actionVerbs, which are English and
+// general; a verbs file (--verbs-file) adds a domain's verbs and removes
+// misleading ones:
+//
+//	# verbs.yaml
+//	add:
+//	  - Liquidate: liquidate, liquidated, liquidating, liquidation
+//	  - Amortize
+//	remove:
+//	  - Sign
+//
+// It is read as a naming config is (see naming.go).
+//
+// An added verb is found as any of its forms, or its name in lower case
+// without them, and is tried before the built-in verbs. The procedure
+// mapper (--show-mappings) recognises the same verbs in procedure and
+// method names.
+
+// ActionVerb is a verb for method names, and the forms of it that identify
+// it in column, value and variable names.
+type ActionVerb struct {
+	Verb  string   // As in method names: Approve
+	Forms []string // Lower case: approve, approved, approving, approval
+}
+
+// VerbsConfig is a parsed verbs file.
+type VerbsConfig struct {
+	Add    []ActionVerb
+	Remove []string // Verbs, matched without regard to case
+}
+
+// actionVerbs are the built-in verbs, in priority order (longer/more
+// specific patterns first, so "deactivate" is matched before "activate").
+var actionVerbs = []ActionVerb{
+	// Compound verbs first (to avoid substring issues)
+	{"Countersign", []string{"countersign", "countersigned", "countersigning"}},
+	{"Deactivate", []string{"deactivate", "deactivated", "deactivating", "deactivation"}},
+	{"Acknowledge", []string{"acknowledge", "acknowledged", "acknowledging", "acknowledgment", "acknowledgement"}},
+
+	// Approval workflow verbs
+	{"Approve", []string{"approve", "approved", "approving", "approval"}},
+	{"Reject", []string{"reject", "rejected", "rejecting", "rejection"}},
+	{"Certify", []string{"certify", "certified", "certifying", "certification"}},
+	{"Attest", []string{"attest", "attested", "attesting", "attestation"}},
+	{"Review", []string{"review", "reviewed", "reviewing"}},
+	{"Assess", []string{"assess", "assessed", "assessing", "assessment"}},
+	{"Audit", []string{"audit", "audited", "auditing"}},
+	{"Authorize", []string{"authorize", "authorized", "authorizing", "authorization"}},
+	{"Grant", []string{"grant", "granted", "granting"}},
+	{"Deny", []string{"deny", "denied", "denying", "denial"}},
+	{"Escalate", []string{"escalate", "escalated", "escalating", "escalation"}},
+	{"Delegate", []string{"delegate", "delegated", "delegating", "delegation"}},
+
+	// Lifecycle verbs
+	{"Suspend", []string{"suspend", "suspended", "suspending", "suspension"}},
+	{"Resume", []string{"resume", "resumed", "resuming"}},
+	{"Cancel", []string{"cancel", "cancelled", "canceled", "cancelling", "canceling", "cancellation"}},
+	{"Terminate", []string{"terminate", "terminated", "terminating", "termination"}},
+	{"Complete", []string{"complete", "completed", "completing", "completion"}},
+	{"Finalize", []string{"finalize", "finalized", "finalizing", "finalization"}},
+	{"Activate", []string{"activate", "activated", "activating", "activation"}},
+
+	// Communication verbs
+	{"Notify", []string{"notify", "notified", "notifying", "notification"}},
+	{"Alert", []string{"alert", "alerted", "alerting"}},
+
+	// Signing verbs
+	{"Sign", []string{"sign", "signed", "signing", "signature"}},
+
+	// Calculation verbs
+	{"Calculate", []string{"calculate", "calculated", "calculating", "calculation"}},
+	{"Compute", []string{"compute", "computed", "computing", "computation"}},
+	{"Estimate", []string{"estimate", "estimated", "estimating", "estimation"}},
+
+	// Validation verbs
+	{"Validate", []string{"validate", "validated", "validating", "validation"}},
+	{"Verify", []string{"verify", "verified", "verifying", "verification"}},
+
+	// Transfer verbs
+	{"Transfer", []string{"transfer", "transferred", "transferring"}},
+	{"Submit", []string{"submit", "submitted", "submitting", "submission"}},
+}
+
+var verbForm = regexp.MustCompile(`^[a-z]+$`)
+
+// ParseVerbs parses a verbs file: lines "add:" and "remove:" starting a
+// section, and indented lines in it, "Verb" or "Verb: form, form" to add
+// and "Verb" to remove, each optionally a list item ("- Verb"). Lines
+// starting with # are comments.
+func ParseVerbs(source string) (VerbsConfig, error) {
+	var config VerbsConfig
+	section := ""
+	for n, line := range strings.Split(source, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if line[0] != ' ' && line[0] != '\t' {
+			if trimmed != "add:" && trimmed != "remove:" {
+				return VerbsConfig{}, fmt.Errorf("line %d: expected \"add:\" or \"remove:\", got %q", n+1, trimmed)
+			}
+			section = strings.TrimSuffix(trimmed, ":")
+			continue
+		}
+		verb, forms, hasForms := strings.Cut(listItem(trimmed), ":")
+		verb = strings.TrimSpace(verb)
+		if !token.IsIdentifier(verb) || !token.IsExported(verb) {
+			return VerbsConfig{}, fmt.Errorf("line %d: %q is not a verb in PascalCase", n+1, verb)
+		}
+		switch section {
+		case "":
+			return VerbsConfig{}, fmt.Errorf("line %d: %s is not in a section", n+1, verb)
+		case "remove":
+			if hasForms {
+				return VerbsConfig{}, fmt.Errorf("line %d: %s: removed verbs have no forms", n+1, verb)
+			}
+			config.Remove = append(config.Remove, verb)
+		case "add":
+			v := ActionVerb{Verb: verb}
+			if hasForms {
+				for _, form := range strings.Split(forms, ",") {
+					form = strings.TrimSpace(form)
+					if !verbForm.MatchString(form) {
+						return VerbsConfig{}, fmt.Errorf("line %d: %s: form %q is not lower-case letters", n+1, verb, form)
+					}
+					v.Forms = append(v.Forms, form)
+				}
+			} else {
+				v.Forms = []string{strings.ToLower(verb)}
+			}
+			config.Add = append(config.Add, v)
+		}
+	}
+	return config, nil
+}
+
+// Verbs returns the verbs config adds, for the procedure mapper.
+func (c VerbsConfig) Verbs() []string {
+	var verbs []string
+	for _, v := range c.Add {
+		verbs = append(verbs, v.Verb)
+	}
+	return verbs
+}
+
+// actionVerbTable returns the verbs with config applied: those it adds,
+// then the built-in ones it doesn't remove.
+func actionVerbTable(config VerbsConfig) []ActionVerb {
+	removed := map[string]bool{}
+	for _, v := range config.Remove {
+		removed[strings.ToLower(v)] = true
+	}
+	var verbs []ActionVerb
+	for _, v := range append(append([]ActionVerb{}, config.Add...), actionVerbs...) {
+		if !removed[strings.ToLower(v.Verb)] {
+			verbs = append(verbs, v)
+		}
+	}
+	return verbs
+}
+
+// actionVerb is extractActionVerb with the verbs of DMLConfig.Verbs.
+func (dt *dmlTranspiler) actionVerb(name string) string {
+	if dt.actionVerbs == nil {
+		dt.actionVerbs = actionVerbTable(dt.config.Verbs)
+	}
+	return matchActionVerb(name, dt.actionVerbs)
+}
+
+// extractActionVerb detects business process verbs in identifiers.
+// Returns the verb in PascalCase if found, empty string otherwise.
+func extractActionVerb(name string) string {
+	return matchActionVerb(name, actionVerbs)
+}
+
+func matchActionVerb(name string, verbs []ActionVerb) string {
+	nameLower := strings.ToLower(name)
+	for _, v := range verbs {
+		for _, form := range v.Forms {
+			if strings.Contains(nameLower, form) {
+				return v.Verb
+			}
+		}
+	}
+	return ""
+}
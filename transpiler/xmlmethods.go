@@ -0,0 +1,637 @@
+package transpiler
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ha1tch/tsqlparser/ast"
+)
+
+// XML methods and OPENXML
+//
+// The methods of the xml type become calls to the tsqlruntime/xmlfn
+// package, which parses documents with encoding/xml and evaluates the
+// XPath subset procedures use:
+//
+//	@Doc.value('(/Order/@id)[1]', 'INT')  ->  int32 parsed from xmlfn.Value(doc, "(/Order/@id)[1]")
+//	@Doc.exist('/Order/Line') = 1         ->  xmlfn.Exist(doc, "/Order/Line")
+//
+// A SELECT or INSERT ... SELECT reading @Doc.nodes('/Order/Line') AS
+// T(c), or OPENXML(@h, '/Order/Line', flags) WITH (...), is shredded in
+// Go whatever the backend, since the document is a Go string: each node
+// is a row, T.c.value(...) and the WITH columns are read from it, and
+// the rows are assigned to the SELECT's variables or inserted one at a
+// time (with gRPC, sent as one request). sp_xml_preparedocument parses the
+// document into the Go variable OPENXML reads, which leaves
+// sp_xml_removedocument nothing to do.
+
+const xmlfnImport = "github.com/ha1tch/tgpiler/tsqlruntime/xmlfn"
+
+// xmlColumn is a column of an OPENXML WITH clause, read from the node
+// being shredded.
+type xmlColumn struct {
+	code string
+	typ  *ast.DataType
+}
+
+// xmlRowSource is the nodes() or OPENXML a SELECT reads its rows from.
+type xmlRowSource struct {
+	label   string // As written, for comments and errors
+	nodes   string // Go statement declaring nodesVar (and err)
+	check   bool   // Whether the statement returns an error to check
+	nodeVar string
+	aliases []string // Lower-cased names the node is referred to by
+	columns []*ast.OpenJsonColumn
+	flags   int64
+}
+
+var xmlNodesFunction = regexp.MustCompile(`(?i)^@([\w@#$]+)\.nodes$`)
+
+// xmlDataType parses the type value() converts to, such as 'DECIMAL(10,2)'.
+func xmlDataType(s string) *ast.DataType {
+	name, _, _ := strings.Cut(s, "(")
+	return &ast.DataType{Name: strings.ToUpper(strings.TrimSpace(name))}
+}
+
+// transpileXMLMethod converts value(), query(), exist() and modify()
+// called on a document or the node being shredded.
+func (t *transpiler) transpileXMLMethod(e *ast.MethodCallExpression) (string, error) {
+	method := strings.ToLower(e.MethodName)
+	obj, onNode := t.xmlRowFor(e.Object)
+	if !onNode {
+		var err error
+		if obj, err = t.transpileExpression(e.Object); err != nil {
+			return "", err
+		}
+	}
+	call := func(fn string, args ...string) string {
+		if onNode {
+			return fmt.Sprintf("%s.%s(%s)", obj, fn, strings.Join(args, ", "))
+		}
+		t.imports[xmlfnImport] = true
+		return fmt.Sprintf("xmlfn.%s(%s, %s)", fn, obj, strings.Join(args, ", "))
+	}
+
+	switch method {
+	case "value":
+		if len(e.Arguments) < 2 {
+			return "", fmt.Errorf("XML .value() requires 2 arguments (xpath, type)")
+		}
+		path, err := t.transpileExpression(e.Arguments[0])
+		if err != nil {
+			return "", err
+		}
+		typ, ok := e.Arguments[1].(*ast.StringLiteral)
+		if !ok {
+			return "", fmt.Errorf("XML .value() needs the type as a string literal, got %s", e.Arguments[1].String())
+		}
+		return t.xmlValueAs(call("Value", path), xmlDataType(typ.Value))
+	case "query", "exist":
+		if len(e.Arguments) < 1 {
+			return "", fmt.Errorf("XML .%s() requires 1 argument (xpath)", method)
+		}
+		path, err := t.transpileExpression(e.Arguments[0])
+		if err != nil {
+			return "", err
+		}
+		return call(toPascalCase(method), path), nil
+	case "nodes":
+		return "", fmt.Errorf("XML .nodes() returns rows; read them with SELECT or INSERT ... SELECT FROM @xml.nodes('...') AS T(c)")
+	case "modify":
+		// XML DML has no Go equivalent yet; the call is kept for a helper
+		// the application provides
+		if len(e.Arguments) < 1 {
+			return "", fmt.Errorf("XML .modify() requires 1 argument (dml)")
+		}
+		dml, err := t.transpileExpression(e.Arguments[0])
+		if err != nil {
+			return "", err
+		}
+		t.warnings = append(t.warnings, fmt.Sprintf("%s: XML .modify() has no Go translation; it calls XmlModify, which the application must provide", t.currentProcName))
+		return fmt.Sprintf("XmlModify(%s, %s)", obj, dml), nil
+	default:
+		return "", fmt.Errorf("unsupported method: %s", e.MethodName)
+	}
+}
+
+// xmlRowFor returns the Go node an expression refers to, as T.c or c in
+// a method called on a row of nodes().
+func (t *transpiler) xmlRowFor(e ast.Expression) (string, bool) {
+	if len(t.xmlRows) == 0 {
+		return "", false
+	}
+	var name string
+	switch x := e.(type) {
+	case *ast.Identifier:
+		name = x.Value
+	case *ast.QualifiedIdentifier:
+		name = x.String()
+	default:
+		return "", false
+	}
+	node, ok := t.xmlRows[strings.ToLower(name)]
+	return node, ok
+}
+
+// transpileXMLRowNumber numbers the rows being shredded with a counter,
+// for ROW_NUMBER() OVER (ORDER BY ...) without PARTITION BY.
+func (t *transpiler) transpileXMLRowNumber(e *ast.FunctionCall) (string, bool, error) {
+	if t.xmlRows == nil || e.Over == nil || !strings.EqualFold(e.Function.String(), "ROW_NUMBER") {
+		return "", false, nil
+	}
+	if len(e.Over.PartitionBy) > 0 {
+		return "", false, fmt.Errorf("ROW_NUMBER() OVER (PARTITION BY ...) of rows shredded from XML has no Go translation")
+	}
+	for _, item := range e.Over.OrderBy {
+		switch item.Expression.(type) {
+		case *ast.SubqueryExpression, *ast.IntegerLiteral, *ast.StringLiteral, *ast.NullLiteral:
+		default:
+			t.warnings = append(t.warnings, fmt.Sprintf("%s: ROW_NUMBER() numbers the rows shredded from XML in document order, not by %s", t.currentProcName, item.Expression.String()))
+		}
+	}
+	if t.xmlRowNumber == "" {
+		t.xmlRowNumber = "rowNumber"
+	}
+	return t.xmlRowNumber, true, nil
+}
+
+// xmlColumnFor returns the OPENXML column an identifier refers to.
+func (t *transpiler) xmlColumnFor(e ast.Expression) (xmlColumn, bool) {
+	if len(t.xmlColumns) == 0 {
+		return xmlColumn{}, false
+	}
+	var name string
+	switch x := e.(type) {
+	case *ast.Identifier:
+		name = x.Value
+	case *ast.QualifiedIdentifier:
+		if len(x.Parts) == 0 {
+			return xmlColumn{}, false
+		}
+		name = x.Parts[len(x.Parts)-1].Value
+	default:
+		return xmlColumn{}, false
+	}
+	col, ok := t.xmlColumns[strings.ToLower(name)]
+	return col, ok
+}
+
+// xmlValueAs converts the text get returns to the Go type of a SQL type.
+// Text that doesn't convert gives the zero value, as NULL does elsewhere.
+func (t *transpiler) xmlValueAs(get string, typ *ast.DataType) (string, error) {
+	goType, err := t.mapDataType(typ)
+	if err != nil {
+		return "", fmt.Errorf("XML value as %s: %w", typ.Name, err)
+	}
+	parseInt := func(fn string, bits int) string {
+		t.imports["strconv"] = true
+		t.imports["strings"] = true
+		return fmt.Sprintf("func() %s { v, _ := strconv.%s(strings.TrimSpace(%s), 10, %d); return %s(v) }()", goType, fn, get, bits, goType)
+	}
+	switch goType {
+	case "string":
+		return get, nil
+	case "uint8":
+		return parseInt("ParseUint", 8), nil
+	case "int16":
+		return parseInt("ParseInt", 16), nil
+	case "int32":
+		return parseInt("ParseInt", 32), nil
+	case "int64":
+		return parseInt("ParseInt", 64), nil
+	case "float64":
+		t.imports["strconv"] = true
+		t.imports["strings"] = true
+		return fmt.Sprintf("func() float64 { v, _ := strconv.ParseFloat(strings.TrimSpace(%s), 64); return v }()", get), nil
+	case "bool":
+		t.imports["strings"] = true
+		return fmt.Sprintf("func() bool { s := strings.TrimSpace(%s); return s == \"1\" || strings.EqualFold(s, \"true\") }()", get), nil
+	case "time.Time":
+		t.imports["strings"] = true
+		t.imports["time"] = true
+		return fmt.Sprintf("func() time.Time { s := strings.TrimSpace(%s); for _, layout := range []string{time.RFC3339Nano, \"2006-01-02T15:04:05.999999999\", \"2006-01-02\"} { if v, err := time.Parse(layout, s); err == nil { return v } }; return time.Time{} }()", get), nil
+	case "[]byte":
+		return fmt.Sprintf("[]byte(%s)", get), nil
+	}
+	if t.isDecimalType(goType) {
+		if t.decimalMode() == DecimalShopspring {
+			t.importDecimal()
+			t.imports["strings"] = true
+			return fmt.Sprintf("func() decimal.Decimal { v, _ := decimal.NewFromString(strings.TrimSpace(%s)); return v }()", get), nil
+		}
+		return t.decimalParse(get), nil
+	}
+	return "", fmt.Errorf("XML value as %s (%s) is not supported", typ.Name, goType)
+}
+
+// xmlDocumentProc returns sp_xml_preparedocument or sp_xml_removedocument
+// if s calls one.
+func xmlDocumentProc(s *ast.ExecStatement) string {
+	if s.Procedure == nil || len(s.Procedure.Parts) == 0 {
+		return ""
+	}
+	name := strings.ToLower(s.Procedure.Parts[len(s.Procedure.Parts)-1].Value)
+	switch name {
+	case "sp_xml_preparedocument", "sp_xml_removedocument":
+		return name
+	}
+	return ""
+}
+
+// transpileXMLDocument parses the document of sp_xml_preparedocument
+// @h OUTPUT, @xml into a Go variable for OPENXML(@h, ...) to read.
+func (dt *dmlTranspiler) transpileXMLDocument(s *ast.ExecStatement, proc string) (string, error) {
+	if len(s.Parameters) == 0 {
+		return "", fmt.Errorf("%s needs a document handle", proc)
+	}
+	handle, ok := s.Parameters[0].Value.(*ast.Variable)
+	if !ok {
+		return "", fmt.Errorf("%s needs a variable as the document handle, got %s", proc, s.Parameters[0].Value.String())
+	}
+	key := strings.ToLower(strings.TrimPrefix(handle.Name, "@"))
+	docVar := goIdentifier(strings.TrimPrefix(handle.Name, "@")) + "XML"
+
+	if proc == "sp_xml_removedocument" {
+		if _, ok := dt.xmlDocuments[key]; !ok {
+			return "", fmt.Errorf("sp_xml_removedocument %s: no document was prepared with this handle", handle.Name)
+		}
+		return fmt.Sprintf("// sp_xml_removedocument %s: nothing to release, %s is garbage collected", handle.Name, docVar), nil
+	}
+	if len(s.Parameters) < 2 {
+		return "", fmt.Errorf("sp_xml_preparedocument %s needs the XML text", handle.Name)
+	}
+	if len(s.Parameters) > 2 {
+		dt.warnings = append(dt.warnings, fmt.Sprintf("%s: sp_xml_preparedocument namespace declarations are ignored; namespace prefixes in paths match any namespace", dt.currentProcName))
+	}
+	doc, err := dt.transpileExpression(s.Parameters[1].Value)
+	if err != nil {
+		return "", err
+	}
+	if dt.xmlDocuments == nil {
+		dt.xmlDocuments = map[string]string{}
+	}
+	dt.xmlDocuments[key] = docVar
+	dt.imports[xmlfnImport] = true
+
+	assignOp := ":="
+	if dt.symbols.isDeclared(docVar) && dt.symbols.isDeclared("err") {
+		assignOp = "="
+	}
+	dt.symbols.markDeclared(docVar)
+	dt.symbols.markDeclared("err")
+	ind := dt.indentStr()
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("// sp_xml_preparedocument %s: the document is parsed in Go\n", handle.Name))
+	out.WriteString(ind + fmt.Sprintf("%s, err %s xmlfn.Parse(%s)\n", docVar, assignOp, doc))
+	out.WriteString(ind + "if err != nil {\n")
+	out.WriteString(ind + "\t" + dt.buildErrorReturn() + "\n")
+	out.WriteString(ind + "}")
+	return out.String(), nil
+}
+
+// xmlRowSource returns the nodes() or OPENXML a SELECT reads as its only
+// table, or nil if it reads something else.
+func (dt *dmlTranspiler) xmlRowSource(s *ast.SelectStatement) (*xmlRowSource, error) {
+	if s == nil || s.From == nil || len(s.From.Tables) != 1 {
+		return nil, nil
+	}
+	tvf, ok := s.From.Tables[0].(*ast.TableValuedFunction)
+	if !ok || tvf.Function == nil {
+		return nil, nil
+	}
+	fn := tvf.Function.String()
+	if m := xmlNodesFunction.FindStringSubmatch(fn); m != nil {
+		src := &xmlRowSource{label: fn + "(" + joinExpressions(tvf.Arguments) + ")"}
+		if tvf.Alias == nil || len(tvf.ColumnAliases) != 1 {
+			return nil, fmt.Errorf("%s needs an alias naming its column, as AS T(c)", src.label)
+		}
+		path, err := dt.xmlPath(src.label, tvf.Arguments, 0)
+		if err != nil {
+			return nil, err
+		}
+		column := tvf.ColumnAliases[0].Value
+		doc := goIdentifier(m[1])
+		dt.symbols.markUsed(doc)
+		src.nodeVar = goIdentifier(column) + "Node"
+		src.aliases = []string{strings.ToLower(tvf.Alias.Value + "." + column), strings.ToLower(column)}
+		src.nodes = fmt.Sprintf("%sNodes, err %%s xmlfn.Nodes(%s, %s)", doc, doc, path)
+		src.check = true
+		return src, nil
+	}
+	if !strings.EqualFold(fn, "OPENXML") {
+		return nil, nil
+	}
+
+	src := &xmlRowSource{label: "OPENXML(" + joinExpressions(tvf.Arguments) + ")", nodeVar: "node"}
+	if len(tvf.Arguments) < 2 {
+		return nil, fmt.Errorf("%s needs a document handle and a path", src.label)
+	}
+	if len(tvf.OpenJsonColumns) == 0 {
+		return nil, fmt.Errorf("%s without a WITH clause returns an edge table, which has no Go translation", src.label)
+	}
+	handle, ok := tvf.Arguments[0].(*ast.Variable)
+	if !ok {
+		return nil, fmt.Errorf("%s needs a variable as the document handle", src.label)
+	}
+	docVar, ok := dt.xmlDocuments[strings.ToLower(strings.TrimPrefix(handle.Name, "@"))]
+	if !ok {
+		return nil, fmt.Errorf("%s reads a document that sp_xml_preparedocument didn't prepare in this procedure", src.label)
+	}
+	path, err := dt.xmlPath(src.label, tvf.Arguments, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(tvf.Arguments) > 2 {
+		lit, ok := tvf.Arguments[2].(*ast.IntegerLiteral)
+		if !ok {
+			return nil, fmt.Errorf("%s needs literal flags", src.label)
+		}
+		src.flags = lit.Value
+	}
+	dt.symbols.markUsed(docVar)
+	src.columns = tvf.OpenJsonColumns
+	src.nodes = fmt.Sprintf("%sNodes %%s %s.Nodes(%s)", strings.TrimSuffix(docVar, "XML"), docVar, path)
+	return src, nil
+}
+
+// xmlPath returns the Go string of a literal path argument.
+func (dt *dmlTranspiler) xmlPath(label string, args []ast.Expression, i int) (string, error) {
+	if len(args) <= i {
+		return "", fmt.Errorf("%s needs a path", label)
+	}
+	if _, ok := args[i].(*ast.StringLiteral); !ok {
+		return "", fmt.Errorf("%s needs a literal path", label)
+	}
+	return dt.transpileExpression(args[i])
+}
+
+func joinExpressions(exprs []ast.Expression) string {
+	parts := make([]string, len(exprs))
+	for i, e := range exprs {
+		parts[i] = e.String()
+	}
+	return strings.Join(parts, ", ")
+}
+
+// columnPath returns the path an OPENXML WITH column is read from: its
+// own, or its name as an attribute (flags 0 and 1), an element (2) or
+// either (3).
+func (src *xmlRowSource) columnPath(col *ast.OpenJsonColumn) string {
+	if col.Path != "" {
+		return col.Path
+	}
+	switch src.flags & 3 {
+	case 2:
+		return col.Name
+	case 3:
+		return "@" + col.Name + "|" + col.Name
+	default:
+		return "@" + col.Name
+	}
+}
+
+// withColumns returns the SELECT's columns, with * expanded to the
+// OPENXML WITH columns.
+func (src *xmlRowSource) withColumns(s *ast.SelectStatement) []ast.SelectColumn {
+	var cols []ast.SelectColumn
+	for _, col := range s.Columns {
+		if col.AllColumns || (col.Expression != nil && col.Expression.String() == "*") {
+			for _, c := range src.columns {
+				cols = append(cols, ast.SelectColumn{Expression: &ast.Identifier{Value: c.Name}})
+			}
+			continue
+		}
+		cols = append(cols, col)
+	}
+	return cols
+}
+
+// enterXMLRows puts the node of src and its OPENXML columns in scope for
+// the expressions of a SELECT reading it, until the returned func is called.
+func (dt *dmlTranspiler) enterXMLRows(src *xmlRowSource) (func(), error) {
+	dt.xmlRows = map[string]string{}
+	for _, alias := range src.aliases {
+		dt.xmlRows[alias] = src.nodeVar
+	}
+	dt.xmlColumns = map[string]xmlColumn{}
+	for _, col := range src.columns {
+		code, err := dt.xmlValueAs(fmt.Sprintf("%s.Value(%q)", src.nodeVar, src.columnPath(col)), col.DataType)
+		if err != nil {
+			dt.xmlRows, dt.xmlColumns = nil, nil
+			return nil, fmt.Errorf("%s column %s: %w", src.label, col.Name, err)
+		}
+		dt.xmlColumns[strings.ToLower(col.Name)] = xmlColumn{code: code, typ: col.DataType}
+	}
+	return func() { dt.xmlRows, dt.xmlColumns, dt.xmlRowNumber = nil, nil, "" }, nil
+}
+
+// xmlNodes emits the statement finding the nodes of src, and returns the
+// variable holding them.
+func (dt *dmlTranspiler) xmlNodes(src *xmlRowSource, out *strings.Builder) string {
+	ind := dt.indentStr()
+	nodesVar, _, _ := strings.Cut(src.nodes, " ")
+	nodesVar = strings.TrimSuffix(nodesVar, ",")
+	assignOp := ":="
+	if dt.symbols.isDeclared(nodesVar) && (!src.check || dt.symbols.isDeclared("err")) {
+		assignOp = "="
+	}
+	dt.symbols.markDeclared(nodesVar)
+	dt.symbols.markUsed(nodesVar)
+	dt.imports[xmlfnImport] = true
+	out.WriteString(ind + fmt.Sprintf(src.nodes, assignOp) + "\n")
+	if src.check {
+		dt.symbols.markDeclared("err")
+		out.WriteString(ind + "if err != nil {\n")
+		out.WriteString(ind + "\t" + dt.buildErrorReturn() + "\n")
+		out.WriteString(ind + "}\n")
+	}
+	return nodesVar
+}
+
+// checkXMLSelect rejects the clauses a SELECT shredded in Go can't apply.
+func (dt *dmlTranspiler) checkXMLSelect(s *ast.SelectStatement, src *xmlRowSource) error {
+	if s.Distinct || s.Top != nil || len(s.GroupBy) > 0 || s.Having != nil || s.Union != nil || s.Into != nil {
+		return fmt.Errorf("SELECT ... FROM %s is shredded in Go, which doesn't support DISTINCT, TOP, GROUP BY, HAVING, UNION or INTO", src.label)
+	}
+	if len(s.OrderBy) > 0 {
+		dt.warnings = append(dt.warnings, fmt.Sprintf("%s: ORDER BY is not applied to the rows shredded from %s, which come in document order", dt.currentProcName, src.label))
+	}
+	return nil
+}
+
+// shredXML emits the loop over the rows of src, with body transpiled
+// while the node and OPENXML columns are in scope.
+func (dt *dmlTranspiler) shredXML(s *ast.SelectStatement, src *xmlRowSource, note string, body func(ind string) (string, error)) (string, error) {
+	if err := dt.checkXMLSelect(s, src); err != nil {
+		return "", err
+	}
+	leave, err := dt.enterXMLRows(src)
+	if err != nil {
+		return "", err
+	}
+	defer leave()
+
+	ind := dt.indentStr()
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("// %s: rows shredded in Go%s\n", src.label, note))
+	nodesVar := dt.xmlNodes(src, &out)
+	var loop strings.Builder
+	if s.Where != nil {
+		cond, err := dt.transpileExpression(s.Where)
+		if err != nil {
+			return "", err
+		}
+		loop.WriteString(ind + fmt.Sprintf("\tif !(%s) {\n", cond))
+		loop.WriteString(ind + "\t\tcontinue\n")
+		loop.WriteString(ind + "\t}\n")
+	}
+	code, err := body(ind + "\t")
+	if err != nil {
+		return "", err
+	}
+	if dt.xmlRowNumber != "" {
+		// Counted after WHERE, as ROW_NUMBER() numbers the rows it keeps
+		out.WriteString(ind + fmt.Sprintf("%s := int64(0)\n", dt.xmlRowNumber))
+		loop.WriteString(ind + fmt.Sprintf("\t%s++\n", dt.xmlRowNumber))
+	}
+	out.WriteString(ind + fmt.Sprintf("for _, %s := range %s {\n", src.nodeVar, nodesVar))
+	out.WriteString(loop.String())
+	out.WriteString(code)
+	out.WriteString(ind + "}")
+	return out.String(), nil
+}
+
+// transpileSelectXML assigns the rows of a SELECT from nodes() or OPENXML
+// to its variables, or to a variable per column for a result set, as the
+// rows of a query are scanned.
+func (dt *dmlTranspiler) transpileSelectXML(s *ast.SelectStatement, src *xmlRowSource) (string, error) {
+	columns := src.withColumns(s)
+	var decls []string
+	var contractCols []ContractColumn
+	used := map[string]int{}
+	code, err := dt.shredXML(s, src, "", func(ind string) (string, error) {
+		var body strings.Builder
+		for _, col := range columns {
+			value, err := dt.transpileExpression(col.Expression)
+			if err != nil {
+				return "", err
+			}
+			if col.Variable != nil {
+				body.WriteString(ind + fmt.Sprintf("%s = %s\n", goIdentifier(strings.TrimPrefix(col.Variable.Name, "@")), value))
+				continue
+			}
+			name := dt.extractColumnName(col.Expression)
+			if col.Alias != nil {
+				name = col.Alias.Value
+			}
+			goName := goIdentifier(name)
+			if n := used[goName]; n > 0 {
+				used[goName] = n + 1
+				goName = fmt.Sprintf("%s%d", goName, n+1)
+			} else {
+				used[goName] = 1
+			}
+			goType := "string"
+			if ti := dt.inferType(col.Expression); ti != nil && ti.goType != "" && ti.goType != "any" {
+				goType = ti.goType
+			}
+			decls = append(decls, fmt.Sprintf("var %s %s", goName, goType))
+			contractCols = append(contractCols, ContractColumn{Name: name, GoType: goType})
+			dt.symbols.markDeclared(goName)
+			body.WriteString(ind + fmt.Sprintf("%s = %s\n", goName, value))
+		}
+		return body.String(), nil
+	})
+	if err != nil {
+		return "", err
+	}
+	dt.recordResultSet(contractCols)
+	if len(decls) == 0 {
+		return code, nil
+	}
+	comment, rest, _ := strings.Cut(code, "\n")
+	ind := dt.indentStr()
+	return comment + "\n" + ind + strings.Join(decls, "\n"+ind) + "\n" + rest, nil
+}
+
+// transpileInsertXML inserts the rows of INSERT ... SELECT FROM nodes() or
+// OPENXML one at a time, or with gRPC sends them as one request.
+func (dt *dmlTranspiler) transpileInsertXML(s *ast.InsertStatement, src *xmlRowSource, backend BackendType) (string, error) {
+	sel := *s.Select
+	sel.Columns = src.withColumns(s.Select)
+	insert := *s
+	insert.Select = &sel
+
+	switch backend {
+	case BackendSQL:
+		dbVar := dt.getDBVar()
+		return dt.shredXML(&sel, src, ", one INSERT each", func(ind string) (string, error) {
+			var cols, placeholders, args []string
+			for _, c := range insert.Columns {
+				cols = append(cols, c.Value)
+			}
+			for i, col := range sel.Columns {
+				value, err := dt.transpileExpression(col.Expression)
+				if err != nil {
+					return "", err
+				}
+				placeholders = append(placeholders, dt.getPlaceholder(i+1))
+				args = append(args, value)
+			}
+			query := "INSERT INTO " + insert.Table.String()
+			if len(cols) > 0 {
+				query += " (" + strings.Join(cols, ", ") + ")"
+			}
+			query = dt.removeTableHints(query + " VALUES (" + strings.Join(placeholders, ", ") + ")")
+			var body strings.Builder
+			body.WriteString(ind + fmt.Sprintf("if _, err := %s.ExecContext(ctx, %q, %s); err != nil {\n", dbVar, query, strings.Join(args, ", ")))
+			body.WriteString(ind + "\t" + dt.buildErrorReturn() + "\n")
+			body.WriteString(ind + "}\n")
+			return body.String(), nil
+		})
+	case BackendGRPC:
+		if err := dt.checkXMLSelect(&sel, src); err != nil {
+			return "", err
+		}
+		if sel.Where != nil {
+			return "", fmt.Errorf("INSERT ... SELECT FROM %s WHERE ... has no gRPC translation; the rows are sent as one request", src.label)
+		}
+		leave, err := dt.enterXMLRows(src)
+		if err != nil {
+			return "", err
+		}
+		defer leave()
+		var out strings.Builder
+		out.WriteString(fmt.Sprintf("// %s: rows shredded in Go\n", src.label))
+		nodesVar := dt.xmlNodes(src, &out)
+		call, err := dt.transpileInsertRowsGRPC(&insert, src.label, nodesVar, src.nodeVar, func(expr ast.Expression) (string, bool, error) {
+			value, err := dt.transpileExpression(expr)
+			return value, err == nil && strings.Contains(value, src.nodeVar+"."), err
+		})
+		if err != nil {
+			return "", err
+		}
+		if dt.xmlRowNumber != "" {
+			return "", fmt.Errorf("INSERT ... SELECT ROW_NUMBER() ... FROM %s has no gRPC translation", src.label)
+		}
+		return out.String() + dt.indentStr() + call, nil
+	default:
+		return "", fmt.Errorf("INSERT ... SELECT FROM %s needs the SQL or gRPC backend, not %s", src.label, backend)
+	}
+}
+
+// normalizeXMLSQL warns about XML methods and OPENXML left in a query for
+// a dialect other than SQL Server.
+func (dt *dmlTranspiler) normalizeXMLSQL(query string) string {
+	if dt.config.SQLDialect == "sqlserver" || dt.config.SQLDialect == "" {
+		return query
+	}
+	if xmlMethodCall.MatchString(sqlStringLiteral.ReplaceAllString(query, "''")) {
+		dt.warnings = append(dt.warnings, fmt.Sprintf("%s: XML methods and OPENXML have no %s translation inside a query; they are kept as they are",
+			dt.currentProcName, dt.config.SQLDialect))
+	}
+	return query
+}
+
+var xmlMethodCall = regexp.MustCompile(`(?i)\.(?:value|nodes|query|exist|modify)\s*\(|\bOPENXML\s*\(`)
@@ -0,0 +1,106 @@
+package tsqlruntime
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Heartbeater records that a long-running activity is still making
+// progress. Temporal's activity.RecordHeartbeat is one:
+//
+//	tsqlruntime.SetHeartbeater(activity.RecordHeartbeat)
+type Heartbeater func(ctx context.Context, details ...any)
+
+var (
+	heartbeatMu sync.RWMutex
+	heartbeater Heartbeater
+)
+
+type heartbeaterKey struct{}
+
+// SetHeartbeater sets the Heartbeater used for contexts without one of
+// their own. Pass nil to stop recording heartbeats.
+func SetHeartbeater(h Heartbeater) {
+	heartbeatMu.Lock()
+	heartbeater = h
+	heartbeatMu.Unlock()
+}
+
+// WithHeartbeater returns a context whose heartbeats go to h, for workers
+// that track activities per call.
+func WithHeartbeater(ctx context.Context, h Heartbeater) context.Context {
+	return context.WithValue(ctx, heartbeaterKey{}, h)
+}
+
+// Heartbeat records a heartbeat for the activity running with ctx and
+// returns ctx.Err(), so the activity stops once it is cancelled.
+// Procedures marked -- tgpiler:activity call it at the top of every loop
+// iteration.
+func Heartbeat(ctx context.Context, details ...any) error {
+	h, _ := ctx.Value(heartbeaterKey{}).(Heartbeater)
+	if h == nil {
+		heartbeatMu.RLock()
+		h = heartbeater
+		heartbeatMu.RUnlock()
+	}
+	if h != nil {
+		h(ctx, details...)
+	}
+	return ctx.Err()
+}
+
+// Sleep waits for d, as WAITFOR DELAY does, returning ctx.Err() early if
+// ctx is cancelled.
+func Sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Delay parses a WAITFOR duration, hh:mm[:ss[.mmm]], returning 0 if it
+// isn't one.
+func Delay(s string) time.Duration {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0
+	}
+	var d time.Duration
+	for i, unit := range []time.Duration{time.Hour, time.Minute} {
+		n, err := strconv.Atoi(parts[i])
+		if err != nil || n < 0 {
+			return 0
+		}
+		d += time.Duration(n) * unit
+	}
+	if len(parts) == 3 {
+		secs, err := strconv.ParseFloat(parts[2], 64)
+		if err != nil || secs < 0 {
+			return 0
+		}
+		d += time.Duration(secs * float64(time.Second)).Round(time.Millisecond)
+	}
+	return d
+}
+
+// Until returns how long to wait for the next time of day timeOfDay after
+// midnight, as WAITFOR TIME does.
+func Until(timeOfDay time.Duration) time.Duration {
+	now := time.Now()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	next := midnight.Add(timeOfDay)
+	if !next.After(now) {
+		next = midnight.AddDate(0, 0, 1).Add(timeOfDay)
+	}
+	return next.Sub(now)
+}
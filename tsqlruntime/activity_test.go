@@ -0,0 +1,50 @@
+package tsqlruntime
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHeartbeat(t *testing.T) {
+	var global, local int
+	SetHeartbeater(func(context.Context, ...any) { global++ })
+	defer SetHeartbeater(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := Heartbeat(ctx); err != nil || global != 1 {
+		t.Fatalf("got %v, %d heartbeats", err, global)
+	}
+	perCall := WithHeartbeater(ctx, func(context.Context, ...any) { local++ })
+	Heartbeat(perCall)
+	if global != 1 || local != 1 {
+		t.Errorf("expected the context's heartbeater, got %d global and %d local", global, local)
+	}
+
+	cancel()
+	if err := Heartbeat(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if err := Sleep(ctx, time.Hour); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected Sleep to stop on cancel, got %v", err)
+	}
+}
+
+func TestDelay(t *testing.T) {
+	tests := map[string]time.Duration{
+		"00:00:05":     5 * time.Second,
+		"01:30":        90 * time.Minute,
+		"00:00:01.250": 1250 * time.Millisecond,
+		"5":            0,
+		"aa:00":        0,
+	}
+	for s, want := range tests {
+		if got := Delay(s); got != want {
+			t.Errorf("Delay(%q) = %v, want %v", s, got, want)
+		}
+	}
+	if d := Until(0); d <= 0 || d > 24*time.Hour {
+		t.Errorf("Until(0) = %v", d)
+	}
+}
@@ -0,0 +1,263 @@
+package tsqlruntime
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AppLocks holds the application locks a procedure call takes with
+// sp_getapplock, as the SQL Server session would. Generated code creates
+// one per call and releases what is still held when the call returns:
+//
+//	appLocks := tsqlruntime.NewAppLocks(r.db, "postgres")
+//	defer appLocks.ReleaseAll()
+//
+// On PostgreSQL the locks are advisory locks keyed by a hash of the
+// resource name, on MySQL GET_LOCK locks, and on SQL Server sp_getapplock
+// itself, each on a connection held until the lock is released. With any
+// other dialect, or no database, they are held in the process, so they
+// only serialize callers within it.
+//
+// Shared and IntentShared locks are shared; the other modes are
+// exclusive. MySQL has no shared locks, so every mode is exclusive there.
+type AppLocks struct {
+	db      DBTX
+	dialect string
+	held    map[string]*appLock
+}
+
+type appLock struct {
+	conn   DBTX
+	close  func()
+	shared bool
+	count  int
+}
+
+// NewAppLocks returns the application locks of a call running against db
+// in dialect ("postgres", "mysql" or "sqlserver"). A nil db, or another
+// dialect, holds the locks in the process.
+func NewAppLocks(db DBTX, dialect string) *AppLocks {
+	if db == nil {
+		dialect = ""
+	}
+	return &AppLocks{db: db, dialect: dialect, held: map[string]*appLock{}}
+}
+
+// appLockPoll is how often a lock that can't be taken yet is tried again.
+const appLockPoll = 10 * time.Millisecond
+
+// Get takes the lock on resource in mode, waiting up to timeout for it; a
+// negative timeout waits until ctx is done. It returns sp_getapplock's
+// status: 0 when the lock was granted at once, 1 after waiting, -1 when
+// the wait timed out and -2 when ctx was done, with ctx's error. Taking a
+// lock already held counts it again, and it must be released as often.
+func (l *AppLocks) Get(ctx context.Context, resource, mode string, timeout time.Duration) (int32, error) {
+	if held := l.held[resource]; held != nil {
+		held.count++
+		return 0, nil
+	}
+	shared := strings.EqualFold(mode, "Shared") || strings.EqualFold(mode, "IntentShared")
+	lock := &appLock{shared: shared, count: 1, close: func() {}}
+
+	if l.dialect == "postgres" || l.dialect == "mysql" || l.dialect == "sqlserver" {
+		// The lock belongs to the connection, so one is kept for it
+		lock.conn = l.db
+		if pool, ok := l.db.(*sql.DB); ok {
+			conn, err := pool.Conn(ctx)
+			if err != nil {
+				return -999, err
+			}
+			lock.conn = conn
+			lock.close = func() { conn.Close() }
+		}
+	}
+
+	var deadline time.Time
+	if timeout >= 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	for waited := false; ; waited = true {
+		granted, err := l.try(ctx, lock, resource, timeout)
+		if err != nil {
+			lock.close()
+			return -999, err
+		}
+		if granted {
+			l.held[resource] = lock
+			if waited {
+				return 1, nil
+			}
+			return 0, nil
+		}
+		if l.dialect == "mysql" || l.dialect == "sqlserver" {
+			// GET_LOCK and sp_getapplock have waited already
+			lock.close()
+			return -1, nil
+		}
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			lock.close()
+			return -1, nil
+		}
+		select {
+		case <-ctx.Done():
+			lock.close()
+			return -2, ctx.Err()
+		case <-time.After(appLockPoll):
+		}
+	}
+}
+
+// try takes lock on resource if it's free. MySQL and SQL Server wait up
+// to timeout themselves.
+func (l *AppLocks) try(ctx context.Context, lock *appLock, resource string, timeout time.Duration) (bool, error) {
+	switch l.dialect {
+	case "postgres":
+		fn := "pg_try_advisory_lock"
+		if lock.shared {
+			fn = "pg_try_advisory_lock_shared"
+		}
+		var granted bool
+		err := lock.conn.QueryRowContext(ctx, "SELECT "+fn+"($1)", appLockKey(resource)).Scan(&granted)
+		return granted, err
+	case "mysql":
+		seconds := -1
+		if timeout >= 0 {
+			seconds = int((timeout + time.Second - 1) / time.Second)
+		}
+		var granted sql.NullInt64
+		err := lock.conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", mysqlLockName(resource), seconds).Scan(&granted)
+		if err == nil && !granted.Valid {
+			err = fmt.Errorf("GET_LOCK failed for application lock %s", resource)
+		}
+		return granted.Int64 == 1, err
+	case "sqlserver":
+		mode := "Exclusive"
+		if lock.shared {
+			mode = "Shared"
+		}
+		ms := int64(-1)
+		if timeout >= 0 {
+			ms = timeout.Milliseconds()
+		}
+		var status int32
+		err := lock.conn.QueryRowContext(ctx, "DECLARE @r INT; EXEC @r = sp_getapplock @Resource = @p1, @LockMode = @p2, "+
+			"@LockOwner = 'Session', @LockTimeout = @p3; SELECT @r", resource, mode, ms).Scan(&status)
+		if err == nil && status < -1 {
+			err = fmt.Errorf("sp_getapplock returned %d for application lock %s", status, resource)
+		}
+		return status >= 0, err
+	}
+	return processAppLocks.try(resource, lock.shared), nil
+}
+
+// Release releases the lock on resource, as sp_releaseapplock does,
+// returning 0. Releasing a lock that isn't held is an error.
+func (l *AppLocks) Release(ctx context.Context, resource string) (int32, error) {
+	lock := l.held[resource]
+	if lock == nil {
+		return -999, fmt.Errorf("cannot release the application lock %s because it is not currently held", resource)
+	}
+	if lock.count--; lock.count > 0 {
+		return 0, nil
+	}
+	delete(l.held, resource)
+	defer lock.close()
+	var err error
+	switch l.dialect {
+	case "postgres":
+		fn := "pg_advisory_unlock"
+		if lock.shared {
+			fn = "pg_advisory_unlock_shared"
+		}
+		_, err = lock.conn.ExecContext(ctx, "SELECT "+fn+"($1)", appLockKey(resource))
+	case "mysql":
+		_, err = lock.conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", mysqlLockName(resource))
+	case "sqlserver":
+		_, err = lock.conn.ExecContext(ctx, "EXEC sp_releaseapplock @Resource = @p1, @LockOwner = 'Session'", resource)
+	default:
+		processAppLocks.release(resource, lock.shared)
+	}
+	if err != nil {
+		return -999, err
+	}
+	return 0, nil
+}
+
+// ReleaseAll releases every lock still held, as the end of a session
+// does. It doesn't use the call's context, which may be done by then.
+func (l *AppLocks) ReleaseAll() {
+	for resource, lock := range l.held {
+		lock.count = 1
+		l.Release(context.Background(), resource)
+	}
+}
+
+// appLockKey returns the advisory lock key of resource on PostgreSQL.
+func appLockKey(resource string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(resource))
+	return int64(h.Sum64())
+}
+
+// mysqlLockName returns resource within MySQL's 64 characters for lock
+// names, replacing longer ones by a hash.
+func mysqlLockName(resource string) string {
+	if len(resource) <= 64 {
+		return resource
+	}
+	return fmt.Sprintf("applock:%016x", uint64(appLockKey(resource)))
+}
+
+// processAppLocks holds the application locks taken without a database.
+var processAppLocks = &appLockTable{locks: map[string]*processAppLock{}}
+
+type appLockTable struct {
+	mu    sync.Mutex
+	locks map[string]*processAppLock
+}
+
+type processAppLock struct {
+	shared    int
+	exclusive bool
+}
+
+func (t *appLockTable) try(resource string, shared bool) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	lock := t.locks[resource]
+	if lock == nil {
+		lock = &processAppLock{}
+		t.locks[resource] = lock
+	}
+	switch {
+	case lock.exclusive, !shared && lock.shared > 0:
+		return false
+	case shared:
+		lock.shared++
+	default:
+		lock.exclusive = true
+	}
+	return true
+}
+
+func (t *appLockTable) release(resource string, shared bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	lock := t.locks[resource]
+	if lock == nil {
+		return
+	}
+	if shared {
+		lock.shared--
+	} else {
+		lock.exclusive = false
+	}
+	if lock.shared == 0 && !lock.exclusive {
+		delete(t.locks, resource)
+	}
+}
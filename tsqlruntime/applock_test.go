@@ -0,0 +1,65 @@
+package tsqlruntime
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAppLocksInProcess(t *testing.T) {
+	ctx := context.Background()
+	a, b := NewAppLocks(nil, ""), NewAppLocks(nil, "postgres")
+
+	if status, err := a.Get(ctx, "nightly", "Exclusive", 0); status != 0 || err != nil {
+		t.Fatalf("Get = %d, %v; want 0", status, err)
+	}
+	// Taken again by the same call, it is counted
+	if status, _ := a.Get(ctx, "nightly", "Exclusive", 0); status != 0 {
+		t.Errorf("re-entrant Get = %d, want 0", status)
+	}
+	if status, err := b.Get(ctx, "nightly", "Shared", 20*time.Millisecond); status != -1 || err != nil {
+		t.Errorf("Get of a held lock = %d, %v; want -1", status, err)
+	}
+	a.Release(ctx, "nightly")
+	if status, _ := b.Get(ctx, "nightly", "Shared", 0); status != -1 {
+		t.Errorf("Get after one of two releases = %d, want -1", status)
+	}
+
+	// Released while another call waits, the lock is granted after waiting
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		a.Release(ctx, "nightly")
+	}()
+	if status, err := b.Get(ctx, "nightly", "Shared", -1); status != 1 || err != nil {
+		t.Errorf("Get after waiting = %d, %v; want 1", status, err)
+	}
+	if status, _ := a.Get(ctx, "nightly", "IntentShared", 0); status != 0 {
+		t.Errorf("shared Get beside a shared lock = %d, want 0", status)
+	}
+	a.ReleaseAll()
+	b.ReleaseAll()
+
+	if _, err := a.Release(ctx, "nightly"); err == nil {
+		t.Error("Release of a lock not held should fail")
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	a.Get(ctx, "nightly", "Update", 0)
+	cancel()
+	if status, err := b.Get(cancelled, "nightly", "Exclusive", -1); status != -2 || err == nil {
+		t.Errorf("Get with a cancelled context = %d, %v; want -2", status, err)
+	}
+	a.ReleaseAll()
+}
+
+func TestAppLockNames(t *testing.T) {
+	if appLockKey("nightly") == appLockKey("Nightly") {
+		t.Error("advisory lock keys should differ by case, as resource names do")
+	}
+	long := "resource-" + string(make([]byte, 80))
+	if got := mysqlLockName(long); len(got) > 64 {
+		t.Errorf("mysqlLockName returned %d characters", len(got))
+	}
+	if got := mysqlLockName("nightly"); got != "nightly" {
+		t.Errorf("mysqlLockName(%q) = %q", "nightly", got)
+	}
+}
@@ -0,0 +1,328 @@
+package tsqlruntime
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/shopspring/decimal"
+)
+
+// Typed builtin helpers called directly from transpiled code.
+//
+// The transpiler emits calls to these functions for T-SQL builtins whose
+// semantics are too subtle to inline at every call site (DATEDIFF boundary
+// counting, ROUND half-away-from-zero, ISNUMERIC's permissive parsing).
+// Keeping the logic here means a semantics fix lands once, rather than in
+// every generated file. The interpreter's Value-based functions delegate to
+// the same helpers so both paths agree.
+
+// DateDiff returns the number of datepart boundaries crossed between start
+// and end, matching T-SQL DATEDIFF. Unlike elapsed-time arithmetic,
+// DATEDIFF(year, '2023-12-31', '2024-01-01') is 1.
+// Unknown dateparts return 0; use DateDiffBig for the error.
+func DateDiff(datepart string, start, end time.Time) int32 {
+	n, _ := DateDiffBig(datepart, start, end)
+	return int32(n)
+}
+
+// DateDiffBig is DateDiff with a BIGINT result, matching DATEDIFF_BIG.
+// It returns an error for unknown dateparts.
+func DateDiffBig(datepart string, start, end time.Time) (int64, error) {
+	switch strings.ToLower(datepart) {
+	case "year", "yy", "yyyy":
+		return int64(end.Year() - start.Year()), nil
+	case "quarter", "qq", "q":
+		startQ := start.Year()*4 + (int(start.Month())-1)/3
+		endQ := end.Year()*4 + (int(end.Month())-1)/3
+		return int64(endQ - startQ), nil
+	case "month", "mm", "m":
+		return int64((end.Year()-start.Year())*12 + int(end.Month()) - int(start.Month())), nil
+	case "dayofyear", "dy", "y", "day", "dd", "d":
+		return daysBetween(start, end), nil
+	case "week", "wk", "ww":
+		// Week boundaries are Sundays (SET DATEFIRST 7)
+		s := truncateToDay(start).AddDate(0, 0, -int(start.Weekday()))
+		e := truncateToDay(end).AddDate(0, 0, -int(end.Weekday()))
+		return daysBetween(s, e) / 7, nil
+	case "hour", "hh":
+		return floorDiv(end.Unix(), 3600) - floorDiv(start.Unix(), 3600), nil
+	case "minute", "mi", "n":
+		return floorDiv(end.Unix(), 60) - floorDiv(start.Unix(), 60), nil
+	case "second", "ss", "s":
+		return end.Unix() - start.Unix(), nil
+	case "millisecond", "ms":
+		return end.UnixMilli() - start.UnixMilli(), nil
+	case "microsecond", "mcs":
+		return end.UnixMicro() - start.UnixMicro(), nil
+	case "nanosecond", "ns":
+		return end.Sub(start).Nanoseconds(), nil
+	default:
+		return 0, fmt.Errorf("unknown datepart: %s", datepart)
+	}
+}
+
+// EOMonth returns the last day of the month containing date, optionally
+// offset by months, matching T-SQL EOMONTH(date [, months]).
+func EOMonth(date time.Time, months ...int) time.Time {
+	offset := 0
+	if len(months) > 0 {
+		offset = months[0]
+	}
+	first := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, date.Location())
+	return first.AddDate(0, offset+1, -1)
+}
+
+// DateFromParts builds a date at midnight UTC, matching T-SQL DATEFROMPARTS.
+func DateFromParts(year, month, day int) time.Time {
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+}
+
+// datePartNames maps datepart names and abbreviations to the full names.
+var datePartNames = map[string]string{
+	"year": "year", "yy": "year", "yyyy": "year",
+	"quarter": "quarter", "qq": "quarter", "q": "quarter",
+	"month": "month", "mm": "month", "m": "month",
+	"dayofyear": "dayofyear", "dy": "dayofyear", "y": "dayofyear",
+	"day": "day", "dd": "day", "d": "day",
+	"week": "week", "wk": "week", "ww": "week",
+	"iso_week": "iso_week", "isowk": "iso_week", "isoww": "iso_week",
+	"weekday": "weekday", "dw": "weekday", "w": "weekday",
+	"hour": "hour", "hh": "hour",
+	"minute": "minute", "mi": "minute", "n": "minute",
+	"second": "second", "ss": "second", "s": "second",
+	"millisecond": "millisecond", "ms": "millisecond",
+	"microsecond": "microsecond", "mcs": "microsecond",
+	"nanosecond": "nanosecond", "ns": "nanosecond",
+	"tzoffset": "tzoffset", "tz": "tzoffset",
+}
+
+// DatePartName returns the full name of a datepart, such as "month" for
+// "mm", and whether datepart is one.
+func DatePartName(datepart string) (string, bool) {
+	name, ok := datePartNames[strings.ToLower(strings.TrimSpace(datepart))]
+	return name, ok
+}
+
+// DateAdd adds number dateparts to date, matching T-SQL DATEADD. Adding
+// months keeps the day of the month where it can and otherwise ends at the
+// month's last day, so DATEADD(month, 1, '2024-01-31') is 2024-02-29.
+// Unknown dateparts return date unchanged.
+func DateAdd(datepart string, number int, date time.Time) time.Time {
+	name, _ := DatePartName(datepart)
+	switch name {
+	case "year":
+		return addMonths(date, number*12)
+	case "quarter":
+		return addMonths(date, number*3)
+	case "month":
+		return addMonths(date, number)
+	case "dayofyear", "day", "weekday":
+		return date.AddDate(0, 0, number)
+	case "week":
+		return date.AddDate(0, 0, number*7)
+	case "hour":
+		return date.Add(time.Duration(number) * time.Hour)
+	case "minute":
+		return date.Add(time.Duration(number) * time.Minute)
+	case "second":
+		return date.Add(time.Duration(number) * time.Second)
+	case "millisecond":
+		return date.Add(time.Duration(number) * time.Millisecond)
+	case "microsecond":
+		return date.Add(time.Duration(number) * time.Microsecond)
+	case "nanosecond":
+		return date.Add(time.Duration(number))
+	}
+	return date
+}
+
+// addMonths adds n months to t, clamping the day to the end of the month.
+func addMonths(t time.Time, n int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(n), 1, 0, 0, 0, 0, t.Location())
+	day := t.Day()
+	if last := first.AddDate(0, 1, -1).Day(); day > last {
+		day = last
+	}
+	return time.Date(first.Year(), first.Month(), day, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+}
+
+// DatePart returns a datepart of date, matching T-SQL DATEPART with SET
+// DATEFIRST 7: weeks start on Sunday, week 1 is the one containing
+// January 1, and weekday 1 is Sunday. Unknown dateparts return 0.
+func DatePart(datepart string, date time.Time) int32 {
+	name, _ := DatePartName(datepart)
+	switch name {
+	case "year":
+		return int32(date.Year())
+	case "quarter":
+		return int32((date.Month()-1)/3 + 1)
+	case "month":
+		return int32(date.Month())
+	case "dayofyear":
+		return int32(date.YearDay())
+	case "day":
+		return int32(date.Day())
+	case "week":
+		jan1 := time.Date(date.Year(), 1, 1, 0, 0, 0, 0, date.Location())
+		return int32((date.YearDay()-1+int(jan1.Weekday()))/7 + 1)
+	case "iso_week":
+		_, week := date.ISOWeek()
+		return int32(week)
+	case "weekday":
+		return int32(date.Weekday()) + 1
+	case "hour":
+		return int32(date.Hour())
+	case "minute":
+		return int32(date.Minute())
+	case "second":
+		return int32(date.Second())
+	case "millisecond":
+		return int32(date.Nanosecond() / 1e6)
+	case "microsecond":
+		return int32(date.Nanosecond() / 1e3)
+	case "nanosecond":
+		return int32(date.Nanosecond())
+	case "tzoffset":
+		_, offset := date.Zone()
+		return int32(offset / 60)
+	}
+	return 0
+}
+
+// DateName returns a datepart of date as a string, matching T-SQL
+// DATENAME: month and weekday names, the offset as "+hh:mm", and other
+// dateparts as numbers.
+func DateName(datepart string, date time.Time) string {
+	name, _ := DatePartName(datepart)
+	switch name {
+	case "month":
+		return date.Month().String()
+	case "weekday":
+		return date.Weekday().String()
+	case "tzoffset":
+		return date.Format("-07:00")
+	}
+	return fmt.Sprint(DatePart(datepart, date))
+}
+
+// Round rounds v to length decimal places using T-SQL ROUND semantics:
+// halves round away from zero and a negative length rounds to the left of
+// the decimal point (ROUND(1234.5, -2) = 1200).
+// A non-zero function argument truncates instead, as in ROUND(x, n, 1).
+func Round(v float64, length int, function ...int) float64 {
+	scale := math.Pow(10, float64(length))
+	if len(function) > 0 && function[0] != 0 {
+		return math.Trunc(v*scale) / scale
+	}
+	return math.Round(v*scale) / scale
+}
+
+// RoundDecimal is Round for decimal.Decimal values.
+func RoundDecimal(d decimal.Decimal, length int, function ...int) decimal.Decimal {
+	if len(function) > 0 && function[0] != 0 {
+		return d.Truncate(int32(length))
+	}
+	return d.Round(int32(length))
+}
+
+// IsNumeric reports whether v would convert to a numeric type, matching
+// T-SQL ISNUMERIC: it returns 1 or 0 rather than a bool. Strings follow
+// SQL Server's permissive rules, so currency symbols, thousands
+// separators and exponents are accepted.
+func IsNumeric(v any) int32 {
+	switch x := v.(type) {
+	case nil:
+		return 0
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64,
+		float32, float64, decimal.Decimal:
+		return 1
+	case string:
+		if isNumericString(x) {
+			return 1
+		}
+		return 0
+	case fmt.Stringer:
+		if isNumericString(x.String()) {
+			return 1
+		}
+		return 0
+	default:
+		return 0
+	}
+}
+
+// isNumericString implements the string rules behind IsNumeric.
+// SQL Server accepts a lone sign, currency symbol or decimal point, so
+// those are treated as numeric here too.
+func isNumericString(s string) bool {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return false
+	}
+
+	runes := []rune(s)
+	i := 0
+	if runes[i] == '+' || runes[i] == '-' {
+		i++
+	}
+	if i < len(runes) && unicode.Is(unicode.Sc, runes[i]) {
+		i++
+		// A sign may also follow the currency symbol ($-5)
+		if i < len(runes) && (runes[i] == '+' || runes[i] == '-') {
+			i++
+		}
+	}
+
+	digits, seenDot := 0, false
+	for ; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case r == ',' && !seenDot:
+		case r == '.' && !seenDot:
+			seenDot = true
+		case (r == 'e' || r == 'E' || r == 'd' || r == 'D') && digits > 0:
+			// Exponent: optional sign then at least one digit
+			i++
+			if i < len(runes) && (runes[i] == '+' || runes[i] == '-') {
+				i++
+			}
+			if i == len(runes) {
+				return false
+			}
+			for ; i < len(runes); i++ {
+				if runes[i] < '0' || runes[i] > '9' {
+					return false
+				}
+			}
+			return true
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func truncateToDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// daysBetween counts midnight boundaries between two times, ignoring
+// the time-of-day component the way DATEDIFF(day, ...) does.
+func daysBetween(start, end time.Time) int64 {
+	s := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+	e := time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, time.UTC)
+	return int64(e.Sub(s).Hours() / 24)
+}
+
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if (a%b != 0) && ((a < 0) != (b < 0)) {
+		q--
+	}
+	return q
+}
@@ -0,0 +1,163 @@
+package tsqlruntime
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestDateDiffBoundaries(t *testing.T) {
+	tests := []struct {
+		datepart string
+		start    time.Time
+		end      time.Time
+		expected int32
+	}{
+		{"year", time.Date(2023, 12, 31, 23, 59, 0, 0, time.UTC), time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), 1},
+		{"day", time.Date(2024, 1, 1, 23, 59, 0, 0, time.UTC), time.Date(2024, 1, 2, 0, 1, 0, 0, time.UTC), 1},
+		{"hour", time.Date(2024, 1, 1, 10, 59, 0, 0, time.UTC), time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC), 1},
+		{"month", time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC), time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), 1},
+		{"quarter", time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC), time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC), 1},
+		{"week", time.Date(2024, 1, 6, 0, 0, 0, 0, time.UTC), time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC), 1},
+		{"day", time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), -14},
+	}
+
+	for _, tt := range tests {
+		if got := DateDiff(tt.datepart, tt.start, tt.end); got != tt.expected {
+			t.Errorf("DateDiff(%s, %v, %v) = %d, want %d", tt.datepart, tt.start, tt.end, got, tt.expected)
+		}
+	}
+
+	if _, err := DateDiffBig("fortnight", time.Now(), time.Now()); err == nil {
+		t.Error("DateDiffBig should reject unknown dateparts")
+	}
+}
+
+func TestDateAddPartName(t *testing.T) {
+	jan31 := time.Date(2024, 1, 31, 9, 30, 0, 0, time.UTC)
+	tests := []struct {
+		datepart string
+		number   int
+		expected time.Time
+	}{
+		{"month", 1, time.Date(2024, 2, 29, 9, 30, 0, 0, time.UTC)},
+		{"yy", 1, time.Date(2025, 1, 31, 9, 30, 0, 0, time.UTC)},
+		{"q", -1, time.Date(2023, 10, 31, 9, 30, 0, 0, time.UTC)},
+		{"wk", 1, time.Date(2024, 2, 7, 9, 30, 0, 0, time.UTC)},
+		{"mi", -30, time.Date(2024, 1, 31, 9, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		if got := DateAdd(tt.datepart, tt.number, jan31); !got.Equal(tt.expected) {
+			t.Errorf("DateAdd(%s, %d) = %v, want %v", tt.datepart, tt.number, got, tt.expected)
+		}
+	}
+
+	// 2023-01-01 is a Sunday, so January 7 is still week 1
+	sat := time.Date(2023, 1, 7, 0, 0, 0, 0, time.UTC)
+	if got := DatePart("week", sat); got != 1 {
+		t.Errorf("DatePart(week) = %d, want 1", got)
+	}
+	if got := DatePart("dw", sat); got != 7 {
+		t.Errorf("DatePart(dw) = %d, want 7", got)
+	}
+	if got := DateName("month", sat) + " " + DateName("weekday", sat); got != "January Saturday" {
+		t.Errorf("DateName = %q", got)
+	}
+	if _, ok := DatePartName("fortnight"); ok {
+		t.Error("DatePartName accepted an unknown datepart")
+	}
+}
+
+func TestFormat(t *testing.T) {
+	d := time.Date(2024, 3, 5, 14, 7, 9, 123000000, time.UTC)
+	dates := map[string]string{
+		"yyyy-MM-dd":          "2024-03-05",
+		"dd/MM/yyyy HH:mm:ss": "05/03/2024 14:07:09",
+		"MMMM d, yyyy":        "March 5, 2024",
+		"hh:mm tt":            "02:07 PM",
+		"HH:mm:ss.fff":        "14:07:09.123",
+		"d":                   "3/5/2024",
+	}
+	for format, want := range dates {
+		if got := FormatDate(d, format); got != want {
+			t.Errorf("FormatDate(%q) = %q, want %q", format, got, want)
+		}
+	}
+
+	numbers := []struct {
+		v      float64
+		format string
+		want   string
+	}{
+		{1234.5, "N2", "1,234.50"},
+		{-1234.5, "C", "-$1,234.50"},
+		{0.1234, "P1", "12.3%"},
+		{42, "D5", "00042"},
+		{1234.5, "#,##0.00", "1,234.50"},
+		{3.14159, "0.##", "3.14"},
+		{7, "000", "007"},
+	}
+	for _, tt := range numbers {
+		if got := FormatNumber(tt.v, tt.format); got != tt.want {
+			t.Errorf("FormatNumber(%v, %q) = %q, want %q", tt.v, tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestEOMonthAndDateFromParts(t *testing.T) {
+	d := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	if got := EOMonth(d); !got.Equal(time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("EOMonth = %v", got)
+	}
+	if got := EOMonth(d, 1); !got.Equal(time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("EOMonth(+1) = %v", got)
+	}
+	if got := DateFromParts(2024, 2, 29); !got.Equal(time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("DateFromParts = %v", got)
+	}
+}
+
+func TestRoundSemantics(t *testing.T) {
+	if got := Round(2.5, 0); got != 3 {
+		t.Errorf("Round(2.5, 0) = %v, want 3", got)
+	}
+	if got := Round(-2.5, 0); got != -3 {
+		t.Errorf("Round(-2.5, 0) = %v, want -3", got)
+	}
+	if got := Round(1234.5, -2); got != 1200 {
+		t.Errorf("Round(1234.5, -2) = %v, want 1200", got)
+	}
+	if got := Round(1.789, 1, 1); got != 1.7 {
+		t.Errorf("Round(1.789, 1, 1) = %v, want 1.7", got)
+	}
+	if got := RoundDecimal(decimal.RequireFromString("1.255"), 2); got.String() != "1.26" {
+		t.Errorf("RoundDecimal = %s, want 1.26", got)
+	}
+}
+
+func TestIsNumeric(t *testing.T) {
+	tests := []struct {
+		input    any
+		expected int32
+	}{
+		{"123", 1},
+		{" -12.5 ", 1},
+		{"$1,000.00", 1},
+		{"1e5", 1},
+		{"1d5", 1},
+		{"1e", 0},
+		{"abc", 0},
+		{"", 0},
+		{"12a", 0},
+		{nil, 0},
+		{int32(5), 1},
+		{decimal.NewFromInt(1), 1},
+	}
+
+	for _, tt := range tests {
+		if got := IsNumeric(tt.input); got != tt.expected {
+			t.Errorf("IsNumeric(%#v) = %d, want %d", tt.input, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package tsqlruntime
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf16"
+)
+
+// Execer is the subset of *sql.DB / *sql.Tx needed by BulkInsert.
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// BulkOptions mirrors the BULK INSERT options that affect how a data file
+// is read. Server-side hints (TABLOCK, FIRE_TRIGGERS, ...) have no
+// equivalent and are not represented.
+type BulkOptions struct {
+	Dialect         Dialect
+	FieldTerminator string // default "\t"
+	RowTerminator   string // default "\n"; a trailing "\r" is also removed
+	CSV             bool   // FORMAT = 'CSV': RFC 4180 quoting
+	FieldQuote      rune   // FIELDQUOTE, default '"'
+	FirstRow        int    // 1-based, default 1
+	LastRow         int    // 0 means to the end of the file
+	BatchSize       int    // rows per INSERT, default 1000
+	MaxErrors       int    // malformed rows tolerated, default 10
+}
+
+// bulkMaxParams keeps multi-row INSERTs under the parameter limits of
+// the drivers (SQL Server allows 2100, postgres 65535).
+var bulkMaxParams = map[Dialect]int{
+	DialectSQLServer: 2000,
+	DialectPostgres:  65535,
+	DialectMySQL:     65535,
+	DialectSQLite:    32766,
+}
+
+// BulkInsert loads a delimited data file into table, the way BULK INSERT
+// does on the server, and returns the number of rows inserted. columns
+// may be nil, in which case each row must supply every column of the
+// table in order. Empty fields are inserted as NULL.
+//
+// Rows are sent as multi-row INSERT statements of up to BatchSize rows.
+// Rows with a different number of fields than the first one are skipped
+// and counted; the load fails once more than MaxErrors have been seen.
+func BulkInsert(ctx context.Context, db Execer, table string, columns []string, path string, opts BulkOptions) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("bulk insert into %s: %w", table, err)
+	}
+	defer f.Close()
+	return BulkInsertFrom(ctx, db, table, columns, f, opts)
+}
+
+// BulkInsertFrom is BulkInsert reading from r instead of a file.
+func BulkInsertFrom(ctx context.Context, db Execer, table string, columns []string, r io.Reader, opts BulkOptions) (int64, error) {
+	if opts.FieldTerminator == "" {
+		opts.FieldTerminator = "\t"
+	}
+	if opts.RowTerminator == "" {
+		opts.RowTerminator = "\n"
+	}
+	if opts.FieldQuote == 0 {
+		opts.FieldQuote = '"'
+	}
+	if opts.FirstRow < 1 {
+		opts.FirstRow = 1
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 1000
+	}
+	if opts.MaxErrors <= 0 {
+		opts.MaxErrors = 10
+	}
+
+	next, err := bulkRowReader(r, opts)
+	if err != nil {
+		return 0, fmt.Errorf("bulk insert into %s: %w", table, err)
+	}
+
+	var (
+		inserted int64
+		batch    [][]string
+		width    = len(columns)
+		bad      int
+	)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		query, args := bulkInsertQuery(opts.Dialect, table, columns, batch)
+		res, err := db.ExecContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err == nil {
+			inserted += n
+		} else {
+			inserted += int64(len(batch))
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	for line := 1; ; line++ {
+		fields, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return inserted, fmt.Errorf("bulk insert into %s: row %d: %w", table, line, err)
+		}
+		if line < opts.FirstRow {
+			continue
+		}
+		if opts.LastRow > 0 && line > opts.LastRow {
+			break
+		}
+		if width == 0 {
+			width = len(fields)
+		}
+		if len(fields) != width {
+			bad++
+			if bad > opts.MaxErrors {
+				return inserted, fmt.Errorf("bulk insert into %s: row %d has %d fields, expected %d (more than %d bad rows)",
+					table, line, len(fields), width, opts.MaxErrors)
+			}
+			continue
+		}
+		batch = append(batch, fields)
+		if len(batch) >= bulkBatchRows(opts, width) {
+			if err := flush(); err != nil {
+				return inserted, fmt.Errorf("bulk insert into %s: %w", table, err)
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return inserted, fmt.Errorf("bulk insert into %s: %w", table, err)
+	}
+	return inserted, nil
+}
+
+// bulkBatchRows returns how many rows of width fields fit in one INSERT.
+func bulkBatchRows(opts BulkOptions, width int) int {
+	rows := opts.BatchSize
+	if limit, ok := bulkMaxParams[opts.Dialect]; ok && width > 0 && rows*width > limit {
+		rows = limit / width
+	}
+	if rows < 1 {
+		rows = 1
+	}
+	return rows
+}
+
+// bulkRowReader returns a function yielding the fields of each row.
+func bulkRowReader(r io.Reader, opts BulkOptions) (func() ([]string, error), error) {
+	if opts.CSV {
+		if len([]rune(opts.FieldTerminator)) != 1 {
+			return nil, fmt.Errorf("FORMAT = 'CSV' needs a single-character field terminator, got %q", opts.FieldTerminator)
+		}
+		cr := csv.NewReader(r)
+		cr.Comma = []rune(opts.FieldTerminator)[0]
+		cr.FieldsPerRecord = -1
+		if opts.FieldQuote != '"' {
+			return nil, fmt.Errorf("FIELDQUOTE %q is not supported, only '\"'", opts.FieldQuote)
+		}
+		return cr.Read, nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	scanner.Split(splitOnTerminator([]byte(opts.RowTerminator)))
+	trimCR := opts.RowTerminator == "\n"
+	return func() ([]string, error) {
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return nil, err
+			}
+			return nil, io.EOF
+		}
+		row := scanner.Text()
+		if trimCR {
+			row = strings.TrimSuffix(row, "\r")
+		}
+		return strings.Split(row, opts.FieldTerminator), nil
+	}, nil
+}
+
+// splitOnTerminator is a bufio.SplitFunc splitting on an arbitrary row
+// terminator. A final row without a terminator is returned as is.
+func splitOnTerminator(term []byte) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		if atEOF && len(data) == 0 {
+			return 0, nil, nil
+		}
+		if i := bytes.Index(data, term); i >= 0 {
+			return i + len(term), data[:i], nil
+		}
+		if atEOF {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	}
+}
+
+// bulkInsertQuery builds a multi-row INSERT for rows.
+func bulkInsertQuery(dialect Dialect, table string, columns []string, rows [][]string) (string, []interface{}) {
+	var sb strings.Builder
+	sb.WriteString("INSERT INTO ")
+	sb.WriteString(table)
+	if len(columns) > 0 {
+		sb.WriteString(" (")
+		sb.WriteString(strings.Join(columns, ", "))
+		sb.WriteString(")")
+	}
+	sb.WriteString(" VALUES ")
+	args := make([]interface{}, 0, len(rows)*len(rows[0]))
+	for r, row := range rows {
+		if r > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString("(")
+		for i, field := range row {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			if field == "" {
+				args = append(args, nil)
+			} else {
+				args = append(args, field)
+			}
+			sb.WriteString(bulkPlaceholder(dialect, len(args)))
+		}
+		sb.WriteString(")")
+	}
+	return sb.String(), args
+}
+
+// bulkPlaceholder returns the n'th (1-based) parameter placeholder.
+func bulkPlaceholder(dialect Dialect, n int) string {
+	switch dialect {
+	case DialectMySQL, DialectSQLite:
+		return "?"
+	case DialectSQLServer:
+		return fmt.Sprintf("@p%d", n)
+	default:
+		return fmt.Sprintf("$%d", n)
+	}
+}
+
+// ReadBulkText reads a whole file as text, as OPENROWSET(BULK ...,
+// SINGLE_CLOB) does. With wide set (SINGLE_NCLOB) the file is decoded
+// from UTF-16LE, skipping a byte order mark if there is one.
+func ReadBulkText(path string, wide bool) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if !wide {
+		return string(bytes.TrimPrefix(data, []byte("\xEF\xBB\xBF"))), nil
+	}
+	data = bytes.TrimPrefix(data, []byte("\xFF\xFE"))
+	if len(data)%2 != 0 {
+		return "", fmt.Errorf("%s: odd number of bytes for UTF-16 text", path)
+	}
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = uint16(data[2*i]) | uint16(data[2*i+1])<<8
+	}
+	return string(utf16.Decode(units)), nil
+}
@@ -0,0 +1,98 @@
+package tsqlruntime
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+)
+
+type bulkResult int64
+
+func (r bulkResult) LastInsertId() (int64, error) { return 0, nil }
+func (r bulkResult) RowsAffected() (int64, error) { return int64(r), nil }
+
+type recordingExecer struct {
+	queries []string
+	args    [][]interface{}
+}
+
+func (e *recordingExecer) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	e.queries = append(e.queries, query)
+	e.args = append(e.args, args)
+	return bulkResult(strings.Count(query, "), (") + 1), nil
+}
+
+func TestBulkInsertDelimited(t *testing.T) {
+	data := "ID;Name\r\n1;Alice\r\n2;\r\n3;Carol;extra\r\n4;Dan"
+	db := &recordingExecer{}
+	n, err := BulkInsertFrom(context.Background(), db, "People", nil, strings.NewReader(data), BulkOptions{
+		Dialect:         DialectPostgres,
+		FieldTerminator: ";",
+		FirstRow:        2,
+		BatchSize:       2,
+	})
+	if err != nil {
+		t.Fatalf("BulkInsertFrom failed: %v", err)
+	}
+	if n != 3 {
+		t.Errorf("inserted %d rows, want 3", n)
+	}
+	want := []string{
+		"INSERT INTO People VALUES ($1, $2), ($3, $4)",
+		"INSERT INTO People VALUES ($1, $2)",
+	}
+	if strings.Join(db.queries, "\n") != strings.Join(want, "\n") {
+		t.Errorf("queries:\n%s\nwant:\n%s", strings.Join(db.queries, "\n"), strings.Join(want, "\n"))
+	}
+	// The empty field is NULL and the row with three fields is skipped
+	if db.args[0][3] != nil || db.args[1][1] != "Dan" {
+		t.Errorf("unexpected args %v", db.args)
+	}
+}
+
+func TestBulkInsertCSV(t *testing.T) {
+	data := "1,\"Smith, John\"\n2,\"say \"\"hi\"\"\"\n"
+	db := &recordingExecer{}
+	_, err := BulkInsertFrom(context.Background(), db, "People", []string{"ID", "Name"}, strings.NewReader(data), BulkOptions{
+		Dialect:         DialectSQLServer,
+		FieldTerminator: ",",
+		CSV:             true,
+	})
+	if err != nil {
+		t.Fatalf("BulkInsertFrom failed: %v", err)
+	}
+	if db.queries[0] != "INSERT INTO People (ID, Name) VALUES (@p1, @p2), (@p3, @p4)" {
+		t.Errorf("unexpected query %q", db.queries[0])
+	}
+	if db.args[0][1] != "Smith, John" || db.args[0][3] != `say "hi"` {
+		t.Errorf("unexpected args %v", db.args[0])
+	}
+}
+
+func TestBulkInsertLimits(t *testing.T) {
+	// SQL Server's parameter limit caps the batch below BatchSize
+	if got := bulkBatchRows(BulkOptions{Dialect: DialectSQLServer, BatchSize: 1000}, 10); got != 200 {
+		t.Errorf("bulkBatchRows = %d, want 200", got)
+	}
+
+	data := "1|a\n2\n3\n4|d\n"
+	_, err := BulkInsertFrom(context.Background(), &recordingExecer{}, "T", nil, strings.NewReader(data), BulkOptions{
+		FieldTerminator: "|",
+		MaxErrors:       1,
+	})
+	if err == nil || !strings.Contains(err.Error(), "row 3 has 1 fields, expected 2") {
+		t.Errorf("expected a bad row error, got %v", err)
+	}
+
+	data = "1|a<EOR>2|b<EOR>"
+	db := &recordingExecer{}
+	if _, err := BulkInsertFrom(context.Background(), db, "T", nil, strings.NewReader(data), BulkOptions{
+		Dialect: DialectMySQL, FieldTerminator: "|", RowTerminator: "<EOR>",
+	}); err != nil {
+		t.Fatalf("BulkInsertFrom failed: %v", err)
+	}
+	if db.queries[0] != "INSERT INTO T VALUES (?, ?), (?, ?)" {
+		t.Errorf("unexpected query %q", db.queries[0])
+	}
+}
@@ -416,6 +416,12 @@ func parseDateTimeWithStyle(s string, style int) (time.Time, error) {
 	return time.Time{}, fmt.Errorf("cannot parse datetime: %s", s)
 }
 
+// FormatDateTime formats t as CONVERT(VARCHAR, t, style) does. Style 0
+// is also what CAST(t AS VARCHAR) gives.
+func FormatDateTime(t time.Time, style int) string {
+	return formatDateTimeWithStyle(t, style)
+}
+
 // formatDateTimeWithStyle formats a datetime using SQL Server style codes
 func formatDateTimeWithStyle(t time.Time, style int) string {
 	formats := map[int]string{
@@ -1,6 +1,7 @@
 package tsqlruntime
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"sync"
@@ -170,6 +171,34 @@ func (m *CursorManager) ClearSession() {
 	m.localCursors = make(map[string]*Cursor)
 }
 
+// OpenScrollCursor runs query and returns its rows buffered in an open
+// cursor, which FETCH PRIOR, FIRST, LAST, ABSOLUTE and RELATIVE can move
+// through. Generated code uses it for cursors fetched other than NEXT;
+// all the rows are held in memory until the cursor is unreferenced.
+func OpenScrollCursor(ctx context.Context, db RowsQuerier, name, query string, args ...interface{}) (*Cursor, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns, values, err := scanValues(rows)
+	if err != nil {
+		return nil, err
+	}
+	cursor := &Cursor{
+		Name:        normalizeCursorName(name),
+		Query:       query,
+		CurrentRow:  -1,
+		IsAllocated: true,
+		CursorType:  CursorStatic,
+		ScrollType:  CursorScrollAbsolute,
+	}
+	if err := cursor.Open(columns, values); err != nil {
+		return nil, err
+	}
+	return cursor, nil
+}
+
 // Cursor methods
 
 // Open opens the cursor with result data
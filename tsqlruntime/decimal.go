@@ -0,0 +1,95 @@
+package tsqlruntime
+
+import (
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// String decimals
+//
+// With --decimal-mode=string, DECIMAL, NUMERIC and MONEY values are kept
+// as strings such as "12.50", the form database drivers return them in,
+// and generated code does its arithmetic with the functions below. They
+// are exact; a string that isn't a number, including "", counts as 0.
+
+func parseDecimal(s string) decimal.Decimal {
+	d, err := decimal.NewFromString(strings.TrimSpace(s))
+	if err != nil {
+		return decimal.Zero
+	}
+	return d
+}
+
+// DecimalAdd returns x + y.
+func DecimalAdd(x, y string) string {
+	return parseDecimal(x).Add(parseDecimal(y)).String()
+}
+
+// DecimalSub returns x - y.
+func DecimalSub(x, y string) string {
+	return parseDecimal(x).Sub(parseDecimal(y)).String()
+}
+
+// DecimalMul returns x * y.
+func DecimalMul(x, y string) string {
+	return parseDecimal(x).Mul(parseDecimal(y)).String()
+}
+
+// DecimalDiv returns x / y, or "0" when y is 0.
+func DecimalDiv(x, y string) string {
+	d := parseDecimal(y)
+	if d.IsZero() {
+		return "0"
+	}
+	return parseDecimal(x).Div(d).String()
+}
+
+// DecimalMod returns x % y, or "0" when y is 0.
+func DecimalMod(x, y string) string {
+	d := parseDecimal(y)
+	if d.IsZero() {
+		return "0"
+	}
+	return parseDecimal(x).Mod(d).String()
+}
+
+// DecimalNeg returns -x.
+func DecimalNeg(x string) string {
+	return parseDecimal(x).Neg().String()
+}
+
+// DecimalAbs returns the absolute value of x.
+func DecimalAbs(x string) string {
+	return parseDecimal(x).Abs().String()
+}
+
+// DecimalCeil returns the smallest integer not less than x.
+func DecimalCeil(x string) string {
+	return parseDecimal(x).Ceil().String()
+}
+
+// DecimalFloor returns the largest integer not greater than x.
+func DecimalFloor(x string) string {
+	return parseDecimal(x).Floor().String()
+}
+
+// DecimalRound is Round for string decimals.
+func DecimalRound(x string, length int, function ...int) string {
+	return RoundDecimal(parseDecimal(x), length, function...).String()
+}
+
+// DecimalCmp compares x and y, returning -1, 0 or +1.
+func DecimalCmp(x, y string) int {
+	return parseDecimal(x).Cmp(parseDecimal(y))
+}
+
+// DecimalFloat returns x as a float64.
+func DecimalFloat(x string) float64 {
+	return parseDecimal(x).InexactFloat64()
+}
+
+// DecimalInt returns the integer part of x.
+func DecimalInt(x string) int64 {
+	return parseDecimal(x).IntPart()
+}
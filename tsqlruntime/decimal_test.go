@@ -0,0 +1,34 @@
+package tsqlruntime
+
+import "testing"
+
+func TestStringDecimals(t *testing.T) {
+	tests := []struct {
+		got, want string
+	}{
+		{DecimalAdd("0.1", "0.2"), "0.3"},
+		{DecimalSub("10", "0.01"), "9.99"},
+		{DecimalMul("1.5", "-2"), "-3"},
+		{DecimalDiv("1", "4"), "0.25"},
+		{DecimalDiv("1", "0"), "0"},
+		{DecimalMod("7", "3"), "1"},
+		{DecimalNeg("1.5"), "-1.5"},
+		{DecimalAbs("-2.25"), "2.25"},
+		{DecimalCeil("1.1"), "2"},
+		{DecimalFloor("-1.1"), "-2"},
+		{DecimalRound("1.255", 2), "1.26"},
+		{DecimalRound("1.259", 2, 1), "1.25"},
+		{DecimalAdd("", "1"), "1"},
+	}
+	for i, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%d: got %s, want %s", i, tt.got, tt.want)
+		}
+	}
+	if DecimalCmp("1.50", "1.5") != 0 || DecimalCmp("2", "10") >= 0 {
+		t.Error("DecimalCmp compared wrongly")
+	}
+	if DecimalInt("-3.9") != -3 || DecimalFloat("2.5") != 2.5 {
+		t.Error("DecimalInt/DecimalFloat converted wrongly")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/ha1tch/tsqlparser/ast"
+	"github.com/shopspring/decimal"
 )
 
 // ExpressionEvaluator evaluates T-SQL expressions at runtime
@@ -496,6 +497,26 @@ func (e *ExpressionEvaluator) evaluateLikeExpression(ex *ast.LikeExpression) (Va
 	return NewBit(matches), nil
 }
 
+// Like returns whether v matches a LIKE pattern, or NULL if either is NULL.
+func (v Value) Like(pattern Value) Value {
+	if v.IsNull || pattern.IsNull {
+		return Null(TypeBit)
+	}
+	return NewBit(matchLikePattern(v.AsString(), pattern.AsString()))
+}
+
+// Coalesce returns v, or the first of alt that isn't NULL if v is, as
+// ISNULL and COALESCE do.
+func (v Value) Coalesce(alt ...Value) Value {
+	for _, a := range alt {
+		if !v.IsNull {
+			break
+		}
+		v = a
+	}
+	return v
+}
+
 // matchLikePattern implements SQL LIKE pattern matching
 func matchLikePattern(s, pattern string) bool {
 	// Convert SQL LIKE pattern to a simple matcher
@@ -585,6 +606,12 @@ func ToValue(v interface{}) Value {
 		return NewBinary(val)
 	case time.Time:
 		return NewDateTime(val)
+	case decimal.Decimal:
+		scale := 0
+		if exp := val.Exponent(); exp < 0 {
+			scale = int(-exp)
+		}
+		return NewDecimal(val, 38, scale)
 	default:
 		// Try to convert via string representation
 		return NewVarChar(fmt.Sprintf("%v", v), -1)
@@ -0,0 +1,9 @@
+// Package eventkafkago adapts a segmentio kafka.Writer to
+// tsqlruntime.EventPublisher, for code generated with --table-event.
+//
+// It needs github.com/segmentio/kafka-go, so it is only compiled with the
+// kafkago build tag:
+//
+//	go get github.com/segmentio/kafka-go
+//	go build -tags kafkago ./...
+package eventkafkago
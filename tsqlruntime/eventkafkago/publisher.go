@@ -0,0 +1,21 @@
+//go:build kafkago
+
+package eventkafkago
+
+import (
+	"context"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Publisher publishes events through a kafka.Writer. The Writer must not
+// have its Topic set, since each message carries its own.
+type Publisher struct {
+	Writer *kafka.Writer
+}
+
+// Publish writes the message; with a synchronous Writer it waits for the
+// broker to acknowledge it.
+func (p Publisher) Publish(ctx context.Context, topic string, key, value []byte) error {
+	return p.Writer.WriteMessages(ctx, kafka.Message{Topic: topic, Key: key, Value: value})
+}
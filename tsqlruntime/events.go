@@ -0,0 +1,73 @@
+package tsqlruntime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// EventPublisher sends a message to a topic. Generated code calls it in
+// place of INSERTs into outbox/queue tables mapped with --table-event.
+//
+// Adapters for the common Kafka clients are in the eventsarama and
+// eventkafkago packages, so the runtime itself depends on neither.
+type EventPublisher interface {
+	Publish(ctx context.Context, topic string, key, value []byte) error
+}
+
+// PublishEvent publishes the columns of an inserted row to topic as a JSON
+// object. key partitions the topic; nil publishes without a key.
+func PublishEvent(ctx context.Context, p EventPublisher, topic string, key any, row map[string]any) error {
+	if p == nil {
+		return fmt.Errorf("publish to %s: no event publisher configured", topic)
+	}
+	value, err := json.Marshal(row)
+	if err != nil {
+		return fmt.Errorf("publish to %s: %w", topic, err)
+	}
+	var k []byte
+	if key != nil {
+		k = []byte(fmt.Sprint(key))
+	}
+	if err := p.Publish(ctx, topic, k, value); err != nil {
+		return fmt.Errorf("publish to %s: %w", topic, err)
+	}
+	return nil
+}
+
+// Event is a message recorded by MemoryPublisher.
+type Event struct {
+	Topic string
+	Key   []byte
+	Value []byte
+}
+
+// MemoryPublisher is an EventPublisher that keeps messages in memory, for
+// tests and local runs without a broker.
+type MemoryPublisher struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+// Publish records the message.
+func (m *MemoryPublisher) Publish(ctx context.Context, topic string, key, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, Event{Topic: topic, Key: key, Value: value})
+	return nil
+}
+
+// Events returns the messages published so far, optionally only those for
+// one topic.
+func (m *MemoryPublisher) Events(topic string) []Event {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []Event
+	for _, e := range m.events {
+		if topic == "" || e.Topic == topic {
+			out = append(out, e)
+		}
+	}
+	return out
+}
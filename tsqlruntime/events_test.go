@@ -0,0 +1,32 @@
+package tsqlruntime
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPublishEvent(t *testing.T) {
+	pub := &MemoryPublisher{}
+	ctx := context.Background()
+	if err := PublishEvent(ctx, pub, "orders", int32(42), map[string]any{"EventType": "Created", "OrderID": int32(42)}); err != nil {
+		t.Fatalf("PublishEvent failed: %v", err)
+	}
+	if err := PublishEvent(ctx, pub, "audit", nil, map[string]any{"Note": nil}); err != nil {
+		t.Fatalf("PublishEvent failed: %v", err)
+	}
+
+	events := pub.Events("orders")
+	if len(events) != 1 {
+		t.Fatalf("expected 1 orders event, got %d", len(events))
+	}
+	if string(events[0].Key) != "42" || string(events[0].Value) != `{"EventType":"Created","OrderID":42}` {
+		t.Errorf("unexpected event %q %q", events[0].Key, events[0].Value)
+	}
+	if audit := pub.Events("audit"); len(audit) != 1 || audit[0].Key != nil || string(audit[0].Value) != `{"Note":null}` {
+		t.Errorf("unexpected audit events %v", audit)
+	}
+
+	if err := PublishEvent(ctx, nil, "orders", nil, nil); err == nil {
+		t.Error("expected an error without a publisher")
+	}
+}
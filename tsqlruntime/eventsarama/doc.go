@@ -0,0 +1,9 @@
+// Package eventsarama adapts a sarama.SyncProducer to
+// tsqlruntime.EventPublisher, for code generated with --table-event.
+//
+// It needs github.com/IBM/sarama, so it is only compiled with the sarama
+// build tag:
+//
+//	go get github.com/IBM/sarama
+//	go build -tags sarama ./...
+package eventsarama
@@ -0,0 +1,24 @@
+//go:build sarama
+
+package eventsarama
+
+import (
+	"context"
+
+	"github.com/IBM/sarama"
+)
+
+// Publisher publishes events through a sarama.SyncProducer.
+type Publisher struct {
+	Producer sarama.SyncProducer
+}
+
+// Publish sends the message and waits for the broker to acknowledge it.
+func (p Publisher) Publish(ctx context.Context, topic string, key, value []byte) error {
+	msg := &sarama.ProducerMessage{Topic: topic, Value: sarama.ByteEncoder(value)}
+	if key != nil {
+		msg.Key = sarama.ByteEncoder(key)
+	}
+	_, _, err := p.Producer.SendMessage(msg)
+	return err
+}
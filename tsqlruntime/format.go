@@ -0,0 +1,263 @@
+package tsqlruntime
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FORMAT
+//
+// T-SQL FORMAT takes .NET format strings. FormatDate and FormatNumber
+// support the standard formats ('d', 'N2', 'C' and so on) and custom ones
+// ('yyyy-MM-dd', '#,##0.00') in the invariant English culture; the
+// culture argument isn't supported.
+
+// dateStandardFormats are the .NET standard date and time formats.
+var dateStandardFormats = map[string]string{
+	"d": "1/2/2006",
+	"D": "Monday, January 2, 2006",
+	"f": "Monday, January 2, 2006 3:04 PM",
+	"F": "Monday, January 2, 2006 3:04:05 PM",
+	"g": "1/2/2006 3:04 PM",
+	"G": "1/2/2006 3:04:05 PM",
+	"m": "January 2",
+	"M": "January 2",
+	"o": "2006-01-02T15:04:05.0000000-07:00",
+	"O": "2006-01-02T15:04:05.0000000-07:00",
+	"s": "2006-01-02T15:04:05",
+	"t": "3:04 PM",
+	"T": "3:04:05 PM",
+	"u": "2006-01-02 15:04:05Z",
+	"y": "January 2006",
+	"Y": "January 2006",
+}
+
+// DotNetLayout returns the Go time layout for a .NET date and time format
+// string, such as "2006-01-02" for "yyyy-MM-dd".
+func DotNetLayout(format string) string {
+	if layout, ok := dateStandardFormats[format]; ok {
+		return layout
+	}
+	layout, _ := ConvertDotNetFormat(format, func(c byte, n int) (string, bool) {
+		return dotNetToken(c, n), true
+	}, func(text string) string { return text })
+	return layout
+}
+
+// ConvertDotNetFormat converts a .NET custom date and time format string
+// to another notation, such as a SQL dialect's. token converts n repeats of
+// a format character such as 'y' or 'M', and literal converts quoted and
+// other literal text. It fails if token does.
+func ConvertDotNetFormat(format string, token func(c byte, n int) (string, bool), literal func(text string) string) (string, bool) {
+	var b strings.Builder
+	for i := 0; i < len(format); {
+		c := format[i]
+		switch c {
+		case '\'', '"':
+			// Quoted literal text
+			end := strings.IndexByte(format[i+1:], c)
+			if end < 0 {
+				end = len(format) - i - 1
+			}
+			b.WriteString(literal(format[i+1 : i+1+end]))
+			i += end + 2
+			continue
+		case '\\':
+			if i+1 < len(format) {
+				b.WriteString(literal(format[i+1 : i+2]))
+			}
+			i += 2
+			continue
+		}
+		if !strings.ContainsRune("yMdHhmsfFtzK", rune(c)) {
+			b.WriteString(literal(format[i : i+1]))
+			i++
+			continue
+		}
+		n := 1
+		for i+n < len(format) && format[i+n] == c {
+			n++
+		}
+		s, ok := token(c, n)
+		if !ok {
+			return "", false
+		}
+		b.WriteString(s)
+		i += n
+	}
+	return b.String(), true
+}
+
+// dotNetToken returns the Go layout for n repeats of the .NET format
+// character c.
+func dotNetToken(c byte, n int) string {
+	pick := func(layouts ...string) string {
+		if n > len(layouts) {
+			n = len(layouts)
+		}
+		return layouts[n-1]
+	}
+	switch c {
+	case 'y':
+		return pick("06", "06", "2006")
+	case 'M':
+		return pick("1", "01", "Jan", "January")
+	case 'd':
+		return pick("2", "02", "Mon", "Monday")
+	case 'H':
+		return "15"
+	case 'h':
+		return pick("3", "03")
+	case 'm':
+		return pick("4", "04")
+	case 's':
+		return pick("5", "05")
+	case 'f':
+		return strings.Repeat("0", n)
+	case 'F':
+		return strings.Repeat("9", n)
+	case 't':
+		return "PM"
+	case 'z':
+		return pick("-07", "-07", "-07:00")
+	}
+	return "Z07:00"
+}
+
+// FormatDate is FORMAT for dates and times.
+func FormatDate(date time.Time, format string) string {
+	return date.Format(DotNetLayout(format))
+}
+
+// FormatNumber is FORMAT for numbers.
+func FormatNumber(v float64, format string) string {
+	if len(format) > 0 && strings.ContainsRune("CcDdEeFfGgNnPpXx", rune(format[0])) {
+		if precision, err := strconv.Atoi(format[1:]); err == nil || len(format) == 1 {
+			if len(format) == 1 {
+				precision = -1
+			}
+			return formatStandardNumber(v, format[0], precision)
+		}
+	}
+	return formatCustomNumber(v, format)
+}
+
+// formatStandardNumber formats v with a .NET standard numeric format, with
+// precision -1 for the default.
+func formatStandardNumber(v float64, spec byte, precision int) string {
+	orDefault := func(d int) int {
+		if precision < 0 {
+			return d
+		}
+		return precision
+	}
+	switch spec {
+	case 'C', 'c':
+		s := groupThousands(strconv.FormatFloat(math.Abs(v), 'f', orDefault(2), 64))
+		if v < 0 {
+			return "-$" + s
+		}
+		return "$" + s
+	case 'D', 'd':
+		s := strconv.FormatInt(int64(math.Abs(v)), 10)
+		if len(s) < precision {
+			s = strings.Repeat("0", precision-len(s)) + s
+		}
+		if v < 0 {
+			return "-" + s
+		}
+		return s
+	case 'E', 'e':
+		s := strconv.FormatFloat(v, 'e', orDefault(6), 64)
+		if spec == 'E' {
+			s = strings.ToUpper(s)
+		}
+		return s
+	case 'F', 'f':
+		return strconv.FormatFloat(v, 'f', orDefault(2), 64)
+	case 'N', 'n':
+		return groupThousands(strconv.FormatFloat(v, 'f', orDefault(2), 64))
+	case 'P', 'p':
+		return groupThousands(strconv.FormatFloat(v*100, 'f', orDefault(2), 64)) + "%"
+	case 'X', 'x':
+		s := strconv.FormatInt(int64(v), 16)
+		if len(s) < precision {
+			s = strings.Repeat("0", precision-len(s)) + s
+		}
+		if spec == 'X' {
+			s = strings.ToUpper(s)
+		}
+		return s
+	}
+	return strconv.FormatFloat(v, 'g', precision, 64)
+}
+
+// formatCustomNumber formats v with a .NET custom numeric format such as
+// "#,##0.00" or "0.0%". Text before and after the digit placeholders is
+// kept as it is.
+func formatCustomNumber(v float64, format string) string {
+	start := strings.IndexAny(format, "0#")
+	if start < 0 {
+		return format
+	}
+	end := strings.LastIndexAny(format, "0#") + 1
+	prefix, pattern, suffix := format[:start], format[start:end], format[end:]
+	if strings.Contains(prefix+suffix, "%") {
+		v *= 100
+	}
+
+	intPart, fracPart, _ := strings.Cut(pattern, ".")
+	decimals := len(fracPart)
+	s := strconv.FormatFloat(math.Abs(v), 'f', decimals, 64)
+	if minFrac := strings.Count(fracPart, "0"); decimals > minFrac && strings.Contains(s, ".") {
+		// Optional # decimals drop trailing zeros
+		whole, frac, _ := strings.Cut(s, ".")
+		frac = strings.TrimRight(frac, "0")
+		for len(frac) < minFrac {
+			frac += "0"
+		}
+		s = whole
+		if frac != "" {
+			s += "." + frac
+		}
+	}
+	whole, frac, hasFrac := strings.Cut(s, ".")
+	if minInt := strings.Count(intPart, "0"); len(whole) < minInt {
+		whole = strings.Repeat("0", minInt-len(whole)) + whole
+	} else if minInt == 0 && whole == "0" {
+		whole = ""
+	}
+	if strings.Contains(intPart, ",") {
+		whole = groupThousands(whole)
+	}
+	s = whole
+	if hasFrac {
+		s += "." + frac
+	}
+	if v < 0 {
+		s = "-" + s
+	}
+	return prefix + s + suffix
+}
+
+// groupThousands inserts thousands separators into a formatted number.
+func groupThousands(s string) string {
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	whole, frac, hasFrac := strings.Cut(s, ".")
+	var b strings.Builder
+	for i, r := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(r)
+	}
+	if hasFrac {
+		return sign + b.String() + "." + frac
+	}
+	return sign + b.String()
+}
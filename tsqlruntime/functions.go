@@ -7,7 +7,7 @@ import (
 	"time"
 	"unicode/utf8"
 
-	"github.com/shopspring/decimal"
+	"github.com/ha1tch/tgpiler/tsqlruntime/strfn"
 )
 
 // Function is a T-SQL function implementation
@@ -75,6 +75,7 @@ func (r *FunctionRegistry) registerBuiltins() {
 	r.Register("NCHAR", fnNChar)
 	r.Register("QUOTENAME", fnQuoteName)
 	r.Register("FORMAT", fnFormat)
+	r.Register("FORMATMESSAGE", fnFormatMessage)
 
 	// NULL handling functions
 	r.Register("ISNULL", fnIsNull)
@@ -355,24 +356,13 @@ func fnCharIndex(args []Value) (Value, error) {
 }
 
 func fnPatIndex(args []Value) (Value, error) {
-	// Simplified PATINDEX - only handles basic patterns
 	if len(args) != 2 {
 		return Value{}, fmt.Errorf("PATINDEX requires 2 arguments")
 	}
 	if args[0].IsNull || args[1].IsNull {
 		return Null(TypeInt), nil
 	}
-
-	pattern := args[0].AsString()
-	str := args[1].AsString()
-
-	// Remove % from pattern for simple matching
-	pattern = strings.Trim(pattern, "%")
-	idx := strings.Index(str, pattern)
-	if idx < 0 {
-		return NewInt(0), nil
-	}
-	return NewInt(int64(idx + 1)), nil // 1-based
+	return NewInt(int64(strfn.PatIndex(args[0].AsString(), args[1].AsString()))), nil
 }
 
 func fnConcat(args []Value) (Value, error) {
@@ -585,7 +575,6 @@ func fnQuoteName(args []Value) (Value, error) {
 }
 
 func fnFormat(args []Value) (Value, error) {
-	// Simplified FORMAT - basic support
 	if len(args) < 2 {
 		return Value{}, fmt.Errorf("FORMAT requires at least 2 arguments")
 	}
@@ -594,51 +583,31 @@ func fnFormat(args []Value) (Value, error) {
 	}
 
 	format := args[1].AsString()
-
-	// Handle datetime formatting
 	if args[0].Type.IsDateTime() {
-		t := args[0].AsTime()
-		// Convert .NET-style format to Go format
-		goFormat := convertDotNetToGoFormat(format)
-		return NewVarChar(t.Format(goFormat), -1), nil
+		return NewVarChar(FormatDate(args[0].AsTime(), format), -1), nil
+	}
+	if args[0].Type.IsNumeric() {
+		return NewVarChar(FormatNumber(args[0].AsFloat(), format), -1), nil
 	}
-
-	// Handle numeric formatting - simplified
 	return NewVarChar(args[0].AsString(), -1), nil
 }
 
-func convertDotNetToGoFormat(format string) string {
-	replacements := map[string]string{
-		"yyyy": "2006",
-		"yy":   "06",
-		"MMMM": "January",
-		"MMM":  "Jan",
-		"MM":   "01",
-		"M":    "1",
-		"dddd": "Monday",
-		"ddd":  "Mon",
-		"dd":   "02",
-		"d":    "2",
-		"HH":   "15",
-		"hh":   "03",
-		"h":    "3",
-		"mm":   "04",
-		"ss":   "05",
-		"tt":   "PM",
-		"fff":  "000",
-		"ff":   "00",
-		"f":    "0",
-	}
-
-	result := format
-	for dotNet, golang := range replacements {
-		result = strings.ReplaceAll(result, dotNet, golang)
-	}
-	return result
-}
-
 // ============ NULL handling functions ============
 
+func fnFormatMessage(args []Value) (Value, error) {
+	if len(args) < 1 {
+		return Value{}, fmt.Errorf("FORMATMESSAGE requires at least 1 argument")
+	}
+	if args[0].IsNull {
+		return Null(TypeNVarChar), nil
+	}
+	var values []interface{}
+	for _, arg := range args[1:] {
+		values = append(values, FromValue(arg))
+	}
+	return NewNVarChar(strfn.FormatMessage(args[0].AsString(), values...), -1), nil
+}
+
 func fnIsNull(args []Value) (Value, error) {
 	if len(args) != 2 {
 		return Value{}, fmt.Errorf("ISNULL requires 2 arguments")
@@ -728,36 +697,11 @@ func fnDateAdd(args []Value) (Value, error) {
 		return Null(TypeDateTime), nil
 	}
 
-	interval := strings.ToLower(args[0].AsString())
-	number := int(args[1].AsInt())
-	date := args[2].AsTime()
-
-	switch interval {
-	case "year", "yy", "yyyy":
-		return NewDateTime(date.AddDate(number, 0, 0)), nil
-	case "quarter", "qq", "q":
-		return NewDateTime(date.AddDate(0, number*3, 0)), nil
-	case "month", "mm", "m":
-		return NewDateTime(date.AddDate(0, number, 0)), nil
-	case "dayofyear", "dy", "y", "day", "dd", "d":
-		return NewDateTime(date.AddDate(0, 0, number)), nil
-	case "week", "wk", "ww":
-		return NewDateTime(date.AddDate(0, 0, number*7)), nil
-	case "hour", "hh":
-		return NewDateTime(date.Add(time.Duration(number) * time.Hour)), nil
-	case "minute", "mi", "n":
-		return NewDateTime(date.Add(time.Duration(number) * time.Minute)), nil
-	case "second", "ss", "s":
-		return NewDateTime(date.Add(time.Duration(number) * time.Second)), nil
-	case "millisecond", "ms":
-		return NewDateTime(date.Add(time.Duration(number) * time.Millisecond)), nil
-	case "microsecond", "mcs":
-		return NewDateTime(date.Add(time.Duration(number) * time.Microsecond)), nil
-	case "nanosecond", "ns":
-		return NewDateTime(date.Add(time.Duration(number) * time.Nanosecond)), nil
-	default:
+	interval := args[0].AsString()
+	if _, ok := DatePartName(interval); !ok {
 		return Value{}, fmt.Errorf("unknown datepart: %s", interval)
 	}
+	return NewDateTime(DateAdd(interval, int(args[1].AsInt()), args[2].AsTime())), nil
 }
 
 func fnDateDiff(args []Value) (Value, error) {
@@ -768,40 +712,11 @@ func fnDateDiff(args []Value) (Value, error) {
 		return Null(TypeInt), nil
 	}
 
-	interval := strings.ToLower(args[0].AsString())
-	startDate := args[1].AsTime()
-	endDate := args[2].AsTime()
-
-	diff := endDate.Sub(startDate)
-
-	switch interval {
-	case "year", "yy", "yyyy":
-		return NewInt(int64(endDate.Year() - startDate.Year())), nil
-	case "quarter", "qq", "q":
-		startQ := (startDate.Year()*12 + int(startDate.Month()) - 1) / 3
-		endQ := (endDate.Year()*12 + int(endDate.Month()) - 1) / 3
-		return NewInt(int64(endQ - startQ)), nil
-	case "month", "mm", "m":
-		return NewInt(int64((endDate.Year()-startDate.Year())*12 + int(endDate.Month()-startDate.Month()))), nil
-	case "dayofyear", "dy", "y", "day", "dd", "d":
-		return NewInt(int64(diff.Hours() / 24)), nil
-	case "week", "wk", "ww":
-		return NewInt(int64(diff.Hours() / 24 / 7)), nil
-	case "hour", "hh":
-		return NewInt(int64(diff.Hours())), nil
-	case "minute", "mi", "n":
-		return NewInt(int64(diff.Minutes())), nil
-	case "second", "ss", "s":
-		return NewInt(int64(diff.Seconds())), nil
-	case "millisecond", "ms":
-		return NewInt(diff.Milliseconds()), nil
-	case "microsecond", "mcs":
-		return NewInt(diff.Microseconds()), nil
-	case "nanosecond", "ns":
-		return NewInt(diff.Nanoseconds()), nil
-	default:
-		return Value{}, fmt.Errorf("unknown datepart: %s", interval)
+	n, err := DateDiffBig(args[0].AsString(), args[1].AsTime(), args[2].AsTime())
+	if err != nil {
+		return Value{}, err
 	}
+	return NewInt(n), nil
 }
 
 func fnDateDiffBig(args []Value) (Value, error) {
@@ -816,40 +731,11 @@ func fnDatePart(args []Value) (Value, error) {
 		return Null(TypeInt), nil
 	}
 
-	interval := strings.ToLower(args[0].AsString())
-	date := args[1].AsTime()
-
-	switch interval {
-	case "year", "yy", "yyyy":
-		return NewInt(int64(date.Year())), nil
-	case "quarter", "qq", "q":
-		return NewInt(int64((date.Month()-1)/3 + 1)), nil
-	case "month", "mm", "m":
-		return NewInt(int64(date.Month())), nil
-	case "dayofyear", "dy", "y":
-		return NewInt(int64(date.YearDay())), nil
-	case "day", "dd", "d":
-		return NewInt(int64(date.Day())), nil
-	case "week", "wk", "ww":
-		_, week := date.ISOWeek()
-		return NewInt(int64(week)), nil
-	case "weekday", "dw":
-		return NewInt(int64(date.Weekday()) + 1), nil // SQL Server is 1-based
-	case "hour", "hh":
-		return NewInt(int64(date.Hour())), nil
-	case "minute", "mi", "n":
-		return NewInt(int64(date.Minute())), nil
-	case "second", "ss", "s":
-		return NewInt(int64(date.Second())), nil
-	case "millisecond", "ms":
-		return NewInt(int64(date.Nanosecond() / 1000000)), nil
-	case "microsecond", "mcs":
-		return NewInt(int64(date.Nanosecond() / 1000)), nil
-	case "nanosecond", "ns":
-		return NewInt(int64(date.Nanosecond())), nil
-	default:
+	interval := args[0].AsString()
+	if _, ok := DatePartName(interval); !ok {
 		return Value{}, fmt.Errorf("unknown datepart: %s", interval)
 	}
+	return NewInt(int64(DatePart(interval, args[1].AsTime()))), nil
 }
 
 func fnDateName(args []Value) (Value, error) {
@@ -860,24 +746,11 @@ func fnDateName(args []Value) (Value, error) {
 		return Null(TypeVarChar), nil
 	}
 
-	interval := strings.ToLower(args[0].AsString())
-	date := args[1].AsTime()
-
-	switch interval {
-	case "year", "yy", "yyyy":
-		return NewVarChar(fmt.Sprintf("%d", date.Year()), -1), nil
-	case "month", "mm", "m":
-		return NewVarChar(date.Month().String(), -1), nil
-	case "weekday", "dw":
-		return NewVarChar(date.Weekday().String(), -1), nil
-	default:
-		// For other parts, return numeric value as string
-		result, err := fnDatePart(args)
-		if err != nil {
-			return Value{}, err
-		}
-		return NewVarChar(result.AsString(), -1), nil
+	interval := args[0].AsString()
+	if _, ok := DatePartName(interval); !ok {
+		return Value{}, fmt.Errorf("unknown datepart: %s", interval)
 	}
+	return NewVarChar(DateName(interval, args[1].AsTime()), -1), nil
 }
 
 func fnDay(args []Value) (Value, error) {
@@ -924,12 +797,7 @@ func fnEOMonth(args []Value) (Value, error) {
 		monthsToAdd = int(args[1].AsInt())
 	}
 
-	// Move to next month, then subtract a day
-	date = date.AddDate(0, monthsToAdd+1, 0)
-	date = time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, date.Location())
-	date = date.AddDate(0, 0, -1)
-
-	return NewDate(date), nil
+	return NewDate(EOMonth(date, monthsToAdd)), nil
 }
 
 func fnDateFromParts(args []Value) (Value, error) {
@@ -944,7 +812,7 @@ func fnDateFromParts(args []Value) (Value, error) {
 	month := int(args[1].AsInt())
 	day := int(args[2].AsInt())
 
-	return NewDate(time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)), nil
+	return NewDate(DateFromParts(year, month, day)), nil
 }
 
 func fnIsDate(args []Value) (Value, error) {
@@ -1039,24 +907,16 @@ func fnRound(args []Value) (Value, error) {
 		truncate = true
 	}
 
+	function := 0
+	if truncate {
+		function = 1
+	}
+
 	switch args[0].Type {
 	case TypeDecimal, TypeNumeric, TypeMoney, TypeSmallMoney:
-		d := args[0].decimalVal
-		if truncate {
-			d = d.Truncate(int32(decimals))
-		} else {
-			d = d.Round(int32(decimals))
-		}
-		return NewDecimal(d, args[0].Precision, decimals), nil
+		return NewDecimal(RoundDecimal(args[0].decimalVal, decimals, function), args[0].Precision, decimals), nil
 	default:
-		f := args[0].AsFloat()
-		scale := math.Pow(10, float64(decimals))
-		if truncate {
-			f = math.Trunc(f*scale) / scale
-		} else {
-			f = math.Round(f*scale) / scale
-		}
-		return NewFloat(f), nil
+		return NewFloat(Round(args[0].AsFloat(), decimals, function)), nil
 	}
 }
 
@@ -1183,13 +1043,7 @@ func fnIsNumeric(args []Value) (Value, error) {
 	if args[0].Type.IsNumeric() {
 		return NewInt(1), nil
 	}
-	// Try to parse string
-	s := strings.TrimSpace(args[0].AsString())
-	_, err := decimal.NewFromString(s)
-	if err == nil {
-		return NewInt(1), nil
-	}
-	return NewInt(0), nil
+	return NewInt(int64(IsNumeric(args[0].AsString()))), nil
 }
 
 // ============ System functions ============
@@ -1708,8 +1562,9 @@ func fnSwitchOffset(args []Value) (Value, error) {
 	if args[0].IsNull {
 		return Null(TypeDateTimeOffset), nil
 	}
-	// Simplified - just return the input
-	return args[0], nil
+	v := NewDateTime(SwitchOffset(args[0].AsTime(), offsetArg(args[1])))
+	v.Type = TypeDateTimeOffset
+	return v, nil
 }
 
 func fnToDateTimeOffset(args []Value) (Value, error) {
@@ -1719,8 +1574,16 @@ func fnToDateTimeOffset(args []Value) (Value, error) {
 	if args[0].IsNull {
 		return Null(TypeDateTimeOffset), nil
 	}
-	// Simplified - just return the input as DateTimeOffset
-	v := args[0]
+	v := NewDateTime(ToDateTimeOffset(args[0].AsTime(), offsetArg(args[1])))
 	v.Type = TypeDateTimeOffset
 	return v, nil
 }
+
+// offsetArg returns a time zone offset argument, a string such as "-08:00"
+// or a number of minutes.
+func offsetArg(v Value) any {
+	if v.Type.IsString() {
+		return v.AsString()
+	}
+	return v.AsInt()
+}
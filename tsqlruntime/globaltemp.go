@@ -0,0 +1,132 @@
+package tsqlruntime
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GlobalTempTables holds the global temp tables (##name) of a process.
+// SQL Server shares a ##table between every session, so TempTableManagers
+// created with NewTempTableManager share GlobalTables: a procedure that
+// creates ##Staging and another that reads it see the same rows, as they
+// did in the database.
+//
+// SQL Server drops a ##table when the session that created it ends and no
+// other session is using it. A Go process has no such sessions, so tables
+// live until they are dropped, or as the lifetime fields say.
+type GlobalTempTables struct {
+	// IdleTimeout drops a table that hasn't been created, read or written
+	// for that long, checked whenever the tables are used. Zero keeps
+	// tables until they are dropped.
+	IdleTimeout time.Duration
+
+	// DropWithSession drops a table when the TempTableManager that created
+	// it is cleared with ClearSession, as when its session ends.
+	DropWithSession bool
+
+	mu     sync.Mutex
+	tables map[string]*globalTempTable
+	now    func() time.Time // For tests
+}
+
+type globalTempTable struct {
+	table    *TempTable
+	creator  *TempTableManager
+	lastUsed time.Time
+}
+
+// GlobalTables is the process's registry of global temp tables, shared by
+// the TempTableManagers NewTempTableManager creates. Set its lifetime
+// fields before the first procedure runs.
+var GlobalTables = NewGlobalTempTables()
+
+// NewGlobalTempTables returns an empty registry of global temp tables,
+// whose tables live until they are dropped.
+func NewGlobalTempTables() *GlobalTempTables {
+	return &GlobalTempTables{tables: make(map[string]*globalTempTable), now: time.Now}
+}
+
+// create adds a table created by creator, which must be lower-cased.
+func (g *GlobalTempTables) create(name string, table *TempTable, creator *TempTableManager) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.expire()
+	if _, exists := g.tables[name]; exists {
+		return fmt.Errorf("temp table %s already exists", name)
+	}
+	g.tables[name] = &globalTempTable{table: table, creator: creator, lastUsed: g.now()}
+	return nil
+}
+
+// get returns the table called name, which must be lower-cased.
+func (g *GlobalTempTables) get(name string) (*TempTable, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.expire()
+	entry, ok := g.tables[name]
+	if !ok {
+		return nil, false
+	}
+	entry.lastUsed = g.now()
+	return entry.table, true
+}
+
+// drop removes the table called name, which must be lower-cased.
+func (g *GlobalTempTables) drop(name string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, exists := g.tables[name]; !exists {
+		return fmt.Errorf("temp table %s does not exist", name)
+	}
+	delete(g.tables, name)
+	return nil
+}
+
+// endSession drops the tables creator made, if DropWithSession is set.
+func (g *GlobalTempTables) endSession(creator *TempTableManager) {
+	if !g.DropWithSession {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for name, entry := range g.tables {
+		if entry.creator == creator {
+			delete(g.tables, name)
+		}
+	}
+}
+
+// expire drops the tables idle for longer than IdleTimeout.
+func (g *GlobalTempTables) expire() {
+	if g.IdleTimeout <= 0 {
+		return
+	}
+	cutoff := g.now().Add(-g.IdleTimeout)
+	for name, entry := range g.tables {
+		if entry.lastUsed.Before(cutoff) {
+			delete(g.tables, name)
+		}
+	}
+}
+
+// Names returns the names of the global temp tables, lower-cased and
+// sorted, for finding the ones a process leaves behind.
+func (g *GlobalTempTables) Names() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.expire()
+	names := make([]string, 0, len(g.tables))
+	for name := range g.tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// isGlobalTempTable reports whether name is that of a global temp table.
+func isGlobalTempTable(name string) bool {
+	return strings.HasPrefix(name, "##")
+}
@@ -0,0 +1,172 @@
+package tsqlruntime
+
+import (
+	"strconv"
+	"strings"
+)
+
+// HierarchyID values
+//
+// HIERARCHYID values are materialized paths in generated code, the strings
+// hierarchyid's ToString() gives: "/" for the root and "/1/3/" for the
+// third child of its first child. A position between two siblings has
+// dotted components, so "/1.1/" sorts after "/1/" and before "/2/". Kept
+// in a text column, a node's descendants are the rows whose path starts
+// with its own. Paths don't sort as text the way hierarchyid values do
+// ("/10/" sorts before "/2/"), so ordering by them needs HierarchyCompare.
+// Where SQL Server returns NULL or raises an error, these return "".
+
+// HierarchyGetLevel returns the depth of node, 0 for the root.
+func HierarchyGetLevel(node string) int16 {
+	return int16(len(hierarchyLevels(node)))
+}
+
+// HierarchyGetAncestor returns the ancestor n levels above node, or "" if
+// node isn't that deep.
+func HierarchyGetAncestor(node string, n int) string {
+	levels := hierarchyLevels(node)
+	if n < 0 || n > len(levels) {
+		return ""
+	}
+	return hierarchyPath(levels[:len(levels)-n])
+}
+
+// HierarchyIsDescendantOf reports whether node is parent or below it.
+func HierarchyIsDescendantOf(node, parent string) bool {
+	if node == "" || parent == "" {
+		return false
+	}
+	return strings.HasPrefix(hierarchyPath(hierarchyLevels(node)), hierarchyPath(hierarchyLevels(parent)))
+}
+
+// HierarchyGetDescendant returns a child of parent after child1 and before
+// child2, either of which may be "", as GetDescendant does.
+func HierarchyGetDescendant(parent, child1, child2 string) string {
+	base := hierarchyLevels(parent)
+	childLevel := func(child string) ([]int, bool) {
+		levels := hierarchyLevels(child)
+		if len(levels) != len(base)+1 || hierarchyPath(levels[:len(base)]) != hierarchyPath(base) {
+			return nil, false
+		}
+		return parseHierarchyLevel(levels[len(base)])
+	}
+	var c1, c2 []int
+	var ok bool
+	if child1 != "" {
+		if c1, ok = childLevel(child1); !ok {
+			return ""
+		}
+	}
+	if child2 != "" {
+		if c2, ok = childLevel(child2); !ok {
+			return ""
+		}
+	}
+
+	var level []int
+	switch {
+	case c1 == nil && c2 == nil:
+		level = []int{1}
+	case c2 == nil:
+		level = []int{c1[0] + 1}
+	case c1 == nil:
+		level = []int{c2[0] - 1}
+	default:
+		if compareHierarchyLevels(c1, c2) >= 0 {
+			return ""
+		}
+		// The next value after child1 at its own depth, or one below it
+		level = append([]int(nil), c1...)
+		level[len(level)-1]++
+		if compareHierarchyLevels(level, c2) >= 0 {
+			level = append(append([]int(nil), c1...), 1)
+		}
+	}
+	return hierarchyPath(append(base, formatHierarchyLevel(level)))
+}
+
+// HierarchyGetReparentedValue moves node from below oldRoot to below
+// newRoot, keeping its path under oldRoot.
+func HierarchyGetReparentedValue(node, oldRoot, newRoot string) string {
+	levels, old := hierarchyLevels(node), hierarchyLevels(oldRoot)
+	if !HierarchyIsDescendantOf(node, oldRoot) {
+		return ""
+	}
+	return hierarchyPath(append(hierarchyLevels(newRoot), levels[len(old):]...))
+}
+
+// HierarchyCompare orders a and b as hierarchyid values sort, depth first
+// with parents before their children, returning -1, 0 or 1.
+func HierarchyCompare(a, b string) int {
+	la, lb := hierarchyLevels(a), hierarchyLevels(b)
+	for i := 0; i < len(la) && i < len(lb); i++ {
+		ca, _ := parseHierarchyLevel(la[i])
+		cb, _ := parseHierarchyLevel(lb[i])
+		if c := compareHierarchyLevels(ca, cb); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(la) < len(lb):
+		return -1
+	case len(la) > len(lb):
+		return 1
+	}
+	return 0
+}
+
+// hierarchyLevels splits a path into its levels, "/1/2.1/" into "1" and "2.1".
+func hierarchyLevels(node string) []string {
+	node = strings.Trim(strings.TrimSpace(node), "/")
+	if node == "" {
+		return nil
+	}
+	return strings.Split(node, "/")
+}
+
+func hierarchyPath(levels []string) string {
+	if len(levels) == 0 {
+		return "/"
+	}
+	return "/" + strings.Join(levels, "/") + "/"
+}
+
+// parseHierarchyLevel parses a level such as "2.1" into its numbers.
+func parseHierarchyLevel(level string) ([]int, bool) {
+	var nums []int
+	for _, part := range strings.Split(level, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, false
+		}
+		nums = append(nums, n)
+	}
+	return nums, true
+}
+
+func formatHierarchyLevel(nums []int) string {
+	parts := make([]string, len(nums))
+	for i, n := range nums {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, ".")
+}
+
+// compareHierarchyLevels orders levels, "1" < "1.1" < "2".
+func compareHierarchyLevels(a, b []int) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		switch {
+		case a[i] < b[i]:
+			return -1
+		case a[i] > b[i]:
+			return 1
+		}
+	}
+	switch {
+	case len(a) < len(b):
+		return -1
+	case len(a) > len(b):
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,64 @@
+package tsqlruntime
+
+import "testing"
+
+func TestHierarchyID(t *testing.T) {
+	if got := HierarchyGetLevel("/"); got != 0 {
+		t.Errorf("HierarchyGetLevel(/) = %d, want 0", got)
+	}
+	if got := HierarchyGetLevel("/1/3/"); got != 2 {
+		t.Errorf("HierarchyGetLevel(/1/3/) = %d, want 2", got)
+	}
+	for _, tt := range []struct {
+		node string
+		n    int
+		want string
+	}{
+		{"/1/3/", 1, "/1/"},
+		{"/1/3/", 2, "/"},
+		{"/1/3/", 0, "/1/3/"},
+		{"/1/3/", 3, ""},
+	} {
+		if got := HierarchyGetAncestor(tt.node, tt.n); got != tt.want {
+			t.Errorf("HierarchyGetAncestor(%q, %d) = %q, want %q", tt.node, tt.n, got, tt.want)
+		}
+	}
+	if !HierarchyIsDescendantOf("/1/3/", "/1/") || !HierarchyIsDescendantOf("/1/", "/1/") || HierarchyIsDescendantOf("/10/", "/1/") {
+		t.Error("HierarchyIsDescendantOf gave the wrong answer")
+	}
+	for _, tt := range []struct {
+		parent, child1, child2, want string
+	}{
+		{"/1/", "", "", "/1/1/"},
+		{"/1/", "/1/2/", "", "/1/3/"},
+		{"/1/", "", "/1/2/", "/1/1/"},
+		{"/1/", "/1/1/", "/1/3/", "/1/2/"},
+		{"/1/", "/1/1/", "/1/2/", "/1/1.1/"},
+		{"/1/", "/1/2/", "/1/1/", ""},
+		{"/1/", "/2/1/", "", ""},
+	} {
+		if got := HierarchyGetDescendant(tt.parent, tt.child1, tt.child2); got != tt.want {
+			t.Errorf("HierarchyGetDescendant(%q, %q, %q) = %q, want %q", tt.parent, tt.child1, tt.child2, got, tt.want)
+		}
+	}
+	if got := HierarchyGetReparentedValue("/1/3/2/", "/1/", "/4/5/"); got != "/4/5/3/2/" {
+		t.Errorf("HierarchyGetReparentedValue = %q, want /4/5/3/2/", got)
+	}
+	if got := HierarchyGetReparentedValue("/2/3/", "/1/", "/4/"); got != "" {
+		t.Errorf("HierarchyGetReparentedValue outside oldRoot = %q, want empty", got)
+	}
+	for _, tt := range []struct {
+		a, b string
+		want int
+	}{
+		{"/2/", "/10/", -1},
+		{"/1/", "/1/1/", -1},
+		{"/1.1/", "/1/", 1},
+		{"/1.1/", "/2/", -1},
+		{"/3/", "/3/", 0},
+	} {
+		if got := HierarchyCompare(tt.a, tt.b); got != tt.want {
+			t.Errorf("HierarchyCompare(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
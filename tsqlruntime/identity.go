@@ -0,0 +1,46 @@
+package tsqlruntime
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// IdentCurrent returns the last identity value generated for table, as
+// IDENT_CURRENT does, reading it from where the dialect keeps it. column is
+// the table's identity column, which PostgreSQL needs to find its sequence.
+// A table that has had no rows inserted gives 0.
+//
+// MySQL reads AUTO_INCREMENT from information_schema, which MySQL 8 caches
+// for information_schema_stats_expiry seconds. SQLite has no record of the
+// values handed out, so the largest rowid stands in for it.
+func IdentCurrent(ctx context.Context, db DBTX, dialect, table, column string) (int64, error) {
+	query, args, err := identCurrentQuery(dialect, table, column)
+	if err != nil {
+		return 0, err
+	}
+	var value sql.NullInt64
+	if err := db.QueryRowContext(ctx, query, args...).Scan(&value); err != nil {
+		return 0, fmt.Errorf("IDENT_CURRENT(%s): %w", table, err)
+	}
+	return value.Int64, nil
+}
+
+// identCurrentQuery returns the query IdentCurrent runs.
+func identCurrentQuery(dialect, table, column string) (string, []interface{}, error) {
+	name := SequenceTable(table)
+	switch dialect {
+	case "postgres":
+		return "SELECT pg_sequence_last_value(pg_get_serial_sequence($1, $2)::regclass)",
+			[]interface{}{strings.ToLower(name), strings.ToLower(column)}, nil
+	case "mysql":
+		return "SELECT AUTO_INCREMENT - 1 FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?",
+			[]interface{}{name}, nil
+	case "sqlite":
+		return "SELECT MAX(rowid) FROM " + name, nil, nil
+	case "sqlserver":
+		return "SELECT CAST(IDENT_CURRENT(@p1) AS BIGINT)", []interface{}{strings.Trim(table, "[]")}, nil
+	}
+	return "", nil, fmt.Errorf("IDENT_CURRENT is not supported for dialect %s", dialect)
+}
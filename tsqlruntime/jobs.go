@@ -0,0 +1,134 @@
+package tsqlruntime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// StepAction is what a job does when a step ends, with the values of
+// msdb's on_success_action and on_fail_action.
+type StepAction int
+
+const (
+	QuitWithSuccess StepAction = 1
+	QuitWithFailure StepAction = 2
+	GoToNextStep    StepAction = 3
+	GoToStep        StepAction = 4
+)
+
+// JobStep is a step of a Job.
+type JobStep struct {
+	ID            int // Step number, as GoToStep refers to it
+	Name          string
+	Run           func(ctx context.Context) error
+	RetryAttempts int           // Retries after a failure, before OnFailure applies
+	RetryInterval time.Duration // Wait between retries
+	OnSuccess     StepAction    // 0 means QuitWithSuccess
+	OnSuccessStep int           // Step ID for GoToStep
+	OnFailure     StepAction    // 0 means QuitWithFailure
+	OnFailureStep int           // Step ID for GoToStep
+}
+
+// Job is a migrated SQL Server Agent job: steps run in sequence, each
+// deciding by its outcome which runs next. Generated job runners
+// (--jobs) return one, with the schedules of the original as cron
+// expressions for whichever scheduler runs it:
+//
+//	job := r.NightlyCleanupJob()
+//	c.AddFunc(job.Schedules[0], func() { job.Run(ctx) })
+type Job struct {
+	Name      string
+	Steps     []JobStep
+	StartStep int      // ID of the first step; 0 means Steps[0]
+	Schedules []string // Cron expressions: minute hour day-of-month month day-of-week
+}
+
+// Run runs the job from its start step, as SQL Server Agent would. A
+// failed step is retried RetryAttempts times, RetryInterval apart, before
+// its OnFailure action applies. GoToNextStep after the last step quits
+// with its outcome. Run returns nil if the job quits with success, else
+// an error wrapping the last step error.
+func (j *Job) Run(ctx context.Context) error {
+	if len(j.Steps) == 0 {
+		return nil
+	}
+	i := 0
+	if j.StartStep != 0 {
+		var err error
+		if i, err = j.stepIndex(j.StartStep); err != nil {
+			return err
+		}
+	}
+	var lastErr error
+	for {
+		step := &j.Steps[i]
+		err := runStep(ctx, step)
+		if ctx.Err() != nil {
+			return fmt.Errorf("job %s: step %d (%s): %w", j.Name, step.ID, step.Name, errors.Join(err, ctx.Err()))
+		}
+		action, next := step.OnSuccess, step.OnSuccessStep
+		if action == 0 {
+			action = QuitWithSuccess
+		}
+		if err != nil {
+			lastErr = fmt.Errorf("step %d (%s): %w", step.ID, step.Name, err)
+			action, next = step.OnFailure, step.OnFailureStep
+			if action == 0 {
+				action = QuitWithFailure
+			}
+		}
+		if action == GoToNextStep && i == len(j.Steps)-1 {
+			action = QuitWithSuccess
+			if err != nil {
+				action = QuitWithFailure
+			}
+		}
+
+		switch action {
+		case QuitWithSuccess:
+			return nil
+		case QuitWithFailure:
+			if lastErr == nil {
+				lastErr = fmt.Errorf("step %d (%s) quit with failure", step.ID, step.Name)
+			}
+			return fmt.Errorf("job %s: %w", j.Name, lastErr)
+		case GoToNextStep:
+			i++
+		case GoToStep:
+			if i, err = j.stepIndex(next); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("job %s: step %d (%s): unknown action %d", j.Name, step.ID, step.Name, action)
+		}
+	}
+}
+
+// stepIndex returns the index in j.Steps of the step with ID id.
+func (j *Job) stepIndex(id int) (int, error) {
+	for i, s := range j.Steps {
+		if s.ID == id {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("job %s: no step %d", j.Name, id)
+}
+
+// runStep runs a step and its retries, returning the last error.
+func runStep(ctx context.Context, step *JobStep) error {
+	for attempt := 0; ; attempt++ {
+		err := step.Run(ctx)
+		if err == nil || attempt >= step.RetryAttempts {
+			return err
+		}
+		timer := time.NewTimer(step.RetryInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
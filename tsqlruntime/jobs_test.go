@@ -0,0 +1,65 @@
+package tsqlruntime
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestJobRun(t *testing.T) {
+	var ran []string
+	step := func(name string, err error) func(context.Context) error {
+		return func(context.Context) error {
+			ran = append(ran, name)
+			return err
+		}
+	}
+	failures := 0
+	flaky := func(ctx context.Context) error {
+		ran = append(ran, "purge")
+		if failures++; failures < 3 {
+			return errors.New("deadlock")
+		}
+		return nil
+	}
+
+	job := &Job{
+		Name: "Nightly",
+		Steps: []JobStep{
+			{ID: 1, Name: "Purge", Run: flaky, RetryAttempts: 2, OnSuccess: GoToNextStep, OnFailure: GoToStep, OnFailureStep: 3},
+			{ID: 2, Name: "Totals", Run: step("totals", nil), OnSuccess: QuitWithSuccess, OnFailure: QuitWithFailure},
+			{ID: 3, Name: "Notify", Run: step("notify", nil), OnSuccess: QuitWithFailure, OnFailure: QuitWithFailure},
+		},
+	}
+	if err := job.Run(context.Background()); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if got := strings.Join(ran, ","); got != "purge,purge,purge,totals" {
+		t.Errorf("steps run: %s", got)
+	}
+
+	// Out of retries: the failure step runs and the job fails
+	ran, failures = nil, -10
+	err := job.Run(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "step 1 (Purge): deadlock") {
+		t.Errorf("expected the purge error, got %v", err)
+	}
+	if got := strings.Join(ran, ","); got != "purge,purge,purge,notify" {
+		t.Errorf("steps run: %s", got)
+	}
+
+	// Defaults and GoToNextStep from the last step
+	ran = nil
+	job = &Job{Name: "Two", StartStep: 2, Steps: []JobStep{
+		{ID: 1, Name: "A", Run: step("a", nil)},
+		{ID: 2, Name: "B", Run: step("b", nil), OnSuccess: GoToNextStep},
+	}}
+	if err := job.Run(context.Background()); err != nil || strings.Join(ran, ",") != "b" {
+		t.Errorf("got %v, ran %v", err, ran)
+	}
+	job.Steps[1].Run = step("b", errors.New("boom"))
+	if err := job.Run(context.Background()); err == nil {
+		t.Error("expected the default failure action to fail the job")
+	}
+}
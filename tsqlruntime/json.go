@@ -467,50 +467,156 @@ type ForJSONOptions struct {
 	RootName        string // ROOT('name')
 	IncludeNullValues bool
 	WithoutArrayWrapper bool
+	Columns         []string // Keys of the columns, in place of the names the query gives them
 }
 
-// ForJSON converts rows to JSON format
+// ForJSON converts rows to JSON format. Keys keep the order of the
+// columns, and in PATH mode a dotted name (Customer.Name) nests the value
+// in an object. It returns "" for no rows, as FOR JSON returns NULL.
 func ForJSON(columns []string, rows [][]Value, options ForJSONOptions) (string, error) {
-	var result []map[string]interface{}
+	if len(rows) == 0 {
+		return "", nil
+	}
+	if len(options.Columns) == len(columns) {
+		columns = options.Columns
+	}
 
+	objects := make([]string, 0, len(rows))
 	for _, row := range rows {
-		obj := make(map[string]interface{})
+		obj := &jsonObject{}
 		for i, col := range columns {
 			if i >= len(row) {
 				continue
 			}
 			val := row[i]
-
 			if val.IsNull && !options.IncludeNullValues {
 				continue
 			}
-
-			if val.IsNull {
-				obj[col] = nil
-			} else {
-				obj[col] = val.ToInterface()
+			path := []string{col}
+			if options.Mode == ForJSONPath {
+				path = strings.Split(col, ".")
+			}
+			encoded, err := forJSONValue(val)
+			if err != nil {
+				return "", err
 			}
+			obj.set(path, encoded)
 		}
-		result = append(result, obj)
+		objects = append(objects, obj.String())
 	}
 
-	var output interface{}
-	if options.WithoutArrayWrapper && len(result) == 1 {
-		output = result[0]
-	} else {
-		output = result
+	output := strings.Join(objects, ",")
+	if !options.WithoutArrayWrapper {
+		output = "[" + output + "]"
 	}
-
 	if options.RootName != "" {
-		output = map[string]interface{}{options.RootName: output}
+		key, _ := json.Marshal(options.RootName)
+		output = "{" + string(key) + ":" + output + "}"
 	}
+	return output, nil
+}
 
-	bytes, err := json.Marshal(output)
-	if err != nil {
-		return "", err
+// forJSONValue encodes a column value. Decimals are written as they are
+// rather than through float64.
+func forJSONValue(val Value) (string, error) {
+	if val.IsNull {
+		return "null", nil
+	}
+	switch val.Type {
+	case TypeDecimal, TypeNumeric, TypeMoney, TypeSmallMoney:
+		return val.decimalVal.String(), nil
+	}
+	b, err := json.Marshal(val.ToInterface())
+	return string(b), err
+}
+
+// jsonObject is a JSON object keeping its keys in insertion order.
+type jsonObject struct {
+	keys   []string
+	values map[string]interface{} // encoded string or *jsonObject
+}
+
+// set sets the value at path, creating the objects on the way.
+func (o *jsonObject) set(path []string, encoded string) {
+	if o.values == nil {
+		o.values = map[string]interface{}{}
+	}
+	key := path[0]
+	existing, ok := o.values[key]
+	if !ok {
+		o.keys = append(o.keys, key)
+	}
+	if len(path) == 1 {
+		o.values[key] = encoded
+		return
+	}
+	child, isObject := existing.(*jsonObject)
+	if !isObject {
+		child = &jsonObject{}
+		o.values[key] = child
+	}
+	child.set(path[1:], encoded)
+}
+
+func (o *jsonObject) String() string {
+	var b strings.Builder
+	b.WriteString("{")
+	for i, key := range o.keys {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		k, _ := json.Marshal(key)
+		b.Write(k)
+		b.WriteString(":")
+		switch v := o.values[key].(type) {
+		case string:
+			b.WriteString(v)
+		case *jsonObject:
+			b.WriteString(v.String())
+		}
 	}
+	b.WriteString("}")
+	return b.String()
+}
 
-	return string(bytes), nil
+// OpenJSONInto decodes the rows OPENJSON would return for the JSON at path
+// into dest, a pointer to a slice of structs whose json tags name the
+// properties the columns of its WITH clause read. An object is one row. A
+// lax path that doesn't exist gives no rows.
+func OpenJSONInto(jsonStr string, path string, dest interface{}) error {
+	if jsonStr == "" {
+		return nil
+	}
+	var data interface{}
+	if err := json.Unmarshal([]byte(jsonStr), &data); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	path = strings.TrimSpace(path)
+	strict := strings.HasPrefix(path, "strict ")
+	path = strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(path, "strict "), "lax "))
+	if path != "" && path != "$" {
+		var ok bool
+		if data, ok = jsonNavigate(data, jsonParsePath(path)); !ok {
+			if strict {
+				return fmt.Errorf("property cannot be found on the specified JSON path %s", path)
+			}
+			return nil
+		}
+	}
+	switch data.(type) {
+	case []interface{}:
+	case map[string]interface{}:
+		data = []interface{}{data}
+	case nil:
+		return nil
+	default:
+		return fmt.Errorf("JSON at %s is neither an array nor an object", path)
+	}
+	rows, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(rows, dest)
 }
 
 // Updated function registry entries
@@ -228,6 +228,65 @@ func TestForJSON(t *testing.T) {
 	}
 }
 
+func TestForJSON_PathNesting(t *testing.T) {
+	columns := []string{"id", "c_name", "c_city", "note"}
+	rows := [][]Value{
+		{NewInt(1), NewVarChar("Alice", -1), NewVarChar("Oslo", -1), Null(TypeVarChar)},
+		{NewInt(2), NewVarChar("Bob", -1), Null(TypeVarChar), NewVarChar("vip", -1)},
+	}
+	result, err := ForJSON(columns, rows, ForJSONOptions{
+		Mode:    ForJSONPath,
+		Columns: []string{"id", "Customer.Name", "Customer.City", "note"},
+	})
+	if err != nil {
+		t.Fatalf("ForJSON error: %v", err)
+	}
+	want := `[{"id":1,"Customer":{"Name":"Alice","City":"Oslo"}},{"id":2,"Customer":{"Name":"Bob"},"note":"vip"}]`
+	if result != want {
+		t.Errorf("Expected %s, got %s", want, result)
+	}
+
+	// Rows without the array wrapper are separated by commas, as in T-SQL
+	result, _ = ForJSON(columns[:1], rows, ForJSONOptions{Mode: ForJSONPath, WithoutArrayWrapper: true})
+	if result != `{"id":1},{"id":2}` {
+		t.Errorf("Expected objects without the array, got %s", result)
+	}
+
+	// No rows is NULL
+	if result, _ = ForJSON(columns, nil, ForJSONOptions{Mode: ForJSONPath}); result != "" {
+		t.Errorf("Expected empty result for no rows, got %s", result)
+	}
+}
+
+func TestOpenJSONInto(t *testing.T) {
+	var rows []struct {
+		ProductID int32 `json:"id"`
+		Quantity  int32 `json:"qty"`
+	}
+	err := OpenJSONInto(`{"items": [{"id": 7, "qty": 2}, {"id": 9, "qty": 1}]}`, "$.items", &rows)
+	if err != nil {
+		t.Fatalf("OpenJSONInto error: %v", err)
+	}
+	if len(rows) != 2 || rows[1].ProductID != 9 || rows[1].Quantity != 1 {
+		t.Errorf("Expected 2 rows, got %+v", rows)
+	}
+
+	// An object is one row
+	rows = nil
+	if err := OpenJSONInto(`{"id": 3, "qty": 4}`, "$", &rows); err != nil || len(rows) != 1 || rows[0].ProductID != 3 {
+		t.Errorf("Expected one row from an object, got %+v, %v", rows, err)
+	}
+
+	// A missing path gives no rows unless it is strict
+	rows = nil
+	if err := OpenJSONInto(`{}`, "lax $.items", &rows); err != nil || len(rows) != 0 {
+		t.Errorf("Expected no rows for a lax missing path, got %+v, %v", rows, err)
+	}
+	if err := OpenJSONInto(`{}`, "strict $.items", &rows); err == nil {
+		t.Error("Expected an error for a strict missing path")
+	}
+}
+
 // ============================================================================
 // XML Tests
 // ============================================================================
@@ -416,6 +475,27 @@ func TestForXML_Elements(t *testing.T) {
 	}
 }
 
+func TestForXML_Attributes(t *testing.T) {
+	columns := []string{"id", "name"}
+	rows := [][]Value{
+		{NewInt(1), NewVarChar("Alice & Bob", -1)},
+	}
+
+	// PATH columns named '@id' become attributes
+	result, err := ForXML(columns, rows, ForXMLOptions{
+		Mode:        ForXMLPath,
+		ElementName: "item",
+		Elements:    true,
+		Attributes:  []string{"id"},
+	})
+	if err != nil {
+		t.Fatalf("ForXML error: %v", err)
+	}
+	if want := `<item id="1"><name>Alice &amp; Bob</name></item>`; result != want {
+		t.Errorf("Expected %q, got %q", want, result)
+	}
+}
+
 func TestForXML_Root(t *testing.T) {
 	columns := []string{"id"}
 	rows := [][]Value{{NewInt(1)}}
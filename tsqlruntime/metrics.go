@@ -0,0 +1,35 @@
+package tsqlruntime
+
+import "time"
+
+// Metrics records procedure executions for code generated with --metrics.
+// The metricsprom package adapts it to Prometheus counters and histograms,
+// so the runtime itself doesn't depend on a metrics library; a nil Metrics
+// records nothing.
+type Metrics interface {
+	// ObserveProcedure records one call of the procedure name that took
+	// elapsed and failed with err, or succeeded when err is nil.
+	ObserveProcedure(name string, elapsed time.Duration, err error)
+}
+
+// NopMetrics is a Metrics that records nothing.
+type NopMetrics struct{}
+
+// ObserveProcedure does nothing.
+func (NopMetrics) ObserveProcedure(string, time.Duration, error) {}
+
+// ObserveProcedure starts timing a call of name, recorded in metrics, which
+// may be nil, when the returned function is called with the procedure's
+// error:
+//
+//	observe := tsqlruntime.ObserveProcedure(r.metrics, "usp_GetOrder")
+//	defer func() { observe(err) }()
+func ObserveProcedure(metrics Metrics, name string) func(err error) {
+	if metrics == nil {
+		return func(error) {}
+	}
+	start := time.Now()
+	return func(err error) {
+		metrics.ObserveProcedure(name, time.Since(start), err)
+	}
+}
@@ -0,0 +1,42 @@
+package tsqlruntime
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type observation struct {
+	name    string
+	elapsed time.Duration
+	err     error
+}
+
+type recordingMetrics struct {
+	observed []observation
+}
+
+func (m *recordingMetrics) ObserveProcedure(name string, elapsed time.Duration, err error) {
+	m.observed = append(m.observed, observation{name, elapsed, err})
+}
+
+func TestObserveProcedure(t *testing.T) {
+	ObserveProcedure(nil, "usp_GetOrder")(errors.New("ignored"))
+
+	m := &recordingMetrics{}
+	observe := ObserveProcedure(m, "usp_GetOrder")
+	time.Sleep(time.Millisecond)
+	failure := errors.New("deadlock")
+	observe(failure)
+	ObserveProcedure(m, "usp_Ping")(nil)
+
+	if len(m.observed) != 2 {
+		t.Fatalf("expected 2 observations, got %d", len(m.observed))
+	}
+	if o := m.observed[0]; o.name != "usp_GetOrder" || o.err != failure || o.elapsed < time.Millisecond {
+		t.Errorf("unexpected observation %+v", o)
+	}
+	if o := m.observed[1]; o.name != "usp_Ping" || o.err != nil {
+		t.Errorf("unexpected observation %+v", o)
+	}
+}
@@ -0,0 +1,9 @@
+// Package metricsprom adapts Prometheus to tsqlruntime.Metrics, for code
+// generated with --metrics.
+//
+// It needs github.com/prometheus/client_golang, so it is only compiled with
+// the prometheus build tag:
+//
+//	go get github.com/prometheus/client_golang
+//	go build -tags prometheus ./...
+package metricsprom
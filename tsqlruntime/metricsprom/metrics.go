@@ -0,0 +1,56 @@
+//go:build prometheus
+
+package metricsprom
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics records procedure calls as Prometheus metrics, labelled with the
+// procedure name:
+//
+//	<namespace>_procedure_calls_total{procedure, status="ok"|"error"}
+//	<namespace>_procedure_duration_seconds{procedure}
+type Metrics struct {
+	calls    *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+// New creates the metrics and registers them with reg. Buckets default to
+// prometheus.DefBuckets.
+func New(reg prometheus.Registerer, namespace string, buckets ...float64) (*Metrics, error) {
+	if len(buckets) == 0 {
+		buckets = prometheus.DefBuckets
+	}
+	m := &Metrics{
+		calls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "procedure_calls_total",
+			Help:      "Calls of each procedure, by outcome.",
+		}, []string{"procedure", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "procedure_duration_seconds",
+			Help:      "Time taken by each procedure call.",
+			Buckets:   buckets,
+		}, []string{"procedure"}),
+	}
+	for _, c := range []prometheus.Collector{m.calls, m.duration} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// ObserveProcedure counts the call and records how long it took.
+func (m *Metrics) ObserveProcedure(name string, elapsed time.Duration, err error) {
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	m.calls.WithLabelValues(name, status).Inc()
+	m.duration.WithLabelValues(name).Observe(elapsed.Seconds())
+}
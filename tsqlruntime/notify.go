@@ -0,0 +1,19 @@
+package tsqlruntime
+
+import "context"
+
+// Notifier sends a message to people. Generated code calls it in place of
+// Database Mail (sp_send_dbmail, xp_sendmail), which has no equivalent
+// outside SQL Server; to holds the recipients as written in the procedure,
+// separated by semicolons.
+type Notifier interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+// NotifierFunc adapts an ordinary function to Notifier.
+type NotifierFunc func(ctx context.Context, to, subject, body string) error
+
+// Send calls f.
+func (f NotifierFunc) Send(ctx context.Context, to, subject, body string) error {
+	return f(ctx, to, subject, body)
+}
@@ -0,0 +1,30 @@
+package tsqlruntime
+
+// Ptr returns a pointer to v. Generated code uses it to assign a value to
+// a nullable parameter under --null-mode=pointer.
+func Ptr[T any](v T) *T {
+	return &v
+}
+
+// Deref returns *p, or the zero value if p is nil, as a nullable value
+// reads in a Go expression under --null-mode=pointer.
+func Deref[T any](p *T) T {
+	if p == nil {
+		var zero T
+		return zero
+	}
+	return *p
+}
+
+// Coalesce returns the first of values that isn't the zero value, or the
+// zero value if they all are. Under the default --null-mode NULLs read as
+// the zero value, so this is COALESCE for them.
+func Coalesce[T comparable](values ...T) T {
+	var zero T
+	for _, v := range values {
+		if v != zero {
+			return v
+		}
+	}
+	return zero
+}
@@ -0,0 +1,26 @@
+package tsqlruntime
+
+import "testing"
+
+func TestPtrDeref(t *testing.T) {
+	p := Ptr("EU")
+	if *p != "EU" || Deref(p) != "EU" {
+		t.Errorf("Ptr/Deref = %v", *p)
+	}
+	var none *int64
+	if Deref(none) != 0 {
+		t.Errorf("Deref(nil) = %d, want 0", Deref(none))
+	}
+}
+
+func TestCoalesce(t *testing.T) {
+	if got := Coalesce("", "EU", "US"); got != "EU" {
+		t.Errorf("Coalesce strings = %q, want EU", got)
+	}
+	if got := Coalesce(int32(0), 0); got != 0 {
+		t.Errorf("Coalesce zeros = %d, want 0", got)
+	}
+	if got := Coalesce(0, 7, 9); got != 7 {
+		t.Errorf("Coalesce ints = %d, want 7", got)
+	}
+}
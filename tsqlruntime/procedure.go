@@ -0,0 +1,225 @@
+package tsqlruntime
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ProcParam is an argument of a stored procedure run with CallProcedure.
+type ProcParam struct {
+	Name   string      // Parameter name without the @, or "" for a positional argument
+	Value  interface{} // The value passed; for an OUTPUT parameter, a pointer that receives the result
+	Output bool
+}
+
+// CallProcedure runs a stored procedure that is still in the database,
+// for migrated code whose callee hasn't been migrated yet. Generated
+// passthrough stubs call it with the caller's arguments:
+//
+//	SQL Server  EXEC @rc = name @OrderID = @OrderID, @Ref = @Ref OUTPUT
+//	PostgreSQL  CALL name(OrderID => $1, Ref => $2), reading INOUT parameters from the row it returns
+//	MySQL       SET @Ref = ?; CALL name(?, @Ref); SELECT @Ref, on one connection
+//
+// OUTPUT parameters are read back into their pointers. The return code is
+// the procedure's RETURN value on SQL Server and 0 elsewhere, where
+// procedures don't have one. MySQL binds arguments by position only, and
+// SQLite has no stored procedures.
+func CallProcedure(ctx context.Context, db DBTX, dialect Dialect, name string, params ...ProcParam) (int32, error) {
+	switch dialect {
+	case DialectSQLServer:
+		return callSQLServer(ctx, db, name, params)
+	case DialectMySQL:
+		return 0, callMySQL(ctx, db, name, params)
+	case DialectSQLite:
+		return 0, fmt.Errorf("%s: sqlite has no stored procedures", name)
+	default:
+		return 0, callPostgres(ctx, db, dialect, name, params)
+	}
+}
+
+// QueryProcedure runs a SQL Server stored procedure that returns result
+// sets, as the wrappers generated with --backend=procedure-call do. scan is
+// called with each result set in turn, numbered from 0, and reads its rows.
+// OUTPUT parameters and the return code are set once every result set has
+// been read, as SQL Server sends them last.
+func QueryProcedure(ctx context.Context, db DBTX, dialect Dialect, name string, scan func(set int, rows *sql.Rows) error, params ...ProcParam) (int32, error) {
+	if dialect != DialectSQLServer {
+		return 0, fmt.Errorf("%s: reading result sets of a stored procedure needs SQL Server", name)
+	}
+	query, args, rc := sqlServerExec(name, params)
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	for set := 0; ; set++ {
+		if err := scan(set, rows); err != nil {
+			return 0, err
+		}
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+		if !rows.NextResultSet() {
+			break
+		}
+	}
+	// Output parameters are only filled in when the rows are closed
+	if err := rows.Close(); err != nil {
+		return 0, err
+	}
+	return *rc, rows.Err()
+}
+
+// errStopRows ends a QueryProcedure whose rows a loop stopped ranging over.
+var errStopRows = errors.New("stopped reading rows")
+
+// ProcedureRows runs a SQL Server stored procedure with one result set and
+// returns its rows as an iterator, as the wrappers generated with
+// --rows=iter do: a range loop over it reads each row as the loop asks for
+// it, and breaking out of the loop stops the reading. An error ends the
+// loop, yielded with the zero T. The result is an iter.Seq2[T, error],
+// declared without the iter package so the runtime builds before Go 1.23.
+func ProcedureRows[T any](ctx context.Context, db DBTX, dialect Dialect, name string, scan func(rows *sql.Rows) (T, error), params ...ProcParam) func(yield func(T, error) bool) {
+	return func(yield func(T, error) bool) {
+		_, err := QueryProcedure(ctx, db, dialect, name, func(set int, rows *sql.Rows) error {
+			if set > 0 {
+				return nil
+			}
+			for rows.Next() {
+				row, err := scan(rows)
+				if err != nil {
+					return err
+				}
+				if !yield(row, nil) {
+					return errStopRows
+				}
+			}
+			return nil
+		}, params...)
+		if err != nil && err != errStopRows {
+			var zero T
+			yield(zero, err)
+		}
+	}
+}
+
+// Nullable returns a scan destination for dest that stores the zero value
+// for NULL, so a result set column of unknown nullability can be scanned
+// into a plain Go type.
+func Nullable[T any](dest *T) sql.Scanner {
+	return nullable[T]{dest}
+}
+
+type nullable[T any] struct{ dest *T }
+
+func (n nullable[T]) Scan(src interface{}) error {
+	var v sql.Null[T]
+	if err := v.Scan(src); err != nil {
+		return err
+	}
+	*n.dest = v.V
+	return nil
+}
+
+// callSQLServer runs the procedure with ExecContext.
+func callSQLServer(ctx context.Context, db DBTX, name string, params []ProcParam) (int32, error) {
+	query, args, rc := sqlServerExec(name, params)
+	if _, err := db.ExecContext(ctx, query, args...); err != nil {
+		return 0, err
+	}
+	return *rc, nil
+}
+
+// sqlServerExec returns the EXEC statement for a procedure and its
+// arguments. Every argument is bound by name, OUTPUT ones as sql.Out, and
+// the return code comes back through one more output parameter, which the
+// returned pointer receives.
+func sqlServerExec(name string, params []ProcParam) (string, []interface{}, *int32) {
+	rc := new(int32)
+	args := []interface{}{sql.Named("tgpiler_rc", sql.Out{Dest: rc})}
+	parts := make([]string, len(params))
+	for i, p := range params {
+		bind := fmt.Sprintf("p%d", i+1)
+		parts[i] = "@" + bind
+		if p.Name != "" {
+			bind = p.Name
+			parts[i] = fmt.Sprintf("@%s = @%s", p.Name, p.Name)
+		}
+		if p.Output {
+			parts[i] += " OUTPUT"
+			args = append(args, sql.Named(bind, sql.Out{Dest: p.Value, In: true}))
+		} else {
+			args = append(args, sql.Named(bind, p.Value))
+		}
+	}
+	query := "EXEC @tgpiler_rc = " + name
+	if len(parts) > 0 {
+		query += " " + strings.Join(parts, ", ")
+	}
+	return query, args, rc
+}
+
+// callPostgres runs CALL, scanning the row it returns into the OUTPUT
+// parameters when there are any.
+func callPostgres(ctx context.Context, db DBTX, dialect Dialect, name string, params []ProcParam) error {
+	parts := make([]string, len(params))
+	args := make([]interface{}, len(params))
+	var dests []interface{}
+	for i, p := range params {
+		parts[i] = bulkPlaceholder(dialect, i+1)
+		if p.Name != "" {
+			parts[i] = p.Name + " => " + parts[i]
+		}
+		args[i] = p.Value
+		if p.Output {
+			dests = append(dests, p.Value)
+		}
+	}
+	query := fmt.Sprintf("CALL %s(%s)", name, strings.Join(parts, ", "))
+	if len(dests) == 0 {
+		_, err := db.ExecContext(ctx, query, args...)
+		return err
+	}
+	return db.QueryRowContext(ctx, query, args...).Scan(dests...)
+}
+
+// callMySQL passes OUTPUT parameters through session variables, so the
+// statements have to share a connection.
+func callMySQL(ctx context.Context, db DBTX, name string, params []ProcParam) error {
+	if pool, ok := db.(*sql.DB); ok {
+		conn, err := pool.Conn(ctx)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		db = conn
+	}
+
+	parts := make([]string, len(params))
+	var args, dests []interface{}
+	var vars []string
+	for i, p := range params {
+		if !p.Output {
+			parts[i] = "?"
+			args = append(args, p.Value)
+			continue
+		}
+		v := fmt.Sprintf("@tgpiler_out%d", i+1)
+		if _, err := db.ExecContext(ctx, "SET "+v+" = ?", p.Value); err != nil {
+			return err
+		}
+		parts[i] = v
+		vars = append(vars, v)
+		dests = append(dests, p.Value)
+	}
+	if _, err := db.ExecContext(ctx, fmt.Sprintf("CALL %s(%s)", name, strings.Join(parts, ", ")), args...); err != nil {
+		return err
+	}
+	if len(vars) == 0 {
+		return nil
+	}
+	return db.QueryRowContext(ctx, "SELECT "+strings.Join(vars, ", ")).Scan(dests...)
+}
@@ -0,0 +1,113 @@
+package tsqlruntime
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+// recordingDB records the statements CallProcedure runs. Only
+// ExecContext is used by the calls tested here.
+type recordingDB struct {
+	recordingExecer
+}
+
+func (d *recordingDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	panic("unexpected QueryContext")
+}
+
+func (d *recordingDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	panic("unexpected QueryRowContext")
+}
+
+func TestCallProcedureSQLServer(t *testing.T) {
+	db := &recordingDB{}
+	var ref string
+	_, err := CallProcedure(context.Background(), db, DialectSQLServer, "dbo.usp_Charge",
+		ProcParam{Value: 7},
+		ProcParam{Name: "Amount", Value: "9.50"},
+		ProcParam{Name: "Ref", Value: &ref, Output: true},
+	)
+	if err != nil {
+		t.Fatalf("CallProcedure failed: %v", err)
+	}
+	if want := "EXEC @tgpiler_rc = dbo.usp_Charge @p1, @Amount = @Amount, @Ref = @Ref OUTPUT"; db.queries[0] != want {
+		t.Errorf("query:\n got %s\nwant %s", db.queries[0], want)
+	}
+	args := db.args[0]
+	if len(args) != 4 {
+		t.Fatalf("expected 4 args, got %v", args)
+	}
+	if rc := args[0].(sql.NamedArg); rc.Name != "tgpiler_rc" {
+		t.Errorf("expected the return code first, got %v", rc)
+	}
+	if !reflect.DeepEqual(args[1], sql.Named("p1", 7)) || !reflect.DeepEqual(args[2], sql.Named("Amount", "9.50")) {
+		t.Errorf("unexpected input args %v", args[1:3])
+	}
+	if out, ok := args[3].(sql.NamedArg).Value.(sql.Out); !ok || out.Dest != &ref || !out.In {
+		t.Errorf("expected @Ref as an in/out sql.Out, got %v", args[3])
+	}
+}
+
+func TestCallProcedurePostgres(t *testing.T) {
+	db := &recordingDB{}
+	rc, err := CallProcedure(context.Background(), db, DialectPostgres, "usp_Notify",
+		ProcParam{Name: "OrderID", Value: 7},
+		ProcParam{Name: "Note", Value: "placed"},
+	)
+	if err != nil || rc != 0 {
+		t.Fatalf("CallProcedure: %d, %v", rc, err)
+	}
+	if want := "CALL usp_Notify(OrderID => $1, Note => $2)"; db.queries[0] != want {
+		t.Errorf("got %s, want %s", db.queries[0], want)
+	}
+	if !reflect.DeepEqual(db.args[0], []interface{}{7, "placed"}) {
+		t.Errorf("unexpected args %v", db.args[0])
+	}
+
+	db = &recordingDB{}
+	if _, err := CallProcedure(context.Background(), db, DialectMySQL, "usp_Notify", ProcParam{Name: "OrderID", Value: 7}); err != nil {
+		t.Fatalf("CallProcedure failed: %v", err)
+	}
+	if want := "CALL usp_Notify(?)"; db.queries[0] != want {
+		t.Errorf("got %s, want %s", db.queries[0], want)
+	}
+
+	if _, err := CallProcedure(context.Background(), db, DialectSQLite, "usp_Notify"); err == nil {
+		t.Error("expected an error for sqlite")
+	}
+}
+
+func TestNullable(t *testing.T) {
+	n := int32(5)
+	if err := Nullable(&n).Scan(nil); err != nil || n != 0 {
+		t.Errorf("NULL: got %d, %v", n, err)
+	}
+	if err := Nullable(&n).Scan(int64(42)); err != nil || n != 42 {
+		t.Errorf("got %d, %v", n, err)
+	}
+	var s string
+	if err := Nullable(&s).Scan([]byte("abc")); err != nil || s != "abc" {
+		t.Errorf("got %q, %v", s, err)
+	}
+}
+
+func TestProcedureRowsError(t *testing.T) {
+	rows := ProcedureRows(context.Background(), &recordingDB{}, DialectPostgres, "usp_GetOrders",
+		func(rows *sql.Rows) (int32, error) {
+			t.Fatal("unexpected scan")
+			return 0, nil
+		})
+	var errs []error
+	rows(func(id int32, err error) bool {
+		if id != 0 {
+			t.Errorf("expected the zero value with the error, got %d", id)
+		}
+		errs = append(errs, err)
+		return true
+	})
+	if len(errs) != 1 || errs[0] == nil {
+		t.Errorf("expected one error, got %v", errs)
+	}
+}
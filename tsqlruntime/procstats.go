@@ -0,0 +1,143 @@
+package tsqlruntime
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ProcedureStats holds execution statistics for one procedure, with the
+// fields and units (microseconds) of SQL Server's
+// sys.dm_exec_procedure_stats, so numbers from both sides of a migration
+// can be compared directly.
+type ProcedureStats struct {
+	Name              string    `json:"name"`
+	CachedTime        time.Time `json:"cached_time"` // First execution
+	LastExecutionTime time.Time `json:"last_execution_time"`
+	ExecutionCount    int64     `json:"execution_count"`
+
+	TotalWorkerTime int64 `json:"total_worker_time"`
+	LastWorkerTime  int64 `json:"last_worker_time"`
+	MinWorkerTime   int64 `json:"min_worker_time"`
+	MaxWorkerTime   int64 `json:"max_worker_time"`
+
+	TotalElapsedTime int64 `json:"total_elapsed_time"`
+	LastElapsedTime  int64 `json:"last_elapsed_time"`
+	MinElapsedTime   int64 `json:"min_elapsed_time"`
+	MaxElapsedTime   int64 `json:"max_elapsed_time"`
+}
+
+// ProcStatsRegistry records procedure executions in memory.
+//
+// Elapsed time is wall-clock time. Worker time is the CPU time the process
+// used during the call, which on a busy server includes other goroutines;
+// it is capped at the elapsed time, and is zero on platforms without
+// getrusage.
+//
+// The registry is an http.Handler serving the statistics as JSON, and an
+// expvar.Var:
+//
+//	expvar.Publish("procedure_stats", tsqlruntime.ProcStats)
+//	http.Handle("/debug/procstats", tsqlruntime.ProcStats)
+type ProcStatsRegistry struct {
+	mu    sync.Mutex
+	procs map[string]*ProcedureStats
+}
+
+// ProcStats is the registry generated code records into (--exec-stats).
+var ProcStats = NewProcStatsRegistry()
+
+// NewProcStatsRegistry returns an empty registry.
+func NewProcStatsRegistry() *ProcStatsRegistry {
+	return &ProcStatsRegistry{procs: make(map[string]*ProcedureStats)}
+}
+
+// TrackProcedure starts timing an execution of name in ProcStats. Call the
+// returned function when the procedure returns:
+//
+//	defer tsqlruntime.TrackProcedure("dbo.GetCustomer")()
+func TrackProcedure(name string) func() {
+	return ProcStats.Track(name)
+}
+
+// Track starts timing an execution of name; the returned function records
+// it.
+func (r *ProcStatsRegistry) Track(name string) func() {
+	start := time.Now()
+	cpuStart := processCPUTime()
+	return func() {
+		elapsed := time.Since(start)
+		worker := processCPUTime() - cpuStart
+		if worker > elapsed {
+			worker = elapsed
+		}
+		r.Record(name, start, elapsed, worker)
+	}
+}
+
+// Record adds one execution of name that started at start.
+func (r *ProcStatsRegistry) Record(name string, start time.Time, elapsed, worker time.Duration) {
+	elapsedUS, workerUS := elapsed.Microseconds(), worker.Microseconds()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.procs[name]
+	if !ok {
+		s = &ProcedureStats{
+			Name:           name,
+			CachedTime:     start,
+			MinWorkerTime:  workerUS,
+			MinElapsedTime: elapsedUS,
+		}
+		r.procs[name] = s
+	}
+	s.LastExecutionTime = start
+	s.ExecutionCount++
+
+	s.TotalWorkerTime += workerUS
+	s.LastWorkerTime = workerUS
+	s.MinWorkerTime = min(s.MinWorkerTime, workerUS)
+	s.MaxWorkerTime = max(s.MaxWorkerTime, workerUS)
+
+	s.TotalElapsedTime += elapsedUS
+	s.LastElapsedTime = elapsedUS
+	s.MinElapsedTime = min(s.MinElapsedTime, elapsedUS)
+	s.MaxElapsedTime = max(s.MaxElapsedTime, elapsedUS)
+}
+
+// Snapshot returns the statistics of every procedure, by name.
+func (r *ProcStatsRegistry) Snapshot() []ProcedureStats {
+	r.mu.Lock()
+	out := make([]ProcedureStats, 0, len(r.procs))
+	for _, s := range r.procs {
+		out = append(out, *s)
+	}
+	r.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Reset clears the statistics, like DBCC FREEPROCCACHE does on the server.
+func (r *ProcStatsRegistry) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.procs = make(map[string]*ProcedureStats)
+}
+
+// String returns the statistics as a JSON array, which makes the registry
+// an expvar.Var.
+func (r *ProcStatsRegistry) String() string {
+	data, err := json.Marshal(r.Snapshot())
+	if err != nil {
+		return "[]"
+	}
+	return string(data)
+}
+
+// ServeHTTP writes the statistics as a JSON array.
+func (r *ProcStatsRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(r.String()))
+}
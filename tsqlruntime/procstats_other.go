@@ -0,0 +1,8 @@
+//go:build !unix
+
+package tsqlruntime
+
+import "time"
+
+// processCPUTime is not available on this platform; worker time is zero.
+func processCPUTime() time.Duration { return 0 }
@@ -0,0 +1,51 @@
+package tsqlruntime
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestProcStatsRegistry(t *testing.T) {
+	r := NewProcStatsRegistry()
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	r.Record("dbo.GetCustomer", start, 3*time.Millisecond, time.Millisecond)
+	r.Record("dbo.GetCustomer", start.Add(time.Second), time.Millisecond, 2*time.Millisecond)
+	r.Track("dbo.AddOrder")()
+
+	stats := r.Snapshot()
+	if len(stats) != 2 || stats[0].Name != "dbo.AddOrder" || stats[1].Name != "dbo.GetCustomer" {
+		t.Fatalf("unexpected snapshot %+v", stats)
+	}
+	got := stats[1]
+	want := ProcedureStats{
+		Name:              "dbo.GetCustomer",
+		CachedTime:        start,
+		LastExecutionTime: start.Add(time.Second),
+		ExecutionCount:    2,
+		TotalWorkerTime:   3000, LastWorkerTime: 2000, MinWorkerTime: 1000, MaxWorkerTime: 2000,
+		TotalElapsedTime: 4000, LastElapsedTime: 1000, MinElapsedTime: 1000, MaxElapsedTime: 3000,
+	}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if tracked := stats[0]; tracked.ExecutionCount != 1 || tracked.LastWorkerTime > tracked.LastElapsedTime {
+		t.Errorf("unexpected tracked stats %+v", tracked)
+	}
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/procstats", nil))
+	var served []map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &served); err != nil {
+		t.Fatalf("invalid JSON %q: %v", rec.Body.String(), err)
+	}
+	if len(served) != 2 || served[1]["execution_count"] != float64(2) || served[1]["total_elapsed_time"] != float64(4000) {
+		t.Errorf("unexpected JSON %s", rec.Body.String())
+	}
+
+	r.Reset()
+	if len(r.Snapshot()) != 0 {
+		t.Error("expected no stats after Reset")
+	}
+}
@@ -0,0 +1,211 @@
+package tsqlruntime
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// RowQuerier is the subset of *sql.DB / *sql.Tx needed by the query helpers.
+type RowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// DBTX is the store parameter type for functional-style generated code
+// (--style=functions). Both *sql.DB and *sql.Tx satisfy it, so callers can
+// run a procedure inside their own transaction.
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// TxBeginner is a DBTX that can begin a transaction, as *sql.DB and
+// *sql.Conn can.
+type TxBeginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// BeginTx begins a transaction on db for functional-style code, whose
+// procedures all take a DBTX. A *sql.Tx can't begin another, so a
+// procedure that opens its own transaction fails when called inside one.
+func BeginTx(ctx context.Context, db DBTX, opts *sql.TxOptions) (*sql.Tx, error) {
+	b, ok := db.(TxBeginner)
+	if !ok {
+		return nil, fmt.Errorf("tsqlruntime: %T cannot begin a transaction", db)
+	}
+	return b.BeginTx(ctx, opts)
+}
+
+// QueryExists runs a "SELECT 1 WHERE EXISTS(...)" style query and reports
+// whether it returned 1. A query that fails is also reported as false:
+// T-SQL would raise its error, which an expression has no way to return.
+// Generated IF and WHILE statements testing EXISTS call ReadExists instead.
+//
+// Generated code calls this instead of emitting an inline closure for every
+// EXISTS expression.
+func QueryExists(ctx context.Context, db RowQuerier, query string, args ...interface{}) bool {
+	exists, _ := ReadExists(ctx, db, query, args...)
+	return exists
+}
+
+// ReadExists is QueryExists returning the query's error, for generated
+// statements, which can return it. No rows is false, not an error.
+func ReadExists(ctx context.Context, db RowQuerier, query string, args ...interface{}) (bool, error) {
+	var exists int
+	err := db.QueryRowContext(ctx, query, args...).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil && exists == 1, err
+}
+
+// QueryScalar runs a scalar subquery and returns its single value, or nil
+// when it returns no rows, as T-SQL yields NULL. A query that fails also
+// returns nil, where T-SQL would raise its error. Generated IF, WHILE and
+// SET statements call ReadScalar instead.
+func QueryScalar(ctx context.Context, db RowQuerier, query string, args ...interface{}) any {
+	result, _ := ReadScalar(ctx, db, query, args...)
+	return result
+}
+
+// ReadScalar is QueryScalar returning the query's error, for generated
+// statements, which can return it. No rows is nil, not an error.
+func ReadScalar(ctx context.Context, db RowQuerier, query string, args ...interface{}) (any, error) {
+	var result any
+	err := db.QueryRowContext(ctx, query, args...).Scan(&result)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// QueryScalarInt64 runs a scalar subquery expected to yield an integer,
+// such as SELECT COUNT(*). It returns 0 when the query returns no rows or
+// NULL, and also when it fails, where T-SQL would raise its error.
+// Generated IF, WHILE and SET statements call ReadScalarInt64 instead.
+func QueryScalarInt64(ctx context.Context, db RowQuerier, query string, args ...interface{}) int64 {
+	result, _ := ReadScalarInt64(ctx, db, query, args...)
+	return result
+}
+
+// ReadScalarInt64 is QueryScalarInt64 returning the query's error, for
+// generated statements, which can return it. No rows is 0, not an error.
+func ReadScalarInt64(ctx context.Context, db RowQuerier, query string, args ...interface{}) (int64, error) {
+	var result sql.NullInt64
+	err := db.QueryRowContext(ctx, query, args...).Scan(&result)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return result.Int64, nil
+}
+
+// QueryScalarString runs a scalar subquery expected to yield a string,
+// such as a STRING_AGG. It returns "" when the query returns no rows or
+// NULL, and also when it fails, where T-SQL would raise its error.
+// Generated SET and DECLARE statements call ReadScalarString instead.
+func QueryScalarString(ctx context.Context, db RowQuerier, query string, args ...interface{}) string {
+	result, _ := ReadScalarString(ctx, db, query, args...)
+	return result
+}
+
+// ReadScalarString is QueryScalarString returning the query's error, for
+// generated statements, which can return it. No rows is "", not an error.
+func ReadScalarString(ctx context.Context, db RowQuerier, query string, args ...interface{}) (string, error) {
+	var result sql.NullString
+	err := db.QueryRowContext(ctx, query, args...).Scan(&result)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return result.String, nil
+}
+
+// RowsQuerier is the subset of *sql.DB / *sql.Tx needed by QueryForXML
+// and QueryForJSON.
+type RowsQuerier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// QueryForXML runs a query and returns its rows as XML, as a FOR XML
+// clause with the given options would, for databases without FOR XML. It
+// returns "" when the query fails or returns no rows (NULL in T-SQL).
+func QueryForXML(ctx context.Context, db RowsQuerier, options ForXMLOptions, query string, args ...interface{}) string {
+	xml, _ := ReadForXML(ctx, db, options, query, args...)
+	return xml
+}
+
+// ReadForXML is QueryForXML returning the query's error, for generated
+// statements, which can return it. No rows is "", not an error.
+func ReadForXML(ctx context.Context, db RowsQuerier, options ForXMLOptions, query string, args ...interface{}) (string, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	columns, values, err := scanValues(rows)
+	if err != nil || len(values) == 0 {
+		return "", err
+	}
+	return ForXML(columns, values, options)
+}
+
+// QueryForJSON runs a query and returns its rows as JSON, as a FOR JSON
+// clause with the given options would, for databases without FOR JSON. It
+// returns "" when the query fails or returns no rows (NULL in T-SQL).
+func QueryForJSON(ctx context.Context, db RowsQuerier, options ForJSONOptions, query string, args ...interface{}) string {
+	json, _ := ReadForJSON(ctx, db, options, query, args...)
+	return json
+}
+
+// ReadForJSON is QueryForJSON returning the query's error, for generated
+// statements, which can return it.
+func ReadForJSON(ctx context.Context, db RowsQuerier, options ForJSONOptions, query string, args ...interface{}) (string, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	columns, values, err := scanValues(rows)
+	if err != nil {
+		return "", err
+	}
+	return ForJSON(columns, values, options)
+}
+
+// scanValues reads the columns and the remaining rows of rows.
+func scanValues(rows *sql.Rows) ([]string, [][]Value, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, nil, err
+	}
+	var values [][]Value
+	for rows.Next() {
+		dest := make([]any, len(columns))
+		ptrs := make([]any, len(columns))
+		for i := range dest {
+			ptrs[i] = &dest[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, nil, err
+		}
+		row := make([]Value, len(columns))
+		for i, v := range dest {
+			// Drivers return text columns as []byte
+			if b, ok := v.([]byte); ok {
+				v = string(b)
+			}
+			row[i] = ToValue(v)
+		}
+		values = append(values, row)
+	}
+	return columns, values, rows.Err()
+}
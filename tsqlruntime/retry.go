@@ -0,0 +1,160 @@
+package tsqlruntime
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy says how often Retry runs a function and which of its errors
+// are worth another attempt.
+type RetryPolicy struct {
+	Attempts   int           // Total attempts, including the first
+	Backoff    time.Duration // Delay before the second attempt, doubled for each one after
+	MaxBackoff time.Duration // Cap on the delay; 0 means 100 * Backoff
+	Retryable  func(error) bool
+}
+
+// NewRetryPolicy returns a policy that retries the transient errors of
+// dialect (see RetryableErrors), and also the error codes in extra.
+func NewRetryPolicy(dialect string, attempts int, backoff time.Duration, extra ...string) RetryPolicy {
+	return RetryPolicy{
+		Attempts:  attempts,
+		Backoff:   backoff,
+		Retryable: RetryableErrors(dialect, extra...),
+	}
+}
+
+// ErrReturn ends a retried function early without an error of its own,
+// for a RETURN inside a retried transaction. Retry doesn't retry it and
+// returns it as is; the caller returns from the procedure when it sees it.
+var ErrReturn = errors.New("tsqlruntime: return")
+
+// Retry calls fn until it succeeds, returns an error the policy doesn't
+// retry, or has been called p.Attempts times, and returns its last error.
+// Delays grow exponentially with jitter. Generated code retries whole
+// transactions this way (--retry):
+//
+//	err := tsqlruntime.Retry(ctx, tsqlruntime.NewRetryPolicy("postgres", 3, 100*time.Millisecond), func() error {
+//		tx, err := r.db.BeginTx(ctx, nil)
+//		...
+//		return tx.Commit()
+//	})
+func Retry(ctx context.Context, p RetryPolicy, fn func() error) error {
+	maxBackoff := p.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = 100 * p.Backoff
+	}
+	delay := p.Backoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.Attempts || p.Retryable == nil || !p.Retryable(err) {
+			return err
+		}
+
+		// Wait between half the delay and all of it
+		wait := delay
+		if half := int64(delay / 2); half > 0 {
+			wait = time.Duration(half + rand.Int64N(half+1))
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(err, ctx.Err())
+		case <-timer.C:
+		}
+		delay = min(delay*2, maxBackoff)
+	}
+}
+
+// Transient error codes by dialect: deadlocks, lock timeouts and
+// serialization failures, plus the connection errors Azure SQL Database
+// documents as transient.
+var retryableCodes = map[string][]string{
+	"sqlserver": {"1205", "1222", "-2", "4060", "40197", "40501", "40613", "49918", "49919", "49920"},
+	"postgres":  {"40001", "40P01", "55P03"},
+	"mysql":     {"1213", "1205"},
+	"sqlite":    {"5", "6"}, // SQLITE_BUSY, SQLITE_LOCKED
+	"oracle":    {"60", "8177"},
+}
+
+// Messages that identify the same errors when a driver exposes no code.
+var retryableMessages = map[string][]string{
+	"sqlserver": {"deadlock", "lock request time out"},
+	"postgres":  {"deadlock detected", "could not serialize access"},
+	"mysql":     {"deadlock found", "lock wait timeout exceeded"},
+	"sqlite":    {"database is locked", "database table is locked"},
+	"oracle":    {"ora-00060", "ora-08177"},
+}
+
+// RetryableErrors returns a classifier reporting whether an error from a
+// dialect database is transient. Codes are SQL Server, MySQL, SQLite and
+// Oracle error numbers or PostgreSQL SQLSTATEs; extra adds more. An
+// unknown dialect retries only extra, and SQL Server deadlocks raised as
+// *SQLError.
+func RetryableErrors(dialect string, extra ...string) func(error) bool {
+	codes := make(map[string]bool)
+	for _, c := range retryableCodes[dialect] {
+		codes[c] = true
+	}
+	for _, c := range extra {
+		codes[strings.TrimSpace(c)] = true
+	}
+	if len(codes) == 0 {
+		codes[strconv.Itoa(ErrDeadlock)] = true
+	}
+	messages := retryableMessages[dialect]
+
+	return func(err error) bool {
+		if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return false
+		}
+		for _, c := range errorCodes(err) {
+			if codes[c] {
+				return true
+			}
+		}
+		msg := strings.ToLower(err.Error())
+		for _, m := range messages {
+			if strings.Contains(msg, m) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// mysqlErrorRe matches the number in a MySQL driver error message,
+// e.g. "Error 1213 (40001): Deadlock found ...".
+var mysqlErrorRe = regexp.MustCompile(`^Error (\d+)`)
+
+// errorCodes returns the codes err carries, found through the methods the
+// common drivers define, so no driver needs importing.
+func errorCodes(err error) []string {
+	var codes []string
+	var sqlErr *SQLError
+	if errors.As(err, &sqlErr) {
+		codes = append(codes, strconv.Itoa(sqlErr.Number))
+	}
+	var mssql interface{ SQLErrorNumber() int32 } // github.com/microsoft/go-mssqldb
+	if errors.As(err, &mssql) {
+		codes = append(codes, strconv.Itoa(int(mssql.SQLErrorNumber())))
+	}
+	var pg interface{ SQLState() string } // pgx, lib/pq
+	if errors.As(err, &pg) {
+		codes = append(codes, pg.SQLState())
+	}
+	var coded interface{ Code() int } // modernc.org/sqlite
+	if errors.As(err, &coded) {
+		codes = append(codes, strconv.Itoa(coded.Code()))
+	}
+	if m := mysqlErrorRe.FindStringSubmatch(err.Error()); m != nil {
+		codes = append(codes, m[1])
+	}
+	return codes
+}
@@ -0,0 +1,92 @@
+package tsqlruntime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// pgError stands in for a PostgreSQL driver error.
+type pgError struct{ code string }
+
+func (e *pgError) Error() string    { return "pg error " + e.code }
+func (e *pgError) SQLState() string { return e.code }
+
+func TestRetry(t *testing.T) {
+	ctx := context.Background()
+	policy := NewRetryPolicy("postgres", 3, time.Millisecond)
+
+	calls := 0
+	err := Retry(ctx, policy, func() error {
+		calls++
+		if calls < 3 {
+			return fmt.Errorf("update: %w", &pgError{"40P01"})
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("expected success on the third attempt, got %v after %d", err, calls)
+	}
+
+	calls = 0
+	err = Retry(ctx, policy, func() error {
+		calls++
+		return &pgError{"23505"} // unique_violation
+	})
+	if calls != 1 || err == nil {
+		t.Errorf("expected a permanent error to be returned at once, got %v after %d", err, calls)
+	}
+
+	calls = 0
+	err = Retry(ctx, policy, func() error {
+		calls++
+		return &pgError{"40001"}
+	})
+	if calls != 3 || err == nil {
+		t.Errorf("expected 3 attempts, got %d", calls)
+	}
+
+	calls = 0
+	err = Retry(ctx, policy, func() error {
+		calls++
+		return ErrReturn
+	})
+	if calls != 1 || err != ErrReturn {
+		t.Errorf("expected ErrReturn to be returned at once, got %v after %d", err, calls)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	err = Retry(cancelled, NewRetryPolicy("postgres", 3, time.Hour), func() error {
+		return &pgError{"40001"}
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the wait to end with the context, got %v", err)
+	}
+}
+
+func TestRetryableErrors(t *testing.T) {
+	tests := []struct {
+		dialect string
+		extra   []string
+		err     error
+		want    bool
+	}{
+		{"sqlserver", nil, NewSQLError(ErrDeadlock, "deadlock victim"), true},
+		{"sqlserver", nil, NewSQLError(ErrDuplicateKey, "duplicate key"), false},
+		{"sqlserver", nil, errors.New("Transaction (Process ID 52) was deadlocked on lock resources"), true},
+		{"postgres", nil, &pgError{"40001"}, true},
+		{"postgres", []string{"55000"}, &pgError{"55000"}, true},
+		{"mysql", nil, errors.New("Error 1213 (40001): Deadlock found when trying to get lock"), true},
+		{"mysql", nil, errors.New("Error 1062 (23000): Duplicate entry"), false},
+		{"sqlite", nil, errors.New("database is locked"), true},
+		{"postgres", nil, context.DeadlineExceeded, false},
+	}
+	for _, tt := range tests {
+		if got := RetryableErrors(tt.dialect, tt.extra...)(tt.err); got != tt.want {
+			t.Errorf("RetryableErrors(%q, %v)(%v) = %v, want %v", tt.dialect, tt.extra, tt.err, got, tt.want)
+		}
+	}
+}
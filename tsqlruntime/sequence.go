@@ -0,0 +1,108 @@
+package tsqlruntime
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Sequences
+//
+// NEXT VALUE FOR, sp_sequence_get_range and ALTER SEQUENCE ... RESTART WITH
+// become calls to NextSequenceValue, SequenceRange and RestartSequence.
+// PostgreSQL and SQL Server have sequences. MySQL and SQLite don't, so there
+// a sequence is a one-row table named after it (see SequenceTable), with
+// the next value to hand out and the increment:
+//
+//	CREATE TABLE OrderNumbers (next_value BIGINT NOT NULL, increment_by BIGINT NOT NULL);
+//	INSERT INTO OrderNumbers VALUES (1000, 1);
+//
+// Values are reserved with a single UPDATE, so concurrent callers never get
+// the same one. MINVALUE, MAXVALUE and CYCLE aren't enforced on the tables.
+
+// NextSequenceValue returns the next value of the sequence name.
+func NextSequenceValue(ctx context.Context, db DBTX, dialect, name string) (int64, error) {
+	first, _, err := SequenceRange(ctx, db, dialect, name, 1)
+	return first, err
+}
+
+// SequenceRange reserves size values of the sequence name, as
+// sp_sequence_get_range does, and returns the first and last. On
+// PostgreSQL the values are distinct but, with other sessions using the
+// sequence at the same time, may not be contiguous.
+func SequenceRange(ctx context.Context, db DBTX, dialect, name string, size int64) (first, last int64, err error) {
+	if size < 1 {
+		return 0, 0, fmt.Errorf("the range size for sequence %s must be positive", name)
+	}
+	switch dialect {
+	case "postgres":
+		err = db.QueryRowContext(ctx, "SELECT MIN(v), MAX(v) FROM (SELECT nextval($1) AS v FROM generate_series(1, $2)) r",
+			name, size).Scan(&first, &last)
+	case "sqlserver":
+		if size == 1 {
+			err = db.QueryRowContext(ctx, "SELECT CAST(NEXT VALUE FOR "+name+" AS BIGINT)").Scan(&first)
+			last = first
+			break
+		}
+		err = db.QueryRowContext(ctx, "DECLARE @first SQL_VARIANT, @last SQL_VARIANT; "+
+			"EXEC sp_sequence_get_range @sequence_name = @p1, @range_size = @p2, "+
+			"@range_first_value = @first OUTPUT, @range_last_value = @last OUTPUT; "+
+			"SELECT CAST(@first AS BIGINT), CAST(@last AS BIGINT)", name, size).Scan(&first, &last)
+	case "mysql":
+		// LAST_INSERT_ID(expr) remembers expr for the connection, so the
+		// UPDATE and the SELECT have to share one
+		if pool, ok := db.(*sql.DB); ok {
+			conn, connErr := pool.Conn(ctx)
+			if connErr != nil {
+				return 0, 0, connErr
+			}
+			defer conn.Close()
+			db = conn
+		}
+		table := SequenceTable(name)
+		if _, err = db.ExecContext(ctx, "UPDATE "+table+" SET next_value = LAST_INSERT_ID(next_value + increment_by * ?)", size); err != nil {
+			break
+		}
+		err = db.QueryRowContext(ctx, "SELECT LAST_INSERT_ID() - increment_by * ?, LAST_INSERT_ID() - increment_by FROM "+table,
+			size).Scan(&first, &last)
+	case "sqlite":
+		err = db.QueryRowContext(ctx, "UPDATE "+SequenceTable(name)+" SET next_value = next_value + increment_by * ? "+
+			"RETURNING next_value - increment_by * ?, next_value - increment_by", size, size).Scan(&first, &last)
+	default:
+		return 0, 0, fmt.Errorf("sequences are not supported for dialect %s", dialect)
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("sequence %s: %w", name, err)
+	}
+	return first, last, nil
+}
+
+// RestartSequence makes value the next value of the sequence name, as
+// ALTER SEQUENCE ... RESTART WITH does.
+func RestartSequence(ctx context.Context, db DBTX, dialect, name string, value int64) error {
+	var err error
+	switch dialect {
+	case "postgres":
+		_, err = db.ExecContext(ctx, "SELECT setval($1, $2, false)", name, value)
+	case "sqlserver":
+		_, err = db.ExecContext(ctx, fmt.Sprintf("ALTER SEQUENCE %s RESTART WITH %d", name, value))
+	case "mysql", "sqlite":
+		_, err = db.ExecContext(ctx, "UPDATE "+SequenceTable(name)+" SET next_value = ?", value)
+	default:
+		return fmt.Errorf("sequences are not supported for dialect %s", dialect)
+	}
+	if err != nil {
+		return fmt.Errorf("sequence %s: %w", name, err)
+	}
+	return nil
+}
+
+// SequenceTable returns the table emulating the sequence name on MySQL and
+// SQLite: the sequence's name without its schema.
+func SequenceTable(name string) string {
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		name = name[i+1:]
+	}
+	return strings.Trim(name, "[]")
+}
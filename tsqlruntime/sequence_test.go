@@ -0,0 +1,78 @@
+package tsqlruntime
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+)
+
+// execRecorder is a DBTX that records the statements it executes.
+type execRecorder struct {
+	DBTX
+	queries []string
+	args    [][]interface{}
+}
+
+func (r *execRecorder) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	r.queries = append(r.queries, query)
+	r.args = append(r.args, args)
+	return nil, nil
+}
+
+func TestSequences(t *testing.T) {
+	for name, want := range map[string]string{
+		"dbo.OrderNumbers":         "OrderNumbers",
+		"[Sales].[InvoiceNumbers]": "InvoiceNumbers",
+		"Tickets":                  "Tickets",
+	} {
+		if got := SequenceTable(name); got != want {
+			t.Errorf("SequenceTable(%q) = %q, want %q", name, got, want)
+		}
+	}
+
+	ctx := context.Background()
+	for dialect, want := range map[string]string{
+		"postgres":  "SELECT setval($1, $2, false)",
+		"sqlserver": "ALTER SEQUENCE dbo.OrderNumbers RESTART WITH 500",
+		"mysql":     "UPDATE OrderNumbers SET next_value = ?",
+		"sqlite":    "UPDATE OrderNumbers SET next_value = ?",
+	} {
+		db := &execRecorder{}
+		if err := RestartSequence(ctx, db, dialect, "dbo.OrderNumbers", 500); err != nil {
+			t.Fatalf("%s: RestartSequence: %v", dialect, err)
+		}
+		if len(db.queries) != 1 || db.queries[0] != want {
+			t.Errorf("%s: RestartSequence ran %q, want %q", dialect, db.queries, want)
+		}
+	}
+
+	if err := RestartSequence(ctx, &execRecorder{}, "oracle", "dbo.OrderNumbers", 1); err == nil {
+		t.Error("expected an error for an unsupported dialect")
+	}
+	if _, _, err := SequenceRange(ctx, &execRecorder{}, "postgres", "dbo.OrderNumbers", 0); err == nil {
+		t.Error("expected an error for an empty range")
+	}
+}
+
+func TestIdentCurrentQuery(t *testing.T) {
+	for dialect, want := range map[string]string{
+		"postgres":  "SELECT pg_sequence_last_value(pg_get_serial_sequence($1, $2)::regclass)",
+		"mysql":     "SELECT AUTO_INCREMENT - 1 FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?",
+		"sqlite":    "SELECT MAX(rowid) FROM Orders",
+		"sqlserver": "SELECT CAST(IDENT_CURRENT(@p1) AS BIGINT)",
+	} {
+		query, _, err := identCurrentQuery(dialect, "dbo.Orders", "OrderID")
+		if err != nil {
+			t.Fatalf("%s: %v", dialect, err)
+		}
+		if query != want {
+			t.Errorf("%s: query = %q, want %q", dialect, query, want)
+		}
+	}
+	if _, args, _ := identCurrentQuery("postgres", "dbo.Orders", "OrderID"); args[0] != "orders" || args[1] != "orderid" {
+		t.Errorf("postgres: args = %v, want [orders orderid]", args)
+	}
+	if _, _, err := identCurrentQuery("oracle", "Orders", "OrderID"); err == nil {
+		t.Error("expected an error for an unsupported dialect")
+	}
+}
@@ -0,0 +1,270 @@
+package tsqlruntime
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Spatial values
+//
+// GEOMETRY and GEOGRAPHY values are strings in generated code: WKT such as
+// "POINT(-122.3 47.6)" with --spatial-mode=wkt, or, with
+// --spatial-mode=postgis, PostGIS's EWKT, which puts the SRID in front
+// ("SRID=4326;POINT(-122.3 47.6)"). PostGIS parses EWKT given for a
+// geometry or geography parameter, and ST_AsEWKT reads a column back as
+// EWKT. WKT puts x before y, so points are longitude first, where
+// geography::Point takes the latitude first.
+
+// WKTPoint returns the WKT of the point (x, y).
+func WKTPoint(x, y float64) string {
+	return "POINT(" + formatCoord(x) + " " + formatCoord(y) + ")"
+}
+
+// EWKT returns wkt with the SRID in front, as PostGIS writes it. An SRID
+// of 0 (unknown) leaves wkt as it is.
+func EWKT(srid int, wkt string) string {
+	wkt = SpatialWKT(wkt)
+	if srid == 0 {
+		return wkt
+	}
+	return "SRID=" + strconv.Itoa(srid) + ";" + wkt
+}
+
+// SpatialWKT returns the WKT of a WKT or EWKT value, without its SRID.
+func SpatialWKT(value string) string {
+	if srid, wkt, ok := splitEWKT(value); ok && srid != "" {
+		return wkt
+	}
+	return value
+}
+
+// SpatialSRID returns the SRID of an EWKT value, or 0 if it has none.
+func SpatialSRID(value string) int {
+	srid, _, ok := splitEWKT(value)
+	if !ok {
+		return 0
+	}
+	n, _ := strconv.Atoi(srid)
+	return n
+}
+
+// splitEWKT splits "SRID=n;wkt" into n and wkt.
+func splitEWKT(value string) (srid, wkt string, ok bool) {
+	value = strings.TrimSpace(value)
+	if len(value) < 5 || !strings.EqualFold(value[:5], "SRID=") {
+		return "", value, true
+	}
+	srid, wkt, ok = strings.Cut(value[5:], ";")
+	return strings.TrimSpace(srid), strings.TrimSpace(wkt), ok
+}
+
+// SpatialFromWKB returns the WKT of a WKB or EWKB value, raw or hex
+// encoded as PostGIS returns geometry and geography columns. A value with
+// an SRID gives EWKT.
+func SpatialFromWKB(b []byte) (string, error) {
+	if len(b) > 0 && len(b)%2 == 0 && isHex(b) {
+		decoded := make([]byte, hex.DecodedLen(len(b)))
+		if _, err := hex.Decode(decoded, b); err != nil {
+			return "", err
+		}
+		b = decoded
+	}
+	r := &wkbReader{data: b}
+	srid, wkt := r.geometry()
+	if r.err != nil {
+		return "", fmt.Errorf("WKB: %w", r.err)
+	}
+	return EWKT(int(srid), wkt), nil
+}
+
+func isHex(b []byte) bool {
+	for _, c := range b {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+func formatCoord(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// EWKB flags on the geometry type.
+const (
+	ewkbZ    = 0x80000000
+	ewkbM    = 0x40000000
+	ewkbSRID = 0x20000000
+)
+
+var wkbTypes = map[uint32]string{
+	1: "POINT", 2: "LINESTRING", 3: "POLYGON", 4: "MULTIPOINT",
+	5: "MULTILINESTRING", 6: "MULTIPOLYGON", 7: "GEOMETRYCOLLECTION",
+}
+
+// wkbReader reads WKB, keeping the first error.
+type wkbReader struct {
+	data  []byte
+	order binary.ByteOrder
+	err   error
+}
+
+func (r *wkbReader) uint32() uint32 {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.data) < 4 {
+		r.err = fmt.Errorf("value ends early")
+		return 0
+	}
+	v := r.order.Uint32(r.data)
+	r.data = r.data[4:]
+	return v
+}
+
+func (r *wkbReader) float64() float64 {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.data) < 8 {
+		r.err = fmt.Errorf("value ends early")
+		return 0
+	}
+	v := math.Float64frombits(r.order.Uint64(r.data))
+	r.data = r.data[8:]
+	return v
+}
+
+// geometry reads a geometry, returning its SRID and WKT.
+func (r *wkbReader) geometry() (uint32, string) {
+	if r.err != nil {
+		return 0, ""
+	}
+	if len(r.data) < 1 {
+		r.err = fmt.Errorf("value ends early")
+		return 0, ""
+	}
+	switch r.data[0] {
+	case 0:
+		r.order = binary.BigEndian
+	case 1:
+		r.order = binary.LittleEndian
+	default:
+		r.err = fmt.Errorf("invalid byte order %d", r.data[0])
+		return 0, ""
+	}
+	r.data = r.data[1:]
+	typ := r.uint32()
+	var srid uint32
+	if typ&ewkbSRID != 0 {
+		srid = r.uint32()
+	}
+	dims := 2
+	if typ&ewkbZ != 0 {
+		dims++
+	}
+	if typ&ewkbM != 0 {
+		dims++
+	}
+	typ &^= ewkbZ | ewkbM | ewkbSRID
+	if typ >= 1000 {
+		// ISO WKB: 1000s for Z, 2000s for M, 3000s for ZM
+		dims += [...]int{0, 1, 1, 2}[typ/1000%4]
+		typ %= 1000
+	}
+	name, ok := wkbTypes[typ]
+	if !ok {
+		if r.err == nil {
+			r.err = fmt.Errorf("unsupported geometry type %d", typ)
+		}
+		return 0, ""
+	}
+	body := r.body(typ, dims)
+	if r.err != nil {
+		return 0, ""
+	}
+	if body == "" {
+		return srid, name + " EMPTY"
+	}
+	return srid, name + body
+}
+
+// body reads the coordinates of a geometry of type typ.
+func (r *wkbReader) body(typ uint32, dims int) string {
+	switch typ {
+	case 1:
+		point := r.point(dims)
+		if point == "" {
+			return ""
+		}
+		return "(" + point + ")"
+	case 2:
+		return r.points(dims)
+	case 3:
+		return r.rings(dims)
+	}
+	// Collections hold whole geometries, with their own headers
+	n := r.uint32()
+	if n == 0 {
+		return ""
+	}
+	var parts []string
+	for i := uint32(0); i < n && r.err == nil; i++ {
+		_, wkt := r.geometry()
+		if typ != 7 {
+			// MULTIPOINT((1 2)), MULTILINESTRING((1 2, 3 4)): drop the member's name
+			if i := strings.IndexByte(wkt, '('); i >= 0 {
+				wkt = wkt[i:]
+			} else {
+				wkt = "EMPTY"
+			}
+		}
+		parts = append(parts, wkt)
+	}
+	return "(" + strings.Join(parts, ", ") + ")"
+}
+
+// point reads a point's coordinates, "" for an empty point.
+func (r *wkbReader) point(dims int) string {
+	coords := make([]string, dims)
+	empty := true
+	for i := range coords {
+		v := r.float64()
+		if !math.IsNaN(v) {
+			empty = false
+		}
+		coords[i] = formatCoord(v)
+	}
+	if empty {
+		return ""
+	}
+	return strings.Join(coords, " ")
+}
+
+func (r *wkbReader) points(dims int) string {
+	n := r.uint32()
+	if n == 0 {
+		return ""
+	}
+	var points []string
+	for i := uint32(0); i < n && r.err == nil; i++ {
+		points = append(points, r.point(dims))
+	}
+	return "(" + strings.Join(points, ", ") + ")"
+}
+
+func (r *wkbReader) rings(dims int) string {
+	n := r.uint32()
+	if n == 0 {
+		return ""
+	}
+	var rings []string
+	for i := uint32(0); i < n && r.err == nil; i++ {
+		rings = append(rings, r.points(dims))
+	}
+	return "(" + strings.Join(rings, ", ") + ")"
+}
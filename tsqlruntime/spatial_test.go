@@ -0,0 +1,56 @@
+package tsqlruntime
+
+import "testing"
+
+func TestSpatialValues(t *testing.T) {
+	if got := WKTPoint(-122.3, 47.6); got != "POINT(-122.3 47.6)" {
+		t.Errorf("WKTPoint = %q", got)
+	}
+	ewkt := EWKT(4326, "POINT(1 2)")
+	if ewkt != "SRID=4326;POINT(1 2)" {
+		t.Errorf("EWKT = %q", ewkt)
+	}
+	if got := EWKT(0, ewkt); got != "POINT(1 2)" {
+		t.Errorf("EWKT with SRID 0 = %q, want plain WKT", got)
+	}
+	if got := SpatialWKT(ewkt); got != "POINT(1 2)" {
+		t.Errorf("SpatialWKT = %q", got)
+	}
+	if got := SpatialSRID(ewkt); got != 4326 {
+		t.Errorf("SpatialSRID = %d", got)
+	}
+	if got := SpatialSRID("POINT(1 2)"); got != 0 {
+		t.Errorf("SpatialSRID of WKT = %d", got)
+	}
+}
+
+func TestSpatialFromWKB(t *testing.T) {
+	for _, tt := range []struct {
+		wkb, want string
+	}{
+		// Little-endian POINT(1 2)
+		{"0101000000000000000000f03f0000000000000040", "POINT(1 2)"},
+		// Big-endian POINT(1 2)
+		{"00000000013ff00000000000004000000000000000", "POINT(1 2)"},
+		// EWKB POINT(1 2) with SRID 4326, as PostGIS returns a geography
+		{"0101000020e6100000000000000000f03f0000000000000040", "SRID=4326;POINT(1 2)"},
+		// LINESTRING(0 0, 1 1)
+		{"010200000002000000" + "00000000000000000000000000000000" + "000000000000f03f000000000000f03f", "LINESTRING(0 0, 1 1)"},
+		// MULTIPOINT((1 2))
+		{"010400000001000000" + "0101000000000000000000f03f0000000000000040", "MULTIPOINT((1 2))"},
+		// An empty LINESTRING
+		{"010200000000000000", "LINESTRING EMPTY"},
+	} {
+		got, err := SpatialFromWKB([]byte(tt.wkb))
+		if err != nil {
+			t.Errorf("SpatialFromWKB(%s): %v", tt.wkb, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("SpatialFromWKB(%s) = %q, want %q", tt.wkb, got, tt.want)
+		}
+	}
+	if _, err := SpatialFromWKB([]byte("0101000000")); err == nil {
+		t.Error("SpatialFromWKB of a truncated point: expected an error")
+	}
+}
@@ -102,6 +102,10 @@ type SPLogger interface {
 
 	// LogExit logs procedure exit (optional, for tracing).
 	LogExit(ctx context.Context, procName string, duration time.Duration, err error)
+
+	// LogMessage logs a message the procedure prints, with PRINT or an
+	// informational RAISERROR, such as the progress of a batch job.
+	LogMessage(ctx context.Context, procName string, message string)
 }
 
 // CaptureError creates an SPError from a recovered panic value.
@@ -228,6 +232,10 @@ func (l *DatabaseSPLogger) LogExit(ctx context.Context, procName string, duratio
 	// Optional: could update/insert exit record for tracing
 }
 
+// LogMessage is a no-op for the database logger, whose table holds errors.
+func (l *DatabaseSPLogger) LogMessage(ctx context.Context, procName string, message string) {
+}
+
 func (l *DatabaseSPLogger) buildInsertQuery() string {
 	cols := []string{
 		l.columns.ProcedureName,
@@ -349,6 +357,14 @@ func (l *SlogSPLogger) LogExit(ctx context.Context, procName string, duration ti
 	}
 }
 
+// LogMessage logs the message at Info level.
+func (l *SlogSPLogger) LogMessage(ctx context.Context, procName string, message string) {
+	l.logger.InfoContext(ctx, "stored procedure message",
+		slog.String("procedure", procName),
+		slog.String("message", message),
+	)
+}
+
 // =============================================================================
 // MultiSPLogger - Logs to multiple destinations
 // =============================================================================
@@ -388,6 +404,13 @@ func (l *MultiSPLogger) LogExit(ctx context.Context, procName string, duration t
 	}
 }
 
+// LogMessage logs to all configured loggers.
+func (l *MultiSPLogger) LogMessage(ctx context.Context, procName string, message string) {
+	for _, logger := range l.loggers {
+		logger.LogMessage(ctx, procName, message)
+	}
+}
+
 // =============================================================================
 // BufferedSPLogger - Buffers errors for batch insert
 // =============================================================================
@@ -446,6 +469,11 @@ func (l *BufferedSPLogger) LogExit(ctx context.Context, procName string, duratio
 	l.inner.LogExit(ctx, procName, duration, err)
 }
 
+// LogMessage delegates to the inner logger.
+func (l *BufferedSPLogger) LogMessage(ctx context.Context, procName string, message string) {
+	l.inner.LogMessage(ctx, procName, message)
+}
+
 // Flush immediately flushes all buffered errors.
 func (l *BufferedSPLogger) Flush(ctx context.Context) error {
 	l.bufferMu.Lock()
@@ -511,6 +539,10 @@ func (l *NopSPLogger) LogEntry(ctx context.Context, procName string, params map[
 func (l *NopSPLogger) LogExit(ctx context.Context, procName string, duration time.Duration, err error) {
 }
 
+// LogMessage does nothing.
+func (l *NopSPLogger) LogMessage(ctx context.Context, procName string, message string) {
+}
+
 // =============================================================================
 // FileSPLogger - Logs to a file
 // =============================================================================
@@ -572,6 +604,13 @@ func (l *FileSPLogger) LogExit(ctx context.Context, procName string, duration ti
 	}
 }
 
+// LogMessage writes the message to the file.
+func (l *FileSPLogger) LogMessage(ctx context.Context, procName string, message string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.file.WriteString(fmt.Sprintf("[%s] PRINT %s: %s\n", time.Now().Format(time.RFC3339), procName, message))
+}
+
 // Close closes the file.
 func (l *FileSPLogger) Close() error {
 	return l.file.Close()
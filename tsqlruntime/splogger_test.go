@@ -144,6 +144,21 @@ func TestSlogSPLoggerEntry(t *testing.T) {
 	}
 }
 
+func TestSlogSPLoggerMessage(t *testing.T) {
+	var buf bytes.Buffer
+	handler := slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo})
+	logger := NewSlogSPLoggerWithHandler(handler)
+
+	logger.LogMessage(context.Background(), "PurgeLogs", "Batch 3: 300 rows")
+
+	output := buf.String()
+	for _, want := range []string{`"level":"INFO"`, `"procedure":"PurgeLogs"`, `"message":"Batch 3: 300 rows"`} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected log to contain %s, got: %s", want, output)
+		}
+	}
+}
+
 func TestMultiSPLogger(t *testing.T) {
 	var buf1, buf2 bytes.Buffer
 	handler1 := slog.NewJSONHandler(&buf1, nil)
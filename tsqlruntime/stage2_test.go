@@ -3,6 +3,7 @@ package tsqlruntime
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/shopspring/decimal"
 )
@@ -163,6 +164,54 @@ func TestGlobalTempTable(t *testing.T) {
 	}
 }
 
+func TestGlobalTempTables_Shared(t *testing.T) {
+	columns := []TempTableColumn{{Name: "ID", Type: TypeInt}}
+	globals := NewGlobalTempTables()
+	first, second := NewTempTableManagerWith(globals), NewTempTableManagerWith(globals)
+
+	staging, err := first.CreateTempTable("##Staging", columns)
+	if err != nil {
+		t.Fatalf("CreateTempTable: %v", err)
+	}
+	staging.InsertScanned(nil, []any{1})
+	shared, err := second.Table("##staging")
+	if err != nil || len(shared.SelectAll()) != 1 {
+		t.Fatalf("expected the second session to see the row of ##Staging, got %v", err)
+	}
+	if _, err := second.CreateTempTable("##Staging", columns); err == nil {
+		t.Error("expected an error creating ##Staging again in another session")
+	}
+
+	// Until dropped by default; DropWithSession ends it with its creator
+	first.ClearSession()
+	if !second.TempTableExists("##Staging") {
+		t.Error("expected ##Staging to outlive the session by default")
+	}
+	globals.DropWithSession = true
+	second.ClearSession()
+	if !second.TempTableExists("##Staging") {
+		t.Error("expected ##Staging to outlive a session that didn't create it")
+	}
+	first.ClearSession()
+	if second.TempTableExists("##Staging") {
+		t.Error("expected ##Staging to be dropped with the session that created it")
+	}
+
+	// IdleTimeout drops tables nobody has used for that long
+	now := time.Now()
+	globals.now = func() time.Time { return now }
+	globals.IdleTimeout = time.Minute
+	first.CreateTempTable("##Idle", columns)
+	now = now.Add(30 * time.Second)
+	if !second.TempTableExists("##Idle") {
+		t.Error("expected ##Idle to be kept within the timeout")
+	}
+	now = now.Add(61 * time.Second)
+	if names := globals.Names(); len(names) != 0 {
+		t.Errorf("expected ##Idle to expire, got %v", names)
+	}
+}
+
 func TestTempTableToResultSet(t *testing.T) {
 	manager := NewTempTableManager()
 
@@ -354,3 +403,118 @@ func TestTempTableManager_ClearSession(t *testing.T) {
 		t.Error("##global1 should remain after ClearSession")
 	}
 }
+
+func TestTempTable_InsertScanned(t *testing.T) {
+	manager := NewTempTableManager()
+	manager.CreateTempTable("#audit", []TempTableColumn{
+		{Name: "AuditID", Type: TypeInt, Identity: true, IdentitySeed: 1, IdentityIncr: 1},
+		{Name: "CustomerID", Type: TypeInt, Nullable: true},
+		{Name: "Name", Type: TypeVarChar, Nullable: true},
+		{Name: "Code", Type: TypeChar, Nullable: true},
+	})
+	manager.CreateTableVariable("@changes", []TempTableColumn{
+		{Name: "Amount", Type: TypeDecimal, Precision: 10, Scale: 2, Nullable: true},
+	})
+
+	audit, err := manager.Table("#Audit")
+	if err != nil {
+		t.Fatalf("Table(#Audit): %v", err)
+	}
+	// Positional, skipping the identity column; text arrives as []byte
+	if err := audit.InsertScanned(nil, []any{int64(7), []byte("Ada"), nil}); err != nil {
+		t.Fatalf("InsertScanned: %v", err)
+	}
+	if err := audit.InsertScanned([]string{"Name", "CustomerID"}, []any{"Bob", int64(8)}); err != nil {
+		t.Fatalf("InsertScanned: %v", err)
+	}
+	rows := audit.SelectAll()
+	if len(rows) != 2 || rows[0][0].AsInt() != 1 || rows[0][1].AsInt() != 7 || rows[0][2].AsString() != "Ada" || !rows[0][3].IsNull {
+		t.Errorf("unexpected first row: %v", rows)
+	}
+	if rows[1][1].AsInt() != 8 || rows[1][2].AsString() != "Bob" || rows[1][2].Type != TypeVarChar {
+		t.Errorf("unexpected second row: %v", rows[1])
+	}
+	// A nullable column left out is NULL
+	if !rows[1][3].IsNull || rows[1][3].Type != TypeChar {
+		t.Errorf("expected a NULL Code, got %v", rows[1][3])
+	}
+
+	changes, err := manager.Table("@Changes")
+	if err != nil {
+		t.Fatalf("Table(@Changes): %v", err)
+	}
+	if err := changes.InsertScanned(nil, []any{[]byte("12.50")}); err != nil {
+		t.Fatalf("InsertScanned: %v", err)
+	}
+	if got := changes.SelectAll()[0][0]; got.Type != TypeDecimal || !got.AsDecimal().Equal(decimal.RequireFromString("12.5")) {
+		t.Errorf("expected decimal 12.50, got %v", got)
+	}
+
+	if err := audit.InsertScanned([]string{"Missing"}, []any{1}); err == nil {
+		t.Error("expected an error for an unknown column")
+	}
+	if _, err := manager.Table("#missing"); err == nil {
+		t.Error("expected an error for a missing temp table")
+	}
+	if _, err := manager.Table("@missing"); err == nil {
+		t.Error("expected an error for a missing table variable")
+	}
+}
+
+func TestTempTable_UpdateSortAggregate(t *testing.T) {
+	manager := NewTempTableManager()
+	manager.CreateTempTable("#work", []TempTableColumn{
+		{Name: "ID", Type: TypeInt},
+		{Name: "Name", Type: TypeVarChar, Nullable: true},
+		{Name: "Total", Type: TypeDecimal, Precision: 10, Scale: 2, Nullable: true},
+	})
+	work, _ := manager.Table("#work")
+	for _, row := range [][]any{{3, "c", 5}, {1, nil, nil}, {2, "b", 20}} {
+		if err := work.InsertScanned(nil, row); err != nil {
+			t.Fatalf("InsertScanned: %v", err)
+		}
+	}
+
+	// Total + 1 where Name LIKE 'b%'; the NULL Name matches neither LIKE nor NOT LIKE
+	n, err := work.UpdateRows(func(row []Value) bool {
+		return row[1].Like(NewVarChar("b%", -1)).IsTruthy()
+	}, func(row []Value) map[string]Value {
+		return map[string]Value{"Total": row[2].Add(NewInt(1))}
+	})
+	if err != nil || n != 1 {
+		t.Fatalf("UpdateRows = %d, %v; want 1 row", n, err)
+	}
+	if !NewVarChar("a", -1).Like(Null(TypeVarChar)).IsNull {
+		t.Error("expected NULL from LIKE with a NULL pattern")
+	}
+
+	rows := work.Select(nil)
+	SortRows(rows, SortKey{Column: 2, Desc: true}, SortKey{Column: 0})
+	var ids []int64
+	for _, row := range rows {
+		ids = append(ids, row[0].AsInt())
+	}
+	if fmt.Sprint(ids) != "[2 3 1]" {
+		t.Errorf("sorted IDs = %v, want [2 3 1] with the NULL Total last", ids)
+	}
+	if got := rows[0][2]; got.Type != TypeDecimal || !got.AsDecimal().Equal(decimal.RequireFromString("21")) {
+		t.Errorf("updated Total = %v, want 21", got)
+	}
+
+	total := func(row []Value) Value { return row[2] }
+	if got := Aggregate("SUM", rows, total); !got.AsDecimal().Equal(decimal.RequireFromString("26")) {
+		t.Errorf("SUM = %v, want 26", got)
+	}
+	if got := Aggregate("COUNT", rows, total); got.AsInt() != 2 {
+		t.Errorf("COUNT = %v, want 2, skipping the NULL", got)
+	}
+	if got := Aggregate("MIN", rows, total); !got.AsDecimal().Equal(decimal.RequireFromString("5")) {
+		t.Errorf("MIN = %v, want 5", got)
+	}
+	if got := Aggregate("MAX", nil, total); !got.IsNull {
+		t.Errorf("MAX of no rows = %v, want NULL", got)
+	}
+	if got := Aggregate("AVG", nil, total).Coalesce(NewInt(0)); got.AsInt() != 0 {
+		t.Errorf("ISNULL(AVG of no rows, 0) = %v, want 0", got)
+	}
+}
@@ -0,0 +1,313 @@
+// Package strfn implements the T-SQL string functions Go has no direct
+// equivalent for, for generated code. Positions are 1-based and count
+// characters, as in T-SQL, and out-of-range positions and lengths are
+// clamped instead of panicking. Where T-SQL returns NULL, such as STUFF
+// with a start past the end of the string, the functions return "".
+package strfn
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Left returns the first n characters of s, as LEFT does.
+func Left(s string, n int) string {
+	r := []rune(s)
+	return string(r[:clamp(n, 0, len(r))])
+}
+
+// Right returns the last n characters of s, as RIGHT does.
+func Right(s string, n int) string {
+	r := []rune(s)
+	return string(r[len(r)-clamp(n, 0, len(r)):])
+}
+
+// Substring returns length characters of s from position start, as
+// SUBSTRING does. A start before 1 shortens the result by as much.
+func Substring(s string, start, length int) string {
+	r := []rune(s)
+	end := clamp(start-1+length, 0, len(r))
+	return string(r[clamp(start-1, 0, end):end])
+}
+
+// Stuff deletes length characters of s from position start and inserts
+// insert there, as STUFF does.
+func Stuff(s string, start, length int, insert string) string {
+	r := []rune(s)
+	if start < 1 || start > len(r) || length < 0 {
+		return ""
+	}
+	end := clamp(start-1+length, 0, len(r))
+	return string(r[:start-1]) + insert + string(r[end:])
+}
+
+// CharIndex returns the position of the first find in s, searching from
+// position start if given, or 0, as CHARINDEX does.
+func CharIndex(find, s string, start ...int) int32 {
+	if find == "" {
+		return 0
+	}
+	from := 0
+	if len(start) > 0 && start[0] > 1 {
+		from = start[0] - 1
+	}
+	r := []rune(s)
+	if from > len(r) {
+		return 0
+	}
+	i := strings.Index(string(r[from:]), find)
+	if i < 0 {
+		return 0
+	}
+	return int32(from + utf8.RuneCountInString(string(r[from:])[:i]) + 1)
+}
+
+// PatIndex returns the position of the first match of the LIKE pattern
+// in s, or 0, as PATINDEX does. Patterns can use %, _, [abc], [a-z] and
+// [^abc], and match regardless of case, as with SQL Server's default
+// collation.
+func PatIndex(pattern, s string) int32 {
+	re, err := likeRegexp(pattern)
+	if err != nil {
+		return 0
+	}
+	loc := re.FindStringIndex(s)
+	if loc == nil {
+		return 0
+	}
+	return int32(utf8.RuneCountInString(s[:loc[0]]) + 1)
+}
+
+// likeRegexp converts a PATINDEX pattern. Without a leading or trailing %
+// it is anchored to the start or end of the string.
+func likeRegexp(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("(?is)")
+	leading := strings.HasPrefix(pattern, "%")
+	if !leading {
+		b.WriteString("^")
+	}
+	body := strings.TrimLeft(pattern, "%")
+	trailing := strings.HasSuffix(body, "%") || (leading && body == "")
+	body = strings.TrimRight(body, "%")
+	writeLikePattern(&b, body, 0)
+	if !trailing {
+		b.WriteString("$")
+	}
+	return regexp.Compile(b.String())
+}
+
+// writeLikePattern writes the regexp of a LIKE pattern. A character after
+// escape, if not 0, is matched as itself.
+func writeLikePattern(b *strings.Builder, pattern string, escape rune) {
+	p := []rune(pattern)
+	for i := 0; i < len(p); i++ {
+		switch c := p[i]; {
+		case c == escape && i+1 < len(p):
+			i++
+			b.WriteString(regexp.QuoteMeta(string(p[i])))
+		case c == '%':
+			b.WriteString(".*?")
+		case c == '_':
+			b.WriteString(".")
+		case c == '[':
+			end := -1
+			for j := i + 1; j < len(p); j++ {
+				if p[j] == ']' {
+					end = j
+					break
+				}
+			}
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := string(p[i+1 : end])
+			b.WriteString("[")
+			if strings.HasPrefix(class, "^") {
+				b.WriteString("^")
+				class = class[1:]
+			}
+			b.WriteString(strings.NewReplacer(`\`, `\\`, "[", `\[`).Replace(class))
+			b.WriteString("]")
+			i = end
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+}
+
+// likeCache holds the compiled patterns of Like and LikeEscape.
+var likeCache sync.Map // pattern + "\x00" + escape -> *regexp.Regexp
+
+// Like reports whether s matches the LIKE pattern as a whole, as LIKE
+// does. Patterns can use %, _, [abc], [a-z] and [^abc], and match
+// regardless of case, as with SQL Server's default collation.
+func Like(s, pattern string) bool {
+	return LikeEscape(s, pattern, "")
+}
+
+// LikeEscape is Like with an ESCAPE character, which makes the %, _ or [
+// after it match itself.
+func LikeEscape(s, pattern, escape string) bool {
+	key := pattern + "\x00" + escape
+	re, ok := likeCache.Load(key)
+	if !ok {
+		var esc rune
+		if escape != "" {
+			esc, _ = utf8.DecodeRuneInString(escape)
+		}
+		var b strings.Builder
+		b.WriteString("(?is)^")
+		writeLikePattern(&b, pattern, esc)
+		b.WriteString("$")
+		compiled, err := regexp.Compile(b.String())
+		if err != nil {
+			return false
+		}
+		re, _ = likeCache.LoadOrStore(key, compiled)
+	}
+	return re.(*regexp.Regexp).MatchString(s)
+}
+
+// Replicate returns s repeated n times, as REPLICATE does.
+func Replicate(s string, n int) string {
+	if n < 0 {
+		return ""
+	}
+	return strings.Repeat(s, n)
+}
+
+// Space returns n spaces, as SPACE does.
+func Space(n int) string {
+	return Replicate(" ", n)
+}
+
+// Reverse returns s with its characters in reverse order, as REVERSE does.
+func Reverse(s string) string {
+	r := []rune(s)
+	for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+		r[i], r[j] = r[j], r[i]
+	}
+	return string(r)
+}
+
+// Translate replaces each character of s found in from with the one at
+// the same position in to, as TRANSLATE does. from and to must be the
+// same length; if they aren't, s is returned unchanged.
+func Translate(s, from, to string) string {
+	f, t := []rune(from), []rune(to)
+	if len(f) != len(t) {
+		return s
+	}
+	return strings.Map(func(c rune) rune {
+		for i := range f {
+			if f[i] == c {
+				return t[i]
+			}
+		}
+		return c
+	}, s)
+}
+
+// QuoteName delimits s as a SQL Server identifier, as QUOTENAME does,
+// with brackets or the quote character given: [, ], ', ", (, ), <, >,
+// {, } or `. Names over 128 characters and other quote characters give "".
+func QuoteName(s string, quote ...string) string {
+	open, close := "[", "]"
+	if len(quote) > 0 {
+		pairs := map[string]string{
+			"[": "]", "]": "]", "'": "'", `"`: `"`, "(": ")", ")": ")",
+			"<": ">", ">": ">", "{": "}", "}": "}", "`": "`",
+		}
+		var ok bool
+		if close, ok = pairs[quote[0]]; !ok {
+			return ""
+		}
+		open = map[string]string{"]": "[", ")": "(", ">": "<", "}": "{"}[quote[0]]
+		if open == "" {
+			open = quote[0]
+		}
+	}
+	if utf8.RuneCountInString(s) > 128 {
+		return ""
+	}
+	return open + strings.ReplaceAll(s, close, close+close) + close
+}
+
+// FormatMessage formats a message as FORMATMESSAGE and RAISERROR do:
+// printf-style %d, %i, %u, %o, %x, %X and %s, with flags, width and
+// precision. Arguments that are missing print as (null).
+func FormatMessage(format string, args ...any) string {
+	var b strings.Builder
+	n := 0
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			b.WriteByte(format[i])
+			continue
+		}
+		j := i + 1
+		for j < len(format) && strings.IndexByte("-+ #0123456789.*hl", format[j]) >= 0 {
+			j++
+		}
+		if j == len(format) {
+			b.WriteString(format[i:])
+			break
+		}
+		verb := format[j]
+		if verb == '%' && j == i+1 {
+			b.WriteByte('%')
+			i = j
+			continue
+		}
+		if strings.IndexByte("diuoxXs", verb) < 0 {
+			b.WriteString(format[i : j+1])
+			i = j
+			continue
+		}
+		spec := strings.TrimRight(format[i+1:j], "hl")
+		var arg any = "(null)"
+		if strings.Contains(spec, "*") {
+			width := 0
+			if n < len(args) {
+				switch w := args[n].(type) {
+				case int:
+					width = w
+				case int32:
+					width = int(w)
+				case int64:
+					width = int(w)
+				}
+				n++
+			}
+			spec = strings.Replace(spec, "*", fmt.Sprint(width), 1)
+		}
+		if n < len(args) && args[n] != nil {
+			arg = args[n]
+		}
+		n++
+		switch verb {
+		case 'i', 'u':
+			verb = 'd'
+		}
+		if _, isString := arg.(string); isString && verb != 's' {
+			verb = 's'
+		}
+		b.WriteString(fmt.Sprintf("%"+spec+string(verb), arg))
+		i = j
+	}
+	return b.String()
+}
+
+func clamp(n, lo, hi int) int {
+	if n < lo {
+		return lo
+	}
+	if n > hi {
+		return hi
+	}
+	return n
+}
@@ -0,0 +1,92 @@
+package strfn
+
+import "testing"
+
+func TestStringFunctions(t *testing.T) {
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"LEFT", Left("héllo", 2), "hé"},
+		{"LEFT past the end", Left("abc", 10), "abc"},
+		{"RIGHT", Right("héllo", 4), "éllo"},
+		{"RIGHT negative", Right("abc", -1), ""},
+		{"SUBSTRING", Substring("abcdef", 2, 3), "bcd"},
+		{"SUBSTRING before the start", Substring("abcdef", 0, 3), "ab"},
+		{"SUBSTRING past the end", Substring("abc", 5, 2), ""},
+		{"STUFF", Stuff("abcdef", 2, 3, "ijklmn"), "aijklmnef"},
+		{"STUFF delete", Stuff("abcdef", 2, 10, ""), "a"},
+		{"STUFF past the end", Stuff("abc", 5, 1, "x"), ""},
+		{"REPLICATE", Replicate("ab", 3), "ababab"},
+		{"REPLICATE negative", Replicate("ab", -1), ""},
+		{"SPACE", Space(3), "   "},
+		{"REVERSE", Reverse("añb"), "bña"},
+		{"TRANSLATE", Translate("2*[3+4]/{7-2}", "[]{}", "()()"), "2*(3+4)/(7-2)"},
+		{"QUOTENAME", QuoteName("ab]c"), "[ab]]c]"},
+		{"QUOTENAME quote", QuoteName("it's", "'"), "'it''s'"},
+		{"QUOTENAME closing", QuoteName("x", ")"), "(x)"},
+		{"QUOTENAME invalid", QuoteName("x", "|"), ""},
+		{"FORMATMESSAGE", FormatMessage("Order %d for %s: %5.2s|%-4i|%x", int32(42), "Ann", "abc", 7, 255), "Order 42 for Ann:    ab|7   |ff"},
+		{"FORMATMESSAGE missing", FormatMessage("%s and %d, 100%%", "a"), "a and (null), 100%"},
+		{"FORMATMESSAGE string as number", FormatMessage("%d", "12"), "12"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.name, tt.got, tt.want)
+		}
+	}
+
+	indexes := []struct {
+		name string
+		got  int32
+		want int32
+	}{
+		{"CHARINDEX", CharIndex("lo", "héllo"), 4},
+		{"CHARINDEX start", CharIndex("a", "banana", 3), 4},
+		{"CHARINDEX missing", CharIndex("z", "banana"), 0},
+		{"CHARINDEX empty", CharIndex("", "banana"), 0},
+		{"CHARINDEX start past the end", CharIndex("a", "banana", 10), 0},
+		{"PATINDEX", PatIndex("%ter%", "interesting"), 3},
+		{"PATINDEX class", PatIndex("%[0-9]%", "abc1d"), 4},
+		{"PATINDEX negated class", PatIndex("%[^a-z]%", "ab-c"), 3},
+		{"PATINDEX underscore", PatIndex("%b_d%", "abcd"), 2},
+		{"PATINDEX anchored", PatIndex("ab%", "xab"), 0},
+		{"PATINDEX suffix", PatIndex("%ing", "interesting"), 9},
+		{"PATINDEX any", PatIndex("%", "abc"), 1},
+	}
+	for _, tt := range indexes {
+		if tt.got != tt.want {
+			t.Errorf("%s = %d, want %d", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestLike(t *testing.T) {
+	for _, tt := range []struct {
+		s, pattern, escape string
+		want               bool
+	}{
+		{"ABCDEF", "abc%", "", true},
+		{"xABC", "abc%", "", false},
+		{"Smith", "Sm_th", "", true},
+		{"Smiith", "Sm_th", "", false},
+		{"Carter", "[A-C]%", "", true},
+		{"Davis", "[A-C]%", "", false},
+		{"Davis", "[^A-C]%", "", true},
+		{"50%", "%[%]", "", true},
+		{"50% off", "%0!% %", "!", true},
+		{"500 off", "%0!% %", "!", false},
+		{"a_b", "a\\_b", "\\", true},
+		{"axb", "a\\_b", "\\", false},
+		{"line\nbreak", "line%", "", true},
+		{"", "%", "", true},
+	} {
+		if got := LikeEscape(tt.s, tt.pattern, tt.escape); got != tt.want {
+			t.Errorf("LikeEscape(%q, %q, %q) = %v, want %v", tt.s, tt.pattern, tt.escape, got, tt.want)
+		}
+	}
+	if !Like("héllo", "h_llo") {
+		t.Error(`Like("héllo", "h_llo") = false, want true`)
+	}
+}
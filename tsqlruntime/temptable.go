@@ -47,16 +47,23 @@ type TableVariable struct {
 // TempTableManager manages temporary tables for a session
 type TempTableManager struct {
 	localTables  map[string]*TempTable  // #tables - session scoped
-	globalTables map[string]*TempTable  // ##tables - global (simplified)
+	globalTables *GlobalTempTables      // ##tables - shared
 	tableVars    map[string]*TableVariable
 	mu           sync.RWMutex
 }
 
-// NewTempTableManager creates a new temp table manager
+// NewTempTableManager creates a new temp table manager, sharing the
+// process's global temp tables (GlobalTables)
 func NewTempTableManager() *TempTableManager {
+	return NewTempTableManagerWith(GlobalTables)
+}
+
+// NewTempTableManagerWith creates a new temp table manager whose global
+// temp tables are those of globals
+func NewTempTableManagerWith(globals *GlobalTempTables) *TempTableManager {
 	return &TempTableManager{
 		localTables:  make(map[string]*TempTable),
-		globalTables: make(map[string]*TempTable),
+		globalTables: globals,
 		tableVars:    make(map[string]*TableVariable),
 	}
 }
@@ -68,14 +75,10 @@ func (m *TempTableManager) CreateTempTable(name string, columns []TempTableColum
 
 	// Normalize name
 	name = strings.ToLower(name)
-	isGlobal := strings.HasPrefix(name, "##")
+	isGlobal := isGlobalTempTable(name)
 
 	// Check if already exists
-	if isGlobal {
-		if _, exists := m.globalTables[name]; exists {
-			return nil, fmt.Errorf("temp table %s already exists", name)
-		}
-	} else {
+	if !isGlobal {
 		if _, exists := m.localTables[name]; exists {
 			return nil, fmt.Errorf("temp table %s already exists", name)
 		}
@@ -89,7 +92,9 @@ func (m *TempTableManager) CreateTempTable(name string, columns []TempTableColum
 	}
 
 	if isGlobal {
-		m.globalTables[name] = table
+		if err := m.globalTables.create(name, table, m); err != nil {
+			return nil, err
+		}
 	} else {
 		m.localTables[name] = table
 	}
@@ -110,8 +115,8 @@ func (m *TempTableManager) GetTempTable(name string) (*TempTable, bool) {
 	}
 
 	// Then global tables
-	if table, ok := m.globalTables[name]; ok {
-		return table, true
+	if isGlobalTempTable(name) {
+		return m.globalTables.get(name)
 	}
 
 	return nil, false
@@ -124,17 +129,13 @@ func (m *TempTableManager) DropTempTable(name string) error {
 
 	name = strings.ToLower(name)
 
-	if strings.HasPrefix(name, "##") {
-		if _, exists := m.globalTables[name]; !exists {
-			return fmt.Errorf("temp table %s does not exist", name)
-		}
-		delete(m.globalTables, name)
-	} else {
-		if _, exists := m.localTables[name]; !exists {
-			return fmt.Errorf("temp table %s does not exist", name)
-		}
-		delete(m.localTables, name)
+	if isGlobalTempTable(name) {
+		return m.globalTables.drop(name)
+	}
+	if _, exists := m.localTables[name]; !exists {
+		return fmt.Errorf("temp table %s does not exist", name)
 	}
+	delete(m.localTables, name)
 
 	return nil
 }
@@ -179,13 +180,31 @@ func (m *TempTableManager) GetTableVariable(name string) (*TableVariable, bool)
 	return tv, ok
 }
 
-// ClearSession clears all session-scoped temp tables and table variables
+// Table returns the temp table or table variable called name (#name,
+// ##name or @name), or an error if there is none.
+func (m *TempTableManager) Table(name string) (*TempTable, error) {
+	if strings.HasPrefix(name, "@") {
+		if tv, ok := m.GetTableVariable(name); ok {
+			return tv.TempTable, nil
+		}
+		return nil, fmt.Errorf("must declare the table variable %s", name)
+	}
+	if table, ok := m.GetTempTable(name); ok {
+		return table, nil
+	}
+	return nil, fmt.Errorf("invalid object name '%s'", name)
+}
+
+// ClearSession clears all session-scoped temp tables and table variables,
+// and the global temp tables the session created if the registry drops
+// them with their session
 func (m *TempTableManager) ClearSession() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	m.localTables = make(map[string]*TempTable)
 	m.tableVars = make(map[string]*TableVariable)
+	m.globalTables.endSession(m)
 }
 
 // TempTable methods
@@ -236,6 +255,9 @@ func (t *TempTable) Insert(values map[string]Value) (int64, error) {
 			row[i] = NewBigInt(identityValue)
 		} else if val, ok := values[strings.ToLower(col.Name)]; ok {
 			row[i] = val
+		} else if col.Nullable && col.DefaultValue.Type == TypeUnknown && !col.DefaultValue.IsNull {
+			// No default given
+			row[i] = Null(col.Type)
 		} else if !col.DefaultValue.IsNull || col.Nullable {
 			row[i] = col.DefaultValue
 		} else {
@@ -247,6 +269,57 @@ func (t *TempTable) Insert(values map[string]Value) (int64, error) {
 	return identityValue, nil
 }
 
+// InsertScanned inserts a row of values scanned by database/sql, such as a
+// row of an OUTPUT clause, converting each to the type of its column.
+// Values go to the named columns, or to the columns other than identity
+// columns in order if columns is nil; columns not given get their default.
+func (t *TempTable) InsertScanned(columns []string, values []any) error {
+	if columns == nil {
+		for _, col := range t.Columns {
+			if !col.Identity {
+				columns = append(columns, col.Name)
+			}
+		}
+	}
+	if len(values) != len(columns) {
+		return fmt.Errorf("%s: expected %d values, got %d", t.Name, len(columns), len(values))
+	}
+	row := make(map[string]Value, len(columns))
+	for i, name := range columns {
+		col, ok := t.GetColumn(name)
+		if !ok {
+			return fmt.Errorf("%s: invalid column name '%s'", t.Name, name)
+		}
+		v, err := scannedValue(*col, values[i])
+		if err != nil {
+			return fmt.Errorf("%s: column %s: %w", t.Name, col.Name, err)
+		}
+		row[strings.ToLower(col.Name)] = v
+	}
+	_, err := t.Insert(row)
+	return err
+}
+
+// scannedValue converts a value scanned by database/sql to the type of col.
+func scannedValue(col TempTableColumn, v any) (Value, error) {
+	if b, ok := v.([]byte); ok && col.Type != TypeBinary && col.Type != TypeVarBinary {
+		// Drivers return text as []byte
+		v = string(b)
+	}
+	val := ToValue(v)
+	maxLen := col.MaxLen
+	switch col.Type {
+	case TypeUnknown, TypeDateTimeOffset, TypeText, TypeNText, TypeUniqueIdentifier, TypeXML, TypeTable:
+		// Kept as scanned
+		return val, nil
+	case TypeChar, TypeNChar:
+		if maxLen <= 0 {
+			return Cast(val, TypeNVarChar, 0, 0, 0)
+		}
+	}
+	return Cast(val, col.Type, col.Precision, col.Scale, maxLen)
+}
+
 // InsertRow inserts a row with values in column order
 func (t *TempTable) InsertRow(values []Value) (int64, error) {
 	t.mu.Lock()
@@ -359,6 +432,104 @@ func (t *TempTable) Update(updates map[string]Value, predicate func(row []Value)
 	return count
 }
 
+// UpdateRows updates the rows matching predicate, or every row if it is
+// nil, to the values set returns for each, keyed by column name and cast
+// to the columns' types. set reads the row as it was before the update, as
+// the SET clauses of an UPDATE do. It returns the number of rows updated.
+func (t *TempTable) UpdateRows(predicate func(row []Value) bool, set func(row []Value) map[string]Value) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	count := 0
+	for i, row := range t.Rows {
+		if predicate != nil && !predicate(row) {
+			continue
+		}
+		updated := make([]Value, len(row))
+		copy(updated, row)
+		for name, val := range set(row) {
+			idx := t.GetColumnIndex(name)
+			if idx < 0 {
+				return count, fmt.Errorf("%s: invalid column name '%s'", t.Name, name)
+			}
+			v, err := scannedValue(t.Columns[idx], val)
+			if err != nil {
+				return count, fmt.Errorf("%s: column %s: %w", t.Name, t.Columns[idx].Name, err)
+			}
+			updated[idx] = v
+		}
+		t.Rows[i] = updated
+		count++
+	}
+	return count, nil
+}
+
+// SortKey is a column rows are sorted by, as in ORDER BY.
+type SortKey struct {
+	Column int // Index of the column in the row
+	Desc   bool
+}
+
+// SortRows sorts rows by keys, in order, keeping the order of rows that
+// compare equal. NULLs sort first, as in SQL Server.
+func SortRows(rows [][]Value, keys ...SortKey) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, k := range keys {
+			a, b := rows[i][k.Column], rows[j][k.Column]
+			var cmp int
+			switch {
+			case a.IsNull && b.IsNull:
+			case a.IsNull:
+				cmp = -1
+			case b.IsNull:
+				cmp = 1
+			default:
+				cmp = a.Compare(b)
+			}
+			if cmp == 0 {
+				continue
+			}
+			if k.Desc {
+				return cmp > 0
+			}
+			return cmp < 0
+		}
+		return false
+	})
+}
+
+// Aggregate computes SUM, AVG, MIN, MAX or COUNT of the values value reads
+// from rows. NULLs are skipped, as in SQL Server: COUNT counts the values
+// that aren't NULL, and the others are NULL when there are none.
+func Aggregate(name string, rows [][]Value, value func(row []Value) Value) Value {
+	var result Value
+	count := 0
+	for _, row := range rows {
+		v := value(row)
+		if v.IsNull {
+			continue
+		}
+		switch {
+		case count == 0:
+			result = v
+		case name == "SUM" || name == "AVG":
+			result = result.Add(v)
+		case name == "MIN" && v.Compare(result) < 0, name == "MAX" && v.Compare(result) > 0:
+			result = v
+		}
+		count++
+	}
+	switch {
+	case name == "COUNT":
+		return NewInt(int64(count))
+	case count == 0:
+		return Null(result.Type)
+	case name == "AVG":
+		return result.Div(NewInt(int64(count)))
+	}
+	return result
+}
+
 // Delete removes rows matching the predicate
 func (t *TempTable) Delete(predicate func(row []Value) bool) int {
 	t.mu.Lock()
@@ -0,0 +1,44 @@
+package tsqlruntime
+
+import (
+	"context"
+	"time"
+)
+
+// StatementTimeout gives each statement of a procedure its own deadline.
+// Generated code calls Next before every statement and Stop when the
+// procedure returns (--timeout-scope=statement):
+//
+//	stmtTimeout := tsqlruntime.NewStatementTimeout(ctx, 5*time.Second)
+//	defer stmtTimeout.Stop()
+//	...
+//	stmtCtx = stmtTimeout.Next()
+//	result, err := r.db.ExecContext(stmtCtx, ...)
+type StatementTimeout struct {
+	parent  context.Context
+	timeout time.Duration
+	cancel  context.CancelFunc
+}
+
+// NewStatementTimeout returns a StatementTimeout whose statement contexts
+// derive from ctx.
+func NewStatementTimeout(ctx context.Context, timeout time.Duration) *StatementTimeout {
+	return &StatementTimeout{parent: ctx, timeout: timeout}
+}
+
+// Next ends the previous statement's context and returns one for the next
+// statement, which is cancelled after the timeout.
+func (s *StatementTimeout) Next() context.Context {
+	s.Stop()
+	ctx, cancel := context.WithTimeout(s.parent, s.timeout)
+	s.cancel = cancel
+	return ctx
+}
+
+// Stop ends the current statement's context.
+func (s *StatementTimeout) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+		s.cancel = nil
+	}
+}
@@ -0,0 +1,32 @@
+package tsqlruntime
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestStatementTimeout(t *testing.T) {
+	st := NewStatementTimeout(context.Background(), time.Minute)
+	first := st.Next()
+	if _, ok := first.Deadline(); !ok {
+		t.Fatal("expected a deadline")
+	}
+	second := st.Next()
+	if first.Err() != context.Canceled {
+		t.Errorf("expected the previous statement's context to be cancelled, got %v", first.Err())
+	}
+	if second.Err() != nil {
+		t.Errorf("expected the current statement's context to be live, got %v", second.Err())
+	}
+	st.Stop()
+	if second.Err() != context.Canceled {
+		t.Errorf("expected Stop to cancel the current context, got %v", second.Err())
+	}
+
+	expired := NewStatementTimeout(context.Background(), time.Nanosecond).Next()
+	<-expired.Done()
+	if expired.Err() != context.DeadlineExceeded {
+		t.Errorf("expected DeadlineExceeded, got %v", expired.Err())
+	}
+}
@@ -0,0 +1,197 @@
+package tsqlruntime
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// windowsZones maps the Windows time zone names SQL Server uses, as listed
+// by sys.time_zone_info, to IANA names. Names not listed are tried as IANA
+// names.
+var windowsZones = map[string]string{
+	"utc":                            "UTC",
+	"coordinated universal time":     "UTC",
+	"gmt standard time":              "Europe/London",
+	"greenwich standard time":        "Atlantic/Reykjavik",
+	"w. europe standard time":        "Europe/Berlin",
+	"central europe standard time":   "Europe/Budapest",
+	"central european standard time": "Europe/Warsaw",
+	"romance standard time":          "Europe/Paris",
+	"e. europe standard time":        "Europe/Chisinau",
+	"fle standard time":              "Europe/Kiev",
+	"gtb standard time":              "Europe/Bucharest",
+	"russian standard time":          "Europe/Moscow",
+	"turkey standard time":           "Europe/Istanbul",
+	"israel standard time":           "Asia/Jerusalem",
+	"south africa standard time":     "Africa/Johannesburg",
+	"egypt standard time":            "Africa/Cairo",
+	"arabian standard time":          "Asia/Dubai",
+	"arab standard time":             "Asia/Riyadh",
+	"iran standard time":             "Asia/Tehran",
+	"pakistan standard time":         "Asia/Karachi",
+	"india standard time":            "Asia/Kolkata",
+	"bangladesh standard time":       "Asia/Dhaka",
+	"se asia standard time":          "Asia/Bangkok",
+	"china standard time":            "Asia/Shanghai",
+	"singapore standard time":        "Asia/Singapore",
+	"taipei standard time":           "Asia/Taipei",
+	"tokyo standard time":            "Asia/Tokyo",
+	"korea standard time":            "Asia/Seoul",
+	"aus central standard time":      "Australia/Darwin",
+	"cen. australia standard time":   "Australia/Adelaide",
+	"aus eastern standard time":      "Australia/Sydney",
+	"e. australia standard time":     "Australia/Brisbane",
+	"w. australia standard time":     "Australia/Perth",
+	"new zealand standard time":      "Pacific/Auckland",
+	"hawaiian standard time":         "Pacific/Honolulu",
+	"alaskan standard time":          "America/Anchorage",
+	"pacific standard time":          "America/Los_Angeles",
+	"us mountain standard time":      "America/Phoenix",
+	"mountain standard time":         "America/Denver",
+	"central standard time":          "America/Chicago",
+	"central america standard time":  "America/Guatemala",
+	"canada central standard time":   "America/Regina",
+	"central standard time (mexico)": "America/Mexico_City",
+	"eastern standard time":          "America/New_York",
+	"us eastern standard time":       "America/Indianapolis",
+	"atlantic standard time":         "America/Halifax",
+	"newfoundland standard time":     "America/St_Johns",
+	"sa pacific standard time":       "America/Bogota",
+	"venezuela standard time":        "America/Caracas",
+	"pacific sa standard time":       "America/Santiago",
+	"argentina standard time":        "America/Buenos_Aires",
+	"e. south america standard time": "America/Sao_Paulo",
+}
+
+var (
+	locationMu sync.Mutex
+	locations  = map[string]*time.Location{}
+)
+
+// IANAZone returns the IANA name for a time zone name as AT TIME ZONE
+// accepts it, either a Windows name such as 'Pacific Standard Time' or an
+// IANA name, which is returned as it is.
+func IANAZone(zone string) string {
+	zone = strings.TrimSpace(zone)
+	if iana, ok := windowsZones[strings.ToLower(zone)]; ok {
+		return iana
+	}
+	return zone
+}
+
+// Location returns the time zone named zone, a Windows or IANA name, or an
+// error if it is unknown. Locations are loaded once.
+func Location(zone string) (*time.Location, error) {
+	name := IANAZone(zone)
+	locationMu.Lock()
+	defer locationMu.Unlock()
+	if loc, ok := locations[name]; ok {
+		return loc, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("the time zone parameter '%s' provided in AT TIME ZONE clause is invalid", zone)
+	}
+	locations[name] = loc
+	return loc, nil
+}
+
+// AtTimeZone is t AT TIME ZONE zone for a DATETIMEOFFSET value: the same
+// instant, in zone. Unknown zones leave t as it is.
+func AtTimeZone(t time.Time, zone string) time.Time {
+	loc, err := Location(zone)
+	if err != nil {
+		return t
+	}
+	return t.In(loc)
+}
+
+// InTimeZone is t AT TIME ZONE zone for a value without an offset, such as
+// a DATETIME: the same wall clock time, taken to be in zone. Unknown zones
+// leave t as it is.
+func InTimeZone(t time.Time, zone string) time.Time {
+	loc, err := Location(zone)
+	if err != nil {
+		return t
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+}
+
+// SwitchOffset is SWITCHOFFSET: the same instant, with the UTC offset
+// offset, a string such as "-08:00" or a number of minutes.
+func SwitchOffset(t time.Time, offset any) time.Time {
+	return t.In(offsetZone(offset))
+}
+
+// ToDateTimeOffset is TODATETIMEOFFSET: the same wall clock time, with the
+// UTC offset offset.
+func ToDateTimeOffset(t time.Time, offset any) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), offsetZone(offset))
+}
+
+// SmallDateTime rounds t to the minute, as storing it in a SMALLDATETIME
+// does.
+func SmallDateTime(t time.Time) time.Time {
+	return t.Round(time.Minute)
+}
+
+// offsetZone returns a fixed zone for a UTC offset, "+hh:mm", "-hh:mm" or
+// a number of minutes. Offsets that aren't either are UTC.
+func offsetZone(offset any) *time.Location {
+	var minutes int
+	switch o := offset.(type) {
+	case int:
+		minutes = o
+	case int32:
+		minutes = int(o)
+	case int64:
+		minutes = int(o)
+	case string:
+		m, ok := parseOffset(o)
+		if !ok {
+			return time.UTC
+		}
+		minutes = m
+	default:
+		return time.UTC
+	}
+	if minutes == 0 {
+		return time.UTC
+	}
+	sign := '+'
+	abs := minutes
+	if minutes < 0 {
+		sign, abs = '-', -minutes
+	}
+	return time.FixedZone(fmt.Sprintf("%c%02d:%02d", sign, abs/60, abs%60), minutes*60)
+}
+
+// parseOffset parses "+hh:mm" or "-hh:mm" into minutes.
+func parseOffset(s string) (int, bool) {
+	s = strings.TrimSpace(s)
+	if s == "Z" {
+		return 0, true
+	}
+	if len(s) < 2 || (s[0] != '+' && s[0] != '-') {
+		return 0, false
+	}
+	hh, mm, _ := strings.Cut(s[1:], ":")
+	h, err := strconv.Atoi(hh)
+	if err != nil || h > 14 {
+		return 0, false
+	}
+	m := 0
+	if mm != "" {
+		if m, err = strconv.Atoi(mm); err != nil || m > 59 {
+			return 0, false
+		}
+	}
+	minutes := h*60 + m
+	if s[0] == '-' {
+		minutes = -minutes
+	}
+	return minutes, true
+}
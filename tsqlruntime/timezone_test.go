@@ -0,0 +1,45 @@
+package tsqlruntime
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestTimeZones(t *testing.T) {
+	if got := IANAZone("Pacific Standard Time"); got != "America/Los_Angeles" {
+		t.Errorf("IANAZone = %q", got)
+	}
+	if got := IANAZone("Europe/Paris"); got != "Europe/Paris" {
+		t.Errorf("IANAZone kept IANA name as %q", got)
+	}
+	if _, err := Location("Nowhere Standard Time"); err == nil {
+		t.Error("expected an error for an unknown zone")
+	}
+
+	utc := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	at := AtTimeZone(utc, "Pacific Standard Time")
+	if !at.Equal(utc) || at.Hour() != 5 {
+		t.Errorf("AtTimeZone = %v, want the same instant at 05:00", at)
+	}
+	in := InTimeZone(utc, "W. Europe Standard Time")
+	if in.Hour() != 12 || in.Sub(utc) != -2*time.Hour {
+		t.Errorf("InTimeZone = %v, want 12:00 +02:00", in)
+	}
+
+	sw := SwitchOffset(utc, "-08:00")
+	if !sw.Equal(utc) || sw.Hour() != 4 {
+		t.Errorf("SwitchOffset = %v", sw)
+	}
+	to := ToDateTimeOffset(utc, int32(330))
+	if to.Hour() != 12 || to.Format("-07:00") != "+05:30" {
+		t.Errorf("ToDateTimeOffset = %v", to)
+	}
+	if got := SwitchOffset(utc, "bogus"); got.Location() != time.UTC {
+		t.Errorf("invalid offset gave %v", got.Location())
+	}
+
+	if got := SmallDateTime(time.Date(2024, 1, 1, 10, 29, 30, 0, time.UTC)); got.Minute() != 30 || got.Second() != 0 {
+		t.Errorf("SmallDateTime = %v", got)
+	}
+}
@@ -0,0 +1,9 @@
+// Package traceotel adapts an OpenTelemetry trace.Tracer to
+// tsqlruntime.Tracer, for code generated with --otel.
+//
+// It needs go.opentelemetry.io/otel, so it is only compiled with the otel
+// build tag:
+//
+//	go get go.opentelemetry.io/otel
+//	go build -tags otel ./...
+package traceotel
@@ -0,0 +1,44 @@
+//go:build otel
+
+package traceotel
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ha1tch/tgpiler/tsqlruntime"
+)
+
+// Tracer starts OpenTelemetry spans. Attributes are added to every span,
+// e.g. attribute.String("db.system", "postgresql").
+type Tracer struct {
+	Tracer     trace.Tracer
+	Attributes []attribute.KeyValue
+}
+
+// Start starts a span named name with attrs.
+func (t Tracer) Start(ctx context.Context, name string, attrs ...tsqlruntime.Attribute) (context.Context, tsqlruntime.Span) {
+	kvs := append([]attribute.KeyValue(nil), t.Attributes...)
+	for _, a := range attrs {
+		kvs = append(kvs, attribute.String(a.Key, a.Value))
+	}
+	ctx, span := t.Tracer.Start(ctx, name, trace.WithAttributes(kvs...))
+	return ctx, Span{span}
+}
+
+// Span wraps a trace.Span.
+type Span struct {
+	trace.Span
+}
+
+// End records err, if any, with an error status and ends the span.
+func (s Span) End(err error) {
+	if err != nil {
+		s.Span.RecordError(err)
+		s.Span.SetStatus(codes.Error, err.Error())
+	}
+	s.Span.End()
+}
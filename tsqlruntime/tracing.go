@@ -0,0 +1,118 @@
+package tsqlruntime
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// Tracer starts spans for code generated with --otel. The traceotel
+// package adapts an OpenTelemetry trace.Tracer to it, so the runtime
+// itself doesn't depend on OpenTelemetry; a nil Tracer traces nothing.
+type Tracer interface {
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// Span is a started span.
+type Span interface {
+	// End ends the span, with an error status when err is not nil.
+	End(err error)
+}
+
+// Attribute is a span attribute, named after the OpenTelemetry semantic
+// conventions (db.statement, rpc.method, ...).
+type Attribute struct {
+	Key   string
+	Value string
+}
+
+// NopTracer is a Tracer whose spans do nothing.
+type NopTracer struct{}
+
+// Start returns ctx and a span that does nothing.
+func (NopTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	return ctx, nopSpan{}
+}
+
+type nopSpan struct{}
+
+func (nopSpan) End(error) {}
+
+// StartSpan starts a span with tracer, which may be nil. Generated
+// procedures start one for their whole call:
+//
+//	ctx, span := tsqlruntime.StartSpan(ctx, r.tracer, "usp_GetOrder")
+//	defer func() { span.End(err) }()
+func StartSpan(ctx context.Context, tracer Tracer, name string, attrs ...Attribute) (context.Context, Span) {
+	if tracer == nil {
+		return ctx, nopSpan{}
+	}
+	return tracer.Start(ctx, name, attrs...)
+}
+
+// StartRPCSpan starts a span for a gRPC call of method.
+func StartRPCSpan(ctx context.Context, tracer Tracer, method string) (context.Context, Span) {
+	return StartSpan(ctx, tracer, method,
+		Attribute{Key: "rpc.system", Value: "grpc"},
+		Attribute{Key: "rpc.method", Value: method})
+}
+
+// startDBSpan starts a span for query, named after its first keyword.
+func startDBSpan(ctx context.Context, tracer Tracer, query string) (context.Context, Span) {
+	op := strings.ToUpper(strings.SplitN(strings.TrimSpace(query), " ", 2)[0])
+	return StartSpan(ctx, tracer, op,
+		Attribute{Key: "db.operation", Value: op},
+		Attribute{Key: "db.statement", Value: query})
+}
+
+// TracedExecContext runs db.ExecContext in a span.
+func TracedExecContext(ctx context.Context, tracer Tracer, db DBTX, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := startDBSpan(ctx, tracer, query)
+	result, err := db.ExecContext(ctx, query, args...)
+	span.End(err)
+	return result, err
+}
+
+// TracedQueryContext runs db.QueryContext in a span, which ends when the
+// query returns rather than when the rows are closed.
+func TracedQueryContext(ctx context.Context, tracer Tracer, db DBTX, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := startDBSpan(ctx, tracer, query)
+	rows, err := db.QueryContext(ctx, query, args...)
+	span.End(err)
+	return rows, err
+}
+
+// TracedQueryRowContext runs db.QueryRowContext in a span.
+func TracedQueryRowContext(ctx context.Context, tracer Tracer, db DBTX, query string, args ...interface{}) *sql.Row {
+	ctx, span := startDBSpan(ctx, tracer, query)
+	row := db.QueryRowContext(ctx, query, args...)
+	span.End(row.Err())
+	return row
+}
+
+// TraceDB returns db with each call run in a span, for generated code that
+// hands the store to a runtime helper (ExecTableParams, ...) instead of
+// calling it directly. A nil tracer returns db itself.
+func TraceDB(tracer Tracer, db DBTX) DBTX {
+	if tracer == nil {
+		return db
+	}
+	return tracedDB{tracer: tracer, db: db}
+}
+
+type tracedDB struct {
+	tracer Tracer
+	db     DBTX
+}
+
+func (t tracedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return TracedExecContext(ctx, t.tracer, t.db, query, args...)
+}
+
+func (t tracedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return TracedQueryContext(ctx, t.tracer, t.db, query, args...)
+}
+
+func (t tracedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return TracedQueryRowContext(ctx, t.tracer, t.db, query, args...)
+}
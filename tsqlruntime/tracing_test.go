@@ -0,0 +1,69 @@
+package tsqlruntime
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type recordedSpan struct {
+	name  string
+	attrs []Attribute
+	err   error
+	ended bool
+}
+
+func (s *recordedSpan) End(err error) {
+	s.err = err
+	s.ended = true
+}
+
+type recordingTracer struct {
+	spans []*recordedSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	s := &recordedSpan{name: name, attrs: attrs}
+	t.spans = append(t.spans, s)
+	return ctx, s
+}
+
+func TestStartSpan(t *testing.T) {
+	ctx := context.Background()
+	got, span := StartSpan(ctx, nil, "usp_GetOrder")
+	if got != ctx {
+		t.Error("expected a nil tracer to return ctx")
+	}
+	span.End(errors.New("ignored"))
+
+	tracer := &recordingTracer{}
+	_, span = StartRPCSpan(ctx, tracer, "GetOrder")
+	failure := errors.New("unavailable")
+	span.End(failure)
+	if len(tracer.spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(tracer.spans))
+	}
+	s := tracer.spans[0]
+	if s.name != "GetOrder" || !s.ended || s.err != failure {
+		t.Errorf("unexpected span %+v", s)
+	}
+	want := []Attribute{{"rpc.system", "grpc"}, {"rpc.method", "GetOrder"}}
+	if len(s.attrs) != 2 || s.attrs[0] != want[0] || s.attrs[1] != want[1] {
+		t.Errorf("expected attributes %v, got %v", want, s.attrs)
+	}
+}
+
+func TestStartDBSpan(t *testing.T) {
+	tracer := &recordingTracer{}
+	query := "  update Orders SET Viewed = 1"
+	_, span := startDBSpan(context.Background(), tracer, query)
+	span.End(nil)
+	s := tracer.spans[0]
+	if s.name != "UPDATE" {
+		t.Errorf("expected span UPDATE, got %q", s.name)
+	}
+	want := []Attribute{{"db.operation", "UPDATE"}, {"db.statement", query}}
+	if len(s.attrs) != 2 || s.attrs[0] != want[0] || s.attrs[1] != want[1] {
+		t.Errorf("expected attributes %v, got %v", want, s.attrs)
+	}
+}
@@ -0,0 +1,370 @@
+package tsqlruntime
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// TableParam is a table-valued parameter: the rows of a user-defined table
+// type (CREATE TYPE ... AS TABLE) passed to a procedure. Generated code
+// builds one from the procedure's slice-of-struct parameter and hands it to
+// ExecTableParams, QueryTableParams or QueryRowTableParams, which replace
+// the @Name table reference in the query with the rows.
+type TableParam struct {
+	Name    string   // Name the query reads it by, without the @
+	Columns []string // Column names, in row order
+	Types   []string // Postgres column types, for unnest
+	Rows    [][]interface{}
+}
+
+// ExpandTableParams replaces each @Name reference to one of params in query
+// with its rows, returning the query and arguments to run. On postgres the
+// rows are passed as one array per column and read back with unnest(), so
+// the statement has a fixed number of arguments:
+//
+//	FROM @Items  ->  FROM unnest($2::text::integer[], ...) AS Items(ProductID, ...)
+//
+// Other dialects read them from a UNION ALL of one SELECT per row, with
+// one placeholder per value. An alias on the reference (FROM @Items i) is
+// kept. On postgres a membership test on one column becomes a comparison
+// with the column's array, as pq.Array would pass it:
+//
+//	ProductID IN (SELECT ProductID FROM @Items)  ->  ProductID = ANY($2::text::integer[])
+//	ProductID NOT IN (SELECT ...)                ->  ProductID <> ALL($2::text::integer[])
+func ExpandTableParams(dialect Dialect, query string, args []interface{}, params ...TableParam) (string, []interface{}) {
+	byName := make(map[string]*TableParam, len(params))
+	for i := range params {
+		byName[strings.ToLower(params[i].Name)] = &params[i]
+	}
+
+	var out strings.Builder
+	var expanded []interface{}
+	next := len(args) + 1 // Next numbered placeholder
+	used := 0             // Arguments of args copied for ? placeholders
+	inQuote := false
+	for pos := 0; pos < len(query); pos++ {
+		c := query[pos]
+		switch {
+		case c == '\'':
+			inQuote = !inQuote
+		case inQuote:
+		case dialect == DialectPostgres && (c == 'I' || c == 'i' || c == 'N' || c == 'n') && (pos == 0 || !isIdentPart(query[pos-1])):
+			m := inTableParamRe.FindStringSubmatch(query[pos:])
+			if m == nil {
+				break
+			}
+			p, ok := byName[strings.ToLower(m[3])]
+			if !ok {
+				break
+			}
+			column := p.column(m[2])
+			if column < 0 {
+				break
+			}
+			op := "= ANY"
+			if m[1] != "" {
+				op = "<> ALL"
+			}
+			out.WriteString(fmt.Sprintf("%s(%s)", op, p.array(column, &next)))
+			expanded = append(expanded, p.columnArray(column))
+			pos += len(m[0]) - 1
+			continue
+		case c == '?' && !numberedPlaceholders(dialect):
+			if used < len(args) {
+				expanded = append(expanded, args[used])
+				used++
+			}
+		case c == '@' && (pos == 0 || query[pos-1] != '@') && pos+1 < len(query) && isIdentStart(query[pos+1]):
+			end := pos + 1
+			for end < len(query) && isIdentPart(query[end]) {
+				end++
+			}
+			p, ok := byName[strings.ToLower(query[pos+1:end])]
+			if !ok {
+				break
+			}
+			alias, rest := tableAlias(query[end:])
+			if alias == "" {
+				alias = p.Name
+			}
+			expr, values := p.expand(dialect, alias, &next)
+			out.WriteString(expr)
+			expanded = append(expanded, values...)
+			pos = len(query) - len(rest) - 1
+			continue
+		}
+		out.WriteByte(c)
+	}
+	if numberedPlaceholders(dialect) {
+		expanded = append(append([]interface{}{}, args...), expanded...)
+	} else {
+		expanded = append(expanded, args[used:]...)
+	}
+	return out.String(), expanded
+}
+
+// expand returns the SQL that reads the rows as a table named alias, and
+// its arguments, numbering placeholders from *next.
+func (p *TableParam) expand(dialect Dialect, alias string, next *int) (string, []interface{}) {
+	columns := strings.Join(p.Columns, ", ")
+	if dialect == DialectPostgres {
+		arrays := make([]string, len(p.Columns))
+		values := make([]interface{}, len(p.Columns))
+		for i := range p.Columns {
+			arrays[i] = p.array(i, next)
+			values[i] = p.columnArray(i)
+		}
+		return fmt.Sprintf("unnest(%s) AS %s(%s)", strings.Join(arrays, ", "), alias, columns), values
+	}
+
+	if len(p.Rows) == 0 {
+		nulls := make([]string, len(p.Columns))
+		for i, col := range p.Columns {
+			nulls[i] = "NULL AS " + col
+		}
+		return fmt.Sprintf("(SELECT %s WHERE 1 = 0) AS %s", strings.Join(nulls, ", "), alias), nil
+	}
+	var values []interface{}
+	selects := make([]string, len(p.Rows))
+	for r, row := range p.Rows {
+		cols := make([]string, len(p.Columns))
+		for i, col := range p.Columns {
+			cols[i] = bulkPlaceholder(dialect, *next)
+			*next++
+			if r == 0 {
+				cols[i] += " AS " + col
+			}
+			values = append(values, row[i])
+		}
+		selects[r] = "SELECT " + strings.Join(cols, ", ")
+	}
+	return fmt.Sprintf("(%s) AS %s", strings.Join(selects, " UNION ALL "), alias), values
+}
+
+// inTableParamRe matches a membership test on one column of a table-valued
+// parameter, capturing the NOT, the column and the parameter.
+var inTableParamRe = regexp.MustCompile(`^(?i)(NOT\s+)?IN\s*\(\s*SELECT\s+(?:DISTINCT\s+)?([A-Za-z_]\w*)\s+FROM\s+@([A-Za-z_]\w*)\s*\)`)
+
+// column returns the index of the column named name, or -1.
+func (p *TableParam) column(name string) int {
+	for i, col := range p.Columns {
+		if strings.EqualFold(col, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// array returns the placeholder for the postgres array of column i,
+// numbered *next.
+func (p *TableParam) array(i int, next *int) string {
+	typ := "text"
+	if i < len(p.Types) {
+		typ = p.Types[i]
+	}
+	// Passed as text so any driver can send it
+	placeholder := fmt.Sprintf("%s::text::%s[]", bulkPlaceholder(DialectPostgres, *next), typ)
+	*next++
+	return placeholder
+}
+
+// columnArray returns the values of column i as a postgres array literal.
+func (p *TableParam) columnArray(i int) string {
+	column := make([]interface{}, len(p.Rows))
+	for r, row := range p.Rows {
+		column[r] = row[i]
+	}
+	return postgresArray(column)
+}
+
+// ExecTableParams runs an INSERT, UPDATE, DELETE or MERGE that reads
+// table-valued parameters (see ExpandTableParams). Outside postgres, an
+// INSERT reading a single parameter is split into batches small enough for
+// the driver's parameter limit (see bulkMaxParams); the result's
+// RowsAffected is their total.
+func ExecTableParams(ctx context.Context, db DBTX, dialect Dialect, query string, params []TableParam, args ...interface{}) (sql.Result, error) {
+	batches := [][]TableParam{params}
+	if dialect != DialectPostgres && len(params) == 1 && len(params[0].Columns) > 0 &&
+		strings.HasPrefix(strings.ToUpper(strings.TrimSpace(query)), "INSERT") {
+		limit, ok := bulkMaxParams[dialect]
+		if !ok {
+			limit = bulkMaxParams[DialectSQLServer]
+		}
+		batches = batchTableParam(params[0], (limit-len(args))/len(params[0].Columns))
+	}
+
+	var total tableParamResult
+	for _, batch := range batches {
+		q, a := ExpandTableParams(dialect, query, args, batch...)
+		result, err := db.ExecContext(ctx, q, a...)
+		if err != nil {
+			return nil, err
+		}
+		if n, err := result.RowsAffected(); err == nil {
+			total.rows += n
+		}
+		total.last = result
+	}
+	return total, nil
+}
+
+// QueryTableParams runs a query that reads table-valued parameters.
+func QueryTableParams(ctx context.Context, db DBTX, dialect Dialect, query string, params []TableParam, args ...interface{}) (*sql.Rows, error) {
+	q, a := ExpandTableParams(dialect, query, args, params...)
+	return db.QueryContext(ctx, q, a...)
+}
+
+// QueryRowTableParams runs a single-row query that reads table-valued
+// parameters.
+func QueryRowTableParams(ctx context.Context, db DBTX, dialect Dialect, query string, params []TableParam, args ...interface{}) *sql.Row {
+	q, a := ExpandTableParams(dialect, query, args, params...)
+	return db.QueryRowContext(ctx, q, a...)
+}
+
+// batchTableParam splits p into parameters of at most size rows. A
+// parameter with no rows is a single empty batch.
+func batchTableParam(p TableParam, size int) [][]TableParam {
+	if size < 1 {
+		size = 1
+	}
+	if len(p.Rows) <= size {
+		return [][]TableParam{{p}}
+	}
+	var batches [][]TableParam
+	for start := 0; start < len(p.Rows); start += size {
+		end := min(start+size, len(p.Rows))
+		batch := p
+		batch.Rows = p.Rows[start:end]
+		batches = append(batches, []TableParam{batch})
+	}
+	return batches
+}
+
+// tableParamResult adds up the rows affected by each batch.
+type tableParamResult struct {
+	rows int64
+	last sql.Result
+}
+
+func (r tableParamResult) LastInsertId() (int64, error) {
+	if r.last == nil {
+		return 0, fmt.Errorf("no rows inserted")
+	}
+	return r.last.LastInsertId()
+}
+
+func (r tableParamResult) RowsAffected() (int64, error) {
+	return r.rows, nil
+}
+
+// tableAlias returns the alias following a table reference in rest, if
+// any, and what follows it.
+func tableAlias(rest string) (string, string) {
+	trimmed := strings.TrimLeft(rest, " \t\r\n")
+	word := func(s string) string {
+		end := 0
+		for end < len(s) && isIdentPart(s[end]) {
+			end++
+		}
+		return s[:end]
+	}
+	w := word(trimmed)
+	if strings.EqualFold(w, "AS") {
+		after := strings.TrimLeft(trimmed[len(w):], " \t\r\n")
+		if alias := word(after); alias != "" {
+			return alias, after[len(alias):]
+		}
+		return "", rest
+	}
+	if w == "" || !isIdentStart(w[0]) || tableAliasKeywords[strings.ToUpper(w)] {
+		return "", rest
+	}
+	return w, trimmed[len(w):]
+}
+
+// Keywords that can follow a table reference without an alias.
+var tableAliasKeywords = map[string]bool{
+	"WHERE": true, "JOIN": true, "INNER": true, "LEFT": true, "RIGHT": true,
+	"FULL": true, "CROSS": true, "OUTER": true, "ON": true, "GROUP": true,
+	"ORDER": true, "HAVING": true, "UNION": true, "EXCEPT": true,
+	"INTERSECT": true, "WITH": true, "OPTION": true, "FOR": true,
+	"LIMIT": true, "OFFSET": true, "WINDOW": true, "RETURNING": true,
+}
+
+// numberedPlaceholders reports whether dialect numbers its placeholders,
+// rather than binding ? in order.
+func numberedPlaceholders(dialect Dialect) bool {
+	return dialect != DialectMySQL && dialect != DialectSQLite
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9')
+}
+
+// postgresArray formats values as a postgres array literal, e.g.
+// {"1","2",NULL}. Nil values and nil pointers are NULL.
+func postgresArray(values []interface{}) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, v := range values {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		s, ok := postgresArrayElement(v)
+		if !ok {
+			b.WriteString("NULL")
+			continue
+		}
+		b.WriteByte('"')
+		b.WriteString(strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// postgresArrayElement returns v in postgres text format, or false for NULL.
+func postgresArrayElement(v interface{}) (string, bool) {
+	if v == nil {
+		return "", false
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return "", false
+		}
+		return postgresArrayElement(rv.Elem().Interface())
+	}
+	if valuer, ok := v.(driver.Valuer); ok {
+		value, err := valuer.Value()
+		if err != nil || value == nil {
+			return "", false
+		}
+		v = value
+	}
+	switch x := v.(type) {
+	case string:
+		return x, true
+	case []byte:
+		return `\x` + hex.EncodeToString(x), true
+	case bool:
+		if x {
+			return "t", true
+		}
+		return "f", true
+	case time.Time:
+		return x.Format("2006-01-02 15:04:05.999999999Z07:00"), true
+	default:
+		return fmt.Sprint(x), true
+	}
+}
@@ -0,0 +1,120 @@
+package tsqlruntime
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func orderItems(rows ...[]interface{}) TableParam {
+	return TableParam{
+		Name:    "Items",
+		Columns: []string{"ProductID", "UnitPrice"},
+		Types:   []string{"integer", "numeric(18,2)"},
+		Rows:    rows,
+	}
+}
+
+func TestExpandTableParams(t *testing.T) {
+	price := decimal.RequireFromString("9.50")
+	items := orderItems(
+		[]interface{}{int32(1), &price},
+		[]interface{}{int32(2), (*decimal.Decimal)(nil)},
+	)
+
+	tests := []struct {
+		name      string
+		dialect   Dialect
+		query     string
+		args      []interface{}
+		wantQuery string
+		wantArgs  []interface{}
+	}{
+		{
+			name:      "postgres unnest",
+			dialect:   DialectPostgres,
+			query:     "INSERT INTO OrderItems (OrderID, ProductID) SELECT $1, ProductID FROM @Items",
+			args:      []interface{}{7},
+			wantQuery: "INSERT INTO OrderItems (OrderID, ProductID) SELECT $1, ProductID FROM unnest($2::text::integer[], $3::text::numeric(18,2)[]) AS Items(ProductID, UnitPrice)",
+			wantArgs:  []interface{}{7, `{"1","2"}`, `{"9.5",NULL}`},
+		},
+		{
+			name:      "postgres IN becomes ANY",
+			dialect:   DialectPostgres,
+			query:     "UPDATE Products SET Stock = $1 WHERE ID IN (SELECT ProductID FROM @Items) AND ID not in ( select distinct productid from @items ) AND Code IN (SELECT Code FROM @Items)",
+			args:      []interface{}{0},
+			wantQuery: "UPDATE Products SET Stock = $1 WHERE ID = ANY($2::text::integer[]) AND ID <> ALL($3::text::integer[]) AND Code IN (SELECT Code FROM unnest($4::text::integer[], $5::text::numeric(18,2)[]) AS Items(ProductID, UnitPrice))",
+			wantArgs:  []interface{}{0, `{"1","2"}`, `{"1","2"}`, `{"1","2"}`, `{"9.5",NULL}`},
+		},
+		{
+			name:      "sqlserver keeps alias",
+			dialect:   DialectSQLServer,
+			query:     "SELECT COUNT(*) FROM @items AS i WHERE i.ProductID > @p1",
+			args:      []interface{}{0},
+			wantQuery: "SELECT COUNT(*) FROM (SELECT @p2 AS ProductID, @p3 AS UnitPrice UNION ALL SELECT @p4, @p5) AS i WHERE i.ProductID > @p1",
+			wantArgs:  []interface{}{0, int32(1), &price, int32(2), (*decimal.Decimal)(nil)},
+		},
+		{
+			name:      "mysql placeholders in order",
+			dialect:   DialectMySQL,
+			query:     "SELECT ? , ProductID FROM @Items i JOIN Products p ON p.ID = i.ProductID WHERE p.Name <> '@Items' AND p.Active = ?",
+			args:      []interface{}{"a", true},
+			wantQuery: "SELECT ? , ProductID FROM (SELECT ? AS ProductID, ? AS UnitPrice UNION ALL SELECT ?, ?) AS i JOIN Products p ON p.ID = i.ProductID WHERE p.Name <> '@Items' AND p.Active = ?",
+			wantArgs:  []interface{}{"a", int32(1), &price, int32(2), (*decimal.Decimal)(nil), true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, args := ExpandTableParams(tt.dialect, tt.query, tt.args, items)
+			if query != tt.wantQuery {
+				t.Errorf("query:\n got %s\nwant %s", query, tt.wantQuery)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("args: got %v, want %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestExpandTableParamsEmpty(t *testing.T) {
+	query, args := ExpandTableParams(DialectSQLite, "SELECT COUNT(*) FROM @Items", nil, orderItems())
+	if want := "SELECT COUNT(*) FROM (SELECT NULL AS ProductID, NULL AS UnitPrice WHERE 1 = 0) AS Items"; query != want {
+		t.Errorf("got %s, want %s", query, want)
+	}
+	if len(args) != 0 {
+		t.Errorf("expected no args, got %v", args)
+	}
+
+	query, args = ExpandTableParams(DialectPostgres, "SELECT COUNT(*) FROM @Items", nil, orderItems())
+	if want := "SELECT COUNT(*) FROM unnest($1::text::integer[], $2::text::numeric(18,2)[]) AS Items(ProductID, UnitPrice)"; query != want {
+		t.Errorf("got %s, want %s", query, want)
+	}
+	if !reflect.DeepEqual(args, []interface{}{"{}", "{}"}) {
+		t.Errorf("unexpected args %v", args)
+	}
+}
+
+func TestBatchTableParam(t *testing.T) {
+	var rows [][]interface{}
+	for i := 0; i < 5; i++ {
+		rows = append(rows, []interface{}{i, nil})
+	}
+	batches := batchTableParam(orderItems(rows...), 2)
+	if len(batches) != 3 {
+		t.Fatalf("expected 3 batches, got %d", len(batches))
+	}
+	if n := len(batches[2][0].Rows); n != 1 {
+		t.Errorf("expected 1 row in the last batch, got %d", n)
+	}
+	if batches := batchTableParam(orderItems(), 2); len(batches) != 1 {
+		t.Errorf("expected one batch for no rows, got %d", len(batches))
+	}
+}
+
+func TestPostgresArray(t *testing.T) {
+	got := postgresArray([]interface{}{`a"b\c`, []byte{1, 255}, false, nil})
+	if want := `{"a\"b\\c","\\x01ff","f",NULL}`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
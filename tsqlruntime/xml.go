@@ -366,10 +366,11 @@ const (
 // ForXMLOptions holds options for FOR XML clause
 type ForXMLOptions struct {
 	Mode        ForXMLMode
-	ElementName string // For RAW('name') or PATH('name')
-	RootName    string // ROOT('name')
-	Elements    bool   // ELEMENTS option
-	XSINil      bool   // XSINIL option
+	ElementName string   // For RAW('name') or PATH('name')
+	RootName    string   // ROOT('name')
+	Elements    bool     // ELEMENTS option
+	XSINil      bool     // XSINIL option
+	Attributes  []string // With Elements, columns written as attributes (PATH's '@name')
 }
 
 // ForXML converts rows to XML format
@@ -397,9 +398,23 @@ func ForXML(columns []string, rows [][]Value, options ForXMLOptions) (string, er
 		builder.WriteString(elementName)
 
 		if options.Elements {
+			isAttribute := make(map[string]bool, len(options.Attributes))
+			for _, name := range options.Attributes {
+				isAttribute[name] = true
+			}
+			for i, col := range columns {
+				if i >= len(row) || !isAttribute[col] || row[i].IsNull {
+					continue
+				}
+				builder.WriteString(" ")
+				builder.WriteString(col)
+				builder.WriteString("=\"")
+				builder.WriteString(xmlEscape(row[i].AsString()))
+				builder.WriteString("\"")
+			}
 			builder.WriteString(">")
 			for i, col := range columns {
-				if i >= len(row) {
+				if i >= len(row) || isAttribute[col] {
 					continue
 				}
 				val := row[i]
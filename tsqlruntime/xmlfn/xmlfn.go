@@ -0,0 +1,562 @@
+// Package xmlfn implements the methods of the T-SQL xml type (value,
+// query, exist and nodes) and OPENXML for generated code, over
+// encoding/xml.
+//
+// Paths are the XPath subset procedures use: absolute and relative
+// steps, //, ., .., *, @attr, @*, text() and node(), predicates with a
+// position, last(), a path or a path compared with a literal, unions with
+// |, a parenthesised path with a position, as in (/Order/ID)[1], and
+// count(), string() and data() around a path. Namespace prefixes are
+// ignored, so a:Order matches Order in any namespace.
+//
+// Where T-SQL returns NULL, such as value() of a path matching nothing,
+// the functions return "". value() takes the first node a path matches
+// instead of requiring a singleton.
+package xmlfn
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type kind int
+
+const (
+	documentNode kind = iota
+	elementNode
+	attributeNode
+	textNode
+)
+
+// Node is a node of a parsed document: the document itself, an element,
+// an attribute or text.
+type Node struct {
+	kind     kind
+	name     string // Local name of an element or attribute
+	value    string // Value of an attribute or text
+	attrs    []*Node
+	children []*Node
+	parent   *Node
+	order    int // Position in document order
+}
+
+// Parse parses an XML document or fragment.
+func Parse(doc string) (*Node, error) {
+	root := &Node{kind: documentNode}
+	cur := root
+	order := 0
+	add := func(parent, n *Node) {
+		order++
+		n.order = order
+		n.parent = parent
+		parent.children = append(parent.children, n)
+	}
+	d := xml.NewDecoder(strings.NewReader(doc))
+	d.Strict = true
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parsing XML: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			el := &Node{kind: elementNode, name: t.Name.Local}
+			add(cur, el)
+			for _, a := range t.Attr {
+				if a.Name.Space == "xmlns" || (a.Name.Space == "" && a.Name.Local == "xmlns") {
+					continue
+				}
+				order++
+				el.attrs = append(el.attrs, &Node{kind: attributeNode, name: a.Name.Local, value: a.Value, parent: el, order: order})
+			}
+			cur = el
+		case xml.EndElement:
+			cur = cur.parent
+		case xml.CharData:
+			if strings.TrimSpace(string(t)) == "" {
+				continue
+			}
+			add(cur, &Node{kind: textNode, value: string(t)})
+		}
+	}
+	return root, nil
+}
+
+// Value returns the text of the first node path matches in doc, as
+// doc.value(path, type) does before the conversion to type. It returns ""
+// if doc isn't well-formed.
+func Value(doc, path string) string {
+	n, err := Parse(doc)
+	if err != nil {
+		return ""
+	}
+	return n.Value(path)
+}
+
+// Query returns the nodes path matches in doc as XML, as doc.query(path)
+// does. It returns "" if doc isn't well-formed.
+func Query(doc, path string) string {
+	n, err := Parse(doc)
+	if err != nil {
+		return ""
+	}
+	return n.Query(path)
+}
+
+// Exist reports whether path matches any node in doc, as
+// doc.exist(path) = 1 does. It returns false if doc isn't well-formed.
+func Exist(doc, path string) bool {
+	n, err := Parse(doc)
+	if err != nil {
+		return false
+	}
+	return n.Exist(path)
+}
+
+// Nodes returns the nodes path matches in doc, a row each, as
+// doc.nodes(path) does. Unlike the other functions it returns an error
+// if doc isn't well-formed, as it is called as a statement.
+func Nodes(doc, path string) ([]*Node, error) {
+	n, err := Parse(doc)
+	if err != nil {
+		return nil, err
+	}
+	return n.Nodes(path), nil
+}
+
+// Value returns the text of the first node path matches from n, or the
+// result of count(), string() or data().
+func (n *Node) Value(path string) string {
+	path = strings.TrimSpace(path)
+	if fn, arg, ok := pathFunction(path); ok {
+		nodes := n.Nodes(arg)
+		switch fn {
+		case "count":
+			return strconv.Itoa(len(nodes))
+		default: // string, data
+			if len(nodes) == 0 {
+				return ""
+			}
+			return nodes[0].Text()
+		}
+	}
+	nodes := n.Nodes(path)
+	if len(nodes) == 0 {
+		return ""
+	}
+	return nodes[0].Text()
+}
+
+// Query returns the nodes path matches from n as XML.
+func (n *Node) Query(path string) string {
+	var b strings.Builder
+	for _, m := range n.Nodes(path) {
+		m.write(&b)
+	}
+	return b.String()
+}
+
+// Exist reports whether path matches any node from n.
+func (n *Node) Exist(path string) bool {
+	return len(n.Nodes(path)) > 0
+}
+
+// Nodes returns the nodes path matches from n, in document order.
+func (n *Node) Nodes(path string) []*Node {
+	return evalPath([]*Node{n}, strings.TrimSpace(path))
+}
+
+// Text returns the string value of n: the text it contains, or the value
+// of an attribute.
+func (n *Node) Text() string {
+	switch n.kind {
+	case attributeNode, textNode:
+		return n.value
+	}
+	var b strings.Builder
+	var walk func(*Node)
+	walk = func(m *Node) {
+		for _, c := range m.children {
+			if c.kind == textNode {
+				b.WriteString(c.value)
+			} else {
+				walk(c)
+			}
+		}
+	}
+	walk(n)
+	return b.String()
+}
+
+// String returns n as XML.
+func (n *Node) String() string {
+	var b strings.Builder
+	n.write(&b)
+	return b.String()
+}
+
+func (n *Node) write(b *strings.Builder) {
+	switch n.kind {
+	case documentNode:
+		for _, c := range n.children {
+			c.write(b)
+		}
+	case attributeNode, textNode:
+		xml.EscapeText(b, []byte(n.value))
+	case elementNode:
+		b.WriteString("<" + n.name)
+		for _, a := range n.attrs {
+			b.WriteString(" " + a.name + `="`)
+			xml.EscapeText(b, []byte(a.value))
+			b.WriteString(`"`)
+		}
+		if len(n.children) == 0 {
+			b.WriteString("/>")
+			return
+		}
+		b.WriteString(">")
+		for _, c := range n.children {
+			c.write(b)
+		}
+		b.WriteString("</" + n.name + ">")
+	}
+}
+
+func (n *Node) root() *Node {
+	for n.parent != nil {
+		n = n.parent
+	}
+	return n
+}
+
+// pathFunction splits count(path), string(path) and data(path).
+func pathFunction(path string) (string, string, bool) {
+	for _, fn := range []string{"count", "string", "data"} {
+		if strings.HasPrefix(path, fn+"(") && strings.HasSuffix(path, ")") && closing(path, len(fn)) == len(path)-1 {
+			return fn, path[len(fn)+1 : len(path)-1], true
+		}
+	}
+	return "", "", false
+}
+
+// evalPath evaluates a path from each of the context nodes.
+func evalPath(ctx []*Node, path string) []*Node {
+	if path == "" || len(ctx) == 0 {
+		return nil
+	}
+	if parts := splitTop(path, '|'); len(parts) > 1 {
+		var all []*Node
+		for _, p := range parts {
+			all = append(all, evalPath(ctx, strings.TrimSpace(p))...)
+		}
+		return documentOrder(all)
+	}
+
+	// (path)[n]/rest: the predicates apply to everything path matches
+	if path[0] == '(' {
+		end := closing(path, 0)
+		if end < 0 {
+			return nil
+		}
+		nodes := evalPath(ctx, path[1:end])
+		rest := path[end+1:]
+		for strings.HasPrefix(rest, "[") {
+			close := closing(rest, 0)
+			if close < 0 {
+				return nil
+			}
+			nodes = filter(nodes, rest[1:close])
+			rest = rest[close+1:]
+		}
+		if rest == "" {
+			return nodes
+		}
+		return evalPath(nodes, strings.TrimPrefix(rest, "/"))
+	}
+
+	descendant := false
+	if strings.HasPrefix(path, "/") {
+		ctx = []*Node{ctx[0].root()}
+		path = path[1:]
+		if strings.HasPrefix(path, "/") {
+			descendant = true
+			path = path[1:]
+		}
+		if path == "" {
+			return ctx
+		}
+	}
+	steps := splitTop(path, '/')
+	for _, step := range steps {
+		if step == "" {
+			descendant = true
+			continue
+		}
+		var next []*Node
+		for _, c := range ctx {
+			next = append(next, evalStep(c, strings.TrimSpace(step), descendant)...)
+		}
+		ctx = documentOrder(next)
+		descendant = false
+	}
+	return ctx
+}
+
+// evalStep evaluates one step, with its predicates, from a context node.
+func evalStep(ctx *Node, step string, descendant bool) []*Node {
+	test, preds := step, ""
+	if i := strings.IndexByte(step, '['); i >= 0 {
+		test, preds = step[:i], step[i:]
+	}
+	var candidates []*Node
+	switch {
+	case test == ".":
+		candidates = []*Node{ctx}
+	case test == "..":
+		if ctx.parent != nil {
+			candidates = []*Node{ctx.parent}
+		}
+	case strings.HasPrefix(test, "@"):
+		name := localName(test[1:])
+		from := []*Node{ctx}
+		if descendant {
+			from = append(from, descendants(ctx)...)
+		}
+		for _, n := range from {
+			for _, a := range n.attrs {
+				if name == "*" || a.name == name {
+					candidates = append(candidates, a)
+				}
+			}
+		}
+	default:
+		from := ctx.children
+		if descendant {
+			from = descendants(ctx)
+		}
+		name := localName(test)
+		for _, n := range from {
+			switch {
+			case name == "node()":
+				candidates = append(candidates, n)
+			case name == "text()":
+				if n.kind == textNode {
+					candidates = append(candidates, n)
+				}
+			case n.kind == elementNode && (name == "*" || n.name == name):
+				candidates = append(candidates, n)
+			}
+		}
+	}
+	for preds != "" {
+		close := closing(preds, 0)
+		if close < 0 {
+			return nil
+		}
+		candidates = filter(candidates, preds[1:close])
+		preds = preds[close+1:]
+	}
+	return candidates
+}
+
+// filter applies a predicate to nodes.
+func filter(nodes []*Node, pred string) []*Node {
+	pred = strings.TrimSpace(pred)
+	if pred == "last()" {
+		if len(nodes) == 0 {
+			return nil
+		}
+		return nodes[len(nodes)-1:]
+	}
+	if i, err := strconv.Atoi(pred); err == nil {
+		if i < 1 || i > len(nodes) {
+			return nil
+		}
+		return nodes[i-1 : i]
+	}
+	var kept []*Node
+	for _, n := range nodes {
+		if test(n, pred) {
+			kept = append(kept, n)
+		}
+	}
+	return kept
+}
+
+// test evaluates a predicate other than a position for a node: a path,
+// which must match something, or a path compared with a literal.
+func test(n *Node, pred string) bool {
+	for _, op := range []string{"!=", ">=", "<=", "=", ">", "<"} {
+		i := indexTop(pred, op)
+		if i < 0 {
+			continue
+		}
+		left := strings.TrimSpace(pred[:i])
+		right := strings.TrimSpace(pred[i+len(op):])
+		lit, ok := literal(right)
+		if !ok {
+			return false
+		}
+		for _, m := range evalPath([]*Node{n}, left) {
+			if compare(m.Text(), op, lit) {
+				return true
+			}
+		}
+		return false
+	}
+	return len(evalPath([]*Node{n}, pred)) > 0
+}
+
+func literal(s string) (string, bool) {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1], true
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return s, true
+	}
+	return "", false
+}
+
+// compare compares numerically when both sides are numbers.
+func compare(a, op, b string) bool {
+	c := strings.Compare(a, b)
+	x, errA := strconv.ParseFloat(strings.TrimSpace(a), 64)
+	y, errB := strconv.ParseFloat(b, 64)
+	if errA == nil && errB == nil {
+		switch {
+		case x < y:
+			c = -1
+		case x > y:
+			c = 1
+		default:
+			c = 0
+		}
+	}
+	switch op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	case "<":
+		return c < 0
+	default:
+		return c <= 0
+	}
+}
+
+func descendants(n *Node) []*Node {
+	var all []*Node
+	for _, c := range n.children {
+		all = append(all, c)
+		all = append(all, descendants(c)...)
+	}
+	return all
+}
+
+func documentOrder(nodes []*Node) []*Node {
+	seen := map[*Node]bool{}
+	unique := nodes[:0:0]
+	for _, n := range nodes {
+		if !seen[n] {
+			seen[n] = true
+			unique = append(unique, n)
+		}
+	}
+	sort.SliceStable(unique, func(i, j int) bool { return unique[i].order < unique[j].order })
+	return unique
+}
+
+func localName(name string) string {
+	if i := strings.LastIndexByte(name, ':'); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
+
+// closing returns the index of the bracket closing the one at open,
+// skipping quoted literals, or -1.
+func closing(s string, open int) int {
+	depth := 0
+	var quote byte
+	for i := open; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(' || c == '[':
+			depth++
+		case c == ')' || c == ']':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// splitTop splits s on sep outside brackets and quoted literals.
+func splitTop(s string, sep byte) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '(' || c == '[':
+			end := closing(s, i)
+			if end < 0 {
+				return append(parts, s[start:])
+			}
+			i = end
+		case c == '"' || c == '\'':
+			if end := strings.IndexByte(s[i+1:], c); end >= 0 {
+				i += end + 1
+			}
+		case c == sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// indexTop returns the index of op in s outside brackets and quoted
+// literals, or -1.
+func indexTop(s, op string) int {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '(' || c == '[':
+			if end := closing(s, i); end >= 0 {
+				i = end
+			}
+		case c == '"' || c == '\'':
+			if end := strings.IndexByte(s[i+1:], c); end >= 0 {
+				i += end + 1
+			}
+		case strings.HasPrefix(s[i:], op):
+			// "<" and ">" must not be the start of "<=" or ">=", nor "=" the end of "!="
+			if len(op) == 1 && i+1 < len(s) && s[i+1] == '=' && op != "=" {
+				continue
+			}
+			if op == "=" && i > 0 && strings.IndexByte("!<>", s[i-1]) >= 0 {
+				continue
+			}
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,78 @@
+package xmlfn
+
+import "testing"
+
+const orders = `<Root xmlns:a="urn:a">
+  <Order id="1" status="Open"><ID>10</ID><Name>Ann &amp; Bo</Name><Total>25.50</Total></Order>
+  <Order id="2" status="Shipped"><ID>11</ID><Name>Cy</Name><Total>7</Total></Order>
+  <a:Note>first</a:Note>
+</Root>`
+
+func TestValue(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"(/Root/Order/ID)[1]", "10"},
+		{"(/Root/Order/ID)[2]", "11"},
+		{"(/Root/Order/@status)[last()]", "Shipped"},
+		{"/Root/Order[2]/Name", "Cy"},
+		{"(/Root/Order/Name)[1]", "Ann & Bo"},
+		{"/Root/Order[@id=\"2\"]/Total", "7"},
+		{"/Root/Order[Total > 10]/@id", "1"},
+		{"(//Name/text())[2]", "Cy"},
+		{"count(/Root/Order)", "2"},
+		{"count(//Order[@status='Open'])", "1"},
+		{"string((/Root/a:Note)[1])", "first"},
+		{"Root/Order/@id", "1"},
+		{"(/Root/Order/Missing)[1]", ""},
+	}
+	for _, tt := range tests {
+		if got := Value(orders, tt.path); got != tt.want {
+			t.Errorf("Value(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+	if got := Value("<Root>", "/Root"); got != "" {
+		t.Errorf("Value of a malformed document = %q, want \"\"", got)
+	}
+}
+
+func TestNodes(t *testing.T) {
+	rows, err := Nodes(orders, "/Root/Order")
+	if err != nil {
+		t.Fatalf("Nodes failed: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("Expected 2 rows, got %d", len(rows))
+	}
+	if got := rows[1].Value("(ID)[1]"); got != "11" {
+		t.Errorf("Relative value = %q, want 11", got)
+	}
+	if got := rows[0].Value("@status|status"); got != "Open" {
+		t.Errorf("Attribute or element = %q, want Open", got)
+	}
+	if got := rows[1].Value("."); got != "11Cy7" {
+		t.Errorf("Value(.) = %q, want 11Cy7", got)
+	}
+	if got := rows[0].Value("../Order[2]/@id"); got != "2" {
+		t.Errorf("Value(..) = %q, want 2", got)
+	}
+	if !rows[0].Exist("Total") || rows[0].Exist("Missing") {
+		t.Error("Exist is wrong")
+	}
+	if got := rows[1].String(); got != `<Order id="2" status="Shipped"><ID>11</ID><Name>Cy</Name><Total>7</Total></Order>` {
+		t.Errorf("String = %s", got)
+	}
+	if _, err := Nodes("<Root><Order></Root>", "/Root/Order"); err == nil {
+		t.Error("Expected an error for a malformed document")
+	}
+}
+
+func TestQueryExist(t *testing.T) {
+	if got := Query(orders, "/Root/Order[1]/Name"); got != "<Name>Ann &amp; Bo</Name>" {
+		t.Errorf("Query = %q", got)
+	}
+	if !Exist(orders, "/Root/Order[@status=\"Shipped\"]") || Exist(orders, "/Root/Customer") {
+		t.Error("Exist is wrong")
+	}
+}